@@ -0,0 +1,60 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// Attest handles device attestation requests. Devices don't have
+// credentials yet, so these requests are not authenticated. A device
+// requests a challenge at /v1/attest/challenge, signs it with its enrolled
+// key, and sends it to /v1/attest/verify to get NATS credentials that only
+// allow access to the device subtree.
+type Attest struct {
+	nc *nats.Conn
+}
+
+// NewAttestHandler returns a new attestation handler
+func NewAttestHandler(nc *nats.Conn) Attest {
+	return Attest{nc: nc}
+}
+
+// ServeHTTP serves attestation requests
+func (a Attest) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(res, "only POST allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var head string
+	head, req.URL.Path = ShiftPath(req.URL.Path)
+
+	var attestReq data.AttestRequest
+	if err := decode(req.Body, &attestReq); err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var resp data.AttestResponse
+	var err error
+
+	switch head {
+	case "challenge":
+		resp.Challenge, err = client.AttestChallenge(a.nc, attestReq.DeviceID)
+	case "verify":
+		resp.Creds, err = client.AttestVerify(a.nc, attestReq)
+	default:
+		http.Error(res, "Not Found", http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	encode(res, resp)
+}
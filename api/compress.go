@@ -0,0 +1,120 @@
+package api
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// compressWriter compresses a response with the encoding negotiated by
+// negotiateEncoding. Flush writes the compressed data that is buffered and
+// flushes the response, so it is sent as a chunk.
+type compressWriter struct {
+	res http.ResponseWriter
+	w   io.Writer
+	// nil if the response is not compressed
+	flush func() error
+	close func() error
+}
+
+// negotiateEncoding returns the Accept-Encoding of the request that is
+// preferred, zstd or gzip, or blank if neither is accepted. zstd is used if
+// both have the same q value.
+func negotiateEncoding(req *http.Request) string {
+	best := ""
+	bestQ := 0.0
+
+	for _, h := range req.Header.Values("Accept-Encoding") {
+		for _, e := range strings.Split(h, ",") {
+			name, params, _ := strings.Cut(strings.TrimSpace(e), ";")
+			name = strings.ToLower(strings.TrimSpace(name))
+
+			if name != "zstd" && name != "gzip" {
+				continue
+			}
+
+			q := 1.0
+			if params = strings.TrimSpace(params); strings.HasPrefix(params, "q=") {
+				var err error
+				q, err = strconv.ParseFloat(strings.TrimPrefix(params, "q="), 64)
+				if err != nil {
+					continue
+				}
+			}
+
+			if q > bestQ || (q == bestQ && name == "zstd") {
+				best, bestQ = name, q
+			}
+		}
+	}
+
+	return best
+}
+
+// newCompressWriter sets the Content-Encoding of the response. Compression
+// uses the fastest level and a 1MB zstd window, so that large exports do not
+// use much CPU or memory on the server.
+func newCompressWriter(res http.ResponseWriter, req *http.Request) (*compressWriter, error) {
+	ret := &compressWriter{res: res, w: res}
+
+	res.Header().Add("Vary", "Accept-Encoding")
+
+	encoding := negotiateEncoding(req)
+
+	switch encoding {
+	case "zstd":
+		zw, err := zstd.NewWriter(res,
+			zstd.WithEncoderLevel(zstd.SpeedFastest),
+			zstd.WithEncoderConcurrency(1),
+			zstd.WithWindowSize(1<<20))
+		if err != nil {
+			return nil, err
+		}
+		ret.w, ret.flush, ret.close = zw, zw.Flush, zw.Close
+	case "gzip":
+		zw, err := gzip.NewWriterLevel(res, gzip.BestSpeed)
+		if err != nil {
+			return nil, err
+		}
+		ret.w, ret.flush, ret.close = zw, zw.Flush, zw.Close
+	default:
+		return ret, nil
+	}
+
+	res.Header().Set("Content-Encoding", encoding)
+	res.Header().Del("Content-Length")
+
+	return ret, nil
+}
+
+func (c *compressWriter) Write(b []byte) (int, error) {
+	return c.w.Write(b)
+}
+
+// Flush sends the data written so far to the client
+func (c *compressWriter) Flush() error {
+	if c.flush != nil {
+		if err := c.flush(); err != nil {
+			return err
+		}
+	}
+
+	if f, ok := c.res.(http.Flusher); ok {
+		f.Flush()
+	}
+
+	return nil
+}
+
+// Close writes the end of the compressed stream
+func (c *compressWriter) Close() error {
+	if c.close != nil {
+		return c.close()
+	}
+
+	return nil
+}
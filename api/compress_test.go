@@ -0,0 +1,118 @@
+package api
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := []struct {
+		accept []string
+		exp    string
+	}{
+		{nil, ""},
+		{[]string{"gzip"}, "gzip"},
+		{[]string{"zstd"}, "zstd"},
+		{[]string{"gzip, zstd"}, "zstd"},
+		{[]string{"br, deflate"}, ""},
+		{[]string{"gzip;q=0"}, ""},
+		{[]string{"gzip;q=x"}, ""},
+		{[]string{"GZIP"}, "gzip"},
+		{[]string{"zstd;q=0.5, gzip"}, "gzip"},
+		{[]string{"gzip;q=0.8, zstd;q=0.8"}, "zstd"},
+		{[]string{"gzip; q=0.9", "zstd;q=0.1"}, "gzip"},
+		{[]string{"gzip, deflate, br, zstd;q=1.0"}, "zstd"},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		for _, a := range test.accept {
+			req.Header.Add("Accept-Encoding", a)
+		}
+
+		if e := negotiateEncoding(req); e != test.exp {
+			t.Errorf("%q: expected %q, got %q", test.accept, test.exp, e)
+		}
+	}
+}
+
+// decodeBody decompresses a response body with its Content-Encoding
+func decodeBody(encoding string, body io.Reader) ([]byte, error) {
+	switch encoding {
+	case "gzip":
+		r, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, err
+		}
+		return io.ReadAll(r)
+	case "zstd":
+		r, err := zstd.NewReader(body)
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return io.ReadAll(r)
+	default:
+		return io.ReadAll(body)
+	}
+}
+
+func TestCompressWriter(t *testing.T) {
+	data := bytes.Repeat([]byte("point data "), 10000)
+
+	for _, encoding := range []string{"", "gzip", "zstd"} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if encoding != "" {
+			req.Header.Set("Accept-Encoding", encoding)
+		}
+
+		res := httptest.NewRecorder()
+
+		w, err := newCompressWriter(res, req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// flushed data is sent before the rest is written
+		w.Write(data[:100])
+		if err := w.Flush(); err != nil {
+			t.Fatal(encoding, ": flush: ", err)
+		}
+
+		if res.Body.Len() == 0 || !res.Flushed {
+			t.Error(encoding, ": data not flushed")
+		}
+
+		w.Write(data[100:])
+		if err := w.Close(); err != nil {
+			t.Fatal(encoding, ": close: ", err)
+		}
+
+		if e := res.Header().Get("Content-Encoding"); e != encoding {
+			t.Errorf("%q: wrong Content-Encoding: %q", encoding, e)
+		}
+
+		if res.Header().Get("Vary") != "Accept-Encoding" {
+			t.Errorf("%q: Vary not set", encoding)
+		}
+
+		if encoding != "" && res.Body.Len() >= len(data) {
+			t.Errorf("%q: body not compressed", encoding)
+		}
+
+		d, err := decodeBody(encoding, res.Body)
+		if err != nil {
+			t.Fatal(encoding, ": decode: ", err)
+		}
+
+		if !bytes.Equal(d, data) {
+			t.Errorf("%q: round trip does not match", encoding)
+		}
+	}
+}
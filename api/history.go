@@ -0,0 +1,291 @@
+package api
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// History exports are requested from the history backends in chunks of
+// historyChunk, and each chunk is sent to the client before the next one is
+// requested, so long time ranges are not held in memory.
+const historyChunk = 24 * time.Hour
+
+// historyMaxPoints is the max number of points of a history export, and the
+// default limit
+var historyMaxPoints = 5000000
+
+// historyMaxExports is the max number of history exports that run at once
+const historyMaxExports = 4
+
+// historyExports limits the history exports that run at once
+var historyExports = make(chan struct{}, historyMaxExports)
+
+// history trailers, set if an export does not complete
+const (
+	historyTrailerError     = "Siot-Export-Error"
+	historyTrailerTruncated = "Siot-Export-Truncated"
+)
+
+// historyEncoder writes the points of a history export
+type historyEncoder interface {
+	encode(points data.Points) error
+	end() error
+}
+
+type historyJSON struct {
+	w     *compressWriter
+	first bool
+}
+
+func (e *historyJSON) encode(points data.Points) error {
+	for _, p := range points {
+		sep := ","
+		if e.first {
+			sep = "["
+			e.first = false
+		}
+
+		b, err := json.Marshal(p)
+		if err != nil {
+			return err
+		}
+
+		if _, err := e.w.Write(append([]byte(sep), b...)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (e *historyJSON) end() error {
+	end := "]\n"
+	if e.first {
+		end = "[]\n"
+	}
+
+	_, err := e.w.Write([]byte(end))
+	return err
+}
+
+type historyCSV struct {
+	w *csv.Writer
+}
+
+func newHistoryCSV(w *compressWriter) (*historyCSV, error) {
+	ret := &historyCSV{w: csv.NewWriter(w)}
+	return ret, ret.w.Write([]string{"time", "type", "key", "value", "text"})
+}
+
+func (e *historyCSV) encode(points data.Points) error {
+	for _, p := range points {
+		err := e.w.Write([]string{
+			p.Time.Format(time.RFC3339Nano),
+			p.Type,
+			p.Key,
+			strconv.FormatFloat(p.Value, 'f', -1, 64),
+			p.Text,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	e.w.Flush()
+	return e.w.Error()
+}
+
+func (e *historyCSV) end() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// historyChunks splits the time range of a history query into queries of
+// historyChunk. Chunks are a multiple of the window, so that windows are not
+// split. Aggregates without a window are over the whole range, so the query
+// is not split.
+func historyChunks(q data.HistoryQuery) []data.HistoryQuery {
+	if q.Aggregate != "" && q.Window <= 0 {
+		return []data.HistoryQuery{q}
+	}
+
+	chunk := historyChunk
+	if q.Window > 0 {
+		chunk = (chunk + q.Window - 1) / q.Window * q.Window
+	}
+
+	var ret []data.HistoryQuery
+
+	for start := q.Start; start.Before(q.End); start = start.Add(chunk) {
+		c := q
+		c.Start = start
+		// the end of queries is inclusive, so points at the start of
+		// the next chunk are not returned twice
+		if end := start.Add(chunk); end.Before(q.End) {
+			c.End = end.Add(-time.Nanosecond)
+		}
+		ret = append(ret, c)
+	}
+
+	if len(ret) == 0 {
+		ret = append(ret, q)
+	}
+
+	return ret
+}
+
+// history handles /v1/nodes/:id/history. The response is streamed, and
+// compressed with gzip or zstd if the client accepts it. format is json
+// (default) or csv, and limit is the max number of points, at most
+// historyMaxPoints. Errors after the first points are sent, and truncation
+// at the limit, are reported in trailers.
+func (h *Nodes) history(res http.ResponseWriter, req *http.Request, id string) {
+	if req.Method != http.MethodGet {
+		http.Error(res, "only GET allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	v := req.URL.Query()
+
+	q, err := parseHistoryQuery(v)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	format := v.Get("format")
+	if format != "" && format != "json" && format != "csv" {
+		http.Error(res, "format must be json or csv", http.StatusBadRequest)
+		return
+	}
+
+	limit := historyMaxPoints
+	if l := v.Get("limit"); l != "" {
+		limit, err = strconv.Atoi(l)
+		if err != nil || limit <= 0 || limit > historyMaxPoints {
+			http.Error(res, fmt.Sprintf("limit must be 1 to %v", historyMaxPoints),
+				http.StatusBadRequest)
+			return
+		}
+	}
+
+	select {
+	case historyExports <- struct{}{}:
+		defer func() { <-historyExports }()
+	default:
+		res.Header().Set("Retry-After", "10")
+		http.Error(res, "too many history exports", http.StatusServiceUnavailable)
+		return
+	}
+
+	chunks := historyChunks(q)
+
+	// errors of the first chunk are returned with an error status, as the
+	// response has not started
+	points, err := client.GetHistory(h.nc, id, chunks[0])
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if format == "csv" {
+		res.Header().Set("Content-Type", "text/csv")
+		res.Header().Set("Content-Disposition",
+			fmt.Sprintf("attachment; filename=\"%v-history.csv\"", id))
+	} else {
+		res.Header().Set("Content-Type", "application/json")
+	}
+
+	res.Header().Set("Trailer", historyTrailerError+", "+historyTrailerTruncated)
+
+	w, err := newCompressWriter(res, req)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var enc historyEncoder
+	if format == "csv" {
+		enc, err = newHistoryCSV(w)
+	} else {
+		enc = &historyJSON{w: w, first: true}
+	}
+
+	if err == nil {
+		err = h.streamHistory(w, enc, id, chunks, points, limit)
+	}
+
+	if err == nil {
+		err = enc.end()
+	}
+
+	if cErr := w.Close(); err == nil {
+		err = cErr
+	}
+
+	if err != nil {
+		log.Printf("Error exporting history of %v: %v", id, err)
+		res.Header().Set(historyTrailerError, err.Error())
+	}
+}
+
+// streamHistory writes the points of each chunk, requesting the next chunk
+// after the previous one was sent. Annotations are included once.
+func (h *Nodes) streamHistory(w *compressWriter, enc historyEncoder, id string,
+	chunks []data.HistoryQuery, points data.Points, limit int) error {
+	annotations := make(map[string]bool)
+	count := 0
+
+	for i := range chunks {
+		if i > 0 {
+			var err error
+			points, err = client.GetHistory(h.nc, id, chunks[i])
+			if err != nil {
+				return err
+			}
+		}
+
+		send := make(data.Points, 0, len(points))
+
+		for _, p := range points.Mask() {
+			if p.Type == data.PointTypeAnnotation {
+				if annotations[p.Key] {
+					continue
+				}
+				annotations[p.Key] = true
+			}
+
+			send = append(send, p)
+		}
+
+		truncated := false
+		if count+len(send) > limit {
+			send = send[:limit-count]
+			truncated = true
+		}
+		count += len(send)
+
+		if err := enc.encode(send); err != nil {
+			return err
+		}
+
+		if truncated {
+			w.res.Header().Set(historyTrailerTruncated, "true")
+			return nil
+		}
+
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,432 @@
+package api
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	natsserver "github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+	"github.com/simpleiot/simpleiot/internal/pb"
+	"google.golang.org/protobuf/proto"
+)
+
+var historyTestStart = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func TestHistoryChunks(t *testing.T) {
+	s := historyTestStart
+	day := 24 * time.Hour
+
+	type chunk struct{ start, end time.Duration }
+
+	tests := []struct {
+		name string
+		q    data.HistoryQuery
+		exp  []chunk
+	}{
+		{"days", data.HistoryQuery{Start: s, End: s.Add(3 * day)},
+			[]chunk{{0, day - 1}, {day, 2*day - 1}, {2 * day, 3 * day}}},
+		{"partial day", data.HistoryQuery{Start: s, End: s.Add(30 * time.Hour)},
+			[]chunk{{0, day - 1}, {day, 30 * time.Hour}}},
+		{"window", data.HistoryQuery{Start: s, End: s.Add(60 * time.Hour),
+			Window: 5 * time.Hour, Aggregate: "mean"},
+			[]chunk{{0, 25*time.Hour - 1}, {25 * time.Hour, 50*time.Hour - 1},
+				{50 * time.Hour, 60 * time.Hour}}},
+		{"window divides chunk", data.HistoryQuery{Start: s, End: s.Add(day),
+			Window: time.Hour, Aggregate: "max"},
+			[]chunk{{0, day}}},
+		{"aggregate without window", data.HistoryQuery{Start: s, End: s.Add(3 * day),
+			Aggregate: "mean"},
+			[]chunk{{0, 3 * day}}},
+		{"empty range", data.HistoryQuery{Start: s, End: s},
+			[]chunk{{0, 0}}},
+	}
+
+	for _, test := range tests {
+		chunks := historyChunks(test.q)
+
+		if len(chunks) != len(test.exp) {
+			t.Errorf("%v: expected %v chunks, got %v", test.name, len(test.exp),
+				len(chunks))
+			continue
+		}
+
+		for i, c := range chunks {
+			exp := test.exp[i]
+			if !c.Start.Equal(s.Add(exp.start)) || !c.End.Equal(s.Add(exp.end)) {
+				t.Errorf("%v: chunk %v: expected %v to %v, got %v to %v", test.name,
+					i, exp.start, exp.end, c.Start.Sub(s), c.End.Sub(s))
+			}
+
+			if c.Window != test.q.Window || c.Aggregate != test.q.Aggregate {
+				t.Errorf("%v: chunk %v: query not copied", test.name, i)
+			}
+		}
+	}
+}
+
+// historyTest runs the history handler with a history backend that returns
+// a point at every hour of the query range
+type historyTest struct {
+	url string
+	// backend returns an error for queries if set
+	fail func(q data.HistoryQuery) error
+	// queries are blocked until release is closed, if set
+	release chan struct{}
+	lock    sync.Mutex
+	queries []data.HistoryQuery
+}
+
+// startTestNats starts a NATS server and returns a connection to it
+func startTestNats(t *testing.T) *nats.Conn {
+	ns, err := natsserver.NewServer(&natsserver.Options{Port: -1, NoSigs: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go ns.Start()
+	t.Cleanup(ns.Shutdown)
+
+	if !ns.ReadyForConnections(5 * time.Second) {
+		t.Fatal("NATS server not ready")
+	}
+
+	nc, err := nats.Connect(ns.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(nc.Close)
+
+	return nc
+}
+
+// respondNodes responds to node requests for id with nodes
+func respondNodes(t *testing.T, nc *nats.Conn, id string, nodes data.Nodes) {
+	_, err := nc.Subscribe("node."+id, func(msg *nats.Msg) {
+		pbNodes, err := nodes.ToPbNodes()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		d, err := proto.Marshal(&pb.NodesRequest{Nodes: pbNodes})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		msg.Respond(d)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func startHistoryTest(t *testing.T) *historyTest {
+	nc := startTestNats(t)
+
+	// node requests for annotations (see client.GetHistory)
+	respondNodes(t, nc, "dev", data.Nodes{{ID: "dev", Type: data.NodeTypeDevice}})
+
+	ht := &historyTest{}
+
+	_, err := nc.Subscribe(client.SubjectHistory("*"), func(msg *nats.Msg) {
+		id, q, err := client.DecodeHistoryMsg(msg)
+		if err != nil {
+			client.RespondHistory(msg, id, nil, err)
+			return
+		}
+
+		ht.lock.Lock()
+		ht.queries = append(ht.queries, q)
+		release, fail := ht.release, ht.fail
+		ht.lock.Unlock()
+
+		if release != nil {
+			<-release
+		}
+
+		if fail != nil {
+			if err := fail(q); err != nil {
+				client.RespondHistory(msg, id, nil, err)
+				return
+			}
+		}
+
+		var pts data.Points
+		for tm := q.Start.Truncate(time.Hour); !tm.After(q.End); tm = tm.Add(time.Hour) {
+			if !tm.Before(q.Start) {
+				pts = append(pts, data.Point{Time: tm, Type: data.PointTypeValue,
+					Value: float64(tm.Unix())})
+			}
+		}
+
+		client.RespondHistory(msg, id, pts, nil)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := &Nodes{nc: nc}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		h.history(res, req, "dev")
+	}))
+	t.Cleanup(srv.Close)
+
+	ht.url = srv.URL
+
+	return ht
+}
+
+func (ht *historyTest) setFail(fail func(q data.HistoryQuery) error) {
+	ht.lock.Lock()
+	ht.fail = fail
+	ht.lock.Unlock()
+}
+
+func (ht *historyTest) queryCount() int {
+	ht.lock.Lock()
+	defer ht.lock.Unlock()
+	return len(ht.queries)
+}
+
+// get requests an export of the range starting at historyTestStart. The
+// body is decompressed, and the trailers are set in the response.
+func (ht *historyTest) get(t *testing.T, r time.Duration, params, encoding string) (*http.Response, []byte) {
+	v := url.Values{}
+	v.Set("start", historyTestStart.Format(time.RFC3339))
+	v.Set("end", historyTestStart.Add(r).Format(time.RFC3339))
+
+	req, err := http.NewRequest(http.MethodGet, ht.url+"?"+v.Encode()+params, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if encoding != "" {
+		req.Header.Set("Accept-Encoding", encoding)
+	}
+
+	c := &http.Client{Transport: &http.Transport{DisableCompression: true}}
+	res, err := c.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	body, err := decodeBody(res.Header.Get("Content-Encoding"), res.Body)
+	if err != nil {
+		t.Fatal("Error reading body: ", err)
+	}
+
+	return res, body
+}
+
+// checkHourly checks that points are at every hour from historyTestStart
+func checkHourly(t *testing.T, name string, times []time.Time, count int) {
+	t.Helper()
+
+	if len(times) != count {
+		t.Errorf("%v: expected %v points, got %v", name, count, len(times))
+		return
+	}
+
+	for i, tm := range times {
+		if exp := historyTestStart.Add(time.Duration(i) * time.Hour); !tm.Equal(exp) {
+			t.Errorf("%v: point %v: expected %v, got %v", name, i, exp, tm)
+			return
+		}
+	}
+}
+
+func jsonTimes(t *testing.T, body []byte) []time.Time {
+	var pts []data.Point
+	err := json.Unmarshal(body, &pts)
+	if err != nil {
+		t.Fatal("Error decoding JSON: ", err)
+	}
+
+	ret := make([]time.Time, len(pts))
+	for i, p := range pts {
+		ret[i] = p.Time
+	}
+	return ret
+}
+
+func TestHistoryExport(t *testing.T) {
+	ht := startHistoryTest(t)
+
+	for _, encoding := range []string{"", "gzip", "zstd"} {
+		start := ht.queryCount()
+
+		res, body := ht.get(t, 72*time.Hour, "", encoding)
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("%q: status %v: %s", encoding, res.StatusCode, body)
+		}
+
+		if e := res.Header.Get("Content-Encoding"); e != encoding {
+			t.Errorf("%q: wrong Content-Encoding %q", encoding, e)
+		}
+
+		// 3 daily chunks, and the end of the range is included once
+		checkHourly(t, encoding, jsonTimes(t, body), 73)
+
+		if n := ht.queryCount() - start; n != 3 {
+			t.Errorf("%q: expected 3 chunk queries, got %v", encoding, n)
+		}
+
+		if res.Trailer.Get(historyTrailerError) != "" ||
+			res.Trailer.Get(historyTrailerTruncated) != "" {
+			t.Errorf("%q: unexpected trailers: %v", encoding, res.Trailer)
+		}
+	}
+
+	res, body := ht.get(t, 48*time.Hour, "&format=csv", "gzip")
+	if res.StatusCode != http.StatusOK ||
+		!strings.HasPrefix(res.Header.Get("Content-Type"), "text/csv") {
+		t.Fatalf("csv: status %v, type %v", res.StatusCode, res.Header.Get("Content-Type"))
+	}
+
+	records, err := csv.NewReader(strings.NewReader(string(body))).ReadAll()
+	if err != nil {
+		t.Fatal("Error decoding CSV: ", err)
+	}
+
+	if len(records) < 1 || strings.Join(records[0], ",") != "time,type,key,value,text" {
+		t.Fatal("CSV header not correct: ", records)
+	}
+
+	var times []time.Time
+	for _, r := range records[1:] {
+		tm, err := time.Parse(time.RFC3339Nano, r[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		times = append(times, tm)
+	}
+
+	checkHourly(t, "csv", times, 49)
+}
+
+func TestHistoryLimit(t *testing.T) {
+	ht := startHistoryTest(t)
+
+	res, body := ht.get(t, 72*time.Hour, "&limit=10", "zstd")
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("status %v: %s", res.StatusCode, body)
+	}
+
+	checkHourly(t, "limit", jsonTimes(t, body), 10)
+
+	if res.Trailer.Get(historyTrailerTruncated) != "true" {
+		t.Error("truncated trailer not set: ", res.Trailer)
+	}
+
+	for _, limit := range []string{"0", "x", fmt.Sprint(historyMaxPoints + 1)} {
+		res, _ := ht.get(t, time.Hour, "&limit="+limit, "")
+		if res.StatusCode != http.StatusBadRequest {
+			t.Errorf("limit %v: expected bad request, got %v", limit, res.StatusCode)
+		}
+	}
+
+	// the max is the default limit, and applies across chunks
+	maxPoints := historyMaxPoints
+	historyMaxPoints = 30
+	t.Cleanup(func() { historyMaxPoints = maxPoints })
+
+	res, body = ht.get(t, 72*time.Hour, "", "gzip")
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("status %v: %s", res.StatusCode, body)
+	}
+
+	checkHourly(t, "max", jsonTimes(t, body), 30)
+
+	if res.Trailer.Get(historyTrailerTruncated) != "true" {
+		t.Error("truncated trailer not set at max: ", res.Trailer)
+	}
+}
+
+func TestHistoryErrors(t *testing.T) {
+	ht := startHistoryTest(t)
+
+	ht.setFail(func(q data.HistoryQuery) error {
+		if q.Start.After(historyTestStart) {
+			return errors.New("backend down")
+		}
+		return nil
+	})
+
+	// the response has started when the second chunk fails
+	res, body := ht.get(t, 72*time.Hour, "", "gzip")
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("status %v: %s", res.StatusCode, body)
+	}
+
+	if e := res.Trailer.Get(historyTrailerError); !strings.Contains(e, "backend down") {
+		t.Error("error trailer not set: ", res.Trailer)
+	}
+
+	if !strings.HasPrefix(string(body), "[") {
+		t.Error("points of the first chunk not sent: ", string(body))
+	}
+
+	ht.setFail(func(q data.HistoryQuery) error {
+		return errors.New("backend down")
+	})
+
+	res, _ = ht.get(t, 72*time.Hour, "", "gzip")
+	if res.StatusCode != http.StatusInternalServerError {
+		t.Error("expected error status, got: ", res.StatusCode)
+	}
+}
+
+func TestHistoryConcurrentExports(t *testing.T) {
+	ht := startHistoryTest(t)
+
+	release := make(chan struct{})
+	ht.lock.Lock()
+	ht.release = release
+	ht.lock.Unlock()
+
+	var wg sync.WaitGroup
+	for i := 0; i < historyMaxExports; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, body := ht.get(t, time.Hour, "", "")
+			if res.StatusCode != http.StatusOK {
+				t.Errorf("status %v: %s", res.StatusCode, body)
+			}
+		}()
+	}
+
+	for start := time.Now(); len(historyExports) < historyMaxExports; {
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("Timeout waiting for exports to start")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	res, _ := ht.get(t, time.Hour, "", "")
+	if res.StatusCode != http.StatusServiceUnavailable ||
+		res.Header.Get("Retry-After") == "" {
+		t.Error("export over the limit not rejected: ", res.StatusCode)
+	}
+
+	close(release)
+	wg.Wait()
+
+	res, _ = ht.get(t, time.Hour, "", "")
+	if res.StatusCode != http.StatusOK {
+		t.Error("export not allowed after others finished: ", res.StatusCode)
+	}
+}
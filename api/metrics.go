@@ -0,0 +1,130 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// Metrics serves metric points from the root node in the Prometheus
+// text exposition format.
+type Metrics struct {
+	check     RequestValidator
+	nc        *nats.Conn
+	authToken string
+}
+
+// NewMetricsHandler returns a new metrics handler
+func NewMetricsHandler(v RequestValidator, authToken string, nc *nats.Conn) http.Handler {
+	return &Metrics{v, nc, authToken}
+}
+
+// ServeHTTP serves metrics requests
+func (h *Metrics) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+	if req.Header.Get("Authorization") != h.authToken {
+		if valid, _ := h.check.Valid(req); !valid {
+			http.Error(res, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	if req.Method != http.MethodGet {
+		http.Error(res, "only GET allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	nodes, err := client.GetNode(h.nc, "root", "")
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if len(nodes) < 1 {
+		http.Error(res, "root node not found", http.StatusNotFound)
+		return
+	}
+
+	res.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	res.Write([]byte(prometheusMetrics(nodes[0])))
+}
+
+// prometheusMetrics renders all metric points in a node. The point type is
+// converted to snake case and the point key (if set) is used as a label.
+func prometheusMetrics(node data.NodeEdge) string {
+	metrics := make(map[string][]data.Point)
+	types := make(map[string]string)
+
+	for _, p := range node.Points {
+		if !strings.HasPrefix(p.Type, "metric") {
+			continue
+		}
+
+		name := "siot_" + snakeCase(strings.TrimPrefix(p.Type, "metric"))
+		metrics[name] = append(metrics[name], p)
+		types[name] = p.Type
+	}
+
+	names := make([]string, 0, len(metrics))
+	for n := range metrics {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+
+	for _, n := range names {
+		fmt.Fprintf(&b, "# HELP %v %v point\n", n, types[n])
+		fmt.Fprintf(&b, "# TYPE %v gauge\n", n)
+		for _, p := range metrics[n] {
+			ts := p.Time.UnixNano() / 1e6
+			if p.Key != "" {
+				fmt.Fprintf(&b, "%v{node_id=\"%v\",key=\"%v\"} %v %v\n", n,
+					labelValue(node.ID), labelValue(p.Key), p.Value, ts)
+			} else {
+				fmt.Fprintf(&b, "%v{node_id=\"%v\"} %v %v\n", n,
+					labelValue(node.ID), p.Value, ts)
+			}
+		}
+	}
+
+	return b.String()
+}
+
+// snakeCase converts a camel case point type to a metric name. Acronyms are
+// kept together (CPU -> cpu), and characters that are not allowed in metric
+// names are replaced with '_'.
+func snakeCase(s string) string {
+	rs := []rune(s)
+
+	var b strings.Builder
+	for i, r := range rs {
+		if unicode.IsUpper(r) {
+			prev := rune(0)
+			if i > 0 {
+				prev = rs[i-1]
+			}
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) ||
+				(unicode.IsUpper(prev) && i+1 < len(rs) && unicode.IsLower(rs[i+1])) {
+				b.WriteRune('_')
+			}
+			r = unicode.ToLower(r)
+		}
+
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') {
+			r = '_'
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// labelValue escapes a label value in the text exposition format
+func labelValue(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
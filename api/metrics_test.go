@@ -0,0 +1,122 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/simpleiot/simpleiot/data"
+)
+
+func TestSnakeCase(t *testing.T) {
+	tests := []struct {
+		in, exp string
+	}{
+		{"NatsCycleNodePoint", "nats_cycle_node_point"},
+		{"ClientCPU", "client_cpu"},
+		{"HTTPRequests", "http_requests"},
+		{"SubPending2", "sub_pending2"},
+		{"Bad-Name.x", "bad_name_x"},
+		{"Température", "temp_rature"},
+		{"", ""},
+	}
+
+	for _, test := range tests {
+		if got := snakeCase(test.in); got != test.exp {
+			t.Errorf("%q: expected %q, got %q", test.in, test.exp, got)
+		}
+	}
+}
+
+func TestPrometheusMetrics(t *testing.T) {
+	tm := time.UnixMilli(1700000000123)
+
+	node := data.NodeEdge{
+		ID: "root",
+		Points: data.Points{
+			{Time: tm, Type: data.PointTypeMetricManagerActiveClients,
+				Key: "modbus", Value: 2},
+			{Time: tm, Type: data.PointTypeDescription, Text: "not a metric"},
+			{Time: tm, Type: data.PointTypeMetricClientCPU, Value: 0.5},
+			{Time: tm, Type: data.PointTypeMetricManagerActiveClients,
+				Key: `a"b\c` + "\n", Value: 1},
+		},
+	}
+
+	exp := `# HELP siot_client_cpu metricClientCPU point
+# TYPE siot_client_cpu gauge
+siot_client_cpu{node_id="root"} 0.5 1700000000123
+# HELP siot_manager_active_clients metricManagerActiveClients point
+# TYPE siot_manager_active_clients gauge
+siot_manager_active_clients{node_id="root",key="modbus"} 2 1700000000123
+siot_manager_active_clients{node_id="root",key="a\"b\\c\n"} 1 1700000000123
+`
+
+	if got := prometheusMetrics(node); got != exp {
+		t.Errorf("expected:\n%v\ngot:\n%v", exp, got)
+	}
+}
+
+func TestMetricsAuth(t *testing.T) {
+	nc := startTestNats(t)
+
+	respondNodes(t, nc, "root", data.Nodes{{ID: "root", Type: data.NodeTypeDevice,
+		Points: data.Points{{Time: time.Now(),
+			Type: data.PointTypeMetricManagerRestarts, Key: "modbus", Value: 3}}}})
+
+	key, err := NewKey(20)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := key.NewToken("user")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(NewMetricsHandler(key, "secret", nc))
+	defer srv.Close()
+
+	tests := []struct {
+		name   string
+		auth   string
+		status int
+	}{
+		{"none", "", http.StatusUnauthorized},
+		{"wrong token", "Bearer wrong", http.StatusUnauthorized},
+		{"auth token", "secret", http.StatusOK},
+		{"user JWT", "Bearer " + token, http.StatusOK},
+	}
+
+	for _, test := range tests {
+		req, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if test.auth != "" {
+			req.Header.Set("Authorization", test.auth)
+		}
+
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		body, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+
+		if res.StatusCode != test.status {
+			t.Errorf("%v: expected status %v, got %v", test.name, test.status,
+				res.StatusCode)
+		}
+
+		if test.status == http.StatusOK &&
+			!strings.Contains(string(body), `siot_manager_restarts{node_id="root",key="modbus"} 3`) {
+			t.Errorf("%v: metric not found in:\n%v", test.name, string(body))
+		}
+	}
+}
@@ -2,9 +2,12 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"io/ioutil"
 	"log"
 	"net/http"
+	"net/url"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/nats-io/nats.go"
@@ -85,6 +88,8 @@ func (h *Nodes) ServeHTTP(res http.ResponseWriter, req *http.Request) {
 				return
 			}
 			if len(nodes) > 0 {
+				maskNodes(nodes)
+				localizeNodes(nodes, req.URL.Query().Get("locale"))
 				en := json.NewEncoder(res)
 				en.Encode(nodes)
 			} else {
@@ -115,6 +120,8 @@ func (h *Nodes) ServeHTTP(res http.ResponseWriter, req *http.Request) {
 			if err != nil {
 				http.Error(res, err.Error(), http.StatusNotFound)
 			} else {
+				maskNodes(node)
+				localizeNodes(node, req.URL.Query().Get("locale"))
 				en := json.NewEncoder(res)
 				en.Encode(node)
 			}
@@ -148,6 +155,200 @@ func (h *Nodes) ServeHTTP(res http.ResponseWriter, req *http.Request) {
 		http.Error(res, "only POST allowed", http.StatusMethodNotAllowed)
 		return
 
+	case "origin":
+		if req.Method != http.MethodGet {
+			http.Error(res, "only GET allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		q := req.URL.Query()
+		origin, err := client.GetPointOrigin(h.nc, id, q.Get("type"), q.Get("key"))
+		if err != nil {
+			http.Error(res, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		origin.Point = data.Points{origin.Point}.Mask()[0]
+		en := json.NewEncoder(res)
+		en.Encode(origin)
+
+	case "backfill":
+		if req.Method != http.MethodPost {
+			http.Error(res, "only POST allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var points data.Points
+		err := json.NewDecoder(req.Body).Decode(&points)
+		if err != nil {
+			http.Error(res, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		for i := range points {
+			points[i].Origin = userID
+		}
+
+		err = client.SendBackfill(h.nc, id, points)
+		if err != nil {
+			http.Error(res, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		en := json.NewEncoder(res)
+		en.Encode(data.StandardResponse{Success: true, ID: id})
+
+	case "annotations":
+		switch req.Method {
+		case http.MethodGet:
+			annotations, err := client.GetAnnotations(h.nc, id)
+			if err != nil {
+				http.Error(res, err.Error(), http.StatusNotFound)
+				return
+			}
+
+			if annotations == nil {
+				annotations = []data.Annotation{}
+			}
+
+			en := json.NewEncoder(res)
+			en.Encode(annotations)
+		case http.MethodPost:
+			var a data.Annotation
+			if err := decode(req.Body, &a); err != nil {
+				http.Error(res, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			if a.User == "" {
+				a.User = userID
+			}
+
+			annID, err := client.AddAnnotation(h.nc, id, a)
+			if err != nil {
+				http.Error(res, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			en := json.NewEncoder(res)
+			en.Encode(data.StandardResponse{Success: true, ID: annID})
+		case http.MethodDelete:
+			annID, _ := ShiftPath(req.URL.Path)
+			if annID == "" {
+				http.Error(res, "annotation ID must be specified", http.StatusBadRequest)
+				return
+			}
+
+			err := client.DeleteAnnotation(h.nc, id, annID, userID)
+			if err != nil {
+				http.Error(res, err.Error(), http.StatusNotFound)
+				return
+			}
+
+			en := json.NewEncoder(res)
+			en.Encode(data.StandardResponse{Success: true, ID: annID})
+		default:
+			http.Error(res, "invalid method", http.StatusMethodNotAllowed)
+		}
+		return
+
+	case "calibrations":
+		switch req.Method {
+		case http.MethodGet:
+			cals, err := client.GetCalibrations(h.nc, id)
+			if err != nil {
+				http.Error(res, err.Error(), http.StatusNotFound)
+				return
+			}
+
+			en := json.NewEncoder(res)
+			en.Encode(cals)
+		case http.MethodPost:
+			var c data.Calibration
+			if err := decode(req.Body, &c); err != nil {
+				http.Error(res, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			// calibrations are always applied now by the current user
+			c.AppliedBy = userID
+			c.AppliedAt = time.Now()
+
+			err := client.SetCalibration(h.nc, id, c)
+			if err != nil {
+				http.Error(res, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			en := json.NewEncoder(res)
+			en.Encode(data.StandardResponse{Success: true, ID: id})
+		case http.MethodDelete:
+			pointType, _ := ShiftPath(req.URL.Path)
+			if pointType == "" {
+				http.Error(res, "point type must be specified", http.StatusBadRequest)
+				return
+			}
+
+			err := client.DeleteCalibration(h.nc, id, pointType, userID)
+			if err != nil {
+				http.Error(res, err.Error(), http.StatusNotFound)
+				return
+			}
+
+			en := json.NewEncoder(res)
+			en.Encode(data.StandardResponse{Success: true, ID: id})
+		default:
+			http.Error(res, "invalid method", http.StatusMethodNotAllowed)
+		}
+		return
+
+	case "history":
+		h.history(res, req, id)
+		return
+
+	case "playback":
+		if req.Method != http.MethodGet {
+			http.Error(res, "only GET allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		t, err := time.Parse(time.RFC3339, req.URL.Query().Get("time"))
+		if err != nil {
+			http.Error(res, "time must be specified in RFC3339 format", http.StatusBadRequest)
+			return
+		}
+
+		nodes, err := client.GetNodeStateAt(h.nc, id, t)
+		if err != nil {
+			http.Error(res, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		maskNodes(nodes)
+		en := json.NewEncoder(res)
+		en.Encode(nodes)
+		return
+
+	case "alarms":
+		if req.Method != http.MethodGet {
+			http.Error(res, "only GET allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		alarms, err := client.GetAlarms(h.nc, id)
+		if err != nil {
+			http.Error(res, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if alarms == nil {
+			alarms = []client.Alarm{}
+		}
+
+		en := json.NewEncoder(res)
+		en.Encode(alarms)
+		return
+
 	case "parents":
 		switch req.Method {
 		case http.MethodPost:
@@ -291,3 +492,64 @@ func (h *Nodes) processPoints(res http.ResponseWriter, req *http.Request, id, us
 	en := json.NewEncoder(res)
 	en.Encode(data.StandardResponse{Success: true, ID: id})
 }
+
+// parseHistoryQuery parses the query parameters of a history request. start
+// and end are RFC3339 times, and window is a duration such as 15m. If end is
+// not specified, it defaults to now, and if start is not specified, it
+// defaults to 24h before end.
+func parseHistoryQuery(v url.Values) (data.HistoryQuery, error) {
+	q := data.HistoryQuery{
+		Type:      v.Get("type"),
+		Key:       v.Get("key"),
+		Aggregate: v.Get("aggregate"),
+	}
+
+	q.End = time.Now()
+	if e := v.Get("end"); e != "" {
+		var err error
+		q.End, err = time.Parse(time.RFC3339, e)
+		if err != nil {
+			return q, errors.New("end must be specified in RFC3339 format")
+		}
+	}
+
+	q.Start = q.End.Add(-24 * time.Hour)
+	if s := v.Get("start"); s != "" {
+		var err error
+		q.Start, err = time.Parse(time.RFC3339, s)
+		if err != nil {
+			return q, errors.New("start must be specified in RFC3339 format")
+		}
+	}
+
+	if w := v.Get("window"); w != "" {
+		var err error
+		q.Window, err = time.ParseDuration(w)
+		if err != nil {
+			return q, errors.New("window must be a duration such as 15m")
+		}
+	}
+
+	return q, q.Validate()
+}
+
+// maskNodes masks sensitive points so credentials are not sent to API
+// clients (see data.Points.Mask)
+func maskNodes(nodes []data.NodeEdge) {
+	for i := range nodes {
+		nodes[i].Points = nodes[i].Points.Mask()
+		nodes[i].EdgePoints = nodes[i].EdgePoints.Mask()
+	}
+}
+
+// localizeNodes replaces the text of translatable points with the
+// translations for locale (see data.Points.Localize)
+func localizeNodes(nodes []data.NodeEdge, locale string) {
+	if locale == "" {
+		return
+	}
+
+	for i := range nodes {
+		nodes[i].Points = nodes[i].Points.Localize(locale)
+	}
+}
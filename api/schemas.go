@@ -0,0 +1,45 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/client"
+)
+
+// Schemas handles point schema requests. GET /v1/schemas returns the
+// registered node type schemas (see data.RegisterSchema), which the frontend
+// uses to build edit forms.
+type Schemas struct {
+	check     RequestValidator
+	nc        *nats.Conn
+	authToken string
+}
+
+// NewSchemasHandler returns a new schemas handler
+func NewSchemasHandler(v RequestValidator, authToken string, nc *nats.Conn) http.Handler {
+	return &Schemas{v, nc, authToken}
+}
+
+// ServeHTTP serves schema requests
+func (h *Schemas) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+	if req.Header.Get("Authorization") != h.authToken {
+		if valid, _ := h.check.Valid(req); !valid {
+			http.Error(res, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	if req.Method != http.MethodGet {
+		http.Error(res, "only GET allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	schemas, err := client.GetSchemas(h.nc)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	encode(res, schemas)
+}
@@ -0,0 +1,95 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// Search handles node search requests. GET /v1/search?q=<words>&limit=<n>
+// returns the nodes whose type, description, or text points contain all the
+// words (see client.Search). Users only get nodes below the nodes they have
+// access to.
+type Search struct {
+	check     RequestValidator
+	nc        *nats.Conn
+	authToken string
+}
+
+// NewSearchHandler returns a new search handler
+func NewSearchHandler(v RequestValidator, authToken string, nc *nats.Conn) http.Handler {
+	return &Search{v, nc, authToken}
+}
+
+// ServeHTTP serves search requests
+func (h *Search) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+	var validUser bool
+	var userID string
+
+	if req.Header.Get("Authorization") != h.authToken {
+		validUser, userID = h.check.Valid(req)
+		if !validUser {
+			http.Error(res, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	if req.Method != http.MethodGet {
+		http.Error(res, "only GET allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	sr := client.SearchRequest{Query: req.URL.Query().Get("q")}
+
+	if l := req.URL.Query().Get("limit"); l != "" {
+		var err error
+		sr.Limit, err = strconv.Atoi(l)
+		if err != nil {
+			http.Error(res, "limit must be a number", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// searches by the auth token (and with auth disabled) cover the
+	// entire tree
+	parents := []string{""}
+
+	if validUser && userID != "" {
+		// users have access to the nodes their user nodes are under
+		userNodes, err := client.GetNode(h.nc, userID, "all")
+		if err != nil {
+			http.Error(res, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		parents = nil
+		for _, un := range userNodes {
+			parents = append(parents, un.Parent)
+		}
+	}
+
+	ret := []data.NodeEdge{}
+	found := make(map[string]bool)
+
+	for _, p := range parents {
+		sr.Parent = p
+		nodes, err := client.Search(h.nc, sr)
+		if err != nil {
+			http.Error(res, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		for _, n := range nodes {
+			if !found[n.ID] {
+				found[n.ID] = true
+				ret = append(ret, n)
+			}
+		}
+	}
+
+	maskNodes(ret)
+	encode(res, ret)
+}
@@ -8,6 +8,7 @@ import (
 	"net"
 	"net/http"
 	"net/url"
+	"strconv"
 
 	"github.com/koding/websocketproxy"
 	"github.com/nats-io/nats.go"
@@ -38,6 +39,7 @@ type App struct {
 	PublicHandler  http.Handler
 	IndexHandler   http.Handler
 	V1ApiHandler   http.Handler
+	MetricsHandler http.Handler
 	WebsocketProxy http.Handler
 }
 
@@ -45,16 +47,21 @@ type App struct {
 func (h *App) ServeHTTP(res http.ResponseWriter, req *http.Request) {
 	var head string
 
+	// NATS WebSocket connections are accepted on any path so that edge
+	// devices can connect with a path prefix (see client.EdgeOptions)
+	headerUpgrade := req.Header["Upgrade"]
+	if h.WebsocketProxy != nil && len(headerUpgrade) > 0 && headerUpgrade[0] == "websocket" {
+		h.WebsocketProxy.ServeHTTP(res, req)
+		return
+	}
+
 	switch req.URL.Path {
 	case "/":
-		headerUpgrade := req.Header["Upgrade"]
-		if h.WebsocketProxy != nil && len(headerUpgrade) > 0 && headerUpgrade[0] == "websocket" {
-			h.WebsocketProxy.ServeHTTP(res, req)
-		} else {
-			h.IndexHandler.ServeHTTP(res, req)
-		}
+		h.IndexHandler.ServeHTTP(res, req)
 	case "/orgs", "/users", "/devices", "/sign-in", "/groups", "/msg":
 		h.IndexHandler.ServeHTTP(res, req)
+	case "/metrics":
+		h.MetricsHandler.ServeHTTP(res, req)
 
 	default:
 		head, req.URL.Path = ShiftPath(req.URL.Path)
@@ -80,7 +87,8 @@ func NewAppHandler(args ServerArgs) http.Handler {
 	var wsProxy http.Handler
 
 	if args.NatsWSPort > 0 {
-		uS := fmt.Sprintf("ws://localhost:%v", args.NatsWSPort)
+		uS := "ws://" + net.JoinHostPort(localHost(args.NatsWSAddr),
+			strconv.Itoa(args.NatsWSPort))
 		u, err := url.Parse(uS)
 		if err != nil {
 			log.Println("Error with WS url: ", err)
@@ -93,18 +101,35 @@ func NewAppHandler(args ServerArgs) http.Handler {
 		PublicHandler:  http.FileServer(args.Filesystem),
 		IndexHandler:   NewIndexHandler(args.GetAsset),
 		V1ApiHandler:   v1,
+		MetricsHandler: NewMetricsHandler(args.JwtAuth, args.AuthToken, args.Nc),
 		WebsocketProxy: wsProxy,
 	}
 }
 
-// ServerArgs can be used to pass arguments to the server subsystem
+// localHost returns the host to connect to a local listener bound to addr
+func localHost(addr string) string {
+	ip := net.ParseIP(addr)
+	if addr == "" || (ip != nil && ip.IsUnspecified()) {
+		return "localhost"
+	}
+
+	return addr
+}
+
+// ServerArgs can be used to pass arguments to the server subsystem. Addr and
+// NatsWSAddr are the IPv4 or IPv6 addresses the HTTP server and NATS WebSocket
+// listeners are bound to, blank for all addresses. If Listener is set, the
+// HTTP server is served on it instead of listening on Addr and Port.
 type ServerArgs struct {
+	Addr       string
 	Port       string
+	Listener   net.Listener
 	GetAsset   func(string) []byte
 	Filesystem http.FileSystem
 	Debug      bool
 	JwtAuth    Authorizer
 	AuthToken  string
+	NatsWSAddr string
 	NatsWSPort int
 	Nc         *nats.Conn
 }
@@ -127,15 +152,19 @@ func NewServer(args ServerArgs) *Server {
 // Start the api server
 func (s *Server) Start() error {
 	log.Println("Starting http server, debug: ", s.args.Debug)
-	log.Println("Starting portal on port: ", s.args.Port)
-	address := fmt.Sprintf(":%s", s.args.Port)
-
 	var err error
-	s.ln, err = net.Listen("tcp", address)
-	if err != nil {
-		return fmt.Errorf("Error starting api server: %v", err)
+
+	if s.args.Listener != nil {
+		s.ln = s.args.Listener
+	} else {
+		s.ln, err = net.Listen("tcp", net.JoinHostPort(s.args.Addr, s.args.Port))
+		if err != nil {
+			return fmt.Errorf("Error starting api server: %v", err)
+		}
 	}
 
+	log.Println("Starting portal on: ", s.ln.Addr())
+
 	chError := make(chan error)
 
 	go func() {
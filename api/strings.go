@@ -0,0 +1,93 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// Strings handles translation of user visible strings.
+// GET /v1/strings?locale=<locale>&id=<node> exports the strings of a node and
+// its descendants (see client.ExportStrings), and POST /v1/strings imports
+// translated data.LocaleStrings. Without id, users get the strings of the
+// nodes they have access to.
+type Strings struct {
+	check     RequestValidator
+	nc        *nats.Conn
+	authToken string
+}
+
+// NewStringsHandler returns a new strings handler
+func NewStringsHandler(v RequestValidator, authToken string, nc *nats.Conn) http.Handler {
+	return &Strings{v, nc, authToken}
+}
+
+// ServeHTTP serves strings requests
+func (h *Strings) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+	var validUser bool
+	var userID string
+
+	if req.Header.Get("Authorization") != h.authToken {
+		validUser, userID = h.check.Valid(req)
+		if !validUser {
+			http.Error(res, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	switch req.Method {
+	case http.MethodGet:
+		h.export(res, req, validUser, userID)
+	case http.MethodPost:
+		var ls data.LocaleStrings
+		if err := decode(req.Body, &ls); err != nil {
+			http.Error(res, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		err := client.ImportStrings(h.nc, ls, userID)
+		if err != nil {
+			http.Error(res, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		encode(res, data.StandardResponse{Success: true})
+	default:
+		http.Error(res, "invalid method", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *Strings) export(res http.ResponseWriter, req *http.Request, validUser bool, userID string) {
+	locale := req.URL.Query().Get("locale")
+	ids := []string{req.URL.Query().Get("id")}
+
+	if ids[0] == "" && validUser && userID != "" {
+		// users have access to the nodes their user nodes are under
+		userNodes, err := client.GetNode(h.nc, userID, "all")
+		if err != nil {
+			http.Error(res, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		ids = nil
+		for _, un := range userNodes {
+			ids = append(ids, un.Parent)
+		}
+	}
+
+	ret := data.LocaleStrings{Locale: locale, Strings: []data.LocaleString{}}
+
+	for _, id := range ids {
+		ls, err := client.ExportStrings(h.nc, id, locale)
+		if err != nil {
+			http.Error(res, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		ret.Strings = append(ret.Strings, ls.Strings...)
+	}
+
+	encode(res, ret)
+}
@@ -6,11 +6,16 @@ import (
 
 // V1 handles v1 api requests
 type V1 struct {
-	GroupsHandler http.Handler
-	UsersHandler  http.Handler
-	NodesHandler  http.Handler
-	AuthHandler   http.Handler
-	MsgHandler    http.Handler
+	GroupsHandler  http.Handler
+	UsersHandler   http.Handler
+	NodesHandler   http.Handler
+	AuthHandler    http.Handler
+	MsgHandler     http.Handler
+	AttestHandler  http.Handler
+	SchemasHandler http.Handler
+	SearchHandler  http.Handler
+	StringsHandler http.Handler
+	WatchHandler   http.Handler
 }
 
 // Top level handler for http requests in the coap-server process
@@ -24,6 +29,16 @@ func (h *V1) ServeHTTP(res http.ResponseWriter, req *http.Request) {
 		h.NodesHandler.ServeHTTP(res, req)
 	case "auth":
 		h.AuthHandler.ServeHTTP(res, req)
+	case "attest":
+		h.AttestHandler.ServeHTTP(res, req)
+	case "schemas":
+		h.SchemasHandler.ServeHTTP(res, req)
+	case "search":
+		h.SearchHandler.ServeHTTP(res, req)
+	case "strings":
+		h.StringsHandler.ServeHTTP(res, req)
+	case "watch":
+		h.WatchHandler.ServeHTTP(res, req)
 	default:
 		http.Error(res, "Not Found", http.StatusNotFound)
 	}
@@ -34,6 +49,15 @@ func NewV1Handler(args ServerArgs) http.Handler {
 	return &V1{
 		NodesHandler: NewNodesHandler(args.JwtAuth,
 			args.AuthToken, args.Nc),
-		AuthHandler: NewAuthHandler(args.Nc),
+		AuthHandler:   NewAuthHandler(args.Nc),
+		AttestHandler: NewAttestHandler(args.Nc),
+		SchemasHandler: NewSchemasHandler(args.JwtAuth,
+			args.AuthToken, args.Nc),
+		SearchHandler: NewSearchHandler(args.JwtAuth,
+			args.AuthToken, args.Nc),
+		StringsHandler: NewStringsHandler(args.JwtAuth,
+			args.AuthToken, args.Nc),
+		WatchHandler: NewWatchHandler(args.JwtAuth,
+			args.AuthToken, args.Nc),
 	}
 }
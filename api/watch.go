@@ -0,0 +1,163 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// how often a comment is sent on idle watch streams so proxies keep them
+// open
+var watchKeepAlive = 30 * time.Second
+
+// Watch handles watch requests. GET
+// /v1/watch?parent=<id>&nodeTypes=<types>&pointTypes=<types>&deadband=<n>
+// streams the point changes that match the filter (see client.Watch) as
+// server-sent events. Users only get changes of nodes below the nodes they
+// have access to.
+type Watch struct {
+	check     RequestValidator
+	nc        *nats.Conn
+	authToken string
+}
+
+// NewWatchHandler returns a new watch handler
+func NewWatchHandler(v RequestValidator, authToken string, nc *nats.Conn) http.Handler {
+	return &Watch{v, nc, authToken}
+}
+
+// watchEvent is the data of a watch server-sent event
+type watchEvent struct {
+	NodeID string      `json:"nodeID"`
+	Points data.Points `json:"points"`
+}
+
+// splitParam splits a comma separated query parameter
+func splitParam(v string) []string {
+	var ret []string
+	for _, s := range strings.Split(v, ",") {
+		s = strings.TrimSpace(s)
+		if s != "" {
+			ret = append(ret, s)
+		}
+	}
+	return ret
+}
+
+// ServeHTTP serves watch requests
+func (h *Watch) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+	var validUser bool
+	var userID string
+
+	if req.Header.Get("Authorization") != h.authToken {
+		validUser, userID = h.check.Valid(req)
+		if !validUser {
+			http.Error(res, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	if req.Method != http.MethodGet {
+		http.Error(res, "only GET allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	flusher, ok := res.(http.Flusher)
+	if !ok {
+		http.Error(res, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	q := req.URL.Query()
+
+	filter := client.WatchFilter{
+		NodeTypes:  splitParam(q.Get("nodeTypes")),
+		PointTypes: splitParam(q.Get("pointTypes")),
+	}
+
+	if d := q.Get("deadband"); d != "" {
+		var err error
+		filter.Deadband, err = strconv.ParseFloat(d, 64)
+		if err != nil {
+			http.Error(res, "deadband must be a number", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// watches by the auth token (and with auth disabled) can select any
+	// parent
+	parents := []string{q.Get("parent")}
+
+	if validUser && userID != "" {
+		// users have access to the nodes their user nodes are under
+		userNodes, err := client.GetNode(h.nc, userID, "all")
+		if err != nil {
+			http.Error(res, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		parents = nil
+		for _, un := range userNodes {
+			parents = append(parents, un.Parent)
+		}
+	}
+
+	events := make(chan watchEvent, 100)
+	done := req.Context().Done()
+
+	handler := func(nodeID string, points data.Points) {
+		select {
+		case events <- watchEvent{nodeID, points}:
+		case <-done:
+		}
+	}
+
+	for _, p := range parents {
+		filter.Parent = p
+		w, err := client.Watch(h.nc, filter, handler)
+		if err != nil {
+			http.Error(res, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer w.Stop()
+	}
+
+	res.Header().Set("Content-Type", "text/event-stream")
+	res.Header().Set("Cache-Control", "no-cache")
+	res.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(watchKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case e := <-events:
+			e.Points = e.Points.Mask()
+			d, err := json.Marshal(e)
+			if err != nil {
+				return
+			}
+			_, err = fmt.Fprintf(res, "event: points\ndata: %s\n\n", d)
+			if err != nil {
+				return
+			}
+		case <-keepAlive.C:
+			_, err := fmt.Fprint(res, ": keep alive\n\n")
+			if err != nil {
+				return
+			}
+		case <-done:
+			return
+		}
+
+		flusher.Flush()
+	}
+}
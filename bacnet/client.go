@@ -0,0 +1,676 @@
+package bacnet
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// DefaultPort is the standard BACnet/IP UDP port
+const DefaultPort = 47808
+
+// BACnet virtual link control functions
+const (
+	bvlcType          = 0x81
+	bvlcForwardedNPDU = 0x04
+	bvlcUnicastNPDU   = 0x0a
+	bvlcBroadcastNPDU = 0x0b
+)
+
+// APDU types
+const (
+	pduConfirmed   = 0
+	pduUnconfirmed = 1
+	pduSimpleAck   = 2
+	pduComplexAck  = 3
+	pduError       = 5
+	pduReject      = 6
+	pduAbort       = 7
+)
+
+// services
+const (
+	serviceConfirmedCOV   = 1
+	serviceSubscribeCOV   = 5
+	serviceReadProperty   = 12
+	serviceWriteProperty  = 15
+	serviceIAm            = 0
+	serviceUnconfirmedCOV = 2
+	serviceWhoIs          = 8
+)
+
+// maxAPDU is the largest APDU accepted by the client, which is the largest
+// that fits in an Ethernet frame
+const maxAPDU = 1476
+
+// Address is the address of a device. Devices behind a BACnet router have
+// the IP address of the router and a network number and MAC address on the
+// remote network.
+type Address struct {
+	IP  *net.UDPAddr
+	Net uint16
+	MAC []byte
+}
+
+func (a Address) String() string {
+	if a.Net == 0 {
+		return a.IP.String()
+	}
+	return fmt.Sprintf("%v/%v:%x", a.IP, a.Net, a.MAC)
+}
+
+// Device is a device found by WhoIs
+type Device struct {
+	ID      uint32
+	Address Address
+	MaxAPDU uint32
+	Vendor  uint32
+}
+
+// COVNotification reports the changed properties of an object by property
+// ID
+type COVNotification struct {
+	Device uint32
+	Object ObjectID
+	Values map[uint32]Value
+}
+
+// Error is a BACnet error response
+type Error struct {
+	Class uint32
+	Code  uint32
+}
+
+func (e Error) Error() string {
+	return fmt.Sprintf("bacnet: error class %v, code %v", e.Class, e.Code)
+}
+
+// Errors for rejected and aborted requests
+var (
+	ErrReject = errors.New("bacnet: request rejected")
+	ErrAbort  = errors.New("bacnet: request aborted")
+	ErrClosed = errors.New("bacnet: client closed")
+)
+
+// ClientOptions are used to configure a client
+type ClientOptions struct {
+	// Address the client listens on, defaults to :47808. Devices usually
+	// send I-Am messages to the BACnet port, so discovery needs it.
+	Address string
+	// Broadcast address used for Who-Is, defaults to
+	// 255.255.255.255:47808
+	Broadcast string
+	// Timeout of each try of a request, defaults to 3s
+	Timeout time.Duration
+	// Retries of requests that time out, defaults to 2
+	Retries int
+}
+
+type response struct {
+	pdu byte
+	d   decoder
+}
+
+// Client is a BACnet/IP client. Client is safe to use from multiple
+// goroutines.
+type Client struct {
+	conn          *net.UDPConn
+	broadcast     *net.UDPAddr
+	opts          ClientOptions
+	notifications chan COVNotification
+	done          chan struct{}
+	closeOnce     sync.Once
+
+	// protects the fields below
+	lock     sync.Mutex
+	invokeID byte
+	pending  map[byte]chan response
+	iAms     map[chan Device]bool
+}
+
+// NewClient creates a client
+func NewClient(opts ClientOptions) (*Client, error) {
+	if opts.Address == "" {
+		opts.Address = fmt.Sprintf(":%v", DefaultPort)
+	}
+
+	if opts.Broadcast == "" {
+		opts.Broadcast = fmt.Sprintf("255.255.255.255:%v", DefaultPort)
+	}
+
+	if opts.Timeout <= 0 {
+		opts.Timeout = 3 * time.Second
+	}
+
+	if opts.Retries <= 0 {
+		opts.Retries = 2
+	}
+
+	local, err := net.ResolveUDPAddr("udp4", opts.Address)
+	if err != nil {
+		return nil, fmt.Errorf("bacnet: invalid address: %w", err)
+	}
+
+	broadcast, err := net.ResolveUDPAddr("udp4", opts.Broadcast)
+	if err != nil {
+		return nil, fmt.Errorf("bacnet: invalid broadcast address: %w", err)
+	}
+
+	conn, err := net.ListenUDP("udp4", local)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Client{
+		conn:          conn,
+		broadcast:     broadcast,
+		opts:          opts,
+		notifications: make(chan COVNotification, 100),
+		done:          make(chan struct{}),
+		pending:       make(map[byte]chan response),
+		iAms:          make(map[chan Device]bool),
+	}
+
+	go c.read()
+
+	return c, nil
+}
+
+// LocalAddr returns the address the client listens on
+func (c *Client) LocalAddr() net.Addr {
+	return c.conn.LocalAddr()
+}
+
+// Notifications receives change of value notifications of subscribed
+// objects. Notifications are dropped if they are not received.
+func (c *Client) Notifications() <-chan COVNotification {
+	return c.notifications
+}
+
+// Close closes the client
+func (c *Client) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		close(c.done)
+		err = c.conn.Close()
+	})
+	return err
+}
+
+// send sends an NPDU to an address, or broadcasts it if to is nil
+func (c *Client) send(to *Address, expectReply bool, apdu []byte) error {
+	npdu := []byte{1, 0}
+	if expectReply {
+		npdu[1] |= 0x04
+	}
+
+	if to != nil && to.Net != 0 {
+		npdu[1] |= 0x20
+		npdu = append(npdu, byte(to.Net>>8), byte(to.Net), byte(len(to.MAC)))
+		npdu = append(npdu, to.MAC...)
+		// hop count
+		npdu = append(npdu, 255)
+	}
+
+	fn := byte(bvlcUnicastNPDU)
+	dst := c.broadcast
+	if to != nil {
+		dst = to.IP
+	} else {
+		fn = bvlcBroadcastNPDU
+	}
+
+	size := 4 + len(npdu) + len(apdu)
+	msg := make([]byte, 0, size)
+	msg = append(msg, bvlcType, fn, byte(size>>8), byte(size))
+	msg = append(msg, npdu...)
+	msg = append(msg, apdu...)
+
+	_, err := c.conn.WriteToUDP(msg, dst)
+	return err
+}
+
+// read receives messages until the client is closed
+func (c *Client) read() {
+	buf := make([]byte, 2048)
+
+	for {
+		n, from, err := c.conn.ReadFromUDP(buf)
+		if err != nil {
+			select {
+			case <-c.done:
+				return
+			default:
+			}
+			continue
+		}
+
+		msg := make([]byte, n)
+		copy(msg, buf[:n])
+		c.handle(msg, from)
+	}
+}
+
+// handle handles a received message
+func (c *Client) handle(msg []byte, from *net.UDPAddr) {
+	d := decoder{b: msg}
+
+	if d.byte() != bvlcType {
+		return
+	}
+
+	fn := d.byte()
+	size := int(d.uint16())
+	if d.err != nil || size != len(msg) {
+		return
+	}
+
+	switch fn {
+	case bvlcUnicastNPDU, bvlcBroadcastNPDU:
+	case bvlcForwardedNPDU:
+		// the original source of messages forwarded by a BBMD
+		ip := d.take(4)
+		port := d.uint16()
+		if d.err != nil {
+			return
+		}
+		from = &net.UDPAddr{IP: net.IP(ip), Port: int(port)}
+	default:
+		return
+	}
+
+	src := Address{IP: from}
+
+	// NPDU
+	if d.byte() != 1 {
+		return
+	}
+
+	control := d.byte()
+	if control&0x80 != 0 {
+		// network layer message
+		return
+	}
+
+	if control&0x20 != 0 {
+		d.uint16()
+		d.take(int(d.byte()))
+	}
+
+	if control&0x08 != 0 {
+		src.Net = d.uint16()
+		src.MAC = append([]byte(nil), d.take(int(d.byte()))...)
+	}
+
+	if control&0x20 != 0 {
+		// hop count
+		d.byte()
+	}
+
+	// APDU
+	head := d.byte()
+	if d.err != nil {
+		return
+	}
+
+	pdu := head >> 4
+
+	switch pdu {
+	case pduUnconfirmed:
+		service := d.byte()
+		c.handleUnconfirmed(service, d, src)
+	case pduConfirmed:
+		if head&0x08 != 0 {
+			// segmented requests are not supported
+			return
+		}
+		// max segments and APDU size
+		d.byte()
+		invokeID := d.byte()
+		service := d.byte()
+		if d.err == nil && service == serviceConfirmedCOV {
+			if c.notify(d) {
+				c.send(&src, false, []byte{pduSimpleAck << 4, invokeID, service})
+			}
+		}
+	case pduSimpleAck, pduComplexAck, pduError, pduReject, pduAbort:
+		if pdu == pduComplexAck && head&0x08 != 0 {
+			// segmented responses are not supported, the request was sent
+			// without accepting segmentation so devices should not send
+			// them
+			return
+		}
+
+		invokeID := d.byte()
+		if d.err != nil {
+			return
+		}
+
+		c.lock.Lock()
+		ch, ok := c.pending[invokeID]
+		if ok {
+			delete(c.pending, invokeID)
+		}
+		c.lock.Unlock()
+
+		if ok {
+			ch <- response{pdu: pdu, d: d}
+		}
+	}
+}
+
+func (c *Client) handleUnconfirmed(service byte, d decoder, src Address) {
+	switch service {
+	case serviceIAm:
+		dev := Device{Address: src}
+
+		id := d.value()
+		maxAPDU := d.value()
+		// segmentation
+		d.value()
+		vendor := d.value()
+		if d.err != nil {
+			return
+		}
+
+		if oid, ok := id.Value.(ObjectID); ok {
+			dev.ID = oid.Instance
+		}
+		dev.MaxAPDU, _ = maxAPDU.Value.(uint32)
+		dev.Vendor, _ = vendor.Value.(uint32)
+
+		c.lock.Lock()
+		for ch := range c.iAms {
+			select {
+			case ch <- dev:
+			default:
+			}
+		}
+		c.lock.Unlock()
+	case serviceUnconfirmedCOV:
+		c.notify(d)
+	}
+}
+
+// notify decodes a COV notification and sends it to the notifications
+// channel. It returns false if the notification can't be decoded.
+func (c *Client) notify(d decoder) bool {
+	n := COVNotification{Values: make(map[uint32]Value)}
+
+	// subscriber process ID
+	d.contextUnsigned(0)
+	n.Device = d.contextObjectID(1).Instance
+	n.Object = d.contextObjectID(2)
+	// time remaining
+	d.contextUnsigned(3)
+	d.expect(4, tagOpening)
+
+	for d.more() && !d.hasContext(4, tagClosing) {
+		prop := d.contextUnsigned(0)
+		if d.hasContext(1, tagPrimitive) {
+			d.contextUnsigned(1)
+		}
+		d.expect(2, tagOpening)
+		values := d.values(2)
+		if d.hasContext(3, tagPrimitive) {
+			d.contextUnsigned(3)
+		}
+
+		if len(values) > 0 {
+			n.Values[prop] = values[0]
+		}
+	}
+
+	if d.err != nil {
+		return false
+	}
+
+	select {
+	case c.notifications <- n:
+	default:
+	}
+
+	return true
+}
+
+// request sends a confirmed request and waits for the response. The decoder
+// returned is positioned at the service data of complex ACKs.
+func (c *Client) request(to Address, service byte, body []byte) (*decoder, error) {
+	for try := 0; ; try++ {
+		ch := make(chan response, 1)
+
+		c.lock.Lock()
+		// find a free invoke ID
+		for i := 0; i < 256; i++ {
+			c.invokeID++
+			if _, ok := c.pending[c.invokeID]; !ok {
+				break
+			}
+		}
+		invokeID := c.invokeID
+		c.pending[invokeID] = ch
+		c.lock.Unlock()
+
+		apdu := []byte{pduConfirmed << 4, 0x05, invokeID, service}
+		apdu = append(apdu, body...)
+
+		err := c.send(&to, true, apdu)
+		if err != nil {
+			c.lock.Lock()
+			delete(c.pending, invokeID)
+			c.lock.Unlock()
+			return nil, err
+		}
+
+		select {
+		case r := <-ch:
+			return r.result(service)
+		case <-c.done:
+			return nil, ErrClosed
+		case <-time.After(c.opts.Timeout):
+			c.lock.Lock()
+			delete(c.pending, invokeID)
+			c.lock.Unlock()
+
+			if try >= c.opts.Retries {
+				return nil, fmt.Errorf("bacnet: timeout waiting for %v", to)
+			}
+		}
+	}
+}
+
+// result returns the service data of an ACK, or the error of other
+// responses
+func (r response) result(service byte) (*decoder, error) {
+	d := r.d
+
+	switch r.pdu {
+	case pduSimpleAck, pduComplexAck:
+		if d.byte() != service {
+			return nil, errors.New("bacnet: response for wrong service")
+		}
+		return &d, d.err
+	case pduError:
+		d.byte()
+		class := d.value()
+		code := d.value()
+		e := Error{}
+		e.Class, _ = class.Value.(uint32)
+		e.Code, _ = code.Value.(uint32)
+		return nil, e
+	case pduReject:
+		return nil, fmt.Errorf("%w: reason %v", ErrReject, d.byte())
+	default:
+		return nil, fmt.Errorf("%w: reason %v", ErrAbort, d.byte())
+	}
+}
+
+// WhoIs broadcasts a Who-Is request for the devices with an ID between low
+// and high and returns the devices that answer within wait. If low is
+// negative, all devices are asked.
+func (c *Client) WhoIs(low, high int, wait time.Duration) ([]Device, error) {
+	ch := make(chan Device, 100)
+
+	c.lock.Lock()
+	c.iAms[ch] = true
+	c.lock.Unlock()
+
+	defer func() {
+		c.lock.Lock()
+		delete(c.iAms, ch)
+		c.lock.Unlock()
+	}()
+
+	e := encoder{b: []byte{pduUnconfirmed << 4, serviceWhoIs}}
+	if low >= 0 {
+		e.contextUnsigned(0, uint32(low))
+		e.contextUnsigned(1, uint32(high))
+	}
+
+	err := c.send(nil, false, e.b)
+	if err != nil {
+		return nil, err
+	}
+
+	var ret []Device
+	found := make(map[uint32]bool)
+	timeout := time.After(wait)
+
+	for {
+		select {
+		case dev := <-ch:
+			if found[dev.ID] {
+				continue
+			}
+			if low >= 0 && (dev.ID < uint32(low) || dev.ID > uint32(high)) {
+				continue
+			}
+			found[dev.ID] = true
+			ret = append(ret, dev)
+			if low >= 0 && low == high {
+				return ret, nil
+			}
+		case <-timeout:
+			return ret, nil
+		case <-c.done:
+			return nil, ErrClosed
+		}
+	}
+}
+
+// ReadProperty reads a property of an object. Arrays are read as a whole
+// if index is negative.
+func (c *Client) ReadProperty(to Address, obj ObjectID, prop uint32, index int) ([]Value, error) {
+	e := encoder{}
+	e.contextObjectID(0, obj)
+	e.contextUnsigned(1, prop)
+	if index >= 0 {
+		e.contextUnsigned(2, uint32(index))
+	}
+
+	d, err := c.request(to, serviceReadProperty, e.b)
+	if err != nil {
+		return nil, err
+	}
+
+	d.contextObjectID(0)
+	d.contextUnsigned(1)
+	if d.hasContext(2, tagPrimitive) {
+		d.contextUnsigned(2)
+	}
+	d.expect(3, tagOpening)
+	values := d.values(3)
+
+	return values, d.err
+}
+
+// ReadValue reads the first value of a property
+func (c *Client) ReadValue(to Address, obj ObjectID, prop uint32) (Value, error) {
+	values, err := c.ReadProperty(to, obj, prop, -1)
+	if err != nil {
+		return Value{}, err
+	}
+
+	if len(values) <= 0 {
+		return Value{}, errors.New("bacnet: empty property value")
+	}
+
+	return values[0], nil
+}
+
+// ObjectList returns the objects of a device. If the list is too large to
+// read at once, it is read one object at a time.
+func (c *Client) ObjectList(to Address, device uint32) ([]ObjectID, error) {
+	dev := ObjectID{Type: DeviceObject, Instance: device}
+
+	values, err := c.ReadProperty(to, dev, PropObjectList, -1)
+	if err != nil {
+		values = nil
+
+		count, err := c.ReadProperty(to, dev, PropObjectList, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(count) <= 0 {
+			return nil, errors.New("bacnet: empty object list length")
+		}
+
+		n, _ := count[0].Value.(uint32)
+		for i := uint32(1); i <= n; i++ {
+			v, err := c.ReadProperty(to, dev, PropObjectList, int(i))
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, v...)
+		}
+	}
+
+	var ret []ObjectID
+	for _, v := range values {
+		if id, ok := v.Value.(ObjectID); ok {
+			ret = append(ret, id)
+		}
+	}
+
+	return ret, nil
+}
+
+// WriteProperty writes a property of an object with a priority from 1
+// (highest) to 16. Priority 0 writes without a priority, for properties
+// that are not commandable.
+func (c *Client) WriteProperty(to Address, obj ObjectID, prop uint32, v Value, priority int) error {
+	e := encoder{}
+	e.contextObjectID(0, obj)
+	e.contextUnsigned(1, prop)
+	e.openTag(3)
+	err := e.value(v)
+	if err != nil {
+		return err
+	}
+	e.closeTag(3)
+	if priority > 0 {
+		e.contextUnsigned(4, uint32(priority))
+	}
+
+	_, err = c.request(to, serviceWriteProperty, e.b)
+	return err
+}
+
+// SubscribeCOV subscribes to unconfirmed change of value notifications of
+// an object for lifetime. Subscriptions must be renewed before they
+// expire. A lifetime of 0 cancels the subscription.
+func (c *Client) SubscribeCOV(to Address, processID uint32, obj ObjectID, lifetime time.Duration) error {
+	e := encoder{}
+	e.contextUnsigned(0, processID)
+	e.contextObjectID(1, obj)
+	if lifetime > 0 {
+		e.contextBool(2, false)
+		e.contextUnsigned(3, uint32(lifetime.Seconds()))
+	}
+
+	_, err := c.request(to, serviceSubscribeCOV, e.b)
+	return err
+}
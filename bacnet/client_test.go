@@ -0,0 +1,394 @@
+package bacnet
+
+import (
+	"errors"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeDevice is a BACnet/IP device for testing the client
+type fakeDevice struct {
+	t    *testing.T
+	conn *net.UDPConn
+	id   uint32
+
+	lock       sync.Mutex
+	objects    map[ObjectID]map[uint32]Value
+	subscribed map[ObjectID]bool
+	priority   uint32
+}
+
+func newFakeDevice(t *testing.T, id uint32) *fakeDevice {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal("Error listening: ", err)
+	}
+
+	f := &fakeDevice{
+		t:    t,
+		conn: conn,
+		id:   id,
+		objects: map[ObjectID]map[uint32]Value{
+			{AnalogInput, 1}: {
+				PropPresentValue: {TagReal, float32(21.5)},
+				PropObjectName:   {TagCharacterString, "temp"},
+			},
+			{BinaryOutput, 2}: {
+				PropPresentValue: {TagEnumerated, uint32(0)},
+				PropObjectName:   {TagCharacterString, "fan"},
+			},
+		},
+		subscribed: make(map[ObjectID]bool),
+	}
+
+	go f.run()
+
+	t.Cleanup(func() { conn.Close() })
+
+	return f
+}
+
+func (f *fakeDevice) addr() string {
+	return f.conn.LocalAddr().String()
+}
+
+func (f *fakeDevice) get(obj ObjectID, prop uint32) (Value, bool) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	v, ok := f.objects[obj][prop]
+	return v, ok
+}
+
+func (f *fakeDevice) send(to *net.UDPAddr, apdu []byte) {
+	size := 6 + len(apdu)
+	msg := []byte{bvlcType, bvlcUnicastNPDU, byte(size >> 8), byte(size), 1, 0}
+	msg = append(msg, apdu...)
+	_, err := f.conn.WriteToUDP(msg, to)
+	if err != nil {
+		f.t.Log("Error sending: ", err)
+	}
+}
+
+func (f *fakeDevice) run() {
+	buf := make([]byte, 1500)
+
+	for {
+		n, from, err := f.conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+
+		// skip the BVLC header and NPDU
+		d := decoder{b: append([]byte(nil), buf[6:n]...)}
+		head := d.byte()
+
+		switch head >> 4 {
+		case pduUnconfirmed:
+			if d.byte() != serviceWhoIs {
+				continue
+			}
+			if d.more() {
+				low := d.contextUnsigned(0)
+				high := d.contextUnsigned(1)
+				if f.id < low || f.id > high {
+					continue
+				}
+			}
+			e := encoder{b: []byte{pduUnconfirmed << 4, serviceIAm}}
+			_ = e.value(Value{TagObjectID, ObjectID{DeviceObject, f.id}})
+			e.appUnsigned(maxAPDU)
+			_ = e.value(Value{TagEnumerated, uint32(3)})
+			e.appUnsigned(999)
+			f.send(from, e.b)
+		case pduConfirmed:
+			d.byte()
+			invokeID := d.byte()
+			service := d.byte()
+			f.send(from, f.confirmed(invokeID, service, d, from))
+		}
+	}
+}
+
+func (f *fakeDevice) errorPDU(invokeID, service byte, class, code uint32) []byte {
+	e := encoder{b: []byte{pduError << 4, invokeID, service}}
+	_ = e.value(Value{TagEnumerated, class})
+	_ = e.value(Value{TagEnumerated, code})
+	return e.b
+}
+
+func (f *fakeDevice) confirmed(invokeID, service byte, d decoder, from *net.UDPAddr) []byte {
+	switch service {
+	case serviceReadProperty:
+		obj := d.contextObjectID(0)
+		prop := d.contextUnsigned(1)
+		index := -1
+		if d.hasContext(2, tagPrimitive) {
+			index = int(d.contextUnsigned(2))
+		}
+
+		var values []Value
+
+		if obj == (ObjectID{DeviceObject, f.id}) && prop == PropObjectList {
+			list := []ObjectID{{DeviceObject, f.id}, {AnalogInput, 1}, {BinaryOutput, 2}}
+			switch {
+			case index < 0:
+				// too large to read at once
+				return []byte{pduAbort << 4, invokeID, 4}
+			case index == 0:
+				values = []Value{{TagUnsigned, uint32(len(list))}}
+			case index <= len(list):
+				values = []Value{{TagObjectID, list[index-1]}}
+			default:
+				return f.errorPDU(invokeID, service, 2, 42)
+			}
+		} else {
+			v, ok := f.get(obj, prop)
+			if !ok {
+				// object, unknown-object
+				return f.errorPDU(invokeID, service, 1, 31)
+			}
+			values = []Value{v}
+		}
+
+		e := encoder{b: []byte{pduComplexAck << 4, invokeID, service}}
+		e.contextObjectID(0, obj)
+		e.contextUnsigned(1, prop)
+		if index >= 0 {
+			e.contextUnsigned(2, uint32(index))
+		}
+		e.openTag(3)
+		for _, v := range values {
+			_ = e.value(v)
+		}
+		e.closeTag(3)
+		return e.b
+	case serviceWriteProperty:
+		obj := d.contextObjectID(0)
+		prop := d.contextUnsigned(1)
+		d.expect(3, tagOpening)
+		values := d.values(3)
+		var priority uint32
+		if d.hasContext(4, tagPrimitive) {
+			priority = d.contextUnsigned(4)
+		}
+		if d.err != nil || len(values) != 1 {
+			return []byte{pduReject << 4, invokeID, 0}
+		}
+
+		f.lock.Lock()
+		defer f.lock.Unlock()
+		if _, ok := f.objects[obj]; !ok {
+			return f.errorPDU(invokeID, service, 1, 31)
+		}
+		f.objects[obj][prop] = values[0]
+		f.priority = priority
+		return []byte{pduSimpleAck << 4, invokeID, service}
+	case serviceSubscribeCOV:
+		pid := d.contextUnsigned(0)
+		obj := d.contextObjectID(1)
+		v, ok := f.get(obj, PropPresentValue)
+		if !ok {
+			return f.errorPDU(invokeID, service, 1, 31)
+		}
+
+		f.lock.Lock()
+		f.subscribed[obj] = true
+		f.lock.Unlock()
+
+		// the initial notification is sent after the ACK
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			e := encoder{b: []byte{pduUnconfirmed << 4, serviceUnconfirmedCOV}}
+			e.contextUnsigned(0, pid)
+			e.contextObjectID(1, ObjectID{DeviceObject, f.id})
+			e.contextObjectID(2, obj)
+			e.contextUnsigned(3, 300)
+			e.openTag(4)
+			e.contextUnsigned(0, PropPresentValue)
+			e.openTag(2)
+			_ = e.value(v)
+			e.closeTag(2)
+			e.contextUnsigned(0, PropStatusFlags)
+			e.openTag(2)
+			_ = e.value(Value{TagBitString, []byte{4, 0}})
+			e.closeTag(2)
+			e.closeTag(4)
+			f.send(from, e.b)
+		}()
+
+		return []byte{pduSimpleAck << 4, invokeID, service}
+	}
+
+	// unrecognized service
+	return []byte{pduReject << 4, invokeID, 9}
+}
+
+func TestValueRoundTrip(t *testing.T) {
+	values := []Value{
+		{TagNull, nil},
+		{TagBoolean, true},
+		{TagBoolean, false},
+		{TagUnsigned, uint32(0)},
+		{TagUnsigned, uint32(70000)},
+		{TagSigned, int32(-200)},
+		{TagSigned, int32(1 << 20)},
+		{TagReal, float32(1.5)},
+		{TagDouble, float64(-2.25)},
+		{TagOctetString, []byte{1, 2, 3}},
+		{TagCharacterString, "a long enough object name"},
+		{TagEnumerated, uint32(3)},
+		{TagObjectID, ObjectID{AnalogValue, 4194302}},
+	}
+
+	e := encoder{}
+	for _, v := range values {
+		err := e.value(v)
+		if err != nil {
+			t.Fatal("Error encoding: ", err)
+		}
+	}
+
+	d := decoder{b: e.b}
+	for _, exp := range values {
+		v := d.value()
+		if !reflect.DeepEqual(v, exp) {
+			t.Errorf("Expected %v, got %v", exp, v)
+		}
+	}
+
+	if d.err != nil || d.more() {
+		t.Fatal("Expected all values to be decoded: ", d.err, len(d.b))
+	}
+}
+
+func TestPresentValue(t *testing.T) {
+	tests := []struct {
+		typ ObjectType
+		v   float64
+		exp Value
+		err bool
+	}{
+		{AnalogOutput, 21.5, Value{TagReal, float32(21.5)}, false},
+		{BinaryValue, 1, Value{TagEnumerated, uint32(1)}, false},
+		{BinaryOutput, 0, Value{TagEnumerated, uint32(0)}, false},
+		{MultiStateValue, 3, Value{TagUnsigned, uint32(3)}, false},
+		{MultiStateValue, 0, Value{}, true},
+		{DeviceObject, 1, Value{}, true},
+	}
+
+	for _, test := range tests {
+		v, err := PresentValue(test.typ, test.v)
+		if (err != nil) != test.err {
+			t.Errorf("%v %v: unexpected error: %v", test.typ, test.v, err)
+			continue
+		}
+		if !test.err && !reflect.DeepEqual(v, test.exp) {
+			t.Errorf("%v %v: expected %v, got %v", test.typ, test.v, test.exp, v)
+		}
+	}
+}
+
+func TestClient(t *testing.T) {
+	f := newFakeDevice(t, 1234)
+
+	c, err := NewClient(ClientOptions{
+		Address:   "127.0.0.1:0",
+		Broadcast: f.addr(),
+		Timeout:   500 * time.Millisecond,
+		Retries:   1,
+	})
+	if err != nil {
+		t.Fatal("Error creating client: ", err)
+	}
+	defer c.Close()
+
+	devices, err := c.WhoIs(1234, 1234, time.Second)
+	if err != nil {
+		t.Fatal("WhoIs error: ", err)
+	}
+
+	if len(devices) != 1 || devices[0].ID != 1234 || devices[0].Vendor != 999 {
+		t.Fatal("Unexpected devices: ", devices)
+	}
+
+	addr := devices[0].Address
+
+	devices, err = c.WhoIs(1, 10, 100*time.Millisecond)
+	if err != nil {
+		t.Fatal("WhoIs error: ", err)
+	}
+
+	if len(devices) != 0 {
+		t.Fatal("Expected no devices out of range: ", devices)
+	}
+
+	objects, err := c.ObjectList(addr, 1234)
+	if err != nil {
+		t.Fatal("ObjectList error: ", err)
+	}
+
+	expObjects := []ObjectID{{DeviceObject, 1234}, {AnalogInput, 1}, {BinaryOutput, 2}}
+	if !reflect.DeepEqual(objects, expObjects) {
+		t.Fatal("Unexpected objects: ", objects)
+	}
+
+	v, err := c.ReadValue(addr, ObjectID{AnalogInput, 1}, PropPresentValue)
+	if err != nil {
+		t.Fatal("ReadValue error: ", err)
+	}
+
+	if f, ok := v.Float(); !ok || f != 21.5 {
+		t.Fatal("Unexpected present value: ", v)
+	}
+
+	_, err = c.ReadValue(addr, ObjectID{AnalogInput, 9}, PropPresentValue)
+	var bErr Error
+	if !errors.As(err, &bErr) || bErr.Code != 31 {
+		t.Fatal("Expected unknown object error, got: ", err)
+	}
+
+	err = c.WriteProperty(addr, ObjectID{BinaryOutput, 2}, PropPresentValue,
+		Value{TagEnumerated, uint32(1)}, 8)
+	if err != nil {
+		t.Fatal("WriteProperty error: ", err)
+	}
+
+	if v, _ := f.get(ObjectID{BinaryOutput, 2}, PropPresentValue); v.Value != uint32(1) {
+		t.Fatal("Write not applied: ", v)
+	}
+
+	f.lock.Lock()
+	priority := f.priority
+	f.lock.Unlock()
+
+	if priority != 8 {
+		t.Fatal("Unexpected write priority: ", priority)
+	}
+
+	err = c.SubscribeCOV(addr, 7, ObjectID{AnalogInput, 1}, 5*time.Minute)
+	if err != nil {
+		t.Fatal("SubscribeCOV error: ", err)
+	}
+
+	select {
+	case n := <-c.Notifications():
+		if n.Device != 1234 || n.Object != (ObjectID{AnalogInput, 1}) {
+			t.Fatal("Unexpected notification: ", n)
+		}
+		if f, ok := n.Values[PropPresentValue].Float(); !ok || f != 21.5 {
+			t.Fatal("Unexpected notification value: ", n.Values)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Timeout waiting for notification")
+	}
+
+	f.conn.Close()
+
+	_, err = c.ReadValue(addr, ObjectID{AnalogInput, 1}, PropPresentValue)
+	if err == nil {
+		t.Fatal("Expected timeout error")
+	}
+}
@@ -0,0 +1,13 @@
+// Package bacnet contains a minimal BACnet/IP client. It implements device
+// discovery (Who-Is/I-Am), the ReadProperty, WriteProperty, and SubscribeCOV
+// services, and receives change of value notifications. Devices behind
+// BACnet routers (for example MS/TP devices) are reached through the router.
+// Segmented messages are not supported.
+//
+// There is no maintained Go BACnet library to build on. The existing ones
+// (github.com/alexbeltran/gobacnet and its forks) have not been updated in
+// years and do not support SubscribeCOV, which the client needs to receive
+// changes without polling. The subset used here is small (BVLC, NPDU, and
+// the services above with their application tags), so it is implemented in
+// this package and tested against a fake device in client_test.go.
+package bacnet
@@ -0,0 +1,567 @@
+package bacnet
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Application tags of primitive values
+const (
+	TagNull            byte = 0
+	TagBoolean         byte = 1
+	TagUnsigned        byte = 2
+	TagSigned          byte = 3
+	TagReal            byte = 4
+	TagDouble          byte = 5
+	TagOctetString     byte = 6
+	TagCharacterString byte = 7
+	TagBitString       byte = 8
+	TagEnumerated      byte = 9
+	TagDate            byte = 10
+	TagTime            byte = 11
+	TagObjectID        byte = 12
+)
+
+// ObjectType is the type of a BACnet object
+type ObjectType uint16
+
+// Object types
+const (
+	AnalogInput      ObjectType = 0
+	AnalogOutput     ObjectType = 1
+	AnalogValue      ObjectType = 2
+	BinaryInput      ObjectType = 3
+	BinaryOutput     ObjectType = 4
+	BinaryValue      ObjectType = 5
+	DeviceObject     ObjectType = 8
+	MultiStateInput  ObjectType = 13
+	MultiStateOutput ObjectType = 14
+	MultiStateValue  ObjectType = 19
+)
+
+var objectTypeNames = map[ObjectType]string{
+	AnalogInput:      "analogInput",
+	AnalogOutput:     "analogOutput",
+	AnalogValue:      "analogValue",
+	BinaryInput:      "binaryInput",
+	BinaryOutput:     "binaryOutput",
+	BinaryValue:      "binaryValue",
+	DeviceObject:     "device",
+	MultiStateInput:  "multiStateInput",
+	MultiStateOutput: "multiStateOutput",
+	MultiStateValue:  "multiStateValue",
+}
+
+func (t ObjectType) String() string {
+	if name, ok := objectTypeNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("objectType%v", uint16(t))
+}
+
+// ParseObjectType returns the object type for a name returned by String
+func ParseObjectType(s string) (ObjectType, error) {
+	for t, name := range objectTypeNames {
+		if name == s {
+			return t, nil
+		}
+	}
+	return 0, fmt.Errorf("bacnet: unknown object type: %v", s)
+}
+
+// Input returns true for input objects, which can't be written
+func (t ObjectType) Input() bool {
+	return t == AnalogInput || t == BinaryInput || t == MultiStateInput
+}
+
+// ObjectID identifies an object in a device
+type ObjectID struct {
+	Type     ObjectType
+	Instance uint32
+}
+
+func (id ObjectID) String() string {
+	return fmt.Sprintf("%v:%v", id.Type, id.Instance)
+}
+
+func (id ObjectID) encode() uint32 {
+	return uint32(id.Type)<<22 | id.Instance&0x3fffff
+}
+
+func decodeObjectID(v uint32) ObjectID {
+	return ObjectID{Type: ObjectType(v >> 22), Instance: v & 0x3fffff}
+}
+
+// Property identifiers
+const (
+	PropObjectList   uint32 = 76
+	PropObjectName   uint32 = 77
+	PropPresentValue uint32 = 85
+	PropStatusFlags  uint32 = 111
+	PropUnits        uint32 = 117
+)
+
+// Value is an application tagged value. Value is nil, a bool, uint32
+// (unsigned and enumerated), int32, float32, float64, string, []byte, or
+// ObjectID. Bit strings, dates, and times are returned as the raw bytes.
+type Value struct {
+	Tag   byte
+	Value any
+}
+
+// Float returns a numeric, enumerated, or boolean value as a float64
+func (v Value) Float() (float64, bool) {
+	switch x := v.Value.(type) {
+	case bool:
+		if x {
+			return 1, true
+		}
+		return 0, true
+	case uint32:
+		return float64(x), true
+	case int32:
+		return float64(x), true
+	case float32:
+		return float64(x), true
+	case float64:
+		return x, true
+	default:
+		return 0, false
+	}
+}
+
+// PresentValue returns the value written to the present value of an object
+// type: analog objects take a real, binary objects an enumerated 0 or 1,
+// and multi-state objects an unsigned state number starting at 1
+func PresentValue(t ObjectType, v float64) (Value, error) {
+	switch t {
+	case AnalogInput, AnalogOutput, AnalogValue:
+		return Value{Tag: TagReal, Value: float32(v)}, nil
+	case BinaryInput, BinaryOutput, BinaryValue:
+		var b uint32
+		if v != 0 {
+			b = 1
+		}
+		return Value{Tag: TagEnumerated, Value: b}, nil
+	case MultiStateInput, MultiStateOutput, MultiStateValue:
+		if v < 1 {
+			return Value{}, errors.New("bacnet: multi-state values start at 1")
+		}
+		return Value{Tag: TagUnsigned, Value: uint32(v)}, nil
+	default:
+		return Value{}, fmt.Errorf("bacnet: can't write present value of %v", t)
+	}
+}
+
+// encoder encodes BACnet tags and values
+type encoder struct {
+	b []byte
+}
+
+// tag encodes a tag header. Lengths of 5 and more are encoded after the
+// header.
+func (e *encoder) tag(num byte, context bool, length int) {
+	var class byte
+	if context {
+		class = 0x08
+	}
+
+	lvt := byte(length)
+	if length > 4 {
+		lvt = 5
+	}
+
+	if num < 15 {
+		e.b = append(e.b, num<<4|class|lvt)
+	} else {
+		e.b = append(e.b, 0xf0|class|lvt, num)
+	}
+
+	switch {
+	case length <= 4:
+	case length < 254:
+		e.b = append(e.b, byte(length))
+	case length < 65536:
+		e.b = append(e.b, 254, byte(length>>8), byte(length))
+	default:
+		e.b = append(e.b, 255, byte(length>>24), byte(length>>16),
+			byte(length>>8), byte(length))
+	}
+}
+
+func (e *encoder) openTag(num byte) {
+	e.b = append(e.b, num<<4|0x0e)
+}
+
+func (e *encoder) closeTag(num byte) {
+	e.b = append(e.b, num<<4|0x0f)
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	return append(b, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+func appendUint64(b []byte, v uint64) []byte {
+	return appendUint32(appendUint32(b, uint32(v>>32)), uint32(v))
+}
+
+// unsignedBytes returns the shortest big endian encoding of v
+func unsignedBytes(v uint32) []byte {
+	switch {
+	case v < 1<<8:
+		return []byte{byte(v)}
+	case v < 1<<16:
+		return []byte{byte(v >> 8), byte(v)}
+	case v < 1<<24:
+		return []byte{byte(v >> 16), byte(v >> 8), byte(v)}
+	default:
+		return []byte{byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)}
+	}
+}
+
+func signedBytes(v int32) []byte {
+	switch {
+	case v >= -1<<7 && v < 1<<7:
+		return []byte{byte(v)}
+	case v >= -1<<15 && v < 1<<15:
+		return []byte{byte(v >> 8), byte(v)}
+	case v >= -1<<23 && v < 1<<23:
+		return []byte{byte(v >> 16), byte(v >> 8), byte(v)}
+	default:
+		return []byte{byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)}
+	}
+}
+
+func (e *encoder) contextUnsigned(num byte, v uint32) {
+	b := unsignedBytes(v)
+	e.tag(num, true, len(b))
+	e.b = append(e.b, b...)
+}
+
+func (e *encoder) contextObjectID(num byte, id ObjectID) {
+	e.tag(num, true, 4)
+	e.b = appendUint32(e.b, id.encode())
+}
+
+func (e *encoder) contextBool(num byte, v bool) {
+	e.tag(num, true, 1)
+	if v {
+		e.b = append(e.b, 1)
+	} else {
+		e.b = append(e.b, 0)
+	}
+}
+
+func (e *encoder) appUnsigned(v uint32) {
+	b := unsignedBytes(v)
+	e.tag(TagUnsigned, false, len(b))
+	e.b = append(e.b, b...)
+}
+
+// value encodes an application tagged value
+func (e *encoder) value(v Value) error {
+	switch x := v.Value.(type) {
+	case nil:
+		e.tag(TagNull, false, 0)
+	case bool:
+		// the value of booleans is the length
+		if x {
+			e.tag(TagBoolean, false, 1)
+		} else {
+			e.tag(TagBoolean, false, 0)
+		}
+	case uint32:
+		if v.Tag != TagUnsigned && v.Tag != TagEnumerated {
+			return fmt.Errorf("bacnet: invalid tag %v for unsigned value", v.Tag)
+		}
+		b := unsignedBytes(x)
+		e.tag(v.Tag, false, len(b))
+		e.b = append(e.b, b...)
+	case int32:
+		b := signedBytes(x)
+		e.tag(TagSigned, false, len(b))
+		e.b = append(e.b, b...)
+	case float32:
+		e.tag(TagReal, false, 4)
+		e.b = appendUint32(e.b, math.Float32bits(x))
+	case float64:
+		e.tag(TagDouble, false, 8)
+		e.b = appendUint64(e.b, math.Float64bits(x))
+	case string:
+		e.tag(TagCharacterString, false, len(x)+1)
+		// UTF-8
+		e.b = append(e.b, 0)
+		e.b = append(e.b, x...)
+	case []byte:
+		e.tag(TagOctetString, false, len(x))
+		e.b = append(e.b, x...)
+	case ObjectID:
+		e.tag(TagObjectID, false, 4)
+		e.b = appendUint32(e.b, x.encode())
+	default:
+		return fmt.Errorf("bacnet: can't encode value of type %T", v.Value)
+	}
+
+	return nil
+}
+
+var errShort = errors.New("bacnet: message too short")
+
+// tag kinds
+const (
+	tagPrimitive = iota
+	tagOpening
+	tagClosing
+)
+
+// tagHeader is a decoded tag header
+type tagHeader struct {
+	num     byte
+	context bool
+	kind    int
+	// length of the content, or the value of application booleans
+	length int
+}
+
+// decoder parses BACnet messages. Once an error occurs, all following reads
+// return zero values and err is set.
+type decoder struct {
+	b   []byte
+	err error
+}
+
+func (d *decoder) take(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+
+	if n < 0 || len(d.b) < n {
+		d.err = errShort
+		d.b = nil
+		return nil
+	}
+
+	ret := d.b[:n]
+	d.b = d.b[n:]
+	return ret
+}
+
+func (d *decoder) byte() byte {
+	b := d.take(1)
+	if b == nil {
+		return 0
+	}
+	return b[0]
+}
+
+func (d *decoder) uint16() uint16 {
+	b := d.take(2)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint16(b)
+}
+
+// tag decodes a tag header
+func (d *decoder) tag() tagHeader {
+	b := d.byte()
+
+	h := tagHeader{
+		num:     b >> 4,
+		context: b&0x08 != 0,
+		length:  int(b & 0x07),
+	}
+
+	if h.num == 15 {
+		h.num = d.byte()
+	}
+
+	switch {
+	case h.context && h.length == 6:
+		h.kind = tagOpening
+		h.length = 0
+	case h.context && h.length == 7:
+		h.kind = tagClosing
+		h.length = 0
+	case h.length == 5:
+		h.length = int(d.byte())
+		switch h.length {
+		case 254:
+			h.length = int(d.uint16())
+		case 255:
+			v := d.take(4)
+			if v != nil {
+				h.length = int(binary.BigEndian.Uint32(v))
+			}
+		}
+	}
+
+	return h
+}
+
+// peekTag returns the next tag header without consuming it
+func (d *decoder) peekTag() tagHeader {
+	c := *d
+	return c.tag()
+}
+
+// more returns true if there is more data to decode
+func (d *decoder) more() bool {
+	return d.err == nil && len(d.b) > 0
+}
+
+func (d *decoder) unsigned(length int) uint32 {
+	if length > 4 {
+		d.err = errors.New("bacnet: unsigned value too large")
+		return 0
+	}
+
+	var v uint32
+	for _, b := range d.take(length) {
+		v = v<<8 | uint32(b)
+	}
+	return v
+}
+
+func (d *decoder) signed(length int) int32 {
+	b := d.take(length)
+	if len(b) == 0 || len(b) > 4 {
+		return 0
+	}
+
+	v := int32(int8(b[0]))
+	for _, x := range b[1:] {
+		v = v<<8 | int32(x)
+	}
+	return v
+}
+
+// expect decodes a tag and checks it is the expected context tag
+func (d *decoder) expect(num byte, kind int) tagHeader {
+	h := d.tag()
+	if d.err == nil && (!h.context || h.num != num || h.kind != kind) {
+		d.err = fmt.Errorf("bacnet: expected context tag %v", num)
+	}
+	return h
+}
+
+// contextUnsigned decodes an unsigned value with context tag num
+func (d *decoder) contextUnsigned(num byte) uint32 {
+	h := d.expect(num, tagPrimitive)
+	return d.unsigned(h.length)
+}
+
+// contextObjectID decodes an object ID with context tag num
+func (d *decoder) contextObjectID(num byte) ObjectID {
+	h := d.expect(num, tagPrimitive)
+	return decodeObjectID(d.unsigned(h.length))
+}
+
+// hasContext returns true if the next tag is the context tag num
+func (d *decoder) hasContext(num byte, kind int) bool {
+	if !d.more() {
+		return false
+	}
+	h := d.peekTag()
+	return h.context && h.num == num && h.kind == kind
+}
+
+// value decodes an application tagged value
+func (d *decoder) value() Value {
+	h := d.tag()
+	if d.err != nil {
+		return Value{}
+	}
+
+	if h.context {
+		d.err = errors.New("bacnet: expected application tag")
+		return Value{}
+	}
+
+	v := Value{Tag: h.num}
+
+	switch h.num {
+	case TagNull:
+	case TagBoolean:
+		v.Value = h.length != 0
+	case TagUnsigned, TagEnumerated:
+		v.Value = d.unsigned(h.length)
+	case TagSigned:
+		v.Value = d.signed(h.length)
+	case TagReal:
+		b := d.take(4)
+		if b != nil {
+			v.Value = math.Float32frombits(binary.BigEndian.Uint32(b))
+		}
+	case TagDouble:
+		b := d.take(8)
+		if b != nil {
+			v.Value = math.Float64frombits(binary.BigEndian.Uint64(b))
+		}
+	case TagCharacterString:
+		b := d.take(h.length)
+		if len(b) > 0 {
+			// only UTF-8 (and its ASCII subset) is supported
+			v.Value = string(b[1:])
+		}
+	case TagObjectID:
+		v.Value = decodeObjectID(d.unsigned(h.length))
+	default:
+		v.Value = append([]byte(nil), d.take(h.length)...)
+	}
+
+	return v
+}
+
+// values decodes application tagged values until the closing tag num
+func (d *decoder) values(num byte) []Value {
+	var ret []Value
+
+	for d.more() {
+		h := d.peekTag()
+		if h.context && h.kind == tagClosing && h.num == num {
+			d.tag()
+			return ret
+		}
+
+		if h.context {
+			d.skip()
+			continue
+		}
+
+		ret = append(ret, d.value())
+	}
+
+	if d.err == nil {
+		d.err = errShort
+	}
+
+	return ret
+}
+
+// skip skips a tagged value, including constructed values
+func (d *decoder) skip() {
+	h := d.tag()
+
+	switch h.kind {
+	case tagOpening:
+		for d.more() {
+			n := d.peekTag()
+			if n.kind == tagClosing && n.num == h.num {
+				d.tag()
+				return
+			}
+			d.skip()
+		}
+		if d.err == nil {
+			d.err = errShort
+		}
+	case tagPrimitive:
+		if !h.context && h.num == TagBoolean {
+			return
+		}
+		d.take(h.length)
+	}
+}
@@ -0,0 +1,640 @@
+package canbus
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// extendedFlag is set in DBC message IDs of extended (29 bit) frames
+const extendedFlag = 0x80000000
+
+// ValueType is the encoding of a signal
+type ValueType int
+
+// Value types
+const (
+	Integer ValueType = iota
+	Float32
+	Float64
+)
+
+// Signal describes a signal of a message. Start is the bit number of the
+// least significant bit for little endian signals, and of the most
+// significant bit for big endian signals, numbered as in DBC files. MuxValue
+// is the multiplexer value the signal is sent with if Multiplexed is set.
+// SPN is the J1939 suspect parameter number from the SPN attribute, 0 if not
+// set.
+type Signal struct {
+	Name        string
+	Start       int
+	Length      int
+	BigEndian   bool
+	Signed      bool
+	Type        ValueType
+	Factor      float64
+	Offset      float64
+	Min         float64
+	Max         float64
+	Unit        string
+	Comment     string
+	Multiplexer bool
+	Multiplexed bool
+	MuxValue    int
+	SPN         int
+	// descriptions of raw values
+	Values map[int64]string
+}
+
+// Message describes a CAN message. ID does not include the extended frame
+// flag of DBC files.
+type Message struct {
+	ID       uint32
+	Extended bool
+	Name     string
+	Length   int
+	Sender   string
+	Comment  string
+	Signals  []*Signal
+}
+
+// Database has the messages of a DBC file
+type Database struct {
+	Messages []*Message
+	byID     map[uint32]*Message
+	// extended messages by J1939 PGN
+	byPGN map[uint32]*Message
+}
+
+func dbcID(id uint32, extended bool) uint32 {
+	if extended {
+		return id | extendedFlag
+	}
+	return id
+}
+
+// Message returns the message with id, or nil if there is none
+func (db *Database) Message(id uint32, extended bool) *Message {
+	return db.byID[dbcID(id, extended)]
+}
+
+// LoadDBC parses a DBC file
+func LoadDBC(path string) (*Database, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ParseDBC(f)
+}
+
+// ParseDBC parses the messages, signals, comments, value descriptions, and
+// signal value types of a DBC file. Other definitions are ignored.
+func ParseDBC(r io.Reader) (*Database, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens, err := tokenize(string(b))
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens, db: &Database{
+		byID:  make(map[uint32]*Message),
+		byPGN: make(map[uint32]*Message),
+	}}
+	err = p.parse()
+	if err != nil {
+		return nil, err
+	}
+
+	return p.db, nil
+}
+
+type token struct {
+	text string
+	// true for quoted strings
+	str  bool
+	line int
+}
+
+func isPunct(c byte) bool {
+	return strings.IndexByte(":|@(),[];", c) >= 0
+}
+
+func tokenize(s string) ([]token, error) {
+	var ret []token
+	line := 1
+
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == '\n':
+			line++
+			i++
+		case c == ' ' || c == '\t' || c == '\r':
+			i++
+		case c == '"':
+			start := line
+			var sb strings.Builder
+			i++
+			for ; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+				}
+				if s[i] == '\n' {
+					line++
+				}
+				sb.WriteByte(s[i])
+			}
+			if i >= len(s) {
+				return nil, fmt.Errorf("dbc: line %v: unterminated string", start)
+			}
+			i++
+			ret = append(ret, token{sb.String(), true, start})
+		case isPunct(c):
+			ret = append(ret, token{string(c), false, line})
+			i++
+		default:
+			start := i
+			for i < len(s) && !isPunct(s[i]) && s[i] != '"' &&
+				s[i] != ' ' && s[i] != '\t' && s[i] != '\r' && s[i] != '\n' {
+				i++
+			}
+			ret = append(ret, token{s[start:i], false, line})
+		}
+	}
+
+	return ret, nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+	db     *Database
+	// message signals are added to
+	msg *Message
+}
+
+func (p *parser) more() bool {
+	return p.pos < len(p.tokens)
+}
+
+func (p *parser) peek() token {
+	if !p.more() {
+		return token{}
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.peek()
+	if p.more() {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) line() int {
+	if p.pos > 0 && p.pos <= len(p.tokens) {
+		return p.tokens[p.pos-1].line
+	}
+	return 0
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	return fmt.Errorf("dbc: line %v: %v", p.line(), fmt.Sprintf(format, args...))
+}
+
+func (p *parser) expect(text string) error {
+	t := p.next()
+	if t.str || t.text != text {
+		return p.errorf("expected %q, got %q", text, t.text)
+	}
+	return nil
+}
+
+func (p *parser) str() (string, error) {
+	t := p.next()
+	if !t.str {
+		return "", p.errorf("expected string, got %q", t.text)
+	}
+	return t.text, nil
+}
+
+func (p *parser) float() (float64, error) {
+	t := p.next()
+	v, err := strconv.ParseFloat(t.text, 64)
+	if t.str || err != nil {
+		return 0, p.errorf("expected number, got %q", t.text)
+	}
+	return v, nil
+}
+
+func (p *parser) int() (int64, error) {
+	t := p.next()
+	v, err := strconv.ParseInt(t.text, 10, 64)
+	if t.str || err != nil {
+		return 0, p.errorf("expected integer, got %q", t.text)
+	}
+	return v, nil
+}
+
+func (p *parser) uint32() (uint32, error) {
+	t := p.next()
+	v, err := strconv.ParseUint(t.text, 10, 32)
+	if t.str || err != nil {
+		return 0, p.errorf("expected integer, got %q", t.text)
+	}
+	return uint32(v), nil
+}
+
+// skipLine skips the tokens on the line of the last token
+func (p *parser) skipLine() {
+	line := p.line()
+	for p.more() && p.peek().line == line {
+		p.next()
+	}
+}
+
+// skipStatement skips tokens up to and including the next semicolon
+func (p *parser) skipStatement() {
+	for p.more() {
+		if t := p.next(); !t.str && t.text == ";" {
+			return
+		}
+	}
+}
+
+func (p *parser) parse() error {
+	for p.more() {
+		t := p.next()
+		if t.str {
+			return p.errorf("unexpected string")
+		}
+
+		var err error
+
+		switch t.text {
+		case "VERSION":
+			_, err = p.str()
+		case "NS_":
+			// list of new symbols, which ends at the bit timing section
+			for p.more() && p.peek().text != "BS_" {
+				p.next()
+			}
+		case "BS_", "BU_":
+			p.skipLine()
+		case "BO_":
+			err = p.message()
+		case "SG_":
+			err = p.signal()
+		case "CM_":
+			err = p.comment()
+		case "VAL_":
+			err = p.values()
+		case "SIG_VALTYPE_":
+			err = p.valueType()
+		case "BA_":
+			err = p.attribute()
+		default:
+			p.msg = nil
+			p.skipStatement()
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// message parses BO_ <id> <name>: <length> <sender>
+func (p *parser) message() error {
+	id, err := p.uint32()
+	if err != nil {
+		return err
+	}
+
+	name := p.next().text
+	if err := p.expect(":"); err != nil {
+		return err
+	}
+
+	length, err := p.int()
+	if err != nil {
+		return err
+	}
+
+	m := &Message{
+		ID:       id &^ extendedFlag,
+		Extended: id&extendedFlag != 0,
+		Name:     name,
+		Length:   int(length),
+	}
+
+	if p.more() && p.peek().line == p.line() {
+		m.Sender = p.next().text
+	}
+
+	p.db.Messages = append(p.db.Messages, m)
+	p.db.byID[id] = m
+
+	if m.Extended {
+		pgn := ParseJ1939ID(m.ID).PGN
+		if _, ok := p.db.byPGN[pgn]; !ok {
+			p.db.byPGN[pgn] = m
+		}
+	}
+	p.msg = m
+
+	return nil
+}
+
+// signal parses SG_ <name> [M|m<n>] : <start>|<length>@<order><sign>
+// (<factor>,<offset>) [<min>|<max>] "<unit>" <receivers>
+func (p *parser) signal() error {
+	if p.msg == nil {
+		return p.errorf("signal outside of message")
+	}
+
+	line := p.line()
+	s := &Signal{Name: p.next().text}
+
+	if mux := p.peek(); !mux.str && mux.text != ":" {
+		p.next()
+		switch {
+		case mux.text == "M":
+			s.Multiplexer = true
+		case strings.HasPrefix(mux.text, "m"):
+			v := strings.TrimPrefix(mux.text, "m")
+			if strings.HasSuffix(v, "M") {
+				// extended multiplexing, the signal is also a multiplexer
+				s.Multiplexer = true
+				v = strings.TrimSuffix(v, "M")
+			}
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return p.errorf("invalid multiplexer: %v", mux.text)
+			}
+			s.Multiplexed = true
+			s.MuxValue = n
+		default:
+			return p.errorf("invalid multiplexer: %v", mux.text)
+		}
+	}
+
+	if err := p.expect(":"); err != nil {
+		return err
+	}
+
+	start, err := p.int()
+	if err != nil {
+		return err
+	}
+
+	if err := p.expect("|"); err != nil {
+		return err
+	}
+
+	length, err := p.int()
+	if err != nil {
+		return err
+	}
+
+	if err := p.expect("@"); err != nil {
+		return err
+	}
+
+	format := p.next().text
+	if len(format) != 2 || (format[0] != '0' && format[0] != '1') ||
+		(format[1] != '+' && format[1] != '-') {
+		return p.errorf("invalid signal format: %v", format)
+	}
+
+	s.Start = int(start)
+	s.Length = int(length)
+	s.BigEndian = format[0] == '0'
+	s.Signed = format[1] == '-'
+
+	if s.Length < 1 || s.Length > 64 || s.Start < 0 {
+		return p.errorf("invalid signal size: %v|%v", start, length)
+	}
+
+	if err := p.expect("("); err != nil {
+		return err
+	}
+
+	if s.Factor, err = p.float(); err != nil {
+		return err
+	}
+
+	if err := p.expect(","); err != nil {
+		return err
+	}
+
+	if s.Offset, err = p.float(); err != nil {
+		return err
+	}
+
+	if err := p.expect(")"); err != nil {
+		return err
+	}
+
+	if err := p.expect("["); err != nil {
+		return err
+	}
+
+	if s.Min, err = p.float(); err != nil {
+		return err
+	}
+
+	if err := p.expect("|"); err != nil {
+		return err
+	}
+
+	if s.Max, err = p.float(); err != nil {
+		return err
+	}
+
+	if err := p.expect("]"); err != nil {
+		return err
+	}
+
+	if s.Unit, err = p.str(); err != nil {
+		return err
+	}
+
+	// receivers
+	for p.more() && p.peek().line == line {
+		p.next()
+	}
+
+	p.msg.Signals = append(p.msg.Signals, s)
+
+	return nil
+}
+
+func (p *parser) findSignal(id uint32, name string) *Signal {
+	m := p.db.byID[id]
+	if m == nil {
+		return nil
+	}
+
+	for _, s := range m.Signals {
+		if s.Name == name {
+			return s
+		}
+	}
+
+	return nil
+}
+
+// comment parses CM_ [BU_ <node>|BO_ <id>|SG_ <id> <name>|EV_ <name>]
+// "<comment>";
+func (p *parser) comment() error {
+	p.msg = nil
+
+	var text string
+	var err error
+
+	t := p.next()
+	switch {
+	case t.str:
+		text = t.text
+	case t.text == "BO_":
+		var id uint32
+		if id, err = p.uint32(); err != nil {
+			return err
+		}
+		if text, err = p.str(); err != nil {
+			return err
+		}
+		if m := p.db.byID[id]; m != nil {
+			m.Comment = text
+		}
+	case t.text == "SG_":
+		var id uint32
+		if id, err = p.uint32(); err != nil {
+			return err
+		}
+		name := p.next().text
+		if text, err = p.str(); err != nil {
+			return err
+		}
+		if s := p.findSignal(id, name); s != nil {
+			s.Comment = text
+		}
+	default:
+		p.skipStatement()
+		return nil
+	}
+
+	return p.expect(";")
+}
+
+// values parses VAL_ <id> <signal> (<value> "<description>")* ;
+// Value descriptions of environment variables are ignored.
+func (p *parser) values() error {
+	p.msg = nil
+
+	id, err := strconv.ParseUint(p.peek().text, 10, 32)
+	if err != nil {
+		p.skipStatement()
+		return nil
+	}
+	p.next()
+
+	name := p.next().text
+	values := make(map[int64]string)
+
+	for p.more() && p.peek().text != ";" {
+		v, err := p.float()
+		if err != nil {
+			return err
+		}
+
+		desc, err := p.str()
+		if err != nil {
+			return err
+		}
+
+		values[int64(v)] = desc
+	}
+
+	if s := p.findSignal(uint32(id), name); s != nil {
+		s.Values = values
+	}
+
+	return p.expect(";")
+}
+
+// valueType parses SIG_VALTYPE_ <id> <signal> : <type>;
+func (p *parser) valueType() error {
+	p.msg = nil
+
+	id, err := p.uint32()
+	if err != nil {
+		return err
+	}
+
+	name := p.next().text
+
+	// the colon is missing in some files
+	if p.peek().text == ":" {
+		p.next()
+	}
+
+	typ, err := p.int()
+	if err != nil {
+		return err
+	}
+
+	if s := p.findSignal(id, name); s != nil {
+		switch typ {
+		case 1:
+			s.Type = Float32
+		case 2:
+			s.Type = Float64
+		}
+	}
+
+	return p.expect(";")
+}
+
+// attribute parses the SPN attribute of signals,
+// BA_ "SPN" SG_ <id> <signal> <value>; Other attributes are ignored.
+func (p *parser) attribute() error {
+	p.msg = nil
+
+	name := p.next()
+	if !name.str || name.text != "SPN" || p.peek().text != "SG_" {
+		p.skipStatement()
+		return nil
+	}
+	p.next()
+
+	id, err := p.uint32()
+	if err != nil {
+		return err
+	}
+
+	signal := p.next().text
+
+	spn, err := p.int()
+	if err != nil {
+		return err
+	}
+
+	if s := p.findSignal(id, signal); s != nil {
+		s.SPN = int(spn)
+	}
+
+	return p.expect(";")
+}
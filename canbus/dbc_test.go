@@ -0,0 +1,179 @@
+package canbus
+
+import (
+	"strings"
+	"testing"
+)
+
+var testDBC = `VERSION ""
+
+NS_ :
+	NS_DESC_
+	CM_
+	BA_DEF_
+
+BS_:
+
+BU_: ECU1 ECU2
+
+BO_ 100 Engine: 8 ECU1
+ SG_ Speed : 0|16@1+ (0.125,0) [0|8031.875] "rpm" ECU2
+ SG_ Temp : 16|8@1- (1,-40) [-40|210] "degC" ECU2
+ SG_ Gear : 24|4@1+ (1,0) [0|15] "" ECU2,ECU1
+ SG_ Pressure : 39|12@0+ (0.5,0) [0|2047.5] "kPa" ECU2
+
+BO_ 2566844926 Mux: 8 ECU1
+ SG_ Selector M : 0|8@1+ (1,0) [0|255] "" ECU2
+ SG_ A m1 : 8|16@1+ (1,0) [0|65535] "" ECU2
+ SG_ B m2 : 8|32@1+ (1,0) [0|0] "V" ECU2
+
+CM_ "database comment";
+CM_ BO_ 100 "engine status";
+CM_ SG_ 100 Speed "engine
+speed";
+BA_DEF_ SG_ "GenSigStartValue" INT 0 10000;
+BA_ "GenSigStartValue" SG_ 100 Speed 0;
+VAL_ 100 Gear 0 "Neutral" 1 "First" ;
+SIG_VALTYPE_ 2566844926 B : 1;
+`
+
+func TestParseDBC(t *testing.T) {
+	db, err := ParseDBC(strings.NewReader(testDBC))
+	if err != nil {
+		t.Fatal("Error parsing: ", err)
+	}
+
+	if len(db.Messages) != 2 {
+		t.Fatal("Expected 2 messages, got: ", len(db.Messages))
+	}
+
+	m := db.Message(100, false)
+	if m == nil || m.Name != "Engine" || m.Length != 8 || m.Sender != "ECU1" {
+		t.Fatalf("Engine message not parsed: %+v", m)
+	}
+
+	if m.Comment != "engine status" {
+		t.Error("Wrong message comment: ", m.Comment)
+	}
+
+	if len(m.Signals) != 4 {
+		t.Fatal("Expected 4 signals, got: ", len(m.Signals))
+	}
+
+	s := m.Signals[0]
+	if s.Name != "Speed" || s.Factor != 0.125 || s.Unit != "rpm" ||
+		s.Comment != "engine\nspeed" {
+		t.Errorf("Speed signal not parsed: %+v", s)
+	}
+
+	if !m.Signals[1].Signed || m.Signals[1].Offset != -40 {
+		t.Errorf("Temp signal not parsed: %+v", m.Signals[1])
+	}
+
+	if !m.Signals[3].BigEndian {
+		t.Error("Pressure should be big endian")
+	}
+
+	if db.Message(100, true) != nil {
+		t.Error("Extended message 100 should not exist")
+	}
+
+	mux := db.Message(0x18fef1fe, true)
+	if mux == nil {
+		t.Fatal("Extended message not found")
+	}
+
+	if !mux.Signals[0].Multiplexer || mux.Signals[1].MuxValue != 1 ||
+		mux.Signals[2].Type != Float32 {
+		t.Errorf("Mux signals not parsed: %+v %+v %+v", mux.Signals[0],
+			mux.Signals[1], mux.Signals[2])
+	}
+}
+
+func TestParseDBCError(t *testing.T) {
+	_, err := ParseDBC(strings.NewReader(`BO_ 100 Engine: 8 ECU1
+ SG_ Speed : 0|16@2+ (1,0) [0|0] "" ECU2
+`))
+	if err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Error("Expected error on line 2, got: ", err)
+	}
+}
+
+func TestDecode(t *testing.T) {
+	db, err := ParseDBC(strings.NewReader(testDBC))
+	if err != nil {
+		t.Fatal("Error parsing: ", err)
+	}
+
+	m, values, err := db.Decode(Frame{
+		ID:   100,
+		Data: []byte{0x40, 0x1f, 0xec, 0x01, 0x12, 0x30, 0, 0},
+	})
+	if err != nil {
+		t.Fatal("Error decoding: ", err)
+	}
+
+	if m == nil || m.Name != "Engine" {
+		t.Fatal("Engine message not matched")
+	}
+
+	exp := map[string]float64{
+		"Speed":    1000,
+		"Temp":     -60,
+		"Gear":     1,
+		"Pressure": 145.5,
+	}
+
+	if len(values) != len(exp) {
+		t.Fatal("Wrong number of values: ", len(values))
+	}
+
+	for _, v := range values {
+		if v.Value != exp[v.Signal.Name] {
+			t.Errorf("%v: expected %v, got %v", v.Signal.Name,
+				exp[v.Signal.Name], v.Value)
+		}
+	}
+
+	if values[2].Text != "First" {
+		t.Error("Expected gear text First, got: ", values[2].Text)
+	}
+
+	_, values, err = db.Decode(Frame{
+		ID:       0x18fef1fe,
+		Extended: true,
+		Data:     []byte{1, 0x34, 0x12, 0, 0, 0, 0, 0},
+	})
+	if err != nil {
+		t.Fatal("Error decoding: ", err)
+	}
+
+	if len(values) != 2 || values[1].Signal.Name != "A" ||
+		values[1].Value != 0x1234 {
+		t.Errorf("Mux 1 not decoded: %+v", values)
+	}
+
+	_, values, err = db.Decode(Frame{
+		ID:       0x18fef1fe,
+		Extended: true,
+		Data:     []byte{2, 0, 0, 0xc0, 0x3f, 0, 0, 0},
+	})
+	if err != nil {
+		t.Fatal("Error decoding: ", err)
+	}
+
+	if len(values) != 2 || values[1].Signal.Name != "B" ||
+		values[1].Value != 1.5 {
+		t.Errorf("Mux 2 not decoded: %+v", values)
+	}
+
+	m, _, err = db.Decode(Frame{ID: 101, Data: []byte{0}})
+	if m != nil || err != nil {
+		t.Error("Unknown frame should not match")
+	}
+
+	_, _, err = db.Decode(Frame{ID: 100, Data: []byte{0}})
+	if err == nil {
+		t.Error("Expected error for short frame")
+	}
+}
@@ -0,0 +1,130 @@
+package canbus
+
+import (
+	"fmt"
+	"math"
+)
+
+// Frame is a CAN frame. ID does not include flags.
+type Frame struct {
+	ID       uint32
+	Extended bool
+	Data     []byte
+}
+
+// SignalValue is a decoded signal. Value is scaled with the factor and offset
+// of the signal. Text is the description of the raw value, if any.
+type SignalValue struct {
+	Signal *Signal
+	Raw    int64
+	Value  float64
+	Text   string
+}
+
+// Decode decodes a frame with the message it matches. The message is nil if
+// the database has no message for the frame.
+func (db *Database) Decode(f Frame) (*Message, []SignalValue, error) {
+	m := db.Message(f.ID, f.Extended)
+	if m == nil {
+		return nil, nil, nil
+	}
+
+	values, err := m.Decode(f.Data)
+	return m, values, err
+}
+
+// Decode decodes the signals of the message. Multiplexed signals are only
+// returned if the multiplexer matches.
+func (m *Message) Decode(data []byte) ([]SignalValue, error) {
+	mux := -1
+
+	for _, s := range m.Signals {
+		if s.Multiplexer && !s.Multiplexed {
+			raw, err := s.raw(data)
+			if err != nil {
+				return nil, err
+			}
+			mux = int(raw)
+		}
+	}
+
+	var ret []SignalValue
+
+	for _, s := range m.Signals {
+		if s.Multiplexed && s.MuxValue != mux {
+			continue
+		}
+
+		v, err := s.Decode(data)
+		if err != nil {
+			return nil, err
+		}
+
+		ret = append(ret, v)
+	}
+
+	return ret, nil
+}
+
+// Decode extracts the signal from the data of a frame
+func (s *Signal) Decode(data []byte) (SignalValue, error) {
+	ret := SignalValue{Signal: s}
+
+	raw, err := s.raw(data)
+	if err != nil {
+		return ret, err
+	}
+
+	ret.Raw = int64(raw)
+
+	switch {
+	case s.Type == Float32 && s.Length == 32:
+		ret.Value = float64(math.Float32frombits(uint32(raw)))
+	case s.Type == Float64 && s.Length == 64:
+		ret.Value = math.Float64frombits(raw)
+	case s.Signed && s.Length < 64:
+		// sign extend
+		shift := 64 - s.Length
+		ret.Raw = int64(raw<<shift) >> shift
+		ret.Value = float64(ret.Raw)
+	case s.Signed:
+		ret.Value = float64(ret.Raw)
+	default:
+		ret.Value = float64(raw)
+	}
+
+	ret.Value = ret.Value*s.Factor + s.Offset
+	ret.Text = s.Values[ret.Raw]
+
+	return ret, nil
+}
+
+// raw returns the bits of the signal. Big endian signals start at the most
+// significant bit and continue with the next byte after bit 0 of a byte.
+func (s *Signal) raw(data []byte) (uint64, error) {
+	var ret uint64
+	pos := s.Start
+
+	for i := 0; i < s.Length; i++ {
+		if pos < 0 || pos/8 >= len(data) {
+			return 0, fmt.Errorf("signal %v does not fit in %v bytes",
+				s.Name, len(data))
+		}
+
+		bit := uint64(data[pos/8]>>(pos%8)) & 1
+
+		if s.BigEndian {
+			ret = ret<<1 | bit
+			if pos%8 == 0 {
+				pos += 15
+			} else {
+				pos--
+			}
+		} else {
+			ret |= bit << i
+			pos++
+		}
+	}
+
+	return ret, nil
+}
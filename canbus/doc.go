@@ -0,0 +1,10 @@
+// Package canbus decodes CAN frames into named signals using the message
+// and signal definitions of a DBC file. Little and big endian, signed,
+// float, and multiplexed signals are supported. Value descriptions (VAL_)
+// are returned as the text of a signal.
+//
+// J1939 parameter groups are reassembled from transport protocol frames by
+// J1939, and decoded with the DBC message of their PGN. The suspect
+// parameter number of signals is read from the SPN attribute of J1939 DBC
+// files.
+package canbus
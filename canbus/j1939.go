@@ -0,0 +1,255 @@
+package canbus
+
+import (
+	"encoding/binary"
+)
+
+// J1939 parameter group numbers
+const (
+	// transport protocol data transfer
+	PGNTPDT = 0xeb00
+	// transport protocol connection management
+	PGNTPCM = 0xec00
+)
+
+// J1939GlobalAddress is the destination of broadcast messages
+const J1939GlobalAddress = 0xff
+
+// transport protocol connection management control bytes
+const (
+	tpRTS   = 16
+	tpCTS   = 17
+	tpAck   = 19
+	tpBAM   = 32
+	tpAbort = 255
+)
+
+// j1939MaxSize is the max size of a transport protocol message
+const j1939MaxSize = 1785
+
+// J1939ID is the 29 bit identifier of a J1939 frame. The PGN of PDU1 format
+// messages (PF < 240) does not include the destination address.
+type J1939ID struct {
+	Priority    uint8
+	PGN         uint32
+	Source      uint8
+	Destination uint8
+}
+
+// ParseJ1939ID splits a 29 bit identifier into its J1939 fields
+func ParseJ1939ID(id uint32) J1939ID {
+	ret := J1939ID{
+		Priority:    uint8(id>>26) & 0x7,
+		PGN:         (id >> 8) & 0x3ffff,
+		Source:      uint8(id),
+		Destination: J1939GlobalAddress,
+	}
+
+	if (ret.PGN>>8)&0xff < 240 {
+		ret.Destination = uint8(ret.PGN)
+		ret.PGN &^= 0xff
+	}
+
+	return ret
+}
+
+// CANID returns the 29 bit identifier
+func (id J1939ID) CANID() uint32 {
+	ret := uint32(id.Priority&0x7)<<26 | (id.PGN&0x3ffff)<<8 | uint32(id.Source)
+	if (id.PGN>>8)&0xff < 240 {
+		ret = ret&^0xff00 | uint32(id.Destination)<<8
+	}
+	return ret
+}
+
+// J1939Message is a J1939 parameter group, received in one frame or
+// reassembled from transport protocol frames
+type J1939Message struct {
+	ID   J1939ID
+	Data []byte
+}
+
+type tpSession struct {
+	id      J1939ID
+	size    int
+	packets int
+	next    int
+	data    []byte
+}
+
+// J1939 reassembles J1939 transport protocol messages (BAM broadcasts and
+// RTS/CTS connections) from received frames. It only listens, it does not
+// send CTS or acknowledgements, so a connection to this node is not
+// possible, but connections between other nodes on the bus are received.
+type J1939 struct {
+	// sessions by source and destination address
+	sessions map[uint16]*tpSession
+}
+
+// NewJ1939 returns a new J1939 transport protocol receiver
+func NewJ1939() *J1939 {
+	return &J1939{sessions: make(map[uint16]*tpSession)}
+}
+
+func sessionKey(source, dest uint8) uint16 {
+	return uint16(source)<<8 | uint16(dest)
+}
+
+// Receive processes an extended frame. It returns the parameter group of
+// single frame messages, and of transport protocol messages when the last
+// packet is received. Transport protocol frames, standard frames, and
+// incomplete messages return false.
+func (j *J1939) Receive(f Frame) (J1939Message, bool) {
+	if !f.Extended {
+		return J1939Message{}, false
+	}
+
+	id := ParseJ1939ID(f.ID)
+
+	switch id.PGN {
+	case PGNTPCM:
+		j.control(id, f.Data)
+		return J1939Message{}, false
+	case PGNTPDT:
+		return j.transfer(id, f.Data)
+	}
+
+	return J1939Message{ID: id, Data: f.Data}, true
+}
+
+func (j *J1939) control(id J1939ID, data []byte) {
+	if len(data) < 8 {
+		return
+	}
+
+	key := sessionKey(id.Source, id.Destination)
+
+	switch data[0] {
+	case tpRTS, tpBAM:
+		if data[0] == tpBAM && id.Destination != J1939GlobalAddress {
+			return
+		}
+
+		size := int(binary.LittleEndian.Uint16(data[1:3]))
+		packets := int(data[3])
+		pgn := uint32(data[5]) | uint32(data[6])<<8 | uint32(data[7])<<16
+
+		if size < 9 || size > j1939MaxSize || packets != (size+6)/7 {
+			delete(j.sessions, key)
+			return
+		}
+
+		msgID := J1939ID{
+			Priority:    id.Priority,
+			PGN:         pgn,
+			Source:      id.Source,
+			Destination: id.Destination,
+		}
+
+		if (pgn>>8)&0xff < 240 {
+			msgID.PGN &^= 0xff
+		}
+
+		// a new connection replaces one that was not completed
+		j.sessions[key] = &tpSession{
+			id:      msgID,
+			size:    size,
+			packets: packets,
+			next:    1,
+			data:    make([]byte, 0, packets*7),
+		}
+	case tpAbort:
+		// either side of a connection can abort it
+		delete(j.sessions, key)
+		delete(j.sessions, sessionKey(id.Destination, id.Source))
+	case tpCTS, tpAck:
+		// sent by the receiver of a connection
+	}
+}
+
+func (j *J1939) transfer(id J1939ID, data []byte) (J1939Message, bool) {
+	key := sessionKey(id.Source, id.Destination)
+	s := j.sessions[key]
+	if s == nil || len(data) < 8 {
+		return J1939Message{}, false
+	}
+
+	seq := int(data[0])
+	if seq != s.next {
+		// packets of RTS/CTS connections are resent after a CTS
+		// that asks for them again
+		if seq < s.next && seq >= 1 {
+			s.data = s.data[:(seq-1)*7]
+			s.next = seq
+		} else {
+			delete(j.sessions, key)
+			return J1939Message{}, false
+		}
+	}
+
+	s.data = append(s.data, data[1:8]...)
+	s.next++
+
+	if s.next <= s.packets {
+		return J1939Message{}, false
+	}
+
+	delete(j.sessions, key)
+
+	return J1939Message{ID: s.id, Data: s.data[:s.size]}, true
+}
+
+// J1939Message returns the message for a parameter group, matching the
+// priority, PGN, and source address of extended message IDs first, and then
+// only the PGN. Nil is returned if no message matches.
+func (db *Database) J1939Message(id J1939ID) *Message {
+	if m := db.Message(id.CANID(), true); m != nil {
+		return m
+	}
+
+	return db.byPGN[id.PGN]
+}
+
+// DecodeJ1939 decodes a parameter group with the matching message (see
+// J1939Message). Signals that are not available or in error (for example
+// 0xff or 0xfe of 8 bit signals) are left out.
+func (db *Database) DecodeJ1939(msg J1939Message) (*Message, []SignalValue, error) {
+	m := db.J1939Message(msg.ID)
+	if m == nil {
+		return nil, nil, nil
+	}
+
+	values, err := m.Decode(msg.Data)
+	if err != nil {
+		return m, nil, err
+	}
+
+	ret := values[:0]
+
+	for _, v := range values {
+		if j1939Valid(v.Signal, uint64(v.Raw)) {
+			ret = append(ret, v)
+		}
+	}
+
+	return m, ret, nil
+}
+
+// j1939Valid returns false if the raw value is in the not available or error
+// ranges of J1939-71
+func j1939Valid(s *Signal, raw uint64) bool {
+	if s.Type != Integer || s.Length < 2 || s.Length > 32 {
+		return true
+	}
+
+	raw &= 1<<s.Length - 1
+
+	if s.Length >= 8 {
+		// the most significant byte is 0xfb - 0xff
+		return raw>>(s.Length-8) <= 0xfa
+	}
+
+	// discrete parameters, the two highest values are error and not
+	// available
+	return raw < 1<<s.Length-2
+}
@@ -0,0 +1,193 @@
+package canbus
+
+import (
+	"strings"
+	"testing"
+)
+
+var testJ1939DBC = `VERSION ""
+
+BO_ 2364540158 EEC1: 8 Vector__XXX
+ SG_ EngTorqueMode : 0|4@1+ (1,0) [0|15] "" Vector__XXX
+ SG_ EngSpeed : 24|16@1+ (0.125,0) [0|8031.875] "rpm" Vector__XXX
+ SG_ EngStarterMode : 48|4@1+ (1,0) [0|15] "" Vector__XXX
+
+BO_ 2566841088 EC1: 40 Vector__XXX
+ SG_ EngSpeedAtIdlePoint1 : 0|16@1+ (0.125,0) [0|8031.875] "rpm" Vector__XXX
+ SG_ EngPercentTorqueAtIdlePoint1 : 16|8@1+ (1,-125) [-125|125] "%" Vector__XXX
+ SG_ EngMaxMomentaryOverrideTime : 152|8@1+ (0.1,0) [0|25] "s" Vector__XXX
+
+BA_DEF_ SG_ "SPN" INT 0 524287;
+BA_ "SPN" SG_ 2364540158 EngSpeed 190;
+BA_ "SPN" SG_ 2566841088 EngSpeedAtIdlePoint1 188;
+`
+
+func TestJ1939ID(t *testing.T) {
+	id := ParseJ1939ID(0x0cf00400)
+	exp := J1939ID{Priority: 3, PGN: 0xf004, Source: 0, Destination: 0xff}
+	if id != exp {
+		t.Errorf("Expected %+v, got %+v", exp, id)
+	}
+
+	if id.CANID() != 0x0cf00400 {
+		t.Errorf("Wrong CAN ID: %x", id.CANID())
+	}
+
+	// PDU1, the destination is not part of the PGN
+	id = ParseJ1939ID(0x18ea0bf9)
+	exp = J1939ID{Priority: 6, PGN: 0xea00, Source: 0xf9, Destination: 0x0b}
+	if id != exp {
+		t.Errorf("Expected %+v, got %+v", exp, id)
+	}
+
+	if id.CANID() != 0x18ea0bf9 {
+		t.Errorf("Wrong CAN ID: %x", id.CANID())
+	}
+}
+
+func j1939Frame(id J1939ID, data ...byte) Frame {
+	return Frame{ID: id.CANID(), Extended: true, Data: data}
+}
+
+func TestJ1939Decode(t *testing.T) {
+	db, err := ParseDBC(strings.NewReader(testJ1939DBC))
+	if err != nil {
+		t.Fatal("Error parsing: ", err)
+	}
+
+	if db.Messages[0].Signals[1].SPN != 190 {
+		t.Error("SPN not parsed: ", db.Messages[0].Signals[1].SPN)
+	}
+
+	j := NewJ1939()
+
+	// EEC1 from source 0, the DBC message is from 0xfe so the PGN is
+	// matched. The torque mode is not available.
+	msg, ok := j.Receive(j1939Frame(J1939ID{Priority: 3, PGN: 0xf004},
+		0xff, 0, 0, 0x40, 0x1f, 0, 0x0e, 0xff))
+	if !ok {
+		t.Fatal("Single frame message not received")
+	}
+
+	m, values, err := db.DecodeJ1939(msg)
+	if err != nil {
+		t.Fatal("Error decoding: ", err)
+	}
+
+	if m == nil || m.Name != "EEC1" {
+		t.Fatal("EEC1 not matched")
+	}
+
+	if len(values) != 1 || values[0].Signal.Name != "EngSpeed" ||
+		values[0].Value != 1000 {
+		t.Errorf("EEC1 not decoded: %+v", values)
+	}
+}
+
+func TestJ1939Transport(t *testing.T) {
+	db, err := ParseDBC(strings.NewReader(testJ1939DBC))
+	if err != nil {
+		t.Fatal("Error parsing: ", err)
+	}
+
+	payload := make([]byte, 20)
+	for i := range payload {
+		payload[i] = 0xff
+	}
+	payload[0], payload[1] = 0x40, 0x06 // 200 rpm
+	payload[2] = 135                    // 10 %
+	payload[19] = 50                    // 5 s
+
+	packets := func(seqs ...int) []Frame {
+		var ret []Frame
+		for _, seq := range seqs {
+			data := []byte{byte(seq), 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+			copy(data[1:], payload[(seq-1)*7:])
+			ret = append(ret, j1939Frame(J1939ID{Priority: 7,
+				PGN: PGNTPDT, Source: 0, Destination: 0xff}, data...))
+		}
+		return ret
+	}
+
+	bam := j1939Frame(J1939ID{Priority: 7, PGN: PGNTPCM, Source: 0,
+		Destination: 0xff}, 32, 20, 0, 3, 0xff, 0xe3, 0xfe, 0)
+
+	frames := append([]Frame{bam}, packets(1, 2, 3)...)
+
+	j := NewJ1939()
+
+	var msg J1939Message
+	received := 0
+
+	for _, f := range frames {
+		if m, ok := j.Receive(f); ok {
+			msg = m
+			received++
+		}
+	}
+
+	if received != 1 {
+		t.Fatal("Expected 1 message, got: ", received)
+	}
+
+	if msg.ID.PGN != 0xfee3 || len(msg.Data) != 20 {
+		t.Fatalf("Wrong message: %+v", msg)
+	}
+
+	m, values, err := db.DecodeJ1939(msg)
+	if err != nil {
+		t.Fatal("Error decoding: ", err)
+	}
+
+	if m == nil || m.Name != "EC1" {
+		t.Fatal("EC1 not matched")
+	}
+
+	exp := map[string]float64{
+		"EngSpeedAtIdlePoint1":         200,
+		"EngPercentTorqueAtIdlePoint1": 10,
+		"EngMaxMomentaryOverrideTime":  5,
+	}
+
+	if len(values) != len(exp) {
+		t.Fatalf("Wrong values: %+v", values)
+	}
+
+	for _, v := range values {
+		if v.Value != exp[v.Signal.Name] {
+			t.Errorf("%v: expected %v, got %v", v.Signal.Name,
+				exp[v.Signal.Name], v.Value)
+		}
+	}
+
+	// a missing packet drops the message
+	frames = append([]Frame{bam}, packets(1, 3)...)
+	for _, f := range frames {
+		if _, ok := j.Receive(f); ok {
+			t.Error("Message with missing packet received")
+		}
+	}
+
+	// RTS/CTS connection from 0 to 0x0b, with a packet resent
+	rts := j1939Frame(J1939ID{Priority: 7, PGN: PGNTPCM, Source: 0,
+		Destination: 0x0b}, 16, 20, 0, 3, 0xff, 0xe3, 0xfe, 0)
+
+	frames = []Frame{rts}
+	for _, f := range packets(1, 2, 2, 3) {
+		f.ID = J1939ID{Priority: 7, PGN: PGNTPDT, Source: 0,
+			Destination: 0x0b}.CANID()
+		frames = append(frames, f)
+	}
+
+	received = 0
+	for _, f := range frames {
+		if m, ok := j.Receive(f); ok {
+			msg = m
+			received++
+		}
+	}
+
+	if received != 1 || msg.ID.Destination != 0x0b || msg.Data[19] != 50 {
+		t.Errorf("RTS/CTS message not received: %v %+v", received, msg)
+	}
+}
@@ -0,0 +1,74 @@
+package client
+
+import (
+	"sort"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// Alarm describes an active rule
+type Alarm struct {
+	RuleID      string    `json:"ruleId"`
+	Parent      string    `json:"parent"`
+	Description string    `json:"description"`
+	Severity    string    `json:"severity"`
+	Priority    int       `json:"priority"`
+	Time        time.Time `json:"time"`
+}
+
+// GetAlarms returns all active rules under a node, sorted by priority and
+// then by the time the rule became active (newest first).
+func GetAlarms(nc *nats.Conn, id string) ([]Alarm, error) {
+	nodes, err := GetNodeChildren(nc, id, "", false, true)
+	if err != nil {
+		return nil, err
+	}
+
+	var ret []Alarm
+
+	for _, n := range nodes {
+		if n.Type != data.NodeTypeRule {
+			continue
+		}
+
+		active, ok := n.Points.Find(data.PointTypeActive, "")
+		if !ok || active.Value == 0 {
+			continue
+		}
+
+		var r Rule
+		err := data.Decode(data.NodeEdgeChildren{NodeEdge: n}, &r)
+		if err != nil {
+			return nil, err
+		}
+
+		if r.Disable {
+			continue
+		}
+
+		ret = append(ret, Alarm{
+			RuleID:      r.ID,
+			Parent:      r.Parent,
+			Description: r.Description,
+			Severity:    r.Severity,
+			Priority:    r.EffectivePriority(),
+			Time:        active.Time,
+		})
+	}
+
+	SortAlarms(ret)
+
+	return ret, nil
+}
+
+// SortAlarms sorts alarms by priority and then by time (newest first)
+func SortAlarms(alarms []Alarm) {
+	sort.SliceStable(alarms, func(i, j int) bool {
+		if alarms[i].Priority != alarms[j].Priority {
+			return alarms[i].Priority < alarms[j].Priority
+		}
+		return alarms[i].Time.After(alarms[j].Time)
+	})
+}
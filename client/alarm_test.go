@@ -0,0 +1,88 @@
+package client_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+	"github.com/simpleiot/simpleiot/server"
+)
+
+func TestGetAlarms(t *testing.T) {
+	nc, root, stop, err := server.TestServer()
+
+	if err != nil {
+		t.Fatal("Error starting test server: ", err)
+	}
+
+	defer stop()
+
+	group := data.NodeEdge{
+		ID:     "ID-group",
+		Type:   data.NodeTypeGroup,
+		Parent: root.ID,
+	}
+
+	err = client.SendNode(nc, group, "test")
+	if err != nil {
+		t.Fatal("Error sending group: ", err)
+	}
+
+	now := time.Now()
+
+	rules := []struct {
+		id       string
+		parent   string
+		severity string
+		priority float64
+		active   bool
+		time     time.Time
+	}{
+		{"ID-info", root.ID, data.PointValueInfo, 0, true, now},
+		{"ID-crit-old", group.ID, data.PointValueCritical, 0, true, now.Add(-time.Minute)},
+		{"ID-crit-new", root.ID, data.PointValueCritical, 0, true, now},
+		{"ID-warning-inactive", root.ID, data.PointValueWarning, 0, false, now},
+		{"ID-info-pri", group.ID, data.PointValueInfo, 2, true, now},
+	}
+
+	for _, r := range rules {
+		n := data.NodeEdge{
+			ID:     r.id,
+			Type:   data.NodeTypeRule,
+			Parent: r.parent,
+			Points: data.Points{
+				{Type: data.PointTypeDescription, Text: r.id},
+				{Type: data.PointTypeSeverity, Text: r.severity},
+				{Type: data.PointTypePriority, Value: r.priority},
+				{Type: data.PointTypeActive, Value: data.BoolToFloat(r.active), Time: r.time},
+			},
+		}
+
+		err = client.SendNode(nc, n, "test")
+		if err != nil {
+			t.Fatal("Error sending rule: ", err)
+		}
+	}
+
+	alarms, err := client.GetAlarms(nc, root.ID)
+	if err != nil {
+		t.Fatal("Error getting alarms: ", err)
+	}
+
+	exp := []string{"ID-crit-new", "ID-crit-old", "ID-info-pri", "ID-info"}
+
+	if len(alarms) != len(exp) {
+		t.Fatalf("expected %v alarms, got: %+v", len(exp), alarms)
+	}
+
+	for i, a := range alarms {
+		if a.RuleID != exp[i] {
+			t.Errorf("alarm %v: expected %v, got %v", i, exp[i], a.RuleID)
+		}
+	}
+
+	if alarms[0].Severity != data.PointValueCritical || alarms[0].Priority != 1 {
+		t.Error("wrong severity/priority: ", alarms[0])
+	}
+}
@@ -0,0 +1,71 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// AddAnnotation attaches an annotation to a node. If the annotation ID is
+// blank, a new one is created. The annotation ID is returned.
+func AddAnnotation(nc *nats.Conn, nodeID string, a data.Annotation) (string, error) {
+	if a.ID == "" {
+		a.ID = uuid.New().String()
+	}
+
+	if a.Start.IsZero() {
+		a.Start = time.Now()
+	}
+
+	if !a.End.IsZero() && a.End.Before(a.Start) {
+		return "", errors.New("annotation end is before start")
+	}
+
+	err := SendNodePoint(nc, nodeID, a.ToPoint(), true)
+	if err != nil {
+		return "", fmt.Errorf("Error sending annotation: %w", err)
+	}
+
+	return a.ID, nil
+}
+
+// GetAnnotations returns all annotations for a node
+func GetAnnotations(nc *nats.Conn, nodeID string) ([]data.Annotation, error) {
+	nodes, err := GetNode(nc, nodeID, "none")
+	if err != nil {
+		return nil, err
+	}
+
+	if len(nodes) < 1 {
+		return nil, data.ErrDocumentNotFound
+	}
+
+	return nodes[0].Points.Annotations(), nil
+}
+
+// DeleteAnnotation removes an annotation from a node
+func DeleteAnnotation(nc *nats.Conn, nodeID, id, origin string) error {
+	nodes, err := GetNode(nc, nodeID, "none")
+	if err != nil {
+		return err
+	}
+
+	if len(nodes) < 1 {
+		return data.ErrDocumentNotFound
+	}
+
+	p, ok := nodes[0].Points.Find(data.PointTypeAnnotation, id)
+	if !ok {
+		return errors.New("annotation not found")
+	}
+
+	// the store accepts points with the same timestamp, so we keep the
+	// annotation time and just set the tombstone
+	p.Tombstone = 1
+
+	return SendNodePoint(nc, nodeID, p, true)
+}
@@ -0,0 +1,52 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+func attestRequest(nc *nats.Conn, subject string, req data.AttestRequest) (data.AttestResponse, error) {
+	var resp data.AttestResponse
+
+	d, err := json.Marshal(req)
+	if err != nil {
+		return resp, err
+	}
+
+	msg, err := nc.Request(subject, d, time.Second*5)
+	if err != nil {
+		return resp, fmt.Errorf("Error sending attestation request: %w", err)
+	}
+
+	err = json.Unmarshal(msg.Data, &resp)
+	if err != nil {
+		return resp, fmt.Errorf("Error decoding attestation response: %w", err)
+	}
+
+	if resp.Error != "" {
+		return resp, errors.New(resp.Error)
+	}
+
+	return resp, nil
+}
+
+// AttestChallenge returns a challenge for a device to sign (see
+// data.SignAttestation). A challenge is returned whether or not the device
+// is enrolled.
+func AttestChallenge(nc *nats.Conn, deviceID string) ([]byte, error) {
+	resp, err := attestRequest(nc, SubjectAttestChallenge(),
+		data.AttestRequest{DeviceID: deviceID})
+	return resp.Challenge, err
+}
+
+// AttestVerify sends a signed challenge and returns the NATS credentials
+// issued to the device (see IssueDeviceCreds and DeviceCredsData)
+func AttestVerify(nc *nats.Conn, req data.AttestRequest) (string, error) {
+	resp, err := attestRequest(nc, SubjectAttestVerify(), req)
+	return resp.Creds, err
+}
@@ -0,0 +1,41 @@
+package client
+
+import (
+	"fmt"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// HeaderBackfill is set on phrup.<parent>.<nodeID> messages the store
+// publishes for backfilled points, so history clients can tell them apart
+// from high rate samples.
+const HeaderBackfill = "Siot-Backfill"
+
+// SendBackfill sends historical points of a node, for example when importing
+// data from a replaced system or filling gaps after recovery. The points
+// must have a time. The store publishes them to the history clients (Influx
+// db, retention, etc) above the node, but they are not written to the node
+// and rules do not see them. Points are sent in chunks of
+// DefaultHighRateChunkSize.
+func SendBackfill(nc *nats.Conn, nodeID string, points data.Points) error {
+	for _, p := range points {
+		if p.Time.IsZero() {
+			return fmt.Errorf("backfill point %v does not have a time", p.Type)
+		}
+	}
+
+	for start := 0; start < len(points); start += DefaultHighRateChunkSize {
+		end := start + DefaultHighRateChunkSize
+		if end > len(points) {
+			end = len(points)
+		}
+
+		err := SendPoints(nc, SubjectNodeBackfill(nodeID), points[start:end], true)
+		if err != nil {
+			return fmt.Errorf("Error sending backfill points: %w", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,609 @@
+package client
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/bacnet"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// Bacnet communicates with BACnet/IP devices through the UDP Port (default
+// 47808). BroadcastAddress is the address Who-Is requests are sent to,
+// which defaults to 255.255.255.255. IOs without COV are read every
+// PollPeriod ms. Setting Discover creates IO children for the objects of
+// the devices on the network that are not configured yet.
+type Bacnet struct {
+	ID               string     `node:"id"`
+	Parent           string     `node:"parent"`
+	Description      string     `point:"description"`
+	Port             int        `point:"port"`
+	BroadcastAddress string     `point:"broadcastAddress"`
+	PollPeriod       int        `point:"pollPeriod"`
+	Discover         bool       `point:"discover"`
+	Disable          bool       `point:"disable"`
+	ErrorCount       int        `point:"errorCount"`
+	IOs              []BacnetIO `child:"bacnetIo"`
+}
+
+// BacnetIO maps the present value of a BACnet object to the value point.
+// ObjectType is the object type name, for example analogInput or
+// binaryOutput. With COV set, the client subscribes to changes of the
+// object instead of polling it. Unless ReadOnly is set, valueSet points are
+// written to the present value with Priority (1-16, default 16).
+type BacnetIO struct {
+	ID          string  `node:"id"`
+	Parent      string  `node:"parent"`
+	Description string  `point:"description"`
+	DeviceID    int     `point:"bacnetDeviceID"`
+	ObjectType  string  `point:"bacnetObjectType"`
+	Instance    int     `point:"bacnetInstance"`
+	COV         bool    `point:"cov"`
+	Priority    int     `point:"priority"`
+	Value       float64 `point:"value"`
+	ValueSet    float64 `point:"valueSet"`
+	ReadOnly    bool    `point:"readOnly"`
+	Disable     bool    `point:"disable"`
+}
+
+// how long to wait before reconnecting
+var bacnetRetryPeriod = 10 * time.Second
+
+const (
+	// lifetime of COV subscriptions, which are renewed after 3/4 of it
+	bacnetCOVLifetime = 5 * time.Minute
+	// how long to wait for I-Am responses when discovering devices
+	bacnetDiscoverWait = 3 * time.Second
+	// limit of IOs created by discovery
+	bacnetDiscoverObjects = 1000
+	// subscriber process ID of COV subscriptions
+	bacnetProcessID = 1
+)
+
+// BacnetClient is a SIOT client that maps BACnet objects to points
+type BacnetClient struct {
+	nc            *nats.Conn
+	config        Bacnet
+	stop          chan struct{}
+	newPoints     chan NewPoints
+	newEdgePoints chan NewPoints
+	conn          *bacnet.Client
+	// device addresses by device ID
+	addrs map[uint32]bacnet.Address
+	// IDs of the IOs that are polled
+	polled []string
+	// IDs of the IOs with COV subscriptions by object
+	subscribed map[bacnetObject]string
+	// last value sent for polled IOs
+	values map[string]float64
+}
+
+// bacnetObject identifies an object on the network
+type bacnetObject struct {
+	device uint32
+	object bacnet.ObjectID
+}
+
+// NewBacnetClient ...
+func NewBacnetClient(nc *nats.Conn, config Bacnet) Client {
+	return &BacnetClient{
+		nc:            nc,
+		config:        config,
+		stop:          make(chan struct{}),
+		newPoints:     make(chan NewPoints),
+		newEdgePoints: make(chan NewPoints),
+	}
+}
+
+// Start runs the main logic for this client and blocks until stopped
+func (b *BacnetClient) Start() error {
+	log.Println("Starting BACnet client: ", b.config.Description)
+
+	retry := time.NewTimer(0)
+	defer retry.Stop()
+
+	poll := time.NewTicker(time.Hour)
+	defer poll.Stop()
+
+	renew := time.NewTicker(bacnetCOVLifetime * 3 / 4)
+	defer renew.Stop()
+
+	reconnect := func() {
+		b.disconnect()
+		retry.Reset(0)
+	}
+
+done:
+	for {
+		var notifications <-chan bacnet.COVNotification
+		if b.conn != nil {
+			notifications = b.conn.Notifications()
+		}
+
+		select {
+		case <-b.stop:
+			log.Println("Stopping BACnet client: ", b.config.Description)
+			break done
+		case <-retry.C:
+			b.disconnect()
+
+			if b.config.Disable {
+				break
+			}
+
+			err := b.connect()
+			if err != nil {
+				log.Printf("BACnet %v: error connecting: %v\n",
+					b.config.Description, err)
+				b.error()
+				b.disconnect()
+				retry.Reset(bacnetRetryPeriod)
+				break
+			}
+
+			period := b.config.PollPeriod
+			if period <= 0 {
+				period = 5000
+			}
+			poll.Reset(time.Duration(period) * time.Millisecond)
+
+			if b.config.Discover {
+				b.discover()
+			}
+		case <-poll.C:
+			if b.conn != nil {
+				b.poll()
+			}
+		case <-renew.C:
+			if b.conn != nil {
+				b.subscribe()
+			}
+		case n := <-notifications:
+			ioID, ok := b.subscribed[bacnetObject{n.Device, n.Object}]
+			if !ok {
+				break
+			}
+
+			v, ok := n.Values[bacnet.PropPresentValue]
+			if ok {
+				b.sendValue(ioID, v)
+			}
+		case pts := <-b.newPoints:
+			err := data.MergePoints(pts.ID, pts.Points, &b.config)
+			if err != nil {
+				log.Println("error merging new points: ", err)
+			}
+
+			for _, p := range pts.Points {
+				switch p.Type {
+				case data.PointTypePort, data.PointTypeBroadcastAddress,
+					data.PointTypePollPeriod, data.PointTypeDisable,
+					data.PointTypeBacnetDeviceID, data.PointTypeBacnetObjectType,
+					data.PointTypeBacnetInstance, data.PointTypeCOV:
+					reconnect()
+				case data.PointTypeValueSet:
+					b.write(pts.ID, p)
+				case data.PointTypeDiscover:
+					if b.config.Discover && b.conn != nil {
+						b.discover()
+					}
+				}
+			}
+		case pts := <-b.newEdgePoints:
+			err := data.MergeEdgePoints(pts.ID, pts.Parent, pts.Points, &b.config)
+			if err != nil {
+				log.Println("error merging new points: ", err)
+			}
+		}
+	}
+
+	b.disconnect()
+
+	return nil
+}
+
+// connect opens the BACnet port, sends the current values of the IOs, and
+// subscribes to the IOs with COV set
+func (b *BacnetClient) connect() error {
+	port := b.config.Port
+	if port <= 0 {
+		port = bacnet.DefaultPort
+	}
+
+	broadcast := b.config.BroadcastAddress
+	if broadcast == "" {
+		broadcast = "255.255.255.255"
+	}
+
+	if _, _, err := net.SplitHostPort(broadcast); err != nil {
+		broadcast = net.JoinHostPort(broadcast, fmt.Sprint(bacnet.DefaultPort))
+	}
+
+	var err error
+	b.conn, err = bacnet.NewClient(bacnet.ClientOptions{
+		Address:   fmt.Sprintf(":%v", port),
+		Broadcast: broadcast,
+	})
+	if err != nil {
+		return err
+	}
+
+	b.addrs = make(map[uint32]bacnet.Address)
+	b.values = make(map[string]float64)
+	b.polled = nil
+
+	for _, io := range b.config.IOs {
+		if !io.Disable {
+			b.polled = append(b.polled, io.ID)
+		}
+	}
+
+	// reads the initial values
+	b.poll()
+	b.subscribe()
+
+	return nil
+}
+
+func (b *BacnetClient) disconnect() {
+	if b.conn != nil {
+		b.conn.Close()
+	}
+
+	b.conn = nil
+	b.subscribed = nil
+}
+
+func (b *BacnetClient) error() {
+	b.config.ErrorCount++
+	b.sendStat(data.PointTypeErrorCount, b.config.ErrorCount)
+}
+
+func (b *BacnetClient) io(ioID string) *BacnetIO {
+	for i := range b.config.IOs {
+		if b.config.IOs[i].ID == ioID {
+			return &b.config.IOs[i]
+		}
+	}
+	return nil
+}
+
+// address returns the address of a device, which is found with Who-Is the
+// first time
+func (b *BacnetClient) address(device uint32) (bacnet.Address, error) {
+	if addr, ok := b.addrs[device]; ok {
+		return addr, nil
+	}
+
+	devices, err := b.conn.WhoIs(int(device), int(device), bacnetDiscoverWait)
+	if err != nil {
+		return bacnet.Address{}, err
+	}
+
+	if len(devices) <= 0 {
+		return bacnet.Address{}, fmt.Errorf("device %v not found", device)
+	}
+
+	b.addrs[device] = devices[0].Address
+	return devices[0].Address, nil
+}
+
+// object returns the address and object of an IO
+func (b *BacnetClient) object(io *BacnetIO) (bacnet.Address, bacnet.ObjectID, error) {
+	t, err := bacnet.ParseObjectType(io.ObjectType)
+	if err != nil {
+		return bacnet.Address{}, bacnet.ObjectID{}, err
+	}
+
+	obj := bacnet.ObjectID{Type: t, Instance: uint32(io.Instance)}
+
+	addr, err := b.address(uint32(io.DeviceID))
+	return addr, obj, err
+}
+
+// subscribe subscribes to or renews the COV subscriptions of the IOs with
+// COV set. IOs that can't be subscribed are polled instead.
+func (b *BacnetClient) subscribe() {
+	subscribed := make(map[bacnetObject]string)
+	var polled []string
+
+	for _, id := range b.polled {
+		io := b.io(id)
+		if io != nil && !io.COV {
+			polled = append(polled, id)
+		}
+	}
+
+	for i := range b.config.IOs {
+		io := &b.config.IOs[i]
+		if io.Disable || !io.COV {
+			continue
+		}
+
+		addr, obj, err := b.object(io)
+		if err == nil {
+			err = b.conn.SubscribeCOV(addr, bacnetProcessID, obj, bacnetCOVLifetime)
+		}
+
+		if err != nil {
+			log.Printf("BACnet %v: error subscribing to %v, polling instead: %v\n",
+				b.config.Description, io.Description, err)
+			b.error()
+			polled = append(polled, io.ID)
+			continue
+		}
+
+		subscribed[bacnetObject{uint32(io.DeviceID), obj}] = io.ID
+	}
+
+	b.subscribed = subscribed
+	b.polled = polled
+}
+
+// poll reads the IOs without COV subscriptions and sends the values that
+// changed
+func (b *BacnetClient) poll() {
+	for _, id := range b.polled {
+		io := b.io(id)
+		if io == nil {
+			continue
+		}
+
+		addr, obj, err := b.object(io)
+		if err != nil {
+			log.Printf("BACnet %v: %v: %v\n", b.config.Description,
+				io.Description, err)
+			b.error()
+			continue
+		}
+
+		v, err := b.conn.ReadValue(addr, obj, bacnet.PropPresentValue)
+		if err != nil {
+			log.Printf("BACnet %v: error reading %v: %v\n",
+				b.config.Description, io.Description, err)
+			b.error()
+			continue
+		}
+
+		b.sendValue(io.ID, v)
+	}
+}
+
+// sendValue sends a present value to an IO node if it changed
+func (b *BacnetClient) sendValue(ioID string, v bacnet.Value) {
+	p, ok := bacnetPoint(v, time.Now())
+	if !ok {
+		log.Printf("BACnet %v: %v: unsupported value: %v\n",
+			b.config.Description, ioID, v.Value)
+		return
+	}
+
+	if last, ok := b.values[ioID]; ok && last == p.Value {
+		return
+	}
+
+	b.values[ioID] = p.Value
+
+	err := SendNodePoint(b.nc, ioID, p, false)
+	if err != nil {
+		log.Println("BACnet: error sending value: ", err)
+	}
+}
+
+// write writes a valueSet point of an IO to the present value of its
+// object
+func (b *BacnetClient) write(ioID string, p data.Point) {
+	io := b.io(ioID)
+	if io == nil || io.ReadOnly || io.Disable {
+		return
+	}
+
+	err := b.writeIO(io, p)
+	if err != nil {
+		log.Printf("BACnet %v: error writing %v: %v\n", b.config.Description,
+			io.Description, err)
+		b.error()
+	}
+
+	err = ConfirmCommand(b.nc, ioID, p, err)
+	if err != nil {
+		log.Println("BACnet: error confirming value set: ", err)
+	}
+}
+
+func (b *BacnetClient) writeIO(io *BacnetIO, p data.Point) error {
+	if b.conn == nil {
+		return fmt.Errorf("not connected")
+	}
+
+	addr, obj, err := b.object(io)
+	if err != nil {
+		return err
+	}
+
+	if obj.Type.Input() {
+		return fmt.Errorf("can't write %v objects", obj.Type)
+	}
+
+	v, err := bacnet.PresentValue(obj.Type, p.Value)
+	if err != nil {
+		return err
+	}
+
+	priority := io.Priority
+	if priority <= 0 || priority > 16 {
+		priority = 16
+	}
+
+	err = b.conn.WriteProperty(addr, obj, bacnet.PropPresentValue, v, priority)
+	if err != nil {
+		return err
+	}
+
+	b.sendValue(io.ID, v)
+	return nil
+}
+
+// discover creates IO nodes for the objects of the devices on the network
+// that are not configured yet, and clears the discover point
+func (b *BacnetClient) discover() {
+	// no origin so that the client is not restarted before the IOs are
+	// created
+	err := SendNodePoint(b.nc, b.config.ID, data.Point{
+		Type:  data.PointTypeDiscover,
+		Value: 0,
+	}, true)
+	if err != nil {
+		log.Println("BACnet: error clearing discover: ", err)
+	}
+
+	b.config.Discover = false
+
+	devices, err := b.conn.WhoIs(-1, -1, bacnetDiscoverWait)
+	if err != nil {
+		log.Printf("BACnet %v: error discovering devices: %v\n",
+			b.config.Description, err)
+		b.error()
+		return
+	}
+
+	for _, d := range devices {
+		b.addrs[d.ID] = d.Address
+	}
+
+	configured := make(map[bacnetObject]bool)
+	for _, io := range b.config.IOs {
+		t, err := bacnet.ParseObjectType(io.ObjectType)
+		if err == nil {
+			configured[bacnetObject{uint32(io.DeviceID),
+				bacnet.ObjectID{Type: t, Instance: uint32(io.Instance)}}] = true
+		}
+	}
+
+	ios, err := bacnetObjects(b.conn, devices, configured)
+	if err != nil {
+		log.Printf("BACnet %v: error discovering objects: %v\n",
+			b.config.Description, err)
+		b.error()
+	}
+
+	log.Printf("BACnet %v: found %v devices and %v new objects\n",
+		b.config.Description, len(devices), len(ios))
+
+	for _, io := range ios {
+		io.ID = uuid.New().String()
+		io.Parent = b.config.ID
+		io.ReadOnly = true
+
+		// the origin restarts the client so it reads the new IOs
+		err := sendChildNodeType(b.nc, io, data.NodeTypeBacnetIO, b.config.ID)
+		if err != nil {
+			log.Println("BACnet: error creating IO: ", err)
+			return
+		}
+	}
+}
+
+func (b *BacnetClient) sendStat(typ string, value int) {
+	err := SendNodePoint(b.nc, b.config.ID, data.Point{
+		Time:  time.Now(),
+		Type:  typ,
+		Value: float64(value),
+	}, false)
+	if err != nil {
+		log.Println("BACnet: error sending stat: ", err)
+	}
+}
+
+// Stop sends a signal to the Start function to exit
+func (b *BacnetClient) Stop(err error) {
+	close(b.stop)
+}
+
+// Points is called by the Manager when new points for this
+// node are received.
+func (b *BacnetClient) Points(nodeID string, points []data.Point) {
+	b.newPoints <- NewPoints{nodeID, "", points}
+}
+
+// EdgePoints is called by the Manager when new edge points for this
+// node are received.
+func (b *BacnetClient) EdgePoints(nodeID, parentID string, points []data.Point) {
+	b.newEdgePoints <- NewPoints{nodeID, parentID, points}
+}
+
+// bacnetPoint converts a present value to a value point. Binary values are
+// 0 or 1 and multi-state values are the state number.
+func bacnetPoint(v bacnet.Value, now time.Time) (data.Point, bool) {
+	f, ok := v.Float()
+	if !ok {
+		return data.Point{}, false
+	}
+
+	return data.Point{
+		Time:  now,
+		Type:  data.PointTypeValue,
+		Value: f,
+	}, true
+}
+
+// bacnetDiscoverer reads the objects of a device
+type bacnetDiscoverer interface {
+	ObjectList(addr bacnet.Address, device uint32) ([]bacnet.ObjectID, error)
+	ReadValue(addr bacnet.Address, obj bacnet.ObjectID, prop uint32) (bacnet.Value, error)
+}
+
+// bacnetObjects returns IOs for the objects of devices that are not
+// configured. Only analog, binary, and multi-state objects are returned.
+// The description of an IO is the object name.
+func bacnetObjects(d bacnetDiscoverer, devices []bacnet.Device, configured map[bacnetObject]bool) ([]BacnetIO, error) {
+	var ret []BacnetIO
+
+	sort.Slice(devices, func(i, j int) bool {
+		return devices[i].ID < devices[j].ID
+	})
+
+	for _, dev := range devices {
+		objects, err := d.ObjectList(dev.Address, dev.ID)
+		if err != nil {
+			return ret, fmt.Errorf("device %v: %w", dev.ID, err)
+		}
+
+		for _, obj := range objects {
+			if len(ret) >= bacnetDiscoverObjects {
+				return ret, nil
+			}
+
+			if obj.Type == bacnet.DeviceObject ||
+				configured[bacnetObject{dev.ID, obj}] {
+				continue
+			}
+
+			// PresentValue only fails for unsupported object types
+			if _, err := bacnet.PresentValue(obj.Type, 1); err != nil {
+				continue
+			}
+
+			description := obj.String()
+			name, err := d.ReadValue(dev.Address, obj, bacnet.PropObjectName)
+			if s, ok := name.Value.(string); err == nil && ok && s != "" {
+				description = s
+			}
+
+			ret = append(ret, BacnetIO{
+				Description: description,
+				DeviceID:    int(dev.ID),
+				ObjectType:  obj.Type.String(),
+				Instance:    int(obj.Instance),
+				COV:         true,
+			})
+		}
+	}
+
+	return ret, nil
+}
@@ -0,0 +1,81 @@
+package client
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/simpleiot/simpleiot/bacnet"
+)
+
+func TestBacnetPoint(t *testing.T) {
+	now := time.Now()
+
+	p, ok := bacnetPoint(bacnet.Value{Tag: bacnet.TagReal, Value: float32(21.5)}, now)
+	if !ok || p.Value != 21.5 || !p.Time.Equal(now) {
+		t.Error("real got ", p, ok)
+	}
+
+	p, ok = bacnetPoint(bacnet.Value{Tag: bacnet.TagEnumerated, Value: uint32(1)}, now)
+	if !ok || p.Value != 1 {
+		t.Error("enumerated got ", p, ok)
+	}
+
+	_, ok = bacnetPoint(bacnet.Value{Tag: bacnet.TagCharacterString, Value: "on"}, now)
+	if ok {
+		t.Error("strings should not be converted")
+	}
+}
+
+type testBacnetDevices map[uint32][]bacnet.ObjectID
+
+func (d testBacnetDevices) ObjectList(addr bacnet.Address, device uint32) ([]bacnet.ObjectID, error) {
+	return d[device], nil
+}
+
+func (d testBacnetDevices) ReadValue(addr bacnet.Address, obj bacnet.ObjectID, prop uint32) (bacnet.Value, error) {
+	if obj.Instance == 3 {
+		return bacnet.Value{}, bacnet.Error{Class: 1, Code: 31}
+	}
+	return bacnet.Value{Tag: bacnet.TagCharacterString,
+		Value: fmt.Sprintf("%v-%v", obj.Type, obj.Instance)}, nil
+}
+
+func TestBacnetObjects(t *testing.T) {
+	devices := testBacnetDevices{
+		10: {
+			{Type: bacnet.DeviceObject, Instance: 10},
+			{Type: bacnet.AnalogInput, Instance: 1},
+			{Type: bacnet.BinaryOutput, Instance: 2},
+			// unsupported type
+			{Type: 17, Instance: 1},
+		},
+		20: {
+			{Type: bacnet.DeviceObject, Instance: 20},
+			{Type: bacnet.MultiStateValue, Instance: 3},
+		},
+	}
+
+	configured := map[bacnetObject]bool{
+		{10, bacnet.ObjectID{Type: bacnet.BinaryOutput, Instance: 2}}: true,
+	}
+
+	ios, err := bacnetObjects(devices, []bacnet.Device{{ID: 20}, {ID: 10}},
+		configured)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := []BacnetIO{
+		{Description: "analogInput-1", DeviceID: 10, ObjectType: "analogInput",
+			Instance: 1, COV: true},
+		// no object name
+		{Description: "multiStateValue:3", DeviceID: 20,
+			ObjectType: "multiStateValue", Instance: 3, COV: true},
+	}
+
+	if !reflect.DeepEqual(ios, exp) {
+		t.Errorf("Expected %+v, got %+v", exp, ios)
+	}
+}
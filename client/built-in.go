@@ -1,33 +1,211 @@
 package client
 
 import (
+	"errors"
 	"fmt"
+	"log"
 	"sync"
 
 	"github.com/nats-io/nats.go"
-	"github.com/oklog/run"
+	"github.com/simpleiot/simpleiot/data"
 )
 
-// BuiltInClients is used to manage the SIOT built in node clients
+// ClientManager manages all the clients of a node type (see Manager)
+type ClientManager interface {
+	Start() error
+	Stop(error)
+}
+
+// NewClientManager creates a ClientManager for the root node ID. A Manager
+// can be created with:
+//
+//	func(nc *nats.Conn, root string) client.ClientManager {
+//		return client.NewManager(nc, root, NewMyClient)
+//	}
+type NewClientManager func(nc *nats.Conn, root string) ClientManager
+
+type registeredClient struct {
+	name       string
+	newManager NewClientManager
+}
+
+// BuiltInClients is used to manage the SIOT built in node clients. Programs
+// that embed SIOT can add their own node type clients with Register.
 type BuiltInClients struct {
 	nc       *nats.Conn
 	stop     chan struct{}
 	stopOnce sync.Once
+
+	// the following are protected by lock
+	lock     sync.Mutex
+	clients  []registeredClient
+	rootID   string
+	managers []ClientManager
+	stopped  bool
+
+	// managers that are running
+	wg sync.WaitGroup
+	// receives the error (or nil) of the first manager that exits
+	chExit chan error
 }
 
 // NewBuiltInClients creates a new built in client manager
 func NewBuiltInClients(nc *nats.Conn) *BuiltInClients {
-	return &BuiltInClients{
-		nc:   nc,
-		stop: make(chan struct{}),
+	bic := &BuiltInClients{
+		nc:     nc,
+		stop:   make(chan struct{}),
+		chExit: make(chan error, 1),
+	}
+
+	register(bic, NewSerialDevClient)
+	register(bic, NewRuleClient)
+	register(bic, NewDbClient)
+	register(bic, NewSignalGeneratorClient)
+	register(bic, NewGsmModemClient)
+	register(bic, NewEmailIngestClient)
+	register(bic, NewFileIngestClient)
+	register(bic, NewS3ExportClient)
+	register(bic, NewKafkaClient)
+	register(bic, NewOpcUAClient)
+	register(bic, NewBacnetClient)
+	register(bic, NewSnmpClient)
+	register(bic, NewCanBusClient)
+	register(bic, NewCloudForwarderClient)
+	register(bic, NewWebhookClient)
+	register(bic, NewSequencerClient)
+	register(bic, NewLightingClient)
+	register(bic, NewTankClient)
+	register(bic, NewPumpGroupClient)
+	register(bic, NewGeneratorClient)
+	register(bic, NewHvacClient)
+	register(bic, NewColdChainClient)
+	register(bic, NewDoserClient)
+	register(bic, NewVibrationClient)
+	register(bic, NewOccupancyClient)
+	register(bic, NewConfigTemplateClient)
+	register(bic, NewCommissioningClient)
+	register(bic, NewCalcClient)
+
+	RegisterBuiltInSchemas()
+
+	return bic
+}
+
+// register registers a built in client, the node type is the config type
+// name like NewManager uses
+func register[T any](bic *BuiltInClients, construct func(*nats.Conn, T) Client) {
+	var x T
+	err := bic.Register(nodeTypeOf(x), func(nc *nats.Conn, root string) ClientManager {
+		return NewManager(nc, root, construct)
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
+// Register adds a client manager for a node type. It can be called before
+// or after Start. If the clients are already running, the manager is started
+// right away. name is the node type, which must be unique. Registered node
+// types are published as clientType points on the root node so the frontend
+// can offer them when adding nodes.
+func (bic *BuiltInClients) Register(name string, newManager NewClientManager) error {
+	if name == "" {
+		return errors.New("client name must be set")
+	}
+
+	bic.lock.Lock()
+	defer bic.lock.Unlock()
+
+	for _, c := range bic.clients {
+		if c.name == name {
+			return fmt.Errorf("client %v is already registered", name)
+		}
+	}
+
+	c := registeredClient{name: name, newManager: newManager}
+	bic.clients = append(bic.clients, c)
+
+	if bic.rootID != "" && !bic.stopped {
+		bic.startManager(c)
+
+		err := SendNodePoint(bic.nc, bic.rootID, data.Point{
+			Type: data.PointTypeClientType, Key: name, Value: 1}, false)
+		if err != nil {
+			log.Println("Error publishing client type: ", err)
+		}
+	}
+
+	return nil
+}
+
+// ClientTypes returns the registered node types
+func (bic *BuiltInClients) ClientTypes() []string {
+	bic.lock.Lock()
+	defer bic.lock.Unlock()
+
+	ret := make([]string, len(bic.clients))
+	for i, c := range bic.clients {
+		ret[i] = c.name
 	}
+
+	return ret
+}
+
+// startManager must be called with lock held
+func (bic *BuiltInClients) startManager(c registeredClient) {
+	m := c.newManager(bic.nc, bic.rootID)
+	bic.managers = append(bic.managers, m)
+
+	bic.wg.Add(1)
+	go func() {
+		defer bic.wg.Done()
+		err := m.Start()
+		if err != nil {
+			err = fmt.Errorf("%v client manager: %w", c.name, err)
+		}
+
+		select {
+		case bic.chExit <- err:
+		default:
+		}
+	}()
+}
+
+// publishClientTypes writes a clientType point for each registered client
+// and deletes the points of clients that are no longer registered
+func (bic *BuiltInClients) publishClientTypes(root data.NodeEdge, names []string) error {
+	registered := make(map[string]bool)
+	for _, n := range names {
+		registered[n] = true
+	}
+
+	var points data.Points
+
+	for _, p := range root.Points {
+		if p.Type == data.PointTypeClientType && !registered[p.Key] &&
+			p.Tombstone == 0 {
+			points = append(points, data.Point{Type: data.PointTypeClientType,
+				Key: p.Key, Tombstone: 1})
+		}
+	}
+
+	for _, n := range names {
+		p, ok := root.Points.Find(data.PointTypeClientType, n)
+		if !ok || p.Value != 1 || p.Tombstone != 0 {
+			points = append(points, data.Point{Type: data.PointTypeClientType,
+				Key: n, Value: 1})
+		}
+	}
+
+	if len(points) == 0 {
+		return nil
+	}
+
+	return SendNodePoints(bic.nc, root.ID, points, true)
 }
 
 // Start clients. This function blocks until error or stopped.
 func (bic *BuiltInClients) Start() error {
-	var g run.Group
-	var rootID string
-
 	nodes, err := GetNode(bic.nc, "root", "")
 	if err != nil {
 		return fmt.Errorf("Error starting build in clients getting root node: %v", err)
@@ -37,34 +215,44 @@ func (bic *BuiltInClients) Start() error {
 		return fmt.Errorf("Error starting build in clients no root node")
 	}
 
-	rootID = nodes[0].ID
-	_ = rootID
-
-	sc := NewManager(bic.nc, rootID, NewSerialDevClient)
-	g.Add(sc.Start, sc.Stop)
-
-	rc := NewManager(bic.nc, rootID, NewRuleClient)
-	g.Add(rc.Start, rc.Stop)
-
-	db := NewManager(bic.nc, rootID, NewDbClient)
-	g.Add(db.Start, db.Stop)
+	bic.lock.Lock()
+	bic.rootID = nodes[0].ID
+	names := make([]string, len(bic.clients))
+	for i, c := range bic.clients {
+		names[i] = c.name
+		if !bic.stopped {
+			bic.startManager(c)
+		}
+	}
+	bic.lock.Unlock()
 
-	sg := NewManager(bic.nc, rootID, NewSignalGeneratorClient)
-	g.Add(sg.Start, sg.Stop)
+	err = bic.publishClientTypes(nodes[0], names)
+	if err != nil {
+		log.Println("Error publishing client types: ", err)
+	}
 
-	g.Add(func() error {
-		<-bic.stop
-		return nil
-	}, func(_ error) {
-		bic.Stop(nil)
-	})
+	select {
+	case err = <-bic.chExit:
+	case <-bic.stop:
+	}
 
-	err = g.Run()
+	bic.Stop(nil)
+	bic.wg.Wait()
 
 	return err
 }
 
 // Stop clients
 func (bic *BuiltInClients) Stop(_ error) {
-	bic.stopOnce.Do(func() { close(bic.stop) })
+	bic.stopOnce.Do(func() {
+		close(bic.stop)
+
+		bic.lock.Lock()
+		defer bic.lock.Unlock()
+
+		bic.stopped = true
+		for _, m := range bic.managers {
+			m.Stop(nil)
+		}
+	})
 }
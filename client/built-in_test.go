@@ -0,0 +1,79 @@
+package client_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+	"github.com/simpleiot/simpleiot/server"
+)
+
+func TestBuiltInClientsRegister(t *testing.T) {
+	nc, root, stop, err := server.TestServer()
+
+	if err != nil {
+		t.Fatal("Error starting test server: ", err)
+	}
+
+	defer stop()
+
+	testConfig := testNode{ID: "ID-register", Parent: root.ID, Description: "registered node"}
+
+	err = client.SendNodeType(nc, testConfig, "test")
+	if err != nil {
+		t.Fatal("Error sending node: ", err)
+	}
+
+	bic := client.NewBuiltInClients(nc)
+
+	err = bic.Register(data.NodeTypeRule, nil)
+	if err == nil {
+		t.Fatal("Registering a built in node type again should fail")
+	}
+
+	started := make(chan testNode, 1)
+
+	go bic.Start()
+	defer bic.Stop(nil)
+
+	// clients registered after start are started right away
+	err = bic.Register("testNode", func(nc *nats.Conn, root string) client.ClientManager {
+		return client.NewManager(nc, root, func(nc *nats.Conn, config testNode) client.Client {
+			started <- config
+			return newTestNodeClient(nc, config)
+		})
+	})
+	if err != nil {
+		t.Fatal("Error registering client after start: ", err)
+	}
+
+	select {
+	case config := <-started:
+		if config.Description != testConfig.Description {
+			t.Fatal("Client started with wrong config: ", config)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Registered client was not started")
+	}
+
+	start := time.Now()
+	for {
+		nodes, err := client.GetNode(nc, root.ID, "")
+		if err != nil {
+			t.Fatal("Error getting root node: ", err)
+		}
+
+		_, ok := nodes[0].Points.Find(data.PointTypeClientType, "testNode")
+		if ok {
+			break
+		}
+
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("Client type not published on root node")
+		}
+
+		time.Sleep(50 * time.Millisecond)
+	}
+}
@@ -0,0 +1,349 @@
+package client
+
+import (
+	"log"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// Calc computes points derived from the SourcePointType (defaults to value)
+// point with SourcePointKey of SourceNodeID, so simple math on a sensor does
+// not need a custom client. Each CalcOutput child computes one Operation each
+// time a source point is received and writes the result to its Value:
+//
+//   - delta: the change from the previous source value
+//   - rate: the rate of change in units per second over the last Window
+//     seconds, or between the last two source values if Window is 0
+//   - average: the average of the source values in the last Window seconds,
+//     or of all values since the client started if Window is 0
+//   - min, max: the minimum or maximum over the same range as average
+type Calc struct {
+	ID              string       `node:"id"`
+	Parent          string       `node:"parent"`
+	Description     string       `point:"description"`
+	SourceNodeID    string       `point:"sourceNodeID"`
+	SourcePointType string       `point:"sourcePointType"`
+	SourcePointKey  string       `point:"sourcePointKey"`
+	Disable         bool         `point:"disable"`
+	Outputs         []CalcOutput `child:"calcOutput"`
+}
+
+// CalcOutput is a value computed from the source point of a Calc node.
+// Window is in seconds.
+type CalcOutput struct {
+	ID          string  `node:"id"`
+	Parent      string  `node:"parent"`
+	Description string  `point:"description"`
+	Operation   string  `point:"operation"`
+	Window      float64 `point:"window"`
+	Value       float64 `point:"value"`
+}
+
+// calcSample is a source value
+type calcSample struct {
+	time  time.Time
+	value float64
+}
+
+// calcRunning holds statistics of all source values since the client
+// started
+type calcRunning struct {
+	count    int
+	sum      float64
+	min, max float64
+}
+
+func (r *calcRunning) add(v float64) {
+	if r.count == 0 || v < r.min {
+		r.min = v
+	}
+	if r.count == 0 || v > r.max {
+		r.max = v
+	}
+	r.count++
+	r.sum += v
+}
+
+// calcOutput computes the value of an output from samples, which are sorted
+// by time. false is returned if there are not enough samples or the
+// operation is unknown.
+func calcOutput(o CalcOutput, samples []calcSample, running calcRunning) (float64, bool) {
+	n := len(samples)
+	if n <= 0 {
+		return 0, false
+	}
+
+	last := samples[n-1]
+	window := time.Duration(o.Window * float64(time.Second))
+
+	inWindow := samples
+	if window > 0 {
+		start := last.time.Add(-window)
+		i := sort.Search(n, func(i int) bool {
+			return !samples[i].time.Before(start)
+		})
+		inWindow = samples[i:]
+	}
+
+	switch o.Operation {
+	case data.PointValueDelta:
+		if n < 2 {
+			return 0, false
+		}
+		return last.value - samples[n-2].value, true
+
+	case data.PointValueRate:
+		first := inWindow[0]
+		if window <= 0 {
+			if n < 2 {
+				return 0, false
+			}
+			first = samples[n-2]
+		}
+
+		dt := last.time.Sub(first.time).Seconds()
+		if dt <= 0 {
+			return 0, false
+		}
+		return (last.value - first.value) / dt, true
+
+	case data.PointValueAverage, data.PointValueMin, data.PointValueMax:
+		r := running
+		if window > 0 {
+			r = calcRunning{}
+			for _, s := range inWindow {
+				r.add(s.value)
+			}
+		}
+
+		if r.count <= 0 {
+			return 0, false
+		}
+
+		switch o.Operation {
+		case data.PointValueMin:
+			return r.min, true
+		case data.PointValueMax:
+			return r.max, true
+		default:
+			return r.sum / float64(r.count), true
+		}
+	}
+
+	return 0, false
+}
+
+// CalcClient is a SIOT client that runs calc nodes
+type CalcClient struct {
+	nc            *nats.Conn
+	config        Calc
+	stop          chan struct{}
+	newPoints     chan NewPoints
+	newEdgePoints chan NewPoints
+	newSource     chan data.Point
+	sourceSub     *nats.Subscription
+	// node ID, type, and key of the current subscription
+	sourceKey string
+	samples   []calcSample
+	running   calcRunning
+}
+
+// NewCalcClient ...
+func NewCalcClient(nc *nats.Conn, config Calc) Client {
+	return &CalcClient{
+		nc:            nc,
+		config:        config,
+		stop:          make(chan struct{}),
+		newPoints:     make(chan NewPoints),
+		newEdgePoints: make(chan NewPoints),
+		newSource:     make(chan data.Point),
+	}
+}
+
+// Start runs the main logic for this client and blocks until stopped
+func (c *CalcClient) Start() error {
+	log.Println("Starting calc client: ", c.config.Description)
+
+	c.subscribeSource()
+
+done:
+	for {
+		select {
+		case <-c.stop:
+			log.Println("Stopping calc client: ", c.config.Description)
+			break done
+		case p := <-c.newSource:
+			c.update(p)
+		case pts := <-c.newPoints:
+			err := data.MergePoints(pts.ID, pts.Points, &c.config)
+			if err != nil {
+				log.Println("error merging new points: ", err)
+			}
+
+			if pts.ID != c.config.ID {
+				continue
+			}
+
+			for _, p := range pts.Points {
+				switch p.Type {
+				case data.PointTypeSourceNodeID, data.PointTypeSourcePointType,
+					data.PointTypeSourcePointKey:
+					c.subscribeSource()
+				}
+			}
+		case pts := <-c.newEdgePoints:
+			err := data.MergeEdgePoints(pts.ID, pts.Parent, pts.Points, &c.config)
+			if err != nil {
+				log.Println("error merging new points: ", err)
+			}
+		}
+	}
+
+	if c.sourceSub != nil {
+		c.sourceSub.Unsubscribe()
+	}
+
+	return nil
+}
+
+// maxWindow returns the longest window of the outputs
+func (c *CalcClient) maxWindow() time.Duration {
+	ret := 0.0
+	for _, o := range c.config.Outputs {
+		ret = math.Max(ret, o.Window)
+	}
+	return time.Duration(ret * float64(time.Second))
+}
+
+// update adds a source value and writes the outputs that changed
+func (c *CalcClient) update(p data.Point) {
+	if p.Time.IsZero() {
+		p.Time = time.Now()
+	}
+
+	if n := len(c.samples); n > 0 && !p.Time.After(c.samples[n-1].time) {
+		// old or duplicate point
+		return
+	}
+
+	c.samples = append(c.samples, calcSample{time: p.Time, value: p.Value})
+	c.running.add(p.Value)
+
+	// keep the samples in the longest window, and at least two for delta
+	// and rate
+	start := p.Time.Add(-c.maxWindow())
+	for len(c.samples) > 2 && c.samples[0].time.Before(start) {
+		c.samples = c.samples[1:]
+	}
+
+	if c.config.Disable {
+		return
+	}
+
+	now := time.Now()
+
+	for i := range c.config.Outputs {
+		o := &c.config.Outputs[i]
+		v, ok := calcOutput(*o, c.samples, c.running)
+		if !ok || v == o.Value {
+			continue
+		}
+
+		o.Value = v
+		err := SendNodePoint(c.nc, o.ID, data.Point{Time: now,
+			Type: data.PointTypeValue, Value: v}, false)
+		if err != nil {
+			log.Printf("Calc %v: error sending output %v: %v\n",
+				c.config.Description, o.Description, err)
+		}
+	}
+}
+
+// subscribeSource subscribes to the source point and gets its current value
+func (c *CalcClient) subscribeSource() {
+	pointType := c.config.SourcePointType
+	if pointType == "" {
+		pointType = data.PointTypeValue
+	}
+	pointKey := c.config.SourcePointKey
+
+	key := c.config.SourceNodeID + "." + pointType + "." + pointKey
+	if c.sourceSub != nil && key == c.sourceKey {
+		return
+	}
+
+	if c.sourceSub != nil {
+		c.sourceSub.Unsubscribe()
+		c.sourceSub = nil
+	}
+
+	c.sourceKey = key
+	c.samples = nil
+	c.running = calcRunning{}
+
+	if c.config.SourceNodeID == "" {
+		return
+	}
+
+	match := func(p data.Point) bool {
+		return p.Type == pointType && (p.Key == pointKey ||
+			(pointKey == "" && p.Key == "0") || (pointKey == "0" && p.Key == ""))
+	}
+
+	var err error
+	c.sourceSub, err = c.nc.Subscribe(SubjectNodePoints(c.config.SourceNodeID), func(msg *nats.Msg) {
+		points, err := DecodePoints(msg)
+		if err != nil {
+			log.Println("Calc: error decoding source points: ", err)
+			return
+		}
+
+		for _, p := range points {
+			if !match(p) {
+				continue
+			}
+
+			select {
+			case c.newSource <- p:
+			case <-c.stop:
+			}
+		}
+	})
+	if err != nil {
+		log.Printf("Calc %v: error subscribing to source: %v\n",
+			c.config.Description, err)
+	}
+
+	nodes, err := GetNode(c.nc, c.config.SourceNodeID, "none")
+	if err != nil || len(nodes) < 1 {
+		log.Printf("Calc %v: error getting source: %v\n", c.config.Description, err)
+		return
+	}
+
+	for _, p := range nodes[0].Points {
+		if match(p) && p.Tombstone%2 == 0 {
+			c.update(p)
+		}
+	}
+}
+
+// Stop sends a signal to the Start function to exit
+func (c *CalcClient) Stop(err error) {
+	close(c.stop)
+}
+
+// Points is called by the Manager when new points for this
+// node are received.
+func (c *CalcClient) Points(nodeID string, points []data.Point) {
+	c.newPoints <- NewPoints{nodeID, "", points}
+}
+
+// EdgePoints is called by the Manager when new edge points for this
+// node are received.
+func (c *CalcClient) EdgePoints(nodeID, parentID string, points []data.Point) {
+	c.newEdgePoints <- NewPoints{nodeID, parentID, points}
+}
@@ -0,0 +1,67 @@
+package client_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+	"github.com/simpleiot/simpleiot/server"
+)
+
+func TestCalc(t *testing.T) {
+	nc, root, stop, err := server.TestServer()
+	if err != nil {
+		t.Fatal("Error starting test server: ", err)
+	}
+	defer stop()
+
+	err = client.SendNodeType(nc, client.Variable{ID: "src", Parent: root.ID, Value: 10}, "test")
+	if err != nil {
+		t.Fatal("Error sending variable node: ", err)
+	}
+
+	err = client.SendNodeType(nc, client.Calc{
+		ID:           "calc",
+		Parent:       root.ID,
+		Description:  "flow math",
+		SourceNodeID: "src",
+	}, "test")
+	if err != nil {
+		t.Fatal("Error sending calc node: ", err)
+	}
+
+	for _, o := range []client.CalcOutput{
+		{ID: "delta", Operation: data.PointValueDelta},
+		{ID: "rate", Operation: data.PointValueRate},
+		{ID: "avg", Operation: data.PointValueAverage},
+		{ID: "min", Operation: data.PointValueMin, Window: 60},
+		{ID: "max", Operation: data.PointValueMax},
+	} {
+		o.Parent = "calc"
+		err = client.SendNodeType(nc, o, "test")
+		if err != nil {
+			t.Fatal("Error sending calc output node: ", err)
+		}
+	}
+
+	// wait for the client to restart with the outputs
+	time.Sleep(500 * time.Millisecond)
+
+	now := time.Now()
+	for i, v := range []float64{14, 12} {
+		err := client.SendNodePoint(nc, "src", data.Point{
+			Time: now.Add(time.Duration(i) * time.Second), Type: data.PointTypeValue,
+			Value: v}, true)
+		if err != nil {
+			t.Fatal("Error sending source point: ", err)
+		}
+	}
+
+	// the initial value of 10 is included
+	waitPointValue(t, nc, "delta", data.PointTypeValue, -2)
+	waitPointValue(t, nc, "rate", data.PointTypeValue, -2)
+	waitPointValue(t, nc, "avg", data.PointTypeValue, 12)
+	waitPointValue(t, nc, "min", data.PointTypeValue, 10)
+	waitPointValue(t, nc, "max", data.PointTypeValue, 14)
+}
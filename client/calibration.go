@@ -0,0 +1,103 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// SetCalibration sets the calibration for a point type in a node. Every
+// calibration change is also recorded as an annotation on the point type,
+// which provides an audit trail.
+func SetCalibration(nc *nats.Conn, nodeID string, c data.Calibration) error {
+	if c.PointType == "" {
+		return errors.New("calibration point type must be set")
+	}
+
+	if c.AppliedAt.IsZero() {
+		c.AppliedAt = time.Now()
+	}
+
+	err := SendNodePoints(nc, nodeID, c.ToPoints(), true)
+	if err != nil {
+		return fmt.Errorf("Error sending calibration: %w", err)
+	}
+
+	return auditCalibration(nc, nodeID, c.PointType, c.AppliedBy, c.AppliedAt,
+		fmt.Sprintf("calibration set: offset %v, gain %v", c.Offset, c.Gain))
+}
+
+// GetCalibrations returns the calibrations for a node sorted by point type
+func GetCalibrations(nc *nats.Conn, nodeID string) ([]data.Calibration, error) {
+	nodes, err := GetNode(nc, nodeID, "none")
+	if err != nil {
+		return nil, err
+	}
+
+	if len(nodes) < 1 {
+		return nil, data.ErrDocumentNotFound
+	}
+
+	ret := []data.Calibration{}
+	for _, c := range nodes[0].Points.Calibrations() {
+		ret = append(ret, c)
+	}
+
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].PointType < ret[j].PointType
+	})
+
+	return ret, nil
+}
+
+// DeleteCalibration removes the calibration for a point type in a node
+func DeleteCalibration(nc *nats.Conn, nodeID, pointType, origin string) error {
+	nodes, err := GetNode(nc, nodeID, "none")
+	if err != nil {
+		return err
+	}
+
+	if len(nodes) < 1 {
+		return data.ErrDocumentNotFound
+	}
+
+	var pts data.Points
+	for _, p := range nodes[0].Points {
+		if (p.Type == data.PointTypeCalibrationOffset ||
+			p.Type == data.PointTypeCalibrationGain) && p.Key == pointType {
+			p.Tombstone = 1
+			pts = append(pts, p)
+		}
+	}
+
+	if len(pts) == 0 {
+		return errors.New("calibration not found")
+	}
+
+	err = SendNodePoints(nc, nodeID, pts, true)
+	if err != nil {
+		return fmt.Errorf("Error deleting calibration: %w", err)
+	}
+
+	return auditCalibration(nc, nodeID, pointType, origin, time.Now(),
+		"calibration removed")
+}
+
+func auditCalibration(nc *nats.Conn, nodeID, pointType, user string, t time.Time, text string) error {
+	_, err := AddAnnotation(nc, nodeID, data.Annotation{
+		PointType: pointType,
+		Text:      text,
+		User:      user,
+		Start:     t,
+	})
+
+	if err != nil {
+		return fmt.Errorf("Error recording calibration audit: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,119 @@
+package client_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+	"github.com/simpleiot/simpleiot/server"
+)
+
+func TestCalibration(t *testing.T) {
+	nc, root, stop, err := server.TestServer()
+
+	if err != nil {
+		t.Fatal("Error starting test server: ", err)
+	}
+
+	defer stop()
+
+	n := data.NodeEdge{
+		ID:     "ID-sensor",
+		Type:   data.NodeTypeDevice,
+		Parent: root.ID,
+		Points: data.Points{{Type: data.PointTypeDescription, Text: "sensor"}},
+	}
+
+	err = client.SendNode(nc, n, "test")
+	if err != nil {
+		t.Fatal("Error sending node: ", err)
+	}
+
+	err = client.SetCalibration(nc, n.ID, data.Calibration{
+		PointType: data.PointTypeValue,
+		Offset:    1,
+		Gain:      2,
+		AppliedBy: "joe",
+	})
+	if err != nil {
+		t.Fatal("Error setting calibration: ", err)
+	}
+
+	upValues := make(chan float64, 10)
+
+	sub, err := nc.Subscribe(fmt.Sprintf("up.%v.%v.points", root.ID, n.ID), func(msg *nats.Msg) {
+		pts, err := data.PbDecodePoints(msg.Data)
+		if err != nil {
+			t.Error("Error decoding points: ", err)
+			return
+		}
+		for _, p := range pts {
+			if p.Type == data.PointTypeValue {
+				upValues <- p.Value
+			}
+		}
+	})
+	if err != nil {
+		t.Fatal("Error subscribing: ", err)
+	}
+	defer sub.Unsubscribe()
+
+	err = client.SendNodePoint(nc, n.ID, data.Point{Type: data.PointTypeValue, Value: 10}, true)
+	if err != nil {
+		t.Fatal("Error sending point: ", err)
+	}
+
+	select {
+	case v := <-upValues:
+		if v != 21 {
+			t.Error("expected calibrated value of 21, got: ", v)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for upstream point")
+	}
+
+	nodes, err := client.GetNode(nc, n.ID, "")
+	if err != nil || len(nodes) < 1 {
+		t.Fatal("Error getting node: ", err)
+	}
+
+	if v, _ := nodes[0].Points.Value(data.PointTypeValue, ""); v != 10 {
+		t.Error("expected raw value of 10 in node, got: ", v)
+	}
+
+	cals, err := client.GetCalibrations(nc, n.ID)
+	if err != nil {
+		t.Fatal("Error getting calibrations: ", err)
+	}
+
+	if len(cals) != 1 || cals[0].AppliedBy != "joe" {
+		t.Fatalf("calibrations not correct: %+v", cals)
+	}
+
+	// calibration change is recorded as an annotation
+	annotations, err := client.GetAnnotations(nc, n.ID)
+	if err != nil {
+		t.Fatal("Error getting annotations: ", err)
+	}
+
+	if len(annotations) != 1 || annotations[0].PointType != data.PointTypeValue {
+		t.Fatalf("expected calibration audit annotation, got: %+v", annotations)
+	}
+
+	err = client.DeleteCalibration(nc, n.ID, data.PointTypeValue, "joe")
+	if err != nil {
+		t.Fatal("Error deleting calibration: ", err)
+	}
+
+	cals, err = client.GetCalibrations(nc, n.ID)
+	if err != nil {
+		t.Fatal("Error getting calibrations: ", err)
+	}
+
+	if len(cals) != 0 {
+		t.Fatal("calibration was not deleted")
+	}
+}
@@ -0,0 +1,395 @@
+package client
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/canbus"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// CanBus decodes the frames received on the SocketCAN interface Device (for
+// example can0) with the messages of the DBC file at DbcFile. The signals of
+// each message are sent as value points keyed by the signal name to a
+// message child node, which is created when the message is first received.
+// If J1939 is set, extended frames are J1939 parameter groups, which are
+// reassembled from transport protocol frames and decoded with the DBC
+// message of their PGN.
+type CanBus struct {
+	ID          string       `node:"id"`
+	Parent      string       `node:"parent"`
+	Description string       `point:"description"`
+	Device      string       `point:"device"`
+	DbcFile     string       `point:"dbcFile"`
+	J1939       bool         `point:"j1939"`
+	Disable     bool         `point:"disable"`
+	ErrorCount  int          `point:"errorCount"`
+	Messages    []CanMessage `child:"canMessage"`
+}
+
+// CanMessage receives the signals of the DBC message with CanID. Extended
+// is set for messages with 29 bit identifiers.
+type CanMessage struct {
+	ID          string `node:"id"`
+	Parent      string `node:"parent"`
+	Description string `point:"description"`
+	CanID       int    `point:"canID"`
+	Extended    bool   `point:"extended"`
+}
+
+// how long to wait before reopening the interface
+var canBusRetryPeriod = 10 * time.Second
+
+// canConn is a CAN interface, see openCanBus
+type canConn interface {
+	// read blocks until a data frame is received. Remote and error
+	// frames are skipped.
+	read() (canbus.Frame, error)
+	// close unblocks read
+	close() error
+}
+
+// canMessageKey identifies a DBC message
+type canMessageKey struct {
+	id       uint32
+	extended bool
+}
+
+// CanBusClient is a SIOT client that decodes CAN frames into points
+type CanBusClient struct {
+	nc            *nats.Conn
+	config        CanBus
+	stop          chan struct{}
+	newPoints     chan NewPoints
+	newEdgePoints chan NewPoints
+	conn          canConn
+	// frames and errors of the reader of conn, nil if it is closed
+	frames     chan canbus.Frame
+	readErrors chan error
+	// closed when conn is closed, stops the reader
+	readerDone chan struct{}
+	db         *canbus.Database
+	// reassembles J1939 transport protocol messages, nil if J1939 is
+	// not enabled
+	j1939 *canbus.J1939
+	// IDs of the message nodes
+	messages map[canMessageKey]string
+	// last point sent for each signal by node ID and signal name
+	values map[string]map[string]data.Point
+	// messages that failed to decode, which are only reported once
+	decodeErrors map[canMessageKey]bool
+}
+
+// NewCanBusClient ...
+func NewCanBusClient(nc *nats.Conn, config CanBus) Client {
+	return &CanBusClient{
+		nc:            nc,
+		config:        config,
+		stop:          make(chan struct{}),
+		newPoints:     make(chan NewPoints),
+		newEdgePoints: make(chan NewPoints),
+	}
+}
+
+// Start runs the main logic for this client and blocks until stopped
+func (c *CanBusClient) Start() error {
+	log.Println("Starting CAN bus client: ", c.config.Description)
+
+	retry := time.NewTimer(0)
+	defer retry.Stop()
+
+	reconnect := func() {
+		c.disconnect()
+		retry.Reset(0)
+	}
+
+done:
+	for {
+		select {
+		case <-c.stop:
+			log.Println("Stopping CAN bus client: ", c.config.Description)
+			break done
+		case <-retry.C:
+			c.disconnect()
+
+			if c.config.Disable {
+				break
+			}
+
+			err := c.connect()
+			if err != nil {
+				log.Printf("CAN bus %v: error opening %v: %v\n",
+					c.config.Description, c.config.Device, err)
+				c.error()
+				c.disconnect()
+				retry.Reset(canBusRetryPeriod)
+			}
+		case f := <-c.frames:
+			c.frame(f)
+		case err := <-c.readErrors:
+			log.Printf("CAN bus %v: error reading: %v\n", c.config.Description, err)
+			c.error()
+			c.disconnect()
+			retry.Reset(canBusRetryPeriod)
+		case pts := <-c.newPoints:
+			err := data.MergePoints(pts.ID, pts.Points, &c.config)
+			if err != nil {
+				log.Println("error merging new points: ", err)
+			}
+
+			for _, p := range pts.Points {
+				switch p.Type {
+				case data.PointTypeDevice, data.PointTypeDbcFile,
+					data.PointTypeJ1939, data.PointTypeDisable:
+					reconnect()
+				}
+			}
+		case pts := <-c.newEdgePoints:
+			err := data.MergeEdgePoints(pts.ID, pts.Parent, pts.Points, &c.config)
+			if err != nil {
+				log.Println("error merging new points: ", err)
+			}
+		}
+	}
+
+	c.disconnect()
+
+	return nil
+}
+
+// connect loads the DBC file and opens the interface
+func (c *CanBusClient) connect() error {
+	var err error
+	c.db, err = canbus.LoadDBC(c.config.DbcFile)
+	if err != nil {
+		return fmt.Errorf("error loading DBC file: %w", err)
+	}
+
+	c.messages = make(map[canMessageKey]string)
+	c.values = make(map[string]map[string]data.Point)
+	c.decodeErrors = make(map[canMessageKey]bool)
+
+	c.j1939 = nil
+	if c.config.J1939 {
+		c.j1939 = canbus.NewJ1939()
+	}
+
+	for _, m := range c.config.Messages {
+		c.messages[canMessageKey{uint32(m.CanID), m.Extended}] = m.ID
+	}
+
+	c.conn, err = openCanBus(c.config.Device)
+	if err != nil {
+		return err
+	}
+
+	c.frames = make(chan canbus.Frame, 100)
+	c.readErrors = make(chan error, 1)
+	c.readerDone = make(chan struct{})
+	go canRead(c.conn, c.frames, c.readErrors, c.readerDone)
+
+	return nil
+}
+
+// canRead sends the frames received on conn to frames until done is closed
+// or a read fails
+func canRead(conn canConn, frames chan<- canbus.Frame, errs chan<- error, done <-chan struct{}) {
+	for {
+		f, err := conn.read()
+		if err != nil {
+			errs <- err
+			return
+		}
+
+		select {
+		case frames <- f:
+		case <-done:
+			return
+		}
+	}
+}
+
+func (c *CanBusClient) disconnect() {
+	if c.conn != nil {
+		close(c.readerDone)
+		c.conn.close()
+	}
+
+	c.conn = nil
+	c.frames = nil
+	c.readErrors = nil
+}
+
+func (c *CanBusClient) error() {
+	c.config.ErrorCount++
+	err := SendNodePoint(c.nc, c.config.ID, data.Point{
+		Time:  time.Now(),
+		Type:  data.PointTypeErrorCount,
+		Value: float64(c.config.ErrorCount),
+	}, false)
+	if err != nil {
+		log.Println("CAN bus: error sending error count: ", err)
+	}
+}
+
+// frame decodes a frame and sends the signals that changed to the node of
+// its message. Frames that are not in the DBC file are ignored, and decode
+// errors are reported once for each message, as frames are usually sent
+// periodically.
+func (c *CanBusClient) frame(f canbus.Frame) {
+	m, values, err := canDecode(c.db, c.j1939, f)
+	if err != nil {
+		key := canMessageKey{f.ID, f.Extended}
+		if !c.decodeErrors[key] {
+			c.decodeErrors[key] = true
+			log.Printf("CAN bus %v: error decoding frame %x: %v\n",
+				c.config.Description, f.ID, err)
+			c.error()
+		}
+		return
+	}
+
+	if m == nil {
+		return
+	}
+
+	c.send(m, values, time.Now())
+}
+
+// canDecode decodes a frame with db. If j1939 is not nil, extended frames
+// are passed to it and the parameter groups it returns are decoded by PGN.
+// The message is nil if the frame is not in db or a J1939 message is not
+// complete.
+func canDecode(db *canbus.Database, j1939 *canbus.J1939, f canbus.Frame) (*canbus.Message, []canbus.SignalValue, error) {
+	if j1939 == nil || !f.Extended {
+		return db.Decode(f)
+	}
+
+	msg, ok := j1939.Receive(f)
+	if !ok {
+		return nil, nil, nil
+	}
+
+	return db.DecodeJ1939(msg)
+}
+
+// send sends the signal values of a message that changed. The node of the
+// message is created if it does not exist.
+func (c *CanBusClient) send(m *canbus.Message, values []canbus.SignalValue, now time.Time) {
+	key := canMessageKey{m.ID, m.Extended}
+
+	nodeID, ok := c.messages[key]
+	if !ok {
+		nodeID = uuid.New().String()
+
+		// the node is sent without an origin, so the client is not
+		// restarted for each new message
+		err := SendNode(c.nc, canMessageNode(nodeID, c.config.ID, m), "")
+		if err != nil {
+			log.Println("CAN bus: error creating message node: ", err)
+			return
+		}
+
+		c.messages[key] = nodeID
+	}
+
+	last := c.values[nodeID]
+	if last == nil {
+		last = make(map[string]data.Point)
+		c.values[nodeID] = last
+	}
+
+	var pts data.Points
+
+	for _, p := range canSignalPoints(values, now) {
+		if l, ok := last[p.Key]; ok && l.Value == p.Value && l.Text == p.Text {
+			continue
+		}
+
+		last[p.Key] = p
+		pts = append(pts, p)
+	}
+
+	if len(pts) <= 0 {
+		return
+	}
+
+	err := SendNodePoints(c.nc, nodeID, pts, false)
+	if err != nil {
+		log.Println("CAN bus: error sending signals: ", err)
+	}
+}
+
+// Stop sends a signal to the Start function to exit
+func (c *CanBusClient) Stop(err error) {
+	close(c.stop)
+}
+
+// Points is called by the Manager when new points for this
+// node are received.
+func (c *CanBusClient) Points(nodeID string, points []data.Point) {
+	c.newPoints <- NewPoints{nodeID, "", points}
+}
+
+// EdgePoints is called by the Manager when new edge points for this
+// node are received.
+func (c *CanBusClient) EdgePoints(nodeID, parentID string, points []data.Point) {
+	c.newEdgePoints <- NewPoints{nodeID, parentID, points}
+}
+
+// canMessageNode returns the node of a message. The units and J1939 SPNs of
+// the signals are units and spn points keyed by the signal name.
+func canMessageNode(id, parent string, m *canbus.Message) data.NodeEdge {
+	now := time.Now()
+
+	extended := 0.0
+	if m.Extended {
+		extended = 1
+	}
+
+	pts := data.Points{
+		{Time: now, Type: data.PointTypeDescription, Text: m.Name},
+		{Time: now, Type: data.PointTypeCanID, Value: float64(m.ID)},
+		{Time: now, Type: data.PointTypeExtended, Value: extended},
+	}
+
+	for _, s := range m.Signals {
+		if s.Unit != "" {
+			pts = append(pts, data.Point{Time: now, Type: data.PointTypeUnits,
+				Key: s.Name, Text: s.Unit})
+		}
+
+		if s.SPN != 0 {
+			pts = append(pts, data.Point{Time: now, Type: data.PointTypeSpn,
+				Key: s.Name, Value: float64(s.SPN)})
+		}
+	}
+
+	return data.NodeEdge{
+		ID:     id,
+		Type:   data.NodeTypeCanMessage,
+		Parent: parent,
+		Points: pts,
+	}
+}
+
+// canSignalPoints converts signal values to value points keyed by the
+// signal name. The description of the raw value, if any, is the text.
+func canSignalPoints(values []canbus.SignalValue, now time.Time) data.Points {
+	ret := make(data.Points, len(values))
+
+	for i, v := range values {
+		ret[i] = data.Point{
+			Time:  now,
+			Type:  data.PointTypeValue,
+			Key:   v.Signal.Name,
+			Value: v.Value,
+			Text:  v.Text,
+		}
+	}
+
+	return ret
+}
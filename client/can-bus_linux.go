@@ -0,0 +1,85 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"unsafe"
+
+	"github.com/simpleiot/simpleiot/canbus"
+	"golang.org/x/sys/unix"
+)
+
+// size of struct can_frame
+const canFrameSize = 16
+
+type socketCan struct {
+	f *os.File
+}
+
+// openCanBus opens a raw SocketCAN socket on the interface. The socket is
+// non-blocking, so close unblocks read.
+func openCanBus(device string) (canConn, error) {
+	if device == "" {
+		return nil, errors.New("CAN device is not set")
+	}
+
+	iface, err := net.InterfaceByName(device)
+	if err != nil {
+		return nil, err
+	}
+
+	fd, err := unix.Socket(unix.AF_CAN, unix.SOCK_RAW|unix.SOCK_NONBLOCK|unix.SOCK_CLOEXEC,
+		unix.CAN_RAW)
+	if err != nil {
+		return nil, fmt.Errorf("Error opening CAN socket: %w", err)
+	}
+
+	err = unix.Bind(fd, &unix.SockaddrCAN{Ifindex: iface.Index})
+	if err != nil {
+		unix.Close(fd)
+		return nil, fmt.Errorf("Error binding CAN socket: %w", err)
+	}
+
+	return &socketCan{f: os.NewFile(uintptr(fd), device)}, nil
+}
+
+func (s *socketCan) read() (canbus.Frame, error) {
+	var buf [canFrameSize]byte
+
+	for {
+		n, err := s.f.Read(buf[:])
+		if err != nil {
+			return canbus.Frame{}, err
+		}
+
+		if n != canFrameSize {
+			return canbus.Frame{}, fmt.Errorf("short CAN frame: %v bytes", n)
+		}
+
+		// can_id is in host byte order
+		id := *(*uint32)(unsafe.Pointer(&buf[0]))
+		if id&(unix.CAN_RTR_FLAG|unix.CAN_ERR_FLAG) != 0 {
+			continue
+		}
+
+		f := canbus.Frame{ID: id & unix.CAN_SFF_MASK}
+		if id&unix.CAN_EFF_FLAG != 0 {
+			f.ID = id & unix.CAN_EFF_MASK
+			f.Extended = true
+		}
+
+		l := int(buf[4])
+		if l > 8 {
+			l = 8
+		}
+		f.Data = append([]byte(nil), buf[8:8+l]...)
+
+		return f, nil
+	}
+}
+
+func (s *socketCan) close() error {
+	return s.f.Close()
+}
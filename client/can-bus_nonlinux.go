@@ -0,0 +1,10 @@
+//go:build !linux
+
+package client
+
+import "errors"
+
+// openCanBus is only supported on Linux, which has SocketCAN
+func openCanBus(_ string) (canConn, error) {
+	return nil, errors.New("CAN bus is only supported on Linux")
+}
@@ -0,0 +1,157 @@
+package client
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/simpleiot/simpleiot/canbus"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+var testCanDBC = `VERSION ""
+
+BU_: ECU1 ECU2
+
+BO_ 100 Engine: 8 ECU1
+ SG_ Speed : 0|16@1+ (0.125,0) [0|8031.875] "rpm" ECU2
+ SG_ Gear : 16|4@1+ (1,0) [0|15] "" ECU2
+
+VAL_ 100 Gear 0 "Neutral" 1 "First" ;
+`
+
+type testCanConn struct {
+	frames []canbus.Frame
+}
+
+func (c *testCanConn) read() (canbus.Frame, error) {
+	if len(c.frames) <= 0 {
+		return canbus.Frame{}, errors.New("closed")
+	}
+
+	f := c.frames[0]
+	c.frames = c.frames[1:]
+	return f, nil
+}
+
+func (c *testCanConn) close() error {
+	return nil
+}
+
+func TestCanRead(t *testing.T) {
+	conn := &testCanConn{frames: []canbus.Frame{{ID: 1}, {ID: 2}}}
+	frames := make(chan canbus.Frame, 10)
+	errs := make(chan error, 1)
+
+	canRead(conn, frames, errs, make(chan struct{}))
+
+	if len(frames) != 2 || (<-frames).ID != 1 || (<-frames).ID != 2 {
+		t.Error("frames not received")
+	}
+
+	if len(errs) != 1 {
+		t.Error("read error not reported")
+	}
+}
+
+func TestCanMessagePoints(t *testing.T) {
+	db, err := canbus.ParseDBC(strings.NewReader(testCanDBC))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, values, err := db.Decode(canbus.Frame{ID: 100,
+		Data: []byte{0x40, 0x1f, 0x01, 0, 0, 0, 0, 0}})
+	if err != nil || m == nil {
+		t.Fatal("decode: ", m, err)
+	}
+
+	node := canMessageNode("msg", "bus", m)
+	if node.Type != data.NodeTypeCanMessage || node.Parent != "bus" {
+		t.Errorf("wrong node: %+v", node)
+	}
+
+	desc := node.Points.MapText(data.PointTypeDescription)[""]
+	id := node.Points.Map(data.PointTypeCanID)[""]
+	units := node.Points.MapText(data.PointTypeUnits)["Speed"]
+	if desc != "Engine" || id != 100 || units != "rpm" {
+		t.Errorf("wrong node points: %v", node.Points)
+	}
+
+	now := time.Now()
+	pts := canSignalPoints(values, now)
+
+	speed := pts.Map(data.PointTypeValue)["Speed"]
+	gear := pts.MapText(data.PointTypeValue)["Gear"]
+	if speed != 1000 || gear != "First" {
+		t.Errorf("wrong signal points: %v", pts)
+	}
+}
+
+var testJ1939DBC = `VERSION ""
+
+BO_ 2364540158 EEC1: 8 Vector__XXX
+ SG_ EngSpeed : 24|16@1+ (0.125,0) [0|8031.875] "rpm" Vector__XXX
+
+BO_ 2566841088 EC1: 40 Vector__XXX
+ SG_ EngSpeedAtIdlePoint1 : 0|16@1+ (0.125,0) [0|8031.875] "rpm" Vector__XXX
+
+BA_DEF_ SG_ "SPN" INT 0 524287;
+BA_ "SPN" SG_ 2364540158 EngSpeed 190;
+`
+
+func TestCanDecodeJ1939(t *testing.T) {
+	db, err := canbus.ParseDBC(strings.NewReader(testJ1939DBC))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	frame := func(pgn uint32, d ...byte) canbus.Frame {
+		return canbus.Frame{ID: canbus.J1939ID{Priority: 7, PGN: pgn,
+			Destination: 0xff}.CANID(), Extended: true, Data: d}
+	}
+
+	// EEC1 from source 0 only matches the DBC message by PGN
+	eec1 := frame(0xf004, 0xff, 0, 0, 0x40, 0x1f, 0, 0, 0xff)
+
+	m, _, err := canDecode(db, nil, eec1)
+	if err != nil || m != nil {
+		t.Error("EEC1 should not match without J1939: ", m, err)
+	}
+
+	j := canbus.NewJ1939()
+
+	m, values, err := canDecode(db, j, eec1)
+	if err != nil || m == nil || m.Name != "EEC1" || len(values) != 1 ||
+		values[0].Value != 1000 {
+		t.Fatal("EEC1 not decoded: ", m, values, err)
+	}
+
+	spn := canMessageNode("msg", "bus", m).Points.Map(data.PointTypeSpn)
+	if spn["EngSpeed"] != 190 {
+		t.Error("SPN point not set: ", spn)
+	}
+
+	// EC1 is sent with the transport protocol in 2 packets
+	frames := []canbus.Frame{
+		frame(canbus.PGNTPCM, 32, 14, 0, 2, 0xff, 0xe3, 0xfe, 0),
+		frame(canbus.PGNTPDT, 1, 0x40, 0x06, 0xff, 0xff, 0xff, 0xff, 0xff),
+		frame(canbus.PGNTPDT, 2, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff),
+	}
+
+	for i, f := range frames {
+		m, values, err = canDecode(db, j, f)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if i < len(frames)-1 && m != nil {
+			t.Error("message decoded before the last packet")
+		}
+	}
+
+	if m == nil || m.Name != "EC1" || len(values) != 1 || values[0].Value != 200 {
+		t.Error("EC1 not decoded: ", m, values)
+	}
+}
@@ -0,0 +1,333 @@
+package client
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"regexp"
+	"runtime/pprof"
+	"strconv"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// clientLabel is the pprof label set to the client node ID on the goroutines
+// of managed clients. Goroutines started by a client inherit the label, so
+// goroutine counts and CPU time can be attributed to the client.
+const clientLabel = "siot.client"
+
+// how often client resource usage is sampled, and how long the CPU profile
+// of each sample runs
+var (
+	clientResourcePeriod = time.Minute
+	clientCPUSample      = 5 * time.Second
+)
+
+// clientUsage is the resource usage of a client node
+type clientUsage struct {
+	goroutines int
+	// percent of one CPU used during the last CPU sample
+	cpu float64
+	// false if no CPU profile was taken
+	cpuSampled bool
+}
+
+// resourceSampler samples the goroutines and CPU time of clients while any
+// Manager is running. Go can only run one CPU profile at a time, so a single
+// sampler is shared by all managers.
+type resourceSampler struct {
+	lock       sync.Mutex
+	users      int
+	stop       chan struct{}
+	usage      map[string]clientUsage
+	cpuProfile bool
+}
+
+var clientResources resourceSampler
+
+// SetClientCPUProfile enables the CPU usage metric of clients. A CPU profile
+// is then taken for 5 seconds each minute while managers are running, and
+// other CPU profiles of the process (pprof.StartCPUProfile, go test
+// -cpuprofile, etc.) fail while it runs. It is disabled by default.
+func SetClientCPUProfile(enable bool) {
+	clientResources.lock.Lock()
+	defer clientResources.lock.Unlock()
+	clientResources.cpuProfile = enable
+}
+
+// start starts sampling if this is the first user
+func (s *resourceSampler) start() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.users++
+	if s.users == 1 {
+		s.stop = make(chan struct{})
+		go s.run(s.stop)
+	}
+}
+
+// release stops sampling when the last user is done
+func (s *resourceSampler) release() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.users--
+	if s.users == 0 {
+		close(s.stop)
+		s.usage = nil
+	}
+}
+
+// get returns the last sampled usage of a client node
+func (s *resourceSampler) get(id string) (clientUsage, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	u, ok := s.usage[id]
+	return u, ok
+}
+
+func (s *resourceSampler) run(stop chan struct{}) {
+	ticker := time.NewTicker(clientResourcePeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+
+		usage := make(map[string]clientUsage)
+
+		goroutines, err := goroutinesByLabel(clientLabel)
+		if err == nil {
+			for id, n := range goroutines {
+				usage[id] = clientUsage{goroutines: n}
+			}
+		}
+
+		s.lock.Lock()
+		cpuProfile := s.cpuProfile
+		s.lock.Unlock()
+
+		var buf bytes.Buffer
+		// fails if something else is profiling, CPU is then not reported
+		if cpuProfile && pprof.StartCPUProfile(&buf) == nil {
+			select {
+			case <-time.After(clientCPUSample):
+			case <-stop:
+			}
+			pprof.StopCPUProfile()
+
+			cpu, err := cpuByLabel(buf.Bytes(), clientLabel)
+			if err == nil {
+				for id, u := range usage {
+					u.cpu = 100 * float64(cpu[id]) / float64(clientCPUSample)
+					u.cpuSampled = true
+					usage[id] = u
+				}
+			}
+		}
+
+		s.lock.Lock()
+		if s.stop == stop {
+			s.usage = usage
+		}
+		s.lock.Unlock()
+	}
+}
+
+var reGoroutineCount = regexp.MustCompile(`^(\d+) @`)
+
+// goroutinesByLabel returns the number of goroutines by the value of the
+// label key
+func goroutinesByLabel(key string) (map[string]int, error) {
+	var buf bytes.Buffer
+	err := pprof.Lookup("goroutine").WriteTo(&buf, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	reLabel := regexp.MustCompile(`^# labels: \{.*` +
+		regexp.QuoteMeta(strconv.Quote(key)) + `:("(?:[^"\\]|\\.)*")`)
+
+	ret := make(map[string]int)
+	count := 0
+
+	for _, line := range bytes.Split(buf.Bytes(), []byte("\n")) {
+		if m := reGoroutineCount.FindSubmatch(line); m != nil {
+			count, _ = strconv.Atoi(string(m[1]))
+			continue
+		}
+
+		if m := reLabel.FindSubmatch(line); m != nil {
+			value, err := strconv.Unquote(string(m[1]))
+			if err == nil {
+				ret[value] += count
+			}
+		}
+	}
+
+	return ret, nil
+}
+
+// cpuByLabel returns the CPU time of the samples in a gzipped CPU profile
+// (profile.proto) by the value of the label key
+func cpuByLabel(profile []byte, key string) (map[string]time.Duration, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(profile))
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, err
+	}
+
+	var strs []string
+	var samples [][]byte
+
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		switch {
+		case num == 2 && typ == protowire.BytesType:
+			v, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			samples = append(samples, v)
+			b = b[n:]
+		case num == 6 && typ == protowire.BytesType:
+			v, n := protowire.ConsumeString(b)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			strs = append(strs, v)
+			b = b[n:]
+		default:
+			n := protowire.ConsumeFieldValue(num, typ, b)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			b = b[n:]
+		}
+	}
+
+	str := func(i uint64) string {
+		if i >= uint64(len(strs)) {
+			return ""
+		}
+		return strs[i]
+	}
+
+	ret := make(map[string]time.Duration)
+
+	for _, s := range samples {
+		values, labels, err := parseProfileSample(s)
+		if err != nil {
+			return nil, err
+		}
+
+		// CPU profiles have sample count and CPU nanosecond values
+		if len(values) < 2 {
+			return nil, errors.New("not a CPU profile")
+		}
+
+		for _, l := range labels {
+			if str(l[0]) == key {
+				ret[str(l[1])] += time.Duration(values[1])
+			}
+		}
+	}
+
+	return ret, nil
+}
+
+// parseProfileSample returns the values and the key and string value indexes
+// of the labels of a profile sample
+func parseProfileSample(b []byte) ([]int64, [][2]uint64, error) {
+	var values []int64
+	var labels [][2]uint64
+
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return nil, nil, protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		switch {
+		case num == 2 && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			if n < 0 {
+				return nil, nil, protowire.ParseError(n)
+			}
+			values = append(values, int64(v))
+			b = b[n:]
+		case num == 2 && typ == protowire.BytesType:
+			// packed values
+			p, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return nil, nil, protowire.ParseError(n)
+			}
+			b = b[n:]
+			for len(p) > 0 {
+				v, n := protowire.ConsumeVarint(p)
+				if n < 0 {
+					return nil, nil, protowire.ParseError(n)
+				}
+				values = append(values, int64(v))
+				p = p[n:]
+			}
+		case num == 3 && typ == protowire.BytesType:
+			l, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return nil, nil, protowire.ParseError(n)
+			}
+			b = b[n:]
+
+			var label [2]uint64
+			for len(l) > 0 {
+				lnum, ltyp, n := protowire.ConsumeTag(l)
+				if n < 0 {
+					return nil, nil, protowire.ParseError(n)
+				}
+				l = l[n:]
+
+				if (lnum == 1 || lnum == 2) && ltyp == protowire.VarintType {
+					v, n := protowire.ConsumeVarint(l)
+					if n < 0 {
+						return nil, nil, protowire.ParseError(n)
+					}
+					label[lnum-1] = v
+					l = l[n:]
+					continue
+				}
+
+				n = protowire.ConsumeFieldValue(lnum, ltyp, l)
+				if n < 0 {
+					return nil, nil, protowire.ParseError(n)
+				}
+				l = l[n:]
+			}
+			labels = append(labels, label)
+		default:
+			n := protowire.ConsumeFieldValue(num, typ, b)
+			if n < 0 {
+				return nil, nil, protowire.ParseError(n)
+			}
+			b = b[n:]
+		}
+	}
+
+	return values, labels, nil
+}
@@ -0,0 +1,123 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"runtime/pprof"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestGoroutinesByLabel(t *testing.T) {
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+
+	pprof.Do(context.Background(), pprof.Labels(clientLabel, `node "1"`), func(context.Context) {
+		for i := 0; i < 3; i++ {
+			wg.Add(1)
+			go func() {
+				<-stop
+				wg.Done()
+			}()
+		}
+	})
+
+	defer wg.Wait()
+	defer close(stop)
+
+	counts, err := goroutinesByLabel(clientLabel)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if counts[`node "1"`] != 3 {
+		t.Fatal("Wrong goroutine counts: ", counts)
+	}
+}
+
+func TestCPUByLabel(t *testing.T) {
+	var buf bytes.Buffer
+	err := pprof.StartCPUProfile(&buf)
+	if err != nil {
+		t.Skip("CPU profile already running: ", err)
+	}
+
+	pprof.Do(context.Background(), pprof.Labels(clientLabel, "spin"), func(context.Context) {
+		start := time.Now()
+		x := 0
+		for time.Since(start) < 300*time.Millisecond {
+			x++
+		}
+	})
+
+	pprof.StopCPUProfile()
+
+	cpu, err := cpuByLabel(buf.Bytes(), clientLabel)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cpu["spin"] < 50*time.Millisecond {
+		t.Fatal("Expected CPU time for spin, got: ", cpu)
+	}
+}
+
+func TestResourceSamplerCPUProfile(t *testing.T) {
+	period, sample := clientResourcePeriod, clientCPUSample
+	clientResourcePeriod, clientCPUSample = 10*time.Millisecond, 100*time.Millisecond
+	defer func() { clientResourcePeriod, clientCPUSample = period, sample }()
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer close(stop)
+
+	pprof.Do(context.Background(), pprof.Labels(clientLabel, "c1"), func(context.Context) {
+		wg.Add(1)
+		go func() {
+			<-stop
+			wg.Done()
+		}()
+	})
+
+	// waitUsage runs a sampler until it has sampled c1
+	waitUsage := func(cpuProfile bool) clientUsage {
+		s := &resourceSampler{cpuProfile: cpuProfile, stop: make(chan struct{})}
+		done := make(chan struct{})
+		go func() {
+			s.run(s.stop)
+			close(done)
+		}()
+
+		defer func() {
+			close(s.stop)
+			<-done
+		}()
+
+		start := time.Now()
+		for time.Since(start) < 5*time.Second {
+			if u, ok := s.get("c1"); ok {
+				return u
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		t.Fatal("Timeout waiting for sample")
+		return clientUsage{}
+	}
+
+	if u := waitUsage(false); u.goroutines != 1 || u.cpuSampled {
+		t.Errorf("Wrong usage without CPU profile: %+v", u)
+	}
+
+	var buf bytes.Buffer
+	if err := pprof.StartCPUProfile(&buf); err != nil {
+		t.Skip("CPU profile already running: ", err)
+	}
+	pprof.StopCPUProfile()
+
+	if u := waitUsage(true); !u.cpuSampled {
+		t.Errorf("CPU not sampled: %+v", u)
+	}
+}
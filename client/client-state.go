@@ -1,10 +1,14 @@
 package client
 
 import (
+	"errors"
 	"fmt"
 	"log"
+	"reflect"
+	"runtime/debug"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/nats-io/nats.go"
@@ -15,6 +19,101 @@ func mapKey(node data.NodeEdge) string {
 	return node.Parent + "-" + node.ID
 }
 
+// removeArchived removes archived nodes, which don't get clients and are
+// left out of client configs (see ArchiveNode)
+func removeArchived(nodes []data.NodeEdge) []data.NodeEdge {
+	var ret []data.NodeEdge
+
+	for _, n := range nodes {
+		if !n.Archived() {
+			ret = append(ret, n)
+		}
+	}
+
+	return ret
+}
+
+// getChildren returns the children of a node. Children with a type that
+// matches a child tag in the config type t also get their children, so
+// config types can nest child node slices to any depth. Points for all
+// descendants are routed to the client by the node ID and merged with
+// MergePoints, which also recurses into child slices.
+func getChildren(nc *nats.Conn, id string, t reflect.Type) ([]data.NodeEdgeChildren, error) {
+	children, err := GetNodeChildren(nc, id, "", false, false)
+	if err != nil {
+		return nil, err
+	}
+
+	children = removeArchived(children)
+
+	childTypes := make(map[string]reflect.Type)
+	if t.Kind() == reflect.Struct {
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			if ct := sf.Tag.Get("child"); ct != "" && sf.Type.Kind() == reflect.Slice {
+				childTypes[ct] = sf.Type.Elem()
+			}
+		}
+	}
+
+	ret := make([]data.NodeEdgeChildren, len(children))
+
+	for i, c := range children {
+		ret[i] = data.NodeEdgeChildren{NodeEdge: c}
+
+		ct, ok := childTypes[c.Type]
+		if !ok || !hasChildTags(ct) {
+			continue
+		}
+
+		ret[i].Children, err = getChildren(nc, c.ID, ct)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return ret, nil
+}
+
+// resolveNodeSecrets replaces secret references in the points of a node and
+// its children with the secret values
+func resolveNodeSecrets(nc *nats.Conn, nec *data.NodeEdgeChildren) error {
+	var err error
+	nec.NodeEdge.Points, err = ResolveSecrets(nc, nec.NodeEdge.Points)
+	if err != nil {
+		return err
+	}
+
+	nec.NodeEdge.EdgePoints, err = ResolveSecrets(nc, nec.NodeEdge.EdgePoints)
+	if err != nil {
+		return err
+	}
+
+	for i := range nec.Children {
+		err = resolveNodeSecrets(nc, &nec.Children[i])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// hasChildTags returns true if struct type t has any child node fields
+func hasChildTags(t reflect.Type) bool {
+	if t.Kind() != reflect.Struct {
+		return false
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).Tag.Get("child") != "" {
+			return true
+		}
+	}
+
+	return false
+}
+
 type clientState[T any] struct {
 	nc        *nats.Conn
 	node      data.NodeEdge
@@ -25,42 +124,61 @@ type clientState[T any] struct {
 	upSub  *nats.Subscription
 	client Client
 
+	// subscription to the heartbeats of the client, and the unix nano
+	// time of the last one, accessed atomically
+	healthSub     *nats.Subscription
+	lastHeartbeat int64
+
 	stopOnce sync.Once
 	chStop   chan struct{}
+
+	// when the client state was created, used to tell if a client that
+	// crashed had been running for a while
+	started time.Time
+
+	// shared with the manager, incremented atomically
+	decodeErrors *uint64
+
+	// unix nano time a point update to the client started, or 0 if the
+	// client is not handling one, accessed atomically
+	delivering int64
 }
 
 func newClientState[T any](nc *nats.Conn, construct func(*nats.Conn, T) Client,
-	n data.NodeEdge) *clientState[T] {
+	n data.NodeEdge, decodeErrors *uint64) *clientState[T] {
 
 	ret := &clientState[T]{
-		node:      n,
-		nc:        nc,
-		construct: construct,
-		chStop:    make(chan struct{}),
+		node:         n,
+		nc:           nc,
+		construct:    construct,
+		chStop:       make(chan struct{}),
+		started:      time.Now(),
+		decodeErrors: decodeErrors,
 	}
 
 	return ret
 }
 
 func (cs *clientState[T]) start() (err error) {
-	c, err := GetNodeChildren(cs.nc, cs.node.ID, "", false, false)
+	var config T
+
+	ncc, err := getChildren(cs.nc, cs.node.ID, reflect.TypeOf(config))
 	if err != nil {
 		err = fmt.Errorf("Error getting children: %v", err)
 		return
 	}
 
-	ncc := make([]data.NodeEdgeChildren, len(c))
-
-	for i, nci := range c {
-		ncc[i] = data.NodeEdgeChildren{NodeEdge: nci, Children: nil}
-	}
-
 	cs.nec = data.NodeEdgeChildren{NodeEdge: cs.node, Children: ncc}
 
-	var config T
+	err = resolveNodeSecrets(cs.nc, &cs.nec)
+	if err != nil {
+		err = fmt.Errorf("Error resolving secrets: %v", err)
+		return
+	}
 
 	err = data.Decode(cs.nec, &config)
 	if err != nil {
+		atomic.AddUint64(cs.decodeErrors, 1)
 		err = fmt.Errorf("Error decoding node: %v", err)
 		return
 	}
@@ -71,9 +189,10 @@ func (cs *clientState[T]) start() (err error) {
 	subject := fmt.Sprintf("up.%v.>", cs.node.ID)
 
 	cs.upSub, err = cs.nc.Subscribe(subject, func(msg *nats.Msg) {
-		points, err := data.PbDecodePoints(msg.Data)
+		points, err := DecodePoints(msg)
 		if err != nil {
 			log.Println("Error decoding points")
+			atomic.AddUint64(cs.decodeErrors, 1)
 			return
 		}
 		for _, p := range points {
@@ -85,17 +204,37 @@ func (cs *clientState[T]) start() (err error) {
 
 		// find node ID for points
 		chunks := strings.Split(msg.Subject, ".")
+
+		if len(chunks) == 4 {
+			// points with a type that must be signed are checked
+			// before they are passed to the client
+			err = verifyClientPoints(cs.nc, cs.node.ID, chunks[2], points)
+			if err != nil {
+				log.Printf("Client %v rejected points for node %v: %v\n",
+					cs.node.ID, chunks[2], err)
+				return
+			}
+		}
+
+		points, err = ResolveSecrets(cs.nc, points)
+		if err != nil {
+			log.Printf("Error resolving secrets for client %v: %v\n", cs.node.ID, err)
+			return
+		}
+
 		if len(chunks) == 4 {
 			// node points
 			for _, p := range points {
-				if p.Type == data.PointTypeNodeType {
+				if p.Type == data.PointTypeNodeType || p.Type == data.PointTypeArchived {
+					// restart so archived nodes are removed from or
+					// restored to the config
 					cs.stop(nil)
 					return
 				}
 			}
 
 			// send node points to client
-			cs.client.Points(chunks[2], points)
+			cs.deliver(func() { cs.client.Points(chunks[2], points) })
 
 		} else if len(chunks) == 5 {
 			// edge points
@@ -108,7 +247,7 @@ func (cs *clientState[T]) start() (err error) {
 			}
 
 			// send edge points to client
-			cs.client.EdgePoints(chunks[2], chunks[3], points)
+			cs.deliver(func() { cs.client.EdgePoints(chunks[2], chunks[3], points) })
 		} else {
 			log.Println("up subject malformed: ", msg.Subject)
 			return
@@ -120,20 +259,54 @@ func (cs *clientState[T]) start() (err error) {
 		return
 	}
 
+	cs.healthSub, err = cs.nc.Subscribe(SubjectClientHealth(cs.node.ID), func(*nats.Msg) {
+		atomic.StoreInt64(&cs.lastHeartbeat, time.Now().UnixNano())
+	})
+
+	if err != nil {
+		cs.upSub.Unsubscribe()
+		return
+	}
+
 	chClientStopped := make(chan struct{})
+	var clientErr error
 
 	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				clientErr = fmt.Errorf("panic: %v", r)
+				log.Printf("Client %v %v panicked: %v\n%s", cs.node.Type,
+					cs.node.ID, r, debug.Stack())
+			}
+			close(chClientStopped)
+		}()
+
 		// the following blocks until client exits
-		err := cs.client.Start()
-		if err != nil {
+		clientErr = cs.client.Start()
+		if clientErr != nil {
 			log.Printf("Client Start %v %v returned error: %v\n",
-				cs.node.Type, cs.node.ID, err)
+				cs.node.Type, cs.node.ID, clientErr)
 		}
-		close(chClientStopped)
 	}()
 
-	<-cs.chStop
+	if hr, ok := cs.client.(HeartbeatReporter); !ok || !hr.ReportsHeartbeat() {
+		go cs.heartbeat(chClientStopped)
+	}
+
+	select {
+	case <-cs.chStop:
+	case <-chClientStopped:
+		// the client exited without being stopped, so it crashed
+		cs.upSub.Unsubscribe()
+		cs.healthSub.Unsubscribe()
+		if clientErr == nil {
+			clientErr = errors.New("client exited")
+		}
+		return clientErr
+	}
+
 	cs.upSub.Unsubscribe()
+	cs.healthSub.Unsubscribe()
 	cs.client.Stop(nil)
 
 	select {
@@ -146,6 +319,50 @@ func (cs *clientState[T]) start() (err error) {
 	return nil
 }
 
+// deliver calls f, which passes a point update to the client, and records
+// when it started so that a client that does not accept it is detected
+func (cs *clientState[T]) deliver(f func()) {
+	atomic.StoreInt64(&cs.delivering, time.Now().UnixNano())
+	f()
+	atomic.StoreInt64(&cs.delivering, 0)
+}
+
+// heartbeatTime returns the time of the last heartbeat of the client, or the
+// zero time if there is none
+func (cs *clientState[T]) heartbeatTime() time.Time {
+	t := atomic.LoadInt64(&cs.lastHeartbeat)
+	if t == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, t)
+}
+
+// heartbeat publishes heartbeats for a client that does not publish its own
+// until the client stops. Heartbeats are skipped while the client is not
+// accepting a point update, as its main loop is likely stuck.
+func (cs *clientState[T]) heartbeat(chClientStopped chan struct{}) {
+	ticker := time.NewTicker(HeartbeatPeriod)
+	defer ticker.Stop()
+
+	for {
+		start := atomic.LoadInt64(&cs.delivering)
+		if start == 0 || time.Since(time.Unix(0, start)) < HeartbeatPeriod {
+			err := SendHeartbeat(cs.nc, cs.node.ID)
+			if err != nil {
+				log.Println("Error sending heartbeat: ", err)
+			}
+		}
+
+		select {
+		case <-ticker.C:
+		case <-cs.chStop:
+			return
+		case <-chClientStopped:
+			return
+		}
+	}
+}
+
 func (cs *clientState[T]) stop(err error) {
 	cs.stopOnce.Do(func() { close(cs.chStop) })
 }
@@ -0,0 +1,510 @@
+package client
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/data"
+	"golang.org/x/net/http2"
+)
+
+// CloudForwarder sends point changes from nodes under the parent node to a
+// custom HTTP or gRPC endpoint. URI schemes http and https POST batches to the
+// URI. Schemes grpc and grpcs make unary gRPC calls to the method in the URI
+// path, for example grpc://host:50051/acme.Ingest/Points. Batches are encoded
+// as a list of nodes, each with the points that changed, using JSON or the
+// SIOT Nodes protobuf message (Format). Batches are sent when BatchSize points
+// are collected or every BatchPeriod ms, and are queued in SpoolDir (or
+// memory if blank) while the endpoint is not reachable. MaxSpool limits the
+// queue size in MB.
+type CloudForwarder struct {
+	ID          string  `node:"id"`
+	Parent      string  `node:"parent"`
+	Description string  `point:"description"`
+	URI         string  `point:"uri"`
+	Format      string  `point:"format"`
+	AuthToken   string  `point:"authToken"`
+	PointTypes  string  `point:"pointTypes"`
+	BatchSize   int     `point:"batchSize"`
+	BatchPeriod int     `point:"batchPeriod"`
+	SpoolDir    string  `point:"spoolDir"`
+	MaxSpool    float64 `point:"maxSpool"`
+	Disable     bool    `point:"disable"`
+	Tx          int     `point:"tx"`
+	ErrorCount  int     `point:"errorCount"`
+}
+
+// defaults used if not configured
+var forwarderDefaultBatchSize = 100
+var forwarderDefaultBatchPeriod = time.Second
+var forwarderDefaultMaxSpool = 100.0
+
+// maximum time between retries
+var forwarderMaxBackoff = 5 * time.Minute
+
+var forwarderTimeout = 10 * time.Second
+
+// forwarderError is returned when the endpoint rejects a batch. Permanent
+// errors are not retried.
+type forwarderError struct {
+	msg       string
+	permanent bool
+}
+
+func (e *forwarderError) Error() string {
+	return e.msg
+}
+
+// CloudForwarderClient is a SIOT client that forwards points to custom
+// cloud endpoints
+type CloudForwarderClient struct {
+	nc            *nats.Conn
+	config        CloudForwarder
+	stop          chan struct{}
+	newPoints     chan NewPoints
+	newEdgePoints chan NewPoints
+	newUpPoints   chan NewPoints
+	pointTypes    map[string]bool
+	batch         data.Nodes
+	batchCount    int
+	spool         *spool
+	httpClient    *http.Client
+	attempts      int
+	retryAt       time.Time
+}
+
+// NewCloudForwarderClient ...
+func NewCloudForwarderClient(nc *nats.Conn, config CloudForwarder) Client {
+	return &CloudForwarderClient{
+		nc:            nc,
+		config:        config,
+		stop:          make(chan struct{}),
+		newPoints:     make(chan NewPoints),
+		newEdgePoints: make(chan NewPoints),
+		newUpPoints:   make(chan NewPoints),
+	}
+}
+
+// Start runs the main logic for this client and blocks until stopped
+func (cf *CloudForwarderClient) Start() error {
+	log.Println("Starting cloud forwarder client: ", cf.config.Description)
+
+	bufOpts := BufferOptions{
+		Size:          10000,
+		Policy:        BufferDropOldest,
+		MetricsNodeID: cf.config.ID,
+	}
+
+	handler := func(subject string, points data.Points) {
+		chunks := strings.Split(subject, ".")
+		if len(chunks) < 3 {
+			log.Println("Cloud forwarder up sub, malformed subject: ", subject)
+			return
+		}
+
+		// don't send our own stats
+		if chunks[2] == cf.config.ID {
+			return
+		}
+
+		select {
+		case cf.newUpPoints <- NewPoints{chunks[2], "", points}:
+		case <-cf.stop:
+		}
+	}
+
+	upSub, err := NewBufferedSub(cf.nc, fmt.Sprintf("up.%v.*.points", cf.config.Parent),
+		bufOpts, handler)
+	if err != nil {
+		return fmt.Errorf("Cloud forwarder error subscribing to upsub: %v", err)
+	}
+
+	upSubHr, err := NewBufferedSub(cf.nc, fmt.Sprintf("phrup.%v.*", cf.config.Parent),
+		bufOpts, handler)
+	if err != nil {
+		upSub.Stop()
+		return fmt.Errorf("Cloud forwarder error subscribing to upSubHr: %v", err)
+	}
+
+	cf.configure()
+
+	batchTicker := time.NewTicker(cf.batchPeriod())
+	defer batchTicker.Stop()
+
+done:
+	for {
+		select {
+		case <-cf.stop:
+			log.Println("Stopping cloud forwarder client: ", cf.config.Description)
+			break done
+		case <-batchTicker.C:
+			cf.queueBatch()
+			cf.send()
+		case pts := <-cf.newPoints:
+			err := data.MergePoints(pts.ID, pts.Points, &cf.config)
+			if err != nil {
+				log.Println("error merging new points: ", err)
+			}
+
+			for _, p := range pts.Points {
+				switch p.Type {
+				case data.PointTypePointTypes, data.PointTypeSpoolDir,
+					data.PointTypeMaxSpool, data.PointTypeURI:
+					cf.configure()
+				case data.PointTypeBatchPeriod:
+					batchTicker.Reset(cf.batchPeriod())
+				}
+			}
+		case pts := <-cf.newEdgePoints:
+			err := data.MergeEdgePoints(pts.ID, pts.Parent, pts.Points, &cf.config)
+			if err != nil {
+				log.Println("error merging new points: ", err)
+			}
+		case pts := <-cf.newUpPoints:
+			if cf.config.Disable {
+				continue
+			}
+
+			cf.add(pts.ID, pts.Points)
+
+			batchSize := cf.config.BatchSize
+			if batchSize <= 0 {
+				batchSize = forwarderDefaultBatchSize
+			}
+
+			if cf.batchCount >= batchSize {
+				cf.queueBatch()
+				cf.send()
+			}
+		}
+	}
+
+	upSub.Stop()
+	upSubHr.Stop()
+
+	// batches are only kept across restarts if a spool dir is configured
+	cf.queueBatch()
+
+	return nil
+}
+
+func (cf *CloudForwarderClient) batchPeriod() time.Duration {
+	if cf.config.BatchPeriod <= 0 {
+		return forwarderDefaultBatchPeriod
+	}
+	return time.Duration(cf.config.BatchPeriod) * time.Millisecond
+}
+
+// configure sets up the spool and HTTP client from the current config
+func (cf *CloudForwarderClient) configure() {
+	cf.pointTypes = make(map[string]bool)
+	for _, t := range splitList(cf.config.PointTypes) {
+		cf.pointTypes[t] = true
+	}
+
+	maxSpool := cf.config.MaxSpool
+	if maxSpool <= 0 {
+		maxSpool = forwarderDefaultMaxSpool
+	}
+
+	// keep batches that are queued in memory if the spool changes
+	var pending []spoolEntry
+	if cf.spool != nil && cf.spool.dir == "" {
+		pending = cf.spool.entries
+	}
+
+	var err error
+	cf.spool, err = newSpool(cf.config.SpoolDir, int64(maxSpool*1e6))
+	if err != nil {
+		log.Printf("Cloud forwarder %v: %v, using memory\n", cf.config.Description, err)
+		cf.spool, _ = newSpool("", int64(maxSpool*1e6))
+	}
+
+	for _, e := range pending {
+		_, err := cf.spool.push(e.format, e.count, e.data)
+		if err != nil {
+			log.Printf("Cloud forwarder %v: %v\n", cf.config.Description, err)
+		}
+	}
+
+	cf.httpClient = &http.Client{Timeout: forwarderTimeout}
+
+	if strings.HasPrefix(cf.config.URI, "grpc://") {
+		// gRPC without TLS requires HTTP/2 with prior knowledge
+		cf.httpClient.Transport = &http2.Transport{
+			AllowHTTP: true,
+			DialTLS: func(network, addr string, _ *tls.Config) (net.Conn, error) {
+				return net.DialTimeout(network, addr, forwarderTimeout)
+			},
+		}
+	} else if strings.HasPrefix(cf.config.URI, "grpcs://") {
+		cf.httpClient.Transport = &http2.Transport{}
+	}
+
+	cf.attempts = 0
+	cf.retryAt = time.Time{}
+}
+
+// add adds points to the current batch
+func (cf *CloudForwarderClient) add(nodeID string, points data.Points) {
+	var node *data.NodeEdge
+	for i := range cf.batch {
+		if cf.batch[i].ID == nodeID {
+			node = &cf.batch[i]
+			break
+		}
+	}
+
+	for _, p := range points {
+		if len(cf.pointTypes) > 0 && !cf.pointTypes[p.Type] {
+			continue
+		}
+
+		if node == nil {
+			cf.batch = append(cf.batch, data.NodeEdge{ID: nodeID})
+			node = &cf.batch[len(cf.batch)-1]
+		}
+
+		node.Points = append(node.Points, p)
+		cf.batchCount++
+	}
+}
+
+// queueBatch encodes the current batch and adds it to the spool
+func (cf *CloudForwarderClient) queueBatch() {
+	if cf.batchCount <= 0 {
+		return
+	}
+
+	format := cf.config.Format
+	if format != data.PointValueProtobuf {
+		format = data.PointValueJSON
+	}
+
+	d, err := encodeForwarderBatch(format, cf.batch)
+	count := cf.batchCount
+	cf.batch = nil
+	cf.batchCount = 0
+
+	if err != nil {
+		log.Printf("Cloud forwarder %v: error encoding batch: %v\n",
+			cf.config.Description, err)
+		cf.sendStat(data.PointTypeErrorCount, &cf.config.ErrorCount, 1)
+		return
+	}
+
+	dropped, err := cf.spool.push(format, count, d)
+	if err != nil {
+		log.Printf("Cloud forwarder %v: %v\n", cf.config.Description, err)
+		cf.sendStat(data.PointTypeErrorCount, &cf.config.ErrorCount, 1)
+	}
+
+	if dropped > 0 {
+		log.Printf("Cloud forwarder %v: spool full, dropped %v points\n",
+			cf.config.Description, dropped)
+	}
+}
+
+func encodeForwarderBatch(format string, nodes data.Nodes) ([]byte, error) {
+	if format == data.PointValueProtobuf {
+		return nodes.ToPb()
+	}
+	return json.Marshal(nodes)
+}
+
+// send sends spooled batches until the spool is empty or a send fails. After
+// a failure, sending is retried with an exponential backoff.
+func (cf *CloudForwarderClient) send() {
+	if cf.config.Disable || cf.config.URI == "" || time.Now().Before(cf.retryAt) {
+		return
+	}
+
+	for cf.spool.len() > 0 {
+		e, err := cf.spool.peek()
+		if err == nil {
+			err = cf.post(e.format, e.data)
+		}
+
+		if err != nil {
+			fe, ok := err.(*forwarderError)
+			permanent := ok && fe.permanent
+
+			log.Printf("Cloud forwarder %v: error sending batch (permanent: %v): %v\n",
+				cf.config.Description, permanent, err)
+			cf.sendStat(data.PointTypeErrorCount, &cf.config.ErrorCount, 1)
+
+			if !permanent {
+				cf.retryAt = time.Now().Add(ExpBackoff(cf.attempts, forwarderMaxBackoff))
+				cf.attempts++
+				return
+			}
+		} else {
+			cf.sendStat(data.PointTypeTx, &cf.config.Tx, e.count)
+		}
+
+		cf.attempts = 0
+
+		err = cf.spool.pop()
+		if err != nil {
+			log.Printf("Cloud forwarder %v: %v\n", cf.config.Description, err)
+		}
+	}
+}
+
+// post sends one batch to the endpoint
+func (cf *CloudForwarderClient) post(format string, body []byte) error {
+	u, err := url.Parse(cf.config.URI)
+	if err != nil {
+		return &forwarderError{msg: fmt.Sprintf("invalid URI: %v", err), permanent: true}
+	}
+
+	grpc := u.Scheme == "grpc" || u.Scheme == "grpcs"
+
+	contentType := "application/json"
+	if format == data.PointValueProtobuf {
+		contentType = "application/x-protobuf"
+	}
+
+	switch u.Scheme {
+	case "http", "https":
+	case "grpc", "grpcs":
+		u.Scheme = strings.Replace(u.Scheme, "grpc", "http", 1)
+
+		// gRPC length prefixed message, not compressed
+		msg := make([]byte, 5, 5+len(body))
+		binary.BigEndian.PutUint32(msg[1:], uint32(len(body)))
+		body = append(msg, body...)
+
+		contentType = "application/grpc"
+		if format != data.PointValueProtobuf {
+			contentType = "application/grpc+json"
+		}
+	default:
+		return &forwarderError{msg: "unsupported URI scheme: " + u.Scheme, permanent: true}
+	}
+
+	req, err := http.NewRequest(http.MethodPost, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", contentType)
+	if grpc {
+		req.Header.Set("TE", "trailers")
+	}
+
+	if cf.config.AuthToken != "" {
+		req.Header.Set("Authorization", "Bearer "+cf.config.AuthToken)
+	}
+
+	resp, err := cf.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// trailers are only available after the body is read
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+
+	if grpc && resp.StatusCode == http.StatusOK {
+		return grpcStatus(resp)
+	}
+
+	return httpStatusError(resp, respBody)
+}
+
+// httpStatusError returns an error if the response status is not 2xx
+func httpStatusError(resp *http.Response, respBody []byte) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+
+	// client errors are not retried, except those that may be resolved by
+	// waiting or fixing credentials
+	permanent := resp.StatusCode >= 400 && resp.StatusCode < 500
+	switch resp.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden,
+		http.StatusRequestTimeout, http.StatusTooManyRequests:
+		permanent = false
+	}
+
+	return &forwarderError{
+		msg:       fmt.Sprintf("server returned %v: %v", resp.Status, strings.TrimSpace(string(respBody))),
+		permanent: permanent,
+	}
+}
+
+// grpcStatus returns an error if the grpc-status of a response is not OK.
+// INVALID_ARGUMENT and UNIMPLEMENTED are treated as permanent errors.
+func grpcStatus(resp *http.Response) error {
+	status := resp.Trailer.Get("Grpc-Status")
+	msg := resp.Trailer.Get("Grpc-Message")
+	if status == "" {
+		// trailers only response
+		status = resp.Header.Get("Grpc-Status")
+		msg = resp.Header.Get("Grpc-Message")
+	}
+
+	code, err := strconv.Atoi(status)
+	if err != nil {
+		return fmt.Errorf("invalid grpc-status: %q", status)
+	}
+
+	if code == 0 {
+		return nil
+	}
+
+	if m, err := url.PathUnescape(msg); err == nil {
+		msg = m
+	}
+
+	return &forwarderError{
+		msg:       fmt.Sprintf("grpc error %v: %v", code, msg),
+		permanent: code == 3 || code == 12,
+	}
+}
+
+// sendStat adds inc to a counter and sends it
+func (cf *CloudForwarderClient) sendStat(typ string, counter *int, inc int) {
+	*counter += inc
+	err := SendNodePoint(cf.nc, cf.config.ID, data.Point{
+		Time:  time.Now(),
+		Type:  typ,
+		Value: float64(*counter),
+	}, false)
+	if err != nil {
+		log.Println("Cloud forwarder: error sending stat: ", err)
+	}
+}
+
+// Stop sends a signal to the Start function to exit
+func (cf *CloudForwarderClient) Stop(err error) {
+	close(cf.stop)
+}
+
+// Points is called by the Manager when new points for this
+// node are received.
+func (cf *CloudForwarderClient) Points(nodeID string, points []data.Point) {
+	cf.newPoints <- NewPoints{nodeID, "", points}
+}
+
+// EdgePoints is called by the Manager when new edge points for this
+// node are received.
+func (cf *CloudForwarderClient) EdgePoints(nodeID, parentID string, points []data.Point) {
+	cf.newEdgePoints <- NewPoints{nodeID, parentID, points}
+}
@@ -0,0 +1,157 @@
+package client_test
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+	"github.com/simpleiot/simpleiot/server"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// testCloudForwarder creates a variable and cloud forwarder node, sends a
+// value, and returns the nodes received by the handler
+func testCloudForwarder(t *testing.T, uri, format string, nodes <-chan data.Nodes) {
+	nc, root, stop, err := server.TestServer()
+	if err != nil {
+		t.Fatal("Error starting test server: ", err)
+	}
+	defer stop()
+
+	err = client.SendNodeType(nc, client.CloudForwarder{
+		ID:          "cf",
+		Parent:      root.ID,
+		Description: "test forwarder",
+		URI:         uri,
+		Format:      format,
+		AuthToken:   "secret",
+		PointTypes:  data.PointTypeValue,
+		BatchPeriod: 100,
+	}, "test")
+	if err != nil {
+		t.Fatal("Error sending forwarder node: ", err)
+	}
+
+	err = client.SendNodeType(nc, client.Variable{ID: "var", Parent: root.ID}, "test")
+	if err != nil {
+		t.Fatal("Error sending variable node: ", err)
+	}
+
+	timeout := time.After(10 * time.Second)
+
+	// the forwarder may not be running yet, so keep sending until a value
+	// is received
+	tick := time.NewTicker(200 * time.Millisecond)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-timeout:
+			t.Fatal("Timeout waiting for points")
+		case <-tick.C:
+			err := client.SendNodePoints(nc, "var", data.Points{
+				{Type: data.PointTypeValue, Value: 12},
+				{Type: data.PointTypeDescription, Text: "not sent"},
+			}, true)
+			if err != nil {
+				t.Fatal("Error sending points: ", err)
+			}
+		case n := <-nodes:
+			if len(n) != 1 || n[0].ID != "var" {
+				t.Fatal("Wrong nodes received: ", n)
+			}
+
+			for _, p := range n[0].Points {
+				if p.Type != data.PointTypeValue {
+					t.Fatal("Wrong point received: ", p)
+				}
+			}
+
+			// the initial value of the variable may be forwarded
+			// first
+			if v, _ := n[0].Points.Value(data.PointTypeValue, ""); v != 12 {
+				continue
+			}
+
+			return
+		}
+	}
+}
+
+func TestCloudForwarderREST(t *testing.T) {
+	nodes := make(chan data.Nodes, 10)
+	var lock sync.Mutex
+	requests := 0
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" ||
+			r.Header.Get("Content-Type") != "application/json" {
+			t.Error("Wrong headers: ", r.Header)
+		}
+
+		// the first request fails to test retries
+		lock.Lock()
+		requests++
+		first := requests == 1
+		lock.Unlock()
+
+		if first {
+			http.Error(w, "try again", http.StatusServiceUnavailable)
+			return
+		}
+
+		var n data.Nodes
+		err := json.NewDecoder(r.Body).Decode(&n)
+		if err != nil {
+			t.Error("Error decoding body: ", err)
+		}
+		nodes <- n
+	}))
+	defer s.Close()
+
+	testCloudForwarder(t, s.URL+"/ingest", data.PointValueJSON, nodes)
+}
+
+func TestCloudForwarderGRPC(t *testing.T) {
+	nodes := make(chan data.Nodes, 10)
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/acme.Ingest/Points" ||
+			r.Header.Get("Content-Type") != "application/grpc" {
+			t.Error("Wrong request: ", r.URL.Path, r.Header)
+		}
+
+		body, _ := io.ReadAll(r.Body)
+		if len(body) < 5 || int(binary.BigEndian.Uint32(body[1:])) != len(body)-5 {
+			t.Error("Invalid gRPC message")
+			return
+		}
+
+		n, err := data.PbDecodeNodes(body[5:])
+		if err != nil {
+			t.Error("Error decoding nodes: ", err)
+		}
+
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("Trailer", "Grpc-Status")
+		// empty response message
+		w.Write([]byte{0, 0, 0, 0, 0})
+		w.Header().Set("Grpc-Status", "0")
+
+		nodes <- n
+	})
+
+	s := httptest.NewServer(h2c.NewHandler(handler, &http2.Server{}))
+	defer s.Close()
+
+	testCloudForwarder(t, "grpc://"+s.Listener.Addr().String()+"/acme.Ingest/Points",
+		data.PointValueProtobuf, nodes)
+}
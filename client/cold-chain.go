@@ -0,0 +1,487 @@
+package client
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// ColdChain logs temperature excursions of the TempPointType (defaults to
+// value) point of TempNodeID for cold-chain compliance. The temperature must
+// stay between LowLimit and HighLimit (no limits are checked if HighLimit is
+// not above LowLimit). When it is outside the limits for ExcursionDelay
+// minutes, Excursion is set and a ColdChainEvent child node is created that
+// records the start of the excursion, the limit crossed, and the peak
+// temperature. When the temperature returns within the limits, the end and
+// duration are recorded. Excursions shorter than ExcursionDelay are not
+// logged. Events are signed off by an operator by setting SignOff, which
+// records the user and time of the sign-off. Unsigned is the number of events
+// that are not signed off.
+type ColdChain struct {
+	ID             string           `node:"id"`
+	Parent         string           `node:"parent"`
+	Description    string           `point:"description"`
+	TempNodeID     string           `point:"tempNodeID"`
+	TempPointType  string           `point:"tempPointType"`
+	LowLimit       float64          `point:"lowLimit"`
+	HighLimit      float64          `point:"highLimit"`
+	ExcursionDelay float64          `point:"excursionDelay"`
+	Disable        bool             `point:"disable"`
+	Excursion      bool             `point:"excursion"`
+	Unsigned       int              `point:"unsigned"`
+	Events         []ColdChainEvent `child:"coldChainEvent"`
+}
+
+// ColdChainEvent is a logged temperature excursion. Start and End are
+// RFC3339 times, and End is blank while the excursion is active. LimitType
+// is high or low, Limit is the limit that was crossed, Peak is the highest
+// (or lowest) temperature during the excursion, and Duration is in minutes.
+// Comment is the corrective action entered by the operator.
+type ColdChainEvent struct {
+	ID          string  `node:"id"`
+	Parent      string  `node:"parent"`
+	Description string  `point:"description"`
+	Start       string  `point:"start"`
+	End         string  `point:"end"`
+	LimitType   string  `point:"limitType"`
+	Limit       float64 `point:"limit"`
+	Peak        float64 `point:"peak"`
+	Duration    float64 `point:"duration"`
+	SignOff     bool    `point:"signOff"`
+	SignOffBy   string  `point:"signOffBy"`
+	SignOffTime string  `point:"signOffTime"`
+	Comment     string  `point:"comment"`
+}
+
+// coldChainLimit returns the limit type the temperature is outside of, or
+// blank if it is within the limits
+func coldChainLimit(c *ColdChain, temp float64) string {
+	if c.HighLimit <= c.LowLimit {
+		return ""
+	}
+
+	switch {
+	case temp > c.HighLimit:
+		return data.PointValueHigh
+	case temp < c.LowLimit:
+		return data.PointValueLow
+	}
+
+	return ""
+}
+
+// ColdChainClient is a SIOT client that runs cold-chain logging nodes
+type ColdChainClient struct {
+	nc            *nats.Conn
+	config        ColdChain
+	stop          chan struct{}
+	newPoints     chan NewPoints
+	newEdgePoints chan NewPoints
+	newTemp       chan data.Point
+	tempSub       *nats.Subscription
+	// limit type the temperature is outside of and when it first was,
+	// blank if the temperature is within the limits
+	outside      string
+	outsideStart time.Time
+	peak         float64
+	// ID of the event for the active excursion
+	eventID string
+}
+
+// NewColdChainClient ...
+func NewColdChainClient(nc *nats.Conn, config ColdChain) Client {
+	return &ColdChainClient{
+		nc:            nc,
+		config:        config,
+		stop:          make(chan struct{}),
+		newPoints:     make(chan NewPoints),
+		newEdgePoints: make(chan NewPoints),
+		newTemp:       make(chan data.Point),
+	}
+}
+
+// Start runs the main logic for this client and blocks until stopped
+func (c *ColdChainClient) Start() error {
+	log.Println("Starting cold chain client: ", c.config.Description)
+
+	// an excursion that was active when the client stopped is continued
+	for _, e := range c.config.Events {
+		if e.End == "" {
+			start, err := time.Parse(time.RFC3339Nano, e.Start)
+			if err != nil {
+				log.Printf("Cold chain %v: invalid event start: %v\n",
+					c.config.Description, err)
+				continue
+			}
+			c.eventID = e.ID
+			c.outside = e.LimitType
+			c.outsideStart = start
+			c.peak = e.Peak
+		}
+	}
+
+	c.sendUnsigned()
+	c.subscribeTemp()
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+done:
+	for {
+		select {
+		case <-c.stop:
+			log.Println("Stopping cold chain client: ", c.config.Description)
+			break done
+		case <-ticker.C:
+			// the excursion delay may expire between readings
+			c.checkDelay(time.Now())
+		case p := <-c.newTemp:
+			if p.Time.IsZero() {
+				p.Time = time.Now()
+			}
+			c.update(p.Value, p.Time)
+		case pts := <-c.newPoints:
+			err := data.MergePoints(pts.ID, pts.Points, &c.config)
+			if err != nil {
+				log.Println("error merging new points: ", err)
+			}
+
+			if pts.ID != c.config.ID {
+				c.signOff(pts.ID, pts.Points)
+				continue
+			}
+
+			for _, p := range pts.Points {
+				switch p.Type {
+				case data.PointTypeTempNodeID, data.PointTypeTempPointType:
+					c.subscribeTemp()
+				}
+			}
+		case pts := <-c.newEdgePoints:
+			err := data.MergeEdgePoints(pts.ID, pts.Parent, pts.Points, &c.config)
+			if err != nil {
+				log.Println("error merging new points: ", err)
+			}
+		}
+	}
+
+	if c.tempSub != nil {
+		c.tempSub.Unsubscribe()
+	}
+
+	return nil
+}
+
+// update processes a temperature reading
+func (c *ColdChainClient) update(temp float64, ts time.Time) {
+	if c.config.Disable {
+		return
+	}
+
+	limit := coldChainLimit(&c.config, temp)
+
+	if limit != c.outside {
+		c.endEvent(ts)
+		c.outside = limit
+		c.outsideStart = ts
+		c.peak = temp
+	}
+
+	if limit == "" {
+		return
+	}
+
+	if (limit == data.PointValueHigh && temp > c.peak) ||
+		(limit == data.PointValueLow && temp < c.peak) {
+		c.peak = temp
+		if c.eventID != "" {
+			c.sendEventPoints(c.eventID, data.Points{
+				{Type: data.PointTypePeak, Value: temp}})
+		}
+	}
+
+	c.checkDelay(ts)
+}
+
+// checkDelay logs an event once the temperature has been outside the limits
+// for the excursion delay
+func (c *ColdChainClient) checkDelay(now time.Time) {
+	if c.outside == "" || c.eventID != "" || c.config.Disable {
+		return
+	}
+
+	delay := time.Duration(c.config.ExcursionDelay * float64(time.Minute))
+	if now.Sub(c.outsideStart) < delay {
+		return
+	}
+
+	limit := c.config.HighLimit
+	desc := "High temperature excursion"
+	if c.outside == data.PointValueLow {
+		limit = c.config.LowLimit
+		desc = "Low temperature excursion"
+	}
+
+	e := ColdChainEvent{
+		ID:          uuid.New().String(),
+		Parent:      c.config.ID,
+		Description: desc,
+		Start:       c.outsideStart.Format(time.RFC3339Nano),
+		LimitType:   c.outside,
+		Limit:       limit,
+		Peak:        c.peak,
+	}
+
+	// no origin so that the manager does not restart this client
+	err := SendNodeType(c.nc, e, "")
+	if err != nil {
+		log.Printf("Cold chain %v: error creating event: %v\n",
+			c.config.Description, err)
+		return
+	}
+
+	log.Printf("Cold chain %v: %v, peak %v\n", c.config.Description, desc, c.peak)
+
+	c.eventID = e.ID
+	c.config.Events = append(c.config.Events, e)
+	c.sendState(true)
+	c.sendUnsigned()
+}
+
+// endEvent records the end of the active excursion, if there is one
+func (c *ColdChainClient) endEvent(now time.Time) {
+	if c.eventID == "" {
+		return
+	}
+
+	end := now.Format(time.RFC3339Nano)
+	duration := now.Sub(c.outsideStart).Minutes()
+
+	c.sendEventPoints(c.eventID, data.Points{
+		{Type: data.PointTypeEnd, Text: end},
+		{Type: data.PointTypeDuration, Value: duration},
+	})
+
+	for i := range c.config.Events {
+		if c.config.Events[i].ID == c.eventID {
+			c.config.Events[i].End = end
+			c.config.Events[i].Duration = duration
+		}
+	}
+
+	c.eventID = ""
+	c.sendState(false)
+}
+
+// signOff records who signed off an event and when. The sign-off is only
+// recorded once, so it can't be changed later.
+func (c *ColdChainClient) signOff(eventID string, points data.Points) {
+	for i := range c.config.Events {
+		e := &c.config.Events[i]
+		if e.ID != eventID {
+			continue
+		}
+
+		for _, p := range points {
+			if p.Type != data.PointTypeSignOff || p.Value == 0 || e.SignOffBy != "" {
+				continue
+			}
+
+			ts := p.Time
+			if ts.IsZero() {
+				ts = time.Now()
+			}
+
+			e.SignOffBy = p.Origin
+			e.SignOffTime = ts.Format(time.RFC3339Nano)
+
+			c.sendEventPoints(e.ID, data.Points{
+				{Type: data.PointTypeSignOffBy, Text: e.SignOffBy},
+				{Type: data.PointTypeSignOffTime, Text: e.SignOffTime},
+			})
+		}
+	}
+
+	c.sendUnsigned()
+}
+
+func (c *ColdChainClient) sendEventPoints(eventID string, points data.Points) {
+	now := time.Now()
+	for i := range points {
+		points[i].Time = now
+	}
+
+	err := SendNodePoints(c.nc, eventID, points, false)
+	if err != nil {
+		log.Printf("Cold chain %v: error updating event: %v\n",
+			c.config.Description, err)
+	}
+}
+
+func (c *ColdChainClient) sendState(excursion bool) {
+	if excursion == c.config.Excursion {
+		return
+	}
+
+	c.config.Excursion = excursion
+
+	err := SendNodePoint(c.nc, c.config.ID, data.Point{
+		Time:  time.Now(),
+		Type:  data.PointTypeExcursion,
+		Value: data.BoolToFloat(excursion),
+	}, false)
+	if err != nil {
+		log.Println("Cold chain: error sending state: ", err)
+	}
+}
+
+// sendUnsigned sends the number of events that are not signed off
+func (c *ColdChainClient) sendUnsigned() {
+	unsigned := 0
+	for _, e := range c.config.Events {
+		if !e.SignOff {
+			unsigned++
+		}
+	}
+
+	if unsigned == c.config.Unsigned {
+		return
+	}
+
+	c.config.Unsigned = unsigned
+
+	err := SendNodePoint(c.nc, c.config.ID, data.Point{
+		Time:  time.Now(),
+		Type:  data.PointTypeUnsigned,
+		Value: float64(unsigned),
+	}, false)
+	if err != nil {
+		log.Println("Cold chain: error sending unsigned count: ", err)
+	}
+}
+
+// subscribeTemp subscribes to the temperature point and gets its current
+// value
+func (c *ColdChainClient) subscribeTemp() {
+	if c.tempSub != nil {
+		c.tempSub.Unsubscribe()
+		c.tempSub = nil
+	}
+
+	if c.config.TempNodeID == "" {
+		return
+	}
+
+	pointType := c.config.TempPointType
+	if pointType == "" {
+		pointType = data.PointTypeValue
+	}
+
+	var err error
+	c.tempSub, err = c.nc.Subscribe(SubjectNodePoints(c.config.TempNodeID), func(msg *nats.Msg) {
+		points, err := DecodePoints(msg)
+		if err != nil {
+			log.Println("Cold chain: error decoding temperature points: ", err)
+			return
+		}
+
+		for _, p := range points {
+			if p.Type == pointType {
+				select {
+				case c.newTemp <- p:
+				case <-c.stop:
+				}
+			}
+		}
+	})
+	if err != nil {
+		log.Printf("Cold chain %v: error subscribing to temperature: %v\n",
+			c.config.Description, err)
+	}
+
+	nodes, err := GetNode(c.nc, c.config.TempNodeID, "none")
+	if err != nil || len(nodes) < 1 {
+		log.Printf("Cold chain %v: error getting temperature: %v\n",
+			c.config.Description, err)
+		return
+	}
+
+	if p, ok := nodes[0].Points.Find(pointType, ""); ok {
+		c.update(p.Value, time.Now())
+	}
+}
+
+// Stop sends a signal to the Start function to exit
+func (c *ColdChainClient) Stop(err error) {
+	close(c.stop)
+}
+
+// Points is called by the Manager when new points for this
+// node are received.
+func (c *ColdChainClient) Points(nodeID string, points []data.Point) {
+	c.newPoints <- NewPoints{nodeID, "", points}
+}
+
+// EdgePoints is called by the Manager when new edge points for this
+// node are received.
+func (c *ColdChainClient) EdgePoints(nodeID, parentID string, points []data.Point) {
+	c.newEdgePoints <- NewPoints{nodeID, parentID, points}
+}
+
+// GetColdChainEvents returns the events logged by a cold chain node sorted
+// by start time
+func GetColdChainEvents(nc *nats.Conn, id string) ([]ColdChainEvent, error) {
+	events, err := GetNodeChildrenType[ColdChainEvent](nc, id)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Start < events[j].Start
+	})
+
+	return events, nil
+}
+
+// WriteColdChainCSV writes events as a CSV audit record with one row per
+// event
+func WriteColdChainCSV(w io.Writer, events []ColdChainEvent) error {
+	cw := csv.NewWriter(w)
+
+	err := cw.Write([]string{"id", "description", "start", "end", "duration",
+		"limitType", "limit", "peak", "signOff", "signOffBy", "signOffTime",
+		"comment"})
+	if err != nil {
+		return err
+	}
+
+	f := func(v float64) string {
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+
+	for _, e := range events {
+		err := cw.Write([]string{e.ID, e.Description, e.Start, e.End,
+			f(e.Duration), e.LimitType, f(e.Limit), f(e.Peak),
+			strconv.FormatBool(e.SignOff), e.SignOffBy, e.SignOffTime,
+			e.Comment})
+		if err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+
+	if err := cw.Error(); err != nil {
+		return fmt.Errorf("Error writing CSV: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,137 @@
+package client_test
+
+import (
+	"bytes"
+	"encoding/csv"
+	"testing"
+	"time"
+
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+	"github.com/simpleiot/simpleiot/server"
+)
+
+func TestColdChain(t *testing.T) {
+	nc, root, stop, err := server.TestServer()
+	if err != nil {
+		t.Fatal("Error starting test server: ", err)
+	}
+	defer stop()
+
+	err = client.SendNodeType(nc, client.Variable{ID: "temp", Parent: root.ID}, "test")
+	if err != nil {
+		t.Fatal("Error sending variable node: ", err)
+	}
+
+	sendTemp := func(v float64) {
+		t.Helper()
+		err := client.SendNodePoint(nc, "temp", data.Point{Type: data.PointTypeValue,
+			Value: v, Origin: "test"}, true)
+		if err != nil {
+			t.Fatal("Error sending point: ", err)
+		}
+	}
+
+	sendTemp(5)
+
+	err = client.SendNodeType(nc, client.ColdChain{
+		ID:             "cc",
+		Parent:         root.ID,
+		Description:    "vaccine fridge",
+		TempNodeID:     "temp",
+		LowLimit:       2,
+		HighLimit:      8,
+		ExcursionDelay: 0.01,
+	}, "test")
+	if err != nil {
+		t.Fatal("Error sending cold chain node: ", err)
+	}
+
+	getEvents := func(check func([]client.ColdChainEvent) bool) []client.ColdChainEvent {
+		t.Helper()
+		timeout := time.After(5 * time.Second)
+		for {
+			events, err := client.GetColdChainEvents(nc, "cc")
+			if err != nil {
+				t.Fatal("Error getting events: ", err)
+			}
+
+			if check(events) {
+				return events
+			}
+
+			select {
+			case <-timeout:
+				t.Fatalf("Timeout waiting for events, got: %+v", events)
+			case <-time.After(50 * time.Millisecond):
+			}
+		}
+	}
+
+	// excursions shorter than the delay are not logged
+	sendTemp(9)
+	sendTemp(5)
+	time.Sleep(time.Second)
+
+	events, err := client.GetColdChainEvents(nc, "cc")
+	if err != nil {
+		t.Fatal("Error getting events: ", err)
+	}
+
+	if len(events) != 0 {
+		t.Fatal("Short excursion was logged: ", events)
+	}
+
+	sendTemp(9)
+	waitPointValue(t, nc, "cc", data.PointTypeExcursion, 1)
+	waitPointValue(t, nc, "cc", data.PointTypeUnsigned, 1)
+
+	sendTemp(11)
+	sendTemp(10)
+	sendTemp(4)
+	waitPointValue(t, nc, "cc", data.PointTypeExcursion, 0)
+
+	events = getEvents(func(events []client.ColdChainEvent) bool {
+		return len(events) == 1 && events[0].End != ""
+	})
+
+	e := events[0]
+	if e.LimitType != data.PointValueHigh || e.Limit != 8 || e.Peak != 11 {
+		t.Errorf("Event not correct: %+v", e)
+	}
+
+	if e.Duration <= 0.01 {
+		t.Error("Event duration not correct: ", e.Duration)
+	}
+
+	err = client.SendNodePoint(nc, e.ID, data.Point{Type: data.PointTypeSignOff,
+		Value: 1, Origin: "operator"}, true)
+	if err != nil {
+		t.Fatal("Error signing off event: ", err)
+	}
+
+	waitPointValue(t, nc, "cc", data.PointTypeUnsigned, 0)
+
+	events = getEvents(func(events []client.ColdChainEvent) bool {
+		return len(events) == 1 && events[0].SignOffBy != ""
+	})
+
+	if events[0].SignOffBy != "operator" || events[0].SignOffTime == "" {
+		t.Errorf("Sign off not recorded: %+v", events[0])
+	}
+
+	var buf bytes.Buffer
+	err = client.WriteColdChainCSV(&buf, events)
+	if err != nil {
+		t.Fatal("Error writing CSV: ", err)
+	}
+
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal("Error reading CSV: ", err)
+	}
+
+	if len(rows) != 2 || rows[1][0] != e.ID || rows[1][9] != "operator" {
+		t.Error("CSV not correct: ", rows)
+	}
+}
@@ -0,0 +1,92 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// ErrCommandTimeout is returned by SendCommand if the command times out
+var ErrCommandTimeout = errors.New("command timeout")
+
+// SendCommand writes a command point (a point with a type in the
+// commandPointTypes policy of the root node) and waits for the client of
+// the node to confirm it. p.Origin must be set to the node sending the
+// command. nil is returned if the command succeeds, the error from the
+// client if it fails, and ErrCommandTimeout if the command is not confirmed
+// by the store timeout or the timeout passed in.
+func SendCommand(nc *nats.Conn, nodeID string, p data.Point, timeout time.Duration) error {
+	if p.Origin == "" {
+		return errors.New("command origin must be set")
+	}
+
+	key := data.CommandKey(p)
+	start := time.Now()
+
+	result := make(chan error, 1)
+
+	// points are published on up.<nodeID>.<nodeID>.points after the store
+	// writes them, so unconfirmed states are not seen
+	sub, err := nc.Subscribe(fmt.Sprintf("up.%v.%v.points", nodeID, nodeID), func(msg *nats.Msg) {
+		ps, err := DecodePoints(msg)
+		if err != nil {
+			log.Println("Error decoding command points: ", err)
+			return
+		}
+
+		state, ok := ps.Find(data.PointTypeCommandState, key)
+		if !ok || !data.CommandDone(state.Text) || state.Time.Before(start) {
+			return
+		}
+
+		errText, _ := ps.Text(data.PointTypeCommandError, key)
+
+		switch state.Text {
+		case data.PointValueFail:
+			err = fmt.Errorf("command failed: %v", errText)
+		case data.PointValueTimeout:
+			err = ErrCommandTimeout
+		}
+
+		select {
+		case result <- err:
+		default:
+		}
+	})
+	if err != nil {
+		return err
+	}
+	defer sub.Unsubscribe()
+
+	err = SendNodePoint(nc, nodeID, p, true)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case err := <-result:
+		return err
+	case <-time.After(timeout):
+		return ErrCommandTimeout
+	}
+}
+
+// ConfirmCommand is called by the client of a node after it acts on a
+// command point. cmdErr is nil if the command succeeded. Clients can
+// confirm every write of a command point type, the store drops
+// confirmations of commands that are not pending.
+func ConfirmCommand(nc *nats.Conn, nodeID string, p data.Point, cmdErr error) error {
+	state := data.PointValueSuccess
+	errText := ""
+	if cmdErr != nil {
+		state = data.PointValueFail
+		errText = cmdErr.Error()
+	}
+
+	return SendNodePoints(nc, nodeID,
+		data.CommandStatePoints(data.CommandKey(p), state, errText), true)
+}
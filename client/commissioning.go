@@ -0,0 +1,559 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// Commissioning tracks the checks an installer runs when a site is
+// commissioned. Setting Run runs all automatic checks, and Passed and Failed
+// are the number of checks with that result. Setting SignOff signs off the
+// commissioning if every check has passed and a Technician is entered: a
+// text Report of the checks is generated and the user that signed off
+// (SignOffBy) and the time (SignOffTime, RFC3339) are recorded. Otherwise
+// SignOff is cleared and Detail says why. If a check result changes after
+// sign off, the sign off is cleared.
+type Commissioning struct {
+	ID          string               `node:"id"`
+	Parent      string               `node:"parent"`
+	Description string               `point:"description"`
+	Technician  string               `point:"technician"`
+	Run         bool                 `point:"run"`
+	SignOff     bool                 `point:"signOff"`
+	SignOffBy   string               `point:"signOffBy"`
+	SignOffTime string               `point:"signOffTime"`
+	Report      string               `point:"report"`
+	Detail      string               `point:"detail"`
+	Passed      int                  `point:"passed"`
+	Failed      int                  `point:"failed"`
+	Disable     bool                 `point:"disable"`
+	Checks      []CommissioningCheck `child:"commissioningCheck"`
+}
+
+// CommissioningCheck is a check of a commissioning node. Setting Run runs
+// the check, and Result (pass or fail), ResultTime (RFC3339), and Detail are
+// set when it completes. The CheckType is one of:
+//
+//   - sensor: the PointType (defaults to value) point of NodeID must exist,
+//     be within LowLimit and HighLimit (if HighLimit is greater than
+//     LowLimit), and if MaxAge is set, be updated within MaxAge seconds.
+//   - output: the PointType (defaults to value) point of NodeID is toggled
+//     and the FeedbackPointType (defaults to value) point of FeedbackNodeID
+//     (defaults to NodeID) must follow within FeedbackTimeout seconds
+//     (defaults to 10). The output is then set back to its original value.
+//   - sync: NodeID is an upstream node. A test point is written to the
+//     check node and must be read back from the upstream server within
+//     FeedbackTimeout seconds (defaults to 10).
+//   - manual: the installer sets the Result.
+type CommissioningCheck struct {
+	ID                string  `node:"id"`
+	Parent            string  `node:"parent"`
+	Description       string  `point:"description"`
+	CheckType         string  `point:"checkType"`
+	NodeID            string  `point:"nodeID"`
+	PointType         string  `point:"pointType"`
+	LowLimit          float64 `point:"lowLimit"`
+	HighLimit         float64 `point:"highLimit"`
+	MaxAge            float64 `point:"maxAge"`
+	FeedbackNodeID    string  `point:"feedbackNodeID"`
+	FeedbackPointType string  `point:"feedbackPointType"`
+	FeedbackTimeout   float64 `point:"feedbackTimeout"`
+	Run               bool    `point:"run"`
+	Result            string  `point:"result"`
+	ResultTime        string  `point:"resultTime"`
+	Detail            string  `point:"detail"`
+}
+
+func (c *CommissioningCheck) pointType() string {
+	if c.PointType == "" {
+		return data.PointTypeValue
+	}
+	return c.PointType
+}
+
+func (c *CommissioningCheck) timeout() time.Duration {
+	if c.FeedbackTimeout <= 0 {
+		return 10 * time.Second
+	}
+	return time.Duration(c.FeedbackTimeout * float64(time.Second))
+}
+
+// commissioningResult is the result of running a check
+type commissioningResult struct {
+	id     string
+	pass   bool
+	detail string
+}
+
+// how often output and sync checks poll for feedback
+var commissioningPollPeriod = 100 * time.Millisecond
+
+// CommissioningClient is a SIOT client that runs commissioning nodes
+type CommissioningClient struct {
+	nc            *nats.Conn
+	config        Commissioning
+	stop          chan struct{}
+	newPoints     chan NewPoints
+	newEdgePoints chan NewPoints
+	results       chan commissioningResult
+	// IDs of checks that are running
+	running map[string]bool
+}
+
+// NewCommissioningClient ...
+func NewCommissioningClient(nc *nats.Conn, config Commissioning) Client {
+	return &CommissioningClient{
+		nc:            nc,
+		config:        config,
+		stop:          make(chan struct{}),
+		newPoints:     make(chan NewPoints),
+		newEdgePoints: make(chan NewPoints),
+		results:       make(chan commissioningResult),
+		running:       make(map[string]bool),
+	}
+}
+
+// Start runs the main logic for this client and blocks until stopped
+func (c *CommissioningClient) Start() error {
+	log.Println("Starting commissioning client: ", c.config.Description)
+
+done:
+	for {
+		select {
+		case <-c.stop:
+			log.Println("Stopping commissioning client: ", c.config.Description)
+			break done
+		case r := <-c.results:
+			delete(c.running, r.id)
+			c.setResult(r, time.Now())
+		case pts := <-c.newPoints:
+			err := data.MergePoints(pts.ID, pts.Points, &c.config)
+			if err != nil {
+				log.Println("error merging new points: ", err)
+			}
+
+			if pts.ID != c.config.ID {
+				c.checkPoints(pts.ID, pts.Points)
+				continue
+			}
+
+			for _, p := range pts.Points {
+				switch p.Type {
+				case data.PointTypeRun:
+					if p.Value != 0 {
+						c.runAll()
+					}
+				case data.PointTypeSignOff:
+					if p.Value != 0 {
+						c.signOff(p.Origin, time.Now())
+					}
+				}
+			}
+		case pts := <-c.newEdgePoints:
+			err := data.MergeEdgePoints(pts.ID, pts.Parent, pts.Points, &c.config)
+			if err != nil {
+				log.Println("error merging new points: ", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// checkPoints handles points from the user for a check node
+func (c *CommissioningClient) checkPoints(id string, points data.Points) {
+	for _, p := range points {
+		switch p.Type {
+		case data.PointTypeRun:
+			if p.Value == 0 {
+				continue
+			}
+
+			c.send(id, data.Points{{Time: time.Now(), Type: data.PointTypeRun, Value: 0}})
+
+			if check := c.check(id); check != nil {
+				check.Run = false
+				c.run(check)
+			}
+		case data.PointTypeResult:
+			// result entered by the installer
+			now := time.Now()
+			check := c.check(id)
+			if check == nil {
+				continue
+			}
+
+			check.ResultTime = now.Format(time.RFC3339)
+			c.send(id, data.Points{{Time: now, Type: data.PointTypeResultTime,
+				Text: check.ResultTime}})
+			c.resultsChanged(now)
+		}
+	}
+}
+
+func (c *CommissioningClient) check(id string) *CommissioningCheck {
+	for i := range c.config.Checks {
+		if c.config.Checks[i].ID == id {
+			return &c.config.Checks[i]
+		}
+	}
+	return nil
+}
+
+// runAll runs all checks that are not manual
+func (c *CommissioningClient) runAll() {
+	c.config.Run = false
+	c.send(c.config.ID, data.Points{{Time: time.Now(), Type: data.PointTypeRun, Value: 0}})
+
+	for i := range c.config.Checks {
+		c.run(&c.config.Checks[i])
+	}
+}
+
+// run starts a check in a goroutine. The result is sent to the results
+// channel.
+func (c *CommissioningClient) run(check *CommissioningCheck) {
+	if c.config.Disable || check.CheckType == data.PointValueManual ||
+		c.running[check.ID] {
+		return
+	}
+
+	c.running[check.ID] = true
+	cfg := *check
+	origin := c.config.ID
+
+	go func() {
+		r := commissioningResult{id: cfg.ID}
+
+		var err error
+		switch cfg.CheckType {
+		case data.PointValueSensor:
+			r.detail, err = c.sensorCheck(&cfg, time.Now())
+		case data.PointValueOutput:
+			r.detail, err = c.outputCheck(&cfg, origin)
+		case data.PointValueSync:
+			r.detail, err = c.syncCheck(&cfg)
+		default:
+			err = fmt.Errorf("unknown check type: %v", cfg.CheckType)
+		}
+
+		r.pass = err == nil
+		if err != nil {
+			r.detail = err.Error()
+		}
+
+		select {
+		case c.results <- r:
+		case <-c.stop:
+		}
+	}()
+}
+
+// sensorCheck checks that a sensor reads a plausible value
+func (c *CommissioningClient) sensorCheck(check *CommissioningCheck, now time.Time) (string, error) {
+	p, err := c.readPoint(c.nc, check.NodeID, check.pointType())
+	if err != nil {
+		return "", err
+	}
+
+	if check.MaxAge > 0 {
+		age := now.Sub(p.Time)
+		if age > time.Duration(check.MaxAge*float64(time.Second)) {
+			return "", fmt.Errorf("%v not updated for %v", p.Type,
+				age.Round(time.Second))
+		}
+	}
+
+	v := strconv.FormatFloat(p.Value, 'f', -1, 64)
+
+	if check.HighLimit > check.LowLimit &&
+		(p.Value < check.LowLimit || p.Value > check.HighLimit) {
+		return "", fmt.Errorf("%v is %v, outside %v to %v", p.Type, v,
+			check.LowLimit, check.HighLimit)
+	}
+
+	return fmt.Sprintf("%v is %v", p.Type, v), nil
+}
+
+// outputCheck toggles an output and waits for the feedback to follow
+func (c *CommissioningClient) outputCheck(check *CommissioningCheck, origin string) (string, error) {
+	if check.NodeID == "" {
+		return "", errors.New("node is not set")
+	}
+
+	// an output that has never been set is off
+	p, _ := c.readPoint(c.nc, check.NodeID, check.pointType())
+	original := p.Value
+	toggled := data.BoolToFloat(original == 0)
+
+	write := func(v float64) error {
+		return SendNodePoint(c.nc, check.NodeID, data.Point{
+			Time:   time.Now(),
+			Type:   check.pointType(),
+			Value:  v,
+			Origin: origin,
+		}, true)
+	}
+
+	err := write(toggled)
+	if err != nil {
+		return "", fmt.Errorf("error writing output: %v", err)
+	}
+
+	defer func() {
+		err := write(original)
+		if err != nil {
+			log.Printf("Commissioning check %v: error restoring output: %v\n",
+				check.Description, err)
+		}
+	}()
+
+	feedbackID := check.FeedbackNodeID
+	if feedbackID == "" {
+		feedbackID = check.NodeID
+	}
+
+	feedbackType := check.FeedbackPointType
+	if feedbackType == "" {
+		feedbackType = data.PointTypeValue
+	}
+
+	start := time.Now()
+	err = c.poll(c.nc, feedbackID, feedbackType, toggled, check.timeout())
+	if err != nil {
+		return "", fmt.Errorf("feedback did not follow output: %v", err)
+	}
+
+	return fmt.Sprintf("feedback followed output in %v",
+		time.Since(start).Round(time.Millisecond)), nil
+}
+
+// syncCheck writes a test point to the check node and waits for it to show
+// up on the upstream server
+func (c *CommissioningClient) syncCheck(check *CommissioningCheck) (string, error) {
+	nodes, err := GetNode(c.nc, check.NodeID, "")
+	if err != nil || len(nodes) <= 0 {
+		return "", fmt.Errorf("upstream node %v not found", check.NodeID)
+	}
+
+	uri, _ := nodes[0].Points.Text(data.PointTypeURI, "")
+	token, _ := nodes[0].Points.Text(data.PointTypeAuthToken, "")
+
+	if uri == "" {
+		return "", errors.New("upstream URI is not set")
+	}
+
+	ncUp, err := nats.Connect(uri, nats.Token(token), nats.Timeout(check.timeout()))
+	if err != nil {
+		return "", fmt.Errorf("error connecting to upstream: %v", err)
+	}
+	defer ncUp.Close()
+
+	start := time.Now()
+	test := float64(start.UnixMilli())
+
+	err = SendNodePoint(c.nc, check.ID, data.Point{Time: start,
+		Type: data.PointTypeValue, Value: test}, true)
+	if err != nil {
+		return "", fmt.Errorf("error writing test point: %v", err)
+	}
+
+	err = c.poll(ncUp, check.ID, data.PointTypeValue, test, check.timeout())
+	if err != nil {
+		return "", fmt.Errorf("test point not synchronized: %v", err)
+	}
+
+	return fmt.Sprintf("synchronized in %v", time.Since(start).Round(time.Millisecond)), nil
+}
+
+func (c *CommissioningClient) readPoint(nc *nats.Conn, id, typ string) (data.Point, error) {
+	if id == "" {
+		return data.Point{}, errors.New("node is not set")
+	}
+
+	nodes, err := GetNode(nc, id, "")
+	if err != nil || len(nodes) <= 0 {
+		return data.Point{}, fmt.Errorf("node %v not found", id)
+	}
+
+	p, ok := nodes[0].Points.Find(typ, "")
+	if !ok {
+		return data.Point{}, fmt.Errorf("node does not have a %v point", typ)
+	}
+
+	return p, nil
+}
+
+// poll waits for a point to have value
+func (c *CommissioningClient) poll(nc *nats.Conn, id, typ string, value float64, timeout time.Duration) error {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	var cur string
+	for {
+		p, err := c.readPoint(nc, id, typ)
+		if err == nil && p.Value == value {
+			return nil
+		}
+
+		if err != nil {
+			cur = err.Error()
+		} else {
+			cur = strconv.FormatFloat(p.Value, 'f', -1, 64)
+		}
+
+		select {
+		case <-deadline.C:
+			return fmt.Errorf("timeout after %v (%v)", timeout, cur)
+		case <-c.stop:
+			return errors.New("client stopped")
+		case <-time.After(commissioningPollPeriod):
+		}
+	}
+}
+
+// setResult records the result of a check
+func (c *CommissioningClient) setResult(r commissioningResult, now time.Time) {
+	check := c.check(r.id)
+	if check == nil {
+		// check was deleted while running
+		return
+	}
+
+	check.Result = data.PointValueFail
+	if r.pass {
+		check.Result = data.PointValuePass
+	}
+	check.ResultTime = now.Format(time.RFC3339)
+	check.Detail = r.detail
+
+	c.send(check.ID, data.Points{
+		{Time: now, Type: data.PointTypeResult, Text: check.Result},
+		{Time: now, Type: data.PointTypeResultTime, Text: check.ResultTime},
+		{Time: now, Type: data.PointTypeDetail, Text: check.Detail},
+	})
+
+	c.resultsChanged(now)
+}
+
+// resultsChanged updates the summary and clears the sign off
+func (c *CommissioningClient) resultsChanged(now time.Time) {
+	passed, failed := 0, 0
+	for _, check := range c.config.Checks {
+		switch check.Result {
+		case data.PointValuePass:
+			passed++
+		case data.PointValueFail:
+			failed++
+		}
+	}
+
+	c.config.Passed = passed
+	c.config.Failed = failed
+
+	pts := data.Points{
+		{Time: now, Type: data.PointTypePassed, Value: float64(passed)},
+		{Time: now, Type: data.PointTypeFailed, Value: float64(failed)},
+	}
+
+	if c.config.SignOff {
+		c.config.SignOff = false
+		c.config.Detail = "results changed after sign off"
+		pts = append(pts,
+			data.Point{Time: now, Type: data.PointTypeSignOff, Value: 0},
+			data.Point{Time: now, Type: data.PointTypeDetail, Text: c.config.Detail})
+	}
+
+	c.send(c.config.ID, pts)
+}
+
+// signOff signs off the commissioning if all checks have passed
+func (c *CommissioningClient) signOff(user string, now time.Time) {
+	var reason string
+	pending := len(c.config.Checks) - c.config.Passed - c.config.Failed
+
+	switch {
+	case len(c.config.Checks) <= 0:
+		reason = "no checks"
+	case c.config.Failed > 0 || pending > 0:
+		reason = fmt.Sprintf("%v checks failed, %v not run", c.config.Failed, pending)
+	case c.config.Technician == "":
+		reason = "technician is not set"
+	}
+
+	if reason != "" {
+		c.config.SignOff = false
+		c.config.Detail = "cannot sign off: " + reason
+		c.send(c.config.ID, data.Points{
+			{Time: now, Type: data.PointTypeSignOff, Value: 0},
+			{Time: now, Type: data.PointTypeDetail, Text: c.config.Detail},
+		})
+		return
+	}
+
+	c.config.SignOffBy = user
+	c.config.SignOffTime = now.Format(time.RFC3339)
+	c.config.Report = commissioningReport(&c.config)
+	c.config.Detail = ""
+
+	c.send(c.config.ID, data.Points{
+		{Time: now, Type: data.PointTypeSignOffBy, Text: c.config.SignOffBy},
+		{Time: now, Type: data.PointTypeSignOffTime, Text: c.config.SignOffTime},
+		{Time: now, Type: data.PointTypeReport, Text: c.config.Report},
+		{Time: now, Type: data.PointTypeDetail, Text: ""},
+	})
+}
+
+// commissioningReport returns a text report of a signed off commissioning
+func commissioningReport(c *Commissioning) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "Commissioning report: %v\n", c.Description)
+	fmt.Fprintf(&b, "Technician: %v\n", c.Technician)
+	fmt.Fprintf(&b, "Signed off by: %v\n", c.SignOffBy)
+	fmt.Fprintf(&b, "Signed off at: %v\n", c.SignOffTime)
+	fmt.Fprintf(&b, "Checks passed: %v of %v\n\n", c.Passed, len(c.Checks))
+
+	for _, check := range c.Checks {
+		fmt.Fprintf(&b, "%v [%v] %v, %v", strings.ToUpper(check.Result),
+			check.CheckType, check.Description, check.ResultTime)
+		if check.Detail != "" {
+			fmt.Fprintf(&b, ": %v", check.Detail)
+		}
+		b.WriteString("\n")
+	}
+
+	return b.String()
+}
+
+func (c *CommissioningClient) send(id string, points data.Points) {
+	err := SendNodePoints(c.nc, id, points, false)
+	if err != nil {
+		log.Printf("Commissioning %v: error sending points: %v\n",
+			c.config.Description, err)
+	}
+}
+
+// Stop sends a signal to the Start function to exit
+func (c *CommissioningClient) Stop(err error) {
+	close(c.stop)
+}
+
+// Points is called by the Manager when new points for this
+// node are received.
+func (c *CommissioningClient) Points(nodeID string, points []data.Point) {
+	c.newPoints <- NewPoints{nodeID, "", points}
+}
+
+// EdgePoints is called by the Manager when new edge points for this
+// node are received.
+func (c *CommissioningClient) EdgePoints(nodeID, parentID string, points []data.Point) {
+	c.newEdgePoints <- NewPoints{nodeID, parentID, points}
+}
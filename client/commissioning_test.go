@@ -0,0 +1,142 @@
+package client_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+	"github.com/simpleiot/simpleiot/server"
+)
+
+func TestCommissioning(t *testing.T) {
+	nc, root, stop, err := server.TestServer()
+	if err != nil {
+		t.Fatal("Error starting test server: ", err)
+	}
+	defer stop()
+
+	for _, v := range []client.Variable{
+		{ID: "temp", Parent: root.ID, Value: 21.5},
+		{ID: "relay", Parent: root.ID},
+	} {
+		err = client.SendNodeType(nc, v, "test")
+		if err != nil {
+			t.Fatal("Error sending variable node: ", err)
+		}
+	}
+
+	err = client.SendNodeType(nc, client.Commissioning{
+		ID:          "comm",
+		Parent:      root.ID,
+		Description: "pump station",
+	}, "test")
+	if err != nil {
+		t.Fatal("Error sending commissioning node: ", err)
+	}
+
+	for _, c := range []client.CommissioningCheck{
+		{ID: "tempOk", Parent: "comm", Description: "temp plausible",
+			CheckType: data.PointValueSensor, NodeID: "temp", HighLimit: 50},
+		{ID: "tempHigh", Parent: "comm", Description: "temp high",
+			CheckType: data.PointValueSensor, NodeID: "temp", LowLimit: 30, HighLimit: 50},
+		{ID: "relayToggle", Parent: "comm", Description: "relay toggles",
+			CheckType: data.PointValueOutput, NodeID: "relay", FeedbackTimeout: 2},
+		{ID: "labels", Parent: "comm", Description: "panel labels",
+			CheckType: data.PointValueManual},
+	} {
+		err = client.SendNodeType(nc, c, "test")
+		if err != nil {
+			t.Fatal("Error sending check node: ", err)
+		}
+	}
+
+	send := func(id string, p data.Point) {
+		t.Helper()
+		p.Origin = "test"
+		err := client.SendNodePoint(nc, id, p, true)
+		if err != nil {
+			t.Fatal("Error sending point: ", err)
+		}
+	}
+
+	getText := func(id, typ string) string {
+		t.Helper()
+		nodes, err := client.GetNode(nc, id, "none")
+		if err != nil || len(nodes) <= 0 {
+			t.Fatal("Error getting node: ", err)
+		}
+		v, _ := nodes[0].Points.Text(typ, "")
+		return v
+	}
+
+	// run all checks, retrying until the client has started
+	timeout := time.After(5 * time.Second)
+	for {
+		send("comm", data.Point{Type: data.PointTypeRun, Value: 1})
+		time.Sleep(500 * time.Millisecond)
+		if getText("relayToggle", data.PointTypeResult) != "" {
+			break
+		}
+		select {
+		case <-timeout:
+			t.Fatal("Timeout waiting for checks to run")
+		default:
+		}
+	}
+
+	waitPointValue(t, nc, "comm", data.PointTypePassed, 2)
+	waitPointValue(t, nc, "comm", data.PointTypeFailed, 1)
+	waitPointValue(t, nc, "relay", data.PointTypeValue, 0)
+
+	if r := getText("relayToggle", data.PointTypeResult); r != data.PointValuePass {
+		t.Fatalf("Output check %v: %v", r, getText("relayToggle", data.PointTypeDetail))
+	}
+
+	if d := getText("tempHigh", data.PointTypeDetail); !strings.Contains(d, "outside") {
+		t.Error("Wrong sensor check detail: ", d)
+	}
+
+	// can't sign off with a failed check
+	send("comm", data.Point{Type: data.PointTypeSignOff, Value: 1})
+	waitPointValue(t, nc, "comm", data.PointTypeSignOff, 0)
+
+	if d := getText("comm", data.PointTypeDetail); !strings.HasPrefix(d, "cannot sign off") {
+		t.Error("Wrong sign off detail: ", d)
+	}
+
+	// fix the limits, pass the manual check, and sign off
+	send("tempHigh", data.Point{Type: data.PointTypeLowLimit, Value: 0})
+	send("tempHigh", data.Point{Type: data.PointTypeRun, Value: 1})
+	send("labels", data.Point{Type: data.PointTypeResult, Text: data.PointValuePass})
+	send("comm", data.Point{Type: data.PointTypeTechnician, Text: "Pat"})
+
+	waitPointValue(t, nc, "comm", data.PointTypePassed, 4)
+	waitPointValue(t, nc, "comm", data.PointTypeFailed, 0)
+
+	if getText("labels", data.PointTypeResultTime) == "" {
+		t.Error("Manual result time not set")
+	}
+
+	send("comm", data.Point{Type: data.PointTypeSignOff, Value: 1})
+
+	timeout = time.After(5 * time.Second)
+	for getText("comm", data.PointTypeSignOffBy) != "test" {
+		select {
+		case <-timeout:
+			t.Fatal("Timeout waiting for sign off: ", getText("comm", data.PointTypeDetail))
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+
+	report := getText("comm", data.PointTypeReport)
+	if !strings.Contains(report, "Technician: Pat") ||
+		strings.Count(report, "PASS [") != 4 {
+		t.Error("Wrong report: ", report)
+	}
+
+	// a result change clears the sign off
+	send("labels", data.Point{Type: data.PointTypeResult, Text: data.PointValueFail})
+	waitPointValue(t, nc, "comm", data.PointTypeSignOff, 0)
+}
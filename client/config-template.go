@@ -0,0 +1,581 @@
+package client
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// ConfigTemplate reports devices whose configuration has drifted from a
+// golden configuration, and is meant to run on an upstream instance that
+// devices synchronize to. The children of GoldenNodeID are the golden
+// configuration. Devices are the nodes below the parent of the template node
+// with a tag point that matches Tag, and their children are compared to the
+// golden configuration every Period minutes (defaults to 60). Children are
+// matched by node type and description, and the points of the golden nodes
+// are compared, except for IgnorePointTypes (comma separated, defaults to
+// value). Devices is the number of devices compared, and Drifted the number
+// that have drifted. A ConfigDrift child node is kept for each device that
+// has drifted.
+type ConfigTemplate struct {
+	ID               string        `node:"id"`
+	Parent           string        `node:"parent"`
+	Description      string        `point:"description"`
+	GoldenNodeID     string        `point:"goldenNodeID"`
+	Tag              string        `point:"tag"`
+	IgnorePointTypes string        `point:"ignorePointTypes"`
+	Period           float64       `point:"period"`
+	Disable          bool          `point:"disable"`
+	Devices          int           `point:"devices"`
+	Drifted          int           `point:"drifted"`
+	Drifts           []ConfigDrift `child:"configDrift"`
+}
+
+// ConfigDrift is a device whose configuration differs from the golden
+// configuration. Differences lists them one per line, and Count is the number
+// of differences. Start is the RFC3339 time the drift was first detected.
+// Setting Reapply writes the golden point values to the device and creates
+// nodes that are missing from it. Nodes on the device that are not in the
+// golden configuration are not deleted.
+type ConfigDrift struct {
+	ID           string `node:"id"`
+	Parent       string `node:"parent"`
+	Description  string `point:"description"`
+	DeviceNodeID string `point:"deviceNodeID"`
+	Differences  string `point:"differences"`
+	Count        int    `point:"count"`
+	Start        string `point:"start"`
+	Reapply      bool   `point:"reapply"`
+}
+
+// configDiff is a difference between a device and the golden configuration
+type configDiff struct {
+	path string
+	// node on the device to write the point to, or to create the missing
+	// node under
+	nodeID string
+	// golden point that is different, if a point differs
+	point *data.Point
+	got   string
+	// golden node that is missing from the device
+	missing *data.NodeEdgeChildren
+	// node on the device that is not in the golden configuration
+	extra bool
+}
+
+func (d configDiff) String() string {
+	switch {
+	case d.missing != nil:
+		return d.path + ": missing"
+	case d.extra:
+		return d.path + ": not in template"
+	}
+
+	pt := d.point.Type
+	if d.point.Key != "" {
+		pt += "." + d.point.Key
+	}
+
+	return fmt.Sprintf("%v: %v is %v, should be %v", d.path, pt, d.got,
+		configPointString(d.point))
+}
+
+func configPointString(p *data.Point) string {
+	if p == nil {
+		return "not set"
+	}
+
+	if p.Text != "" {
+		return p.Text
+	}
+
+	return strconv.FormatFloat(p.Value, 'f', -1, 64)
+}
+
+func configNodeLabel(n data.NodeEdge) string {
+	desc, _ := n.Points.Text(data.PointTypeDescription, "")
+	if desc == "" {
+		return n.Type
+	}
+	return n.Type + " " + desc
+}
+
+// configCompare compares the children of a device to the children of the
+// golden node
+func configCompare(path string, golden, device data.NodeEdgeChildren, ignore map[string]bool) []configDiff {
+	var ret []configDiff
+
+	key := func(n data.NodeEdge) string {
+		desc, _ := n.Points.Text(data.PointTypeDescription, "")
+		return n.Type + "/" + desc
+	}
+
+	matched := make([]bool, len(device.Children))
+
+	for i := range golden.Children {
+		g := &golden.Children[i]
+		gPath := path + "/" + configNodeLabel(g.NodeEdge)
+
+		var d *data.NodeEdgeChildren
+		for j := range device.Children {
+			if !matched[j] && key(device.Children[j].NodeEdge) == key(g.NodeEdge) {
+				matched[j] = true
+				d = &device.Children[j]
+				break
+			}
+		}
+
+		if d == nil {
+			ret = append(ret, configDiff{path: gPath, nodeID: device.NodeEdge.ID,
+				missing: g})
+			continue
+		}
+
+		for k := range g.NodeEdge.Points {
+			p := &g.NodeEdge.Points[k]
+			if p.Tombstone%2 == 1 || p.Type == data.PointTypeNodeType || ignore[p.Type] {
+				continue
+			}
+
+			dp, ok := d.NodeEdge.Points.Find(p.Type, p.Key)
+			if ok && dp.Tombstone%2 == 0 && dp.Value == p.Value && dp.Text == p.Text {
+				continue
+			}
+
+			got := "not set"
+			if ok && dp.Tombstone%2 == 0 {
+				got = configPointString(&dp)
+			}
+
+			ret = append(ret, configDiff{path: gPath, nodeID: d.NodeEdge.ID,
+				point: p, got: got})
+		}
+
+		ret = append(ret, configCompare(gPath, *g, *d, ignore)...)
+	}
+
+	for j, c := range device.Children {
+		if !matched[j] {
+			ret = append(ret, configDiff{path: path + "/" + configNodeLabel(c.NodeEdge),
+				nodeID: c.NodeEdge.ID, extra: true})
+		}
+	}
+
+	return ret
+}
+
+// ConfigTemplateClient is a SIOT client that runs config template nodes
+type ConfigTemplateClient struct {
+	nc            *nats.Conn
+	config        ConfigTemplate
+	stop          chan struct{}
+	newPoints     chan NewPoints
+	newEdgePoints chan NewPoints
+}
+
+// NewConfigTemplateClient ...
+func NewConfigTemplateClient(nc *nats.Conn, config ConfigTemplate) Client {
+	return &ConfigTemplateClient{
+		nc:            nc,
+		config:        config,
+		stop:          make(chan struct{}),
+		newPoints:     make(chan NewPoints),
+		newEdgePoints: make(chan NewPoints),
+	}
+}
+
+// Start runs the main logic for this client and blocks until stopped
+func (c *ConfigTemplateClient) Start() error {
+	log.Println("Starting config template client: ", c.config.Description)
+
+	ticker := time.NewTicker(c.period())
+	defer ticker.Stop()
+
+	c.check()
+
+done:
+	for {
+		select {
+		case <-c.stop:
+			log.Println("Stopping config template client: ", c.config.Description)
+			break done
+		case <-ticker.C:
+			c.check()
+		case pts := <-c.newPoints:
+			err := data.MergePoints(pts.ID, pts.Points, &c.config)
+			if err != nil {
+				log.Println("error merging new points: ", err)
+			}
+
+			if pts.ID != c.config.ID {
+				for _, p := range pts.Points {
+					if p.Type == data.PointTypeReapply && p.Value != 0 {
+						c.reapply(pts.ID)
+					}
+				}
+				continue
+			}
+
+			for _, p := range pts.Points {
+				switch p.Type {
+				case data.PointTypePeriod:
+					ticker.Reset(c.period())
+				case data.PointTypeGoldenNodeID, data.PointTypeTag,
+					data.PointTypeIgnorePointTypes, data.PointTypeDisable:
+					c.check()
+				}
+			}
+		case pts := <-c.newEdgePoints:
+			err := data.MergeEdgePoints(pts.ID, pts.Parent, pts.Points, &c.config)
+			if err != nil {
+				log.Println("error merging new points: ", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (c *ConfigTemplateClient) period() time.Duration {
+	if c.config.Period <= 0 {
+		return time.Hour
+	}
+	return time.Duration(c.config.Period * float64(time.Minute))
+}
+
+func (c *ConfigTemplateClient) ignore() map[string]bool {
+	ret := make(map[string]bool)
+
+	types := c.config.IgnorePointTypes
+	if types == "" {
+		types = data.PointTypeValue
+	}
+
+	for _, t := range strings.Split(types, ",") {
+		ret[strings.TrimSpace(t)] = true
+	}
+
+	return ret
+}
+
+// tree gets a node and its descendants. path contains the IDs of the nodes
+// above so that loops are not followed.
+func (c *ConfigTemplateClient) tree(n data.NodeEdge, path map[string]bool) (data.NodeEdgeChildren, error) {
+	ret := data.NodeEdgeChildren{NodeEdge: n}
+
+	path[n.ID] = true
+	defer delete(path, n.ID)
+
+	children, err := GetNodeChildren(c.nc, n.ID, "", false, false)
+	if err != nil {
+		return ret, err
+	}
+
+	for _, child := range children {
+		if path[child.ID] {
+			continue
+		}
+
+		t, err := c.tree(child, path)
+		if err != nil {
+			return ret, err
+		}
+
+		ret.Children = append(ret.Children, t)
+	}
+
+	return ret, nil
+}
+
+// devices finds the tagged nodes below the parent of the template
+func (c *ConfigTemplateClient) devices() ([]data.NodeEdge, error) {
+	var ret []data.NodeEdge
+
+	seen := map[string]bool{c.config.ID: true, c.config.GoldenNodeID: true}
+	check := []string{c.config.Parent}
+
+	for len(check) > 0 {
+		id := check[0]
+		check = check[1:]
+
+		children, err := GetNodeChildren(c.nc, id, "", false, false)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, n := range children {
+			if seen[n.ID] {
+				continue
+			}
+			seen[n.ID] = true
+
+			if tag, _ := n.Points.Text(data.PointTypeTag, ""); tag == c.config.Tag {
+				ret = append(ret, n)
+				continue
+			}
+
+			check = append(check, n.ID)
+		}
+	}
+
+	return ret, nil
+}
+
+// golden gets the golden configuration
+func (c *ConfigTemplateClient) golden() (data.NodeEdgeChildren, error) {
+	nodes, err := GetNode(c.nc, c.config.GoldenNodeID, "none")
+	if err != nil {
+		return data.NodeEdgeChildren{}, err
+	}
+
+	if len(nodes) < 1 {
+		return data.NodeEdgeChildren{}, data.ErrDocumentNotFound
+	}
+
+	return c.tree(nodes[0], map[string]bool{})
+}
+
+// check compares all devices to the golden configuration and updates the
+// drift nodes
+func (c *ConfigTemplateClient) check() {
+	if c.config.Disable || c.config.GoldenNodeID == "" || c.config.Tag == "" {
+		return
+	}
+
+	golden, err := c.golden()
+	if err != nil {
+		log.Printf("Config template %v: error getting golden config: %v\n",
+			c.config.Description, err)
+		return
+	}
+
+	devices, err := c.devices()
+	if err != nil {
+		log.Printf("Config template %v: error finding devices: %v\n",
+			c.config.Description, err)
+		return
+	}
+
+	ignore := c.ignore()
+	drifted := make(map[string]bool)
+	now := time.Now()
+
+	for _, dev := range devices {
+		device, err := c.tree(dev, map[string]bool{})
+		if err != nil {
+			log.Printf("Config template %v: error getting device %v: %v\n",
+				c.config.Description, dev.ID, err)
+			continue
+		}
+
+		diffs := configCompare("", golden, device, ignore)
+		if len(diffs) <= 0 {
+			continue
+		}
+
+		drifted[dev.ID] = true
+
+		lines := make([]string, len(diffs))
+		for i, d := range diffs {
+			lines[i] = d.String()
+		}
+
+		c.updateDrift(dev, strings.Join(lines, "\n"), len(diffs), now)
+	}
+
+	// remove drifts for devices that match again
+	var drifts []ConfigDrift
+	for _, d := range c.config.Drifts {
+		if drifted[d.DeviceNodeID] {
+			drifts = append(drifts, d)
+			continue
+		}
+
+		err := DeleteNode(c.nc, d.ID, c.config.ID, "")
+		if err != nil {
+			log.Printf("Config template %v: error deleting drift: %v\n",
+				c.config.Description, err)
+		}
+	}
+	c.config.Drifts = drifts
+
+	if len(devices) != c.config.Devices || len(drifted) != c.config.Drifted {
+		c.config.Devices = len(devices)
+		c.config.Drifted = len(drifted)
+
+		err = SendNodePoints(c.nc, c.config.ID, data.Points{
+			{Time: now, Type: data.PointTypeDevices, Value: float64(len(devices))},
+			{Time: now, Type: data.PointTypeDrifted, Value: float64(len(drifted))},
+		}, false)
+		if err != nil {
+			log.Printf("Config template %v: error sending state: %v\n",
+				c.config.Description, err)
+		}
+	}
+}
+
+// updateDrift creates or updates the drift node for a device
+func (c *ConfigTemplateClient) updateDrift(dev data.NodeEdge, differences string, count int, now time.Time) {
+	for i := range c.config.Drifts {
+		d := &c.config.Drifts[i]
+		if d.DeviceNodeID != dev.ID {
+			continue
+		}
+
+		if d.Differences == differences {
+			return
+		}
+
+		d.Differences = differences
+		d.Count = count
+
+		err := SendNodePoints(c.nc, d.ID, data.Points{
+			{Time: now, Type: data.PointTypeDifferences, Text: differences},
+			{Time: now, Type: data.PointTypeCount, Value: float64(count)},
+		}, false)
+		if err != nil {
+			log.Printf("Config template %v: error updating drift: %v\n",
+				c.config.Description, err)
+		}
+		return
+	}
+
+	d := ConfigDrift{
+		ID:           uuid.New().String(),
+		Parent:       c.config.ID,
+		Description:  configNodeLabel(dev),
+		DeviceNodeID: dev.ID,
+		Differences:  differences,
+		Count:        count,
+		Start:        now.Format(time.RFC3339),
+	}
+
+	// no origin so that the manager does not restart this client
+	err := SendNodeType(c.nc, d, "")
+	if err != nil {
+		log.Printf("Config template %v: error creating drift: %v\n",
+			c.config.Description, err)
+		return
+	}
+
+	log.Printf("Config template %v: %v has drifted\n", c.config.Description, d.Description)
+
+	c.config.Drifts = append(c.config.Drifts, d)
+}
+
+// reapply writes the golden configuration to the device of a drift node
+func (c *ConfigTemplateClient) reapply(driftID string) {
+	var deviceID string
+	for _, d := range c.config.Drifts {
+		if d.ID == driftID {
+			deviceID = d.DeviceNodeID
+		}
+	}
+
+	err := SendNodePoint(c.nc, driftID, data.Point{Type: data.PointTypeReapply,
+		Value: 0}, false)
+	if err != nil {
+		log.Printf("Config template %v: error clearing reapply: %v\n",
+			c.config.Description, err)
+	}
+
+	if deviceID == "" {
+		return
+	}
+
+	golden, err := c.golden()
+	if err != nil {
+		log.Printf("Config template %v: error getting golden config: %v\n",
+			c.config.Description, err)
+		return
+	}
+
+	nodes, err := GetNode(c.nc, deviceID, "none")
+	if err != nil || len(nodes) < 1 {
+		log.Printf("Config template %v: error getting device %v: %v\n",
+			c.config.Description, deviceID, err)
+		return
+	}
+
+	device, err := c.tree(nodes[0], map[string]bool{})
+	if err != nil {
+		log.Printf("Config template %v: error getting device %v: %v\n",
+			c.config.Description, deviceID, err)
+		return
+	}
+
+	now := time.Now()
+
+	for _, d := range configCompare("", golden, device, c.ignore()) {
+		switch {
+		case d.point != nil:
+			p := *d.point
+			p.Time = now
+			p.Origin = c.config.ID
+			err = SendNodePoint(c.nc, d.nodeID, p, true)
+		case d.missing != nil:
+			_, err = SendNodes(c.nc, d.nodeID, c.copyNodes(*d.missing, ""))
+		default:
+			continue
+		}
+
+		if err != nil {
+			log.Printf("Config template %v: error reapplying %v: %v\n",
+				c.config.Description, d, err)
+		}
+	}
+
+	log.Printf("Config template %v: reapplied to %v\n", c.config.Description,
+		configNodeLabel(device.NodeEdge))
+
+	c.check()
+}
+
+// copyNodes flattens a golden subtree so it can be created with SendNodes
+func (c *ConfigTemplateClient) copyNodes(n data.NodeEdgeChildren, parent string) []data.NodeEdge {
+	var points data.Points
+	for _, p := range n.NodeEdge.Points {
+		if p.Type == data.PointTypeNodeType || p.Tombstone%2 == 1 {
+			continue
+		}
+		p.Time = time.Time{}
+		p.Origin = c.config.ID
+		points = append(points, p)
+	}
+
+	ret := []data.NodeEdge{{
+		ID:     n.NodeEdge.ID,
+		Type:   n.NodeEdge.Type,
+		Parent: parent,
+		Points: points,
+	}}
+
+	for _, child := range n.Children {
+		ret = append(ret, c.copyNodes(child, n.NodeEdge.ID)...)
+	}
+
+	return ret
+}
+
+// Stop sends a signal to the Start function to exit
+func (c *ConfigTemplateClient) Stop(err error) {
+	close(c.stop)
+}
+
+// Points is called by the Manager when new points for this
+// node are received.
+func (c *ConfigTemplateClient) Points(nodeID string, points []data.Point) {
+	c.newPoints <- NewPoints{nodeID, "", points}
+}
+
+// EdgePoints is called by the Manager when new edge points for this
+// node are received.
+func (c *ConfigTemplateClient) EdgePoints(nodeID, parentID string, points []data.Point) {
+	c.newEdgePoints <- NewPoints{nodeID, parentID, points}
+}
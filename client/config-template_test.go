@@ -0,0 +1,127 @@
+package client_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+	"github.com/simpleiot/simpleiot/server"
+)
+
+func TestConfigTemplate(t *testing.T) {
+	nc, root, stop, err := server.TestServer()
+	if err != nil {
+		t.Fatal("Error starting test server: ", err)
+	}
+	defer stop()
+
+	sendNode := func(id, typ, parent string, points data.Points) {
+		t.Helper()
+		err := client.SendNode(nc, data.NodeEdge{ID: id, Type: typ, Parent: parent,
+			Points: points}, "test")
+		if err != nil {
+			t.Fatal("Error sending node: ", err)
+		}
+	}
+
+	desc := func(d string) data.Point {
+		return data.Point{Type: data.PointTypeDescription, Text: d}
+	}
+
+	units := func(u string) data.Point {
+		return data.Point{Type: data.PointTypeUnits, Text: u}
+	}
+
+	tag := data.Point{Type: data.PointTypeTag, Text: "pump"}
+
+	// golden config
+	sendNode("golden", data.NodeTypeGroup, root.ID, data.Points{desc("golden")})
+	sendNode("ga", data.NodeTypeVariable, "golden", data.Points{desc("a"), units("C"),
+		{Type: data.PointTypeValue, Value: 1}})
+	sendNode("gb", data.NodeTypeVariable, "golden", data.Points{desc("b")})
+
+	// matches, except for the ignored value
+	sendNode("dev1", data.NodeTypeGroup, root.ID, data.Points{desc("dev1"), tag})
+	sendNode("dev1a", data.NodeTypeVariable, "dev1", data.Points{desc("a"), units("C"),
+		{Type: data.PointTypeValue, Value: 5}})
+	sendNode("dev1b", data.NodeTypeVariable, "dev1", data.Points{desc("b")})
+
+	// wrong units and missing b
+	sendNode("dev2", data.NodeTypeGroup, root.ID, data.Points{desc("dev2"), tag})
+	sendNode("dev2a", data.NodeTypeVariable, "dev2", data.Points{desc("a"), units("F")})
+
+	err = client.SendNodeType(nc, client.ConfigTemplate{
+		ID:           "template",
+		Parent:       root.ID,
+		Description:  "pump config",
+		GoldenNodeID: "golden",
+		Tag:          "pump",
+	}, "test")
+	if err != nil {
+		t.Fatal("Error sending config template node: ", err)
+	}
+
+	waitPointValue(t, nc, "template", data.PointTypeDevices, 2)
+	waitPointValue(t, nc, "template", data.PointTypeDrifted, 1)
+
+	drifts, err := client.GetNodeChildrenType[client.ConfigDrift](nc, "template")
+	if err != nil {
+		t.Fatal("Error getting drifts: ", err)
+	}
+
+	if len(drifts) != 1 || drifts[0].DeviceNodeID != "dev2" || drifts[0].Count != 2 {
+		t.Fatalf("Drift not correct: %+v", drifts)
+	}
+
+	if !strings.Contains(drifts[0].Differences, "/variable a: units is F, should be C") ||
+		!strings.Contains(drifts[0].Differences, "/variable b: missing") {
+		t.Error("Differences not correct: ", drifts[0].Differences)
+	}
+
+	err = client.SendNodePoint(nc, drifts[0].ID, data.Point{Type: data.PointTypeReapply,
+		Value: 1, Origin: "test"}, true)
+	if err != nil {
+		t.Fatal("Error sending reapply: ", err)
+	}
+
+	waitPointValue(t, nc, "template", data.PointTypeDrifted, 0)
+
+	nodes, err := client.GetNode(nc, "dev2a", "none")
+	if err != nil || len(nodes) < 1 {
+		t.Fatal("Error getting node: ", err)
+	}
+
+	if u, _ := nodes[0].Points.Text(data.PointTypeUnits, ""); u != "C" {
+		t.Error("Units not reapplied: ", u)
+	}
+
+	children, err := client.GetNodeChildren(nc, "dev2", data.NodeTypeVariable, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(children) != 2 {
+		t.Error("Missing node not created: ", children)
+	}
+
+	// the drift is removed
+	timeout := time.After(5 * time.Second)
+	for {
+		drifts, err = client.GetNodeChildrenType[client.ConfigDrift](nc, "template")
+		if err != nil {
+			t.Fatal("Error getting drifts: ", err)
+		}
+
+		if len(drifts) == 0 {
+			break
+		}
+
+		select {
+		case <-timeout:
+			t.Fatal("Drift not removed")
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+}
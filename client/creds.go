@@ -0,0 +1,114 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nkeys"
+)
+
+// DeviceCredsResponse is the response to a device credentials request
+type DeviceCredsResponse struct {
+	Creds string `json:"creds,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// IssueDeviceCreds requests NATS credentials for a device from the server,
+// which must have an issuer key. The credentials are returned in the NATS
+// creds file format, and only allow the device to use the subjects of the
+// nodes in its subtree. They expire after the server creds expiry (see
+// server.Options), or can be revoked with RevokeDeviceCreds. The connection
+// must have full access (auth token).
+func IssueDeviceCreds(nc *nats.Conn, deviceID string) (string, error) {
+	if deviceID == "" {
+		return "", errors.New("device ID must be set")
+	}
+
+	msg, err := nc.Request(SubjectDeviceCreds(), []byte(deviceID), time.Second*5)
+	if err != nil {
+		return "", fmt.Errorf("Error sending creds request: %w", err)
+	}
+
+	var resp DeviceCredsResponse
+	err = json.Unmarshal(msg.Data, &resp)
+	if err != nil {
+		return "", fmt.Errorf("Error decoding creds response: %w", err)
+	}
+
+	if resp.Error != "" {
+		return "", errors.New(resp.Error)
+	}
+
+	return resp.Creds, nil
+}
+
+// RevokeDeviceCreds revokes the NATS credentials issued to a device so far.
+// Connections with these credentials lose their permissions, and new
+// connections are rejected. Credentials issued later are accepted. The
+// connection must have full access (auth token).
+func RevokeDeviceCreds(nc *nats.Conn, deviceID string) error {
+	if deviceID == "" {
+		return errors.New("device ID must be set")
+	}
+
+	msg, err := nc.Request(SubjectDeviceCredsRevoke(), []byte(deviceID), time.Second*5)
+	if err != nil {
+		return fmt.Errorf("Error sending revoke request: %w", err)
+	}
+
+	var resp DeviceCredsResponse
+	err = json.Unmarshal(msg.Data, &resp)
+	if err != nil {
+		return fmt.Errorf("Error decoding revoke response: %w", err)
+	}
+
+	if resp.Error != "" {
+		return errors.New(resp.Error)
+	}
+
+	return nil
+}
+
+// DeviceCreds returns a NATS option to authenticate with a creds file issued
+// by IssueDeviceCreds (see DeviceCredsData)
+func DeviceCreds(file string) nats.Option {
+	return func(o *nats.Options) error {
+		contents, err := os.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("Error reading creds file: %w", err)
+		}
+
+		return DeviceCredsData(contents)(o)
+	}
+}
+
+// DeviceCredsData returns a NATS option to authenticate with the contents of
+// a creds file issued by IssueDeviceCreds. The SIOT NATS server is not in
+// operator mode, so the JWT is sent as the token, and the server nonce is
+// signed with the nkey.
+func DeviceCredsData(contents []byte) nats.Option {
+	return func(o *nats.Options) error {
+		token, err := jwt.ParseDecoratedJWT(contents)
+		if err != nil {
+			return fmt.Errorf("Error parsing creds JWT: %w", err)
+		}
+
+		kp, err := nkeys.ParseDecoratedNKey(contents)
+		if err != nil {
+			return fmt.Errorf("Error parsing creds nkey: %w", err)
+		}
+
+		pub, err := kp.PublicKey()
+		if err != nil {
+			return err
+		}
+
+		o.Token = token
+		return nats.Nkey(pub, kp.Sign)(o)
+	}
+}
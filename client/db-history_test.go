@@ -0,0 +1,66 @@
+package client
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/simpleiot/simpleiot/data"
+)
+
+func TestInfluxHistoryQuery(t *testing.T) {
+	start := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+	end := start.Add(time.Hour)
+
+	tests := []struct {
+		name       string
+		q          data.HistoryQuery
+		aggregated bool
+		contains   []string
+	}{
+		{"raw", data.HistoryQuery{Start: start, End: end, Type: "value"}, false,
+			[]string{`range(start: 2023-01-02T03:04:05Z, stop: 2023-01-02T04:04:05.000000001Z)`,
+				`r.type == "value"`, "pivot("}},
+		{"mean", data.HistoryQuery{Start: start, End: end,
+			Aggregate: data.AggregateMean}, true,
+			[]string{"tables |> mean(column: column)", `group(columns: ["type", "key"])`,
+				`agg(column: "_value")`}},
+		{"max window", data.HistoryQuery{Start: start, End: end,
+			Window: 15 * time.Minute, Aggregate: data.AggregateMax}, true,
+			[]string{"tables |> max(column: column)",
+				// 03:04:05 is 245s past the 15 minute epoch windows
+				"aggregateWindow(every: 900000000000ns, offset: 245000000000ns, fn: agg"}},
+		{"integral window", data.HistoryQuery{Start: start, End: end,
+			Window: time.Minute, Aggregate: data.AggregateIntegral}, true,
+			[]string{"integral(unit: 1s, column: column)", "offset: 5000000000ns"}},
+		{"last", data.HistoryQuery{Start: start, End: end,
+			Aggregate: data.AggregateLast}, false,
+			[]string{"|> last()\n  |> pivot("}},
+		{"last window", data.HistoryQuery{Start: start, End: end,
+			Window: time.Minute, Aggregate: data.AggregateLast}, false,
+			[]string{"window(every: 60000000000ns, offset: 5000000000ns)\n  |> last()"}},
+		// windows can't be aligned without a start
+		{"window without start", data.HistoryQuery{End: end, Window: time.Minute,
+			Aggregate: data.AggregateMean}, false,
+			[]string{"range(start: 0,", "pivot("}},
+	}
+
+	for _, test := range tests {
+		flux, aggregated := influxHistoryQuery("siot", "node1", test.q)
+
+		if aggregated != test.aggregated {
+			t.Errorf("%v: expected aggregated %v, got %v", test.name,
+				test.aggregated, aggregated)
+		}
+
+		for _, c := range test.contains {
+			if !strings.Contains(flux, c) {
+				t.Errorf("%v: %q not found in:\n%v", test.name, c, flux)
+			}
+		}
+
+		if !strings.Contains(flux, `r.nodeID == "node1"`) {
+			t.Errorf("%v: node filter not found in:\n%v", test.name, flux)
+		}
+	}
+}
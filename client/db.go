@@ -1,10 +1,14 @@
 package client
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
 	"github.com/influxdata/influxdb-client-go/v2/api"
@@ -31,10 +35,13 @@ type DbClient struct {
 	newPoints     chan NewPoints
 	newEdgePoints chan NewPoints
 	newDbPoints   chan NewPoints
-	upSub         *nats.Subscription
-	upSubHr       *nats.Subscription
-	client        influxdb2.Client
-	writeAPI      api.WriteAPI
+	upSub         *BufferedSub
+	upSubHr       *BufferedSub
+	historySub    *nats.Subscription
+	// lock protects client, which is also used by history queries
+	lock     sync.Mutex
+	client   influxdb2.Client
+	writeAPI api.WriteAPI
 }
 
 // NewDbClient ...
@@ -56,49 +63,58 @@ func (dbc *DbClient) Start() error {
 	// FIXME, we probably want to store edge points too ...
 	subject := fmt.Sprintf("up.%v.*.points", dbc.config.Parent)
 
-	var err error
-	dbc.upSub, err = dbc.nc.Subscribe(subject, func(msg *nats.Msg) {
-		points, err := data.PbDecodePoints(msg.Data)
-		if err != nil {
-			log.Println("Error decoding points in db upSub: ", err)
-			return
-		}
+	// writes to influx can stall, so buffer incoming points and drop the
+	// oldest if we get too far behind rather than stalling the NATS connection
+	bufOpts := BufferOptions{
+		Size:          10000,
+		Policy:        BufferDropOldest,
+		MetricsNodeID: dbc.config.ID,
+	}
 
+	var err error
+	dbc.upSub, err = NewBufferedSub(dbc.nc, subject, bufOpts, func(subject string, points data.Points) {
 		// find node ID for points
-		chunks := strings.Split(msg.Subject, ".")
+		chunks := strings.Split(subject, ".")
 		if len(chunks) != 4 {
-			log.Println("rule client up sub, malformed subject: ", msg.Subject)
+			log.Println("rule client up sub, malformed subject: ", subject)
 			return
 		}
 
-		dbc.newDbPoints <- NewPoints{chunks[2], "", points}
+		select {
+		case dbc.newDbPoints <- NewPoints{chunks[2], "", points}:
+		case <-dbc.stop:
+		}
 	})
 
-	subjectHR := fmt.Sprintf("phrup.%v.*", dbc.config.Parent)
+	if err != nil {
+		return fmt.Errorf("Db error subscribing to upsub: %v", err)
+	}
 
-	dbc.upSubHr, err = dbc.nc.Subscribe(subjectHR, func(msg *nats.Msg) {
-		points, err := data.PbDecodePoints(msg.Data)
-		if err != nil {
-			log.Println("Error decoding points in db upSubHr: ", err)
-			return
-		}
+	subjectHR := fmt.Sprintf("phrup.%v.*", dbc.config.Parent)
 
+	dbc.upSubHr, err = NewBufferedSub(dbc.nc, subjectHR, bufOpts, func(subject string, points data.Points) {
 		// find node ID for points
-		chunks := strings.Split(msg.Subject, ".")
+		chunks := strings.Split(subject, ".")
 		if len(chunks) != 3 {
-			log.Println("rule client up hr sub, malformed subject: ", msg.Subject)
+			log.Println("rule client up hr sub, malformed subject: ", subject)
 			return
 		}
 
-		dbc.newDbPoints <- NewPoints{chunks[2], "", points}
+		select {
+		case dbc.newDbPoints <- NewPoints{chunks[2], "", points}:
+		case <-dbc.stop:
+		}
 	})
 
 	if err != nil {
-		return fmt.Errorf("Rule error subscribing to upsub: %v", err)
+		dbc.upSub.Stop()
+		return fmt.Errorf("Db error subscribing to upSubHr: %v", err)
 	}
 
 	setupAPI := func() {
 		log.Println("Setting up Influx API")
+		dbc.lock.Lock()
+		defer dbc.lock.Unlock()
 		// you can set things like retries, batching, precision, etc in client options.
 		dbc.client = influxdb2.NewClientWithOptions(dbc.config.URI,
 			dbc.config.AuthToken, influxdb2.DefaultOptions())
@@ -125,6 +141,16 @@ func (dbc *DbClient) Start() error {
 
 	setupAPI()
 
+	// serve history queries. A queue group is used, so only one db client
+	// responds if there are several.
+	dbc.historySub, err = dbc.nc.QueueSubscribe(SubjectHistory("*"), "db", dbc.handleHistory)
+	if err != nil {
+		dbc.upSub.Stop()
+		dbc.upSubHr.Stop()
+		dbc.client.Close()
+		return fmt.Errorf("Db error subscribing to history: %v", err)
+	}
+
 done:
 	for {
 		select {
@@ -144,7 +170,9 @@ done:
 					data.PointTypeBucket,
 					data.PointTypeAuthToken:
 					// we need to restart the influx write API
+					dbc.lock.Lock()
 					dbc.client.Close()
+					dbc.lock.Unlock()
 					setupAPI()
 				}
 			}
@@ -174,10 +202,185 @@ done:
 	}
 
 	// clean up
+	dbc.historySub.Unsubscribe()
+	dbc.upSub.Stop()
+	dbc.upSubHr.Stop()
 	dbc.client.Close()
 	return nil
 }
 
+func (dbc *DbClient) handleHistory(msg *nats.Msg) {
+	nodeID, q, err := DecodeHistoryMsg(msg)
+
+	var points data.Points
+	if err == nil {
+		points, err = dbc.history(nodeID, q)
+	}
+
+	err = RespondHistory(msg, nodeID, points, err)
+	if err != nil {
+		log.Println("Error responding to history query: ", err)
+	}
+}
+
+// influxAggregates are flux functions that compute aggregates like
+// data.HistoryQuery.Apply. The flux integral is also trapezoidal.
+var influxAggregates = map[string]string{
+	data.AggregateMean:     "mean(column: column)",
+	data.AggregateMin:      "min(column: column)",
+	data.AggregateMax:      "max(column: column)",
+	data.AggregateCount:    "count(column: column)",
+	data.AggregateIntegral: "integral(unit: 1s, column: column)",
+}
+
+// influxHistoryQuery returns the flux query for a history query. If
+// aggregated is true, influx computes the aggregate and returns one row with
+// the type, key, and value for each window. Otherwise, it returns points that
+// must be aggregated with q.Apply, which is needed when the windows can't be
+// aligned to the start of the query in flux, and for the last aggregate, as
+// it returns the whole point.
+func influxHistoryQuery(bucket, nodeID string, q data.HistoryQuery) (flux string, aggregated bool) {
+	start := "0"
+	if !q.Start.IsZero() {
+		start = q.Start.Format(time.RFC3339Nano)
+	}
+
+	stop := "now()"
+	if !q.End.IsZero() {
+		// influx stop is exclusive
+		stop = q.End.Add(time.Nanosecond).Format(time.RFC3339Nano)
+	}
+
+	flux = fmt.Sprintf(`from(bucket: %q)
+  |> range(start: %v, stop: %v)
+  |> filter(fn: (r) => r._measurement == "points" and r.nodeID == %q)`,
+		bucket, start, stop, nodeID)
+
+	if q.Type != "" {
+		flux += fmt.Sprintf("\n  |> filter(fn: (r) => r.type == %q)", q.Type)
+	}
+
+	if q.Key != "" {
+		flux += fmt.Sprintf("\n  |> filter(fn: (r) => r.key == %q)", q.Key)
+	}
+
+	// flux windows are aligned to the unix epoch, so they are offset to
+	// align them to the start of the query
+	var every, offset string
+	if q.Window > 0 && !q.Start.IsZero() {
+		w := q.Window.Nanoseconds()
+		every = fmt.Sprintf("%vns", w)
+		offset = fmt.Sprintf("%vns", (q.Start.UnixNano()%w+w)%w)
+	}
+
+	fn, ok := influxAggregates[q.Aggregate]
+
+	switch {
+	case ok && (q.Window == 0 || every != ""):
+		flux = "agg = (column, tables=<-) => tables |> " + fn + "\n\n" + flux +
+			`
+  |> filter(fn: (r) => r._field == "value")
+  |> group(columns: ["type", "key"])
+  |> sort(columns: ["_time"])`
+
+		if q.Window == 0 {
+			flux += `
+  |> agg(column: "_value")`
+		} else {
+			flux += fmt.Sprintf(`
+  |> aggregateWindow(every: %v, offset: %v, fn: agg, createEmpty: false, timeSrc: "_start")`,
+				every, offset)
+		}
+
+		return flux, true
+
+	case q.Aggregate == data.AggregateLast && q.Window == 0:
+		// don't fetch the entire history if we only need the last value
+		flux += "\n  |> last()"
+
+	case q.Aggregate == data.AggregateLast && every != "":
+		// only fetch the last points of each window
+		flux += fmt.Sprintf(`
+  |> window(every: %v, offset: %v)
+  |> last()
+  |> window(every: inf)`, every, offset)
+	}
+
+	flux += `
+  |> pivot(rowKey: ["_time"], columnKey: ["_field"], valueColumn: "_value")`
+
+	return flux, false
+}
+
+// history queries points from influx. Aggregates are computed by influx
+// where possible, otherwise the aggregation semantics are implemented by
+// data.HistoryQuery, so they are the same for all backends.
+func (dbc *DbClient) history(nodeID string, q data.HistoryQuery) (data.Points, error) {
+	err := q.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	flux, aggregated := influxHistoryQuery(dbc.config.Bucket, nodeID, q)
+
+	dbc.lock.Lock()
+	queryAPI := dbc.client.QueryAPI(dbc.config.Org)
+	dbc.lock.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	result, err := queryAPI.Query(ctx, flux)
+	if err != nil {
+		return nil, fmt.Errorf("Error querying influx: %v", err)
+	}
+	defer result.Close()
+
+	var points data.Points
+
+	for result.Next() {
+		r := result.Record()
+		p := data.Point{Time: r.Time()}
+		p.Type, _ = r.ValueByKey("type").(string)
+		p.Key, _ = r.ValueByKey("key").(string)
+
+		if aggregated {
+			switch v := r.Value().(type) {
+			case float64:
+				p.Value = v
+			case int64:
+				p.Value = float64(v)
+			}
+
+			if q.Window == 0 {
+				// the entire time range is one window
+				p.Time = q.Start
+			}
+
+			points = append(points, p)
+			continue
+		}
+
+		p.Value, _ = r.ValueByKey("value").(float64)
+		p.Text, _ = r.ValueByKey("text").(string)
+		if index, ok := r.ValueByKey("index").(string); ok {
+			p.Index, _ = strconv.ParseFloat(index, 64)
+		}
+		points = append(points, p)
+	}
+
+	if result.Err() != nil {
+		return nil, fmt.Errorf("Error reading influx result: %v", result.Err())
+	}
+
+	if aggregated {
+		sort.Stable(points)
+		return points, nil
+	}
+
+	return q.Apply(points)
+}
+
 // Stop sends a signal to the Start function to exit
 func (dbc *DbClient) Stop(err error) {
 	close(dbc.stop)
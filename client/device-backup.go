@@ -0,0 +1,108 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// how long we wait for each chunk of a device backup, and how many times a
+// chunk is requested before giving up. Taking the snapshot for the first
+// chunk can take a while on a slow device.
+var deviceBackupTimeout = time.Minute
+var deviceBackupRetries = 5
+
+// ErrSnapshotExpired is returned by DeviceBackup when a download is resumed
+// after the device discarded the snapshot, so a new backup must be started
+var ErrSnapshotExpired = errors.New("snapshot expired, start a new backup")
+
+// DeviceBackupRequest requests a chunk of a device store snapshot, starting
+// at Offset. If ID is blank, the device takes a new snapshot. ID is
+// the SHA-256 hash of the snapshot (hex encoded), so the snapshot can be
+// verified after it is downloaded.
+type DeviceBackupRequest struct {
+	ID     string `json:"id"`
+	Offset int64  `json:"offset"`
+}
+
+// DeviceBackupChunk is the response to a DeviceBackupRequest
+type DeviceBackupChunk struct {
+	ID     string `json:"id"`
+	Size   int64  `json:"size"`
+	Offset int64  `json:"offset"`
+	Data   []byte `json:"data"`
+	Error  string `json:"error"`
+}
+
+// DeviceBackup downloads a snapshot of the store of a downstream device
+// connected to this instance through an upstream node, and writes it to w.
+// The snapshot is requested one chunk at a time, and chunks are retried if
+// the device does not respond, so a flaky connection does not restart the
+// download. state is updated as chunks are written. If DeviceBackup returns
+// an error, it can be called again with the same state to resume the
+// download (the device keeps a snapshot for 10 minutes after the last
+// request). A zero state starts a new snapshot.
+func DeviceBackup(nc *nats.Conn, deviceID string, state *DeviceBackupRequest,
+	w io.Writer) error {
+	for {
+		req, err := json.Marshal(state)
+		if err != nil {
+			return err
+		}
+
+		var msg *nats.Msg
+		for i := 0; i < deviceBackupRetries; i++ {
+			msg, err = nc.Request(SubjectDeviceBackup(deviceID), req,
+				deviceBackupTimeout)
+			if err == nil {
+				break
+			}
+			log.Printf("Error requesting backup chunk from device %v at %v: %v\n",
+				deviceID, state.Offset, err)
+		}
+
+		if err != nil {
+			return fmt.Errorf("Error requesting backup chunk: %w", err)
+		}
+
+		var chunk DeviceBackupChunk
+		err = json.Unmarshal(msg.Data, &chunk)
+		if err != nil {
+			return fmt.Errorf("Error decoding backup chunk: %w", err)
+		}
+
+		if chunk.Error == ErrSnapshotExpired.Error() {
+			return ErrSnapshotExpired
+		}
+
+		if chunk.Error != "" {
+			return errors.New(chunk.Error)
+		}
+
+		if chunk.Offset != state.Offset {
+			return fmt.Errorf("Device sent chunk at %v, expected %v",
+				chunk.Offset, state.Offset)
+		}
+
+		_, err = w.Write(chunk.Data)
+		if err != nil {
+			return fmt.Errorf("Error writing backup: %w", err)
+		}
+
+		state.ID = chunk.ID
+		state.Offset += int64(len(chunk.Data))
+
+		if state.Offset >= chunk.Size {
+			return nil
+		}
+
+		if len(chunk.Data) <= 0 {
+			return errors.New("Device sent an empty chunk")
+		}
+	}
+}
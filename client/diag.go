@@ -0,0 +1,170 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// diagnostic commands
+const (
+	// DiagNode returns the node with ID and its edges (see GetNode).
+	// Credentials are masked (see data.Points.Mask).
+	DiagNode = "node"
+	// DiagSubscriptions returns the subscriptions of the NATS server
+	DiagSubscriptions = "subscriptions"
+	// DiagManagers returns the state of the client managers
+	DiagManagers = "managers"
+)
+
+// DiagRequest is sent to run a read-only diagnostic command on a running
+// instance. Token is a user auth token (see the auth.user API).
+type DiagRequest struct {
+	Token   string `json:"token"`
+	Command string `json:"command"`
+	ID      string `json:"id,omitempty"`
+}
+
+// DiagResponse is returned by a diagnostic command. Result is the JSON
+// encoded result of the command.
+type DiagResponse struct {
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+// ManagerState is the state of a client Manager returned by the managers
+// diagnostic command
+type ManagerState struct {
+	NodeType string        `json:"nodeType"`
+	Clients  []ClientState `json:"clients"`
+}
+
+// ClientState is the state of a client of a Manager. Running is false if the
+// client crashed and is waiting to restart or has given up.
+type ClientState struct {
+	NodeID        string    `json:"nodeId"`
+	Parent        string    `json:"parent"`
+	Description   string    `json:"description"`
+	Running       bool      `json:"running"`
+	Started       time.Time `json:"started,omitempty"`
+	Crashes       int       `json:"crashes,omitempty"`
+	CrashLoop     bool      `json:"crashLoop,omitempty"`
+	GaveUp        bool      `json:"gaveUp,omitempty"`
+	Offline       bool      `json:"offline,omitempty"`
+	LastHeartbeat time.Time `json:"lastHeartbeat,omitempty"`
+}
+
+// Diag runs a diagnostic command and decodes the result into result
+func Diag(nc *nats.Conn, req DiagRequest, result any) error {
+	reqData, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	msg, err := nc.Request(SubjectDiag(), reqData, time.Second*20)
+	if err != nil {
+		return fmt.Errorf("Error running diagnostic: %w", err)
+	}
+
+	var resp DiagResponse
+	err = json.Unmarshal(msg.Data, &resp)
+	if err != nil {
+		return fmt.Errorf("Error decoding diagnostic response: %w", err)
+	}
+
+	if resp.Error != "" {
+		return errors.New(resp.Error)
+	}
+
+	if result == nil {
+		return nil
+	}
+
+	return json.Unmarshal(resp.Result, result)
+}
+
+// State returns the state of the manager and its clients. An error is
+// returned if the manager is not running.
+func (m *Manager[T]) State() (ManagerState, error) {
+	ret := make(chan ManagerState, 1)
+
+	f := func() {
+		s := ManagerState{NodeType: m.nodeType}
+
+		for key, cs := range m.clientStates {
+			c := ClientState{
+				NodeID:        cs.node.ID,
+				Parent:        cs.node.Parent,
+				Description:   cs.node.Desc(),
+				Running:       true,
+				Started:       cs.started,
+				Offline:       m.offline[cs.node.ID],
+				LastHeartbeat: cs.heartbeatTime(),
+			}
+
+			if crash, ok := m.crashes[key]; ok {
+				c.Crashes = crash.count
+				c.CrashLoop = crash.crashLoop
+			}
+
+			s.Clients = append(s.Clients, c)
+		}
+
+		for key, crash := range m.crashes {
+			if _, ok := m.clientStates[key]; ok {
+				continue
+			}
+
+			s.Clients = append(s.Clients, ClientState{
+				NodeID:    crash.nodeID,
+				Crashes:   crash.count,
+				CrashLoop: crash.crashLoop,
+				GaveUp:    crash.gaveUp,
+			})
+		}
+
+		ret <- s
+	}
+
+	select {
+	case m.chAction <- f:
+	case <-time.After(5 * time.Second):
+		return ManagerState{}, fmt.Errorf("%v manager is not running", m.nodeType)
+	}
+
+	return <-ret, nil
+}
+
+// ManagerStates returns the state of the registered client managers that
+// report their state (see Manager.State)
+func (bic *BuiltInClients) ManagerStates() ([]ManagerState, error) {
+	type stater interface {
+		State() (ManagerState, error)
+	}
+
+	bic.lock.Lock()
+	managers := make([]ClientManager, len(bic.managers))
+	copy(managers, bic.managers)
+	bic.lock.Unlock()
+
+	var ret []ManagerState
+
+	for _, m := range managers {
+		s, ok := m.(stater)
+		if !ok {
+			continue
+		}
+
+		state, err := s.State()
+		if err != nil {
+			return nil, err
+		}
+
+		ret = append(ret, state)
+	}
+
+	return ret, nil
+}
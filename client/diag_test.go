@@ -0,0 +1,131 @@
+package client_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+	"github.com/simpleiot/simpleiot/server"
+)
+
+func TestDiag(t *testing.T) {
+	nc, root, stop, err := server.TestServer()
+	if err != nil {
+		t.Fatal("Error starting test server: ", err)
+	}
+	defer stop()
+
+	err = client.Diag(nc, client.DiagRequest{Token: "bad",
+		Command: client.DiagNode, ID: root.ID}, nil)
+	if err == nil {
+		t.Fatal("Expected invalid token error")
+	}
+
+	reqPoints := data.Points{
+		{Type: data.PointTypeEmail, Text: "admin@admin.com"},
+		{Type: data.PointTypePass, Text: "admin"},
+	}
+	reqData, err := reqPoints.ToPb()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := nc.Request("auth.user", reqData, 5*time.Second)
+	if err != nil {
+		t.Fatal("Error authenticating: ", err)
+	}
+
+	nodes, err := data.PbDecodeNodesRequest(msg.Data)
+	if err != nil {
+		t.Fatal("Error decoding auth response: ", err)
+	}
+
+	var token string
+	for _, n := range nodes {
+		if n.Type == data.NodeTypeJWT {
+			token, _ = n.Points.Text(data.PointTypeToken, "")
+		}
+	}
+
+	if token == "" {
+		t.Fatal("Did not get a token")
+	}
+
+	var node []data.NodeEdge
+	err = client.Diag(nc, client.DiagRequest{Token: token,
+		Command: client.DiagNode, ID: root.ID}, &node)
+	if err != nil {
+		t.Fatal("Error getting node: ", err)
+	}
+
+	if len(node) < 1 || node[0].ID != root.ID {
+		t.Fatal("Did not get root node: ", node)
+	}
+
+	// credentials are masked
+	users, err := client.GetNodeChildren(nc, root.ID, data.NodeTypeUser, false, false)
+	if err != nil || len(users) < 1 {
+		t.Fatal("Error getting users: ", err)
+	}
+
+	err = client.Diag(nc, client.DiagRequest{Token: token,
+		Command: client.DiagNode, ID: users[0].ID}, &node)
+	if err != nil {
+		t.Fatal("Error getting user node: ", err)
+	}
+
+	if len(node) < 1 {
+		t.Fatal("Did not get user node")
+	}
+
+	if pass, ok := node[0].Points.Text(data.PointTypePass, ""); !ok ||
+		pass != data.SecretMask {
+		t.Errorf("Password not masked: %q, %v", pass, ok)
+	}
+
+	var managers []client.ManagerState
+	err = client.Diag(nc, client.DiagRequest{Token: token,
+		Command: client.DiagManagers}, &managers)
+	if err != nil {
+		t.Fatal("Error getting managers: ", err)
+	}
+
+	found := false
+	for _, m := range managers {
+		if m.NodeType == data.NodeTypeRule {
+			found = true
+		}
+	}
+
+	if !found {
+		t.Fatal("Rule manager state not returned")
+	}
+
+	var subs struct {
+		Subs []struct {
+			Subject string `json:"subject"`
+		} `json:"subscriptions_list"`
+	}
+	err = client.Diag(nc, client.DiagRequest{Token: token,
+		Command: client.DiagSubscriptions}, &subs)
+	if err != nil {
+		t.Fatal("Error getting subscriptions: ", err)
+	}
+
+	found = false
+	for _, s := range subs.Subs {
+		if s.Subject == client.SubjectDiag() {
+			found = true
+		}
+	}
+
+	if !found {
+		t.Fatal("Diag subscription not listed")
+	}
+
+	err = client.Diag(nc, client.DiagRequest{Token: token, Command: "rm"}, nil)
+	if err == nil {
+		t.Fatal("Expected unknown command error")
+	}
+}
@@ -0,0 +1,421 @@
+package client
+
+import (
+	"log"
+	"math"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// Doser pulse-width modulates the OutputPointType (defaults to value) point
+// of OutputNodeID to drive the SensorPointType (defaults to value) point of
+// SensorNodeID toward Setpoint, for example irrigation valves from soil
+// moisture, or nutrient and acid pumps from EC or pH. Direction is raise
+// (dosing increases the reading, the default) or lower. Each Period seconds
+// (defaults to 60), the output is turned on for Duty percent of the period,
+// where Duty is Gain percent per unit of error, limited to MaxDuty (defaults
+// to 100). There is no dosing while the error is within Deadband.
+//
+// Dosing stops while the InterlockNodeID value point is 0 (for example a
+// flow switch or the main pump running), if the sensor has not reported for
+// SensorTimeout minutes, or when DoseToday reaches DailyLimit. The dose is
+// the output on time in minutes times FlowRate (or just the on time if
+// FlowRate is 0) and is reset at midnight UTC. Interlocked and LimitReached
+// report why dosing is stopped.
+type Doser struct {
+	ID              string  `node:"id"`
+	Parent          string  `node:"parent"`
+	Description     string  `point:"description"`
+	SensorNodeID    string  `point:"sensorNodeID"`
+	SensorPointType string  `point:"sensorPointType"`
+	Setpoint        float64 `point:"setpoint"`
+	Direction       string  `point:"direction"`
+	Gain            float64 `point:"gain"`
+	Deadband        float64 `point:"deadband"`
+	Period          float64 `point:"period"`
+	MaxDuty         float64 `point:"maxDuty"`
+	OutputNodeID    string  `point:"outputNodeID"`
+	OutputPointType string  `point:"outputPointType"`
+	FlowRate        float64 `point:"flowRate"`
+	DailyLimit      float64 `point:"dailyLimit"`
+	InterlockNodeID string  `point:"interlockNodeID"`
+	SensorTimeout   float64 `point:"sensorTimeout"`
+	Disable         bool    `point:"disable"`
+	Duty            float64 `point:"duty"`
+	DoseToday       float64 `point:"doseToday"`
+	DoseDate        string  `point:"doseDate"`
+	Interlocked     bool    `point:"interlocked"`
+	LimitReached    bool    `point:"limitReached"`
+}
+
+// how often the doser updates the output, which is the resolution of the
+// pulse width
+var doserTickPeriod = 100 * time.Millisecond
+
+// doser inputs
+const (
+	doserInputSensor    = "sensor"
+	doserInputInterlock = "interlock"
+)
+
+type doserInput struct {
+	input string
+	value float64
+}
+
+// doserDuty returns the duty cycle in percent for a sensor reading
+func doserDuty(d *Doser, sensor float64) float64 {
+	err := d.Setpoint - sensor
+	if d.Direction == data.PointValueLower {
+		err = -err
+	}
+
+	if err <= d.Deadband {
+		return 0
+	}
+
+	maxDuty := d.MaxDuty
+	if maxDuty <= 0 || maxDuty > 100 {
+		maxDuty = 100
+	}
+
+	return math.Min(d.Gain*err, maxDuty)
+}
+
+// DoserClient is a SIOT client that runs dosing controller nodes
+type DoserClient struct {
+	nc            *nats.Conn
+	config        Doser
+	stop          chan struct{}
+	newPoints     chan NewPoints
+	newEdgePoints chan NewPoints
+	newInput      chan doserInput
+	// input subscriptions and the node they are subscribed to by input
+	subs    map[string]*nats.Subscription
+	subNode map[string]string
+	// input values, only set once received
+	inputs     map[string]float64
+	sensorTime time.Time
+	// start and on time of the current PWM cycle
+	cycleStart time.Time
+	onTime     time.Duration
+	// output is nil until the output has been set
+	output     *bool
+	lastUpdate time.Time
+	// time zone of the dose day
+	loc *time.Location
+}
+
+// NewDoserClient ...
+func NewDoserClient(nc *nats.Conn, config Doser) Client {
+	return &DoserClient{
+		nc:            nc,
+		config:        config,
+		stop:          make(chan struct{}),
+		newPoints:     make(chan NewPoints),
+		newEdgePoints: make(chan NewPoints),
+		newInput:      make(chan doserInput),
+		subs:          make(map[string]*nats.Subscription),
+		subNode:       make(map[string]string),
+		inputs:        make(map[string]float64),
+	}
+}
+
+// Start runs the main logic for this client and blocks until stopped
+func (d *DoserClient) Start() error {
+	log.Println("Starting doser client: ", d.config.Description)
+
+	var err error
+	d.loc, err = NodeLocation(d.nc, d.config.ID)
+	if err != nil {
+		log.Printf("Doser %v: %v\n", d.config.Description, err)
+	}
+
+	d.subscribeInputs()
+
+	ticker := time.NewTicker(doserTickPeriod)
+	defer ticker.Stop()
+
+	d.update(time.Now())
+
+done:
+	for {
+		select {
+		case <-d.stop:
+			log.Println("Stopping doser client: ", d.config.Description)
+			break done
+		case now := <-ticker.C:
+			d.update(now)
+		case in := <-d.newInput:
+			d.inputs[in.input] = in.value
+			if in.input == doserInputSensor {
+				d.sensorTime = time.Now()
+			}
+			d.update(time.Now())
+		case pts := <-d.newPoints:
+			err := data.MergePoints(pts.ID, pts.Points, &d.config)
+			if err != nil {
+				log.Println("error merging new points: ", err)
+			}
+
+			for _, p := range pts.Points {
+				switch p.Type {
+				case data.PointTypeSetpoint, data.PointTypeDirection, data.PointTypeGain,
+					data.PointTypeDeadband, data.PointTypePeriod, data.PointTypeMaxDuty,
+					data.PointTypeDisable:
+					// start a new cycle with the new settings
+					d.cycleStart = time.Time{}
+				}
+			}
+
+			d.subscribeInputs()
+			d.update(time.Now())
+		case pts := <-d.newEdgePoints:
+			err := data.MergeEdgePoints(pts.ID, pts.Parent, pts.Points, &d.config)
+			if err != nil {
+				log.Println("error merging new points: ", err)
+			}
+		}
+	}
+
+	// don't leave a valve or pump running
+	d.setOutput(false)
+
+	for _, sub := range d.subs {
+		sub.Unsubscribe()
+	}
+
+	return nil
+}
+
+// interlocked returns true if dosing is not safe
+func (d *DoserClient) interlocked(now time.Time) bool {
+	if d.config.Disable {
+		return true
+	}
+
+	if _, ok := d.inputs[doserInputSensor]; !ok {
+		return true
+	}
+
+	if d.config.SensorTimeout > 0 && now.Sub(d.sensorTime) >
+		time.Duration(d.config.SensorTimeout*float64(time.Minute)) {
+		return true
+	}
+
+	if d.config.InterlockNodeID != "" && d.inputs[doserInputInterlock] == 0 {
+		return true
+	}
+
+	return false
+}
+
+// update accumulates the dose, starts PWM cycles, and sets the output
+func (d *DoserClient) update(now time.Time) {
+	var points data.Points
+
+	loc := d.loc
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	day := now.In(loc).Format("2006-01-02")
+	if day != d.config.DoseDate {
+		d.config.DoseDate = day
+		d.config.DoseToday = 0
+		points = append(points,
+			data.Point{Type: data.PointTypeDoseDate, Text: day},
+			data.Point{Type: data.PointTypeDoseToday, Value: 0})
+	} else if d.output != nil && *d.output && !d.lastUpdate.IsZero() {
+		dose := now.Sub(d.lastUpdate).Minutes()
+		if d.config.FlowRate > 0 {
+			dose *= d.config.FlowRate
+		}
+		d.config.DoseToday += dose
+	}
+
+	d.lastUpdate = now
+
+	interlocked := d.interlocked(now)
+	limitReached := d.config.DailyLimit > 0 && d.config.DoseToday >= d.config.DailyLimit
+
+	period := d.config.Period
+	if period <= 0 {
+		period = 60
+	}
+	periodD := time.Duration(period * float64(time.Second))
+
+	if d.cycleStart.IsZero() || now.Sub(d.cycleStart) >= periodD {
+		d.cycleStart = now
+
+		duty := 0.0
+		if !interlocked {
+			duty = doserDuty(&d.config, d.inputs[doserInputSensor])
+		}
+
+		d.onTime = time.Duration(duty / 100 * float64(periodD))
+
+		if duty != d.config.Duty {
+			d.config.Duty = duty
+			points = append(points, data.Point{Type: data.PointTypeDuty, Value: duty})
+		}
+	}
+
+	on := !interlocked && !limitReached && now.Sub(d.cycleStart) < d.onTime
+
+	wasOn := d.output != nil && *d.output
+	d.setOutput(on)
+
+	if wasOn && !on {
+		points = append(points, data.Point{Type: data.PointTypeDoseToday,
+			Value: d.config.DoseToday})
+	}
+
+	if interlocked != d.config.Interlocked {
+		d.config.Interlocked = interlocked
+		points = append(points, data.Point{Type: data.PointTypeInterlocked,
+			Value: data.BoolToFloat(interlocked)})
+	}
+
+	if limitReached != d.config.LimitReached {
+		d.config.LimitReached = limitReached
+		points = append(points, data.Point{Type: data.PointTypeLimitReached,
+			Value: data.BoolToFloat(limitReached)})
+		if limitReached {
+			log.Printf("Doser %v: daily limit reached\n", d.config.Description)
+		}
+	}
+
+	if len(points) <= 0 {
+		return
+	}
+
+	for i := range points {
+		points[i].Time = now
+	}
+
+	err := SendNodePoints(d.nc, d.config.ID, points, false)
+	if err != nil {
+		log.Println("Doser: error sending state: ", err)
+	}
+}
+
+func (d *DoserClient) setOutput(on bool) {
+	if d.config.OutputNodeID == "" || (d.output != nil && *d.output == on) {
+		return
+	}
+
+	pointType := d.config.OutputPointType
+	if pointType == "" {
+		pointType = data.PointTypeValue
+	}
+
+	err := SendNodePoint(d.nc, d.config.OutputNodeID, data.Point{
+		Time:   time.Now(),
+		Type:   pointType,
+		Value:  data.BoolToFloat(on),
+		Origin: d.config.ID,
+	}, true)
+	if err != nil {
+		log.Printf("Doser %v: error setting output: %v\n", d.config.Description, err)
+		return
+	}
+
+	d.output = &on
+}
+
+// subscribeInputs subscribes to the sensor and interlock points and gets
+// their current values
+func (d *DoserClient) subscribeInputs() {
+	sensorPointType := d.config.SensorPointType
+	if sensorPointType == "" {
+		sensorPointType = data.PointTypeValue
+	}
+
+	for input, nodeID := range map[string]string{
+		doserInputSensor:    d.config.SensorNodeID,
+		doserInputInterlock: d.config.InterlockNodeID,
+	} {
+		pointType := data.PointTypeValue
+		if input == doserInputSensor {
+			pointType = sensorPointType
+		}
+
+		key := nodeID + "." + pointType
+
+		if cur, ok := d.subNode[input]; ok && cur == key {
+			continue
+		}
+
+		if sub, ok := d.subs[input]; ok {
+			sub.Unsubscribe()
+			delete(d.subs, input)
+		}
+
+		delete(d.inputs, input)
+		d.subNode[input] = key
+
+		if nodeID == "" {
+			continue
+		}
+
+		input := input
+
+		sub, err := d.nc.Subscribe(SubjectNodePoints(nodeID), func(msg *nats.Msg) {
+			points, err := DecodePoints(msg)
+			if err != nil {
+				log.Println("Doser: error decoding input points: ", err)
+				return
+			}
+
+			for _, p := range points {
+				if p.Type == pointType {
+					select {
+					case d.newInput <- doserInput{input: input, value: p.Value}:
+					case <-d.stop:
+					}
+				}
+			}
+		})
+		if err != nil {
+			log.Printf("Doser %v: error subscribing to %v input: %v\n",
+				d.config.Description, input, err)
+			continue
+		}
+
+		d.subs[input] = sub
+
+		nodes, err := GetNode(d.nc, nodeID, "none")
+		if err != nil || len(nodes) < 1 {
+			log.Printf("Doser %v: error getting %v input: %v\n",
+				d.config.Description, input, err)
+			continue
+		}
+
+		if v, ok := nodes[0].Points.Value(pointType, ""); ok {
+			d.inputs[input] = v
+			if input == doserInputSensor {
+				d.sensorTime = time.Now()
+			}
+		}
+	}
+}
+
+// Stop sends a signal to the Start function to exit
+func (d *DoserClient) Stop(err error) {
+	close(d.stop)
+}
+
+// Points is called by the Manager when new points for this
+// node are received.
+func (d *DoserClient) Points(nodeID string, points []data.Point) {
+	d.newPoints <- NewPoints{nodeID, "", points}
+}
+
+// EdgePoints is called by the Manager when new edge points for this
+// node are received.
+func (d *DoserClient) EdgePoints(nodeID, parentID string, points []data.Point) {
+	d.newEdgePoints <- NewPoints{nodeID, parentID, points}
+}
@@ -0,0 +1,85 @@
+package client_test
+
+import (
+	"testing"
+
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+	"github.com/simpleiot/simpleiot/server"
+)
+
+func TestDoser(t *testing.T) {
+	nc, root, stop, err := server.TestServer()
+	if err != nil {
+		t.Fatal("Error starting test server: ", err)
+	}
+	defer stop()
+
+	for _, id := range []string{"moisture", "pump", "valve"} {
+		err = client.SendNodeType(nc, client.Variable{ID: id, Parent: root.ID}, "test")
+		if err != nil {
+			t.Fatal("Error sending variable node: ", err)
+		}
+	}
+
+	sendPoint := func(id, typ string, v float64) {
+		t.Helper()
+		err := client.SendNodePoint(nc, id, data.Point{Type: typ, Value: v,
+			Origin: "test"}, true)
+		if err != nil {
+			t.Fatal("Error sending point: ", err)
+		}
+	}
+
+	sendPoint("moisture", data.PointTypeValue, 20)
+	sendPoint("pump", data.PointTypeValue, 1)
+
+	err = client.SendNodeType(nc, client.Doser{
+		ID:              "doser",
+		Parent:          root.ID,
+		Description:     "zone 1",
+		SensorNodeID:    "moisture",
+		Setpoint:        30,
+		Gain:            5,
+		Period:          1,
+		OutputNodeID:    "valve",
+		DailyLimit:      0.08,
+		InterlockNodeID: "pump",
+	}, "test")
+	if err != nil {
+		t.Fatal("Error sending doser node: ", err)
+	}
+
+	// the valve is pulsed at 50% duty
+	waitPointValue(t, nc, "doser", data.PointTypeDuty, 50)
+	waitPointValue(t, nc, "valve", data.PointTypeValue, 1)
+	waitPointValue(t, nc, "valve", data.PointTypeValue, 0)
+	waitPointValue(t, nc, "valve", data.PointTypeValue, 1)
+
+	// the valve closes when the pump stops
+	sendPoint("pump", data.PointTypeValue, 0)
+	waitPointValue(t, nc, "doser", data.PointTypeInterlocked, 1)
+	waitPointValue(t, nc, "valve", data.PointTypeValue, 0)
+	sendPoint("pump", data.PointTypeValue, 1)
+	waitPointValue(t, nc, "doser", data.PointTypeInterlocked, 0)
+
+	// no dosing at the setpoint
+	sendPoint("moisture", data.PointTypeValue, 30)
+	waitPointValue(t, nc, "doser", data.PointTypeDuty, 0)
+
+	// the valve stays open until the daily limit is reached
+	sendPoint("moisture", data.PointTypeValue, 0)
+	waitPointValue(t, nc, "doser", data.PointTypeDuty, 100)
+	waitPointValue(t, nc, "valve", data.PointTypeValue, 1)
+	waitPointValue(t, nc, "doser", data.PointTypeLimitReached, 1)
+	waitPointValue(t, nc, "valve", data.PointTypeValue, 0)
+
+	nodes, err := client.GetNode(nc, "doser", "none")
+	if err != nil || len(nodes) < 1 {
+		t.Fatal("Error getting doser node: ", err)
+	}
+
+	if dose, _ := nodes[0].Points.Value(data.PointTypeDoseToday, ""); dose < 0.08 {
+		t.Error("Dose not correct: ", dose)
+	}
+}
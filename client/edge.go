@@ -3,22 +3,49 @@ package client
 import (
 	"fmt"
 	"log"
+	"math/rand"
 	"net"
 	"time"
 
 	"github.com/nats-io/nats.go"
 )
 
-// EdgeOptions describes options for connecting edge devices
+// EdgeOptions describes options for connecting edge devices. If Proxy is
+// set, connections go through the SOCKS5 or HTTP proxy at that URL (see
+// NewProxyDialer). If WebSocket is set, NATS over WebSocket is used, and
+// nats:// or tls:// URIs are converted to wss:// on port 443 so devices on
+// networks that only allow HTTPS can connect. WSPath is the path of the
+// WebSocket endpoint (for example when the upstream is behind a reverse
+// proxy), which can also be set in the URI (wss://myserver.com/nats).
+// TLSCert and TLSKey are the client certificate files used if the upstream
+// requires client certificates, and TLSCA is the CA bundle used to verify
+// the upstream server. Creds is a NATS credentials file (see
+// IssueDeviceCreds), and CredsData is the contents of one, for example
+// credentials issued after device attestation. Devices authenticated with
+// credentials or certificates must set InboxPrefix to DeviceInbox.
 type EdgeOptions struct {
 	URI          string
 	AuthToken    string
+	Proxy        string
+	WebSocket    bool
+	WSPath       string
+	TLSCert      string
+	TLSKey       string
+	TLSCA        string
+	Creds        string
+	CredsData    string
+	InboxPrefix  string
 	NoEcho       bool
 	Disconnected func()
 	Reconnected  func()
 	Closed       func()
 }
 
+// edgeReconnectSpread is the range reconnect delays of edge devices are
+// randomized over, so devices do not all reconnect at the same time when a
+// server restarts
+const edgeReconnectSpread = 10 * time.Second
+
 // EdgeConnect is a function that attempts connections for edge devices with appropriate
 // timeouts, backups, etc. Currently set to disconnect if we don't have a connection after 6m,
 // and then exp backup to try to connect every 6m after that.
@@ -46,6 +73,32 @@ func EdgeConnect(eo EdgeOptions) (*nats.Conn, error) {
 		// check for other errors
 	}
 
+	dialer := &net.Dialer{
+		KeepAlive: -1,
+	}
+
+	var proxyDialer ProxyDialer
+	if eo.Proxy != "" {
+		var err error
+		proxyDialer, err = NewProxyDialer(eo.Proxy, dialer)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	uri, wsPath := splitURIPath(eo.URI)
+	if eo.WSPath != "" {
+		wsPath = eo.WSPath
+	}
+
+	if eo.WebSocket {
+		var err error
+		uri, err = websocketURI(uri)
+		if err != nil {
+			log.Printf("Error converting URI %v to WebSocket: %v", uri, err)
+		}
+	}
+
 	siotOptions := func(o *nats.Options) error {
 		nats.Timeout(30 * time.Second)(o)
 		nats.DrainTimeout(30 * time.Second)(o)
@@ -55,16 +108,55 @@ func EdgeConnect(eo EdgeOptions) (*nats.Conn, error) {
 		nats.ReconnectBufSize(128 * 1024)(o)
 		nats.ReconnectWait(10 * time.Second)(o)
 		nats.MaxReconnects(-1)(o)
-		nats.SetCustomDialer(&net.Dialer{
-			KeepAlive: -1,
-		})(o)
+		if proxyDialer != nil {
+			nats.SetCustomDialer(proxyDialer)(o)
+		} else {
+			nats.SetCustomDialer(dialer)(o)
+		}
 		nats.CustomReconnectDelay(func(attempts int) time.Duration {
-			delay := ExpBackoff(attempts, 6*time.Minute)
+			delay := ExpBackoff(attempts, 6*time.Minute) +
+				time.Duration(rand.Int63n(int64(edgeReconnectSpread)))
 			log.Printf("NATS reconnect attempts: %v, delay: %v", attempts, delay)
 			return delay
 		})(o)
 		nats.Token(eo.AuthToken)(o)
 
+		if wsPath != "" {
+			nats.ProxyPath(wsPath)(o)
+		}
+
+		if eo.TLSCert != "" {
+			err := nats.ClientCert(eo.TLSCert, eo.TLSKey)(o)
+			if err != nil {
+				return err
+			}
+		}
+
+		if eo.TLSCA != "" {
+			err := nats.RootCAs(eo.TLSCA)(o)
+			if err != nil {
+				return err
+			}
+		}
+
+		if eo.Creds != "" {
+			err := DeviceCreds(eo.Creds)(o)
+			if err != nil {
+				return err
+			}
+		}
+
+		if eo.CredsData != "" {
+			err := DeviceCredsData([]byte(eo.CredsData))(o)
+			if err != nil {
+				return err
+			}
+		}
+
+		if eo.InboxPrefix != "" {
+			nats.CustomInboxPrefix(eo.InboxPrefix)(o)
+		}
+
 		if eo.NoEcho {
 			o.NoEcho = true
 		}
@@ -74,12 +166,21 @@ func EdgeConnect(eo EdgeOptions) (*nats.Conn, error) {
 		return nil
 	}
 
-	uri, err := sanitizeURI(eo.URI)
+	uri, err := sanitizeURI(uri)
 	if err != nil {
 		log.Printf("Error sanitizing URI %v: %v", eo.URI, err)
 	}
 
-	log.Printf("NATS edge connect to: %v, auth enabled: %v", uri, authEnabled)
+	if wsPath != "" {
+		log.Printf("NATS edge WebSocket path: %v", wsPath)
+	}
+
+	if eo.Proxy != "" {
+		log.Printf("NATS edge connect to: %v, auth enabled: %v, through proxy: %v",
+			uri, authEnabled, redactProxy(eo.Proxy))
+	} else {
+		log.Printf("NATS edge connect to: %v, auth enabled: %v", uri, authEnabled)
+	}
 	nc, err := nats.Connect(uri, siotOptions)
 
 	if err != nil {
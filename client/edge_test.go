@@ -0,0 +1,103 @@
+package client_test
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	natsserver "github.com/nats-io/nats-server/v2/server"
+	"github.com/simpleiot/simpleiot/client"
+)
+
+// freePort returns a TCP port that is not in use
+func freePort(t *testing.T) int {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+func TestEdgeConnectWebSocket(t *testing.T) {
+	wsPort := freePort(t)
+	ns, err := natsserver.NewServer(&natsserver.Options{
+		Port:   -1,
+		NoSigs: true,
+		Websocket: natsserver.WebsocketOpts{
+			Host:  "127.0.0.1",
+			Port:  wsPort,
+			NoTLS: true,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go ns.Start()
+	t.Cleanup(ns.Shutdown)
+
+	if !ns.ReadyForConnections(5 * time.Second) {
+		t.Fatal("NATS server not ready")
+	}
+
+	// reverse proxy that records the path WebSocket connections use
+	wsURL, err := url.Parse("http://127.0.0.1:" + strconv.Itoa(wsPort))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rp := httputil.NewSingleHostReverseProxy(wsURL)
+
+	var lock sync.Mutex
+	var paths []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		paths = append(paths, r.URL.Path)
+		lock.Unlock()
+		rp.ServeHTTP(w, r)
+	}))
+	t.Cleanup(proxy.Close)
+
+	nc, err := client.EdgeConnect(client.EdgeOptions{
+		URI:          "ws://" + proxy.Listener.Addr().String(),
+		WebSocket:    true,
+		WSPath:       "/siot/nats",
+		Disconnected: func() {},
+		Reconnected:  func() {},
+		Closed:       func() {},
+	})
+	if err != nil {
+		t.Fatal("Error connecting: ", err)
+	}
+	defer nc.Close()
+
+	sub, err := nc.SubscribeSync("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = nc.Publish("test", []byte("hi"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := sub.NextMsg(5 * time.Second)
+	if err != nil {
+		t.Fatal("Did not get message over WebSocket: ", err)
+	}
+
+	if string(msg.Data) != "hi" {
+		t.Errorf("wrong message: %s", msg.Data)
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	if len(paths) < 1 || paths[0] != "/siot/nats" {
+		t.Errorf("WebSocket path not correct: %v", paths)
+	}
+}
@@ -0,0 +1,324 @@
+package client
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/data"
+	"github.com/simpleiot/simpleiot/msg"
+)
+
+// EmailIngest polls an IMAP mailbox and converts emails into points
+// using the configured patterns. Server is host:port, and TLS is used
+// unless NoTLS is set.
+type EmailIngest struct {
+	ID          string         `node:"id"`
+	Parent      string         `node:"parent"`
+	Description string         `point:"description"`
+	Server      string         `point:"server"`
+	NoTLS       bool           `point:"noTLS"`
+	Username    string         `point:"username"`
+	Pass        string         `point:"pass"`
+	Mailbox     string         `point:"mailbox"`
+	PollPeriod  int            `point:"pollPeriod"`
+	Disable     bool           `point:"disable"`
+	Rx          int            `point:"rx"`
+	ErrorCount  int            `point:"errorCount"`
+	Patterns    []EmailPattern `child:"emailPattern"`
+}
+
+// EmailPattern describes how a point is extracted from an email. From and
+// Subject are optional regular expressions that must match for the pattern
+// to be applied. Regex is matched against the subject and body (separated by
+// a new line) and the first capture group (or the entire match if there are
+// no groups) is used as the point value. If NodeID is not set, points are
+// written to the email ingest node.
+type EmailPattern struct {
+	ID          string `node:"id"`
+	Parent      string `node:"parent"`
+	Description string `point:"description"`
+	From        string `point:"from"`
+	Subject     string `point:"subject"`
+	Regex       string `point:"regex"`
+	NodeID      string `point:"nodeID"`
+	PointType   string `point:"pointType"`
+	PointKey    string `point:"pointKey"`
+	ValueType   string `point:"valueType"`
+}
+
+// EmailIngestClient is a SIOT client that ingests emails
+type EmailIngestClient struct {
+	nc            *nats.Conn
+	config        EmailIngest
+	stop          chan struct{}
+	newPoints     chan NewPoints
+	newEdgePoints chan NewPoints
+}
+
+// NewEmailIngestClient ...
+func NewEmailIngestClient(nc *nats.Conn, config EmailIngest) Client {
+	return &EmailIngestClient{
+		nc:            nc,
+		config:        config,
+		stop:          make(chan struct{}),
+		newPoints:     make(chan NewPoints),
+		newEdgePoints: make(chan NewPoints),
+	}
+}
+
+// Start runs the main logic for this client and blocks until stopped
+func (ei *EmailIngestClient) Start() error {
+	log.Println("Starting email ingest client: ", ei.config.Description)
+
+	pollTicker := time.NewTicker(time.Hour)
+	defer pollTicker.Stop()
+
+	resetTicker := func() {
+		pollPeriod := ei.config.PollPeriod
+		if pollPeriod <= 0 {
+			pollPeriod = 60000
+		}
+		pollTicker.Reset(time.Duration(pollPeriod) * time.Millisecond)
+	}
+
+	resetTicker()
+
+	poll := func() {
+		if ei.config.Disable || ei.config.Server == "" {
+			return
+		}
+
+		err := ei.poll()
+		if err != nil {
+			log.Printf("Email ingest %v: %v\n", ei.config.Description, err)
+			ei.config.ErrorCount++
+			ei.sendStat(data.PointTypeErrorCount, ei.config.ErrorCount)
+		}
+	}
+
+	poll()
+
+done:
+	for {
+		select {
+		case <-ei.stop:
+			log.Println("Stopping email ingest client: ", ei.config.Description)
+			break done
+		case <-pollTicker.C:
+			poll()
+		case pts := <-ei.newPoints:
+			err := data.MergePoints(pts.ID, pts.Points, &ei.config)
+			if err != nil {
+				log.Println("error merging new points: ", err)
+			}
+
+			for _, p := range pts.Points {
+				if p.Type == data.PointTypePollPeriod {
+					resetTicker()
+				}
+			}
+		case pts := <-ei.newEdgePoints:
+			err := data.MergeEdgePoints(pts.ID, pts.Parent, pts.Points, &ei.config)
+			if err != nil {
+				log.Println("error merging new points: ", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// poll processes all unseen messages in the mailbox. Messages are marked
+// as seen once processed.
+func (ei *EmailIngestClient) poll() error {
+	c, err := msg.DialIMAP(ei.config.Server, !ei.config.NoTLS, 30*time.Second)
+	if err != nil {
+		return fmt.Errorf("Error connecting to server: %w", err)
+	}
+	defer c.Logout()
+
+	err = c.Login(ei.config.Username, ei.config.Pass)
+	if err != nil {
+		return fmt.Errorf("Error logging in: %w", err)
+	}
+
+	mailbox := ei.config.Mailbox
+	if mailbox == "" {
+		mailbox = "INBOX"
+	}
+
+	err = c.Select(mailbox)
+	if err != nil {
+		return fmt.Errorf("Error selecting mailbox: %w", err)
+	}
+
+	uids, err := c.SearchUnseen()
+	if err != nil {
+		return fmt.Errorf("Error searching mailbox: %w", err)
+	}
+
+	for _, uid := range uids {
+		raw, err := c.Fetch(uid)
+		if err != nil {
+			return fmt.Errorf("Error fetching message: %w", err)
+		}
+
+		email, err := msg.ParseEmail(raw)
+		if err != nil {
+			log.Printf("Email ingest %v: %v\n", ei.config.Description, err)
+		} else {
+			ei.config.Rx++
+			ei.sendStat(data.PointTypeRx, ei.config.Rx)
+
+			for nodeID, pts := range EmailToPoints(ei.config, email) {
+				err := SendNodePoints(ei.nc, nodeID, pts, true)
+				if err != nil {
+					log.Printf("Email ingest %v: error sending points: %v\n",
+						ei.config.Description, err)
+				}
+			}
+		}
+
+		// messages that can't be parsed are also marked as seen so we
+		// don't process them over and over
+		err = c.MarkSeen(uid)
+		if err != nil {
+			return fmt.Errorf("Error marking message seen: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// EmailToPoints applies the patterns in config to an email and returns the
+// extracted points for each node. The email date is used as the point time
+// if it is set.
+func EmailToPoints(config EmailIngest, email msg.Email) map[string]data.Points {
+	ret := make(map[string]data.Points)
+
+	t := email.Date
+	if t.IsZero() {
+		t = time.Now()
+	}
+
+	text := email.Subject + "\n" + email.Body
+
+	for _, pat := range config.Patterns {
+		if pat.Regex == "" || pat.PointType == "" {
+			continue
+		}
+
+		if !emailMatch(pat.From, email.From) || !emailMatch(pat.Subject, email.Subject) {
+			continue
+		}
+
+		re, err := regexp.Compile(pat.Regex)
+		if err != nil {
+			log.Printf("Email pattern %v: invalid regex: %v\n", pat.Description, err)
+			continue
+		}
+
+		m := re.FindStringSubmatch(text)
+		if m == nil {
+			continue
+		}
+
+		value := m[0]
+		if len(m) > 1 {
+			value = m[1]
+		}
+		value = strings.TrimSpace(value)
+
+		p := data.Point{
+			Time:   t,
+			Type:   pat.PointType,
+			Key:    pat.PointKey,
+			Origin: config.ID,
+		}
+
+		err = setPointValue(&p, pat.ValueType, value)
+		if err != nil {
+			log.Printf("Email pattern %v: %v\n", pat.Description, err)
+			continue
+		}
+
+		nodeID := pat.NodeID
+		if nodeID == "" {
+			nodeID = config.ID
+		}
+
+		ret[nodeID] = append(ret[nodeID], p)
+	}
+
+	return ret
+}
+
+// setPointValue sets the point value or text from a string depending on
+// valueType (number, text, or onOff). Numbers are the default.
+func setPointValue(p *data.Point, valueType, value string) error {
+	switch valueType {
+	case data.PointValueText:
+		p.Text = value
+	case data.PointValueOnOff:
+		switch strings.ToLower(value) {
+		case "on", "true", "1", "yes":
+			p.Value = 1
+		}
+	default:
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("value is not a number: %v", value)
+		}
+		p.Value = v
+	}
+
+	return nil
+}
+
+// emailMatch returns true if pattern is blank or matches s
+func emailMatch(pattern, s string) bool {
+	if pattern == "" {
+		return true
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		log.Println("Email pattern: invalid regex: ", err)
+		return false
+	}
+
+	return re.MatchString(s)
+}
+
+func (ei *EmailIngestClient) sendStat(typ string, value int) {
+	err := SendNodePoint(ei.nc, ei.config.ID, data.Point{
+		Time:  time.Now(),
+		Type:  typ,
+		Value: float64(value),
+	}, false)
+	if err != nil {
+		log.Println("Email ingest: error sending stat: ", err)
+	}
+}
+
+// Stop sends a signal to the Start function to exit
+func (ei *EmailIngestClient) Stop(err error) {
+	close(ei.stop)
+}
+
+// Points is called by the Manager when new points for this
+// node are received.
+func (ei *EmailIngestClient) Points(nodeID string, points []data.Point) {
+	ei.newPoints <- NewPoints{nodeID, "", points}
+}
+
+// EdgePoints is called by the Manager when new edge points for this
+// node are received.
+func (ei *EmailIngestClient) EdgePoints(nodeID, parentID string, points []data.Point) {
+	ei.newEdgePoints <- NewPoints{nodeID, parentID, points}
+}
@@ -0,0 +1,62 @@
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/simpleiot/simpleiot/data"
+	"github.com/simpleiot/simpleiot/msg"
+)
+
+func TestEmailToPoints(t *testing.T) {
+	date := time.Date(2022, 10, 14, 14, 0, 0, 0, time.UTC)
+
+	email := msg.Email{
+		From:    "pump@example.com",
+		Subject: "Alarm station 4",
+		Date:    date,
+		Body:    "Level: 12.5 ft\nStatus: HIGH WATER\nPump: on",
+	}
+
+	config := EmailIngest{
+		ID: "ingest",
+		Patterns: []EmailPattern{
+			{Regex: `Level:\s*([\d.]+)`, PointType: "level", NodeID: "station4"},
+			{Regex: `Status:\s*(.*)`, PointType: "status", ValueType: data.PointValueText,
+				NodeID: "station4"},
+			{Regex: `Pump:\s*(\w+)`, PointType: "pump", PointKey: "1",
+				ValueType: data.PointValueOnOff},
+			// from does not match
+			{From: `other@example\.com`, Regex: `Level:\s*([\d.]+)`, PointType: "x"},
+			// subject does not match
+			{Subject: `^Alarm station 5`, Regex: `Level:\s*([\d.]+)`, PointType: "y"},
+			// value is not a number
+			{Regex: `Status:\s*(.*)`, PointType: "z"},
+		},
+	}
+
+	pts := EmailToPoints(config, email)
+
+	if len(pts) != 2 {
+		t.Fatalf("expected points for 2 nodes, got: %v", pts)
+	}
+
+	station := pts["station4"]
+	if len(station) != 2 {
+		t.Fatal("expected 2 station points, got: ", station)
+	}
+
+	if station[0].Type != "level" || station[0].Value != 12.5 || !station[0].Time.Equal(date) {
+		t.Error("wrong level point: ", station[0])
+	}
+
+	if station[1].Type != "status" || station[1].Text != "HIGH WATER" {
+		t.Error("wrong status point: ", station[1])
+	}
+
+	ingest := pts["ingest"]
+	if len(ingest) != 1 || ingest[0].Type != "pump" || ingest[0].Key != "1" ||
+		ingest[0].Value != 1 || ingest[0].Origin != "ingest" {
+		t.Error("wrong ingest points: ", ingest)
+	}
+}
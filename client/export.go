@@ -0,0 +1,83 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/nats-io/nats.go"
+)
+
+// ExportRequest is sent to export a node and its descendants
+type ExportRequest struct {
+	ID string `json:"id"`
+}
+
+// ImportRequest is sent to import nodes from YAML under Parent. If
+// PreserveIDs is set, the node IDs in the YAML are used, otherwise new IDs
+// are assigned.
+type ImportRequest struct {
+	Parent      string `json:"parent"`
+	PreserveIDs bool   `json:"preserveIds"`
+	Origin      string `json:"origin"`
+	YAML        []byte `json:"yaml"`
+}
+
+// ImportResponse is returned by an import. IDs are the IDs of the top level
+// nodes that were imported.
+type ImportResponse struct {
+	IDs   []string `json:"ids"`
+	Error string   `json:"error,omitempty"`
+}
+
+// ExportNodes returns a node and its descendants as YAML (see data.Export).
+// If id is "root" or empty, the root node is exported.
+func ExportNodes(nc *nats.Conn, id string) ([]byte, error) {
+	req, err := json.Marshal(ExportRequest{ID: id})
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	err = requestChunks(nc, SubjectExport(), req, &buf)
+	if err != nil {
+		return nil, fmt.Errorf("Error exporting nodes: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// ImportNodes imports nodes from YAML (see data.Export) under parent and
+// returns the IDs of the top level nodes. If preserveIDs is set, the node
+// IDs in the YAML are used, which updates nodes that already exist. Otherwise
+// new IDs are assigned, and points in the imported nodes that refer to other
+// imported nodes by ID are updated. The YAML must fit in one NATS message.
+func ImportNodes(nc *nats.Conn, parent string, yaml []byte, preserveIDs bool, origin string) ([]string, error) {
+	req, err := json.Marshal(ImportRequest{
+		Parent:      parent,
+		PreserveIDs: preserveIDs,
+		Origin:      origin,
+		YAML:        yaml,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	msg, err := nc.Request(SubjectImport(), req, storeSnapshotTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("Error importing nodes: %w", err)
+	}
+
+	var resp ImportResponse
+	err = json.Unmarshal(msg.Data, &resp)
+	if err != nil {
+		return nil, fmt.Errorf("Error decoding import response: %w", err)
+	}
+
+	if resp.Error != "" {
+		return nil, errors.New(resp.Error)
+	}
+
+	return resp.IDs, nil
+}
@@ -0,0 +1,464 @@
+package client
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/data"
+	"github.com/simpleiot/simpleiot/file"
+)
+
+// FileIngest polls a local directory, FTP, or SFTP server for CSV or XML
+// files and converts them into points using the configured columns. URI is
+// a local path, ftp://host[:port]/dir, or sftp://host[:port]/dir. Processed
+// files are moved to ProcessedDir (relative to the watched directory) if
+// set, otherwise they are deleted.
+type FileIngest struct {
+	ID            string       `node:"id"`
+	Parent        string       `node:"parent"`
+	Description   string       `point:"description"`
+	URI           string       `point:"uri"`
+	Username      string       `point:"username"`
+	Pass          string       `point:"pass"`
+	HostKey       string       `point:"hostKey"`
+	KnownHosts    string       `point:"knownHosts"`
+	Pattern       string       `point:"pattern"`
+	Format        string       `point:"format"`
+	Delimiter     string       `point:"delimiter"`
+	RecordElement string       `point:"recordElement"`
+	TimeColumn    string       `point:"timeColumn"`
+	TimeFormat    string       `point:"timeFormat"`
+	ProcessedDir  string       `point:"processedDir"`
+	PollPeriod    int          `point:"pollPeriod"`
+	Disable       bool         `point:"disable"`
+	Rx            int          `point:"rx"`
+	ErrorCount    int          `point:"errorCount"`
+	Columns       []FileColumn `child:"fileColumn"`
+}
+
+// FileColumn maps a CSV column or XML field to a point. If NodeID is not
+// set, points are written to the file ingest node.
+type FileColumn struct {
+	ID          string `node:"id"`
+	Parent      string `node:"parent"`
+	Description string `point:"description"`
+	Column      string `point:"column"`
+	NodeID      string `point:"nodeID"`
+	PointType   string `point:"pointType"`
+	PointKey    string `point:"pointKey"`
+	ValueType   string `point:"valueType"`
+}
+
+// fileErrorExt is appended to files that could not be parsed so they are
+// not processed again
+const fileErrorExt = ".error"
+
+// FileIngestClient is a SIOT client that ingests files
+type FileIngestClient struct {
+	nc            *nats.Conn
+	config        FileIngest
+	stop          chan struct{}
+	newPoints     chan NewPoints
+	newEdgePoints chan NewPoints
+}
+
+// NewFileIngestClient ...
+func NewFileIngestClient(nc *nats.Conn, config FileIngest) Client {
+	return &FileIngestClient{
+		nc:            nc,
+		config:        config,
+		stop:          make(chan struct{}),
+		newPoints:     make(chan NewPoints),
+		newEdgePoints: make(chan NewPoints),
+	}
+}
+
+// Start runs the main logic for this client and blocks until stopped
+func (fi *FileIngestClient) Start() error {
+	log.Println("Starting file ingest client: ", fi.config.Description)
+
+	pollTicker := time.NewTicker(time.Hour)
+	defer pollTicker.Stop()
+
+	resetTicker := func() {
+		pollPeriod := fi.config.PollPeriod
+		if pollPeriod <= 0 {
+			pollPeriod = 60000
+		}
+		pollTicker.Reset(time.Duration(pollPeriod) * time.Millisecond)
+	}
+
+	resetTicker()
+
+	poll := func() {
+		if fi.config.Disable || fi.config.URI == "" {
+			return
+		}
+
+		err := fi.poll()
+		if err != nil {
+			log.Printf("File ingest %v: %v\n", fi.config.Description, err)
+			fi.config.ErrorCount++
+			fi.sendStat(data.PointTypeErrorCount, fi.config.ErrorCount)
+		}
+	}
+
+	poll()
+
+done:
+	for {
+		select {
+		case <-fi.stop:
+			log.Println("Stopping file ingest client: ", fi.config.Description)
+			break done
+		case <-pollTicker.C:
+			poll()
+		case pts := <-fi.newPoints:
+			err := data.MergePoints(pts.ID, pts.Points, &fi.config)
+			if err != nil {
+				log.Println("error merging new points: ", err)
+			}
+
+			for _, p := range pts.Points {
+				if p.Type == data.PointTypePollPeriod {
+					resetTicker()
+				}
+			}
+		case pts := <-fi.newEdgePoints:
+			err := data.MergeEdgePoints(pts.ID, pts.Parent, pts.Points, &fi.config)
+			if err != nil {
+				log.Println("error merging new points: ", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// poll processes all matching files in the source directory
+func (fi *FileIngestClient) poll() error {
+	src, err := file.NewSource(fi.config.URI, file.SourceOptions{
+		Username:   fi.config.Username,
+		Password:   fi.config.Pass,
+		HostKey:    fi.config.HostKey,
+		KnownHosts: fi.config.KnownHosts,
+	})
+	if err != nil {
+		return fmt.Errorf("Error opening file source: %w", err)
+	}
+	defer src.Close()
+
+	names, err := src.List()
+	if err != nil {
+		return fmt.Errorf("Error listing files: %w", err)
+	}
+
+	pattern := fi.config.Pattern
+	if pattern == "" {
+		pattern = "*"
+	}
+
+	for _, name := range names {
+		if strings.HasSuffix(name, fileErrorExt) {
+			continue
+		}
+
+		match, err := path.Match(pattern, name)
+		if err != nil {
+			return fmt.Errorf("Invalid file pattern: %w", err)
+		}
+
+		if !match {
+			continue
+		}
+
+		d, err := src.Read(name)
+		if err != nil {
+			return fmt.Errorf("Error reading %v: %w", name, err)
+		}
+
+		pts, err := FileToPoints(fi.config, d)
+		if err != nil {
+			log.Printf("File ingest %v: error parsing %v: %v\n",
+				fi.config.Description, name, err)
+			fi.config.ErrorCount++
+			fi.sendStat(data.PointTypeErrorCount, fi.config.ErrorCount)
+
+			err = src.Rename(name, name+fileErrorExt)
+			if err != nil {
+				return fmt.Errorf("Error renaming %v: %w", name, err)
+			}
+			continue
+		}
+
+		for nodeID, nodePts := range pts {
+			err := SendNodePoints(fi.nc, nodeID, nodePts, true)
+			if err != nil {
+				return fmt.Errorf("Error sending points: %w", err)
+			}
+		}
+
+		fi.config.Rx++
+		fi.sendStat(data.PointTypeRx, fi.config.Rx)
+
+		if fi.config.ProcessedDir != "" {
+			err = src.Rename(name, path.Join(fi.config.ProcessedDir, name))
+		} else {
+			err = src.Remove(name)
+		}
+
+		if err != nil {
+			return fmt.Errorf("Error removing processed file %v: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// FileToPoints parses a CSV or XML file and returns the points for each
+// node using the columns in config. If TimeColumn is set, the time in each
+// record is used as the point time.
+func FileToPoints(config FileIngest, d []byte) (map[string]data.Points, error) {
+	var records []map[string]string
+	var err error
+
+	switch config.Format {
+	case "", data.PointValueCSV:
+		records, err = parseCSVRecords(d, config.Delimiter)
+	case data.PointValueXML:
+		records, err = parseXMLRecords(d, config.RecordElement)
+	default:
+		return nil, fmt.Errorf("unsupported file format: %v", config.Format)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make(map[string]data.Points)
+
+	now := time.Now()
+
+	for i, r := range records {
+		t := now
+
+		if config.TimeColumn != "" {
+			t, err = parseFileTime(r[config.TimeColumn], config.TimeFormat)
+			if err != nil {
+				return nil, fmt.Errorf("record %v: %w", i+1, err)
+			}
+		}
+
+		for _, col := range config.Columns {
+			value, ok := r[col.Column]
+			if !ok || value == "" || col.PointType == "" {
+				continue
+			}
+
+			p := data.Point{
+				Time:   t,
+				Type:   col.PointType,
+				Key:    col.PointKey,
+				Origin: config.ID,
+			}
+
+			err := setPointValue(&p, col.ValueType, value)
+			if err != nil {
+				log.Printf("File column %v: record %v: %v\n", col.Column, i+1, err)
+				continue
+			}
+
+			nodeID := col.NodeID
+			if nodeID == "" {
+				nodeID = config.ID
+			}
+
+			ret[nodeID] = append(ret[nodeID], p)
+		}
+	}
+
+	return ret, nil
+}
+
+// parseFileTime parses a time using format. Format can be a Go time
+// layout, unix (seconds), or unixMs. RFC3339 is the default. Times without
+// a zone are assumed to be local time.
+func parseFileTime(s, format string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}, errors.New("time is blank")
+	}
+
+	switch format {
+	case data.PointValueUnix, data.PointValueUnixMs:
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid time: %v", s)
+		}
+		if format == data.PointValueUnix {
+			v *= 1000
+		}
+		return time.UnixMilli(int64(v)), nil
+	case "":
+		format = time.RFC3339
+	}
+
+	t, err := time.ParseInLocation(format, s, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time: %v", s)
+	}
+
+	return t, nil
+}
+
+// parseCSVRecords parses a CSV file with a header row. Each record maps
+// the header name to the field value.
+func parseCSVRecords(d []byte, delimiter string) ([]map[string]string, error) {
+	d = bytes.TrimPrefix(d, []byte("\xef\xbb\xbf"))
+
+	r := csv.NewReader(bytes.NewReader(d))
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+
+	switch delimiter {
+	case "":
+	case `\t`:
+		r.Comma = '\t'
+	default:
+		r.Comma = []rune(delimiter)[0]
+	}
+
+	header, err := r.Read()
+	if err != nil {
+		return nil, fmt.Errorf("Error reading CSV header: %w", err)
+	}
+
+	for i := range header {
+		header[i] = strings.TrimSpace(header[i])
+	}
+
+	var ret []map[string]string
+
+	for {
+		fields, err := r.Read()
+		if err == io.EOF {
+			return ret, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Error reading CSV: %w", err)
+		}
+
+		rec := make(map[string]string)
+		for i, f := range fields {
+			if i < len(header) {
+				rec[header[i]] = strings.TrimSpace(f)
+			}
+		}
+
+		ret = append(ret, rec)
+	}
+}
+
+// parseXMLRecords returns a record for each element named recordElement
+// (default "record"). Record fields are the attributes of the element and
+// the text of its child elements.
+func parseXMLRecords(d []byte, recordElement string) ([]map[string]string, error) {
+	if recordElement == "" {
+		recordElement = "record"
+	}
+
+	dec := xml.NewDecoder(bytes.NewReader(d))
+
+	var ret []map[string]string
+	var rec map[string]string
+	// depth within the current record
+	depth := 0
+	var field string
+	var text strings.Builder
+
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return ret, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Error reading XML: %w", err)
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if rec == nil {
+				if t.Name.Local == recordElement {
+					rec = make(map[string]string)
+					for _, a := range t.Attr {
+						rec[a.Name.Local] = strings.TrimSpace(a.Value)
+					}
+					depth = 0
+				}
+				continue
+			}
+
+			depth++
+			field = t.Name.Local
+			text.Reset()
+		case xml.CharData:
+			if rec != nil && field != "" {
+				text.Write(t)
+			}
+		case xml.EndElement:
+			if rec == nil {
+				continue
+			}
+
+			if depth == 0 {
+				ret = append(ret, rec)
+				rec = nil
+				continue
+			}
+
+			if field != "" {
+				rec[field] = strings.TrimSpace(text.String())
+				field = ""
+			}
+			depth--
+		}
+	}
+}
+
+func (fi *FileIngestClient) sendStat(typ string, value int) {
+	err := SendNodePoint(fi.nc, fi.config.ID, data.Point{
+		Time:  time.Now(),
+		Type:  typ,
+		Value: float64(value),
+	}, false)
+	if err != nil {
+		log.Println("File ingest: error sending stat: ", err)
+	}
+}
+
+// Stop sends a signal to the Start function to exit
+func (fi *FileIngestClient) Stop(err error) {
+	close(fi.stop)
+}
+
+// Points is called by the Manager when new points for this
+// node are received.
+func (fi *FileIngestClient) Points(nodeID string, points []data.Point) {
+	fi.newPoints <- NewPoints{nodeID, "", points}
+}
+
+// EdgePoints is called by the Manager when new edge points for this
+// node are received.
+func (fi *FileIngestClient) EdgePoints(nodeID, parentID string, points []data.Point) {
+	fi.newEdgePoints <- NewPoints{nodeID, parentID, points}
+}
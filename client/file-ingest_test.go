@@ -0,0 +1,135 @@
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/simpleiot/simpleiot/data"
+)
+
+func TestFileToPointsCSV(t *testing.T) {
+	csv := "\xef\xbb\xbfTimestamp; Level; Pump; Site\n" +
+		"2022-10-14 14:00:00; 12.5; on; north\n" +
+		"2022-10-14 14:05:00; 12.7; off; north\n" +
+		"2022-10-14 14:10:00; ; off; north\n"
+
+	config := FileIngest{
+		ID:         "ingest",
+		Delimiter:  ";",
+		TimeColumn: "Timestamp",
+		TimeFormat: "2006-01-02 15:04:05",
+		Columns: []FileColumn{
+			{Column: "Level", PointType: "level", NodeID: "station4"},
+			{Column: "Pump", PointType: "pump", PointKey: "1",
+				ValueType: data.PointValueOnOff},
+			{Column: "Site", PointType: "site", ValueType: data.PointValueText},
+			// column does not exist
+			{Column: "Flow", PointType: "flow"},
+		},
+	}
+
+	pts, err := FileToPoints(config, []byte(csv))
+	if err != nil {
+		t.Fatal("Error parsing file: ", err)
+	}
+
+	level := pts["station4"]
+	if len(level) != 2 {
+		t.Fatal("Expected 2 level points, got: ", level)
+	}
+
+	t0 := time.Date(2022, 10, 14, 14, 0, 0, 0, time.Local)
+
+	if !level[0].Time.Equal(t0) || level[0].Value != 12.5 {
+		t.Error("Level point 0 not correct: ", level[0])
+	}
+
+	if !level[1].Time.Equal(t0.Add(5*time.Minute)) || level[1].Value != 12.7 {
+		t.Error("Level point 1 not correct: ", level[1])
+	}
+
+	if level[0].Origin != "ingest" {
+		t.Error("Origin not set")
+	}
+
+	ingest := pts["ingest"]
+	if len(ingest) != 6 {
+		t.Fatal("Expected 6 points for ingest node, got: ", ingest)
+	}
+
+	if ingest[0].Type != "pump" || ingest[0].Key != "1" || ingest[0].Value != 1 {
+		t.Error("Pump point not correct: ", ingest[0])
+	}
+
+	if ingest[1].Type != "site" || ingest[1].Text != "north" {
+		t.Error("Site point not correct: ", ingest[1])
+	}
+
+	if ingest[2].Value != 0 {
+		t.Error("Pump should be off: ", ingest[2])
+	}
+}
+
+func TestFileToPointsXML(t *testing.T) {
+	x := `<?xml version="1.0"?>
+<log>
+  <header><site>north</site></header>
+  <sample time="1665756000">
+    <level>12.5</level>
+    <temp units="C">21.2</temp>
+  </sample>
+  <sample time="1665756300">
+    <level>12.7</level>
+  </sample>
+</log>`
+
+	config := FileIngest{
+		ID:            "ingest",
+		Format:        data.PointValueXML,
+		RecordElement: "sample",
+		TimeColumn:    "time",
+		TimeFormat:    data.PointValueUnix,
+		Columns: []FileColumn{
+			{Column: "level", PointType: "level"},
+			{Column: "temp", PointType: "temp"},
+			// outside of record
+			{Column: "site", PointType: "site", ValueType: data.PointValueText},
+		},
+	}
+
+	pts, err := FileToPoints(config, []byte(x))
+	if err != nil {
+		t.Fatal("Error parsing file: ", err)
+	}
+
+	p := pts["ingest"]
+	if len(p) != 3 {
+		t.Fatal("Expected 3 points, got: ", p)
+	}
+
+	if p[0].Type != "level" || p[0].Value != 12.5 ||
+		!p[0].Time.Equal(time.Unix(1665756000, 0)) {
+		t.Error("Point 0 not correct: ", p[0])
+	}
+
+	if p[1].Type != "temp" || p[1].Value != 21.2 {
+		t.Error("Point 1 not correct: ", p[1])
+	}
+
+	if p[2].Type != "level" || p[2].Value != 12.7 ||
+		!p[2].Time.Equal(time.Unix(1665756300, 0)) {
+		t.Error("Point 2 not correct: ", p[2])
+	}
+}
+
+func TestFileToPointsBadTime(t *testing.T) {
+	config := FileIngest{
+		TimeColumn: "time",
+		Columns:    []FileColumn{{Column: "v", PointType: "value"}},
+	}
+
+	_, err := FileToPoints(config, []byte("time,v\nyesterday,1\n"))
+	if err == nil {
+		t.Error("Expected error for invalid time")
+	}
+}
@@ -0,0 +1,559 @@
+package client
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// Generator monitors a standby generator and its automatic transfer switch
+// (ATS). The value points of RunNodeID, FuelNodeID (percent), BatteryNodeID
+// (volts), and ATSNodeID (1 when the load is on the generator) are copied
+// into Running (run input above RunThreshold), FuelLevel, BatteryVoltage,
+// and OnGenerator. If Profile (dse or comap) and ModbusNodeID are set, Modbus
+// IO nodes for the controller registers are created under the Modbus node
+// and any blank input node IDs are set to them.
+//
+// The StartNodeID output (a remote start contact) is turned on while
+// RemoteStart or Exercise is set. Exercise is set weekly on ExerciseWeekday
+// (0 is Sunday) at ExerciseStart (HH:MM, in the node time zone, see
+// NodeLocation) and cleared after
+// ExerciseDuration minutes. If the generator is not running StartTimeout
+// seconds (defaults to 30) after it is started, FailToStart is set and the
+// output is turned off until FailToStart is cleared. LowFuel and LowBattery
+// are set when the inputs drop below FuelLow and BatteryLow, and Runtime is
+// the total hours the generator has run.
+type Generator struct {
+	ID               string  `node:"id"`
+	Parent           string  `node:"parent"`
+	Description      string  `point:"description"`
+	Profile          string  `point:"profile"`
+	ModbusNodeID     string  `point:"modbusNodeID"`
+	ModbusID         int     `point:"modbusID"`
+	RunNodeID        string  `point:"runNodeID"`
+	RunThreshold     float64 `point:"runThreshold"`
+	FuelNodeID       string  `point:"fuelNodeID"`
+	BatteryNodeID    string  `point:"batteryNodeID"`
+	ATSNodeID        string  `point:"atsNodeID"`
+	StartNodeID      string  `point:"startNodeID"`
+	StartTimeout     float64 `point:"startTimeout"`
+	FuelLow          float64 `point:"fuelLow"`
+	BatteryLow       float64 `point:"batteryLow"`
+	ExerciseWeekday  int     `point:"exerciseWeekday"`
+	ExerciseStart    string  `point:"exerciseStart"`
+	ExerciseDuration float64 `point:"exerciseDuration"`
+	RemoteStart      bool    `point:"remoteStart"`
+	Exercise         bool    `point:"exercise"`
+	Disable          bool    `point:"disable"`
+	Running          bool    `point:"running"`
+	FuelLevel        float64 `point:"fuelLevel"`
+	BatteryVoltage   float64 `point:"batteryVoltage"`
+	OnGenerator      bool    `point:"onGenerator"`
+	Runtime          float64 `point:"runtime"`
+	FailToStart      bool    `point:"failToStart"`
+	LowFuel          bool    `point:"lowFuel"`
+	LowBattery       bool    `point:"lowBattery"`
+}
+
+// generator inputs
+const (
+	genInputRun     = "run"
+	genInputFuel    = "fuel"
+	genInputBattery = "battery"
+	genInputATS     = "ats"
+)
+
+// generatorRegister is a controller register in a generator Modbus profile
+type generatorRegister struct {
+	input   string
+	desc    string
+	address int
+	scale   float64
+}
+
+// generatorProfiles are the registers read from common generator
+// controllers. DSE controllers use the GenComm instrumentation page (page 4),
+// and ComAp controllers the InteliLite default register map. Other models or
+// firmware may use different addresses, so the IO nodes can be edited after
+// they are created.
+var generatorProfiles = map[string][]generatorRegister{
+	data.PointValueDSE: {
+		{genInputFuel, "fuel level", 1027, 1},
+		{genInputBattery, "battery voltage", 1029, 0.1},
+		{genInputRun, "engine speed", 1030, 1},
+	},
+	data.PointValueComAp: {
+		{genInputBattery, "battery voltage", 3, 0.1},
+		{genInputRun, "engine speed", 5, 1},
+		{genInputFuel, "fuel level", 7, 1},
+	},
+}
+
+// how often the generator updates runtime and checks the exercise schedule
+var generatorTickPeriod = time.Second
+
+type generatorInput struct {
+	input string
+	value float64
+}
+
+// GeneratorClient is a SIOT client that runs generator nodes
+type GeneratorClient struct {
+	nc            *nats.Conn
+	config        Generator
+	stop          chan struct{}
+	newPoints     chan NewPoints
+	newEdgePoints chan NewPoints
+	newInput      chan generatorInput
+	// input subscriptions and the node they are subscribed to by input
+	subs    map[string]*nats.Subscription
+	subNode map[string]string
+	// output is nil until the start output has been set
+	output *bool
+	// when the start output was turned on
+	startTime time.Time
+	// when the exercise ends, zero if not exercising
+	exerciseEnd   time.Time
+	lastExercise  string
+	lastTick      time.Time
+	lastProfile   string
+	lastProfileID string
+	// time zone of the exercise schedule
+	loc *time.Location
+}
+
+// NewGeneratorClient ...
+func NewGeneratorClient(nc *nats.Conn, config Generator) Client {
+	return &GeneratorClient{
+		nc:            nc,
+		config:        config,
+		stop:          make(chan struct{}),
+		newPoints:     make(chan NewPoints),
+		newEdgePoints: make(chan NewPoints),
+		newInput:      make(chan generatorInput),
+		subs:          make(map[string]*nats.Subscription),
+		subNode:       make(map[string]string),
+	}
+}
+
+// Start runs the main logic for this client and blocks until stopped
+func (g *GeneratorClient) Start() error {
+	log.Println("Starting generator client: ", g.config.Description)
+
+	var err error
+	g.loc, err = NodeLocation(g.nc, g.config.ID)
+	if err != nil {
+		log.Printf("Generator %v: %v\n", g.config.Description, err)
+	}
+
+	g.provision()
+	g.subscribeInputs()
+
+	ticker := time.NewTicker(generatorTickPeriod)
+	defer ticker.Stop()
+
+	g.lastTick = time.Now()
+	g.update(g.lastTick)
+
+done:
+	for {
+		select {
+		case <-g.stop:
+			log.Println("Stopping generator client: ", g.config.Description)
+			break done
+		case now := <-ticker.C:
+			g.tick(now)
+		case in := <-g.newInput:
+			g.setInput(in)
+			g.update(time.Now())
+		case pts := <-g.newPoints:
+			err := data.MergePoints(pts.ID, pts.Points, &g.config)
+			if err != nil {
+				log.Println("error merging new points: ", err)
+			}
+
+			g.provision()
+			g.subscribeInputs()
+			g.update(time.Now())
+		case pts := <-g.newEdgePoints:
+			err := data.MergeEdgePoints(pts.ID, pts.Parent, pts.Points, &g.config)
+			if err != nil {
+				log.Println("error merging new points: ", err)
+			}
+		}
+	}
+
+	// the output is left alone so that the generator does not stop if the
+	// client restarts during a run
+	for _, sub := range g.subs {
+		sub.Unsubscribe()
+	}
+
+	return nil
+}
+
+// inputNodeID returns the node ID configured for an input
+func (g *GeneratorClient) inputNodeID(input string) string {
+	switch input {
+	case genInputRun:
+		return g.config.RunNodeID
+	case genInputFuel:
+		return g.config.FuelNodeID
+	case genInputBattery:
+		return g.config.BatteryNodeID
+	case genInputATS:
+		return g.config.ATSNodeID
+	}
+	return ""
+}
+
+// setInput updates the generator state from an input value
+func (g *GeneratorClient) setInput(in generatorInput) {
+	var points data.Points
+
+	switch in.input {
+	case genInputRun:
+		running := in.value > g.config.RunThreshold
+		if running != g.config.Running {
+			g.config.Running = running
+			points = append(points, data.Point{Type: data.PointTypeRunning,
+				Value: data.BoolToFloat(running)})
+		}
+	case genInputFuel:
+		if in.value != g.config.FuelLevel {
+			g.config.FuelLevel = in.value
+			points = append(points, data.Point{Type: data.PointTypeFuelLevel,
+				Value: in.value})
+		}
+	case genInputBattery:
+		if in.value != g.config.BatteryVoltage {
+			g.config.BatteryVoltage = in.value
+			points = append(points, data.Point{Type: data.PointTypeBatteryVoltage,
+				Value: in.value})
+		}
+	case genInputATS:
+		on := in.value != 0
+		if on != g.config.OnGenerator {
+			g.config.OnGenerator = on
+			points = append(points, data.Point{Type: data.PointTypeOnGenerator,
+				Value: data.BoolToFloat(on)})
+		}
+	}
+
+	g.sendPoints(points)
+}
+
+// tick adds runtime, checks for fail to start, and starts and ends
+// exercise runs
+func (g *GeneratorClient) tick(now time.Time) {
+	elapsed := now.Sub(g.lastTick)
+	g.lastTick = now
+
+	if g.config.Running {
+		g.config.Runtime += elapsed.Hours()
+		g.sendPoints(data.Points{{Type: data.PointTypeRuntime,
+			Value: g.config.Runtime}})
+	}
+
+	g.checkExercise(now)
+	g.update(now)
+}
+
+// checkExercise starts an exercise run if the exercise time is reached, and
+// ends it after the exercise duration
+func (g *GeneratorClient) checkExercise(now time.Time) {
+	duration := time.Duration(g.config.ExerciseDuration * float64(time.Minute))
+
+	if g.config.Exercise {
+		if g.exerciseEnd.IsZero() {
+			g.exerciseEnd = now.Add(duration)
+		}
+
+		if !now.Before(g.exerciseEnd) {
+			log.Println("Generator: exercise complete: ", g.config.Description)
+			g.endExercise()
+		}
+		return
+	}
+
+	g.exerciseEnd = time.Time{}
+
+	if g.config.ExerciseStart == "" || duration <= 0 || g.config.Disable {
+		return
+	}
+
+	matches := reHourMin.FindStringSubmatch(g.config.ExerciseStart)
+	if len(matches) < 3 {
+		return
+	}
+
+	hour, _ := strconv.Atoi(matches[1])
+
+	loc := g.loc
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	nowLoc := now.In(loc)
+	today := nowLoc.Format("2006-01-02")
+	if g.lastExercise == today ||
+		nowLoc.Weekday() != time.Weekday(g.config.ExerciseWeekday) ||
+		fmt.Sprintf("%02d:%v", hour, matches[2]) != nowLoc.Format("15:04") {
+		return
+	}
+
+	g.lastExercise = today
+
+	if g.config.FailToStart {
+		log.Println("Generator: exercise skipped, fail to start is set: ",
+			g.config.Description)
+		return
+	}
+
+	log.Println("Generator: starting exercise: ", g.config.Description)
+	g.config.Exercise = true
+	g.exerciseEnd = now.Add(duration)
+	g.sendPoints(data.Points{{Type: data.PointTypeExercise, Value: 1}})
+}
+
+func (g *GeneratorClient) endExercise() {
+	g.config.Exercise = false
+	g.exerciseEnd = time.Time{}
+	g.sendPoints(data.Points{{Type: data.PointTypeExercise, Value: 0}})
+}
+
+// update sets the start output and checks alarms
+func (g *GeneratorClient) update(now time.Time) {
+	on := !g.config.Disable && !g.config.FailToStart &&
+		(g.config.RemoteStart || g.config.Exercise)
+
+	g.setOutput(on, now)
+
+	timeout := time.Duration(g.config.StartTimeout * float64(time.Second))
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+
+	var points data.Points
+
+	if g.output != nil && *g.output && !g.config.Running &&
+		g.config.RunNodeID != "" && now.Sub(g.startTime) >= timeout {
+		log.Println("Generator: fail to start: ", g.config.Description)
+		g.config.FailToStart = true
+		points = append(points, data.Point{Type: data.PointTypeFailToStart, Value: 1})
+		g.setOutput(false, now)
+		if g.config.Exercise {
+			g.endExercise()
+		}
+	}
+
+	lowFuel := g.config.FuelLow > 0 && g.config.FuelNodeID != "" &&
+		g.config.FuelLevel < g.config.FuelLow
+	if lowFuel != g.config.LowFuel {
+		g.config.LowFuel = lowFuel
+		points = append(points, data.Point{Type: data.PointTypeLowFuel,
+			Value: data.BoolToFloat(lowFuel)})
+	}
+
+	lowBattery := g.config.BatteryLow > 0 && g.config.BatteryNodeID != "" &&
+		g.config.BatteryVoltage < g.config.BatteryLow
+	if lowBattery != g.config.LowBattery {
+		g.config.LowBattery = lowBattery
+		points = append(points, data.Point{Type: data.PointTypeLowBattery,
+			Value: data.BoolToFloat(lowBattery)})
+	}
+
+	g.sendPoints(points)
+}
+
+// setOutput turns the start output on or off if it is not already
+func (g *GeneratorClient) setOutput(on bool, now time.Time) {
+	if g.config.StartNodeID == "" || (g.output != nil && *g.output == on) {
+		return
+	}
+
+	err := SendNodePoint(g.nc, g.config.StartNodeID, data.Point{
+		Time:   now,
+		Type:   data.PointTypeValue,
+		Value:  data.BoolToFloat(on),
+		Origin: g.config.ID,
+	}, true)
+	if err != nil {
+		log.Printf("Generator %v: error setting start output: %v\n",
+			g.config.Description, err)
+		return
+	}
+
+	g.output = &on
+	if on {
+		g.startTime = now
+	}
+}
+
+func (g *GeneratorClient) sendPoints(points data.Points) {
+	if len(points) <= 0 {
+		return
+	}
+
+	now := time.Now()
+	for i := range points {
+		points[i].Time = now
+	}
+
+	err := SendNodePoints(g.nc, g.config.ID, points, false)
+	if err != nil {
+		log.Println("Generator: error sending points: ", err)
+	}
+}
+
+// provision creates the Modbus IO nodes for the controller profile and sets
+// any blank input node IDs to them. Existing IO nodes are not changed.
+func (g *GeneratorClient) provision() {
+	regs, ok := generatorProfiles[g.config.Profile]
+	if !ok || g.config.ModbusNodeID == "" {
+		return
+	}
+
+	if g.lastProfile == g.config.Profile && g.lastProfileID == g.config.ModbusNodeID {
+		return
+	}
+
+	g.lastProfile = g.config.Profile
+	g.lastProfileID = g.config.ModbusNodeID
+
+	var points data.Points
+
+	for _, r := range regs {
+		id := g.config.ID + "-" + r.input
+
+		nodes, err := GetNode(g.nc, id, "none")
+		if err != nil && err != data.ErrDocumentNotFound {
+			log.Printf("Generator %v: error getting IO node: %v\n",
+				g.config.Description, err)
+			continue
+		}
+
+		if len(nodes) <= 0 {
+			err = SendNode(g.nc, data.NodeEdge{
+				ID:     id,
+				Type:   data.NodeTypeModbusIO,
+				Parent: g.config.ModbusNodeID,
+				Points: data.Points{
+					{Type: data.PointTypeDescription,
+						Text: g.config.Description + " " + r.desc},
+					{Type: data.PointTypeID, Value: float64(g.config.ModbusID)},
+					{Type: data.PointTypeAddress, Value: float64(r.address)},
+					{Type: data.PointTypeModbusIOType,
+						Text: data.PointValueModbusHoldingRegister},
+					{Type: data.PointTypeDataFormat, Text: data.PointValueUINT16},
+					{Type: data.PointTypeScale, Value: r.scale},
+					{Type: data.PointTypeOffset, Value: 0},
+					{Type: data.PointTypeReadOnly, Value: 1},
+				},
+			}, g.config.ID)
+			if err != nil {
+				log.Printf("Generator %v: error creating IO node: %v\n",
+					g.config.Description, err)
+				continue
+			}
+		}
+
+		if g.inputNodeID(r.input) != "" {
+			continue
+		}
+
+		switch r.input {
+		case genInputRun:
+			g.config.RunNodeID = id
+			points = append(points, data.Point{Type: data.PointTypeRunNodeID, Text: id})
+		case genInputFuel:
+			g.config.FuelNodeID = id
+			points = append(points, data.Point{Type: data.PointTypeFuelNodeID, Text: id})
+		case genInputBattery:
+			g.config.BatteryNodeID = id
+			points = append(points, data.Point{Type: data.PointTypeBatteryNodeID, Text: id})
+		}
+	}
+
+	g.sendPoints(points)
+}
+
+// subscribeInputs subscribes to the value points of the input nodes and gets
+// their current values
+func (g *GeneratorClient) subscribeInputs() {
+	for _, input := range []string{genInputRun, genInputFuel, genInputBattery,
+		genInputATS} {
+		nodeID := g.inputNodeID(input)
+		if g.subNode[input] == nodeID {
+			continue
+		}
+
+		if sub, ok := g.subs[input]; ok {
+			sub.Unsubscribe()
+			delete(g.subs, input)
+		}
+
+		g.subNode[input] = nodeID
+
+		if nodeID == "" {
+			continue
+		}
+
+		input := input
+
+		sub, err := g.nc.Subscribe(SubjectNodePoints(nodeID), func(msg *nats.Msg) {
+			points, err := DecodePoints(msg)
+			if err != nil {
+				log.Println("Generator: error decoding input points: ", err)
+				return
+			}
+
+			for _, p := range points {
+				if p.Type == data.PointTypeValue {
+					select {
+					case g.newInput <- generatorInput{input: input, value: p.Value}:
+					case <-g.stop:
+					}
+				}
+			}
+		})
+		if err != nil {
+			log.Printf("Generator %v: error subscribing to %v input: %v\n",
+				g.config.Description, input, err)
+			continue
+		}
+
+		g.subs[input] = sub
+
+		nodes, err := GetNode(g.nc, nodeID, "none")
+		if err != nil || len(nodes) < 1 {
+			log.Printf("Generator %v: error getting %v input: %v\n",
+				g.config.Description, input, err)
+			continue
+		}
+
+		v, _ := nodes[0].Points.Value(data.PointTypeValue, "")
+		g.setInput(generatorInput{input: input, value: v})
+	}
+}
+
+// Stop sends a signal to the Start function to exit
+func (g *GeneratorClient) Stop(err error) {
+	close(g.stop)
+}
+
+// Points is called by the Manager when new points for this
+// node are received.
+func (g *GeneratorClient) Points(nodeID string, points []data.Point) {
+	g.newPoints <- NewPoints{nodeID, "", points}
+}
+
+// EdgePoints is called by the Manager when new edge points for this
+// node are received.
+func (g *GeneratorClient) EdgePoints(nodeID, parentID string, points []data.Point) {
+	g.newEdgePoints <- NewPoints{nodeID, parentID, points}
+}
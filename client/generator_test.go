@@ -0,0 +1,76 @@
+package client_test
+
+import (
+	"testing"
+
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+	"github.com/simpleiot/simpleiot/server"
+)
+
+func TestGenerator(t *testing.T) {
+	nc, root, stop, err := server.TestServer()
+	if err != nil {
+		t.Fatal("Error starting test server: ", err)
+	}
+	defer stop()
+
+	for _, id := range []string{"run", "fuel", "start"} {
+		err = client.SendNodeType(nc, client.Variable{ID: id, Parent: root.ID}, "test")
+		if err != nil {
+			t.Fatal("Error sending variable node: ", err)
+		}
+	}
+
+	err = client.SendNodeType(nc, client.Generator{
+		ID:           "gen",
+		Parent:       root.ID,
+		Description:  "site generator",
+		RunNodeID:    "run",
+		RunThreshold: 300,
+		FuelNodeID:   "fuel",
+		StartNodeID:  "start",
+		StartTimeout: 1,
+		FuelLow:      20,
+	}, "test")
+	if err != nil {
+		t.Fatal("Error sending generator node: ", err)
+	}
+
+	sendPoint := func(id, typ string, v float64) {
+		t.Helper()
+		err := client.SendNodePoint(nc, id, data.Point{Type: typ, Value: v,
+			Origin: "test"}, true)
+		if err != nil {
+			t.Fatal("Error sending point: ", err)
+		}
+	}
+
+	// the fuel level is 0 until the fuel sensor reports
+	waitPointValue(t, nc, "gen", data.PointTypeLowFuel, 1)
+
+	sendPoint("fuel", data.PointTypeValue, 15)
+	waitPointValue(t, nc, "gen", data.PointTypeFuelLevel, 15)
+
+	sendPoint("fuel", data.PointTypeValue, 80)
+	waitPointValue(t, nc, "gen", data.PointTypeLowFuel, 0)
+
+	// the generator starts and runs
+	sendPoint("gen", data.PointTypeRemoteStart, 1)
+	waitPointValue(t, nc, "start", data.PointTypeValue, 1)
+	sendPoint("run", data.PointTypeValue, 1500)
+	waitPointValue(t, nc, "gen", data.PointTypeRunning, 1)
+
+	sendPoint("gen", data.PointTypeRemoteStart, 0)
+	waitPointValue(t, nc, "start", data.PointTypeValue, 0)
+	sendPoint("run", data.PointTypeValue, 0)
+	waitPointValue(t, nc, "gen", data.PointTypeRunning, 0)
+
+	// the generator does not start during an exercise run
+	sendPoint("gen", data.PointTypeExerciseDuration, 1)
+	sendPoint("gen", data.PointTypeExercise, 1)
+	waitPointValue(t, nc, "start", data.PointTypeValue, 1)
+	waitPointValue(t, nc, "gen", data.PointTypeFailToStart, 1)
+	waitPointValue(t, nc, "start", data.PointTypeValue, 0)
+	waitPointValue(t, nc, "gen", data.PointTypeExercise, 0)
+}
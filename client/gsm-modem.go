@@ -0,0 +1,323 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jacobsa/go-serial/serial"
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/data"
+	"github.com/simpleiot/simpleiot/msg"
+	"github.com/simpleiot/simpleiot/respreader"
+)
+
+// GsmModem represents a GSM modem used to receive command SMS messages.
+// AllowedSenders is a comma separated list of phone numbers that are allowed
+// to send commands, and TargetNodes a comma separated list of the node IDs
+// commands can write to.
+type GsmModem struct {
+	ID             string `node:"id"`
+	Parent         string `node:"parent"`
+	Description    string `point:"description"`
+	Port           string `point:"port"`
+	Baud           int    `point:"baud"`
+	PollPeriod     int    `point:"pollPeriod"`
+	AllowedSenders string `point:"allowedSenders"`
+	TargetNodes    string `point:"targetNodes"`
+	Disable        bool   `point:"disable"`
+	Rx             int    `point:"rx"`
+	Tx             int    `point:"tx"`
+	ErrorCount     int    `point:"errorCount"`
+}
+
+// GsmModemClient is a SIOT client that polls a serial GSM modem for received
+// SMS messages. Commands from allowed senders are written to node points.
+// Alerts are sent through the GSM modem message service (see msg.GsmModem),
+// which can use the same modem, as the port is only open while it is used.
+type GsmModemClient struct {
+	nc            *nats.Conn
+	config        GsmModem
+	stop          chan struct{}
+	newPoints     chan NewPoints
+	newEdgePoints chan NewPoints
+}
+
+// NewGsmModemClient ...
+func NewGsmModemClient(nc *nats.Conn, config GsmModem) Client {
+	return &GsmModemClient{
+		nc:            nc,
+		config:        config,
+		stop:          make(chan struct{}),
+		newPoints:     make(chan NewPoints),
+		newEdgePoints: make(chan NewPoints),
+	}
+}
+
+// Start runs the main logic for this client and blocks until stopped
+func (gm *GsmModemClient) Start() error {
+	log.Println("Starting GSM modem client: ", gm.config.Description)
+
+	pollTicker := time.NewTicker(time.Hour)
+	pollTicker.Stop()
+	defer pollTicker.Stop()
+
+	resetPoll := func() {
+		pollTicker.Stop()
+
+		if gm.config.Disable {
+			return
+		}
+
+		if gm.config.Port == "" {
+			log.Printf("GSM modem %v port not configured\n", gm.config.Description)
+			return
+		}
+
+		pollPeriod := gm.config.PollPeriod
+		if pollPeriod <= 0 {
+			pollPeriod = 10000
+		}
+
+		pollTicker.Reset(time.Duration(pollPeriod) * time.Millisecond)
+	}
+
+	resetPoll()
+
+done:
+	for {
+		select {
+		case <-gm.stop:
+			log.Println("Stopping GSM modem client: ", gm.config.Description)
+			break done
+		case <-pollTicker.C:
+			gm.poll()
+		case pts := <-gm.newPoints:
+			err := data.MergePoints(pts.ID, pts.Points, &gm.config)
+			if err != nil {
+				log.Println("error merging new points: ", err)
+			}
+
+			for _, p := range pts.Points {
+				switch p.Type {
+				case data.PointTypePort, data.PointTypePollPeriod,
+					data.PointTypeDisable:
+					resetPoll()
+				}
+			}
+		case pts := <-gm.newEdgePoints:
+			err := data.MergeEdgePoints(pts.ID, pts.Parent, pts.Points, &gm.config)
+			if err != nil {
+				log.Println("error merging new points: ", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// poll opens the modem port, processes received messages, and closes the
+// port again
+func (gm *GsmModemClient) poll() {
+	unlock := msg.GsmLockPort(gm.config.Port)
+	defer unlock()
+
+	baud := gm.config.Baud
+	if baud <= 0 {
+		baud = 115200
+	}
+
+	options := serial.OpenOptions{
+		PortName:              gm.config.Port,
+		BaudRate:              uint(baud),
+		DataBits:              8,
+		StopBits:              1,
+		MinimumReadSize:       0,
+		InterCharacterTimeout: 100,
+	}
+
+	p, err := serial.Open(options)
+	if err != nil {
+		gm.modemError(fmt.Errorf("Error opening port: %w", err))
+		return
+	}
+
+	port := respreader.NewReadWriteCloser(p, 10*time.Second, 100*time.Millisecond)
+	defer port.Close()
+
+	received, err := msg.GsmReadSMS(port)
+	if err != nil {
+		gm.modemError(err)
+		return
+	}
+
+	for _, sms := range received {
+		reply := gm.handleSMS(sms)
+		if reply != "" {
+			err := msg.GsmSendSMS(port, sms.From, reply)
+			if err != nil {
+				gm.modemError(err)
+			} else {
+				gm.config.Tx++
+				gm.sendStat(data.PointTypeTx, gm.config.Tx)
+			}
+		}
+
+		err := msg.GsmDeleteSMS(port, sms.Index)
+		if err != nil {
+			gm.modemError(err)
+		}
+	}
+}
+
+func (gm *GsmModemClient) modemError(err error) {
+	log.Printf("GSM modem %v: %v\n", gm.config.Description, err)
+	gm.config.ErrorCount++
+	gm.sendStat(data.PointTypeErrorCount, gm.config.ErrorCount)
+}
+
+// handleSMS processes a received SMS and returns the reply that should
+// be sent to the sender. Messages from senders that are not allowed are
+// ignored and no reply is sent.
+func (gm *GsmModemClient) handleSMS(sms msg.GsmSMS) string {
+	if !smsSenderAllowed(gm.config.AllowedSenders, sms.From) {
+		log.Printf("GSM modem %v: ignoring SMS from %v\n", gm.config.Description, sms.From)
+		return ""
+	}
+
+	gm.config.Rx++
+	gm.sendStat(data.PointTypeRx, gm.config.Rx)
+
+	nodeID, p, err := ParseSMSCommand(sms.Text)
+	if err != nil {
+		return "Error: " + err.Error()
+	}
+
+	if !smsTargetAllowed(gm.config.TargetNodes, nodeID) {
+		log.Printf("GSM modem %v: %v is not allowed to write node %v\n",
+			gm.config.Description, sms.From, nodeID)
+		return "Error: node not allowed"
+	}
+
+	p.Origin = gm.config.ID
+
+	err = SendNodePoint(gm.nc, nodeID, p, true)
+	if err != nil {
+		return "Error: " + err.Error()
+	}
+
+	return "OK"
+}
+
+func (gm *GsmModemClient) sendStat(typ string, value int) {
+	err := SendNodePoint(gm.nc, gm.config.ID, data.Point{
+		Time:  time.Now(),
+		Type:  typ,
+		Value: float64(value),
+	}, false)
+	if err != nil {
+		log.Println("GSM modem: error sending stat: ", err)
+	}
+}
+
+// normalizePhone removes formatting characters from a phone number
+func normalizePhone(phone string) string {
+	return strings.Map(func(r rune) rune {
+		if (r >= '0' && r <= '9') || r == '+' {
+			return r
+		}
+		return -1
+	}, phone)
+}
+
+// smsSenderAllowed returns true if from is in the comma separated list of
+// allowed senders
+func smsSenderAllowed(allowed, from string) bool {
+	from = normalizePhone(from)
+	if from == "" {
+		return false
+	}
+
+	for _, a := range strings.Split(allowed, ",") {
+		if normalizePhone(a) == from {
+			return true
+		}
+	}
+
+	return false
+}
+
+// smsTargetAllowed returns true if nodeID is in the comma separated list of
+// target nodes
+func smsTargetAllowed(targets, nodeID string) bool {
+	for _, t := range strings.Split(targets, ",") {
+		if t = strings.TrimSpace(t); t != "" && t == nodeID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ParseSMSCommand parses a SMS command of the form:
+//
+//	<node ID> <point type>[:<point key>] <value>
+//
+// Numeric values are written to the point value, on/off and true/false to
+// 1/0, and anything else to the point text.
+func ParseSMSCommand(text string) (string, data.Point, error) {
+	fields := strings.Fields(text)
+	if len(fields) < 3 {
+		return "", data.Point{}, errors.New("command format: <node ID> <point type> <value>")
+	}
+
+	p := data.Point{Time: time.Now()}
+
+	p.Type = fields[1]
+	if i := strings.Index(p.Type, ":"); i >= 0 {
+		p.Key = p.Type[i+1:]
+		p.Type = p.Type[:i]
+	}
+
+	if p.Type == "" {
+		return "", data.Point{}, errors.New("point type must be set")
+	}
+
+	value := strings.Join(fields[2:], " ")
+
+	switch strings.ToLower(value) {
+	case "on", "true":
+		p.Value = 1
+	case "off", "false":
+		p.Value = 0
+	default:
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			p.Text = value
+		} else {
+			p.Value = v
+		}
+	}
+
+	return fields[0], p, nil
+}
+
+// Stop sends a signal to the Start function to exit
+func (gm *GsmModemClient) Stop(err error) {
+	close(gm.stop)
+}
+
+// Points is called by the Manager when new points for this
+// node are received.
+func (gm *GsmModemClient) Points(nodeID string, points []data.Point) {
+	gm.newPoints <- NewPoints{nodeID, "", points}
+}
+
+// EdgePoints is called by the Manager when new edge points for this
+// node are received.
+func (gm *GsmModemClient) EdgePoints(nodeID, parentID string, points []data.Point) {
+	gm.newEdgePoints <- NewPoints{nodeID, parentID, points}
+}
@@ -0,0 +1,76 @@
+package client
+
+import (
+	"testing"
+
+	"github.com/simpleiot/simpleiot/data"
+)
+
+func TestParseSMSCommand(t *testing.T) {
+	tests := []struct {
+		text   string
+		nodeID string
+		point  data.Point
+		err    bool
+	}{
+		{"123 value 10.5", "123", data.Point{Type: "value", Value: 10.5}, false},
+		{"123 valueSet:pump ON", "123", data.Point{Type: "valueSet", Key: "pump", Value: 1}, false},
+		{"123 valueSet off", "123", data.Point{Type: "valueSet", Value: 0}, false},
+		{"123 description main tank", "123", data.Point{Type: "description", Text: "main tank"}, false},
+		{"123 value", "", data.Point{}, true},
+		{"123 :key 1", "", data.Point{}, true},
+	}
+
+	for _, test := range tests {
+		nodeID, p, err := ParseSMSCommand(test.text)
+		if (err != nil) != test.err {
+			t.Errorf("%v: unexpected error result: %v", test.text, err)
+			continue
+		}
+
+		if test.err {
+			continue
+		}
+
+		if nodeID != test.nodeID || p.Type != test.point.Type || p.Key != test.point.Key ||
+			p.Value != test.point.Value || p.Text != test.point.Text {
+			t.Errorf("%v: got %v %v", test.text, nodeID, p)
+		}
+	}
+}
+
+func TestSMSSenderAllowed(t *testing.T) {
+	allowed := "+1 (555) 555-1234, +15555554321"
+
+	if !smsSenderAllowed(allowed, "+15555551234") {
+		t.Error("expected sender to be allowed")
+	}
+
+	if !smsSenderAllowed(allowed, "+1 555 555 4321") {
+		t.Error("expected formatted sender to be allowed")
+	}
+
+	if smsSenderAllowed(allowed, "+15555550000") {
+		t.Error("expected sender to be rejected")
+	}
+
+	if smsSenderAllowed("", "") {
+		t.Error("empty sender must not be allowed")
+	}
+}
+
+func TestSMSTargetAllowed(t *testing.T) {
+	targets := "123, 456"
+
+	if !smsTargetAllowed(targets, "456") {
+		t.Error("expected target to be allowed")
+	}
+
+	if smsTargetAllowed(targets, "789") {
+		t.Error("expected target to be rejected")
+	}
+
+	if smsTargetAllowed("", "") {
+		t.Error("empty target must not be allowed")
+	}
+}
@@ -0,0 +1,29 @@
+package client
+
+import (
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// HeartbeatPeriod is how often heartbeats are published for running
+// clients. If no heartbeat is received for a client node for three periods,
+// the manager sets the offline point of the node.
+var HeartbeatPeriod = 10 * time.Second
+
+// number of heartbeat periods without a heartbeat before a client is offline
+const heartbeatsMissed = 3
+
+// HeartbeatReporter is implemented by clients that publish their own
+// heartbeats with SendHeartbeat at least every HeartbeatPeriod from their
+// main loop, so the manager can tell if the loop hangs anywhere. For other
+// clients, heartbeats are published for them as long as they are running and
+// accept point updates.
+type HeartbeatReporter interface {
+	ReportsHeartbeat() bool
+}
+
+// SendHeartbeat publishes a heartbeat for a client node
+func SendHeartbeat(nc *nats.Conn, nodeID string) error {
+	return nc.Publish(SubjectClientHealth(nodeID), nil)
+}
@@ -0,0 +1,207 @@
+package client
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// High rate points are published on phr.<nodeID> (and phrup.<parent>.<nodeID>)
+// and bypass the store. Large sample buffers are sent in chunks. Each chunk
+// is a normal protobuf points message with the following headers, so
+// subscribers that decode the points directly still work.
+const (
+	// HeaderHRBatch is a unique ID of the sample buffer the chunk is part of
+	HeaderHRBatch = "Siot-Hr-Batch"
+	// HeaderHRChunk is the index of the chunk in the buffer, starting at 0
+	HeaderHRChunk = "Siot-Hr-Chunk"
+	// HeaderHRChunks is the number of chunks in the buffer
+	HeaderHRChunks = "Siot-Hr-Chunks"
+	// HeaderHRRate is the sample rate in Hz
+	HeaderHRRate = "Siot-Hr-Rate"
+)
+
+// DefaultHighRateChunkSize is the default max number of points in each high
+// rate message, which keeps messages well below the NATS max payload
+const DefaultHighRateChunkSize = 1000
+
+// maxHighRateChunks limits the number of chunks a subscriber reassembles
+const maxHighRateChunks = 10000
+
+// how long a subscriber waits for the rest of the chunks of a buffer
+var highRateReassemblyTimeout = 10 * time.Second
+
+// HighRateOptions are used to send high rate points. If Parent is set, the
+// points are also published on phrup.<Parent>.<nodeID> for upstream
+// consumers (db, cloud forwarder, etc). Rate is the sample rate in Hz sent
+// to subscribers, 0 if unknown. Buffers are split into chunks of at most
+// ChunkSize points (DefaultHighRateChunkSize if 0).
+type HighRateOptions struct {
+	Parent    string
+	Rate      float64
+	ChunkSize int
+}
+
+// HighRatePoints is a buffer of high rate points received by
+// SubscribeHighRate. Rate is 0 if the sender did not specify it.
+type HighRatePoints struct {
+	NodeID string
+	Points data.Points
+	Rate   float64
+}
+
+// SendHighRatePoints sends a buffer of high rate points for a node, for
+// example kHz vibration or energy samples. The points bypass the store and
+// are split into chunks that SubscribeHighRate reassembles.
+func SendHighRatePoints(nc *nats.Conn, nodeID string, points data.Points, o HighRateOptions) error {
+	chunkSize := o.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = DefaultHighRateChunkSize
+	}
+
+	if len(points) <= 0 {
+		return nil
+	}
+
+	chunks := (len(points) + chunkSize - 1) / chunkSize
+	if chunks > maxHighRateChunks {
+		return fmt.Errorf("high rate buffer of %v points needs more than %v chunks",
+			len(points), maxHighRateChunks)
+	}
+
+	now := time.Now()
+	for i := range points {
+		if points[i].Time.IsZero() {
+			points[i].Time = now
+		}
+	}
+
+	subjects := []string{SubjectNodeHRPoints(nodeID)}
+	if o.Parent != "" {
+		subjects = append(subjects, SubjectNodeHRUpPoints(o.Parent, nodeID))
+	}
+
+	batch := uuid.New().String()
+
+	for c := 0; c < chunks; c++ {
+		end := (c + 1) * chunkSize
+		if end > len(points) {
+			end = len(points)
+		}
+
+		chunk := points[c*chunkSize : end]
+		d, err := chunk.ToPb()
+		if err != nil {
+			return err
+		}
+
+		for _, subject := range subjects {
+			msg := nats.NewMsg(subject)
+			msg.Header.Set(HeaderHRBatch, batch)
+			msg.Header.Set(HeaderHRChunk, strconv.Itoa(c))
+			msg.Header.Set(HeaderHRChunks, strconv.Itoa(chunks))
+			if o.Rate > 0 {
+				msg.Header.Set(HeaderHRRate, strconv.FormatFloat(o.Rate, 'f', -1, 64))
+			}
+			msg.Data = d
+
+			err = nc.PublishMsg(msg)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// highRateBatch is a buffer that is being reassembled
+type highRateBatch struct {
+	chunks   []data.Points
+	received int
+	start    time.Time
+}
+
+// SubscribeHighRate subscribes to high rate points of a node (nodeID can be
+// "*" for all nodes) and calls callback with each buffer once all of its
+// chunks are received. Messages sent without chunk headers (for example by
+// the serial client) are passed on as they are. Buffers with missing chunks
+// are dropped. stop() can be called to clean up the subscription.
+func SubscribeHighRate(nc *nats.Conn, nodeID string, callback func(hr HighRatePoints)) (stop func(), err error) {
+	var lock sync.Mutex
+	batches := make(map[string]*highRateBatch)
+
+	sub, err := nc.Subscribe(SubjectNodeHRPoints(nodeID), func(msg *nats.Msg) {
+		points, err := DecodePoints(msg)
+		if err != nil {
+			log.Println("Error decoding high rate points: ", err)
+			return
+		}
+
+		hr := HighRatePoints{NodeID: strings.TrimPrefix(msg.Subject, "phr.")}
+		hr.Rate, _ = strconv.ParseFloat(msg.Header.Get(HeaderHRRate), 64)
+
+		batch := msg.Header.Get(HeaderHRBatch)
+		chunk, errChunk := strconv.Atoi(msg.Header.Get(HeaderHRChunk))
+		chunks, errChunks := strconv.Atoi(msg.Header.Get(HeaderHRChunks))
+		if batch == "" || errChunk != nil || errChunks != nil || chunks <= 1 {
+			hr.Points = points
+			callback(hr)
+			return
+		}
+
+		if chunks > maxHighRateChunks || chunk < 0 || chunk >= chunks {
+			log.Printf("Invalid high rate chunk %v/%v\n", chunk, chunks)
+			return
+		}
+
+		lock.Lock()
+		for id, b := range batches {
+			if time.Since(b.start) > highRateReassemblyTimeout {
+				log.Printf("Dropping high rate buffer for %v, received %v/%v chunks\n",
+					hr.NodeID, b.received, len(b.chunks))
+				delete(batches, id)
+			}
+		}
+
+		b, ok := batches[batch]
+		if !ok {
+			b = &highRateBatch{chunks: make([]data.Points, chunks), start: time.Now()}
+			batches[batch] = b
+		}
+
+		if len(b.chunks) != chunks || b.chunks[chunk] != nil {
+			lock.Unlock()
+			log.Println("Duplicate or inconsistent high rate chunk for batch: ", batch)
+			return
+		}
+
+		b.chunks[chunk] = points
+		b.received++
+
+		if b.received < chunks {
+			lock.Unlock()
+			return
+		}
+
+		delete(batches, batch)
+		lock.Unlock()
+
+		for _, c := range b.chunks {
+			hr.Points = append(hr.Points, c...)
+		}
+
+		callback(hr)
+	})
+
+	return func() {
+		sub.Unsubscribe()
+	}, err
+}
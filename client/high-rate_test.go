@@ -0,0 +1,89 @@
+package client_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+	"github.com/simpleiot/simpleiot/server"
+)
+
+func TestHighRatePoints(t *testing.T) {
+	nc, _, stop, err := server.TestServer()
+	if err != nil {
+		t.Fatal("Error starting test server: ", err)
+	}
+	defer stop()
+
+	chHR := make(chan client.HighRatePoints, 10)
+	stopSub, err := client.SubscribeHighRate(nc, "*", func(hr client.HighRatePoints) {
+		chHR <- hr
+	})
+	if err != nil {
+		t.Fatal("Error subscribing: ", err)
+	}
+	defer stopSub()
+
+	upSub, err := nc.SubscribeSync(client.SubjectNodeHRUpPoints("parent", "sensor"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	points := make(data.Points, 2500)
+	for i := range points {
+		points[i] = data.Point{Type: data.PointTypeValue, Value: float64(i),
+			Time: start.Add(time.Duration(i) * time.Millisecond)}
+	}
+
+	err = client.SendHighRatePoints(nc, "sensor", points, client.HighRateOptions{
+		Parent: "parent", Rate: 1000})
+	if err != nil {
+		t.Fatal("Error sending high rate points: ", err)
+	}
+
+	select {
+	case hr := <-chHR:
+		if hr.NodeID != "sensor" || hr.Rate != 1000 || len(hr.Points) != len(points) {
+			t.Fatalf("wrong buffer, node: %v, rate: %v, points: %v", hr.NodeID,
+				hr.Rate, len(hr.Points))
+		}
+
+		for i, p := range hr.Points {
+			if p.Value != float64(i) || !p.Time.Equal(points[i].Time) {
+				t.Fatalf("point %v not correct: %v", i, p)
+			}
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for high rate points")
+	}
+
+	// three chunks are also published upstream
+	for i := 0; i < 3; i++ {
+		msg, err := upSub.NextMsg(time.Second)
+		if err != nil {
+			t.Fatal("Did not get upstream chunk: ", err)
+		}
+
+		if msg.Header.Get(client.HeaderHRChunks) != "3" {
+			t.Errorf("wrong chunk count: %v", msg.Header.Get(client.HeaderHRChunks))
+		}
+	}
+
+	// points sent without chunk headers are passed on as they are
+	err = client.SendPoints(nc, client.SubjectNodeHRPoints("mcu"),
+		data.Points{{Type: data.PointTypeValue, Value: 5}}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case hr := <-chHR:
+		if hr.NodeID != "mcu" || hr.Rate != 0 || len(hr.Points) != 1 {
+			t.Errorf("wrong buffer: %+v", hr)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for high rate points")
+	}
+}
@@ -0,0 +1,214 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/data"
+	"github.com/simpleiot/simpleiot/internal/pb"
+	"google.golang.org/protobuf/proto"
+)
+
+// GetHistory queries point history for a node over NATS. History is provided
+// by whatever history backend is responding on the history.<id> subject.
+// Annotations for the node (or the queried point type) that overlap the
+// query time range are included in the results.
+func GetHistory(nc *nats.Conn, nodeID string, q data.HistoryQuery) (data.Points, error) {
+	reqPoints := q.ToPoints()
+	reqData, err := reqPoints.ToPb()
+	if err != nil {
+		return nil, fmt.Errorf("Error encoding history query: %v", err)
+	}
+
+	msg, err := nc.Request(SubjectHistory(nodeID), reqData, time.Second*20)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes, err := data.PbDecodeNodesRequest(msg.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	var ret data.Points
+
+	if len(nodes) > 0 {
+		// backends may also record annotation points, but the node
+		// has the authoritative annotation state
+		for _, p := range nodes[0].Points {
+			if p.Type != data.PointTypeAnnotation {
+				ret = append(ret, p)
+			}
+		}
+	}
+
+	annotations, err := GetAnnotations(nc, nodeID)
+	if err != nil {
+		return nil, fmt.Errorf("Error getting annotations: %v", err)
+	}
+
+	for _, a := range annotations {
+		if q.Type != "" && a.PointType != "" && a.PointType != q.Type {
+			continue
+		}
+
+		if a.Overlaps(q.Start, q.End) {
+			ret = append(ret, a.ToPoint())
+		}
+	}
+
+	return ret, nil
+}
+
+// DecodeHistoryMsg decodes a history query request. This is used by
+// history backends.
+func DecodeHistoryMsg(msg *nats.Msg) (string, data.HistoryQuery, error) {
+	chunks := strings.Split(msg.Subject, ".")
+	if len(chunks) != 2 {
+		return "", data.HistoryQuery{}, errors.New("invalid history subject")
+	}
+
+	points, err := DecodePoints(msg)
+	if err != nil {
+		return "", data.HistoryQuery{}, fmt.Errorf("Error decoding history query: %v", err)
+	}
+
+	q, err := data.PointsToHistoryQuery(points)
+	return chunks[1], q, err
+}
+
+// RespondHistory sends the result of a history query. This is used by
+// history backends.
+func RespondHistory(msg *nats.Msg, nodeID string, points data.Points, histErr error) error {
+	resp := &pb.NodesRequest{}
+
+	if histErr != nil {
+		resp.Error = histErr.Error()
+	} else {
+		nodes := data.Nodes{{ID: nodeID, Points: points}}
+		var err error
+		resp.Nodes, err = nodes.ToPbNodes()
+		if err != nil {
+			resp.Error = fmt.Sprintf("Error pb encoding history: %v", err)
+		}
+	}
+
+	d, err := proto.Marshal(resp)
+	if err != nil {
+		return err
+	}
+
+	return msg.Respond(d)
+}
+
+// GetNodeStateAt reconstructs the state of a node and all its children at a
+// past time. The node structure is the current structure (including deleted
+// nodes), and point values are fetched from history where the current value
+// was written after t. Nodes that did not exist yet or were already deleted at
+// t are not returned.
+func GetNodeStateAt(nc *nats.Conn, id string, t time.Time) ([]data.NodeEdge, error) {
+	nodes, err := GetNode(nc, id, "none")
+	if err != nil {
+		return nil, fmt.Errorf("GetNode error: %w", err)
+	}
+
+	if len(nodes) < 1 {
+		return nil, errors.New("node not found")
+	}
+
+	children, err := GetNodeChildren(nc, id, "", true, true)
+	if err != nil {
+		return nil, fmt.Errorf("GetNodeChildren error: %w", err)
+	}
+
+	nodes = append(nodes, children...)
+
+	var ret []data.NodeEdge
+
+	for _, n := range nodes {
+		if !existedAt(n, t) {
+			continue
+		}
+
+		points, err := pointsAt(nc, n, t)
+		if err != nil {
+			return nil, err
+		}
+
+		n.Points = points
+		// the node was alive at t
+		n.EdgePoints.Add(data.Point{Type: data.PointTypeTombstone, Time: t})
+		ret = append(ret, n)
+	}
+
+	return ret, nil
+}
+
+// existedAt uses point timestamps to determine if a node existed at t
+func existedAt(n data.NodeEdge, t time.Time) bool {
+	ts, tsTime := n.IsTombstone()
+	if ts && !tsTime.After(t) {
+		// already deleted
+		return false
+	}
+
+	for _, p := range n.Points {
+		if !p.Time.After(t) {
+			return true
+		}
+	}
+
+	for _, p := range n.EdgePoints {
+		if p.Type != data.PointTypeTombstone && !p.Time.After(t) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// pointsAt returns the points of n as they were at t. Points that have not
+// changed since t are used as is, others are looked up in history.
+func pointsAt(nc *nats.Conn, n data.NodeEdge, t time.Time) (data.Points, error) {
+	var ret data.Points
+	needHistory := false
+
+	for _, p := range n.Points {
+		if p.Time.After(t) {
+			needHistory = true
+			continue
+		}
+		ret = append(ret, p)
+	}
+
+	if !needHistory {
+		return ret, nil
+	}
+
+	hist, err := GetHistory(nc, n.ID, data.HistoryQuery{
+		End:       t,
+		Aggregate: data.AggregateLast,
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("Error getting history for node %v: %w", n.ID, err)
+	}
+
+	for _, p := range n.Points {
+		if !p.Time.After(t) {
+			continue
+		}
+
+		for _, h := range hist {
+			if h.IsMatch(p.Type, p.Key) {
+				ret = append(ret, h)
+				break
+			}
+		}
+	}
+
+	return ret, nil
+}
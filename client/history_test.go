@@ -0,0 +1,178 @@
+package client_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+	"github.com/simpleiot/simpleiot/server"
+)
+
+func TestGetNodeStateAt(t *testing.T) {
+	nc, root, stop, err := server.TestServer()
+
+	if err != nil {
+		t.Fatal("Error starting test server: ", err)
+	}
+
+	defer stop()
+
+	now := time.Now()
+	past := now.Add(-time.Hour)
+
+	// fake history backend
+	history := data.Points{
+		{Time: now.Add(-2 * time.Hour), Type: data.PointTypeValue, Value: 1},
+		{Time: now.Add(-90 * time.Minute), Type: data.PointTypeValue, Value: 2},
+		{Time: now.Add(-time.Minute), Type: data.PointTypeValue, Value: 3},
+	}
+
+	sub, err := nc.Subscribe(client.SubjectHistory("*"), func(msg *nats.Msg) {
+		id, q, err := client.DecodeHistoryMsg(msg)
+		var pts data.Points
+		if err == nil {
+			pts, err = q.Apply(history)
+		}
+		client.RespondHistory(msg, id, pts, err)
+	})
+	if err != nil {
+		t.Fatal("Error subscribing to history: ", err)
+	}
+	defer sub.Unsubscribe()
+
+	n := data.NodeEdge{
+		ID:     "ID-playback",
+		Type:   data.NodeTypeDevice,
+		Parent: root.ID,
+		Points: data.Points{
+			{Time: now.Add(-2 * time.Hour), Type: data.PointTypeDescription, Text: "dev"},
+			{Time: now.Add(-time.Minute), Type: data.PointTypeValue, Value: 3},
+		},
+		EdgePoints: data.Points{
+			{Time: now.Add(-2 * time.Hour), Type: data.PointTypeTombstone},
+		},
+	}
+
+	err = client.SendNode(nc, n, "test")
+	if err != nil {
+		t.Fatal("Error sending node: ", err)
+	}
+
+	// node created after the playback time should not be returned
+	err = client.SendNode(nc, data.NodeEdge{
+		ID:     "ID-new",
+		Type:   data.NodeTypeDevice,
+		Parent: n.ID,
+		Points: data.Points{{Time: now, Type: data.PointTypeDescription, Text: "new"}},
+	}, "test")
+	if err != nil {
+		t.Fatal("Error sending node: ", err)
+	}
+
+	nodes, err := client.GetNodeStateAt(nc, n.ID, past)
+	if err != nil {
+		t.Fatal("Error getting node state: ", err)
+	}
+
+	if len(nodes) != 1 {
+		t.Fatalf("expected 1 node, got %v", len(nodes))
+	}
+
+	if nodes[0].Desc() != "dev" {
+		t.Error("description not correct: ", nodes[0].Desc())
+	}
+
+	v, _ := nodes[0].Points.Value(data.PointTypeValue, "")
+	if v != 2 {
+		t.Error("expected value of 2, got: ", v)
+	}
+}
+
+func TestAnnotations(t *testing.T) {
+	nc, root, stop, err := server.TestServer()
+
+	if err != nil {
+		t.Fatal("Error starting test server: ", err)
+	}
+
+	defer stop()
+
+	// history backend without any data
+	sub, err := nc.Subscribe(client.SubjectHistory("*"), func(msg *nats.Msg) {
+		id, _, err := client.DecodeHistoryMsg(msg)
+		client.RespondHistory(msg, id, nil, err)
+	})
+	if err != nil {
+		t.Fatal("Error subscribing to history: ", err)
+	}
+	defer sub.Unsubscribe()
+
+	start := time.Now().Add(-time.Hour)
+
+	id, err := client.AddAnnotation(nc, root.ID, data.Annotation{
+		PointType: data.PointTypeValue,
+		Text:      "sensor replaced",
+		User:      "joe",
+		Start:     start,
+		End:       start.Add(10 * time.Minute),
+	})
+	if err != nil {
+		t.Fatal("Error adding annotation: ", err)
+	}
+
+	annotations, err := client.GetAnnotations(nc, root.ID)
+	if err != nil {
+		t.Fatal("Error getting annotations: ", err)
+	}
+
+	if len(annotations) != 1 || annotations[0].ID != id ||
+		annotations[0].Text != "sensor replaced" || annotations[0].User != "joe" ||
+		annotations[0].PointType != data.PointTypeValue ||
+		!annotations[0].End.Equal(start.Add(10*time.Minute)) {
+		t.Fatalf("annotation not correct: %+v", annotations)
+	}
+
+	// annotation should be returned in history query for the point type
+	hist, err := client.GetHistory(nc, root.ID, data.HistoryQuery{
+		Start: start.Add(5 * time.Minute),
+		End:   time.Now(),
+		Type:  data.PointTypeValue,
+	})
+	if err != nil {
+		t.Fatal("Error getting history: ", err)
+	}
+
+	if len(hist) != 1 || hist[0].Type != data.PointTypeAnnotation {
+		t.Fatalf("expected annotation in history, got: %v", hist)
+	}
+
+	// but not for other point types
+	hist, err = client.GetHistory(nc, root.ID, data.HistoryQuery{
+		Start: start,
+		End:   time.Now(),
+		Type:  data.PointTypeDescription,
+	})
+	if err != nil {
+		t.Fatal("Error getting history: ", err)
+	}
+
+	if len(hist) != 0 {
+		t.Fatalf("expected no history, got: %v", hist)
+	}
+
+	err = client.DeleteAnnotation(nc, root.ID, id, "joe")
+	if err != nil {
+		t.Fatal("Error deleting annotation: ", err)
+	}
+
+	annotations, err = client.GetAnnotations(nc, root.ID)
+	if err != nil {
+		t.Fatal("Error getting annotations: ", err)
+	}
+
+	if len(annotations) != 0 {
+		t.Fatal("annotation was not deleted")
+	}
+}
@@ -0,0 +1,509 @@
+package client
+
+import (
+	"log"
+	"sort"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// Hvac controls the heating and cooling stages of a zone from the value point
+// of TempNodeID. Mode is off, heat, cool, or auto. While occupied (between
+// OccupiedStart and OccupiedEnd, HH:MM UTC, or always if these are blank),
+// HeatSetpoint and CoolSetpoint are used, otherwise SetbackHeat and
+// SetbackCool. Heat or cool stage n is turned on when the zone is
+// n*Differential (defaults to 1) past the setpoint and turned off when it is
+// no more than (n-1)*Differential past. Stages are added at most once every
+// StageDelay minutes, stay on at least MinRun minutes, and stay off at least
+// MinOff minutes.
+//
+// If the value point of OutdoorNodeID is below EconomizerTemp and the zone
+// temperature, the EconomizerNodeID output (outdoor air damper) is used as the
+// first cooling stage. The FanNodeID output is on while any stage or the
+// economizer is on. Occupied, HeatStage, CoolStage (number of stages on), and
+// Economizing report the state.
+type Hvac struct {
+	ID               string      `node:"id"`
+	Parent           string      `node:"parent"`
+	Description      string      `point:"description"`
+	Mode             string      `point:"mode"`
+	TempNodeID       string      `point:"tempNodeID"`
+	OutdoorNodeID    string      `point:"outdoorNodeID"`
+	HeatSetpoint     float64     `point:"heatSetpoint"`
+	CoolSetpoint     float64     `point:"coolSetpoint"`
+	SetbackHeat      float64     `point:"setbackHeat"`
+	SetbackCool      float64     `point:"setbackCool"`
+	OccupiedStart    string      `point:"occupiedStart"`
+	OccupiedEnd      string      `point:"occupiedEnd"`
+	Differential     float64     `point:"differential"`
+	StageDelay       float64     `point:"stageDelay"`
+	MinRun           float64     `point:"minRun"`
+	MinOff           float64     `point:"minOff"`
+	EconomizerNodeID string      `point:"economizerNodeID"`
+	EconomizerTemp   float64     `point:"economizerTemp"`
+	FanNodeID        string      `point:"fanNodeID"`
+	Disable          bool        `point:"disable"`
+	Occupied         bool        `point:"occupied"`
+	HeatStage        int         `point:"heatStage"`
+	CoolStage        int         `point:"coolStage"`
+	Economizing      bool        `point:"economizing"`
+	Stages           []HvacStage `child:"hvacStage"`
+}
+
+// HvacStage sets the PointType (defaults to value) point of NodeID to run a
+// heating or cooling stage (StageType heat or cool). Stages of each type are
+// added in Index order.
+type HvacStage struct {
+	ID          string `node:"id"`
+	Parent      string `node:"parent"`
+	Description string `point:"description"`
+	Index       int    `point:"index"`
+	StageType   string `point:"stageType"`
+	NodeID      string `point:"nodeID"`
+	PointType   string `point:"pointType"`
+	Disable     bool   `point:"disable"`
+}
+
+func (s HvacStage) pointType() string {
+	if s.PointType == "" {
+		return data.PointTypeValue
+	}
+	return s.PointType
+}
+
+// hvac inputs
+const (
+	hvacInputTemp    = "temp"
+	hvacInputOutdoor = "outdoor"
+)
+
+// how often the HVAC controller checks timers and the occupied schedule
+var hvacTickPeriod = time.Second
+
+type hvacInput struct {
+	input string
+	value float64
+}
+
+// hvacOutput is the state of a relay output
+type hvacOutput struct {
+	// on is nil until the output has been set
+	on *bool
+	// last time the output was turned on or off
+	changed time.Time
+}
+
+// hvacStageCount returns the number of stages that should be on for err (how
+// far the zone is past the setpoint) when cur stages are on, using
+// hysteresis so stages don't cycle around the threshold
+func hvacStageCount(err, differential float64, cur, max int) int {
+	want := cur
+	for want < max && err >= float64(want+1)*differential {
+		want++
+	}
+	for want > 0 && err <= float64(want-1)*differential {
+		want--
+	}
+	if want > max {
+		want = max
+	}
+	return want
+}
+
+// HvacClient is a SIOT client that runs HVAC controller nodes
+type HvacClient struct {
+	nc            *nats.Conn
+	config        Hvac
+	stop          chan struct{}
+	newPoints     chan NewPoints
+	newEdgePoints chan NewPoints
+	newInput      chan hvacInput
+	// input subscriptions and the node they are subscribed to by input
+	subs    map[string]*nats.Subscription
+	subNode map[string]string
+	// input values, only set once received
+	inputs map[string]float64
+	// outputs by output node ID
+	outputs map[string]*hvacOutput
+	// stages the controller is calling for, which may be more than are on
+	// because of the min off timer
+	heatCall, coolCall int
+	lastStage          time.Time
+	// time zone of the occupied schedule
+	loc *time.Location
+}
+
+// NewHvacClient ...
+func NewHvacClient(nc *nats.Conn, config Hvac) Client {
+	return &HvacClient{
+		nc:            nc,
+		config:        config,
+		stop:          make(chan struct{}),
+		newPoints:     make(chan NewPoints),
+		newEdgePoints: make(chan NewPoints),
+		newInput:      make(chan hvacInput),
+		subs:          make(map[string]*nats.Subscription),
+		subNode:       make(map[string]string),
+		inputs:        make(map[string]float64),
+		outputs:       make(map[string]*hvacOutput),
+	}
+}
+
+// Start runs the main logic for this client and blocks until stopped
+func (h *HvacClient) Start() error {
+	log.Println("Starting HVAC client: ", h.config.Description)
+
+	var err error
+	h.loc, err = NodeLocation(h.nc, h.config.ID)
+	if err != nil {
+		log.Printf("HVAC %v: %v\n", h.config.Description, err)
+	}
+
+	h.subscribeInputs()
+
+	ticker := time.NewTicker(hvacTickPeriod)
+	defer ticker.Stop()
+
+	h.update(time.Now())
+
+done:
+	for {
+		select {
+		case <-h.stop:
+			log.Println("Stopping HVAC client: ", h.config.Description)
+			break done
+		case now := <-ticker.C:
+			h.update(now)
+		case in := <-h.newInput:
+			h.inputs[in.input] = in.value
+			h.update(time.Now())
+		case pts := <-h.newPoints:
+			err := data.MergePoints(pts.ID, pts.Points, &h.config)
+			if err != nil {
+				log.Println("error merging new points: ", err)
+			}
+
+			h.subscribeInputs()
+			h.update(time.Now())
+		case pts := <-h.newEdgePoints:
+			err := data.MergeEdgePoints(pts.ID, pts.Parent, pts.Points, &h.config)
+			if err != nil {
+				log.Println("error merging new points: ", err)
+			}
+		}
+	}
+
+	// outputs are left alone so that equipment does not short cycle when the
+	// client restarts
+	for _, sub := range h.subs {
+		sub.Unsubscribe()
+	}
+
+	return nil
+}
+
+// stages returns the enabled stages of a type in Index order
+func (h *HvacClient) stages(stageType string) []HvacStage {
+	var ret []HvacStage
+	for _, s := range h.config.Stages {
+		if s.StageType == stageType && !s.Disable && s.NodeID != "" {
+			ret = append(ret, s)
+		}
+	}
+
+	sort.SliceStable(ret, func(i, j int) bool {
+		return ret[i].Index < ret[j].Index
+	})
+
+	return ret
+}
+
+// occupied returns true if the zone is in the occupied schedule
+func (h *HvacClient) occupied(now time.Time) bool {
+	if h.config.OccupiedStart == "" || h.config.OccupiedEnd == "" {
+		return true
+	}
+
+	active, err := newSchedule(h.config.OccupiedStart, h.config.OccupiedEnd,
+		nil, h.loc).activeForTime(now)
+	if err != nil {
+		log.Printf("HVAC %v: invalid occupied schedule: %v\n",
+			h.config.Description, err)
+		return true
+	}
+
+	return active
+}
+
+// update computes the number of stages to run and sets the outputs
+func (h *HvacClient) update(now time.Time) {
+	occupied := h.occupied(now)
+
+	heatSP, coolSP := h.config.HeatSetpoint, h.config.CoolSetpoint
+	if !occupied {
+		heatSP, coolSP = h.config.SetbackHeat, h.config.SetbackCool
+	}
+
+	differential := h.config.Differential
+	if differential <= 0 {
+		differential = 1
+	}
+
+	heatStages := h.stages(data.PointValueHeat)
+	coolStages := h.stages(data.PointValueCool)
+
+	temp, haveTemp := h.inputs[hvacInputTemp]
+	outdoor, haveOutdoor := h.inputs[hvacInputOutdoor]
+
+	if !haveTemp {
+		// outputs are left alone until the zone temperature is known
+		h.sendState(occupied, h.config.HeatStage, h.config.CoolStage,
+			h.config.Economizing, now)
+		return
+	}
+
+	economizer := h.config.EconomizerNodeID != "" && haveOutdoor &&
+		outdoor < h.config.EconomizerTemp && outdoor < temp
+
+	coolMax := len(coolStages)
+	if economizer {
+		coolMax++
+	}
+
+	heatWant, coolWant := 0, 0
+
+	if !h.config.Disable {
+		mode := h.config.Mode
+		if mode == data.PointValueHeat || mode == data.PointValueAuto {
+			heatWant = hvacStageCount(heatSP-temp, differential, h.heatCall,
+				len(heatStages))
+		}
+		if mode == data.PointValueCool || mode == data.PointValueAuto {
+			coolWant = hvacStageCount(temp-coolSP, differential, h.coolCall,
+				coolMax)
+		}
+	}
+
+	// stages are added one at a time, StageDelay apart
+	stageDelay := time.Duration(h.config.StageDelay * float64(time.Minute))
+	if heatWant > h.heatCall+1 {
+		heatWant = h.heatCall + 1
+	}
+	if coolWant > h.coolCall+1 {
+		coolWant = h.coolCall + 1
+	}
+	if (heatWant > h.heatCall || coolWant > h.coolCall) &&
+		!h.lastStage.IsZero() && now.Sub(h.lastStage) < stageDelay {
+		heatWant, coolWant = h.heatCall, h.coolCall
+	}
+	if heatWant > h.heatCall || coolWant > h.coolCall {
+		h.lastStage = now
+	}
+
+	h.heatCall, h.coolCall = heatWant, coolWant
+
+	// the economizer is the first cooling stage when it is available
+	mechCool := coolWant
+	economizing := false
+	if economizer && coolWant > 0 {
+		economizing = true
+		mechCool--
+	}
+
+	heatOn := h.setStages(heatStages, heatWant, now)
+	coolOn := h.setStages(coolStages, mechCool, now)
+
+	if h.config.EconomizerNodeID != "" {
+		h.setOutput(h.config.EconomizerNodeID, data.PointTypeValue, economizing,
+			now, false)
+	}
+
+	if h.config.FanNodeID != "" {
+		h.setOutput(h.config.FanNodeID, data.PointTypeValue,
+			heatOn > 0 || coolOn > 0 || economizing, now, false)
+	}
+
+	h.sendState(occupied, heatOn, coolOn, economizing, now)
+}
+
+// sendState sends the state points that changed
+func (h *HvacClient) sendState(occupied bool, heatOn, coolOn int, economizing bool,
+	now time.Time) {
+	var points data.Points
+
+	if occupied != h.config.Occupied {
+		h.config.Occupied = occupied
+		points = append(points, data.Point{Type: data.PointTypeOccupied,
+			Value: data.BoolToFloat(occupied)})
+	}
+
+	if heatOn != h.config.HeatStage {
+		h.config.HeatStage = heatOn
+		points = append(points, data.Point{Type: data.PointTypeHeatStage,
+			Value: float64(heatOn)})
+	}
+
+	if coolOn != h.config.CoolStage {
+		h.config.CoolStage = coolOn
+		points = append(points, data.Point{Type: data.PointTypeCoolStage,
+			Value: float64(coolOn)})
+	}
+
+	if economizing != h.config.Economizing {
+		h.config.Economizing = economizing
+		points = append(points, data.Point{Type: data.PointTypeEconomizing,
+			Value: data.BoolToFloat(economizing)})
+	}
+
+	for i := range points {
+		points[i].Time = now
+	}
+
+	if len(points) > 0 {
+		err := SendNodePoints(h.nc, h.config.ID, points, false)
+		if err != nil {
+			log.Println("HVAC: error sending state: ", err)
+		}
+	}
+}
+
+// setStages turns on the first want stages and turns off the rest, subject
+// to the min run and min off timers, and returns the number of stages on
+func (h *HvacClient) setStages(stages []HvacStage, want int, now time.Time) int {
+	on := 0
+	for i, s := range stages {
+		if h.setOutput(s.NodeID, s.pointType(), i < want, now, true) {
+			on++
+		}
+	}
+	return on
+}
+
+// setOutput turns an output on or off if it is not already. If timers is
+// set, the min run and min off timers are applied. Returns the state of the
+// output.
+func (h *HvacClient) setOutput(nodeID, pointType string, on bool, now time.Time,
+	timers bool) bool {
+	o, ok := h.outputs[nodeID]
+	if !ok {
+		o = &hvacOutput{}
+		h.outputs[nodeID] = o
+	}
+
+	if o.on != nil {
+		if *o.on == on {
+			return on
+		}
+
+		if timers {
+			minRun := time.Duration(h.config.MinRun * float64(time.Minute))
+			minOff := time.Duration(h.config.MinOff * float64(time.Minute))
+			if *o.on && now.Sub(o.changed) < minRun {
+				return true
+			}
+			if !*o.on && now.Sub(o.changed) < minOff {
+				return false
+			}
+		}
+	}
+
+	err := SendNodePoint(h.nc, nodeID, data.Point{
+		Time:   now,
+		Type:   pointType,
+		Value:  data.BoolToFloat(on),
+		Origin: h.config.ID,
+	}, true)
+	if err != nil {
+		log.Printf("HVAC %v: error setting output: %v\n", h.config.Description, err)
+		if o.on != nil {
+			return *o.on
+		}
+		return false
+	}
+
+	o.on = &on
+	o.changed = now
+
+	return on
+}
+
+// subscribeInputs subscribes to the value points of the temperature nodes
+// and gets their current values
+func (h *HvacClient) subscribeInputs() {
+	for input, nodeID := range map[string]string{
+		hvacInputTemp:    h.config.TempNodeID,
+		hvacInputOutdoor: h.config.OutdoorNodeID,
+	} {
+		if cur, ok := h.subNode[input]; ok && cur == nodeID {
+			continue
+		}
+
+		if sub, ok := h.subs[input]; ok {
+			sub.Unsubscribe()
+			delete(h.subs, input)
+		}
+
+		delete(h.inputs, input)
+		h.subNode[input] = nodeID
+
+		if nodeID == "" {
+			continue
+		}
+
+		input := input
+
+		sub, err := h.nc.Subscribe(SubjectNodePoints(nodeID), func(msg *nats.Msg) {
+			points, err := DecodePoints(msg)
+			if err != nil {
+				log.Println("HVAC: error decoding input points: ", err)
+				return
+			}
+
+			for _, p := range points {
+				if p.Type == data.PointTypeValue {
+					select {
+					case h.newInput <- hvacInput{input: input, value: p.Value}:
+					case <-h.stop:
+					}
+				}
+			}
+		})
+		if err != nil {
+			log.Printf("HVAC %v: error subscribing to %v input: %v\n",
+				h.config.Description, input, err)
+			continue
+		}
+
+		h.subs[input] = sub
+
+		nodes, err := GetNode(h.nc, nodeID, "none")
+		if err != nil || len(nodes) < 1 {
+			log.Printf("HVAC %v: error getting %v input: %v\n",
+				h.config.Description, input, err)
+			continue
+		}
+
+		if v, ok := nodes[0].Points.Value(data.PointTypeValue, ""); ok {
+			h.inputs[input] = v
+		}
+	}
+}
+
+// Stop sends a signal to the Start function to exit
+func (h *HvacClient) Stop(err error) {
+	close(h.stop)
+}
+
+// Points is called by the Manager when new points for this
+// node are received.
+func (h *HvacClient) Points(nodeID string, points []data.Point) {
+	h.newPoints <- NewPoints{nodeID, "", points}
+}
+
+// EdgePoints is called by the Manager when new edge points for this
+// node are received.
+func (h *HvacClient) EdgePoints(nodeID, parentID string, points []data.Point) {
+	h.newEdgePoints <- NewPoints{nodeID, parentID, points}
+}
@@ -0,0 +1,106 @@
+package client_test
+
+import (
+	"testing"
+
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+	"github.com/simpleiot/simpleiot/server"
+)
+
+func TestHvac(t *testing.T) {
+	nc, root, stop, err := server.TestServer()
+	if err != nil {
+		t.Fatal("Error starting test server: ", err)
+	}
+	defer stop()
+
+	for _, id := range []string{"temp", "outdoor", "heat1", "heat2", "cool1", "damper", "fan"} {
+		err = client.SendNodeType(nc, client.Variable{ID: id, Parent: root.ID}, "test")
+		if err != nil {
+			t.Fatal("Error sending variable node: ", err)
+		}
+	}
+
+	sendPoint := func(id, typ string, v float64) {
+		t.Helper()
+		err := client.SendNodePoint(nc, id, data.Point{Type: typ, Value: v,
+			Origin: "test"}, true)
+		if err != nil {
+			t.Fatal("Error sending point: ", err)
+		}
+	}
+
+	sendPoint("temp", data.PointTypeValue, 21)
+	sendPoint("outdoor", data.PointTypeValue, 30)
+
+	err = client.SendNodeType(nc, client.Hvac{
+		ID:               "hvac",
+		Parent:           root.ID,
+		Description:      "office",
+		Mode:             data.PointValueAuto,
+		TempNodeID:       "temp",
+		OutdoorNodeID:    "outdoor",
+		HeatSetpoint:     20,
+		CoolSetpoint:     24,
+		EconomizerNodeID: "damper",
+		EconomizerTemp:   15,
+		FanNodeID:        "fan",
+	}, "test")
+	if err != nil {
+		t.Fatal("Error sending HVAC node: ", err)
+	}
+
+	stages := []client.HvacStage{
+		{ID: "s-heat1", Parent: "hvac", Index: 1, StageType: data.PointValueHeat, NodeID: "heat1"},
+		{ID: "s-heat2", Parent: "hvac", Index: 2, StageType: data.PointValueHeat, NodeID: "heat2"},
+		{ID: "s-cool1", Parent: "hvac", Index: 1, StageType: data.PointValueCool, NodeID: "cool1"},
+	}
+
+	for _, s := range stages {
+		err = client.SendNodeType(nc, s, "test")
+		if err != nil {
+			t.Fatal("Error sending stage node: ", err)
+		}
+	}
+
+	waitPointValue(t, nc, "hvac", data.PointTypeOccupied, 1)
+
+	// first heat stage comes on 1 degree below the setpoint
+	sendPoint("temp", data.PointTypeValue, 18.5)
+	waitPointValue(t, nc, "heat1", data.PointTypeValue, 1)
+	waitPointValue(t, nc, "fan", data.PointTypeValue, 1)
+	waitPointValue(t, nc, "hvac", data.PointTypeHeatStage, 1)
+
+	sendPoint("temp", data.PointTypeValue, 17.5)
+	waitPointValue(t, nc, "heat2", data.PointTypeValue, 1)
+	waitPointValue(t, nc, "hvac", data.PointTypeHeatStage, 2)
+
+	// stage 2 stays on until the zone is within 1 degree of the setpoint
+	sendPoint("temp", data.PointTypeValue, 18.5)
+	waitPointValue(t, nc, "heat2", data.PointTypeValue, 1)
+	sendPoint("temp", data.PointTypeValue, 19.5)
+	waitPointValue(t, nc, "heat2", data.PointTypeValue, 0)
+	waitPointValue(t, nc, "heat1", data.PointTypeValue, 1)
+
+	sendPoint("temp", data.PointTypeValue, 20)
+	waitPointValue(t, nc, "heat1", data.PointTypeValue, 0)
+	waitPointValue(t, nc, "fan", data.PointTypeValue, 0)
+
+	// cool outdoor air is used before mechanical cooling
+	sendPoint("outdoor", data.PointTypeValue, 10)
+	sendPoint("temp", data.PointTypeValue, 25.5)
+	waitPointValue(t, nc, "damper", data.PointTypeValue, 1)
+	waitPointValue(t, nc, "hvac", data.PointTypeEconomizing, 1)
+	waitPointValue(t, nc, "fan", data.PointTypeValue, 1)
+	waitPointValue(t, nc, "cool1", data.PointTypeValue, 0)
+
+	sendPoint("temp", data.PointTypeValue, 26.5)
+	waitPointValue(t, nc, "cool1", data.PointTypeValue, 1)
+	waitPointValue(t, nc, "hvac", data.PointTypeCoolStage, 1)
+
+	sendPoint("hvac", data.PointTypeDisable, 1)
+	waitPointValue(t, nc, "cool1", data.PointTypeValue, 0)
+	waitPointValue(t, nc, "damper", data.PointTypeValue, 0)
+	waitPointValue(t, nc, "fan", data.PointTypeValue, 0)
+}
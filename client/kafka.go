@@ -0,0 +1,445 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	kafkago "github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/simpleiot/simpleiot/data"
+	"github.com/simpleiot/simpleiot/kafka"
+)
+
+// Kafka streams point changes from nodes under the parent node to Kafka.
+// Brokers and PointTypes are comma separated lists. If PointTypes is blank,
+// all points are sent. Topic may contain {type}, which is replaced by the
+// point type. Format is json (default) or avro. If SchemaRegistry is set, the
+// schema is registered under the <topic>-value subject and messages use the
+// schema registry wire format.
+type Kafka struct {
+	ID             string `node:"id"`
+	Parent         string `node:"parent"`
+	Description    string `point:"description"`
+	Brokers        string `point:"brokers"`
+	Topic          string `point:"topic"`
+	PointTypes     string `point:"pointTypes"`
+	Format         string `point:"format"`
+	SchemaRegistry string `point:"schemaRegistry"`
+	TLS            bool   `point:"tls"`
+	Username       string `point:"username"`
+	Pass           string `point:"pass"`
+	Disable        bool   `point:"disable"`
+	Tx             int    `point:"tx"`
+	ErrorCount     int    `point:"errorCount"`
+}
+
+// KafkaPoint is the message sent to Kafka for each point
+type KafkaPoint struct {
+	NodeID string    `json:"nodeID"`
+	Type   string    `json:"type"`
+	Key    string    `json:"key"`
+	Time   time.Time `json:"time"`
+	Index  float64   `json:"index"`
+	Value  float64   `json:"value"`
+	Text   string    `json:"text"`
+	Origin string    `json:"origin"`
+}
+
+// kafkaAvroSchema describes KafkaPoint. Time is microseconds since the Unix
+// epoch.
+const kafkaAvroSchema = `{"type":"record","name":"Point","namespace":"io.simpleiot",` +
+	`"fields":[{"name":"nodeID","type":"string"},{"name":"type","type":"string"},` +
+	`{"name":"key","type":"string"},` +
+	`{"name":"time","type":{"type":"long","logicalType":"timestamp-micros"}},` +
+	`{"name":"index","type":"double"},{"name":"value","type":"double"},` +
+	`{"name":"text","type":"string"},{"name":"origin","type":"string"}]}`
+
+const kafkaJSONSchema = `{"$schema":"http://json-schema.org/draft-07/schema#",` +
+	`"title":"Point","type":"object","properties":{"nodeID":{"type":"string"},` +
+	`"type":{"type":"string"},"key":{"type":"string"},` +
+	`"time":{"type":"string","format":"date-time"},"index":{"type":"number"},` +
+	`"value":{"type":"number"},"text":{"type":"string"},"origin":{"type":"string"}}}`
+
+// messages are sent when this many are buffered or every kafkaFlushPeriod
+var kafkaBatchSize = 500
+var kafkaFlushPeriod = time.Second
+
+// kafkaTimeout is the max time to send buffered messages
+var kafkaTimeout = 10 * time.Second
+
+// maximum number of points buffered while Kafka is not reachable. The oldest
+// points are dropped once this is reached.
+var kafkaMaxPoints = 100000
+
+// KafkaClient is a SIOT client that sends points to Kafka
+type KafkaClient struct {
+	nc            *nats.Conn
+	config        Kafka
+	stop          chan struct{}
+	newPoints     chan NewPoints
+	newEdgePoints chan NewPoints
+	newUpPoints   chan NewPoints
+	upSub         *BufferedSub
+	upSubHr       *BufferedSub
+	writer        *kafkago.Writer
+	registry      *kafka.Registry
+	pointTypes    map[string]bool
+	points        []KafkaPoint
+}
+
+// NewKafkaClient ...
+func NewKafkaClient(nc *nats.Conn, config Kafka) Client {
+	return &KafkaClient{
+		nc:            nc,
+		config:        config,
+		stop:          make(chan struct{}),
+		newPoints:     make(chan NewPoints),
+		newEdgePoints: make(chan NewPoints),
+		newUpPoints:   make(chan NewPoints),
+	}
+}
+
+// Start runs the main logic for this client and blocks until stopped
+func (k *KafkaClient) Start() error {
+	log.Println("Starting Kafka client: ", k.config.Description)
+
+	bufOpts := BufferOptions{
+		Size:          10000,
+		Policy:        BufferDropOldest,
+		MetricsNodeID: k.config.ID,
+	}
+
+	handler := func(subject string, points data.Points) {
+		chunks := strings.Split(subject, ".")
+		if len(chunks) < 3 {
+			log.Println("Kafka up sub, malformed subject: ", subject)
+			return
+		}
+
+		// don't send our own stats
+		if chunks[2] == k.config.ID {
+			return
+		}
+
+		select {
+		case k.newUpPoints <- NewPoints{chunks[2], "", points}:
+		case <-k.stop:
+		}
+	}
+
+	var err error
+	k.upSub, err = NewBufferedSub(k.nc, fmt.Sprintf("up.%v.*.points", k.config.Parent),
+		bufOpts, handler)
+	if err != nil {
+		return fmt.Errorf("Kafka error subscribing to upsub: %v", err)
+	}
+
+	k.upSubHr, err = NewBufferedSub(k.nc, fmt.Sprintf("phrup.%v.*", k.config.Parent),
+		bufOpts, handler)
+	if err != nil {
+		k.upSub.Stop()
+		return fmt.Errorf("Kafka error subscribing to upSubHr: %v", err)
+	}
+
+	k.configure()
+
+	flushTicker := time.NewTicker(kafkaFlushPeriod)
+	defer flushTicker.Stop()
+
+	flush := func() {
+		if k.config.Disable || len(k.points) <= 0 {
+			return
+		}
+
+		err := k.send()
+		if err != nil {
+			log.Printf("Kafka %v: error sending points: %v\n",
+				k.config.Description, err)
+			k.config.ErrorCount++
+			k.sendStat(data.PointTypeErrorCount, k.config.ErrorCount)
+		}
+	}
+
+done:
+	for {
+		select {
+		case <-k.stop:
+			log.Println("Stopping Kafka client: ", k.config.Description)
+			break done
+		case <-flushTicker.C:
+			flush()
+		case pts := <-k.newPoints:
+			err := data.MergePoints(pts.ID, pts.Points, &k.config)
+			if err != nil {
+				log.Println("error merging new points: ", err)
+			}
+
+			for _, p := range pts.Points {
+				switch p.Type {
+				case data.PointTypeBrokers, data.PointTypeSchemaRegistry,
+					data.PointTypeTLS, data.PointTypeUsername,
+					data.PointTypePass, data.PointTypePointTypes:
+					k.configure()
+				}
+			}
+		case pts := <-k.newEdgePoints:
+			err := data.MergeEdgePoints(pts.ID, pts.Parent, pts.Points, &k.config)
+			if err != nil {
+				log.Println("error merging new points: ", err)
+			}
+		case pts := <-k.newUpPoints:
+			for _, p := range pts.Points {
+				if len(k.pointTypes) > 0 && !k.pointTypes[p.Type] {
+					continue
+				}
+
+				k.points = append(k.points, KafkaPoint{
+					NodeID: pts.ID,
+					Type:   p.Type,
+					Key:    p.Key,
+					Time:   p.Time,
+					Index:  p.Index,
+					Value:  p.Value,
+					Text:   p.Text,
+					Origin: p.Origin,
+				})
+			}
+
+			if over := len(k.points) - kafkaMaxPoints; over > 0 {
+				log.Printf("Kafka %v: buffer full, dropping %v points\n",
+					k.config.Description, over)
+				k.points = k.points[over:]
+			}
+
+			if len(k.points) >= kafkaBatchSize {
+				flush()
+			}
+		}
+	}
+
+	k.upSub.Stop()
+	k.upSubHr.Stop()
+
+	flush()
+
+	if k.writer != nil {
+		k.writer.Close()
+	}
+
+	return nil
+}
+
+// configure creates the writer and registry client from the current
+// config
+func (k *KafkaClient) configure() {
+	if k.writer != nil {
+		k.writer.Close()
+		k.writer = nil
+	}
+
+	k.registry = nil
+
+	k.pointTypes = make(map[string]bool)
+	for _, t := range splitList(k.config.PointTypes) {
+		k.pointTypes[t] = true
+	}
+
+	brokers := splitList(k.config.Brokers)
+	if len(brokers) <= 0 {
+		return
+	}
+
+	transport := &kafkago.Transport{ClientID: "siot-" + k.config.ID}
+
+	if k.config.TLS {
+		transport.TLS = &tls.Config{}
+	}
+
+	if k.config.Username != "" {
+		transport.SASL = plain.Mechanism{
+			Username: k.config.Username,
+			Password: k.config.Pass,
+		}
+	}
+
+	// messages with the same key (node ID) are written to the same
+	// partition, using the same hash as the Java client. Messages are
+	// batched by the client, so the writer does not wait for more.
+	k.writer = &kafkago.Writer{
+		Addr:                   kafkago.TCP(brokers...),
+		Balancer:               kafkago.Murmur2Balancer{},
+		BatchSize:              kafkaBatchSize,
+		BatchTimeout:           10 * time.Millisecond,
+		RequiredAcks:           kafkago.RequireOne,
+		AllowAutoTopicCreation: true,
+		Transport:              transport,
+	}
+
+	if k.config.SchemaRegistry != "" {
+		var err error
+		k.registry, err = kafka.NewRegistry(k.config.SchemaRegistry)
+		if err != nil {
+			log.Printf("Kafka %v: %v\n", k.config.Description, err)
+		}
+	}
+}
+
+// splitList splits a comma separated list and drops empty entries
+func splitList(s string) []string {
+	var ret []string
+	for _, v := range strings.Split(s, ",") {
+		v = strings.TrimSpace(v)
+		if v != "" {
+			ret = append(ret, v)
+		}
+	}
+	return ret
+}
+
+// kafkaTopic returns the topic for a point type
+func kafkaTopic(topic, pointType string) string {
+	if topic == "" {
+		topic = "siot-points"
+	}
+	return strings.ReplaceAll(topic, "{type}", pointType)
+}
+
+// send sends buffered points. Points are only cleared once all messages are
+// sent.
+func (k *KafkaClient) send() error {
+	if k.writer == nil {
+		return fmt.Errorf("no brokers configured")
+	}
+
+	msgs := make([]kafkago.Message, 0, len(k.points))
+
+	for _, p := range k.points {
+		topic := kafkaTopic(k.config.Topic, p.Type)
+
+		value, err := k.encode(topic, p)
+		if err != nil {
+			return err
+		}
+
+		msgs = append(msgs, kafkago.Message{
+			Topic: topic,
+			Key:   []byte(p.NodeID),
+			Value: value,
+			Time:  p.Time,
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), kafkaTimeout)
+	defer cancel()
+
+	err := k.writer.WriteMessages(ctx, msgs...)
+	if err != nil {
+		return err
+	}
+
+	k.config.Tx += len(msgs)
+	k.points = nil
+	k.sendStat(data.PointTypeTx, k.config.Tx)
+
+	return nil
+}
+
+// encode encodes a point in the configured format, and adds the schema
+// registry header if a registry is configured
+func (k *KafkaClient) encode(topic string, p KafkaPoint) ([]byte, error) {
+	var value []byte
+	var schemaType, schema string
+
+	if k.config.Format == data.PointValueAvro {
+		value = kafkaAvroPoint(p)
+		schemaType, schema = "AVRO", kafkaAvroSchema
+	} else {
+		var err error
+		value, err = json.Marshal(p)
+		if err != nil {
+			return nil, err
+		}
+		schemaType, schema = "JSON", kafkaJSONSchema
+	}
+
+	if k.registry == nil {
+		return value, nil
+	}
+
+	id, err := k.registry.Register(topic+"-value", schemaType, schema)
+	if err != nil {
+		return nil, err
+	}
+
+	return kafka.Frame(id, value), nil
+}
+
+// kafkaAvroPoint encodes a point using the Avro binary encoding of
+// kafkaAvroSchema
+func kafkaAvroPoint(p KafkaPoint) []byte {
+	var ret []byte
+
+	long := func(v int64) {
+		var buf [binary.MaxVarintLen64]byte
+		n := binary.PutVarint(buf[:], v)
+		ret = append(ret, buf[:n]...)
+	}
+
+	str := func(s string) {
+		long(int64(len(s)))
+		ret = append(ret, s...)
+	}
+
+	double := func(v float64) {
+		var buf [8]byte
+		binary.LittleEndian.PutUint64(buf[:], math.Float64bits(v))
+		ret = append(ret, buf[:]...)
+	}
+
+	str(p.NodeID)
+	str(p.Type)
+	str(p.Key)
+	long(p.Time.UnixNano() / 1000)
+	double(p.Index)
+	double(p.Value)
+	str(p.Text)
+	str(p.Origin)
+
+	return ret
+}
+
+func (k *KafkaClient) sendStat(typ string, value int) {
+	err := SendNodePoint(k.nc, k.config.ID, data.Point{
+		Time:  time.Now(),
+		Type:  typ,
+		Value: float64(value),
+	}, false)
+	if err != nil {
+		log.Println("Kafka: error sending stat: ", err)
+	}
+}
+
+// Stop sends a signal to the Start function to exit
+func (k *KafkaClient) Stop(err error) {
+	close(k.stop)
+}
+
+// Points is called by the Manager when new points for this
+// node are received.
+func (k *KafkaClient) Points(nodeID string, points []data.Point) {
+	k.newPoints <- NewPoints{nodeID, "", points}
+}
+
+// EdgePoints is called by the Manager when new edge points for this
+// node are received.
+func (k *KafkaClient) EdgePoints(nodeID, parentID string, points []data.Point) {
+	k.newEdgePoints <- NewPoints{nodeID, parentID, points}
+}
@@ -0,0 +1,62 @@
+package client
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestKafkaAvroPoint(t *testing.T) {
+	p := KafkaPoint{
+		NodeID: "n1",
+		Type:   "temp",
+		Time:   time.Unix(1665756000, 500000),
+		Index:  1,
+		Value:  21.5,
+		Origin: "o",
+	}
+
+	d := kafkaAvroPoint(p)
+
+	str := func() string {
+		n, l := binary.Varint(d)
+		s := string(d[l : l+int(n)])
+		d = d[l+int(n):]
+		return s
+	}
+
+	double := func() float64 {
+		v := math.Float64frombits(binary.LittleEndian.Uint64(d))
+		d = d[8:]
+		return v
+	}
+
+	if str() != "n1" || str() != "temp" || str() != "" {
+		t.Fatal("strings not encoded correctly")
+	}
+
+	ts, l := binary.Varint(d)
+	d = d[l:]
+	if ts != 1665756000000500 {
+		t.Error("time not correct: ", ts)
+	}
+
+	if double() != 1 || double() != 21.5 {
+		t.Error("doubles not correct")
+	}
+
+	if str() != "" || str() != "o" || len(d) != 0 {
+		t.Error("trailing fields not correct")
+	}
+}
+
+func TestKafkaTopic(t *testing.T) {
+	if kafkaTopic("", "temp") != "siot-points" {
+		t.Error("default topic not correct")
+	}
+
+	if kafkaTopic("siot.{type}", "temp") != "siot.temp" {
+		t.Error("topic template not correct")
+	}
+}
@@ -0,0 +1,352 @@
+package client
+
+import (
+	"log"
+	"math"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// Lighting drives the OutputPointType (defaults to value) point of
+// OutputNodeID from dusk to dawn at Latitude/Longitude. Lights turn on
+// DuskOffset minutes after sunset and off DawnOffset minutes after sunrise
+// (offsets can be negative). While dark, the lights are set to Level
+// (percent), or OccupiedLevel while the OccupancyPointType (defaults to value)
+// point of OccupancyNodeID is not zero and for OccupancyTimeout minutes after
+// it clears. Setting Override sets the lights to OverrideLevel regardless of
+// the time of day, and Override is cleared after OverrideTimeout minutes (0
+// means no timeout). The level is converted to an output value with the
+// dimming Curve (linear, square, or cie), where 100% is OutputMax (defaults
+// to 100). Dark, Occupied, and ActiveLevel report the current state.
+type Lighting struct {
+	ID                 string  `node:"id"`
+	Parent             string  `node:"parent"`
+	Description        string  `point:"description"`
+	Latitude           float64 `point:"latitude"`
+	Longitude          float64 `point:"longitude"`
+	DuskOffset         float64 `point:"duskOffset"`
+	DawnOffset         float64 `point:"dawnOffset"`
+	OutputNodeID       string  `point:"outputNodeID"`
+	OutputPointType    string  `point:"outputPointType"`
+	OutputMax          float64 `point:"outputMax"`
+	OccupancyNodeID    string  `point:"occupancyNodeID"`
+	OccupancyPointType string  `point:"occupancyPointType"`
+	OccupancyTimeout   float64 `point:"occupancyTimeout"`
+	Level              float64 `point:"level"`
+	OccupiedLevel      float64 `point:"occupiedLevel"`
+	Curve              string  `point:"curve"`
+	Override           bool    `point:"override"`
+	OverrideLevel      float64 `point:"overrideLevel"`
+	OverrideTimeout    float64 `point:"overrideTimeout"`
+	Disable            bool    `point:"disable"`
+	Dark               bool    `point:"dark"`
+	Occupied           bool    `point:"occupied"`
+	ActiveLevel        float64 `point:"activeLevel"`
+}
+
+// how often the lighting controller checks dusk/dawn and timeouts
+var lightingTickPeriod = time.Second
+
+// dimmingCurve converts a level (percent) to a fraction of full output.
+// The cie curve uses CIE 1931 lightness so that steps in level look evenly
+// spaced.
+func dimmingCurve(curve string, level float64) float64 {
+	l := math.Max(0, math.Min(level, 100)) / 100
+
+	switch curve {
+	case data.PointValueSquare:
+		return l * l
+	case data.PointValueCIE:
+		lightness := l * 100
+		if lightness <= 8 {
+			return lightness / 903.3
+		}
+		return math.Pow((lightness+16)/116, 3)
+	default:
+		return l
+	}
+}
+
+// isDark returns true if t is between dusk and dawn at lat/lon. Dusk and dawn
+// are sunset and sunrise shifted by the offsets.
+func isDark(t time.Time, lat, lon float64, duskOffset, dawnOffset time.Duration) bool {
+	// the solar day can be a day before or after the UTC day
+	for i := -1; i <= 1; i++ {
+		rise, set, ok := sunTimes(t.AddDate(0, 0, i), lat, lon)
+		if !ok {
+			continue
+		}
+
+		if !t.Before(rise.Add(dawnOffset)) && t.Before(set.Add(duskOffset)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// LightingClient is a SIOT client that runs lighting controller nodes
+type LightingClient struct {
+	nc            *nats.Conn
+	config        Lighting
+	stop          chan struct{}
+	newPoints     chan NewPoints
+	newEdgePoints chan NewPoints
+	newOccupancy  chan bool
+	occupancySub  *nats.Subscription
+	// occupancy is the state of the occupancy sensor, config.Occupied also
+	// includes the timeout
+	occupancy     bool
+	lastOccupied  time.Time
+	overrideStart time.Time
+	// output is the last output value sent, nil if not sent yet
+	output *float64
+}
+
+// NewLightingClient ...
+func NewLightingClient(nc *nats.Conn, config Lighting) Client {
+	return &LightingClient{
+		nc:            nc,
+		config:        config,
+		stop:          make(chan struct{}),
+		newPoints:     make(chan NewPoints),
+		newEdgePoints: make(chan NewPoints),
+		newOccupancy:  make(chan bool),
+	}
+}
+
+// Start runs the main logic for this client and blocks until stopped
+func (l *LightingClient) Start() error {
+	log.Println("Starting lighting client: ", l.config.Description)
+
+	// the override timeout runs from when override was set, so get the
+	// time of the override point in case we restarted
+	l.overrideStart = time.Now()
+	nodes, err := GetNode(l.nc, l.config.ID, "none")
+	if err != nil || len(nodes) < 1 {
+		log.Printf("Lighting %v: error getting node: %v\n", l.config.Description, err)
+	} else if p, ok := nodes[0].Points.Find(data.PointTypeOverride, ""); ok {
+		l.overrideStart = p.Time
+	}
+
+	l.subscribeOccupancy()
+
+	ticker := time.NewTicker(lightingTickPeriod)
+	defer ticker.Stop()
+
+	l.update(time.Now())
+
+done:
+	for {
+		select {
+		case <-l.stop:
+			log.Println("Stopping lighting client: ", l.config.Description)
+			break done
+		case now := <-ticker.C:
+			l.update(now)
+		case occupancy := <-l.newOccupancy:
+			l.occupancy = occupancy
+			l.update(time.Now())
+		case pts := <-l.newPoints:
+			err := data.MergePoints(pts.ID, pts.Points, &l.config)
+			if err != nil {
+				log.Println("error merging new points: ", err)
+			}
+
+			for _, p := range pts.Points {
+				switch p.Type {
+				case data.PointTypeOverride:
+					l.overrideStart = p.Time
+					if l.overrideStart.IsZero() {
+						l.overrideStart = time.Now()
+					}
+				case data.PointTypeOccupancyNodeID, data.PointTypeOccupancyPointType:
+					l.subscribeOccupancy()
+				case data.PointTypeOutputNodeID, data.PointTypeOutputPointType:
+					// send the output to the new point
+					l.output = nil
+				}
+			}
+
+			l.update(time.Now())
+		case pts := <-l.newEdgePoints:
+			err := data.MergeEdgePoints(pts.ID, pts.Parent, pts.Points, &l.config)
+			if err != nil {
+				log.Println("error merging new points: ", err)
+			}
+		}
+	}
+
+	// the output is left alone so that lights don't flicker when the client
+	// restarts
+	if l.occupancySub != nil {
+		l.occupancySub.Unsubscribe()
+	}
+
+	return nil
+}
+
+// update evaluates the dusk/dawn, occupancy, and override state and sets the
+// output
+func (l *LightingClient) update(now time.Time) {
+	var points data.Points
+
+	if l.config.Override && l.config.OverrideTimeout > 0 &&
+		now.Sub(l.overrideStart) >= time.Duration(l.config.OverrideTimeout*float64(time.Minute)) {
+		l.config.Override = false
+		points = append(points, data.Point{Type: data.PointTypeOverride, Value: 0})
+	}
+
+	dark := isDark(now, l.config.Latitude, l.config.Longitude,
+		time.Duration(l.config.DuskOffset*float64(time.Minute)),
+		time.Duration(l.config.DawnOffset*float64(time.Minute)))
+	if dark != l.config.Dark {
+		l.config.Dark = dark
+		points = append(points, data.Point{Type: data.PointTypeDark,
+			Value: data.BoolToFloat(dark)})
+	}
+
+	if l.occupancy {
+		l.lastOccupied = now
+	}
+
+	occupied := l.occupancy || (!l.lastOccupied.IsZero() &&
+		now.Sub(l.lastOccupied) < time.Duration(l.config.OccupancyTimeout*float64(time.Minute)))
+	if occupied != l.config.Occupied {
+		l.config.Occupied = occupied
+		points = append(points, data.Point{Type: data.PointTypeOccupied,
+			Value: data.BoolToFloat(occupied)})
+	}
+
+	level := 0.0
+	switch {
+	case l.config.Disable:
+		// lights are off while disabled
+	case l.config.Override:
+		level = l.config.OverrideLevel
+	case dark && occupied:
+		level = l.config.OccupiedLevel
+	case dark:
+		level = l.config.Level
+	}
+
+	if level != l.config.ActiveLevel {
+		l.config.ActiveLevel = level
+		points = append(points, data.Point{Type: data.PointTypeActiveLevel,
+			Value: level})
+	}
+
+	if len(points) > 0 {
+		for i := range points {
+			points[i].Time = now
+		}
+
+		err := SendNodePoints(l.nc, l.config.ID, points, false)
+		if err != nil {
+			log.Println("Lighting: error sending state: ", err)
+		}
+	}
+
+	outputMax := l.config.OutputMax
+	if outputMax == 0 {
+		outputMax = 100
+	}
+
+	l.setOutput(dimmingCurve(l.config.Curve, level) * outputMax)
+}
+
+// setOutput sends the output value if it changed
+func (l *LightingClient) setOutput(v float64) {
+	if l.config.OutputNodeID == "" || (l.output != nil && *l.output == v) {
+		return
+	}
+
+	pointType := l.config.OutputPointType
+	if pointType == "" {
+		pointType = data.PointTypeValue
+	}
+
+	err := SendNodePoint(l.nc, l.config.OutputNodeID, data.Point{
+		Time:   time.Now(),
+		Type:   pointType,
+		Value:  v,
+		Origin: l.config.ID,
+	}, true)
+	if err != nil {
+		log.Printf("Lighting %v: error setting output: %v\n", l.config.Description, err)
+		return
+	}
+
+	l.output = &v
+}
+
+// subscribeOccupancy subscribes to the occupancy sensor point and gets its
+// current value
+func (l *LightingClient) subscribeOccupancy() {
+	if l.occupancySub != nil {
+		l.occupancySub.Unsubscribe()
+		l.occupancySub = nil
+	}
+
+	l.occupancy = false
+
+	if l.config.OccupancyNodeID == "" {
+		return
+	}
+
+	pointType := l.config.OccupancyPointType
+	if pointType == "" {
+		pointType = data.PointTypeValue
+	}
+
+	var err error
+	l.occupancySub, err = l.nc.Subscribe(SubjectNodePoints(l.config.OccupancyNodeID), func(msg *nats.Msg) {
+		points, err := DecodePoints(msg)
+		if err != nil {
+			log.Println("Lighting: error decoding occupancy points: ", err)
+			return
+		}
+
+		for _, p := range points {
+			if p.Type == pointType {
+				select {
+				case l.newOccupancy <- p.Value != 0:
+				case <-l.stop:
+				}
+			}
+		}
+	})
+	if err != nil {
+		log.Printf("Lighting %v: error subscribing to occupancy sensor: %v\n",
+			l.config.Description, err)
+	}
+
+	nodes, err := GetNode(l.nc, l.config.OccupancyNodeID, "none")
+	if err != nil || len(nodes) < 1 {
+		log.Printf("Lighting %v: error getting occupancy sensor: %v\n",
+			l.config.Description, err)
+		return
+	}
+
+	v, _ := nodes[0].Points.Value(pointType, "")
+	l.occupancy = v != 0
+}
+
+// Stop sends a signal to the Start function to exit
+func (l *LightingClient) Stop(err error) {
+	close(l.stop)
+}
+
+// Points is called by the Manager when new points for this
+// node are received.
+func (l *LightingClient) Points(nodeID string, points []data.Point) {
+	l.newPoints <- NewPoints{nodeID, "", points}
+}
+
+// EdgePoints is called by the Manager when new edge points for this
+// node are received.
+func (l *LightingClient) EdgePoints(nodeID, parentID string, points []data.Point) {
+	l.newEdgePoints <- NewPoints{nodeID, parentID, points}
+}
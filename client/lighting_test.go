@@ -0,0 +1,76 @@
+package client_test
+
+import (
+	"testing"
+
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+	"github.com/simpleiot/simpleiot/server"
+)
+
+func TestLighting(t *testing.T) {
+	nc, root, stop, err := server.TestServer()
+	if err != nil {
+		t.Fatal("Error starting test server: ", err)
+	}
+	defer stop()
+
+	for _, id := range []string{"light", "occ"} {
+		err = client.SendNodeType(nc, client.Variable{ID: id, Parent: root.ID}, "test")
+		if err != nil {
+			t.Fatal("Error sending variable node: ", err)
+		}
+	}
+
+	// days are about 12h at the equator, so these offsets make it dark all
+	// the time
+	err = client.SendNodeType(nc, client.Lighting{
+		ID:              "lighting",
+		Parent:          root.ID,
+		Description:     "test lighting",
+		DuskOffset:      -720,
+		DawnOffset:      720,
+		OutputNodeID:    "light",
+		OccupancyNodeID: "occ",
+		Level:           20,
+		OccupiedLevel:   100,
+		Curve:           data.PointValueSquare,
+	}, "test")
+	if err != nil {
+		t.Fatal("Error sending lighting node: ", err)
+	}
+
+	waitPointValue(t, nc, "lighting", data.PointTypeDark, 1)
+	waitPointValue(t, nc, "light", data.PointTypeValue, 4)
+
+	err = client.SendNodePoint(nc, "occ", data.Point{Type: data.PointTypeValue,
+		Value: 1}, true)
+	if err != nil {
+		t.Fatal("Error sending occupancy: ", err)
+	}
+
+	waitPointValue(t, nc, "lighting", data.PointTypeOccupied, 1)
+	waitPointValue(t, nc, "light", data.PointTypeValue, 100)
+
+	err = client.SendNodePoint(nc, "occ", data.Point{Type: data.PointTypeValue,
+		Value: 0}, true)
+	if err != nil {
+		t.Fatal("Error sending occupancy: ", err)
+	}
+
+	waitPointValue(t, nc, "light", data.PointTypeValue, 4)
+
+	// override times out after 0.6s
+	err = client.SendNodePoints(nc, "lighting", data.Points{
+		{Type: data.PointTypeOverrideLevel, Value: 50, Origin: "test"},
+		{Type: data.PointTypeOverrideTimeout, Value: 0.01, Origin: "test"},
+		{Type: data.PointTypeOverride, Value: 1, Origin: "test"},
+	}, true)
+	if err != nil {
+		t.Fatal("Error sending override: ", err)
+	}
+
+	waitPointValue(t, nc, "light", data.PointTypeValue, 25)
+	waitPointValue(t, nc, "lighting", data.PointTypeOverride, 0)
+	waitPointValue(t, nc, "light", data.PointTypeValue, 4)
+}
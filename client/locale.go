@@ -0,0 +1,81 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/data"
+	"gopkg.in/yaml.v2"
+)
+
+// ExportStrings returns the translatable strings (see
+// data.TranslatablePointTypes) of a node and its descendants, with the
+// existing translations for locale. If id is "root" or empty, the entire
+// tree is exported.
+func ExportStrings(nc *nats.Conn, id, locale string) (data.LocaleStrings, error) {
+	out, err := ExportNodes(nc, id)
+	if err != nil {
+		return data.LocaleStrings{}, err
+	}
+
+	var exp data.Export
+	err = yaml.Unmarshal(out, &exp)
+	if err != nil {
+		return data.LocaleStrings{}, fmt.Errorf("Error decoding export: %w", err)
+	}
+
+	var nodes []data.Node
+
+	var walk func(ens []data.ExportNode)
+	walk = func(ens []data.ExportNode) {
+		for _, en := range ens {
+			nodes = append(nodes, data.Node{
+				ID:     en.ID,
+				Type:   en.Type,
+				Points: data.ExportToPoints(en.Points, time.Time{}, ""),
+			})
+			walk(en.Children)
+		}
+	}
+
+	walk(exp.Nodes)
+
+	return data.NewLocaleStrings(locale, nodes), nil
+}
+
+// ImportStrings writes the translated strings as translation points for
+// ls.Locale. Strings that are not translated (Text is blank) are
+// skipped.
+func ImportStrings(nc *nats.Conn, ls data.LocaleStrings, origin string) error {
+	if ls.Locale == "" {
+		return errors.New("locale must be set")
+	}
+
+	points := make(map[string]data.Points)
+	var ids []string
+
+	for _, s := range ls.Strings {
+		if s.Text == "" || s.ID == "" {
+			continue
+		}
+
+		p := data.TranslationPoint(ls.Locale, s.Type, s.Text)
+		p.Origin = origin
+
+		if _, ok := points[s.ID]; !ok {
+			ids = append(ids, s.ID)
+		}
+		points[s.ID] = append(points[s.ID], p)
+	}
+
+	for _, id := range ids {
+		err := SendNodePoints(nc, id, points[id], true)
+		if err != nil {
+			return fmt.Errorf("Error writing translations for node %v: %w", id, err)
+		}
+	}
+
+	return nil
+}
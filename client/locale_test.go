@@ -0,0 +1,69 @@
+package client_test
+
+import (
+	"testing"
+
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/server"
+)
+
+func TestExportImportStrings(t *testing.T) {
+	nc, root, stop, err := server.TestServer()
+	if err != nil {
+		t.Fatal("Error starting test server: ", err)
+	}
+	defer stop()
+
+	err = client.SendNodeType(nc, client.Variable{ID: "v1", Parent: root.ID,
+		Description: "Tank level"}, "test")
+	if err != nil {
+		t.Fatal("Error sending node: ", err)
+	}
+
+	ls, err := client.ExportStrings(nc, root.ID, "de")
+	if err != nil {
+		t.Fatal("Error exporting strings: ", err)
+	}
+
+	var found bool
+	for i, s := range ls.Strings {
+		if s.ID == "v1" {
+			found = true
+			if s.Source != "Tank level" || s.Text != "" {
+				t.Fatalf("Unexpected string: %+v", s)
+			}
+			ls.Strings[i].Text = "Füllstand"
+		}
+	}
+
+	if !found {
+		t.Fatal("Variable description not exported")
+	}
+
+	err = client.ImportStrings(nc, ls, "test")
+	if err != nil {
+		t.Fatal("Error importing strings: ", err)
+	}
+
+	nodes, err := client.GetNode(nc, "v1", root.ID)
+	if err != nil || len(nodes) != 1 {
+		t.Fatal("Error getting node: ", err)
+	}
+
+	if d := nodes[0].Points.Localize("de").Desc(); d != "Füllstand" {
+		t.Fatal("Expected translated description, got: ", d)
+	}
+
+	if d := nodes[0].Points.Desc(); d != "Tank level" {
+		t.Fatal("Source description changed: ", d)
+	}
+
+	ls, err = client.ExportStrings(nc, "v1", "de")
+	if err != nil {
+		t.Fatal("Error exporting strings: ", err)
+	}
+
+	if len(ls.Strings) != 1 || ls.Strings[0].Text != "Füllstand" {
+		t.Fatalf("Expected exported translation, got %+v", ls)
+	}
+}
@@ -1,9 +1,13 @@
 package client
 
 import (
+	"context"
 	"log"
 	"reflect"
+	"runtime/pprof"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/nats-io/nats.go"
@@ -23,12 +27,78 @@ type Manager[T any] struct {
 	stop       chan struct{}
 	chScan     chan struct{}
 	chAction   chan func()
-	chDeleteCS chan string
+	chDeleteCS chan clientExit
 
 	clientStates map[string]*clientState[T]
 
+	// restart policy and crash state of clients that have exited on their
+	// own, keyed like clientStates
+	policy  RestartPolicy
+	crashes map[string]*clientCrash
+
+	// IDs of nodes whose clients have given up, read by the upSub callback
+	gaveUpLock sync.Mutex
+	gaveUp     map[string]bool
+
 	// subscription to listen for new points
 	upSub *nats.Subscription
+
+	// running client nodes that have been set offline
+	offline map[string]bool
+
+	// metrics, reported as points on the root node with the key set
+	// to the node type. restarts counts clients that exited with an
+	// error or panicked.
+	metricsPeriod time.Duration
+	restarts      int
+	decodeErrors  uint64
+	scanDurations *data.PointAverager
+}
+
+var reportManagerMetricsPeriod = time.Minute
+
+// RestartPolicy determines how a Manager restarts clients that exit or panic
+// without being stopped. Restarts are delayed by MinDelay, doubling for each
+// consecutive crash up to MaxDelay. If MaxAttempts is set, the Manager gives
+// up after that many consecutive crashes and does not start the client again
+// until a user changes the node. A client that crashes CrashLoopCount times
+// within CrashLoopWindow is flagged as crash looping. A client that runs for
+// longer than CrashLoopWindow is considered healthy again.
+type RestartPolicy struct {
+	MinDelay        time.Duration
+	MaxDelay        time.Duration
+	MaxAttempts     int
+	CrashLoopCount  int
+	CrashLoopWindow time.Duration
+}
+
+// DefaultRestartPolicy is used by managers unless SetRestartPolicy is called
+var DefaultRestartPolicy = RestartPolicy{
+	MinDelay:        time.Second,
+	MaxDelay:        time.Minute,
+	CrashLoopCount:  5,
+	CrashLoopWindow: 5 * time.Minute,
+}
+
+// clientExit is sent by a clientState goroutine when it exits. err is set if
+// the client exited without being stopped.
+type clientExit struct {
+	key string
+	err error
+}
+
+// clientCrash tracks the crashes of a client
+type clientCrash struct {
+	nodeID string
+	// consecutive crashes
+	attempts int
+	// total crashes, reported in the clientCrashes point
+	count int
+	// crash times within the crash loop window
+	times     []time.Time
+	retry     time.Time
+	gaveUp    bool
+	crashLoop bool
 }
 
 // NewManager takes constructor for a node client and returns a Manager for that client
@@ -37,22 +107,35 @@ type Manager[T any] struct {
 func NewManager[T any](nc *nats.Conn, root string,
 	construct func(nc *nats.Conn, config T) Client) *Manager[T] {
 	var x T
-	nodeType := reflect.TypeOf(x).Name()
-	nodeType = strings.ToLower(nodeType[0:1]) + nodeType[1:]
+	nodeType := nodeTypeOf(x)
 
 	return &Manager[T]{
-		nc:           nc,
-		root:         root,
-		nodeType:     nodeType,
-		construct:    construct,
-		stop:         make(chan struct{}),
-		chScan:       make(chan struct{}),
-		chAction:     make(chan func()),
-		chDeleteCS:   make(chan string),
-		clientStates: make(map[string]*clientState[T]),
+		nc:            nc,
+		root:          root,
+		nodeType:      nodeType,
+		construct:     construct,
+		stop:          make(chan struct{}),
+		chScan:        make(chan struct{}),
+		chAction:      make(chan func()),
+		chDeleteCS:    make(chan clientExit),
+		clientStates:  make(map[string]*clientState[T]),
+		policy:        DefaultRestartPolicy,
+		crashes:       make(map[string]*clientCrash),
+		gaveUp:        make(map[string]bool),
+		offline:       make(map[string]bool),
+		metricsPeriod: reportManagerMetricsPeriod,
+		scanDurations: data.NewPointAverager(
+			data.PointTypeMetricManagerScanDuration),
 	}
 }
 
+// nodeTypeOf returns the node type for a client config, which is the name of
+// the config type with the first letter in lower case
+func nodeTypeOf(config any) string {
+	nodeType := reflect.TypeOf(config).Name()
+	return strings.ToLower(nodeType[0:1]) + nodeType[1:]
+}
+
 // Start node manager. This function looks for children of a certain node type.
 // When new nodes are found, the data is decoded into the client type config, and the
 // constructor for the node client is called. This call blocks until Stop is called.
@@ -62,23 +145,41 @@ func (m *Manager[T]) Start() error {
 	// to all points
 	var err error
 	m.upSub, err = m.nc.Subscribe("up.none.>", func(msg *nats.Msg) {
-		points, err := data.PbDecodePoints(msg.Data)
+		points, err := DecodePoints(msg)
 		if err != nil {
 			log.Println("Error decoding points")
+			atomic.AddUint64(&m.decodeErrors, 1)
 			return
 		}
 
 		for _, p := range points {
-			if p.Type == data.PointTypeNodeType {
+			if p.Type == data.PointTypeNodeType || p.Type == data.PointTypeArchived {
 				m.chScan <- struct{}{}
 			}
 		}
+
+		// a user change to a node whose client has given up retries it
+		chunks := strings.Split(msg.Subject, ".")
+		if len(chunks) < 4 || !m.hasGivenUp(chunks[2]) {
+			return
+		}
+
+		for _, p := range points {
+			if p.Origin != "" {
+				id := chunks[2]
+				m.chAction <- func() { m.retryGaveUp(id) }
+				return
+			}
+		}
 	})
 
 	if err != nil {
 		return err
 	}
 
+	clientResources.start()
+	defer clientResources.release()
+
 	err = m.scan()
 	if err != nil {
 		log.Println("Error scanning for new nodes: ", err)
@@ -87,6 +188,15 @@ func (m *Manager[T]) Start() error {
 	shutdownTimer := time.NewTimer(time.Hour)
 	shutdownTimer.Stop()
 
+	metricsTicker := time.NewTicker(m.metricsPeriod)
+	defer metricsTicker.Stop()
+
+	restartTimer := time.NewTimer(time.Hour)
+	restartTimer.Stop()
+
+	healthTicker := time.NewTicker(HeartbeatPeriod)
+	defer healthTicker.Stop()
+
 	stopping := false
 
 	scan := func() {
@@ -120,16 +230,39 @@ done:
 			scan()
 		case <-m.chScan:
 			scan()
-		case key := <-m.chDeleteCS:
-			delete(m.clientStates, key)
+		case <-metricsTicker.C:
+			if !stopping {
+				m.reportMetrics()
+			}
+		case <-healthTicker.C:
+			if !stopping {
+				m.checkHealth(time.Now())
+			}
+		case <-restartTimer.C:
+			scan()
+			m.resetRestartTimer(restartTimer)
+		case exit := <-m.chDeleteCS:
+			cs := m.clientStates[exit.key]
+			delete(m.clientStates, exit.key)
+			if cs != nil {
+				// set again by scan from the offline point of the
+				// node if the client is restarted
+				delete(m.offline, cs.node.ID)
+			}
 			if stopping {
 				if len(m.clientStates) <= 0 {
 					break done
 				}
 			} else {
+				if exit.err != nil && cs != nil {
+					// only abnormal exits are counted as restarts
+					m.restarts++
+					m.crashed(exit.key, cs, exit.err, time.Now())
+				}
 				// client may have exitted itself due to child
 				// node changes so scan to re-initialize it again
 				scan()
+				m.resetRestartTimer(restartTimer)
 			}
 		case <-shutdownTimer.C:
 			// FIXME: should we return an error here?
@@ -149,13 +282,292 @@ func (m *Manager[T]) Stop(err error) {
 	m.stop <- struct{}{}
 }
 
+// SetRestartPolicy sets the policy for restarting crashed clients. It must be
+// called before Start.
+func (m *Manager[T]) SetRestartPolicy(p RestartPolicy) {
+	m.policy = p
+}
+
+// SetMetricsPeriod sets how often metrics are reported. It must be called
+// before Start.
+func (m *Manager[T]) SetMetricsPeriod(p time.Duration) {
+	m.metricsPeriod = p
+}
+
+// crashed records a crash of a client, schedules its restart, and reports the
+// crash as points on the client node
+func (m *Manager[T]) crashed(key string, cs *clientState[T], err error, now time.Time) {
+	c, ok := m.crashes[key]
+	if !ok {
+		c = &clientCrash{nodeID: cs.node.ID}
+		if p, ok := cs.node.Points.Find(data.PointTypeClientCrashes, ""); ok {
+			c.count = int(p.Value)
+		}
+		m.crashes[key] = c
+	}
+
+	window := m.policy.CrashLoopWindow
+
+	// a client that ran for a while before crashing starts a new series
+	if window > 0 && now.Sub(cs.started) > window {
+		c.attempts = 0
+	}
+
+	c.attempts++
+	c.count++
+
+	times := []time.Time{now}
+	for _, t := range c.times {
+		if window <= 0 || now.Sub(t) < window {
+			times = append(times, t)
+		}
+	}
+	c.times = times
+
+	wasCrashLoop := c.crashLoop
+	if m.policy.CrashLoopCount > 0 && len(c.times) >= m.policy.CrashLoopCount {
+		c.crashLoop = true
+	}
+
+	c.retry = now.Add(m.policy.delay(c.attempts))
+
+	if m.policy.MaxAttempts > 0 && c.attempts >= m.policy.MaxAttempts {
+		c.gaveUp = true
+		m.gaveUpLock.Lock()
+		m.gaveUp[c.nodeID] = true
+		m.gaveUpLock.Unlock()
+		log.Printf("Client %v %v crashed %v times, giving up: %v\n",
+			m.nodeType, c.nodeID, c.attempts, err)
+	} else {
+		log.Printf("Client %v %v crashed, restarting in %v: %v\n",
+			m.nodeType, c.nodeID, c.retry.Sub(now), err)
+	}
+
+	if c.crashLoop && !wasCrashLoop {
+		log.Printf("Client %v %v is crash looping\n", m.nodeType, c.nodeID)
+	}
+
+	pts := data.Points{
+		{Time: now, Type: data.PointTypeClientCrashes, Value: float64(c.count)},
+		{Time: now, Type: data.PointTypeClientError, Text: err.Error()},
+		{Time: now, Type: data.PointTypeClientCrashLoop, Value: data.BoolToFloat(c.crashLoop)},
+	}
+
+	sendErr := SendNodePoints(m.nc, c.nodeID, pts, false)
+	if sendErr != nil {
+		log.Printf("Error sending crash points for %v: %v\n", c.nodeID, sendErr)
+	}
+}
+
+// delay returns how long to wait before restarting a client after attempts
+// consecutive crashes
+func (p RestartPolicy) delay(attempts int) time.Duration {
+	d := p.MinDelay
+	for i := 1; i < attempts && d < p.MaxDelay; i++ {
+		d *= 2
+	}
+
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+
+	return d
+}
+
+// resetRestartTimer sets t to fire when the next crashed client is due
+// to be restarted
+func (m *Manager[T]) resetRestartTimer(t *time.Timer) {
+	var next time.Time
+	for key, c := range m.crashes {
+		if _, running := m.clientStates[key]; running || c.gaveUp {
+			continue
+		}
+		if next.IsZero() || c.retry.Before(next) {
+			next = c.retry
+		}
+	}
+
+	if !t.Stop() {
+		select {
+		case <-t.C:
+		default:
+		}
+	}
+
+	if !next.IsZero() {
+		t.Reset(time.Until(next))
+	}
+}
+
+func (m *Manager[T]) hasGivenUp(id string) bool {
+	m.gaveUpLock.Lock()
+	defer m.gaveUpLock.Unlock()
+	return m.gaveUp[id]
+}
+
+// retryGaveUp restarts clients for a node that have given up
+func (m *Manager[T]) retryGaveUp(id string) {
+	m.gaveUpLock.Lock()
+	delete(m.gaveUp, id)
+	m.gaveUpLock.Unlock()
+
+	found := false
+	for _, c := range m.crashes {
+		if c.nodeID == id && c.gaveUp {
+			c.gaveUp = false
+			c.attempts = 0
+			c.retry = time.Time{}
+			found = true
+		}
+	}
+
+	if !found {
+		return
+	}
+
+	log.Printf("Node %v changed, retrying %v client\n", id, m.nodeType)
+
+	err := m.scan()
+	if err != nil {
+		log.Println("Error scanning for new nodes: ", err)
+	}
+}
+
+// clearCrashes forgets crashes of clients that have been running for
+// longer than the crash loop window and of nodes that have been removed
+func (m *Manager[T]) clearCrashes(found map[string]bool, now time.Time) {
+	for key, c := range m.crashes {
+		if !found[key] {
+			delete(m.crashes, key)
+			m.gaveUpLock.Lock()
+			delete(m.gaveUp, c.nodeID)
+			m.gaveUpLock.Unlock()
+			continue
+		}
+
+		cs, running := m.clientStates[key]
+		if !running || now.Sub(cs.started) <= m.policy.CrashLoopWindow {
+			continue
+		}
+
+		delete(m.crashes, key)
+
+		if c.crashLoop {
+			err := SendNodePoint(m.nc, c.nodeID, data.Point{Time: now,
+				Type: data.PointTypeClientCrashLoop, Value: 0}, false)
+			if err != nil {
+				log.Printf("Error clearing crash loop for %v: %v\n", c.nodeID, err)
+			}
+		}
+	}
+}
+
+// checkHealth sets running clients that have not sent a heartbeat for
+// several periods offline, and clears offline when heartbeats resume
+func (m *Manager[T]) checkHealth(now time.Time) {
+	timeout := HeartbeatPeriod * heartbeatsMissed
+
+	for _, cs := range m.clientStates {
+		id := cs.node.ID
+		last := cs.heartbeatTime()
+
+		if last.Before(cs.started) {
+			// no heartbeat yet from this run of the client
+			if now.Sub(cs.started) <= timeout {
+				continue
+			}
+		}
+
+		offline := now.Sub(last) > timeout
+		if offline == m.offline[id] {
+			continue
+		}
+
+		m.offline[id] = offline
+
+		if offline {
+			log.Printf("Client %v %v stopped sending heartbeats\n", m.nodeType, id)
+		} else {
+			log.Printf("Client %v %v is sending heartbeats again\n", m.nodeType, id)
+		}
+
+		err := SendNodePoint(m.nc, id, data.Point{Time: now,
+			Type: data.PointTypeOffline, Value: data.BoolToFloat(offline)}, false)
+		if err != nil {
+			log.Printf("Error sending offline point for %v: %v\n", id, err)
+		}
+	}
+}
+
+// reportMetrics sends manager metrics to the root node. The node type is
+// used as the point key so that each manager has its own set of points.
+func (m *Manager[T]) reportMetrics() {
+	now := time.Now()
+
+	scanDuration := m.scanDurations.GetAverage()
+	m.scanDurations.ResetAverage()
+
+	pts := data.Points{
+		{Time: now, Type: data.PointTypeMetricManagerActiveClients,
+			Key: m.nodeType, Value: float64(len(m.clientStates))},
+		{Time: now, Type: data.PointTypeMetricManagerRestarts,
+			Key: m.nodeType, Value: float64(m.restarts)},
+		{Time: now, Type: data.PointTypeMetricManagerScanDuration,
+			Key: m.nodeType, Value: scanDuration.Value},
+		{Time: now, Type: data.PointTypeMetricManagerDecodeErrors,
+			Key: m.nodeType, Value: float64(atomic.LoadUint64(&m.decodeErrors))},
+	}
+
+	err := SendNodePoints(m.nc, m.root, pts, false)
+	if err != nil {
+		log.Printf("Error sending manager metrics for %v: %v\n", m.nodeType, err)
+	}
+
+	m.reportClientResources(now)
+}
+
+// reportClientResources sends the resource usage of each client from the last
+// sample of clientResources to the client node. CPU is only reported if a CPU
+// profile was taken (see SetClientCPUProfile).
+func (m *Manager[T]) reportClientResources(now time.Time) {
+	for _, cs := range m.clientStates {
+		u, ok := clientResources.get(cs.node.ID)
+		if !ok {
+			continue
+		}
+
+		pts := data.Points{
+			{Time: now, Type: data.PointTypeMetricClientGoroutines,
+				Value: float64(u.goroutines)},
+		}
+
+		if u.cpuSampled {
+			pts = append(pts, data.Point{Time: now,
+				Type: data.PointTypeMetricClientCPU, Value: u.cpu})
+		}
+
+		err := SendNodePoints(m.nc, cs.node.ID, pts, false)
+		if err != nil {
+			log.Printf("Error sending resource usage for %v: %v\n", cs.node.ID, err)
+		}
+	}
+}
+
 func (m *Manager[T]) scan() error {
+	start := time.Now()
+	defer func() {
+		m.scanDurations.AddPoint(data.Point{Time: time.Now(),
+			Value: float64(time.Since(start).Milliseconds())})
+	}()
+
 	children, err := GetNodeChildren(m.nc, m.root, m.nodeType, false, false)
 
 	if err != nil {
 		return err
 	}
 
+	children = removeArchived(children)
+
 	if len(children) < 0 {
 		return nil
 	}
@@ -171,21 +583,36 @@ func (m *Manager[T]) scan() error {
 			continue
 		}
 
-		cs := newClientState(m.nc, m.construct, n)
+		if c, ok := m.crashes[key]; ok && (c.gaveUp || start.Before(c.retry)) {
+			// waiting to restart a crashed client
+			continue
+		}
+
+		if v, ok := n.Points.Value(data.PointTypeOffline, ""); ok && v != 0 {
+			// clear offline once the client sends heartbeats
+			m.offline[n.ID] = true
+		}
+
+		cs := newClientState(m.nc, m.construct, n, &m.decodeErrors)
 
 		m.clientStates[key] = cs
 
 		go func() {
-			err := cs.start()
+			var err error
+			// goroutines of the client inherit the label
+			pprof.Do(context.Background(), pprof.Labels(clientLabel, cs.node.ID),
+				func(context.Context) { err = cs.start() })
 
 			if err != nil {
 				log.Printf("clientState error %v: %v\n", m.nodeType, err)
 			}
 
-			m.chDeleteCS <- key
+			m.chDeleteCS <- clientExit{key: key, err: err}
 		}()
 	}
 
+	m.clearCrashes(found, start)
+
 	// remove nodes that have been deleted
 	for key, client := range m.clientStates {
 		if _, ok := found[key]; ok {
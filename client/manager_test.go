@@ -1,6 +1,7 @@
 package client_test
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"testing"
@@ -376,6 +377,79 @@ func (tnc *testXClient) getConfig() testX {
 	return <-result
 }
 
+func TestManagerArchive(t *testing.T) {
+	nc, root, stop, err := server.TestServer()
+
+	if err != nil {
+		t.Fatal("Error starting test server: ", err)
+	}
+
+	defer stop()
+
+	newClient := make(chan *testNodeClient)
+
+	var newTestNodeClientWrapper = func(nc *nats.Conn, config testNode) client.Client {
+		testClient := newTestNodeClient(nc, config)
+		newClient <- testClient
+		return testClient
+	}
+
+	m := client.NewManager(nc, root.ID, newTestNodeClientWrapper)
+	go m.Start()
+	defer m.Stop(nil)
+
+	testConfig := testNode{"ID-testnode", root.ID, "fancy test node", 8080, "admin"}
+	err = client.SendNodeType(nc, testConfig, "test")
+	if err != nil {
+		t.Fatal("Error sending node: ", err)
+	}
+
+	var testClient *testNodeClient
+
+	select {
+	case testClient = <-newClient:
+	case <-time.After(time.Second * 10):
+		t.Fatal("Timeout waiting for new client to be created")
+	}
+
+	err = client.ArchiveNode(nc, testConfig.ID, true, "test")
+	if err != nil {
+		t.Fatal("Error archiving node: ", err)
+	}
+
+	select {
+	case <-testClient.stopped:
+	case <-time.After(time.Second * 10):
+		t.Fatal("Timeout waiting for archived client to stop")
+	}
+
+	children, err := client.GetNodeChildren(nc, root.ID, "testNode", false, false)
+	if err != nil {
+		t.Fatal("Error getting children: ", err)
+	}
+
+	// archived nodes are still returned, so they are synced and moved
+	if len(children) != 1 || !children[0].Archived() {
+		t.Fatal("Archived node not returned by GetNodeChildren: ", children)
+	}
+
+	// config is preserved and the client starts again when restored
+	err = client.ArchiveNode(nc, testConfig.ID, false, "test")
+	if err != nil {
+		t.Fatal("Error restoring node: ", err)
+	}
+
+	select {
+	case testClient = <-newClient:
+	case <-time.After(time.Second * 10):
+		t.Fatal("Timeout waiting for restored client to start")
+	}
+
+	if port := testClient.getConfig().Port; port != testConfig.Port {
+		t.Error("Restored client config not correct, port: ", port)
+	}
+}
+
 func TestManagerChildren(t *testing.T) {
 	nc, root, stop, err := server.TestServer()
 
@@ -543,3 +617,489 @@ func TestManagerChildren(t *testing.T) {
 		t.Fatal("failed to remove child node")
 	}
 }
+
+type testCrash struct {
+	ID          string `node:"id"`
+	Parent      string `node:"parent"`
+	Description string `point:"description"`
+}
+
+// testCrashClient exits as soon as it is started, panicking the first time
+type testCrashClient struct {
+	panic bool
+}
+
+func (tcc *testCrashClient) Start() error {
+	if tcc.panic {
+		panic("test panic")
+	}
+	return errors.New("test crash")
+}
+
+func (tcc *testCrashClient) Stop(err error) {}
+
+func (tcc *testCrashClient) Points(nodeID string, points []data.Point) {}
+
+func (tcc *testCrashClient) EdgePoints(nodeID, parentID string, points []data.Point) {}
+
+func TestManagerRestartPolicy(t *testing.T) {
+	nc, root, stop, err := server.TestServer()
+
+	if err != nil {
+		t.Fatal("Error starting test server: ", err)
+	}
+
+	defer stop()
+
+	testConfig := testCrash{"ID-crash", root.ID, "crashing node"}
+
+	err = client.SendNodeType(nc, testConfig, "test")
+	if err != nil {
+		t.Fatal("Error sending node: ", err)
+	}
+
+	starts := make(chan time.Time, 10)
+
+	count := 0
+
+	m := client.NewManager(nc, root.ID, func(nc *nats.Conn, config testCrash) client.Client {
+		count++
+		starts <- time.Now()
+		return &testCrashClient{panic: count == 1}
+	})
+
+	m.SetRestartPolicy(client.RestartPolicy{
+		MinDelay:        100 * time.Millisecond,
+		MaxDelay:        time.Second,
+		MaxAttempts:     3,
+		CrashLoopCount:  3,
+		CrashLoopWindow: time.Minute,
+	})
+
+	go m.Start()
+	defer m.Stop(nil)
+
+	var times []time.Time
+	for i := 0; i < 3; i++ {
+		select {
+		case start := <-starts:
+			times = append(times, start)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Client not started, attempt %v", i+1)
+		}
+	}
+
+	// restarts are delayed by 100ms and then 200ms
+	if d := times[1].Sub(times[0]); d < 100*time.Millisecond {
+		t.Error("first restart not delayed: ", d)
+	}
+
+	if d := times[2].Sub(times[1]); d < 200*time.Millisecond {
+		t.Error("second restart not delayed: ", d)
+	}
+
+	waitPointValue(t, nc, testConfig.ID, data.PointTypeClientCrashes, 3)
+	waitPointValue(t, nc, testConfig.ID, data.PointTypeClientCrashLoop, 1)
+
+	nodes, err := client.GetNode(nc, testConfig.ID, "none")
+	if err != nil {
+		t.Fatal("Error getting node: ", err)
+	}
+
+	if msg, _ := nodes[0].Points.Text(data.PointTypeClientError, ""); msg != "test crash" {
+		t.Error("Wrong client error: ", msg)
+	}
+
+	// the manager gave up after 3 attempts
+	select {
+	case <-starts:
+		t.Fatal("Client restarted after giving up")
+	case <-time.After(time.Second):
+	}
+
+	// a user change retries the client
+	err = client.SendNodePoint(nc, testConfig.ID,
+		data.Point{Type: data.PointTypeDescription, Text: "fixed", Origin: "test"}, true)
+	if err != nil {
+		t.Fatal("Error sending point: ", err)
+	}
+
+	select {
+	case <-starts:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Client not retried after node change")
+	}
+
+	waitPointValue(t, nc, testConfig.ID, data.PointTypeClientCrashes, 4)
+}
+
+type testP struct {
+	ID          string  `node:"id"`
+	Parent      string  `node:"parent"`
+	Description string  `point:"description"`
+	TestQs      []testQ `child:"testQ"`
+}
+
+type testQ struct {
+	ID          string  `node:"id"`
+	Parent      string  `node:"parent"`
+	Description string  `point:"description"`
+	TestRs      []testR `child:"testR"`
+}
+
+type testR struct {
+	ID          string `node:"id"`
+	Parent      string `node:"parent"`
+	Description string `point:"description"`
+	Role        string `edgepoint:"role"`
+}
+
+type testPClient struct {
+	config        testP
+	stop          chan struct{}
+	newPoints     chan client.NewPoints
+	newEdgePoints chan client.NewPoints
+	chGetConfig   chan chan testP
+}
+
+func newTestPClient(nc *nats.Conn, config testP) *testPClient {
+	return &testPClient{
+		config:        config,
+		stop:          make(chan struct{}),
+		newPoints:     make(chan client.NewPoints),
+		newEdgePoints: make(chan client.NewPoints),
+		chGetConfig:   make(chan chan testP),
+	}
+}
+
+func (tpc *testPClient) Start() error {
+	for {
+		select {
+		case <-tpc.stop:
+			return nil
+		case pts := <-tpc.newPoints:
+			err := data.MergePoints(pts.ID, pts.Points, &tpc.config)
+			if err != nil {
+				log.Println("error merging new points: ", err)
+			}
+		case pts := <-tpc.newEdgePoints:
+			err := data.MergeEdgePoints(pts.ID, pts.Parent, pts.Points, &tpc.config)
+			if err != nil {
+				log.Println("error merging new points: ", err)
+			}
+		case ch := <-tpc.chGetConfig:
+			ch <- tpc.config
+		}
+	}
+}
+
+func (tpc *testPClient) Stop(err error) {
+	close(tpc.stop)
+}
+
+func (tpc *testPClient) Points(nodeID string, points []data.Point) {
+	tpc.newPoints <- client.NewPoints{nodeID, "", points}
+}
+
+func (tpc *testPClient) EdgePoints(nodeID, parentID string, points []data.Point) {
+	tpc.newEdgePoints <- client.NewPoints{nodeID, parentID, points}
+}
+
+func (tpc *testPClient) getConfig() testP {
+	result := make(chan testP)
+	tpc.chGetConfig <- result
+	return <-result
+}
+
+func TestManagerNested(t *testing.T) {
+	nc, root, stop, err := server.TestServer()
+
+	if err != nil {
+		t.Fatal("Error starting test server: ", err)
+	}
+
+	defer stop()
+
+	testPConfig := testP{"ID-P", root.ID, "testP node", nil}
+	testQConfig := testQ{"ID-Q", testPConfig.ID, "testQ node", nil}
+	testRConfig := testR{"ID-R", testQConfig.ID, "testR node", ""}
+
+	for _, n := range []any{testPConfig, testQConfig, testRConfig} {
+		err = client.SendNodeType(nc, n, "test")
+		if err != nil {
+			t.Fatal("Error sending node: ", err)
+		}
+	}
+
+	newClient := make(chan *testPClient)
+
+	m := client.NewManager(nc, root.ID, func(nc *nats.Conn, config testP) client.Client {
+		c := newTestPClient(nc, config)
+		newClient <- c
+		return c
+	})
+
+	go m.Start()
+	defer m.Stop(nil)
+
+	var testClient *testPClient
+
+	select {
+	case testClient = <-newClient:
+	case <-time.After(time.Second):
+		t.Fatal("Test client not created")
+	}
+
+	config := testClient.getConfig()
+
+	if len(config.TestQs) != 1 || len(config.TestQs[0].TestRs) != 1 {
+		t.Fatalf("Nested children not decoded: %+v", config)
+	}
+
+	if config.TestQs[0].TestRs[0].Description != testRConfig.Description {
+		t.Fatal("Grandchild not decoded: ", config.TestQs[0].TestRs[0])
+	}
+
+	// point and edge point updates to the grandchild are merged
+	err = client.SendNodePoint(nc, testRConfig.ID,
+		data.Point{Type: data.PointTypeDescription, Text: "updated", Origin: "test"}, true)
+	if err != nil {
+		t.Fatal("Error sending point: ", err)
+	}
+
+	err = client.SendEdgePoint(nc, testRConfig.ID, testRConfig.Parent,
+		data.Point{Type: data.PointTypeRole, Text: "user", Origin: "test"}, true)
+	if err != nil {
+		t.Fatal("Error sending edge point: ", err)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+
+	r := testClient.getConfig().TestQs[0].TestRs[0]
+	if r.Description != "updated" || r.Role != "user" {
+		t.Fatal("Grandchild points not merged: ", r)
+	}
+
+	// adding a grandchild restarts the client
+	testRConfig2 := testR{"ID-R2", testQConfig.ID, "testR node 2", ""}
+	err = client.SendNodeType(nc, testRConfig2, "test")
+	if err != nil {
+		t.Fatal("Error sending node: ", err)
+	}
+
+	select {
+	case testClient = <-newClient:
+	case <-time.After(time.Second):
+		t.Fatal("Test client not re-created")
+	}
+
+	if len(testClient.getConfig().TestQs[0].TestRs) != 2 {
+		t.Fatal("Not seeing new grandchild")
+	}
+}
+
+type testHang struct {
+	ID          string `node:"id"`
+	Parent      string `node:"parent"`
+	Description string `point:"description"`
+}
+
+// testHangClient hangs when it receives a description point until release
+// is closed
+type testHangClient struct {
+	stop      chan struct{}
+	newPoints chan []data.Point
+	release   chan struct{}
+}
+
+func (thc *testHangClient) Start() error {
+	for {
+		select {
+		case <-thc.stop:
+			return nil
+		case <-thc.newPoints:
+			select {
+			case <-thc.release:
+			case <-thc.stop:
+				return nil
+			}
+		}
+	}
+}
+
+func (thc *testHangClient) Stop(err error) {
+	close(thc.stop)
+}
+
+func (thc *testHangClient) Points(nodeID string, points []data.Point) {
+	select {
+	case thc.newPoints <- points:
+	case <-thc.stop:
+	}
+}
+
+func (thc *testHangClient) EdgePoints(nodeID, parentID string, points []data.Point) {}
+
+func TestManagerHeartbeat(t *testing.T) {
+	period := client.HeartbeatPeriod
+	client.HeartbeatPeriod = 50 * time.Millisecond
+	defer func() { client.HeartbeatPeriod = period }()
+
+	nc, root, stop, err := server.TestServer()
+
+	if err != nil {
+		t.Fatal("Error starting test server: ", err)
+	}
+
+	defer stop()
+
+	testConfig := testHang{"ID-hang", root.ID, "hanging node"}
+
+	err = client.SendNodeType(nc, testConfig, "test")
+	if err != nil {
+		t.Fatal("Error sending node: ", err)
+	}
+
+	release := make(chan struct{})
+	started := make(chan struct{}, 1)
+
+	m := client.NewManager(nc, root.ID, func(nc *nats.Conn, config testHang) client.Client {
+		started <- struct{}{}
+		return &testHangClient{
+			stop:      make(chan struct{}),
+			newPoints: make(chan []data.Point),
+			release:   release,
+		}
+	})
+
+	go m.Start()
+	defer m.Stop(nil)
+
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Client not started")
+	}
+
+	heartbeats, err := nc.SubscribeSync(client.SubjectClientHealth(testConfig.ID))
+	if err != nil {
+		t.Fatal("Error subscribing to heartbeats: ", err)
+	}
+	defer heartbeats.Unsubscribe()
+
+	_, err = heartbeats.NextMsg(time.Second)
+	if err != nil {
+		t.Fatal("No heartbeat from running client: ", err)
+	}
+
+	// heartbeats are recorded by the state of the client
+	start := time.Now()
+	for {
+		state, err := m.State()
+		if err != nil {
+			t.Fatal("Error getting manager state: ", err)
+		}
+
+		if len(state.Clients) == 1 && !state.Clients[0].LastHeartbeat.IsZero() {
+			break
+		}
+
+		if time.Since(start) > time.Second {
+			t.Fatalf("Heartbeat not recorded: %+v", state.Clients)
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// the first point hangs the client and the second is not accepted
+	for i := 0; i < 2; i++ {
+		err = client.SendNodePoint(nc, testConfig.ID, data.Point{
+			Type: data.PointTypeDescription, Text: "hang", Origin: "test"}, true)
+		if err != nil {
+			t.Fatal("Error sending point: ", err)
+		}
+	}
+
+	waitPointValue(t, nc, testConfig.ID, data.PointTypeOffline, 1)
+
+	close(release)
+
+	waitPointValue(t, nc, testConfig.ID, data.PointTypeOffline, 0)
+}
+
+func TestManagerMetrics(t *testing.T) {
+	nc, root, stop, err := server.TestServer()
+
+	if err != nil {
+		t.Fatal("Error starting test server: ", err)
+	}
+
+	defer stop()
+
+	for _, id := range []string{"ID-metrics1", "ID-metrics2"} {
+		err = client.SendNodeType(nc, testNode{id, root.ID, "metrics", 8080, ""}, "test")
+		if err != nil {
+			t.Fatal("Error sending node: ", err)
+		}
+	}
+
+	m := client.NewManager(nc, root.ID, func(nc *nats.Conn, config testNode) client.Client {
+		return newTestNodeClient(nc, config)
+	})
+
+	m.SetMetricsPeriod(100 * time.Millisecond)
+
+	go m.Start()
+	defer m.Stop(nil)
+
+	rootPoints := func(exp map[string]float64) data.Points {
+		var pts data.Points
+		for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(50 * time.Millisecond) {
+			nodes, err := client.GetNode(nc, root.ID, "none")
+			if err != nil {
+				t.Fatal("Error getting root node: ", err)
+			}
+
+			pts = nodes[0].Points
+
+			match := true
+			for typ, v := range exp {
+				if got, ok := pts.Value(typ, "testNode"); !ok || got != v {
+					match = false
+				}
+			}
+
+			if match {
+				return pts
+			}
+		}
+
+		for typ, v := range exp {
+			if got, ok := pts.Value(typ, "testNode"); !ok || got != v {
+				t.Errorf("%v: expected %v, got %v (%v)", typ, v, got, ok)
+			}
+		}
+
+		return pts
+	}
+
+	pts := rootPoints(map[string]float64{
+		data.PointTypeMetricManagerActiveClients: 2,
+		data.PointTypeMetricManagerRestarts:      0,
+		data.PointTypeMetricManagerDecodeErrors:  0,
+	})
+
+	if _, ok := pts.Value(data.PointTypeMetricManagerScanDuration, "testNode"); !ok {
+		t.Error("Scan duration not reported")
+	}
+
+	// points that can't be decoded are counted
+	err = nc.Publish("up.none.ID-metrics1.points", []byte("garbage"))
+	if err != nil {
+		t.Fatal("Error publishing: ", err)
+	}
+
+	rootPoints(map[string]float64{
+		data.PointTypeMetricManagerDecodeErrors: 1,
+	})
+}
@@ -5,11 +5,57 @@ import (
 	"fmt"
 	"log"
 	"strings"
+	"time"
 
 	"github.com/nats-io/nats.go"
 	"github.com/simpleiot/simpleiot/data"
 )
 
+// HeaderEncoding is set to EncodingJSON on point messages that are JSON
+// encoded (see data.Points.ToJSON) instead of protobuf encoded
+const HeaderEncoding = "Siot-Encoding"
+
+// EncodingJSON is the HeaderEncoding value for JSON encoded points
+const EncodingJSON = "json"
+
+// SubjectPrefixJSON and SubjectPrefixCBOR are added to point subjects to
+// send or receive JSON (see data.Points.ToJSON) or CBOR (see
+// data.Points.ToCBOR) encoded points, for example cbor.node.<id>.points.
+// This lets devices that can not set message headers pick the encoding.
+const (
+	SubjectPrefixJSON = "json."
+	SubjectPrefixCBOR = "cbor."
+)
+
+// SubjectPrefixStream is added to node and edge point subjects when the
+// store publishes accepted points to a JetStream stream, for example
+// stream.node.<id>.points
+const SubjectPrefixStream = "stream."
+
+// DecodePoints decodes the points in a NATS message. Points are protobuf
+// encoded unless the HeaderEncoding header is EncodingJSON. JSON points
+// without a time are stamped with the current time.
+func DecodePoints(msg *nats.Msg) (data.Points, error) {
+	if msg.Header.Get(HeaderEncoding) != EncodingJSON {
+		return data.PbDecodePoints(msg.Data)
+	}
+
+	var points data.Points
+	err := points.FromJSON(msg.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	for i := range points {
+		if points[i].Time.IsZero() {
+			points[i].Time = now
+		}
+	}
+
+	return points, nil
+}
+
 // DecodeNodePointsMsg decodes NATS message into node ID and points
 func DecodeNodePointsMsg(msg *nats.Msg) (string, []data.Point, error) {
 	chunks := strings.Split(msg.Subject, ".")
@@ -17,10 +63,10 @@ func DecodeNodePointsMsg(msg *nats.Msg) (string, []data.Point, error) {
 		return "", []data.Point{}, errors.New("Error decoding node points subject")
 	}
 	nodeID := chunks[1]
-	points, err := data.PbDecodePoints(msg.Data)
+	points, err := DecodePoints(msg)
 	if err != nil {
-		log.Println("Error decoding Pb points: ", err)
-		return "", []data.Point{}, fmt.Errorf("Error decoding Pb points: %w", err)
+		log.Println("Error decoding points: ", err)
+		return "", []data.Point{}, fmt.Errorf("Error decoding points: %w", err)
 	}
 
 	return nodeID, points, nil
@@ -34,10 +80,10 @@ func DecodeEdgePointsMsg(msg *nats.Msg) (string, string, []data.Point, error) {
 	}
 	nodeID := chunks[1]
 	parentID := chunks[2]
-	points, err := data.PbDecodePoints(msg.Data)
+	points, err := DecodePoints(msg)
 	if err != nil {
-		log.Println("Error decoding Pb points: ", err)
-		return "", "", []data.Point{}, fmt.Errorf("Error decoding Pb points: %w", err)
+		log.Println("Error decoding points: ", err)
+		return "", "", []data.Point{}, fmt.Errorf("Error decoding points: %w", err)
 	}
 
 	return nodeID, parentID, points, nil
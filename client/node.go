@@ -70,7 +70,8 @@ func GetNodeType[T any](nc *nats.Conn, id, parent string) ([]T, error) {
 // GetNodeChildren over NATS
 // deleted nodes are skipped unless includeDel is set to true. typ
 // can be used to limit nodes to a particular type, otherwise, all nodes
-// are returned.
+// are returned. Archived nodes are returned (see ArchiveNode), so they are
+// synchronized, moved, and copied with the rest of the tree.
 func GetNodeChildren(nc *nats.Conn, id, typ string, includeDel bool, recursive bool) ([]data.NodeEdge, error) {
 	var requestPoints data.Points
 
@@ -115,6 +116,32 @@ func GetNodeChildren(nc *nats.Conn, id, typ string, includeDel bool, recursive b
 	return nodes, nil
 }
 
+// GetNodeChildrenByRole gets the immediate children of a node whose edge
+// role point is set to role, for example the nodes a node monitors or
+// controls. Deleted and archived nodes are skipped.
+func GetNodeChildrenByRole(nc *nats.Conn, id, role string) ([]data.NodeEdge, error) {
+	requestPoints := data.Points{
+		data.Point{Type: data.PointTypeRole, Text: role},
+	}
+
+	reqData, err := requestPoints.ToPb()
+	if err != nil {
+		return nil, fmt.Errorf("Error encoding reqData: %v", err)
+	}
+
+	nodeMsg, err := nc.Request("node."+id+".children", reqData, time.Second*20)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes, err := data.PbDecodeNodesRequest(nodeMsg.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	return removeArchived(nodes), nil
+}
+
 // GetNodeChildrenType get immediate children of a custom type
 // deleted nodes are skipped
 func GetNodeChildrenType[T any](nc *nats.Conn, id string) ([]T, error) {
@@ -223,6 +250,40 @@ func SendNode(nc *nats.Conn, node data.NodeEdge, origin string) error {
 	return nil
 }
 
+// SendNodes creates a tree of nodes under parent in one store transaction,
+// so either all the nodes are created or none are. The store assigns new IDs
+// to all the nodes, which are returned in the same order as nodes. The IDs in
+// nodes are only used to reference parents: a node with a blank Parent (or
+// parent) is created under parent, otherwise Parent must be the ID of another
+// node in nodes. Nodes without children don't need an ID.
+func SendNodes(nc *nats.Conn, parent string, nodes []data.NodeEdge) ([]string, error) {
+	d, err := (*data.Nodes)(&nodes).ToPb()
+	if err != nil {
+		return nil, err
+	}
+
+	msg, err := nc.Request(SubjectNodeCreate(parent), d, time.Second*20)
+	if err != nil {
+		return nil, err
+	}
+
+	created, err := data.PbDecodeNodesRequest(msg.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(created) != len(nodes) {
+		return nil, fmt.Errorf("Expected %v created nodes, got %v", len(nodes), len(created))
+	}
+
+	ret := make([]string, len(created))
+	for i, n := range created {
+		ret[i] = n.ID
+	}
+
+	return ret, nil
+}
+
 // SendNodeType is used to send a node to a nats server. Can be
 // used to create nodes.
 func SendNodeType[T any](nc *nats.Conn, node T, origin string) error {
@@ -244,6 +305,23 @@ func SendNodeType[T any](nc *nats.Conn, node T, origin string) error {
 	return SendNode(nc, ne, origin)
 }
 
+// sendChildNodeType is SendNodeType for child node types that are not the
+// struct name with a lowercase first letter, like opcUAIo for OpcUAIO
+func sendChildNodeType[T any](nc *nats.Conn, node T, typ, origin string) error {
+	ne, err := data.Encode(node)
+	if err != nil {
+		return err
+	}
+
+	ne.Type = typ
+
+	for i := range ne.Points {
+		ne.Points[i].Origin = origin
+	}
+
+	return SendNode(nc, ne, origin)
+}
+
 func duplicateNodeHelper(nc *nats.Conn, node data.NodeEdge, newParent, origin string) error {
 	children, err := GetNodeChildren(nc, node.ID, "", false, false)
 	if err != nil {
@@ -306,6 +384,17 @@ func DeleteNode(nc *nats.Conn, id, parent string, origin string) error {
 	return err
 }
 
+// ArchiveNode sets or clears the archived point of a node. Archived nodes
+// keep their config and history, but are skipped by client managers, so
+// their clients are stopped until the node is restored.
+func ArchiveNode(nc *nats.Conn, id string, archived bool, origin string) error {
+	return SendNodePoint(nc, id, data.Point{
+		Type:   data.PointTypeArchived,
+		Value:  data.BoolToFloat(archived),
+		Origin: origin,
+	}, true)
+}
+
 // MoveNode moves a node from one parent to another
 func MoveNode(nc *nats.Conn, id, oldParent, newParent, origin string) error {
 	if newParent == oldParent {
@@ -334,6 +423,112 @@ func MoveNode(nc *nats.Conn, id, oldParent, newParent, origin string) error {
 	return nil
 }
 
+// MoveNodeInstance moves a node and all its children from one SIOT instance
+// (src) to another (dst). Node IDs and point timestamps are preserved, so
+// history that is stored by node ID continues on the new instance. The
+// entire subtree is created on dst and verified before the node is tombstoned
+// on src, so a failed move leaves the original node in place. If src and dst
+// are the same connection, this is the same as MoveNode.
+func MoveNodeInstance(src, dst *nats.Conn, id, srcParent, dstParent, origin string) error {
+	if src == dst {
+		return MoveNode(src, id, srcParent, dstParent, origin)
+	}
+
+	nodes, err := GetNode(src, id, srcParent)
+	if err != nil {
+		return fmt.Errorf("GetNode error: %v", err)
+	}
+
+	if len(nodes) < 1 {
+		return fmt.Errorf("No nodes returned")
+	}
+
+	node := nodes[0]
+	node.Parent = dstParent
+
+	// the edge on the destination instance must be alive, even if this
+	// node was previously tombstoned there
+	node.EdgePoints.Add(data.Point{Time: time.Now(), Type: data.PointTypeTombstone,
+		Value: 0, Origin: origin})
+
+	err = copyNodeHelper(src, dst, node, origin)
+	if err != nil {
+		return fmt.Errorf("Error copying node to destination: %v", err)
+	}
+
+	err = verifyNodeHelper(src, dst, node)
+	if err != nil {
+		return fmt.Errorf("Error verifying node on destination: %v", err)
+	}
+
+	return DeleteNode(src, id, srcParent, origin)
+}
+
+// copyNodeHelper sends node to dst and then recursively copies all children
+// of the node on src. IDs are preserved.
+func copyNodeHelper(src, dst *nats.Conn, node data.NodeEdge, origin string) error {
+	children, err := GetNodeChildren(src, node.ID, "", false, false)
+	if err != nil {
+		return fmt.Errorf("GetNodeChildren error: %v", err)
+	}
+
+	err = SendNode(dst, node, origin)
+	if err != nil {
+		return fmt.Errorf("SendNode error: %v", err)
+	}
+
+	for _, c := range children {
+		err := copyNodeHelper(src, dst, c, origin)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// verifyNodeHelper checks that node and all its children on src exist on dst
+// and are not deleted, and that dst has all their points, with the same or a
+// newer timestamp.
+func verifyNodeHelper(src, dst *nats.Conn, node data.NodeEdge) error {
+	dstNodes, err := GetNode(dst, node.ID, node.Parent)
+	if err != nil {
+		return fmt.Errorf("GetNode error for %v: %v", node.ID, err)
+	}
+
+	if len(dstNodes) < 1 {
+		return fmt.Errorf("Node %v not found on destination", node.ID)
+	}
+
+	dstNode := dstNodes[0]
+
+	if ts, _ := dstNode.IsTombstone(); ts {
+		return fmt.Errorf("Node %v is deleted on destination", node.ID)
+	}
+
+	for _, p := range node.Points {
+		dp, ok := dstNode.Points.Find(p.Type, p.Key)
+		if !ok || dp.Time.Before(p.Time) {
+			return fmt.Errorf("Point %v:%v of node %v missing on destination",
+				p.Type, p.Key, node.ID)
+		}
+	}
+
+	children, err := GetNodeChildren(src, node.ID, "", false, false)
+	if err != nil {
+		return fmt.Errorf("GetNodeChildren error: %v", err)
+	}
+
+	for _, c := range children {
+		err := verifyNodeHelper(src, dst, c)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 // MirrorNode adds a an existing node to a new parent. A node can have
 // multiple parents.
 func MirrorNode(nc *nats.Conn, id, newParent, origin string) error {
@@ -0,0 +1,152 @@
+package client_test
+
+import (
+	"testing"
+
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+	"github.com/simpleiot/simpleiot/server"
+)
+
+func TestMoveNodeInstance(t *testing.T) {
+	nc, root, stop, err := server.TestServer()
+
+	if err != nil {
+		t.Fatal("Error starting test server: ", err)
+	}
+
+	defer stop()
+
+	nc2, root2, stop2, err := server.TestServerMemory()
+
+	if err != nil {
+		t.Fatal("Error starting second test server: ", err)
+	}
+
+	defer stop2()
+
+	group := testNode{ID: "ID-group", Parent: root2.ID, Description: "group"}
+	parent := testNode{ID: "ID-parent", Parent: root.ID, Description: "parent", Port: 8080}
+	child := testNode{ID: "ID-child", Parent: parent.ID, Description: "child", Port: 8081}
+	grandchild := testNode{ID: "ID-grandchild", Parent: child.ID, Description: "grandchild"}
+
+	err = client.SendNodeType(nc2, group, "test")
+	if err != nil {
+		t.Fatal("Error sending node: ", err)
+	}
+
+	for _, n := range []testNode{parent, child, grandchild} {
+		err = client.SendNodeType(nc, n, "test")
+		if err != nil {
+			t.Fatal("Error sending node: ", err)
+		}
+	}
+
+	// archived nodes are moved with the tree
+	err = client.ArchiveNode(nc, grandchild.ID, true, "test")
+	if err != nil {
+		t.Fatal("Error archiving node: ", err)
+	}
+
+	err = client.MoveNodeInstance(nc, nc2, parent.ID, root.ID, group.ID, "test")
+	if err != nil {
+		t.Fatal("Error moving node: ", err)
+	}
+
+	nodes, err := client.GetNodeChildren(nc, root.ID, "", false, false)
+	if err != nil {
+		t.Fatal("Error getting root children: ", err)
+	}
+
+	for _, n := range nodes {
+		if n.ID == parent.ID {
+			t.Fatal("node is still present under old parent")
+		}
+	}
+
+	moved, err := client.GetNodeChildrenType[testNode](nc2, group.ID)
+	if err != nil {
+		t.Fatal("Error getting group children: ", err)
+	}
+
+	if len(moved) != 1 || moved[0].ID != parent.ID || moved[0].Port != parent.Port {
+		t.Fatalf("moved node not correct: %+v", moved)
+	}
+
+	children, err := client.GetNodeChildrenType[testNode](nc2, parent.ID)
+	if err != nil {
+		t.Fatal("Error getting moved node children: ", err)
+	}
+
+	if len(children) != 1 || children[0].ID != child.ID ||
+		children[0].Description != child.Description {
+		t.Fatalf("moved node children not correct: %+v", children)
+	}
+
+	grandchildren, err := client.GetNodeChildren(nc2, child.ID, "", false, false)
+	if err != nil {
+		t.Fatal("Error getting moved node grandchildren: ", err)
+	}
+
+	if len(grandchildren) != 1 || grandchildren[0].ID != grandchild.ID ||
+		!grandchildren[0].Archived() {
+		t.Fatalf("moved node grandchildren not correct: %+v", grandchildren)
+	}
+}
+
+func TestGetNodeChildrenByRole(t *testing.T) {
+	nc, root, stop, err := server.TestServer()
+
+	if err != nil {
+		t.Fatal("Error starting test server: ", err)
+	}
+
+	defer stop()
+
+	area := testNode{ID: "ID-area", Parent: root.ID, Description: "area"}
+	sensor := testNode{ID: "ID-sensor", Parent: area.ID, Description: "sensor"}
+	valve := testNode{ID: "ID-valve", Parent: area.ID, Description: "valve"}
+
+	for _, n := range []testNode{area, sensor, valve} {
+		err = client.SendNodeType(nc, n, "test")
+		if err != nil {
+			t.Fatal("Error sending node: ", err)
+		}
+	}
+
+	err = client.SendEdgePoints(nc, sensor.ID, area.ID, data.Points{
+		{Type: data.PointTypeRole, Text: data.PointValueRoleMonitors},
+		{Type: data.PointTypeWeight, Value: 0.5},
+	}, true)
+	if err != nil {
+		t.Fatal("Error sending edge points: ", err)
+	}
+
+	err = client.SendEdgePoint(nc, valve.ID, area.ID, data.Point{Type: data.PointTypeRole,
+		Text: data.PointValueRoleControls}, true)
+	if err != nil {
+		t.Fatal("Error sending edge point: ", err)
+	}
+
+	nodes, err := client.GetNodeChildrenByRole(nc, area.ID, data.PointValueRoleMonitors)
+	if err != nil {
+		t.Fatal("Error getting children: ", err)
+	}
+
+	if len(nodes) != 1 || nodes[0].ID != sensor.ID {
+		t.Fatal("Expected only the sensor, got: ", nodes)
+	}
+
+	if nodes[0].Role() != data.PointValueRoleMonitors || nodes[0].Weight() != 0.5 {
+		t.Error("Wrong role or weight: ", nodes[0].Role(), nodes[0].Weight())
+	}
+
+	nodes, err = client.GetNodeChildrenByRole(nc, area.ID, data.PointValueRoleControls)
+	if err != nil {
+		t.Fatal("Error getting children: ", err)
+	}
+
+	if len(nodes) != 1 || nodes[0].ID != valve.ID || nodes[0].Weight() != 1 {
+		t.Fatal("Expected only the valve with default weight, got: ", nodes)
+	}
+}
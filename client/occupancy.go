@@ -0,0 +1,436 @@
+package client
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// Occupancy counts people or vehicles entering and leaving OccupancyZone
+// child nodes, from cameras or beam sensors. Occupancy is the total of all
+// zones. The zone counts are reset every day at ResetTime (HH:MM UTC,
+// defaults to 00:00), and LastReset is the RFC3339 time of the last reset, so
+// a reset that was missed while SIOT was not running is done when it starts.
+type Occupancy struct {
+	ID          string          `node:"id"`
+	Parent      string          `node:"parent"`
+	Description string          `point:"description"`
+	ResetTime   string          `point:"resetTime"`
+	LastReset   string          `point:"lastReset"`
+	Disable     bool            `point:"disable"`
+	Occupancy   float64         `point:"occupancy"`
+	Zones       []OccupancyZone `child:"occupancyZone"`
+}
+
+// OccupancyZone is a zone with entry and exit counters. Entries are counted
+// from the EntryPointType (defaults to value) point of EntryNodeID, and exits
+// from the ExitPointType (defaults to value) point of ExitNodeID. If
+// CounterType is event (the default), each point is a number of entries or
+// exits, for example 1 each time a beam is broken. If CounterType is total,
+// the point is a running total, for example from a camera, and the increase
+// is counted. Occupancy is entries minus exits and can't go below 0. It can
+// be corrected by writing it. Occupied is set while Occupancy is above 0,
+// and OverCapacity while it is above Capacity (if set).
+type OccupancyZone struct {
+	ID             string  `node:"id"`
+	Parent         string  `node:"parent"`
+	Description    string  `point:"description"`
+	Capacity       float64 `point:"capacity"`
+	EntryNodeID    string  `point:"entryNodeID"`
+	EntryPointType string  `point:"entryPointType"`
+	ExitNodeID     string  `point:"exitNodeID"`
+	ExitPointType  string  `point:"exitPointType"`
+	CounterType    string  `point:"counterType"`
+	Occupancy      float64 `point:"occupancy"`
+	Occupied       bool    `point:"occupied"`
+	EntriesToday   float64 `point:"entriesToday"`
+	ExitsToday     float64 `point:"exitsToday"`
+	PeakOccupancy  float64 `point:"peakOccupancy"`
+	OverCapacity   bool    `point:"overCapacity"`
+}
+
+// occupancy counter inputs
+const (
+	occupancyInputEntry = "entry"
+	occupancyInputExit  = "exit"
+)
+
+type occupancyInput struct {
+	zoneID string
+	input  string
+	value  float64
+}
+
+// occupancyLastReset returns the last time the counts should have been
+// reset before now. resetTime is in loc, or UTC if loc is nil.
+func occupancyLastReset(resetTime string, now time.Time, loc *time.Location) (time.Time, error) {
+	hour, minute := 0, 0
+
+	if resetTime != "" {
+		matches := reHourMin.FindStringSubmatch(resetTime)
+		if len(matches) < 3 {
+			return time.Time{}, fmt.Errorf("invalid reset time: %v", resetTime)
+		}
+
+		hour, _ = strconv.Atoi(matches[1])
+		minute, _ = strconv.Atoi(matches[2])
+	}
+
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	nowLoc := now.In(loc)
+	ret := time.Date(nowLoc.Year(), nowLoc.Month(), nowLoc.Day(), hour, minute, 0, 0, loc)
+	if ret.After(nowLoc) {
+		ret = ret.AddDate(0, 0, -1)
+	}
+
+	return ret, nil
+}
+
+// OccupancyClient is a SIOT client that runs occupancy counting nodes
+type OccupancyClient struct {
+	nc            *nats.Conn
+	config        Occupancy
+	stop          chan struct{}
+	newPoints     chan NewPoints
+	newEdgePoints chan NewPoints
+	newInput      chan occupancyInput
+	// counter subscriptions and what they are subscribed to by zone ID and
+	// input
+	subs    map[string]*nats.Subscription
+	subNode map[string]string
+	// last value of total counters
+	totals map[string]float64
+	// invalid reset time that was logged
+	badResetTime string
+	// time zone of the reset time
+	loc *time.Location
+}
+
+// NewOccupancyClient ...
+func NewOccupancyClient(nc *nats.Conn, config Occupancy) Client {
+	return &OccupancyClient{
+		nc:            nc,
+		config:        config,
+		stop:          make(chan struct{}),
+		newPoints:     make(chan NewPoints),
+		newEdgePoints: make(chan NewPoints),
+		newInput:      make(chan occupancyInput),
+		subs:          make(map[string]*nats.Subscription),
+		subNode:       make(map[string]string),
+		totals:        make(map[string]float64),
+	}
+}
+
+// Start runs the main logic for this client and blocks until stopped
+func (o *OccupancyClient) Start() error {
+	log.Println("Starting occupancy client: ", o.config.Description)
+
+	var err error
+	o.loc, err = NodeLocation(o.nc, o.config.ID)
+	if err != nil {
+		log.Printf("Occupancy %v: %v\n", o.config.Description, err)
+	}
+
+	o.subscribeCounters()
+	o.checkReset(time.Now())
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+done:
+	for {
+		select {
+		case <-o.stop:
+			log.Println("Stopping occupancy client: ", o.config.Description)
+			break done
+		case now := <-ticker.C:
+			o.checkReset(now)
+		case in := <-o.newInput:
+			o.count(in)
+		case pts := <-o.newPoints:
+			err := data.MergePoints(pts.ID, pts.Points, &o.config)
+			if err != nil {
+				log.Println("error merging new points: ", err)
+			}
+
+			if pts.ID == o.config.ID {
+				o.checkReset(time.Now())
+				continue
+			}
+
+			for _, p := range pts.Points {
+				switch p.Type {
+				case data.PointTypeEntryNodeID, data.PointTypeEntryPointType,
+					data.PointTypeExitNodeID, data.PointTypeExitPointType,
+					data.PointTypeCounterType:
+					o.subscribeCounters()
+				case data.PointTypeOccupancy, data.PointTypeCapacity:
+					// occupancy was corrected or the capacity changed
+					if z := o.zone(pts.ID); z != nil {
+						o.update(z, 0, 0)
+					}
+				}
+			}
+		case pts := <-o.newEdgePoints:
+			err := data.MergeEdgePoints(pts.ID, pts.Parent, pts.Points, &o.config)
+			if err != nil {
+				log.Println("error merging new points: ", err)
+			}
+		}
+	}
+
+	for _, sub := range o.subs {
+		sub.Unsubscribe()
+	}
+
+	return nil
+}
+
+func (o *OccupancyClient) zone(id string) *OccupancyZone {
+	for i := range o.config.Zones {
+		if o.config.Zones[i].ID == id {
+			return &o.config.Zones[i]
+		}
+	}
+	return nil
+}
+
+// count processes a counter point
+func (o *OccupancyClient) count(in occupancyInput) {
+	z := o.zone(in.zoneID)
+	if z == nil || o.config.Disable {
+		return
+	}
+
+	n := in.value
+
+	if z.CounterType == data.PointValueTotal {
+		key := in.zoneID + "." + in.input
+		last, ok := o.totals[key]
+		o.totals[key] = in.value
+		if !ok {
+			// the first total is the starting point
+			return
+		}
+
+		n = in.value - last
+		if n < 0 {
+			// the counter was reset
+			n = in.value
+		}
+	}
+
+	if n <= 0 {
+		return
+	}
+
+	if in.input == occupancyInputEntry {
+		o.update(z, n, 0)
+	} else {
+		o.update(z, 0, n)
+	}
+}
+
+// update adds entries and exits to a zone and sends the zone state
+func (o *OccupancyClient) update(z *OccupancyZone, entries, exits float64) {
+	z.EntriesToday += entries
+	z.ExitsToday += exits
+	z.Occupancy = math.Max(z.Occupancy+entries-exits, 0)
+	z.PeakOccupancy = math.Max(z.PeakOccupancy, z.Occupancy)
+
+	overCapacity := z.Capacity > 0 && z.Occupancy > z.Capacity
+	if overCapacity && !z.OverCapacity {
+		log.Printf("Occupancy %v: %v is over capacity\n", o.config.Description, z.Description)
+	}
+
+	z.OverCapacity = overCapacity
+	z.Occupied = z.Occupancy > 0
+
+	o.sendZone(z, time.Now())
+}
+
+// checkReset resets the zone counts if the reset time has passed since the
+// last reset
+func (o *OccupancyClient) checkReset(now time.Time) {
+	reset, err := occupancyLastReset(o.config.ResetTime, now, o.loc)
+	if err != nil {
+		if o.config.ResetTime != o.badResetTime {
+			log.Printf("Occupancy %v: %v\n", o.config.Description, err)
+			o.badResetTime = o.config.ResetTime
+		}
+		return
+	}
+
+	last, err := time.Parse(time.RFC3339, o.config.LastReset)
+	if err == nil && !last.Before(reset) {
+		return
+	}
+
+	o.config.LastReset = reset.Format(time.RFC3339)
+
+	// the first time the client runs, the counts are not reset
+	if err == nil && !o.config.Disable {
+		log.Printf("Occupancy %v: resetting counts\n", o.config.Description)
+
+		for i := range o.config.Zones {
+			z := &o.config.Zones[i]
+			z.Occupancy = 0
+			z.Occupied = false
+			z.EntriesToday = 0
+			z.ExitsToday = 0
+			z.PeakOccupancy = 0
+			z.OverCapacity = false
+			o.sendZone(z, now)
+		}
+	}
+
+	err = SendNodePoint(o.nc, o.config.ID, data.Point{Time: now,
+		Type: data.PointTypeLastReset, Text: o.config.LastReset}, false)
+	if err != nil {
+		log.Printf("Occupancy %v: error sending last reset: %v\n", o.config.Description, err)
+	}
+}
+
+// sendZone sends the state of a zone and the total occupancy
+func (o *OccupancyClient) sendZone(z *OccupancyZone, now time.Time) {
+	err := SendNodePoints(o.nc, z.ID, data.Points{
+		{Time: now, Type: data.PointTypeOccupancy, Value: z.Occupancy},
+		{Time: now, Type: data.PointTypeOccupied, Value: data.BoolToFloat(z.Occupied)},
+		{Time: now, Type: data.PointTypeEntriesToday, Value: z.EntriesToday},
+		{Time: now, Type: data.PointTypeExitsToday, Value: z.ExitsToday},
+		{Time: now, Type: data.PointTypePeakOccupancy, Value: z.PeakOccupancy},
+		{Time: now, Type: data.PointTypeOverCapacity, Value: data.BoolToFloat(z.OverCapacity)},
+	}, false)
+	if err != nil {
+		log.Printf("Occupancy %v: error sending zone %v: %v\n",
+			o.config.Description, z.Description, err)
+	}
+
+	total := 0.0
+	for _, z := range o.config.Zones {
+		total += z.Occupancy
+	}
+
+	if total == o.config.Occupancy {
+		return
+	}
+
+	o.config.Occupancy = total
+
+	err = SendNodePoint(o.nc, o.config.ID, data.Point{Time: now,
+		Type: data.PointTypeOccupancy, Value: total}, false)
+	if err != nil {
+		log.Printf("Occupancy %v: error sending occupancy: %v\n", o.config.Description, err)
+	}
+}
+
+// subscribeCounters subscribes to the entry and exit counters of each zone
+func (o *OccupancyClient) subscribeCounters() {
+	for _, z := range o.config.Zones {
+		entryPointType := z.EntryPointType
+		if entryPointType == "" {
+			entryPointType = data.PointTypeValue
+		}
+
+		exitPointType := z.ExitPointType
+		if exitPointType == "" {
+			exitPointType = data.PointTypeValue
+		}
+
+		for input, nodeID := range map[string]string{
+			occupancyInputEntry: z.EntryNodeID,
+			occupancyInputExit:  z.ExitNodeID,
+		} {
+			pointType := entryPointType
+			if input == occupancyInputExit {
+				pointType = exitPointType
+			}
+
+			key := z.ID + "." + input
+			subNode := nodeID + "." + pointType + "." + z.CounterType
+
+			if cur, ok := o.subNode[key]; ok && cur == subNode {
+				continue
+			}
+
+			if sub, ok := o.subs[key]; ok {
+				sub.Unsubscribe()
+				delete(o.subs, key)
+			}
+
+			delete(o.totals, key)
+			o.subNode[key] = subNode
+
+			if nodeID == "" {
+				continue
+			}
+
+			zoneID := z.ID
+			input := input
+
+			sub, err := o.nc.Subscribe(SubjectNodePoints(nodeID), func(msg *nats.Msg) {
+				points, err := DecodePoints(msg)
+				if err != nil {
+					log.Println("Occupancy: error decoding counter points: ", err)
+					return
+				}
+
+				for _, p := range points {
+					if p.Type == pointType {
+						select {
+						case o.newInput <- occupancyInput{zoneID: zoneID, input: input,
+							value: p.Value}:
+						case <-o.stop:
+						}
+					}
+				}
+			})
+			if err != nil {
+				log.Printf("Occupancy %v: error subscribing to %v %v counter: %v\n",
+					o.config.Description, z.Description, input, err)
+				continue
+			}
+
+			o.subs[key] = sub
+
+			if z.CounterType != data.PointValueTotal {
+				continue
+			}
+
+			// the current total is the starting point for total counters
+			nodes, err := GetNode(o.nc, nodeID, "none")
+			if err != nil || len(nodes) < 1 {
+				continue
+			}
+
+			if v, ok := nodes[0].Points.Value(pointType, ""); ok {
+				o.totals[key] = v
+			}
+		}
+	}
+}
+
+// Stop sends a signal to the Start function to exit
+func (o *OccupancyClient) Stop(err error) {
+	close(o.stop)
+}
+
+// Points is called by the Manager when new points for this
+// node are received.
+func (o *OccupancyClient) Points(nodeID string, points []data.Point) {
+	o.newPoints <- NewPoints{nodeID, "", points}
+}
+
+// EdgePoints is called by the Manager when new edge points for this
+// node are received.
+func (o *OccupancyClient) EdgePoints(nodeID, parentID string, points []data.Point) {
+	o.newEdgePoints <- NewPoints{nodeID, parentID, points}
+}
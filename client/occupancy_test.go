@@ -0,0 +1,100 @@
+package client_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+	"github.com/simpleiot/simpleiot/server"
+)
+
+func TestOccupancy(t *testing.T) {
+	nc, root, stop, err := server.TestServer()
+	if err != nil {
+		t.Fatal("Error starting test server: ", err)
+	}
+	defer stop()
+
+	for _, id := range []string{"beamIn", "beamOut", "camera"} {
+		err = client.SendNodeType(nc, client.Variable{ID: id, Parent: root.ID}, "test")
+		if err != nil {
+			t.Fatal("Error sending variable node: ", err)
+		}
+	}
+
+	sendCount := func(id, typ string, v float64) {
+		t.Helper()
+		err := client.SendNodePoint(nc, id, data.Point{Type: typ, Value: v,
+			Origin: "test"}, true)
+		if err != nil {
+			t.Fatal("Error sending point: ", err)
+		}
+	}
+
+	sendCount("camera", "in", 100)
+	sendCount("camera", "out", 90)
+
+	err = client.SendNodeType(nc, client.Occupancy{
+		ID:          "occ",
+		Parent:      root.ID,
+		Description: "store",
+	}, "test")
+	if err != nil {
+		t.Fatal("Error sending occupancy node: ", err)
+	}
+
+	for _, z := range []client.OccupancyZone{
+		{ID: "lobby", Parent: "occ", Description: "lobby", Capacity: 2,
+			EntryNodeID: "beamIn", ExitNodeID: "beamOut", Occupancy: 7},
+		{ID: "lot", Parent: "occ", Description: "parking lot",
+			EntryNodeID: "camera", EntryPointType: "in",
+			ExitNodeID: "camera", ExitPointType: "out",
+			CounterType: data.PointValueTotal},
+	} {
+		err = client.SendNodeType(nc, z, "test")
+		if err != nil {
+			t.Fatal("Error sending zone node: ", err)
+		}
+	}
+
+	// wait for the client to restart with both zones
+	time.Sleep(500 * time.Millisecond)
+
+	// the counts were last reset yesterday, so they are reset now
+	err = client.SendNodePoint(nc, "occ", data.Point{Type: data.PointTypeLastReset,
+		Text: time.Now().Add(-48 * time.Hour).Format(time.RFC3339), Origin: "test"}, true)
+	if err != nil {
+		t.Fatal("Error sending point: ", err)
+	}
+
+	waitPointValue(t, nc, "lobby", data.PointTypeOccupancy, 0)
+
+	// beams send 1 when broken and 0 when clear
+	for i := 0; i < 3; i++ {
+		sendCount("beamIn", data.PointTypeValue, 1)
+		sendCount("beamIn", data.PointTypeValue, 0)
+	}
+
+	waitPointValue(t, nc, "lobby", data.PointTypeOccupancy, 3)
+	waitPointValue(t, nc, "lobby", data.PointTypeOverCapacity, 1)
+	waitPointValue(t, nc, "lobby", data.PointTypeOccupied, 1)
+
+	sendCount("beamOut", data.PointTypeValue, 1)
+	waitPointValue(t, nc, "lobby", data.PointTypeOccupancy, 2)
+	waitPointValue(t, nc, "lobby", data.PointTypeOverCapacity, 0)
+	waitPointValue(t, nc, "lobby", data.PointTypePeakOccupancy, 3)
+
+	// totals count the increase since the client started
+	sendCount("camera", "in", 105)
+	sendCount("camera", "out", 92)
+	waitPointValue(t, nc, "lot", data.PointTypeOccupancy, 3)
+	waitPointValue(t, nc, "lot", data.PointTypeEntriesToday, 5)
+	waitPointValue(t, nc, "occ", data.PointTypeOccupancy, 5)
+
+	// occupancy can't go below 0
+	sendCount("beamOut", data.PointTypeValue, 5)
+	waitPointValue(t, nc, "lobby", data.PointTypeOccupancy, 0)
+	waitPointValue(t, nc, "lobby", data.PointTypeOccupied, 0)
+	waitPointValue(t, nc, "lobby", data.PointTypeExitsToday, 6)
+}
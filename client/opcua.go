@@ -0,0 +1,805 @@
+package client
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gopcua/opcua"
+	"github.com/gopcua/opcua/id"
+	"github.com/gopcua/opcua/ua"
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// OpcUA connects to an OPC UA server at URI (opc.tcp://host:port) and
+// subscribes to the nodes of its IO children. SecurityPolicy (None,
+// Basic256Sha256, ...) and SecurityMode (None, Sign, SignAndEncrypt) select
+// the endpoint of the server, and TLSCert/TLSKey are the files of the client
+// application certificate used on secure endpoints. PollPeriod is the
+// publishing interval in ms. Setting Browse creates IO children for the
+// variables of the server that are not configured yet.
+type OpcUA struct {
+	ID             string    `node:"id"`
+	Parent         string    `node:"parent"`
+	Description    string    `point:"description"`
+	URI            string    `point:"uri"`
+	SecurityPolicy string    `point:"securityPolicy"`
+	SecurityMode   string    `point:"securityMode"`
+	TLSCert        string    `point:"tlsCert"`
+	TLSKey         string    `point:"tlsKey"`
+	Username       string    `point:"username"`
+	Pass           string    `point:"pass"`
+	PollPeriod     int       `point:"pollPeriod"`
+	Browse         bool      `point:"browse"`
+	Disable        bool      `point:"disable"`
+	ErrorCount     int       `point:"errorCount"`
+	IOs            []OpcUAIO `child:"opcUAIo"`
+}
+
+// OpcUAIO maps the value of an OPC UA node to the value point. NodeID is in
+// the ns=<namespace>;<i|s|g|b>=<identifier> format. Unless ReadOnly is set,
+// valueSet points are written to the node.
+type OpcUAIO struct {
+	ID          string  `node:"id"`
+	Parent      string  `node:"parent"`
+	Description string  `point:"description"`
+	NodeID      string  `point:"opcuaNodeID"`
+	Value       float64 `point:"value"`
+	ValueSet    float64 `point:"valueSet"`
+	ReadOnly    bool    `point:"readOnly"`
+	Disable     bool    `point:"disable"`
+}
+
+// how long to wait before reconnecting to a server, also how often the
+// connection is checked. Lost connections are first restored by gopcua,
+// the client only reconnects if gopcua gives up.
+var opcuaRetryPeriod = 10 * time.Second
+
+// timeout for connecting and for requests to the server
+const opcuaTimeout = 10 * time.Second
+
+// limits for browsing the address space of a server
+const (
+	opcuaBrowseDepth     = 8
+	opcuaBrowseVariables = 1000
+)
+
+// errOpcUAPasswordInsecure is returned if a password would be sent to the
+// server in clear text
+var errOpcUAPasswordInsecure = errors.New("user name authentication requires an endpoint that encrypts the password, set a security policy")
+
+// OpcUAClient is a SIOT client that maps OPC UA variables to points
+type OpcUAClient struct {
+	nc            *nats.Conn
+	config        OpcUA
+	stop          chan struct{}
+	newPoints     chan NewPoints
+	newEdgePoints chan NewPoints
+	conn          *opcua.Client
+	notifications chan *opcua.PublishNotificationData
+	// IO node IDs by monitored item client handle
+	subIOs []string
+	// variant type of the OPC UA node of each IO, used for writes
+	types map[string]ua.TypeID
+}
+
+// NewOpcUAClient ...
+func NewOpcUAClient(nc *nats.Conn, config OpcUA) Client {
+	return &OpcUAClient{
+		nc:            nc,
+		config:        config,
+		stop:          make(chan struct{}),
+		newPoints:     make(chan NewPoints),
+		newEdgePoints: make(chan NewPoints),
+	}
+}
+
+// Start runs the main logic for this client and blocks until stopped
+func (o *OpcUAClient) Start() error {
+	log.Println("Starting OPC UA client: ", o.config.Description)
+
+	retry := time.NewTimer(0)
+	defer retry.Stop()
+
+	check := time.NewTicker(opcuaRetryPeriod)
+	defer check.Stop()
+
+	reconnect := func() {
+		o.disconnect()
+		retry.Reset(0)
+	}
+
+	failed := func(msg string, err error) {
+		log.Printf("OPC UA %v: %v: %v\n", o.config.Description, msg, err)
+		o.error()
+		o.disconnect()
+		retry.Reset(opcuaRetryPeriod)
+	}
+
+done:
+	for {
+		select {
+		case <-o.stop:
+			log.Println("Stopping OPC UA client: ", o.config.Description)
+			break done
+		case <-retry.C:
+			o.disconnect()
+
+			if o.config.Disable || o.config.URI == "" {
+				break
+			}
+
+			err := o.connect()
+			if err != nil {
+				failed("error connecting", err)
+				break
+			}
+
+			if o.config.Browse {
+				o.browse()
+			}
+		case <-check.C:
+			if o.conn != nil && o.conn.State() == opcua.Closed {
+				failed("connection lost", errors.New("connection closed"))
+			}
+		case n := <-o.notifications:
+			if n.Error != nil {
+				failed("subscription error", n.Error)
+				break
+			}
+
+			switch v := n.Value.(type) {
+			case *ua.DataChangeNotification:
+				for _, item := range v.MonitoredItems {
+					if int(item.ClientHandle) >= len(o.subIOs) {
+						continue
+					}
+					o.sendValue(o.subIOs[item.ClientHandle], item.Value)
+				}
+			case *ua.StatusChangeNotification:
+				if opcuaBad(v.Status) {
+					failed("subscription ended", v.Status)
+				}
+			}
+		case pts := <-o.newPoints:
+			err := data.MergePoints(pts.ID, pts.Points, &o.config)
+			if err != nil {
+				log.Println("error merging new points: ", err)
+			}
+
+			for _, p := range pts.Points {
+				switch p.Type {
+				case data.PointTypeURI, data.PointTypeSecurityPolicy,
+					data.PointTypeSecurityMode, data.PointTypeTLSCert,
+					data.PointTypeTLSKey, data.PointTypeUsername,
+					data.PointTypePass, data.PointTypePollPeriod,
+					data.PointTypeDisable, data.PointTypeOpcUANodeID:
+					reconnect()
+				case data.PointTypeValueSet:
+					o.write(pts.ID, p)
+				case data.PointTypeBrowse:
+					if o.config.Browse && o.conn != nil {
+						o.browse()
+					}
+				}
+			}
+		case pts := <-o.newEdgePoints:
+			err := data.MergeEdgePoints(pts.ID, pts.Parent, pts.Points, &o.config)
+			if err != nil {
+				log.Println("error merging new points: ", err)
+			}
+		}
+	}
+
+	o.disconnect()
+
+	return nil
+}
+
+// connect selects an endpoint of the server, connects, sends the current
+// values, and subscribes to the nodes of the IOs
+func (o *OpcUAClient) connect() error {
+	ctx, cancel := context.WithTimeout(context.Background(), opcuaTimeout)
+	defer cancel()
+
+	endpoints, err := opcua.GetEndpoints(ctx, o.config.URI)
+	if err != nil {
+		return err
+	}
+
+	ep, err := opcuaEndpoint(endpoints, o.config)
+	if err != nil {
+		return err
+	}
+
+	opts, err := opcuaOptions(ep, o.config)
+	if err != nil {
+		return err
+	}
+
+	// the endpoint URL reported by the server often has a host name that
+	// can't be resolved, so the configured URI is used
+	o.conn = opcua.NewClient(o.config.URI, opts...)
+
+	err = o.conn.Connect(ctx)
+	if err != nil {
+		o.conn = nil
+		return err
+	}
+
+	o.types = make(map[string]ua.TypeID)
+	o.subIOs = nil
+
+	var ids []*ua.NodeID
+
+	for _, io := range o.config.IOs {
+		if io.Disable || io.NodeID == "" {
+			continue
+		}
+
+		id, err := ua.ParseNodeID(io.NodeID)
+		if err != nil {
+			log.Printf("OPC UA %v: IO %v: %v\n", o.config.Description,
+				io.Description, err)
+			continue
+		}
+
+		ids = append(ids, id)
+		o.subIOs = append(o.subIOs, io.ID)
+	}
+
+	if len(ids) <= 0 {
+		return nil
+	}
+
+	values, err := o.read(ctx, ids...)
+	if err != nil {
+		return err
+	}
+
+	for i, v := range values {
+		if i < len(o.subIOs) {
+			o.sendValue(o.subIOs[i], v)
+		}
+	}
+
+	period := o.config.PollPeriod
+	if period <= 0 {
+		period = 1000
+	}
+
+	o.notifications = make(chan *opcua.PublishNotificationData, 100)
+
+	sub, err := o.conn.SubscribeWithContext(ctx, &opcua.SubscriptionParameters{
+		Interval: time.Duration(period) * time.Millisecond,
+	}, o.notifications)
+	if err != nil {
+		return err
+	}
+
+	items := make([]*ua.MonitoredItemCreateRequest, len(ids))
+	for i, id := range ids {
+		items[i] = opcua.NewMonitoredItemCreateRequestWithDefaults(id,
+			ua.AttributeIDValue, uint32(i))
+	}
+
+	res, err := sub.MonitorWithContext(ctx, ua.TimestampsToReturnBoth, items...)
+	if err != nil {
+		return err
+	}
+
+	for i, r := range res.Results {
+		if i < len(ids) && opcuaBad(r.StatusCode) {
+			log.Printf("OPC UA %v: error monitoring %v: %v\n",
+				o.config.Description, ids[i], r.StatusCode)
+		}
+	}
+
+	return nil
+}
+
+func (o *OpcUAClient) disconnect() {
+	if o.conn != nil {
+		o.conn.Close()
+	}
+
+	o.conn = nil
+	o.notifications = nil
+}
+
+func (o *OpcUAClient) read(ctx context.Context, ids ...*ua.NodeID) ([]*ua.DataValue, error) {
+	req := &ua.ReadRequest{TimestampsToReturn: ua.TimestampsToReturnBoth}
+	for _, id := range ids {
+		req.NodesToRead = append(req.NodesToRead, &ua.ReadValueID{
+			NodeID:      id,
+			AttributeID: ua.AttributeIDValue,
+		})
+	}
+
+	res, err := o.conn.ReadWithContext(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(res.Results) != len(ids) {
+		return nil, fmt.Errorf("read %v values, got %v", len(ids), len(res.Results))
+	}
+
+	return res.Results, nil
+}
+
+func (o *OpcUAClient) error() {
+	o.config.ErrorCount++
+	o.sendStat(data.PointTypeErrorCount, o.config.ErrorCount)
+}
+
+// sendValue sends the value of an OPC UA node to an IO node
+func (o *OpcUAClient) sendValue(ioID string, v *ua.DataValue) {
+	if v == nil {
+		return
+	}
+
+	if opcuaBad(v.Status) {
+		log.Printf("OPC UA %v: %v: %v\n", o.config.Description,
+			o.ioDescription(ioID), v.Status)
+		return
+	}
+
+	if v.Value != nil && v.Value.Type() != ua.TypeIDNull {
+		o.types[ioID] = v.Value.Type()
+	}
+
+	p, ok := opcuaPoint(v, time.Now())
+	if !ok {
+		return
+	}
+
+	err := SendNodePoint(o.nc, ioID, p, false)
+	if err != nil {
+		log.Println("OPC UA: error sending value: ", err)
+	}
+}
+
+// write writes a valueSet point of an IO to its OPC UA node
+func (o *OpcUAClient) write(ioID string, p data.Point) {
+	var io *OpcUAIO
+	for i := range o.config.IOs {
+		if o.config.IOs[i].ID == ioID {
+			io = &o.config.IOs[i]
+		}
+	}
+
+	if io == nil || io.ReadOnly || io.Disable {
+		return
+	}
+
+	err := o.writeIO(io, p)
+	if err != nil {
+		log.Printf("OPC UA %v: error writing %v: %v\n", o.config.Description,
+			io.Description, err)
+		o.error()
+	}
+
+	err = ConfirmCommand(o.nc, ioID, p, err)
+	if err != nil {
+		log.Println("OPC UA: error confirming value set: ", err)
+	}
+}
+
+func (o *OpcUAClient) writeIO(io *OpcUAIO, p data.Point) error {
+	if o.conn == nil {
+		return fmt.Errorf("not connected")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), opcuaTimeout)
+	defer cancel()
+
+	id, err := ua.ParseNodeID(io.NodeID)
+	if err != nil {
+		return err
+	}
+
+	typ, ok := o.types[io.ID]
+	if !ok {
+		values, err := o.read(ctx, id)
+		if err != nil {
+			return err
+		}
+		if opcuaBad(values[0].Status) {
+			return values[0].Status
+		}
+		if values[0].Value == nil {
+			return fmt.Errorf("no value")
+		}
+		typ = values[0].Value.Type()
+		o.types[io.ID] = typ
+	}
+
+	v, err := opcuaVariant(typ, p)
+	if err != nil {
+		return err
+	}
+
+	res, err := o.conn.WriteWithContext(ctx, &ua.WriteRequest{
+		NodesToWrite: []*ua.WriteValue{{
+			NodeID:      id,
+			AttributeID: ua.AttributeIDValue,
+			Value: &ua.DataValue{
+				EncodingMask: ua.DataValueValue,
+				Value:        v,
+			},
+		}},
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(res.Results) != 1 {
+		return fmt.Errorf("no write result")
+	}
+
+	if opcuaBad(res.Results[0]) {
+		return res.Results[0]
+	}
+
+	return nil
+}
+
+// browse creates IO nodes for the variables of the server that are not
+// configured yet, and clears the browse point
+func (o *OpcUAClient) browse() {
+	// no origin so that the client is not restarted before the IOs are
+	// created
+	err := SendNodePoint(o.nc, o.config.ID, data.Point{
+		Type:  data.PointTypeBrowse,
+		Value: 0,
+	}, true)
+	if err != nil {
+		log.Println("OPC UA: error clearing browse: ", err)
+	}
+
+	o.config.Browse = false
+
+	configured := make(map[string]bool)
+	for _, io := range o.config.IOs {
+		configured[io.NodeID] = true
+	}
+
+	ios, err := opcuaVariables(opcuaClientBrowser{o.conn}, configured)
+	if err != nil {
+		log.Printf("OPC UA %v: error browsing: %v\n", o.config.Description, err)
+		o.error()
+	}
+
+	log.Printf("OPC UA %v: found %v new variables\n", o.config.Description, len(ios))
+
+	for _, io := range ios {
+		io.ID = uuid.New().String()
+		io.Parent = o.config.ID
+		io.ReadOnly = true
+
+		// the origin restarts the client so it subscribes to the new IOs
+		err := sendChildNodeType(o.nc, io, data.NodeTypeOpcUAIO, o.config.ID)
+		if err != nil {
+			log.Println("OPC UA: error creating IO: ", err)
+			return
+		}
+	}
+}
+
+func (o *OpcUAClient) ioDescription(ioID string) string {
+	for _, io := range o.config.IOs {
+		if io.ID == ioID {
+			return io.Description
+		}
+	}
+	return ioID
+}
+
+func (o *OpcUAClient) sendStat(typ string, value int) {
+	err := SendNodePoint(o.nc, o.config.ID, data.Point{
+		Time:  time.Now(),
+		Type:  typ,
+		Value: float64(value),
+	}, false)
+	if err != nil {
+		log.Println("OPC UA: error sending stat: ", err)
+	}
+}
+
+// Stop sends a signal to the Start function to exit
+func (o *OpcUAClient) Stop(err error) {
+	close(o.stop)
+}
+
+// Points is called by the Manager when new points for this
+// node are received.
+func (o *OpcUAClient) Points(nodeID string, points []data.Point) {
+	o.newPoints <- NewPoints{nodeID, "", points}
+}
+
+// EdgePoints is called by the Manager when new edge points for this
+// node are received.
+func (o *OpcUAClient) EdgePoints(nodeID, parentID string, points []data.Point) {
+	o.newEdgePoints <- NewPoints{nodeID, parentID, points}
+}
+
+// opcuaEndpoint selects the endpoint of the server with the configured
+// security policy and mode. If neither is set, the most secure endpoint is
+// used if a client certificate is configured, otherwise an endpoint without
+// security.
+func opcuaEndpoint(endpoints []*ua.EndpointDescription, config OpcUA) (*ua.EndpointDescription, error) {
+	policy := config.SecurityPolicy
+	mode := ua.MessageSecurityModeInvalid
+
+	if config.SecurityMode != "" {
+		mode = ua.MessageSecurityModeFromString(config.SecurityMode)
+		if mode == ua.MessageSecurityModeInvalid {
+			return nil, fmt.Errorf("invalid security mode: %v", config.SecurityMode)
+		}
+	}
+
+	if policy == "" && mode == ua.MessageSecurityModeInvalid && config.TLSCert == "" {
+		policy = "None"
+	}
+
+	ep := opcua.SelectEndpoint(endpoints, policy, mode)
+	if ep == nil {
+		return nil, fmt.Errorf("server has no endpoint with security policy %q and mode %q",
+			policy, config.SecurityMode)
+	}
+
+	return ep, nil
+}
+
+// opcuaOptions returns the gopcua options to connect to an endpoint. The
+// session is anonymous unless a user name is configured.
+func opcuaOptions(ep *ua.EndpointDescription, config OpcUA) ([]opcua.Option, error) {
+	opts := []opcua.Option{
+		opcua.ApplicationName("Simple IoT"),
+		opcua.RequestTimeout(opcuaTimeout),
+	}
+
+	if ep.SecurityPolicyURI != ua.SecurityPolicyURINone {
+		if config.TLSCert == "" || config.TLSKey == "" {
+			return nil, fmt.Errorf("security policy %v requires a client certificate",
+				strings.TrimPrefix(ep.SecurityPolicyURI, ua.SecurityPolicyURIPrefix))
+		}
+
+		cert, err := tls.LoadX509KeyPair(config.TLSCert, config.TLSKey)
+		if err != nil {
+			return nil, err
+		}
+
+		key, ok := cert.PrivateKey.(*rsa.PrivateKey)
+		if !ok {
+			return nil, errors.New("client certificate key must be an RSA key")
+		}
+
+		opts = append(opts, opcua.Certificate(cert.Certificate[0]),
+			opcua.PrivateKey(key))
+	}
+
+	authType := ua.UserTokenTypeAnonymous
+	if config.Username != "" {
+		authType = ua.UserTokenTypeUserName
+	}
+
+	var token *ua.UserTokenPolicy
+	for _, t := range ep.UserIdentityTokens {
+		if t.TokenType == authType {
+			token = t
+			break
+		}
+	}
+
+	if token == nil {
+		return nil, fmt.Errorf("endpoint does not support %v authentication",
+			strings.TrimPrefix(authType.String(), "UserTokenType"))
+	}
+
+	if authType == ua.UserTokenTypeUserName {
+		// the password is encrypted with the security policy of the
+		// token, which defaults to the policy of the endpoint
+		policy := token.SecurityPolicyURI
+		if policy == "" {
+			policy = ep.SecurityPolicyURI
+		}
+
+		if policy == ua.SecurityPolicyURINone &&
+			ep.SecurityMode != ua.MessageSecurityModeSignAndEncrypt {
+			return nil, errOpcUAPasswordInsecure
+		}
+
+		opts = append(opts, opcua.AuthUsername(config.Username, config.Pass))
+	} else {
+		opts = append(opts, opcua.AuthAnonymous())
+	}
+
+	return append(opts, opcua.SecurityFromEndpoint(ep, authType)), nil
+}
+
+// opcuaBad returns true if the severity of a status code is bad
+func opcuaBad(s ua.StatusCode) bool {
+	return s&0xC0000000 == 0x80000000
+}
+
+// opcuaPoint converts an OPC UA value to a value point. Numeric and boolean
+// values are sent in Value and strings in Text. Other types and arrays are
+// not supported.
+func opcuaPoint(v *ua.DataValue, now time.Time) (data.Point, bool) {
+	p := data.Point{
+		Time: v.SourceTimestamp,
+		Type: data.PointTypeValue,
+	}
+
+	if p.Time.IsZero() {
+		p.Time = now
+	}
+
+	if v.Value == nil {
+		return p, false
+	}
+
+	switch x := v.Value.Value().(type) {
+	case string:
+		p.Text = x
+	case bool:
+		p.Value = data.BoolToFloat(x)
+	case int8:
+		p.Value = float64(x)
+	case byte:
+		p.Value = float64(x)
+	case int16:
+		p.Value = float64(x)
+	case uint16:
+		p.Value = float64(x)
+	case int32:
+		p.Value = float64(x)
+	case uint32:
+		p.Value = float64(x)
+	case int64:
+		p.Value = float64(x)
+	case uint64:
+		p.Value = float64(x)
+	case float32:
+		p.Value = float64(x)
+	case float64:
+		p.Value = x
+	default:
+		return p, false
+	}
+
+	return p, true
+}
+
+// opcuaVariant converts a point to a variant of the type of the OPC UA
+// variable it is written to
+func opcuaVariant(typ ua.TypeID, p data.Point) (*ua.Variant, error) {
+	var value any
+
+	switch typ {
+	case ua.TypeIDString:
+		value = p.Text
+	case ua.TypeIDBoolean:
+		value = p.Value != 0
+	case ua.TypeIDSByte:
+		value = int8(p.Value)
+	case ua.TypeIDByte:
+		value = byte(p.Value)
+	case ua.TypeIDInt16:
+		value = int16(p.Value)
+	case ua.TypeIDUint16:
+		value = uint16(p.Value)
+	case ua.TypeIDInt32:
+		value = int32(p.Value)
+	case ua.TypeIDUint32:
+		value = uint32(p.Value)
+	case ua.TypeIDInt64:
+		value = int64(p.Value)
+	case ua.TypeIDUint64:
+		value = uint64(p.Value)
+	case ua.TypeIDFloat:
+		value = float32(p.Value)
+	case ua.TypeIDDouble:
+		value = p.Value
+	default:
+		return nil, fmt.Errorf("can't write to a variable of type %v", typ)
+	}
+
+	return ua.NewVariant(value)
+}
+
+// opcuaBrowser browses the address space of a server
+type opcuaBrowser interface {
+	Browse(id *ua.NodeID) ([]*ua.ReferenceDescription, error)
+}
+
+// opcuaClientBrowser browses the objects and variables referenced by a node
+// on a server
+type opcuaClientBrowser struct {
+	c *opcua.Client
+}
+
+func (b opcuaClientBrowser) Browse(nodeID *ua.NodeID) ([]*ua.ReferenceDescription, error) {
+	return b.c.Node(nodeID).References(id.HierarchicalReferences,
+		ua.BrowseDirectionForward, ua.NodeClassObject|ua.NodeClassVariable, true)
+}
+
+// opcuaVariables browses the objects below the Objects folder and returns
+// IOs for the variables that are not configured. Namespace 0 nodes, which
+// describe the server itself, are skipped. The description of an IO is the
+// path of display names to the variable.
+func opcuaVariables(b opcuaBrowser, configured map[string]bool) ([]OpcUAIO, error) {
+	var ret []OpcUAIO
+	visited := make(map[string]bool)
+
+	var walk func(nodeID *ua.NodeID, path []string) error
+	walk = func(nodeID *ua.NodeID, path []string) error {
+		if len(path) >= opcuaBrowseDepth || len(ret) >= opcuaBrowseVariables {
+			return nil
+		}
+
+		refs, err := b.Browse(nodeID)
+		if err != nil {
+			return err
+		}
+
+		for _, r := range refs {
+			if r.NodeID == nil || r.NodeID.NodeID == nil {
+				continue
+			}
+
+			refID := r.NodeID.NodeID
+			key := refID.String()
+			if refID.Namespace() == 0 || visited[key] {
+				continue
+			}
+			visited[key] = true
+
+			var name string
+			if r.DisplayName != nil {
+				name = r.DisplayName.Text
+			}
+			if name == "" && r.BrowseName != nil {
+				name = r.BrowseName.Name
+			}
+
+			p := append(path[:len(path):len(path)], name)
+
+			switch r.NodeClass {
+			case ua.NodeClassObject:
+				err := walk(refID, p)
+				if err != nil {
+					return err
+				}
+			case ua.NodeClassVariable:
+				if configured[key] || len(ret) >= opcuaBrowseVariables {
+					continue
+				}
+				ret = append(ret, OpcUAIO{
+					Description: strings.Join(p, "/"),
+					NodeID:      key,
+				})
+			}
+		}
+
+		return nil
+	}
+
+	err := walk(ua.NewNumericNodeID(0, id.ObjectsFolder), nil)
+
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Description < ret[j].Description
+	})
+
+	return ret, err
+}
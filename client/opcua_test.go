@@ -0,0 +1,209 @@
+package client
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gopcua/opcua/id"
+	"github.com/gopcua/opcua/ua"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+func TestOpcUAPoint(t *testing.T) {
+	now := time.Now()
+	source := now.Add(-time.Second)
+
+	p, ok := opcuaPoint(&ua.DataValue{
+		Value:           ua.MustVariant(int16(-12)),
+		SourceTimestamp: source,
+	}, now)
+	if !ok || p.Value != -12 || !p.Time.Equal(source) {
+		t.Error("int16 got ", p, ok)
+	}
+
+	p, ok = opcuaPoint(&ua.DataValue{Value: ua.MustVariant(true)}, now)
+	if !ok || p.Value != 1 || !p.Time.Equal(now) {
+		t.Error("bool got ", p, ok)
+	}
+
+	p, ok = opcuaPoint(&ua.DataValue{Value: ua.MustVariant("running")}, now)
+	if !ok || p.Text != "running" {
+		t.Error("string got ", p, ok)
+	}
+
+	_, ok = opcuaPoint(&ua.DataValue{Value: ua.MustVariant([]int32{1})}, now)
+	if ok {
+		t.Error("arrays should not be converted")
+	}
+
+	_, ok = opcuaPoint(&ua.DataValue{}, now)
+	if ok {
+		t.Error("missing value should not be converted")
+	}
+}
+
+func TestOpcUAVariant(t *testing.T) {
+	tests := []struct {
+		typ ua.TypeID
+		p   data.Point
+		exp any
+	}{
+		{ua.TypeIDBoolean, data.Point{Value: 1}, true},
+		{ua.TypeIDInt16, data.Point{Value: -12}, int16(-12)},
+		{ua.TypeIDUint32, data.Point{Value: 40000}, uint32(40000)},
+		{ua.TypeIDFloat, data.Point{Value: 1.5}, float32(1.5)},
+		{ua.TypeIDDouble, data.Point{Value: 2.25}, 2.25},
+		{ua.TypeIDString, data.Point{Text: "on"}, "on"},
+	}
+
+	for _, test := range tests {
+		v, err := opcuaVariant(test.typ, test.p)
+		if err != nil {
+			t.Errorf("%v: %v", test.typ, err)
+			continue
+		}
+
+		if v.Type() != test.typ || v.Value() != test.exp {
+			t.Errorf("%v: got %v %v", test.typ, v.Type(), v.Value())
+		}
+	}
+
+	_, err := opcuaVariant(ua.TypeIDDateTime, data.Point{Value: 1})
+	if err == nil {
+		t.Error("expected error writing to a DateTime")
+	}
+}
+
+func TestOpcUAEndpoint(t *testing.T) {
+	endpoint := func(policy string, mode ua.MessageSecurityMode,
+		level byte, tokens ...*ua.UserTokenPolicy) *ua.EndpointDescription {
+		return &ua.EndpointDescription{
+			SecurityPolicyURI:  ua.FormatSecurityPolicyURI(policy),
+			SecurityMode:       mode,
+			SecurityLevel:      level,
+			UserIdentityTokens: tokens,
+		}
+	}
+
+	anonymous := &ua.UserTokenPolicy{PolicyID: "anonymous",
+		TokenType: ua.UserTokenTypeAnonymous}
+	userName := &ua.UserTokenPolicy{PolicyID: "username",
+		TokenType: ua.UserTokenTypeUserName}
+	userNameEncrypted := &ua.UserTokenPolicy{PolicyID: "username_basic256",
+		TokenType:         ua.UserTokenTypeUserName,
+		SecurityPolicyURI: ua.SecurityPolicyURIBasic256Sha256}
+
+	none := endpoint("None", ua.MessageSecurityModeNone, 0, anonymous, userName)
+	sign := endpoint("Basic256Sha256", ua.MessageSecurityModeSign, 1, userName)
+	encrypt := endpoint("Basic256Sha256", ua.MessageSecurityModeSignAndEncrypt, 2,
+		anonymous, userName)
+
+	tests := []struct {
+		name   string
+		config OpcUA
+		exp    *ua.EndpointDescription
+	}{
+		{"default", OpcUA{}, none},
+		{"certificate", OpcUA{TLSCert: "cert.pem"}, encrypt},
+		{"policy", OpcUA{SecurityPolicy: "Basic256Sha256"}, encrypt},
+		{"policy URI", OpcUA{SecurityPolicy: ua.SecurityPolicyURIBasic256Sha256}, encrypt},
+		{"mode", OpcUA{SecurityMode: "Sign"}, sign},
+		{"policy and mode", OpcUA{SecurityPolicy: "Basic256Sha256",
+			SecurityMode: "None"}, nil},
+		{"invalid mode", OpcUA{SecurityMode: "Encrypt"}, nil},
+	}
+
+	for _, test := range tests {
+		ep, err := opcuaEndpoint([]*ua.EndpointDescription{none, sign, encrypt},
+			test.config)
+		if test.exp == nil {
+			if err == nil {
+				t.Errorf("%v: expected error, got %+v", test.name, ep)
+			}
+			continue
+		}
+
+		if err != nil || ep != test.exp {
+			t.Errorf("%v: got %+v, %v", test.name, ep, err)
+		}
+	}
+
+	// passwords are only sent encrypted
+	_, err := opcuaOptions(none, OpcUA{Username: "user", Pass: "secret"})
+	if !errors.Is(err, errOpcUAPasswordInsecure) {
+		t.Error("password on endpoint without security: ", err)
+	}
+
+	_, err = opcuaOptions(endpoint("None", ua.MessageSecurityModeNone, 0,
+		userNameEncrypted), OpcUA{Username: "user", Pass: "secret"})
+	if err != nil {
+		t.Error("password encrypted by the token policy: ", err)
+	}
+
+	_, err = opcuaOptions(none, OpcUA{})
+	if err != nil {
+		t.Error("anonymous session: ", err)
+	}
+
+	_, err = opcuaOptions(sign, OpcUA{})
+	if err == nil {
+		t.Error("secure endpoint requires a certificate")
+	}
+}
+
+type testOpcUABrowser map[string][]*ua.ReferenceDescription
+
+func (b testOpcUABrowser) Browse(id *ua.NodeID) ([]*ua.ReferenceDescription, error) {
+	return b[id.String()], nil
+}
+
+func TestOpcUAVariables(t *testing.T) {
+	ref := func(ns uint16, name string, class ua.NodeClass) *ua.ReferenceDescription {
+		return &ua.ReferenceDescription{
+			NodeID:      ua.NewExpandedNodeID(ua.NewStringNodeID(ns, name), "", 0),
+			BrowseName:  &ua.QualifiedName{NamespaceIndex: ns, Name: name},
+			DisplayName: &ua.LocalizedText{Text: name},
+			NodeClass:   class,
+		}
+	}
+
+	object := func(ns uint16, name string) *ua.ReferenceDescription {
+		return ref(ns, name, ua.NodeClassObject)
+	}
+
+	variable := func(name string) *ua.ReferenceDescription {
+		return ref(2, name, ua.NodeClassVariable)
+	}
+
+	objects := ua.NewNumericNodeID(0, id.ObjectsFolder).String()
+
+	b := testOpcUABrowser{
+		objects:    {object(0, "Server"), object(2, "Line1")},
+		"s=Server": {variable("ServerStatus")},
+		"ns=2;s=Line1": {object(2, "Pump"), variable("Count"),
+			// references back to a visited node are ignored
+			object(2, "Line1")},
+		"ns=2;s=Pump": {variable("Speed"), variable("On")},
+	}
+
+	ios, err := opcuaVariables(b, map[string]bool{"ns=2;s=On": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := []OpcUAIO{
+		{Description: "Line1/Count", NodeID: "ns=2;s=Count"},
+		{Description: "Line1/Pump/Speed", NodeID: "ns=2;s=Speed"},
+	}
+
+	if len(ios) != len(exp) {
+		t.Fatalf("got %+v", ios)
+	}
+
+	for i := range exp {
+		if ios[i] != exp[i] {
+			t.Errorf("IO %v: got %+v, exp %+v", i, ios[i], exp[i])
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// GetPointOrigin returns who last changed a point of a node, for example the
+// user who last changed a setpoint. An error is returned if the node does
+// not have the point.
+func GetPointOrigin(nc *nats.Conn, nodeID, typ, key string) (data.PointOrigin, error) {
+	var ret data.PointOrigin
+
+	points := data.Points{
+		{Type: data.PointTypePointType, Text: typ},
+		{Type: data.PointTypePointKey, Text: key},
+	}
+
+	req, err := points.ToPb()
+	if err != nil {
+		return ret, err
+	}
+
+	msg, err := nc.Request(SubjectNodeOrigin(nodeID), req, 20*time.Second)
+	if err != nil {
+		return ret, fmt.Errorf("Error requesting point origin: %w", err)
+	}
+
+	err = json.Unmarshal(msg.Data, &ret)
+	if err != nil {
+		return ret, fmt.Errorf("Error decoding point origin: %w", err)
+	}
+
+	if ret.Error != "" {
+		return ret, errors.New(ret.Error)
+	}
+
+	return ret, nil
+}
@@ -0,0 +1,363 @@
+package client
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// BufferPolicy describes what happens when a point buffer is full
+type BufferPolicy int
+
+// Buffer policies
+const (
+	// BufferDropOldest discards the oldest queued message when the buffer is full
+	BufferDropOldest BufferPolicy = iota
+	// BufferSpillToDisk writes messages to a file when the buffer is full and
+	// replays them in order once the subscriber catches up
+	BufferSpillToDisk
+)
+
+// BufferOptions is used to configure buffered point subscriptions
+type BufferOptions struct {
+	// Size is the number of messages queued in memory, defaults to 1000
+	Size int
+	// Policy used when the in memory buffer is full
+	Policy BufferPolicy
+	// SpillFile is the file used for BufferSpillToDisk
+	SpillFile string
+	// MaxSpillBytes limits the size of the spill file, defaults to 10MB. When
+	// this limit is reached, new messages are dropped.
+	MaxSpillBytes int64
+	// MetricsNodeID, if set, is the node buffer metrics are reported to. The
+	// subscription subject is used as the point key.
+	MetricsNodeID string
+	// MetricsPeriod defaults to 1m
+	MetricsPeriod time.Duration
+}
+
+// BufferStats contains counters for a buffered subscription
+type BufferStats struct {
+	Pending int
+	Dropped int
+	Spilled int
+}
+
+// BufferedSub is a NATS subscription where messages are queued between the
+// NATS client and the callback, so a slow callback does not cause NATS
+// slow consumer errors that disconnect the entire connection.
+type BufferedSub struct {
+	nc       *nats.Conn
+	opts     BufferOptions
+	sub      *nats.Subscription
+	callback func(subject string, points data.Points)
+
+	lock      sync.Mutex
+	queue     []*nats.Msg
+	spill     *os.File
+	spillW    int64
+	spillR    int64
+	spillRecs int
+	stats     BufferStats
+
+	chNotify chan struct{}
+	chStop   chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// NewBufferedSub subscribes to subject and calls callback with decoded points
+// from a separate goroutine.
+func NewBufferedSub(nc *nats.Conn, subject string, opts BufferOptions,
+	callback func(subject string, points data.Points)) (*BufferedSub, error) {
+	if opts.Size <= 0 {
+		opts.Size = 1000
+	}
+
+	if opts.MaxSpillBytes <= 0 {
+		opts.MaxSpillBytes = 10 * 1024 * 1024
+	}
+
+	if opts.MetricsPeriod <= 0 {
+		opts.MetricsPeriod = time.Minute
+	}
+
+	bs := &BufferedSub{
+		nc:       nc,
+		opts:     opts,
+		callback: callback,
+		chNotify: make(chan struct{}, 1),
+		chStop:   make(chan struct{}),
+	}
+
+	if opts.Policy == BufferSpillToDisk {
+		if opts.SpillFile == "" {
+			return nil, errors.New("SpillFile must be set for spill to disk policy")
+		}
+
+		var err error
+		bs.spill, err = os.OpenFile(opts.SpillFile, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("Error opening spill file: %w", err)
+		}
+	}
+
+	var err error
+	bs.sub, err = nc.Subscribe(subject, bs.enqueue)
+	if err != nil {
+		bs.closeSpill()
+		return nil, err
+	}
+
+	bs.wg.Add(1)
+	go bs.run()
+
+	return bs, nil
+}
+
+func (bs *BufferedSub) enqueue(msg *nats.Msg) {
+	bs.lock.Lock()
+	defer bs.lock.Unlock()
+
+	if bs.spillRecs > 0 {
+		// we must keep ordering, so once we have started spilling, everything
+		// goes to disk until the spill file is drained
+		bs.spillMsg(msg)
+	} else if len(bs.queue) >= bs.opts.Size {
+		switch bs.opts.Policy {
+		case BufferSpillToDisk:
+			bs.spillMsg(msg)
+		default:
+			bs.queue = bs.queue[1:]
+			bs.queue = append(bs.queue, msg)
+			bs.stats.Dropped++
+		}
+	} else {
+		bs.queue = append(bs.queue, msg)
+	}
+
+	select {
+	case bs.chNotify <- struct{}{}:
+	default:
+	}
+}
+
+// spillMsg must be called with lock held. Records are written as
+// subject length, subject, data length, data.
+func (bs *BufferedSub) spillMsg(msg *nats.Msg) {
+	recLen := int64(8 + len(msg.Subject) + len(msg.Data))
+	if bs.spillW+recLen > bs.opts.MaxSpillBytes {
+		bs.stats.Dropped++
+		return
+	}
+
+	buf := make([]byte, recLen)
+	binary.LittleEndian.PutUint32(buf[0:], uint32(len(msg.Subject)))
+	copy(buf[4:], msg.Subject)
+	binary.LittleEndian.PutUint32(buf[4+len(msg.Subject):], uint32(len(msg.Data)))
+	copy(buf[8+len(msg.Subject):], msg.Data)
+
+	_, err := bs.spill.WriteAt(buf, bs.spillW)
+	if err != nil {
+		log.Println("Error writing to spill file: ", err)
+		bs.stats.Dropped++
+		return
+	}
+
+	bs.spillW += recLen
+	bs.spillRecs++
+	bs.stats.Spilled++
+}
+
+// unspill must be called with lock held
+func (bs *BufferedSub) unspill() (*nats.Msg, error) {
+	var lenBuf [4]byte
+
+	_, err := bs.spill.ReadAt(lenBuf[:], bs.spillR)
+	if err != nil {
+		return nil, err
+	}
+	subLen := int64(binary.LittleEndian.Uint32(lenBuf[:]))
+
+	subject := make([]byte, subLen)
+	_, err = bs.spill.ReadAt(subject, bs.spillR+4)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = bs.spill.ReadAt(lenBuf[:], bs.spillR+4+subLen)
+	if err != nil {
+		return nil, err
+	}
+	dataLen := int64(binary.LittleEndian.Uint32(lenBuf[:]))
+
+	d := make([]byte, dataLen)
+	_, err = bs.spill.ReadAt(d, bs.spillR+8+subLen)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	bs.spillR += 8 + subLen + dataLen
+	bs.spillRecs--
+
+	if bs.spillRecs <= 0 {
+		// spill file is drained, start over
+		bs.spillR = 0
+		bs.spillW = 0
+		err := bs.spill.Truncate(0)
+		if err != nil {
+			log.Println("Error truncating spill file: ", err)
+		}
+	}
+
+	return &nats.Msg{Subject: string(subject), Data: d}, nil
+}
+
+// next returns the next message to process or nil if there is none
+func (bs *BufferedSub) next() *nats.Msg {
+	bs.lock.Lock()
+	defer bs.lock.Unlock()
+
+	if len(bs.queue) > 0 {
+		msg := bs.queue[0]
+		bs.queue = bs.queue[1:]
+		return msg
+	}
+
+	if bs.spillRecs > 0 {
+		msg, err := bs.unspill()
+		if err != nil {
+			log.Println("Error reading spill file, discarding spilled data: ", err)
+			bs.stats.Dropped += bs.spillRecs
+			bs.spillRecs = 0
+			bs.spillR = 0
+			bs.spillW = 0
+			return nil
+		}
+		return msg
+	}
+
+	return nil
+}
+
+func (bs *BufferedSub) run() {
+	defer bs.wg.Done()
+
+	var metricsTicker *time.Ticker
+	var metricsC <-chan time.Time
+	if bs.opts.MetricsNodeID != "" {
+		metricsTicker = time.NewTicker(bs.opts.MetricsPeriod)
+		defer metricsTicker.Stop()
+		metricsC = metricsTicker.C
+	}
+
+	for {
+		for {
+			// metrics are also reported while draining, as this is
+			// when the buffer is backed up
+			select {
+			case <-bs.chStop:
+				return
+			case <-metricsC:
+				bs.reportMetrics()
+			default:
+			}
+
+			msg := bs.next()
+			if msg == nil {
+				break
+			}
+
+			points, err := DecodePoints(msg)
+			if err != nil {
+				log.Println("Error decoding points: ", err)
+				continue
+			}
+
+			bs.callback(msg.Subject, points)
+		}
+
+		select {
+		case <-bs.chStop:
+			return
+		case <-bs.chNotify:
+		case <-metricsC:
+			bs.reportMetrics()
+		}
+	}
+}
+
+func (bs *BufferedSub) reportMetrics() {
+	s := bs.Stats()
+	now := time.Now()
+	key := bs.sub.Subject
+
+	pts := data.Points{
+		{Time: now, Type: data.PointTypeMetricSubPending, Key: key, Value: float64(s.Pending)},
+		{Time: now, Type: data.PointTypeMetricSubDropped, Key: key, Value: float64(s.Dropped)},
+		{Time: now, Type: data.PointTypeMetricSubSpilled, Key: key, Value: float64(s.Spilled)},
+	}
+
+	err := SendNodePoints(bs.nc, bs.opts.MetricsNodeID, pts, false)
+	if err != nil {
+		log.Println("Error sending buffered sub metrics: ", err)
+	}
+}
+
+// Stats returns current buffer counters
+func (bs *BufferedSub) Stats() BufferStats {
+	bs.lock.Lock()
+	defer bs.lock.Unlock()
+	ret := bs.stats
+	ret.Pending = len(bs.queue) + bs.spillRecs
+	return ret
+}
+
+func (bs *BufferedSub) closeSpill() {
+	if bs.spill != nil {
+		bs.spill.Close()
+		os.Remove(bs.opts.SpillFile)
+	}
+}
+
+// Stop unsubscribes and waits for the callback goroutine to exit. Any queued
+// messages are discarded.
+func (bs *BufferedSub) Stop() {
+	bs.stopOnce.Do(func() {
+		err := bs.sub.Unsubscribe()
+		if err != nil {
+			log.Println("Error unsubscribing buffered sub: ", err)
+		}
+		close(bs.chStop)
+		bs.wg.Wait()
+		bs.lock.Lock()
+		bs.closeSpill()
+		bs.lock.Unlock()
+	})
+}
+
+// SubscribePointsBuffered is like SubscribePoints except messages are queued
+// according to opts so a slow callback can't cause NATS slow consumer errors.
+func SubscribePointsBuffered(nc *nats.Conn, id string, opts BufferOptions,
+	callback func(points []data.Point)) (*BufferedSub, error) {
+	return NewBufferedSub(nc, SubjectNodePoints(id), opts, func(_ string, points data.Points) {
+		callback(points)
+	})
+}
+
+// SubscribeEdgePointsBuffered is like SubscribeEdgePoints except messages are
+// queued according to opts so a slow callback can't cause NATS slow consumer errors.
+func SubscribeEdgePointsBuffered(nc *nats.Conn, id, parent string, opts BufferOptions,
+	callback func(points []data.Point)) (*BufferedSub, error) {
+	return NewBufferedSub(nc, SubjectEdgePoints(id, parent), opts, func(_ string, points data.Points) {
+		callback(points)
+	})
+}
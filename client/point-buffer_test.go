@@ -0,0 +1,106 @@
+package client
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+func testBufMsg(t *testing.T, v float64) *nats.Msg {
+	pts := data.Points{{Type: data.PointTypeValue, Value: v}}
+	d, err := pts.ToPb()
+	if err != nil {
+		t.Fatal("Error encoding points: ", err)
+	}
+	return &nats.Msg{Subject: "node.123.points", Data: d}
+}
+
+func testBufValue(t *testing.T, msg *nats.Msg) float64 {
+	if msg == nil {
+		t.Fatal("expected message, got nil")
+	}
+	pts, err := data.PbDecodePoints(msg.Data)
+	if err != nil {
+		t.Fatal("Error decoding points: ", err)
+	}
+	return pts[0].Value
+}
+
+func TestBufferedSubDropOldest(t *testing.T) {
+	bs := &BufferedSub{
+		opts:     BufferOptions{Size: 2, Policy: BufferDropOldest},
+		chNotify: make(chan struct{}, 1),
+	}
+
+	for i := 0; i < 4; i++ {
+		bs.enqueue(testBufMsg(t, float64(i)))
+	}
+
+	s := bs.Stats()
+	if s.Dropped != 2 || s.Pending != 2 {
+		t.Fatalf("unexpected stats: %+v", s)
+	}
+
+	if v := testBufValue(t, bs.next()); v != 2 {
+		t.Fatal("expected 2, got: ", v)
+	}
+
+	if v := testBufValue(t, bs.next()); v != 3 {
+		t.Fatal("expected 3, got: ", v)
+	}
+
+	if bs.next() != nil {
+		t.Fatal("expected empty buffer")
+	}
+}
+
+func TestBufferedSubSpill(t *testing.T) {
+	spillFile := path.Join(t.TempDir(), "spill")
+
+	// bypass NewBufferedSub so we don't need a NATS connection
+	bs := &BufferedSub{
+		opts: BufferOptions{Size: 2, Policy: BufferSpillToDisk,
+			SpillFile: spillFile, MaxSpillBytes: 1024 * 1024},
+		chNotify: make(chan struct{}, 1),
+	}
+
+	var err error
+	bs.spill, err = os.Create(spillFile)
+	if err != nil {
+		t.Fatal("Error creating spill file: ", err)
+	}
+	defer bs.closeSpill()
+
+	for i := 0; i < 5; i++ {
+		bs.enqueue(testBufMsg(t, float64(i)))
+	}
+
+	s := bs.Stats()
+	if s.Spilled != 3 || s.Pending != 5 || s.Dropped != 0 {
+		t.Fatalf("unexpected stats: %+v", s)
+	}
+
+	// messages must come out in order
+	for i := 0; i < 3; i++ {
+		if v := testBufValue(t, bs.next()); v != float64(i) {
+			t.Fatalf("expected %v, got: %v", i, v)
+		}
+	}
+
+	// once we start reading from the spill file, new messages must
+	// be queued behind the spilled data
+	bs.enqueue(testBufMsg(t, 5))
+
+	for i := 3; i < 6; i++ {
+		if v := testBufValue(t, bs.next()); v != float64(i) {
+			t.Fatalf("expected %v, got: %v", i, v)
+		}
+	}
+
+	if bs.next() != nil {
+		t.Fatal("expected empty buffer")
+	}
+}
@@ -22,8 +22,17 @@ func SendEdgePoint(nc *nats.Conn, nodeID, parentID string, point data.Point, ack
 	return SendEdgePoints(nc, nodeID, parentID, points, ack)
 }
 
-// SendNodePoints sends node points using the nats protocol
+// SendNodePoints sends node points using the nats protocol. Points are
+// signed if a signing key is set (see SetSigningKey).
 func SendNodePoints(nc *nats.Conn, nodeID string, points data.Points, ack bool) error {
+	for i := range points {
+		if points[i].Time.IsZero() {
+			points[i].Time = time.Now()
+		}
+	}
+
+	points = signNodePoints(nodeID, points)
+
 	return SendPoints(nc, SubjectNodePoints(nodeID), points, ack)
 }
 
@@ -35,7 +44,19 @@ func SendEdgePoints(nc *nats.Conn, nodeID, parentID string, points data.Points,
 	return SendPoints(nc, SubjectEdgePoints(nodeID, parentID), points, ack)
 }
 
-// SendPoints sends points to specified subject
+// SendChildEdgePoints sends edge points for a node under parentID. Devices
+// authenticated with credentials or client certificates can only publish
+// edge points for nodes in their subtree, so new child nodes are created
+// with this function. The server writes the points if the node is new or
+// already a child of parentID, and then allows the device to use the
+// subjects of the node.
+func SendChildEdgePoints(nc *nats.Conn, nodeID, parentID string, points data.Points, ack bool) error {
+	return SendPoints(nc, SubjectChildEdgePoints(nodeID, parentID), points, ack)
+}
+
+// SendPoints sends points to specified subject. Points sent without ack
+// are buffered while the connection is down if a ReconnectBuffer is set up
+// for nc.
 func SendPoints(nc *nats.Conn, subject string, points data.Points, ack bool) error {
 	for i := range points {
 		if points[i].Time.IsZero() {
@@ -60,7 +81,7 @@ func SendPoints(nc *nats.Conn, subject string, points data.Points, ack bool) err
 		}
 
 	} else {
-		if err := nc.Publish(subject, data); err != nil {
+		if err := publish(nc, subject, data); err != nil {
 			return err
 		}
 	}
@@ -68,11 +89,55 @@ func SendPoints(nc *nats.Conn, subject string, points data.Points, ack bool) err
 	return err
 }
 
+// HeaderTx is set on point messages the store publishes after a transaction
+// is committed. These points have already been written. The value is an ID
+// of the store, and the store handles messages with any other value like any
+// other points.
+const HeaderTx = "Siot-Tx"
+
+// SendNodePointsTx writes node and edge points for multiple nodes in one
+// store transaction, so either all the points are written or none are. After
+// the transaction is committed, the store publishes the points to the node
+// and edge point subjects.
+func SendNodePointsTx(nc *nats.Conn, writes []data.TxWrite) error {
+	for i := range writes {
+		if writes[i].NodeID == "" {
+			return errors.New("transaction write node ID must be set")
+		}
+
+		if writes[i].Edge && writes[i].ParentID == "" {
+			writes[i].ParentID = "none"
+		}
+
+		for j := range writes[i].Points {
+			if writes[i].Points[j].Time.IsZero() {
+				writes[i].Points[j].Time = time.Now()
+			}
+		}
+	}
+
+	d, err := data.PbEncodeTx(writes)
+	if err != nil {
+		return err
+	}
+
+	msg, err := nc.Request(SubjectPointsTx(), d, time.Second)
+	if err != nil {
+		return err
+	}
+
+	if len(msg.Data) > 0 {
+		return errors.New(string(msg.Data))
+	}
+
+	return nil
+}
+
 // SubscribePoints subscripts to point updates for a node and executes a callback
 // when new points arrive. stop() can be called to clean up the subscription
 func SubscribePoints(nc *nats.Conn, id string, callback func(points []data.Point)) (stop func(), err error) {
 	psub, err := nc.Subscribe(SubjectNodePoints(id), func(msg *nats.Msg) {
-		points, err := data.PbDecodePoints(msg.Data)
+		points, err := DecodePoints(msg)
 		if err != nil {
 			log.Println("Error decoding points: ", err)
 			return
@@ -90,7 +155,7 @@ func SubscribePoints(nc *nats.Conn, id string, callback func(points []data.Point
 // when new points arrive. stop() can be called to clean up the subscription
 func SubscribeEdgePoints(nc *nats.Conn, id, parent string, callback func(points []data.Point)) (stop func(), err error) {
 	psub, err := nc.Subscribe(SubjectEdgePoints(id, parent), func(msg *nats.Msg) {
-		points, err := data.PbDecodePoints(msg.Data)
+		points, err := DecodePoints(msg)
 		if err != nil {
 			log.Println("Error decoding points: ", err)
 			return
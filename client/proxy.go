@@ -0,0 +1,146 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+
+	"golang.org/x/net/proxy"
+)
+
+// ProxyDialer dials connections through a SOCKS5 or HTTP proxy
+type ProxyDialer interface {
+	Dial(network, address string) (net.Conn, error)
+}
+
+// NewProxyDialer returns a dialer that connects through the proxy at
+// proxyURL, which is socks5://[user:pass@]host:port or
+// http://[user:pass@]host:port (HTTP CONNECT). forward is used to connect to
+// the proxy.
+func NewProxyDialer(proxyURL string, forward *net.Dialer) (ProxyDialer, error) {
+	u, err := url.Parse(proxyURL)
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing proxy URL: %w", err)
+	}
+
+	if u.Host == "" {
+		return nil, fmt.Errorf("Proxy URL %v does not have a host", proxyURL)
+	}
+
+	switch u.Scheme {
+	case "socks5", "socks5h":
+		var auth *proxy.Auth
+		if u.User != nil {
+			pass, _ := u.User.Password()
+			auth = &proxy.Auth{User: u.User.Username(), Password: pass}
+		}
+
+		return proxy.SOCKS5("tcp", u.Host, auth, forward)
+	case "http":
+		return &httpConnectDialer{proxy: u, forward: forward}, nil
+	default:
+		return nil, fmt.Errorf("Unsupported proxy scheme: %v", u.Scheme)
+	}
+}
+
+// ProxyTransport returns an HTTP transport that connects through the proxy
+// at proxyURL (see NewProxyDialer)
+func ProxyTransport(proxyURL string) (*http.Transport, error) {
+	u, err := url.Parse(proxyURL)
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing proxy URL: %w", err)
+	}
+
+	t := http.DefaultTransport.(*http.Transport).Clone()
+
+	if u.Scheme == "http" {
+		t.Proxy = http.ProxyURL(u)
+		return t, nil
+	}
+
+	d, err := NewProxyDialer(proxyURL, &net.Dialer{})
+	if err != nil {
+		return nil, err
+	}
+
+	t.Proxy = nil
+	t.DialContext = func(_ context.Context, network, addr string) (net.Conn, error) {
+		return d.Dial(network, addr)
+	}
+
+	return t, nil
+}
+
+// redactProxy returns the proxy URL without the password for logging
+func redactProxy(proxyURL string) string {
+	u, err := url.Parse(proxyURL)
+	if err != nil {
+		return "invalid proxy URL"
+	}
+
+	return u.Redacted()
+}
+
+// httpConnectDialer tunnels connections through an HTTP proxy with the
+// CONNECT method
+type httpConnectDialer struct {
+	proxy   *url.URL
+	forward *net.Dialer
+}
+
+func (d *httpConnectDialer) Dial(network, address string) (net.Conn, error) {
+	conn, err := d.forward.Dial("tcp", d.proxy.Host)
+	if err != nil {
+		return nil, fmt.Errorf("Error connecting to proxy: %w", err)
+	}
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: address},
+		Host:   address,
+		Header: make(http.Header),
+	}
+
+	if d.proxy.User != nil {
+		pass, _ := d.proxy.User.Password()
+		cred := base64.StdEncoding.EncodeToString(
+			[]byte(d.proxy.User.Username() + ":" + pass))
+		req.Header.Set("Proxy-Authorization", "Basic "+cred)
+	}
+
+	err = req.Write(conn)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("Error sending proxy CONNECT: %w", err)
+	}
+
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, req)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("Error reading proxy CONNECT response: %w", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("Proxy CONNECT to %v failed: %v", address, resp.Status)
+	}
+
+	// the server may send data (NATS INFO) right away that is already
+	// buffered in r
+	return &bufferedConn{Conn: conn, r: r}, nil
+}
+
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
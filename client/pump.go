@@ -0,0 +1,475 @@
+package client
+
+import (
+	"log"
+	"sort"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// PumpGroup runs Demand (number of pumps) of its pumps, for example to
+// alternate duty between pumps in a lift station. At the start of each
+// demand cycle, the available pump with the least runtime becomes the lead
+// pump, and additional (lag) pumps are also chosen by runtime. A pump is
+// failed if its feedback is not on for FeedbackTimeout seconds (defaults to
+// 10) while it is on, and another pump is started in its place. Lead (pump
+// Index, 0 if none) and Running (number of pumps running) report the state
+// of the group.
+type PumpGroup struct {
+	ID              string  `node:"id"`
+	Parent          string  `node:"parent"`
+	Description     string  `point:"description"`
+	Demand          int     `point:"demand"`
+	FeedbackTimeout float64 `point:"feedbackTimeout"`
+	Disable         bool    `point:"disable"`
+	Lead            int     `point:"lead"`
+	Running         int     `point:"running"`
+	Pumps           []Pump  `child:"pump"`
+}
+
+// Pump sets the PointType (defaults to value) point of NodeID to run the
+// pump. If FeedbackNodeID is set, the FeedbackPointType (defaults to value)
+// point of that node shows if the pump is running. Runtime is the total
+// hours the pump has run. Failed is set when the feedback is lost and must be
+// cleared to use the pump again.
+type Pump struct {
+	ID                string  `node:"id"`
+	Parent            string  `node:"parent"`
+	Description       string  `point:"description"`
+	Index             int     `point:"index"`
+	NodeID            string  `point:"nodeID"`
+	PointType         string  `point:"pointType"`
+	FeedbackNodeID    string  `point:"feedbackNodeID"`
+	FeedbackPointType string  `point:"feedbackPointType"`
+	Runtime           float64 `point:"runtime"`
+	Failed            bool    `point:"failed"`
+	Disable           bool    `point:"disable"`
+}
+
+func (p Pump) available() bool {
+	return !p.Disable && !p.Failed && p.NodeID != ""
+}
+
+func (p Pump) pointType() string {
+	if p.PointType == "" {
+		return data.PointTypeValue
+	}
+	return p.PointType
+}
+
+func (p Pump) feedbackPointType() string {
+	if p.FeedbackPointType == "" {
+		return data.PointTypeValue
+	}
+	return p.FeedbackPointType
+}
+
+// how often the pump group updates runtimes and checks feedback
+var pumpTickPeriod = time.Second
+
+// pumpState is the state of a pump output and feedback
+type pumpState struct {
+	// on is nil until the output has been set
+	on *bool
+	// last time the pump was turned on or the feedback was on while the
+	// pump was on
+	lastOK   time.Time
+	feedback bool
+	sub      *nats.Subscription
+	// feedback node and point type that sub is subscribed to
+	subNodeID, subPointType string
+}
+
+type pumpFeedback struct {
+	pumpID string
+	on     bool
+}
+
+// PumpGroupClient is a SIOT client that runs pump group nodes
+type PumpGroupClient struct {
+	nc            *nats.Conn
+	config        PumpGroup
+	stop          chan struct{}
+	newPoints     chan NewPoints
+	newEdgePoints chan NewPoints
+	newFeedback   chan pumpFeedback
+	// state by pump ID
+	pumps map[string]*pumpState
+	// leadID is the lead pump for the current demand cycle, blank if there
+	// is no demand
+	leadID   string
+	lastTick time.Time
+}
+
+// NewPumpGroupClient ...
+func NewPumpGroupClient(nc *nats.Conn, config PumpGroup) Client {
+	return &PumpGroupClient{
+		nc:            nc,
+		config:        config,
+		stop:          make(chan struct{}),
+		newPoints:     make(chan NewPoints),
+		newEdgePoints: make(chan NewPoints),
+		newFeedback:   make(chan pumpFeedback),
+		pumps:         make(map[string]*pumpState),
+	}
+}
+
+// Start runs the main logic for this client and blocks until stopped
+func (pg *PumpGroupClient) Start() error {
+	log.Println("Starting pump group client: ", pg.config.Description)
+
+	// keep the lead pump if the client restarts during a demand cycle
+	for _, p := range pg.config.Pumps {
+		if p.Index == pg.config.Lead && pg.config.Demand > 0 {
+			pg.leadID = p.ID
+		}
+	}
+
+	pg.subscribeFeedback()
+
+	ticker := time.NewTicker(pumpTickPeriod)
+	defer ticker.Stop()
+
+	pg.lastTick = time.Now()
+	pg.update(pg.lastTick)
+
+done:
+	for {
+		select {
+		case <-pg.stop:
+			log.Println("Stopping pump group client: ", pg.config.Description)
+			break done
+		case now := <-ticker.C:
+			pg.tick(now)
+		case fb := <-pg.newFeedback:
+			if ps, ok := pg.pumps[fb.pumpID]; ok {
+				ps.feedback = fb.on
+				pg.update(time.Now())
+			}
+		case pts := <-pg.newPoints:
+			err := data.MergePoints(pts.ID, pts.Points, &pg.config)
+			if err != nil {
+				log.Println("error merging new points: ", err)
+			}
+
+			if pts.ID != pg.config.ID {
+				// pump config changed
+				pg.subscribeFeedback()
+			}
+
+			pg.update(time.Now())
+		case pts := <-pg.newEdgePoints:
+			err := data.MergeEdgePoints(pts.ID, pts.Parent, pts.Points, &pg.config)
+			if err != nil {
+				log.Println("error merging new points: ", err)
+			}
+		}
+	}
+
+	// the outputs are left alone so that pumps don't cycle when the client
+	// restarts
+	for _, ps := range pg.pumps {
+		if ps.sub != nil {
+			ps.sub.Unsubscribe()
+		}
+	}
+
+	return nil
+}
+
+// byRuntime returns the available pumps sorted by runtime and then index
+func (pg *PumpGroupClient) byRuntime() []Pump {
+	var ret []Pump
+	for _, p := range pg.config.Pumps {
+		if p.available() {
+			ret = append(ret, p)
+		}
+	}
+
+	sort.SliceStable(ret, func(i, j int) bool {
+		if ret[i].Runtime != ret[j].Runtime {
+			return ret[i].Runtime < ret[j].Runtime
+		}
+		return ret[i].Index < ret[j].Index
+	})
+
+	return ret
+}
+
+// isOn returns true if the pump output is on
+func (pg *PumpGroupClient) isOn(p Pump) bool {
+	ps, ok := pg.pumps[p.ID]
+	return ok && ps.on != nil && *ps.on
+}
+
+// running returns true if the pump is running. Pumps without feedback are
+// running while they are on.
+func (pg *PumpGroupClient) running(p Pump) bool {
+	if !pg.isOn(p) {
+		return false
+	}
+
+	return p.FeedbackNodeID == "" || pg.pumps[p.ID].feedback
+}
+
+// tick adds runtime to running pumps and checks for failed pumps
+func (pg *PumpGroupClient) tick(now time.Time) {
+	elapsed := now.Sub(pg.lastTick)
+	pg.lastTick = now
+
+	timeout := time.Duration(pg.config.FeedbackTimeout * float64(time.Second))
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+
+	failed := false
+
+	for i := range pg.config.Pumps {
+		p := &pg.config.Pumps[i]
+		ps, ok := pg.pumps[p.ID]
+		if !ok || ps.on == nil || !*ps.on {
+			continue
+		}
+
+		if pg.running(*p) {
+			ps.lastOK = now
+			p.Runtime += elapsed.Hours()
+			pg.sendPumpPoint(*p, data.Point{Type: data.PointTypeRuntime,
+				Value: p.Runtime})
+			continue
+		}
+
+		if now.Sub(ps.lastOK) >= timeout && !p.Failed {
+			log.Printf("Pump group %v: pump %v failed, no feedback\n",
+				pg.config.Description, p.Description)
+			p.Failed = true
+			pg.sendPumpPoint(*p, data.Point{Type: data.PointTypeFailed, Value: 1})
+			failed = true
+		}
+	}
+
+	if failed {
+		pg.update(now)
+	}
+}
+
+// update chooses the pumps to run, sets the outputs, and sends the group
+// state
+func (pg *PumpGroupClient) update(now time.Time) {
+	avail := pg.byRuntime()
+
+	demand := pg.config.Demand
+	if pg.config.Disable || demand < 0 {
+		demand = 0
+	}
+	if demand > len(avail) {
+		demand = len(avail)
+	}
+
+	var run []Pump
+	lead := 0
+
+	if demand <= 0 {
+		// the next cycle starts with the pump with the least runtime
+		pg.leadID = ""
+		if len(avail) > 0 {
+			lead = avail[0].Index
+		}
+	} else {
+		leadOk := false
+		for _, p := range avail {
+			if p.ID == pg.leadID {
+				leadOk = true
+				run = append(run, p)
+				lead = p.Index
+			}
+		}
+
+		if !leadOk {
+			pg.leadID = avail[0].ID
+			lead = avail[0].Index
+			run = append(run, avail[0])
+		}
+
+		// lag pumps that are already on keep running so that pumps don't
+		// swap as their runtimes change
+		for _, keep := range []bool{true, false} {
+			for _, p := range avail {
+				if len(run) >= demand {
+					break
+				}
+				if p.ID != pg.leadID && pg.isOn(p) == keep {
+					run = append(run, p)
+				}
+			}
+		}
+	}
+
+	on := make(map[string]bool)
+	for _, p := range run {
+		on[p.ID] = true
+	}
+
+	running := 0
+
+	for _, p := range pg.config.Pumps {
+		pg.setOutput(p, on[p.ID], now)
+		if pg.running(p) {
+			running++
+		}
+	}
+
+	var points data.Points
+	if lead != pg.config.Lead {
+		pg.config.Lead = lead
+		points = append(points, data.Point{Type: data.PointTypeLead, Value: float64(lead)})
+	}
+
+	if running != pg.config.Running {
+		pg.config.Running = running
+		points = append(points, data.Point{Type: data.PointTypeRunning, Value: float64(running)})
+	}
+
+	for i := range points {
+		points[i].Time = now
+	}
+
+	if len(points) > 0 {
+		err := SendNodePoints(pg.nc, pg.config.ID, points, false)
+		if err != nil {
+			log.Println("Pump group: error sending state: ", err)
+		}
+	}
+}
+
+// setOutput turns a pump on or off if it is not already
+func (pg *PumpGroupClient) setOutput(p Pump, on bool, now time.Time) {
+	ps, ok := pg.pumps[p.ID]
+	if !ok {
+		ps = &pumpState{}
+		pg.pumps[p.ID] = ps
+	}
+
+	if p.NodeID == "" || (ps.on != nil && *ps.on == on) {
+		return
+	}
+
+	err := SendNodePoint(pg.nc, p.NodeID, data.Point{
+		Time:   now,
+		Type:   p.pointType(),
+		Value:  data.BoolToFloat(on),
+		Origin: pg.config.ID,
+	}, true)
+	if err != nil {
+		log.Printf("Pump group %v: error setting pump %v: %v\n",
+			pg.config.Description, p.Description, err)
+		return
+	}
+
+	ps.on = &on
+	ps.lastOK = now
+}
+
+func (pg *PumpGroupClient) sendPumpPoint(p Pump, pt data.Point) {
+	pt.Time = time.Now()
+	err := SendNodePoint(pg.nc, p.ID, pt, false)
+	if err != nil {
+		log.Println("Pump group: error sending pump point: ", err)
+	}
+}
+
+// subscribeFeedback subscribes to the feedback points of pumps that have
+// feedback configured and removes the state of pumps that were removed
+func (pg *PumpGroupClient) subscribeFeedback() {
+	pumps := make(map[string]Pump)
+	for _, p := range pg.config.Pumps {
+		pumps[p.ID] = p
+	}
+
+	for id, ps := range pg.pumps {
+		p, ok := pumps[id]
+		if ok && p.FeedbackNodeID == ps.subNodeID && p.feedbackPointType() == ps.subPointType {
+			continue
+		}
+
+		if ps.sub != nil {
+			ps.sub.Unsubscribe()
+			ps.sub = nil
+		}
+		ps.subNodeID = ""
+		ps.feedback = false
+
+		if !ok {
+			delete(pg.pumps, id)
+		}
+	}
+
+	for _, p := range pg.config.Pumps {
+		ps, ok := pg.pumps[p.ID]
+		if !ok {
+			ps = &pumpState{}
+			pg.pumps[p.ID] = ps
+		}
+
+		if p.FeedbackNodeID == "" || ps.sub != nil {
+			continue
+		}
+
+		ps.subNodeID = p.FeedbackNodeID
+		ps.subPointType = p.feedbackPointType()
+
+		pumpID, pointType := p.ID, ps.subPointType
+
+		var err error
+		ps.sub, err = pg.nc.Subscribe(SubjectNodePoints(p.FeedbackNodeID), func(msg *nats.Msg) {
+			points, err := DecodePoints(msg)
+			if err != nil {
+				log.Println("Pump group: error decoding feedback points: ", err)
+				return
+			}
+
+			for _, pt := range points {
+				if pt.Type == pointType {
+					select {
+					case pg.newFeedback <- pumpFeedback{pumpID: pumpID, on: pt.Value != 0}:
+					case <-pg.stop:
+					}
+				}
+			}
+		})
+		if err != nil {
+			log.Printf("Pump group %v: error subscribing to pump %v feedback: %v\n",
+				pg.config.Description, p.Description, err)
+			continue
+		}
+
+		nodes, err := GetNode(pg.nc, p.FeedbackNodeID, "none")
+		if err != nil || len(nodes) < 1 {
+			log.Printf("Pump group %v: error getting pump %v feedback: %v\n",
+				pg.config.Description, p.Description, err)
+			continue
+		}
+
+		v, _ := nodes[0].Points.Value(pointType, "")
+		ps.feedback = v != 0
+	}
+}
+
+// Stop sends a signal to the Start function to exit
+func (pg *PumpGroupClient) Stop(err error) {
+	close(pg.stop)
+}
+
+// Points is called by the Manager when new points for this
+// node are received.
+func (pg *PumpGroupClient) Points(nodeID string, points []data.Point) {
+	pg.newPoints <- NewPoints{nodeID, "", points}
+}
+
+// EdgePoints is called by the Manager when new edge points for this
+// node are received.
+func (pg *PumpGroupClient) EdgePoints(nodeID, parentID string, points []data.Point) {
+	pg.newEdgePoints <- NewPoints{nodeID, parentID, points}
+}
@@ -0,0 +1,99 @@
+package client_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+	"github.com/simpleiot/simpleiot/server"
+)
+
+func TestPumpGroup(t *testing.T) {
+	nc, root, stop, err := server.TestServer()
+	if err != nil {
+		t.Fatal("Error starting test server: ", err)
+	}
+	defer stop()
+
+	for _, id := range []string{"out1", "out2", "fb1", "fb2"} {
+		err = client.SendNodeType(nc, client.Variable{ID: id, Parent: root.ID}, "test")
+		if err != nil {
+			t.Fatal("Error sending variable node: ", err)
+		}
+	}
+
+	err = client.SendNodeType(nc, client.PumpGroup{
+		ID:              "pg",
+		Parent:          root.ID,
+		Description:     "lift station",
+		FeedbackTimeout: 1,
+	}, "test")
+	if err != nil {
+		t.Fatal("Error sending pump group node: ", err)
+	}
+
+	pumps := []client.Pump{
+		{ID: "pump1", Parent: "pg", Description: "pump 1", Index: 1, NodeID: "out1", FeedbackNodeID: "fb1",
+			Runtime: 5},
+		{ID: "pump2", Parent: "pg", Description: "pump 2", Index: 2, NodeID: "out2", FeedbackNodeID: "fb2",
+			Runtime: 1},
+	}
+
+	for _, p := range pumps {
+		err = client.SendNodeType(nc, p, "test")
+		if err != nil {
+			t.Fatal("Error sending pump node: ", err)
+		}
+	}
+
+	sendPoint := func(id, typ string, v float64) {
+		t.Helper()
+		err := client.SendNodePoint(nc, id, data.Point{Type: typ, Value: v,
+			Origin: "test"}, true)
+		if err != nil {
+			t.Fatal("Error sending point: ", err)
+		}
+	}
+
+	// the pump with the least runtime is the next lead pump
+	waitPointValue(t, nc, "pg", data.PointTypeLead, 2)
+
+	sendPoint("pg", data.PointTypeDemand, 1)
+	waitPointValue(t, nc, "out2", data.PointTypeValue, 1)
+	waitPointValue(t, nc, "out1", data.PointTypeValue, 0)
+
+	sendPoint("fb2", data.PointTypeValue, 1)
+	waitPointValue(t, nc, "pg", data.PointTypeRunning, 1)
+
+	// run long enough for the runtime to be updated
+	time.Sleep(1500 * time.Millisecond)
+
+	// losing feedback fails the lead pump and starts the other pump
+	sendPoint("fb2", data.PointTypeValue, 0)
+	waitPointValue(t, nc, "pump2", data.PointTypeFailed, 1)
+	waitPointValue(t, nc, "out2", data.PointTypeValue, 0)
+	waitPointValue(t, nc, "out1", data.PointTypeValue, 1)
+	sendPoint("fb1", data.PointTypeValue, 1)
+	waitPointValue(t, nc, "pg", data.PointTypeLead, 1)
+
+	nodes, err := client.GetNode(nc, "pump2", "none")
+	if err != nil || len(nodes) < 1 {
+		t.Fatal("Error getting pump: ", err)
+	}
+
+	runtime, _ := nodes[0].Points.Value(data.PointTypeRuntime, "")
+	if runtime <= 1 {
+		t.Error("Runtime not updated: ", runtime)
+	}
+
+	// both pumps run when demand is 2 and pump2 is cleared
+	sendPoint("pump2", data.PointTypeFailed, 0)
+	sendPoint("pg", data.PointTypeDemand, 2)
+	waitPointValue(t, nc, "out2", data.PointTypeValue, 1)
+	waitPointValue(t, nc, "pg", data.PointTypeLead, 1)
+
+	sendPoint("pg", data.PointTypeDemand, 0)
+	waitPointValue(t, nc, "out1", data.PointTypeValue, 0)
+	waitPointValue(t, nc, "out2", data.PointTypeValue, 0)
+}
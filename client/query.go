@@ -0,0 +1,38 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// Query selects nodes below Parent (the root node if blank). Type limits
+// the results to a node type, Depth to the number of levels below Parent (0
+// for all levels), and Where is a point filter expression (see
+// data.ParseNodeFilter). Deleted and archived nodes are not returned.
+type Query struct {
+	Parent string `json:"parent,omitempty"`
+	Type   string `json:"type,omitempty"`
+	Depth  int    `json:"depth,omitempty"`
+	Where  string `json:"where,omitempty"`
+}
+
+// QueryNodes returns the nodes that match q, so clients can find nodes
+// without fetching the entire tree. The Parent of each node is the node it
+// was found under. A node with more than one parent is only returned once.
+func QueryNodes(nc *nats.Conn, q Query) ([]data.NodeEdge, error) {
+	req, err := json.Marshal(q)
+	if err != nil {
+		return nil, err
+	}
+
+	msg, err := nc.Request(SubjectQueryNodes(), req, time.Second*20)
+	if err != nil {
+		return nil, fmt.Errorf("Error querying nodes: %w", err)
+	}
+
+	return data.PbDecodeNodesRequest(msg.Data)
+}
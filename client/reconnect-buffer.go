@@ -0,0 +1,280 @@
+package client
+
+import (
+	"encoding/binary"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// ReconnectBufferOptions is used to configure a ReconnectBuffer
+type ReconnectBufferOptions struct {
+	// Dir is the directory messages are stored in. If blank, messages are
+	// kept in memory.
+	Dir string
+	// MaxBytes limits the size of the buffer, defaults to 50MB. The oldest
+	// messages are dropped when this limit is reached.
+	MaxBytes int64
+	// MaxAge, if set, drops messages that are older when they are sent
+	MaxAge time.Duration
+	// MetricsNodeID, if set, is the node buffer metrics are reported to
+	// (see SetMetricsNodeID)
+	MetricsNodeID string
+	// MetricsPeriod defaults to 1m
+	MetricsPeriod time.Duration
+}
+
+// ReconnectBufferStats contains counters for a reconnect buffer
+type ReconnectBufferStats struct {
+	Pending int
+	Bytes   int64
+	Dropped int
+	Sent    int
+}
+
+// ReconnectBuffer stores points published with SendPoints (without ack)
+// while the NATS connection is down, and sends them in order once it is
+// reconnected. This replaces the NATS client reconnect buffer, which is
+// limited to memory and returns errors once it is full, so bursts of points
+// during NATS restarts are not lost. Requests are not buffered.
+type ReconnectBuffer struct {
+	nc   *nats.Conn
+	opts ReconnectBufferOptions
+
+	lock    sync.Mutex
+	spool   *spool
+	stats   ReconnectBufferStats
+	metrics string
+
+	chNotify chan struct{}
+	chStop   chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+var reconnectBuffers = struct {
+	lock    sync.RWMutex
+	buffers map[*nats.Conn]*ReconnectBuffer
+}{buffers: make(map[*nats.Conn]*ReconnectBuffer)}
+
+// NewReconnectBuffer creates a reconnect buffer for nc. Messages left in
+// opts.Dir from a previous run are sent once nc is connected. Stop must be
+// called when the buffer is no longer used.
+func NewReconnectBuffer(nc *nats.Conn, opts ReconnectBufferOptions) (*ReconnectBuffer, error) {
+	if opts.MaxBytes <= 0 {
+		opts.MaxBytes = 50 * 1024 * 1024
+	}
+
+	if opts.MetricsPeriod <= 0 {
+		opts.MetricsPeriod = time.Minute
+	}
+
+	s, err := newSpool(opts.Dir, opts.MaxBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	rb := &ReconnectBuffer{
+		nc:       nc,
+		opts:     opts,
+		spool:    s,
+		metrics:  opts.MetricsNodeID,
+		chNotify: make(chan struct{}, 1),
+		chStop:   make(chan struct{}),
+	}
+
+	reconnectBuffers.lock.Lock()
+	reconnectBuffers.buffers[nc] = rb
+	reconnectBuffers.lock.Unlock()
+
+	rb.wg.Add(1)
+	go rb.run()
+
+	return rb, nil
+}
+
+// publish sends a message with the reconnect buffer of nc if there is one
+func publish(nc *nats.Conn, subject string, d []byte) error {
+	reconnectBuffers.lock.RLock()
+	rb := reconnectBuffers.buffers[nc]
+	reconnectBuffers.lock.RUnlock()
+
+	if rb == nil {
+		return nc.Publish(subject, d)
+	}
+
+	return rb.publish(subject, d)
+}
+
+func (rb *ReconnectBuffer) publish(subject string, d []byte) error {
+	rb.lock.Lock()
+	defer rb.lock.Unlock()
+
+	// once messages are buffered, new messages are buffered too until the
+	// buffer is empty so that they are sent in order
+	if rb.spool.len() <= 0 && rb.nc.IsConnected() {
+		err := rb.nc.Publish(subject, d)
+		if !errors.Is(err, nats.ErrReconnectBufExceeded) {
+			return err
+		}
+	}
+
+	dropped, err := rb.spool.push("msg", 1, encodeBufferedMsg(subject, d))
+	rb.stats.Dropped += dropped
+	if err != nil {
+		return err
+	}
+
+	select {
+	case rb.chNotify <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// messages are stored as the subject length, subject, and message data
+func encodeBufferedMsg(subject string, d []byte) []byte {
+	l := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(l, uint64(len(subject)))
+	ret := append(l[:n], subject...)
+	return append(ret, d...)
+}
+
+func decodeBufferedMsg(d []byte) (string, []byte, error) {
+	l, n := binary.Uvarint(d)
+	if n <= 0 || uint64(len(d)-n) < l {
+		return "", nil, errors.New("invalid buffered message")
+	}
+
+	return string(d[n : n+int(l)]), d[n+int(l):], nil
+}
+
+// flush sends buffered messages until the buffer is empty or the
+// connection is lost
+func (rb *ReconnectBuffer) flush() {
+	rb.lock.Lock()
+	defer rb.lock.Unlock()
+
+	for rb.spool.len() > 0 && rb.nc.IsConnected() {
+		e, err := rb.spool.peek()
+		if err == nil {
+			if rb.opts.MaxAge > 0 && time.Since(e.time()) > rb.opts.MaxAge {
+				rb.stats.Dropped++
+			} else {
+				var subject string
+				var d []byte
+				subject, d, err = decodeBufferedMsg(e.data)
+				if err == nil {
+					err = rb.nc.Publish(subject, d)
+					if err != nil {
+						// try again after reconnecting
+						return
+					}
+					rb.stats.Sent++
+				}
+			}
+		}
+
+		if err != nil {
+			log.Println("Error reading reconnect buffer, dropping message: ", err)
+			rb.stats.Dropped++
+		}
+
+		err = rb.spool.pop()
+		if err != nil {
+			log.Println("Error removing reconnect buffer message: ", err)
+			return
+		}
+	}
+}
+
+func (rb *ReconnectBuffer) run() {
+	defer rb.wg.Done()
+
+	// the connection state is checked periodically as the NATS connection
+	// only has one reconnect handler, which the owner of the connection sets
+	checkTicker := time.NewTicker(250 * time.Millisecond)
+	defer checkTicker.Stop()
+
+	metricsTicker := time.NewTicker(rb.opts.MetricsPeriod)
+	defer metricsTicker.Stop()
+
+	for {
+		select {
+		case <-rb.chStop:
+			return
+		case <-rb.chNotify:
+			rb.flush()
+		case <-checkTicker.C:
+			rb.flush()
+		case <-metricsTicker.C:
+			rb.reportMetrics()
+		}
+	}
+}
+
+func (rb *ReconnectBuffer) reportMetrics() {
+	rb.lock.Lock()
+	nodeID := rb.metrics
+	rb.lock.Unlock()
+
+	if nodeID == "" {
+		return
+	}
+
+	s := rb.Stats()
+	now := time.Now()
+
+	pts := data.Points{
+		{Time: now, Type: data.PointTypeMetricNatsBufPending, Value: float64(s.Pending)},
+		{Time: now, Type: data.PointTypeMetricNatsBufBytes, Value: float64(s.Bytes)},
+		{Time: now, Type: data.PointTypeMetricNatsBufDropped, Value: float64(s.Dropped)},
+	}
+
+	err := SendNodePoints(rb.nc, nodeID, pts, false)
+	if err != nil {
+		log.Println("Error sending reconnect buffer metrics: ", err)
+	}
+}
+
+// SetMetricsNodeID sets the node metrics are reported to, typically the root
+// node once it is known
+func (rb *ReconnectBuffer) SetMetricsNodeID(id string) {
+	rb.lock.Lock()
+	defer rb.lock.Unlock()
+	rb.metrics = id
+}
+
+// Stats returns current buffer counters
+func (rb *ReconnectBuffer) Stats() ReconnectBufferStats {
+	rb.lock.Lock()
+	defer rb.lock.Unlock()
+	ret := rb.stats
+	ret.Pending = rb.spool.len()
+	ret.Bytes = rb.spool.size
+	return ret
+}
+
+// Stop stops buffering messages for the connection. Messages that were not
+// sent are kept in Dir and sent by the next buffer created for it.
+func (rb *ReconnectBuffer) Stop() {
+	rb.stopOnce.Do(func() {
+		reconnectBuffers.lock.Lock()
+		if reconnectBuffers.buffers[rb.nc] == rb {
+			delete(reconnectBuffers.buffers, rb.nc)
+		}
+		reconnectBuffers.lock.Unlock()
+
+		close(rb.chStop)
+		rb.wg.Wait()
+
+		if n := rb.spool.len(); n > 0 && rb.opts.Dir == "" {
+			log.Printf("Reconnect buffer stopped, %v messages were not sent\n", n)
+		}
+	})
+}
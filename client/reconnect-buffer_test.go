@@ -0,0 +1,162 @@
+package client_test
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	natsserver "github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+func TestReconnectBuffer(t *testing.T) {
+	port := freePort(t)
+
+	startNats := func() *natsserver.Server {
+		t.Helper()
+		ns, err := natsserver.NewServer(&natsserver.Options{
+			Host:   "127.0.0.1",
+			Port:   port,
+			NoSigs: true,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		go ns.Start()
+
+		if !ns.ReadyForConnections(5 * time.Second) {
+			t.Fatal("NATS server not ready")
+		}
+
+		return ns
+	}
+
+	ns := startNats()
+
+	nc, err := nats.Connect(ns.ClientURL(),
+		nats.MaxReconnects(-1),
+		nats.ReconnectWait(50*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+
+	rb, err := client.NewReconnectBuffer(nc, client.ReconnectBufferOptions{
+		Dir: t.TempDir(),
+	})
+	if err != nil {
+		t.Fatal("Error creating reconnect buffer: ", err)
+	}
+	defer rb.Stop()
+
+	// subscriptions are restored when the connection reconnects
+	received := make(chan float64, 100)
+	_, err = client.SubscribePoints(nc, "123", func(points []data.Point) {
+		for _, p := range points {
+			received <- p.Value
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	nc.Flush()
+
+	ns.Shutdown()
+
+	start := time.Now()
+	for nc.IsConnected() {
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("Connection did not close")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	const count = 20
+
+	for i := 0; i < count; i++ {
+		err := client.SendNodePoint(nc, "123", data.Point{
+			Type: data.PointTypeValue, Value: float64(i)}, false)
+		if err != nil {
+			t.Fatal("Error sending point: ", err)
+		}
+	}
+
+	if s := rb.Stats(); s.Pending != count {
+		t.Fatalf("Expected %v pending messages, got %+v", count, s)
+	}
+
+	ns = startNats()
+	defer ns.Shutdown()
+
+	for i := 0; i < count; i++ {
+		select {
+		case v := <-received:
+			if v != float64(i) {
+				t.Fatalf("Expected value %v, got %v", i, v)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timeout waiting for buffered points")
+		}
+	}
+
+	if s := rb.Stats(); s.Pending != 0 || s.Sent != count {
+		t.Fatalf("Unexpected stats after reconnect: %+v", s)
+	}
+}
+
+func TestReconnectBufferMaxAge(t *testing.T) {
+	port := freePort(t)
+
+	nc, err := nats.Connect("nats://127.0.0.1:"+strconv.Itoa(port),
+		nats.RetryOnFailedConnect(true),
+		nats.MaxReconnects(-1),
+		nats.ReconnectWait(50*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+
+	rb, err := client.NewReconnectBuffer(nc, client.ReconnectBufferOptions{
+		MaxAge: 50 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal("Error creating reconnect buffer: ", err)
+	}
+	defer rb.Stop()
+
+	err = client.SendNodePoint(nc, "123", data.Point{Type: data.PointTypeValue}, false)
+	if err != nil {
+		t.Fatal("Error sending point: ", err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	ns, err := natsserver.NewServer(&natsserver.Options{
+		Host:   "127.0.0.1",
+		Port:   port,
+		NoSigs: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go ns.Start()
+	defer ns.Shutdown()
+
+	start := time.Now()
+	for {
+		s := rb.Stats()
+		if s.Pending == 0 {
+			if s.Dropped != 1 || s.Sent != 0 {
+				t.Fatalf("Expected old message to be dropped, got %+v", s)
+			}
+			break
+		}
+
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("Timeout waiting for buffer to be flushed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
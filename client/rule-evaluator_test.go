@@ -0,0 +1,54 @@
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/simpleiot/simpleiot/data"
+)
+
+func TestRuleEvaluate(t *testing.T) {
+	now := time.Now()
+	stale := now.Add(-2 * ruleLeaseTimeout)
+
+	tests := []struct {
+		desc      string
+		runOn     string
+		evaluator string
+		edge      bool
+		lease     time.Time
+		exp       bool
+	}{
+		{"no designation", "", "", false, now, true},
+		{"no lease", data.PointValueEdge, "", false, now, true},
+		{"edge only on edge", data.PointValueEdge, data.PointValueEdge, true, now, true},
+		{"edge only upstream", data.PointValueEdge, data.PointValueEdge, false, stale, false},
+		{"upstream only on edge", data.PointValueUpstream, data.PointValueUpstream, true, now, false},
+		{"upstream only upstream", data.PointValueUpstream, data.PointValueUpstream, false, now, true},
+		{"edge preferred upstream", data.PointValueEdgePreferred, data.PointValueEdge, false, now, false},
+		{"edge preferred upstream, edge offline", data.PointValueEdgePreferred, data.PointValueEdge, false, stale, true},
+		{"upstream preferred, connected, edge", data.PointValueUpstreamPreferred, data.PointValueUpstream, true, now, false},
+		{"upstream preferred, connected, upstream", data.PointValueUpstreamPreferred, data.PointValueUpstream, false, now, true},
+		{"upstream preferred, offline, edge", data.PointValueUpstreamPreferred, data.PointValueEdge, true, now, true},
+	}
+
+	for _, test := range tests {
+		rc := &RuleClient{
+			rootID:    "local",
+			leaseTime: test.lease,
+			config: Rule{
+				RunOn:         test.runOn,
+				Evaluator:     test.evaluator,
+				EvaluatorEdge: "remote",
+			},
+		}
+
+		if test.edge {
+			rc.config.EvaluatorEdge = "local"
+		}
+
+		if rc.evaluate(now) != test.exp {
+			t.Errorf("%v: expected %v", test.desc, test.exp)
+		}
+	}
+}
@@ -23,6 +23,11 @@ type Rule struct {
 	Description     string      `point:"description"`
 	Disable         bool        `point:"disable"`
 	Active          bool        `point:"active"`
+	Severity        string      `point:"severity"`
+	Priority        int         `point:"priority"`
+	RunOn           string      `point:"runOn"`
+	Evaluator       string      `point:"evaluator"`
+	EvaluatorEdge   string      `point:"evaluatorEdge"`
 	Conditions      []Condition `child:"condition"`
 	Actions         []Action    `child:"action"`
 	ActionsInactive []Action    `child:"actionInactive"`
@@ -31,6 +36,12 @@ type Rule struct {
 func (r Rule) String() string {
 	ret := fmt.Sprintf("Rule: %v\n", r.Description)
 	ret += fmt.Sprintf("  active: %v\n", r.Active)
+	if r.Severity != "" || r.Priority != 0 {
+		ret += fmt.Sprintf("  severity: %v, priority: %v\n", r.Severity, r.EffectivePriority())
+	}
+	if r.RunOn != "" {
+		ret += fmt.Sprintf("  run on: %v, evaluator: %v\n", r.RunOn, r.Evaluator)
+	}
 	for _, c := range r.Conditions {
 		ret += fmt.Sprintf("%v", c)
 	}
@@ -45,6 +56,15 @@ func (r Rule) String() string {
 	return ret
 }
 
+// EffectivePriority returns the rule priority. If priority is not set, it
+// is derived from the severity.
+func (r Rule) EffectivePriority() int {
+	if r.Priority > 0 {
+		return r.Priority
+	}
+	return data.SeverityPriority(r.Severity)
+}
+
 // Condition defines parameters to look for in a point or a schedule.
 type Condition struct {
 	// general parameters
@@ -172,9 +192,20 @@ type RuleClient struct {
 	newPoints     chan NewPoints
 	newEdgePoints chan NewPoints
 	newRulePoints chan NewPoints
+	newHeartbeat  chan string
 	upSub         *nats.Subscription
+	heartbeatSub  *nats.Subscription
+	rootID        string
+	leaseTime     time.Time
+	// time zone of schedule conditions
+	loc *time.Location
 }
 
+// ruleLeaseTimeout is how long the evaluator lease written by the edge
+// sync layer is valid after the last heartbeat of the edge. The edge sends a
+// heartbeat to the upstream every sync cycle.
+var ruleLeaseTimeout = 30 * time.Second
+
 // NewRuleClient ...
 func NewRuleClient(nc *nats.Conn, config Rule) Client {
 	return &RuleClient{
@@ -184,6 +215,10 @@ func NewRuleClient(nc *nats.Conn, config Rule) Client {
 		newPoints:     make(chan NewPoints),
 		newEdgePoints: make(chan NewPoints),
 		newRulePoints: make(chan NewPoints),
+		newHeartbeat:  make(chan string),
+		// we don't know when the lease in the initial config was
+		// written, so assume it is current
+		leaseTime: time.Now(),
 	}
 }
 
@@ -194,9 +229,22 @@ func (rc *RuleClient) Start() error {
 	// that are in the conditions
 	subject := fmt.Sprintf("up.%v.*.points", rc.config.Parent)
 
-	var err error
+	rootNodes, err := GetNode(rc.nc, "root", "")
+	if err != nil {
+		return fmt.Errorf("Rule error getting root node: %v", err)
+	}
+
+	if len(rootNodes) > 0 {
+		rc.rootID = rootNodes[0].ID
+	}
+
+	rc.loc, err = NodeLocation(rc.nc, rc.config.ID)
+	if err != nil {
+		log.Printf("Rule %v: %v\n", rc.config.Description, err)
+	}
+
 	rc.upSub, err = rc.nc.Subscribe(subject, func(msg *nats.Msg) {
-		points, err := data.PbDecodePoints(msg.Data)
+		points, err := DecodePoints(msg)
 		if err != nil {
 			log.Println("Error decoding points in rule upSub: ", err)
 			return
@@ -216,12 +264,34 @@ func (rc *RuleClient) Start() error {
 		return fmt.Errorf("Rule error subscribing to upsub: %v", err)
 	}
 
+	// heartbeats of edge instances renew the evaluator lease
+	rc.heartbeatSub, err = rc.nc.Subscribe(SubjectInstanceHeartbeat("*"), func(msg *nats.Msg) {
+		chunks := strings.Split(msg.Subject, ".")
+		if len(chunks) != 3 {
+			return
+		}
+
+		select {
+		case rc.newHeartbeat <- chunks[1]:
+		case <-rc.stop:
+		}
+	})
+
+	if err != nil {
+		rc.upSub.Unsubscribe()
+		return fmt.Errorf("Rule error subscribing to heartbeats: %v", err)
+	}
+
 done:
 	for {
 		select {
 		case <-rc.stop:
 			break done
 		case pts := <-rc.newRulePoints:
+			if !rc.evaluate(time.Now()) {
+				continue
+			}
+
 			active, changed, err := rc.ruleProcessPoints(pts.ID, pts.Points)
 
 			if err != nil {
@@ -259,15 +329,28 @@ done:
 			if err != nil {
 				log.Println("error merging rule points: ", err)
 			}
+
+			if pts.ID == rc.config.ID {
+				for _, p := range pts.Points {
+					if p.Type == data.PointTypeEvaluator && p.Time.After(rc.leaseTime) {
+						rc.leaseTime = p.Time
+					}
+				}
+			}
 		case pts := <-rc.newEdgePoints:
 			err := data.MergeEdgePoints(pts.ID, pts.Parent, pts.Points, &rc.config)
 			if err != nil {
 				log.Println("error merging rule edge points: ", err)
 			}
+		case edge := <-rc.newHeartbeat:
+			if edge == rc.config.EvaluatorEdge {
+				rc.leaseTime = time.Now()
+			}
 		}
 	}
 
 	rc.upSub.Unsubscribe()
+	rc.heartbeatSub.Unsubscribe()
 
 	return nil
 }
@@ -289,6 +372,33 @@ func (rc *RuleClient) EdgePoints(nodeID, parentID string, points []data.Point) {
 	rc.newEdgePoints <- NewPoints{nodeID, parentID, points}
 }
 
+// evaluate returns true if this instance should evaluate the rule. Rules
+// without a runOn designation run on every instance. Otherwise, the edge
+// sync layer decides which side evaluates the rule and writes an evaluator
+// lease to the rule node. If the lease is stale, the edge is not reachable
+// and the upstream side takes over, unless the rule is edge only.
+func (rc *RuleClient) evaluate(now time.Time) bool {
+	if rc.config.RunOn == "" || rc.config.Evaluator == "" {
+		// no designation, or no sync layer has ever claimed this rule
+		return true
+	}
+
+	if rc.rootID != "" && rc.config.EvaluatorEdge == rc.rootID {
+		// we are the edge instance, our sync layer decides
+		return rc.config.Evaluator == data.PointValueEdge
+	}
+
+	if rc.config.RunOn == data.PointValueEdge {
+		return false
+	}
+
+	if now.Sub(rc.leaseTime) > ruleLeaseTimeout {
+		return true
+	}
+
+	return rc.config.Evaluator == data.PointValueUpstream
+}
+
 // sendPoint sets origin to the rule node
 func (rc *RuleClient) sendPoint(id string, point data.Point) error {
 	return SendNodePoint(rc.nc, id, point, false)
@@ -354,7 +464,7 @@ func (rc *RuleClient) ruleProcessPoints(nodeID string, points data.Points) (bool
 					continue
 				}
 				pointsProcessed = true
-				sched := newSchedule(c.StartTime, c.EndTime, c.Weekdays)
+				sched := newSchedule(c.StartTime, c.EndTime, c.Weekdays, rc.loc)
 
 				var err error
 				active, err = sched.activeForTime(p.Time)
@@ -416,8 +526,22 @@ func (rc *RuleClient) ruleProcessPoints(nodeID string, points data.Points) (bool
 	return false, false, nil
 }
 
-// ruleRunActions runs rule actions
+// ruleRunActions runs rule actions. Points set by the actions are written in
+// one transaction so that nodes are not left partly updated.
 func (rc *RuleClient) ruleRunActions(actions []Action, triggerNodeID string) error {
+	var tx []data.TxWrite
+
+	defer func() {
+		if len(tx) <= 0 {
+			return
+		}
+
+		err := SendNodePointsTx(rc.nc, tx)
+		if err != nil {
+			log.Println("Error sending rule action points: ", err)
+		}
+	}()
+
 	for i, a := range actions {
 		switch a.Action {
 		case data.PointValueSetValue:
@@ -432,10 +556,7 @@ func (rc *RuleClient) ruleRunActions(actions []Action, triggerNodeID string) err
 				Text:   a.ValueText,
 				Origin: a.ID,
 			}
-			err := rc.sendPoint(a.NodeID, p)
-			if err != nil {
-				log.Println("Error sending rule action point: ", err)
-			}
+			tx = append(tx, data.TxWrite{NodeID: a.NodeID, Points: data.Points{p}})
 		case data.PointValueNotify:
 			// get node that fired the rule
 			nodes, err := GetNode(rc.nc, triggerNodeID, "none")
@@ -455,6 +576,13 @@ func (rc *RuleClient) ruleRunActions(actions []Action, triggerNodeID string) err
 				ID:         uuid.New().String(),
 				SourceNode: a.NodeID,
 				Message:    rc.config.Description + " fired at " + triggerNodeDesc,
+				Severity:   rc.config.Severity,
+				Priority:   rc.config.EffectivePriority(),
+			}
+
+			if rc.config.Severity != "" {
+				n.Subject = strings.ToUpper(rc.config.Severity) + ": " +
+					rc.config.Description
 			}
 
 			d, err := n.ToPb()
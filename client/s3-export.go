@@ -0,0 +1,537 @@
+package client
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/data"
+	"github.com/simpleiot/simpleiot/file"
+)
+
+// S3Export periodically uploads point history and node backups to an S3
+// compatible service. URI is the service endpoint (for example
+// http://minio:9000) and defaults to AWS. SessionToken is only needed with
+// temporary credentials. Periods are in minutes. If EncryptionKey is set,
+// objects are encrypted before they are uploaded (see file.EncryptWriter),
+// otherwise credentials are masked.
+type S3Export struct {
+	ID            string `node:"id"`
+	Parent        string `node:"parent"`
+	Description   string `point:"description"`
+	URI           string `point:"uri"`
+	Region        string `point:"region"`
+	Bucket        string `point:"bucket"`
+	AccessKey     string `point:"accessKey"`
+	SecretKey     string `point:"secretKey"`
+	SessionToken  string `point:"sessionToken"`
+	Prefix        string `point:"prefix"`
+	EncryptionKey string `point:"encryptionKey"`
+	ExportPeriod  int    `point:"exportPeriod"`
+	BackupPeriod  int    `point:"backupPeriod"`
+	Disable       bool   `point:"disable"`
+	Tx            int    `point:"tx"`
+	ErrorCount    int    `point:"errorCount"`
+}
+
+// maximum number of points spooled between exports. If an export fails,
+// points are kept for the next export, and the oldest points are dropped
+// once this is reached.
+var s3ExportMaxPoints = 1000000
+
+// s3ArchivePoint is one line in a point archive
+type s3ArchivePoint struct {
+	NodeID string `json:"nodeID"`
+	data.Point
+}
+
+// s3Spool is an object that is written to a temp file, so that exports are
+// not held in memory. Objects are gzipped, and encrypted if a key is set.
+type s3Spool struct {
+	f         *os.File
+	gz        *gzip.Writer
+	enc       *file.EncryptWriter
+	json      *json.Encoder
+	encrypted bool
+	count     int
+	// time the object was finished, used in the object key
+	time time.Time
+}
+
+func newS3Spool(encryptionKey string) (*s3Spool, error) {
+	f, err := os.CreateTemp("", "siot-s3-*")
+	if err != nil {
+		return nil, fmt.Errorf("Error creating spool file: %w", err)
+	}
+
+	ret := &s3Spool{f: f, encrypted: encryptionKey != ""}
+
+	var w io.Writer = f
+
+	if ret.encrypted {
+		ret.enc, err = file.NewEncryptWriter(encryptionKey, f)
+		if err != nil {
+			ret.remove()
+			return nil, err
+		}
+		w = ret.enc
+	}
+
+	ret.gz = gzip.NewWriter(w)
+	ret.json = json.NewEncoder(ret.gz)
+
+	return ret, nil
+}
+
+// add writes v as a JSON line
+func (s *s3Spool) add(v interface{}) error {
+	err := s.json.Encode(v)
+	if err != nil {
+		return err
+	}
+
+	s.count++
+	return nil
+}
+
+// finish writes the end of the object, after which it can be uploaded
+func (s *s3Spool) finish(t time.Time) error {
+	s.time = t
+
+	err := s.gz.Close()
+	if err != nil {
+		return err
+	}
+
+	if s.enc != nil {
+		return s.enc.Close()
+	}
+
+	return nil
+}
+
+func (s *s3Spool) remove() {
+	s.f.Close()
+	os.Remove(s.f.Name())
+}
+
+// S3ExportClient is a SIOT client that exports data to S3
+type S3ExportClient struct {
+	nc            *nats.Conn
+	config        S3Export
+	stop          chan struct{}
+	newPoints     chan NewPoints
+	newEdgePoints chan NewPoints
+	newUpPoints   chan NewPoints
+	upSub         *BufferedSub
+	upSubHr       *BufferedSub
+	// points received since the last export
+	spool *s3Spool
+	// point exports that failed, oldest first
+	pending []*s3Spool
+}
+
+// NewS3ExportClient ...
+func NewS3ExportClient(nc *nats.Conn, config S3Export) Client {
+	return &S3ExportClient{
+		nc:            nc,
+		config:        config,
+		stop:          make(chan struct{}),
+		newPoints:     make(chan NewPoints),
+		newEdgePoints: make(chan NewPoints),
+		newUpPoints:   make(chan NewPoints),
+	}
+}
+
+// Start runs the main logic for this client and blocks until stopped
+func (s3 *S3ExportClient) Start() error {
+	log.Println("Starting S3 export client: ", s3.config.Description)
+
+	bufOpts := BufferOptions{
+		Size:          10000,
+		Policy:        BufferDropOldest,
+		MetricsNodeID: s3.config.ID,
+	}
+
+	handler := func(subject string, points data.Points) {
+		// node ID is the 3rd field of up.<parent>.<id>.points and
+		// phrup.<parent>.<id>
+		chunks := strings.Split(subject, ".")
+		if len(chunks) < 3 {
+			log.Println("S3 export up sub, malformed subject: ", subject)
+			return
+		}
+
+		// don't archive our own stats
+		if chunks[2] == s3.config.ID {
+			return
+		}
+
+		select {
+		case s3.newUpPoints <- NewPoints{chunks[2], "", points}:
+		case <-s3.stop:
+		}
+	}
+
+	var err error
+	s3.upSub, err = NewBufferedSub(s3.nc, fmt.Sprintf("up.%v.*.points", s3.config.Parent),
+		bufOpts, handler)
+	if err != nil {
+		return fmt.Errorf("S3 export error subscribing to upsub: %v", err)
+	}
+
+	s3.upSubHr, err = NewBufferedSub(s3.nc, fmt.Sprintf("phrup.%v.*", s3.config.Parent),
+		bufOpts, handler)
+	if err != nil {
+		s3.upSub.Stop()
+		return fmt.Errorf("S3 export error subscribing to upSubHr: %v", err)
+	}
+
+	exportTicker := time.NewTicker(time.Hour)
+	defer exportTicker.Stop()
+
+	backupTicker := time.NewTicker(time.Hour)
+	defer backupTicker.Stop()
+
+	resetTickers := func() {
+		exportPeriod := s3.config.ExportPeriod
+		if exportPeriod <= 0 {
+			exportPeriod = 60
+		}
+		exportTicker.Reset(time.Duration(exportPeriod) * time.Minute)
+
+		backupPeriod := s3.config.BackupPeriod
+		if backupPeriod <= 0 {
+			backupPeriod = 24 * 60
+		}
+		backupTicker.Reset(time.Duration(backupPeriod) * time.Minute)
+	}
+
+	resetTickers()
+
+	exportPoints := func() {
+		if s3.config.Disable || s3.spooled() <= 0 {
+			return
+		}
+
+		err := s3.exportPoints(time.Now())
+		if err != nil {
+			log.Printf("S3 export %v: error exporting points: %v\n",
+				s3.config.Description, err)
+			s3.config.ErrorCount++
+			s3.sendStat(data.PointTypeErrorCount, s3.config.ErrorCount)
+		}
+	}
+
+	backup := func() {
+		if s3.config.Disable {
+			return
+		}
+
+		err := s3.backup(time.Now())
+		if err != nil {
+			log.Printf("S3 export %v: error backing up nodes: %v\n",
+				s3.config.Description, err)
+			s3.config.ErrorCount++
+			s3.sendStat(data.PointTypeErrorCount, s3.config.ErrorCount)
+		}
+	}
+
+done:
+	for {
+		select {
+		case <-s3.stop:
+			log.Println("Stopping S3 export client: ", s3.config.Description)
+			break done
+		case <-exportTicker.C:
+			exportPoints()
+		case <-backupTicker.C:
+			backup()
+		case pts := <-s3.newPoints:
+			err := data.MergePoints(pts.ID, pts.Points, &s3.config)
+			if err != nil {
+				log.Println("error merging new points: ", err)
+			}
+
+			for _, p := range pts.Points {
+				switch p.Type {
+				case data.PointTypeExportPeriod, data.PointTypeBackupPeriod:
+					resetTickers()
+				}
+			}
+		case pts := <-s3.newEdgePoints:
+			err := data.MergeEdgePoints(pts.ID, pts.Parent, pts.Points, &s3.config)
+			if err != nil {
+				log.Println("error merging new points: ", err)
+			}
+		case pts := <-s3.newUpPoints:
+			err := s3.spoolPoints(pts.ID, pts.Points)
+			if err != nil {
+				log.Printf("S3 export %v: error spooling points: %v\n",
+					s3.config.Description, err)
+			}
+		}
+	}
+
+	s3.upSub.Stop()
+	s3.upSubHr.Stop()
+
+	// don't lose spooled points on shutdown
+	exportPoints()
+
+	for _, s := range s3.pending {
+		s.remove()
+	}
+
+	if s3.spool != nil {
+		s3.spool.remove()
+	}
+
+	return nil
+}
+
+// spooled returns the number of points waiting to be exported
+func (s3 *S3ExportClient) spooled() int {
+	ret := 0
+
+	for _, s := range s3.pending {
+		ret += s.count
+	}
+
+	if s3.spool != nil {
+		ret += s3.spool.count
+	}
+
+	return ret
+}
+
+// spoolPoints writes points to the spool. Credentials are masked unless the
+// export is encrypted. Once s3ExportMaxPoints are spooled, the oldest failed
+// export is dropped, or new points if there are none.
+func (s3 *S3ExportClient) spoolPoints(id string, points data.Points) error {
+	for s3.spooled()+len(points) > s3ExportMaxPoints && len(s3.pending) > 0 {
+		log.Printf("S3 export %v: spool full, dropping %v points\n",
+			s3.config.Description, s3.pending[0].count)
+		s3.pending[0].remove()
+		s3.pending = s3.pending[1:]
+	}
+
+	if s3.spooled()+len(points) > s3ExportMaxPoints {
+		return fmt.Errorf("spool full, dropping %v points", len(points))
+	}
+
+	if s3.spool == nil {
+		var err error
+		s3.spool, err = newS3Spool(s3.config.EncryptionKey)
+		if err != nil {
+			return err
+		}
+	}
+
+	if !s3.spool.encrypted {
+		points = points.Mask()
+	}
+
+	for _, p := range points {
+		err := s3.spool.add(s3ArchivePoint{id, p})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// s3ObjectKey returns a key for an exported object. Keys are grouped by
+// kind (points or backups) and date so that bucket lifecycle rules can be
+// applied by prefix, for example: <prefix>/points/2022/10/14/<id>-20221014T140000Z.jsonl.gz
+func s3ObjectKey(prefix, kind, id, ext string, t time.Time, encrypted bool) string {
+	t = t.UTC()
+
+	name := fmt.Sprintf("%v-%v.%v.gz", id, t.Format("20060102T150405Z"), ext)
+	if encrypted {
+		name += ".enc"
+	}
+
+	return path.Join(prefix, kind, t.Format("2006/01/02"), name)
+}
+
+func (s3 *S3ExportClient) put(kind, ext string, s *s3Spool) error {
+	key := s3ObjectKey(s3.config.Prefix, kind, s3.config.Parent, ext, s.time,
+		s.encrypted)
+
+	err := s3Put(s3.config, key, s.f)
+	if err != nil {
+		return err
+	}
+
+	s3.config.Tx++
+	s3.sendStat(data.PointTypeTx, s3.config.Tx)
+
+	return nil
+}
+
+// exportPoints uploads spooled points as gzipped JSON lines. If an upload
+// fails, the points are kept and uploaded by the next export.
+func (s3 *S3ExportClient) exportPoints(t time.Time) error {
+	if s3.spool != nil {
+		s := s3.spool
+		s3.spool = nil
+
+		err := s.finish(t)
+		if err != nil {
+			s.remove()
+			return fmt.Errorf("Error writing points: %w", err)
+		}
+
+		s3.pending = append(s3.pending, s)
+	}
+
+	for len(s3.pending) > 0 {
+		err := s3.put("points", "jsonl", s3.pending[0])
+		if err != nil {
+			return err
+		}
+
+		s3.pending[0].remove()
+		s3.pending = s3.pending[1:]
+	}
+
+	return nil
+}
+
+// backup uploads all nodes under the parent node as a JSON array.
+// Credentials are masked unless the backup is encrypted.
+func (s3 *S3ExportClient) backup(t time.Time) error {
+	nodes, err := GetNode(s3.nc, s3.config.Parent, "none")
+	if err != nil {
+		return fmt.Errorf("Error getting node: %w", err)
+	}
+
+	children, err := GetNodeChildren(s3.nc, s3.config.Parent, "", false, true)
+	if err != nil {
+		return fmt.Errorf("Error getting children: %w", err)
+	}
+
+	nodes = append(nodes, children...)
+
+	s, err := newS3Spool(s3.config.EncryptionKey)
+	if err != nil {
+		return err
+	}
+	defer s.remove()
+
+	if !s.encrypted {
+		for i := range nodes {
+			nodes[i].Points = nodes[i].Points.Mask()
+			nodes[i].EdgePoints = nodes[i].EdgePoints.Mask()
+		}
+	}
+
+	err = s.add(nodes)
+	if err == nil {
+		err = s.finish(t)
+	}
+
+	if err != nil {
+		return fmt.Errorf("Error encoding nodes: %w", err)
+	}
+
+	return s3.put("backups", "json", s)
+}
+
+// part size of multipart uploads, 0 lets minio pick one from the object size
+var s3PartSize uint64
+
+// s3Put uploads an object. Large objects are uploaded in parts, and failed
+// requests are retried.
+func s3Put(config S3Export, key string, body io.ReadSeeker) error {
+	region := config.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	endpoint := config.URI
+	if endpoint == "" {
+		endpoint = "https://s3." + region + ".amazonaws.com"
+	}
+
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return fmt.Errorf("Error parsing URI: %w", err)
+	}
+
+	c, err := minio.New(u.Host, &minio.Options{
+		Creds: credentials.NewStaticV4(config.AccessKey, config.SecretKey,
+			config.SessionToken),
+		Secure: u.Scheme == "https",
+		Region: region,
+	})
+	if err != nil {
+		return err
+	}
+
+	size, err := body.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+
+	_, err = body.Seek(0, io.SeekStart)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.PutObject(context.Background(), config.Bucket, key, body, size,
+		minio.PutObjectOptions{
+			ContentType: "application/octet-stream",
+			PartSize:    s3PartSize,
+		})
+	if err != nil {
+		if s3Err := minio.ToErrorResponse(err); s3Err.Code != "" {
+			return fmt.Errorf("S3 error: %v: %v", s3Err.Code, s3Err.Message)
+		}
+
+		return fmt.Errorf("S3 error: %w", err)
+	}
+
+	return nil
+}
+
+func (s3 *S3ExportClient) sendStat(typ string, value int) {
+	err := SendNodePoint(s3.nc, s3.config.ID, data.Point{
+		Time:  time.Now(),
+		Type:  typ,
+		Value: float64(value),
+	}, false)
+	if err != nil {
+		log.Println("S3 export: error sending stat: ", err)
+	}
+}
+
+// Stop sends a signal to the Start function to exit
+func (s3 *S3ExportClient) Stop(err error) {
+	close(s3.stop)
+}
+
+// Points is called by the Manager when new points for this
+// node are received.
+func (s3 *S3ExportClient) Points(nodeID string, points []data.Point) {
+	s3.newPoints <- NewPoints{nodeID, "", points}
+}
+
+// EdgePoints is called by the Manager when new edge points for this
+// node are received.
+func (s3 *S3ExportClient) EdgePoints(nodeID, parentID string, points []data.Point) {
+	s3.newEdgePoints <- NewPoints{nodeID, parentID, points}
+}
@@ -0,0 +1,317 @@
+package client
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/simpleiot/simpleiot/data"
+	"github.com/simpleiot/simpleiot/file"
+)
+
+func TestS3ObjectKey(t *testing.T) {
+	tm := time.Date(2022, 10, 14, 14, 0, 5, 0, time.UTC)
+
+	key := s3ObjectKey("siot/site1", "points", "dev1", "jsonl", tm, false)
+	exp := "siot/site1/points/2022/10/14/dev1-20221014T140005Z.jsonl.gz"
+	if key != exp {
+		t.Errorf("Expected %v, got %v", exp, key)
+	}
+
+	key = s3ObjectKey("", "backups", "dev1", "json", tm, true)
+	exp = "backups/2022/10/14/dev1-20221014T140005Z.json.gz.enc"
+	if key != exp {
+		t.Errorf("Expected %v, got %v", exp, key)
+	}
+}
+
+// testS3 is a fake S3 server that supports multipart uploads. The first
+// request fails so that retries are tested.
+type testS3 struct {
+	sync.Mutex
+	*httptest.Server
+	requests int
+	auth     []string
+	tokens   []string
+	parts    map[int][]byte
+	objects  map[string][]byte
+}
+
+func newTestS3(t *testing.T) *testS3 {
+	s := &testS3{parts: make(map[int][]byte), objects: make(map[string][]byte)}
+
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.Lock()
+		defer s.Unlock()
+
+		s.requests++
+		if s.requests == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`<Error><Code>SlowDown</Code><Message>Slow Down</Message></Error>`))
+			return
+		}
+
+		s.auth = append(s.auth, r.Header.Get("Authorization"))
+		s.tokens = append(s.tokens, r.Header.Get("X-Amz-Security-Token"))
+
+		q := r.URL.Query()
+
+		switch {
+		case r.Method == http.MethodPost && q.Has("uploads"):
+			w.Write([]byte(`<InitiateMultipartUploadResult><UploadId>u1</UploadId></InitiateMultipartUploadResult>`))
+		case r.Method == http.MethodPut && q.Has("partNumber"):
+			n, _ := strconv.Atoi(q.Get("partNumber"))
+			s.parts[n] = readS3Body(t, r)
+			w.Header().Set("ETag", fmt.Sprintf(`"part%v"`, n))
+		case r.Method == http.MethodPost && q.Has("uploadId"):
+			var obj []byte
+			for i := 1; i <= len(s.parts); i++ {
+				obj = append(obj, s.parts[i]...)
+			}
+			s.objects[r.URL.Path] = obj
+			w.Write([]byte(`<CompleteMultipartUploadResult><Bucket>archive</Bucket><ETag>"obj"</ETag></CompleteMultipartUploadResult>`))
+		case r.Method == http.MethodPut:
+			s.objects[r.URL.Path] = readS3Body(t, r)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}))
+
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+// readS3Body reads a request body, decoding aws-chunked bodies that are
+// signed while they are streamed
+func readS3Body(t *testing.T, r *http.Request) []byte {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		t.Error("Error reading body: ", err)
+	}
+
+	if r.Header.Get("X-Amz-Content-Sha256") != "STREAMING-AWS4-HMAC-SHA256-PAYLOAD" {
+		return body
+	}
+
+	var ret []byte
+
+	for len(body) > 0 {
+		// <hex size>;chunk-signature=<signature>\r\n<data>\r\n
+		header, rest, _ := bytes.Cut(body, []byte("\r\n"))
+		size, _, _ := bytes.Cut(header, []byte(";"))
+
+		n, err := strconv.ParseInt(string(size), 16, 64)
+		if err != nil || int(n)+2 > len(rest) {
+			t.Errorf("Bad chunk header: %q", header)
+			return nil
+		}
+
+		ret = append(ret, rest[:n]...)
+		body = rest[n+2:]
+	}
+
+	return ret
+}
+
+func TestS3Put(t *testing.T) {
+	srv := newTestS3(t)
+
+	config := S3Export{
+		URI:          srv.URL,
+		Bucket:       "archive",
+		AccessKey:    "AKID",
+		SecretKey:    "secret",
+		SessionToken: "token",
+	}
+
+	body := []byte("hello")
+
+	err := s3Put(config, "points/2022/10/14/a.jsonl.gz", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal("Put error: ", err)
+	}
+
+	got, ok := srv.objects["/archive/points/2022/10/14/a.jsonl.gz"]
+	if !ok || !bytes.Equal(got, body) {
+		t.Errorf("Wrong object: %v, %q", ok, got)
+	}
+
+	if srv.requests != 2 {
+		t.Error("Failed request not retried, requests: ", srv.requests)
+	}
+
+	if !strings.HasPrefix(srv.auth[0], "AWS4-HMAC-SHA256 Credential=AKID/") ||
+		!strings.Contains(srv.auth[0], "/us-east-1/s3/aws4_request") {
+		t.Error("Wrong authorization: ", srv.auth[0])
+	}
+
+	if srv.tokens[0] != "token" {
+		t.Error("Wrong session token: ", srv.tokens[0])
+	}
+}
+
+func TestS3PutMultipart(t *testing.T) {
+	partSize := s3PartSize
+	s3PartSize = 5 << 20
+	defer func() { s3PartSize = partSize }()
+
+	srv := newTestS3(t)
+
+	body := make([]byte, 2*s3PartSize+100)
+	for i := range body {
+		body[i] = byte(i)
+	}
+
+	err := s3Put(S3Export{URI: srv.URL, Bucket: "archive", AccessKey: "AKID",
+		SecretKey: "secret"}, "big", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal("Put error: ", err)
+	}
+
+	if len(srv.parts) != 3 {
+		t.Error("Expected 3 parts, got: ", len(srv.parts))
+	}
+
+	if !bytes.Equal(srv.objects["/archive/big"], body) {
+		t.Error("Wrong object, length: ", len(srv.objects["/archive/big"]))
+	}
+
+	for _, token := range srv.tokens {
+		if token != "" {
+			t.Fatal("Unexpected session token: ", token)
+		}
+	}
+}
+
+func TestS3PutError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?>
+<Error><Code>AccessDenied</Code><Message>Access Denied</Message></Error>`))
+	}))
+	defer srv.Close()
+
+	err := s3Put(S3Export{URI: srv.URL, Bucket: "archive"}, "k", bytes.NewReader(nil))
+	if err == nil || !strings.Contains(err.Error(), "AccessDenied") {
+		t.Error("Expected access denied error, got: ", err)
+	}
+}
+
+func readS3Spool(t *testing.T, s *s3Spool, key string) []s3ArchivePoint {
+	t.Helper()
+
+	d, err := os.ReadFile(s.f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if key != "" {
+		d, err = file.Decrypt(key, d)
+		if err != nil {
+			t.Fatal("Error decrypting: ", err)
+		}
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(d))
+	if err != nil {
+		t.Fatal("Error decompressing: ", err)
+	}
+
+	var ret []s3ArchivePoint
+
+	dec := json.NewDecoder(zr)
+	for dec.More() {
+		var p s3ArchivePoint
+		if err := dec.Decode(&p); err != nil {
+			t.Fatal("Error decoding: ", err)
+		}
+		ret = append(ret, p)
+	}
+
+	return ret
+}
+
+func TestS3Spool(t *testing.T) {
+	points := data.Points{
+		{Type: data.PointTypeValue, Value: 1},
+		{Type: data.PointTypeSecretKey, Text: "abc"},
+	}
+
+	for _, key := range []string{"", "passphrase"} {
+		c := &S3ExportClient{config: S3Export{EncryptionKey: key}}
+
+		if err := c.spoolPoints("n1", points); err != nil {
+			t.Fatal("Error spooling: ", err)
+		}
+
+		s := c.spool
+		defer s.remove()
+
+		if err := s.finish(time.Now()); err != nil {
+			t.Fatal("Error finishing: ", err)
+		}
+
+		got := readS3Spool(t, s, key)
+		if len(got) != 2 || got[0].NodeID != "n1" || got[0].Value != 1 {
+			t.Fatalf("Wrong points: %+v", got)
+		}
+
+		expSecret := data.SecretMask
+		if key != "" {
+			expSecret = "abc"
+		}
+
+		if got[1].Text != expSecret {
+			t.Errorf("Key %q: expected secret %v, got %v", key, expSecret, got[1].Text)
+		}
+	}
+}
+
+func TestS3SpoolFull(t *testing.T) {
+	max := s3ExportMaxPoints
+	s3ExportMaxPoints = 3
+	defer func() { s3ExportMaxPoints = max }()
+
+	c := &S3ExportClient{}
+	defer func() {
+		for _, s := range c.pending {
+			s.remove()
+		}
+		c.spool.remove()
+	}()
+
+	points := data.Points{{Value: 1}, {Value: 2}}
+
+	if err := c.spoolPoints("n1", points); err != nil {
+		t.Fatal(err)
+	}
+
+	// a failed export is kept until the spool is full
+	if err := c.spool.finish(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	c.pending, c.spool = append(c.pending, c.spool), nil
+
+	if err := c.spoolPoints("n1", points); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(c.pending) != 0 || c.spooled() != 2 {
+		t.Errorf("Oldest export not dropped: %v, %v", len(c.pending), c.spooled())
+	}
+
+	if err := c.spoolPoints("n1", points); err == nil {
+		t.Error("Expected error when spool is full")
+	}
+}
@@ -12,18 +12,26 @@ type schedule struct {
 	startTime string
 	endTime   string
 	weekdays  []time.Weekday
+	loc       *time.Location
 }
 
-func newSchedule(start, end string, weekdays []time.Weekday) *schedule {
+// newSchedule returns a schedule with start and end times in loc, or UTC if
+// loc is nil
+func newSchedule(start, end string, weekdays []time.Weekday, loc *time.Location) *schedule {
+	if loc == nil {
+		loc = time.UTC
+	}
+
 	return &schedule{
 		startTime: start,
 		endTime:   end,
 		weekdays:  weekdays,
+		loc:       loc,
 	}
 }
 
 func (s *schedule) activeForTime(t time.Time) (bool, error) {
-	tUTC := t.UTC()
+	tLoc := t.In(s.loc)
 
 	// parse out hour/minute
 	matches := reHourMin.FindStringSubmatch(s.startTime)
@@ -58,12 +66,12 @@ func (s *schedule) activeForTime(t time.Time) (bool, error) {
 		return false, fmt.Errorf("TimeRange: error parsing end hour: %v", matches[1])
 	}
 
-	y := tUTC.Year()
-	m := tUTC.Month()
-	d := tUTC.Day()
+	y := tLoc.Year()
+	m := tLoc.Month()
+	d := tLoc.Day()
 
-	start := time.Date(y, m, d, startHour, startMin, 0, 0, time.UTC)
-	end := time.Date(y, m, d, endHour, endMin, 0, 0, time.UTC)
+	start := time.Date(y, m, d, startHour, startMin, 0, 0, s.loc)
+	end := time.Date(y, m, d, endHour, endMin, 0, 0, s.loc)
 
 	timeRanges := timeRanges{
 		{start, end},
@@ -27,7 +27,7 @@ func (tt *testTable) run(t *testing.T, sched *schedule) {
 }
 
 func TestScheduleAllDays(t *testing.T) {
-	sched := newSchedule("2:00", "5:00", []time.Weekday{})
+	sched := newSchedule("2:00", "5:00", []time.Weekday{}, nil)
 
 	tests := testTable{
 		{time.Date(2021, time.February, 10, 4, 0, 0, 0, time.UTC), true},
@@ -38,7 +38,7 @@ func TestScheduleAllDays(t *testing.T) {
 }
 
 func TestScheduleWeekdays(t *testing.T) {
-	sched := newSchedule("2:00", "5:00", []time.Weekday{0, 6})
+	sched := newSchedule("2:00", "5:00", []time.Weekday{0, 6}, nil)
 
 	// 2021-08-09 is a Monday
 	tests := testTable{
@@ -50,7 +50,7 @@ func TestScheduleWeekdays(t *testing.T) {
 }
 
 func TestScheduleWrapDay(t *testing.T) {
-	sched := newSchedule("20:00", "2:00", []time.Weekday{})
+	sched := newSchedule("20:00", "2:00", []time.Weekday{}, nil)
 
 	// 2021-08-09 is a Monday
 	tests := testTable{
@@ -62,7 +62,7 @@ func TestScheduleWrapDay(t *testing.T) {
 }
 
 func TestScheduleWrapDayWeekday(t *testing.T) {
-	sched := newSchedule("20:00", "2:00", []time.Weekday{1})
+	sched := newSchedule("20:00", "2:00", []time.Weekday{1}, nil)
 
 	// 2021-08-09 is a Monday
 	tests := testTable{
@@ -75,3 +75,25 @@ func TestScheduleWrapDayWeekday(t *testing.T) {
 
 	tests.run(t, sched)
 }
+
+func TestScheduleLocation(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("time zone database not available: ", err)
+	}
+
+	// 8:00 to 17:00 local time on weekdays
+	sched := newSchedule("8:00", "17:00", []time.Weekday{1, 2, 3, 4, 5}, loc)
+
+	tests := testTable{
+		// Friday 16:30 EST is Friday 21:30 UTC
+		{time.Date(2021, time.February, 12, 21, 30, 0, 0, time.UTC), true},
+		// Friday 19:00 EST is Saturday 00:00 UTC
+		{time.Date(2021, time.February, 13, 0, 0, 0, 0, time.UTC), false},
+		// Monday 7:30 EDT is Monday 11:30 UTC
+		{time.Date(2021, time.June, 14, 11, 30, 0, 0, time.UTC), false},
+		{time.Date(2021, time.June, 14, 12, 30, 0, 0, time.UTC), true},
+	}
+
+	tests.run(t, sched)
+}
@@ -0,0 +1,152 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+func schemaValue(typ, units string) data.PointSchema {
+	return data.PointSchema{Type: typ, Kind: data.PointKindValue, Units: units}
+}
+
+func schemaText(typ string, options ...string) data.PointSchema {
+	return data.PointSchema{Type: typ, Kind: data.PointKindText, Options: options}
+}
+
+func schemaBool(typ string) data.PointSchema {
+	return data.PointSchema{Type: typ, Kind: data.PointKindBool}
+}
+
+func schemaStatus(ps data.PointSchema) data.PointSchema {
+	ps.Status = true
+	return ps
+}
+
+// builtInSchemas are the point schemas of built-in node types. Node types
+// without a schema are not validated.
+var builtInSchemas = []data.NodeSchema{
+	{NodeType: data.NodeTypeSignalGenerator, Points: []data.PointSchema{
+		schemaValue(data.PointTypeFrequency, "Hz").WithRange(0, 1e6),
+		schemaValue(data.PointTypeAmplitude, ""),
+		schemaValue(data.PointTypeOffset, ""),
+		schemaValue(data.PointTypeSampleRate, "Hz").WithRange(0, 1e6),
+		schemaText(data.PointTypeUnits),
+		schemaBool(data.PointTypeDisable),
+	}},
+	{NodeType: data.NodeTypeLighting, Points: []data.PointSchema{
+		schemaValue(data.PointTypeLatitude, "°").WithRange(-90, 90),
+		schemaValue(data.PointTypeLongitude, "°").WithRange(-180, 180),
+		schemaValue(data.PointTypeDuskOffset, "min"),
+		schemaValue(data.PointTypeDawnOffset, "min"),
+		schemaValue(data.PointTypeOutputMax, "").WithRange(0, 1e6),
+		schemaValue(data.PointTypeOccupancyTimeout, "min").WithRange(0, 1440),
+		schemaValue(data.PointTypeLevel, "%").WithRange(0, 100),
+		schemaValue(data.PointTypeOccupiedLevel, "%").WithRange(0, 100),
+		schemaText(data.PointTypeCurve, "", data.PointValueLinear, data.PointValueSquare,
+			data.PointValueCIE),
+		schemaBool(data.PointTypeOverride),
+		schemaValue(data.PointTypeOverrideLevel, "%").WithRange(0, 100),
+		schemaValue(data.PointTypeOverrideTimeout, "min").WithRange(0, 1440),
+		schemaBool(data.PointTypeDisable),
+		schemaStatus(schemaBool(data.PointTypeDark)),
+		schemaStatus(schemaBool(data.PointTypeOccupied)),
+		schemaStatus(schemaValue(data.PointTypeActiveLevel, "%")),
+	}},
+	{NodeType: data.NodeTypeTank, Points: []data.PointSchema{
+		schemaText(data.PointTypeShape, "", data.PointValueVertical, data.PointValueHorizontal,
+			data.PointValueRectangular, data.PointValueTable),
+		schemaValue(data.PointTypeDiameter, "").WithRange(0, 1e6),
+		schemaValue(data.PointTypeLength, "").WithRange(0, 1e6),
+		schemaValue(data.PointTypeWidth, "").WithRange(0, 1e6),
+		schemaValue(data.PointTypeHeight, "").WithRange(0, 1e6),
+		schemaValue(data.PointTypeVolumeScale, ""),
+		schemaText(data.PointTypeLevelNodeID),
+		schemaText(data.PointTypeLevelPointType),
+		schemaValue(data.PointTypeLevelOffset, ""),
+		schemaBool(data.PointTypeFromTop),
+		schemaValue(data.PointTypeRateWindow, "min").WithRange(0, 1440),
+		schemaValue(data.PointTypeLeakRate, "/h").WithRange(0, 1e9),
+		schemaValue(data.PointTypeLeakDelay, "min").WithRange(0, 1440),
+		schemaBool(data.PointTypeDisable),
+		schemaStatus(schemaValue(data.PointTypeLevel, "")),
+		schemaStatus(schemaValue(data.PointTypeVolume, "")),
+		schemaStatus(schemaValue(data.PointTypePercent, "%")),
+		schemaStatus(schemaValue(data.PointTypeRate, "/h")),
+		schemaStatus(schemaBool(data.PointTypeLeak)),
+	}},
+	{NodeType: data.NodeTypeHvac, Points: []data.PointSchema{
+		schemaText(data.PointTypeMode, "", data.PointValueHeat, data.PointValueCool,
+			data.PointValueAuto, data.PointValueOff),
+		schemaText(data.PointTypeTempNodeID),
+		schemaText(data.PointTypeOutdoorNodeID),
+		schemaValue(data.PointTypeHeatSetpoint, "°").WithRange(-50, 150),
+		schemaValue(data.PointTypeCoolSetpoint, "°").WithRange(-50, 150),
+		schemaValue(data.PointTypeSetbackHeat, "°").WithRange(-50, 150),
+		schemaValue(data.PointTypeSetbackCool, "°").WithRange(-50, 150),
+		schemaText(data.PointTypeOccupiedStart),
+		schemaText(data.PointTypeOccupiedEnd),
+		schemaValue(data.PointTypeDifferential, "°").WithRange(0, 20),
+		schemaValue(data.PointTypeStageDelay, "min").WithRange(0, 1440),
+		schemaValue(data.PointTypeMinRun, "min").WithRange(0, 1440),
+		schemaValue(data.PointTypeMinOff, "min").WithRange(0, 1440),
+		schemaText(data.PointTypeEconomizerNodeID),
+		schemaValue(data.PointTypeEconomizerTemp, "°").WithRange(-50, 150),
+		schemaText(data.PointTypeFanNodeID),
+		schemaBool(data.PointTypeDisable),
+		schemaStatus(schemaBool(data.PointTypeOccupied)),
+		schemaStatus(schemaValue(data.PointTypeHeatStage, "")),
+		schemaStatus(schemaValue(data.PointTypeCoolStage, "")),
+		schemaStatus(schemaBool(data.PointTypeEconomizing)),
+	}},
+	{NodeType: data.NodeTypeCalc, Points: []data.PointSchema{
+		schemaText(data.PointTypeSourceNodeID),
+		schemaText(data.PointTypeSourcePointType),
+		schemaText(data.PointTypeSourcePointKey),
+		schemaBool(data.PointTypeDisable),
+	}},
+	{NodeType: data.NodeTypeCalcOutput, Points: []data.PointSchema{
+		schemaText(data.PointTypeOperation, data.PointValueDelta, data.PointValueRate,
+			data.PointValueAverage, data.PointValueMin, data.PointValueMax),
+		schemaValue(data.PointTypeWindow, "s").WithRange(0, 1e7),
+		schemaStatus(schemaValue(data.PointTypeValue, "")),
+	}},
+}
+
+// RegisterBuiltInSchemas registers the point schemas of built-in node types
+// (see data.RegisterSchema)
+func RegisterBuiltInSchemas() {
+	for _, s := range builtInSchemas {
+		data.RegisterSchema(s)
+	}
+}
+
+// SchemasResponse is returned by the store for a schemas request
+type SchemasResponse struct {
+	Schemas []data.NodeSchema `json:"schemas"`
+	Error   string            `json:"error,omitempty"`
+}
+
+// GetSchemas returns the point schemas registered with the store
+func GetSchemas(nc *nats.Conn) ([]data.NodeSchema, error) {
+	msg, err := nc.Request(SubjectSchemas(), nil, time.Second*5)
+	if err != nil {
+		return nil, fmt.Errorf("Error getting schemas: %w", err)
+	}
+
+	var resp SchemasResponse
+	err = json.Unmarshal(msg.Data, &resp)
+	if err != nil {
+		return nil, fmt.Errorf("Error decoding schemas response: %w", err)
+	}
+
+	if resp.Error != "" {
+		return nil, errors.New(resp.Error)
+	}
+
+	return resp.Schemas, nil
+}
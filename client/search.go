@@ -0,0 +1,40 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// DefaultSearchLimit is the number of nodes returned by a search if the
+// limit is not set
+const DefaultSearchLimit = 50
+
+// SearchRequest is sent to search for nodes. Query is a list of words, each
+// of which must be found in the node type, description, or text points of
+// a node. If Parent is set, only the parent and nodes below it are
+// returned.
+type SearchRequest struct {
+	Query  string `json:"query"`
+	Parent string `json:"parent,omitempty"`
+	Limit  int    `json:"limit,omitempty"`
+}
+
+// Search returns the nodes that match a search, best matches first. Words
+// in the node description score higher than words in other points.
+func Search(nc *nats.Conn, req SearchRequest) ([]data.NodeEdge, error) {
+	reqData, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	msg, err := nc.Request(SubjectSearch(), reqData, time.Second*20)
+	if err != nil {
+		return nil, fmt.Errorf("Error searching nodes: %w", err)
+	}
+
+	return data.PbDecodeNodesRequest(msg.Data)
+}
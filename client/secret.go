@@ -0,0 +1,69 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// SecretResponse is returned by the store for a secret request
+type SecretResponse struct {
+	Value string `json:"value"`
+	Error string `json:"error,omitempty"`
+}
+
+// GetSecret returns the decrypted value of a secret node
+func GetSecret(nc *nats.Conn, id string) (string, error) {
+	msg, err := nc.Request(SubjectSecret(id), nil, time.Second*5)
+	if err != nil {
+		return "", fmt.Errorf("Error getting secret %v: %w", id, err)
+	}
+
+	var resp SecretResponse
+	err = json.Unmarshal(msg.Data, &resp)
+	if err != nil {
+		return "", fmt.Errorf("Error decoding secret response: %w", err)
+	}
+
+	if resp.Error != "" {
+		return "", errors.New(resp.Error)
+	}
+
+	return resp.Value, nil
+}
+
+// ResolveSecrets returns a copy of points where the text of points that
+// reference a secret node (see data.SecretRef) is replaced by the secret
+// value. points is returned as is if there are no references.
+func ResolveSecrets(nc *nats.Conn, points data.Points) (data.Points, error) {
+	var ret data.Points
+
+	for i, p := range points {
+		id, ok := data.ParseSecretRef(p.Text)
+		if !ok {
+			continue
+		}
+
+		value, err := GetSecret(nc, id)
+		if err != nil {
+			return points, err
+		}
+
+		if ret == nil {
+			ret = make(data.Points, len(points))
+			copy(ret, points)
+		}
+
+		ret[i].Text = value
+	}
+
+	if ret == nil {
+		return points, nil
+	}
+
+	return ret, nil
+}
@@ -0,0 +1,504 @@
+package client
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// Sequencer runs its zones one at a time in Index order, for example to
+// sequence irrigation valves. A run is started by setting Run, or daily at
+// Start (HH:MM, UTC). Setting Run to false stops the run, and Advance skips
+// to the next zone. The active zone is paused while Pause is set or while the
+// RainPointType (defaults to value) point of RainNodeID is not zero.
+// ActiveZone (1 based), ZoneRemaining, and Remaining (seconds) report the
+// progress of the run, and are used to resume a run if the client restarts.
+type Sequencer struct {
+	ID            string          `node:"id"`
+	Parent        string          `node:"parent"`
+	Description   string          `point:"description"`
+	Start         string          `point:"start"`
+	RainNodeID    string          `point:"rainNodeID"`
+	RainPointType string          `point:"rainPointType"`
+	Run           bool            `point:"run"`
+	Pause         bool            `point:"pause"`
+	Advance       bool            `point:"advance"`
+	Disable       bool            `point:"disable"`
+	RainDelay     bool            `point:"rainDelay"`
+	ActiveZone    int             `point:"activeZone"`
+	ZoneRemaining float64         `point:"zoneRemaining"`
+	Remaining     float64         `point:"remaining"`
+	Zones         []SequencerZone `child:"sequencerZone"`
+}
+
+// SequencerZone sets the PointType (defaults to value) point of NodeID to 1
+// for Duration minutes. Zones that are disabled or have no duration are
+// skipped.
+type SequencerZone struct {
+	ID          string  `node:"id"`
+	Parent      string  `node:"parent"`
+	Description string  `point:"description"`
+	Index       int     `point:"index"`
+	NodeID      string  `point:"nodeID"`
+	PointType   string  `point:"pointType"`
+	Duration    float64 `point:"duration"`
+	Disable     bool    `point:"disable"`
+}
+
+func (z SequencerZone) duration() time.Duration {
+	return time.Duration(z.Duration * float64(time.Minute))
+}
+
+func (z SequencerZone) runnable() bool {
+	return !z.Disable && z.NodeID != "" && z.Duration > 0
+}
+
+func (z SequencerZone) pointType() string {
+	if z.PointType == "" {
+		return data.PointTypeValue
+	}
+	return z.PointType
+}
+
+// how often the sequencer updates remaining time and checks the start time
+var sequencerTickPeriod = time.Second
+
+// SequencerClient is a SIOT client that runs sequencer nodes
+type SequencerClient struct {
+	nc            *nats.Conn
+	config        Sequencer
+	stop          chan struct{}
+	newPoints     chan NewPoints
+	newEdgePoints chan NewPoints
+	newRain       chan bool
+	rainSub       *nats.Subscription
+	rain          bool
+	// zoneID is the active zone, blank if not running
+	zoneID        string
+	zoneRemaining time.Duration
+	// on is the zone with the output currently turned on
+	on            *SequencerZone
+	lastTick      time.Time
+	lastScheduled string
+	// time zone of the start time
+	loc *time.Location
+}
+
+// NewSequencerClient ...
+func NewSequencerClient(nc *nats.Conn, config Sequencer) Client {
+	return &SequencerClient{
+		nc:            nc,
+		config:        config,
+		stop:          make(chan struct{}),
+		newPoints:     make(chan NewPoints),
+		newEdgePoints: make(chan NewPoints),
+		newRain:       make(chan bool),
+	}
+}
+
+// Start runs the main logic for this client and blocks until stopped
+func (s *SequencerClient) Start() error {
+	log.Println("Starting sequencer client: ", s.config.Description)
+
+	var err error
+	s.loc, err = NodeLocation(s.nc, s.config.ID)
+	if err != nil {
+		log.Printf("Sequencer %v: %v\n", s.config.Description, err)
+	}
+
+	s.subscribeRain()
+
+	// resume a run that was in progress when the client stopped
+	if s.config.Run && !s.config.Disable {
+		zones := s.zones()
+		pos := s.config.ActiveZone - 1
+		if pos >= 0 && pos < len(zones) && zones[pos].runnable() {
+			s.zoneID = zones[pos].ID
+			s.zoneRemaining = time.Duration(s.config.ZoneRemaining * float64(time.Second))
+			if s.zoneRemaining <= 0 || s.zoneRemaining > zones[pos].duration() {
+				s.zoneRemaining = zones[pos].duration()
+			}
+			s.updateOutput()
+			s.sendState()
+		} else {
+			s.startRun()
+		}
+	}
+
+	ticker := time.NewTicker(sequencerTickPeriod)
+	defer ticker.Stop()
+
+	s.lastTick = time.Now()
+
+done:
+	for {
+		select {
+		case <-s.stop:
+			log.Println("Stopping sequencer client: ", s.config.Description)
+			break done
+		case now := <-ticker.C:
+			s.tick(now)
+		case rain := <-s.newRain:
+			if rain == s.rain {
+				continue
+			}
+			s.rain = rain
+			s.updateOutput()
+			s.sendPoint(data.Point{Type: data.PointTypeRainDelay,
+				Value: data.BoolToFloat(rain)})
+		case pts := <-s.newPoints:
+			err := data.MergePoints(pts.ID, pts.Points, &s.config)
+			if err != nil {
+				log.Println("error merging new points: ", err)
+			}
+
+			if pts.ID != s.config.ID {
+				// zone config changed
+				s.updateOutput()
+				continue
+			}
+
+			for _, p := range pts.Points {
+				switch p.Type {
+				case data.PointTypeRun:
+					if s.config.Run && s.zoneID == "" {
+						s.startRun()
+					} else if !s.config.Run && s.zoneID != "" {
+						s.endRun()
+					}
+				case data.PointTypeAdvance:
+					if s.config.Advance {
+						if s.zoneID != "" {
+							s.nextZone()
+						}
+						s.config.Advance = false
+						s.sendPoint(data.Point{Type: data.PointTypeAdvance, Value: 0})
+					}
+				case data.PointTypePause:
+					s.updateOutput()
+				case data.PointTypeDisable:
+					if s.config.Disable && s.zoneID != "" {
+						s.endRun()
+					}
+				case data.PointTypeRainNodeID, data.PointTypeRainPointType:
+					s.subscribeRain()
+				}
+			}
+		case pts := <-s.newEdgePoints:
+			err := data.MergeEdgePoints(pts.ID, pts.Parent, pts.Points, &s.config)
+			if err != nil {
+				log.Println("error merging new points: ", err)
+			}
+		}
+	}
+
+	// the run state is kept so the run resumes when the client restarts,
+	// but outputs are turned off while the client is not running
+	s.setOutput(nil)
+
+	if s.rainSub != nil {
+		s.rainSub.Unsubscribe()
+	}
+
+	return nil
+}
+
+// zones returns zones sorted by index
+func (s *SequencerClient) zones() []SequencerZone {
+	zones := make([]SequencerZone, len(s.config.Zones))
+	copy(zones, s.config.Zones)
+
+	sort.SliceStable(zones, func(i, j int) bool {
+		if zones[i].Index != zones[j].Index {
+			return zones[i].Index < zones[j].Index
+		}
+		return zones[i].Description < zones[j].Description
+	})
+
+	return zones
+}
+
+// activePos returns the position of the active zone in zones, or -1
+func (s *SequencerClient) activePos(zones []SequencerZone) int {
+	for i, z := range zones {
+		if z.ID == s.zoneID {
+			return i
+		}
+	}
+	return -1
+}
+
+func (s *SequencerClient) paused() bool {
+	return s.config.Pause || s.rain
+}
+
+func (s *SequencerClient) tick(now time.Time) {
+	elapsed := now.Sub(s.lastTick)
+	s.lastTick = now
+
+	if s.zoneID == "" {
+		s.checkStart(now)
+		return
+	}
+
+	if !s.paused() {
+		s.zoneRemaining -= elapsed
+		if s.zoneRemaining <= 0 {
+			s.nextZone()
+			return
+		}
+	}
+
+	s.sendState()
+}
+
+// checkStart starts a run if the start time is reached
+func (s *SequencerClient) checkStart(now time.Time) {
+	if s.config.Start == "" || s.config.Disable {
+		return
+	}
+
+	matches := reHourMin.FindStringSubmatch(s.config.Start)
+	if len(matches) < 3 {
+		return
+	}
+
+	hour, _ := strconv.Atoi(matches[1])
+
+	loc := s.loc
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	nowLoc := now.In(loc)
+	today := nowLoc.Format("2006-01-02")
+	if s.lastScheduled == today ||
+		fmt.Sprintf("%02d:%v", hour, matches[2]) != nowLoc.Format("15:04") {
+		return
+	}
+
+	s.lastScheduled = today
+	s.startRun()
+}
+
+// startRun starts a run at the first zone
+func (s *SequencerClient) startRun() {
+	if s.config.Disable {
+		return
+	}
+
+	if !s.config.Run {
+		s.config.Run = true
+		s.sendPoint(data.Point{Type: data.PointTypeRun, Value: 1})
+	}
+
+	s.zoneID = ""
+	s.activateNext(s.zones(), -1)
+}
+
+// nextZone turns off the active zone and starts the next one
+func (s *SequencerClient) nextZone() {
+	zones := s.zones()
+	s.activateNext(zones, s.activePos(zones))
+}
+
+// activateNext starts the first runnable zone after pos, or ends the run
+// if there are none
+func (s *SequencerClient) activateNext(zones []SequencerZone, pos int) {
+	for i := pos + 1; i < len(zones); i++ {
+		if zones[i].runnable() {
+			s.zoneID = zones[i].ID
+			s.zoneRemaining = zones[i].duration()
+			s.updateOutput()
+			s.sendState()
+			return
+		}
+	}
+
+	s.endRun()
+}
+
+// endRun turns off outputs and clears the run state
+func (s *SequencerClient) endRun() {
+	s.zoneID = ""
+	s.zoneRemaining = 0
+	s.updateOutput()
+
+	if s.config.Run {
+		s.config.Run = false
+		s.sendPoint(data.Point{Type: data.PointTypeRun, Value: 0})
+	}
+
+	s.sendState()
+}
+
+// updateOutput turns on the active zone output unless paused
+func (s *SequencerClient) updateOutput() {
+	if s.zoneID == "" || s.paused() {
+		s.setOutput(nil)
+		return
+	}
+
+	for _, z := range s.config.Zones {
+		if z.ID == s.zoneID {
+			z := z
+			s.setOutput(&z)
+			return
+		}
+	}
+
+	// active zone was removed
+	s.setOutput(nil)
+}
+
+// setOutput turns on the output of zone z and turns off any other output. If
+// z is nil, all outputs are turned off.
+func (s *SequencerClient) setOutput(z *SequencerZone) {
+	if s.on != nil {
+		if z != nil && z.ID == s.on.ID && z.NodeID == s.on.NodeID &&
+			z.pointType() == s.on.pointType() {
+			return
+		}
+
+		s.sendOutput(*s.on, false)
+		s.on = nil
+	}
+
+	if z != nil && z.NodeID != "" {
+		s.sendOutput(*z, true)
+		s.on = z
+	}
+}
+
+func (s *SequencerClient) sendOutput(z SequencerZone, on bool) {
+	err := SendNodePoint(s.nc, z.NodeID, data.Point{
+		Time:   time.Now(),
+		Type:   z.pointType(),
+		Value:  data.BoolToFloat(on),
+		Origin: s.config.ID,
+	}, true)
+	if err != nil {
+		log.Printf("Sequencer %v: error setting zone %v output: %v\n",
+			s.config.Description, z.Description, err)
+	}
+}
+
+// sendState sends the active zone and remaining time
+func (s *SequencerClient) sendState() {
+	zones := s.zones()
+	pos := s.activePos(zones)
+
+	remaining := time.Duration(0)
+	if pos >= 0 {
+		remaining = s.zoneRemaining
+		for _, z := range zones[pos+1:] {
+			if z.runnable() {
+				remaining += z.duration()
+			}
+		}
+	}
+
+	now := time.Now()
+	points := data.Points{
+		{Time: now, Type: data.PointTypeActiveZone, Value: float64(pos + 1)},
+		{Time: now, Type: data.PointTypeZoneRemaining,
+			Value: s.zoneRemaining.Round(time.Second).Seconds()},
+		{Time: now, Type: data.PointTypeRemaining,
+			Value: remaining.Round(time.Second).Seconds()},
+	}
+
+	err := SendNodePoints(s.nc, s.config.ID, points, false)
+	if err != nil {
+		log.Println("Sequencer: error sending state: ", err)
+	}
+}
+
+func (s *SequencerClient) sendPoint(p data.Point) {
+	p.Time = time.Now()
+	err := SendNodePoint(s.nc, s.config.ID, p, false)
+	if err != nil {
+		log.Println("Sequencer: error sending point: ", err)
+	}
+}
+
+// subscribeRain subscribes to the rain sensor point and gets its current
+// value
+func (s *SequencerClient) subscribeRain() {
+	if s.rainSub != nil {
+		s.rainSub.Unsubscribe()
+		s.rainSub = nil
+	}
+
+	rain := false
+	defer func() {
+		if rain != s.rain {
+			s.rain = rain
+			s.updateOutput()
+			s.sendPoint(data.Point{Type: data.PointTypeRainDelay,
+				Value: data.BoolToFloat(rain)})
+		}
+	}()
+
+	if s.config.RainNodeID == "" {
+		return
+	}
+
+	pointType := s.config.RainPointType
+	if pointType == "" {
+		pointType = data.PointTypeValue
+	}
+
+	var err error
+	s.rainSub, err = s.nc.Subscribe(SubjectNodePoints(s.config.RainNodeID), func(msg *nats.Msg) {
+		points, err := DecodePoints(msg)
+		if err != nil {
+			log.Println("Sequencer: error decoding rain points: ", err)
+			return
+		}
+
+		for _, p := range points {
+			if p.Type == pointType {
+				select {
+				case s.newRain <- p.Value != 0:
+				case <-s.stop:
+				}
+			}
+		}
+	})
+	if err != nil {
+		log.Printf("Sequencer %v: error subscribing to rain sensor: %v\n",
+			s.config.Description, err)
+	}
+
+	nodes, err := GetNode(s.nc, s.config.RainNodeID, "none")
+	if err != nil || len(nodes) < 1 {
+		log.Printf("Sequencer %v: error getting rain sensor: %v\n",
+			s.config.Description, err)
+		return
+	}
+
+	v, _ := nodes[0].Points.Value(pointType, "")
+	rain = v != 0
+}
+
+// Stop sends a signal to the Start function to exit
+func (s *SequencerClient) Stop(err error) {
+	close(s.stop)
+}
+
+// Points is called by the Manager when new points for this
+// node are received.
+func (s *SequencerClient) Points(nodeID string, points []data.Point) {
+	s.newPoints <- NewPoints{nodeID, "", points}
+}
+
+// EdgePoints is called by the Manager when new edge points for this
+// node are received.
+func (s *SequencerClient) EdgePoints(nodeID, parentID string, points []data.Point) {
+	s.newEdgePoints <- NewPoints{nodeID, parentID, points}
+}
@@ -0,0 +1,139 @@
+package client_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+	"github.com/simpleiot/simpleiot/server"
+)
+
+// waitPointValue waits for a node point to be set to v
+func waitPointValue(t *testing.T, nc *nats.Conn, id, typ string, v float64) {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	var cur float64
+
+	for {
+		nodes, err := client.GetNode(nc, id, "none")
+		if err != nil {
+			t.Fatal("Error getting node: ", err)
+		}
+
+		if len(nodes) > 0 {
+			cur, _ = nodes[0].Points.Value(typ, "")
+			if cur == v {
+				return
+			}
+		}
+
+		select {
+		case <-timeout:
+			t.Fatalf("Timeout waiting for %v %v to be %v, got %v", id, typ, v, cur)
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+}
+
+func TestSequencer(t *testing.T) {
+	nc, root, stop, err := server.TestServer()
+	if err != nil {
+		t.Fatal("Error starting test server: ", err)
+	}
+	defer stop()
+
+	for _, id := range []string{"z1", "z2", "rain"} {
+		err = client.SendNodeType(nc, client.Variable{ID: id, Parent: root.ID}, "test")
+		if err != nil {
+			t.Fatal("Error sending variable node: ", err)
+		}
+	}
+
+	err = client.SendNodeType(nc, client.Sequencer{
+		ID:          "seq",
+		Parent:      root.ID,
+		Description: "test sequencer",
+		RainNodeID:  "rain",
+	}, "test")
+	if err != nil {
+		t.Fatal("Error sending sequencer node: ", err)
+	}
+
+	// zones run in index order
+	zones := []client.SequencerZone{
+		{ID: "zone2", Parent: "seq", Index: 2, NodeID: "z2", Duration: 0.02},
+		{ID: "zone1", Parent: "seq", Index: 1, NodeID: "z1", Duration: 10},
+		{ID: "zone3", Parent: "seq", Index: 3, NodeID: "z1", Duration: 10,
+			Disable: true},
+	}
+
+	for _, z := range zones {
+		err = client.SendNodeType(nc, z, "test")
+		if err != nil {
+			t.Fatal("Error sending zone node: ", err)
+		}
+	}
+
+	// the client restarts as zones are added, so keep sending run until the
+	// first zone is on
+	timeout := time.After(5 * time.Second)
+	for on := 0.0; on == 0; {
+		select {
+		case <-timeout:
+			t.Fatal("Timeout waiting for run to start")
+		case <-time.After(200 * time.Millisecond):
+		}
+
+		err = client.SendNodePoint(nc, "seq", data.Point{Type: data.PointTypeRun,
+			Value: 1, Origin: "test"}, true)
+		if err != nil {
+			t.Fatal("Error starting run: ", err)
+		}
+
+		nodes, err := client.GetNode(nc, "z1", "none")
+		if err != nil || len(nodes) < 1 {
+			t.Fatal("Error getting node: ", err)
+		}
+		on, _ = nodes[0].Points.Value(data.PointTypeValue, "")
+	}
+
+	waitPointValue(t, nc, "seq", data.PointTypeActiveZone, 1)
+
+	// rain pauses the active zone
+	err = client.SendNodePoint(nc, "rain", data.Point{Type: data.PointTypeValue,
+		Value: 1}, true)
+	if err != nil {
+		t.Fatal("Error sending rain: ", err)
+	}
+
+	waitPointValue(t, nc, "z1", data.PointTypeValue, 0)
+	waitPointValue(t, nc, "seq", data.PointTypeRainDelay, 1)
+
+	err = client.SendNodePoint(nc, "rain", data.Point{Type: data.PointTypeValue,
+		Value: 0}, true)
+	if err != nil {
+		t.Fatal("Error sending rain: ", err)
+	}
+
+	waitPointValue(t, nc, "z1", data.PointTypeValue, 1)
+	waitPointValue(t, nc, "seq", data.PointTypeRainDelay, 0)
+
+	// advance to zone 2, which finishes the run after its duration. Zone 3 is
+	// disabled.
+	err = client.SendNodePoint(nc, "seq", data.Point{Type: data.PointTypeAdvance,
+		Value: 1, Origin: "test"}, true)
+	if err != nil {
+		t.Fatal("Error sending advance: ", err)
+	}
+
+	waitPointValue(t, nc, "z1", data.PointTypeValue, 0)
+	waitPointValue(t, nc, "z2", data.PointTypeValue, 1)
+	waitPointValue(t, nc, "seq", data.PointTypeAdvance, 0)
+
+	waitPointValue(t, nc, "z2", data.PointTypeValue, 0)
+	waitPointValue(t, nc, "seq", data.PointTypeRun, 0)
+	waitPointValue(t, nc, "seq", data.PointTypeActiveZone, 0)
+	waitPointValue(t, nc, "seq", data.PointTypeRemaining, 0)
+}
@@ -1,7 +1,6 @@
 package client
 
 import (
-	"fmt"
 	"io"
 	"log"
 	"strconv"
@@ -43,8 +42,6 @@ type SerialDevClient struct {
 	wrSeq         byte
 	lastSendStats time.Time
 	natsSub       string
-	natsSubHR     string
-	natsSubHRUp   string
 }
 
 // NewSerialDevClient ...
@@ -56,8 +53,6 @@ func NewSerialDevClient(nc *nats.Conn, config SerialDev) Client {
 		newPoints:     make(chan NewPoints),
 		newEdgePoints: make(chan NewPoints),
 		natsSub:       SubjectNodePoints(config.ID),
-		natsSubHR:     fmt.Sprintf("phr.%v", config.ID),
-		natsSubHRUp:   fmt.Sprintf("phrup.%v.%v", config.Parent, config.ID),
 	}
 }
 
@@ -273,15 +268,11 @@ func (sd *SerialDevClient) Start() error {
 			}
 
 			if hrData {
-				err = SendPoints(sd.nc, sd.natsSubHR, points, false)
+				err = SendHighRatePoints(sd.nc, sd.config.ID, points,
+					HighRateOptions{Parent: sd.config.Parent})
 				if err != nil {
 					log.Println("Error sending HR points received from MCU: ", err)
 				}
-
-				err = SendPoints(sd.nc, sd.natsSubHRUp, points, false)
-				if err != nil {
-					log.Println("Error sending HR Up points received from MCU: ", err)
-				}
 			}
 		case pts := <-sd.newPoints:
 			op := false
@@ -0,0 +1,114 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// Response types of the NATS services API
+const (
+	ServicePingType   = "io.nats.micro.v1.ping_response"
+	ServiceInfoType   = "io.nats.micro.v1.info_response"
+	ServiceStatsType  = "io.nats.micro.v1.stats_response"
+	ServiceSchemaType = "io.nats.micro.v1.schema_response"
+)
+
+// ServiceIdentity identifies a service instance in the responses of the
+// NATS services API. Each running store has a unique ID. The metadata of the
+// store includes the ID of its root node.
+type ServiceIdentity struct {
+	Type     string            `json:"type"`
+	Name     string            `json:"name"`
+	ID       string            `json:"id"`
+	Version  string            `json:"version"`
+	Metadata map[string]string `json:"metadata"`
+}
+
+// ServiceEndpointInfo describes an endpoint of a service
+type ServiceEndpointInfo struct {
+	Name       string            `json:"name"`
+	Subject    string            `json:"subject"`
+	QueueGroup string            `json:"queue_group,omitempty"`
+	Metadata   map[string]string `json:"metadata,omitempty"`
+}
+
+// ServiceInfo is the response to a service INFO request
+type ServiceInfo struct {
+	ServiceIdentity
+	Description string                `json:"description"`
+	Endpoints   []ServiceEndpointInfo `json:"endpoints"`
+}
+
+// ServiceEndpointStats are the request stats of an endpoint. Processing
+// times are in ns and are measured from when a request is received until
+// the store replies, so they include the time points wait to be written.
+type ServiceEndpointStats struct {
+	Name                  string        `json:"name"`
+	Subject               string        `json:"subject"`
+	QueueGroup            string        `json:"queue_group,omitempty"`
+	NumRequests           int           `json:"num_requests"`
+	NumErrors             int           `json:"num_errors"`
+	LastError             string        `json:"last_error"`
+	ProcessingTime        time.Duration `json:"processing_time"`
+	AverageProcessingTime time.Duration `json:"average_processing_time"`
+}
+
+// ServiceStats is the response to a service STATS request
+type ServiceStats struct {
+	ServiceIdentity
+	Started   time.Time              `json:"started"`
+	Endpoints []ServiceEndpointStats `json:"endpoints"`
+}
+
+// ServiceEndpointSchema describes the request and response encoding of an
+// endpoint
+type ServiceEndpointSchema struct {
+	Name    string `json:"name"`
+	Subject string `json:"subject"`
+	Schema  struct {
+		Request  string `json:"request"`
+		Response string `json:"response"`
+	} `json:"schema"`
+}
+
+// ServiceSchema is the response to a service SCHEMA request
+type ServiceSchema struct {
+	ServiceIdentity
+	APIURL    string                  `json:"api_url"`
+	Endpoints []ServiceEndpointSchema `json:"endpoints"`
+}
+
+// serviceRequest sends a NATS services API request to the store with id, or
+// the first store that answers if id is blank
+func serviceRequest(nc *nats.Conn, verb, id string, ret any) error {
+	msg, err := nc.Request(SubjectService(verb, id), nil, time.Second*5)
+	if err != nil {
+		return err
+	}
+
+	err = json.Unmarshal(msg.Data, ret)
+	if err != nil {
+		return errors.New(string(msg.Data))
+	}
+
+	return nil
+}
+
+// GetServiceInfo returns the endpoints of the store with id, or of the first
+// store that answers if id is blank
+func GetServiceInfo(nc *nats.Conn, id string) (ServiceInfo, error) {
+	var ret ServiceInfo
+	err := serviceRequest(nc, "INFO", id, &ret)
+	return ret, err
+}
+
+// GetServiceStats returns the request stats of the store with id, or of the
+// first store that answers if id is blank
+func GetServiceStats(nc *nats.Conn, id string) (ServiceStats, error) {
+	var ret ServiceStats
+	err := serviceRequest(nc, "STATS", id, &ret)
+	return ret, err
+}
@@ -0,0 +1,19 @@
+package client
+
+import (
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// SendDesiredPoints sends config points as desired points (see
+// data.DesiredPoint). The instance that owns the node applies them when it
+// receives them, so changes to devices that are offline are pending until
+// the device reconnects and reports the new values.
+func SendDesiredPoints(nc *nats.Conn, nodeID string, points data.Points, ack bool) error {
+	desired := make(data.Points, len(points))
+	for i, p := range points {
+		desired[i] = data.DesiredPoint(p)
+	}
+
+	return SendNodePoints(nc, nodeID, desired, ack)
+}
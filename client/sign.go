@@ -0,0 +1,182 @@
+package client
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// signer signs node points sent by this process, see SetSigningKey
+var signer struct {
+	lock       sync.RWMutex
+	keyID      string
+	key        ed25519.PrivateKey
+	pointTypes map[string]bool
+}
+
+// SetSigningKey sets the Ed25519 key used to sign node points sent by this
+// process with SendNodePoints. Messages that contain a point with one of
+// pointTypes are signed, unless they are already signed (for example when
+// they are forwarded from another instance). Changes to the signing policy
+// (signedPointTypes and signingKey points) are always signed. keyID
+// identifies the public key on the receiving instances (see the signingKey
+// point). A nil key disables signing.
+func SetSigningKey(keyID string, key ed25519.PrivateKey, pointTypes []string) {
+	signer.lock.Lock()
+	defer signer.lock.Unlock()
+
+	signer.keyID = keyID
+	signer.key = key
+	signer.pointTypes = map[string]bool{
+		data.PointTypeSignedPointTypes: true,
+		data.PointTypeSigningKey:       true,
+	}
+	for _, t := range pointTypes {
+		signer.pointTypes[t] = true
+	}
+}
+
+// signNodePoints signs points if a signing key is set and the points include
+// a point type that is signed
+func signNodePoints(nodeID string, points data.Points) data.Points {
+	signer.lock.RLock()
+	defer signer.lock.RUnlock()
+
+	if signer.key == nil {
+		return points
+	}
+
+	sign := false
+	for _, p := range points {
+		if p.Type == data.PointTypeSignature {
+			return points
+		}
+		if signer.pointTypes[p.Type] {
+			sign = true
+		}
+	}
+
+	if !sign {
+		return points
+	}
+
+	return data.SignPoints(nodeID, points, signer.pointTypes, signer.keyID, signer.key)
+}
+
+// how often clients read the signing policy from the root node
+var clientSigningCheckPeriod = time.Minute
+
+// signatures older than this are rejected by clients, as in the store
+var clientSignatureMaxAge = 5 * time.Minute
+
+// clientSigning is the signing policy used to verify points sent to clients.
+// The store verifies points before they are written, but points are verified
+// again when they are received on up subjects, so points published directly
+// to these subjects by another connection are not passed to clients.
+var clientSigning struct {
+	lock       sync.Mutex
+	check      time.Time
+	pointTypes map[string]bool
+	keys       map[string]ed25519.PublicKey
+	// nonces by client node ID, so clients that are restarted still reject
+	// replays
+	nonces map[string]*data.NonceCache
+}
+
+func clientSigningPolicy(nc *nats.Conn) (map[string]bool, map[string]ed25519.PublicKey) {
+	clientSigning.lock.Lock()
+	defer clientSigning.lock.Unlock()
+
+	if time.Since(clientSigning.check) < clientSigningCheckPeriod {
+		return clientSigning.pointTypes, clientSigning.keys
+	}
+
+	clientSigning.check = time.Now()
+
+	nodes, err := GetNode(nc, "root", "")
+	if err != nil || len(nodes) < 1 {
+		// the last policy is used until the root node can be read
+		log.Println("Error getting signing policy: ", err)
+		return clientSigning.pointTypes, clientSigning.keys
+	}
+
+	clientSigning.pointTypes, clientSigning.keys = data.SigningPolicy(nodes[0].Points)
+
+	return clientSigning.pointTypes, clientSigning.keys
+}
+
+// verifyClientPoints checks the signature of node points received by the
+// client with node ID clientID, if they include a point type that must be
+// signed
+func verifyClientPoints(nc *nats.Conn, clientID, nodeID string, points data.Points) error {
+	pointTypes, keys := clientSigningPolicy(nc)
+
+	signed := false
+	for _, p := range points {
+		if pointTypes[p.Type] {
+			signed = true
+			break
+		}
+	}
+
+	if !signed {
+		return nil
+	}
+
+	clientSigning.lock.Lock()
+	if clientSigning.nonces == nil {
+		clientSigning.nonces = make(map[string]*data.NonceCache)
+	}
+	nonces, ok := clientSigning.nonces[clientID]
+	if !ok {
+		nonces = data.NewNonceCache()
+		clientSigning.nonces[clientID] = nonces
+	}
+	clientSigning.lock.Unlock()
+
+	return data.VerifyPoints(nodeID, points, pointTypes, keys,
+		clientSignatureMaxAge, time.Now(), nonces)
+}
+
+// LoadSigningKey reads an Ed25519 private key from a file that contains the
+// base64 encoded key seed. If the file does not exist, a new key is
+// generated and saved to it.
+func LoadSigningKey(file string) (ed25519.PrivateKey, error) {
+	contents, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		_, key, err := ed25519.GenerateKey(nil)
+		if err != nil {
+			return nil, fmt.Errorf("Error generating signing key: %w", err)
+		}
+
+		seed := base64.StdEncoding.EncodeToString(key.Seed())
+		err = os.WriteFile(file, []byte(seed+"\n"), 0600)
+		if err != nil {
+			return nil, fmt.Errorf("Error saving signing key: %w", err)
+		}
+
+		return key, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("Error reading signing key: %w", err)
+	}
+
+	seed, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(contents)))
+	if err != nil {
+		return nil, fmt.Errorf("Error decoding signing key: %w", err)
+	}
+
+	if len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("signing key must be a %v byte seed", ed25519.SeedSize)
+	}
+
+	return ed25519.NewKeyFromSeed(seed), nil
+}
@@ -0,0 +1,66 @@
+package client
+
+import (
+	"crypto/ed25519"
+	"testing"
+	"time"
+
+	"github.com/simpleiot/simpleiot/data"
+)
+
+func TestVerifyClientPoints(t *testing.T) {
+	pub, key, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal("Error generating key: ", err)
+	}
+
+	// set the policy so it is not read from the root node
+	clientSigning.lock.Lock()
+	clientSigning.check = time.Now()
+	clientSigning.pointTypes, clientSigning.keys = data.SigningPolicy(data.Points{
+		{Type: data.PointTypeSignedPointTypes, Text: data.PointTypeValueSet},
+		{Type: data.PointTypeSigningKey, Key: "k1", Text: data.EncodeSigningKey(pub)},
+	})
+	clientSigning.lock.Unlock()
+
+	defer func() {
+		clientSigning.lock.Lock()
+		clientSigning.check = time.Time{}
+		clientSigning.pointTypes, clientSigning.keys = nil, nil
+		clientSigning.lock.Unlock()
+	}()
+
+	valueSet := data.Points{{Time: time.Now(), Type: data.PointTypeValueSet, Value: 1}}
+
+	err = verifyClientPoints(nil, "c1", "n1", valueSet)
+	if err == nil {
+		t.Fatal("Unsigned point was accepted")
+	}
+
+	signed := data.SignPoints("n1", valueSet, nil, "k1", key)
+	// the store adds points that are not signed
+	forwarded := append(signed, data.Point{Time: time.Now(),
+		Type: data.PointTypeCommandState, Text: "pending"})
+
+	err = verifyClientPoints(nil, "c1", "n1", forwarded)
+	if err != nil {
+		t.Fatal("Signed point was rejected: ", err)
+	}
+
+	err = verifyClientPoints(nil, "c1", "n1", forwarded)
+	if err == nil {
+		t.Fatal("Replayed point was accepted")
+	}
+
+	// another client receives the same points
+	err = verifyClientPoints(nil, "c2", "n1", forwarded)
+	if err != nil {
+		t.Fatal("Signed point was rejected by another client: ", err)
+	}
+
+	err = verifyClientPoints(nil, "c1", "n1",
+		data.Points{{Time: time.Now(), Type: data.PointTypeValue, Value: 1}})
+	if err != nil {
+		t.Fatal("Point that does not need a signature was rejected: ", err)
+	}
+}
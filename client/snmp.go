@@ -0,0 +1,601 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gosnmp/gosnmp"
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// Snmp polls the OIDs of its IO children from the SNMP agent at Address
+// (host or host:port, port 161 by default) every PollPeriod ms. SnmpVersion
+// is 2c (default) or 3. SNMPv3 requests are sent as Username, authenticated
+// with AuthProtocol (MD5 or SHA) and Pass, and encrypted with PrivProtocol
+// (DES or AES) and PrivPass. If TrapPort is set, traps received on that UDP
+// port are sent as trap points.
+type Snmp struct {
+	ID           string   `node:"id"`
+	Parent       string   `node:"parent"`
+	Description  string   `point:"description"`
+	Address      string   `point:"address"`
+	SnmpVersion  string   `point:"snmpVersion"`
+	Community    string   `point:"community"`
+	Username     string   `point:"username"`
+	AuthProtocol string   `point:"authProtocol"`
+	Pass         string   `point:"pass"`
+	PrivProtocol string   `point:"privProtocol"`
+	PrivPass     string   `point:"privPass"`
+	PollPeriod   int      `point:"pollPeriod"`
+	TrapPort     int      `point:"trapPort"`
+	Disable      bool     `point:"disable"`
+	ErrorCount   int      `point:"errorCount"`
+	IOs          []SnmpIO `child:"snmpIo"`
+}
+
+// SnmpIO maps the variable with OID (for example 1.3.6.1.2.1.1.3.0) to the
+// value point. Numeric variables are sent as the point value, and octet
+// strings, OIDs, and IP addresses as the point text.
+type SnmpIO struct {
+	ID          string  `node:"id"`
+	Parent      string  `node:"parent"`
+	Description string  `point:"description"`
+	OID         string  `point:"oid"`
+	Value       float64 `point:"value"`
+	Disable     bool    `point:"disable"`
+}
+
+// how long to wait before reconnecting
+var snmpRetryPeriod = 10 * time.Second
+
+// SnmpClient is a SIOT client that polls SNMP agents and receives traps
+type SnmpClient struct {
+	nc            *nats.Conn
+	config        Snmp
+	stop          chan struct{}
+	newPoints     chan NewPoints
+	newEdgePoints chan NewPoints
+	conn          *gosnmp.GoSNMP
+	traps         *gosnmp.TrapListener
+	// trap points received by the trap listener
+	trapPoints chan data.Point
+	// IOs that are polled
+	polled []snmpIO
+	// last point sent for each IO
+	values map[string]data.Point
+}
+
+type snmpIO struct {
+	id  string
+	oid string
+}
+
+// NewSnmpClient ...
+func NewSnmpClient(nc *nats.Conn, config Snmp) Client {
+	return &SnmpClient{
+		nc:            nc,
+		config:        config,
+		stop:          make(chan struct{}),
+		newPoints:     make(chan NewPoints),
+		newEdgePoints: make(chan NewPoints),
+		trapPoints:    make(chan data.Point, 100),
+	}
+}
+
+// Start runs the main logic for this client and blocks until stopped
+func (s *SnmpClient) Start() error {
+	log.Println("Starting SNMP client: ", s.config.Description)
+
+	retry := time.NewTimer(0)
+	defer retry.Stop()
+
+	poll := time.NewTicker(time.Hour)
+	defer poll.Stop()
+
+	reconnect := func() {
+		s.disconnect()
+		retry.Reset(0)
+	}
+
+done:
+	for {
+		select {
+		case <-s.stop:
+			log.Println("Stopping SNMP client: ", s.config.Description)
+			break done
+		case <-retry.C:
+			s.disconnect()
+
+			if s.config.Disable {
+				break
+			}
+
+			err := s.connect()
+			if err != nil {
+				log.Printf("SNMP %v: error connecting: %v\n",
+					s.config.Description, err)
+				s.error()
+				s.disconnect()
+				retry.Reset(snmpRetryPeriod)
+				break
+			}
+
+			period := s.config.PollPeriod
+			if period <= 0 {
+				period = 5000
+			}
+			poll.Reset(time.Duration(period) * time.Millisecond)
+		case <-poll.C:
+			if s.conn != nil {
+				s.poll()
+			}
+		case p := <-s.trapPoints:
+			err := SendNodePoint(s.nc, s.config.ID, p, false)
+			if err != nil {
+				log.Println("SNMP: error sending trap: ", err)
+			}
+		case pts := <-s.newPoints:
+			err := data.MergePoints(pts.ID, pts.Points, &s.config)
+			if err != nil {
+				log.Println("error merging new points: ", err)
+			}
+
+			for _, p := range pts.Points {
+				switch p.Type {
+				case data.PointTypeAddress, data.PointTypeSnmpVersion,
+					data.PointTypeCommunity, data.PointTypeUsername,
+					data.PointTypeAuthProtocol, data.PointTypePass,
+					data.PointTypePrivProtocol, data.PointTypePrivPass,
+					data.PointTypePollPeriod, data.PointTypeTrapPort,
+					data.PointTypeDisable, data.PointTypeOID:
+					reconnect()
+				}
+			}
+		case pts := <-s.newEdgePoints:
+			err := data.MergeEdgePoints(pts.ID, pts.Parent, pts.Points, &s.config)
+			if err != nil {
+				log.Println("error merging new points: ", err)
+			}
+		}
+	}
+
+	s.disconnect()
+
+	return nil
+}
+
+// snmpParams returns the gosnmp parameters of the config. The address is
+// not set.
+func snmpParams(config Snmp) (*gosnmp.GoSNMP, error) {
+	ret := &gosnmp.GoSNMP{
+		Port:      161,
+		Community: config.Community,
+		Timeout:   3 * time.Second,
+		Retries:   2,
+		MaxOids:   gosnmp.MaxOids,
+	}
+
+	if ret.Community == "" {
+		ret.Community = "public"
+	}
+
+	switch config.SnmpVersion {
+	case "", "2c":
+		ret.Version = gosnmp.Version2c
+		return ret, nil
+	case "3":
+		ret.Version = gosnmp.Version3
+	default:
+		return nil, fmt.Errorf("unsupported SNMP version: %v", config.SnmpVersion)
+	}
+
+	if config.Username == "" {
+		return nil, errors.New("user is required for SNMPv3")
+	}
+
+	usm := &gosnmp.UsmSecurityParameters{
+		UserName:                 config.Username,
+		AuthenticationProtocol:   gosnmp.NoAuth,
+		AuthenticationPassphrase: config.Pass,
+		PrivacyProtocol:          gosnmp.NoPriv,
+		PrivacyPassphrase:        config.PrivPass,
+	}
+
+	switch strings.ToUpper(config.AuthProtocol) {
+	case "":
+	case "MD5":
+		usm.AuthenticationProtocol = gosnmp.MD5
+	case "SHA":
+		usm.AuthenticationProtocol = gosnmp.SHA
+	default:
+		return nil, fmt.Errorf("unsupported SNMP auth protocol: %v", config.AuthProtocol)
+	}
+
+	switch strings.ToUpper(config.PrivProtocol) {
+	case "":
+	case "DES":
+		usm.PrivacyProtocol = gosnmp.DES
+	case "AES":
+		usm.PrivacyProtocol = gosnmp.AES
+	default:
+		return nil, fmt.Errorf("unsupported SNMP privacy protocol: %v", config.PrivProtocol)
+	}
+
+	if usm.AuthenticationProtocol != gosnmp.NoAuth && len(config.Pass) < 8 {
+		return nil, errors.New("SNMP auth password must be at least 8 characters")
+	}
+
+	if usm.PrivacyProtocol != gosnmp.NoPriv && len(config.PrivPass) < 8 {
+		return nil, errors.New("SNMP privacy password must be at least 8 characters")
+	}
+
+	switch {
+	case usm.PrivacyProtocol != gosnmp.NoPriv:
+		if usm.AuthenticationProtocol == gosnmp.NoAuth {
+			return nil, errors.New("SNMP privacy requires authentication")
+		}
+		ret.MsgFlags = gosnmp.AuthPriv
+	case usm.AuthenticationProtocol != gosnmp.NoAuth:
+		ret.MsgFlags = gosnmp.AuthNoPriv
+	default:
+		ret.MsgFlags = gosnmp.NoAuthNoPriv
+	}
+
+	ret.SecurityModel = gosnmp.UserSecurityModel
+	ret.SecurityParameters = usm
+
+	return ret, nil
+}
+
+// snmpOID checks an OID in the 1.3.6.1.2.1.1.3.0 format and returns it in
+// the format used by gosnmp, with a leading dot
+func snmpOID(oid string) (string, error) {
+	oid = strings.TrimPrefix(oid, ".")
+
+	parts := strings.Split(oid, ".")
+	if len(parts) < 2 {
+		return "", fmt.Errorf("invalid OID: %v", oid)
+	}
+
+	for _, p := range parts {
+		_, err := strconv.ParseUint(p, 10, 32)
+		if err != nil {
+			return "", fmt.Errorf("invalid OID: %v", oid)
+		}
+	}
+
+	return "." + oid, nil
+}
+
+// connect creates the SNMP client and trap listener and reads the initial
+// values
+func (s *SnmpClient) connect() error {
+	s.values = make(map[string]data.Point)
+	s.polled = nil
+
+	params, err := snmpParams(s.config)
+	if err != nil {
+		return err
+	}
+
+	for _, io := range s.config.IOs {
+		if io.Disable {
+			continue
+		}
+
+		oid, err := snmpOID(io.OID)
+		if err != nil {
+			log.Printf("SNMP %v: %v: %v\n", s.config.Description,
+				io.Description, err)
+			s.error()
+			continue
+		}
+
+		s.polled = append(s.polled, snmpIO{io.ID, oid})
+	}
+
+	if s.config.TrapPort > 0 {
+		// the listener has its own parameters, as it runs concurrently
+		// with requests
+		trapParams, _ := snmpParams(s.config)
+		s.traps, err = snmpListenTraps(fmt.Sprintf(":%v", s.config.TrapPort),
+			trapParams, s.trapPoints)
+		if err != nil {
+			return fmt.Errorf("error listening for traps: %w", err)
+		}
+	}
+
+	if s.config.Address == "" {
+		// only receives traps
+		return nil
+	}
+
+	params.Target = s.config.Address
+	if host, port, err := net.SplitHostPort(s.config.Address); err == nil {
+		p, err := strconv.ParseUint(port, 10, 16)
+		if err != nil {
+			return fmt.Errorf("invalid port: %v", port)
+		}
+		params.Target, params.Port = host, uint16(p)
+	}
+
+	err = params.Connect()
+	if err != nil {
+		return err
+	}
+
+	s.conn = params
+
+	s.poll()
+
+	return nil
+}
+
+func (s *SnmpClient) disconnect() {
+	if s.conn != nil {
+		s.conn.Conn.Close()
+	}
+
+	if s.traps != nil {
+		s.traps.Close()
+	}
+
+	s.conn = nil
+	s.traps = nil
+}
+
+func (s *SnmpClient) error() {
+	s.config.ErrorCount++
+	err := SendNodePoint(s.nc, s.config.ID, data.Point{
+		Time:  time.Now(),
+		Type:  data.PointTypeErrorCount,
+		Value: float64(s.config.ErrorCount),
+	}, false)
+	if err != nil {
+		log.Println("SNMP: error sending error count: ", err)
+	}
+}
+
+// poll reads the IOs and sends the values that changed. The IOs are read
+// in requests of at most gosnmp.MaxOids variables.
+func (s *SnmpClient) poll() {
+	now := time.Now()
+
+	for start := 0; start < len(s.polled); start += s.conn.MaxOids {
+		end := start + s.conn.MaxOids
+		if end > len(s.polled) {
+			end = len(s.polled)
+		}
+
+		oids := make([]string, end-start)
+		for i, io := range s.polled[start:end] {
+			oids[i] = io.oid
+		}
+
+		resp, err := s.conn.Get(oids)
+		if err != nil {
+			log.Printf("SNMP %v: error reading: %v\n", s.config.Description, err)
+			s.error()
+			return
+		}
+
+		if resp.Error != gosnmp.NoError {
+			log.Printf("SNMP %v: error reading: %v (index %v)\n",
+				s.config.Description, resp.Error, resp.ErrorIndex)
+			s.error()
+			continue
+		}
+
+		for i, v := range resp.Variables {
+			if i >= end-start {
+				break
+			}
+
+			io := s.polled[start+i]
+
+			p, ok := snmpPoint(v, now)
+			if !ok {
+				log.Printf("SNMP %v: %v: unsupported value: %v\n",
+					s.config.Description, io.oid, v.Type)
+				s.error()
+				continue
+			}
+
+			if last, ok := s.values[io.id]; ok && last.Value == p.Value &&
+				last.Text == p.Text {
+				continue
+			}
+
+			s.values[io.id] = p
+
+			err := SendNodePoint(s.nc, io.id, p, false)
+			if err != nil {
+				log.Println("SNMP: error sending value: ", err)
+			}
+		}
+	}
+}
+
+// Stop sends a signal to the Start function to exit
+func (s *SnmpClient) Stop(err error) {
+	close(s.stop)
+}
+
+// Points is called by the Manager when new points for this
+// node are received.
+func (s *SnmpClient) Points(nodeID string, points []data.Point) {
+	s.newPoints <- NewPoints{nodeID, "", points}
+}
+
+// EdgePoints is called by the Manager when new edge points for this
+// node are received.
+func (s *SnmpClient) EdgePoints(nodeID, parentID string, points []data.Point) {
+	s.newEdgePoints <- NewPoints{nodeID, parentID, points}
+}
+
+// snmpListenTraps listens for traps and informs on addr and sends them to
+// points as trap points. If params is SNMPv3, only SNMPv3 traps from its
+// user are accepted, otherwise SNMPv1 and SNMPv2c traps with its community.
+// Traps received while points is full are dropped. The listener is ready when it is returned.
+func snmpListenTraps(addr string, params *gosnmp.GoSNMP, points chan<- data.Point) (*gosnmp.TrapListener, error) {
+	l := gosnmp.NewTrapListener()
+	l.Params = params
+	l.OnNewTrap = func(packet *gosnmp.SnmpPacket, from *net.UDPAddr) {
+		if params.Version == gosnmp.Version3 {
+			// gosnmp authenticates traps with the keys of the listener,
+			// but does not check the user
+			usm, ok := packet.SecurityParameters.(*gosnmp.UsmSecurityParameters)
+			if packet.Version != gosnmp.Version3 || !ok ||
+				usm.UserName != params.SecurityParameters.(*gosnmp.UsmSecurityParameters).UserName {
+				return
+			}
+		} else if packet.Version == gosnmp.Version3 || packet.Community != params.Community {
+			return
+		}
+
+		p, ok := snmpTrapPoint(packet, from, time.Now())
+		if !ok {
+			return
+		}
+
+		select {
+		case points <- p:
+		default:
+		}
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- l.Listen(addr)
+	}()
+
+	select {
+	case <-l.Listening():
+		return l, nil
+	case err := <-errs:
+		return nil, err
+	}
+}
+
+// snmpPoint converts a variable to a value point. Numeric variables are
+// sent as the point value, others as text. Exceptions such as noSuchObject
+// are not converted.
+func snmpPoint(v gosnmp.SnmpPDU, now time.Time) (data.Point, bool) {
+	p := data.Point{
+		Time: now,
+		Type: data.PointTypeValue,
+	}
+
+	switch v.Type {
+	case gosnmp.NoSuchObject, gosnmp.NoSuchInstance, gosnmp.EndOfMibView,
+		gosnmp.Null:
+		return p, false
+	case gosnmp.Integer, gosnmp.Counter32, gosnmp.Gauge32, gosnmp.TimeTicks,
+		gosnmp.Counter64, gosnmp.Uinteger32:
+		p.Value, _ = new(big.Float).SetInt(gosnmp.ToBigInt(v.Value)).Float64()
+	case gosnmp.OpaqueFloat, gosnmp.OpaqueDouble:
+		switch x := v.Value.(type) {
+		case float32:
+			p.Value = float64(x)
+		case float64:
+			p.Value = x
+		}
+	default:
+		if v.Value == nil {
+			return p, false
+		}
+		p.Text = snmpText(v)
+	}
+
+	return p, true
+}
+
+// snmpText returns the value of a variable as text. Printable octet strings
+// are returned as is, other octet strings in hex. OIDs are returned without
+// the leading dot.
+func snmpText(v gosnmp.SnmpPDU) string {
+	switch x := v.Value.(type) {
+	case []byte:
+		for _, c := range x {
+			if (c < 0x20 || c > 0x7e) && c != '\n' && c != '\r' && c != '\t' {
+				return fmt.Sprintf("%x", x)
+			}
+		}
+		return string(x)
+	case string:
+		if v.Type == gosnmp.ObjectIdentifier {
+			return strings.TrimPrefix(x, ".")
+		}
+		return x
+	default:
+		return fmt.Sprint(x)
+	}
+}
+
+const (
+	snmpOIDSysUpTime   = ".1.3.6.1.2.1.1.3.0"
+	snmpOIDSnmpTrapOID = ".1.3.6.1.6.3.1.1.4.1.0"
+	// SNMPv1 generic traps are converted to OIDs under snmpTraps
+	snmpOIDSnmpTraps = "1.3.6.1.6.3.1.1.5"
+)
+
+// snmpTrapPoint converts a trap or inform to a trap point. The key is the
+// address of the sender and the text has the trap OID and variables.
+// SNMPv1 traps are converted to the SNMPv2 format (RFC 3584 3.1), and
+// sysUpTime and snmpTrapOID are not included in the variables.
+func snmpTrapPoint(packet *gosnmp.SnmpPacket, from *net.UDPAddr, now time.Time) (data.Point, bool) {
+	oid := ""
+	var vars []string
+
+	if packet.Version == gosnmp.Version1 {
+		if packet.GenericTrap < 6 {
+			oid = fmt.Sprintf("%v.%v", snmpOIDSnmpTraps, packet.GenericTrap+1)
+		} else {
+			oid = fmt.Sprintf("%v.0.%v", strings.TrimPrefix(packet.Enterprise, "."),
+				packet.SpecificTrap)
+		}
+	} else if packet.PDUType != gosnmp.SNMPv2Trap && packet.PDUType != gosnmp.InformRequest {
+		return data.Point{}, false
+	}
+
+	for _, v := range packet.Variables {
+		switch v.Name {
+		case snmpOIDSysUpTime:
+		case snmpOIDSnmpTrapOID:
+			if s, ok := v.Value.(string); ok {
+				oid = strings.TrimPrefix(s, ".")
+			}
+		default:
+			vars = append(vars, fmt.Sprintf("%v=%v",
+				strings.TrimPrefix(v.Name, "."), snmpText(v)))
+		}
+	}
+
+	if oid == "" {
+		return data.Point{}, false
+	}
+
+	key := ""
+	if from != nil {
+		key = from.IP.String()
+	}
+
+	text := oid
+	if len(vars) > 0 {
+		text += " " + strings.Join(vars, " ")
+	}
+
+	return data.Point{
+		Time: now,
+		Type: data.PointTypeTrap,
+		Key:  key,
+		Text: text,
+	}, true
+}
@@ -0,0 +1,233 @@
+package client
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/gosnmp/gosnmp"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+func TestSnmpPoint(t *testing.T) {
+	now := time.Now()
+
+	p, ok := snmpPoint(gosnmp.SnmpPDU{Type: gosnmp.Gauge32, Value: uint(42)}, now)
+	if !ok || p.Value != 42 || p.Text != "" || !p.Time.Equal(now) {
+		t.Error("gauge got ", p, ok)
+	}
+
+	p, ok = snmpPoint(gosnmp.SnmpPDU{Type: gosnmp.Counter64, Value: uint64(1 << 40)}, now)
+	if !ok || p.Value != 1<<40 {
+		t.Error("counter64 got ", p, ok)
+	}
+
+	p, ok = snmpPoint(gosnmp.SnmpPDU{Type: gosnmp.OctetString, Value: []byte("eth0")}, now)
+	if !ok || p.Text != "eth0" {
+		t.Error("octet string got ", p, ok)
+	}
+
+	p, ok = snmpPoint(gosnmp.SnmpPDU{Type: gosnmp.OctetString, Value: []byte{0, 0x1b}}, now)
+	if !ok || p.Text != "001b" {
+		t.Error("binary octet string got ", p, ok)
+	}
+
+	p, ok = snmpPoint(gosnmp.SnmpPDU{Type: gosnmp.ObjectIdentifier,
+		Value: ".1.3.6.1.4.1.8072.3.2.10"}, now)
+	if !ok || p.Text != "1.3.6.1.4.1.8072.3.2.10" {
+		t.Error("OID got ", p, ok)
+	}
+
+	_, ok = snmpPoint(gosnmp.SnmpPDU{Type: gosnmp.NoSuchObject}, now)
+	if ok {
+		t.Error("exceptions should not be converted")
+	}
+}
+
+func TestSnmpTrapPoint(t *testing.T) {
+	p, ok := snmpTrapPoint(&gosnmp.SnmpPacket{
+		Version: gosnmp.Version2c,
+		PDUType: gosnmp.SNMPv2Trap,
+		Variables: []gosnmp.SnmpPDU{
+			{Name: ".1.3.6.1.2.1.1.3.0", Type: gosnmp.TimeTicks, Value: uint32(100)},
+			{Name: ".1.3.6.1.6.3.1.1.4.1.0", Type: gosnmp.ObjectIdentifier,
+				Value: ".1.3.6.1.6.3.1.1.5.3"},
+			{Name: ".1.3.6.1.2.1.2.2.1.1.2", Type: gosnmp.Integer, Value: 2},
+		},
+	}, &net.UDPAddr{IP: net.IPv4(10, 0, 0, 2), Port: 1024}, time.Now())
+
+	if !ok || p.Type != data.PointTypeTrap || p.Key != "10.0.0.2" ||
+		p.Text != "1.3.6.1.6.3.1.1.5.3 1.3.6.1.2.1.2.2.1.1.2=2" {
+		t.Errorf("got %+v", p)
+	}
+
+	// SNMPv1 link down
+	p, ok = snmpTrapPoint(&gosnmp.SnmpPacket{
+		Version: gosnmp.Version1,
+		PDUType: gosnmp.Trap,
+		SnmpTrap: gosnmp.SnmpTrap{
+			Enterprise:  ".1.3.6.1.4.1.8072",
+			GenericTrap: 2,
+		},
+	}, nil, time.Now())
+
+	if !ok || p.Text != "1.3.6.1.6.3.1.1.5.3" {
+		t.Errorf("v1 got %+v", p)
+	}
+}
+
+func TestSnmpParams(t *testing.T) {
+	g, err := snmpParams(Snmp{})
+	if err != nil || g.Version != gosnmp.Version2c || g.Community != "public" {
+		t.Error("default got ", g, err)
+	}
+
+	g, err = snmpParams(Snmp{SnmpVersion: "3", Username: "admin",
+		AuthProtocol: "sha", Pass: "authpass", PrivProtocol: "aes",
+		PrivPass: "privpass"})
+	if err != nil || g.Version != gosnmp.Version3 || g.MsgFlags != gosnmp.AuthPriv {
+		t.Error("v3 got ", g, err)
+	}
+
+	_, err = snmpParams(Snmp{SnmpVersion: "3", Username: "admin",
+		PrivProtocol: "des", PrivPass: "privpass"})
+	if err == nil {
+		t.Error("privacy without authentication should fail")
+	}
+
+	_, err = snmpParams(Snmp{SnmpVersion: "1"})
+	if err == nil {
+		t.Error("version 1 should fail")
+	}
+}
+
+func TestSnmpListenTraps(t *testing.T) {
+	params, err := snmpParams(Snmp{Community: "siot"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	points := make(chan data.Point, 10)
+
+	l, err := snmpListenTraps("127.0.0.1:16162", params, points)
+	if err != nil {
+		t.Fatal("listen: ", err)
+	}
+	defer l.Close()
+
+	trap := gosnmp.SnmpTrap{
+		Variables: []gosnmp.SnmpPDU{
+			{Name: ".1.3.6.1.6.3.1.1.4.1.0", Type: gosnmp.ObjectIdentifier,
+				Value: ".1.3.6.1.6.3.1.1.5.3"},
+		},
+	}
+
+	for _, community := range []string{"wrong", "siot"} {
+		sender := &gosnmp.GoSNMP{
+			Target:    "127.0.0.1",
+			Port:      16162,
+			Community: community,
+			Version:   gosnmp.Version2c,
+			Timeout:   time.Second,
+		}
+
+		err = sender.Connect()
+		if err != nil {
+			t.Fatal("connect: ", err)
+		}
+
+		_, err = sender.SendTrap(trap)
+		sender.Conn.Close()
+		if err != nil {
+			t.Fatal("send trap: ", err)
+		}
+	}
+
+	select {
+	case p := <-points:
+		if p.Key != "127.0.0.1" || p.Text != "1.3.6.1.6.3.1.1.5.3" {
+			t.Errorf("got %+v", p)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timeout waiting for trap")
+	}
+
+	select {
+	case p := <-points:
+		t.Error("trap with wrong community received: ", p)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestSnmpListenTrapsV3(t *testing.T) {
+	config := Snmp{SnmpVersion: "3", Username: "admin", AuthProtocol: "SHA",
+		Pass: "authpass", PrivProtocol: "AES", PrivPass: "privpass"}
+
+	params, err := snmpParams(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	points := make(chan data.Point, 10)
+
+	l, err := snmpListenTraps("127.0.0.1:16163", params, points)
+	if err != nil {
+		t.Fatal("listen: ", err)
+	}
+	defer l.Close()
+
+	wrongPass := config
+	wrongPass.Pass = "wrongpass"
+
+	tests := []struct {
+		name   string
+		config Snmp
+		ok     bool
+	}{
+		{"v2c", Snmp{}, false},
+		{"wrong password", wrongPass, false},
+		{"valid", config, true},
+	}
+
+	for _, test := range tests {
+		sender, err := snmpParams(test.config)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		sender.Target = "127.0.0.1"
+		sender.Port = 16163
+		if usm, ok := sender.SecurityParameters.(*gosnmp.UsmSecurityParameters); ok {
+			// the sender of a trap is the authoritative engine
+			usm.AuthoritativeEngineID = "\x80\x00\x1f\x88\x04siot"
+			usm.AuthoritativeEngineBoots = 1
+		}
+
+		err = sender.Connect()
+		if err != nil {
+			t.Fatal("connect: ", err)
+		}
+
+		_, err = sender.SendTrap(gosnmp.SnmpTrap{
+			Variables: []gosnmp.SnmpPDU{
+				{Name: ".1.3.6.1.6.3.1.1.4.1.0", Type: gosnmp.ObjectIdentifier,
+					Value: ".1.3.6.1.6.3.1.1.5.3"},
+			},
+		})
+		sender.Conn.Close()
+		if err != nil {
+			t.Fatal("send trap: ", err)
+		}
+
+		select {
+		case p := <-points:
+			if !test.ok {
+				t.Errorf("%v: trap should be dropped, got %+v", test.name, p)
+			}
+		case <-time.After(500 * time.Millisecond):
+			if test.ok {
+				t.Errorf("%v: timeout waiting for trap", test.name)
+			}
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package client
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// spoolEntry is a batch of points waiting to be sent
+type spoolEntry struct {
+	name   string
+	format string
+	count  int
+	size   int64
+	// data is only set for memory spools
+	data []byte
+}
+
+// spool is a FIFO queue of encoded point batches. If dir is set, each batch
+// is stored in a file so that batches are kept across restarts, otherwise
+// batches are kept in memory. Once the spool is larger than maxBytes, the
+// oldest batches are dropped.
+type spool struct {
+	dir      string
+	maxBytes int64
+	entries  []spoolEntry
+	size     int64
+	lastSeq  int64
+}
+
+// newSpool creates a spool and loads any batches left in dir
+func newSpool(dir string, maxBytes int64) (*spool, error) {
+	s := &spool{dir: dir, maxBytes: maxBytes}
+
+	if dir == "" {
+		return s, nil
+	}
+
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, fmt.Errorf("Error creating spool dir: %w", err)
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading spool dir: %w", err)
+	}
+
+	for _, f := range files {
+		e, ok := parseSpoolName(f.Name())
+		if !ok || f.IsDir() {
+			continue
+		}
+
+		info, err := f.Info()
+		if err != nil {
+			continue
+		}
+
+		e.size = info.Size()
+		s.entries = append(s.entries, e)
+		s.size += e.size
+	}
+
+	sort.Slice(s.entries, func(i, j int) bool {
+		return s.entries[i].name < s.entries[j].name
+	})
+
+	return s, nil
+}
+
+// spool files are named <sequence>-<point count>.<format>
+func parseSpoolName(name string) (spoolEntry, bool) {
+	ext := filepath.Ext(name)
+	parts := strings.Split(strings.TrimSuffix(name, ext), "-")
+	if ext == "" || len(parts) != 2 {
+		return spoolEntry{}, false
+	}
+
+	count, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return spoolEntry{}, false
+	}
+
+	return spoolEntry{name: name, format: ext[1:], count: count}, true
+}
+
+// time returns when the batch was added to the spool
+func (e spoolEntry) time() time.Time {
+	seq, err := strconv.ParseInt(strings.SplitN(e.name, "-", 2)[0], 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return time.Unix(0, seq)
+}
+
+// push adds a batch to the end of the spool. It returns the number of points
+// in batches that were dropped to make room.
+func (s *spool) push(format string, count int, data []byte) (int, error) {
+	// sequence numbers must be increasing so files sort in order
+	seq := time.Now().UnixNano()
+	if seq <= s.lastSeq {
+		seq = s.lastSeq + 1
+	}
+	s.lastSeq = seq
+
+	e := spoolEntry{
+		name:   fmt.Sprintf("%020d-%d.%v", seq, count, format),
+		format: format,
+		count:  count,
+		size:   int64(len(data)),
+	}
+
+	if s.dir != "" {
+		err := os.WriteFile(filepath.Join(s.dir, e.name), data, 0644)
+		if err != nil {
+			return 0, fmt.Errorf("Error writing spool file: %w", err)
+		}
+	} else {
+		e.data = data
+	}
+
+	s.entries = append(s.entries, e)
+	s.size += e.size
+
+	dropped := 0
+	for s.maxBytes > 0 && s.size > s.maxBytes && len(s.entries) > 1 {
+		dropped += s.entries[0].count
+		err := s.pop()
+		if err != nil {
+			return dropped, err
+		}
+	}
+
+	return dropped, nil
+}
+
+// peek returns the oldest batch
+func (s *spool) peek() (spoolEntry, error) {
+	e := s.entries[0]
+
+	if s.dir == "" {
+		return e, nil
+	}
+
+	var err error
+	e.data, err = os.ReadFile(filepath.Join(s.dir, e.name))
+	if err != nil {
+		return e, fmt.Errorf("Error reading spool file: %w", err)
+	}
+
+	return e, nil
+}
+
+// pop removes the oldest batch
+func (s *spool) pop() error {
+	e := s.entries[0]
+	s.entries = s.entries[1:]
+	s.size -= e.size
+
+	if s.dir == "" {
+		return nil
+	}
+
+	err := os.Remove(filepath.Join(s.dir, e.name))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("Error removing spool file: %w", err)
+	}
+
+	return nil
+}
+
+func (s *spool) len() int {
+	return len(s.entries)
+}
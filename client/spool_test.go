@@ -0,0 +1,74 @@
+package client
+
+import (
+	"fmt"
+	"testing"
+)
+
+func testSpool(t *testing.T, dir string) {
+	s, err := newSpool(dir, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		dropped, err := s.push("json", i+1, []byte(fmt.Sprintf("batch%v", i)))
+		if err != nil {
+			t.Fatal("push error: ", err)
+		}
+
+		// each batch is 6 bytes, so three batches fit
+		if dropped != 0 {
+			t.Error("Unexpected drop: ", dropped)
+		}
+	}
+
+	dropped, err := s.push("protobuf", 4, []byte("batch3"))
+	if err != nil {
+		t.Fatal("push error: ", err)
+	}
+
+	if dropped != 1 || s.len() != 3 {
+		t.Fatal("Oldest batch not dropped: ", dropped, s.len())
+	}
+
+	if dir != "" {
+		// reload to make sure order and metadata is kept
+		s, err = newSpool(dir, 20)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := 1; i < 4; i++ {
+		e, err := s.peek()
+		if err != nil {
+			t.Fatal("peek error: ", err)
+		}
+
+		if string(e.data) != fmt.Sprintf("batch%v", i) || e.count != i+1 {
+			t.Errorf("Wrong batch %v: %v %v", i, string(e.data), e.count)
+		}
+
+		if (i == 3) != (e.format == "protobuf") {
+			t.Error("Wrong format: ", e.format)
+		}
+
+		err = s.pop()
+		if err != nil {
+			t.Fatal("pop error: ", err)
+		}
+	}
+
+	if s.len() != 0 || s.size != 0 {
+		t.Error("Spool not empty: ", s.len(), s.size)
+	}
+}
+
+func TestSpoolMemory(t *testing.T) {
+	testSpool(t, "")
+}
+
+func TestSpoolDir(t *testing.T) {
+	testSpool(t, t.TempDir())
+}
@@ -0,0 +1,152 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// how long we wait for the store to respond during a backup or restore.
+// Reading or restoring a large store can take a while.
+var storeSnapshotTimeout = time.Minute
+
+// StoreBackup requests a snapshot of the store and writes it to w. The store
+// keeps running while the snapshot is taken.
+func StoreBackup(nc *nats.Conn, w io.Writer) error {
+	return requestChunks(nc, SubjectStoreBackup(), nil, w)
+}
+
+// requestChunks sends a request for data that is too large for one message
+// and writes the response to w. The store replies with an error string
+// (empty on success), followed by the data in chunks, and then an empty
+// message.
+func requestChunks(nc *nats.Conn, subject string, req []byte, w io.Writer) error {
+	inbox := nats.NewInbox()
+	sub, err := nc.SubscribeSync(inbox)
+	if err != nil {
+		return fmt.Errorf("Error subscribing to inbox: %w", err)
+	}
+	defer sub.Unsubscribe()
+
+	// all chunks are sent at once, so don't drop chunks if we're slow
+	// writing them
+	err = sub.SetPendingLimits(-1, -1)
+	if err != nil {
+		return err
+	}
+
+	err = nc.PublishRequest(subject, inbox, req)
+	if err != nil {
+		return fmt.Errorf("Error sending request: %w", err)
+	}
+
+	msg, err := sub.NextMsg(storeSnapshotTimeout)
+	if err != nil {
+		return fmt.Errorf("Error waiting for response: %w", err)
+	}
+
+	if len(msg.Data) > 0 {
+		return errors.New(string(msg.Data))
+	}
+
+	for {
+		msg, err := sub.NextMsg(storeSnapshotTimeout)
+		if err != nil {
+			return fmt.Errorf("Error receiving response: %w", err)
+		}
+
+		if len(msg.Data) <= 0 {
+			return nil
+		}
+
+		_, err = w.Write(msg.Data)
+		if err != nil {
+			return fmt.Errorf("Error writing response: %w", err)
+		}
+	}
+}
+
+// StoreRestore sends a snapshot read from r to the store, which replaces
+// all data in the store with it. The snapshot is sent in chunks, and an empty
+// request tells the store to restore the chunks it has received. Only one
+// restore can be in progress at a time. SIOT should be restarted after a
+// restore.
+func StoreRestore(nc *nats.Conn, r io.Reader) error {
+	// leave room for the NATS headers
+	buf := make([]byte, nc.MaxPayload()-1024)
+
+	send := func(chunk []byte) error {
+		msg, err := nc.Request(SubjectStoreRestore(), chunk, storeSnapshotTimeout)
+		if err != nil {
+			return err
+		}
+
+		if len(msg.Data) > 0 {
+			return errors.New(string(msg.Data))
+		}
+
+		return nil
+	}
+
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			sendErr := send(buf[:n])
+			if sendErr != nil {
+				return fmt.Errorf("Error sending snapshot: %w", sendErr)
+			}
+		}
+
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+
+		if err != nil {
+			return fmt.Errorf("Error reading snapshot: %w", err)
+		}
+	}
+
+	err := send(nil)
+	if err != nil {
+		return fmt.Errorf("Error restoring snapshot: %w", err)
+	}
+
+	return nil
+}
+
+// StoreVerify checks the store for hash mismatches, orphaned nodes and edges,
+// and deleted root or node type points. If repair is set, the problems that
+// can be fixed are repaired (see store.Verify).
+func StoreVerify(nc *nats.Conn, repair bool) (data.StoreVerifyReport, error) {
+	var ret data.StoreVerifyReport
+
+	points := data.Points{
+		{Type: data.PointTypeRepair, Value: data.BoolToFloat(repair)},
+	}
+
+	req, err := points.ToPb()
+	if err != nil {
+		return ret, err
+	}
+
+	msg, err := nc.Request(SubjectStoreVerify(), req, storeSnapshotTimeout)
+	if err != nil {
+		return ret, fmt.Errorf("Error requesting store verify: %w", err)
+	}
+
+	err = json.Unmarshal(msg.Data, &ret)
+	if err != nil {
+		return ret, fmt.Errorf("Error decoding store verify report: %w", err)
+	}
+
+	if ret.Error != "" {
+		return ret, errors.New(ret.Error)
+	}
+
+	return ret, nil
+}
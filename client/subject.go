@@ -24,7 +24,181 @@ func SubjectEdgeAllPoints() string {
 	return "node.*.*.points"
 }
 
+// SubjectPointsTx is used to send points for multiple nodes and edges that
+// are written in one transaction
+func SubjectPointsTx() string {
+	return "points.tx"
+}
+
+// SubjectNodeCreate is used to create a tree of nodes under a parent in
+// one request
+func SubjectNodeCreate(parentID string) string {
+	return fmt.Sprintf("node.%v.create", parentID)
+}
+
+// SubjectClientHealth constructs a NATS subject for client heartbeats
+func SubjectClientHealth(nodeID string) string {
+	return fmt.Sprintf("client.%v.health", nodeID)
+}
+
+// SubjectInstanceHeartbeat constructs a NATS subject for heartbeats that an
+// edge instance sends to its upstream. These are not stored.
+func SubjectInstanceHeartbeat(rootID string) string {
+	return fmt.Sprintf("node.%v.heartbeat", rootID)
+}
+
 // SubjectNodeHRPoints constructs a NATS subject for high rate node points
 func SubjectNodeHRPoints(nodeID string) string {
 	return fmt.Sprintf("phr.%v", nodeID)
 }
+
+// SubjectNodeHRUpPoints constructs a NATS subject for high rate node points
+// rebroadcast to upstream consumers
+func SubjectNodeHRUpPoints(parentID, nodeID string) string {
+	return fmt.Sprintf("phrup.%v.%v", parentID, nodeID)
+}
+
+// SubjectHistory constructs a NATS subject for history queries
+func SubjectHistory(nodeID string) string {
+	return fmt.Sprintf("history.%v", nodeID)
+}
+
+// SubjectStoreBackup is used to request a snapshot of the store
+func SubjectStoreBackup() string {
+	return "admin.store.backup"
+}
+
+// SubjectExport is used to export a node tree to YAML
+func SubjectExport() string {
+	return "admin.export"
+}
+
+// SubjectImport is used to import a node tree from YAML
+func SubjectImport() string {
+	return "admin.import"
+}
+
+// SubjectStoreVerify is used to request a store integrity check
+func SubjectStoreVerify() string {
+	return "admin.store.verify"
+}
+
+// SubjectStoreRestore is used to send a snapshot to restore to the store
+func SubjectStoreRestore() string {
+	return "admin.store.restore"
+}
+
+// SubjectStoreLeader is used by stores to elect the leader when several
+// SIOT servers share a NATS cluster
+func SubjectStoreLeader() string {
+	return "admin.store.leader"
+}
+
+// SubjectSecret is used to get the value of a secret node
+func SubjectSecret(nodeID string) string {
+	return fmt.Sprintf("secret.%v", nodeID)
+}
+
+// SubjectSchemas is used to get the registered point schemas
+func SubjectSchemas() string {
+	return "schemas"
+}
+
+// SubjectQueryNodes is used to find nodes that match a query
+func SubjectQueryNodes() string {
+	return "query.nodes"
+}
+
+// SubjectSearch is used to search node descriptions and text points
+func SubjectSearch() string {
+	return "query.search"
+}
+
+// SubjectWatch is used to create, renew, and cancel watches, which send
+// point changes that match a filter (see Watch)
+func SubjectWatch() string {
+	return "query.watch"
+}
+
+// ServiceName is the name the store registers with the NATS services API
+const ServiceName = "simpleiot"
+
+// SubjectService is used to discover the store and get its endpoints and
+// stats with the NATS services API. verb is PING, INFO, STATS, or SCHEMA. If
+// id is blank, all SIOT stores answer.
+func SubjectService(verb, id string) string {
+	if id == "" {
+		return "$SRV." + verb + "." + ServiceName
+	}
+	return "$SRV." + verb + "." + ServiceName + "." + id
+}
+
+// SubjectDiag is used to run read-only diagnostic commands
+func SubjectDiag() string {
+	return "admin.diag"
+}
+
+// SubjectDeviceCreds is used to issue NATS credentials to a device
+func SubjectDeviceCreds() string {
+	return "admin.creds"
+}
+
+// SubjectDeviceCredsRevoke is used to revoke the NATS credentials of a device
+func SubjectDeviceCredsRevoke() string {
+	return "admin.creds.revoke"
+}
+
+// SubjectChildEdgePoints is used by devices authenticated with credentials
+// or client certificates to send edge points for a child of a node in their
+// subtree (see SendChildEdgePoints)
+func SubjectChildEdgePoints(nodeID, parentID string) string {
+	return fmt.Sprintf("node.%v.child.%v.points", parentID, nodeID)
+}
+
+// DeviceInbox is the NATS inbox prefix devices authenticated with
+// credentials or client certificates use for request replies, as they can't
+// subscribe to the inboxes of other clients
+func DeviceInbox(deviceID string) string {
+	return "_INBOX." + deviceID
+}
+
+// SubjectAttestChallenge is used to get a device attestation challenge
+func SubjectAttestChallenge() string {
+	return "attest.challenge"
+}
+
+// SubjectAttestVerify is used to send a signed attestation challenge
+func SubjectAttestVerify() string {
+	return "attest.verify"
+}
+
+// SubjectNodeOrigin is used to find out who last changed a point of a node
+func SubjectNodeOrigin(nodeID string) string {
+	return fmt.Sprintf("node.%v.origin", nodeID)
+}
+
+// SubjectNodeBackfill is used to send historical points of a node that are
+// only written to history
+func SubjectNodeBackfill(nodeID string) string {
+	return fmt.Sprintf("node.%v.backfill", nodeID)
+}
+
+// SubjectMQTTPoints is the NATS subject MQTT clients publish points of a
+// node under. The MQTT topic siot/<nodeID>/<pointType>[/<key>] is mapped to
+// the subject siot.<nodeID>.<pointType>[.<key>] by the NATS server.
+func SubjectMQTTPoints(nodeID string) string {
+	return fmt.Sprintf("siot.%v", nodeID)
+}
+
+// SubjectDeviceBackup is used by an upstream instance to request a snapshot
+// of the store of a downstream device
+func SubjectDeviceBackup(deviceID string) string {
+	return fmt.Sprintf("node.%v.backup", deviceID)
+}
+
+// SubjectTreeDiff is used to compare a subtree with the upstream copy. On a
+// downstream instance, id is the ID of the upstream node. On the upstream
+// instance, id is the ID of the device (the downstream root node).
+func SubjectTreeDiff(id string) string {
+	return fmt.Sprintf("node.%v.diff", id)
+}
@@ -0,0 +1,54 @@
+package client
+
+import (
+	"math"
+	"time"
+)
+
+// sunTimes returns sunrise and sunset for the UTC date of day at lat/lon
+// (degrees, north and east are positive) using the sunrise equation. ok is
+// false if the sun does not rise that day (polar night). If the sun does not
+// set (polar day), rise and set are 12h either side of solar noon.
+func sunTimes(day time.Time, lat, lon float64) (rise, set time.Time, ok bool) {
+	const toRad = math.Pi / 180
+
+	y, m, d := day.UTC().Date()
+	jd := float64(time.Date(y, m, d, 0, 0, 0, 0, time.UTC).Unix())/86400 + 2440587.5
+
+	// mean solar time
+	n := math.Ceil(jd - 2451545.0 + 0.0008)
+	jStar := n - lon/360
+
+	// solar mean anomaly
+	ma := math.Mod(357.5291+0.98560028*jStar, 360)
+	// equation of the center
+	c := 1.9148*math.Sin(ma*toRad) + 0.02*math.Sin(2*ma*toRad) +
+		0.0003*math.Sin(3*ma*toRad)
+	// ecliptic longitude
+	el := math.Mod(ma+c+180+102.9372, 360)
+
+	transit := 2451545.0 + jStar + 0.0053*math.Sin(ma*toRad) -
+		0.0069*math.Sin(2*el*toRad)
+
+	sinDec := math.Sin(el*toRad) * math.Sin(23.4397*toRad)
+	cosDec := math.Cos(math.Asin(sinDec))
+
+	// hour angle, -0.833 degrees accounts for refraction and the solar disc
+	cosHa := (math.Sin(-0.833*toRad) - math.Sin(lat*toRad)*sinDec) /
+		(math.Cos(lat*toRad) * cosDec)
+
+	if cosHa > 1 {
+		return time.Time{}, time.Time{}, false
+	}
+
+	ha := 180.0
+	if cosHa >= -1 {
+		ha = math.Acos(cosHa) / toRad
+	}
+
+	toTime := func(j float64) time.Time {
+		return time.Unix(0, int64((j-2440587.5)*86400*1e9)).UTC()
+	}
+
+	return toTime(transit - ha/360), toTime(transit + ha/360), true
+}
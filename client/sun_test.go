@@ -0,0 +1,98 @@
+package client
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/simpleiot/simpleiot/data"
+)
+
+func TestSunTimes(t *testing.T) {
+	cases := []struct {
+		name     string
+		day      time.Time
+		lat, lon float64
+		rise     time.Time
+		set      time.Time
+	}{
+		{"new york summer", time.Date(2024, 6, 21, 0, 0, 0, 0, time.UTC), 40.7128, -74.006,
+			time.Date(2024, 6, 21, 9, 25, 0, 0, time.UTC),
+			time.Date(2024, 6, 22, 0, 31, 0, 0, time.UTC)},
+		{"london winter", time.Date(2024, 12, 21, 0, 0, 0, 0, time.UTC), 51.5, -0.12,
+			time.Date(2024, 12, 21, 8, 4, 0, 0, time.UTC),
+			time.Date(2024, 12, 21, 15, 53, 0, 0, time.UTC)},
+		{"sydney", time.Date(2024, 3, 20, 0, 0, 0, 0, time.UTC), -33.87, 151.2,
+			time.Date(2024, 3, 19, 19, 58, 0, 0, time.UTC),
+			time.Date(2024, 3, 20, 8, 7, 0, 0, time.UTC)},
+	}
+
+	for _, c := range cases {
+		rise, set, ok := sunTimes(c.day, c.lat, c.lon)
+		if !ok {
+			t.Errorf("%v: expected sunrise", c.name)
+			continue
+		}
+
+		if math.Abs(rise.Sub(c.rise).Minutes()) > 3 || math.Abs(set.Sub(c.set).Minutes()) > 3 {
+			t.Errorf("%v: got %v - %v, expected %v - %v", c.name, rise, set, c.rise, c.set)
+		}
+	}
+
+	// polar night
+	_, _, ok := sunTimes(time.Date(2024, 12, 21, 0, 0, 0, 0, time.UTC), 78, 15)
+	if ok {
+		t.Error("Expected no sunrise in polar night")
+	}
+
+	// polar day
+	rise, set, ok := sunTimes(time.Date(2024, 6, 21, 0, 0, 0, 0, time.UTC), 78, 15)
+	if !ok || set.Sub(rise) != 24*time.Hour {
+		t.Error("Expected sun up all day: ", rise, set)
+	}
+}
+
+func TestIsDark(t *testing.T) {
+	noon := time.Date(2024, 12, 21, 12, 0, 0, 0, time.UTC)
+	night := time.Date(2024, 12, 21, 20, 0, 0, 0, time.UTC)
+
+	if isDark(noon, 51.5, -0.12, 0, 0) {
+		t.Error("Expected light at noon")
+	}
+
+	if !isDark(night, 51.5, -0.12, 0, 0) {
+		t.Error("Expected dark at night")
+	}
+
+	// sunset is 15:53, dusk is 30m later
+	dusk := time.Date(2024, 12, 21, 16, 10, 0, 0, time.UTC)
+	if !isDark(dusk, 51.5, -0.12, 0, 0) || isDark(dusk, 51.5, -0.12, 30*time.Minute, 0) {
+		t.Error("Dusk offset not applied")
+	}
+
+	if !isDark(noon, 78, 15, 0, 0) {
+		t.Error("Expected dark in polar night")
+	}
+}
+
+func TestDimmingCurve(t *testing.T) {
+	cases := []struct {
+		curve    string
+		level    float64
+		expected float64
+	}{
+		{"", 50, 0.5},
+		{data.PointValueLinear, 120, 1},
+		{data.PointValueSquare, 50, 0.25},
+		{data.PointValueCIE, 0, 0},
+		{data.PointValueCIE, 50, 0.184},
+		{data.PointValueCIE, 100, 1},
+	}
+
+	for _, c := range cases {
+		v := dimmingCurve(c.curve, c.level)
+		if math.Abs(v-c.expected) > 0.001 {
+			t.Errorf("%v %v: expected %v, got %v", c.curve, c.level, c.expected, v)
+		}
+	}
+}
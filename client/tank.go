@@ -0,0 +1,455 @@
+package client
+
+import (
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// Tank converts the LevelPointType (defaults to value) point of LevelNodeID
+// into a volume and percent full. The level is the sensor value plus
+// LevelOffset, or Height (Diameter for horizontal tanks) minus this if
+// FromTop is set (for sensors mounted at the top of the tank). The volume is
+// computed from the tank Shape and dimensions (all in the same units as the
+// level) and multiplied by VolumeScale (defaults to 1), or looked up in the
+// strapping table. The strapping table is stored in strapping points where
+// the key is the level and the value is the volume, and is linearly
+// interpolated. Rate is the fill (positive) or drain (negative) rate in volume
+// per hour over the last RateWindow minutes (defaults to 5). Leak is set when
+// the tank drains faster than LeakRate (volume per hour) for LeakDelay
+// minutes.
+type Tank struct {
+	ID             string  `node:"id"`
+	Parent         string  `node:"parent"`
+	Description    string  `point:"description"`
+	Shape          string  `point:"shape"`
+	Diameter       float64 `point:"diameter"`
+	Length         float64 `point:"length"`
+	Width          float64 `point:"width"`
+	Height         float64 `point:"height"`
+	VolumeScale    float64 `point:"volumeScale"`
+	LevelNodeID    string  `point:"levelNodeID"`
+	LevelPointType string  `point:"levelPointType"`
+	LevelOffset    float64 `point:"levelOffset"`
+	FromTop        bool    `point:"fromTop"`
+	RateWindow     float64 `point:"rateWindow"`
+	LeakRate       float64 `point:"leakRate"`
+	LeakDelay      float64 `point:"leakDelay"`
+	Disable        bool    `point:"disable"`
+	Level          float64 `point:"level"`
+	Volume         float64 `point:"volume"`
+	Percent        float64 `point:"percent"`
+	Rate           float64 `point:"rate"`
+	Leak           bool    `point:"leak"`
+}
+
+// strapEntry is one row of a tank strapping table
+type strapEntry struct {
+	level  float64
+	volume float64
+}
+
+// strappingTable returns the strapping table in points sorted by level
+func strappingTable(points map[string]data.Point) []strapEntry {
+	var ret []strapEntry
+
+	for _, p := range points {
+		if p.Tombstone%2 != 0 {
+			continue
+		}
+
+		level, err := strconv.ParseFloat(p.Key, 64)
+		if err != nil {
+			log.Println("Tank: invalid strapping level: ", p.Key)
+			continue
+		}
+
+		ret = append(ret, strapEntry{level: level, volume: p.Value})
+	}
+
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].level < ret[j].level
+	})
+
+	return ret
+}
+
+// strapVolume interpolates the volume at level in a strapping table. Levels
+// outside the table are clamped to the first or last row.
+func strapVolume(table []strapEntry, level float64) float64 {
+	if len(table) == 0 {
+		return 0
+	}
+
+	if level <= table[0].level {
+		return table[0].volume
+	}
+
+	for i := 1; i < len(table); i++ {
+		if level <= table[i].level {
+			a, b := table[i-1], table[i]
+			return a.volume + (b.volume-a.volume)*(level-a.level)/(b.level-a.level)
+		}
+	}
+
+	return table[len(table)-1].volume
+}
+
+// tankHeight returns the level of a full tank
+func tankHeight(t *Tank, table []strapEntry) float64 {
+	switch t.Shape {
+	case data.PointValueHorizontal:
+		return t.Diameter
+	case data.PointValueTable:
+		if len(table) > 0 {
+			return table[len(table)-1].level
+		}
+		return 0
+	default:
+		return t.Height
+	}
+}
+
+// tankVolume returns the volume of a tank at level
+func tankVolume(t *Tank, table []strapEntry, level float64) float64 {
+	level = math.Max(0, math.Min(level, tankHeight(t, table)))
+
+	scale := t.VolumeScale
+	if scale == 0 {
+		scale = 1
+	}
+
+	switch t.Shape {
+	case data.PointValueTable:
+		return strapVolume(table, level)
+	case data.PointValueHorizontal:
+		// area of the circular segment below the level
+		r := t.Diameter / 2
+		if r <= 0 {
+			return 0
+		}
+		area := r*r*math.Acos((r-level)/r) - (r-level)*math.Sqrt(2*r*level-level*level)
+		return area * t.Length * scale
+	case data.PointValueRectangular:
+		return t.Length * t.Width * level * scale
+	default:
+		// vertical cylinder
+		r := t.Diameter / 2
+		return math.Pi * r * r * level * scale
+	}
+}
+
+// tankSample is a volume at a point in time used to compute the rate
+type tankSample struct {
+	time   time.Time
+	volume float64
+}
+
+// tankRate returns the least squares slope of the samples in volume per
+// hour
+func tankRate(samples []tankSample) float64 {
+	if len(samples) < 2 {
+		return 0
+	}
+
+	t0 := samples[0].time
+	var sumT, sumV, sumTT, sumTV float64
+	for _, s := range samples {
+		t := s.time.Sub(t0).Hours()
+		sumT += t
+		sumV += s.volume
+		sumTT += t * t
+		sumTV += t * s.volume
+	}
+
+	n := float64(len(samples))
+	d := n*sumTT - sumT*sumT
+	if d == 0 {
+		return 0
+	}
+
+	return (n*sumTV - sumT*sumV) / d
+}
+
+// TankClient is a SIOT client that runs tank nodes
+type TankClient struct {
+	nc            *nats.Conn
+	config        Tank
+	stop          chan struct{}
+	newPoints     chan NewPoints
+	newEdgePoints chan NewPoints
+	newLevel      chan data.Point
+	levelSub      *nats.Subscription
+	// strapping points by key
+	strapping map[string]data.Point
+	table     []strapEntry
+	samples   []tankSample
+	// when the drain rate first exceeded the leak rate, zero if it is not
+	leakStart time.Time
+	// last sensor value
+	raw     float64
+	haveRaw bool
+}
+
+// NewTankClient ...
+func NewTankClient(nc *nats.Conn, config Tank) Client {
+	return &TankClient{
+		nc:            nc,
+		config:        config,
+		stop:          make(chan struct{}),
+		newPoints:     make(chan NewPoints),
+		newEdgePoints: make(chan NewPoints),
+		newLevel:      make(chan data.Point),
+		strapping:     make(map[string]data.Point),
+	}
+}
+
+// Start runs the main logic for this client and blocks until stopped
+func (t *TankClient) Start() error {
+	log.Println("Starting tank client: ", t.config.Description)
+
+	// the strapping table is stored in keyed points, which are not decoded
+	// into the config
+	nodes, err := GetNode(t.nc, t.config.ID, "none")
+	if err != nil || len(nodes) < 1 {
+		log.Printf("Tank %v: error getting node: %v\n", t.config.Description, err)
+	} else {
+		t.mergeStrapping(nodes[0].Points)
+	}
+
+	t.subscribeLevel()
+
+done:
+	for {
+		select {
+		case <-t.stop:
+			log.Println("Stopping tank client: ", t.config.Description)
+			break done
+		case p := <-t.newLevel:
+			t.raw = p.Value
+			t.haveRaw = true
+			if p.Time.IsZero() {
+				p.Time = time.Now()
+			}
+			t.update(p.Time)
+		case pts := <-t.newPoints:
+			err := data.MergePoints(pts.ID, pts.Points, &t.config)
+			if err != nil {
+				log.Println("error merging new points: ", err)
+			}
+
+			t.mergeStrapping(pts.Points)
+
+			for _, p := range pts.Points {
+				switch p.Type {
+				case data.PointTypeLevelNodeID, data.PointTypeLevelPointType:
+					t.subscribeLevel()
+				case data.PointTypeShape, data.PointTypeDiameter, data.PointTypeLength,
+					data.PointTypeWidth, data.PointTypeHeight, data.PointTypeVolumeScale,
+					data.PointTypeStrapping:
+					// the rate can't be computed across a change in geometry
+					t.samples = nil
+				}
+			}
+
+			t.update(time.Time{})
+		case pts := <-t.newEdgePoints:
+			err := data.MergeEdgePoints(pts.ID, pts.Parent, pts.Points, &t.config)
+			if err != nil {
+				log.Println("error merging new points: ", err)
+			}
+		}
+	}
+
+	if t.levelSub != nil {
+		t.levelSub.Unsubscribe()
+	}
+
+	return nil
+}
+
+// mergeStrapping updates the strapping table with any strapping points
+func (t *TankClient) mergeStrapping(points data.Points) {
+	changed := false
+	for _, p := range points {
+		if p.Type != data.PointTypeStrapping {
+			continue
+		}
+
+		if cur, ok := t.strapping[p.Key]; ok && cur.Time.After(p.Time) {
+			continue
+		}
+
+		t.strapping[p.Key] = p
+		changed = true
+	}
+
+	if changed {
+		t.table = strappingTable(t.strapping)
+	}
+}
+
+// update computes the level, volume, percent, rate, and leak state from the
+// last sensor value. If sampleTime is set, the sensor value is new and is used
+// for the rate at that time.
+func (t *TankClient) update(sampleTime time.Time) {
+	if !t.haveRaw || t.config.Disable {
+		return
+	}
+
+	height := tankHeight(&t.config, t.table)
+
+	level := t.raw + t.config.LevelOffset
+	if t.config.FromTop {
+		level = height - level
+	}
+
+	volume := tankVolume(&t.config, t.table, level)
+
+	percent := 0.0
+	if capacity := tankVolume(&t.config, t.table, height); capacity > 0 {
+		percent = volume / capacity * 100
+	}
+
+	if !sampleTime.IsZero() {
+		window := t.config.RateWindow
+		if window <= 0 {
+			window = 5
+		}
+
+		t.samples = append(t.samples, tankSample{time: sampleTime, volume: volume})
+		start := sampleTime.Add(-time.Duration(window * float64(time.Minute)))
+		for len(t.samples) > 0 && t.samples[0].time.Before(start) {
+			t.samples = t.samples[1:]
+		}
+	}
+
+	rate := tankRate(t.samples)
+
+	now := time.Now()
+
+	leak := false
+	if t.config.LeakRate > 0 && -rate >= t.config.LeakRate {
+		if t.leakStart.IsZero() {
+			t.leakStart = now
+		}
+		leak = now.Sub(t.leakStart) >= time.Duration(t.config.LeakDelay*float64(time.Minute))
+	} else {
+		t.leakStart = time.Time{}
+	}
+
+	var points data.Points
+
+	set := func(typ string, cur *float64, v float64) {
+		if *cur != v {
+			*cur = v
+			points = append(points, data.Point{Type: typ, Value: v})
+		}
+	}
+
+	set(data.PointTypeLevel, &t.config.Level, level)
+	set(data.PointTypeVolume, &t.config.Volume, volume)
+	set(data.PointTypePercent, &t.config.Percent, percent)
+	set(data.PointTypeRate, &t.config.Rate, rate)
+
+	if leak != t.config.Leak {
+		t.config.Leak = leak
+		points = append(points, data.Point{Type: data.PointTypeLeak,
+			Value: data.BoolToFloat(leak)})
+		if leak {
+			log.Printf("Tank %v: leak detected, draining at %.2f/h\n",
+				t.config.Description, -rate)
+		}
+	}
+
+	if len(points) <= 0 {
+		return
+	}
+
+	for i := range points {
+		points[i].Time = now
+	}
+
+	err := SendNodePoints(t.nc, t.config.ID, points, false)
+	if err != nil {
+		log.Println("Tank: error sending state: ", err)
+	}
+}
+
+// subscribeLevel subscribes to the level sensor point and gets its current
+// value
+func (t *TankClient) subscribeLevel() {
+	if t.levelSub != nil {
+		t.levelSub.Unsubscribe()
+		t.levelSub = nil
+	}
+
+	t.haveRaw = false
+	t.samples = nil
+
+	if t.config.LevelNodeID == "" {
+		return
+	}
+
+	pointType := t.config.LevelPointType
+	if pointType == "" {
+		pointType = data.PointTypeValue
+	}
+
+	var err error
+	t.levelSub, err = t.nc.Subscribe(SubjectNodePoints(t.config.LevelNodeID), func(msg *nats.Msg) {
+		points, err := DecodePoints(msg)
+		if err != nil {
+			log.Println("Tank: error decoding level points: ", err)
+			return
+		}
+
+		for _, p := range points {
+			if p.Type == pointType {
+				select {
+				case t.newLevel <- p:
+				case <-t.stop:
+				}
+			}
+		}
+	})
+	if err != nil {
+		log.Printf("Tank %v: error subscribing to level sensor: %v\n",
+			t.config.Description, err)
+	}
+
+	nodes, err := GetNode(t.nc, t.config.LevelNodeID, "none")
+	if err != nil || len(nodes) < 1 {
+		log.Printf("Tank %v: error getting level sensor: %v\n",
+			t.config.Description, err)
+		return
+	}
+
+	if p, ok := nodes[0].Points.Find(pointType, ""); ok {
+		t.raw = p.Value
+		t.haveRaw = true
+		t.update(time.Time{})
+	}
+}
+
+// Stop sends a signal to the Start function to exit
+func (t *TankClient) Stop(err error) {
+	close(t.stop)
+}
+
+// Points is called by the Manager when new points for this
+// node are received.
+func (t *TankClient) Points(nodeID string, points []data.Point) {
+	t.newPoints <- NewPoints{nodeID, "", points}
+}
+
+// EdgePoints is called by the Manager when new edge points for this
+// node are received.
+func (t *TankClient) EdgePoints(nodeID, parentID string, points []data.Point) {
+	t.newEdgePoints <- NewPoints{nodeID, parentID, points}
+}
@@ -0,0 +1,116 @@
+package client_test
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+	"github.com/simpleiot/simpleiot/server"
+)
+
+func TestTank(t *testing.T) {
+	nc, root, stop, err := server.TestServer()
+	if err != nil {
+		t.Fatal("Error starting test server: ", err)
+	}
+	defer stop()
+
+	for _, id := range []string{"lvl1", "lvl2", "lvl3"} {
+		err = client.SendNodeType(nc, client.Variable{ID: id, Parent: root.ID}, "test")
+		if err != nil {
+			t.Fatal("Error sending variable node: ", err)
+		}
+	}
+
+	sendLevel := func(id string, tm time.Time, v float64) {
+		t.Helper()
+		err := client.SendNodePoint(nc, id, data.Point{Time: tm,
+			Type: data.PointTypeValue, Value: v}, true)
+		if err != nil {
+			t.Fatal("Error sending level: ", err)
+		}
+	}
+
+	err = client.SendNodeType(nc, client.Tank{
+		ID:          "rect",
+		Parent:      root.ID,
+		Description: "rectangular tank",
+		Shape:       data.PointValueRectangular,
+		Length:      1,
+		Width:       1,
+		Height:      2,
+		LevelNodeID: "lvl1",
+		LeakRate:    10,
+	}, "test")
+	if err != nil {
+		t.Fatal("Error sending tank node: ", err)
+	}
+
+	err = client.SendNodeType(nc, client.Tank{
+		ID:          "horiz",
+		Parent:      root.ID,
+		Description: "horizontal tank",
+		Shape:       data.PointValueHorizontal,
+		Diameter:    2,
+		Length:      1,
+		LevelNodeID: "lvl2",
+	}, "test")
+	if err != nil {
+		t.Fatal("Error sending tank node: ", err)
+	}
+
+	err = client.SendNodeType(nc, client.Tank{
+		ID:          "strap",
+		Parent:      root.ID,
+		Description: "strapped tank",
+		Shape:       data.PointValueTable,
+		LevelNodeID: "lvl3",
+	}, "test")
+	if err != nil {
+		t.Fatal("Error sending tank node: ", err)
+	}
+
+	err = client.SendNodePoints(nc, "strap", data.Points{
+		{Type: data.PointTypeStrapping, Key: "0", Value: 0, Origin: "test"},
+		{Type: data.PointTypeStrapping, Key: "1", Value: 100, Origin: "test"},
+		{Type: data.PointTypeStrapping, Key: "2", Value: 150, Origin: "test"},
+	}, true)
+	if err != nil {
+		t.Fatal("Error sending strapping table: ", err)
+	}
+
+	// wait for the clients to start
+	time.Sleep(500 * time.Millisecond)
+
+	now := time.Now()
+
+	sendLevel("lvl2", now, 1)
+	waitPointValue(t, nc, "horiz", data.PointTypePercent, 50)
+
+	sendLevel("lvl3", now, 1.5)
+	waitPointValue(t, nc, "strap", data.PointTypeVolume, 125)
+
+	// drain at 30/h
+	sendLevel("lvl1", now.Add(-time.Minute), 1.5)
+	sendLevel("lvl1", now.Add(-30*time.Second), 1.25)
+	sendLevel("lvl1", now, 1)
+	waitPointValue(t, nc, "rect", data.PointTypeVolume, 1)
+	waitPointValue(t, nc, "rect", data.PointTypePercent, 50)
+	waitPointValue(t, nc, "rect", data.PointTypeLeak, 1)
+
+	nodes, err := client.GetNode(nc, "rect", "none")
+	if err != nil || len(nodes) < 1 {
+		t.Fatal("Error getting tank: ", err)
+	}
+
+	rate, _ := nodes[0].Points.Value(data.PointTypeRate, "")
+	if math.Abs(rate+30) > 0.01 {
+		t.Error("Expected rate of -30, got: ", rate)
+	}
+
+	// filling clears the leak
+	sendLevel("lvl1", now.Add(time.Minute), 2)
+	waitPointValue(t, nc, "rect", data.PointTypeLeak, 0)
+}
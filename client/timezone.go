@@ -0,0 +1,44 @@
+package client
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// NodeLocation returns the time zone set by the timezone point of a node or
+// its closest ancestor, for example on the device or group node of a site.
+// UTC is returned if no time zone is set, or with an error if the time
+// zone is not valid. If a node has multiple parents, the first one is used.
+func NodeLocation(nc *nats.Conn, nodeID string) (*time.Location, error) {
+	id := nodeID
+	visited := make(map[string]bool)
+
+	for id != "" && id != "none" && !visited[id] {
+		visited[id] = true
+
+		nodes, err := GetNode(nc, id, "all")
+		if err != nil {
+			return time.UTC, err
+		}
+
+		if len(nodes) < 1 {
+			break
+		}
+
+		tz, ok := nodes[0].Points.Text(data.PointTypeTimezone, "")
+		if ok && tz != "" {
+			loc, err := time.LoadLocation(tz)
+			if err != nil {
+				return time.UTC, fmt.Errorf("invalid time zone %v: %v", tz, err)
+			}
+			return loc, nil
+		}
+
+		id = nodes[0].Parent
+	}
+
+	return time.UTC, nil
+}
@@ -0,0 +1,57 @@
+package client_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+	"github.com/simpleiot/simpleiot/server"
+)
+
+func TestNodeLocation(t *testing.T) {
+	nc, root, stop, err := server.TestServer()
+
+	if err != nil {
+		t.Fatal("Error starting test server: ", err)
+	}
+
+	defer stop()
+
+	site := testNode{ID: "ID-site", Parent: root.ID, Description: "site"}
+	rule := testNode{ID: "ID-rule", Parent: site.ID, Description: "rule"}
+
+	for _, n := range []testNode{site, rule} {
+		err = client.SendNodeType(nc, n, "test")
+		if err != nil {
+			t.Fatal("Error sending node: ", err)
+		}
+	}
+
+	loc, err := client.NodeLocation(nc, rule.ID)
+	if err != nil || loc != time.UTC {
+		t.Fatal("Expected UTC without a time zone, got: ", loc, err)
+	}
+
+	err = client.SendNodePoint(nc, site.ID, data.Point{Type: data.PointTypeTimezone,
+		Text: "America/Chicago"}, true)
+	if err != nil {
+		t.Fatal("Error sending time zone: ", err)
+	}
+
+	loc, err = client.NodeLocation(nc, rule.ID)
+	if err != nil || loc.String() != "America/Chicago" {
+		t.Fatal("Expected site time zone, got: ", loc, err)
+	}
+
+	err = client.SendNodePoint(nc, site.ID, data.Point{Type: data.PointTypeTimezone,
+		Text: "Mars/Olympus"}, true)
+	if err != nil {
+		t.Fatal("Error sending time zone: ", err)
+	}
+
+	loc, err = client.NodeLocation(nc, rule.ID)
+	if err == nil || loc != time.UTC {
+		t.Fatal("Expected error and UTC for invalid time zone, got: ", loc, err)
+	}
+}
@@ -0,0 +1,230 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// NodeDiff.Missing values
+const (
+	// MissingLocal is set if the node only exists upstream
+	MissingLocal = "local"
+	// MissingUpstream is set if the node only exists locally
+	MissingUpstream = "upstream"
+)
+
+// NodeDiff is a node that differs between a downstream instance and its
+// upstream. Missing is set if the node (and its subtree) only exists on one
+// side, otherwise Points and EdgePoints are the points that differ. A node
+// with matching points is not reported, even if its hash differs because
+// of a child node.
+type NodeDiff struct {
+	ID           string      `json:"id"`
+	Parent       string      `json:"parent"`
+	Type         string      `json:"type"`
+	Description  string      `json:"description,omitempty"`
+	Missing      string      `json:"missing,omitempty"`
+	LocalHash    []byte      `json:"localHash,omitempty"`
+	UpstreamHash []byte      `json:"upstreamHash,omitempty"`
+	Points       []PointDiff `json:"points,omitempty"`
+	EdgePoints   []PointDiff `json:"edgePoints,omitempty"`
+}
+
+// PointDiff is a point that differs in value, text, time, or tombstone.
+// Local or Upstream is nil if the point only exists on the other side.
+type PointDiff struct {
+	Type     string      `json:"type"`
+	Key      string      `json:"key,omitempty"`
+	Local    *data.Point `json:"local,omitempty"`
+	Upstream *data.Point `json:"upstream,omitempty"`
+}
+
+// TreeDiffResponse is the response to a tree diff request (see TreeDiff)
+type TreeDiffResponse struct {
+	Nodes []NodeDiff `json:"nodes"`
+	Error string     `json:"error,omitempty"`
+}
+
+// TreeDiff compares a subtree of a downstream instance with the upstream
+// copy, and returns the nodes that differ. The request is handled by the
+// upstream client of the downstream instance, so it can be sent to the
+// downstream instance with id set to the ID of the upstream node, or to the
+// upstream instance with id set to the device ID (the downstream root
+// node). nodeID is the root of the subtree to compare, or blank for the
+// whole tree (or the sync nodes of a peer).
+func TreeDiff(nc *nats.Conn, id, nodeID string) ([]NodeDiff, error) {
+	msg, err := nc.Request(SubjectTreeDiff(id), []byte(nodeID), time.Minute)
+	if err != nil {
+		return nil, fmt.Errorf("Error requesting tree diff: %w", err)
+	}
+
+	var resp TreeDiffResponse
+	err = json.Unmarshal(msg.Data, &resp)
+	if err != nil {
+		return nil, fmt.Errorf("Error decoding tree diff: %w", err)
+	}
+
+	if resp.Error != "" {
+		return nil, errors.New(resp.Error)
+	}
+
+	return resp.Nodes, nil
+}
+
+// DiffTrees compares the subtree at node id (with parent, see GetNode) on
+// the local and upstream NATS connections. If parent is blank, the parent of
+// the first local instance of the node is used. Only subtrees with a
+// different hash are walked, so matching subtrees are cheap to compare.
+func DiffTrees(ncLocal, ncUp *nats.Conn, id, parent string) ([]NodeDiff, error) {
+	if parent == "" {
+		instances, err := GetNode(ncLocal, id, "all")
+		if err != nil {
+			return nil, fmt.Errorf("Error getting local node: %w", err)
+		}
+
+		if len(instances) <= 0 {
+			return nil, errors.New("local node not found")
+		}
+
+		parent = instances[0].Parent
+	}
+
+	locals, err := GetNode(ncLocal, id, parent)
+	if err != nil {
+		return nil, fmt.Errorf("Error getting local node: %w", err)
+	}
+
+	if len(locals) <= 0 {
+		return nil, errors.New("local node not found")
+	}
+
+	ups, err := GetNode(ncUp, id, parent)
+	if err != nil && err != data.ErrDocumentNotFound {
+		return nil, fmt.Errorf("Error getting upstream node: %w", err)
+	}
+
+	if len(ups) <= 0 {
+		return []NodeDiff{missingNode(locals[0], MissingUpstream)}, nil
+	}
+
+	return diffNodes(ncLocal, ncUp, locals[0], ups[0])
+}
+
+func missingNode(n data.NodeEdge, missing string) NodeDiff {
+	d := NodeDiff{ID: n.ID, Parent: n.Parent, Type: n.Type,
+		Description: n.Points.Desc(), Missing: missing}
+
+	if missing == MissingUpstream {
+		d.LocalHash = n.Hash
+	} else {
+		d.UpstreamHash = n.Hash
+	}
+
+	return d
+}
+
+func diffNodes(ncLocal, ncUp *nats.Conn, local, up data.NodeEdge) ([]NodeDiff, error) {
+	// backends that don't keep hashes (memory) are always walked
+	if len(local.Hash) > 0 && bytes.Equal(local.Hash, up.Hash) {
+		return nil, nil
+	}
+
+	var ret []NodeDiff
+
+	d := NodeDiff{
+		ID:           local.ID,
+		Parent:       local.Parent,
+		Type:         local.Type,
+		Description:  local.Points.Desc(),
+		LocalHash:    local.Hash,
+		UpstreamHash: up.Hash,
+		Points:       diffPoints(local.Points, up.Points),
+		EdgePoints:   diffPoints(local.EdgePoints, up.EdgePoints),
+	}
+
+	if len(d.Points) > 0 || len(d.EdgePoints) > 0 {
+		ret = append(ret, d)
+	}
+
+	children, err := GetNodeChildren(ncLocal, local.ID, "", true, false)
+	if err != nil {
+		return nil, fmt.Errorf("Error getting local node children: %w", err)
+	}
+
+	upChildren, err := GetNodeChildren(ncUp, up.ID, "", true, false)
+	if err != nil {
+		return nil, fmt.Errorf("Error getting upstream node children: %w", err)
+	}
+
+	upByID := make(map[string]data.NodeEdge)
+	for _, c := range upChildren {
+		upByID[c.ID] = c
+	}
+
+	for _, c := range children {
+		upChild, ok := upByID[c.ID]
+		if !ok {
+			ret = append(ret, missingNode(c, MissingUpstream))
+			continue
+		}
+		delete(upByID, c.ID)
+
+		diffs, err := diffNodes(ncLocal, ncUp, c, upChild)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, diffs...)
+	}
+
+	for _, c := range upChildren {
+		if _, ok := upByID[c.ID]; ok {
+			ret = append(ret, missingNode(c, MissingLocal))
+		}
+	}
+
+	return ret, nil
+}
+
+// diffPoints returns the points that differ between local and upstream
+// points, matched by type and key
+func diffPoints(local, up data.Points) []PointDiff {
+	var ret []PointDiff
+
+	key := func(p data.Point) string { return p.Type + "." + p.Key }
+
+	upByKey := make(map[string]data.Point)
+	for _, p := range up {
+		upByKey[key(p)] = p
+	}
+
+	for i := range local {
+		p := local[i]
+		pUp, ok := upByKey[key(p)]
+		if !ok {
+			ret = append(ret, PointDiff{Type: p.Type, Key: p.Key, Local: &p})
+			continue
+		}
+		delete(upByKey, key(p))
+
+		if !p.Time.Equal(pUp.Time) || p.Value != pUp.Value ||
+			p.Text != pUp.Text || p.Tombstone != pUp.Tombstone {
+			ret = append(ret, PointDiff{Type: p.Type, Key: p.Key, Local: &p,
+				Upstream: &pUp})
+		}
+	}
+
+	for i := range up {
+		p := up[i]
+		if _, ok := upByKey[key(p)]; ok {
+			ret = append(ret, PointDiff{Type: p.Type, Key: p.Key, Upstream: &p})
+		}
+	}
+
+	return ret
+}
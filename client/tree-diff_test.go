@@ -0,0 +1,130 @@
+package client_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	natsserver "github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+	"github.com/simpleiot/simpleiot/store"
+)
+
+// startDiffStore starts a memory store with its own NATS server
+func startDiffStore(t *testing.T) (*nats.Conn, string) {
+	ns, err := natsserver.NewServer(&natsserver.Options{Port: -1, NoSigs: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go ns.Start()
+	t.Cleanup(ns.Shutdown)
+
+	if !ns.ReadyForConnections(5 * time.Second) {
+		t.Fatal("NATS server not ready")
+	}
+
+	nc, err := nats.Connect(ns.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(nc.Close)
+
+	st, err := store.NewStore(store.Params{File: store.MemoryStoreFile, Nc: nc})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		st.Start()
+		close(stopped)
+	}()
+	t.Cleanup(func() {
+		st.Stop(nil)
+		<-stopped
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err = st.WaitStart(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root, err := client.GetNode(nc, "root", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return nc, root[0].ID
+}
+
+func TestDiffTrees(t *testing.T) {
+	ncLocal, rootLocal := startDiffStore(t)
+	ncUp, rootUp := startDiffStore(t)
+
+	now := time.Now()
+
+	send := func(nc *nats.Conn, id, parent string, value float64) {
+		t.Helper()
+		err := client.SendNode(nc, data.NodeEdge{ID: id, Parent: parent,
+			Type: data.NodeTypeVariable, Points: data.Points{
+				{Time: now, Type: data.PointTypeValue, Value: value},
+			}}, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the stores have different roots, so compare a subtree with the
+	// same parent
+	send(ncLocal, "group", rootLocal, 0)
+	send(ncUp, "group", rootUp, 0)
+	send(ncLocal, "site", "group", 1)
+	send(ncUp, "site", "group", 2)
+	send(ncLocal, "same", "site", 3)
+	send(ncUp, "same", "site", 3)
+	send(ncLocal, "local", "site", 4)
+	send(ncUp, "up", "site", 5)
+
+	diffs, err := client.DiffTrees(ncLocal, ncUp, "site", "")
+	if err != nil {
+		t.Fatal("Error comparing trees: ", err)
+	}
+
+	found := make(map[string]client.NodeDiff)
+	for _, d := range diffs {
+		found[d.ID] = d
+	}
+
+	if len(found) != 3 {
+		t.Fatalf("Expected 3 node diffs, got: %+v", diffs)
+	}
+
+	site := found["site"]
+	if site.Missing != "" || len(site.Points) != 1 ||
+		site.Points[0].Type != data.PointTypeValue ||
+		site.Points[0].Local.Value != 1 || site.Points[0].Upstream.Value != 2 {
+		t.Errorf("Wrong site diff: %+v", site)
+	}
+
+	if found["local"].Missing != client.MissingUpstream {
+		t.Errorf("Wrong local node diff: %+v", found["local"])
+	}
+
+	if found["up"].Missing != client.MissingLocal {
+		t.Errorf("Wrong upstream node diff: %+v", found["up"])
+	}
+
+	// the same tree has no differences
+	diffs, err = client.DiffTrees(ncLocal, ncLocal, "site", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(diffs) != 0 {
+		t.Errorf("Expected no diffs, got: %+v", diffs)
+	}
+}
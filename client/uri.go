@@ -2,10 +2,12 @@ package client
 
 import (
 	"fmt"
+	"net"
 	"strings"
 )
 
-// returns protocol, server, port, err
+// returns protocol, server, port, err. IPv6 literal servers are enclosed in
+// brackets in the URI (nats://[2001:db8::1]:4222) and returned without them.
 func parseURI(uri string) (string, string, string, error) {
 	uri = strings.Trim(uri, " ")
 	parts := strings.Split(uri, "://")
@@ -16,6 +18,23 @@ func parseURI(uri string) (string, string, string, error) {
 	proto := parts[0]
 	server := parts[1]
 
+	if strings.HasPrefix(server, "[") {
+		end := strings.Index(server, "]")
+		if end < 0 {
+			return "", "", "", fmt.Errorf("URI %v is missing ] in IPv6 address", uri)
+		}
+
+		port := ""
+		if rest := server[end+1:]; rest != "" {
+			if !strings.HasPrefix(rest, ":") {
+				return "", "", "", fmt.Errorf("URI %v has invalid port", uri)
+			}
+			port = rest[1:]
+		}
+
+		return proto, server[1:end], port, nil
+	}
+
 	parts = strings.Split(server, ":")
 
 	port := ""
@@ -45,5 +64,45 @@ func sanitizeURI(uri string) (string, error) {
 		}
 	}
 
-	return fmt.Sprintf("%v://%v:%v", proto, server, port), nil
+	return fmt.Sprintf("%v://%v", proto, net.JoinHostPort(server, port)), nil
+}
+
+// splitURIPath returns uri without its path and the path, for example
+// wss://myserver.com/nats returns wss://myserver.com and /nats
+func splitURIPath(uri string) (string, string) {
+	uri = strings.Trim(uri, " ")
+	start := strings.Index(uri, "://")
+	if start < 0 {
+		return uri, ""
+	}
+	start += len("://")
+
+	i := strings.Index(uri[start:], "/")
+	if i < 0 {
+		return uri, ""
+	}
+	i += start
+
+	path := uri[i:]
+	if path == "/" {
+		path = ""
+	}
+
+	return uri[:i], path
+}
+
+// websocketURI converts a NATS URI to a NATS WebSocket URI. ws:// and wss://
+// URIs are returned as is, other URIs are converted to wss:// on the default
+// port (443).
+func websocketURI(uri string) (string, error) {
+	proto, server, _, err := parseURI(uri)
+	if err != nil {
+		return uri, err
+	}
+
+	if proto == "ws" || proto == "wss" {
+		return uri, nil
+	}
+
+	return "wss://" + net.JoinHostPort(server, "443"), nil
 }
@@ -61,6 +61,25 @@ func TestNatsURIPartsSpaces(t *testing.T) {
 	}
 }
 
+func TestNatsURIPartsIPv6(t *testing.T) {
+	proto, server, port, err := parseURI("nats://[2001:db8::1]:4222")
+	if err != nil {
+		t.Error(err)
+	}
+
+	if proto != "nats" {
+		t.Error("Wrong proto, expected nats, got: ", proto)
+	}
+
+	if server != "2001:db8::1" {
+		t.Error("Wrong server, expected 2001:db8::1, got: ", server)
+	}
+
+	if port != "4222" {
+		t.Error("Wrong port, expected 4222, got: ", port)
+	}
+}
+
 type sanitizeTests struct {
 	in  string
 	exp string
@@ -73,6 +92,8 @@ func TestSanitizeURI(t *testing.T) {
 		{"ws://myserver.com", "ws://myserver.com:80"},
 		{"wss://myserver.com", "wss://myserver.com:443"},
 		{"wsss://myserver.com", "wsss://myserver.com:4222"},
+		{"nats://[2001:db8::1]", "nats://[2001:db8::1]:4222"},
+		{"wss://[::1]:8443", "wss://[::1]:8443"},
 	}
 
 	for _, test := range tests {
@@ -93,4 +114,50 @@ func TestSanitizeURIError(t *testing.T) {
 	if err == nil {
 		t.Error("Expected error")
 	}
+
+	_, err = sanitizeURI("nats://[2001:db8::1:4222")
+	if err == nil {
+		t.Error("Expected error for unterminated IPv6 address")
+	}
+}
+
+func TestSplitURIPath(t *testing.T) {
+	tests := []struct {
+		in, uri, path string
+	}{
+		{"wss://myserver.com", "wss://myserver.com", ""},
+		{"wss://myserver.com/", "wss://myserver.com", ""},
+		{"wss://myserver.com/nats", "wss://myserver.com", "/nats"},
+		{"wss://myserver.com:8443/siot/nats", "wss://myserver.com:8443", "/siot/nats"},
+		{"wss://[::1]/nats", "wss://[::1]", "/nats"},
+	}
+
+	for _, test := range tests {
+		uri, path := splitURIPath(test.in)
+		if uri != test.uri || path != test.path {
+			t.Errorf("Error splitting %v, got %v %v, expected %v %v", test.in,
+				uri, path, test.uri, test.path)
+		}
+	}
+}
+
+func TestWebsocketURI(t *testing.T) {
+	tests := []sanitizeTests{
+		{"nats://myserver.com:4222", "wss://myserver.com:443"},
+		{"tls://myserver.com", "wss://myserver.com:443"},
+		{"nats://[2001:db8::1]:4222", "wss://[2001:db8::1]:443"},
+		{"ws://myserver.com:8080", "ws://myserver.com:8080"},
+		{"wss://myserver.com", "wss://myserver.com"},
+	}
+
+	for _, test := range tests {
+		s, err := websocketURI(test.in)
+		if err != nil {
+			t.Errorf("Error converting %v: %v", test.in, err)
+		}
+
+		if s != test.exp {
+			t.Errorf("Error converting %v, got %v, expected %v", test.in, s, test.exp)
+		}
+	}
 }
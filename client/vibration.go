@@ -0,0 +1,412 @@
+package client
+
+import (
+	"log"
+	"math"
+	"math/cmplx"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// Vibration computes condition monitoring features from the high rate
+// (phr.*) SensorPointType (defaults to value) points of SensorNodeID, for
+// example an accelerometer on a motor or pump, so raw waveforms never have
+// to leave the edge. Every Period seconds (defaults to 10), the last
+// WindowSize samples (defaults to 1024, rounded down to a power of two) are
+// analyzed and the RMS, Peak, CrestFactor, and Kurtosis of the signal (with
+// the mean removed) are written to the node. If there are no new samples
+// since the last analysis, nothing is written. SampleRate is the sample rate
+// in Hz and is estimated from the point times if 0.
+//
+// Each VibrationBand child is a frequency band of the spectrum of the window
+// (Hann windowed), and its Value is the RMS of the signal in the band, which
+// is the square root of the band energy.
+type Vibration struct {
+	ID              string          `node:"id"`
+	Parent          string          `node:"parent"`
+	Description     string          `point:"description"`
+	SensorNodeID    string          `point:"sensorNodeID"`
+	SensorPointType string          `point:"sensorPointType"`
+	SampleRate      float64         `point:"sampleRate"`
+	WindowSize      int             `point:"windowSize"`
+	Period          float64         `point:"period"`
+	Disable         bool            `point:"disable"`
+	Rms             float64         `point:"rms"`
+	Peak            float64         `point:"peak"`
+	CrestFactor     float64         `point:"crestFactor"`
+	Kurtosis        float64         `point:"kurtosis"`
+	Bands           []VibrationBand `child:"vibrationBand"`
+}
+
+// VibrationBand is a frequency band from LowFrequency up to (but not
+// including) HighFrequency in Hz. Value is the RMS of the signal in the band.
+type VibrationBand struct {
+	ID            string  `node:"id"`
+	Parent        string  `node:"parent"`
+	Description   string  `point:"description"`
+	LowFrequency  float64 `point:"lowFrequency"`
+	HighFrequency float64 `point:"highFrequency"`
+	Value         float64 `point:"value"`
+}
+
+// vibrationFeatures are the results of analyzing a window of samples
+type vibrationFeatures struct {
+	rms         float64
+	peak        float64
+	crestFactor float64
+	kurtosis    float64
+	// band RMS values, in the order of the bands
+	bands []float64
+}
+
+// vibrationWindowSize returns the number of samples to analyze
+func vibrationWindowSize(v *Vibration) int {
+	size := v.WindowSize
+	if size <= 0 {
+		size = 1024
+	}
+
+	n := 8
+	for n*2 <= size {
+		n *= 2
+	}
+
+	return n
+}
+
+// fft computes the discrete Fourier transform of x in place. The length of
+// x must be a power of two.
+func fft(x []complex128) {
+	n := len(x)
+
+	// bit reversal permutation
+	for i, j := 1, 0; i < n; i++ {
+		bit := n >> 1
+		for ; j&bit != 0; bit >>= 1 {
+			j ^= bit
+		}
+		j ^= bit
+		if i < j {
+			x[i], x[j] = x[j], x[i]
+		}
+	}
+
+	for size := 2; size <= n; size <<= 1 {
+		w := cmplx.Exp(complex(0, -2*math.Pi/float64(size)))
+		for start := 0; start < n; start += size {
+			wk := complex(1, 0)
+			for k := 0; k < size/2; k++ {
+				a := x[start+k]
+				b := x[start+k+size/2] * wk
+				x[start+k] = a + b
+				x[start+k+size/2] = a - b
+				wk *= w
+			}
+		}
+	}
+}
+
+// vibrationAnalyze computes features of samples, which must have a power of
+// two length. Band values are only computed if the sample rate is known.
+func vibrationAnalyze(samples []float64, sampleRate float64, bands []VibrationBand) vibrationFeatures {
+	n := len(samples)
+	var ret vibrationFeatures
+
+	mean := 0.0
+	for _, s := range samples {
+		mean += s
+	}
+	mean /= float64(n)
+
+	var m2, m4 float64
+	for _, s := range samples {
+		d := s - mean
+		m2 += d * d
+		m4 += d * d * d * d
+		if math.Abs(d) > ret.peak {
+			ret.peak = math.Abs(d)
+		}
+	}
+	m2 /= float64(n)
+	m4 /= float64(n)
+
+	ret.rms = math.Sqrt(m2)
+	if m2 > 0 {
+		ret.crestFactor = ret.peak / ret.rms
+		ret.kurtosis = m4 / (m2 * m2)
+	}
+
+	if sampleRate <= 0 || len(bands) <= 0 {
+		return ret
+	}
+
+	x := make([]complex128, n)
+	for i, s := range samples {
+		hann := 0.5 * (1 - math.Cos(2*math.Pi*float64(i)/float64(n)))
+		x[i] = complex((s-mean)*hann, 0)
+	}
+
+	fft(x)
+
+	// mean square of the signal in each bin of the one sided spectrum,
+	// corrected for the energy lost to the Hann window (mean of the window
+	// squared is 3/8)
+	power := make([]float64, n/2+1)
+	for k := range power {
+		p := real(x[k])*real(x[k]) + imag(x[k])*imag(x[k])
+		p /= float64(n) * float64(n) * 0.375
+		if k != 0 && k != n/2 {
+			p *= 2
+		}
+		power[k] = p
+	}
+
+	binWidth := sampleRate / float64(n)
+
+	ret.bands = make([]float64, len(bands))
+	for i, b := range bands {
+		sum := 0.0
+		for k, p := range power {
+			f := float64(k) * binWidth
+			if f >= b.LowFrequency && f < b.HighFrequency {
+				sum += p
+			}
+		}
+		ret.bands[i] = math.Sqrt(sum)
+	}
+
+	return ret
+}
+
+type vibrationSample struct {
+	value float64
+	time  time.Time
+}
+
+// VibrationClient is a SIOT client that runs vibration analysis nodes
+type VibrationClient struct {
+	nc            *nats.Conn
+	config        Vibration
+	stop          chan struct{}
+	newPoints     chan NewPoints
+	newEdgePoints chan NewPoints
+	newSamples    chan []vibrationSample
+	sensorSub     *nats.Subscription
+	sensorKey     string
+	samples       []vibrationSample
+	// number of samples received since the last analysis
+	received int
+}
+
+// NewVibrationClient ...
+func NewVibrationClient(nc *nats.Conn, config Vibration) Client {
+	return &VibrationClient{
+		nc:            nc,
+		config:        config,
+		stop:          make(chan struct{}),
+		newPoints:     make(chan NewPoints),
+		newEdgePoints: make(chan NewPoints),
+		newSamples:    make(chan []vibrationSample),
+	}
+}
+
+// Start runs the main logic for this client and blocks until stopped
+func (v *VibrationClient) Start() error {
+	log.Println("Starting vibration client: ", v.config.Description)
+
+	v.subscribeSensor()
+
+	ticker := time.NewTicker(v.period())
+	defer ticker.Stop()
+
+done:
+	for {
+		select {
+		case <-v.stop:
+			log.Println("Stopping vibration client: ", v.config.Description)
+			break done
+		case <-ticker.C:
+			v.analyze(time.Now())
+		case samples := <-v.newSamples:
+			v.samples = append(v.samples, samples...)
+			v.received += len(samples)
+			if n := vibrationWindowSize(&v.config); len(v.samples) > n {
+				v.samples = v.samples[len(v.samples)-n:]
+			}
+		case pts := <-v.newPoints:
+			err := data.MergePoints(pts.ID, pts.Points, &v.config)
+			if err != nil {
+				log.Println("error merging new points: ", err)
+			}
+
+			if pts.ID != v.config.ID {
+				continue
+			}
+
+			for _, p := range pts.Points {
+				switch p.Type {
+				case data.PointTypeSensorNodeID, data.PointTypeSensorPointType:
+					v.subscribeSensor()
+				case data.PointTypePeriod:
+					ticker.Reset(v.period())
+				}
+			}
+		case pts := <-v.newEdgePoints:
+			err := data.MergeEdgePoints(pts.ID, pts.Parent, pts.Points, &v.config)
+			if err != nil {
+				log.Println("error merging new points: ", err)
+			}
+		}
+	}
+
+	if v.sensorSub != nil {
+		v.sensorSub.Unsubscribe()
+	}
+
+	return nil
+}
+
+func (v *VibrationClient) period() time.Duration {
+	if v.config.Period <= 0 {
+		return 10 * time.Second
+	}
+	return time.Duration(v.config.Period * float64(time.Second))
+}
+
+// analyze computes features of the last window of samples and writes them
+// to the node and its bands
+func (v *VibrationClient) analyze(now time.Time) {
+	n := vibrationWindowSize(&v.config)
+
+	if v.config.Disable || v.received <= 0 || len(v.samples) < n {
+		return
+	}
+
+	v.received = 0
+	window := v.samples[len(v.samples)-n:]
+
+	sampleRate := v.config.SampleRate
+	if sampleRate <= 0 {
+		dt := window[n-1].time.Sub(window[0].time).Seconds()
+		if dt > 0 {
+			sampleRate = float64(n-1) / dt
+		}
+	}
+
+	values := make([]float64, n)
+	for i, s := range window {
+		values[i] = s.value
+	}
+
+	f := vibrationAnalyze(values, sampleRate, v.config.Bands)
+
+	v.config.Rms = f.rms
+	v.config.Peak = f.peak
+	v.config.CrestFactor = f.crestFactor
+	v.config.Kurtosis = f.kurtosis
+
+	err := SendNodePoints(v.nc, v.config.ID, data.Points{
+		{Time: now, Type: data.PointTypeRms, Value: f.rms},
+		{Time: now, Type: data.PointTypePeak, Value: f.peak},
+		{Time: now, Type: data.PointTypeCrestFactor, Value: f.crestFactor},
+		{Time: now, Type: data.PointTypeKurtosis, Value: f.kurtosis},
+	}, false)
+	if err != nil {
+		log.Printf("Vibration %v: error sending features: %v\n", v.config.Description, err)
+	}
+
+	if sampleRate <= 0 && len(v.config.Bands) > 0 {
+		log.Printf("Vibration %v: sample rate unknown, bands not computed\n",
+			v.config.Description)
+	}
+
+	for i, value := range f.bands {
+		b := &v.config.Bands[i]
+		b.Value = value
+		err := SendNodePoint(v.nc, b.ID, data.Point{Time: now,
+			Type: data.PointTypeValue, Value: value}, false)
+		if err != nil {
+			log.Printf("Vibration %v: error sending band %v: %v\n",
+				v.config.Description, b.Description, err)
+		}
+	}
+}
+
+// subscribeSensor subscribes to the high rate points of the sensor node
+func (v *VibrationClient) subscribeSensor() {
+	pointType := v.config.SensorPointType
+	if pointType == "" {
+		pointType = data.PointTypeValue
+	}
+
+	key := v.config.SensorNodeID + "." + pointType
+	if v.sensorSub != nil && key == v.sensorKey {
+		return
+	}
+
+	if v.sensorSub != nil {
+		v.sensorSub.Unsubscribe()
+		v.sensorSub = nil
+	}
+
+	v.sensorKey = key
+	v.samples = nil
+	v.received = 0
+
+	if v.config.SensorNodeID == "" {
+		return
+	}
+
+	var err error
+	v.sensorSub, err = v.nc.Subscribe(SubjectNodeHRPoints(v.config.SensorNodeID),
+		func(msg *nats.Msg) {
+			points, err := DecodePoints(msg)
+			if err != nil {
+				log.Println("Vibration: error decoding sensor points: ", err)
+				return
+			}
+
+			var samples []vibrationSample
+			for _, p := range points {
+				if p.Type != pointType {
+					continue
+				}
+				if p.Time.IsZero() {
+					p.Time = time.Now()
+				}
+				samples = append(samples, vibrationSample{value: p.Value, time: p.Time})
+			}
+
+			if len(samples) <= 0 {
+				return
+			}
+
+			select {
+			case v.newSamples <- samples:
+			case <-v.stop:
+			}
+		})
+	if err != nil {
+		log.Printf("Vibration %v: error subscribing to sensor: %v\n",
+			v.config.Description, err)
+	}
+}
+
+// Stop sends a signal to the Start function to exit
+func (v *VibrationClient) Stop(err error) {
+	close(v.stop)
+}
+
+// Points is called by the Manager when new points for this
+// node are received.
+func (v *VibrationClient) Points(nodeID string, points []data.Point) {
+	v.newPoints <- NewPoints{nodeID, "", points}
+}
+
+// EdgePoints is called by the Manager when new edge points for this
+// node are received.
+func (v *VibrationClient) EdgePoints(nodeID, parentID string, points []data.Point) {
+	v.newEdgePoints <- NewPoints{nodeID, parentID, points}
+}
@@ -0,0 +1,120 @@
+package client_test
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+	"github.com/simpleiot/simpleiot/server"
+)
+
+func TestVibration(t *testing.T) {
+	nc, root, stop, err := server.TestServer()
+	if err != nil {
+		t.Fatal("Error starting test server: ", err)
+	}
+	defer stop()
+
+	err = client.SendNodeType(nc, client.Vibration{
+		ID:           "vib",
+		Parent:       root.ID,
+		Description:  "pump bearing",
+		SensorNodeID: "accel",
+		SampleRate:   1000,
+		WindowSize:   256,
+		Period:       0.1,
+	}, "test")
+	if err != nil {
+		t.Fatal("Error sending vibration node: ", err)
+	}
+
+	for _, b := range []client.VibrationBand{
+		{ID: "low", Parent: "vib", LowFrequency: 30, HighFrequency: 70},
+		{ID: "high", Parent: "vib", LowFrequency: 200, HighFrequency: 400},
+	} {
+		err = client.SendNodeType(nc, b, "test")
+		if err != nil {
+			t.Fatal("Error sending band node: ", err)
+		}
+	}
+
+	// wait for the client to restart with the bands
+	time.Sleep(500 * time.Millisecond)
+
+	// 50Hz sine with an amplitude of 2 on top of a 1g offset
+	start := time.Now()
+	var points data.Points
+	for i := 0; i < 512; i++ {
+		points = append(points, data.Point{
+			Time:  start.Add(time.Duration(i) * time.Millisecond),
+			Type:  data.PointTypeValue,
+			Value: 1 + 2*math.Sin(2*math.Pi*50*float64(i)/1000),
+		})
+	}
+
+	err = client.SendPoints(nc, client.SubjectNodeHRPoints("accel"), points, false)
+	if err != nil {
+		t.Fatal("Error sending high rate points: ", err)
+	}
+
+	var vib []client.Vibration
+	timeout := time.After(5 * time.Second)
+	for {
+		vib, err = client.GetNodeType[client.Vibration](nc, "vib", "")
+		if err != nil {
+			t.Fatal("Error getting vibration node: ", err)
+		}
+
+		if len(vib) > 0 && vib[0].Rms > 0 {
+			break
+		}
+
+		select {
+		case <-timeout:
+			t.Fatal("Timeout waiting for vibration features")
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+
+	v := vib[0]
+	near := func(a, b float64) bool {
+		return math.Abs(a-b) < 0.05*b
+	}
+
+	if !near(v.Rms, math.Sqrt2) || !near(v.Peak, 2) ||
+		!near(v.CrestFactor, math.Sqrt2) || !near(v.Kurtosis, 1.5) {
+		t.Errorf("Features not correct: %+v", v)
+	}
+
+	// band values are written after the node features
+	getBand := func(id string) float64 {
+		t.Helper()
+		timeout := time.After(time.Second)
+		for {
+			bands, err := client.GetNodeType[client.VibrationBand](nc, id, "")
+			if err != nil || len(bands) < 1 {
+				t.Fatal("Error getting band: ", err)
+			}
+
+			select {
+			case <-timeout:
+				return bands[0].Value
+			case <-time.After(50 * time.Millisecond):
+			}
+
+			if bands[0].Value != 0 {
+				return bands[0].Value
+			}
+		}
+	}
+
+	if b := getBand("low"); !near(b, math.Sqrt2) {
+		t.Error("Low band not correct: ", b)
+	}
+
+	if b := getBand("high"); b > 0.01 {
+		t.Error("High band not correct: ", b)
+	}
+}
@@ -0,0 +1,146 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// WatchTTL is how long the store keeps a watch that is not renewed.
+// Watchers renew their watch every WatchTTL/3.
+var WatchTTL = time.Minute
+
+// WatchFilter selects the point changes sent to a watch. Parent limits the
+// watch to the parent and nodes below it (the entire tree if blank).
+// NodeTypes and PointTypes limit it to nodes and points of those types (all
+// if empty). If Deadband is set, a point is only sent when its value differs
+// by at least Deadband from the last value sent for the same node, point
+// type, and key, or when its text changes.
+type WatchFilter struct {
+	Parent     string   `json:"parent,omitempty"`
+	NodeTypes  []string `json:"nodeTypes,omitempty"`
+	PointTypes []string `json:"pointTypes,omitempty"`
+	Deadband   float64  `json:"deadband,omitempty"`
+}
+
+// WatchRequest creates or renews a watch, or cancels it if Cancel is set.
+// Point changes are published to <Deliver>.<nodeID>.
+type WatchRequest struct {
+	ID      string      `json:"id"`
+	Deliver string      `json:"deliver"`
+	Filter  WatchFilter `json:"filter"`
+	Cancel  bool        `json:"cancel,omitempty"`
+}
+
+// Watcher receives the point changes of a watch (see Watch)
+type Watcher struct {
+	nc       *nats.Conn
+	req      WatchRequest
+	sub      *nats.Subscription
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// Watch asks the store to send point changes that match filter to handler,
+// so consumers that only need a few point types don't have to subscribe to
+// all points and discard most of them. handler is called from a NATS
+// subscription callback. Stop must be called when the watch is no longer
+// needed.
+func Watch(nc *nats.Conn, filter WatchFilter,
+	handler func(nodeID string, points data.Points)) (*Watcher, error) {
+	w := &Watcher{
+		nc: nc,
+		req: WatchRequest{
+			ID:      uuid.New().String(),
+			Deliver: nats.NewInbox(),
+			Filter:  filter,
+		},
+		stop: make(chan struct{}),
+	}
+
+	var err error
+	w.sub, err = nc.Subscribe(w.req.Deliver+".*", func(msg *nats.Msg) {
+		points, err := DecodePoints(msg)
+		if err != nil {
+			log.Println("Watch: error decoding points: ", err)
+			return
+		}
+
+		handler(strings.TrimPrefix(msg.Subject, w.req.Deliver+"."), points)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = w.send(w.req)
+	if err != nil {
+		w.sub.Unsubscribe()
+		return nil, err
+	}
+
+	go w.renew()
+
+	return w, nil
+}
+
+func (w *Watcher) send(req WatchRequest) error {
+	d, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+
+	msg, err := w.nc.Request(SubjectWatch(), d, time.Second*20)
+	if err != nil {
+		return fmt.Errorf("Error sending watch request: %w", err)
+	}
+
+	if len(msg.Data) > 0 {
+		return errors.New(string(msg.Data))
+	}
+
+	return nil
+}
+
+// renew renews the watch until it is stopped. The watch is created again
+// if the store lost it, for example after a restart.
+func (w *Watcher) renew() {
+	ticker := time.NewTicker(WatchTTL / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			err := w.send(w.req)
+			if err != nil {
+				log.Println("Watch: error renewing: ", err)
+			}
+		case <-w.stop:
+			return
+		}
+	}
+}
+
+// Stop cancels the watch
+func (w *Watcher) Stop() error {
+	var err error
+
+	w.stopOnce.Do(func() {
+		close(w.stop)
+
+		req := w.req
+		req.Cancel = true
+		err = w.send(req)
+
+		w.sub.Unsubscribe()
+	})
+
+	return err
+}
@@ -0,0 +1,413 @@
+package client
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// Webhook calls URI when nodes under the parent node are created (OnCreate),
+// deleted (OnDelete), or change one of the point types in PointTypes (comma
+// separated, no point events are sent if blank). NodeTypes is a comma
+// separated list of node types that events are sent for, events are sent for
+// all nodes if it is blank. Each event is POSTed as a JSON WebhookEvent. If
+// Secret is set, the body is signed with HMAC-SHA256 and the signature is
+// sent in the X-SIOT-Signature header (see WebhookSignature).
+type Webhook struct {
+	ID          string `node:"id"`
+	Parent      string `node:"parent"`
+	Description string `point:"description"`
+	URI         string `point:"uri"`
+	Secret      string `point:"secret"`
+	OnCreate    bool   `point:"onCreate"`
+	OnDelete    bool   `point:"onDelete"`
+	PointTypes  string `point:"pointTypes"`
+	NodeTypes   string `point:"nodeTypes"`
+	Disable     bool   `point:"disable"`
+	Tx          int    `point:"tx"`
+	ErrorCount  int    `point:"errorCount"`
+}
+
+// webhook events
+const (
+	WebhookEventCreated = "created"
+	WebhookEventDeleted = "deleted"
+	WebhookEventPoints  = "points"
+)
+
+// WebhookEvent is the body of a webhook request. For created events, Points
+// contains the points the node was created with. For deleted events, Parent
+// is the parent the node was removed from.
+type WebhookEvent struct {
+	Event    string      `json:"event"`
+	Time     time.Time   `json:"time"`
+	NodeID   string      `json:"nodeId"`
+	NodeType string      `json:"nodeType,omitempty"`
+	Parent   string      `json:"parent,omitempty"`
+	Points   data.Points `json:"points,omitempty"`
+}
+
+// max number of events queued while the webhook URI is not reachable
+var webhookMaxQueue = 1000
+
+// how often failed events are checked for retry
+var webhookRetryPeriod = time.Second
+
+// WebhookSignature returns the value of the X-SIOT-Signature header for a
+// request body. Receivers should compute this using the shared secret and
+// compare it with hmac.Equal.
+func WebhookSignature(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// WebhookClient is a SIOT client that calls webhooks on node lifecycle
+// events
+type WebhookClient struct {
+	nc            *nats.Conn
+	config        Webhook
+	stop          chan struct{}
+	newPoints     chan NewPoints
+	newEdgePoints chan NewPoints
+	newUpPoints   chan NewPoints
+	newUpEdges    chan NewPoints
+	pointTypes    map[string]bool
+	nodeTypes     map[string]bool
+	// nodes is used to detect new nodes and maps node IDs to types
+	nodes      map[string]string
+	queue      []WebhookEvent
+	httpClient *http.Client
+	attempts   int
+	retryAt    time.Time
+}
+
+// NewWebhookClient ...
+func NewWebhookClient(nc *nats.Conn, config Webhook) Client {
+	return &WebhookClient{
+		nc:            nc,
+		config:        config,
+		stop:          make(chan struct{}),
+		newPoints:     make(chan NewPoints),
+		newEdgePoints: make(chan NewPoints),
+		newUpPoints:   make(chan NewPoints),
+		newUpEdges:    make(chan NewPoints),
+		httpClient:    &http.Client{Timeout: forwarderTimeout},
+	}
+}
+
+// Start runs the main logic for this client and blocks until stopped
+func (w *WebhookClient) Start() error {
+	log.Println("Starting webhook client: ", w.config.Description)
+
+	bufOpts := BufferOptions{
+		Size:          10000,
+		Policy:        BufferDropOldest,
+		MetricsNodeID: w.config.ID,
+	}
+
+	upSub, err := NewBufferedSub(w.nc, fmt.Sprintf("up.%v.*.points", w.config.Parent),
+		bufOpts, func(subject string, points data.Points) {
+			chunks := strings.Split(subject, ".")
+			if len(chunks) != 4 {
+				log.Println("Webhook up sub, malformed subject: ", subject)
+				return
+			}
+
+			// don't send events for our own stats
+			if chunks[2] == w.config.ID {
+				return
+			}
+
+			select {
+			case w.newUpPoints <- NewPoints{chunks[2], "", points}:
+			case <-w.stop:
+			}
+		})
+	if err != nil {
+		return fmt.Errorf("Webhook error subscribing to upsub: %v", err)
+	}
+
+	upSubEdges, err := NewBufferedSub(w.nc, fmt.Sprintf("up.%v.*.*.points", w.config.Parent),
+		bufOpts, func(subject string, points data.Points) {
+			chunks := strings.Split(subject, ".")
+			if len(chunks) != 5 {
+				log.Println("Webhook up edge sub, malformed subject: ", subject)
+				return
+			}
+
+			select {
+			case w.newUpEdges <- NewPoints{chunks[2], chunks[3], points}:
+			case <-w.stop:
+			}
+		})
+	if err != nil {
+		upSub.Stop()
+		return fmt.Errorf("Webhook error subscribing to up edge sub: %v", err)
+	}
+
+	// existing nodes are not reported as created
+	w.nodes = make(map[string]string)
+	children, err := GetNodeChildren(w.nc, w.config.Parent, "", false, true)
+	if err != nil {
+		log.Printf("Webhook %v: error getting nodes: %v\n", w.config.Description, err)
+	}
+
+	for _, c := range children {
+		w.nodes[c.ID] = c.Type
+	}
+
+	w.configure()
+
+	retryTicker := time.NewTicker(webhookRetryPeriod)
+	defer retryTicker.Stop()
+
+done:
+	for {
+		select {
+		case <-w.stop:
+			log.Println("Stopping webhook client: ", w.config.Description)
+			break done
+		case <-retryTicker.C:
+			w.send()
+		case pts := <-w.newPoints:
+			err := data.MergePoints(pts.ID, pts.Points, &w.config)
+			if err != nil {
+				log.Println("error merging new points: ", err)
+			}
+
+			for _, p := range pts.Points {
+				switch p.Type {
+				case data.PointTypePointTypes, data.PointTypeNodeTypes,
+					data.PointTypeURI:
+					w.configure()
+				}
+			}
+		case pts := <-w.newEdgePoints:
+			err := data.MergeEdgePoints(pts.ID, pts.Parent, pts.Points, &w.config)
+			if err != nil {
+				log.Println("error merging new points: ", err)
+			}
+		case pts := <-w.newUpPoints:
+			w.handlePoints(pts.ID, pts.Points)
+			w.send()
+		case pts := <-w.newUpEdges:
+			w.handleEdgePoints(pts.ID, pts.Parent, pts.Points)
+			w.send()
+		}
+	}
+
+	upSub.Stop()
+	upSubEdges.Stop()
+
+	return nil
+}
+
+func (w *WebhookClient) configure() {
+	w.pointTypes = make(map[string]bool)
+	for _, t := range splitList(w.config.PointTypes) {
+		w.pointTypes[t] = true
+	}
+
+	w.nodeTypes = make(map[string]bool)
+	for _, t := range splitList(w.config.NodeTypes) {
+		w.nodeTypes[t] = true
+	}
+
+	w.attempts = 0
+	w.retryAt = time.Time{}
+}
+
+func (w *WebhookClient) nodeTypeMatch(typ string) bool {
+	return len(w.nodeTypes) <= 0 || w.nodeTypes[typ]
+}
+
+// handlePoints queues created and point events. A node is created when we
+// see a node type point for a node we don't know about yet.
+func (w *WebhookClient) handlePoints(nodeID string, points data.Points) {
+	typ, known := w.nodes[nodeID]
+
+	if !known {
+		for _, p := range points {
+			if p.Type == data.PointTypeNodeType {
+				typ = p.Text
+				w.nodes[nodeID] = typ
+
+				if w.config.OnCreate && w.nodeTypeMatch(typ) {
+					w.queueEvent(WebhookEvent{
+						Event:    WebhookEventCreated,
+						NodeID:   nodeID,
+						NodeType: typ,
+						Points:   points,
+					})
+				}
+				return
+			}
+		}
+	}
+
+	if len(w.pointTypes) <= 0 || !w.nodeTypeMatch(typ) {
+		return
+	}
+
+	var changed data.Points
+	for _, p := range points {
+		if w.pointTypes[p.Type] {
+			changed = append(changed, p)
+		}
+	}
+
+	if len(changed) > 0 {
+		w.queueEvent(WebhookEvent{
+			Event:    WebhookEventPoints,
+			NodeID:   nodeID,
+			NodeType: typ,
+			Points:   changed,
+		})
+	}
+}
+
+// handleEdgePoints queues deleted events
+func (w *WebhookClient) handleEdgePoints(nodeID, parentID string, points data.Points) {
+	for _, p := range points {
+		if p.Type != data.PointTypeTombstone || p.Value == 0 {
+			continue
+		}
+
+		typ, known := w.nodes[nodeID]
+		if !known {
+			return
+		}
+
+		// a node that is added again is reported as created
+		delete(w.nodes, nodeID)
+
+		if w.config.OnDelete && w.nodeTypeMatch(typ) {
+			w.queueEvent(WebhookEvent{
+				Event:    WebhookEventDeleted,
+				NodeID:   nodeID,
+				NodeType: typ,
+				Parent:   parentID,
+			})
+		}
+		return
+	}
+}
+
+func (w *WebhookClient) queueEvent(e WebhookEvent) {
+	if w.config.Disable {
+		return
+	}
+
+	e.Time = time.Now()
+	w.queue = append(w.queue, e)
+
+	if len(w.queue) > webhookMaxQueue {
+		log.Printf("Webhook %v: queue full, dropping event\n", w.config.Description)
+		w.queue = w.queue[1:]
+	}
+}
+
+// send sends queued events until the queue is empty or a send fails. After
+// a failure, sending is retried with an exponential backoff.
+func (w *WebhookClient) send() {
+	if w.config.Disable || w.config.URI == "" || time.Now().Before(w.retryAt) {
+		return
+	}
+
+	for len(w.queue) > 0 {
+		err := w.post(w.queue[0])
+		if err != nil {
+			fe, ok := err.(*forwarderError)
+			permanent := ok && fe.permanent
+
+			log.Printf("Webhook %v: error sending event (permanent: %v): %v\n",
+				w.config.Description, permanent, err)
+			w.sendStat(data.PointTypeErrorCount, &w.config.ErrorCount)
+
+			if !permanent {
+				w.retryAt = time.Now().Add(ExpBackoff(w.attempts, forwarderMaxBackoff))
+				w.attempts++
+				return
+			}
+		} else {
+			w.sendStat(data.PointTypeTx, &w.config.Tx)
+		}
+
+		w.attempts = 0
+		w.queue = w.queue[1:]
+	}
+}
+
+// post sends one event to the webhook URI
+func (w *WebhookClient) post(e WebhookEvent) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return &forwarderError{msg: fmt.Sprintf("error encoding event: %v", err), permanent: true}
+	}
+
+	req, err := http.NewRequest(http.MethodPost, w.config.URI, bytes.NewReader(body))
+	if err != nil {
+		return &forwarderError{msg: fmt.Sprintf("invalid URI: %v", err), permanent: true}
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-SIOT-Event", e.Event)
+	if w.config.Secret != "" {
+		req.Header.Set("X-SIOT-Signature", WebhookSignature(w.config.Secret, body))
+	}
+
+	resp, err := w.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+
+	return httpStatusError(resp, respBody)
+}
+
+// sendStat increments a counter and sends it
+func (w *WebhookClient) sendStat(typ string, counter *int) {
+	*counter++
+	err := SendNodePoint(w.nc, w.config.ID, data.Point{
+		Time:  time.Now(),
+		Type:  typ,
+		Value: float64(*counter),
+	}, false)
+	if err != nil {
+		log.Println("Webhook: error sending stat: ", err)
+	}
+}
+
+// Stop sends a signal to the Start function to exit
+func (w *WebhookClient) Stop(err error) {
+	close(w.stop)
+}
+
+// Points is called by the Manager when new points for this
+// node are received.
+func (w *WebhookClient) Points(nodeID string, points []data.Point) {
+	w.newPoints <- NewPoints{nodeID, "", points}
+}
+
+// EdgePoints is called by the Manager when new edge points for this
+// node are received.
+func (w *WebhookClient) EdgePoints(nodeID, parentID string, points []data.Point) {
+	w.newEdgePoints <- NewPoints{nodeID, parentID, points}
+}
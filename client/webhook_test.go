@@ -0,0 +1,149 @@
+package client_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+	"github.com/simpleiot/simpleiot/server"
+)
+
+func TestWebhook(t *testing.T) {
+	events := make(chan client.WebhookEvent, 100)
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Error("Error reading body: ", err)
+		}
+
+		if r.Header.Get("X-SIOT-Signature") != client.WebhookSignature("secret", body) {
+			t.Error("Wrong signature: ", r.Header.Get("X-SIOT-Signature"))
+		}
+
+		var e client.WebhookEvent
+		err = json.Unmarshal(body, &e)
+		if err != nil {
+			t.Error("Error decoding event: ", err)
+		}
+
+		if r.Header.Get("X-SIOT-Event") != e.Event {
+			t.Error("Wrong event header: ", r.Header.Get("X-SIOT-Event"))
+		}
+
+		events <- e
+	}))
+	defer s.Close()
+
+	nc, root, stop, err := server.TestServer()
+	if err != nil {
+		t.Fatal("Error starting test server: ", err)
+	}
+	defer stop()
+
+	err = client.SendNodeType(nc, client.Variable{ID: "var", Parent: root.ID}, "test")
+	if err != nil {
+		t.Fatal("Error sending variable node: ", err)
+	}
+
+	err = client.SendNodeType(nc, client.Webhook{
+		ID:          "wh",
+		Parent:      root.ID,
+		Description: "test webhook",
+		URI:         s.URL,
+		Secret:      "secret",
+		OnCreate:    true,
+		OnDelete:    true,
+		PointTypes:  data.PointTypeValue,
+		NodeTypes:   data.NodeTypeVariable,
+	}, "test")
+	if err != nil {
+		t.Fatal("Error sending webhook node: ", err)
+	}
+
+	timeout := time.After(10 * time.Second)
+
+	// the webhook may not be running yet, so keep sending until a point
+	// event is received
+	tick := time.NewTicker(200 * time.Millisecond)
+	defer tick.Stop()
+
+running:
+	for {
+		select {
+		case <-timeout:
+			t.Fatal("Timeout waiting for point event")
+		case <-tick.C:
+			err := client.SendNodePoints(nc, "var", data.Points{
+				{Type: data.PointTypeValue, Value: 12},
+				{Type: data.PointTypeDescription, Text: "not sent"},
+			}, true)
+			if err != nil {
+				t.Fatal("Error sending points: ", err)
+			}
+		case e := <-events:
+			if e.Event != client.WebhookEventPoints || e.NodeID != "var" ||
+				e.NodeType != data.NodeTypeVariable || len(e.Points) != 1 ||
+				e.Points[0].Value != 12 {
+				t.Fatal("Wrong point event: ", e)
+			}
+			break running
+		}
+	}
+
+	// drain point events that are still being sent
+	time.Sleep(300 * time.Millisecond)
+	for len(events) > 0 {
+		<-events
+	}
+
+	// node types that are not in the filter do not send events
+	err = client.SendNode(nc, data.NodeEdge{ID: "dev", Type: data.NodeTypeDevice,
+		Parent: root.ID}, "test")
+	if err != nil {
+		t.Fatal("Error sending device node: ", err)
+	}
+
+	err = client.SendNodeType(nc, client.Variable{ID: "var2", Parent: root.ID,
+		Description: "new var"}, "test")
+	if err != nil {
+		t.Fatal("Error sending variable node: ", err)
+	}
+
+	getEvent := func() client.WebhookEvent {
+		select {
+		case e := <-events:
+			return e
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timeout waiting for event")
+		}
+		return client.WebhookEvent{}
+	}
+
+	e := getEvent()
+	if e.Event != client.WebhookEventCreated || e.NodeID != "var2" ||
+		e.NodeType != data.NodeTypeVariable {
+		t.Fatal("Wrong created event: ", e)
+	}
+
+	desc, _ := e.Points.Text(data.PointTypeDescription, "")
+	if desc != "new var" {
+		t.Error("Created event does not include node points: ", e.Points)
+	}
+
+	err = client.DeleteNode(nc, "var2", root.ID, "test")
+	if err != nil {
+		t.Fatal("Error deleting node: ", err)
+	}
+
+	e = getEvent()
+	if e.Event != client.WebhookEventDeleted || e.NodeID != "var2" ||
+		e.Parent != root.ID {
+		t.Fatal("Wrong deleted event: ", e)
+	}
+}
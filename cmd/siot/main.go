@@ -4,6 +4,9 @@ import (
 	"log"
 	"os"
 
+	// time zone database for node timezone points on systems without one
+	_ "time/tzdata"
+
 	"github.com/simpleiot/simpleiot/server"
 )
 
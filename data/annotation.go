@@ -0,0 +1,88 @@
+package data
+
+import (
+	"time"
+)
+
+// Annotation is a comment attached to a node, or a point type in a node,
+// over a time range. This is used to explain anomalies in the data, such
+// as "sensor replaced here". Annotations are stored as points in the node
+// so they are synchronized and stored alongside history like any other point.
+type Annotation struct {
+	ID string `json:"id"`
+	// PointType is optional. If blank, the annotation applies to the
+	// entire node.
+	PointType string    `json:"pointType,omitempty"`
+	Text      string    `json:"text"`
+	User      string    `json:"user,omitempty"`
+	Start     time.Time `json:"start"`
+	// End is optional. If zero, the annotation is for a single point in time.
+	End time.Time `json:"end,omitempty"`
+}
+
+// ToPoint converts an annotation to a point. The point key is the
+// annotation ID, value is the duration in seconds, and the annotated point
+// type is stored in the data field.
+func (a Annotation) ToPoint() Point {
+	var dur float64
+	if !a.End.IsZero() {
+		dur = a.End.Sub(a.Start).Seconds()
+	}
+
+	return Point{
+		Type:   PointTypeAnnotation,
+		Key:    a.ID,
+		Time:   a.Start,
+		Value:  dur,
+		Text:   a.Text,
+		Data:   []byte(a.PointType),
+		Origin: a.User,
+	}
+}
+
+// PointToAnnotation converts an annotation point back to an annotation
+func PointToAnnotation(p Point) Annotation {
+	ret := Annotation{
+		ID:        p.Key,
+		PointType: string(p.Data),
+		Text:      p.Text,
+		User:      p.Origin,
+		Start:     p.Time,
+	}
+
+	if p.Value != 0 {
+		ret.End = p.Time.Add(time.Duration(p.Value * float64(time.Second)))
+	}
+
+	return ret
+}
+
+// Overlaps returns true if the annotation overlaps the start/end time range.
+// A zero end means there is no end.
+func (a Annotation) Overlaps(start, end time.Time) bool {
+	aEnd := a.End
+	if aEnd.IsZero() {
+		aEnd = a.Start
+	}
+
+	if aEnd.Before(start) {
+		return false
+	}
+
+	if !end.IsZero() && a.Start.After(end) {
+		return false
+	}
+
+	return true
+}
+
+// Annotations returns all annotations (that are not deleted) in a list of points
+func (ps Points) Annotations() []Annotation {
+	var ret []Annotation
+	for _, p := range ps {
+		if p.Type == PointTypeAnnotation && p.Tombstone%2 == 0 {
+			ret = append(ret, PointToAnnotation(p))
+		}
+	}
+	return ret
+}
@@ -0,0 +1,100 @@
+package data
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+)
+
+// AttestRequest is sent by a device to get a challenge (only DeviceID is
+// set), and then to send the signed challenge
+type AttestRequest struct {
+	DeviceID  string `json:"deviceId"`
+	Challenge []byte `json:"challenge,omitempty"`
+	Signature []byte `json:"signature,omitempty"`
+}
+
+// AttestResponse contains the challenge for a device, or the NATS
+// credentials (creds file contents) issued after the device signed the
+// challenge
+type AttestResponse struct {
+	Challenge []byte `json:"challenge,omitempty"`
+	Creds     string `json:"creds,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// attestMessage returns the message signed for an attestation challenge. The
+// device ID is included so a signature can't be used for another device.
+func attestMessage(deviceID string, challenge []byte) []byte {
+	msg := []byte("siot-attest:" + deviceID + ":")
+	return append(msg, challenge...)
+}
+
+// SignAttestation signs a challenge with a device key. The key is typically
+// held in a TPM or secure element, which provides a crypto.Signer. Ed25519,
+// ECDSA, and RSA (PKCS #1 v1.5) keys are supported.
+func SignAttestation(key crypto.Signer, deviceID string, challenge []byte) ([]byte, error) {
+	msg := attestMessage(deviceID, challenge)
+
+	if _, ok := key.Public().(ed25519.PublicKey); ok {
+		return key.Sign(rand.Reader, msg, crypto.Hash(0))
+	}
+
+	digest := sha256.Sum256(msg)
+	return key.Sign(rand.Reader, digest[:], crypto.SHA256)
+}
+
+// VerifyAttestation checks the signature of a challenge with the public key
+// enrolled for a device
+func VerifyAttestation(pub crypto.PublicKey, deviceID string, challenge, sig []byte) error {
+	msg := attestMessage(deviceID, challenge)
+	digest := sha256.Sum256(msg)
+
+	switch k := pub.(type) {
+	case ed25519.PublicKey:
+		if !ed25519.Verify(k, msg, sig) {
+			return errors.New("invalid signature")
+		}
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(k, digest[:], sig) {
+			return errors.New("invalid signature")
+		}
+	case *rsa.PublicKey:
+		err := rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], sig)
+		if err != nil {
+			return errors.New("invalid signature")
+		}
+	default:
+		return fmt.Errorf("unsupported key type %T", pub)
+	}
+
+	return nil
+}
+
+// EncodePublicKey returns a public key as base64 encoded PKIX DER, which is
+// used to enroll devices (see PointTypeAttestationKey)
+func EncodePublicKey(pub crypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(der), nil
+}
+
+// ParsePublicKey parses a public key encoded with EncodePublicKey
+func ParsePublicKey(s string) (crypto.PublicKey, error) {
+	der, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return x509.ParsePKIXPublicKey(der)
+}
@@ -0,0 +1,62 @@
+package data
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+)
+
+func TestAttestation(t *testing.T) {
+	_, edKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	challenge := []byte("1234567890")
+
+	for _, key := range []crypto.Signer{edKey, ecKey, rsaKey} {
+		enc, err := EncodePublicKey(key.Public())
+		if err != nil {
+			t.Fatal("Error encoding key: ", err)
+		}
+
+		pub, err := ParsePublicKey(enc)
+		if err != nil {
+			t.Fatal("Error parsing key: ", err)
+		}
+
+		sig, err := SignAttestation(key, "dev1", challenge)
+		if err != nil {
+			t.Fatalf("%T: error signing: %v", key, err)
+		}
+
+		err = VerifyAttestation(pub, "dev1", challenge, sig)
+		if err != nil {
+			t.Errorf("%T: error verifying: %v", key, err)
+		}
+
+		err = VerifyAttestation(pub, "dev2", challenge, sig)
+		if err == nil {
+			t.Errorf("%T: signature verified for another device", key)
+		}
+
+		err = VerifyAttestation(pub, "dev1", []byte("other"), sig)
+		if err == nil {
+			t.Errorf("%T: signature verified for another challenge", key)
+		}
+	}
+}
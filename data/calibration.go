@@ -0,0 +1,86 @@
+package data
+
+import (
+	"time"
+)
+
+// Calibration describes a calibration for a point type in a node. The raw
+// point value is stored in the node, and the calibrated value
+// (raw * Gain + Offset) is what rules and history see.
+type Calibration struct {
+	PointType string    `json:"pointType"`
+	Offset    float64   `json:"offset"`
+	Gain      float64   `json:"gain"`
+	AppliedBy string    `json:"appliedBy,omitempty"`
+	AppliedAt time.Time `json:"appliedAt"`
+}
+
+// ToPoints converts a calibration to points. The point key is the
+// calibrated point type.
+func (c Calibration) ToPoints() Points {
+	return Points{
+		{Type: PointTypeCalibrationOffset, Key: c.PointType, Value: c.Offset,
+			Time: c.AppliedAt, Origin: c.AppliedBy},
+		{Type: PointTypeCalibrationGain, Key: c.PointType, Value: c.Gain,
+			Time: c.AppliedAt, Origin: c.AppliedBy},
+	}
+}
+
+// Apply returns the calibrated value
+func (c Calibration) Apply(v float64) float64 {
+	return v*c.Gain + c.Offset
+}
+
+// Calibrations returns the calibrations (that are not deleted) in a list of
+// points. The map key is the calibrated point type.
+func (ps Points) Calibrations() map[string]Calibration {
+	ret := make(map[string]Calibration)
+
+	for _, p := range ps {
+		if p.Type != PointTypeCalibrationOffset && p.Type != PointTypeCalibrationGain {
+			continue
+		}
+
+		if p.Tombstone%2 != 0 {
+			continue
+		}
+
+		c, ok := ret[p.Key]
+		if !ok {
+			c = Calibration{PointType: p.Key, Gain: 1}
+		}
+
+		if p.Type == PointTypeCalibrationOffset {
+			c.Offset = p.Value
+		} else {
+			c.Gain = p.Value
+		}
+
+		if p.Time.After(c.AppliedAt) {
+			c.AppliedAt = p.Time
+			c.AppliedBy = p.Origin
+		}
+
+		ret[p.Key] = c
+	}
+
+	return ret
+}
+
+// Calibrate returns points with calibrations applied to the point values
+func (ps Points) Calibrate(cals map[string]Calibration) Points {
+	if len(cals) == 0 {
+		return ps
+	}
+
+	ret := make(Points, len(ps))
+
+	for i, p := range ps {
+		if c, ok := cals[p.Type]; ok {
+			p.Value = c.Apply(p.Value)
+		}
+		ret[i] = p
+	}
+
+	return ret
+}
@@ -0,0 +1,295 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// This is a minimal CBOR (RFC 8949) encoder and decoder for the point wire
+// format (see Points.ToCBOR). Only definite length items are supported.
+
+// CBOR major types
+const (
+	cborUint   = 0
+	cborNegInt = 1
+	cborBytes  = 2
+	cborText   = 3
+	cborArray  = 4
+	cborMap    = 5
+	cborTag    = 6
+	cborSimple = 7
+)
+
+// cborMaxDepth limits nesting when skipping unknown items
+const cborMaxDepth = 16
+
+var errCBORShort = errors.New("CBOR data is too short")
+
+type cborWriter struct {
+	buf []byte
+}
+
+// head writes the initial byte of an item and its argument
+func (w *cborWriter) head(major byte, n uint64) {
+	m := major << 5
+	switch {
+	case n < 24:
+		w.buf = append(w.buf, m|byte(n))
+	case n <= math.MaxUint8:
+		w.buf = append(w.buf, m|24, byte(n))
+	case n <= math.MaxUint16:
+		w.buf = appendBigEndian(append(w.buf, m|25), n, 2)
+	case n <= math.MaxUint32:
+		w.buf = appendBigEndian(append(w.buf, m|26), n, 4)
+	default:
+		w.buf = appendBigEndian(append(w.buf, m|27), n, 8)
+	}
+}
+
+func (w *cborWriter) int(v int64) {
+	if v >= 0 {
+		w.head(cborUint, uint64(v))
+	} else {
+		w.head(cborNegInt, uint64(-1-v))
+	}
+}
+
+func (w *cborWriter) text(s string) {
+	w.head(cborText, uint64(len(s)))
+	w.buf = append(w.buf, s...)
+}
+
+func (w *cborWriter) bytes(b []byte) {
+	w.head(cborBytes, uint64(len(b)))
+	w.buf = append(w.buf, b...)
+}
+
+// float writes v as a single precision float if that is lossless, otherwise
+// as a double
+func (w *cborWriter) float(v float64) {
+	if f := float32(v); float64(f) == v || math.IsNaN(v) {
+		w.buf = appendBigEndian(append(w.buf, cborSimple<<5|26),
+			uint64(math.Float32bits(f)), 4)
+		return
+	}
+
+	w.buf = appendBigEndian(append(w.buf, cborSimple<<5|27), math.Float64bits(v), 8)
+}
+
+// appendBigEndian appends the low size bytes of n to buf, most significant
+// byte first
+func appendBigEndian(buf []byte, n uint64, size int) []byte {
+	for i := size - 1; i >= 0; i-- {
+		buf = append(buf, byte(n>>(8*i)))
+	}
+	return buf
+}
+
+type cborReader struct {
+	d   []byte
+	pos int
+}
+
+func (r *cborReader) remaining() int {
+	return len(r.d) - r.pos
+}
+
+// head reads the initial byte of an item and its argument. For floats, n is
+// the raw bits of the value.
+func (r *cborReader) head() (major, info byte, n uint64, err error) {
+	if r.remaining() < 1 {
+		return 0, 0, 0, errCBORShort
+	}
+
+	b := r.d[r.pos]
+	r.pos++
+	major = b >> 5
+	info = b & 0x1f
+
+	size := 0
+	switch {
+	case info < 24:
+		return major, info, uint64(info), nil
+	case info == 24:
+		size = 1
+	case info == 25:
+		size = 2
+	case info == 26:
+		size = 4
+	case info == 27:
+		size = 8
+	case info == 31:
+		return 0, 0, 0, errors.New("indefinite length CBOR items are not supported")
+	default:
+		return 0, 0, 0, fmt.Errorf("invalid CBOR additional info %v", info)
+	}
+
+	if r.remaining() < size {
+		return 0, 0, 0, errCBORShort
+	}
+
+	for _, c := range r.d[r.pos : r.pos+size] {
+		n = n<<8 | uint64(c)
+	}
+	r.pos += size
+
+	return major, info, n, nil
+}
+
+// length reads the head of an array, map, text, or byte string item and
+// checks the length against the data left
+func (r *cborReader) length(major byte) (int, error) {
+	m, _, n, err := r.head()
+	if err != nil {
+		return 0, err
+	}
+
+	if m != major {
+		return 0, fmt.Errorf("expected CBOR major type %v, got %v", major, m)
+	}
+
+	if n > uint64(r.remaining()) {
+		return 0, errCBORShort
+	}
+
+	return int(n), nil
+}
+
+func (r *cborReader) text() (string, error) {
+	n, err := r.length(cborText)
+	if err != nil {
+		return "", err
+	}
+
+	ret := string(r.d[r.pos : r.pos+n])
+	r.pos += n
+	return ret, nil
+}
+
+func (r *cborReader) bytes() ([]byte, error) {
+	n, err := r.length(cborBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]byte, n)
+	copy(ret, r.d[r.pos:r.pos+n])
+	r.pos += n
+	return ret, nil
+}
+
+// intArg converts the argument of an integer item to an int64
+func intArg(major byte, n uint64) (int64, error) {
+	if n > math.MaxInt64 {
+		return 0, errors.New("CBOR integer overflows int64")
+	}
+
+	if major == cborNegInt {
+		return -1 - int64(n), nil
+	}
+
+	return int64(n), nil
+}
+
+func (r *cborReader) int() (int64, error) {
+	major, _, n, err := r.head()
+	if err != nil {
+		return 0, err
+	}
+
+	if major != cborUint && major != cborNegInt {
+		return 0, fmt.Errorf("expected CBOR integer, got major type %v", major)
+	}
+
+	return intArg(major, n)
+}
+
+// float reads a half, single, or double precision float, or an integer
+func (r *cborReader) float() (float64, error) {
+	major, info, n, err := r.head()
+	if err != nil {
+		return 0, err
+	}
+
+	switch major {
+	case cborUint, cborNegInt:
+		v, err := intArg(major, n)
+		return float64(v), err
+	case cborSimple:
+		switch info {
+		case 25:
+			return halfToFloat(uint16(n)), nil
+		case 26:
+			return float64(math.Float32frombits(uint32(n))), nil
+		case 27:
+			return math.Float64frombits(n), nil
+		}
+	}
+
+	return 0, fmt.Errorf("expected CBOR number, got major type %v", major)
+}
+
+// skip skips over one item
+func (r *cborReader) skip(depth int) error {
+	if depth > cborMaxDepth {
+		return errors.New("CBOR data is nested too deep")
+	}
+
+	major, _, n, err := r.head()
+	if err != nil {
+		return err
+	}
+
+	switch major {
+	case cborBytes, cborText:
+		if n > uint64(r.remaining()) {
+			return errCBORShort
+		}
+		r.pos += int(n)
+	case cborArray, cborMap:
+		if n > uint64(r.remaining()) {
+			return errCBORShort
+		}
+		count := int(n)
+		if major == cborMap {
+			count *= 2
+		}
+		for i := 0; i < count; i++ {
+			err := r.skip(depth + 1)
+			if err != nil {
+				return err
+			}
+		}
+	case cborTag:
+		return r.skip(depth + 1)
+	}
+
+	return nil
+}
+
+// halfToFloat converts IEEE 754 half precision bits to a float64
+func halfToFloat(h uint16) float64 {
+	exp := int(h>>10) & 0x1f
+	mant := float64(h & 0x3ff)
+
+	var v float64
+	switch exp {
+	case 0:
+		v = math.Ldexp(mant, -24)
+	case 0x1f:
+		if mant == 0 {
+			v = math.Inf(1)
+		} else {
+			v = math.NaN()
+		}
+	default:
+		v = math.Ldexp(mant+1024, exp-25)
+	}
+
+	if h&0x8000 != 0 {
+		return -v
+	}
+
+	return v
+}
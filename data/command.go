@@ -0,0 +1,25 @@
+package data
+
+import "time"
+
+// CommandKey returns the key of the commandState and commandError points
+// for a command point (see TypeKey)
+func CommandKey(p Point) string {
+	return p.TypeKey()
+}
+
+// CommandStatePoints returns the points that record the state of a command.
+// errText is the reason a command failed and is cleared for other states.
+func CommandStatePoints(key, state, errText string) Points {
+	now := time.Now()
+	return Points{
+		{Type: PointTypeCommandState, Key: key, Time: now, Text: state},
+		{Type: PointTypeCommandError, Key: key, Time: now, Text: errText},
+	}
+}
+
+// CommandDone returns true if the command state is final
+func CommandDone(state string) bool {
+	return state == PointValueSuccess || state == PointValueFail ||
+		state == PointValueTimeout
+}
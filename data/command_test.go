@@ -0,0 +1,20 @@
+package data
+
+import "testing"
+
+func TestCommandKey(t *testing.T) {
+	tests := []struct {
+		p   Point
+		exp string
+	}{
+		{Point{Type: PointTypeValueSet}, "valueSet"},
+		{Point{Type: PointTypeValueSet, Key: "0"}, "valueSet"},
+		{Point{Type: PointTypeValueSet, Key: "2"}, "valueSet.2"},
+	}
+
+	for _, test := range tests {
+		if got := CommandKey(test.p); got != test.exp {
+			t.Errorf("expected %v, got %v", test.exp, got)
+		}
+	}
+}
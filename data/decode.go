@@ -19,14 +19,35 @@ type NodeEdgeChildren struct {
 // It is recommended that id and parent node tags
 // always be included.
 //	   type exType struct {
-//		ID          string      `node:"id"`
-//		Parent      string      `node:"parent"`
-//		Description string      `point:"description"`
-//		Count       int         `point:"count"`
-//		Role        string      `edgepoint:"role"`
-//		Tombstone   bool        `edgepoint:"tombstone"`
-//		Conditions  []Condition `child:"condition"`
+//		ID          string            `node:"id"`
+//		Parent      string            `node:"parent"`
+//		Description string            `point:"description"`
+//		Count       int               `point:"count"`
+//		Period      time.Duration     `point:"period"`
+//		Timeout     time.Duration     `point:"timeout,type=text"`
+//		Offset      float64           `point:"offset,key=x"`
+//		Labels      map[string]string `point:"label"`
+//		Setpoints   []float64         `point:"setpoint"`
+//		Role        string            `edgepoint:"role"`
+//		Tombstone   bool              `edgepoint:"tombstone"`
+//		Conditions  []Condition       `child:"condition"`
 //	   }
+// A point or edgepoint tag is the point type followed by
+// optional comma separated options:
+//   - key=<key>: only use points with this key
+//   - type=text or type=value: read the field from the
+//     point Text or Value instead of the default for the
+//     field type
+//   - omitempty: Encode skips the field if it is empty
+// Fields can be any int, uint, float, bool, or string type,
+// time.Duration (seconds by default, a duration string with
+// type=text), time.Time (RFC3339 text by default, unix
+// seconds with type=value), or a type that implements
+// PointUnmarshaler or encoding.TextUnmarshaler. Map fields
+// use the point key as the map key and slice fields use it
+// as the index. Tombstoned points remove map entries.
+// Points that can't be converted to the field type are
+// logged and skipped.
 // output can also be a *reflect.Value
 func Decode(input NodeEdgeChildren, output interface{}) error {
 	var vOut reflect.Value
@@ -45,16 +66,22 @@ func Decode(input NodeEdgeChildren, output interface{}) error {
 		tOut = reflect.TypeOf(output).Elem()
 	}
 
-	pointValues := make(map[string]reflect.Value)
-	edgeValues := make(map[string]reflect.Value)
+	pointValues := make(tagFields)
+	edgeValues := make(tagFields)
 	childValues := make(map[string]reflect.Value)
 
 	for i := 0; i < tOut.NumField(); i++ {
 		sf := tOut.Field(i)
 		if pt := sf.Tag.Get("point"); pt != "" {
-			pointValues[pt] = vOut.Field(i)
+			err := pointValues.add(pt, vOut.Field(i))
+			if err != nil {
+				return err
+			}
 		} else if et := sf.Tag.Get("edgepoint"); et != "" {
-			edgeValues[et] = vOut.Field(i)
+			err := edgeValues.add(et, vOut.Field(i))
+			if err != nil {
+				return err
+			}
 		} else if nt := sf.Tag.Get("node"); nt != "" {
 			if nt == "id" {
 				vOut.Field(i).SetString(input.NodeEdge.ID)
@@ -67,16 +94,16 @@ func Decode(input NodeEdgeChildren, output interface{}) error {
 	}
 
 	for _, p := range input.NodeEdge.Points {
-		v, ok := pointValues[p.Type]
-		if ok {
-			setVal(p, v)
+		err := pointValues.set(p)
+		if err != nil {
+			return err
 		}
 	}
 
 	for _, p := range input.NodeEdge.EdgePoints {
-		v, ok := edgeValues[p.Type]
-		if ok {
-			setVal(p, v)
+		err := edgeValues.set(p)
+		if err != nil {
+			return err
 		}
 	}
 
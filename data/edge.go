@@ -38,6 +38,13 @@ func (e *Edge) IsTombstone() bool {
 	return tombstone
 }
 
+// Role returns the role edge point, which describes the relationship of
+// the up node to the down node
+func (e *Edge) Role() string {
+	role, _ := e.Points.Text(PointTypeRole, "")
+	return role
+}
+
 // ByEdgeID implements sort interface for NodeEdge by ID
 type ByEdgeID []*Edge
 
@@ -12,54 +12,109 @@ import (
 // It is recommended that id and parent node tags
 // always be included.
 //	   type exType struct {
-//		ID          string  `node:"id"`
-//		Parent      string  `node:"parent"`
-//		Description string  `point:"description"`
-//		Count       int     `point:"count"`
-//		Role        string  `edgepoint:"role"`
-//		Tombstone   bool    `edgepoint:"tombstone"`
+//		ID          string            `node:"id"`
+//		Parent      string            `node:"parent"`
+//		Description string            `point:"description"`
+//		Count       int               `point:"count"`
+//		Labels      map[string]string `point:"label,omitempty"`
+//		Role        string            `edgepoint:"role"`
+//		Tombstone   bool              `edgepoint:"tombstone"`
 //	   }
+// See [Decode] for the supported field types and tag
+// options. Map entries are encoded in key order. Use
+// [EncodeTree] to also encode child nodes.
 func Encode(in interface{}) (NodeEdge, error) {
+	return encode(addressable(in))
+}
+
+// EncodeTree is like [Encode], but also encodes child
+// node slices (child tags) of in to child nodes.
+func EncodeTree(in interface{}) (NodeEdgeChildren, error) {
+	return encodeTree(addressable(in))
+}
+
+// addressable returns the struct in points to, or a copy of in, so fields
+// are addressable and methods with pointer receivers can be used
+func addressable(in interface{}) reflect.Value {
 	vIn := reflect.ValueOf(in)
-	tIn := reflect.TypeOf(in)
+	if vIn.Kind() == reflect.Pointer {
+		return vIn.Elem()
+	}
 
-	nodeType := tIn.Name()
-	nodeType = strings.ToLower(nodeType[0:1]) + nodeType[1:]
+	v := reflect.New(vIn.Type()).Elem()
+	v.Set(vIn)
+	return v
+}
 
-	ret := NodeEdge{Type: nodeType}
+func encodeTree(vIn reflect.Value) (NodeEdgeChildren, error) {
+	ne, err := encode(vIn)
+	if err != nil {
+		return NodeEdgeChildren{}, err
+	}
+
+	ret := NodeEdgeChildren{NodeEdge: ne}
+
+	tIn := vIn.Type()
+	for i := 0; i < tIn.NumField(); i++ {
+		ct := tIn.Field(i).Tag.Get("child")
+		if ct == "" {
+			continue
+		}
+
+		children := vIn.Field(i)
+		if children.Kind() != reflect.Slice {
+			return ret, fmt.Errorf("Child field %v is not a slice", tIn.Field(i).Name)
+		}
+
+		for j := 0; j < children.Len(); j++ {
+			c, err := encodeTree(children.Index(j))
+			if err != nil {
+				return ret, fmt.Errorf("Error encoding child: %v", err)
+			}
 
-	valToPoint := func(t string, v reflect.Value) (Point, error) {
-		k := v.Type().Kind()
-		switch k {
-		case reflect.String:
-			return Point{Type: t, Text: v.String()}, nil
-		case reflect.Int:
-			return Point{Type: t, Value: float64(v.Int())}, nil
-		case reflect.Float64:
-			return Point{Type: t, Value: v.Float()}, nil
-		case reflect.Float32:
-			return Point{Type: t, Value: v.Float()}, nil
-		case reflect.Bool:
-			return Point{Type: t, Value: BoolToFloat(v.Bool())}, nil
-		default:
-			return Point{}, fmt.Errorf("Unhandled type: %v", k)
+			c.NodeEdge.Type = ct
+			if c.NodeEdge.Parent == "" {
+				c.NodeEdge.Parent = ne.ID
+			}
+			ret.Children = append(ret.Children, c)
 		}
 	}
 
+	return ret, nil
+}
+
+func encode(vIn reflect.Value) (NodeEdge, error) {
+	tIn := vIn.Type()
+
+	nodeType := tIn.Name()
+	if nodeType != "" {
+		nodeType = strings.ToLower(nodeType[0:1]) + nodeType[1:]
+	}
+
+	ret := NodeEdge{Type: nodeType}
+
 	for i := 0; i < tIn.NumField(); i++ {
 		sf := tIn.Field(i)
 		if pt := sf.Tag.Get("point"); pt != "" {
-			p, err := valToPoint(pt, vIn.Field(i))
+			tag, err := parsePointTag(pt)
+			if err != nil {
+				return ret, err
+			}
+			points, err := fieldPoints(vIn.Field(i), tag)
 			if err != nil {
 				return ret, err
 			}
-			ret.Points = append(ret.Points, p)
+			ret.Points = append(ret.Points, points...)
 		} else if et := sf.Tag.Get("edgepoint"); et != "" {
-			p, err := valToPoint(et, vIn.Field(i))
+			tag, err := parsePointTag(et)
+			if err != nil {
+				return ret, err
+			}
+			points, err := fieldPoints(vIn.Field(i), tag)
 			if err != nil {
 				return ret, err
 			}
-			ret.EdgePoints = append(ret.EdgePoints, p)
+			ret.EdgePoints = append(ret.EdgePoints, points...)
 		} else if nt := sf.Tag.Get("node"); nt != "" {
 			if nt == "id" {
 				v := vIn.Field(i)
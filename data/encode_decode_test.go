@@ -1,8 +1,11 @@
 package data
 
 import (
+	"fmt"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 type testType struct {
@@ -219,3 +222,178 @@ func TestDecodeWithChildren(t *testing.T) {
 	}
 
 }
+
+type testLevel int
+
+func (l testLevel) MarshalPoint() (Point, error) {
+	return Point{Text: strings.Repeat("*", int(l))}, nil
+}
+
+func (l *testLevel) UnmarshalPoint(p Point) error {
+	if strings.Trim(p.Text, "*") != "" {
+		return fmt.Errorf("invalid level: %v", p.Text)
+	}
+	*l = testLevel(len(p.Text))
+	return nil
+}
+
+type testTyped struct {
+	ID        string             `node:"id"`
+	Parent    string             `node:"parent"`
+	Period    time.Duration      `point:"period"`
+	Timeout   time.Duration      `point:"timeout,type=text"`
+	Start     time.Time          `point:"start"`
+	Port      uint16             `point:"port,type=text"`
+	Offset    float64            `point:"offset,key=x"`
+	OffsetY   float64            `point:"offset,key=y"`
+	Labels    map[string]string  `point:"label"`
+	Channels  map[int]bool       `point:"channel"`
+	Setpoints []float64          `point:"setpoint"`
+	Level     testLevel          `point:"level"`
+	Note      string             `point:"note,omitempty"`
+	Weights   map[string]float64 `edgepoint:"weight,omitempty"`
+}
+
+func TestEncodeDecodeTyped(t *testing.T) {
+	start := time.Date(2022, 3, 4, 5, 6, 7, 0, time.UTC)
+
+	in := testTyped{
+		ID:        "123",
+		Parent:    "456",
+		Period:    1500 * time.Millisecond,
+		Timeout:   2 * time.Minute,
+		Start:     start,
+		Port:      8118,
+		Offset:    1.5,
+		OffsetY:   -2,
+		Labels:    map[string]string{"b": "two", "a": "one"},
+		Channels:  map[int]bool{10: true, 2: false},
+		Setpoints: []float64{20, 21.5},
+		Level:     3,
+	}
+
+	ne, err := Encode(in)
+	if err != nil {
+		t.Fatal("Error encoding: ", err)
+	}
+
+	exp := Points{
+		{Type: "period", Value: 1.5},
+		{Type: "timeout", Text: "2m0s"},
+		{Type: "start", Text: "2022-03-04T05:06:07Z"},
+		{Type: "port", Text: "8118"},
+		{Type: "offset", Key: "x", Value: 1.5},
+		{Type: "offset", Key: "y", Value: -2},
+		{Type: "label", Key: "a", Text: "one"},
+		{Type: "label", Key: "b", Text: "two"},
+		{Type: "channel", Key: "2", Value: 0},
+		{Type: "channel", Key: "10", Value: 1},
+		{Type: "setpoint", Key: "0", Value: 20},
+		{Type: "setpoint", Key: "1", Value: 21.5},
+		{Type: "level", Text: "***"},
+	}
+
+	if !reflect.DeepEqual(ne.Points, exp) {
+		t.Errorf("Encode failed, exp: %v, got %v", exp, ne.Points)
+	}
+
+	if len(ne.EdgePoints) != 0 {
+		t.Error("omitempty edge points were encoded: ", ne.EdgePoints)
+	}
+
+	var out testTyped
+	err = Decode(NodeEdgeChildren{NodeEdge: ne}, &out)
+	if err != nil {
+		t.Fatal("Error decoding: ", err)
+	}
+
+	if !reflect.DeepEqual(out, in) {
+		t.Errorf("Decode failed, exp: %+v, got %+v", in, out)
+	}
+}
+
+func TestDecodeTypedBadPoints(t *testing.T) {
+	ne := NodeEdge{
+		ID: "123",
+		Points: Points{
+			{Type: "timeout", Text: "soon"},
+			{Type: "port", Text: "8118"},
+			{Type: "channel", Key: "x", Value: 1},
+			{Type: "level", Text: "high"},
+			{Type: "setpoint", Key: "1", Value: 5},
+		},
+	}
+
+	var out testTyped
+	err := Decode(NodeEdgeChildren{NodeEdge: ne}, &out)
+	if err != nil {
+		t.Fatal("Error decoding: ", err)
+	}
+
+	exp := testTyped{ID: "123", Port: 8118, Setpoints: []float64{0, 5}}
+	if !reflect.DeepEqual(out, exp) {
+		t.Errorf("Decode failed, exp: %+v, got %+v", exp, out)
+	}
+}
+
+func TestDecodeUnsupportedType(t *testing.T) {
+	var out struct {
+		Config struct{ A int } `point:"config"`
+	}
+
+	ne := NodeEdge{Points: Points{{Type: "config", Value: 1}}}
+	err := Decode(NodeEdgeChildren{NodeEdge: ne}, &out)
+	if err == nil {
+		t.Error("Expected error decoding unsupported field type")
+	}
+}
+
+func TestMergeTypedTombstone(t *testing.T) {
+	v := testTyped{
+		ID:     "123",
+		Labels: map[string]string{"a": "one", "b": "two"},
+	}
+
+	err := MergePoints("123", Points{
+		{Type: "label", Key: "a", Tombstone: 1},
+		{Type: "label", Key: "c", Text: "three"},
+	}, &v)
+	if err != nil {
+		t.Fatal("Merge error: ", err)
+	}
+
+	exp := map[string]string{"b": "two", "c": "three"}
+	if !reflect.DeepEqual(v.Labels, exp) {
+		t.Errorf("Merge failed, exp: %v, got %v", exp, v.Labels)
+	}
+}
+
+func TestEncodeTree(t *testing.T) {
+	in := testX{
+		ID:          "123",
+		Description: "test X",
+		TestYs: []testY{
+			{ID: "abc", Description: "test Y", TestZs: []testZ{
+				{ID: "def", Description: "test Z"},
+			}},
+		},
+	}
+
+	tree, err := EncodeTree(in)
+	if err != nil {
+		t.Fatal("Error encoding: ", err)
+	}
+
+	var out testX
+	err = Decode(tree, &out)
+	if err != nil {
+		t.Fatal("Error decoding: ", err)
+	}
+
+	in.TestYs[0].Parent = "123"
+	in.TestYs[0].TestZs[0].Parent = "abc"
+
+	if !reflect.DeepEqual(out, in) {
+		t.Errorf("EncodeTree failed, exp: %+v, got %+v", in, out)
+	}
+}
@@ -0,0 +1,86 @@
+package data
+
+import (
+	"strings"
+	"time"
+)
+
+// Export is a node tree in a human readable format (typically YAML) used to
+// export and import nodes. Points are exported without timestamps or
+// deleted points so that the file can be edited and used to provision
+// systems.
+type Export struct {
+	Nodes []ExportNode `json:"nodes" yaml:"nodes"`
+}
+
+// ExportNode is a node and its children in an Export. EdgePoints are the
+// points of the edge to the parent node.
+type ExportNode struct {
+	ID         string        `json:"id,omitempty" yaml:"id,omitempty"`
+	Type       string        `json:"type" yaml:"type"`
+	Points     []ExportPoint `json:"points,omitempty" yaml:"points,omitempty"`
+	EdgePoints []ExportPoint `json:"edgePoints,omitempty" yaml:"edgePoints,omitempty"`
+	Children   []ExportNode  `json:"children,omitempty" yaml:"children,omitempty"`
+}
+
+// ExportPoint is a point in an Export
+type ExportPoint struct {
+	Type  string  `json:"type" yaml:"type"`
+	Key   string  `json:"key,omitempty" yaml:"key,omitempty"`
+	Index float64 `json:"index,omitempty" yaml:"index,omitempty"`
+	Value float64 `json:"value,omitempty" yaml:"value,omitempty"`
+	Text  string  `json:"text,omitempty" yaml:"text,omitempty"`
+}
+
+// ToExport converts points to export points. Deleted points, and the
+// tombstone point (nodes are exported if they are not deleted) are not
+// included. Sensitive points are masked (see Points.Mask), except for
+// encrypted secret values.
+func (ps Points) ToExport() []ExportPoint {
+	var ret []ExportPoint
+
+	for _, p := range ps {
+		text := p.Text
+		if !strings.HasPrefix(text, EncryptedPrefix) {
+			text = maskText(p)
+		}
+
+		if p.Tombstone%2 != 0 || p.Type == PointTypeTombstone {
+			continue
+		}
+
+		ret = append(ret, ExportPoint{
+			Type:  p.Type,
+			Key:   p.Key,
+			Index: p.Index,
+			Value: p.Value,
+			Text:  text,
+		})
+	}
+
+	return ret
+}
+
+// ExportToPoints converts export points to points with time set to t. Masked
+// points are skipped so they don't overwrite existing values.
+func ExportToPoints(eps []ExportPoint, t time.Time, origin string) Points {
+	ret := make(Points, 0, len(eps))
+
+	for _, ep := range eps {
+		if ep.Text == SecretMask && IsSensitive(ep.Type) {
+			continue
+		}
+
+		ret = append(ret, Point{
+			Time:   t,
+			Type:   ep.Type,
+			Key:    ep.Key,
+			Index:  ep.Index,
+			Value:  ep.Value,
+			Text:   ep.Text,
+			Origin: origin,
+		})
+	}
+
+	return ret
+}
@@ -0,0 +1,180 @@
+package data
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// NodeFilter is a parsed point filter expression (see ParseNodeFilter)
+type NodeFilter []filterPredicate
+
+// filterPredicate compares the point with Type and Key to a value. If
+// isText is set, the point Text is compared, otherwise the point Value.
+type filterPredicate struct {
+	Type   string
+	Key    string
+	Op     string
+	Value  float64
+	Text   string
+	isText bool
+}
+
+var reFilterPredicate = regexp.MustCompile(
+	`^([A-Za-z0-9_]+)(?:\.([^\s=!<>]+))?\s*(=|!=|<=|>=|<|>)\s*(.+)$`)
+
+// ParseNodeFilter parses a filter expression of predicates joined by "and",
+// for example:
+//
+//	value > 20 and description = "Boiler room" and disable != true
+//
+// Each predicate is <pointType>[.<key>] <op> <value>, where op is one of =,
+// !=, <, <=, >, >=. Numbers and true/false are compared to the point Value,
+// other values (which can be quoted) to the point Text with = and != only.
+// A point that does not exist has a value of 0 and empty text, the same as
+// a config field without a point.
+func ParseNodeFilter(expr string) (NodeFilter, error) {
+	var ret NodeFilter
+
+	terms, err := splitFilter(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, t := range terms {
+		m := reFilterPredicate.FindStringSubmatch(t)
+		if m == nil {
+			return nil, fmt.Errorf("invalid filter predicate: %v", t)
+		}
+
+		p := filterPredicate{Type: m[1], Key: m[2], Op: m[3]}
+		v := strings.TrimSpace(m[4])
+
+		switch {
+		case v == "true" || v == "false":
+			p.Value = BoolToFloat(v == "true")
+		case strings.HasPrefix(v, `"`):
+			p.Text, err = strconv.Unquote(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid filter string %v: %w", v, err)
+			}
+			p.isText = true
+		default:
+			p.Value, err = strconv.ParseFloat(v, 64)
+			if err != nil {
+				p.Text = v
+				p.isText = true
+			}
+		}
+
+		if p.isText && p.Op != "=" && p.Op != "!=" {
+			return nil, fmt.Errorf("text can only be compared with = or !=: %v", t)
+		}
+
+		ret = append(ret, p)
+	}
+
+	return ret, nil
+}
+
+// splitFilter splits an expression on "and" outside of quotes
+func splitFilter(expr string) ([]string, error) {
+	var ret []string
+
+	add := func(t string) error {
+		t = strings.TrimSpace(t)
+		if t == "" {
+			return fmt.Errorf("missing filter predicate around and")
+		}
+		ret = append(ret, t)
+		return nil
+	}
+
+	isSpace := func(b byte) bool {
+		return b == ' ' || b == '\t' || b == '\n'
+	}
+
+	quoted := false
+	start := 0
+
+	for i := 0; i < len(expr); i++ {
+		switch {
+		case expr[i] == '\\' && quoted:
+			i++
+		case expr[i] == '"':
+			quoted = !quoted
+		case !quoted && i > 0 && isSpace(expr[i-1]) && i+4 <= len(expr) &&
+			strings.EqualFold(expr[i:i+3], "and") && isSpace(expr[i+3]):
+			if err := add(expr[start:i]); err != nil {
+				return nil, err
+			}
+			start = i + 3
+		}
+	}
+
+	if quoted {
+		return nil, fmt.Errorf("unterminated string in filter")
+	}
+
+	if strings.TrimSpace(expr) == "" {
+		return nil, nil
+	}
+
+	if err := add(expr[start:]); err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+// Match returns true if points match all predicates of the filter.
+// Tombstoned points are ignored. If a predicate does not have a key, points
+// with a key of "" or "0" match.
+func (f NodeFilter) Match(points Points) bool {
+	for _, pred := range f {
+		var p Point
+		for _, pt := range points {
+			if pt.Type != pred.Type || pt.Tombstone%2 == 1 {
+				continue
+			}
+
+			if pt.Key == pred.Key || (pred.Key == "" && pt.Key == "0") {
+				p = pt
+				break
+			}
+		}
+
+		if !pred.match(p) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (pred filterPredicate) match(p Point) bool {
+	if pred.isText {
+		if pred.Op == "=" {
+			return p.Text == pred.Text
+		}
+		return p.Text != pred.Text
+	}
+
+	switch pred.Op {
+	case "=":
+		return p.Value == pred.Value
+	case "!=":
+		return p.Value != pred.Value
+	case "<":
+		return p.Value < pred.Value
+	case "<=":
+		return p.Value <= pred.Value
+	case ">":
+		return p.Value > pred.Value
+	case ">=":
+		return p.Value >= pred.Value
+	}
+
+	return false
+}
@@ -0,0 +1,51 @@
+package data
+
+import "testing"
+
+func TestNodeFilter(t *testing.T) {
+	points := Points{
+		{Type: PointTypeValue, Value: 22.5},
+		{Type: PointTypeDescription, Key: "0", Text: "Boiler and pump room"},
+		{Type: PointTypeDisable, Value: 1},
+		{Type: PointTypeValue, Key: "x", Value: 3},
+		{Type: PointTypeUnits, Text: "C", Tombstone: 1},
+	}
+
+	tests := []struct {
+		expr  string
+		match bool
+	}{
+		{"", true},
+		{"value > 20", true},
+		{"value>20 AND value <= 22.5", true},
+		{"value < 20", false},
+		{`description = "Boiler and pump room"`, true},
+		{`description != "Boiler and pump room"`, false},
+		{"disable = true and value.x = 3", true},
+		{"value.x >= 4", false},
+		{"units = C", false},
+		{"units = \"\"", true},
+		{"missing = 0", true},
+	}
+
+	for _, test := range tests {
+		f, err := ParseNodeFilter(test.expr)
+		if err != nil {
+			t.Errorf("Error parsing %v: %v", test.expr, err)
+			continue
+		}
+
+		if f.Match(points) != test.match {
+			t.Errorf("%v: expected match %v", test.expr, test.match)
+		}
+	}
+
+	for _, expr := range []string{
+		"value", "value > 20 and", "and value > 1", `description = "x`,
+		"description > abc", "value ~ 2",
+	} {
+		if _, err := ParseNodeFilter(expr); err == nil {
+			t.Errorf("Expected error parsing %v", expr)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package data
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// define valid history aggregate functions
+const (
+	AggregateMean     = "mean"
+	AggregateMin      = "min"
+	AggregateMax      = "max"
+	AggregateLast     = "last"
+	AggregateCount    = "count"
+	AggregateIntegral = "integral"
+)
+
+// HistoryQuery describes a query for point history. If Aggregate is set,
+// points are grouped by type, key, and Window and one point is returned
+// for each group at the start of the window. If Window is zero, the entire
+// time range is one window. Windows are aligned to Start. The last aggregate
+// returns the last point in the window as is, including its time and text.
+// The integral aggregate is computed using the trapezoidal rule and is in
+// units of value*seconds.
+type HistoryQuery struct {
+	Start     time.Time     `json:"start"`
+	End       time.Time     `json:"end"`
+	Type      string        `json:"type,omitempty"`
+	Key       string        `json:"key,omitempty"`
+	Window    time.Duration `json:"window,omitempty"`
+	Aggregate string        `json:"aggregate,omitempty"`
+}
+
+// ToPoints encodes a history query in points so it can be sent over NATS
+func (q HistoryQuery) ToPoints() Points {
+	ret := Points{
+		{Type: PointTypeStart, Text: q.Start.Format(time.RFC3339Nano)},
+		{Type: PointTypeEnd, Text: q.End.Format(time.RFC3339Nano)},
+	}
+
+	if q.Type != "" {
+		ret = append(ret, Point{Type: PointTypePointType, Text: q.Type})
+	}
+
+	if q.Key != "" {
+		ret = append(ret, Point{Type: PointTypePointKey, Text: q.Key})
+	}
+
+	if q.Window != 0 {
+		ret = append(ret, Point{Type: PointTypeWindow, Value: q.Window.Seconds()})
+	}
+
+	if q.Aggregate != "" {
+		ret = append(ret, Point{Type: PointTypeAggregate, Text: q.Aggregate})
+	}
+
+	return ret
+}
+
+// PointsToHistoryQuery decodes a history query from points
+func PointsToHistoryQuery(points Points) (HistoryQuery, error) {
+	var ret HistoryQuery
+	var err error
+
+	for _, p := range points {
+		switch p.Type {
+		case PointTypeStart:
+			ret.Start, err = time.Parse(time.RFC3339Nano, p.Text)
+			if err != nil {
+				return ret, fmt.Errorf("Error parsing start time: %w", err)
+			}
+		case PointTypeEnd:
+			ret.End, err = time.Parse(time.RFC3339Nano, p.Text)
+			if err != nil {
+				return ret, fmt.Errorf("Error parsing end time: %w", err)
+			}
+		case PointTypePointType:
+			ret.Type = p.Text
+		case PointTypePointKey:
+			ret.Key = p.Text
+		case PointTypeWindow:
+			ret.Window = time.Duration(p.Value * float64(time.Second))
+		case PointTypeAggregate:
+			ret.Aggregate = p.Text
+		}
+	}
+
+	return ret, ret.Validate()
+}
+
+// Validate checks if a history query is valid
+func (q HistoryQuery) Validate() error {
+	if q.End.Before(q.Start) {
+		return fmt.Errorf("history query end is before start")
+	}
+
+	if q.Window < 0 {
+		return fmt.Errorf("history query window must not be negative")
+	}
+
+	switch q.Aggregate {
+	case "", AggregateMean, AggregateMin, AggregateMax, AggregateLast,
+		AggregateCount, AggregateIntegral:
+	default:
+		return fmt.Errorf("unsupported aggregate: %v", q.Aggregate)
+	}
+
+	return nil
+}
+
+// Match returns true if point should be included in the query results
+func (q HistoryQuery) Match(p Point) bool {
+	if q.Type != "" && p.Type != q.Type {
+		return false
+	}
+
+	if q.Key != "" && p.Key != q.Key {
+		return false
+	}
+
+	if p.Time.Before(q.Start) {
+		return false
+	}
+
+	if !q.End.IsZero() && p.Time.After(q.End) {
+		return false
+	}
+
+	return true
+}
+
+// Apply filters and aggregates raw history points according to the query.
+// History backends return raw points and use this so that aggregate semantics
+// are the same regardless of where the data is stored. Returned points are
+// sorted by time.
+func (q HistoryQuery) Apply(points Points) (Points, error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+
+	var matched Points
+	for _, p := range points {
+		if q.Match(p) {
+			matched = append(matched, p)
+		}
+	}
+
+	sort.Stable(matched)
+
+	if q.Aggregate == "" {
+		return matched, nil
+	}
+
+	type groupKey struct {
+		typ    string
+		key    string
+		window int64
+	}
+
+	groups := make(map[groupKey]Points)
+	var keys []groupKey
+
+	for _, p := range matched {
+		var w int64
+		if q.Window > 0 {
+			w = int64(p.Time.Sub(q.Start) / q.Window)
+		}
+		k := groupKey{p.Type, p.Key, w}
+		if _, ok := groups[k]; !ok {
+			keys = append(keys, k)
+		}
+		groups[k] = append(groups[k], p)
+	}
+
+	ret := make(Points, 0, len(keys))
+
+	for _, k := range keys {
+		if q.Aggregate == AggregateLast {
+			g := groups[k]
+			ret = append(ret, g[len(g)-1])
+			continue
+		}
+
+		ret = append(ret, Point{
+			Type:  k.typ,
+			Key:   k.key,
+			Time:  q.Start.Add(time.Duration(k.window) * q.Window),
+			Value: aggregate(q.Aggregate, groups[k]),
+		})
+	}
+
+	sort.Stable(ret)
+
+	return ret, nil
+}
+
+// aggregate assumes points are sorted by time
+func aggregate(fn string, points Points) float64 {
+	switch fn {
+	case AggregateMean:
+		total := 0.0
+		for _, p := range points {
+			total += p.Value
+		}
+		return total / float64(len(points))
+	case AggregateMin:
+		ret := math.Inf(1)
+		for _, p := range points {
+			ret = math.Min(ret, p.Value)
+		}
+		return ret
+	case AggregateMax:
+		ret := math.Inf(-1)
+		for _, p := range points {
+			ret = math.Max(ret, p.Value)
+		}
+		return ret
+	case AggregateCount:
+		return float64(len(points))
+	case AggregateIntegral:
+		total := 0.0
+		for i := 1; i < len(points); i++ {
+			dt := points[i].Time.Sub(points[i-1].Time).Seconds()
+			total += (points[i].Value + points[i-1].Value) / 2 * dt
+		}
+		return total
+	}
+
+	return 0
+}
@@ -0,0 +1,95 @@
+package data
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHistoryQueryApply(t *testing.T) {
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	var points Points
+	for i := 0; i < 6; i++ {
+		points = append(points, Point{Type: PointTypeValue,
+			Time: start.Add(time.Duration(i) * time.Minute), Value: float64(i)})
+	}
+
+	// unrelated point type should be filtered out
+	points = append(points, Point{Type: PointTypeDescription, Time: start, Text: "hi"})
+
+	tests := []struct {
+		agg    string
+		expect []float64
+	}{
+		{AggregateMean, []float64{1, 4}},
+		{AggregateMin, []float64{0, 3}},
+		{AggregateMax, []float64{2, 5}},
+		{AggregateLast, []float64{2, 5}},
+		{AggregateCount, []float64{3, 3}},
+		// 0->1->2 over 2 minutes = 2*60, 3->4->5 = 8*60
+		{AggregateIntegral, []float64{120, 480}},
+	}
+
+	for _, test := range tests {
+		q := HistoryQuery{
+			Start:     start,
+			End:       start.Add(time.Hour),
+			Type:      PointTypeValue,
+			Window:    3 * time.Minute,
+			Aggregate: test.agg,
+		}
+
+		res, err := q.Apply(points)
+		if err != nil {
+			t.Fatal("Apply error: ", err)
+		}
+
+		if len(res) != len(test.expect) {
+			t.Fatalf("%v: expected %v points, got %v", test.agg, len(test.expect), len(res))
+		}
+
+		for i, p := range res {
+			if p.Value != test.expect[i] {
+				t.Errorf("%v: window %v expected %v, got %v", test.agg, i,
+					test.expect[i], p.Value)
+			}
+
+			expTime := start.Add(time.Duration(i) * 3 * time.Minute)
+			if test.agg == AggregateLast {
+				// last returns the actual point
+				expTime = start.Add(time.Duration(i*3+2) * time.Minute)
+			}
+			if !p.Time.Equal(expTime) {
+				t.Errorf("%v: window %v expected time %v, got %v", test.agg, i,
+					expTime, p.Time)
+			}
+		}
+	}
+}
+
+func TestHistoryQueryPoints(t *testing.T) {
+	q := HistoryQuery{
+		Start:     time.Now().Add(-time.Hour),
+		End:       time.Now(),
+		Type:      PointTypeValue,
+		Key:       "a",
+		Window:    time.Minute,
+		Aggregate: AggregateMax,
+	}
+
+	q2, err := PointsToHistoryQuery(q.ToPoints())
+	if err != nil {
+		t.Fatal("Error decoding query: ", err)
+	}
+
+	if !q2.Start.Equal(q.Start) || !q2.End.Equal(q.End) || q2.Type != q.Type ||
+		q2.Key != q.Key || q2.Window != q.Window || q2.Aggregate != q.Aggregate {
+		t.Fatalf("query did not round trip, exp: %+v, got: %+v", q, q2)
+	}
+
+	q.Aggregate = "median"
+	_, err = PointsToHistoryQuery(q.ToPoints())
+	if err == nil {
+		t.Fatal("expected error for invalid aggregate")
+	}
+}
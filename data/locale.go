@@ -0,0 +1,132 @@
+package data
+
+import (
+	"sort"
+	"strings"
+)
+
+// TranslatablePointTypes are the text point types that are exported for
+// translation (see LocaleStrings)
+var TranslatablePointTypes = []string{PointTypeDescription}
+
+// TranslationKey returns the key of the translation point of point type typ
+// for locale
+func TranslationKey(locale, typ string) string {
+	return locale + "." + typ
+}
+
+// TranslationPoint returns the point that stores the translation of point
+// type typ for locale
+func TranslationPoint(locale, typ, text string) Point {
+	return Point{
+		Type: PointTypeTranslation,
+		Key:  TranslationKey(locale, typ),
+		Text: text,
+	}
+}
+
+// Localize returns a copy of the points where the text of translatable
+// points is replaced by the translation for locale if there is one.
+// Translations for a language and region (de-CH) fall back to the language
+// (de).
+func (ps Points) Localize(locale string) Points {
+	if locale == "" {
+		return ps
+	}
+
+	locales := []string{locale}
+	if lang, _, ok := strings.Cut(locale, "-"); ok {
+		locales = append(locales, lang)
+	}
+
+	ret := make(Points, len(ps))
+	copy(ret, ps)
+
+	for i, p := range ret {
+		if !isTranslatable(p.Type) || p.Key != "" && p.Key != "0" {
+			continue
+		}
+
+		for _, l := range locales {
+			if text := ps.translation(l, p.Type); text != "" {
+				ret[i].Text = text
+				break
+			}
+		}
+	}
+
+	return ret
+}
+
+// translation returns the text of the translation point of point type typ
+// for locale
+func (ps Points) translation(locale, typ string) string {
+	key := TranslationKey(locale, typ)
+	for _, p := range ps {
+		if p.Type == PointTypeTranslation && p.Key == key && p.Tombstone%2 == 0 {
+			return p.Text
+		}
+	}
+
+	return ""
+}
+
+func isTranslatable(typ string) bool {
+	for _, t := range TranslatablePointTypes {
+		if t == typ {
+			return true
+		}
+	}
+
+	return false
+}
+
+// LocaleString is a user visible string of a node. Source is the text of
+// the point, and Text the translation for the locale (blank if it is not
+// translated yet).
+type LocaleString struct {
+	ID     string `json:"id"`
+	Type   string `json:"type"`
+	Source string `json:"source"`
+	Text   string `json:"text"`
+}
+
+// LocaleStrings are the user visible strings of a node tree, keyed by node
+// ID and point type, used to translate them. Strings are exported with
+// Source set, translators fill in Text, and the strings are imported as
+// translation points.
+type LocaleStrings struct {
+	Locale  string         `json:"locale"`
+	Strings []LocaleString `json:"strings"`
+}
+
+// NewLocaleStrings returns the translatable strings of nodes and their
+// translations for locale, sorted by node ID and point type
+func NewLocaleStrings(locale string, nodes []Node) LocaleStrings {
+	ret := LocaleStrings{Locale: locale, Strings: []LocaleString{}}
+
+	for _, n := range nodes {
+		for _, typ := range TranslatablePointTypes {
+			source, ok := n.Points.Text(typ, "")
+			if !ok || source == "" {
+				continue
+			}
+
+			ret.Strings = append(ret.Strings, LocaleString{
+				ID:     n.ID,
+				Type:   typ,
+				Source: source,
+				Text:   n.Points.translation(locale, typ),
+			})
+		}
+	}
+
+	sort.Slice(ret.Strings, func(i, j int) bool {
+		if ret.Strings[i].ID != ret.Strings[j].ID {
+			return ret.Strings[i].ID < ret.Strings[j].ID
+		}
+		return ret.Strings[i].Type < ret.Strings[j].Type
+	})
+
+	return ret
+}
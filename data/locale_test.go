@@ -0,0 +1,65 @@
+package data
+
+import "testing"
+
+func TestPointsLocalize(t *testing.T) {
+	ps := Points{
+		{Type: PointTypeDescription, Text: "Pump"},
+		{Type: PointTypeValue, Value: 2},
+		TranslationPoint("de", PointTypeDescription, "Pumpe"),
+		TranslationPoint("fr-CA", PointTypeDescription, "Pompe"),
+	}
+
+	tests := []struct {
+		locale string
+		desc   string
+	}{
+		{"", "Pump"},
+		{"de", "Pumpe"},
+		{"de-CH", "Pumpe"},
+		{"fr-CA", "Pompe"},
+		{"fr", "Pump"},
+		{"es", "Pump"},
+	}
+
+	for _, test := range tests {
+		l := ps.Localize(test.locale)
+		if d := l.Desc(); d != test.desc {
+			t.Errorf("locale %v: expected %v, got %v", test.locale, test.desc, d)
+		}
+	}
+
+	if d := ps.Desc(); d != "Pump" {
+		t.Error("Localize changed the original points: ", d)
+	}
+}
+
+func TestNewLocaleStrings(t *testing.T) {
+	nodes := []Node{
+		{ID: "b", Points: Points{
+			{Type: PointTypeDescription, Text: "Pump"},
+			TranslationPoint("de", PointTypeDescription, "Pumpe"),
+		}},
+		{ID: "a", Points: Points{
+			{Type: PointTypeDescription, Text: "Tank"},
+		}},
+		{ID: "c", Points: Points{{Type: PointTypeValue, Value: 1}}},
+	}
+
+	ls := NewLocaleStrings("de", nodes)
+
+	exp := []LocaleString{
+		{ID: "a", Type: PointTypeDescription, Source: "Tank"},
+		{ID: "b", Type: PointTypeDescription, Source: "Pump", Text: "Pumpe"},
+	}
+
+	if ls.Locale != "de" || len(ls.Strings) != len(exp) {
+		t.Fatalf("Unexpected strings: %+v", ls)
+	}
+
+	for i := range exp {
+		if ls.Strings[i] != exp[i] {
+			t.Errorf("Expected %+v, got %+v", exp[i], ls.Strings[i])
+		}
+	}
+}
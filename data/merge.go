@@ -3,25 +3,9 @@ package data
 import (
 	"errors"
 	"fmt"
-	"log"
 	"reflect"
 )
 
-func setVal(p Point, v reflect.Value) {
-	switch v.Type().Kind() {
-	case reflect.String:
-		v.SetString(p.Text)
-	case reflect.Int:
-		v.SetInt(int64(p.Value))
-	case reflect.Float64, reflect.Float32:
-		v.SetFloat(p.Value)
-	case reflect.Bool:
-		v.SetBool(FloatToBool(p.Value))
-	default:
-		log.Println("setVal failed, did not match any type: ", v.Type().Kind())
-	}
-}
-
 var count = 0
 
 // MergePoints takes points and updates fields in a type
@@ -47,7 +31,7 @@ func MergePoints(id string, points []Point, output interface{}) error {
 		tOut = reflect.TypeOf(output).Elem()
 	}
 
-	pointValues := make(map[string]reflect.Value)
+	pointValues := make(tagFields)
 	childValues := make(map[string]reflect.Value)
 
 	structID := ""
@@ -55,7 +39,10 @@ func MergePoints(id string, points []Point, output interface{}) error {
 	for i := 0; i < tOut.NumField(); i++ {
 		sf := tOut.Field(i)
 		if pt := sf.Tag.Get("point"); pt != "" {
-			pointValues[pt] = vOut.Field(i)
+			err := pointValues.add(pt, vOut.Field(i))
+			if err != nil {
+				return err
+			}
 		} else if nt := sf.Tag.Get("node"); nt != "" {
 			if nt == "id" {
 				structID = vOut.Field(i).String()
@@ -67,9 +54,9 @@ func MergePoints(id string, points []Point, output interface{}) error {
 
 	if structID == id {
 		for _, p := range points {
-			v, ok := pointValues[p.Type]
-			if ok {
-				setVal(p, v)
+			err := pointValues.set(p)
+			if err != nil {
+				return err
 			}
 		}
 	} else if len(childValues) > 0 {
@@ -109,7 +96,7 @@ func MergeEdgePoints(id, parent string, points []Point, output interface{}) erro
 		tOut = reflect.TypeOf(output).Elem()
 	}
 
-	edgeValues := make(map[string]reflect.Value)
+	edgeValues := make(tagFields)
 	childValues := make(map[string]reflect.Value)
 
 	structID := ""
@@ -118,7 +105,10 @@ func MergeEdgePoints(id, parent string, points []Point, output interface{}) erro
 	for i := 0; i < tOut.NumField(); i++ {
 		sf := tOut.Field(i)
 		if et := sf.Tag.Get("edgepoint"); et != "" {
-			edgeValues[et] = vOut.Field(i)
+			err := edgeValues.add(et, vOut.Field(i))
+			if err != nil {
+				return err
+			}
 		} else if nt := sf.Tag.Get("node"); nt != "" {
 			if nt == "id" {
 				structID = vOut.Field(i).String()
@@ -132,9 +122,9 @@ func MergeEdgePoints(id, parent string, points []Point, output interface{}) erro
 
 	if structID == id && structParent == parent {
 		for _, p := range points {
-			v, ok := edgeValues[p.Type]
-			if ok {
-				setVal(p, v)
+			err := edgeValues.set(p)
+			if err != nil {
+				return err
 			}
 		}
 	} else if len(childValues) > 0 {
@@ -1,12 +1,19 @@
 package data
 
 // MsgService is used to represent message services such as Twilio, SMTP, etc
+// SID and AuthToken are the account ID/key and secret for the service.
+// Region and SessionToken are only used by AWS SNS, and Port/Baud by GSM
+// modems.
 type MsgService struct {
-	ID        string
-	Service   string
-	SID       string
-	AuthToken string
-	From      string
+	ID           string
+	Service      string
+	SID          string
+	AuthToken    string
+	SessionToken string
+	From         string
+	Region       string
+	Port         string
+	Baud         int
 }
 
 // NodeToMsgService converts a node to message service
@@ -21,8 +28,16 @@ func NodeToMsgService(node Node) (MsgService, error) {
 			ret.SID = p.Text
 		case PointTypeAuthToken:
 			ret.AuthToken = p.Text
+		case PointTypeSessionToken:
+			ret.SessionToken = p.Text
 		case PointTypeFrom:
 			ret.From = p.Text
+		case PointTypeRegion:
+			ret.Region = p.Text
+		case PointTypePort:
+			ret.Port = p.Text
+		case PointTypeBaud:
+			ret.Baud = int(p.Value)
 		}
 	}
 
@@ -15,6 +15,8 @@ type Message struct {
 	Phone          string
 	Subject        string
 	Message        string
+	Severity       string
+	Priority       int
 }
 
 // ToPb converts to protobuf data
@@ -28,6 +30,8 @@ func (m *Message) ToPb() ([]byte, error) {
 		Phone:          m.Phone,
 		Subject:        m.Subject,
 		Message:        m.Message,
+		Severity:       m.Severity,
+		Priority:       int32(m.Priority),
 	}
 
 	return proto.Marshal(&pbMsg)
@@ -51,5 +55,7 @@ func PbDecodeMessage(data []byte) (Message, error) {
 		Phone:          pbMsg.Phone,
 		Subject:        pbMsg.Subject,
 		Message:        pbMsg.Message,
+		Severity:       pbMsg.Severity,
+		Priority:       int(pbMsg.Priority),
 	}, nil
 }
@@ -60,6 +60,29 @@ func (n Node) String() string {
 	return ret
 }
 
+// Role returns the role edge point, which describes the relationship of the
+// parent to the node (for example monitors or controls)
+func (n NodeEdge) Role() string {
+	role, _ := n.EdgePoints.Text(PointTypeRole, "")
+	return role
+}
+
+// Weight returns the weight edge point of the relationship, or 1 if it is
+// not set
+func (n NodeEdge) Weight() float64 {
+	w, ok := n.EdgePoints.Value(PointTypeWeight, "")
+	if !ok {
+		return 1
+	}
+	return w
+}
+
+// Archived returns true if the archived point of the node is set
+func (n NodeEdge) Archived() bool {
+	archived, _ := n.Points.ValueBool(PointTypeArchived, "")
+	return archived
+}
+
 // Desc returns Description if set, otherwise ID
 func (n *Node) Desc() string {
 	desc := n.Points.Desc()
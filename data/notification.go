@@ -12,6 +12,8 @@ type Notification struct {
 	SourceNode string `json:"sourceNode"`
 	Subject    string `json:"subject"`
 	Message    string `json:"message"`
+	Severity   string `json:"severity,omitempty"`
+	Priority   int    `json:"priority,omitempty"`
 }
 
 // ToPb converts to protobuf data
@@ -22,6 +24,8 @@ func (n *Notification) ToPb() ([]byte, error) {
 		SourceNode: n.SourceNode,
 		Subject:    n.Subject,
 		Msg:        n.Message,
+		Severity:   n.Severity,
+		Priority:   int32(n.Priority),
 	}
 
 	return proto.Marshal(&pbNot)
@@ -42,5 +46,22 @@ func PbDecodeNotification(data []byte) (Notification, error) {
 		SourceNode: pbNot.SourceNode,
 		Subject:    pbNot.Subject,
 		Message:    pbNot.Msg,
+		Severity:   pbNot.Severity,
+		Priority:   int(pbNot.Priority),
 	}, nil
 }
+
+// SeverityPriority returns the default priority for a severity level. Lower
+// numbers are higher priority. Unknown severities have the lowest priority.
+func SeverityPriority(severity string) int {
+	switch severity {
+	case PointValueCritical:
+		return 1
+	case PointValueWarning:
+		return 2
+	case PointValueInfo:
+		return 3
+	}
+
+	return 4
+}
@@ -0,0 +1,78 @@
+package data
+
+import "strings"
+
+// define the kinds of point origins
+const (
+	// a user changed the point, typically through the UI or HTTP API
+	PointOriginUser = "user"
+	// another SIOT instance changed the point, the origin is the root
+	// device node of the instance
+	PointOriginInstance = "instance"
+	// a client (rule, modbus, etc) changed the point, the origin is the
+	// client node
+	PointOriginClient = "client"
+	// the origin node is not in the store, for example a user of an
+	// upstream instance that is not synchronized
+	PointOriginUnknown = "unknown"
+)
+
+// OriginID returns the ID of the node that wrote the point. Points written
+// by the node that owns them have a blank Origin, so nodeID is returned.
+func (p Point) OriginID(nodeID string) string {
+	if p.Origin != "" {
+		return p.Origin
+	}
+
+	return nodeID
+}
+
+// PointOrigin describes who last changed a point. OriginID is the node that
+// wrote the point (see Point.OriginID) and Kind is one of the PointOrigin*
+// constants. OriginType and OriginDescription describe the origin node if
+// it is in the store: the node type, and the user name or node description.
+// Error is set if the query failed.
+type PointOrigin struct {
+	NodeID            string `json:"nodeId"`
+	Point             Point  `json:"point"`
+	OriginID          string `json:"originId"`
+	Kind              string `json:"kind"`
+	OriginType        string `json:"originType,omitempty"`
+	OriginDescription string `json:"originDescription,omitempty"`
+	Error             string `json:"error,omitempty"`
+}
+
+// NewPointOrigin returns the origin of a point p of node nodeID. origin is
+// the origin node, or nil if it is not known.
+func NewPointOrigin(nodeID string, p Point, origin *Node) PointOrigin {
+	ret := PointOrigin{
+		NodeID:   nodeID,
+		Point:    p,
+		OriginID: p.OriginID(nodeID),
+		Kind:     PointOriginUnknown,
+	}
+
+	if origin == nil {
+		return ret
+	}
+
+	ret.OriginType = origin.Type
+	ret.OriginDescription = origin.Desc()
+
+	switch origin.Type {
+	case NodeTypeUser:
+		ret.Kind = PointOriginUser
+		u := origin.ToUser()
+		if name := strings.TrimSpace(u.FirstName + " " + u.LastName); name != "" {
+			ret.OriginDescription = name
+		} else if u.Email != "" {
+			ret.OriginDescription = u.Email
+		}
+	case NodeTypeDevice:
+		ret.Kind = PointOriginInstance
+	default:
+		ret.Kind = PointOriginClient
+	}
+
+	return ret
+}
@@ -0,0 +1,234 @@
+package data
+
+import (
+	"strconv"
+	"time"
+)
+
+// Points with the same type and different keys can hold an array or a map.
+// Array points use the index as the key ("0", "1", ...) and map points use
+// the map key. An entry is deleted with an odd Tombstone, and a deleted entry
+// is restored with the next even Tombstone. Since the largest tombstone wins
+// when points are merged (see Points.Add), instances end up with the same
+// array or map no matter what order the points arrive in.
+//
+// Arrays are kept contiguous: the Slice* methods return the points to send
+// to insert, delete, or move entries, which shift the following entries and
+// delete the entries past the new end.
+
+// liveTombstone returns the tombstone for restoring or updating an entry
+func liveTombstone(t int) int {
+	if t%2 == 1 {
+		return t + 1
+	}
+	return t
+}
+
+// deadTombstone returns the tombstone for deleting an entry
+func deadTombstone(t int) int {
+	if t%2 == 0 {
+		return t + 1
+	}
+	return t
+}
+
+// slice returns the array of points of type typ ordered by index, and the
+// points of that type by key, including deleted points
+func (ps Points) slice(typ string) ([]Point, map[string]Point) {
+	var ret []Point
+	all := make(map[string]Point)
+
+	for _, p := range ps {
+		if p.Type != typ {
+			continue
+		}
+
+		all[p.Key] = p
+
+		if p.Tombstone%2 == 1 {
+			continue
+		}
+
+		i := 0
+		if p.Key != "" {
+			var err error
+			i, err = strconv.Atoi(p.Key)
+			if err != nil || i < 0 {
+				continue
+			}
+		}
+
+		if i >= len(ret) {
+			ret = append(ret, make([]Point, i+1-len(ret))...)
+		}
+
+		ret[i] = p
+	}
+
+	return ret, all
+}
+
+// SliceFloat returns the values of the array of points of type typ. Missing
+// entries are 0.
+func (ps Points) SliceFloat(typ string) []float64 {
+	s, _ := ps.slice(typ)
+	ret := make([]float64, len(s))
+	for i, p := range s {
+		ret[i] = p.Value
+	}
+	return ret
+}
+
+// SliceText returns the text of the array of points of type typ
+func (ps Points) SliceText(typ string) []string {
+	s, _ := ps.slice(typ)
+	ret := make([]string, len(s))
+	for i, p := range s {
+		ret[i] = p.Text
+	}
+	return ret
+}
+
+// Map returns the values of the points of type typ by key
+func (ps Points) Map(typ string) map[string]float64 {
+	ret := make(map[string]float64)
+	for _, p := range ps {
+		if p.Type == typ && p.Tombstone%2 == 0 {
+			ret[p.Key] = p.Value
+		}
+	}
+	return ret
+}
+
+// MapText returns the text of the points of type typ by key
+func (ps Points) MapText(typ string) map[string]string {
+	ret := make(map[string]string)
+	for _, p := range ps {
+		if p.Type == typ && p.Tombstone%2 == 0 {
+			ret[p.Key] = p.Text
+		}
+	}
+	return ret
+}
+
+// MapSet returns the point to send to set map entry p.Key of p.Type. The
+// tombstone is set so a deleted entry is restored.
+func (ps Points) MapSet(p Point) Point {
+	for _, c := range ps {
+		if c.Type == p.Type && c.Key == p.Key {
+			p.Tombstone = liveTombstone(c.Tombstone)
+			break
+		}
+	}
+
+	if p.Time.IsZero() {
+		p.Time = time.Now()
+	}
+
+	return p
+}
+
+// MapDelete returns the point to send to delete map entry key of type typ
+func (ps Points) MapDelete(typ, key string) Point {
+	ret := Point{Time: time.Now(), Type: typ, Key: key, Tombstone: 1}
+	for _, c := range ps {
+		if c.Type == typ && c.Key == key {
+			ret.Tombstone = deadTombstone(c.Tombstone)
+			break
+		}
+	}
+	return ret
+}
+
+// SliceUpdate returns the points to send to change the array of points of
+// type typ to entries. Only entries that change are returned, and entries
+// past the end of the new array are deleted. The type and key of entries are
+// set from typ and the index.
+func (ps Points) SliceUpdate(typ string, entries []Point) Points {
+	cur, all := ps.slice(typ)
+	now := time.Now()
+
+	var ret Points
+
+	for i, e := range entries {
+		key := strconv.Itoa(i)
+		existing, ok := all[key]
+
+		if i < len(cur) && ok && existing.Tombstone%2 == 0 &&
+			cur[i].Value == e.Value && cur[i].Text == e.Text {
+			continue
+		}
+
+		e.Type = typ
+		e.Key = key
+		e.Time = now
+		e.Tombstone = liveTombstone(existing.Tombstone)
+		ret = append(ret, e)
+	}
+
+	for i := len(entries); i < len(cur); i++ {
+		key := strconv.Itoa(i)
+		existing, ok := all[key]
+		if !ok || existing.Tombstone%2 == 1 {
+			continue
+		}
+
+		ret = append(ret, Point{Time: now, Type: typ, Key: key,
+			Tombstone: deadTombstone(existing.Tombstone)})
+	}
+
+	return ret
+}
+
+// SliceInsert returns the points to send to insert p at index i of the array
+// of points of type p.Type. Later entries are shifted up. If i is past the
+// end, p is appended.
+func (ps Points) SliceInsert(i int, p Point) Points {
+	cur, _ := ps.slice(p.Type)
+	if i < 0 {
+		i = 0
+	}
+	if i > len(cur) {
+		i = len(cur)
+	}
+
+	entries := make([]Point, 0, len(cur)+1)
+	entries = append(entries, cur[:i]...)
+	entries = append(entries, p)
+	entries = append(entries, cur[i:]...)
+
+	return ps.SliceUpdate(p.Type, entries)
+}
+
+// SliceDelete returns the points to send to delete index i of the array of
+// points of type typ. Later entries are shifted down.
+func (ps Points) SliceDelete(typ string, i int) Points {
+	cur, _ := ps.slice(typ)
+	if i < 0 || i >= len(cur) {
+		return nil
+	}
+
+	entries := make([]Point, 0, len(cur)-1)
+	entries = append(entries, cur[:i]...)
+	entries = append(entries, cur[i+1:]...)
+
+	return ps.SliceUpdate(typ, entries)
+}
+
+// SliceMove returns the points to send to move the entry at index from to
+// index to in the array of points of type typ
+func (ps Points) SliceMove(typ string, from, to int) Points {
+	cur, _ := ps.slice(typ)
+	if from < 0 || from >= len(cur) || to < 0 || to >= len(cur) || from == to {
+		return nil
+	}
+
+	entries := make([]Point, 0, len(cur))
+	entries = append(entries, cur[:from]...)
+	entries = append(entries, cur[from+1:]...)
+
+	moved := cur[from]
+	entries = append(entries[:to], append([]Point{moved}, entries[to:]...)...)
+
+	return ps.SliceUpdate(typ, entries)
+}
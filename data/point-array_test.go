@@ -0,0 +1,131 @@
+package data
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func testArray(values ...float64) Points {
+	t := time.Now().Add(-time.Minute)
+	var ret Points
+	for i, v := range values {
+		ret = append(ret, Point{Time: t, Type: "setpoint", Key: strconv.Itoa(i), Value: v})
+	}
+	return ret
+}
+
+func applyPoints(ps Points, update Points) Points {
+	ret := make(Points, len(ps))
+	copy(ret, ps)
+	for _, p := range update {
+		ret.Add(p)
+	}
+	return ret
+}
+
+func TestPointsSlice(t *testing.T) {
+	ps := testArray(10, 20, 30)
+	ps = append(ps, Point{Type: "setpoint", Key: "3", Value: 40, Tombstone: 1})
+
+	exp := []float64{10, 20, 30}
+	if got := ps.SliceFloat("setpoint"); !reflect.DeepEqual(got, exp) {
+		t.Errorf("SliceFloat, exp %v, got %v", exp, got)
+	}
+
+	// out of order keys are sorted by index, not text
+	ps = Points{
+		{Type: "name", Key: "10", Text: "k"},
+		{Type: "name", Key: "2", Text: "c"},
+	}
+	if got := ps.SliceText("name"); len(got) != 11 || got[2] != "c" || got[10] != "k" {
+		t.Error("SliceText out of order keys: ", got)
+	}
+}
+
+func TestPointsSliceOps(t *testing.T) {
+	tests := []struct {
+		name string
+		ops  func(ps Points) Points
+		exp  []float64
+	}{
+		{"insert", func(ps Points) Points {
+			return ps.SliceInsert(1, Point{Type: "setpoint", Value: 15})
+		}, []float64{10, 15, 20, 30}},
+		{"append", func(ps Points) Points {
+			return ps.SliceInsert(10, Point{Type: "setpoint", Value: 40})
+		}, []float64{10, 20, 30, 40}},
+		{"delete", func(ps Points) Points {
+			return ps.SliceDelete("setpoint", 0)
+		}, []float64{20, 30}},
+		{"move down", func(ps Points) Points {
+			return ps.SliceMove("setpoint", 0, 2)
+		}, []float64{20, 30, 10}},
+		{"move up", func(ps Points) Points {
+			return ps.SliceMove("setpoint", 2, 0)
+		}, []float64{30, 10, 20}},
+	}
+
+	for _, test := range tests {
+		ps := testArray(10, 20, 30)
+		update := test.ops(ps)
+		got := applyPoints(ps, update).SliceFloat("setpoint")
+		if !reflect.DeepEqual(got, test.exp) {
+			t.Errorf("%v: exp %v, got %v", test.name, test.exp, got)
+		}
+	}
+}
+
+func TestPointsSliceRestore(t *testing.T) {
+	ps := testArray(10, 20, 30)
+
+	// delete the last entry, then insert, which restores its key
+	ps = applyPoints(ps, ps.SliceDelete("setpoint", 2))
+	if got := ps.SliceFloat("setpoint"); !reflect.DeepEqual(got, []float64{10, 20}) {
+		t.Fatal("delete failed: ", got)
+	}
+
+	time.Sleep(time.Millisecond)
+
+	update := ps.SliceInsert(0, Point{Type: "setpoint", Value: 5})
+	ps = applyPoints(ps, update)
+
+	exp := []float64{5, 10, 20}
+	if got := ps.SliceFloat("setpoint"); !reflect.DeepEqual(got, exp) {
+		t.Errorf("restore failed, exp %v, got %v", exp, got)
+	}
+
+	// only changed entries are sent
+	if update := ps.SliceUpdate("setpoint", []Point{{Value: 5}, {Value: 11}, {Value: 20}}); len(update) != 1 {
+		t.Error("Expected 1 changed point, got: ", update)
+	}
+}
+
+func TestPointsMap(t *testing.T) {
+	ps := Points{
+		{Type: "register", Key: "temp", Value: 100},
+		{Type: "register", Key: "pressure", Value: 200},
+		{Type: "register", Key: "flow", Value: 300, Tombstone: 1},
+	}
+
+	exp := map[string]float64{"temp": 100, "pressure": 200}
+	if got := ps.Map("register"); !reflect.DeepEqual(got, exp) {
+		t.Errorf("Map, exp %v, got %v", exp, got)
+	}
+
+	p := ps.MapDelete("register", "temp")
+	if p.Tombstone != 1 {
+		t.Error("MapDelete tombstone: ", p.Tombstone)
+	}
+
+	p = ps.MapSet(Point{Type: "register", Key: "flow", Value: 301})
+	if p.Tombstone != 2 {
+		t.Error("MapSet did not restore deleted entry: ", p.Tombstone)
+	}
+
+	ps = applyPoints(ps, Points{p})
+	if v := ps.Map("register")["flow"]; v != 301 {
+		t.Error("Restored entry value: ", v)
+	}
+}
@@ -0,0 +1,214 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// cborTagEpochTime is the CBOR tag for epoch based time in seconds
+const cborTagEpochTime = 1
+
+// ToCBOR encodes points in CBOR for constrained devices where protobuf
+// libraries are too heavy. Points are an array of maps with the same keys
+// as the JSON wire format (see ToJSON), zero fields are left out:
+//
+//	[{"type": "value", "key": "0", "time": 1672671845123000000, "value": 1.5}]
+//
+// time is an integer in nanoseconds since the Unix epoch and ttl is an
+// integer in nanoseconds. Value and index are single precision floats if
+// that is lossless, otherwise doubles.
+func (ps Points) ToCBOR() ([]byte, error) {
+	w := &cborWriter{}
+	w.head(cborArray, uint64(len(ps)))
+
+	for _, p := range ps {
+		hasTime := !p.Time.IsZero()
+		var ns int64
+		if hasTime {
+			ns = p.Time.UnixNano()
+			if !time.Unix(0, ns).Equal(p.Time) {
+				return nil, fmt.Errorf("point time %v can not be encoded in CBOR", p.Time)
+			}
+		}
+
+		count := 0
+		for _, set := range []bool{p.Type != "", p.Key != "", hasTime, p.Index != 0,
+			p.Value != 0, p.Text != "", len(p.Data) > 0, p.Tombstone != 0,
+			p.Origin != "", p.TTL != 0} {
+			if set {
+				count++
+			}
+		}
+
+		w.head(cborMap, uint64(count))
+
+		if p.Type != "" {
+			w.text("type")
+			w.text(p.Type)
+		}
+
+		if p.Key != "" {
+			w.text("key")
+			w.text(p.Key)
+		}
+
+		if hasTime {
+			w.text("time")
+			w.int(ns)
+		}
+
+		if p.Index != 0 {
+			w.text("index")
+			w.float(p.Index)
+		}
+
+		if p.Value != 0 {
+			w.text("value")
+			w.float(p.Value)
+		}
+
+		if p.Text != "" {
+			w.text("text")
+			w.text(p.Text)
+		}
+
+		if len(p.Data) > 0 {
+			w.text("data")
+			w.bytes(p.Data)
+		}
+
+		if p.Tombstone != 0 {
+			w.text("tombstone")
+			w.int(int64(p.Tombstone))
+		}
+
+		if p.Origin != "" {
+			w.text("origin")
+			w.text(p.Origin)
+		}
+
+		if p.TTL != 0 {
+			w.text("ttl")
+			w.int(int64(p.TTL))
+		}
+	}
+
+	return w.buf, nil
+}
+
+// FromCBOR decodes points encoded with ToCBOR. Integers are accepted for
+// value and index, and time may also be an epoch time tag (tag 1) in
+// seconds for devices without 64 bit integers. Unknown keys are skipped.
+// Points without a time are left with a zero time.
+func (ps *Points) FromCBOR(d []byte) error {
+	r := &cborReader{d: d}
+
+	n, err := r.length(cborArray)
+	if err != nil {
+		return err
+	}
+
+	ret := make(Points, n)
+	for i := range ret {
+		err := ret[i].fromCBOR(r)
+		if err != nil {
+			return fmt.Errorf("point %v: %w", i, err)
+		}
+	}
+
+	if r.remaining() > 0 {
+		return errors.New("extra data after CBOR points")
+	}
+
+	*ps = ret
+	return nil
+}
+
+func (p *Point) fromCBOR(r *cborReader) error {
+	n, err := r.length(cborMap)
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < n; i++ {
+		key, err := r.text()
+		if err != nil {
+			return err
+		}
+
+		switch key {
+		case "type":
+			p.Type, err = r.text()
+		case "key":
+			p.Key, err = r.text()
+		case "time":
+			p.Time, err = r.time()
+		case "index":
+			p.Index, err = r.float()
+		case "value":
+			p.Value, err = r.float()
+		case "text":
+			p.Text, err = r.text()
+		case "data":
+			p.Data, err = r.bytes()
+		case "tombstone":
+			var v int64
+			v, err = r.int()
+			if err == nil && (v > math.MaxInt32 || v < math.MinInt32) {
+				err = errors.New("tombstone out of range")
+			}
+			p.Tombstone = int(v)
+		case "origin":
+			p.Origin, err = r.text()
+		case "ttl":
+			var v int64
+			v, err = r.int()
+			p.TTL = time.Duration(v)
+		default:
+			err = r.skip(0)
+		}
+
+		if err != nil {
+			return fmt.Errorf("%v: %w", key, err)
+		}
+	}
+
+	return nil
+}
+
+// time reads integer nanoseconds since the Unix epoch or an epoch time tag
+// in seconds
+func (r *cborReader) time() (time.Time, error) {
+	pos := r.pos
+	major, _, n, err := r.head()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if major == cborTag {
+		if n != cborTagEpochTime {
+			return time.Time{}, fmt.Errorf("unsupported CBOR time tag %v", n)
+		}
+
+		s, err := r.float()
+		if err != nil {
+			return time.Time{}, err
+		}
+
+		if math.IsNaN(s) || math.Abs(s) > math.MaxInt64/1e9 {
+			return time.Time{}, errors.New("CBOR epoch time out of range")
+		}
+
+		return time.Unix(0, int64(s*1e9)).UTC(), nil
+	}
+
+	r.pos = pos
+	ns, err := r.int()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return time.Unix(0, ns).UTC(), nil
+}
@@ -0,0 +1,194 @@
+package data
+
+import (
+	"bytes"
+	"encoding/hex"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPointsCBOR(t *testing.T) {
+	now := time.Date(2023, 1, 2, 15, 4, 5, 123000000, time.UTC)
+
+	pts := Points{
+		{Type: PointTypeValue, Key: "0", Time: now, Value: 1.5},
+		{Type: PointTypeDescription, Time: now, Text: "pump", Origin: "abc"},
+		{Type: PointTypeValue, Key: "1", Time: now, Index: 0.1, Tombstone: 1,
+			Data: []byte{1, 2}},
+		{Type: PointTypeValue, Value: -3, TTL: 30 * time.Second},
+	}
+
+	d, err := pts.ToCBOR()
+	if err != nil {
+		t.Fatal("Error encoding points: ", err)
+	}
+
+	var back Points
+	err = back.FromCBOR(d)
+	if err != nil {
+		t.Fatal("Error decoding points: ", err)
+	}
+
+	if !reflect.DeepEqual(back, pts) {
+		t.Errorf("round trip failed, got %v, exp %v", back, pts)
+	}
+}
+
+func TestPointsCBOREncoding(t *testing.T) {
+	pts := Points{{Type: "value", Value: 1.5}}
+
+	d, err := pts.ToCBOR()
+	if err != nil {
+		t.Fatal("Error encoding points: ", err)
+	}
+
+	// [{"type": "value", "value": 1.5}] with value as a single precision float
+	exp, _ := hex.DecodeString("81a264747970656576616c75656576616c7565fa3fc00000")
+	if !bytes.Equal(d, exp) {
+		t.Errorf("CBOR encoding not correct, got %x, exp %x", d, exp)
+	}
+}
+
+func TestPointsFromCBORDevice(t *testing.T) {
+	// what a small device might send: an integer value, a half precision
+	// index, a tag 1 epoch time in seconds, and an unknown key
+	// [{"type": "value", "value": 2, "index": 1.0 (f16),
+	//   "time": 1(1672671845), "extra": [1, {"a": h'00'}]}]
+	d, _ := hex.DecodeString("81a5647479706565" + "76616c7565" + "6576616c756502" +
+		"65696e646578f93c00" + "6474696d65c11a63b2f265" +
+		"6565787472618201a1616141" + "00")
+
+	var pts Points
+	err := pts.FromCBOR(d)
+	if err != nil {
+		t.Fatal("Error decoding points: ", err)
+	}
+
+	exp := Points{{Type: "value", Value: 2, Index: 1,
+		Time: time.Unix(1672671845, 0).UTC()}}
+
+	if !reflect.DeepEqual(pts, exp) {
+		t.Errorf("decoded points not correct, got %v, exp %v", pts, exp)
+	}
+}
+
+func TestPointsFromCBORErrors(t *testing.T) {
+	tests := []string{
+		"",
+		"a0",               // map instead of array
+		"81",               // missing point
+		"9f",               // indefinite length array
+		"81a1647479706501", // integer type
+		"8ba0",             // array longer than data
+		"81a0a0",           // extra data
+	}
+
+	for _, test := range tests {
+		d, _ := hex.DecodeString(test)
+		var pts Points
+		if err := pts.FromCBOR(d); err == nil {
+			t.Errorf("expected error decoding %v", test)
+		}
+	}
+}
+
+// equalFloat compares floats, treating NaNs as equal
+func equalFloat(a, b float64) bool {
+	return a == b || (math.IsNaN(a) && math.IsNaN(b))
+}
+
+// FuzzPointsCBOR checks that points that go through the protobuf encoding
+// round trip through CBOR unchanged
+func FuzzPointsCBOR(f *testing.F) {
+	f.Add("value", "0", int64(1672671845), int32(123), 1.5, 0.0, "", []byte{}, 0, "", int64(0))
+	f.Add("description", "", int64(0), int32(0), 0.0, 2.0, "pump", []byte{1}, 1, "abc", int64(1e9))
+	f.Add("", "k", int64(-5), int32(999999999), -1e30, 1e-5, "\x00", []byte(nil), -3, "o", int64(-1))
+
+	f.Fuzz(func(t *testing.T, typ, key string, sec int64, nsec int32,
+		value, index float64, text string, d []byte, tombstone int, origin string,
+		ttl int64) {
+		p := Point{Type: typ, Key: key, Time: time.Unix(sec, int64(nsec)),
+			Value: value, Index: index, Text: text, Data: d,
+			Tombstone: tombstone, Origin: origin, TTL: time.Duration(ttl)}
+
+		pbData, err := (&Points{p}).ToPb()
+		if err != nil {
+			// invalid UTF-8, time out of range, etc
+			return
+		}
+
+		pbPoints, err := PbDecodePoints(pbData)
+		if err != nil {
+			t.Fatal("Error decoding pb points: ", err)
+		}
+
+		cborData, err := pbPoints.ToCBOR()
+		if err != nil {
+			// time out of the range of int64 nanoseconds
+			return
+		}
+
+		var back Points
+		err = back.FromCBOR(cborData)
+		if err != nil {
+			t.Fatalf("Error decoding CBOR %x: %v", cborData, err)
+		}
+
+		if len(back) != 1 {
+			t.Fatalf("decoded %v points", len(back))
+		}
+
+		exp, got := pbPoints[0], back[0]
+		if !equalFloat(exp.Value, got.Value) || !equalFloat(exp.Index, got.Index) {
+			t.Errorf("value/index mismatch, got %v/%v, exp %v/%v", got.Value,
+				got.Index, exp.Value, exp.Index)
+		}
+
+		if !exp.Time.Equal(got.Time) && !(exp.Time.IsZero() && got.Time.IsZero()) {
+			t.Errorf("time mismatch, got %v, exp %v", got.Time, exp.Time)
+		}
+
+		exp.Value, exp.Index, exp.Time = 0, 0, time.Time{}
+		got.Value, got.Index, got.Time = 0, 0, time.Time{}
+		if len(exp.Data) == 0 {
+			exp.Data = nil
+		}
+
+		if !reflect.DeepEqual(exp, got) {
+			t.Errorf("round trip failed, got %+v, exp %+v", got, exp)
+		}
+	})
+}
+
+// FuzzPointsFromCBOR checks that arbitrary data does not crash the decoder
+func FuzzPointsFromCBOR(f *testing.F) {
+	f.Add([]byte{0x81, 0xa0})
+	f.Add([]byte{0x81, 0xa1, 0x64, 't', 'y', 'p', 'e', 0x61, 'v'})
+	f.Add([]byte{0x9b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff})
+
+	f.Fuzz(func(t *testing.T, d []byte) {
+		var pts Points
+		err := pts.FromCBOR(d)
+		if err != nil {
+			return
+		}
+
+		// anything that decodes must encode and decode to the same points
+		d2, err := pts.ToCBOR()
+		if err != nil {
+			return
+		}
+
+		var pts2 Points
+		err = pts2.FromCBOR(d2)
+		if err != nil {
+			t.Fatalf("Error decoding re-encoded CBOR %x: %v", d2, err)
+		}
+
+		if len(pts2) != len(pts) {
+			t.Fatalf("re-encoded points length mismatch")
+		}
+	})
+}
@@ -0,0 +1,85 @@
+package data
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// jsonPoint is the canonical JSON wire format of a point. Field names match
+// the Point JSON tags, zero fields are left out, time is RFC3339 with
+// nanoseconds, and ttl is in nanoseconds.
+type jsonPoint struct {
+	Type      string        `json:"type"`
+	Key       string        `json:"key,omitempty"`
+	Time      *time.Time    `json:"time,omitempty"`
+	Index     float64       `json:"index,omitempty"`
+	Value     float64       `json:"value,omitempty"`
+	Text      string        `json:"text,omitempty"`
+	Data      []byte        `json:"data,omitempty"`
+	Tombstone int           `json:"tombstone,omitempty"`
+	Origin    string        `json:"origin,omitempty"`
+	TTL       time.Duration `json:"ttl,omitempty"`
+}
+
+// ToJSON encodes points in the canonical JSON wire format, an array of
+// objects such as:
+//
+//	[{"type":"value","key":"0","time":"2023-01-02T15:04:05.123Z","value":1}]
+//
+// This is used by clients that do not speak protobuf (shell scripts,
+// browsers over NATS WebSocket, etc).
+func (ps Points) ToJSON() ([]byte, error) {
+	ret := make([]jsonPoint, len(ps))
+	for i, p := range ps {
+		ret[i] = jsonPoint{
+			Type:      p.Type,
+			Key:       p.Key,
+			Index:     p.Index,
+			Value:     p.Value,
+			Text:      p.Text,
+			Data:      p.Data,
+			Tombstone: p.Tombstone,
+			Origin:    p.Origin,
+			TTL:       p.TTL,
+		}
+
+		if !p.Time.IsZero() {
+			t := p.Time.UTC()
+			ret[i].Time = &t
+		}
+	}
+
+	return json.Marshal(ret)
+}
+
+// FromJSON decodes points in the JSON wire format (see ToJSON). Points
+// without a time are left with a zero time.
+func (ps *Points) FromJSON(d []byte) error {
+	var in []jsonPoint
+	err := json.Unmarshal(d, &in)
+	if err != nil {
+		return err
+	}
+
+	ret := make(Points, len(in))
+	for i, p := range in {
+		ret[i] = Point{
+			Type:      p.Type,
+			Key:       p.Key,
+			Index:     p.Index,
+			Value:     p.Value,
+			Text:      p.Text,
+			Data:      p.Data,
+			Tombstone: p.Tombstone,
+			Origin:    p.Origin,
+			TTL:       p.TTL,
+		}
+
+		if p.Time != nil {
+			ret[i].Time = *p.Time
+		}
+	}
+
+	*ps = ret
+	return nil
+}
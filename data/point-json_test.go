@@ -0,0 +1,57 @@
+package data
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPointsJSON(t *testing.T) {
+	now := time.Date(2023, 1, 2, 15, 4, 5, 123000000, time.UTC)
+
+	pts := Points{
+		{Type: PointTypeValue, Key: "0", Time: now, Value: 1.5},
+		{Type: PointTypeDescription, Time: now, Text: "pump", Origin: "abc"},
+		{Type: PointTypeValue, Key: "1", Time: now, Tombstone: 1, TTL: time.Minute},
+	}
+
+	d, err := pts.ToJSON()
+	if err != nil {
+		t.Fatal("Error encoding points: ", err)
+	}
+
+	exp := `[{"type":"value","key":"0","time":"2023-01-02T15:04:05.123Z","value":1.5},` +
+		`{"type":"description","time":"2023-01-02T15:04:05.123Z","text":"pump","origin":"abc"},` +
+		`{"type":"value","key":"1","time":"2023-01-02T15:04:05.123Z","tombstone":1,"ttl":60000000000}]`
+
+	if string(d) != exp {
+		t.Errorf("JSON encoding not correct, got:\n%s\nexp:\n%s", d, exp)
+	}
+
+	var back Points
+	err = back.FromJSON(d)
+	if err != nil {
+		t.Fatal("Error decoding points: ", err)
+	}
+
+	if !reflect.DeepEqual(back, pts) {
+		t.Errorf("round trip failed, got %v, exp %v", back, pts)
+	}
+}
+
+func TestPointsFromJSONNoTime(t *testing.T) {
+	var pts Points
+	err := pts.FromJSON([]byte(`[{"type":"value","value":2}]`))
+	if err != nil {
+		t.Fatal("Error decoding points: ", err)
+	}
+
+	if len(pts) != 1 || pts[0].Value != 2 || !pts[0].Time.IsZero() {
+		t.Errorf("decoded points not correct: %v", pts)
+	}
+
+	err = pts.FromJSON([]byte(`{"type":"value"}`))
+	if err == nil {
+		t.Error("expected error decoding a single object")
+	}
+}
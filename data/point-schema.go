@@ -0,0 +1,161 @@
+package data
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+)
+
+// PointKind is the kind of data a point type holds
+type PointKind string
+
+// point kinds
+const (
+	// PointKindValue points hold a number in Value
+	PointKindValue PointKind = "value"
+	// PointKindBool points hold 0 or 1 in Value
+	PointKindBool PointKind = "bool"
+	// PointKindText points hold a string in Text
+	PointKindText PointKind = "text"
+)
+
+// schema validation modes set with the schemaMode point on the root node
+const (
+	SchemaModeOff    = "off"
+	SchemaModeFlag   = "flag"
+	SchemaModeReject = "reject"
+)
+
+// PointSchema describes a point type a node type uses. Min and Max limit
+// the Value of value points, and Options lists the allowed Text of text
+// points. Status points are set by the client rather than the user, so
+// forms show them read-only.
+type PointSchema struct {
+	Type    string    `json:"type"`
+	Kind    PointKind `json:"kind"`
+	Label   string    `json:"label,omitempty"`
+	Units   string    `json:"units,omitempty"`
+	Min     *float64  `json:"min,omitempty"`
+	Max     *float64  `json:"max,omitempty"`
+	Options []string  `json:"options,omitempty"`
+	Status  bool      `json:"status,omitempty"`
+}
+
+// WithRange returns a copy of the point schema limited to min through max
+func (ps PointSchema) WithRange(min, max float64) PointSchema {
+	ps.Min = &min
+	ps.Max = &max
+	return ps
+}
+
+// Validate returns an error if p does not match the point schema.
+// Tombstoned points are always valid.
+func (ps PointSchema) Validate(p Point) error {
+	if p.Tombstone%2 == 1 {
+		return nil
+	}
+
+	switch ps.Kind {
+	case PointKindValue:
+		if math.IsNaN(p.Value) || math.IsInf(p.Value, 0) {
+			return fmt.Errorf("%v is not a number", p.Type)
+		}
+		if ps.Min != nil && p.Value < *ps.Min {
+			return fmt.Errorf("%v %v is less than %v", p.Type, p.Value, *ps.Min)
+		}
+		if ps.Max != nil && p.Value > *ps.Max {
+			return fmt.Errorf("%v %v is more than %v", p.Type, p.Value, *ps.Max)
+		}
+	case PointKindBool:
+		if p.Value != 0 && p.Value != 1 {
+			return fmt.Errorf("%v %v is not 0 or 1", p.Type, p.Value)
+		}
+	case PointKindText:
+		if len(ps.Options) <= 0 {
+			return nil
+		}
+		for _, o := range ps.Options {
+			if p.Text == o {
+				return nil
+			}
+		}
+		return fmt.Errorf("%v %q is not one of %v", p.Type, p.Text, ps.Options)
+	default:
+		return fmt.Errorf("%v has unknown kind %v", p.Type, ps.Kind)
+	}
+
+	return nil
+}
+
+// NodeSchema describes the points of a node type. Point types that are not
+// in the schema (description, disable, ...) are not validated.
+type NodeSchema struct {
+	NodeType string        `json:"nodeType"`
+	Points   []PointSchema `json:"points"`
+}
+
+// Point returns the schema for a point type
+func (ns NodeSchema) Point(typ string) (PointSchema, bool) {
+	for _, ps := range ns.Points {
+		if ps.Type == typ {
+			return ps, true
+		}
+	}
+
+	return PointSchema{}, false
+}
+
+// Validate returns an error for the first point that does not match the
+// schema
+func (ns NodeSchema) Validate(points Points) error {
+	for _, p := range points {
+		ps, ok := ns.Point(p.Type)
+		if !ok {
+			continue
+		}
+
+		err := ps.Validate(p)
+		if err != nil {
+			return fmt.Errorf("%v: %w", ns.NodeType, err)
+		}
+	}
+
+	return nil
+}
+
+var schemaLock sync.RWMutex
+var schemas = make(map[string]NodeSchema)
+
+// RegisterSchema registers the schema for a node type, replacing any
+// schema already registered for the type
+func RegisterSchema(s NodeSchema) {
+	schemaLock.Lock()
+	defer schemaLock.Unlock()
+	schemas[s.NodeType] = s
+}
+
+// LookupSchema returns the registered schema for a node type
+func LookupSchema(nodeType string) (NodeSchema, bool) {
+	schemaLock.RLock()
+	defer schemaLock.RUnlock()
+	s, ok := schemas[nodeType]
+	return s, ok
+}
+
+// Schemas returns all registered schemas sorted by node type
+func Schemas() []NodeSchema {
+	schemaLock.RLock()
+	defer schemaLock.RUnlock()
+
+	ret := make([]NodeSchema, 0, len(schemas))
+	for _, s := range schemas {
+		ret = append(ret, s)
+	}
+
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].NodeType < ret[j].NodeType
+	})
+
+	return ret
+}
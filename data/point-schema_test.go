@@ -0,0 +1,74 @@
+package data
+
+import (
+	"math"
+	"testing"
+)
+
+func TestPointSchemaValidate(t *testing.T) {
+	level := PointSchema{Type: "level", Kind: PointKindValue}.WithRange(0, 100)
+	enable := PointSchema{Type: "enable", Kind: PointKindBool}
+	mode := PointSchema{Type: "mode", Kind: PointKindText, Options: []string{"heat", "cool"}}
+	name := PointSchema{Type: "name", Kind: PointKindText}
+
+	tests := []struct {
+		name  string
+		ps    PointSchema
+		p     Point
+		valid bool
+	}{
+		{"in range", level, Point{Type: "level", Value: 50}, true},
+		{"at max", level, Point{Type: "level", Value: 100}, true},
+		{"below min", level, Point{Type: "level", Value: -1}, false},
+		{"above max", level, Point{Type: "level", Value: 101}, false},
+		{"NaN", level, Point{Type: "level", Value: math.NaN()}, false},
+		{"deleted", level, Point{Type: "level", Value: 500, Tombstone: 1}, true},
+		{"bool", enable, Point{Type: "enable", Value: 1}, true},
+		{"not bool", enable, Point{Type: "enable", Value: 2}, false},
+		{"option", mode, Point{Type: "mode", Text: "cool"}, true},
+		{"not option", mode, Point{Type: "mode", Text: "fan"}, false},
+		{"any text", name, Point{Type: "name", Text: "anything"}, true},
+	}
+
+	for _, test := range tests {
+		err := test.ps.Validate(test.p)
+		if (err == nil) != test.valid {
+			t.Errorf("%v: expected valid %v, got error %v", test.name, test.valid, err)
+		}
+	}
+}
+
+func TestRegisterSchema(t *testing.T) {
+	RegisterSchema(NodeSchema{NodeType: "testSchemaB"})
+	RegisterSchema(NodeSchema{NodeType: "testSchemaA", Points: []PointSchema{
+		{Type: "level", Kind: PointKindValue},
+	}})
+
+	s, ok := LookupSchema("testSchemaA")
+	if !ok {
+		t.Fatal("Schema not found")
+	}
+
+	if _, ok := s.Point("level"); !ok {
+		t.Error("Point schema not found")
+	}
+
+	err := s.Validate(Points{{Type: "description", Text: "not in schema"}})
+	if err != nil {
+		t.Error("Point not in schema failed validation: ", err)
+	}
+
+	a, b := -1, -1
+	for i, s := range Schemas() {
+		switch s.NodeType {
+		case "testSchemaA":
+			a = i
+		case "testSchemaB":
+			b = i
+		}
+	}
+
+	if a < 0 || b < 0 || a > b {
+		t.Error("Schemas not sorted by node type: ", a, b)
+	}
+}
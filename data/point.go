@@ -56,6 +56,10 @@ type Point struct {
 
 	// Where did this point come from. If from the owning node, it may be blank.
 	Origin string `json:"origin"`
+
+	// Time to live of the value. If set, the store clears the value and
+	// marks it stale if a newer point is not written within TTL of Time.
+	TTL time.Duration `json:"ttl,omitempty"`
 }
 
 // CRC returns a CRC for the point
@@ -98,11 +102,26 @@ func (p Point) String() string {
 		t += fmt.Sprintf("O:%v ", p.Origin)
 	}
 
+	if p.TTL != 0 {
+		t += fmt.Sprintf("TTL:%v ", p.TTL)
+	}
+
 	t += p.Time.Format(time.RFC3339)
 
 	return t
 }
 
+// TypeKey returns the point type, followed by the point key if it is set
+// (for example valueSet or valueSet.2). This is used as the key of points
+// that describe another point, such as commandState and stale points.
+func (p Point) TypeKey() string {
+	if p.Key == "" || p.Key == "0" {
+		return p.Type
+	}
+
+	return p.Type + "." + p.Key
+}
+
 // IsMatch returns true if the point matches the params passed in
 func (p Point) IsMatch(typ, key string) bool {
 	if typ != "" && typ != p.Type {
@@ -130,8 +149,10 @@ func (p Point) ToPb() (pb.Point, error) {
 		Value:     float32(p.Value),
 		Text:      p.Text,
 		Time:      ts,
+		Data:      p.Data,
 		Tombstone: int32(p.Tombstone),
 		Origin:    p.Origin,
+		Ttl:       int64(p.TTL),
 	}, nil
 }
 
@@ -320,8 +341,10 @@ func PbToPoint(sPb *pb.Point) (Point, error) {
 		Index:     float64(sPb.Index),
 		Value:     float64(sPb.Value),
 		Time:      ts,
+		Data:      sPb.Data,
 		Tombstone: int(sPb.Tombstone),
 		Origin:    sPb.Origin,
+		TTL:       time.Duration(sPb.Ttl),
 	}
 
 	return ret, nil
@@ -13,6 +13,7 @@ const (
 	PointTypeScale              = "scale"
 	PointTypeOffset             = "offset"
 	PointTypeUnits              = "units"
+	PointTypeDeviceUnits        = "deviceUnits"
 	PointTypeValue              = "value"
 	PointTypeValueSet           = "valueSet"
 	PointTypeIndex              = "index"
@@ -55,6 +56,13 @@ const (
 	PointTypeVersionApp           = "versionApp"
 	PointTypeVersionHW            = "versionHW"
 
+	// set on the root node when the store can't write to the db
+	PointTypeStoreReadOnly = "storeReadOnly"
+	PointTypeStoreError    = "storeError"
+
+	// set in a store verify request to repair the problems found
+	PointTypeRepair = "repair"
+
 	// user node describes a system user and is used to control
 	// access to the system (typically through web UI)
 	NodeTypeUser       = "user"
@@ -69,6 +77,12 @@ const (
 	PointValueRoleAdmin = "admin"
 	PointValueRoleUser  = "user"
 
+	// roles of other edges describe the relationship of the parent to the
+	// node, and the weight edge point how strong it is
+	PointValueRoleMonitors = "monitors"
+	PointValueRoleControls = "controls"
+	PointTypeWeight        = "weight"
+
 	// User Authentication
 	NodeTypeJWT    = "jwt"
 	PointTypeToken = "token"
@@ -121,6 +135,17 @@ const (
 
 	PointTypeActive = "active"
 
+	// runOn designates where a rule is evaluated
+	PointTypeRunOn              = "runOn"
+	PointValueEdge              = "edge"
+	PointValueUpstream          = "upstream"
+	PointValueEdgePreferred     = "edgePreferred"
+	PointValueUpstreamPreferred = "upstreamPreferred"
+
+	// evaluator lease written to rules by the edge sync layer
+	PointTypeEvaluator     = "evaluator"
+	PointTypeEvaluatorEdge = "evaluatorEdge"
+
 	NodeTypeCondition = "condition"
 
 	PointTypeConditionType = "conditionType"
@@ -155,6 +180,14 @@ const (
 
 	PointTypeMinActive = "minActive"
 
+	// alarm severity and priority of a rule. Lower priority numbers are more
+	// important. If priority is not set, it is derived from severity.
+	PointTypeSeverity  = "severity"
+	PointValueInfo     = "info"
+	PointValueWarning  = "warning"
+	PointValueCritical = "critical"
+	PointTypePriority  = "priority"
+
 	NodeTypeAction         = "action"
 	NodeTypeActionInactive = "actionInactive"
 
@@ -174,18 +207,31 @@ const (
 
 	PointTypeService = "service"
 
-	PointValueTwilio = "twilio"
-	PointValueSMTP   = "smtp"
+	PointValueTwilio      = "twilio"
+	PointValueAwsSns      = "awsSns"
+	PointValueVonage      = "vonage"
+	PointValueMessageBird = "messageBird"
+	PointValueGsmModem    = "gsmModem"
+	PointValueSMTP        = "smtp"
+
+	// smsService is the ID of the message service a node that sends
+	// notifications uses for SMS
+	PointTypeSMSService = "smsService"
 
 	PointTypeSID       = "sid"
 	PointTypeAuthToken = "authToken"
 	PointTypeFrom      = "from"
+	PointTypeRegion    = "region"
 
 	NodeTypeVariable      = "variable"
 	PointTypeVariableType = "variableType"
 
 	NodeTypeUpstream = "upstream"
 
+	// a peer node mirrors selected subtrees with a sibling instance
+	NodeTypePeer      = "peer"
+	PointTypeSyncNode = "syncNode"
+
 	PointTypeMetricNatsCycleNodePoint          = "metricNatsCycleNodePoint"
 	PointTypeMetricNatsCycleNodeEdgePoint      = "metricNatsCycleNodeEdgePoint"
 	PointTypeMetricNatsCycleNode               = "metricNatsCycleNode"
@@ -195,6 +241,143 @@ const (
 	PointTypeMetricNatsThroughputNodePoint     = "metricNatsThroughputNodePoint"
 	PointTypeMetricNatsThroughputNodeEdgePoint = "metricNatsThroughputNodeEdgePoint"
 
+	// client manager metrics, the point key is set to the node type
+	PointTypeMetricManagerActiveClients = "metricManagerActiveClients"
+	PointTypeMetricManagerRestarts      = "metricManagerRestarts"
+	PointTypeMetricManagerScanDuration  = "metricManagerScanDuration"
+	PointTypeMetricManagerDecodeErrors  = "metricManagerDecodeErrors"
+
+	// crashes of a client, set on the client node by its manager
+	PointTypeClientCrashes   = "clientCrashes"
+	PointTypeClientError     = "clientError"
+	PointTypeClientCrashLoop = "clientCrashLoop"
+
+	// resource usage of a client, set on the client node by its manager
+	PointTypeMetricClientGoroutines = "metricClientGoroutines"
+	PointTypeMetricClientCPU        = "metricClientCPU"
+
+	// set on a client node by its manager when the client stops sending
+	// heartbeats
+	PointTypeOffline = "offline"
+
+	// an archived node keeps its config and history, but client managers
+	// skip it, so its client is stopped
+	PointTypeArchived = "archived"
+
+	// IANA time zone (for example America/Chicago) of schedules in a node
+	// and its descendants, typically set on the device or group node of a
+	// site. Schedules are in UTC if not set.
+	PointTypeTimezone = "timezone"
+
+	// node types with a registered client, set on the root device node.
+	// The point key is set to the node type.
+	PointTypeClientType = "clientType"
+
+	// store dedup policy on the root device node, the point key is set to
+	// the node type
+	PointTypeDedupWindow = "dedupWindow"
+
+	// point schema validation mode (off, flag, or reject) set on the root
+	// device node. Nodes with points that violate the schema of their node
+	// type are flagged with schemaError points, where the key is the
+	// invalid point type.
+	PointTypeSchemaMode  = "schemaMode"
+	PointTypeSchemaError = "schemaError"
+
+	// time of the last point the store published to a JetStream stream,
+	// saved on the root device node so points published by other
+	// instances while the store was stopped can be replayed
+	PointTypeStreamTime = "streamTime"
+
+	// device attestation, set on the root device node of the upstream
+	// instance. The point key is set to the device ID (the root node ID of
+	// the device).
+	PointTypeAttestationKey = "attestationKey"
+	PointTypeAttested       = "attested"
+
+	// set on upstream nodes to get credentials with device attestation
+	PointTypeProvisionURL = "provisionURL"
+
+	// set on upstream nodes to connect through a SOCKS5 or HTTP proxy
+	PointTypeProxy = "proxy"
+
+	// set on upstream nodes to connect with NATS over WebSocket (wss on port
+	// 443 by default) for networks that only allow HTTPS. wsPath is an
+	// optional path prefix, for example when the upstream is behind a
+	// reverse proxy.
+	PointTypeTransport  = "transport"
+	PointValueNATS      = "nats"
+	PointValueWebSocket = "websocket"
+	PointTypeWSPath     = "wsPath"
+
+	// set on upstream nodes to authenticate with a TLS client certificate,
+	// the files of the certificate, key, and CA bundle used to verify the
+	// upstream. The certificate common name is the device ID.
+	PointTypeTLSCert = "tlsCert"
+	PointTypeTLSKey  = "tlsKey"
+	PointTypeTLSCA   = "tlsCA"
+
+	// set on upstream nodes to authenticate with NATS credentials issued by
+	// the upstream, the path of the creds file
+	PointTypeCreds = "creds"
+
+	// set on the root node when the NATS credentials of a device are
+	// revoked. The key is the device ID, and credentials issued at or
+	// before the time of the point are rejected.
+	PointTypeCredsRevoked = "credsRevoked"
+
+	// secret nodes hold credentials that client configs reference by
+	// node ID (see SecretRef). The value is encrypted by the store.
+	NodeTypeSecret       = "secret"
+	PointTypeSecretValue = "secretValue"
+
+	// signing of control points, set on the root device node. The key of
+	// signingKey points is the key ID.
+	PointTypeSignedPointTypes = "signedPointTypes"
+	PointTypeSigningKey       = "signingKey"
+	PointTypeSignature        = "signature"
+
+	// commands, the policy is set on the root device node. Points with a
+	// type in commandPointTypes (comma separated) written to a node by
+	// another node (users, rules, etc) are commands that the client of the
+	// node confirms. The state of each command is tracked with
+	// commandState and commandError points on the node, where the key is
+	// the command point type (see CommandKey). The state is pending,
+	// success, fail (PointValueFail), or timeout.
+	PointTypeCommandPointTypes = "commandPointTypes"
+	PointTypeCommandTimeout    = "commandTimeout"
+	PointTypeCommandState      = "commandState"
+	PointTypeCommandError      = "commandError"
+	PointValuePending          = "pending"
+	PointValueSuccess          = "success"
+	PointValueTimeout          = "timeout"
+
+	// set by the store when a point with a TTL expires, the key is the
+	// point type and key of the expired point (see Point.TypeKey). The value
+	// is 1 when the point is stale, and 0 after it is written again.
+	PointTypeStale = "stale"
+
+	// desired state of a config point, the key is the point type and key of
+	// the config point (see Point.TypeKey). The instance that owns the node
+	// applies the desired value to the config point, which is the reported
+	// state (see Shadow).
+	PointTypeDesired = "desired"
+
+	// translation of a text point for a locale, the key is the locale
+	// followed by "." and the point type (for example de.description), see
+	// Points.Localize
+	PointTypeTranslation = "translation"
+
+	// buffered subscription metrics, the point key is set to the subject
+	PointTypeMetricSubPending = "metricSubPending"
+	PointTypeMetricSubDropped = "metricSubDropped"
+	PointTypeMetricSubSpilled = "metricSubSpilled"
+
+	// reconnect buffer metrics of the server NATS client
+	PointTypeMetricNatsBufPending = "metricNatsBufPending"
+	PointTypeMetricNatsBufBytes   = "metricNatsBufBytes"
+	PointTypeMetricNatsBufDropped = "metricNatsBufDropped"
+
 	// serial MCU clients
 	NodeTypeSerialDev = "serialDev"
 	PointTypeRx       = "rx"
@@ -204,6 +387,423 @@ const (
 	PointTypeLog      = "log"
 	PointTypeUptime   = "uptime"
 
+	// GSM modem clients receive command SMS messages
+	NodeTypeGsmModem        = "gsmModem"
+	PointTypeAllowedSenders = "allowedSenders"
+	PointTypeTargetNodes    = "targetNodes"
+
+	// email ingest clients convert emails into points
+	NodeTypeEmailIngest  = "emailIngest"
+	NodeTypeEmailPattern = "emailPattern"
+	PointTypeServer      = "server"
+	PointTypeNoTLS       = "noTLS"
+	PointTypeUsername    = "username"
+	PointTypeMailbox     = "mailbox"
+	PointTypeSubject     = "subject"
+	PointTypeRegex       = "regex"
+
+	// file ingest clients convert CSV/XML files into points
+	NodeTypeFileIngest     = "fileIngest"
+	NodeTypeFileColumn     = "fileColumn"
+	PointTypeHostKey       = "hostKey"
+	PointTypeKnownHosts    = "knownHosts"
+	PointTypePattern       = "pattern"
+	PointTypeFormat        = "format"
+	PointTypeDelimiter     = "delimiter"
+	PointTypeRecordElement = "recordElement"
+	PointTypeTimeColumn    = "timeColumn"
+	PointTypeTimeFormat    = "timeFormat"
+	PointTypeProcessedDir  = "processedDir"
+	PointTypeColumn        = "column"
+	PointValueCSV          = "csv"
+	PointValueXML          = "xml"
+	PointValueUnix         = "unix"
+	PointValueUnixMs       = "unixMs"
+
+	// S3 export clients upload point history and backups to S3
+	NodeTypeS3Export       = "s3Export"
+	PointTypeAccessKey     = "accessKey"
+	PointTypeSecretKey     = "secretKey"
+	PointTypeSessionToken  = "sessionToken"
+	PointTypePrefix        = "prefix"
+	PointTypeEncryptionKey = "encryptionKey"
+	PointTypeExportPeriod  = "exportPeriod"
+	PointTypeBackupPeriod  = "backupPeriod"
+
+	// Kafka clients stream point changes to Kafka topics
+	NodeTypeKafka           = "kafka"
+	PointTypeBrokers        = "brokers"
+	PointTypeTopic          = "topic"
+	PointTypePointTypes     = "pointTypes"
+	PointTypeSchemaRegistry = "schemaRegistry"
+	PointTypeTLS            = "tls"
+	PointValueJSON          = "json"
+	PointValueAvro          = "avro"
+
+	// OPC UA clients map the variables of an OPC UA server to IO nodes. The
+	// security policy and mode select the endpoint of the server, and the
+	// tlsCert/tlsKey points are the client application certificate.
+	NodeTypeOpcUA           = "opcUA"
+	NodeTypeOpcUAIO         = "opcUAIo"
+	PointTypeOpcUANodeID    = "opcuaNodeID"
+	PointTypeBrowse         = "browse"
+	PointTypeSecurityPolicy = "securityPolicy"
+	PointTypeSecurityMode   = "securityMode"
+
+	// BACnet clients map the objects of BACnet/IP devices to IO nodes
+	NodeTypeBacnet            = "bacnet"
+	NodeTypeBacnetIO          = "bacnetIo"
+	PointTypeBroadcastAddress = "broadcastAddress"
+	PointTypeDiscover         = "discover"
+	PointTypeBacnetDeviceID   = "bacnetDeviceID"
+	PointTypeBacnetObjectType = "bacnetObjectType"
+	PointTypeBacnetInstance   = "bacnetInstance"
+	PointTypeCOV              = "cov"
+
+	// SNMP clients poll SNMP agents and receive traps
+	NodeTypeSnmp          = "snmp"
+	NodeTypeSnmpIO        = "snmpIo"
+	PointTypeSnmpVersion  = "snmpVersion"
+	PointTypeCommunity    = "community"
+	PointTypeAuthProtocol = "authProtocol"
+	PointTypePrivProtocol = "privProtocol"
+	PointTypePrivPass     = "privPass"
+	PointTypeTrapPort     = "trapPort"
+	PointTypeOID          = "oid"
+	PointTypeTrap         = "trap"
+	PointValueSnmpV2c     = "2c"
+	PointValueSnmpV3      = "3"
+
+	// CAN bus clients decode the frames of a SocketCAN interface with a DBC
+	// file into signal points of message nodes
+	NodeTypeCanBus     = "canBus"
+	NodeTypeCanMessage = "canMessage"
+	PointTypeDbcFile   = "dbcFile"
+	PointTypeCanID     = "canID"
+	PointTypeExtended  = "extended"
+	// J1939 parameter groups are reassembled and decoded by PGN, and the
+	// suspect parameter numbers of signals are spn points
+	PointTypeJ1939 = "j1939"
+	PointTypeSpn   = "spn"
+
+	// cloud forwarders send point changes to custom HTTP or gRPC endpoints
+	NodeTypeCloudForwarder = "cloudForwarder"
+	PointTypeBatchSize     = "batchSize"
+	PointTypeBatchPeriod   = "batchPeriod"
+	PointTypeSpoolDir      = "spoolDir"
+	PointTypeMaxSpool      = "maxSpool"
+	PointValueProtobuf     = "protobuf"
+
+	// retention nodes keep point history for the nodes under their parent
+	NodeTypeRetention           = "retention"
+	PointTypeRawPeriod          = "rawPeriod"
+	PointTypeDownsampleInterval = "downsampleInterval"
+	PointTypeDownsamplePeriod   = "downsamplePeriod"
+
+	// store settings nodes configure store maintenance such as purging
+	// deleted nodes
+	NodeTypeStoreSettings = "storeSettings"
+	PointTypeGcAge        = "gcAge"
+	PointTypeGcPeriod     = "gcPeriod"
+	PointTypeGcDryRun     = "gcDryRun"
+	PointTypeGcEdges      = "gcEdges"
+	PointTypeGcNodes      = "gcNodes"
+	PointTypeKeyTypes     = "keyTypes"
+	PointTypeKeyAge       = "keyAge"
+	PointTypeKeyLimit     = "keyLimit"
+	PointTypeGcKeys       = "gcKeys"
+	PointTypeGcPoints     = "gcPoints"
+
+	// quota nodes limit the resources used by the nodes under their parent
+	NodeTypeQuota            = "quota"
+	PointTypeMaxNodes        = "maxNodes"
+	PointTypeMaxPointRate    = "maxPointRate"
+	PointTypeMaxHistoryBytes = "maxHistoryBytes"
+	PointTypeNodeCount       = "nodeCount"
+	PointTypePointRate       = "pointRate"
+	PointTypeHistoryBytes    = "historyBytes"
+	// overQuota points are keyed by the usage point type that is over its
+	// limit and set to 1 while the limit is exceeded, rejected counts the
+	// writes rejected for each limit
+	PointTypeOverQuota = "overQuota"
+	PointTypeRejected  = "rejected"
+
+	// webhooks call a URL when nodes are created, deleted, or change points
+	NodeTypeWebhook    = "webhook"
+	PointTypeSecret    = "secret"
+	PointTypeOnCreate  = "onCreate"
+	PointTypeOnDelete  = "onDelete"
+	PointTypeNodeTypes = "nodeTypes"
+
+	// sequencers run zones (outputs) in order for configured durations
+	NodeTypeSequencer      = "sequencer"
+	NodeTypeSequencerZone  = "sequencerZone"
+	PointTypeDuration      = "duration"
+	PointTypeRun           = "run"
+	PointTypePause         = "pause"
+	PointTypeAdvance       = "advance"
+	PointTypeRainNodeID    = "rainNodeID"
+	PointTypeRainPointType = "rainPointType"
+	PointTypeRainDelay     = "rainDelay"
+	PointTypeActiveZone    = "activeZone"
+	PointTypeZoneRemaining = "zoneRemaining"
+	PointTypeRemaining     = "remaining"
+
+	// lighting controllers drive lights from dusk to dawn with occupancy,
+	// dimming curves, and manual override
+	NodeTypeLighting            = "lighting"
+	PointTypeLatitude           = "latitude"
+	PointTypeLongitude          = "longitude"
+	PointTypeDuskOffset         = "duskOffset"
+	PointTypeDawnOffset         = "dawnOffset"
+	PointTypeOutputNodeID       = "outputNodeID"
+	PointTypeOutputPointType    = "outputPointType"
+	PointTypeOutputMax          = "outputMax"
+	PointTypeOccupancyNodeID    = "occupancyNodeID"
+	PointTypeOccupancyPointType = "occupancyPointType"
+	PointTypeOccupancyTimeout   = "occupancyTimeout"
+	PointTypeLevel              = "level"
+	PointTypeOccupiedLevel      = "occupiedLevel"
+	PointTypeCurve              = "curve"
+	PointValueLinear            = "linear"
+	PointValueSquare            = "square"
+	PointValueCIE               = "cie"
+	PointTypeOverride           = "override"
+	PointTypeOverrideLevel      = "overrideLevel"
+	PointTypeOverrideTimeout    = "overrideTimeout"
+	PointTypeDark               = "dark"
+	PointTypeOccupied           = "occupied"
+	PointTypeActiveLevel        = "activeLevel"
+
+	// tanks convert a level sensor to volume and percent full, and detect
+	// leaks. The strapping point key is the level.
+	NodeTypeTank            = "tank"
+	PointTypeShape          = "shape"
+	PointValueVertical      = "vertical"
+	PointValueHorizontal    = "horizontal"
+	PointValueRectangular   = "rectangular"
+	PointValueTable         = "table"
+	PointTypeDiameter       = "diameter"
+	PointTypeLength         = "length"
+	PointTypeWidth          = "width"
+	PointTypeHeight         = "height"
+	PointTypeVolumeScale    = "volumeScale"
+	PointTypeStrapping      = "strapping"
+	PointTypeLevelNodeID    = "levelNodeID"
+	PointTypeLevelPointType = "levelPointType"
+	PointTypeLevelOffset    = "levelOffset"
+	PointTypeFromTop        = "fromTop"
+	PointTypeRateWindow     = "rateWindow"
+	PointTypeLeakRate       = "leakRate"
+	PointTypeLeakDelay      = "leakDelay"
+	PointTypeVolume         = "volume"
+	PointTypePercent        = "percent"
+	PointTypeRate           = "rate"
+	PointTypeLeak           = "leak"
+
+	// pump groups alternate the lead pump by runtime and fail over to
+	// another pump if feedback is lost
+	NodeTypePumpGroup          = "pumpGroup"
+	NodeTypePump               = "pump"
+	PointTypeDemand            = "demand"
+	PointTypeFeedbackTimeout   = "feedbackTimeout"
+	PointTypeLead              = "lead"
+	PointTypeRunning           = "running"
+	PointTypeNodeID            = "nodeID"
+	PointTypeFeedbackNodeID    = "feedbackNodeID"
+	PointTypeFeedbackPointType = "feedbackPointType"
+	PointTypeRuntime           = "runtime"
+	PointTypeFailed            = "failed"
+
+	// generators monitor a generator controller and ATS, and run weekly
+	// exercise runs
+	NodeTypeGenerator         = "generator"
+	PointTypeProfile          = "profile"
+	PointValueDSE             = "dse"
+	PointValueComAp           = "comap"
+	PointTypeModbusNodeID     = "modbusNodeID"
+	PointTypeModbusID         = "modbusID"
+	PointTypeRunNodeID        = "runNodeID"
+	PointTypeRunThreshold     = "runThreshold"
+	PointTypeFuelNodeID       = "fuelNodeID"
+	PointTypeBatteryNodeID    = "batteryNodeID"
+	PointTypeATSNodeID        = "atsNodeID"
+	PointTypeStartNodeID      = "startNodeID"
+	PointTypeStartTimeout     = "startTimeout"
+	PointTypeFuelLow          = "fuelLow"
+	PointTypeBatteryLow       = "batteryLow"
+	PointTypeExerciseWeekday  = "exerciseWeekday"
+	PointTypeExerciseStart    = "exerciseStart"
+	PointTypeExerciseDuration = "exerciseDuration"
+	PointTypeRemoteStart      = "remoteStart"
+	PointTypeExercise         = "exercise"
+	PointTypeFuelLevel        = "fuelLevel"
+	PointTypeBatteryVoltage   = "batteryVoltage"
+	PointTypeOnGenerator      = "onGenerator"
+	PointTypeFailToStart      = "failToStart"
+	PointTypeLowFuel          = "lowFuel"
+	PointTypeLowBattery       = "lowBattery"
+
+	// HVAC controllers stage heating and cooling outputs from a zone
+	// temperature and use outdoor air to cool when it is cool enough
+	NodeTypeHvac              = "hvac"
+	NodeTypeHvacStage         = "hvacStage"
+	PointTypeMode             = "mode"
+	PointValueHeat            = "heat"
+	PointValueCool            = "cool"
+	PointValueAuto            = "auto"
+	PointTypeTempNodeID       = "tempNodeID"
+	PointTypeOutdoorNodeID    = "outdoorNodeID"
+	PointTypeHeatSetpoint     = "heatSetpoint"
+	PointTypeCoolSetpoint     = "coolSetpoint"
+	PointTypeSetbackHeat      = "setbackHeat"
+	PointTypeSetbackCool      = "setbackCool"
+	PointTypeOccupiedStart    = "occupiedStart"
+	PointTypeOccupiedEnd      = "occupiedEnd"
+	PointTypeDifferential     = "differential"
+	PointTypeStageDelay       = "stageDelay"
+	PointTypeMinRun           = "minRun"
+	PointTypeMinOff           = "minOff"
+	PointTypeEconomizerNodeID = "economizerNodeID"
+	PointTypeEconomizerTemp   = "economizerTemp"
+	PointTypeFanNodeID        = "fanNodeID"
+	PointTypeHeatStage        = "heatStage"
+	PointTypeCoolStage        = "coolStage"
+	PointTypeEconomizing      = "economizing"
+	PointTypeStageType        = "stageType"
+
+	// cold chain nodes log temperature excursions as events that are signed
+	// off by an operator
+	NodeTypeColdChain       = "coldChain"
+	NodeTypeColdChainEvent  = "coldChainEvent"
+	PointTypeTempPointType  = "tempPointType"
+	PointTypeLowLimit       = "lowLimit"
+	PointTypeHighLimit      = "highLimit"
+	PointTypeExcursionDelay = "excursionDelay"
+	PointTypeExcursion      = "excursion"
+	PointTypeUnsigned       = "unsigned"
+	PointTypeLimitType      = "limitType"
+	PointValueHigh          = "high"
+	PointValueLow           = "low"
+	PointTypeLimit          = "limit"
+	PointTypePeak           = "peak"
+	PointTypeSignOff        = "signOff"
+	PointTypeSignOffBy      = "signOffBy"
+	PointTypeSignOffTime    = "signOffTime"
+	PointTypeComment        = "comment"
+
+	// dosers pulse-width modulate irrigation valves or fertigation pumps to
+	// drive a sensor toward a setpoint
+	NodeTypeDoser            = "doser"
+	PointTypeSensorNodeID    = "sensorNodeID"
+	PointTypeSensorPointType = "sensorPointType"
+	PointTypeSetpoint        = "setpoint"
+	PointTypeDirection       = "direction"
+	PointValueRaise          = "raise"
+	PointValueLower          = "lower"
+	PointTypeGain            = "gain"
+	PointTypeDeadband        = "deadband"
+	PointTypePeriod          = "period"
+	PointTypeMaxDuty         = "maxDuty"
+	PointTypeFlowRate        = "flowRate"
+	PointTypeDailyLimit      = "dailyLimit"
+	PointTypeInterlockNodeID = "interlockNodeID"
+	PointTypeSensorTimeout   = "sensorTimeout"
+	PointTypeDuty            = "duty"
+	PointTypeDoseToday       = "doseToday"
+	PointTypeDoseDate        = "doseDate"
+	PointTypeInterlocked     = "interlocked"
+	PointTypeLimitReached    = "limitReached"
+
+	// vibration nodes compute features of high rate acceleration data
+	NodeTypeVibration      = "vibration"
+	NodeTypeVibrationBand  = "vibrationBand"
+	PointTypeWindowSize    = "windowSize"
+	PointTypeRms           = "rms"
+	PointTypeCrestFactor   = "crestFactor"
+	PointTypeKurtosis      = "kurtosis"
+	PointTypeLowFrequency  = "lowFrequency"
+	PointTypeHighFrequency = "highFrequency"
+
+	// calc nodes compute points derived from a source point. Each
+	// calcOutput child computes one operation over an optional window
+	// (PointTypeWindow, in seconds).
+	NodeTypeCalc             = "calc"
+	NodeTypeCalcOutput       = "calcOutput"
+	PointTypeSourceNodeID    = "sourceNodeID"
+	PointTypeSourcePointType = "sourcePointType"
+	PointTypeSourcePointKey  = "sourcePointKey"
+	PointTypeOperation       = "operation"
+	PointValueDelta          = "delta"
+	PointValueRate           = "rate"
+	PointValueAverage        = "average"
+	PointValueMin            = "min"
+	PointValueMax            = "max"
+
+	// occupancy nodes count people or vehicles entering and leaving zones
+	NodeTypeOccupancy       = "occupancy"
+	NodeTypeOccupancyZone   = "occupancyZone"
+	PointTypeResetTime      = "resetTime"
+	PointTypeLastReset      = "lastReset"
+	PointTypeCapacity       = "capacity"
+	PointTypeEntryNodeID    = "entryNodeID"
+	PointTypeEntryPointType = "entryPointType"
+	PointTypeExitNodeID     = "exitNodeID"
+	PointTypeExitPointType  = "exitPointType"
+	PointTypeCounterType    = "counterType"
+	PointValueEvent         = "event"
+	PointValueTotal         = "total"
+	PointTypeOccupancy      = "occupancy"
+	PointTypeEntriesToday   = "entriesToday"
+	PointTypeExitsToday     = "exitsToday"
+	PointTypePeakOccupancy  = "peakOccupancy"
+	PointTypeOverCapacity   = "overCapacity"
+
+	// config templates report devices whose configuration has drifted from
+	// a golden configuration
+	NodeTypeConfigTemplate    = "configTemplate"
+	NodeTypeConfigDrift       = "configDrift"
+	PointTypeGoldenNodeID     = "goldenNodeID"
+	PointTypeTag              = "tag"
+	PointTypeIgnorePointTypes = "ignorePointTypes"
+	PointTypeDevices          = "devices"
+	PointTypeDrifted          = "drifted"
+	PointTypeDeviceNodeID     = "deviceNodeID"
+	PointTypeDifferences      = "differences"
+	PointTypeCount            = "count"
+	PointTypeReapply          = "reapply"
+
+	// commissioning nodes track the checks an installer runs on a site and
+	// generate a signed off report
+	NodeTypeCommissioning      = "commissioning"
+	NodeTypeCommissioningCheck = "commissioningCheck"
+	PointTypeTechnician        = "technician"
+	PointTypeReport            = "report"
+	PointTypeDetail            = "detail"
+	PointTypePassed            = "passed"
+	PointTypeCheckType         = "checkType"
+	PointValueSensor           = "sensor"
+	PointValueOutput           = "output"
+	PointValueSync             = "sync"
+	PointValueManual           = "manual"
+	PointTypeMaxAge            = "maxAge"
+	PointTypeResult            = "result"
+	PointTypeResultTime        = "resultTime"
+	PointValuePass             = "pass"
+	PointValueFail             = "fail"
+
+	// annotations are comments attached to a node or point type over a
+	// time range. The point key is the annotation ID.
+	PointTypeAnnotation = "annotation"
+
+	// calibration points, the point key is the calibrated point type
+	PointTypeCalibrationOffset = "calibrationOffset"
+	PointTypeCalibrationGain   = "calibrationGain"
+
+	// history queries
+	PointTypeWindow    = "window"
+	PointTypeAggregate = "aggregate"
+
 	NodeTypeSignalGenerator = "signalGenerator"
 
 	PointTypeFrequency  = "frequency"
@@ -0,0 +1,72 @@
+package data
+
+import "strings"
+
+// SecretMask replaces the text of sensitive points in API responses and
+// exports
+const SecretMask = "********"
+
+// EncryptedPrefix is added to secret values encrypted by the store
+const EncryptedPrefix = "enc:"
+
+const secretRefPrefix = "secret:"
+
+// sensitivePointTypes are masked in API responses and exports
+var sensitivePointTypes = map[string]bool{
+	PointTypePass:          true,
+	PointTypeAuthToken:     true,
+	PointTypeSecretKey:     true,
+	PointTypeSessionToken:  true,
+	PointTypeSecret:        true,
+	PointTypeEncryptionKey: true,
+	PointTypeSecretValue:   true,
+	PointTypePrivPass:      true,
+	PointTypeCommunity:     true,
+}
+
+// IsSensitive returns true if points of type typ hold credentials
+func IsSensitive(typ string) bool {
+	return sensitivePointTypes[typ]
+}
+
+// SecretRef returns the point text used to reference a secret node in a
+// client config. Clients get the secret value instead of the reference.
+func SecretRef(id string) string {
+	return secretRefPrefix + id
+}
+
+// ParseSecretRef returns the secret node ID if text is a secret reference
+func ParseSecretRef(text string) (string, bool) {
+	if !strings.HasPrefix(text, secretRefPrefix) {
+		return "", false
+	}
+
+	id := strings.TrimPrefix(text, secretRefPrefix)
+	return id, id != ""
+}
+
+// Mask returns a copy of the points with the text of sensitive points
+// replaced by SecretMask. Secret references are not masked as they don't
+// contain the secret.
+func (ps Points) Mask() Points {
+	ret := make(Points, len(ps))
+	copy(ret, ps)
+
+	for i := range ret {
+		ret[i].Text = maskText(ret[i])
+	}
+
+	return ret
+}
+
+func maskText(p Point) string {
+	if !IsSensitive(p.Type) || p.Text == "" {
+		return p.Text
+	}
+
+	if _, ok := ParseSecretRef(p.Text); ok {
+		return p.Text
+	}
+
+	return SecretMask
+}
@@ -0,0 +1,44 @@
+package data
+
+import "testing"
+
+func TestPointsMask(t *testing.T) {
+	points := Points{
+		{Type: PointTypeDescription, Text: "db"},
+		{Type: PointTypeAuthToken, Text: "abc123"},
+		{Type: PointTypePass, Text: SecretRef("s1")},
+		{Type: PointTypeSecret},
+	}
+
+	masked := points.Mask()
+
+	exp := []string{"db", SecretMask, "secret:s1", ""}
+	for i, p := range masked {
+		if p.Text != exp[i] {
+			t.Errorf("point %v: expected %v, got %v", p.Type, exp[i], p.Text)
+		}
+	}
+
+	if points[1].Text != "abc123" {
+		t.Error("Mask modified the original points")
+	}
+}
+
+func TestParseSecretRef(t *testing.T) {
+	tests := []struct {
+		text string
+		id   string
+		ok   bool
+	}{
+		{"secret:1234", "1234", true},
+		{"secret:", "", false},
+		{"password", "", false},
+	}
+
+	for _, test := range tests {
+		id, ok := ParseSecretRef(test.text)
+		if id != test.id || ok != test.ok {
+			t.Errorf("%v: expected %v %v, got %v %v", test.text, test.id, test.ok, id, ok)
+		}
+	}
+}
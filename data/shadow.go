@@ -0,0 +1,102 @@
+package data
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+)
+
+// DesiredPoint returns the desired point for config point p. The point is
+// written to a node instead of p when the change should be applied by the
+// instance that owns the node, which may be offline.
+func DesiredPoint(p Point) Point {
+	return Point{
+		Type:   PointTypeDesired,
+		Key:    p.TypeKey(),
+		Time:   p.Time,
+		Index:  p.Index,
+		Value:  p.Value,
+		Text:   p.Text,
+		Data:   p.Data,
+		Origin: p.Origin,
+	}
+}
+
+// DesiredTypeKey returns the type and key of the config point of desired
+// point key (the reverse of Point.TypeKey)
+func DesiredTypeKey(key string) (string, string) {
+	typ, k, _ := strings.Cut(key, ".")
+	return typ, k
+}
+
+// Shadow is the desired and reported state of a config point. Reported is
+// the config point, and Desired is the last desired point written for it.
+// Either point is zero if it does not exist.
+type Shadow struct {
+	Type     string
+	Key      string
+	Desired  Point
+	Reported Point
+}
+
+// Pending returns true if the desired value has not been applied. Changes
+// resolve by time: a desired value is pending until a reported point with
+// the same or a newer time is written, so a change made on the device after
+// the desired value wins, and a desired value made after it is applied.
+func (s Shadow) Pending() bool {
+	if s.Desired.Type == "" || s.Desired.Tombstone%2 == 1 {
+		return false
+	}
+
+	if s.Reported.Type == "" {
+		return true
+	}
+
+	return s.Desired.Time.After(s.Reported.Time) && !sameValue(s.Desired, s.Reported)
+}
+
+// Shadows returns the shadow state of each config point with a desired
+// point, sorted by desired point key
+func (ps Points) Shadows() []Shadow {
+	var ret []Shadow
+
+	for _, d := range ps {
+		if d.Type != PointTypeDesired {
+			continue
+		}
+
+		typ, key := DesiredTypeKey(d.Key)
+		s := Shadow{Type: typ, Key: key, Desired: d}
+
+		for _, p := range ps {
+			if p.Type == typ && p.TypeKey() == d.Key {
+				s.Reported = p
+				break
+			}
+		}
+
+		ret = append(ret, s)
+	}
+
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Desired.Key < ret[j].Desired.Key
+	})
+
+	return ret
+}
+
+// Pending returns the shadows that have not been applied
+func (ps Points) Pending() []Shadow {
+	var ret []Shadow
+	for _, s := range ps.Shadows() {
+		if s.Pending() {
+			ret = append(ret, s)
+		}
+	}
+
+	return ret
+}
+
+func sameValue(a, b Point) bool {
+	return a.Value == b.Value && a.Text == b.Text && bytes.Equal(a.Data, b.Data)
+}
@@ -0,0 +1,51 @@
+package data
+
+import (
+	"testing"
+	"time"
+)
+
+func TestShadowPending(t *testing.T) {
+	now := time.Now()
+	later := now.Add(time.Second)
+
+	reported := Point{Type: PointTypeDescription, Text: "a", Time: now}
+
+	tests := []struct {
+		name    string
+		desired Point
+		pending bool
+	}{
+		{"newer", Point{Text: "b", Time: later}, true},
+		{"same value", Point{Text: "a", Time: later}, false},
+		{"older", Point{Text: "b", Time: now.Add(-time.Second)}, false},
+		{"same time", Point{Text: "b", Time: now}, false},
+		{"deleted", Point{Text: "b", Time: later, Tombstone: 1}, false},
+	}
+
+	for _, test := range tests {
+		d := test.desired
+		d.Type = PointTypeDesired
+		d.Key = reported.TypeKey()
+
+		shadows := Points{reported, d}.Shadows()
+		if len(shadows) != 1 {
+			t.Fatalf("%v: expected 1 shadow, got %v", test.name, len(shadows))
+		}
+
+		if shadows[0].Reported.Text != "a" {
+			t.Errorf("%v: reported point not found", test.name)
+		}
+
+		if shadows[0].Pending() != test.pending {
+			t.Errorf("%v: expected pending %v", test.name, test.pending)
+		}
+	}
+
+	d := DesiredPoint(Point{Type: "value", Key: "3", Value: 2, Time: later})
+	pending := Points{d}.Pending()
+	if len(pending) != 1 || pending[0].Type != "value" || pending[0].Key != "3" {
+		t.Error("Expected desired point without reported point to be pending: ",
+			pending)
+	}
+}
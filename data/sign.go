@@ -0,0 +1,286 @@
+package data
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// signatureNonceLen is the length of the random nonce in the data of
+// signature points, which is used to reject replayed messages
+const signatureNonceLen = 16
+
+// signedBytes returns the message that is signed for points written to a
+// node. Only points with a type in types are included. Fields are encoded as
+// they are sent on the wire, so signatures still verify after points are
+// decoded.
+func signedBytes(nodeID string, signTime time.Time, nonce []byte, types []string,
+	points Points) []byte {
+	var b bytes.Buffer
+
+	str := func(s string) {
+		binary.Write(&b, binary.BigEndian, uint32(len(s)))
+		b.WriteString(s)
+	}
+
+	num := func(v uint64) {
+		binary.Write(&b, binary.BigEndian, v)
+	}
+
+	str(nodeID)
+	num(uint64(signTime.UnixNano()))
+	str(string(nonce))
+	str(strings.Join(types, ","))
+
+	covered := make(map[string]bool, len(types))
+	for _, t := range types {
+		covered[t] = true
+	}
+
+	for _, p := range points {
+		if p.Type == PointTypeSignature || !covered[p.Type] {
+			continue
+		}
+
+		str(p.Type)
+		str(p.Key)
+		num(uint64(p.Time.UnixNano()))
+		// values are float32 in the protobuf encoding
+		num(uint64(math.Float32bits(float32(p.Index))))
+		num(uint64(math.Float32bits(float32(p.Value))))
+		str(p.Text)
+		str(string(p.Data))
+		num(uint64(p.Tombstone))
+		str(p.Origin)
+		num(uint64(p.TTL))
+	}
+
+	return b.Bytes()
+}
+
+// SignPoints signs points written to a node with an Ed25519 key and returns
+// the points with a signature point added. Only points with a type in
+// pointTypes are signed, or all points if pointTypes is nil. The signature
+// covers points of these types, so the receiver can add points of other
+// types (for example command states) and the signature still verifies when
+// the points are forwarded. The point key of the signature point is keyID,
+// which identifies the public key to verify it with, and the data is a random
+// nonce followed by the comma separated signed point types. Point times must
+// be set before signing.
+func SignPoints(nodeID string, points Points, pointTypes map[string]bool,
+	keyID string, key ed25519.PrivateKey) Points {
+	typeMap := make(map[string]bool)
+	for _, p := range points {
+		if p.Type != PointTypeSignature && (pointTypes == nil || pointTypes[p.Type]) {
+			typeMap[p.Type] = true
+		}
+	}
+
+	types := make([]string, 0, len(typeMap))
+	for t := range typeMap {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+
+	nonce := make([]byte, signatureNonceLen)
+	_, err := rand.Read(nonce)
+	if err != nil {
+		// the signature will not verify without a nonce
+		log.Println("Error generating signature nonce: ", err)
+		nonce = nil
+	}
+
+	now := time.Now()
+	sig := ed25519.Sign(key, signedBytes(nodeID, now, nonce, types, points))
+
+	ret := make(Points, len(points), len(points)+1)
+	copy(ret, points)
+
+	return append(ret, Point{
+		Time: now,
+		Type: PointTypeSignature,
+		Key:  keyID,
+		Text: base64.StdEncoding.EncodeToString(sig),
+		Data: append(nonce, []byte(strings.Join(types, ","))...),
+	})
+}
+
+// NonceCache records the nonces of signatures that have been accepted, so
+// that a signed message is only accepted once. Nonces are kept until the
+// signature is too old to be accepted.
+type NonceCache struct {
+	lock   sync.Mutex
+	nonces map[string]time.Time
+	pruned time.Time
+}
+
+// NewNonceCache creates a NonceCache
+func NewNonceCache() *NonceCache {
+	return &NonceCache{nonces: make(map[string]time.Time)}
+}
+
+// use records a nonce and returns false if it was already used. Nonces of
+// signatures older than maxAge are removed.
+func (c *NonceCache) use(nonce []byte, signTime time.Time, maxAge time.Duration,
+	now time.Time) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if now.Sub(c.pruned) > maxAge {
+		for n, t := range c.nonces {
+			if now.Sub(t) > maxAge {
+				delete(c.nonces, n)
+			}
+		}
+		c.pruned = now
+	}
+
+	if _, ok := c.nonces[string(nonce)]; ok {
+		return false
+	}
+
+	c.nonces[string(nonce)] = signTime
+	return true
+}
+
+// VerifyPoints checks that points written to a node have a signature from
+// one of keys, which are indexed by key ID, and that the signature covers
+// all the points with a type in pointTypes. The signature must be less than
+// maxAge old, and its nonce must not be in nonces, so messages can't be
+// replayed. The nonce is added to nonces if the signature is valid.
+func VerifyPoints(nodeID string, points Points, pointTypes map[string]bool,
+	keys map[string]ed25519.PublicKey, maxAge time.Duration, now time.Time,
+	nonces *NonceCache) error {
+	found := false
+
+	for _, p := range points {
+		if p.Type != PointTypeSignature {
+			continue
+		}
+
+		found = true
+
+		key, ok := keys[p.Key]
+		if !ok {
+			continue
+		}
+
+		sig, err := base64.StdEncoding.DecodeString(p.Text)
+		if err != nil {
+			continue
+		}
+
+		if len(p.Data) < signatureNonceLen {
+			continue
+		}
+
+		nonce := p.Data[:signatureNonceLen]
+		var types []string
+		if len(p.Data) > signatureNonceLen {
+			types = strings.Split(string(p.Data[signatureNonceLen:]), ",")
+		}
+
+		if !ed25519.Verify(key, signedBytes(nodeID, p.Time, nonce, types, points), sig) {
+			continue
+		}
+
+		covered := make(map[string]bool, len(types))
+		for _, t := range types {
+			covered[t] = true
+		}
+
+		for _, pc := range points {
+			if pointTypes[pc.Type] && !covered[pc.Type] {
+				return fmt.Errorf("signature from %v does not cover %v points",
+					p.Key, pc.Type)
+			}
+		}
+
+		age := now.Sub(p.Time)
+		if age > maxAge || age < -maxAge {
+			return fmt.Errorf("signature from %v is too old: %v", p.Key, age)
+		}
+
+		if !nonces.use(nonce, p.Time, maxAge, now) {
+			return fmt.Errorf("signature from %v was already used", p.Key)
+		}
+
+		return nil
+	}
+
+	if !found {
+		return errors.New("points are not signed")
+	}
+
+	return errors.New("points do not have a valid signature from a trusted key")
+}
+
+// SigningPolicy returns the signing policy in the points of a root node.
+// Points with a type in the signedPointTypes point (comma separated) must be
+// signed by one of the signingKey points, where the point key is the key ID
+// and the text is the base64 encoded Ed25519 public key. If any point types
+// are signed, changes to the policy must also be signed.
+func SigningPolicy(points Points) (map[string]bool, map[string]ed25519.PublicKey) {
+	pointTypes := make(map[string]bool)
+	keys := make(map[string]ed25519.PublicKey)
+
+	for _, p := range points {
+		if p.Tombstone%2 == 1 {
+			continue
+		}
+
+		switch p.Type {
+		case PointTypeSignedPointTypes:
+			for _, t := range strings.Split(p.Text, ",") {
+				if t = strings.TrimSpace(t); t != "" {
+					pointTypes[t] = true
+				}
+			}
+		case PointTypeSigningKey:
+			key, err := DecodeSigningKey(p.Text)
+			if err != nil {
+				log.Printf("Error decoding signing key %v: %v\n", p.Key, err)
+				continue
+			}
+			keys[p.Key] = key
+		}
+	}
+
+	if len(pointTypes) > 0 {
+		// the policy itself can only be changed with a signed message
+		pointTypes[PointTypeSignedPointTypes] = true
+		pointTypes[PointTypeSigningKey] = true
+	}
+
+	return pointTypes, keys
+}
+
+// EncodeSigningKey returns the base64 encoding of a public key, as used in
+// signingKey points
+func EncodeSigningKey(key ed25519.PublicKey) string {
+	return base64.StdEncoding.EncodeToString(key)
+}
+
+// DecodeSigningKey decodes a base64 encoded public key
+func DecodeSigningKey(s string) (ed25519.PublicKey, error) {
+	key, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("public key must be %v bytes", ed25519.PublicKeySize)
+	}
+
+	return ed25519.PublicKey(key), nil
+}
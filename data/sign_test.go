@@ -0,0 +1,178 @@
+package data
+
+import (
+	"crypto/ed25519"
+	"testing"
+	"time"
+)
+
+func TestSignPoints(t *testing.T) {
+	pub, key, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal("Error generating key: ", err)
+	}
+
+	keys := map[string]ed25519.PublicKey{"dev1": pub}
+	now := time.Now()
+
+	points := Points{
+		{Time: now, Type: PointTypeValueSet, Value: 0.1, Origin: "user1"},
+	}
+
+	valueSet := map[string]bool{PointTypeValueSet: true}
+
+	signed := SignPoints("out1", points, valueSet, "dev1", key)
+	if len(signed) != 2 || len(points) != 1 {
+		t.Fatal("Signature point not added: ", signed)
+	}
+
+	// signatures verify after points are sent
+	d, err := signed.ToPb()
+	if err != nil {
+		t.Fatal("Error encoding points: ", err)
+	}
+
+	decoded, err := PbDecodePoints(d)
+	if err != nil {
+		t.Fatal("Error decoding points: ", err)
+	}
+
+	verify := func(nodeID string, points Points, keys map[string]ed25519.PublicKey,
+		now time.Time) error {
+		return VerifyPoints(nodeID, points, valueSet, keys, time.Minute, now,
+			NewNonceCache())
+	}
+
+	err = verify("out1", decoded, keys, now)
+	if err != nil {
+		t.Fatal("Signature did not verify: ", err)
+	}
+
+	err = verify("out2", decoded, keys, now)
+	if err == nil {
+		t.Error("Signature for another node verified")
+	}
+
+	tampered := make(Points, len(decoded))
+	copy(tampered, decoded)
+	tampered[0].Value = 1
+	err = verify("out1", tampered, keys, now)
+	if err == nil {
+		t.Error("Tampered points verified")
+	}
+
+	err = verify("out1", decoded, keys, now.Add(2*time.Minute))
+	if err == nil {
+		t.Error("Old signature verified")
+	}
+
+	err = verify("out1", decoded, map[string]ed25519.PublicKey{"dev2": pub}, now)
+	if err == nil {
+		t.Error("Signature from unknown key ID verified")
+	}
+
+	err = verify("out1", points, keys, now)
+	if err == nil {
+		t.Error("Unsigned points verified")
+	}
+
+	// points of other types can be added, for example by the store
+	added := append(Points{{Time: now, Type: PointTypeValue, Value: 2}}, decoded...)
+	err = verify("out1", added, keys, now)
+	if err != nil {
+		t.Error("Signature did not verify with other points added: ", err)
+	}
+
+	// but points of signed types can't
+	added = append(Points{{Time: now, Type: PointTypeValueSet, Value: 2}}, decoded...)
+	err = verify("out1", added, keys, now)
+	if err == nil {
+		t.Error("Signature verified with a signed point added")
+	}
+
+	// the signature must cover all the signed point types
+	signed = SignPoints("out1", points, map[string]bool{}, "dev1", key)
+	err = verify("out1", signed, keys, now)
+	if err == nil {
+		t.Error("Signature that does not cover valueSet verified")
+	}
+}
+
+func TestVerifyPointsReplay(t *testing.T) {
+	pub, key, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal("Error generating key: ", err)
+	}
+
+	keys := map[string]ed25519.PublicKey{"dev1": pub}
+	valueSet := map[string]bool{PointTypeValueSet: true}
+	nonces := NewNonceCache()
+	now := time.Now()
+
+	points := Points{{Time: now, Type: PointTypeValueSet, Value: 0.1}}
+	signed := SignPoints("out1", points, valueSet, "dev1", key)
+
+	err = VerifyPoints("out1", signed, valueSet, keys, time.Minute, now, nonces)
+	if err != nil {
+		t.Fatal("Signature did not verify: ", err)
+	}
+
+	err = VerifyPoints("out1", signed, valueSet, keys, time.Minute, now, nonces)
+	if err == nil {
+		t.Fatal("Replayed signature verified")
+	}
+
+	// the same points signed again have a new nonce
+	signed = SignPoints("out1", points, valueSet, "dev1", key)
+	err = VerifyPoints("out1", signed, valueSet, keys, time.Minute, now, nonces)
+	if err != nil {
+		t.Fatal("Second signature did not verify: ", err)
+	}
+
+	// nonces are removed once signatures are too old to be accepted
+	nonces.use([]byte("x"), now, time.Minute, now)
+	nonces.use([]byte("y"), now, time.Minute, now.Add(2*time.Minute))
+	if len(nonces.nonces) != 1 {
+		t.Error("Old nonces were not removed: ", len(nonces.nonces))
+	}
+}
+
+func TestSigningPolicy(t *testing.T) {
+	pub, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal("Error generating key: ", err)
+	}
+
+	pointTypes, keys := SigningPolicy(Points{
+		{Type: PointTypeSignedPointTypes, Text: "valueSet, value"},
+		{Type: PointTypeSigningKey, Key: "k1", Text: EncodeSigningKey(pub)},
+		{Type: PointTypeSigningKey, Key: "k2", Text: "bad"},
+		{Type: PointTypeSigningKey, Key: "k3", Text: EncodeSigningKey(pub), Tombstone: 1},
+	})
+
+	if len(pointTypes) != 4 || !pointTypes[PointTypeValue] ||
+		!pointTypes[PointTypeSigningKey] {
+		t.Error("Wrong point types: ", pointTypes)
+	}
+
+	if len(keys) != 1 || !keys["k1"].Equal(pub) {
+		t.Error("Wrong keys: ", keys)
+	}
+}
+
+func TestDecodeSigningKey(t *testing.T) {
+	pub, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal("Error generating key: ", err)
+	}
+
+	key, err := DecodeSigningKey(EncodeSigningKey(pub))
+	if err != nil || !key.Equal(pub) {
+		t.Fatal("Key did not round trip: ", err)
+	}
+
+	_, err = DecodeSigningKey("c2hvcnQ=")
+	if err == nil {
+		t.Error("Short key decoded")
+	}
+}
@@ -0,0 +1,48 @@
+package data
+
+import (
+	"fmt"
+	"time"
+)
+
+// define store problem types found by a store verify
+const (
+	// the stored edge hash does not match the recomputed hash
+	StoreProblemHash = "hash"
+	// the edge points to a node that does not exist, or from a parent that
+	// does not exist
+	StoreProblemOrphanEdge = "orphanEdge"
+	// the node can't be reached from the root node
+	StoreProblemOrphanNode = "orphanNode"
+	// the root node is deleted, or the node type point is deleted
+	StoreProblemTombstone = "tombstone"
+)
+
+// StoreProblem describes one problem found by a store verify. Repaired is set
+// if the problem was fixed.
+type StoreProblem struct {
+	Type        string `json:"type"`
+	NodeID      string `json:"nodeId,omitempty"`
+	EdgeID      string `json:"edgeId,omitempty"`
+	Description string `json:"description"`
+	Repaired    bool   `json:"repaired"`
+}
+
+func (p StoreProblem) String() string {
+	ret := fmt.Sprintf("%v: %v", p.Type, p.Description)
+	if p.Repaired {
+		ret += " (repaired)"
+	}
+	return ret
+}
+
+// StoreVerifyReport is returned by a store verify. Nodes and Edges are the
+// number of nodes and edges checked. Error is set if the verify failed.
+type StoreVerifyReport struct {
+	Time     time.Time      `json:"time"`
+	Repair   bool           `json:"repair"`
+	Nodes    int            `json:"nodes"`
+	Edges    int            `json:"edges"`
+	Problems []StoreProblem `json:"problems"`
+	Error    string         `json:"error,omitempty"`
+}
@@ -0,0 +1,502 @@
+package data
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PointMarshaler is implemented by types that encode themselves to a point.
+// Encode sets the point type and key after MarshalPoint returns.
+type PointMarshaler interface {
+	MarshalPoint() (Point, error)
+}
+
+// PointUnmarshaler is implemented by types that decode themselves from a
+// point.
+type PointUnmarshaler interface {
+	UnmarshalPoint(Point) error
+}
+
+var (
+	durationType         = reflect.TypeOf(time.Duration(0))
+	timeType             = reflect.TypeOf(time.Time{})
+	pointMarshalerType   = reflect.TypeOf((*PointMarshaler)(nil)).Elem()
+	pointUnmarshalerType = reflect.TypeOf((*PointUnmarshaler)(nil)).Elem()
+	textMarshalerType    = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	textUnmarshalerType  = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// pointTag is a parsed point or edgepoint struct tag. The tag is the point
+// type followed by optional comma separated options:
+//
+//	key=<key>   only points with this key are used for the field
+//	type=text   the field is stored in the point Text
+//	type=value  the field is stored in the point Value
+//	omitempty   Encode skips the field if it has the zero value
+//
+// By default strings, times, and TextMarshalers are stored in Text and
+// everything else in Value. Map fields use the point key as the map key and
+// slice fields use it as the index.
+type pointTag struct {
+	typ       string
+	key       string
+	hasKey    bool
+	text      bool
+	value     bool
+	omitEmpty bool
+}
+
+func parsePointTag(tag string) (pointTag, error) {
+	opts := strings.Split(tag, ",")
+	ret := pointTag{typ: opts[0]}
+
+	for _, o := range opts[1:] {
+		switch {
+		case strings.HasPrefix(o, "key="):
+			ret.key = strings.TrimPrefix(o, "key=")
+			ret.hasKey = true
+		case o == "type=text":
+			ret.text = true
+		case o == "type=value":
+			ret.value = true
+		case o == "omitempty":
+			ret.omitEmpty = true
+		default:
+			return ret, fmt.Errorf("Unknown option %v in point tag %v", o, tag)
+		}
+	}
+
+	return ret, nil
+}
+
+// tagField is a struct field with a point or edgepoint tag
+type tagField struct {
+	tag pointTag
+	v   reflect.Value
+}
+
+// tagFields maps point types to fields with that point type
+type tagFields map[string][]tagField
+
+func (tf tagFields) add(tag string, v reflect.Value) error {
+	t, err := parsePointTag(tag)
+	if err != nil {
+		return err
+	}
+
+	tf[t.typ] = append(tf[t.typ], tagField{tag: t, v: v})
+	return nil
+}
+
+// set sets all fields that match p. Points that do not convert to the field
+// type are skipped so one bad point does not keep a node from decoding.
+func (tf tagFields) set(p Point) error {
+	for _, f := range tf[p.Type] {
+		if f.tag.hasKey && f.tag.key != p.Key {
+			continue
+		}
+
+		err := setField(p, f.v, f.tag)
+		if err != nil {
+			var pve errPointValue
+			if errors.As(err, &pve) {
+				log.Printf("Skipping %v point with key %v: %v\n", p.Type, p.Key, err)
+				continue
+			}
+			return fmt.Errorf("Error setting %v: %w", p.Type, err)
+		}
+	}
+
+	return nil
+}
+
+// errPointValue is returned when a point can't be converted to a supported
+// field type
+type errPointValue struct {
+	err error
+}
+
+func (e errPointValue) Error() string {
+	return e.err.Error()
+}
+
+func isCollection(t reflect.Type) bool {
+	if implements(t, pointUnmarshalerType) || implements(t, textUnmarshalerType) {
+		return false
+	}
+
+	return t.Kind() == reflect.Map ||
+		(t.Kind() == reflect.Slice && t.Elem().Kind() != reflect.Uint8)
+}
+
+func implements(t, i reflect.Type) bool {
+	return t.Implements(i) || reflect.PtrTo(t).Implements(i)
+}
+
+// setField sets struct field v from point p
+func setField(p Point, v reflect.Value, tag pointTag) error {
+	if !isCollection(v.Type()) {
+		return setScalar(p, v, tag)
+	}
+
+	deleted := p.Tombstone%2 == 1
+
+	if v.Kind() == reflect.Map {
+		k, err := mapKey(p.Key, v.Type().Key())
+		if err != nil {
+			return err
+		}
+
+		if deleted {
+			if !v.IsNil() {
+				v.SetMapIndex(k, reflect.Value{})
+			}
+			return nil
+		}
+
+		e := reflect.New(v.Type().Elem()).Elem()
+		if !v.IsNil() {
+			if cur := v.MapIndex(k); cur.IsValid() {
+				e.Set(cur)
+			}
+		}
+
+		err = setScalar(p, e, tag)
+		if err != nil {
+			return err
+		}
+
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+		v.SetMapIndex(k, e)
+		return nil
+	}
+
+	// slice, the key is the index
+	i := 0
+	if p.Key != "" {
+		var err error
+		i, err = strconv.Atoi(p.Key)
+		if err != nil || i < 0 {
+			return errPointValue{fmt.Errorf("Invalid slice index: %v", p.Key)}
+		}
+	}
+
+	if i >= v.Len() {
+		if deleted {
+			return nil
+		}
+		v.Set(reflect.AppendSlice(v, reflect.MakeSlice(v.Type(), i+1-v.Len(), i+1-v.Len())))
+	}
+
+	if deleted {
+		v.Index(i).Set(reflect.Zero(v.Type().Elem()))
+		if i == v.Len()-1 {
+			v.Set(v.Slice(0, i))
+		}
+		return nil
+	}
+
+	return setScalar(p, v.Index(i), tag)
+}
+
+func mapKey(key string, t reflect.Type) (reflect.Value, error) {
+	k := reflect.New(t).Elem()
+	switch t.Kind() {
+	case reflect.String:
+		k.SetString(key)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(key, 10, 64)
+		if err != nil {
+			return k, errPointValue{fmt.Errorf("Invalid map key: %v", key)}
+		}
+		k.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		i, err := strconv.ParseUint(key, 10, 64)
+		if err != nil {
+			return k, errPointValue{fmt.Errorf("Invalid map key: %v", key)}
+		}
+		k.SetUint(i)
+	default:
+		return k, fmt.Errorf("Unsupported map key type: %v", t)
+	}
+
+	return k, nil
+}
+
+// setScalar sets a single value v from point p
+func setScalar(p Point, v reflect.Value, tag pointTag) error {
+	if v.CanAddr() {
+		if u, ok := v.Addr().Interface().(PointUnmarshaler); ok {
+			err := u.UnmarshalPoint(p)
+			if err != nil {
+				return errPointValue{err}
+			}
+			return nil
+		}
+	}
+
+	switch v.Type() {
+	case durationType:
+		if tag.text {
+			d, err := time.ParseDuration(p.Text)
+			if err != nil {
+				return errPointValue{err}
+			}
+			v.SetInt(int64(d))
+		} else {
+			v.SetInt(int64(p.Value * float64(time.Second)))
+		}
+		return nil
+	case timeType:
+		if tag.value {
+			if p.Value == 0 {
+				v.Set(reflect.Zero(timeType))
+				return nil
+			}
+			sec := int64(p.Value)
+			nsec := int64((p.Value - float64(sec)) * 1e9)
+			v.Set(reflect.ValueOf(time.Unix(sec, nsec)))
+			return nil
+		}
+		if p.Text == "" {
+			v.Set(reflect.Zero(timeType))
+			return nil
+		}
+		t, err := time.Parse(time.RFC3339Nano, p.Text)
+		if err != nil {
+			return errPointValue{err}
+		}
+		v.Set(reflect.ValueOf(t))
+		return nil
+	}
+
+	if v.CanAddr() {
+		if u, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+			err := u.UnmarshalText([]byte(p.Text))
+			if err != nil {
+				return errPointValue{err}
+			}
+			return nil
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		if tag.value {
+			v.SetString(strconv.FormatFloat(p.Value, 'f', -1, 64))
+		} else {
+			v.SetString(p.Text)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if tag.text {
+			i, err := strconv.ParseInt(p.Text, 0, 64)
+			if err != nil {
+				return errPointValue{err}
+			}
+			v.SetInt(i)
+		} else {
+			v.SetInt(int64(p.Value))
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if tag.text {
+			i, err := strconv.ParseUint(p.Text, 0, 64)
+			if err != nil {
+				return errPointValue{err}
+			}
+			v.SetUint(i)
+		} else {
+			v.SetUint(uint64(p.Value))
+		}
+	case reflect.Float32, reflect.Float64:
+		if tag.text {
+			f, err := strconv.ParseFloat(p.Text, 64)
+			if err != nil {
+				return errPointValue{err}
+			}
+			v.SetFloat(f)
+		} else {
+			v.SetFloat(p.Value)
+		}
+	case reflect.Bool:
+		if tag.text {
+			b, err := strconv.ParseBool(p.Text)
+			if err != nil {
+				return errPointValue{err}
+			}
+			v.SetBool(b)
+		} else {
+			v.SetBool(FloatToBool(p.Value))
+		}
+	default:
+		return fmt.Errorf("Unsupported field type: %v", v.Type())
+	}
+
+	return nil
+}
+
+// fieldPoints returns the points for struct field v
+func fieldPoints(v reflect.Value, tag pointTag) (Points, error) {
+	if tag.omitEmpty && isEmpty(v) {
+		return nil, nil
+	}
+
+	if !isCollection(v.Type()) {
+		p, err := scalarPoint(v, tag)
+		if err != nil {
+			return nil, err
+		}
+		p.Type = tag.typ
+		if tag.hasKey {
+			p.Key = tag.key
+		}
+		return Points{p}, nil
+	}
+
+	var ret Points
+
+	if v.Kind() == reflect.Map {
+		keys := v.MapKeys()
+		keyStrings := make(map[reflect.Value]string, len(keys))
+		for _, k := range keys {
+			keyStrings[k] = fmt.Sprint(k.Interface())
+		}
+
+		sort.Slice(keys, func(i, j int) bool {
+			ki, kj := keys[i], keys[j]
+			switch ki.Kind() {
+			case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+				return ki.Int() < kj.Int()
+			case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+				return ki.Uint() < kj.Uint()
+			}
+			return keyStrings[ki] < keyStrings[kj]
+		})
+
+		for _, k := range keys {
+			e := reflect.New(v.Type().Elem()).Elem()
+			e.Set(v.MapIndex(k))
+			p, err := scalarPoint(e, tag)
+			if err != nil {
+				return nil, err
+			}
+			p.Type = tag.typ
+			p.Key = keyStrings[k]
+			ret = append(ret, p)
+		}
+
+		return ret, nil
+	}
+
+	for i := 0; i < v.Len(); i++ {
+		p, err := scalarPoint(v.Index(i), tag)
+		if err != nil {
+			return nil, err
+		}
+		p.Type = tag.typ
+		p.Key = strconv.Itoa(i)
+		ret = append(ret, p)
+	}
+
+	return ret, nil
+}
+
+func isEmpty(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Map, reflect.Slice:
+		return v.Len() == 0
+	}
+
+	return v.IsZero()
+}
+
+// scalarPoint returns a point with the Value or Text set from v
+func scalarPoint(v reflect.Value, tag pointTag) (Point, error) {
+	if m, ok := marshaler(v, pointMarshalerType); ok {
+		return m.Interface().(PointMarshaler).MarshalPoint()
+	}
+
+	switch v.Type() {
+	case durationType:
+		d := time.Duration(v.Int())
+		if tag.text {
+			return Point{Text: d.String()}, nil
+		}
+		return Point{Value: d.Seconds()}, nil
+	case timeType:
+		t := v.Interface().(time.Time)
+		if tag.value {
+			if t.IsZero() {
+				return Point{}, nil
+			}
+			return Point{Value: float64(t.UnixNano()) / 1e9}, nil
+		}
+		if t.IsZero() {
+			return Point{}, nil
+		}
+		return Point{Text: t.Format(time.RFC3339Nano)}, nil
+	}
+
+	if m, ok := marshaler(v, textMarshalerType); ok {
+		text, err := m.Interface().(encoding.TextMarshaler).MarshalText()
+		if err != nil {
+			return Point{}, err
+		}
+		return Point{Text: string(text)}, nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		if tag.value {
+			f, err := strconv.ParseFloat(v.String(), 64)
+			if err != nil {
+				return Point{}, err
+			}
+			return Point{Value: f}, nil
+		}
+		return Point{Text: v.String()}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if tag.text {
+			return Point{Text: strconv.FormatInt(v.Int(), 10)}, nil
+		}
+		return Point{Value: float64(v.Int())}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if tag.text {
+			return Point{Text: strconv.FormatUint(v.Uint(), 10)}, nil
+		}
+		return Point{Value: float64(v.Uint())}, nil
+	case reflect.Float32, reflect.Float64:
+		if tag.text {
+			return Point{Text: strconv.FormatFloat(v.Float(), 'f', -1, 64)}, nil
+		}
+		return Point{Value: v.Float()}, nil
+	case reflect.Bool:
+		if tag.text {
+			return Point{Text: strconv.FormatBool(v.Bool())}, nil
+		}
+		return Point{Value: BoolToFloat(v.Bool())}, nil
+	default:
+		return Point{}, fmt.Errorf("Unhandled type: %v", v.Type())
+	}
+}
+
+// marshaler returns v, or a pointer to v, if it implements interface i
+func marshaler(v reflect.Value, i reflect.Type) (reflect.Value, bool) {
+	if v.Type().Implements(i) {
+		return v, true
+	}
+
+	if v.CanAddr() && v.Addr().Type().Implements(i) {
+		return v.Addr(), true
+	}
+
+	return v, false
+}
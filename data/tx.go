@@ -0,0 +1,71 @@
+package data
+
+import (
+	"github.com/simpleiot/simpleiot/internal/pb"
+	"google.golang.org/protobuf/proto"
+)
+
+// TxWrite is a set of node or edge points written as part of a
+// transaction. If Edge is set, the points are edge points for the edge
+// between NodeID and ParentID.
+type TxWrite struct {
+	NodeID   string
+	ParentID string
+	Edge     bool
+	Points   Points
+}
+
+// PbEncodeTx encodes a transaction into protobuf
+func PbEncodeTx(writes []TxWrite) ([]byte, error) {
+	pbWrites := make([]*pb.TxWrite, len(writes))
+
+	for i, w := range writes {
+		pbPoints := make([]*pb.Point, len(w.Points))
+		for j, p := range w.Points {
+			pPb, err := p.ToPb()
+			if err != nil {
+				return []byte{}, err
+			}
+			pbPoints[j] = &pPb
+		}
+
+		pbWrites[i] = &pb.TxWrite{
+			NodeID:   w.NodeID,
+			ParentID: w.ParentID,
+			Edge:     w.Edge,
+			Points:   pbPoints,
+		}
+	}
+
+	return proto.Marshal(&pb.Tx{Writes: pbWrites})
+}
+
+// PbDecodeTx decodes a protobuf encoded transaction
+func PbDecodeTx(data []byte) ([]TxWrite, error) {
+	pbTx := &pb.Tx{}
+	err := proto.Unmarshal(data, pbTx)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]TxWrite, len(pbTx.Writes))
+
+	for i, wPb := range pbTx.Writes {
+		points := make(Points, len(wPb.Points))
+		for j, pPb := range wPb.Points {
+			points[j], err = PbToPoint(pPb)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		ret[i] = TxWrite{
+			NodeID:   wPb.NodeID,
+			ParentID: wPb.ParentID,
+			Edge:     wPb.Edge,
+			Points:   points,
+		}
+	}
+
+	return ret, nil
+}
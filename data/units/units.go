@@ -0,0 +1,99 @@
+// Package units converts values between units of the same quantity.
+//
+// By convention, a units point on a node gives the units of the value point
+// of that node. Nodes that read devices that report in fixed units (for
+// example a 1-wire temperature sensor in °C) convert the values to the units
+// declared on the node.
+package units
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrUnknown is returned if units are not known
+var ErrUnknown = errors.New("unknown units")
+
+// quantities
+const (
+	temperature = "temperature"
+	pressure    = "pressure"
+	power       = "power"
+)
+
+// unit converts a value to the base unit of a quantity with
+// value*scale + offset
+type unit struct {
+	quantity string
+	scale    float64
+	offset   float64
+}
+
+var known = map[string]unit{
+	"C":   {temperature, 1, 0},
+	"F":   {temperature, 5.0 / 9, -32 * 5.0 / 9},
+	"K":   {temperature, 1, -273.15},
+	"Pa":  {pressure, 1, 0},
+	"kPa": {pressure, 1000, 0},
+	"bar": {pressure, 100000, 0},
+	"psi": {pressure, 6894.757293168, 0},
+	"W":   {power, 1, 0},
+	"kW":  {power, 1000, 0},
+}
+
+// other spellings of units
+var aliases = map[string]string{
+	"°C":      "C",
+	"degC":    "C",
+	"celsius": "C",
+	"°F":      "F",
+	"degF":    "F",
+	"kpa":     "kPa",
+	"pa":      "Pa",
+	"PSI":     "psi",
+	"w":       "W",
+	"kw":      "kW",
+}
+
+// Normalize returns the name used by this package for units, or u if the
+// units are not known
+func Normalize(u string) string {
+	if a, ok := aliases[u]; ok {
+		return a
+	}
+	return u
+}
+
+// Known returns true if u can be converted
+func Known(u string) bool {
+	_, ok := known[Normalize(u)]
+	return ok
+}
+
+// Convert converts v from units from to units to. If from or to are blank
+// or the same, v is returned unchanged. An error is returned if the units
+// are unknown or not of the same quantity.
+func Convert(v float64, from, to string) (float64, error) {
+	from, to = Normalize(from), Normalize(to)
+	if from == "" || to == "" || from == to {
+		return v, nil
+	}
+
+	f, ok := known[from]
+	if !ok {
+		return v, fmt.Errorf("%w: %v", ErrUnknown, from)
+	}
+
+	t, ok := known[to]
+	if !ok {
+		return v, fmt.Errorf("%w: %v", ErrUnknown, to)
+	}
+
+	if f.quantity != t.quantity {
+		return v, fmt.Errorf("can't convert %v (%v) to %v (%v)", from,
+			f.quantity, to, t.quantity)
+	}
+
+	base := v*f.scale + f.offset
+	return (base - t.offset) / t.scale, nil
+}
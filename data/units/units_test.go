@@ -0,0 +1,48 @@
+package units
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		v        float64
+		from, to string
+		exp      float64
+	}{
+		{100, "C", "F", 212},
+		{-40, "°F", "°C", -40},
+		{0, "C", "K", 273.15},
+		{14.6959, "psi", "kPa", 101.325},
+		{1, "bar", "Pa", 100000},
+		{2500, "W", "kW", 2.5},
+		{3, "kW", "kW", 3},
+		{3, "", "kW", 3},
+		{3, "gal", "", 3},
+	}
+
+	for _, test := range tests {
+		v, err := Convert(test.v, test.from, test.to)
+		if err != nil {
+			t.Errorf("%v %v to %v: %v", test.v, test.from, test.to, err)
+			continue
+		}
+
+		if math.Abs(v-test.exp) > 0.001 {
+			t.Errorf("%v %v to %v: expected %v, got %v", test.v, test.from,
+				test.to, test.exp, v)
+		}
+	}
+
+	_, err := Convert(1, "gal", "L")
+	if !errors.Is(err, ErrUnknown) {
+		t.Error("Expected unknown units error, got: ", err)
+	}
+
+	_, err = Convert(1, "C", "psi")
+	if err == nil {
+		t.Error("Expected error converting temperature to pressure")
+	}
+}
@@ -1,2 +1,3 @@
-// Package file contains file utilties.
+// Package file contains file utilties and file sources (local, FTP, and SFTP)
+// used to ingest files.
 package file
@@ -0,0 +1,239 @@
+package file
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// encryptMagic identifies data encrypted by Encrypt before streams were
+// supported. The format is: magic (8 bytes), scrypt salt (16 bytes), GCM
+// nonce (12 bytes), ciphertext. It can still be decrypted.
+var encryptMagic = []byte("SIOTENC1")
+
+// encryptStreamMagic identifies data encrypted by EncryptWriter. The format
+// is: magic (8 bytes), scrypt salt (16 bytes), nonce prefix (7 bytes), and
+// chunks of encryptChunk bytes of plain text, each sealed with GCM. The nonce
+// of a chunk is the prefix, the chunk index (4 bytes big endian), and 1 for
+// the last chunk or 0 otherwise, so chunks cannot be reordered, dropped, or
+// truncated.
+var encryptStreamMagic = []byte("SIOTENC2")
+
+const encryptSaltLen = 16
+
+const encryptNoncePrefixLen = 7
+
+const encryptChunk = 64 * 1024
+
+func encryptKey(passphrase string, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(passphrase), salt, 32768, 8, 1, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+func encryptChunkNonce(prefix []byte, index uint32, last bool) []byte {
+	nonce := make([]byte, 12)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[encryptNoncePrefixLen:], index)
+	if last {
+		nonce[11] = 1
+	}
+	return nonce
+}
+
+// EncryptWriter encrypts a stream with AES-256-GCM using a key derived from
+// a passphrase with scrypt. Close must be called to write the last chunk.
+type EncryptWriter struct {
+	w      io.Writer
+	gcm    cipher.AEAD
+	prefix []byte
+	index  uint32
+	buf    []byte
+	closed bool
+}
+
+// NewEncryptWriter writes the header of an encrypted stream to w
+func NewEncryptWriter(passphrase string, w io.Writer) (*EncryptWriter, error) {
+	salt := make([]byte, encryptSaltLen+encryptNoncePrefixLen)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := encryptKey(passphrase, salt[:encryptSaltLen])
+	if err != nil {
+		return nil, fmt.Errorf("Error creating cipher: %w", err)
+	}
+
+	_, err = w.Write(append(append([]byte{}, encryptStreamMagic...), salt...))
+	if err != nil {
+		return nil, err
+	}
+
+	return &EncryptWriter{
+		w:      w,
+		gcm:    gcm,
+		prefix: salt[encryptSaltLen:],
+		buf:    make([]byte, 0, encryptChunk+gcm.Overhead()),
+	}, nil
+}
+
+func (e *EncryptWriter) seal(last bool) error {
+	if e.index == 1<<32-1 {
+		return errors.New("encrypted stream is too long")
+	}
+
+	d := e.gcm.Seal(e.buf[:0], encryptChunkNonce(e.prefix, e.index, last),
+		e.buf, nil)
+	e.index++
+	e.buf = e.buf[:0]
+
+	_, err := e.w.Write(d)
+	return err
+}
+
+// Write encrypts d. Data is written to the underlying writer in chunks.
+func (e *EncryptWriter) Write(d []byte) (int, error) {
+	if e.closed {
+		return 0, errors.New("write to closed EncryptWriter")
+	}
+
+	n := len(d)
+
+	for len(d) > 0 {
+		// a full chunk is only sealed once more data is written, as the
+		// last chunk is sealed differently
+		if len(e.buf) == encryptChunk {
+			if err := e.seal(false); err != nil {
+				return n - len(d), err
+			}
+		}
+
+		c := copy(e.buf[len(e.buf):encryptChunk], d)
+		e.buf = e.buf[:len(e.buf)+c]
+		d = d[c:]
+	}
+
+	return n, nil
+}
+
+// Close writes the last chunk. It does not close the underlying writer.
+func (e *EncryptWriter) Close() error {
+	if e.closed {
+		return nil
+	}
+
+	e.closed = true
+	return e.seal(true)
+}
+
+// Encrypt encrypts data with AES-256-GCM using a key derived from
+// passphrase with scrypt (see EncryptWriter)
+func Encrypt(passphrase string, d []byte) ([]byte, error) {
+	var buf bytes.Buffer
+
+	w, err := NewEncryptWriter(passphrase, &buf)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = w.Write(d)
+	if err != nil {
+		return nil, err
+	}
+
+	err = w.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Decrypt decrypts data encrypted by Encrypt or EncryptWriter
+func Decrypt(passphrase string, d []byte) ([]byte, error) {
+	switch {
+	case bytes.HasPrefix(d, encryptMagic):
+		return decryptV1(passphrase, d[len(encryptMagic):])
+	case bytes.HasPrefix(d, encryptStreamMagic):
+		return decryptStream(passphrase, d[len(encryptStreamMagic):])
+	default:
+		return nil, errors.New("data is not encrypted")
+	}
+}
+
+func decryptV1(passphrase string, d []byte) ([]byte, error) {
+	if len(d) < encryptSaltLen {
+		return nil, errors.New("encrypted data is too short")
+	}
+
+	gcm, err := encryptKey(passphrase, d[:encryptSaltLen])
+	if err != nil {
+		return nil, fmt.Errorf("Error creating cipher: %w", err)
+	}
+
+	d = d[encryptSaltLen:]
+
+	if len(d) < gcm.NonceSize() {
+		return nil, errors.New("encrypted data is too short")
+	}
+
+	ret, err := gcm.Open(nil, d[:gcm.NonceSize()], d[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, fmt.Errorf("Error decrypting: %w", err)
+	}
+
+	return ret, nil
+}
+
+func decryptStream(passphrase string, d []byte) ([]byte, error) {
+	if len(d) < encryptSaltLen+encryptNoncePrefixLen {
+		return nil, errors.New("encrypted data is too short")
+	}
+
+	gcm, err := encryptKey(passphrase, d[:encryptSaltLen])
+	if err != nil {
+		return nil, fmt.Errorf("Error creating cipher: %w", err)
+	}
+
+	prefix := d[encryptSaltLen : encryptSaltLen+encryptNoncePrefixLen]
+	d = d[encryptSaltLen+encryptNoncePrefixLen:]
+
+	chunk := encryptChunk + gcm.Overhead()
+
+	var ret []byte
+
+	for index := uint32(0); ; index++ {
+		last := len(d) <= chunk
+		c := d
+		if !last {
+			c = d[:chunk]
+		}
+
+		ret, err = gcm.Open(ret, encryptChunkNonce(prefix, index, last), c, nil)
+		if err != nil {
+			return nil, fmt.Errorf("Error decrypting: %w", err)
+		}
+
+		if last {
+			return ret, nil
+		}
+
+		d = d[chunk:]
+	}
+}
@@ -0,0 +1,84 @@
+package file
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEncrypt(t *testing.T) {
+	enc, err := Encrypt("secret", []byte("archive data"))
+	if err != nil {
+		t.Fatal("Encrypt error: ", err)
+	}
+
+	d, err := Decrypt("secret", enc)
+	if err != nil {
+		t.Fatal("Decrypt error: ", err)
+	}
+
+	if string(d) != "archive data" {
+		t.Error("Decrypted data not correct: ", string(d))
+	}
+
+	_, err = Decrypt("wrong", enc)
+	if err == nil {
+		t.Error("Expected error with wrong passphrase")
+	}
+
+	_, err = Decrypt("secret", []byte("archive data"))
+	if err == nil {
+		t.Error("Expected error for unencrypted data")
+	}
+}
+
+func TestEncryptWriter(t *testing.T) {
+	for _, size := range []int{0, 1, encryptChunk, encryptChunk + 1, 3 * encryptChunk} {
+		d := make([]byte, size)
+		for i := range d {
+			d[i] = byte(i)
+		}
+
+		var buf bytes.Buffer
+
+		w, err := NewEncryptWriter("secret", &buf)
+		if err != nil {
+			t.Fatal("NewEncryptWriter error: ", err)
+		}
+
+		// write in odd sized pieces
+		for rest := d; len(rest) > 0; {
+			n := 1000
+			if n > len(rest) {
+				n = len(rest)
+			}
+
+			if _, err := w.Write(rest[:n]); err != nil {
+				t.Fatal("Write error: ", err)
+			}
+
+			rest = rest[n:]
+		}
+
+		if err := w.Close(); err != nil {
+			t.Fatal("Close error: ", err)
+		}
+
+		dec, err := Decrypt("secret", buf.Bytes())
+		if err != nil {
+			t.Fatalf("Decrypt error, size %v: %v", size, err)
+		}
+
+		if !bytes.Equal(dec, d) {
+			t.Errorf("Decrypted data not correct, size %v", size)
+		}
+
+		if size > encryptChunk {
+			// drop the last chunk
+			enc := buf.Bytes()
+			_, err := Decrypt("secret", enc[:len(enc)-(size%encryptChunk)-16])
+			if err == nil {
+				t.Errorf("Truncated data decrypted, size %v", size)
+			}
+		}
+	}
+}
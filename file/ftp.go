@@ -0,0 +1,255 @@
+package file
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FTPSource reads files from a FTP server directory
+type FTPSource struct {
+	conn    net.Conn
+	text    *textproto.Conn
+	host    string
+	dir     string
+	timeout time.Duration
+}
+
+// DialFTP logs into a FTP server and changes to dir. If no username is
+// given, anonymous login is used.
+func DialFTP(addr, dir string, opts SourceOptions) (*FTPSource, error) {
+	conn, err := net.DialTimeout("tcp", addr, opts.Timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	host, _, _ := net.SplitHostPort(addr)
+
+	f := &FTPSource{
+		conn:    conn,
+		text:    textproto.NewConn(conn),
+		host:    host,
+		dir:     dir,
+		timeout: opts.Timeout,
+	}
+
+	err = f.login(opts)
+	if err != nil {
+		f.text.Close()
+		return nil, err
+	}
+
+	return f, nil
+}
+
+func (f *FTPSource) login(opts SourceOptions) error {
+	f.setDeadline()
+
+	_, _, err := f.text.ReadResponse(220)
+	if err != nil {
+		return fmt.Errorf("Error reading FTP greeting: %w", err)
+	}
+
+	user := opts.Username
+	if user == "" {
+		user = "anonymous"
+	}
+
+	code, _, err := f.cmd(0, "USER %v", user)
+	if err != nil {
+		return err
+	}
+
+	if code == 331 {
+		_, _, err = f.cmd(230, "PASS %v", opts.Password)
+		if err != nil {
+			return err
+		}
+	} else if code != 230 {
+		return fmt.Errorf("FTP login failed: %v", code)
+	}
+
+	_, _, err = f.cmd(200, "TYPE I")
+	if err != nil {
+		return err
+	}
+
+	_, _, err = f.cmd(250, "CWD %v", f.dir)
+	return err
+}
+
+func (f *FTPSource) setDeadline() {
+	f.conn.SetDeadline(time.Now().Add(f.timeout))
+}
+
+// cmd sends a command and reads the response. If expectCode is 0, any
+// code is accepted.
+func (f *FTPSource) cmd(expectCode int, format string, args ...interface{}) (int, string, error) {
+	f.setDeadline()
+
+	err := f.text.PrintfLine(format, args...)
+	if err != nil {
+		return 0, "", err
+	}
+
+	code, msg, err := f.text.ReadResponse(expectCode)
+	if err != nil {
+		return code, msg, fmt.Errorf("FTP %v: %w", strings.Fields(format)[0], err)
+	}
+
+	return code, msg, nil
+}
+
+var reEpsv = regexp.MustCompile(`\(\|\|\|(\d+)\|\)`)
+var rePasv = regexp.MustCompile(`(\d+),(\d+),(\d+),(\d+),(\d+),(\d+)`)
+
+// dataConn opens a passive data connection. The control connection host is
+// always used as servers behind NAT often report a private address.
+func (f *FTPSource) dataConn() (net.Conn, error) {
+	var port int
+
+	_, msg, err := f.cmd(229, "EPSV")
+	if err == nil {
+		m := reEpsv.FindStringSubmatch(msg)
+		if m == nil {
+			return nil, fmt.Errorf("Error parsing EPSV response: %v", msg)
+		}
+		port, _ = strconv.Atoi(m[1])
+	} else {
+		_, msg, err := f.cmd(227, "PASV")
+		if err != nil {
+			return nil, err
+		}
+		m := rePasv.FindStringSubmatch(msg)
+		if m == nil {
+			return nil, fmt.Errorf("Error parsing PASV response: %v", msg)
+		}
+		p1, _ := strconv.Atoi(m[5])
+		p2, _ := strconv.Atoi(m[6])
+		port = p1*256 + p2
+	}
+
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(f.host, strconv.Itoa(port)),
+		f.timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	conn.SetDeadline(time.Now().Add(f.timeout))
+
+	return conn, nil
+}
+
+// transfer runs a command that returns data on a data connection
+func (f *FTPSource) transfer(format string, args ...interface{}) ([]byte, error) {
+	conn, err := f.dataConn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	code, msg, err := f.cmd(0, format, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	if code != 125 && code != 150 {
+		return nil, &textproto.Error{Code: code, Msg: msg}
+	}
+
+	d, err := io.ReadAll(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	conn.Close()
+
+	f.setDeadline()
+	_, _, err = f.text.ReadResponse(226)
+	if err != nil {
+		return nil, err
+	}
+
+	return d, nil
+}
+
+// List returns the names of regular files in the directory. MLSD is used
+// if the server supports it, otherwise NLST.
+func (f *FTPSource) List() ([]string, error) {
+	var ret []string
+
+	d, err := f.transfer("MLSD")
+	if err == nil {
+		for _, line := range strings.Split(string(d), "\n") {
+			line = strings.TrimRight(line, "\r")
+			facts, name, ok := strings.Cut(line, " ")
+			if !ok {
+				continue
+			}
+			if strings.Contains(strings.ToLower(facts), "type=file;") {
+				ret = append(ret, name)
+			}
+		}
+		return ret, nil
+	}
+
+	var tpErr *textproto.Error
+	if !errors.As(err, &tpErr) {
+		return nil, err
+	}
+
+	d, err = f.transfer("NLST")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, line := range strings.Split(string(d), "\n") {
+		name := path.Base(strings.TrimSpace(line))
+		if name != "" && name != "." && name != ".." {
+			ret = append(ret, name)
+		}
+	}
+
+	return ret, nil
+}
+
+// Read returns the contents of a file
+func (f *FTPSource) Read(name string) ([]byte, error) {
+	return f.transfer("RETR %v", path.Base(name))
+}
+
+// Remove deletes a file
+func (f *FTPSource) Remove(name string) error {
+	_, _, err := f.cmd(250, "DELE %v", path.Base(name))
+	return err
+}
+
+// Rename moves a file. The parent directory of newPath is created if it
+// does not exist.
+func (f *FTPSource) Rename(name, newPath string) error {
+	if dir := path.Dir(newPath); dir != "." {
+		// ignore errors as the directory probably already exists
+		f.cmd(257, "MKD %v", dir)
+	}
+
+	_, _, err := f.cmd(350, "RNFR %v", path.Base(name))
+	if err != nil {
+		return err
+	}
+
+	_, _, err = f.cmd(250, "RNTO %v", newPath)
+	return err
+}
+
+// Close logs out and closes the connection
+func (f *FTPSource) Close() error {
+	f.cmd(221, "QUIT")
+	return f.text.Close()
+}
@@ -0,0 +1,65 @@
+package file
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// LocalSource reads files from a local directory
+type LocalSource struct {
+	dir string
+}
+
+// NewLocalSource returns a source for a local directory
+func NewLocalSource(dir string) (*LocalSource, error) {
+	_, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	return &LocalSource{dir: dir}, nil
+}
+
+// List returns the names of regular files in the directory
+func (ls *LocalSource) List() ([]string, error) {
+	entries, err := os.ReadDir(ls.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var ret []string
+	for _, e := range entries {
+		if e.Type().IsRegular() {
+			ret = append(ret, e.Name())
+		}
+	}
+
+	return ret, nil
+}
+
+// Read returns the contents of a file
+func (ls *LocalSource) Read(name string) ([]byte, error) {
+	return os.ReadFile(filepath.Join(ls.dir, filepath.Base(name)))
+}
+
+// Remove deletes a file
+func (ls *LocalSource) Remove(name string) error {
+	return os.Remove(filepath.Join(ls.dir, filepath.Base(name)))
+}
+
+// Rename moves a file. Parent directories of newPath are created if needed.
+func (ls *LocalSource) Rename(name, newPath string) error {
+	dst := filepath.Join(ls.dir, newPath)
+
+	err := os.MkdirAll(filepath.Dir(dst), 0755)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(filepath.Join(ls.dir, filepath.Base(name)), dst)
+}
+
+// Close does nothing for local sources
+func (ls *LocalSource) Close() error {
+	return nil
+}
@@ -0,0 +1,491 @@
+package file
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// SFTP packet types, see draft-ietf-secsh-filexfer-02 (version 3)
+const (
+	sftpInit     = 1
+	sftpVersion  = 2
+	sftpOpen     = 3
+	sftpClose    = 4
+	sftpRead     = 5
+	sftpOpenDir  = 11
+	sftpReadDir  = 12
+	sftpRemove   = 13
+	sftpMkdir    = 14
+	sftpRename   = 18
+	sftpStatus   = 101
+	sftpHandle   = 102
+	sftpData     = 103
+	sftpName     = 104
+	sftpStatusOK = 0
+	sftpEOF      = 1
+)
+
+// SFTPSource reads files from a SFTP server directory. This is a minimal
+// SFTP version 3 client that only supports the operations needed to ingest
+// files.
+type SFTPSource struct {
+	client *ssh.Client
+	sess   *ssh.Session
+	w      io.WriteCloser
+	r      *bufio.Reader
+	dir    string
+	id     uint32
+}
+
+// DialSFTP connects to a SFTP server. The server key must match
+// opts.HostKey, or an entry in the opts.KnownHosts file.
+func DialSFTP(addr, dir string, opts SourceOptions) (*SFTPSource, error) {
+	hostKeyCallback, err := sftpHostKeyCallback(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &ssh.ClientConfig{
+		User:            opts.Username,
+		Auth:            []ssh.AuthMethod{ssh.Password(opts.Password)},
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         opts.Timeout,
+	}
+
+	client, err := ssh.Dial("tcp", addr, config)
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := newSFTPSource(client, dir)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// sftpHostKeyCallback returns a callback that verifies the server key. Unknown
+// keys are never accepted.
+func sftpHostKeyCallback(opts SourceOptions) (ssh.HostKeyCallback, error) {
+	if opts.HostKey != "" {
+		key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(opts.HostKey))
+		if err != nil {
+			return nil, fmt.Errorf("Error parsing host key: %w", err)
+		}
+		return ssh.FixedHostKey(key), nil
+	}
+
+	if opts.KnownHosts != "" {
+		cb, err := knownhosts.New(opts.KnownHosts)
+		if err != nil {
+			return nil, fmt.Errorf("Error reading known hosts: %w", err)
+		}
+		return cb, nil
+	}
+
+	return nil, errors.New("SFTP host key or known hosts file must be set")
+}
+
+func newSFTPSource(client *ssh.Client, dir string) (*SFTPSource, error) {
+	sess, err := client.NewSession()
+	if err != nil {
+		return nil, err
+	}
+
+	w, err := sess.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := sess.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	err = sess.RequestSubsystem("sftp")
+	if err != nil {
+		return nil, fmt.Errorf("Error starting sftp subsystem: %w", err)
+	}
+
+	s := &SFTPSource{
+		client: client,
+		sess:   sess,
+		w:      w,
+		r:      bufio.NewReader(r),
+		dir:    dir,
+	}
+
+	// init packet does not have a request ID
+	err = s.writePacket(sftpInit, u32(3))
+	if err != nil {
+		return nil, err
+	}
+
+	typ, _, err := s.readPacket()
+	if err != nil {
+		return nil, err
+	}
+
+	if typ != sftpVersion {
+		return nil, fmt.Errorf("unexpected sftp init response: %v", typ)
+	}
+
+	return s, nil
+}
+
+func u32(v uint32) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, v)
+	return b
+}
+
+func u64(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return b
+}
+
+func sftpString(s string) []byte {
+	return append(u32(uint32(len(s))), s...)
+}
+
+func (s *SFTPSource) writePacket(typ byte, payload ...[]byte) error {
+	var d []byte
+	for _, p := range payload {
+		d = append(d, p...)
+	}
+
+	pkt := append(u32(uint32(len(d)+1)), typ)
+	pkt = append(pkt, d...)
+
+	_, err := s.w.Write(pkt)
+	return err
+}
+
+func (s *SFTPSource) readPacket() (byte, []byte, error) {
+	var lenBuf [4]byte
+	_, err := io.ReadFull(s.r, lenBuf[:])
+	if err != nil {
+		return 0, nil, err
+	}
+
+	l := binary.BigEndian.Uint32(lenBuf[:])
+	if l < 1 || l > 1<<24 {
+		return 0, nil, fmt.Errorf("invalid sftp packet length: %v", l)
+	}
+
+	d := make([]byte, l)
+	_, err = io.ReadFull(s.r, d)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return d[0], d[1:], nil
+}
+
+var errSFTPShort = errors.New("sftp packet too short")
+
+// sftpBuf is used to decode packets
+type sftpBuf []byte
+
+func (b *sftpBuf) u32() (uint32, error) {
+	if len(*b) < 4 {
+		return 0, errSFTPShort
+	}
+	v := binary.BigEndian.Uint32(*b)
+	*b = (*b)[4:]
+	return v, nil
+}
+
+func (b *sftpBuf) str() (string, error) {
+	l, err := b.u32()
+	if err != nil {
+		return "", err
+	}
+	if uint32(len(*b)) < l {
+		return "", errSFTPShort
+	}
+	v := string((*b)[:l])
+	*b = (*b)[l:]
+	return v, nil
+}
+
+func (b *sftpBuf) skip(n int) error {
+	if len(*b) < n {
+		return errSFTPShort
+	}
+	*b = (*b)[n:]
+	return nil
+}
+
+// attrs decodes file attributes and returns the permissions (0 if not
+// present)
+func (b *sftpBuf) attrs() (uint32, error) {
+	flags, err := b.u32()
+	if err != nil {
+		return 0, err
+	}
+
+	var perm uint32
+
+	if flags&0x1 != 0 {
+		// size
+		if err := b.skip(8); err != nil {
+			return 0, err
+		}
+	}
+
+	if flags&0x2 != 0 {
+		// uid, gid
+		if err := b.skip(8); err != nil {
+			return 0, err
+		}
+	}
+
+	if flags&0x4 != 0 {
+		perm, err = b.u32()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if flags&0x8 != 0 {
+		// atime, mtime
+		if err := b.skip(8); err != nil {
+			return 0, err
+		}
+	}
+
+	if flags&0x80000000 != 0 {
+		count, err := b.u32()
+		if err != nil {
+			return 0, err
+		}
+		for i := uint32(0); i < count; i++ {
+			if _, err := b.str(); err != nil {
+				return 0, err
+			}
+			if _, err := b.str(); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	return perm, nil
+}
+
+// request sends a request and returns the response type and payload after
+// the request ID
+func (s *SFTPSource) request(typ byte, payload ...[]byte) (byte, sftpBuf, error) {
+	s.id++
+	id := s.id
+
+	err := s.writePacket(typ, append([][]byte{u32(id)}, payload...)...)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	respType, d, err := s.readPacket()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	b := sftpBuf(d)
+	respID, err := b.u32()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if respID != id {
+		return 0, nil, fmt.Errorf("sftp response ID mismatch: %v != %v", respID, id)
+	}
+
+	return respType, b, nil
+}
+
+// statusErr returns an error for a status response that is not OK
+func statusErr(b sftpBuf) (uint32, error) {
+	code, err := b.u32()
+	if err != nil {
+		return 0, err
+	}
+
+	if code == sftpStatusOK {
+		return code, nil
+	}
+
+	msg, _ := b.str()
+	return code, fmt.Errorf("sftp error %v: %v", code, msg)
+}
+
+// requestStatus sends a request that returns a status response
+func (s *SFTPSource) requestStatus(typ byte, payload ...[]byte) error {
+	respType, b, err := s.request(typ, payload...)
+	if err != nil {
+		return err
+	}
+
+	if respType != sftpStatus {
+		return fmt.Errorf("unexpected sftp response: %v", respType)
+	}
+
+	_, err = statusErr(b)
+	return err
+}
+
+// requestHandle sends a request that returns a handle
+func (s *SFTPSource) requestHandle(typ byte, payload ...[]byte) (string, error) {
+	respType, b, err := s.request(typ, payload...)
+	if err != nil {
+		return "", err
+	}
+
+	switch respType {
+	case sftpHandle:
+		return b.str()
+	case sftpStatus:
+		_, err := statusErr(b)
+		if err == nil {
+			err = errors.New("sftp: expected handle")
+		}
+		return "", err
+	}
+
+	return "", fmt.Errorf("unexpected sftp response: %v", respType)
+}
+
+func (s *SFTPSource) path(name string) string {
+	return path.Join(s.dir, name)
+}
+
+// List returns the names of regular files in the directory
+func (s *SFTPSource) List() ([]string, error) {
+	handle, err := s.requestHandle(sftpOpenDir, sftpString(s.dir))
+	if err != nil {
+		return nil, err
+	}
+	defer s.requestStatus(sftpClose, sftpString(handle))
+
+	var ret []string
+
+	for {
+		respType, b, err := s.request(sftpReadDir, sftpString(handle))
+		if err != nil {
+			return nil, err
+		}
+
+		if respType == sftpStatus {
+			code, err := statusErr(b)
+			if code == sftpEOF {
+				return ret, nil
+			}
+			if err == nil {
+				err = errors.New("sftp: unexpected status reading directory")
+			}
+			return nil, err
+		}
+
+		if respType != sftpName {
+			return nil, fmt.Errorf("unexpected sftp response: %v", respType)
+		}
+
+		count, err := b.u32()
+		if err != nil {
+			return nil, err
+		}
+
+		for i := uint32(0); i < count; i++ {
+			name, err := b.str()
+			if err != nil {
+				return nil, err
+			}
+
+			// long name
+			if _, err := b.str(); err != nil {
+				return nil, err
+			}
+
+			perm, err := b.attrs()
+			if err != nil {
+				return nil, err
+			}
+
+			if perm&0170000 == 0100000 {
+				ret = append(ret, name)
+			}
+		}
+	}
+}
+
+// Read returns the contents of a file
+func (s *SFTPSource) Read(name string) ([]byte, error) {
+	handle, err := s.requestHandle(sftpOpen, sftpString(s.path(path.Base(name))),
+		u32(1), u32(0))
+	if err != nil {
+		return nil, err
+	}
+	defer s.requestStatus(sftpClose, sftpString(handle))
+
+	var ret []byte
+
+	for {
+		respType, b, err := s.request(sftpRead, sftpString(handle),
+			u64(uint64(len(ret))), u32(32*1024))
+		if err != nil {
+			return nil, err
+		}
+
+		switch respType {
+		case sftpData:
+			d, err := b.str()
+			if err != nil {
+				return nil, err
+			}
+			ret = append(ret, d...)
+		case sftpStatus:
+			code, err := statusErr(b)
+			if code == sftpEOF {
+				return ret, nil
+			}
+			if err == nil {
+				err = errors.New("sftp: unexpected status reading file")
+			}
+			return nil, err
+		default:
+			return nil, fmt.Errorf("unexpected sftp response: %v", respType)
+		}
+	}
+}
+
+// Remove deletes a file
+func (s *SFTPSource) Remove(name string) error {
+	return s.requestStatus(sftpRemove, sftpString(s.path(path.Base(name))))
+}
+
+// Rename moves a file. The parent directory of newPath is created if it
+// does not exist.
+func (s *SFTPSource) Rename(name, newPath string) error {
+	if dir := path.Dir(newPath); dir != "." {
+		// ignore errors as the directory probably already exists
+		s.requestStatus(sftpMkdir, sftpString(s.path(dir)), u32(0))
+	}
+
+	return s.requestStatus(sftpRename, sftpString(s.path(path.Base(name))),
+		sftpString(s.path(newPath)))
+}
+
+// Close closes the SFTP session and SSH connection
+func (s *SFTPSource) Close() error {
+	s.w.Close()
+	s.sess.Close()
+	return s.client.Close()
+}
@@ -0,0 +1,79 @@
+package file
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"time"
+)
+
+// Source is a directory that files are read from. Local directories, FTP,
+// and SFTP are supported.
+type Source interface {
+	// List returns the names of regular files in the directory
+	List() ([]string, error)
+	// Read returns the contents of a file
+	Read(name string) ([]byte, error)
+	// Remove deletes a file
+	Remove(name string) error
+	// Rename moves a file. newPath is relative to the source directory.
+	Rename(name, newPath string) error
+	Close() error
+}
+
+// SourceOptions are used to connect to a remote file source
+type SourceOptions struct {
+	Username string
+	Password string
+	// HostKey is the expected SFTP server key in authorized_keys format
+	HostKey string
+	// KnownHosts is the path of a known_hosts file that is used to verify
+	// the SFTP server key if HostKey is not set. One of these must be set
+	// for SFTP.
+	KnownHosts string
+	Timeout    time.Duration
+}
+
+// NewSource opens a Source. uri is a local directory path, or a URI of the
+// form ftp://host[:port]/dir or sftp://host[:port]/dir. A user and password
+// in the URI override the options.
+func NewSource(uri string, opts SourceOptions) (Source, error) {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme == "" || u.Scheme == "file" {
+		dir := uri
+		if err == nil && u.Scheme == "file" {
+			dir = u.Path
+		}
+		return NewLocalSource(dir)
+	}
+
+	if u.User != nil {
+		opts.Username = u.User.Username()
+		if p, ok := u.User.Password(); ok {
+			opts.Password = p
+		}
+	}
+
+	if opts.Timeout <= 0 {
+		opts.Timeout = 30 * time.Second
+	}
+
+	dir := path.Clean("/" + u.Path)
+
+	switch u.Scheme {
+	case "ftp":
+		host := u.Host
+		if u.Port() == "" {
+			host += ":21"
+		}
+		return DialFTP(host, dir, opts)
+	case "sftp":
+		host := u.Host
+		if u.Port() == "" {
+			host += ":22"
+		}
+		return DialSFTP(host, dir, opts)
+	}
+
+	return nil, fmt.Errorf("unsupported file source: %v", u.Scheme)
+}
@@ -0,0 +1,282 @@
+package file
+
+import (
+	"bufio"
+	"crypto/ed25519"
+	"crypto/rand"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func TestLocalSource(t *testing.T) {
+	dir := t.TempDir()
+
+	err := os.WriteFile(filepath.Join(dir, "a.csv"), []byte("a"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.WriteFile(filepath.Join(dir, "b.csv"), []byte("b"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.Mkdir(filepath.Join(dir, "sub"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	src, err := NewSource(dir, SourceOptions{})
+	if err != nil {
+		t.Fatal("Error opening source: ", err)
+	}
+	defer src.Close()
+
+	names, err := src.List()
+	if err != nil {
+		t.Fatal("Error listing: ", err)
+	}
+
+	sort.Strings(names)
+
+	if !reflect.DeepEqual(names, []string{"a.csv", "b.csv"}) {
+		t.Fatal("List not correct: ", names)
+	}
+
+	d, err := src.Read("a.csv")
+	if err != nil || string(d) != "a" {
+		t.Fatal("Read failed: ", err, string(d))
+	}
+
+	err = src.Rename("a.csv", "done/a.csv")
+	if err != nil {
+		t.Fatal("Rename failed: ", err)
+	}
+
+	if !Exists(filepath.Join(dir, "done", "a.csv")) {
+		t.Error("Renamed file does not exist")
+	}
+
+	err = src.Remove("b.csv")
+	if err != nil {
+		t.Fatal("Remove failed: ", err)
+	}
+
+	names, _ = src.List()
+	if len(names) != 0 {
+		t.Error("Expected no files, got: ", names)
+	}
+}
+
+// fakeFTP is a minimal FTP server used for testing. MLSD is not supported
+// so NLST is used.
+func fakeFTP(t *testing.T, files map[string]string) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		r := bufio.NewReader(conn)
+		reply := func(s string) { fmt.Fprintf(conn, "%v\r\n", s) }
+
+		var data net.Listener
+		var rnfr string
+
+		send := func(s string) {
+			reply("150 opening data connection")
+			c, err := data.Accept()
+			if err == nil {
+				c.Write([]byte(s))
+				c.Close()
+			}
+			data.Close()
+			reply("226 transfer complete")
+		}
+
+		reply("220 fake ftp")
+
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+
+			cmd, arg, _ := strings.Cut(strings.TrimSpace(line), " ")
+
+			switch cmd {
+			case "USER":
+				reply("331 password required")
+			case "PASS":
+				if arg != "secret" {
+					reply("530 login incorrect")
+					continue
+				}
+				reply("230 logged in")
+			case "TYPE":
+				reply("200 type set")
+			case "CWD":
+				reply("250 ok")
+			case "EPSV":
+				data, _ = net.Listen("tcp", "127.0.0.1:0")
+				port := data.Addr().(*net.TCPAddr).Port
+				reply(fmt.Sprintf("229 Entering Extended Passive Mode (|||%v|)", port))
+			case "MLSD":
+				data.Close()
+				reply("500 unknown command")
+			case "NLST":
+				var names []string
+				for n := range files {
+					names = append(names, n)
+				}
+				send(strings.Join(names, "\r\n") + "\r\n")
+			case "RETR":
+				f, ok := files[arg]
+				if !ok {
+					data.Close()
+					reply("550 not found")
+					continue
+				}
+				send(f)
+			case "DELE":
+				delete(files, arg)
+				reply("250 deleted")
+			case "MKD":
+				reply("257 created")
+			case "RNFR":
+				rnfr = arg
+				reply("350 ready")
+			case "RNTO":
+				files[arg] = files[rnfr]
+				delete(files, rnfr)
+				reply("250 renamed")
+			case "QUIT":
+				reply("221 bye")
+				return
+			default:
+				reply("502 not implemented")
+			}
+		}
+	}()
+
+	return l.Addr().String()
+}
+
+func TestFTPSource(t *testing.T) {
+	files := map[string]string{"a.csv": "time,v\n", "b.csv": "time,x\n"}
+
+	addr := fakeFTP(t, files)
+
+	src, err := NewSource("ftp://user:secret@"+addr+"/logs", SourceOptions{})
+	if err != nil {
+		t.Fatal("Error connecting: ", err)
+	}
+
+	names, err := src.List()
+	if err != nil {
+		t.Fatal("Error listing: ", err)
+	}
+
+	sort.Strings(names)
+
+	if !reflect.DeepEqual(names, []string{"a.csv", "b.csv"}) {
+		t.Fatal("List not correct: ", names)
+	}
+
+	d, err := src.Read("a.csv")
+	if err != nil || string(d) != "time,v\n" {
+		t.Fatal("Read failed: ", err, string(d))
+	}
+
+	err = src.Rename("a.csv", "done/a.csv")
+	if err != nil {
+		t.Fatal("Rename failed: ", err)
+	}
+
+	err = src.Remove("b.csv")
+	if err != nil {
+		t.Fatal("Remove failed: ", err)
+	}
+
+	err = src.Close()
+	if err != nil {
+		t.Fatal("Close failed: ", err)
+	}
+
+	if !reflect.DeepEqual(files, map[string]string{"done/a.csv": "time,v\n"}) {
+		t.Error("Files not correct after processing: ", files)
+	}
+}
+
+func TestSFTPHostKeyCallback(t *testing.T) {
+	_, err := sftpHostKeyCallback(SourceOptions{})
+	if err == nil {
+		t.Fatal("SFTP without a host key or known hosts must fail")
+	}
+
+	newKey := func() ssh.PublicKey {
+		pub, _, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		key, err := ssh.NewPublicKey(pub)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return key
+	}
+
+	key, otherKey := newKey(), newKey()
+	addr := &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 22}
+
+	cb, err := sftpHostKeyCallback(SourceOptions{
+		HostKey: string(ssh.MarshalAuthorizedKey(key)),
+	})
+	if err != nil {
+		t.Fatal("Error with host key: ", err)
+	}
+
+	if cb("10.0.0.1:22", addr, key) != nil {
+		t.Error("host key not accepted")
+	}
+
+	if cb("10.0.0.1:22", addr, otherKey) == nil {
+		t.Error("wrong host key accepted")
+	}
+
+	knownHosts := filepath.Join(t.TempDir(), "known_hosts")
+	err = os.WriteFile(knownHosts,
+		[]byte(knownhosts.Line([]string{"10.0.0.1"}, key)+"\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cb, err = sftpHostKeyCallback(SourceOptions{KnownHosts: knownHosts})
+	if err != nil {
+		t.Fatal("Error with known hosts: ", err)
+	}
+
+	if cb("10.0.0.1:22", addr, key) != nil {
+		t.Error("known host key not accepted")
+	}
+
+	if cb("10.0.0.1:22", addr, otherKey) == nil {
+		t.Error("wrong known host key accepted")
+	}
+}
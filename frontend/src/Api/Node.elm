@@ -18,21 +18,64 @@ module Api.Node exposing
     , sysStatePowerOff
     , typeAction
     , typeActionInactive
+    , typeBacnet
+    , typeBacnetIO
+    , typeCalc
+    , typeCalcOutput
+    , typeCanBus
+    , typeCanMessage
+    , typeCloudForwarder
+    , typeColdChain
+    , typeColdChainEvent
+    , typeCommissioning
+    , typeCommissioningCheck
     , typeCondition
+    , typeConfigDrift
+    , typeConfigTemplate
     , typeDb
     , typeDevice
+    , typeDoser
+    , typeEmailIngest
+    , typeEmailPattern
+    , typeFileColumn
+    , typeFileIngest
+    , typeGenerator
     , typeGroup
+    , typeGsmModem
+    , typeHvac
+    , typeHvacStage
+    , typeKafka
+    , typeLighting
     , typeModbus
     , typeModbusIO
     , typeMsgService
+    , typeOccupancy
+    , typeOccupancyZone
     , typeOneWire
     , typeOneWireIO
+    , typeOpcUA
+    , typeOpcUAIO
+    , typePump
+    , typePumpGroup
+    , typeQuota
+    , typeRetention
     , typeRule
+    , typeS3Export
+    , typeSecret
+    , typeSequencer
+    , typeSequencerZone
     , typeSerialDev
     , typeSignalGenerator
+    , typeSnmp
+    , typeSnmpIO
+    , typeStoreSettings
+    , typeTank
     , typeUpstream
     , typeUser
     , typeVariable
+    , typeVibration
+    , typeVibrationBand
+    , typeWebhook
     )
 
 import Api.Data exposing (Data)
@@ -145,6 +188,221 @@ typeSignalGenerator =
     "signalGenerator"
 
 
+typeGsmModem : String
+typeGsmModem =
+    "gsmModem"
+
+
+typeEmailIngest : String
+typeEmailIngest =
+    "emailIngest"
+
+
+typeEmailPattern : String
+typeEmailPattern =
+    "emailPattern"
+
+
+typeFileIngest : String
+typeFileIngest =
+    "fileIngest"
+
+
+typeFileColumn : String
+typeFileColumn =
+    "fileColumn"
+
+
+typeS3Export : String
+typeS3Export =
+    "s3Export"
+
+
+typeKafka : String
+typeKafka =
+    "kafka"
+
+
+typeOpcUA : String
+typeOpcUA =
+    "opcUA"
+
+
+typeOpcUAIO : String
+typeOpcUAIO =
+    "opcUAIo"
+
+
+typeBacnet : String
+typeBacnet =
+    "bacnet"
+
+
+typeBacnetIO : String
+typeBacnetIO =
+    "bacnetIo"
+
+
+typeSnmp : String
+typeSnmp =
+    "snmp"
+
+
+typeSnmpIO : String
+typeSnmpIO =
+    "snmpIo"
+
+
+typeCanBus : String
+typeCanBus =
+    "canBus"
+
+
+typeCanMessage : String
+typeCanMessage =
+    "canMessage"
+
+
+typeRetention : String
+typeRetention =
+    "retention"
+
+
+typeCloudForwarder : String
+typeCloudForwarder =
+    "cloudForwarder"
+
+
+typeWebhook : String
+typeWebhook =
+    "webhook"
+
+
+typeSequencer : String
+typeSequencer =
+    "sequencer"
+
+
+typeSequencerZone : String
+typeSequencerZone =
+    "sequencerZone"
+
+
+typeLighting : String
+typeLighting =
+    "lighting"
+
+
+typeTank : String
+typeTank =
+    "tank"
+
+
+typePumpGroup : String
+typePumpGroup =
+    "pumpGroup"
+
+
+typePump : String
+typePump =
+    "pump"
+
+
+typeGenerator : String
+typeGenerator =
+    "generator"
+
+
+typeHvac : String
+typeHvac =
+    "hvac"
+
+
+typeHvacStage : String
+typeHvacStage =
+    "hvacStage"
+
+
+typeColdChain : String
+typeColdChain =
+    "coldChain"
+
+
+typeColdChainEvent : String
+typeColdChainEvent =
+    "coldChainEvent"
+
+
+typeDoser : String
+typeDoser =
+    "doser"
+
+
+typeStoreSettings : String
+typeStoreSettings =
+    "storeSettings"
+
+
+typeQuota : String
+typeQuota =
+    "quota"
+
+
+typeVibration : String
+typeVibration =
+    "vibration"
+
+
+typeVibrationBand : String
+typeVibrationBand =
+    "vibrationBand"
+
+
+typeOccupancy : String
+typeOccupancy =
+    "occupancy"
+
+
+typeOccupancyZone : String
+typeOccupancyZone =
+    "occupancyZone"
+
+
+typeConfigTemplate : String
+typeConfigTemplate =
+    "configTemplate"
+
+
+typeConfigDrift : String
+typeConfigDrift =
+    "configDrift"
+
+
+typeCommissioning : String
+typeCommissioning =
+    "commissioning"
+
+
+typeCommissioningCheck : String
+typeCommissioningCheck =
+    "commissioningCheck"
+
+
+typeSecret : String
+typeSecret =
+    "secret"
+
+
+typeCalc : String
+typeCalc =
+    "calc"
+
+
+typeCalcOutput : String
+typeCalcOutput =
+    "calcOutput"
+
+
 
 -- Node corresponds with Go NodeEdge struct
 
@@ -3,6 +3,7 @@ module Api.Point exposing
     , blankMajicValue
     , clearText
     , decode
+    , desiredPending
     , empty
     , encode
     , encodeList
@@ -17,76 +18,342 @@ module Api.Point exposing
     , newValue
     , renderPoint
     , sort
+    , typeAccessKey
     , typeAction
     , typeActive
+    , typeActiveLevel
+    , typeActiveZone
     , typeAddress
+    , typeAdvance
+    , typeAllowedSenders
     , typeAmplitude
+    , typeArchived
+    , typeAtsNodeID
+    , typeAttestationKey
+    , typeAttested
+    , typeAuthProtocol
     , typeAuthToken
+    , typeBackupPeriod
+    , typeBacnetDeviceID
+    , typeBacnetInstance
+    , typeBacnetObjectType
+    , typeBatchPeriod
+    , typeBatchSize
+    , typeBatteryLow
+    , typeBatteryNodeID
+    , typeBatteryVoltage
     , typeBaud
+    , typeBroadcastAddress
+    , typeBrokers
+    , typeBrowse
     , typeBucket
+    , typeCOV
+    , typeCanID
+    , typeCapacity
     , typeChannel
+    , typeCheckType
+    , typeClientCrashLoop
+    , typeClientCrashes
+    , typeClientError
     , typeClientServer
+    , typeClientType
     , typeCmdPending
+    , typeColumn
+    , typeComment
+    , typeCommunity
     , typeConditionType
+    , typeCoolSetpoint
+    , typeCoolStage
+    , typeCount
+    , typeCounterType
+    , typeCrestFactor
+    , typeCurve
+    , typeDailyLimit
+    , typeDark
     , typeDataFormat
+    , typeDawnOffset
+    , typeDbcFile
+    , typeDeadband
     , typeDebug
+    , typeDelimiter
+    , typeDemand
     , typeDescription
+    , typeDesired
+    , typeDetail
     , typeDevice
+    , typeDeviceNodeID
+    , typeDeviceUnits
+    , typeDevices
+    , typeDiameter
+    , typeDifferences
+    , typeDifferential
+    , typeDirection
     , typeDisable
+    , typeDiscover
+    , typeDoseDate
+    , typeDoseToday
+    , typeDownsampleInterval
+    , typeDownsamplePeriod
+    , typeDrifted
+    , typeDuration
+    , typeDuskOffset
+    , typeDuty
+    , typeEconomizerNodeID
+    , typeEconomizerTemp
+    , typeEconomizing
     , typeEmail
+    , typeEncryptionKey
     , typeEnd
+    , typeEntriesToday
+    , typeEntryNodeID
+    , typeEntryPointType
     , typeErrorCount
     , typeErrorCountCRC
     , typeErrorCountCRCReset
     , typeErrorCountEOF
     , typeErrorCountEOFReset
     , typeErrorCountReset
+    , typeExcursion
+    , typeExcursionDelay
+    , typeExercise
+    , typeExerciseDuration
+    , typeExerciseStart
+    , typeExerciseWeekday
+    , typeExitNodeID
+    , typeExitPointType
+    , typeExitsToday
+    , typeExportPeriod
+    , typeExtended
+    , typeFailToStart
+    , typeFailed
+    , typeFanNodeID
+    , typeFeedbackNodeID
+    , typeFeedbackPointType
+    , typeFeedbackTimeout
     , typeFilePath
     , typeFirstName
+    , typeFlowRate
+    , typeFormat
     , typeFrequency
     , typeFrom
+    , typeFromTop
+    , typeFuelLevel
+    , typeFuelLow
+    , typeFuelNodeID
+    , typeGain
+    , typeGcAge
+    , typeGcDryRun
+    , typeGcEdges
+    , typeGcKeys
+    , typeGcNodes
+    , typeGcPeriod
+    , typeGcPoints
+    , typeGoldenNodeID
+    , typeHeatSetpoint
+    , typeHeatStage
+    , typeHeight
+    , typeHighFrequency
+    , typeHighLimit
+    , typeHistoryBytes
+    , typeHostKey
     , typeID
+    , typeIgnorePointTypes
     , typeIndex
+    , typeInterlockNodeID
+    , typeInterlocked
+    , typeJ1939
+    , typeKeyAge
+    , typeKeyLimit
+    , typeKeyTypes
+    , typeKnownHosts
+    , typeKurtosis
     , typeLastName
+    , typeLastReset
+    , typeLatitude
+    , typeLead
+    , typeLeak
+    , typeLeakDelay
+    , typeLeakRate
+    , typeLength
+    , typeLevel
+    , typeLevelNodeID
+    , typeLevelOffset
+    , typeLevelPointType
+    , typeLimit
+    , typeLimitReached
+    , typeLimitType
     , typeLog
+    , typeLongitude
+    , typeLowBattery
+    , typeLowFrequency
+    , typeLowFuel
+    , typeLowLimit
+    , typeMailbox
+    , typeMaxAge
+    , typeMaxDuty
+    , typeMaxHistoryBytes
+    , typeMaxNodes
+    , typeMaxPointRate
+    , typeMaxSpool
     , typeMinActive
+    , typeMinOff
+    , typeMinRun
+    , typeModbusID
     , typeModbusIOType
+    , typeModbusNodeID
+    , typeMode
+    , typeNoTLS
+    , typeNodeCount
     , typeNodeID
     , typeNodeType
+    , typeNodeTypes
+    , typeOID
+    , typeOccupancy
+    , typeOccupancyNodeID
+    , typeOccupancyPointType
+    , typeOccupancyTimeout
+    , typeOccupied
+    , typeOccupiedEnd
+    , typeOccupiedLevel
+    , typeOccupiedStart
+    , typeOffline
     , typeOffset
+    , typeOnCreate
+    , typeOnDelete
+    , typeOnGenerator
+    , typeOpcUANodeID
+    , typeOperation
     , typeOperator
     , typeOrg
+    , typeOutdoorNodeID
+    , typeOutputMax
+    , typeOutputNodeID
+    , typeOutputPointType
+    , typeOverCapacity
+    , typeOverQuota
+    , typeOverride
+    , typeOverrideLevel
+    , typeOverrideTimeout
     , typePass
+    , typePassed
+    , typePattern
+    , typePause
+    , typePeak
+    , typePeakOccupancy
+    , typePercent
+    , typePeriod
     , typePhone
     , typePointID
     , typePointIndex
     , typePointKey
+    , typePointRate
     , typePointType
+    , typePointTypes
     , typePollPeriod
     , typePort
+    , typePrefix
+    , typePriority
+    , typePrivPass
+    , typePrivProtocol
+    , typeProcessedDir
+    , typeProfile
     , typeProtocol
+    , typeProvisionURL
+    , typeProxy
+    , typeRainDelay
+    , typeRainNodeID
+    , typeRainPointType
+    , typeRate
+    , typeRateWindow
+    , typeRawPeriod
     , typeReadOnly
+    , typeReapply
+    , typeRecordElement
+    , typeRegex
+    , typeRegion
+    , typeRejected
+    , typeRemaining
+    , typeRemoteStart
+    , typeReport
+    , typeResetTime
+    , typeResult
+    , typeResultTime
+    , typeRms
+    , typeRun
+    , typeRunNodeID
+    , typeRunThreshold
+    , typeRunning
+    , typeRuntime
     , typeRx
     , typeRxReset
     , typeSID
     , typeSampleRate
     , typeScale
+    , typeSchemaRegistry
+    , typeSecret
+    , typeSecretKey
+    , typeSecretValue
+    , typeSecurityMode
+    , typeSecurityPolicy
+    , typeSensorNodeID
+    , typeSensorPointType
+    , typeSensorTimeout
+    , typeServer
     , typeService
+    , typeSessionToken
+    , typeSetbackCool
+    , typeSetbackHeat
+    , typeSetpoint
+    , typeSeverity
+    , typeShape
+    , typeSignOff
+    , typeSignOffBy
+    , typeSignOffTime
+    , typeSmsService
+    , typeSnmpVersion
+    , typeSourceNodeID
+    , typeSourcePointKey
+    , typeSourcePointType
+    , typeSpn
+    , typeSpoolDir
+    , typeStageDelay
+    , typeStageType
     , typeStart
     , typeStartApp
+    , typeStartNodeID
     , typeStartSystem
+    , typeStartTimeout
+    , typeStrapping
+    , typeSubject
     , typeSwUpdateError
     , typeSwUpdatePercComplete
     , typeSwUpdateRunning
     , typeSwUpdateState
     , typeSysState
+    , typeTLS
+    , typeTLSCert
+    , typeTLSKey
+    , typeTag
+    , typeTargetNodes
+    , typeTechnician
+    , typeTempNodeID
+    , typeTempPointType
+    , typeTimeColumn
+    , typeTimeFormat
+    , typeTimezone
     , typeTombstone
+    , typeTopic
+    , typeTransport
+    , typeTrap
+    , typeTrapPort
     , typeTx
     , typeTxReset
     , typeURI
     , typeUnits
+    , typeUnsigned
     , typeUpdateApp
     , typeUpdateOS
+    , typeUsername
     , typeValue
     , typeValueSet
     , typeValueText
@@ -95,45 +362,99 @@ module Api.Point exposing
     , typeVersionApp
     , typeVersionHW
     , typeVersionOS
+    , typeVolume
+    , typeVolumeScale
     , typeWeekday
+    , typeWidth
+    , typeWindow
+    , typeWindowSize
+    , typeWsPath
+    , typeZoneRemaining
     , updatePoint
     , updatePoints
+    , valueAuto
+    , valueAverage
+    , valueAvro
+    , valueAwsSns
+    , valueCIE
+    , valueCSV
     , valueClient
+    , valueComAp
     , valueContains
+    , valueCool
+    , valueCritical
+    , valueDSE
+    , valueDelta
     , valueEqual
+    , valueEvent
     , valueFLOAT32
+    , valueFail
     , valueGreaterThan
+    , valueGsmModem
+    , valueHeat
+    , valueHigh
+    , valueHorizontal
     , valueINT16
     , valueINT32
+    , valueInfo
+    , valueJSON
     , valueLessThan
+    , valueLinear
+    , valueLow
+    , valueLower
+    , valueManual
+    , valueMax
+    , valueMessageBird
+    , valueMin
     , valueModbusCoil
     , valueModbusDiscreteInput
     , valueModbusHoldingRegister
     , valueModbusInputRegister
+    , valueNats
     , valueNotEqual
     , valueNotify
     , valueNumber
     , valueOff
     , valueOn
     , valueOnOff
+    , valueOutput
+    , valuePass
     , valuePlayAudio
     , valuePointValue
+    , valueProtobuf
     , valueRTU
+    , valueRaise
+    , valueRate
+    , valueRectangular
     , valueSMTP
     , valueSchedule
+    , valueSensor
     , valueServer
     , valueSetValue
     , valueSetValueBool
     , valueSetValueText
+    , valueSnmpV2c
+    , valueSnmpV3
+    , valueSquare
+    , valueSync
     , valueSysStateOffline
     , valueSysStateOnline
     , valueSysStatePowerOff
     , valueSysStateUnknown
     , valueTCP
+    , valueTable
     , valueText
+    , valueTotal
     , valueTwilio
     , valueUINT16
     , valueUINT32
+    , valueUnix
+    , valueUnixMs
+    , valueVertical
+    , valueVonage
+    , valueWarning
+    , valueWebSocket
+    , valueXML
     )
 
 import Iso8601
@@ -206,6 +527,11 @@ typeCmdPending =
     "cmdPending"
 
 
+typeDesired : String
+typeDesired =
+    "desired"
+
+
 typeSwUpdateState : String
 typeSwUpdateState =
     "swUpdateState"
@@ -586,6 +912,31 @@ typeMinActive =
     "minActive"
 
 
+typeSeverity : String
+typeSeverity =
+    "severity"
+
+
+valueInfo : String
+valueInfo =
+    "info"
+
+
+valueWarning : String
+valueWarning =
+    "warning"
+
+
+valueCritical : String
+valueCritical =
+    "critical"
+
+
+typePriority : String
+typePriority =
+    "priority"
+
+
 typeAction : String
 typeAction =
     "action"
@@ -621,11 +972,56 @@ typeService =
     "service"
 
 
+typeSmsService : String
+typeSmsService =
+    "smsService"
+
+
 valueTwilio : String
 valueTwilio =
     "twilio"
 
 
+valueAwsSns : String
+valueAwsSns =
+    "awsSns"
+
+
+valueVonage : String
+valueVonage =
+    "vonage"
+
+
+valueMessageBird : String
+valueMessageBird =
+    "messageBird"
+
+
+valueGsmModem : String
+valueGsmModem =
+    "gsmModem"
+
+
+valueCSV : String
+valueCSV =
+    "csv"
+
+
+valueXML : String
+valueXML =
+    "xml"
+
+
+valueUnix : String
+valueUnix =
+    "unix"
+
+
+valueUnixMs : String
+valueUnixMs =
+    "unixMs"
+
+
 valueSMTP : String
 valueSMTP =
     "smtp"
@@ -646,312 +1042,1889 @@ typeFrom =
     "from"
 
 
-typeVariableType : String
-typeVariableType =
-    "variableType"
+typeRegion : String
+typeRegion =
+    "region"
 
 
-typeNodeType : String
-typeNodeType =
-    "nodeType"
+typeAllowedSenders : String
+typeAllowedSenders =
+    "allowedSenders"
 
 
-typeNodeID : String
-typeNodeID =
-    "nodeID"
+typeTargetNodes : String
+typeTargetNodes =
+    "targetNodes"
 
 
-typeTombstone : String
-typeTombstone =
-    "tombstone"
+typeServer : String
+typeServer =
+    "server"
 
 
-valueOnOff : String
-valueOnOff =
-    "onOff"
+typeNoTLS : String
+typeNoTLS =
+    "noTLS"
 
 
-valueNumber : String
-valueNumber =
-    "number"
+typeUsername : String
+typeUsername =
+    "username"
 
 
-valueText : String
-valueText =
-    "text"
+typeMailbox : String
+typeMailbox =
+    "mailbox"
 
 
-typeActive : String
-typeActive =
-    "active"
+typeSubject : String
+typeSubject =
+    "subject"
 
 
-typeBucket : String
-typeBucket =
-    "bucket"
+typeRegex : String
+typeRegex =
+    "regex"
 
 
-typeOrg : String
-typeOrg =
-    "org"
+typeColumn : String
+typeColumn =
+    "column"
 
 
-typeDisable : String
-typeDisable =
-    "disable"
+typeAccessKey : String
+typeAccessKey =
+    "accessKey"
 
 
-typeIndex : String
-typeIndex =
-    "index"
+typeSecretKey : String
+typeSecretKey =
+    "secretKey"
 
 
-typeFrequency : String
-typeFrequency =
-    "frequency"
+typeSessionToken : String
+typeSessionToken =
+    "sessionToken"
 
 
-typeAmplitude : String
-typeAmplitude =
-    "amplitude"
+typePrefix : String
+typePrefix =
+    "prefix"
 
 
-typeSampleRate : String
-typeSampleRate =
-    "sampleRate"
+typeEncryptionKey : String
+typeEncryptionKey =
+    "encryptionKey"
 
 
+typeExportPeriod : String
+typeExportPeriod =
+    "exportPeriod"
 
--- Point should match data/Point.go
 
+typeBackupPeriod : String
+typeBackupPeriod =
+    "backupPeriod"
 
-type alias Point =
-    { typ : String
-    , key : String
-    , time : Time.Posix
-    , index : Float
-    , value : Float
-    , text : String
-    , tombstone : Int
-    }
 
+typeBrokers : String
+typeBrokers =
+    "brokers"
 
-empty : Point
-empty =
-    Point
-        ""
-        ""
-        (Time.millisToPosix 0)
-        0
-        0
-        ""
-        0
 
+typeTopic : String
+typeTopic =
+    "topic"
 
-newValue : String -> String -> Float -> Point
-newValue typ key value =
-    { typ = typ
-    , key = key
-    , time = Time.millisToPosix 0
-    , index = 0
-    , value = value
-    , text = ""
-    , tombstone = 0
-    }
 
+typePointTypes : String
+typePointTypes =
+    "pointTypes"
 
-newText : String -> String -> String -> Point
-newText typ key text =
-    { typ = typ
-    , key = key
-    , time = Time.millisToPosix 0
-    , index = 0
-    , value = 0
-    , text = text
-    , tombstone = 0
-    }
 
+typeSchemaRegistry : String
+typeSchemaRegistry =
+    "schemaRegistry"
 
-specialPoints : List String
-specialPoints =
-    [ typeDescription
-    , typeVersionHW
-    , typeVersionOS
-    , typeVersionApp
-    , typeBaud
-    , typeDebug
-    , typeDisable
-    , typeErrorCount
-    , typeErrorCountReset
-    , typeLog
-    , typePort
-    , typeRx
-    , typeRxReset
-    , typeTx
-    , typeTxReset
-    ]
 
+typeTLS : String
+typeTLS =
+    "tls"
 
-filterSpecialPoints : List Point -> List Point
-filterSpecialPoints points =
-    List.filter (\p -> not <| List.member p.typ specialPoints) points
 
+typeTLSCert : String
+typeTLSCert =
+    "tlsCert"
 
-encode : Point -> Json.Encode.Value
-encode p =
-    Json.Encode.object
-        [ ( "type", Json.Encode.string <| p.typ )
-        , ( "key", Json.Encode.string <| p.key )
-        , ( "time", Iso8601.encode <| p.time )
-        , ( "index", Json.Encode.float <| p.index )
-        , ( "value", Json.Encode.float <| p.value )
-        , ( "text", Json.Encode.string <| p.text )
-        , ( "tombstone", Json.Encode.int <| p.tombstone )
-        ]
 
+typeTLSKey : String
+typeTLSKey =
+    "tlsKey"
 
-encodeList : List Point -> Json.Encode.Value
-encodeList p =
-    Json.Encode.list encode p
 
+typeSecurityPolicy : String
+typeSecurityPolicy =
+    "securityPolicy"
 
-decode : Decode.Decoder Point
-decode =
-    Decode.succeed Point
-        |> optional "type" Decode.string ""
-        |> optional "key" Decode.string ""
-        |> optional "time" Json.Decode.Extra.datetime (Time.millisToPosix 0)
-        |> optional "index" Decode.float 0
-        |> optional "value" Decode.float 0
-        |> optional "text" Decode.string ""
-        |> optional "tombstone" Decode.int 0
 
+typeSecurityMode : String
+typeSecurityMode =
+    "securityMode"
 
-renderPoint : Point -> String
-renderPoint s =
-    let
-        key =
-            if s.key == "" then
-                ""
 
-            else
-                s.key ++ ":"
+typeOpcUANodeID : String
+typeOpcUANodeID =
+    "opcuaNodeID"
 
-        index =
-            if s.index /= 0 then
-                Round.round 1 s.index ++ ":"
 
-            else
-                ""
+typeBrowse : String
+typeBrowse =
+    "browse"
 
-        value =
-            if s.text /= "" then
-                s.text
 
-            else
-                Round.round 2 s.value
-    in
-    s.typ ++ key ++ index ++ ": " ++ value
+typeBroadcastAddress : String
+typeBroadcastAddress =
+    "broadcastAddress"
 
 
-updatePoint : List Point -> Point -> List Point
-updatePoint points point =
-    case
-        List.Extra.findIndex
-            (\p ->
-                point.typ == p.typ && point.key == p.key
-            )
-            points
-    of
-        Just index ->
-            List.Extra.setAt index point points
+typeDiscover : String
+typeDiscover =
+    "discover"
 
-        Nothing ->
-            point :: points
 
+typeBacnetDeviceID : String
+typeBacnetDeviceID =
+    "bacnetDeviceID"
 
-updatePoints : List Point -> List Point -> List Point
-updatePoints points newPoints =
-    List.foldr
-        (\newPoint updatedPoints -> updatePoint updatedPoints newPoint)
-        points
-        newPoints
 
+typeBacnetObjectType : String
+typeBacnetObjectType =
+    "bacnetObjectType"
 
-get : List Point -> String -> String -> Maybe Point
-get points typ key =
-    List.Extra.find
-        (\p ->
-            typ == p.typ && key == p.key
-        )
-        points
 
+typeBacnetInstance : String
+typeBacnetInstance =
+    "bacnetInstance"
 
-getText : List Point -> String -> String -> String
-getText points typ key =
-    case
-        get points typ key
-    of
-        Just found ->
-            found.text
 
-        Nothing ->
-            ""
+typeCOV : String
+typeCOV =
+    "cov"
 
 
-getBestDesc : List Point -> String
-getBestDesc points =
-    let
-        firstName =
-            getText points typeFirstName ""
+typeSnmpVersion : String
+typeSnmpVersion =
+    "snmpVersion"
 
-        desc =
-            getText points typeDescription ""
-    in
-    if firstName /= "" then
-        firstName ++ " " ++ getText points typeLastName ""
 
-    else if desc /= "" then
-        desc
+typeCommunity : String
+typeCommunity =
+    "community"
 
-    else
-        "no description"
 
+typeAuthProtocol : String
+typeAuthProtocol =
+    "authProtocol"
 
-getValue : List Point -> String -> String -> Float
-getValue points typ key =
-    case
-        get points typ key
-    of
-        Just found ->
-            found.value
 
-        Nothing ->
-            0
+typePrivProtocol : String
+typePrivProtocol =
+    "privProtocol"
 
 
-getBool : List Point -> String -> String -> Bool
-getBool points typ key =
-    getValue points typ key == 1
+typePrivPass : String
+typePrivPass =
+    "privPass"
 
 
-getLatest : List Point -> Maybe Point
-getLatest points =
-    List.foldl
-        (\p result ->
-            case result of
-                Just point ->
-                    if Time.posixToMillis p.time > Time.posixToMillis point.time then
-                        Just p
+typeTrapPort : String
+typeTrapPort =
+    "trapPort"
 
-                    else
-                        Just point
 
-                Nothing ->
-                    Just p
-        )
-        Nothing
-        points
+typeOID : String
+typeOID =
+    "oid"
+
+
+typeTrap : String
+typeTrap =
+    "trap"
+
+
+typeDbcFile : String
+typeDbcFile =
+    "dbcFile"
+
+
+typeCanID : String
+typeCanID =
+    "canID"
+
+
+typeExtended : String
+typeExtended =
+    "extended"
+
+
+typeJ1939 : String
+typeJ1939 =
+    "j1939"
+
+
+typeSpn : String
+typeSpn =
+    "spn"
+
+
+valueSnmpV2c : String
+valueSnmpV2c =
+    "2c"
+
+
+valueSnmpV3 : String
+valueSnmpV3 =
+    "3"
+
+
+valueJSON : String
+valueJSON =
+    "json"
+
+
+valueAvro : String
+valueAvro =
+    "avro"
+
+
+typeRawPeriod : String
+typeRawPeriod =
+    "rawPeriod"
+
+
+typeDownsampleInterval : String
+typeDownsampleInterval =
+    "downsampleInterval"
+
+
+typeDownsamplePeriod : String
+typeDownsamplePeriod =
+    "downsamplePeriod"
+
+
+typeBatchSize : String
+typeBatchSize =
+    "batchSize"
+
+
+typeBatchPeriod : String
+typeBatchPeriod =
+    "batchPeriod"
+
+
+typeSpoolDir : String
+typeSpoolDir =
+    "spoolDir"
+
+
+typeMaxSpool : String
+typeMaxSpool =
+    "maxSpool"
+
+
+valueProtobuf : String
+valueProtobuf =
+    "protobuf"
+
+
+typeSecret : String
+typeSecret =
+    "secret"
+
+
+typeOnCreate : String
+typeOnCreate =
+    "onCreate"
+
+
+typeOnDelete : String
+typeOnDelete =
+    "onDelete"
+
+
+typeNodeTypes : String
+typeNodeTypes =
+    "nodeTypes"
+
+
+typeDuration : String
+typeDuration =
+    "duration"
+
+
+typeRun : String
+typeRun =
+    "run"
+
+
+typePause : String
+typePause =
+    "pause"
+
+
+typeAdvance : String
+typeAdvance =
+    "advance"
+
+
+typeRainNodeID : String
+typeRainNodeID =
+    "rainNodeID"
+
+
+typeRainPointType : String
+typeRainPointType =
+    "rainPointType"
+
+
+typeRainDelay : String
+typeRainDelay =
+    "rainDelay"
+
+
+typeActiveZone : String
+typeActiveZone =
+    "activeZone"
+
+
+typeZoneRemaining : String
+typeZoneRemaining =
+    "zoneRemaining"
+
+
+typeRemaining : String
+typeRemaining =
+    "remaining"
+
+
+typeLatitude : String
+typeLatitude =
+    "latitude"
+
+
+typeLongitude : String
+typeLongitude =
+    "longitude"
+
+
+typeDuskOffset : String
+typeDuskOffset =
+    "duskOffset"
+
+
+typeDawnOffset : String
+typeDawnOffset =
+    "dawnOffset"
+
+
+typeOutputNodeID : String
+typeOutputNodeID =
+    "outputNodeID"
+
+
+typeOutputPointType : String
+typeOutputPointType =
+    "outputPointType"
+
+
+typeOutputMax : String
+typeOutputMax =
+    "outputMax"
+
+
+typeOccupancyNodeID : String
+typeOccupancyNodeID =
+    "occupancyNodeID"
+
+
+typeOccupancyPointType : String
+typeOccupancyPointType =
+    "occupancyPointType"
+
+
+typeOccupancyTimeout : String
+typeOccupancyTimeout =
+    "occupancyTimeout"
+
+
+typeLevel : String
+typeLevel =
+    "level"
+
+
+typeOccupiedLevel : String
+typeOccupiedLevel =
+    "occupiedLevel"
+
+
+typeCurve : String
+typeCurve =
+    "curve"
+
+
+valueLinear : String
+valueLinear =
+    "linear"
+
+
+valueSquare : String
+valueSquare =
+    "square"
+
+
+valueCIE : String
+valueCIE =
+    "cie"
+
+
+typeOverride : String
+typeOverride =
+    "override"
+
+
+typeOverrideLevel : String
+typeOverrideLevel =
+    "overrideLevel"
+
+
+typeOverrideTimeout : String
+typeOverrideTimeout =
+    "overrideTimeout"
+
+
+typeDark : String
+typeDark =
+    "dark"
+
+
+typeOccupied : String
+typeOccupied =
+    "occupied"
+
+
+typeActiveLevel : String
+typeActiveLevel =
+    "activeLevel"
+
+
+typeShape : String
+typeShape =
+    "shape"
+
+
+valueVertical : String
+valueVertical =
+    "vertical"
+
+
+valueHorizontal : String
+valueHorizontal =
+    "horizontal"
+
+
+valueRectangular : String
+valueRectangular =
+    "rectangular"
+
+
+valueTable : String
+valueTable =
+    "table"
+
+
+typeDiameter : String
+typeDiameter =
+    "diameter"
+
+
+typeLength : String
+typeLength =
+    "length"
+
+
+typeWidth : String
+typeWidth =
+    "width"
+
+
+typeHeight : String
+typeHeight =
+    "height"
+
+
+typeVolumeScale : String
+typeVolumeScale =
+    "volumeScale"
+
+
+typeStrapping : String
+typeStrapping =
+    "strapping"
+
+
+typeLevelNodeID : String
+typeLevelNodeID =
+    "levelNodeID"
+
+
+typeLevelPointType : String
+typeLevelPointType =
+    "levelPointType"
+
+
+typeLevelOffset : String
+typeLevelOffset =
+    "levelOffset"
+
+
+typeFromTop : String
+typeFromTop =
+    "fromTop"
+
+
+typeRateWindow : String
+typeRateWindow =
+    "rateWindow"
+
+
+typeLeakRate : String
+typeLeakRate =
+    "leakRate"
+
+
+typeLeakDelay : String
+typeLeakDelay =
+    "leakDelay"
+
+
+typeVolume : String
+typeVolume =
+    "volume"
+
+
+typePercent : String
+typePercent =
+    "percent"
+
+
+typeRate : String
+typeRate =
+    "rate"
+
+
+typeLeak : String
+typeLeak =
+    "leak"
+
+
+typeDemand : String
+typeDemand =
+    "demand"
+
+
+typeFeedbackTimeout : String
+typeFeedbackTimeout =
+    "feedbackTimeout"
+
+
+typeLead : String
+typeLead =
+    "lead"
+
+
+typeRunning : String
+typeRunning =
+    "running"
+
+
+typeFeedbackNodeID : String
+typeFeedbackNodeID =
+    "feedbackNodeID"
+
+
+typeFeedbackPointType : String
+typeFeedbackPointType =
+    "feedbackPointType"
+
+
+typeRuntime : String
+typeRuntime =
+    "runtime"
+
+
+typeFailed : String
+typeFailed =
+    "failed"
+
+
+typeProfile : String
+typeProfile =
+    "profile"
+
+
+typeModbusNodeID : String
+typeModbusNodeID =
+    "modbusNodeID"
+
+
+typeModbusID : String
+typeModbusID =
+    "modbusID"
+
+
+typeRunNodeID : String
+typeRunNodeID =
+    "runNodeID"
+
+
+typeRunThreshold : String
+typeRunThreshold =
+    "runThreshold"
+
+
+typeFuelNodeID : String
+typeFuelNodeID =
+    "fuelNodeID"
+
+
+typeBatteryNodeID : String
+typeBatteryNodeID =
+    "batteryNodeID"
+
+
+typeAtsNodeID : String
+typeAtsNodeID =
+    "atsNodeID"
+
+
+typeStartNodeID : String
+typeStartNodeID =
+    "startNodeID"
+
+
+typeStartTimeout : String
+typeStartTimeout =
+    "startTimeout"
+
+
+typeFuelLow : String
+typeFuelLow =
+    "fuelLow"
+
+
+typeBatteryLow : String
+typeBatteryLow =
+    "batteryLow"
+
+
+typeExerciseWeekday : String
+typeExerciseWeekday =
+    "exerciseWeekday"
+
+
+typeExerciseStart : String
+typeExerciseStart =
+    "exerciseStart"
+
+
+typeExerciseDuration : String
+typeExerciseDuration =
+    "exerciseDuration"
+
+
+typeRemoteStart : String
+typeRemoteStart =
+    "remoteStart"
+
+
+typeExercise : String
+typeExercise =
+    "exercise"
+
+
+typeFuelLevel : String
+typeFuelLevel =
+    "fuelLevel"
+
+
+typeBatteryVoltage : String
+typeBatteryVoltage =
+    "batteryVoltage"
+
+
+typeOnGenerator : String
+typeOnGenerator =
+    "onGenerator"
+
+
+typeFailToStart : String
+typeFailToStart =
+    "failToStart"
+
+
+typeLowFuel : String
+typeLowFuel =
+    "lowFuel"
+
+
+typeLowBattery : String
+typeLowBattery =
+    "lowBattery"
+
+
+valueDSE : String
+valueDSE =
+    "dse"
+
+
+valueComAp : String
+valueComAp =
+    "comap"
+
+
+typeMode : String
+typeMode =
+    "mode"
+
+
+typeTempNodeID : String
+typeTempNodeID =
+    "tempNodeID"
+
+
+typeOutdoorNodeID : String
+typeOutdoorNodeID =
+    "outdoorNodeID"
+
+
+typeHeatSetpoint : String
+typeHeatSetpoint =
+    "heatSetpoint"
+
+
+typeCoolSetpoint : String
+typeCoolSetpoint =
+    "coolSetpoint"
+
+
+typeSetbackHeat : String
+typeSetbackHeat =
+    "setbackHeat"
+
+
+typeSetbackCool : String
+typeSetbackCool =
+    "setbackCool"
+
+
+typeOccupiedStart : String
+typeOccupiedStart =
+    "occupiedStart"
+
+
+typeOccupiedEnd : String
+typeOccupiedEnd =
+    "occupiedEnd"
+
+
+typeDifferential : String
+typeDifferential =
+    "differential"
+
+
+typeStageDelay : String
+typeStageDelay =
+    "stageDelay"
+
+
+typeMinRun : String
+typeMinRun =
+    "minRun"
+
+
+typeMinOff : String
+typeMinOff =
+    "minOff"
+
+
+typeEconomizerNodeID : String
+typeEconomizerNodeID =
+    "economizerNodeID"
+
+
+typeEconomizerTemp : String
+typeEconomizerTemp =
+    "economizerTemp"
+
+
+typeFanNodeID : String
+typeFanNodeID =
+    "fanNodeID"
+
+
+typeHeatStage : String
+typeHeatStage =
+    "heatStage"
+
+
+typeCoolStage : String
+typeCoolStage =
+    "coolStage"
+
+
+typeEconomizing : String
+typeEconomizing =
+    "economizing"
+
+
+typeStageType : String
+typeStageType =
+    "stageType"
+
+
+valueHeat : String
+valueHeat =
+    "heat"
+
+
+valueCool : String
+valueCool =
+    "cool"
+
+
+valueAuto : String
+valueAuto =
+    "auto"
+
+
+typeTempPointType : String
+typeTempPointType =
+    "tempPointType"
+
+
+typeLowLimit : String
+typeLowLimit =
+    "lowLimit"
+
+
+typeHighLimit : String
+typeHighLimit =
+    "highLimit"
+
+
+typeExcursionDelay : String
+typeExcursionDelay =
+    "excursionDelay"
+
+
+typeExcursion : String
+typeExcursion =
+    "excursion"
+
+
+typeUnsigned : String
+typeUnsigned =
+    "unsigned"
+
+
+typeLimitType : String
+typeLimitType =
+    "limitType"
+
+
+valueHigh : String
+valueHigh =
+    "high"
+
+
+valueLow : String
+valueLow =
+    "low"
+
+
+typeLimit : String
+typeLimit =
+    "limit"
+
+
+typePeak : String
+typePeak =
+    "peak"
+
+
+typeSignOff : String
+typeSignOff =
+    "signOff"
+
+
+typeSignOffBy : String
+typeSignOffBy =
+    "signOffBy"
+
+
+typeSignOffTime : String
+typeSignOffTime =
+    "signOffTime"
+
+
+typeComment : String
+typeComment =
+    "comment"
+
+
+typeSensorNodeID : String
+typeSensorNodeID =
+    "sensorNodeID"
+
+
+typeSensorPointType : String
+typeSensorPointType =
+    "sensorPointType"
+
+
+typeSetpoint : String
+typeSetpoint =
+    "setpoint"
+
+
+typeDirection : String
+typeDirection =
+    "direction"
+
+
+valueRaise : String
+valueRaise =
+    "raise"
+
+
+valueLower : String
+valueLower =
+    "lower"
+
+
+typeGain : String
+typeGain =
+    "gain"
+
+
+typeDeadband : String
+typeDeadband =
+    "deadband"
+
+
+typePeriod : String
+typePeriod =
+    "period"
+
+
+typeMaxDuty : String
+typeMaxDuty =
+    "maxDuty"
+
+
+typeFlowRate : String
+typeFlowRate =
+    "flowRate"
+
+
+typeDailyLimit : String
+typeDailyLimit =
+    "dailyLimit"
+
+
+typeInterlockNodeID : String
+typeInterlockNodeID =
+    "interlockNodeID"
+
+
+typeSensorTimeout : String
+typeSensorTimeout =
+    "sensorTimeout"
+
+
+typeDuty : String
+typeDuty =
+    "duty"
+
+
+typeDoseToday : String
+typeDoseToday =
+    "doseToday"
+
+
+typeDoseDate : String
+typeDoseDate =
+    "doseDate"
+
+
+typeInterlocked : String
+typeInterlocked =
+    "interlocked"
+
+
+typeLimitReached : String
+typeLimitReached =
+    "limitReached"
+
+
+typeGcAge : String
+typeGcAge =
+    "gcAge"
+
+
+typeGcPeriod : String
+typeGcPeriod =
+    "gcPeriod"
+
+
+typeGcDryRun : String
+typeGcDryRun =
+    "gcDryRun"
+
+
+typeGcEdges : String
+typeGcEdges =
+    "gcEdges"
+
+
+typeGcNodes : String
+typeGcNodes =
+    "gcNodes"
+
+
+typeGcKeys : String
+typeGcKeys =
+    "gcKeys"
+
+
+typeGcPoints : String
+typeGcPoints =
+    "gcPoints"
+
+
+typeKeyTypes : String
+typeKeyTypes =
+    "keyTypes"
+
+
+typeKeyAge : String
+typeKeyAge =
+    "keyAge"
+
+
+typeKeyLimit : String
+typeKeyLimit =
+    "keyLimit"
+
+
+typeMaxNodes : String
+typeMaxNodes =
+    "maxNodes"
+
+
+typeMaxPointRate : String
+typeMaxPointRate =
+    "maxPointRate"
+
+
+typeMaxHistoryBytes : String
+typeMaxHistoryBytes =
+    "maxHistoryBytes"
+
+
+typeNodeCount : String
+typeNodeCount =
+    "nodeCount"
+
+
+typePointRate : String
+typePointRate =
+    "pointRate"
+
+
+typeHistoryBytes : String
+typeHistoryBytes =
+    "historyBytes"
+
+
+typeOverQuota : String
+typeOverQuota =
+    "overQuota"
+
+
+typeRejected : String
+typeRejected =
+    "rejected"
+
+
+typeWindowSize : String
+typeWindowSize =
+    "windowSize"
+
+
+typeRms : String
+typeRms =
+    "rms"
+
+
+typeCrestFactor : String
+typeCrestFactor =
+    "crestFactor"
+
+
+typeKurtosis : String
+typeKurtosis =
+    "kurtosis"
+
+
+typeLowFrequency : String
+typeLowFrequency =
+    "lowFrequency"
+
+
+typeHighFrequency : String
+typeHighFrequency =
+    "highFrequency"
+
+
+typeResetTime : String
+typeResetTime =
+    "resetTime"
+
+
+typeLastReset : String
+typeLastReset =
+    "lastReset"
+
+
+typeCapacity : String
+typeCapacity =
+    "capacity"
+
+
+typeEntryNodeID : String
+typeEntryNodeID =
+    "entryNodeID"
+
+
+typeEntryPointType : String
+typeEntryPointType =
+    "entryPointType"
+
+
+typeExitNodeID : String
+typeExitNodeID =
+    "exitNodeID"
+
+
+typeExitPointType : String
+typeExitPointType =
+    "exitPointType"
+
+
+typeCounterType : String
+typeCounterType =
+    "counterType"
+
+
+valueEvent : String
+valueEvent =
+    "event"
+
+
+valueTotal : String
+valueTotal =
+    "total"
+
+
+typeOccupancy : String
+typeOccupancy =
+    "occupancy"
+
+
+typeEntriesToday : String
+typeEntriesToday =
+    "entriesToday"
+
+
+typeExitsToday : String
+typeExitsToday =
+    "exitsToday"
+
+
+typePeakOccupancy : String
+typePeakOccupancy =
+    "peakOccupancy"
+
+
+typeOverCapacity : String
+typeOverCapacity =
+    "overCapacity"
+
+
+typeGoldenNodeID : String
+typeGoldenNodeID =
+    "goldenNodeID"
+
+
+typeTag : String
+typeTag =
+    "tag"
+
+
+typeIgnorePointTypes : String
+typeIgnorePointTypes =
+    "ignorePointTypes"
+
+
+typeDevices : String
+typeDevices =
+    "devices"
+
+
+typeDrifted : String
+typeDrifted =
+    "drifted"
+
+
+typeDeviceNodeID : String
+typeDeviceNodeID =
+    "deviceNodeID"
+
+
+typeDifferences : String
+typeDifferences =
+    "differences"
+
+
+typeCount : String
+typeCount =
+    "count"
+
+
+typeReapply : String
+typeReapply =
+    "reapply"
+
+
+typeClientCrashes : String
+typeClientCrashes =
+    "clientCrashes"
+
+
+typeClientError : String
+typeClientError =
+    "clientError"
+
+
+typeClientCrashLoop : String
+typeClientCrashLoop =
+    "clientCrashLoop"
+
+
+typeTechnician : String
+typeTechnician =
+    "technician"
+
+
+typeReport : String
+typeReport =
+    "report"
+
+
+typeDetail : String
+typeDetail =
+    "detail"
+
+
+typePassed : String
+typePassed =
+    "passed"
+
+
+typeCheckType : String
+typeCheckType =
+    "checkType"
+
+
+typeMaxAge : String
+typeMaxAge =
+    "maxAge"
+
+
+typeResult : String
+typeResult =
+    "result"
+
+
+typeResultTime : String
+typeResultTime =
+    "resultTime"
+
+
+valueSensor : String
+valueSensor =
+    "sensor"
+
+
+valueOutput : String
+valueOutput =
+    "output"
+
+
+valueSync : String
+valueSync =
+    "sync"
+
+
+valueManual : String
+valueManual =
+    "manual"
+
+
+valuePass : String
+valuePass =
+    "pass"
+
+
+valueFail : String
+valueFail =
+    "fail"
+
+
+typeOffline : String
+typeOffline =
+    "offline"
+
+
+typeClientType : String
+typeClientType =
+    "clientType"
+
+
+typeSecretValue : String
+typeSecretValue =
+    "secretValue"
+
+
+typeProvisionURL : String
+typeProvisionURL =
+    "provisionURL"
+
+
+typeAttestationKey : String
+typeAttestationKey =
+    "attestationKey"
+
+
+typeAttested : String
+typeAttested =
+    "attested"
+
+
+typeProxy : String
+typeProxy =
+    "proxy"
+
+
+typeTransport : String
+typeTransport =
+    "transport"
+
+
+typeWsPath : String
+typeWsPath =
+    "wsPath"
+
+
+valueNats : String
+valueNats =
+    "nats"
+
+
+valueWebSocket : String
+valueWebSocket =
+    "websocket"
+
+
+typeSourceNodeID : String
+typeSourceNodeID =
+    "sourceNodeID"
+
+
+typeSourcePointType : String
+typeSourcePointType =
+    "sourcePointType"
+
+
+typeSourcePointKey : String
+typeSourcePointKey =
+    "sourcePointKey"
+
+
+typeOperation : String
+typeOperation =
+    "operation"
+
+
+typeWindow : String
+typeWindow =
+    "window"
+
+
+valueDelta : String
+valueDelta =
+    "delta"
+
+
+valueRate : String
+valueRate =
+    "rate"
+
+
+valueAverage : String
+valueAverage =
+    "average"
+
+
+valueMin : String
+valueMin =
+    "min"
+
+
+valueMax : String
+valueMax =
+    "max"
+
+
+typeArchived : String
+typeArchived =
+    "archived"
+
+
+typeDeviceUnits : String
+typeDeviceUnits =
+    "deviceUnits"
+
+
+typeTimezone : String
+typeTimezone =
+    "timezone"
+
+
+typeDelimiter : String
+typeDelimiter =
+    "delimiter"
+
+
+typeFormat : String
+typeFormat =
+    "format"
+
+
+typeHostKey : String
+typeHostKey =
+    "hostKey"
+
+
+typeKnownHosts : String
+typeKnownHosts =
+    "knownHosts"
+
+
+typePattern : String
+typePattern =
+    "pattern"
+
+
+typeProcessedDir : String
+typeProcessedDir =
+    "processedDir"
+
+
+typeRecordElement : String
+typeRecordElement =
+    "recordElement"
+
+
+typeTimeColumn : String
+typeTimeColumn =
+    "timeColumn"
+
+
+typeTimeFormat : String
+typeTimeFormat =
+    "timeFormat"
+
+
+typeVariableType : String
+typeVariableType =
+    "variableType"
+
+
+typeNodeType : String
+typeNodeType =
+    "nodeType"
+
+
+typeNodeID : String
+typeNodeID =
+    "nodeID"
+
+
+typeTombstone : String
+typeTombstone =
+    "tombstone"
+
+
+valueOnOff : String
+valueOnOff =
+    "onOff"
+
+
+valueNumber : String
+valueNumber =
+    "number"
+
+
+valueText : String
+valueText =
+    "text"
+
+
+typeActive : String
+typeActive =
+    "active"
+
+
+typeBucket : String
+typeBucket =
+    "bucket"
+
+
+typeOrg : String
+typeOrg =
+    "org"
+
+
+typeDisable : String
+typeDisable =
+    "disable"
+
+
+typeIndex : String
+typeIndex =
+    "index"
+
+
+typeFrequency : String
+typeFrequency =
+    "frequency"
+
+
+typeAmplitude : String
+typeAmplitude =
+    "amplitude"
+
+
+typeSampleRate : String
+typeSampleRate =
+    "sampleRate"
+
+
+
+-- Point should match data/Point.go
+
+
+type alias Point =
+    { typ : String
+    , key : String
+    , time : Time.Posix
+    , index : Float
+    , value : Float
+    , text : String
+    , tombstone : Int
+    , origin : String
+    }
+
+
+empty : Point
+empty =
+    Point
+        ""
+        ""
+        (Time.millisToPosix 0)
+        0
+        0
+        ""
+        0
+        ""
+
+
+newValue : String -> String -> Float -> Point
+newValue typ key value =
+    { typ = typ
+    , key = key
+    , time = Time.millisToPosix 0
+    , index = 0
+    , value = value
+    , text = ""
+    , tombstone = 0
+    , origin = ""
+    }
+
+
+newText : String -> String -> String -> Point
+newText typ key text =
+    { typ = typ
+    , key = key
+    , time = Time.millisToPosix 0
+    , index = 0
+    , value = 0
+    , text = text
+    , tombstone = 0
+    , origin = ""
+    }
+
+
+specialPoints : List String
+specialPoints =
+    [ typeDescription
+    , typeVersionHW
+    , typeVersionOS
+    , typeVersionApp
+    , typeBaud
+    , typeDebug
+    , typeDisable
+    , typeErrorCount
+    , typeErrorCountReset
+    , typeLog
+    , typePort
+    , typeRx
+    , typeRxReset
+    , typeTx
+    , typeTxReset
+    ]
+
+
+filterSpecialPoints : List Point -> List Point
+filterSpecialPoints points =
+    List.filter (\p -> not <| List.member p.typ specialPoints) points
+
+
+encode : Point -> Json.Encode.Value
+encode p =
+    Json.Encode.object
+        [ ( "type", Json.Encode.string <| p.typ )
+        , ( "key", Json.Encode.string <| p.key )
+        , ( "time", Iso8601.encode <| p.time )
+        , ( "index", Json.Encode.float <| p.index )
+        , ( "value", Json.Encode.float <| p.value )
+        , ( "text", Json.Encode.string <| p.text )
+        , ( "tombstone", Json.Encode.int <| p.tombstone )
+        ]
+
+
+encodeList : List Point -> Json.Encode.Value
+encodeList p =
+    Json.Encode.list encode p
+
+
+decode : Decode.Decoder Point
+decode =
+    Decode.succeed Point
+        |> optional "type" Decode.string ""
+        |> optional "key" Decode.string ""
+        |> optional "time" Json.Decode.Extra.datetime (Time.millisToPosix 0)
+        |> optional "index" Decode.float 0
+        |> optional "value" Decode.float 0
+        |> optional "text" Decode.string ""
+        |> optional "tombstone" Decode.int 0
+        |> optional "origin" Decode.string ""
+
+
+renderPoint : Point -> String
+renderPoint s =
+    let
+        key =
+            if s.key == "" then
+                ""
+
+            else
+                s.key ++ ":"
+
+        index =
+            if s.index /= 0 then
+                Round.round 1 s.index ++ ":"
+
+            else
+                ""
+
+        value =
+            if s.text /= "" then
+                s.text
+
+            else
+                Round.round 2 s.value
+
+        origin =
+            if s.origin /= "" then
+                " (by " ++ s.origin ++ ")"
+
+            else
+                ""
+    in
+    s.typ ++ key ++ index ++ ": " ++ value ++ origin
+
+
+updatePoint : List Point -> Point -> List Point
+updatePoint points point =
+    case
+        List.Extra.findIndex
+            (\p ->
+                point.typ == p.typ && point.key == p.key
+            )
+            points
+    of
+        Just index ->
+            List.Extra.setAt index point points
+
+        Nothing ->
+            point :: points
+
+
+updatePoints : List Point -> List Point -> List Point
+updatePoints points newPoints =
+    List.foldr
+        (\newPoint updatedPoints -> updatePoint updatedPoints newPoint)
+        points
+        newPoints
+
+
+get : List Point -> String -> String -> Maybe Point
+get points typ key =
+    List.Extra.find
+        (\p ->
+            typ == p.typ && key == p.key
+        )
+        points
+
+
+
+-- desiredPending returns the desired point of a config point if it has not
+-- been applied yet (see data/shadow.go)
+
+
+desiredPending : List Point -> String -> String -> Maybe Point
+desiredPending points typ key =
+    let
+        typeKey =
+            if key == "" || key == "0" then
+                typ
+
+            else
+                typ ++ "." ++ key
+    in
+    case get points typeDesired typeKey of
+        Just desired ->
+            if modBy 2 desired.tombstone == 1 then
+                Nothing
+
+            else
+                case get points typ key of
+                    Just reported ->
+                        if
+                            Time.posixToMillis desired.time
+                                > Time.posixToMillis reported.time
+                                && (desired.value /= reported.value || desired.text /= reported.text)
+                        then
+                            Just desired
+
+                        else
+                            Nothing
+
+                    Nothing ->
+                        Just desired
+
+        Nothing ->
+            Nothing
+
+
+getText : List Point -> String -> String -> String
+getText points typ key =
+    case
+        get points typ key
+    of
+        Just found ->
+            found.text
+
+        Nothing ->
+            ""
+
+
+getBestDesc : List Point -> String
+getBestDesc points =
+    let
+        firstName =
+            getText points typeFirstName ""
+
+        desc =
+            getText points typeDescription ""
+    in
+    if firstName /= "" then
+        firstName ++ " " ++ getText points typeLastName ""
+
+    else if desc /= "" then
+        desc
+
+    else
+        "no description"
+
+
+getValue : List Point -> String -> String -> Float
+getValue points typ key =
+    case
+        get points typ key
+    of
+        Just found ->
+            found.value
+
+        Nothing ->
+            0
+
+
+getBool : List Point -> String -> String -> Bool
+getBool points typ key =
+    getValue points typ key == 1
+
+
+getLatest : List Point -> Maybe Point
+getLatest points =
+    List.foldl
+        (\p result ->
+            case result of
+                Just point ->
+                    if Time.posixToMillis p.time > Time.posixToMillis point.time then
+                        Just p
+
+                    else
+                        Just point
+
+                Nothing ->
+                    Just p
+        )
+        Nothing
+        points
 
 
 
@@ -987,3 +2960,4 @@ sort a b =
 
     else
         compare a.value b.value
+
@@ -0,0 +1,101 @@
+module Api.Schema exposing
+    ( NodeSchema
+    , PointSchema
+    , find
+    , kindBool
+    , kindText
+    , kindValue
+    , list
+    )
+
+import Api.Data exposing (Data)
+import Http
+import Json.Decode as Decode
+import Json.Decode.Pipeline exposing (optional, required)
+import Url.Builder
+
+
+
+-- point schemas registered for node types in the backend, used to build
+-- edit forms for node types the frontend does not have a view for
+
+
+type alias NodeSchema =
+    { nodeType : String
+    , points : List PointSchema
+    }
+
+
+type alias PointSchema =
+    { typ : String
+    , kind : String
+    , label : String
+    , units : String
+    , min : Maybe Float
+    , max : Maybe Float
+    , options : List String
+    , status : Bool
+    }
+
+
+kindValue : String
+kindValue =
+    "value"
+
+
+kindBool : String
+kindBool =
+    "bool"
+
+
+kindText : String
+kindText =
+    "text"
+
+
+find : List NodeSchema -> String -> Maybe NodeSchema
+find schemas nodeType =
+    List.filter (\s -> s.nodeType == nodeType) schemas
+        |> List.head
+
+
+decodeList : Decode.Decoder (List NodeSchema)
+decodeList =
+    Decode.list decode
+
+
+decode : Decode.Decoder NodeSchema
+decode =
+    Decode.succeed NodeSchema
+        |> required "nodeType" Decode.string
+        |> optional "points" (Decode.list decodePoint) []
+
+
+decodePoint : Decode.Decoder PointSchema
+decodePoint =
+    Decode.succeed PointSchema
+        |> required "type" Decode.string
+        |> required "kind" Decode.string
+        |> optional "label" Decode.string ""
+        |> optional "units" Decode.string ""
+        |> optional "min" (Decode.nullable Decode.float) Nothing
+        |> optional "max" (Decode.nullable Decode.float) Nothing
+        |> optional "options" (Decode.list Decode.string) []
+        |> optional "status" Decode.bool False
+
+
+list :
+    { token : String
+    , onResponse : Data (List NodeSchema) -> msg
+    }
+    -> Cmd msg
+list options =
+    Http.request
+        { method = "GET"
+        , headers = [ Http.header "Authorization" <| "Bearer " ++ options.token ]
+        , url = Url.Builder.absolute [ "v1", "schemas" ] []
+        , expect = Api.Data.expectJson options.onResponse decodeList
+        , body = Http.emptyBody
+        , timeout = Nothing
+        , tracker = Nothing
+        }
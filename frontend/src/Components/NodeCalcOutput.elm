@@ -0,0 +1,62 @@
+module Components.NodeCalcOutput exposing (view)
+
+import Api.Point as Point
+import Components.NodeOptions exposing (NodeOptions, oToInputO)
+import Element exposing (..)
+import Element.Border as Border
+import Round
+import UI.Icon as Icon
+import UI.NodeInputs as NodeInputs
+import UI.Style as Style
+
+
+view : NodeOptions msg -> Element msg
+view o =
+    let
+        labelWidth =
+            150
+
+        opts =
+            oToInputO o labelWidth
+
+        textInput =
+            NodeInputs.nodeTextInput opts ""
+
+        optionInput =
+            NodeInputs.nodeOptionInput opts ""
+
+        numberInput =
+            NodeInputs.nodeNumberInput opts ""
+
+        value =
+            Point.getValue o.node.points Point.typeValue ""
+    in
+    column
+        [ width fill
+        , Border.widthEach { top = 2, bottom = 0, left = 0, right = 0 }
+        , Border.color Style.colors.black
+        , spacing 6
+        ]
+    <|
+        wrappedRow [ spacing 10 ]
+            [ Icon.trendingUp
+            , text <|
+                Point.getText o.node.points Point.typeDescription ""
+            , text <| Round.round 3 value
+            ]
+            :: (if o.expDetail then
+                    [ textInput Point.typeDescription "Description" ""
+                    , optionInput Point.typeOperation
+                        "Operation"
+                        [ ( Point.valueDelta, "delta" )
+                        , ( Point.valueRate, "rate (units/s)" )
+                        , ( Point.valueAverage, "average" )
+                        , ( Point.valueMin, "min" )
+                        , ( Point.valueMax, "max" )
+                        ]
+                    , numberInput Point.typeWindow "Window (s)"
+                    ]
+
+                else
+                    []
+               )
@@ -0,0 +1,58 @@
+module Components.NodeCanBus exposing (view)
+
+import Api.Point as Point
+import Components.NodeOptions exposing (NodeOptions, oToInputO)
+import Element exposing (..)
+import Element.Border as Border
+import UI.Icon as Icon
+import UI.NodeInputs as NodeInputs
+import UI.Style as Style
+import UI.ViewIf exposing (viewIf)
+
+
+view : NodeOptions msg -> Element msg
+view o =
+    let
+        labelWidth =
+            150
+
+        opts =
+            oToInputO o labelWidth
+
+        textInput =
+            NodeInputs.nodeTextInput opts ""
+
+        checkboxInput =
+            NodeInputs.nodeCheckboxInput opts ""
+
+        disabled =
+            Point.getBool o.node.points Point.typeDisable ""
+
+        errorCount =
+            String.fromFloat <| Point.getValue o.node.points Point.typeErrorCount ""
+    in
+    column
+        [ width fill
+        , Border.widthEach { top = 2, bottom = 0, left = 0, right = 0 }
+        , Border.color Style.colors.black
+        , spacing 6
+        ]
+    <|
+        wrappedRow [ spacing 10 ]
+            [ Icon.bus
+            , text <|
+                Point.getText o.node.points Point.typeDescription ""
+            , viewIf disabled <| text "(disabled)"
+            ]
+            :: (if o.expDetail then
+                    [ textInput Point.typeDescription "Description" ""
+                    , textInput Point.typeDevice "Interface" "can0"
+                    , textInput Point.typeDbcFile "DBC file" "/etc/siot/vehicle.dbc"
+                    , checkboxInput Point.typeJ1939 "J1939"
+                    , checkboxInput Point.typeDisable "Disable"
+                    , text <| "Errors: " ++ errorCount
+                    ]
+
+                else
+                    []
+               )
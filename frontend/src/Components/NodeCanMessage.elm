@@ -0,0 +1,82 @@
+module Components.NodeCanMessage exposing (view)
+
+import Api.Point as Point exposing (Point)
+import Components.NodeOptions exposing (NodeOptions, oToInputO)
+import Element exposing (..)
+import Element.Border as Border
+import Round
+import UI.Icon as Icon
+import UI.NodeInputs as NodeInputs
+import UI.Style exposing (colors)
+
+
+view : NodeOptions msg -> Element msg
+view o =
+    let
+        labelWidth =
+            150
+
+        opts =
+            oToInputO o labelWidth
+
+        textInput =
+            NodeInputs.nodeTextInput opts ""
+
+        numberInput =
+            NodeInputs.nodeNumberInput opts ""
+
+        checkboxInput =
+            NodeInputs.nodeCheckboxInput opts ""
+
+        signals =
+            o.node.points
+                |> List.filter (\p -> p.typ == Point.typeValue)
+                |> List.sortBy .key
+    in
+    column
+        [ width fill
+        , Border.widthEach { top = 2, bottom = 0, left = 0, right = 0 }
+        , Border.color colors.black
+        , spacing 6
+        ]
+    <|
+        wrappedRow [ spacing 10 ]
+            [ Icon.io
+            , text <|
+                Point.getText o.node.points Point.typeDescription ""
+            ]
+            :: List.map (viewSignal o.node.points) signals
+            ++ (if o.expDetail then
+                    [ textInput Point.typeDescription "Description" ""
+                    , numberInput Point.typeCanID "CAN ID"
+                    , checkboxInput Point.typeExtended "Extended ID"
+                    ]
+
+                else
+                    []
+               )
+
+
+viewSignal : List Point -> Point -> Element msg
+viewSignal points p =
+    let
+        value =
+            if p.text /= "" then
+                p.text
+
+            else
+                String.fromFloat (Round.roundNum 2 p.value)
+                    ++ " "
+                    ++ Point.getText points Point.typeUnits p.key
+
+        spn =
+            Point.getValue points Point.typeSpn p.key
+
+        name =
+            if spn /= 0 then
+                p.key ++ " (SPN " ++ String.fromFloat spn ++ ")"
+
+            else
+                p.key
+    in
+    text <| name ++ ": " ++ value
@@ -0,0 +1,131 @@
+module Components.NodeClient exposing (view)
+
+import Api.Point as Point
+import Api.Schema as Schema exposing (NodeSchema, PointSchema)
+import Components.NodeOptions exposing (NodeOptions, oToInputO)
+import Element exposing (..)
+import Element.Border as Border
+import Round
+import UI.Icon as Icon
+import UI.NodeInputs as NodeInputs exposing (NodeInputOptions)
+import UI.Style exposing (colors)
+
+
+
+-- view for node types with a client registered at runtime that the
+-- frontend does not know about. If the backend has a point schema for the
+-- node type, the edit form is built from it.
+
+
+view : Maybe NodeSchema -> NodeOptions msg -> Element msg
+view schema o =
+    let
+        labelWidth =
+            150
+
+        opts =
+            oToInputO o labelWidth
+
+        textInput =
+            NodeInputs.nodeTextInput opts ""
+
+        checkboxInput =
+            NodeInputs.nodeCheckboxInput opts ""
+
+        schemaInputs =
+            case schema of
+                Just s ->
+                    List.map (schemaInput opts) s.points
+
+                Nothing ->
+                    [ checkboxInput Point.typeDisable "Disable" ]
+    in
+    column
+        [ width fill
+        , Border.widthEach { top = 2, bottom = 0, left = 0, right = 0 }
+        , Border.color colors.black
+        , spacing 6
+        ]
+    <|
+        wrappedRow [ spacing 10 ]
+            [ Icon.io
+            , text <|
+                Point.getText o.node.points Point.typeDescription ""
+            ]
+            :: (if o.expDetail then
+                    [ text <| "Node type: " ++ o.node.typ
+                    , textInput Point.typeDescription "Description" ""
+                    ]
+                        ++ schemaInputs
+
+                else
+                    []
+               )
+
+
+schemaInput : NodeInputOptions msg -> PointSchema -> Element msg
+schemaInput opts ps =
+    let
+        lbl =
+            if ps.label == "" then
+                ps.typ
+
+            else
+                ps.label
+
+        lblUnits =
+            if ps.units == "" then
+                lbl
+
+            else
+                lbl ++ " (" ++ ps.units ++ ")"
+    in
+    if ps.status then
+        schemaStatus opts ps lblUnits
+
+    else if ps.kind == Schema.kindBool then
+        NodeInputs.nodeCheckboxInput opts "" ps.typ lbl
+
+    else if ps.kind == Schema.kindValue then
+        NodeInputs.nodeNumberInput opts "" ps.typ lblUnits
+
+    else if List.isEmpty ps.options then
+        NodeInputs.nodeTextInput opts "" ps.typ lbl ""
+
+    else
+        NodeInputs.nodeOptionInput opts
+            ""
+            ps.typ
+            lbl
+            (List.map
+                (\opt ->
+                    ( opt
+                    , if opt == "" then
+                        "default"
+
+                      else
+                        opt
+                    )
+                )
+                ps.options
+            )
+
+
+schemaStatus : NodeInputOptions msg -> PointSchema -> String -> Element msg
+schemaStatus opts ps lbl =
+    let
+        value =
+            if ps.kind == Schema.kindText then
+                Point.getText opts.node.points ps.typ ""
+
+            else if ps.kind == Schema.kindBool then
+                if Point.getBool opts.node.points ps.typ "" then
+                    "yes"
+
+                else
+                    "no"
+
+            else
+                Round.round 2 <| Point.getValue opts.node.points ps.typ ""
+    in
+    el [ paddingXY 20 0 ] <| text <| lbl ++ ": " ++ value
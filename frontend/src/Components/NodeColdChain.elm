@@ -0,0 +1,67 @@
+module Components.NodeColdChain exposing (view)
+
+import Api.Point as Point
+import Components.NodeOptions exposing (NodeOptions, oToInputO)
+import Element exposing (..)
+import Element.Border as Border
+import UI.Icon as Icon
+import UI.NodeInputs as NodeInputs
+import UI.Style as Style
+import UI.ViewIf exposing (viewIf)
+
+
+view : NodeOptions msg -> Element msg
+view o =
+    let
+        labelWidth =
+            150
+
+        opts =
+            oToInputO o labelWidth
+
+        textInput =
+            NodeInputs.nodeTextInput opts ""
+
+        numberInput =
+            NodeInputs.nodeNumberInput opts ""
+
+        checkboxInput =
+            NodeInputs.nodeCheckboxInput opts ""
+
+        disabled =
+            Point.getBool o.node.points Point.typeDisable ""
+
+        excursion =
+            Point.getBool o.node.points Point.typeExcursion ""
+
+        unsigned =
+            Point.getValue o.node.points Point.typeUnsigned ""
+    in
+    column
+        [ width fill
+        , Border.widthEach { top = 2, bottom = 0, left = 0, right = 0 }
+        , Border.color Style.colors.black
+        , spacing 6
+        ]
+    <|
+        wrappedRow [ spacing 10 ]
+            [ Icon.thermometer
+            , text <|
+                Point.getText o.node.points Point.typeDescription ""
+            , viewIf excursion <| text "(excursion)"
+            , viewIf (unsigned > 0) <| text <| "unsigned: " ++ String.fromFloat unsigned
+            , viewIf disabled <| text "(disabled)"
+            ]
+            :: (if o.expDetail then
+                    [ textInput Point.typeDescription "Description" ""
+                    , textInput Point.typeTempNodeID "Temp node ID" ""
+                    , textInput Point.typeTempPointType "Temp point type" "value"
+                    , numberInput Point.typeLowLimit "Low limit"
+                    , numberInput Point.typeHighLimit "High limit"
+                    , numberInput Point.typeExcursionDelay "Excursion delay (m)"
+                    , checkboxInput Point.typeDisable "Disable"
+                    ]
+
+                else
+                    []
+               )
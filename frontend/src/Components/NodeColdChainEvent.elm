@@ -0,0 +1,80 @@
+module Components.NodeColdChainEvent exposing (view)
+
+import Api.Point as Point
+import Components.NodeOptions exposing (NodeOptions, oToInputO)
+import Element exposing (..)
+import Element.Border as Border
+import UI.Icon as Icon
+import UI.NodeInputs as NodeInputs
+import UI.Style as Style
+import UI.ViewIf exposing (viewIf)
+
+
+view : NodeOptions msg -> Element msg
+view o =
+    let
+        labelWidth =
+            150
+
+        opts =
+            oToInputO o labelWidth
+
+        textInput =
+            NodeInputs.nodeTextInput opts ""
+
+        checkboxInput =
+            NodeInputs.nodeCheckboxInput opts ""
+
+        getText typ =
+            Point.getText o.node.points typ ""
+
+        getValue typ =
+            Point.getValue o.node.points typ ""
+
+        signOffBy =
+            getText Point.typeSignOffBy
+
+        end =
+            getText Point.typeEnd
+
+        field lbl v =
+            row [ spacing 10 ]
+                [ el [ width <| px labelWidth ] <| text <| lbl ++ ":"
+                , text v
+                ]
+    in
+    column
+        [ width fill
+        , Border.widthEach { top = 2, bottom = 0, left = 0, right = 0 }
+        , Border.color Style.colors.black
+        , spacing 6
+        ]
+    <|
+        wrappedRow [ spacing 10 ]
+            [ Icon.clipboard
+            , text <| getText Point.typeDescription
+            , text <| getText Point.typeStart
+            , viewIf (end == "") <| text "(active)"
+            , viewIf (signOffBy == "") <| text "(not signed off)"
+            ]
+            :: (if o.expDetail then
+                    [ field "Start" <| getText Point.typeStart
+                    , field "End" end
+                    , field "Duration (m)" <| String.fromFloat <| getValue Point.typeDuration
+                    , field "Limit" <|
+                        getText Point.typeLimitType
+                            ++ " "
+                            ++ String.fromFloat (getValue Point.typeLimit)
+                    , field "Peak" <| String.fromFloat <| getValue Point.typePeak
+                    , textInput Point.typeComment "Corrective action" ""
+                    , checkboxInput Point.typeSignOff "Sign off"
+                    , viewIf (signOffBy /= "") <|
+                        field "Signed off by" <|
+                            signOffBy
+                                ++ " at "
+                                ++ getText Point.typeSignOffTime
+                    ]
+
+                else
+                    []
+               )
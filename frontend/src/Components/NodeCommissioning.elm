@@ -0,0 +1,73 @@
+module Components.NodeCommissioning exposing (view)
+
+import Api.Point as Point
+import Components.NodeOptions exposing (NodeOptions, oToInputO)
+import Element exposing (..)
+import Element.Border as Border
+import UI.Icon as Icon
+import UI.NodeInputs as NodeInputs
+import UI.Style as Style
+
+
+view : NodeOptions msg -> Element msg
+view o =
+    let
+        labelWidth =
+            150
+
+        opts =
+            oToInputO o labelWidth
+
+        textInput =
+            NodeInputs.nodeTextInput opts ""
+
+        checkboxInput =
+            NodeInputs.nodeCheckboxInput opts ""
+
+        getText typ =
+            Point.getText o.node.points typ ""
+
+        counter typ =
+            String.fromFloat <| Point.getValue o.node.points typ ""
+
+        signedOff =
+            Point.getBool o.node.points Point.typeSignOff ""
+
+        status =
+            if signedOff then
+                "signed off " ++ getText Point.typeSignOffTime
+
+            else
+                counter Point.typePassed
+                    ++ " passed, "
+                    ++ counter Point.typeFailed
+                    ++ " failed"
+    in
+    column
+        [ width fill
+        , Border.widthEach { top = 2, bottom = 0, left = 0, right = 0 }
+        , Border.color Style.colors.black
+        , spacing 6
+        ]
+    <|
+        wrappedRow [ spacing 10 ]
+            [ Icon.check
+            , text <| getText Point.typeDescription
+            , text status
+            ]
+            :: (if o.expDetail then
+                    [ textInput Point.typeDescription "Description" ""
+                    , textInput Point.typeTechnician "Technician" ""
+                    , checkboxInput Point.typeRun "Run all checks"
+                    , checkboxInput Point.typeSignOff "Sign off"
+                    , text <| getText Point.typeDetail
+                    , checkboxInput Point.typeDisable "Disable"
+                    , column [ spacing 3 ] <|
+                        List.map text <|
+                            String.lines <|
+                                getText Point.typeReport
+                    ]
+
+                else
+                    []
+               )
@@ -0,0 +1,112 @@
+module Components.NodeCommissioningCheck exposing (view)
+
+import Api.Point as Point
+import Components.NodeOptions exposing (NodeOptions, oToInputO)
+import Element exposing (..)
+import Element.Border as Border
+import Element.Font as Font
+import UI.Icon as Icon
+import UI.NodeInputs as NodeInputs
+import UI.Style as Style
+import UI.ViewIf exposing (viewIf)
+
+
+view : NodeOptions msg -> Element msg
+view o =
+    let
+        labelWidth =
+            150
+
+        opts =
+            oToInputO o labelWidth
+
+        textInput =
+            NodeInputs.nodeTextInput opts ""
+
+        numberInput =
+            NodeInputs.nodeNumberInput opts ""
+
+        checkboxInput =
+            NodeInputs.nodeCheckboxInput opts ""
+
+        optionInput =
+            NodeInputs.nodeOptionInput opts ""
+
+        getText typ =
+            Point.getText o.node.points typ ""
+
+        checkType =
+            getText Point.typeCheckType
+
+        result =
+            getText Point.typeResult
+
+        resultColor =
+            if result == Point.valuePass then
+                Style.colors.darkgreen
+
+            else if result == Point.valueFail then
+                Style.colors.red
+
+            else
+                Style.colors.gray
+    in
+    column
+        [ width fill
+        , Border.widthEach { top = 2, bottom = 0, left = 0, right = 0 }
+        , Border.color Style.colors.black
+        , spacing 6
+        ]
+    <|
+        wrappedRow [ spacing 10 ]
+            [ Icon.check
+            , text <| getText Point.typeDescription
+            , el [ Font.color resultColor ] <|
+                text <|
+                    if result == "" then
+                        "not run"
+
+                    else
+                        result
+            ]
+            :: (if o.expDetail then
+                    [ textInput Point.typeDescription "Description" ""
+                    , optionInput Point.typeCheckType
+                        "Check type"
+                        [ ( Point.valueSensor, "Sensor reads plausible" )
+                        , ( Point.valueOutput, "Output toggles" )
+                        , ( Point.valueSync, "Upstream sync" )
+                        , ( Point.valueManual, "Manual" )
+                        ]
+                    , viewIf (checkType /= Point.valueManual) <|
+                        textInput Point.typeNodeID "Node ID" ""
+                    , viewIf (checkType == Point.valueSensor || checkType == Point.valueOutput) <|
+                        textInput Point.typePointType "Point type" "value"
+                    , viewIf (checkType == Point.valueSensor) <|
+                        numberInput Point.typeLowLimit "Low limit"
+                    , viewIf (checkType == Point.valueSensor) <|
+                        numberInput Point.typeHighLimit "High limit"
+                    , viewIf (checkType == Point.valueSensor) <|
+                        numberInput Point.typeMaxAge "Max age (s)"
+                    , viewIf (checkType == Point.valueOutput) <|
+                        textInput Point.typeFeedbackNodeID "Feedback node ID" ""
+                    , viewIf (checkType == Point.valueOutput) <|
+                        textInput Point.typeFeedbackPointType "Feedback point type" "value"
+                    , viewIf (checkType == Point.valueOutput || checkType == Point.valueSync) <|
+                        numberInput Point.typeFeedbackTimeout "Timeout (s)"
+                    , if checkType == Point.valueManual then
+                        optionInput Point.typeResult
+                            "Result"
+                            [ ( Point.valuePass, "Pass" )
+                            , ( Point.valueFail, "Fail" )
+                            ]
+
+                      else
+                        checkboxInput Point.typeRun "Run check"
+                    , text <| "Result time: " ++ getText Point.typeResultTime
+                    , text <| getText Point.typeDetail
+                    ]
+
+                else
+                    []
+               )
@@ -0,0 +1,54 @@
+module Components.NodeConfigDrift exposing (view)
+
+import Api.Point as Point
+import Components.NodeOptions exposing (NodeOptions, oToInputO)
+import Element exposing (..)
+import Element.Border as Border
+import UI.Icon as Icon
+import UI.NodeInputs as NodeInputs
+import UI.Style as Style
+
+
+view : NodeOptions msg -> Element msg
+view o =
+    let
+        labelWidth =
+            150
+
+        opts =
+            oToInputO o labelWidth
+
+        checkboxInput =
+            NodeInputs.nodeCheckboxInput opts ""
+
+        getText typ =
+            Point.getText o.node.points typ ""
+
+        count =
+            String.fromFloat <| Point.getValue o.node.points Point.typeCount ""
+    in
+    column
+        [ width fill
+        , Border.widthEach { top = 2, bottom = 0, left = 0, right = 0 }
+        , Border.color Style.colors.black
+        , spacing 6
+        ]
+    <|
+        wrappedRow [ spacing 10 ]
+            [ Icon.clipboard
+            , text <| getText Point.typeDescription
+            , text <| count ++ " differences"
+            ]
+            :: (if o.expDetail then
+                    [ text <| "Device: " ++ getText Point.typeDeviceNodeID
+                    , text <| "Detected: " ++ getText Point.typeStart
+                    , column [ spacing 3 ] <|
+                        List.map text <|
+                            String.lines <|
+                                getText Point.typeDifferences
+                    , checkboxInput Point.typeReapply "Re-apply template"
+                    ]
+
+                else
+                    []
+               )
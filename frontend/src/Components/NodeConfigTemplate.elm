@@ -0,0 +1,62 @@
+module Components.NodeConfigTemplate exposing (view)
+
+import Api.Point as Point
+import Components.NodeOptions exposing (NodeOptions, oToInputO)
+import Element exposing (..)
+import Element.Border as Border
+import UI.Icon as Icon
+import UI.NodeInputs as NodeInputs
+import UI.Style as Style
+import UI.ViewIf exposing (viewIf)
+
+
+view : NodeOptions msg -> Element msg
+view o =
+    let
+        labelWidth =
+            150
+
+        opts =
+            oToInputO o labelWidth
+
+        textInput =
+            NodeInputs.nodeTextInput opts ""
+
+        numberInput =
+            NodeInputs.nodeNumberInput opts ""
+
+        checkboxInput =
+            NodeInputs.nodeCheckboxInput opts ""
+
+        disabled =
+            Point.getBool o.node.points Point.typeDisable ""
+
+        counter typ =
+            String.fromFloat <| Point.getValue o.node.points typ ""
+    in
+    column
+        [ width fill
+        , Border.widthEach { top = 2, bottom = 0, left = 0, right = 0 }
+        , Border.color Style.colors.black
+        , spacing 6
+        ]
+    <|
+        wrappedRow [ spacing 10 ]
+            [ Icon.clipboard
+            , text <|
+                Point.getText o.node.points Point.typeDescription ""
+            , text <| "drifted: " ++ counter Point.typeDrifted ++ "/" ++ counter Point.typeDevices
+            , viewIf disabled <| text "(disabled)"
+            ]
+            :: (if o.expDetail then
+                    [ textInput Point.typeDescription "Description" ""
+                    , textInput Point.typeGoldenNodeID "Golden node ID" ""
+                    , textInput Point.typeTag "Device tag" ""
+                    , textInput Point.typeIgnorePointTypes "Ignore point types" "value"
+                    , numberInput Point.typePeriod "Period (m)"
+                    , checkboxInput Point.typeDisable "Disable"
+                    ]
+
+                else
+                    []
+               )
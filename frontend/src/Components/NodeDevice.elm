@@ -2,13 +2,14 @@ module Components.NodeDevice exposing (view)
 
 import Api.Node as Node
 import Api.Point as Point exposing (Point)
-import Components.NodeOptions exposing (NodeOptions)
+import Components.NodeOptions exposing (NodeOptions, oToInputO)
 import Element exposing (..)
 import Element.Background as Background
 import Element.Border as Border
 import Element.Input as Input
 import Time
 import UI.Icon as Icon
+import UI.NodeInputs as NodeInputs
 import UI.Style as Style exposing (colors)
 import UI.ViewIf exposing (viewIf)
 import Utils.Duration as Duration
@@ -93,14 +94,16 @@ view o =
                 { onChange =
                     \d ->
                         o.onEditNodePoint
-                            [ Point Point.typeDescription "" o.now 0 0 d 0 ]
+                            [ Point Point.typeDescription "" o.now 0 0 d 0 "" ]
                 , text = Node.description o.node
                 , placeholder = Just <| Input.placeholder [] <| text "node description"
                 , label = Input.labelHidden "node description"
                 }
             ]
             :: (if o.expDetail then
-                    [ viewPoints <| Point.filterSpecialPoints <| List.sortWith Point.sort o.node.points
+                    [ NodeInputs.nodeTextInput (oToInputO o 100) "" Point.typeTag "Tag" ""
+                    , NodeInputs.nodeTextInput (oToInputO o 100) "" Point.typeTimezone "Time zone" "UTC"
+                    , viewPoints <| Point.filterSpecialPoints <| List.sortWith Point.sort o.node.points
                     , text ("Last update: " ++ Iso8601.toDateTimeString o.zone latestPointTime)
                     , text
                         ("Time since last update: "
@@ -0,0 +1,92 @@
+module Components.NodeDoser exposing (view)
+
+import Api.Point as Point
+import Components.NodeOptions exposing (NodeOptions, oToInputO)
+import Element exposing (..)
+import Element.Border as Border
+import Round
+import UI.Icon as Icon
+import UI.NodeInputs as NodeInputs
+import UI.Style as Style
+import UI.ViewIf exposing (viewIf)
+
+
+view : NodeOptions msg -> Element msg
+view o =
+    let
+        labelWidth =
+            150
+
+        opts =
+            oToInputO o labelWidth
+
+        textInput =
+            NodeInputs.nodeTextInput opts ""
+
+        numberInput =
+            NodeInputs.nodeNumberInput opts ""
+
+        optionInput =
+            NodeInputs.nodeOptionInput opts ""
+
+        checkboxInput =
+            NodeInputs.nodeCheckboxInput opts ""
+
+        disabled =
+            Point.getBool o.node.points Point.typeDisable ""
+
+        interlocked =
+            Point.getBool o.node.points Point.typeInterlocked ""
+
+        limitReached =
+            Point.getBool o.node.points Point.typeLimitReached ""
+
+        duty =
+            Point.getValue o.node.points Point.typeDuty ""
+
+        doseToday =
+            Point.getValue o.node.points Point.typeDoseToday ""
+    in
+    column
+        [ width fill
+        , Border.widthEach { top = 2, bottom = 0, left = 0, right = 0 }
+        , Border.color Style.colors.black
+        , spacing 6
+        ]
+    <|
+        wrappedRow [ spacing 10 ]
+            [ Icon.droplet
+            , text <|
+                Point.getText o.node.points Point.typeDescription ""
+            , text <| "duty: " ++ Round.round 0 duty ++ "%"
+            , text <| "today: " ++ Round.round 2 doseToday
+            , viewIf interlocked <| text "(interlocked)"
+            , viewIf limitReached <| text "(daily limit)"
+            , viewIf disabled <| text "(disabled)"
+            ]
+            :: (if o.expDetail then
+                    [ textInput Point.typeDescription "Description" ""
+                    , textInput Point.typeSensorNodeID "Sensor node ID" ""
+                    , textInput Point.typeSensorPointType "Sensor point type" "value"
+                    , numberInput Point.typeSetpoint "Setpoint"
+                    , optionInput Point.typeDirection
+                        "Direction"
+                        [ ( Point.valueRaise, "Dosing raises reading" )
+                        , ( Point.valueLower, "Dosing lowers reading" )
+                        ]
+                    , numberInput Point.typeGain "Gain (%/unit)"
+                    , numberInput Point.typeDeadband "Deadband"
+                    , numberInput Point.typePeriod "Period (s)"
+                    , numberInput Point.typeMaxDuty "Max duty (%)"
+                    , textInput Point.typeOutputNodeID "Output node ID" ""
+                    , textInput Point.typeOutputPointType "Output point type" "value"
+                    , numberInput Point.typeFlowRate "Flow rate (/m)"
+                    , numberInput Point.typeDailyLimit "Daily limit"
+                    , textInput Point.typeInterlockNodeID "Interlock node ID" ""
+                    , numberInput Point.typeSensorTimeout "Sensor timeout (m)"
+                    , checkboxInput Point.typeDisable "Disable"
+                    ]
+
+                else
+                    []
+               )
@@ -0,0 +1,65 @@
+module Components.NodeEmailIngest exposing (view)
+
+import Api.Point as Point
+import Components.NodeOptions exposing (NodeOptions, oToInputO)
+import Element exposing (..)
+import Element.Border as Border
+import UI.Icon as Icon
+import UI.NodeInputs as NodeInputs
+import UI.Style as Style
+import UI.ViewIf exposing (viewIf)
+
+
+view : NodeOptions msg -> Element msg
+view o =
+    let
+        labelWidth =
+            150
+
+        opts =
+            oToInputO o labelWidth
+
+        textInput =
+            NodeInputs.nodeTextInput opts ""
+
+        numberInput =
+            NodeInputs.nodeNumberInput opts ""
+
+        checkboxInput =
+            NodeInputs.nodeCheckboxInput opts ""
+
+        disabled =
+            Point.getBool o.node.points Point.typeDisable ""
+
+        counter typ =
+            String.fromFloat <| Point.getValue o.node.points typ ""
+    in
+    column
+        [ width fill
+        , Border.widthEach { top = 2, bottom = 0, left = 0, right = 0 }
+        , Border.color Style.colors.black
+        , spacing 6
+        ]
+    <|
+        wrappedRow [ spacing 10 ]
+            [ Icon.mail
+            , text <|
+                Point.getText o.node.points Point.typeDescription ""
+            , viewIf disabled <| text "(disabled)"
+            ]
+            :: (if o.expDetail then
+                    [ textInput Point.typeDescription "Description" ""
+                    , textInput Point.typeServer "IMAP server" "imap.example.com:993"
+                    , checkboxInput Point.typeNoTLS "Disable TLS"
+                    , textInput Point.typeUsername "Username" ""
+                    , textInput Point.typePass "Password" ""
+                    , textInput Point.typeMailbox "Mailbox" "INBOX"
+                    , numberInput Point.typePollPeriod "Poll period (ms)"
+                    , checkboxInput Point.typeDisable "Disable"
+                    , text <| "Emails processed: " ++ counter Point.typeRx
+                    , text <| "Errors: " ++ counter Point.typeErrorCount
+                    ]
+
+                else
+                    []
+               )
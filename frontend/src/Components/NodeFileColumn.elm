@@ -0,0 +1,55 @@
+module Components.NodeFileColumn exposing (view)
+
+import Api.Point as Point
+import Components.NodeOptions exposing (NodeOptions, oToInputO)
+import Element exposing (..)
+import Element.Border as Border
+import UI.Icon as Icon
+import UI.NodeInputs as NodeInputs
+import UI.Style as Style
+
+
+view : NodeOptions msg -> Element msg
+view o =
+    let
+        labelWidth =
+            150
+
+        opts =
+            oToInputO o labelWidth
+
+        textInput =
+            NodeInputs.nodeTextInput opts ""
+
+        optionInput =
+            NodeInputs.nodeOptionInput opts ""
+    in
+    column
+        [ width fill
+        , Border.widthEach { top = 2, bottom = 0, left = 0, right = 0 }
+        , Border.color Style.colors.black
+        , spacing 6
+        ]
+    <|
+        wrappedRow [ spacing 10 ]
+            [ Icon.list
+            , text <|
+                Point.getText o.node.points Point.typeDescription ""
+            ]
+            :: (if o.expDetail then
+                    [ textInput Point.typeDescription "Description" ""
+                    , textInput Point.typeColumn "Column" "CSV header or XML field"
+                    , textInput Point.typeNodeID "Node ID" "defaults to this node"
+                    , textInput Point.typePointType "Point type" ""
+                    , textInput Point.typePointKey "Point key" ""
+                    , optionInput Point.typeValueType
+                        "Value type"
+                        [ ( Point.valueNumber, "number" )
+                        , ( Point.valueOnOff, "on/off" )
+                        , ( Point.valueText, "text" )
+                        ]
+                    ]
+
+                else
+                    []
+               )
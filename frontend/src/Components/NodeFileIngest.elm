@@ -0,0 +1,84 @@
+module Components.NodeFileIngest exposing (view)
+
+import Api.Point as Point
+import Components.NodeOptions exposing (NodeOptions, oToInputO)
+import Element exposing (..)
+import Element.Border as Border
+import UI.Icon as Icon
+import UI.NodeInputs as NodeInputs
+import UI.Style as Style
+import UI.ViewIf exposing (viewIf)
+
+
+view : NodeOptions msg -> Element msg
+view o =
+    let
+        labelWidth =
+            150
+
+        opts =
+            oToInputO o labelWidth
+
+        textInput =
+            NodeInputs.nodeTextInput opts ""
+
+        numberInput =
+            NodeInputs.nodeNumberInput opts ""
+
+        checkboxInput =
+            NodeInputs.nodeCheckboxInput opts ""
+
+        optionInput =
+            NodeInputs.nodeOptionInput opts ""
+
+        disabled =
+            Point.getBool o.node.points Point.typeDisable ""
+
+        format =
+            Point.getText o.node.points Point.typeFormat ""
+
+        counter typ =
+            String.fromFloat <| Point.getValue o.node.points typ ""
+    in
+    column
+        [ width fill
+        , Border.widthEach { top = 2, bottom = 0, left = 0, right = 0 }
+        , Border.color Style.colors.black
+        , spacing 6
+        ]
+    <|
+        wrappedRow [ spacing 10 ]
+            [ Icon.fileText
+            , text <|
+                Point.getText o.node.points Point.typeDescription ""
+            , viewIf disabled <| text "(disabled)"
+            ]
+            :: (if o.expDetail then
+                    [ textInput Point.typeDescription "Description" ""
+                    , textInput Point.typeURI "Directory/URI" "sftp://host/logs"
+                    , textInput Point.typeUsername "Username" ""
+                    , textInput Point.typePass "Password" ""
+                    , textInput Point.typeHostKey "SFTP host key" "ssh-ed25519 AAAA..."
+                    , textInput Point.typeKnownHosts "SFTP known hosts file" "/root/.ssh/known_hosts"
+                    , textInput Point.typePattern "File pattern" "*.csv"
+                    , optionInput Point.typeFormat
+                        "Format"
+                        [ ( Point.valueCSV, "CSV" )
+                        , ( Point.valueXML, "XML" )
+                        ]
+                    , viewIf (format /= Point.valueXML) <|
+                        textInput Point.typeDelimiter "Delimiter" ","
+                    , viewIf (format == Point.valueXML) <|
+                        textInput Point.typeRecordElement "Record element" "record"
+                    , textInput Point.typeTimeColumn "Time column" ""
+                    , textInput Point.typeTimeFormat "Time format" "2006-01-02T15:04:05Z07:00"
+                    , textInput Point.typeProcessedDir "Processed dir" "delete if blank"
+                    , numberInput Point.typePollPeriod "Poll period (ms)"
+                    , checkboxInput Point.typeDisable "Disable"
+                    , text <| "Files processed: " ++ counter Point.typeRx
+                    , text <| "Errors: " ++ counter Point.typeErrorCount
+                    ]
+
+                else
+                    []
+               )
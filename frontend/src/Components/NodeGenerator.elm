@@ -0,0 +1,127 @@
+module Components.NodeGenerator exposing (view)
+
+import Api.Point as Point
+import Components.NodeOptions exposing (NodeOptions, oToInputO)
+import Element exposing (..)
+import Element.Border as Border
+import Round
+import UI.Icon as Icon
+import UI.NodeInputs as NodeInputs
+import UI.Style as Style
+import UI.ViewIf exposing (viewIf)
+
+
+view : NodeOptions msg -> Element msg
+view o =
+    let
+        labelWidth =
+            150
+
+        opts =
+            oToInputO o labelWidth
+
+        textInput =
+            NodeInputs.nodeTextInput opts ""
+
+        numberInput =
+            NodeInputs.nodeNumberInput opts ""
+
+        optionInput =
+            NodeInputs.nodeOptionInput opts ""
+
+        checkboxInput =
+            NodeInputs.nodeCheckboxInput opts ""
+
+        timeInput =
+            NodeInputs.nodeTimeInput opts ""
+
+        disabled =
+            Point.getBool o.node.points Point.typeDisable ""
+
+        running =
+            Point.getBool o.node.points Point.typeRunning ""
+
+        exercise =
+            Point.getBool o.node.points Point.typeExercise ""
+
+        onGenerator =
+            Point.getBool o.node.points Point.typeOnGenerator ""
+
+        failToStart =
+            Point.getBool o.node.points Point.typeFailToStart ""
+
+        lowFuel =
+            Point.getBool o.node.points Point.typeLowFuel ""
+
+        lowBattery =
+            Point.getBool o.node.points Point.typeLowBattery ""
+
+        fuel =
+            Point.getValue o.node.points Point.typeFuelLevel ""
+
+        battery =
+            Point.getValue o.node.points Point.typeBatteryVoltage ""
+
+        profile =
+            Point.getText o.node.points Point.typeProfile ""
+    in
+    column
+        [ width fill
+        , Border.widthEach { top = 2, bottom = 0, left = 0, right = 0 }
+        , Border.color Style.colors.black
+        , spacing 6
+        ]
+    <|
+        wrappedRow [ spacing 10 ]
+            [ Icon.power
+            , text <|
+                Point.getText o.node.points Point.typeDescription ""
+            , text <|
+                if running then
+                    "running"
+
+                else
+                    "stopped"
+            , text <| "fuel: " ++ Round.round 0 fuel ++ "%"
+            , text <| "battery: " ++ Round.round 1 battery ++ "V"
+            , viewIf exercise <| text "(exercise)"
+            , viewIf onGenerator <| text "(on generator)"
+            , viewIf failToStart <| text "(fail to start)"
+            , viewIf lowFuel <| text "(low fuel)"
+            , viewIf lowBattery <| text "(low battery)"
+            , viewIf disabled <| text "(disabled)"
+            ]
+            :: (if o.expDetail then
+                    [ textInput Point.typeDescription "Description" ""
+                    , optionInput Point.typeProfile
+                        "Profile"
+                        [ ( "", "None" )
+                        , ( Point.valueDSE, "DSE" )
+                        , ( Point.valueComAp, "ComAp" )
+                        ]
+                    , viewIf (profile /= "") <|
+                        textInput Point.typeModbusNodeID "Modbus node ID" ""
+                    , viewIf (profile /= "") <|
+                        numberInput Point.typeModbusID "Modbus ID"
+                    , textInput Point.typeRunNodeID "Run node ID" ""
+                    , numberInput Point.typeRunThreshold "Run threshold"
+                    , textInput Point.typeFuelNodeID "Fuel node ID" ""
+                    , textInput Point.typeBatteryNodeID "Battery node ID" ""
+                    , textInput Point.typeAtsNodeID "ATS node ID" ""
+                    , textInput Point.typeStartNodeID "Start node ID" ""
+                    , numberInput Point.typeStartTimeout "Start timeout (s)"
+                    , numberInput Point.typeFuelLow "Fuel low (%)"
+                    , numberInput Point.typeBatteryLow "Battery low (V)"
+                    , numberInput Point.typeExerciseWeekday "Exercise weekday (0-6)"
+                    , timeInput Point.typeExerciseStart "Exercise start"
+                    , numberInput Point.typeExerciseDuration "Exercise duration (m)"
+                    , numberInput Point.typeRuntime "Runtime (h)"
+                    , checkboxInput Point.typeRemoteStart "Remote start"
+                    , checkboxInput Point.typeExercise "Exercise"
+                    , checkboxInput Point.typeFailToStart "Fail to start"
+                    , checkboxInput Point.typeDisable "Disable"
+                    ]
+
+                else
+                    []
+               )
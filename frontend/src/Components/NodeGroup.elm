@@ -32,6 +32,7 @@ view o =
             ]
             :: (if o.expDetail then
                     [ textInput Point.typeDescription "Description" ""
+                    , textInput Point.typeTimezone "Time zone" "UTC"
                     ]
 
                 else
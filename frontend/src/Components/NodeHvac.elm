@@ -0,0 +1,102 @@
+module Components.NodeHvac exposing (view)
+
+import Api.Point as Point
+import Components.NodeOptions exposing (NodeOptions, oToInputO)
+import Element exposing (..)
+import Element.Border as Border
+import UI.Icon as Icon
+import UI.NodeInputs as NodeInputs
+import UI.Style as Style
+import UI.ViewIf exposing (viewIf)
+
+
+view : NodeOptions msg -> Element msg
+view o =
+    let
+        labelWidth =
+            150
+
+        opts =
+            oToInputO o labelWidth
+
+        textInput =
+            NodeInputs.nodeTextInput opts ""
+
+        numberInput =
+            NodeInputs.nodeNumberInput opts ""
+
+        optionInput =
+            NodeInputs.nodeOptionInput opts ""
+
+        checkboxInput =
+            NodeInputs.nodeCheckboxInput opts ""
+
+        timeInput =
+            NodeInputs.nodeTimeInput opts ""
+
+        disabled =
+            Point.getBool o.node.points Point.typeDisable ""
+
+        occupied =
+            Point.getBool o.node.points Point.typeOccupied ""
+
+        economizing =
+            Point.getBool o.node.points Point.typeEconomizing ""
+
+        heatStage =
+            Point.getValue o.node.points Point.typeHeatStage ""
+
+        coolStage =
+            Point.getValue o.node.points Point.typeCoolStage ""
+
+        mode =
+            Point.getText o.node.points Point.typeMode ""
+    in
+    column
+        [ width fill
+        , Border.widthEach { top = 2, bottom = 0, left = 0, right = 0 }
+        , Border.color Style.colors.black
+        , spacing 6
+        ]
+    <|
+        wrappedRow [ spacing 10 ]
+            [ Icon.thermometer
+            , text <|
+                Point.getText o.node.points Point.typeDescription ""
+            , text <| "mode: " ++ mode
+            , viewIf (heatStage > 0) <| text <| "heat: " ++ String.fromFloat heatStage
+            , viewIf (coolStage > 0) <| text <| "cool: " ++ String.fromFloat coolStage
+            , viewIf economizing <| text "(economizer)"
+            , viewIf (not occupied) <| text "(setback)"
+            , viewIf disabled <| text "(disabled)"
+            ]
+            :: (if o.expDetail then
+                    [ textInput Point.typeDescription "Description" ""
+                    , optionInput Point.typeMode
+                        "Mode"
+                        [ ( Point.valueOff, "Off" )
+                        , ( Point.valueHeat, "Heat" )
+                        , ( Point.valueCool, "Cool" )
+                        , ( Point.valueAuto, "Auto" )
+                        ]
+                    , textInput Point.typeTempNodeID "Zone temp node ID" ""
+                    , numberInput Point.typeHeatSetpoint "Heat setpoint"
+                    , numberInput Point.typeCoolSetpoint "Cool setpoint"
+                    , timeInput Point.typeOccupiedStart "Occupied start"
+                    , timeInput Point.typeOccupiedEnd "Occupied end"
+                    , numberInput Point.typeSetbackHeat "Setback heat"
+                    , numberInput Point.typeSetbackCool "Setback cool"
+                    , numberInput Point.typeDifferential "Stage differential"
+                    , numberInput Point.typeStageDelay "Stage delay (m)"
+                    , numberInput Point.typeMinRun "Min run (m)"
+                    , numberInput Point.typeMinOff "Min off (m)"
+                    , textInput Point.typeFanNodeID "Fan node ID" ""
+                    , textInput Point.typeOutdoorNodeID "Outdoor temp node ID" ""
+                    , textInput Point.typeEconomizerNodeID "Economizer node ID" ""
+                    , numberInput Point.typeEconomizerTemp "Economizer below"
+                    , checkboxInput Point.typeDisable "Disable"
+                    ]
+
+                else
+                    []
+               )
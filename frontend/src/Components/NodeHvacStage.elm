@@ -0,0 +1,66 @@
+module Components.NodeHvacStage exposing (view)
+
+import Api.Point as Point
+import Components.NodeOptions exposing (NodeOptions, oToInputO)
+import Element exposing (..)
+import Element.Border as Border
+import UI.Icon as Icon
+import UI.NodeInputs as NodeInputs
+import UI.Style as Style
+import UI.ViewIf exposing (viewIf)
+
+
+view : NodeOptions msg -> Element msg
+view o =
+    let
+        labelWidth =
+            150
+
+        opts =
+            oToInputO o labelWidth
+
+        textInput =
+            NodeInputs.nodeTextInput opts ""
+
+        numberInput =
+            NodeInputs.nodeNumberInput opts ""
+
+        optionInput =
+            NodeInputs.nodeOptionInput opts ""
+
+        checkboxInput =
+            NodeInputs.nodeCheckboxInput opts ""
+
+        disabled =
+            Point.getBool o.node.points Point.typeDisable ""
+    in
+    column
+        [ width fill
+        , Border.widthEach { top = 2, bottom = 0, left = 0, right = 0 }
+        , Border.color Style.colors.black
+        , spacing 6
+        ]
+    <|
+        wrappedRow [ spacing 10 ]
+            [ Icon.thermometer
+            , text <|
+                Point.getText o.node.points Point.typeDescription ""
+            , text <| Point.getText o.node.points Point.typeStageType ""
+            , viewIf disabled <| text "(disabled)"
+            ]
+            :: (if o.expDetail then
+                    [ textInput Point.typeDescription "Description" ""
+                    , optionInput Point.typeStageType
+                        "Stage type"
+                        [ ( Point.valueHeat, "Heat" )
+                        , ( Point.valueCool, "Cool" )
+                        ]
+                    , numberInput Point.typeIndex "Index"
+                    , textInput Point.typeNodeID "Output node ID" ""
+                    , textInput Point.typePointType "Output point type" "value"
+                    , checkboxInput Point.typeDisable "Disable"
+                    ]
+
+                else
+                    []
+               )
@@ -0,0 +1,71 @@
+module Components.NodeKafka exposing (view)
+
+import Api.Point as Point
+import Components.NodeOptions exposing (NodeOptions, oToInputO)
+import Element exposing (..)
+import Element.Border as Border
+import UI.Icon as Icon
+import UI.NodeInputs as NodeInputs
+import UI.Style as Style
+import UI.ViewIf exposing (viewIf)
+
+
+view : NodeOptions msg -> Element msg
+view o =
+    let
+        labelWidth =
+            150
+
+        opts =
+            oToInputO o labelWidth
+
+        textInput =
+            NodeInputs.nodeTextInput opts ""
+
+        optionInput =
+            NodeInputs.nodeOptionInput opts ""
+
+        checkboxInput =
+            NodeInputs.nodeCheckboxInput opts ""
+
+        disabled =
+            Point.getBool o.node.points Point.typeDisable ""
+
+        counter typ =
+            String.fromFloat <| Point.getValue o.node.points typ ""
+    in
+    column
+        [ width fill
+        , Border.widthEach { top = 2, bottom = 0, left = 0, right = 0 }
+        , Border.color Style.colors.black
+        , spacing 6
+        ]
+    <|
+        wrappedRow [ spacing 10 ]
+            [ Icon.share
+            , text <|
+                Point.getText o.node.points Point.typeDescription ""
+            , viewIf disabled <| text "(disabled)"
+            ]
+            :: (if o.expDetail then
+                    [ textInput Point.typeDescription "Description" ""
+                    , textInput Point.typeBrokers "Brokers" "kafka1:9092,kafka2:9092"
+                    , textInput Point.typeTopic "Topic" "siot-points"
+                    , textInput Point.typePointTypes "Point types" "all if blank"
+                    , optionInput Point.typeFormat
+                        "Format"
+                        [ ( Point.valueJSON, "JSON" )
+                        , ( Point.valueAvro, "Avro" )
+                        ]
+                    , textInput Point.typeSchemaRegistry "Schema registry" "optional"
+                    , checkboxInput Point.typeTLS "TLS"
+                    , textInput Point.typeUsername "SASL username" "optional"
+                    , textInput Point.typePass "SASL password" ""
+                    , checkboxInput Point.typeDisable "Disable"
+                    , text <| "Points sent: " ++ counter Point.typeTx
+                    , text <| "Errors: " ++ counter Point.typeErrorCount
+                    ]
+
+                else
+                    []
+               )
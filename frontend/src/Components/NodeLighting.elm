@@ -0,0 +1,95 @@
+module Components.NodeLighting exposing (view)
+
+import Api.Point as Point
+import Components.NodeOptions exposing (NodeOptions, oToInputO)
+import Element exposing (..)
+import Element.Border as Border
+import Round
+import UI.Icon as Icon
+import UI.NodeInputs as NodeInputs
+import UI.Style as Style
+import UI.ViewIf exposing (viewIf)
+
+
+view : NodeOptions msg -> Element msg
+view o =
+    let
+        labelWidth =
+            170
+
+        opts =
+            oToInputO o labelWidth
+
+        textInput =
+            NodeInputs.nodeTextInput opts ""
+
+        numberInput =
+            NodeInputs.nodeNumberInput opts ""
+
+        optionInput =
+            NodeInputs.nodeOptionInput opts ""
+
+        checkboxInput =
+            NodeInputs.nodeCheckboxInput opts ""
+
+        disabled =
+            Point.getBool o.node.points Point.typeDisable ""
+
+        dark =
+            Point.getBool o.node.points Point.typeDark ""
+
+        occupied =
+            Point.getBool o.node.points Point.typeOccupied ""
+
+        override =
+            Point.getBool o.node.points Point.typeOverride ""
+
+        level =
+            Point.getValue o.node.points Point.typeActiveLevel ""
+    in
+    column
+        [ width fill
+        , Border.widthEach { top = 2, bottom = 0, left = 0, right = 0 }
+        , Border.color Style.colors.black
+        , spacing 6
+        ]
+    <|
+        wrappedRow [ spacing 10 ]
+            [ Icon.sun
+            , text <|
+                Point.getText o.node.points Point.typeDescription ""
+            , text <| Round.round 0 level ++ "%"
+            , viewIf dark <| text "(dark)"
+            , viewIf occupied <| text "(occupied)"
+            , viewIf override <| text "(override)"
+            , viewIf disabled <| text "(disabled)"
+            ]
+            :: (if o.expDetail then
+                    [ textInput Point.typeDescription "Description" ""
+                    , numberInput Point.typeLatitude "Latitude"
+                    , numberInput Point.typeLongitude "Longitude"
+                    , numberInput Point.typeDuskOffset "Dusk offset (m)"
+                    , numberInput Point.typeDawnOffset "Dawn offset (m)"
+                    , textInput Point.typeOutputNodeID "Output node ID" ""
+                    , textInput Point.typeOutputPointType "Output point type" "value"
+                    , numberInput Point.typeOutputMax "Output at 100%"
+                    , optionInput Point.typeCurve
+                        "Dimming curve"
+                        [ ( Point.valueLinear, "Linear" )
+                        , ( Point.valueSquare, "Square" )
+                        , ( Point.valueCIE, "CIE lightness" )
+                        ]
+                    , numberInput Point.typeLevel "Level (%)"
+                    , textInput Point.typeOccupancyNodeID "Occupancy node ID" "optional"
+                    , textInput Point.typeOccupancyPointType "Occupancy point type" "value"
+                    , numberInput Point.typeOccupiedLevel "Occupied level (%)"
+                    , numberInput Point.typeOccupancyTimeout "Occupancy timeout (m)"
+                    , checkboxInput Point.typeOverride "Override"
+                    , numberInput Point.typeOverrideLevel "Override level (%)"
+                    , numberInput Point.typeOverrideTimeout "Override timeout (m)"
+                    , checkboxInput Point.typeDisable "Disable"
+                    ]
+
+                else
+                    []
+               )
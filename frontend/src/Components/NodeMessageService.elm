@@ -23,6 +23,44 @@ view o =
 
         optionInput =
             NodeInputs.nodeOptionInput opts ""
+
+        numberInput =
+            NodeInputs.nodeNumberInput opts ""
+
+        service =
+            Point.getText o.node.points Point.typeService ""
+
+        serviceInputs =
+            case service of
+                "awsSns" ->
+                    [ textInput Point.typeSID "Access Key ID" ""
+                    , textInput Point.typeAuthToken "Secret Access Key" ""
+                    , textInput Point.typeSessionToken "Session Token" "optional"
+                    , textInput Point.typeRegion "Region" "us-east-1"
+                    , textInput Point.typeFrom "Sender ID" "optional"
+                    ]
+
+                "vonage" ->
+                    [ textInput Point.typeSID "API Key" ""
+                    , textInput Point.typeAuthToken "API Secret" ""
+                    , textInput Point.typeFrom "From" ""
+                    ]
+
+                "messageBird" ->
+                    [ textInput Point.typeAuthToken "Access Key" ""
+                    , textInput Point.typeFrom "Originator" ""
+                    ]
+
+                "gsmModem" ->
+                    [ textInput Point.typePort "Port" "/dev/ttyUSB2"
+                    , numberInput Point.typeBaud "Baud"
+                    ]
+
+                _ ->
+                    [ textInput Point.typeSID "SID" ""
+                    , textInput Point.typeAuthToken "Auth Token" ""
+                    , textInput Point.typeFrom "From" ""
+                    ]
     in
     column
         [ width fill
@@ -41,11 +79,13 @@ view o =
                     , optionInput Point.typeService
                         "Service"
                         [ ( Point.valueTwilio, "Twilio SMS" )
+                        , ( Point.valueAwsSns, "AWS SNS SMS" )
+                        , ( Point.valueVonage, "Vonage SMS" )
+                        , ( Point.valueMessageBird, "MessageBird SMS" )
+                        , ( Point.valueGsmModem, "GSM modem SMS" )
                         ]
-                    , textInput Point.typeSID "SID" ""
-                    , textInput Point.typeAuthToken "Auth Token" ""
-                    , textInput Point.typeFrom "From" ""
                     ]
+                        ++ serviceInputs
 
                 else
                     []
@@ -147,6 +147,8 @@ view o =
                         numberInput Point.typeOffset "Offset"
                     , viewIf isRegister <|
                         textInput Point.typeUnits "Units" ""
+                    , viewIf isRegister <|
+                        textInput Point.typeDeviceUnits "Device units" ""
                     , viewIf isRegister <|
                         optionInput Point.typeDataFormat
                             "Data format"
@@ -156,6 +158,12 @@ view o =
                             , ( Point.valueINT32, "INT32" )
                             , ( Point.valueFLOAT32, "FLOAT32" )
                             ]
+                    , viewIf (not isClient) <|
+                        textInput Point.typeSourceNodeID "Source node ID" ""
+                    , viewIf (not isClient) <|
+                        textInput Point.typeSourcePointType "Source point type" "value"
+                    , viewIf (not isClient) <|
+                        textInput Point.typeSourcePointKey "Source point key" ""
 
                     -- This can get a little confusing, but client sets the following:
                     --   * coil
@@ -0,0 +1,57 @@
+module Components.NodeOccupancy exposing (view)
+
+import Api.Point as Point
+import Components.NodeOptions exposing (NodeOptions, oToInputO)
+import Element exposing (..)
+import Element.Border as Border
+import UI.Icon as Icon
+import UI.NodeInputs as NodeInputs
+import UI.Style as Style
+import UI.ViewIf exposing (viewIf)
+
+
+view : NodeOptions msg -> Element msg
+view o =
+    let
+        labelWidth =
+            150
+
+        opts =
+            oToInputO o labelWidth
+
+        textInput =
+            NodeInputs.nodeTextInput opts ""
+
+        checkboxInput =
+            NodeInputs.nodeCheckboxInput opts ""
+
+        disabled =
+            Point.getBool o.node.points Point.typeDisable ""
+
+        occupancy =
+            Point.getValue o.node.points Point.typeOccupancy ""
+    in
+    column
+        [ width fill
+        , Border.widthEach { top = 2, bottom = 0, left = 0, right = 0 }
+        , Border.color Style.colors.black
+        , spacing 6
+        ]
+    <|
+        wrappedRow [ spacing 10 ]
+            [ Icon.users
+            , text <|
+                Point.getText o.node.points Point.typeDescription ""
+            , text <| "occupancy: " ++ String.fromFloat occupancy
+            , viewIf disabled <| text "(disabled)"
+            ]
+            :: (if o.expDetail then
+                    [ textInput Point.typeDescription "Description" ""
+                    , textInput Point.typeResetTime "Reset time (HH:MM UTC)" "00:00"
+                    , checkboxInput Point.typeDisable "Disable"
+                    , text <| "Last reset: " ++ Point.getText o.node.points Point.typeLastReset ""
+                    ]
+
+                else
+                    []
+               )
@@ -0,0 +1,71 @@
+module Components.NodeOccupancyZone exposing (view)
+
+import Api.Point as Point
+import Components.NodeOptions exposing (NodeOptions, oToInputO)
+import Element exposing (..)
+import Element.Border as Border
+import UI.Icon as Icon
+import UI.NodeInputs as NodeInputs
+import UI.Style as Style
+import UI.ViewIf exposing (viewIf)
+
+
+view : NodeOptions msg -> Element msg
+view o =
+    let
+        labelWidth =
+            150
+
+        opts =
+            oToInputO o labelWidth
+
+        textInput =
+            NodeInputs.nodeTextInput opts ""
+
+        numberInput =
+            NodeInputs.nodeNumberInput opts ""
+
+        optionInput =
+            NodeInputs.nodeOptionInput opts ""
+
+        overCapacity =
+            Point.getBool o.node.points Point.typeOverCapacity ""
+
+        counter typ =
+            String.fromFloat <| Point.getValue o.node.points typ ""
+    in
+    column
+        [ width fill
+        , Border.widthEach { top = 2, bottom = 0, left = 0, right = 0 }
+        , Border.color Style.colors.black
+        , spacing 6
+        ]
+    <|
+        wrappedRow [ spacing 10 ]
+            [ Icon.users
+            , text <|
+                Point.getText o.node.points Point.typeDescription ""
+            , text <| "occupancy: " ++ counter Point.typeOccupancy
+            , viewIf overCapacity <| text "(over capacity)"
+            ]
+            :: (if o.expDetail then
+                    [ textInput Point.typeDescription "Description" ""
+                    , numberInput Point.typeCapacity "Capacity"
+                    , textInput Point.typeEntryNodeID "Entry node ID" ""
+                    , textInput Point.typeEntryPointType "Entry point type" "value"
+                    , textInput Point.typeExitNodeID "Exit node ID" ""
+                    , textInput Point.typeExitPointType "Exit point type" "value"
+                    , optionInput Point.typeCounterType
+                        "Counter type"
+                        [ ( Point.valueEvent, "Event" )
+                        , ( Point.valueTotal, "Total" )
+                        ]
+                    , numberInput Point.typeOccupancy "Occupancy"
+                    , text <| "Entries today: " ++ counter Point.typeEntriesToday
+                    , text <| "Exits today: " ++ counter Point.typeExitsToday
+                    , text <| "Peak occupancy: " ++ counter Point.typePeakOccupancy
+                    ]
+
+                else
+                    []
+               )
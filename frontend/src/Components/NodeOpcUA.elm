@@ -0,0 +1,76 @@
+module Components.NodeOpcUA exposing (view)
+
+import Api.Point as Point
+import Components.NodeOptions exposing (NodeOptions, oToInputO)
+import Element exposing (..)
+import Element.Border as Border
+import UI.Icon as Icon
+import UI.NodeInputs as NodeInputs
+import UI.Style as Style
+import UI.ViewIf exposing (viewIf)
+
+
+view : NodeOptions msg -> Element msg
+view o =
+    let
+        labelWidth =
+            150
+
+        opts =
+            oToInputO o labelWidth
+
+        textInput =
+            NodeInputs.nodeTextInput opts ""
+
+        numberInput =
+            NodeInputs.nodeNumberInput opts ""
+
+        checkboxInput =
+            NodeInputs.nodeCheckboxInput opts ""
+
+        optionInput =
+            NodeInputs.nodeOptionInput opts ""
+
+        disabled =
+            Point.getBool o.node.points Point.typeDisable ""
+
+        counter typ =
+            String.fromFloat <| Point.getValue o.node.points typ ""
+    in
+    column
+        [ width fill
+        , Border.widthEach { top = 2, bottom = 0, left = 0, right = 0 }
+        , Border.color Style.colors.black
+        , spacing 6
+        ]
+    <|
+        wrappedRow [ spacing 10 ]
+            [ Icon.bus
+            , text <|
+                Point.getText o.node.points Point.typeDescription ""
+            , viewIf disabled <| text "(disabled)"
+            ]
+            :: (if o.expDetail then
+                    [ textInput Point.typeDescription "Description" ""
+                    , textInput Point.typeURI "URI" "opc.tcp://plc1:4840"
+                    , textInput Point.typeSecurityPolicy "Security policy" "Basic256Sha256"
+                    , optionInput Point.typeSecurityMode
+                        "Security mode"
+                        [ ( "", "auto" )
+                        , ( "None", "none" )
+                        , ( "Sign", "sign" )
+                        , ( "SignAndEncrypt", "sign and encrypt" )
+                        ]
+                    , textInput Point.typeTLSCert "Certificate file" "/data/opcua-cert.pem"
+                    , textInput Point.typeTLSKey "Key file" "/data/opcua-key.pem"
+                    , textInput Point.typeUsername "Username" "leave blank for anonymous"
+                    , textInput Point.typePass "Password" ""
+                    , numberInput Point.typePollPeriod "Publishing interval (ms)"
+                    , checkboxInput Point.typeBrowse "Browse for variables"
+                    , checkboxInput Point.typeDisable "Disable"
+                    , text <| "Errors: " ++ counter Point.typeErrorCount
+                    ]
+
+                else
+                    []
+               )
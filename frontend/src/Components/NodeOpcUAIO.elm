@@ -0,0 +1,76 @@
+module Components.NodeOpcUAIO exposing (view)
+
+import Api.Point as Point
+import Components.NodeOptions exposing (NodeOptions, oToInputO)
+import Element exposing (..)
+import Element.Border as Border
+import Round
+import UI.Icon as Icon
+import UI.NodeInputs as NodeInputs
+import UI.Style exposing (colors)
+import UI.ViewIf exposing (viewIf)
+
+
+view : NodeOptions msg -> Element msg
+view o =
+    let
+        labelWidth =
+            150
+
+        opts =
+            oToInputO o labelWidth
+
+        textInput =
+            NodeInputs.nodeTextInput opts ""
+
+        numberInput =
+            NodeInputs.nodeNumberInput opts ""
+
+        checkboxInput =
+            NodeInputs.nodeCheckboxInput opts ""
+
+        valueText =
+            Point.getText o.node.points Point.typeValue ""
+
+        value =
+            if valueText /= "" then
+                valueText
+
+            else
+                String.fromFloat <|
+                    Round.roundNum 2 <|
+                        Point.getValue o.node.points Point.typeValue ""
+
+        isReadOnly =
+            Point.getBool o.node.points Point.typeReadOnly ""
+
+        disabled =
+            Point.getBool o.node.points Point.typeDisable ""
+    in
+    column
+        [ width fill
+        , Border.widthEach { top = 2, bottom = 0, left = 0, right = 0 }
+        , Border.color colors.black
+        , spacing 6
+        ]
+    <|
+        wrappedRow [ spacing 10 ]
+            [ Icon.io
+            , text <|
+                Point.getText o.node.points Point.typeDescription ""
+                    ++ ": "
+                    ++ value
+            , viewIf disabled <| text "(disabled)"
+            ]
+            :: (if o.expDetail then
+                    [ textInput Point.typeDescription "Description" ""
+                    , textInput Point.typeOpcUANodeID "Node ID" "ns=2;s=Pump1.Speed"
+                    , checkboxInput Point.typeReadOnly "Read only"
+                    , viewIf (not isReadOnly) <|
+                        numberInput Point.typeValueSet "Value"
+                    , checkboxInput Point.typeDisable "Disable"
+                    ]
+
+                else
+                    []
+               )
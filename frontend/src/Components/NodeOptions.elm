@@ -17,6 +17,10 @@ type CopyMove
 type alias NodeOptions msg =
     { now : Time.Posix
     , zone : Time.Zone
+
+    -- the node or an ancestor sets a time zone, so schedule times are
+    -- entered in that time zone instead of being converted to UTC
+    , siteZone : Bool
     , modified : Bool
     , expDetail : Bool
     , parent : Maybe Node
@@ -32,7 +36,12 @@ oToInputO o labelWidth =
     { onEditNodePoint = o.onEditNodePoint
     , node = o.node
     , now = o.now
-    , zone = o.zone
+    , zone =
+        if o.siteZone then
+            Time.utc
+
+        else
+            o.zone
     , labelWidth = labelWidth
     }
 
@@ -0,0 +1,70 @@
+module Components.NodePump exposing (view)
+
+import Api.Point as Point
+import Components.NodeOptions exposing (NodeOptions, oToInputO)
+import Element exposing (..)
+import Element.Border as Border
+import Round
+import UI.Icon as Icon
+import UI.NodeInputs as NodeInputs
+import UI.Style as Style
+import UI.ViewIf exposing (viewIf)
+
+
+view : NodeOptions msg -> Element msg
+view o =
+    let
+        labelWidth =
+            150
+
+        opts =
+            oToInputO o labelWidth
+
+        textInput =
+            NodeInputs.nodeTextInput opts ""
+
+        numberInput =
+            NodeInputs.nodeNumberInput opts ""
+
+        checkboxInput =
+            NodeInputs.nodeCheckboxInput opts ""
+
+        disabled =
+            Point.getBool o.node.points Point.typeDisable ""
+
+        failed =
+            Point.getBool o.node.points Point.typeFailed ""
+
+        runtime =
+            Point.getValue o.node.points Point.typeRuntime ""
+    in
+    column
+        [ width fill
+        , Border.widthEach { top = 2, bottom = 0, left = 0, right = 0 }
+        , Border.color Style.colors.black
+        , spacing 6
+        ]
+    <|
+        wrappedRow [ spacing 10 ]
+            [ Icon.activity
+            , text <|
+                Point.getText o.node.points Point.typeDescription ""
+            , text <| Round.round 1 runtime ++ "h"
+            , viewIf failed <| text "(failed)"
+            , viewIf disabled <| text "(disabled)"
+            ]
+            :: (if o.expDetail then
+                    [ textInput Point.typeDescription "Description" ""
+                    , numberInput Point.typeIndex "Index"
+                    , textInput Point.typeNodeID "Output node ID" ""
+                    , textInput Point.typePointType "Output point type" "value"
+                    , textInput Point.typeFeedbackNodeID "Feedback node ID" ""
+                    , textInput Point.typeFeedbackPointType "Feedback point type" "value"
+                    , numberInput Point.typeRuntime "Runtime (h)"
+                    , checkboxInput Point.typeFailed "Failed"
+                    , checkboxInput Point.typeDisable "Disable"
+                    ]
+
+                else
+                    []
+               )
@@ -0,0 +1,78 @@
+module Components.NodeQuota exposing (view)
+
+import Api.Point as Point
+import Components.NodeOptions exposing (NodeOptions, oToInputO)
+import Element exposing (..)
+import Element.Border as Border
+import UI.Icon as Icon
+import UI.NodeInputs as NodeInputs
+import UI.Style as Style
+import UI.ViewIf exposing (viewIf)
+
+
+view : NodeOptions msg -> Element msg
+view o =
+    let
+        labelWidth =
+            150
+
+        opts =
+            oToInputO o labelWidth
+
+        textInput =
+            NodeInputs.nodeTextInput opts ""
+
+        numberInput =
+            NodeInputs.nodeNumberInput opts ""
+
+        checkboxInput =
+            NodeInputs.nodeCheckboxInput opts ""
+
+        disabled =
+            Point.getBool o.node.points Point.typeDisable ""
+
+        overQuota =
+            List.any
+                (\typ -> Point.getBool o.node.points Point.typeOverQuota typ)
+                [ Point.typeNodeCount, Point.typePointRate, Point.typeHistoryBytes ]
+
+        counter typ =
+            String.fromFloat <| Point.getValue o.node.points typ ""
+
+        rejected typ =
+            String.fromFloat <| Point.getValue o.node.points Point.typeRejected typ
+    in
+    column
+        [ width fill
+        , Border.widthEach { top = 2, bottom = 0, left = 0, right = 0 }
+        , Border.color Style.colors.black
+        , spacing 6
+        ]
+    <|
+        wrappedRow [ spacing 10 ]
+            [ Icon.database
+            , text <|
+                Point.getText o.node.points Point.typeDescription ""
+            , viewIf disabled <| text "(disabled)"
+            , viewIf overQuota <| text "(over quota)"
+            ]
+            :: (if o.expDetail then
+                    [ textInput Point.typeDescription "Description" ""
+                    , textInput Point.typeNodeID "Subtree node ID" "blank for entire tree"
+                    , numberInput Point.typeMaxNodes "Max nodes"
+                    , numberInput Point.typeMaxPointRate "Max points/s"
+                    , numberInput Point.typeMaxHistoryBytes "Max history bytes"
+                    , checkboxInput Point.typeDisable "Disable"
+                    , text <| "Nodes: " ++ counter Point.typeNodeCount
+                    , text <| "Points/s: " ++ counter Point.typePointRate
+                    , text <| "History bytes: " ++ counter Point.typeHistoryBytes
+                    , text <|
+                        "Rejected nodes: "
+                            ++ rejected Point.typeNodeCount
+                            ++ ", points: "
+                            ++ rejected Point.typePointRate
+                    ]
+
+                else
+                    []
+               )
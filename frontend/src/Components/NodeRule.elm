@@ -20,6 +20,12 @@ view o =
         textInput =
             NodeInputs.nodeTextInput opts ""
 
+        optionInput =
+            NodeInputs.nodeOptionInput opts ""
+
+        numberInput =
+            NodeInputs.nodeNumberInput opts ""
+
         active =
             Point.getBool o.node.points Point.typeActive ""
 
@@ -52,6 +58,14 @@ view o =
             ]
             :: (if o.expDetail then
                     [ textInput Point.typeDescription "Description" ""
+                    , optionInput Point.typeSeverity
+                        "Severity"
+                        [ ( Point.valueInfo, "info" )
+                        , ( Point.valueWarning, "warning" )
+                        , ( Point.valueCritical, "critical" )
+                        ]
+                    , numberInput Point.typePriority "Priority"
+                    , textInput Point.typeSmsService "SMS service node ID" "default"
                     ]
 
                 else
@@ -0,0 +1,69 @@
+module Components.NodeS3Export exposing (view)
+
+import Api.Point as Point
+import Components.NodeOptions exposing (NodeOptions, oToInputO)
+import Element exposing (..)
+import Element.Border as Border
+import UI.Icon as Icon
+import UI.NodeInputs as NodeInputs
+import UI.Style as Style
+import UI.ViewIf exposing (viewIf)
+
+
+view : NodeOptions msg -> Element msg
+view o =
+    let
+        labelWidth =
+            150
+
+        opts =
+            oToInputO o labelWidth
+
+        textInput =
+            NodeInputs.nodeTextInput opts ""
+
+        numberInput =
+            NodeInputs.nodeNumberInput opts ""
+
+        checkboxInput =
+            NodeInputs.nodeCheckboxInput opts ""
+
+        disabled =
+            Point.getBool o.node.points Point.typeDisable ""
+
+        counter typ =
+            String.fromFloat <| Point.getValue o.node.points typ ""
+    in
+    column
+        [ width fill
+        , Border.widthEach { top = 2, bottom = 0, left = 0, right = 0 }
+        , Border.color Style.colors.black
+        , spacing 6
+        ]
+    <|
+        wrappedRow [ spacing 10 ]
+            [ Icon.archive
+            , text <|
+                Point.getText o.node.points Point.typeDescription ""
+            , viewIf disabled <| text "(disabled)"
+            ]
+            :: (if o.expDetail then
+                    [ textInput Point.typeDescription "Description" ""
+                    , textInput Point.typeURI "Endpoint" "defaults to AWS"
+                    , textInput Point.typeRegion "Region" "us-east-1"
+                    , textInput Point.typeBucket "Bucket" ""
+                    , textInput Point.typeAccessKey "Access key" ""
+                    , textInput Point.typeSecretKey "Secret key" ""
+                    , textInput Point.typeSessionToken "Session token" "only for temporary credentials"
+                    , textInput Point.typePrefix "Prefix" "optional"
+                    , textInput Point.typeEncryptionKey "Encryption key" "optional"
+                    , numberInput Point.typeExportPeriod "Export period (m)"
+                    , numberInput Point.typeBackupPeriod "Backup period (m)"
+                    , checkboxInput Point.typeDisable "Disable"
+                    , text <| "Objects uploaded: " ++ counter Point.typeTx
+                    , text <| "Errors: " ++ counter Point.typeErrorCount
+                    ]
+
+                else
+                    []
+               )
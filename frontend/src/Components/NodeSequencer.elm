@@ -0,0 +1,95 @@
+module Components.NodeSequencer exposing (view)
+
+import Api.Point as Point
+import Components.NodeOptions exposing (NodeOptions, oToInputO)
+import Element exposing (..)
+import Element.Border as Border
+import UI.Icon as Icon
+import UI.NodeInputs as NodeInputs
+import UI.Style as Style
+import UI.ViewIf exposing (viewIf)
+
+
+view : NodeOptions msg -> Element msg
+view o =
+    let
+        labelWidth =
+            150
+
+        opts =
+            oToInputO o labelWidth
+
+        textInput =
+            NodeInputs.nodeTextInput opts ""
+
+        timeInput =
+            NodeInputs.nodeTimeInput opts ""
+
+        checkboxInput =
+            NodeInputs.nodeCheckboxInput opts ""
+
+        disabled =
+            Point.getBool o.node.points Point.typeDisable ""
+
+        activeZone =
+            round <| Point.getValue o.node.points Point.typeActiveZone ""
+
+        rainDelay =
+            Point.getBool o.node.points Point.typeRainDelay ""
+
+        paused =
+            Point.getBool o.node.points Point.typePause ""
+
+        remaining typ =
+            formatSeconds <| round <| Point.getValue o.node.points typ ""
+
+        status =
+            if activeZone > 0 then
+                "zone "
+                    ++ String.fromInt activeZone
+                    ++ ", "
+                    ++ remaining Point.typeZoneRemaining
+                    ++ " left ("
+                    ++ remaining Point.typeRemaining
+                    ++ " total)"
+
+            else
+                "idle"
+    in
+    column
+        [ width fill
+        , Border.widthEach { top = 2, bottom = 0, left = 0, right = 0 }
+        , Border.color Style.colors.black
+        , spacing 6
+        ]
+    <|
+        wrappedRow [ spacing 10 ]
+            [ Icon.droplet
+            , text <|
+                Point.getText o.node.points Point.typeDescription ""
+            , text status
+            , viewIf rainDelay <| text "(rain delay)"
+            , viewIf paused <| text "(paused)"
+            , viewIf disabled <| text "(disabled)"
+            ]
+            :: (if o.expDetail then
+                    [ textInput Point.typeDescription "Description" ""
+                    , timeInput Point.typeStart "Daily start time"
+                    , textInput Point.typeRainNodeID "Rain sensor node ID" "optional"
+                    , textInput Point.typeRainPointType "Rain sensor point type" "value"
+                    , checkboxInput Point.typeRun "Run"
+                    , checkboxInput Point.typePause "Pause"
+                    , checkboxInput Point.typeAdvance "Advance to next zone"
+                    , checkboxInput Point.typeDisable "Disable"
+                    ]
+
+                else
+                    []
+               )
+
+
+formatSeconds : Int -> String
+formatSeconds s =
+    String.fromInt (s // 60)
+        ++ ":"
+        ++ String.padLeft 2 '0' (String.fromInt (modBy 60 s))
@@ -0,0 +1,112 @@
+module Components.NodeSnmp exposing (view)
+
+import Api.Point as Point
+import Components.NodeOptions exposing (NodeOptions, oToInputO)
+import Element exposing (..)
+import Element.Border as Border
+import UI.Icon as Icon
+import UI.NodeInputs as NodeInputs
+import UI.Style as Style
+import UI.ViewIf exposing (viewIf)
+
+
+view : NodeOptions msg -> Element msg
+view o =
+    let
+        labelWidth =
+            150
+
+        opts =
+            oToInputO o labelWidth
+
+        textInput =
+            NodeInputs.nodeTextInput opts ""
+
+        numberInput =
+            NodeInputs.nodeNumberInput opts ""
+
+        checkboxInput =
+            NodeInputs.nodeCheckboxInput opts ""
+
+        optionInput =
+            NodeInputs.nodeOptionInput opts ""
+
+        disabled =
+            Point.getBool o.node.points Point.typeDisable ""
+
+        v3 =
+            Point.getText o.node.points Point.typeSnmpVersion "" == Point.valueSnmpV3
+
+        auth =
+            Point.getText o.node.points Point.typeAuthProtocol "" /= ""
+
+        priv =
+            Point.getText o.node.points Point.typePrivProtocol "" /= ""
+
+        counter typ =
+            String.fromFloat <| Point.getValue o.node.points typ ""
+
+        trap =
+            o.node.points
+                |> List.filter (\p -> p.typ == Point.typeTrap)
+                |> Point.getLatest
+    in
+    column
+        [ width fill
+        , Border.widthEach { top = 2, bottom = 0, left = 0, right = 0 }
+        , Border.color Style.colors.black
+        , spacing 6
+        ]
+    <|
+        wrappedRow [ spacing 10 ]
+            [ Icon.bus
+            , text <|
+                Point.getText o.node.points Point.typeDescription ""
+            , viewIf disabled <| text "(disabled)"
+            ]
+            :: (if o.expDetail then
+                    [ textInput Point.typeDescription "Description" ""
+                    , textInput Point.typeAddress "Agent address" "switch1:161"
+                    , optionInput Point.typeSnmpVersion
+                        "Version"
+                        [ ( Point.valueSnmpV2c, "v2c" )
+                        , ( Point.valueSnmpV3, "v3" )
+                        ]
+                    , viewIf (not v3) <|
+                        textInput Point.typeCommunity "Community" "public"
+                    , viewIf v3 <|
+                        textInput Point.typeUsername "Username" ""
+                    , viewIf v3 <|
+                        optionInput Point.typeAuthProtocol
+                            "Authentication"
+                            [ ( "", "none" )
+                            , ( "MD5", "MD5" )
+                            , ( "SHA", "SHA" )
+                            ]
+                    , viewIf (v3 && auth) <|
+                        textInput Point.typePass "Auth password" ""
+                    , viewIf (v3 && auth) <|
+                        optionInput Point.typePrivProtocol
+                            "Privacy"
+                            [ ( "", "none" )
+                            , ( "DES", "DES" )
+                            , ( "AES", "AES" )
+                            ]
+                    , viewIf (v3 && auth && priv) <|
+                        textInput Point.typePrivPass "Privacy password" ""
+                    , numberInput Point.typePollPeriod "Poll period (ms)"
+                    , numberInput Point.typeTrapPort "Trap port (162)"
+                    , checkboxInput Point.typeDisable "Disable"
+                    , text <| "Errors: " ++ counter Point.typeErrorCount
+                    , viewIf (trap /= Nothing) <|
+                        text <|
+                            "Last trap: "
+                                ++ (trap
+                                        |> Maybe.map (\p -> p.key ++ " " ++ p.text)
+                                        |> Maybe.withDefault ""
+                                   )
+                    ]
+
+                else
+                    []
+               )
@@ -0,0 +1,71 @@
+module Components.NodeStoreSettings exposing (view)
+
+import Api.Point as Point
+import Components.NodeOptions exposing (NodeOptions, oToInputO)
+import Element exposing (..)
+import Element.Border as Border
+import UI.Icon as Icon
+import UI.NodeInputs as NodeInputs
+import UI.Style as Style
+import UI.ViewIf exposing (viewIf)
+
+
+view : NodeOptions msg -> Element msg
+view o =
+    let
+        labelWidth =
+            150
+
+        opts =
+            oToInputO o labelWidth
+
+        textInput =
+            NodeInputs.nodeTextInput opts ""
+
+        numberInput =
+            NodeInputs.nodeNumberInput opts ""
+
+        checkboxInput =
+            NodeInputs.nodeCheckboxInput opts ""
+
+        disabled =
+            Point.getBool o.node.points Point.typeDisable ""
+
+        dryRun =
+            Point.getBool o.node.points Point.typeGcDryRun ""
+
+        counter typ =
+            String.fromFloat <| Point.getValue o.node.points typ ""
+    in
+    column
+        [ width fill
+        , Border.widthEach { top = 2, bottom = 0, left = 0, right = 0 }
+        , Border.color Style.colors.black
+        , spacing 6
+        ]
+    <|
+        wrappedRow [ spacing 10 ]
+            [ Icon.database
+            , text <|
+                Point.getText o.node.points Point.typeDescription ""
+            , viewIf disabled <| text "(disabled)"
+            , viewIf dryRun <| text "(dry run)"
+            ]
+            :: (if o.expDetail then
+                    [ textInput Point.typeDescription "Description" ""
+                    , numberInput Point.typeGcAge "GC age (days)"
+                    , numberInput Point.typeGcPeriod "GC period (h)"
+                    , checkboxInput Point.typeGcDryRun "Dry run"
+                    , textInput Point.typeKeyTypes "Keyed point types" "none if blank"
+                    , numberInput Point.typeKeyAge "Key age (days)"
+                    , numberInput Point.typeKeyLimit "Keys per type"
+                    , checkboxInput Point.typeDisable "Disable"
+                    , text <| "Last GC edges: " ++ counter Point.typeGcEdges
+                    , text <| "Last GC nodes: " ++ counter Point.typeGcNodes
+                    , text <| "Last GC keys deleted: " ++ counter Point.typeGcKeys
+                    , text <| "Last GC points purged: " ++ counter Point.typeGcPoints
+                    ]
+
+                else
+                    []
+               )
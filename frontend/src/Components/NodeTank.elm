@@ -0,0 +1,119 @@
+module Components.NodeTank exposing (view)
+
+import Api.Point as Point
+import Components.NodeOptions exposing (NodeOptions, oToInputO)
+import Element exposing (..)
+import Element.Border as Border
+import Round
+import UI.Icon as Icon
+import UI.NodeInputs as NodeInputs
+import UI.Style as Style
+import UI.ViewIf exposing (viewIf)
+
+
+view : NodeOptions msg -> Element msg
+view o =
+    let
+        labelWidth =
+            150
+
+        opts =
+            oToInputO o labelWidth
+
+        textInput =
+            NodeInputs.nodeTextInput opts ""
+
+        numberInput =
+            NodeInputs.nodeNumberInput opts ""
+
+        optionInput =
+            NodeInputs.nodeOptionInput opts ""
+
+        checkboxInput =
+            NodeInputs.nodeCheckboxInput opts ""
+
+        disabled =
+            Point.getBool o.node.points Point.typeDisable ""
+
+        leak =
+            Point.getBool o.node.points Point.typeLeak ""
+
+        shape =
+            Point.getText o.node.points Point.typeShape ""
+
+        volume =
+            Point.getValue o.node.points Point.typeVolume ""
+
+        percent =
+            Point.getValue o.node.points Point.typePercent ""
+
+        rate =
+            Point.getValue o.node.points Point.typeRate ""
+
+        -- strapping table rows are keyed by level
+        strapping =
+            o.node.points
+                |> List.filter
+                    (\p ->
+                        p.typ == Point.typeStrapping && modBy 2 p.tombstone == 0
+                    )
+                |> List.sortBy (\p -> String.toFloat p.key |> Maybe.withDefault 0)
+                |> List.map
+                    (\p ->
+                        NodeInputs.nodeNumberInput opts
+                            p.key
+                            Point.typeStrapping
+                            ("Volume at " ++ p.key)
+                    )
+    in
+    column
+        [ width fill
+        , Border.widthEach { top = 2, bottom = 0, left = 0, right = 0 }
+        , Border.color Style.colors.black
+        , spacing 6
+        ]
+    <|
+        wrappedRow [ spacing 10 ]
+            [ Icon.battery
+            , text <|
+                Point.getText o.node.points Point.typeDescription ""
+            , text <| Round.round 1 volume
+            , text <| Round.round 0 percent ++ "%"
+            , text <| Round.round 1 rate ++ "/h"
+            , viewIf leak <| text "(leak)"
+            , viewIf disabled <| text "(disabled)"
+            ]
+            :: (if o.expDetail then
+                    [ textInput Point.typeDescription "Description" ""
+                    , optionInput Point.typeShape
+                        "Shape"
+                        [ ( Point.valueVertical, "Vertical cylinder" )
+                        , ( Point.valueHorizontal, "Horizontal cylinder" )
+                        , ( Point.valueRectangular, "Rectangular" )
+                        , ( Point.valueTable, "Strapping table" )
+                        ]
+                    , viewIf (shape /= Point.valueRectangular && shape /= Point.valueTable) <|
+                        numberInput Point.typeDiameter "Diameter"
+                    , viewIf (shape == Point.valueHorizontal || shape == Point.valueRectangular) <|
+                        numberInput Point.typeLength "Length"
+                    , viewIf (shape == Point.valueRectangular) <|
+                        numberInput Point.typeWidth "Width"
+                    , viewIf (shape /= Point.valueHorizontal && shape /= Point.valueTable) <|
+                        numberInput Point.typeHeight "Height"
+                    , viewIf (shape /= Point.valueTable) <|
+                        numberInput Point.typeVolumeScale "Volume scale"
+                    , viewIf (shape == Point.valueTable) <|
+                        column [ spacing 6 ] strapping
+                    , textInput Point.typeLevelNodeID "Level node ID" ""
+                    , textInput Point.typeLevelPointType "Level point type" "value"
+                    , numberInput Point.typeLevelOffset "Level offset"
+                    , checkboxInput Point.typeFromTop "Sensor at top"
+                    , numberInput Point.typeRateWindow "Rate window (m)"
+                    , numberInput Point.typeLeakRate "Leak rate (/h)"
+                    , numberInput Point.typeLeakDelay "Leak delay (m)"
+                    , checkboxInput Point.typeDisable "Disable"
+                    ]
+
+                else
+                    []
+               )
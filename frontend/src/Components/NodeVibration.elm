@@ -0,0 +1,67 @@
+module Components.NodeVibration exposing (view)
+
+import Api.Point as Point
+import Components.NodeOptions exposing (NodeOptions, oToInputO)
+import Element exposing (..)
+import Element.Border as Border
+import Round
+import UI.Icon as Icon
+import UI.NodeInputs as NodeInputs
+import UI.Style as Style
+import UI.ViewIf exposing (viewIf)
+
+
+view : NodeOptions msg -> Element msg
+view o =
+    let
+        labelWidth =
+            150
+
+        opts =
+            oToInputO o labelWidth
+
+        textInput =
+            NodeInputs.nodeTextInput opts ""
+
+        numberInput =
+            NodeInputs.nodeNumberInput opts ""
+
+        checkboxInput =
+            NodeInputs.nodeCheckboxInput opts ""
+
+        disabled =
+            Point.getBool o.node.points Point.typeDisable ""
+
+        feature lbl typ =
+            text <| lbl ++ ": " ++ Round.round 3 (Point.getValue o.node.points typ "")
+    in
+    column
+        [ width fill
+        , Border.widthEach { top = 2, bottom = 0, left = 0, right = 0 }
+        , Border.color Style.colors.black
+        , spacing 6
+        ]
+    <|
+        wrappedRow [ spacing 10 ]
+            [ Icon.activity
+            , text <|
+                Point.getText o.node.points Point.typeDescription ""
+            , feature "RMS" Point.typeRms
+            , feature "kurtosis" Point.typeKurtosis
+            , viewIf disabled <| text "(disabled)"
+            ]
+            :: (if o.expDetail then
+                    [ textInput Point.typeDescription "Description" ""
+                    , textInput Point.typeSensorNodeID "Sensor node ID" ""
+                    , textInput Point.typeSensorPointType "Sensor point type" "value"
+                    , numberInput Point.typeSampleRate "Sample rate (Hz)"
+                    , numberInput Point.typeWindowSize "Window size"
+                    , numberInput Point.typePeriod "Period (s)"
+                    , checkboxInput Point.typeDisable "Disable"
+                    , feature "Peak" Point.typePeak
+                    , feature "Crest factor" Point.typeCrestFactor
+                    ]
+
+                else
+                    []
+               )
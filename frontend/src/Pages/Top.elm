@@ -6,24 +6,69 @@ import Api.Node as Node exposing (Node, NodeView)
 import Api.Point as Point exposing (Point)
 import Api.Port as Port
 import Api.Response exposing (Response)
+import Api.Schema as Schema exposing (NodeSchema)
 import Browser.Navigation exposing (Key)
 import Components.NodeAction as NodeAction
+import Components.NodeBacnet as NodeBacnet
+import Components.NodeBacnetIO as NodeBacnetIO
+import Components.NodeCloudForwarder as NodeCloudForwarder
+import Components.NodeClient as NodeClient
+import Components.NodeColdChain as NodeColdChain
+import Components.NodeColdChainEvent as NodeColdChainEvent
 import Components.NodeCondition as NodeCondition
+import Components.NodeCommissioning as NodeCommissioning
+import Components.NodeCommissioningCheck as NodeCommissioningCheck
+import Components.NodeConfigDrift as NodeConfigDrift
+import Components.NodeConfigTemplate as NodeConfigTemplate
 import Components.NodeDb as NodeDb
 import Components.NodeDevice as NodeDevice
+import Components.NodeDoser as NodeDoser
+import Components.NodeEmailIngest as NodeEmailIngest
+import Components.NodeEmailPattern as NodeEmailPattern
+import Components.NodeFileColumn as NodeFileColumn
+import Components.NodeFileIngest as NodeFileIngest
+import Components.NodeGenerator as NodeGenerator
 import Components.NodeGroup as NodeGroup
+import Components.NodeGsmModem as NodeGsmModem
+import Components.NodeHvac as NodeHvac
+import Components.NodeHvacStage as NodeHvacStage
+import Components.NodeKafka as NodeKafka
+import Components.NodeLighting as NodeLighting
 import Components.NodeMessageService as NodeMessageService
 import Components.NodeModbus as NodeModbus
 import Components.NodeModbusIO as NodeModbusIO
+import Components.NodeOccupancy as NodeOccupancy
+import Components.NodeOccupancyZone as NodeOccupancyZone
 import Components.NodeOneWire as NodeOneWire
 import Components.NodeOneWireIO as NodeOneWireIO
+import Components.NodeOpcUA as NodeOpcUA
+import Components.NodeOpcUAIO as NodeOpcUAIO
 import Components.NodeOptions exposing (CopyMove(..), NodeOptions)
+import Components.NodePump as NodePump
+import Components.NodePumpGroup as NodePumpGroup
+import Components.NodeQuota as NodeQuota
+import Components.NodeRetention as NodeRetention
 import Components.NodeRule as NodeRule
+import Components.NodeS3Export as NodeS3Export
+import Components.NodeSecret as NodeSecret
+import Components.NodeSequencer as NodeSequencer
+import Components.NodeSequencerZone as NodeSequencerZone
 import Components.NodeSerialDev as NodeSerialDev
 import Components.NodeSignalGenerator as SignalGenerator
+import Components.NodeSnmp as NodeSnmp
+import Components.NodeSnmpIO as NodeSnmpIO
+import Components.NodeStoreSettings as NodeStoreSettings
+import Components.NodeTank as NodeTank
 import Components.NodeUpstream as NodeUpstream
 import Components.NodeUser as NodeUser
 import Components.NodeVariable as NodeVariable
+import Components.NodeCalc as NodeCalc
+import Components.NodeCalcOutput as NodeCalcOutput
+import Components.NodeCanBus as NodeCanBus
+import Components.NodeCanMessage as NodeCanMessage
+import Components.NodeVibration as NodeVibration
+import Components.NodeVibrationBand as NodeVibrationBand
+import Components.NodeWebhook as NodeWebhook
 import Dict
 import Element exposing (..)
 import Element.Background as Background
@@ -79,6 +124,7 @@ type alias Model =
     , nodeOp : NodeOperation
     , copyMove : CopyMove
     , nodeMsg : Maybe NodeMsg
+    , schemas : List NodeSchema
     }
 
 
@@ -131,6 +177,7 @@ defaultModel key =
         OpNone
         CopyMoveNone
         Nothing
+        []
 
 
 init : Shared.Model -> Url Params -> ( Model, Cmd Msg )
@@ -146,6 +193,7 @@ init shared { key } =
                 [ Task.perform Zone Time.here
                 , Task.perform Tick Time.now
                 , Node.list { onResponse = ApiRespList, token = auth.token }
+                , Schema.list { onResponse = ApiRespSchemas, token = auth.token }
                 ]
             )
 
@@ -182,6 +230,7 @@ type Msg
     | ApiPutDuplicateNode Int String String
     | ApiPostNotificationNode
     | ApiRespList (Data (List Node))
+    | ApiRespSchemas (Data (List NodeSchema))
     | ApiRespDelete (Data Response)
     | ApiRespPostPoint (Data Response)
     | ApiRespPostAddNode Int (Data Response)
@@ -450,6 +499,19 @@ update msg model =
             , updateNodes model
             )
 
+        ApiRespSchemas resp ->
+            case resp of
+                Data.Success schemas ->
+                    ( { model | schemas = schemas }, Cmd.none )
+
+                Data.Failure err ->
+                    ( popError "Error getting schemas" err model
+                    , Cmd.none
+                    )
+
+                _ ->
+                    ( model, Cmd.none )
+
         ApiRespList resp ->
             case resp of
                 Data.Success nodes ->
@@ -899,6 +961,38 @@ nodeCustomSort t =
             t
 
 
+-- rulePriority returns the priority used to sort rules. If priority is not
+-- set, it is derived from the severity. Other nodes all have the same priority.
+
+
+rulePriority : Node -> Float
+rulePriority node =
+    if node.typ /= Node.typeRule then
+        0
+
+    else
+        let
+            priority =
+                Point.getValue node.points Point.typePriority ""
+        in
+        if priority > 0 then
+            priority
+
+        else
+            case Point.getText node.points Point.typeSeverity "" of
+                "critical" ->
+                    1
+
+                "warning" ->
+                    2
+
+                "info" ->
+                    3
+
+                _ ->
+                    4
+
+
 nodeSort : Tree NodeView -> Tree NodeView -> Order
 nodeSort a b =
     let
@@ -914,6 +1008,12 @@ nodeSort a b =
         bType =
             nodeCustomSort bNode.node.typ
 
+        aPriority =
+            rulePriority aNode.node
+
+        bPriority =
+            rulePriority bNode.node
+
         aDesc =
             String.toLower <| Point.getBestDesc aNode.node.points
 
@@ -935,6 +1035,9 @@ nodeSort a b =
     if aType /= bType then
         compare aType bType
 
+    else if aPriority /= bPriority then
+        compare aPriority bPriority
+
     else if aDesc /= bDesc then
         compare aDesc bDesc
 
@@ -1030,8 +1133,12 @@ viewNodes model =
         List.concat <|
             List.map
                 (\t ->
-                    viewNode model Nothing (Tree.label t) 0
-                        :: viewNodesHelp 1 model t
+                    let
+                        siteZone =
+                            hasTimezone (Tree.label t).node
+                    in
+                    viewNode model Nothing (Tree.label t) 0 siteZone
+                        :: viewNodesHelp 1 model siteZone t
                 )
                 treeWithEdits
 
@@ -1039,9 +1146,10 @@ viewNodes model =
 viewNodesHelp :
     Int
     -> Model
+    -> Bool
     -> Tree NodeView
     -> List (Element Msg)
-viewNodesHelp depth model tree =
+viewNodesHelp depth model siteZone tree =
     let
         node =
             Tree.label tree
@@ -1062,13 +1170,19 @@ viewNodesHelp depth model tree =
                 tombstone =
                     isTombstone childNode.node
 
+                childSiteZone =
+                    siteZone || hasTimezone childNode.node
+
                 display =
                     shouldDisplay childNode.node.typ
+                        || List.member childNode.node.typ (registeredClientTypes model.nodes)
+                        || Schema.find model.schemas childNode.node.typ
+                        /= Nothing
             in
             if display && not tombstone then
                 ret
-                    ++ viewNode model (Just node) childNode depth
-                    :: viewNodesHelp (depth + 1) model child
+                    ++ viewNode model (Just node) childNode depth childSiteZone
+                    :: viewNodesHelp (depth + 1) model childSiteZone child
 
             else
                 ret
@@ -1082,6 +1196,39 @@ isTombstone node =
     Point.getBool node.edgePoints Point.typeTombstone ""
 
 
+isArchived : Node -> Bool
+isArchived node =
+    Point.getBool node.points Point.typeArchived ""
+
+
+hasTimezone : Node -> Bool
+hasTimezone node =
+    Point.getText node.points Point.typeTimezone "" /= ""
+
+
+-- registeredClientTypes returns node types with a client registered at
+-- runtime (clientType points on the root nodes) that the frontend does not
+-- otherwise know about
+
+
+registeredClientTypes : List (Tree NodeView) -> List String
+registeredClientTypes trees =
+    List.concatMap (\t -> clientTypes (Tree.label t).node.points) trees
+
+
+clientTypes : List Point -> List String
+clientTypes points =
+    List.filterMap
+        (\p ->
+            if p.typ == Point.typeClientType && p.value /= 0 && p.tombstone == 0 && not (shouldDisplay p.key) then
+                Just p.key
+
+            else
+                Nothing
+        )
+        points
+
+
 shouldDisplay : String -> Bool
 shouldDisplay typ =
     case typ of
@@ -1124,6 +1271,135 @@ shouldDisplay typ =
         "signalGenerator" ->
             True
 
+        "gsmModem" ->
+            True
+
+        "emailIngest" ->
+            True
+
+        "emailPattern" ->
+            True
+
+        "fileIngest" ->
+            True
+
+        "fileColumn" ->
+            True
+
+        "s3Export" ->
+            True
+
+        "kafka" ->
+            True
+
+        "opcUA" ->
+            True
+
+        "opcUAIo" ->
+            True
+
+        "bacnet" ->
+            True
+
+        "bacnetIo" ->
+            True
+
+        "snmp" ->
+            True
+
+        "snmpIo" ->
+            True
+
+        "canBus" ->
+            True
+
+        "canMessage" ->
+            True
+
+        "retention" ->
+            True
+
+        "cloudForwarder" ->
+            True
+
+        "webhook" ->
+            True
+
+        "sequencer" ->
+            True
+
+        "sequencerZone" ->
+            True
+
+        "lighting" ->
+            True
+
+        "tank" ->
+            True
+
+        "pumpGroup" ->
+            True
+
+        "pump" ->
+            True
+
+        "generator" ->
+            True
+
+        "hvac" ->
+            True
+
+        "hvacStage" ->
+            True
+
+        "coldChain" ->
+            True
+
+        "coldChainEvent" ->
+            True
+
+        "doser" ->
+            True
+
+        "storeSettings" ->
+            True
+
+        "quota" ->
+            True
+
+        "vibration" ->
+            True
+
+        "vibrationBand" ->
+            True
+
+        "calc" ->
+            True
+
+        "calcOutput" ->
+            True
+
+        "occupancy" ->
+            True
+
+        "occupancyZone" ->
+            True
+
+        "configTemplate" ->
+            True
+
+        "configDrift" ->
+            True
+
+        "commissioning" ->
+            True
+
+        "commissioningCheck" ->
+            True
+
+        "secret" ->
+            True
+
         "upstream" ->
             True
 
@@ -1140,8 +1416,8 @@ shouldDisplay typ =
             False
 
 
-viewNode : Model -> Maybe NodeView -> NodeView -> Int -> Element Msg
-viewNode model parent node depth =
+viewNode : Model -> Maybe NodeView -> NodeView -> Int -> Bool -> Element Msg
+viewNode model parent node depth siteZone =
     let
         nodeView =
             case node.node.typ of
@@ -1190,14 +1466,151 @@ viewNode model parent node depth =
                 "signalGenerator" ->
                     SignalGenerator.view
 
+                "gsmModem" ->
+                    NodeGsmModem.view
+
+                "emailIngest" ->
+                    NodeEmailIngest.view
+
+                "emailPattern" ->
+                    NodeEmailPattern.view
+
+                "fileIngest" ->
+                    NodeFileIngest.view
+
+                "fileColumn" ->
+                    NodeFileColumn.view
+
+                "s3Export" ->
+                    NodeS3Export.view
+
+                "kafka" ->
+                    NodeKafka.view
+
+                "opcUA" ->
+                    NodeOpcUA.view
+
+                "opcUAIo" ->
+                    NodeOpcUAIO.view
+
+                "bacnet" ->
+                    NodeBacnet.view
+
+                "bacnetIo" ->
+                    NodeBacnetIO.view
+
+                "snmp" ->
+                    NodeSnmp.view
+
+                "snmpIo" ->
+                    NodeSnmpIO.view
+
+                "canBus" ->
+                    NodeCanBus.view
+
+                "canMessage" ->
+                    NodeCanMessage.view
+
+                "retention" ->
+                    NodeRetention.view
+
+                "cloudForwarder" ->
+                    NodeCloudForwarder.view
+
+                "webhook" ->
+                    NodeWebhook.view
+
+                "sequencer" ->
+                    NodeSequencer.view
+
+                "sequencerZone" ->
+                    NodeSequencerZone.view
+
+                "lighting" ->
+                    NodeLighting.view
+
+                "tank" ->
+                    NodeTank.view
+
+                "pumpGroup" ->
+                    NodePumpGroup.view
+
+                "pump" ->
+                    NodePump.view
+
+                "generator" ->
+                    NodeGenerator.view
+
+                "hvac" ->
+                    NodeHvac.view
+
+                "hvacStage" ->
+                    NodeHvacStage.view
+
+                "coldChain" ->
+                    NodeColdChain.view
+
+                "coldChainEvent" ->
+                    NodeColdChainEvent.view
+
+                "doser" ->
+                    NodeDoser.view
+
+                "storeSettings" ->
+                    NodeStoreSettings.view
+
+                "quota" ->
+                    NodeQuota.view
+
+                "vibration" ->
+                    NodeVibration.view
+
+                "vibrationBand" ->
+                    NodeVibrationBand.view
+
+                "calc" ->
+                    NodeCalc.view
+
+                "calcOutput" ->
+                    NodeCalcOutput.view
+
+                "occupancy" ->
+                    NodeOccupancy.view
+
+                "occupancyZone" ->
+                    NodeOccupancyZone.view
+
+                "configTemplate" ->
+                    NodeConfigTemplate.view
+
+                "configDrift" ->
+                    NodeConfigDrift.view
+
+                "commissioning" ->
+                    NodeCommissioning.view
+
+                "commissioningCheck" ->
+                    NodeCommissioningCheck.view
+
+                "secret" ->
+                    NodeSecret.view
+
                 "upstream" ->
                     NodeUpstream.view
 
                 "db" ->
                     NodeDb.view
 
-                _ ->
-                    viewUnknown
+                typ ->
+                    if
+                        List.member typ (registeredClientTypes model.nodes)
+                            || Schema.find model.schemas typ
+                            /= Nothing
+                    then
+                        NodeClient.view (Schema.find model.schemas typ)
+
+                    else
+                        viewUnknown
 
         background =
             if node.expDetail then
@@ -1221,7 +1634,7 @@ viewNode model parent node depth =
                 model.nodeMsg
 
         viewNodeOps =
-            viewNodeOperations node msg
+            viewNodeOperations model.now node msg
     in
     el
         [ width fill
@@ -1248,6 +1661,7 @@ viewNode model parent node depth =
                   nodeView
                     { now = model.now
                     , zone = model.zone
+                    , siteZone = siteZone
                     , modified = node.mod
                     , parent = Maybe.map .node parent
                     , node = node.node
@@ -1256,6 +1670,10 @@ viewNode model parent node depth =
                     , onEditNodePoint = EditNodePoint node.feID
                     , copy = model.copyMove
                     }
+                , viewClientHealth node.node
+                , viewIf (isArchived node.node) <|
+                    el [ Font.color colors.gray ] <|
+                        text "Archived (client stopped)"
                 , viewIf node.mod <|
                     Form.buttonRow
                         [ Form.button
@@ -1308,6 +1726,39 @@ viewNode model parent node depth =
             ]
 
 
+viewClientHealth : Node -> Element msg
+viewClientHealth node =
+    let
+        offline =
+            Point.getBool node.points Point.typeOffline ""
+
+        crashes =
+            Point.getValue node.points Point.typeClientCrashes ""
+
+        crashLoop =
+            Point.getBool node.points Point.typeClientCrashLoop ""
+
+        error =
+            Point.getText node.points Point.typeClientError ""
+
+        label =
+            if crashLoop then
+                "Client crash looping"
+
+            else
+                "Client crashes"
+    in
+    viewIf (offline || crashes > 0) <|
+        column [ spacing 6 ]
+            [ viewIf offline <|
+                el [ Font.color colors.red ] <|
+                    text "Client not responding"
+            , viewIf (crashes > 0) <|
+                paragraph [ Font.color colors.red ]
+                    [ text <| label ++ ": " ++ String.fromFloat crashes ++ ", last error: " ++ error ]
+            ]
+
+
 viewUnknown : NodeOptions msg -> Element msg
 viewUnknown o =
     Element.text <| "unknown node type: " ++ o.node.typ
@@ -1324,12 +1775,31 @@ nodeTypesThatHaveChildNodes =
     ]
 
 
-viewNodeOperations : NodeView -> Maybe String -> Element Msg
-viewNodeOperations node msg =
+viewNodeOperations : Time.Posix -> NodeView -> Maybe String -> Element Msg
+viewNodeOperations now node msg =
     let
         desc =
             Point.getBestDesc node.node.points
 
+        archived =
+            isArchived node.node
+
+        -- archiving is saved with the other edits of the node
+        archivePoint =
+            Point Point.typeArchived
+                ""
+                now
+                0
+                (if archived then
+                    0
+
+                 else
+                    1
+                )
+                ""
+                0
+                ""
+
         showNodeAdd =
             List.member node.node.typ
                 nodeTypesThatHaveChildNodes
@@ -1342,6 +1812,7 @@ viewNodeOperations node msg =
             , Button.x (DeleteNode node.feID node.node.id node.node.parent)
             , Button.copy (CopyNode node.feID node.node.id node.node.parent desc)
             , Button.clipboard (PasteNode node.feID node.node.id)
+            , Button.archive (EditNodePoint node.feID [ archivePoint ])
             ]
         , case msg of
             Just m ->
@@ -1402,6 +1873,211 @@ nodeDescSignalGenerator =
     row [] [ Icon.activity, text "Signal Generator" ]
 
 
+nodeDescGsmModem : Element Msg
+nodeDescGsmModem =
+    row [] [ Icon.smartphone, text "GSM Modem" ]
+
+
+nodeDescEmailIngest : Element Msg
+nodeDescEmailIngest =
+    row [] [ Icon.mail, text "Email Ingest" ]
+
+
+nodeDescEmailPattern : Element Msg
+nodeDescEmailPattern =
+    row [] [ Icon.list, text "Email Pattern" ]
+
+
+nodeDescFileIngest : Element Msg
+nodeDescFileIngest =
+    row [] [ Icon.fileText, text "File Ingest" ]
+
+
+nodeDescFileColumn : Element Msg
+nodeDescFileColumn =
+    row [] [ Icon.list, text "File Column" ]
+
+
+nodeDescS3Export : Element Msg
+nodeDescS3Export =
+    row [] [ Icon.archive, text "S3 Export" ]
+
+
+nodeDescKafka : Element Msg
+nodeDescKafka =
+    row [] [ Icon.share, text "Kafka" ]
+
+
+nodeDescOpcUA : Element Msg
+nodeDescOpcUA =
+    row [] [ Icon.bus, text "OPC UA" ]
+
+
+nodeDescOpcUAIO : Element Msg
+nodeDescOpcUAIO =
+    row [] [ Icon.io, text "OPC UA IO" ]
+
+
+nodeDescBacnet : Element Msg
+nodeDescBacnet =
+    row [] [ Icon.bus, text "BACnet" ]
+
+
+nodeDescBacnetIO : Element Msg
+nodeDescBacnetIO =
+    row [] [ Icon.io, text "BACnet IO" ]
+
+
+nodeDescSnmp : Element Msg
+nodeDescSnmp =
+    row [] [ Icon.bus, text "SNMP" ]
+
+
+nodeDescSnmpIO : Element Msg
+nodeDescSnmpIO =
+    row [] [ Icon.io, text "SNMP IO" ]
+
+
+nodeDescCanBus : Element Msg
+nodeDescCanBus =
+    row [] [ Icon.bus, text "CAN bus" ]
+
+
+nodeDescCanMessage : Element Msg
+nodeDescCanMessage =
+    row [] [ Icon.io, text "CAN message" ]
+
+
+nodeDescRetention : Element Msg
+nodeDescRetention =
+    row [] [ Icon.clock, text "Retention" ]
+
+
+nodeDescCloudForwarder : Element Msg
+nodeDescCloudForwarder =
+    row [] [ Icon.globe, text "Cloud Forwarder" ]
+
+
+nodeDescWebhook : Element Msg
+nodeDescWebhook =
+    row [] [ Icon.link, text "Webhook" ]
+
+
+nodeDescSequencer : Element Msg
+nodeDescSequencer =
+    row [] [ Icon.droplet, text "Sequencer" ]
+
+
+nodeDescSequencerZone : Element Msg
+nodeDescSequencerZone =
+    row [] [ Icon.list, text "Zone" ]
+
+
+nodeDescLighting : Element Msg
+nodeDescLighting =
+    row [] [ Icon.sun, text "Lighting" ]
+
+
+nodeDescTank : Element Msg
+nodeDescTank =
+    row [] [ Icon.battery, text "Tank" ]
+
+
+nodeDescPumpGroup : Element Msg
+nodeDescPumpGroup =
+    row [] [ Icon.activity, text "Pump group" ]
+
+
+nodeDescPump : Element Msg
+nodeDescPump =
+    row [] [ Icon.activity, text "Pump" ]
+
+
+nodeDescGenerator : Element Msg
+nodeDescGenerator =
+    row [] [ Icon.power, text "Generator" ]
+
+
+nodeDescHvac : Element Msg
+nodeDescHvac =
+    row [] [ Icon.thermometer, text "HVAC" ]
+
+
+nodeDescHvacStage : Element Msg
+nodeDescHvacStage =
+    row [] [ Icon.thermometer, text "HVAC stage" ]
+
+
+nodeDescColdChain : Element Msg
+nodeDescColdChain =
+    row [] [ Icon.thermometer, text "Cold chain" ]
+
+
+nodeDescDoser : Element Msg
+nodeDescDoser =
+    row [] [ Icon.droplet, text "Doser" ]
+
+
+nodeDescStoreSettings : Element Msg
+nodeDescStoreSettings =
+    row [] [ Icon.database, text "Store settings" ]
+
+
+nodeDescQuota : Element Msg
+nodeDescQuota =
+    row [] [ Icon.database, text "Quota" ]
+
+
+nodeDescVibration : Element Msg
+nodeDescVibration =
+    row [] [ Icon.activity, text "Vibration" ]
+
+
+nodeDescVibrationBand : Element Msg
+nodeDescVibrationBand =
+    row [] [ Icon.activity, text "Vibration band" ]
+
+
+nodeDescCalc : Element Msg
+nodeDescCalc =
+    row [] [ Icon.trendingUp, text "Calc" ]
+
+
+nodeDescCalcOutput : Element Msg
+nodeDescCalcOutput =
+    row [] [ Icon.trendingUp, text "Calc output" ]
+
+
+nodeDescOccupancy : Element Msg
+nodeDescOccupancy =
+    row [] [ Icon.users, text "Occupancy" ]
+
+
+nodeDescOccupancyZone : Element Msg
+nodeDescOccupancyZone =
+    row [] [ Icon.users, text "Occupancy zone" ]
+
+
+nodeDescConfigTemplate : Element Msg
+nodeDescConfigTemplate =
+    row [] [ Icon.clipboard, text "Config template" ]
+
+
+nodeDescCommissioning : Element Msg
+nodeDescCommissioning =
+    row [] [ Icon.check, text "Commissioning" ]
+
+
+nodeDescCommissioningCheck : Element Msg
+nodeDescCommissioningCheck =
+    row [] [ Icon.check, text "Commissioning check" ]
+
+
+nodeDescSecret : Element Msg
+nodeDescSecret =
+    row [] [ Icon.lock, text "Secret" ]
+
+
 nodeDescUpstream : Element Msg
 nodeDescUpstream =
     row [] [ Icon.uploadCloud, text "Upstream" ]
@@ -1422,6 +2098,11 @@ nodeDescActionInactive =
     row [] [ Icon.trendingDown, text "Action (rule inactive)" ]
 
 
+nodeDescClient : String -> Element Msg
+nodeDescClient typ =
+    row [] [ Icon.io, text typ ]
+
+
 viewAddNode : NodeView -> NodeToAdd -> Element Msg
 viewAddNode parent add =
     column [ spacing 10 ]
@@ -1441,8 +2122,39 @@ viewAddNode parent add =
                             , Input.option Node.typeDb nodeDescDb
                             , Input.option Node.typeVariable nodeDescVariable
                             , Input.option Node.typeSignalGenerator nodeDescSignalGenerator
+                            , Input.option Node.typeGsmModem nodeDescGsmModem
+                            , Input.option Node.typeEmailIngest nodeDescEmailIngest
+                            , Input.option Node.typeFileIngest nodeDescFileIngest
+                            , Input.option Node.typeS3Export nodeDescS3Export
+                            , Input.option Node.typeKafka nodeDescKafka
+                            , Input.option Node.typeOpcUA nodeDescOpcUA
+                            , Input.option Node.typeBacnet nodeDescBacnet
+                            , Input.option Node.typeSnmp nodeDescSnmp
+                            , Input.option Node.typeCanBus nodeDescCanBus
+                            , Input.option Node.typeRetention nodeDescRetention
+                            , Input.option Node.typeCloudForwarder nodeDescCloudForwarder
+                            , Input.option Node.typeWebhook nodeDescWebhook
+                            , Input.option Node.typeSequencer nodeDescSequencer
+                            , Input.option Node.typeLighting nodeDescLighting
+                            , Input.option Node.typeTank nodeDescTank
+                            , Input.option Node.typePumpGroup nodeDescPumpGroup
+                            , Input.option Node.typeGenerator nodeDescGenerator
+                            , Input.option Node.typeHvac nodeDescHvac
+                            , Input.option Node.typeColdChain nodeDescColdChain
+                            , Input.option Node.typeDoser nodeDescDoser
+                            , Input.option Node.typeVibration nodeDescVibration
+                            , Input.option Node.typeCalc nodeDescCalc
+                            , Input.option Node.typeOccupancy nodeDescOccupancy
+                            , Input.option Node.typeConfigTemplate nodeDescConfigTemplate
+                            , Input.option Node.typeCommissioning nodeDescCommissioning
+                            , Input.option Node.typeSecret nodeDescSecret
+                            , Input.option Node.typeStoreSettings nodeDescStoreSettings
+                            , Input.option Node.typeQuota nodeDescQuota
                             , Input.option Node.typeUpstream nodeDescUpstream
                             ]
+                                ++ List.map
+                                    (\typ -> Input.option typ (nodeDescClient typ))
+                                    (clientTypes parent.node.points)
 
                         else
                             []
@@ -1457,6 +2169,31 @@ viewAddNode parent add =
                             , Input.option Node.typeDb nodeDescDb
                             , Input.option Node.typeVariable nodeDescVariable
                             , Input.option Node.typeSignalGenerator nodeDescSignalGenerator
+                            , Input.option Node.typeGsmModem nodeDescGsmModem
+                            , Input.option Node.typeEmailIngest nodeDescEmailIngest
+                            , Input.option Node.typeFileIngest nodeDescFileIngest
+                            , Input.option Node.typeS3Export nodeDescS3Export
+                            , Input.option Node.typeKafka nodeDescKafka
+                            , Input.option Node.typeOpcUA nodeDescOpcUA
+                            , Input.option Node.typeBacnet nodeDescBacnet
+                            , Input.option Node.typeSnmp nodeDescSnmp
+                            , Input.option Node.typeCanBus nodeDescCanBus
+                            , Input.option Node.typeRetention nodeDescRetention
+                            , Input.option Node.typeCloudForwarder nodeDescCloudForwarder
+                            , Input.option Node.typeWebhook nodeDescWebhook
+                            , Input.option Node.typeSequencer nodeDescSequencer
+                            , Input.option Node.typeLighting nodeDescLighting
+                            , Input.option Node.typeTank nodeDescTank
+                            , Input.option Node.typePumpGroup nodeDescPumpGroup
+                            , Input.option Node.typeGenerator nodeDescGenerator
+                            , Input.option Node.typeHvac nodeDescHvac
+                            , Input.option Node.typeColdChain nodeDescColdChain
+                            , Input.option Node.typeDoser nodeDescDoser
+                            , Input.option Node.typeVibration nodeDescVibration
+                            , Input.option Node.typeCalc nodeDescCalc
+                            , Input.option Node.typeOccupancy nodeDescOccupancy
+                            , Input.option Node.typeConfigTemplate nodeDescConfigTemplate
+                            , Input.option Node.typeCommissioning nodeDescCommissioning
                             ]
 
                         else
@@ -1465,6 +2202,84 @@ viewAddNode parent add =
                     ++ (if parent.node.typ == Node.typeModbus then
                             [ Input.option Node.typeModbusIO nodeDescModbusIO ]
 
+                        else
+                            []
+                       )
+                    ++ (if parent.node.typ == Node.typeOpcUA then
+                            [ Input.option Node.typeOpcUAIO nodeDescOpcUAIO ]
+
+                        else
+                            []
+                       )
+                    ++ (if parent.node.typ == Node.typeBacnet then
+                            [ Input.option Node.typeBacnetIO nodeDescBacnetIO ]
+
+                        else
+                            []
+                       )
+                    ++ (if parent.node.typ == Node.typeSnmp then
+                            [ Input.option Node.typeSnmpIO nodeDescSnmpIO ]
+
+                        else
+                            []
+                       )
+                    ++ (if parent.node.typ == Node.typeCanBus then
+                            [ Input.option Node.typeCanMessage nodeDescCanMessage ]
+
+                        else
+                            []
+                       )
+                    ++ (if parent.node.typ == Node.typeEmailIngest then
+                            [ Input.option Node.typeEmailPattern nodeDescEmailPattern ]
+
+                        else
+                            []
+                       )
+                    ++ (if parent.node.typ == Node.typeFileIngest then
+                            [ Input.option Node.typeFileColumn nodeDescFileColumn ]
+
+                        else
+                            []
+                       )
+                    ++ (if parent.node.typ == Node.typeSequencer then
+                            [ Input.option Node.typeSequencerZone nodeDescSequencerZone ]
+
+                        else
+                            []
+                       )
+                    ++ (if parent.node.typ == Node.typePumpGroup then
+                            [ Input.option Node.typePump nodeDescPump ]
+
+                        else
+                            []
+                       )
+                    ++ (if parent.node.typ == Node.typeHvac then
+                            [ Input.option Node.typeHvacStage nodeDescHvacStage ]
+
+                        else
+                            []
+                       )
+                    ++ (if parent.node.typ == Node.typeVibration then
+                            [ Input.option Node.typeVibrationBand nodeDescVibrationBand ]
+
+                        else
+                            []
+                       )
+                    ++ (if parent.node.typ == Node.typeCalc then
+                            [ Input.option Node.typeCalcOutput nodeDescCalcOutput ]
+
+                        else
+                            []
+                       )
+                    ++ (if parent.node.typ == Node.typeOccupancy then
+                            [ Input.option Node.typeOccupancyZone nodeDescOccupancyZone ]
+
+                        else
+                            []
+                       )
+                    ++ (if parent.node.typ == Node.typeCommissioning then
+                            [ Input.option Node.typeCommissioningCheck nodeDescCommissioningCheck ]
+
                         else
                             []
                        )
@@ -1,5 +1,6 @@
 module UI.Button exposing
-    ( arrowDown
+    ( archive
+    , arrowDown
     , arrowRight
     , check
     , clipboard
@@ -144,6 +145,11 @@ clipboard msg =
     button FeatherIcons.clipboard msg
 
 
+archive : msg -> Element msg
+archive msg =
+    button FeatherIcons.archive msg
+
+
 dot : msg -> Element msg
 dot =
     [ Svg.circle
@@ -1,21 +1,34 @@
 module UI.Icon exposing
     ( activity
+    , archive
+    , battery
     , blank
     , bus
     , check
     , clipboard
+    , clock
     , cloud
     , cloudOff
     , database
     , device
     , dot
+    , droplet
+    , fileText
+    , globe
     , io
+    , link
     , list
+    , lock
+    , mail
     , minus
     , oneWire
     , power
     , send
     , serialDev
+    , share
+    , smartphone
+    , sun
+    , thermometer
     , trendingDown
     , trendingUp
     , uploadCloud
@@ -187,6 +200,11 @@ send =
     icon FeatherIcons.send
 
 
+share : Element msg
+share =
+    icon FeatherIcons.share2
+
+
 uploadCloud : Element msg
 uploadCloud =
     icon FeatherIcons.uploadCloud
@@ -200,3 +218,63 @@ database =
 clipboard : Element msg
 clipboard =
     icon FeatherIcons.clipboard
+
+
+smartphone : Element msg
+smartphone =
+    icon FeatherIcons.smartphone
+
+
+mail : Element msg
+mail =
+    icon FeatherIcons.mail
+
+
+fileText : Element msg
+fileText =
+    icon FeatherIcons.fileText
+
+
+archive : Element msg
+archive =
+    icon FeatherIcons.archive
+
+
+clock : Element msg
+clock =
+    icon FeatherIcons.clock
+
+
+globe : Element msg
+globe =
+    icon FeatherIcons.globe
+
+
+link : Element msg
+link =
+    icon FeatherIcons.link
+
+
+droplet : Element msg
+droplet =
+    icon FeatherIcons.droplet
+
+
+sun : Element msg
+sun =
+    icon FeatherIcons.sun
+
+
+thermometer : Element msg
+thermometer =
+    icon FeatherIcons.thermometer
+
+
+battery : Element msg
+battery =
+    icon FeatherIcons.battery
+
+
+lock : Element msg
+lock =
+    icon FeatherIcons.lock
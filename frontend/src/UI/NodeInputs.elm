@@ -15,6 +15,7 @@ import Api.Node exposing (Node)
 import Api.Point as Point exposing (Point)
 import Color
 import Element exposing (..)
+import Element.Font as Font
 import Element.Input as Input
 import List.Extra
 import Round
@@ -45,16 +46,39 @@ nodeTextInput :
     -> Element msg
 nodeTextInput o key typ lbl placeholder =
     Input.text
-        []
+        (pendingHint o typ key)
         { onChange =
             \d ->
-                o.onEditNodePoint [ Point typ key o.now 0 0 d 0 ]
+                o.onEditNodePoint [ Point typ key o.now 0 0 d 0 "" ]
         , text = Point.getText o.node.points typ key
         , placeholder = Just <| Input.placeholder [] <| text placeholder
         , label = Input.labelLeft [ width (px o.labelWidth) ] <| el [ alignRight ] <| text <| lbl ++ ":"
         }
 
 
+
+-- pendingHint shows the desired value of a point that has not been applied
+-- by the device that owns the node yet
+
+
+pendingHint : NodeInputOptions msg -> String -> String -> List (Attribute msg)
+pendingHint o typ key =
+    case Point.desiredPending o.node.points typ key of
+        Just desired ->
+            let
+                v =
+                    if desired.text /= "" then
+                        desired.text
+
+                    else
+                        String.fromFloat desired.value
+            in
+            [ onRight <| el [ paddingXY 10 0, centerY, Font.italic ] <| text <| "pending: " ++ v ]
+
+        Nothing ->
+            []
+
+
 nodeTimeInput :
     NodeInputOptions msg
     -> String
@@ -93,7 +117,7 @@ nodeTimeInput o key typ lbl =
                             Nothing ->
                                 d
                 in
-                o.onEditNodePoint [ Point typ key o.now 0 0 sendValue 0 ]
+                o.onEditNodePoint [ Point typ key o.now 0 0 sendValue 0 "" ]
         , text = display
         , placeholder = Nothing
         , label = Input.labelLeft [ width (px o.labelWidth) ] <| el [ alignRight ] <| text <| lbl ++ ":"
@@ -199,16 +223,16 @@ pointsToSchedule points =
 
 scheduleToPoints : Time.Posix -> Utils.Time.Schedule -> List Point
 scheduleToPoints now sched =
-    [ Point Point.typeStart "" now 0 0 sched.startTime 0
-    , Point Point.typeEnd "" now 0 0 sched.endTime 0
+    [ Point Point.typeStart "" now 0 0 sched.startTime 0 ""
+    , Point Point.typeEnd "" now 0 0 sched.endTime 0 ""
     ]
         ++ List.map
             (\wday ->
                 if List.member wday sched.weekdays then
-                    Point Point.typeWeekday (String.fromInt wday) now (toFloat wday) 1 "" 0
+                    Point Point.typeWeekday (String.fromInt wday) now (toFloat wday) 1 "" 0 ""
 
                 else
-                    Point Point.typeWeekday (String.fromInt wday) now (toFloat wday) 0 "" 0
+                    Point Point.typeWeekday (String.fromInt wday) now (toFloat wday) 0 "" 0 ""
             )
             [ 0, 1, 2, 3, 4, 5, 6 ]
 
@@ -286,7 +310,7 @@ nodeCheckboxInput o key typ lbl =
                             0.0
                 in
                 o.onEditNodePoint
-                    [ Point typ key o.now 0 v "" 0 ]
+                    [ Point typ key o.now 0 v "" 0 "" ]
         , checked =
             Point.getValue o.node.points typ key == 1
         , icon = Input.defaultCheckbox
@@ -339,7 +363,7 @@ nodeNumberInput o key typ lbl =
                     0
     in
     Input.text
-        []
+        (pendingHint o typ key)
         { onChange =
             \d ->
                 let
@@ -363,7 +387,7 @@ nodeNumberInput o key typ lbl =
                             Maybe.withDefault currentValueF <| String.toFloat dCheck
                 in
                 o.onEditNodePoint
-                    [ Point typ key o.now 0 v dCheck 0 ]
+                    [ Point typ key o.now 0 v dCheck 0 "" ]
         , text = currentValue
         , placeholder = Nothing
         , label = Input.labelLeft [ width (px o.labelWidth) ] <| el [ alignRight ] <| text <| lbl ++ ":"
@@ -383,7 +407,7 @@ nodeOptionInput o key typ lbl options =
         { onChange =
             \sel ->
                 o.onEditNodePoint
-                    [ Point typ key o.now 0 0 sel 0 ]
+                    [ Point typ key o.now 0 0 sel 0 "" ]
         , label =
             Input.labelLeft [ padding 12, width (px o.labelWidth) ] <|
                 el [ alignRight ] <|
@@ -433,7 +457,7 @@ nodeCounterWithReset o key typ pointResetName lbl =
                             else
                                 0
                     in
-                    o.onEditNodePoint [ Point pointResetName key o.now 0 vFloat "" 0 ]
+                    o.onEditNodePoint [ Point pointResetName key o.now 0 vFloat "" 0 "" ]
             , icon = Input.defaultCheckbox
             , checked = currentResetValue
             , label =
@@ -495,7 +519,7 @@ nodeOnOffInput o key typ pointSetName lbl =
         [ el [ width (px o.labelWidth) ] <| el [ alignRight ] <| text <| lbl ++ ":"
         , Input.button
             []
-            { onPress = Just <| o.onEditNodePoint [ Point pointSetName key o.now 0 newValue "" 0 ]
+            { onPress = Just <| o.onEditNodePoint [ Point pointSetName key o.now 0 newValue "" 0 "" ]
             , label =
                 el [ width (px 100) ] <|
                     html <|
@@ -550,6 +574,6 @@ nodePasteButton :
     -> Element msg
 nodePasteButton o label typ value =
     row [ spacing 10, paddingEach { top = 0, bottom = 0, right = 0, left = 75 } ]
-        [ UI.Button.clipboard <| o.onEditNodePoint [ Point typ "" o.now 0 0 value 0 ]
+        [ UI.Button.clipboard <| o.onEditNodePoint [ Point typ "" o.now 0 0 value 0 "" ]
         , label
         ]
@@ -0,0 +1,3 @@
+// Package generate scaffolds code for SIOT extensions, such as a new client
+// package (see Client).
+package generate
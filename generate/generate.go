@@ -0,0 +1,181 @@
+package generate
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"go/format"
+	"go/token"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+//go:embed templates/*.tmpl
+var templates embed.FS
+
+// ErrExists is returned by Client if a file it would write already exists
+var ErrExists = errors.New("file already exists")
+
+var reNodeType = regexp.MustCompile(`^[a-z][a-zA-Z0-9]*$`)
+
+// ClientArgs describes the client package to generate
+type ClientArgs struct {
+	// NodeType is the type of the nodes the client runs, ex: myDevice
+	NodeType string
+	// Dir is the directory the package directory is created in
+	Dir string
+	// Import is the import path of the generated package. If blank, it is
+	// found from the go.mod file above Dir.
+	Import string
+}
+
+// clientData is passed to the client templates
+type clientData struct {
+	NodeType string
+	// Type is the exported Go name, ex: MyDevice
+	Type string
+	// Package is the package name, ex: mydevice
+	Package string
+	Import  string
+}
+
+// Client writes a client package for args.NodeType following the Manager
+// conventions: a config struct with point tags, a client with a Start loop,
+// a test that runs the client against a test server, and a registration
+// snippet in the package doc. The package directory and import path are
+// returned. Existing files are not overwritten.
+func Client(args ClientArgs) (dir, importPath string, err error) {
+	if !reNodeType.MatchString(args.NodeType) {
+		return "", "", fmt.Errorf("node type %q must be a camelCase identifier, ex: myDevice",
+			args.NodeType)
+	}
+
+	d := clientData{
+		NodeType: args.NodeType,
+		Type:     strings.ToUpper(args.NodeType[:1]) + args.NodeType[1:],
+		Package:  strings.ToLower(args.NodeType),
+		Import:   args.Import,
+	}
+
+	if token.IsKeyword(d.Package) {
+		return "", "", fmt.Errorf("package name %q is a Go keyword", d.Package)
+	}
+
+	if args.Dir == "" {
+		args.Dir = "."
+	}
+
+	dir = filepath.Join(args.Dir, d.Package)
+
+	if d.Import == "" {
+		d.Import, err = findImportPath(dir)
+		if err != nil {
+			return "", "", err
+		}
+	}
+
+	files := map[string]string{
+		"client.go.tmpl":      d.Package + ".go",
+		"client_test.go.tmpl": d.Package + "_test.go",
+	}
+
+	out := make(map[string][]byte)
+
+	for tmpl, file := range files {
+		path := filepath.Join(dir, file)
+		if _, err := os.Stat(path); err == nil {
+			return "", "", fmt.Errorf("%v: %w", path, ErrExists)
+		}
+
+		src, err := execute(tmpl, d)
+		if err != nil {
+			return "", "", err
+		}
+		out[path] = src
+	}
+
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return "", "", err
+	}
+
+	for path, src := range out {
+		err := os.WriteFile(path, src, 0644)
+		if err != nil {
+			return "", "", err
+		}
+	}
+
+	return dir, d.Import, nil
+}
+
+// ClientRegistration returns the code that registers a generated client
+// with a SIOT server
+func ClientRegistration(nodeType, importPath string) string {
+	pkg := strings.ToLower(nodeType)
+	typ := strings.ToUpper(nodeType[:1]) + nodeType[1:]
+
+	return fmt.Sprintf(`import "%v"
+
+err = siot.Clients().Register("%v",
+	func(nc *nats.Conn, root string) client.ClientManager {
+		return client.NewManager(nc, root, %v.New%vClient)
+	})
+`, importPath, nodeType, pkg, typ)
+}
+
+// execute runs a template and formats the result
+func execute(name string, d clientData) ([]byte, error) {
+	t, err := template.ParseFS(templates, "templates/"+name)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	err = t.Execute(&buf, d)
+	if err != nil {
+		return nil, err
+	}
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("error formatting %v: %w", name, err)
+	}
+
+	return src, nil
+}
+
+var reModule = regexp.MustCompile(`(?m)^module\s+(\S+)`)
+
+// findImportPath finds the import path of dir from the nearest go.mod file
+func findImportPath(dir string) (string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+
+	for d := filepath.Dir(abs); ; d = filepath.Dir(d) {
+		mod, err := os.ReadFile(filepath.Join(d, "go.mod"))
+		if err == nil {
+			m := reModule.FindSubmatch(mod)
+			if m == nil {
+				return "", fmt.Errorf("no module in %v", filepath.Join(d, "go.mod"))
+			}
+
+			rel, err := filepath.Rel(d, abs)
+			if err != nil {
+				return "", err
+			}
+
+			return string(m[1]) + "/" + filepath.ToSlash(rel), nil
+		}
+
+		if d == filepath.Dir(d) {
+			return "", errors.New("go.mod not found, set the import path")
+		}
+	}
+}
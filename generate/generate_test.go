@@ -0,0 +1,72 @@
+package generate
+
+import (
+	"errors"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"testing"
+)
+
+func TestClient(t *testing.T) {
+	tmp := t.TempDir()
+
+	args := ClientArgs{NodeType: "myDevice", Dir: tmp, Import: "example.com/mydevice"}
+
+	dir, importPath, err := Client(args)
+	if err != nil {
+		t.Fatal("Error generating client: ", err)
+	}
+
+	if dir != filepath.Join(tmp, "mydevice") || importPath != "example.com/mydevice" {
+		t.Fatal("Wrong dir or import path: ", dir, importPath)
+	}
+
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dir, nil, 0)
+	if err != nil {
+		t.Fatal("Error parsing generated code: ", err)
+	}
+
+	pkg, ok := pkgs["mydevice"]
+	if !ok {
+		t.Fatal("Package was not generated")
+	}
+
+	decls := make(map[string]bool)
+	for _, f := range pkg.Files {
+		for _, d := range f.Decls {
+			switch d := d.(type) {
+			case *ast.FuncDecl:
+				decls[d.Name.Name] = true
+			case *ast.GenDecl:
+				for _, s := range d.Specs {
+					if ts, ok := s.(*ast.TypeSpec); ok {
+						decls[ts.Name.Name] = true
+					}
+				}
+			}
+		}
+	}
+
+	if !decls["MyDevice"] || !decls["NewMyDeviceClient"] {
+		t.Fatal("Generated package is missing the config or constructor")
+	}
+
+	if _, ok := pkgs["mydevice_test"]; !ok {
+		t.Fatal("Test was not generated")
+	}
+
+	_, _, err = Client(args)
+	if !errors.Is(err, ErrExists) {
+		t.Fatal("Expected exists error, got: ", err)
+	}
+
+	for _, typ := range []string{"", "MyDevice", "my-device", "func"} {
+		_, _, err = Client(ClientArgs{NodeType: typ, Dir: tmp, Import: "x"})
+		if err == nil {
+			t.Errorf("Expected error for node type %q", typ)
+		}
+	}
+}
@@ -0,0 +1,3 @@
+// Package kafka contains a Confluent compatible schema registry client.
+// Messages are produced with github.com/segmentio/kafka-go.
+package kafka
@@ -0,0 +1,75 @@
+package kafka
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	calls := 0
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+
+		user, pass, _ := r.BasicAuth()
+		if user != "key" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error_code":401,"message":"Unauthorized"}`))
+			return
+		}
+
+		if r.URL.Path != "/subjects/points-value/versions" {
+			t.Error("wrong path: ", r.URL.Path)
+		}
+
+		var body struct {
+			Schema     string `json:"schema"`
+			SchemaType string `json:"schemaType"`
+		}
+
+		err := json.NewDecoder(r.Body).Decode(&body)
+		if err != nil || body.Schema != `"string"` || body.SchemaType != "" {
+			t.Error("wrong body: ", err, body)
+		}
+
+		w.Write([]byte(`{"id":42}`))
+	}))
+	defer srv.Close()
+
+	r, err := NewRegistry("http://key:wrong@" + srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = r.Register("points-value", "AVRO", `"string"`)
+	if err == nil || err.Error() != "schema registry error: Unauthorized" {
+		t.Fatal("Expected unauthorized error, got: ", err)
+	}
+
+	r, err = NewRegistry("http://key:secret@" + srv.Listener.Addr().String() + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		id, err := r.Register("points-value", "AVRO", `"string"`)
+		if err != nil {
+			t.Fatal("Error registering: ", err)
+		}
+
+		if id != 42 {
+			t.Error("wrong ID: ", id)
+		}
+	}
+
+	if calls != 2 {
+		t.Error("schema ID was not cached")
+	}
+
+	f := Frame(42, []byte{1, 2})
+	if string(f) != "\x00\x00\x00\x00\x2a\x01\x02" {
+		t.Error("wrong frame: ", f)
+	}
+}
@@ -0,0 +1,111 @@
+package msg
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"strings"
+	"time"
+)
+
+// Email is a decoded email message
+type Email struct {
+	From    string
+	Subject string
+	Date    time.Time
+	Body    string
+}
+
+// ParseEmail decodes a raw RFC 822 message. For multipart messages, the
+// first text/plain part is used as the body.
+func ParseEmail(raw []byte) (Email, error) {
+	var ret Email
+
+	m, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return ret, fmt.Errorf("Error reading email: %w", err)
+	}
+
+	dec := new(mime.WordDecoder)
+
+	ret.Subject, err = dec.DecodeHeader(m.Header.Get("Subject"))
+	if err != nil {
+		ret.Subject = m.Header.Get("Subject")
+	}
+
+	ret.From = m.Header.Get("From")
+	if addr, err := mail.ParseAddress(ret.From); err == nil {
+		ret.From = addr.Address
+	}
+
+	ret.Date, err = m.Header.Date()
+	if err != nil {
+		ret.Date = time.Time{}
+	}
+
+	body, err := emailText(m.Header.Get("Content-Type"),
+		m.Header.Get("Content-Transfer-Encoding"), m.Body)
+	if err != nil {
+		return ret, err
+	}
+
+	ret.Body = strings.TrimSpace(body)
+
+	return ret, nil
+}
+
+// emailText returns the text of a message part, descending into multipart
+// parts if necessary
+func emailText(contentType, encoding string, r io.Reader) (string, error) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		// no or invalid content type defaults to text/plain
+		mediaType = "text/plain"
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		mr := multipart.NewReader(r, params["boundary"])
+		for {
+			p, err := mr.NextPart()
+			if err == io.EOF {
+				return "", nil
+			}
+			if err != nil {
+				return "", fmt.Errorf("Error reading email part: %w", err)
+			}
+
+			text, err := emailText(p.Header.Get("Content-Type"),
+				p.Header.Get("Content-Transfer-Encoding"), p)
+			if err != nil {
+				return "", err
+			}
+
+			if text != "" {
+				return text, nil
+			}
+		}
+	}
+
+	if mediaType != "text/plain" {
+		return "", nil
+	}
+
+	switch strings.ToLower(encoding) {
+	case "quoted-printable":
+		r = quotedprintable.NewReader(r)
+	case "base64":
+		r = base64.NewDecoder(base64.StdEncoding, r)
+	}
+
+	d, err := io.ReadAll(r)
+	if err != nil {
+		return "", fmt.Errorf("Error reading email body: %w", err)
+	}
+
+	return string(d), nil
+}
@@ -0,0 +1,142 @@
+package msg
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap/backend/memory"
+	"github.com/emersion/go-imap/server"
+)
+
+const testEmail = "From: Pump Controller <pump@example.com>\r\n" +
+	"To: alerts@example.com\r\n" +
+	"Subject: =?UTF-8?Q?Alarm_=E2=80=93_station_4?=\r\n" +
+	"Date: Fri, 14 Oct 2022 10:00:00 -0400\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/alternative; boundary=\"xyz\"\r\n" +
+	"\r\n" +
+	"--xyz\r\n" +
+	"Content-Type: text/plain; charset=utf-8\r\n" +
+	"Content-Transfer-Encoding: quoted-printable\r\n" +
+	"\r\n" +
+	"Level: 12.5 ft\r\n" +
+	"Status: HIGH=\r\n" +
+	" WATER\r\n" +
+	"--xyz\r\n" +
+	"Content-Type: text/html\r\n" +
+	"\r\n" +
+	"<p>Level: 12.5 ft</p>\r\n" +
+	"--xyz--\r\n"
+
+func TestParseEmail(t *testing.T) {
+	e, err := ParseEmail([]byte(testEmail))
+	if err != nil {
+		t.Fatal("Error parsing email: ", err)
+	}
+
+	if e.From != "pump@example.com" {
+		t.Error("wrong from: ", e.From)
+	}
+
+	if e.Subject != "Alarm – station 4" {
+		t.Error("wrong subject: ", e.Subject)
+	}
+
+	if !e.Date.Equal(time.Date(2022, 10, 14, 14, 0, 0, 0, time.UTC)) {
+		t.Error("wrong date: ", e.Date)
+	}
+
+	if e.Body != "Level: 12.5 ft\r\nStatus: HIGH WATER" {
+		t.Errorf("wrong body: %q", e.Body)
+	}
+}
+
+func TestIMAP(t *testing.T) {
+	be := memory.New()
+
+	user, err := be.Login(nil, "username", "password")
+	if err != nil {
+		t.Fatal("Error logging in to backend: ", err)
+	}
+
+	mbox, err := user.GetMailbox("INBOX")
+	if err != nil {
+		t.Fatal("Error getting mailbox: ", err)
+	}
+
+	// the memory backend has one message that is already seen
+	err = mbox.(*memory.Mailbox).CreateMessage(nil, time.Now(),
+		bytes.NewBufferString(testEmail))
+	if err != nil {
+		t.Fatal("Error creating message: ", err)
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("Error listening: ", err)
+	}
+
+	s := server.New(be)
+	s.AllowInsecureAuth = true
+	go s.Serve(l)
+	defer s.Close()
+
+	c, err := DialIMAP(l.Addr().String(), false, time.Second)
+	if err != nil {
+		t.Fatal("Error connecting: ", err)
+	}
+
+	err = c.Login("username", "wrong")
+	if err == nil {
+		t.Fatal("Login with wrong password succeeded")
+	}
+
+	err = c.Login("username", "password")
+	if err != nil {
+		t.Fatal("Error logging in: ", err)
+	}
+
+	err = c.Select("INBOX")
+	if err != nil {
+		t.Fatal("Error selecting mailbox: ", err)
+	}
+
+	uids, err := c.SearchUnseen()
+	if err != nil {
+		t.Fatal("Error searching: ", err)
+	}
+
+	if len(uids) != 1 || uids[0] != 7 {
+		t.Fatal("wrong search results: ", uids)
+	}
+
+	raw, err := c.Fetch(uids[0])
+	if err != nil {
+		t.Fatal("Error fetching: ", err)
+	}
+
+	if string(raw) != testEmail {
+		t.Error("fetched message does not match")
+	}
+
+	err = c.MarkSeen(uids[0])
+	if err != nil {
+		t.Fatal("Error marking seen: ", err)
+	}
+
+	uids, err = c.SearchUnseen()
+	if err != nil {
+		t.Fatal("Error searching: ", err)
+	}
+
+	if len(uids) != 0 {
+		t.Error("expected no unseen messages, got: ", uids)
+	}
+
+	err = c.Logout()
+	if err != nil {
+		t.Error("Error logging out: ", err)
+	}
+}
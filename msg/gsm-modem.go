@@ -0,0 +1,239 @@
+package msg
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jacobsa/go-serial/serial"
+	"github.com/simpleiot/simpleiot/network"
+	"github.com/simpleiot/simpleiot/respreader"
+)
+
+// GsmModem can be used to send SMS messages through a GSM modem connected
+// to a serial port using AT commands
+type GsmModem struct {
+	portName string
+	baud     int
+}
+
+// NewGsmModem creates a new GSM modem messenger. baud defaults to 115200.
+func NewGsmModem(portName string, baud int) *GsmModem {
+	if baud <= 0 {
+		baud = 115200
+	}
+
+	return &GsmModem{
+		portName: portName,
+		baud:     baud,
+	}
+}
+
+// gsmPorts serializes access to modem serial ports, which are shared by the
+// GSM modem SMS provider and the GSM modem client
+var gsmPorts = struct {
+	sync.Mutex
+	locks map[string]*sync.Mutex
+}{locks: make(map[string]*sync.Mutex)}
+
+// GsmLockPort waits until no one else is using a modem port and returns a
+// function that releases it. The port should only be open while it is
+// locked.
+func GsmLockPort(portName string) func() {
+	gsmPorts.Lock()
+	l, ok := gsmPorts.locks[portName]
+	if !ok {
+		l = &sync.Mutex{}
+		gsmPorts.locks[portName] = l
+	}
+	gsmPorts.Unlock()
+
+	l.Lock()
+	return l.Unlock
+}
+
+// SendSMS sends a sms message. The serial port is only open while the
+// message is being sent.
+func (m *GsmModem) SendSMS(to, msg string) error {
+	unlock := GsmLockPort(m.portName)
+	defer unlock()
+
+	options := serial.OpenOptions{
+		PortName:              m.portName,
+		BaudRate:              uint(m.baud),
+		DataBits:              8,
+		StopBits:              1,
+		MinimumReadSize:       0,
+		InterCharacterTimeout: 100,
+	}
+
+	port, err := serial.Open(options)
+	if err != nil {
+		return fmt.Errorf("Error opening modem port: %w", err)
+	}
+
+	rwc := respreader.NewReadWriteCloser(port, 10*time.Second,
+		100*time.Millisecond)
+	defer rwc.Close()
+
+	return GsmSendSMS(rwc, to, msg)
+}
+
+var reGsmNumber = regexp.MustCompile(`^\+?[0-9]+$`)
+
+// GsmSendSMS sends a SMS in text mode using AT commands. port should be a
+// respreader so that reads return a complete modem response. to must be a
+// phone number of digits with an optional leading +.
+func GsmSendSMS(port io.ReadWriter, to, msg string) error {
+	if !reGsmNumber.MatchString(to) {
+		return fmt.Errorf("invalid phone number: %q", to)
+	}
+
+	// disable echo so responses don't include the command
+	err := network.CmdOK(port, "ATE0")
+	if err != nil {
+		return fmt.Errorf("Error disabling modem echo: %w", err)
+	}
+
+	err = network.CmdOK(port, "AT+CMGF=1")
+	if err != nil {
+		return fmt.Errorf("Error setting SMS text mode: %w", err)
+	}
+
+	_, err = port.Write([]byte(`AT+CMGS="` + to + "\"\r"))
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, 128)
+
+	n, err := port.Read(buf)
+	if err != nil {
+		return fmt.Errorf("Error waiting for SMS prompt: %w", err)
+	}
+
+	if !strings.Contains(string(buf[:n]), ">") {
+		return fmt.Errorf("modem did not prompt for SMS: %v",
+			strings.TrimSpace(string(buf[:n])))
+	}
+
+	// message is terminated with ctrl-z, and esc cancels it, so these
+	// are removed from the text
+	msg = strings.NewReplacer("\x1a", "", "\x1b", "").Replace(msg)
+	_, err = port.Write([]byte(msg + "\x1a"))
+	if err != nil {
+		return err
+	}
+
+	// the modem may take several seconds to send the message
+	_, err = gsmReadResp(port)
+	if err != nil {
+		return fmt.Errorf("Error sending SMS: %w", err)
+	}
+
+	return nil
+}
+
+// GsmSMS is a SMS message received by a modem
+type GsmSMS struct {
+	Index int
+	From  string
+	Time  string
+	Text  string
+}
+
+var reCmgl = regexp.MustCompile(`^\+CMGL:\s*(\d+),"([^"]*)","([^"]*)",[^,]*,?"?([^"]*)"?`)
+
+// GsmReadSMS returns all received messages stored in the modem. Messages
+// should be deleted with GsmDeleteSMS after they are processed.
+func GsmReadSMS(port io.ReadWriter) ([]GsmSMS, error) {
+	err := network.CmdOK(port, "AT+CMGF=1")
+	if err != nil {
+		return nil, fmt.Errorf("Error setting SMS text mode: %w", err)
+	}
+
+	_, err = port.Write([]byte(`AT+CMGL="ALL"` + "\r"))
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := gsmReadResp(port)
+	if err != nil {
+		return nil, fmt.Errorf("Error listing SMS: %w", err)
+	}
+
+	var ret []GsmSMS
+	var cur *GsmSMS
+
+	for _, line := range strings.Split(resp, "\n") {
+		line = strings.TrimRight(line, "\r")
+
+		if m := reCmgl.FindStringSubmatch(line); m != nil {
+			if cur != nil {
+				ret = append(ret, *cur)
+			}
+			index, _ := strconv.Atoi(m[1])
+			cur = &GsmSMS{Index: index, From: m[3], Time: m[4]}
+			continue
+		}
+
+		if cur == nil {
+			continue
+		}
+
+		if line == "OK" {
+			break
+		}
+
+		if cur.Text != "" {
+			cur.Text += "\n"
+		}
+		cur.Text += line
+	}
+
+	if cur != nil {
+		ret = append(ret, *cur)
+	}
+
+	for i := range ret {
+		ret[i].Text = strings.TrimSpace(ret[i].Text)
+	}
+
+	return ret, nil
+}
+
+// GsmDeleteSMS deletes a message stored in the modem
+func GsmDeleteSMS(port io.ReadWriter, index int) error {
+	return network.CmdOK(port, fmt.Sprintf("AT+CMGD=%v", index))
+}
+
+// gsmReadResp reads until the modem returns OK or ERROR. Responses may
+// arrive in several pieces.
+func gsmReadResp(port io.Reader) (string, error) {
+	buf := make([]byte, 1024)
+	var resp string
+
+	for i := 0; i < 6; i++ {
+		n, err := port.Read(buf)
+		resp += string(buf[:n])
+
+		if strings.Contains(resp, "ERROR") {
+			return resp, fmt.Errorf("modem error: %v", strings.TrimSpace(resp))
+		}
+
+		if strings.HasSuffix(strings.TrimSpace(resp), "OK") {
+			return resp, nil
+		}
+
+		if err != nil && err != io.EOF {
+			return resp, err
+		}
+	}
+
+	return resp, errors.New("timeout waiting for modem response")
+}
@@ -0,0 +1,134 @@
+package msg
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+)
+
+// IMAP is used to poll a mailbox for new messages. It wraps the
+// github.com/emersion/go-imap client with the few operations that are needed.
+type IMAP struct {
+	c *client.Client
+}
+
+// DialIMAP connects to an IMAP server. If useTLS is set, the connection
+// uses implicit TLS (typically port 993). timeout applies to the connection
+// and to each command.
+func DialIMAP(addr string, useTLS bool, timeout time.Duration) (*IMAP, error) {
+	dialer := &net.Dialer{Timeout: timeout}
+
+	var c *client.Client
+	var err error
+
+	if useTLS {
+		c, err = client.DialWithDialerTLS(dialer, addr, nil)
+	} else {
+		c, err = client.DialWithDialer(dialer, addr)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	c.Timeout = timeout
+
+	return &IMAP{c: c}, nil
+}
+
+// NewIMAP creates an IMAP client from an existing connection and reads
+// the server greeting. If timeout is set, it applies to each command.
+func NewIMAP(conn net.Conn, timeout time.Duration) (*IMAP, error) {
+	c, err := client.New(conn)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("Error reading IMAP greeting: %w", err)
+	}
+
+	c.Timeout = timeout
+
+	return &IMAP{c: c}, nil
+}
+
+// Close closes the connection without logging out
+func (c *IMAP) Close() error {
+	return c.c.Terminate()
+}
+
+// Logout logs out and closes the connection
+func (c *IMAP) Logout() error {
+	return c.c.Logout()
+}
+
+// Login authenticates with the server
+func (c *IMAP) Login(user, pass string) error {
+	return c.c.Login(user, pass)
+}
+
+// Select selects a mailbox
+func (c *IMAP) Select(mailbox string) error {
+	_, err := c.c.Select(mailbox, false)
+	return err
+}
+
+// SearchUnseen returns the UIDs of all unseen messages in the selected
+// mailbox
+func (c *IMAP) SearchUnseen() ([]uint32, error) {
+	criteria := imap.NewSearchCriteria()
+	criteria.WithoutFlags = []string{imap.SeenFlag}
+	return c.c.UidSearch(criteria)
+}
+
+// Fetch returns the raw RFC 822 message for a UID. The message is not
+// marked as seen.
+func (c *IMAP) Fetch(uid uint32) ([]byte, error) {
+	seqSet := new(imap.SeqSet)
+	seqSet.AddNum(uid)
+
+	section := &imap.BodySectionName{Peek: true}
+	messages := make(chan *imap.Message, 1)
+	done := make(chan error, 1)
+
+	go func() {
+		done <- c.c.UidFetch(seqSet, []imap.FetchItem{section.FetchItem()}, messages)
+	}()
+
+	var ret []byte
+	var err error
+
+	for m := range messages {
+		body := m.GetBody(section)
+		if body == nil || ret != nil {
+			continue
+		}
+
+		ret, err = io.ReadAll(body)
+	}
+
+	if fetchErr := <-done; fetchErr != nil {
+		return nil, fetchErr
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if ret == nil {
+		return nil, fmt.Errorf("message %v not found", uid)
+	}
+
+	return ret, nil
+}
+
+// MarkSeen sets the seen flag on a message
+func (c *IMAP) MarkSeen(uid uint32) error {
+	seqSet := new(imap.SeqSet)
+	seqSet.AddNum(uid)
+
+	return c.c.UidStore(seqSet, imap.FormatFlagsOp(imap.AddFlags, true),
+		[]interface{}{imap.SeenFlag}, nil)
+}
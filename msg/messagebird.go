@@ -0,0 +1,66 @@
+package msg
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// MessageBird can be used to send SMS messages through MessageBird
+type MessageBird struct {
+	accessKey  string
+	originator string
+	url        string
+}
+
+// NewMessageBird creates a new MessageBird messenger
+func NewMessageBird(accessKey, originator string) *MessageBird {
+	return &MessageBird{
+		accessKey:  accessKey,
+		originator: originator,
+		url:        "https://rest.messagebird.com/messages",
+	}
+}
+
+// SendSMS sends a sms message
+func (m *MessageBird) SendSMS(to, msg string) error {
+	form := url.Values{
+		"originator": {m.originator},
+		"recipients": {to},
+		"body":       {msg},
+	}
+
+	req, err := http.NewRequest(http.MethodPost, m.url, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", "AccessKey "+m.accessKey)
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusCreated {
+		return nil
+	}
+
+	var ret struct {
+		Errors []struct {
+			Code        int    `json:"code"`
+			Description string `json:"description"`
+		} `json:"errors"`
+	}
+
+	if json.NewDecoder(resp.Body).Decode(&ret) == nil && len(ret.Errors) > 0 {
+		return fmt.Errorf("MessageBird error: %v: %v", ret.Errors[0].Code,
+			ret.Errors[0].Description)
+	}
+
+	return fmt.Errorf("MessageBird error: %v", resp.Status)
+}
@@ -0,0 +1,47 @@
+package msg
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// SMSProvider is implemented by services that can send SMS messages
+type SMSProvider interface {
+	SendSMS(to, msg string) error
+}
+
+// ErrNotSMS is returned if a message service does not send SMS messages
+var ErrNotSMS = errors.New("message service does not send SMS")
+
+// NewSMSProvider returns the SMS provider for a message service node
+func NewSMSProvider(svc data.MsgService) (SMSProvider, error) {
+	switch svc.Service {
+	case data.PointValueTwilio:
+		return NewTwilio(svc.SID, svc.AuthToken, svc.From), nil
+	case data.PointValueAwsSns:
+		if svc.Region == "" {
+			return nil, errors.New("AWS SNS region must be set")
+		}
+		return NewAwsSns(svc.SID, svc.AuthToken, svc.SessionToken, svc.Region,
+			svc.From), nil
+	case data.PointValueVonage:
+		return NewVonage(svc.SID, svc.AuthToken, svc.From), nil
+	case data.PointValueMessageBird:
+		return NewMessageBird(svc.AuthToken, svc.From), nil
+	case data.PointValueGsmModem:
+		if svc.Port == "" {
+			return nil, errors.New("GSM modem port must be set")
+		}
+		return NewGsmModem(svc.Port, svc.Baud), nil
+	case data.PointValueSMTP:
+		return nil, ErrNotSMS
+	}
+
+	return nil, fmt.Errorf("unknown message service: %v", svc.Service)
+}
+
+var httpClient = &http.Client{Timeout: 30 * time.Second}
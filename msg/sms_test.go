@@ -0,0 +1,220 @@
+package msg
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/simpleiot/simpleiot/data"
+)
+
+func TestNewSMSProvider(t *testing.T) {
+	tests := []struct {
+		svc data.MsgService
+		err bool
+	}{
+		{data.MsgService{Service: data.PointValueTwilio}, false},
+		{data.MsgService{Service: data.PointValueAwsSns, Region: "us-east-1"}, false},
+		{data.MsgService{Service: data.PointValueAwsSns}, true},
+		{data.MsgService{Service: data.PointValueVonage}, false},
+		{data.MsgService{Service: data.PointValueMessageBird}, false},
+		{data.MsgService{Service: data.PointValueGsmModem, Port: "/dev/ttyUSB2"}, false},
+		{data.MsgService{Service: data.PointValueGsmModem}, true},
+		{data.MsgService{Service: "pigeon"}, true},
+	}
+
+	for _, test := range tests {
+		_, err := NewSMSProvider(test.svc)
+		if (err != nil) != test.err {
+			t.Errorf("%v: unexpected error result: %v", test.svc.Service, err)
+		}
+	}
+
+	_, err := NewSMSProvider(data.MsgService{Service: data.PointValueSMTP})
+	if err != ErrNotSMS {
+		t.Error("expected ErrNotSMS for smtp, got: ", err)
+	}
+}
+
+func TestAwsSns(t *testing.T) {
+	var auth, token, phone, message string
+	fail := false
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		token = r.Header.Get("X-Amz-Security-Token")
+		phone = r.FormValue("PhoneNumber")
+		message = r.FormValue("Message")
+
+		if fail {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`<ErrorResponse><Error><Code>InvalidClientTokenId</Code>` +
+				`<Message>The security token included in the request is invalid</Message>` +
+				`</Error></ErrorResponse>`))
+		}
+	}))
+	defer ts.Close()
+
+	m := NewAwsSns("AKID", "secret", "token", "us-east-1", "")
+	m.url = ts.URL
+
+	err := m.SendSMS("+15555551234", "hi there")
+	if err != nil {
+		t.Fatal("Error sending SMS: ", err)
+	}
+
+	if phone != "+15555551234" || message != "hi there" {
+		t.Errorf("wrong request: %v, %v", phone, message)
+	}
+
+	if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKID/") ||
+		!strings.Contains(auth, "/us-east-1/sns/aws4_request") ||
+		!strings.Contains(auth, "x-amz-security-token") {
+		t.Error("wrong authorization header: ", auth)
+	}
+
+	if token != "token" {
+		t.Error("wrong session token: ", token)
+	}
+
+	fail = true
+	err = m.SendSMS("+15555551234", "hi there")
+	if err == nil || !strings.Contains(err.Error(), "InvalidClientTokenId") {
+		t.Error("expected error, got: ", err)
+	}
+}
+
+func TestVonage(t *testing.T) {
+	var text string
+	status := "0"
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		text = r.FormValue("text")
+		w.Write([]byte(`{"message-count":"1","messages":[{"status":"` + status +
+			`","error-text":"Bad Credentials"}]}`))
+	}))
+	defer ts.Close()
+
+	v := NewVonage("key", "secret", "SIOT")
+	v.url = ts.URL
+
+	err := v.SendSMS("+15555551234", "hi there")
+	if err != nil {
+		t.Fatal("Error sending SMS: ", err)
+	}
+
+	if text != "hi there" {
+		t.Error("wrong text: ", text)
+	}
+
+	status = "4"
+	err = v.SendSMS("+15555551234", "hi there")
+	if err == nil || !strings.Contains(err.Error(), "Bad Credentials") {
+		t.Error("expected error, got: ", err)
+	}
+}
+
+func TestMessageBird(t *testing.T) {
+	var auth, recipients string
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		recipients = r.FormValue("recipients")
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer ts.Close()
+
+	m := NewMessageBird("abc", "SIOT")
+	m.url = ts.URL
+
+	err := m.SendSMS("+15555551234", "hi there")
+	if err != nil {
+		t.Fatal("Error sending SMS: ", err)
+	}
+
+	if auth != "AccessKey abc" || recipients != "+15555551234" {
+		t.Errorf("wrong request: %v, %v", auth, recipients)
+	}
+}
+
+// fakeModem responds to AT commands with canned responses
+type fakeModem struct {
+	resp []string
+	sms  string
+	list string
+}
+
+func (fm *fakeModem) Write(d []byte) (int, error) {
+	s := string(d)
+	switch {
+	case strings.HasPrefix(s, "AT+CMGS"):
+		fm.resp = append(fm.resp, "\r\n> ")
+	case strings.HasPrefix(s, "AT+CMGL"):
+		fm.resp = append(fm.resp, fm.list)
+	case strings.HasPrefix(s, "AT"):
+		fm.resp = append(fm.resp, "\r\nOK\r\n")
+	case strings.HasSuffix(s, "\x1a"):
+		fm.sms = strings.TrimSuffix(s, "\x1a")
+		fm.resp = append(fm.resp, "\r\n+CMGS: 12\r\n", "\r\nOK\r\n")
+	}
+	return len(d), nil
+}
+
+func (fm *fakeModem) Read(d []byte) (int, error) {
+	if len(fm.resp) < 1 {
+		return 0, nil
+	}
+	n := copy(d, fm.resp[0])
+	fm.resp = fm.resp[1:]
+	return n, nil
+}
+
+func TestGsmSendSMS(t *testing.T) {
+	fm := &fakeModem{}
+
+	err := GsmSendSMS(fm, "+15555551234", "tank level high")
+	if err != nil {
+		t.Fatal("Error sending SMS: ", err)
+	}
+
+	if fm.sms != "tank level high" {
+		t.Error("wrong SMS text: ", fm.sms)
+	}
+
+	for _, to := range []string{"", "+1555\"\r\nATD911;", "555-1234"} {
+		err = GsmSendSMS(&fakeModem{}, to, "hi")
+		if err == nil {
+			t.Errorf("invalid number %q was accepted", to)
+		}
+	}
+}
+
+func TestGsmReadSMS(t *testing.T) {
+	fm := &fakeModem{
+		list: "\r\n+CMGL: 1,\"REC UNREAD\",\"+15555551234\",,\"22/10/14,10:00:00-20\"\r\n" +
+			"pump on\r\n" +
+			"+CMGL: 3,\"REC READ\",\"+15555554321\",\"\",\"22/10/14,10:05:00-20\"\r\n" +
+			"line 1\r\nline 2\r\n\r\nOK\r\n",
+	}
+
+	sms, err := GsmReadSMS(fm)
+	if err != nil {
+		t.Fatal("Error reading SMS: ", err)
+	}
+
+	exp := []GsmSMS{
+		{Index: 1, From: "+15555551234", Time: "22/10/14,10:00:00-20", Text: "pump on"},
+		{Index: 3, From: "+15555554321", Time: "22/10/14,10:05:00-20", Text: "line 1\nline 2"},
+	}
+
+	if len(sms) != len(exp) {
+		t.Fatalf("expected %v messages, got: %+v", len(exp), sms)
+	}
+
+	for i := range exp {
+		if sms[i] != exp[i] {
+			t.Errorf("message %v: expected %+v, got %+v", i, exp[i], sms[i])
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package msg
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+)
+
+// AwsSns can be used to send SMS messages through AWS SNS
+type AwsSns struct {
+	creds    aws.Credentials
+	region   string
+	senderID string
+	url      string
+}
+
+// NewAwsSns creates a new AWS SNS messenger. sessionToken is only needed with
+// temporary credentials. senderID is optional and is only supported in some
+// countries.
+func NewAwsSns(accessKey, secretKey, sessionToken, region, senderID string) *AwsSns {
+	return &AwsSns{
+		creds: aws.Credentials{
+			AccessKeyID:     accessKey,
+			SecretAccessKey: secretKey,
+			SessionToken:    sessionToken,
+		},
+		region:   region,
+		senderID: senderID,
+		url:      "https://sns." + region + ".amazonaws.com/",
+	}
+}
+
+// SendSMS sends a sms message
+func (m *AwsSns) SendSMS(to, msg string) error {
+	form := url.Values{}
+	form.Set("Action", "Publish")
+	form.Set("Version", "2010-03-31")
+	form.Set("PhoneNumber", to)
+	form.Set("Message", msg)
+
+	if m.senderID != "" {
+		form.Set("MessageAttributes.entry.1.Name", "AWS.SNS.SMS.SenderID")
+		form.Set("MessageAttributes.entry.1.Value.DataType", "String")
+		form.Set("MessageAttributes.entry.1.Value.StringValue", m.senderID)
+	}
+
+	body := form.Encode()
+
+	req, err := http.NewRequest(http.MethodPost, m.url, strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+
+	bodyHash := sha256.Sum256([]byte(body))
+
+	err = v4.NewSigner().SignHTTP(context.Background(), m.creds, req,
+		hex.EncodeToString(bodyHash[:]), "sns", m.region, time.Now())
+	if err != nil {
+		return fmt.Errorf("Error signing request: %w", err)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		var snsErr struct {
+			Error struct {
+				Code    string
+				Message string
+			}
+		}
+
+		if xml.Unmarshal(respBody, &snsErr) == nil && snsErr.Error.Message != "" {
+			return fmt.Errorf("SNS error: %v: %v", snsErr.Error.Code,
+				snsErr.Error.Message)
+		}
+
+		return fmt.Errorf("SNS error: %v", resp.Status)
+	}
+
+	return nil
+}
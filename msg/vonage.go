@@ -0,0 +1,71 @@
+package msg
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// Vonage can be used to send SMS messages through Vonage (Nexmo)
+type Vonage struct {
+	apiKey    string
+	apiSecret string
+	from      string
+	url       string
+}
+
+// NewVonage creates a new Vonage messenger
+func NewVonage(apiKey, apiSecret, from string) *Vonage {
+	return &Vonage{
+		apiKey:    apiKey,
+		apiSecret: apiSecret,
+		from:      from,
+		url:       "https://rest.nexmo.com/sms/json",
+	}
+}
+
+// SendSMS sends a sms message
+func (m *Vonage) SendSMS(to, msg string) error {
+	resp, err := httpClient.PostForm(m.url, url.Values{
+		"api_key":    {m.apiKey},
+		"api_secret": {m.apiSecret},
+		"from":       {m.from},
+		"to":         {to},
+		"text":       {msg},
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Vonage error: %v", resp.Status)
+	}
+
+	var ret struct {
+		Messages []struct {
+			Status    string `json:"status"`
+			ErrorText string `json:"error-text"`
+		} `json:"messages"`
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&ret)
+	if err != nil {
+		return fmt.Errorf("Error decoding Vonage response: %w", err)
+	}
+
+	if len(ret.Messages) < 1 {
+		return errors.New("Vonage did not return message status")
+	}
+
+	// status 0 is success, any other value is an error
+	for _, s := range ret.Messages {
+		if s.Status != "0" {
+			return fmt.Errorf("Vonage error: %v: %v", s.Status, s.ErrorText)
+		}
+	}
+
+	return nil
+}
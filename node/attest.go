@@ -0,0 +1,152 @@
+package node
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// attestation key of this device, see SetAttestationKey
+var attestation struct {
+	lock sync.Mutex
+	key  crypto.Signer
+}
+
+// SetAttestationKey sets the key used to attest this device to upstream
+// instances that have a provision URL (see data.PointTypeProvisionURL). The
+// key should be held in a TPM or secure element, which typically provide a
+// crypto.Signer.
+func SetAttestationKey(key crypto.Signer) {
+	attestation.lock.Lock()
+	defer attestation.lock.Unlock()
+	attestation.key = key
+}
+
+func attestationKey() crypto.Signer {
+	attestation.lock.Lock()
+	defer attestation.lock.Unlock()
+	return attestation.key
+}
+
+// LoadAttestationKey reads an ECDSA P-256 key from a PEM file. If the file
+// does not exist, a new key is generated and saved to it. A key in a file is
+// not hardware backed, so this is mostly useful for testing.
+func LoadAttestationKey(file string) (crypto.Signer, error) {
+	contents, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, fmt.Errorf("Error generating attestation key: %w", err)
+		}
+
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+
+		out := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+		err = os.WriteFile(file, out, 0600)
+		if err != nil {
+			return nil, fmt.Errorf("Error saving attestation key: %w", err)
+		}
+
+		return key, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("Error reading attestation key: %w", err)
+	}
+
+	block, _ := pem.Decode(contents)
+	if block == nil {
+		return nil, errors.New("attestation key file is not PEM encoded")
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing attestation key: %w", err)
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("attestation key can't be used for signing")
+	}
+
+	return signer, nil
+}
+
+func postAttest(url, proxy string, req data.AttestRequest) (data.AttestResponse, error) {
+	var ret data.AttestResponse
+
+	d, err := json.Marshal(req)
+	if err != nil {
+		return ret, err
+	}
+
+	httpClient := &http.Client{Timeout: 10 * time.Second}
+	if proxy != "" {
+		httpClient.Transport, err = client.ProxyTransport(proxy)
+		if err != nil {
+			return ret, err
+		}
+	}
+	resp, err := httpClient.Post(url, "application/json", bytes.NewReader(d))
+	if err != nil {
+		return ret, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var msg bytes.Buffer
+		msg.ReadFrom(resp.Body)
+		return ret, fmt.Errorf("%v: %v", resp.Status, strings.TrimSpace(msg.String()))
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(&ret)
+	return ret, err
+}
+
+// attest gets NATS credentials (creds file contents) from the upstream at
+// provisionURL by signing a challenge with the attestation key. Requests go through proxy if it is set.
+func attest(provisionURL, proxy, deviceID string) (string, error) {
+	key := attestationKey()
+	if key == nil {
+		return "", errors.New("no attestation key is set")
+	}
+
+	url := strings.TrimSuffix(provisionURL, "/") + "/v1/attest/"
+
+	resp, err := postAttest(url+"challenge", proxy, data.AttestRequest{DeviceID: deviceID})
+	if err != nil {
+		return "", fmt.Errorf("Error getting attestation challenge: %w", err)
+	}
+
+	sig, err := data.SignAttestation(key, deviceID, resp.Challenge)
+	if err != nil {
+		return "", fmt.Errorf("Error signing attestation challenge: %w", err)
+	}
+
+	resp, err = postAttest(url+"verify", proxy, data.AttestRequest{
+		DeviceID:  deviceID,
+		Challenge: resp.Challenge,
+		Signature: sig,
+	})
+	if err != nil {
+		return "", fmt.Errorf("Error verifying attestation: %w", err)
+	}
+
+	return resp.Creds, nil
+}
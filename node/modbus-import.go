@@ -0,0 +1,294 @@
+package node
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// ModbusRegister describes a register in a register map that is imported as
+// a Modbus IO node (see ParseModbusRegisters). Type is the Modbus IO type
+// (coil, discreteInput, inputRegister, holdingRegister, or the modbusIoType
+// point value). Format is the data format of registers (uint16 if blank).
+type ModbusRegister struct {
+	Description string  `json:"description"`
+	ID          int     `json:"id"`
+	Address     int     `json:"address"`
+	Type        string  `json:"type"`
+	Format      string  `json:"format"`
+	Scale       float64 `json:"scale"`
+	Offset      float64 `json:"offset"`
+	Units       string  `json:"units"`
+	DeviceUnits string  `json:"deviceUnits"`
+	ReadOnly    bool    `json:"readOnly"`
+}
+
+// short names for Modbus IO types in register maps
+var modbusIOTypes = map[string]string{
+	"coil":            data.PointValueModbusCoil,
+	"discreteinput":   data.PointValueModbusDiscreteInput,
+	"discrete":        data.PointValueModbusDiscreteInput,
+	"inputregister":   data.PointValueModbusInputRegister,
+	"input":           data.PointValueModbusInputRegister,
+	"holdingregister": data.PointValueModbusHoldingRegister,
+	"holding":         data.PointValueModbusHoldingRegister,
+}
+
+// points returns the points of the Modbus IO node for the register
+func (r ModbusRegister) points() data.Points {
+	now := time.Now()
+
+	pts := data.Points{
+		{Time: now, Type: data.PointTypeDescription, Text: r.Description},
+		{Time: now, Type: data.PointTypeID, Value: float64(r.ID)},
+		{Time: now, Type: data.PointTypeAddress, Value: float64(r.Address)},
+		{Time: now, Type: data.PointTypeModbusIOType, Text: r.Type},
+		{Time: now, Type: data.PointTypeReadOnly, Value: data.BoolToFloat(r.ReadOnly)},
+	}
+
+	if r.Type == data.PointValueModbusInputRegister ||
+		r.Type == data.PointValueModbusHoldingRegister {
+		pts = append(pts,
+			data.Point{Time: now, Type: data.PointTypeDataFormat, Text: r.Format},
+			data.Point{Time: now, Type: data.PointTypeScale, Value: r.Scale},
+			data.Point{Time: now, Type: data.PointTypeOffset, Value: r.Offset},
+			data.Point{Time: now, Type: data.PointTypeUnits, Text: r.Units},
+			data.Point{Time: now, Type: data.PointTypeDeviceUnits, Text: r.DeviceUnits})
+	}
+
+	return pts
+}
+
+// normalize sets the full IO type and defaults, and checks the register is
+// a valid Modbus IO
+func (r *ModbusRegister) normalize() error {
+	if t, ok := modbusIOTypes[strings.ToLower(r.Type)]; ok {
+		r.Type = t
+	}
+
+	if r.Format == "" {
+		r.Format = data.PointValueUINT16
+	}
+
+	ne := data.NodeEdge{Type: data.NodeTypeModbusIO, Points: r.points()}
+	_, err := NewModbusIONode(data.PointValueClient, &ne)
+	if err != nil {
+		return err
+	}
+
+	switch r.Type {
+	case data.PointValueModbusCoil, data.PointValueModbusDiscreteInput:
+		return nil
+	case data.PointValueModbusInputRegister, data.PointValueModbusHoldingRegister:
+	default:
+		return fmt.Errorf("invalid type: %v", r.Type)
+	}
+
+	switch r.Format {
+	case data.PointValueUINT16, data.PointValueINT16, data.PointValueUINT32,
+		data.PointValueINT32, data.PointValueFLOAT32:
+	default:
+		return fmt.Errorf("invalid format: %v", r.Format)
+	}
+
+	return nil
+}
+
+// ParseModbusRegisters reads a register map in CSV or JSON format. A JSON
+// register map is an array of ModbusRegister objects. A CSV register map
+// has a header row with the ModbusRegister JSON field names as column names
+// (in any order, case is ignored), and one register per row. Address and
+// type are required, scale defaults to 1. The register map is checked
+// before anything is returned, so an import is all or nothing.
+func ParseModbusRegisters(r io.Reader, format string) ([]ModbusRegister, error) {
+	var regs []ModbusRegister
+
+	switch strings.ToLower(format) {
+	case "json":
+		err := json.NewDecoder(r).Decode(&regs)
+		if err != nil {
+			return nil, fmt.Errorf("Error decoding register map: %w", err)
+		}
+
+		for i := range regs {
+			if regs[i].Scale == 0 {
+				regs[i].Scale = 1
+			}
+		}
+	case "csv":
+		var err error
+		regs, err = parseModbusRegistersCSV(r)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported register map format: %v", format)
+	}
+
+	if len(regs) <= 0 {
+		return nil, errors.New("register map is empty")
+	}
+
+	for i := range regs {
+		err := regs[i].normalize()
+		if err != nil {
+			return nil, fmt.Errorf("register %v (%v): %w", i+1,
+				regs[i].Description, err)
+		}
+	}
+
+	return regs, nil
+}
+
+func parseModbusRegistersCSV(r io.Reader) ([]ModbusRegister, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+
+	rows, err := cr.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("Error reading register map: %w", err)
+	}
+
+	if len(rows) <= 0 {
+		return nil, errors.New("register map is empty")
+	}
+
+	columns := make(map[string]int)
+	for i, c := range rows[0] {
+		columns[strings.ToLower(strings.TrimSpace(c))] = i
+	}
+
+	for _, c := range []string{"address", "type"} {
+		if _, ok := columns[c]; !ok {
+			return nil, fmt.Errorf("register map does not have a %v column", c)
+		}
+	}
+
+	var regs []ModbusRegister
+
+	for i, row := range rows[1:] {
+		line := i + 2
+
+		field := func(name string) string {
+			c, ok := columns[strings.ToLower(name)]
+			if !ok || c >= len(row) {
+				return ""
+			}
+			return strings.TrimSpace(row[c])
+		}
+
+		number := func(name string, def float64) (float64, error) {
+			s := field(name)
+			if s == "" {
+				return def, nil
+			}
+			v, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				return 0, fmt.Errorf("line %v: invalid %v: %v", line, name, s)
+			}
+			return v, nil
+		}
+
+		reg := ModbusRegister{
+			Description: field("description"),
+			Type:        field("type"),
+			Format:      field("format"),
+			Units:       field("units"),
+			DeviceUnits: field("deviceUnits"),
+		}
+
+		id, err := number("id", 1)
+		if err != nil {
+			return nil, err
+		}
+		reg.ID = int(id)
+
+		address, err := number("address", -1)
+		if err != nil {
+			return nil, err
+		}
+		if address < 0 {
+			return nil, fmt.Errorf("line %v: address is required", line)
+		}
+		reg.Address = int(address)
+
+		reg.Scale, err = number("scale", 1)
+		if err != nil {
+			return nil, err
+		}
+
+		reg.Offset, err = number("offset", 0)
+		if err != nil {
+			return nil, err
+		}
+
+		switch strings.ToLower(field("readOnly")) {
+		case "1", "true", "yes", "y", "x":
+			reg.ReadOnly = true
+		}
+
+		regs = append(regs, reg)
+	}
+
+	return regs, nil
+}
+
+// ImportModbusRegisters creates a Modbus IO node under the Modbus node for
+// each register. If the Modbus node already has an IO with the same ID,
+// address, and type, its points are updated instead, so a register map can
+// be imported again after it is edited. The number of IO nodes created and
+// updated is returned.
+func ImportModbusRegisters(nc *nats.Conn, modbusID string, regs []ModbusRegister) (created, updated int, err error) {
+	children, err := client.GetNodeChildren(nc, modbusID, data.NodeTypeModbusIO, false, false)
+	if err != nil {
+		return 0, 0, fmt.Errorf("Error getting Modbus IOs: %w", err)
+	}
+
+	key := func(id, address int, typ string) string {
+		return fmt.Sprintf("%v:%v:%v", id, address, typ)
+	}
+
+	existing := make(map[string]string)
+	for _, c := range children {
+		id, _ := c.Points.ValueInt(data.PointTypeID, "")
+		address, _ := c.Points.ValueInt(data.PointTypeAddress, "")
+		typ, _ := c.Points.Text(data.PointTypeModbusIOType, "")
+		existing[key(id, address, typ)] = c.ID
+	}
+
+	for _, r := range regs {
+		if nodeID, ok := existing[key(r.ID, r.Address, r.Type)]; ok {
+			err := client.SendNodePoints(nc, nodeID, r.points(), true)
+			if err != nil {
+				return created, updated, fmt.Errorf("Error updating IO %v: %w",
+					r.Description, err)
+			}
+			updated++
+			continue
+		}
+
+		err := client.SendNode(nc, data.NodeEdge{
+			ID:     uuid.New().String(),
+			Type:   data.NodeTypeModbusIO,
+			Parent: modbusID,
+			Points: r.points(),
+		}, "")
+		if err != nil {
+			return created, updated, fmt.Errorf("Error creating IO %v: %w",
+				r.Description, err)
+		}
+		created++
+	}
+
+	return created, updated, nil
+}
@@ -0,0 +1,74 @@
+package node
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/simpleiot/simpleiot/data"
+)
+
+func TestParseModbusRegisters(t *testing.T) {
+	csvMap := `Description, Address, Type, Format, Scale, Units, ReadOnly
+Temperature, 100, input, int16, 0.1, C, x
+Setpoint, 200, holdingRegister, float32, , , 
+Pump, 1, coil, , , , 
+`
+
+	regs, err := ParseModbusRegisters(strings.NewReader(csvMap), "csv")
+	if err != nil {
+		t.Fatal("Error parsing CSV: ", err)
+	}
+
+	exp := []ModbusRegister{
+		{Description: "Temperature", ID: 1, Address: 100,
+			Type: data.PointValueModbusInputRegister, Format: data.PointValueINT16,
+			Scale: 0.1, Units: "C", ReadOnly: true},
+		{Description: "Setpoint", ID: 1, Address: 200,
+			Type: data.PointValueModbusHoldingRegister, Format: data.PointValueFLOAT32,
+			Scale: 1},
+		{Description: "Pump", ID: 1, Address: 1,
+			Type: data.PointValueModbusCoil, Format: data.PointValueUINT16, Scale: 1},
+	}
+
+	if len(regs) != len(exp) {
+		t.Fatalf("Expected %v registers, got %v", len(exp), len(regs))
+	}
+
+	for i := range exp {
+		if regs[i] != exp[i] {
+			t.Errorf("Register %v, expected %+v, got %+v", i, exp[i], regs[i])
+		}
+	}
+
+	jsonMap := `[{"description": "Level", "id": 2, "address": 10, "type": "holding",
+		"format": "uint32", "scale": 0.5, "offset": -10}]`
+
+	regs, err = ParseModbusRegisters(strings.NewReader(jsonMap), "json")
+	if err != nil {
+		t.Fatal("Error parsing JSON: ", err)
+	}
+
+	expJSON := ModbusRegister{Description: "Level", ID: 2, Address: 10,
+		Type: data.PointValueModbusHoldingRegister, Format: data.PointValueUINT32,
+		Scale: 0.5, Offset: -10}
+
+	if len(regs) != 1 || regs[0] != expJSON {
+		t.Fatalf("Expected %+v, got %+v", expJSON, regs)
+	}
+
+	bad := map[string]string{
+		"no address column": "description, type\nfoo, coil\n",
+		"missing address":   "address, type\n, coil\n",
+		"bad type":          "address, type\n1, bogus\n",
+		"bad format":        "address, type, format\n1, input, int64\n",
+		"bad scale":         "address, type, scale\n1, input, abc\n",
+		"empty":             "address, type\n",
+	}
+
+	for name, m := range bad {
+		_, err := ParseModbusRegisters(strings.NewReader(m), "csv")
+		if err == nil {
+			t.Errorf("%v: expected error", name)
+		}
+	}
+}
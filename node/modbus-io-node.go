@@ -2,11 +2,15 @@ package node
 
 import (
 	"errors"
+	"log"
 
 	"github.com/simpleiot/simpleiot/data"
+	"github.com/simpleiot/simpleiot/data/units"
 )
 
-// ModbusIONode describes a modbus IO db node
+// ModbusIONode describes a modbus IO db node. On server buses, the IO can
+// mirror the sourcePointType (defaults to value) point with sourcePointKey of
+// sourceNodeID, so other nodes can be polled by Modbus clients.
 type ModbusIONode struct {
 	nodeID             string
 	description        string
@@ -17,6 +21,8 @@ type ModbusIONode struct {
 	readOnly           bool
 	scale              float64
 	offset             float64
+	units              string
+	deviceUnits        string
 	value              float64
 	valueSet           float64
 	disable            bool
@@ -26,6 +32,9 @@ type ModbusIONode struct {
 	errorCountReset    bool
 	errorCountCRCReset bool
 	errorCountEOFReset bool
+	sourceNodeID       string
+	sourcePointType    string
+	sourcePointKey     string
 }
 
 // NewModbusIONode Convert node to modbus IO node
@@ -71,6 +80,12 @@ func NewModbusIONode(busType string, node *data.NodeEdge) (*ModbusIONode, error)
 		if !ok {
 			return nil, errors.New("Must define modbus offset")
 		}
+		ret.units, _ = node.Points.Text(data.PointTypeUnits, "")
+		ret.deviceUnits, _ = node.Points.Text(data.PointTypeDeviceUnits, "")
+		_, err := units.Convert(0, ret.deviceUnits, ret.units)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	ret.value, _ = node.Points.Value(data.PointTypeValue, "")
@@ -82,6 +97,9 @@ func NewModbusIONode(busType string, node *data.NodeEdge) (*ModbusIONode, error)
 	ret.errorCountReset, _ = node.Points.ValueBool(data.PointTypeErrorCountReset, "")
 	ret.errorCountCRCReset, _ = node.Points.ValueBool(data.PointTypeErrorCountCRCReset, "")
 	ret.errorCountEOFReset, _ = node.Points.ValueBool(data.PointTypeErrorCountEOFReset, "")
+	ret.sourceNodeID, _ = node.Points.Text(data.PointTypeSourceNodeID, "")
+	ret.sourcePointType, _ = node.Points.Text(data.PointTypeSourcePointType, "")
+	ret.sourcePointKey, _ = node.Points.Text(data.PointTypeSourcePointKey, "")
 
 	return &ret, nil
 }
@@ -95,6 +113,8 @@ func (io *ModbusIONode) Changed(newIO *ModbusIONode) bool {
 		io.modbusDataType != newIO.modbusDataType ||
 		io.scale != newIO.scale ||
 		io.offset != newIO.offset ||
+		io.units != newIO.units ||
+		io.deviceUnits != newIO.deviceUnits ||
 		io.value != newIO.value ||
 		io.valueSet != newIO.valueSet ||
 		io.errorCountReset != newIO.errorCountReset ||
@@ -105,3 +125,36 @@ func (io *ModbusIONode) Changed(newIO *ModbusIONode) bool {
 
 	return false
 }
+
+// sourceMatch returns true if the point is the source point of the IO
+func (io *ModbusIONode) sourceMatch(p data.Point) bool {
+	pointType := io.sourcePointType
+	if pointType == "" {
+		pointType = data.PointTypeValue
+	}
+	pointKey := io.sourcePointKey
+
+	return p.Type == pointType && (p.Key == pointKey ||
+		(pointKey == "" && p.Key == "0") || (pointKey == "0" && p.Key == ""))
+}
+
+// fromDevice converts a scaled register value in the device units to the
+// units of the IO
+func (io *ModbusIONode) fromDevice(v float64) float64 {
+	ret, err := units.Convert(v, io.deviceUnits, io.units)
+	if err != nil {
+		log.Printf("Modbus IO %v: %v\n", io.description, err)
+		return v
+	}
+	return ret
+}
+
+// toDevice converts a value in the units of the IO to the device units
+func (io *ModbusIONode) toDevice(v float64) float64 {
+	ret, err := units.Convert(v, io.units, io.deviceUnits)
+	if err != nil {
+		log.Printf("Modbus IO %v: %v\n", io.description, err)
+		return v
+	}
+	return ret
+}
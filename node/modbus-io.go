@@ -5,14 +5,17 @@ import (
 	"time"
 
 	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/client"
 	"github.com/simpleiot/simpleiot/data"
 )
 
 // ModbusIO represents the state of a managed modbus io
 type ModbusIO struct {
-	ioNode   *ModbusIONode
-	sub      *nats.Subscription
-	lastSent time.Time
+	ioNode    *ModbusIONode
+	sub       *nats.Subscription
+	sourceSub *nats.Subscription
+	sourceKey string
+	lastSent  time.Time
 }
 
 // NewModbusIO creates a new modbus IO
@@ -23,7 +26,7 @@ func NewModbusIO(nc *nats.Conn, node *ModbusIONode, chPoint chan<- pointWID) (*M
 
 	var err error
 	io.sub, err = nc.Subscribe("node."+io.ioNode.nodeID+".points", func(msg *nats.Msg) {
-		points, err := data.PbDecodePoints(msg.Data)
+		points, err := client.DecodePoints(msg)
 		if err != nil {
 			// FIXME, send over channel
 			log.Println("Error decoding node data: ", err)
@@ -42,6 +45,70 @@ func NewModbusIO(nc *nats.Conn, node *ModbusIONode, chPoint chan<- pointWID) (*M
 	return io, nil
 }
 
+// subscribeSource subscribes to the source point of the IO and returns its
+// current value if the source changed. Source points are sent to chSource
+// with the ID of the IO.
+func (io *ModbusIO) subscribeSource(nc *nats.Conn, chSource chan<- pointWID) (data.Point, bool) {
+	n := io.ioNode
+	key := n.sourceNodeID + "." + n.sourcePointType + "." + n.sourcePointKey
+	if key == io.sourceKey {
+		return data.Point{}, false
+	}
+
+	io.unsubscribeSource()
+	io.sourceKey = key
+
+	if n.sourceNodeID == "" {
+		return data.Point{}, false
+	}
+
+	// the callback uses a copy as the IO node is changed by the bus
+	src := *n
+
+	var err error
+	io.sourceSub, err = nc.Subscribe(client.SubjectNodePoints(n.sourceNodeID), func(msg *nats.Msg) {
+		points, err := client.DecodePoints(msg)
+		if err != nil {
+			log.Println("Error decoding modbus IO source points: ", err)
+			return
+		}
+
+		for _, p := range points {
+			if src.sourceMatch(p) {
+				chSource <- pointWID{src.nodeID, p}
+			}
+		}
+	})
+	if err != nil {
+		log.Printf("Modbus IO %v: error subscribing to source: %v\n", n.description, err)
+		return data.Point{}, false
+	}
+
+	nodes, err := client.GetNode(nc, n.sourceNodeID, "none")
+	if err != nil || len(nodes) < 1 {
+		log.Printf("Modbus IO %v: error getting source: %v\n", n.description, err)
+		return data.Point{}, false
+	}
+
+	for _, p := range nodes[0].Points {
+		if n.sourceMatch(p) && p.Tombstone%2 == 0 {
+			return p, true
+		}
+	}
+
+	return data.Point{}, false
+}
+
+func (io *ModbusIO) unsubscribeSource() {
+	if io.sourceSub != nil {
+		err := io.sourceSub.Unsubscribe()
+		if err != nil {
+			log.Println("Error unsubscribing from IO source: ", err)
+		}
+		io.sourceSub = nil
+	}
+}
+
 // Stop io
 func (io *ModbusIO) Stop() {
 	if io.sub != nil {
@@ -50,4 +117,5 @@ func (io *ModbusIO) Stop() {
 			log.Println("Error unsubscribing from IO: ", err)
 		}
 	}
+	io.unsubscribeSource()
 }
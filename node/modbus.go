@@ -45,6 +45,7 @@ type Modbus struct {
 
 	chDone      chan bool
 	chPoint     chan pointWID
+	chSource    chan pointWID
 	chError     <-chan error
 	chRegChange chan bool
 }
@@ -57,6 +58,7 @@ func NewModbus(nc *nats.Conn, node data.NodeEdge) (*Modbus, error) {
 		ios:         make(map[string]*ModbusIO),
 		chDone:      make(chan bool),
 		chPoint:     make(chan pointWID),
+		chSource:    make(chan pointWID),
 		chRegChange: make(chan bool),
 	}
 
@@ -70,7 +72,7 @@ func NewModbus(nc *nats.Conn, node data.NodeEdge) (*Modbus, error) {
 	// closure is required so we don't get races accessing bus.busNode
 	func(id string) {
 		bus.sub, err = nc.Subscribe("node."+bus.busNode.nodeID+".points", func(msg *nats.Msg) {
-			points, err := data.PbDecodePoints(msg.Data)
+			points, err := client.DecodePoints(msg)
 			if err != nil {
 				// FIXME, send over channel
 				log.Println("Error decoding node data: ", err)
@@ -133,6 +135,7 @@ func (b *Modbus) CheckIOs() error {
 			}
 			b.ios[node.ID] = io
 			b.InitRegs(io.ioNode)
+			b.checkSource(io)
 		}
 	}
 
@@ -150,6 +153,81 @@ func (b *Modbus) CheckIOs() error {
 	return nil
 }
 
+// checkSource subscribes to the source point of an IO on a server bus
+func (b *Modbus) checkSource(io *ModbusIO) {
+	if b.busNode.busType != data.PointValueServer {
+		io.unsubscribeSource()
+		io.sourceKey = ""
+		return
+	}
+
+	p, ok := io.subscribeSource(b.nc, b.chSource)
+	if ok {
+		b.sourcePoint(io.ioNode, p)
+	}
+}
+
+// sourcePoint writes the value of the source point of an IO to the server
+// registers and the IO value
+func (b *Modbus) sourcePoint(io *ModbusIONode, p data.Point) {
+	value := p.Value
+
+	if b.server != nil {
+		switch io.modbusIOType {
+		case data.PointValueModbusDiscreteInput, data.PointValueModbusCoil:
+			b.regs.WriteCoil(io.address, data.FloatToBool(value))
+		case data.PointValueModbusInputRegister, data.PointValueModbusHoldingRegister:
+			io.value = value
+			err := b.WriteReg(io)
+			if err != nil {
+				log.Printf("Modbus IO %v: error writing source value: %v\n",
+					io.description, err)
+				return
+			}
+			// the IO value is what clients read from the register
+			value, err = b.ReadReg(io)
+			if err != nil {
+				log.Printf("Modbus IO %v: error reading source value: %v\n",
+					io.description, err)
+				return
+			}
+		}
+	}
+
+	if io.value == value {
+		return
+	}
+
+	io.value = value
+	err := b.SendPoint(io.nodeID, data.PointTypeValue, value)
+	if err != nil {
+		log.Println("Error sending modbus IO value: ", err)
+	}
+}
+
+// writeSource writes a value written by a Modbus client to the source
+// point of an IO
+func (b *Modbus) writeSource(io *ModbusIONode, value float64) error {
+	if io.sourceNodeID == "" {
+		return nil
+	}
+
+	pointType := io.sourcePointType
+	if pointType == "" {
+		pointType = data.PointTypeValue
+	}
+
+	p := data.Point{
+		Time:   time.Now(),
+		Type:   pointType,
+		Key:    io.sourcePointKey,
+		Value:  value,
+		Origin: io.nodeID,
+	}
+
+	return client.SendNodePoint(b.nc, io.sourceNodeID, p, true)
+}
+
 // SendPoint sends a point over nats
 func (b *Modbus) SendPoint(nodeID, pointType string, value float64) error {
 	// send the point
@@ -165,7 +243,7 @@ func (b *Modbus) SendPoint(nodeID, pointType string, value float64) error {
 // WriteBusHoldingReg used to write register values to bus
 // should only be used by client
 func (b *Modbus) WriteBusHoldingReg(io *ModbusIONode) error {
-	unscaledValue := (io.valueSet - io.offset) / io.scale
+	unscaledValue := (io.toDevice(io.valueSet) - io.offset) / io.scale
 	switch io.modbusDataType {
 	case data.PointValueUINT16, data.PointValueINT16:
 		err := b.client.WriteSingleReg(byte(io.id),
@@ -287,7 +365,7 @@ func (b *Modbus) ReadBusReg(io *ModbusIO) error {
 			io.ioNode.modbusDataType)
 	}
 
-	value := valueUnscaled*io.ioNode.scale + io.ioNode.offset
+	value := io.ioNode.fromDevice(valueUnscaled*io.ioNode.scale + io.ioNode.offset)
 
 	if value != io.ioNode.value || time.Since(io.lastSent) > time.Minute*10 {
 		io.ioNode.value = value
@@ -358,6 +436,7 @@ func (b *Modbus) ClientIO(io *ModbusIO) error {
 			// we need set the remote value
 			err := b.client.WriteSingleCoil(byte(io.ioNode.id), uint16(io.ioNode.address),
 				vBool)
+			b.confirmValueSet(io.ioNode, err)
 
 			if err != nil {
 				return err
@@ -384,6 +463,7 @@ func (b *Modbus) ClientIO(io *ModbusIO) error {
 		if !io.ioNode.readOnly && io.ioNode.valueSet != io.ioNode.value {
 			// we need set the remote value
 			err := b.WriteBusHoldingReg(io.ioNode)
+			b.confirmValueSet(io.ioNode, err)
 
 			if err != nil {
 				return err
@@ -408,6 +488,16 @@ func (b *Modbus) ClientIO(io *ModbusIO) error {
 	return nil
 }
 
+// confirmValueSet confirms a valueSet command after writing it to the
+// remote device
+func (b *Modbus) confirmValueSet(io *ModbusIONode, writeErr error) {
+	err := client.ConfirmCommand(b.nc, io.nodeID,
+		data.Point{Type: data.PointTypeValueSet}, writeErr)
+	if err != nil {
+		log.Println("Error confirming modbus write: ", err)
+	}
+}
+
 // ServerIO processes an IO on a server bus
 func (b *Modbus) ServerIO(io *ModbusIONode) error {
 	// update regs with db value
@@ -427,6 +517,11 @@ func (b *Modbus) ServerIO(io *ModbusIONode) error {
 			if err != nil {
 				return err
 			}
+
+			err = b.writeSource(io, data.BoolToFloat(regValue))
+			if err != nil {
+				return err
+			}
 		}
 
 	case data.PointValueModbusInputRegister:
@@ -443,6 +538,11 @@ func (b *Modbus) ServerIO(io *ModbusIONode) error {
 			if err != nil {
 				return err
 			}
+
+			err = b.writeSource(io, v)
+			if err != nil {
+				return err
+			}
 		}
 
 	default:
@@ -523,13 +623,13 @@ func (b *Modbus) ReadReg(io *ModbusIONode) (float64, error) {
 		return 0, fmt.Errorf("unhandled data type: %v",
 			io.modbusDataType)
 	}
-	return valueUnscaled*io.scale + io.offset, nil
+	return io.fromDevice(valueUnscaled*io.scale + io.offset), nil
 }
 
 // WriteReg writes an io value to a reg
 // This should only be used on server
 func (b *Modbus) WriteReg(io *ModbusIONode) error {
-	unscaledValue := (io.value - io.offset) / io.scale
+	unscaledValue := (io.toDevice(io.value) - io.offset) / io.scale
 	switch io.modbusDataType {
 	case data.PointValueUINT16, data.PointValueINT16:
 		b.regs.WriteReg(io.address, uint16(unscaledValue))
@@ -758,6 +858,10 @@ func (b *Modbus) Run() {
 					if err != nil {
 						log.Println("Error setting up serial port: ", err)
 					}
+					// sources are only used on servers
+					for _, io := range b.ios {
+						b.checkSource(io)
+					}
 				case data.PointTypePollPeriod:
 					setScanTimer()
 
@@ -836,6 +940,19 @@ func (b *Modbus) Run() {
 					io.ioNode.scale = p.Value
 				case data.PointTypeOffset:
 					io.ioNode.offset = p.Value
+				case data.PointTypeUnits:
+					io.ioNode.units = p.Text
+				case data.PointTypeDeviceUnits:
+					io.ioNode.deviceUnits = p.Text
+				case data.PointTypeSourceNodeID:
+					io.ioNode.sourceNodeID = p.Text
+					b.checkSource(io)
+				case data.PointTypeSourcePointType:
+					io.ioNode.sourcePointType = p.Text
+					b.checkSource(io)
+				case data.PointTypeSourcePointKey:
+					io.ioNode.sourcePointKey = p.Text
+					b.checkSource(io)
 				case data.PointTypeValue:
 					valueModified = true
 					io.ioNode.value = p.Value
@@ -918,6 +1035,12 @@ func (b *Modbus) Run() {
 					}
 				}
 			}
+		case point := <-b.chSource:
+			io, ok := b.ios[point.id]
+			if ok {
+				b.sourcePoint(io.ioNode, point.point)
+			}
+
 		case <-b.chRegChange:
 			// this only happens on modbus servers
 			for _, io := range b.ios {
@@ -2,9 +2,15 @@ package node
 
 import (
 	"fmt"
+	"sync"
 	"testing"
+	"time"
 
+	natsserver "github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/client"
 	"github.com/simpleiot/simpleiot/data"
+	"github.com/simpleiot/simpleiot/modbus"
 )
 
 func TestNotifyTemplate(t *testing.T) {
@@ -40,3 +46,144 @@ func TestNotifyTemplate(t *testing.T) {
 
 	fmt.Println("render result: ", res)
 }
+
+func TestModbusIONodeUnits(t *testing.T) {
+	node := data.NodeEdge{
+		ID: "io",
+		Points: data.Points{
+			{Type: data.PointTypeAddress, Value: 1},
+			{Type: data.PointTypeModbusIOType, Text: data.PointValueModbusHoldingRegister},
+			{Type: data.PointTypeDataFormat, Text: data.PointValueINT16},
+			{Type: data.PointTypeScale, Value: 0.1},
+			{Type: data.PointTypeOffset, Value: 0},
+			{Type: data.PointTypeDeviceUnits, Text: "psi"},
+			{Type: data.PointTypeUnits, Text: "kPa"},
+		},
+	}
+
+	io, err := NewModbusIONode(data.PointValueClient, &node)
+	if err != nil {
+		t.Fatal("Error creating IO: ", err)
+	}
+
+	if v := io.fromDevice(10); v < 68.94 || v > 68.95 {
+		t.Error("Wrong value read: ", v)
+	}
+
+	if v := io.toDevice(68.94757); v < 9.999 || v > 10.001 {
+		t.Error("Wrong value written: ", v)
+	}
+
+	node.Points[len(node.Points)-1].Text = "C"
+
+	_, err = NewModbusIONode(data.PointValueClient, &node)
+	if err == nil {
+		t.Error("Expected error converting pressure to temperature")
+	}
+}
+
+type testModbusServer struct{}
+
+func (testModbusServer) Close() error                       { return nil }
+func (testModbusServer) Listen(func(error), func(), func()) {}
+
+func TestModbusIOSource(t *testing.T) {
+	ns, err := natsserver.NewServer(&natsserver.Options{Port: -1, NoSigs: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go ns.Start()
+	t.Cleanup(ns.Shutdown)
+
+	if !ns.ReadyForConnections(5 * time.Second) {
+		t.Fatal("NATS server not ready")
+	}
+
+	nc, err := nats.Connect(ns.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(nc.Close)
+
+	// fake store records the points sent to each node
+	var lock sync.Mutex
+	sent := make(map[string]data.Points)
+	_, err = nc.Subscribe("node.*.points", func(msg *nats.Msg) {
+		points, err := client.DecodePoints(msg)
+		if err != nil {
+			t.Error(err)
+		}
+		lock.Lock()
+		id := msg.Subject[len("node.") : len(msg.Subject)-len(".points")]
+		sent[id] = append(sent[id], points...)
+		lock.Unlock()
+		msg.Respond(nil)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ioNode, err := NewModbusIONode(data.PointValueServer, &data.NodeEdge{
+		ID: "io",
+		Points: data.Points{
+			{Type: data.PointTypeAddress, Value: 10},
+			{Type: data.PointTypeModbusIOType, Text: data.PointValueModbusHoldingRegister},
+			{Type: data.PointTypeDataFormat, Text: data.PointValueUINT16},
+			{Type: data.PointTypeScale, Value: 0.1},
+			{Type: data.PointTypeOffset, Value: 0},
+			{Type: data.PointTypeSourceNodeID, Text: "sensor"},
+			{Type: data.PointTypeSourcePointType, Text: data.PointTypeLevel},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !ioNode.sourceMatch(data.Point{Type: data.PointTypeLevel, Key: "0"}) ||
+		ioNode.sourceMatch(data.Point{Type: data.PointTypeValue}) {
+		t.Fatal("Wrong source point match")
+	}
+
+	b := &Modbus{
+		nc:      nc,
+		busNode: &ModbusNode{busType: data.PointValueServer},
+		regs:    &modbus.Regs{},
+		server:  testModbusServer{},
+	}
+
+	b.InitRegs(ioNode)
+
+	// source values are written to the register and IO value
+	b.sourcePoint(ioNode, data.Point{Type: data.PointTypeLevel, Value: 21.37})
+
+	reg, err := b.regs.ReadReg(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reg != 213 {
+		t.Fatal("Wrong register value: ", reg)
+	}
+
+	lock.Lock()
+	if len(sent["io"]) != 1 || sent["io"][0].Value < 21.299 || sent["io"][0].Value > 21.301 {
+		t.Fatal("Wrong IO value sent: ", sent["io"])
+	}
+	lock.Unlock()
+
+	// writes from Modbus clients are sent to the source
+	b.regs.WriteReg(10, 250)
+	err = b.ServerIO(ioNode)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	if len(sent["sensor"]) != 1 {
+		t.Fatal("Source point not written: ", sent["sensor"])
+	}
+	p := sent["sensor"][0]
+	if p.Type != data.PointTypeLevel || p.Value != 25 || p.Origin != "io" {
+		t.Fatal("Wrong source point written: ", p)
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/nats-io/nats.go"
 	"github.com/simpleiot/simpleiot/client"
 	"github.com/simpleiot/simpleiot/data"
+	"github.com/simpleiot/simpleiot/data/units"
 )
 
 type oneWireIO struct {
@@ -31,7 +32,7 @@ func newOneWireIO(nc *nats.Conn, node *oneWireIONode, chPoint chan<- pointWID) (
 
 	var err error
 	io.sub, err = nc.Subscribe("node."+io.ioNode.nodeID+".points", func(msg *nats.Msg) {
-		points, err := data.PbDecodePoints(msg.Data)
+		points, err := client.DecodePoints(msg)
 		if err != nil {
 			// FIXME, send over channel
 			log.Println("Error decoding node data: ", err)
@@ -117,8 +118,12 @@ func (io *oneWireIO) read() error {
 
 	v := float64(vRaw) / 1000
 
-	if io.ioNode.units == "F" {
-		v = v*1.8 + 32
+	// 1-wire temperature sensors report in °C
+	if units.Known(io.ioNode.units) {
+		v, err = units.Convert(v, "C", io.ioNode.units)
+		if err != nil {
+			return err
+		}
 	}
 
 	if v != io.ioNode.value || time.Since(io.lastSent) > time.Minute*10 {
@@ -44,7 +44,7 @@ func newOneWire(nc *nats.Conn, node data.NodeEdge) (*oneWire, error) {
 	// closure is required so we don't get races accessing ow.busNode
 	func(id string) {
 		ow.sub, err = nc.Subscribe("node."+ow.owNode.nodeID+".points", func(msg *nats.Msg) {
-			points, err := data.PbDecodePoints(msg.Data)
+			points, err := client.DecodePoints(msg)
 			if err != nil {
 				// FIXME, send over channel
 				log.Println("Error decoding node data: ", err)
@@ -0,0 +1,128 @@
+package node
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/client"
+)
+
+// how long a snapshot is kept after the last request, so an interrupted
+// download can be resumed
+var backupExpire = 10 * time.Minute
+
+// upstreamBackup sends snapshots of the local store to an upstream instance
+// in chunks (see client.DeviceBackup). The last snapshot is kept until it
+// expires, so requests for later chunks read from the same snapshot.
+type upstreamBackup struct {
+	nc   *nats.Conn
+	ncUp *nats.Conn
+
+	lock     sync.Mutex
+	id       string
+	snapshot []byte
+	expire   *time.Timer
+}
+
+func newUpstreamBackup(nc, ncUp *nats.Conn) *upstreamBackup {
+	return &upstreamBackup{nc: nc, ncUp: ncUp}
+}
+
+// handle responds to a client.DeviceBackupRequest with a chunk
+func (b *upstreamBackup) handle(msg *nats.Msg) {
+	var req client.DeviceBackupRequest
+	var chunk client.DeviceBackupChunk
+
+	err := json.Unmarshal(msg.Data, &req)
+	if err == nil {
+		chunk, err = b.chunk(req)
+	}
+
+	if err != nil {
+		log.Println("Error sending backup upstream: ", err)
+		chunk.Error = err.Error()
+	}
+
+	out, err := json.Marshal(chunk)
+	if err != nil {
+		log.Println("Error encoding backup chunk: ", err)
+		return
+	}
+
+	err = msg.Respond(out)
+	if err != nil {
+		log.Println("Error responding to backup request: ", err)
+	}
+}
+
+// chunk returns the chunk at the request offset, taking a new snapshot if
+// the request ID is blank
+func (b *upstreamBackup) chunk(req client.DeviceBackupRequest) (client.DeviceBackupChunk, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if req.ID == "" {
+		var buf bytes.Buffer
+		err := client.StoreBackup(b.nc, &buf)
+		if err != nil {
+			return client.DeviceBackupChunk{}, err
+		}
+
+		hash := sha256.Sum256(buf.Bytes())
+		b.id = hex.EncodeToString(hash[:])
+		b.snapshot = buf.Bytes()
+		log.Printf("Sending %v byte store snapshot upstream\n", len(b.snapshot))
+	} else if req.ID != b.id {
+		return client.DeviceBackupChunk{}, client.ErrSnapshotExpired
+	}
+
+	if req.Offset < 0 || req.Offset > int64(len(b.snapshot)) {
+		return client.DeviceBackupChunk{}, errors.New("offset is outside the snapshot")
+	}
+
+	if b.expire != nil {
+		b.expire.Stop()
+	}
+	b.expire = time.AfterFunc(backupExpire, b.clear)
+
+	// leave room for the headers and JSON (base64) encoding
+	chunkSize := (b.ncUp.MaxPayload() - 1024) * 3 / 4
+	end := req.Offset + chunkSize
+	if end > int64(len(b.snapshot)) {
+		end = int64(len(b.snapshot))
+	}
+
+	return client.DeviceBackupChunk{
+		ID:     b.id,
+		Size:   int64(len(b.snapshot)),
+		Offset: req.Offset,
+		Data:   b.snapshot[req.Offset:end],
+	}, nil
+}
+
+// clear frees the snapshot once it expires
+func (b *upstreamBackup) clear() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.id = ""
+	b.snapshot = nil
+}
+
+// stop frees the snapshot
+func (b *upstreamBackup) stop() {
+	b.lock.Lock()
+	if b.expire != nil {
+		b.expire.Stop()
+	}
+	b.lock.Unlock()
+
+	b.clear()
+}
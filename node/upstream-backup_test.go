@@ -0,0 +1,97 @@
+package node
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	natsserver "github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/client"
+)
+
+// failWriter fails after n bytes have been written
+type failWriter struct {
+	buf bytes.Buffer
+	n   int
+}
+
+func (w *failWriter) Write(p []byte) (int, error) {
+	if w.buf.Len() >= w.n {
+		return 0, errors.New("disk full")
+	}
+	return w.buf.Write(p)
+}
+
+func TestUpstreamBackup(t *testing.T) {
+	ns, err := natsserver.NewServer(&natsserver.Options{Port: -1, NoSigs: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go ns.Start()
+	t.Cleanup(ns.Shutdown)
+
+	if !ns.ReadyForConnections(5 * time.Second) {
+		t.Fatal("NATS server not ready")
+	}
+
+	nc, err := nats.Connect(ns.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(nc.Close)
+
+	// snapshot that takes several chunks
+	snapshot := bytes.Repeat([]byte("0123456789"), int(nc.MaxPayload()/5))
+
+	// fake store that replies to backup requests (see Store.handleBackup)
+	_, err = nc.Subscribe(client.SubjectStoreBackup(), func(msg *nats.Msg) {
+		nc.Publish(msg.Reply, nil)
+		buf := bytes.NewBuffer(snapshot)
+		for buf.Len() > 0 {
+			nc.Publish(msg.Reply, buf.Next(1000))
+		}
+		nc.Publish(msg.Reply, nil)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := newUpstreamBackup(nc, nc)
+	t.Cleanup(b.stop)
+
+	_, err = nc.Subscribe(client.SubjectDeviceBackup("dev"), b.handle)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// interrupted after the first chunk
+	var state client.DeviceBackupRequest
+	w := &failWriter{n: 1}
+	err = client.DeviceBackup(nc, "dev", &state, w)
+	if err == nil {
+		t.Fatal("Expected write error")
+	}
+
+	if state.ID == "" || state.Offset <= 0 || state.Offset >= int64(len(snapshot)) {
+		t.Fatalf("Wrong state after first chunk: %+v", state)
+	}
+
+	// resume
+	w.n = len(snapshot)
+	err = client.DeviceBackup(nc, "dev", &state, w)
+	if err != nil {
+		t.Fatal("Error resuming backup: ", err)
+	}
+
+	if !bytes.Equal(w.buf.Bytes(), snapshot) {
+		t.Fatal("Backup does not match snapshot")
+	}
+
+	state = client.DeviceBackupRequest{ID: "unknown", Offset: 10}
+	err = client.DeviceBackup(nc, "dev", &state, &bytes.Buffer{})
+	if !errors.Is(err, client.ErrSnapshotExpired) {
+		t.Fatal("Expected snapshot expired, got: ", err)
+	}
+}
@@ -0,0 +1,54 @@
+package node
+
+import (
+	"encoding/json"
+	"log"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/client"
+)
+
+// handleDiff responds to a tree diff request (see client.TreeDiff) with the
+// differences between the local subtree and the upstream copy. A blank node
+// ID compares the nodes that are synchronized.
+func (up *Upstream) handleDiff(msg *nats.Msg) {
+	var resp client.TreeDiffResponse
+
+	id := string(msg.Data)
+
+	var err error
+	if id != "" {
+		resp.Nodes, err = client.DiffTrees(up.nc, up.ncUp, id, "")
+	} else {
+		for _, n := range up.syncRoots {
+			parent := n.Parent
+			if !up.peer() {
+				parent = "none"
+			}
+
+			var diffs []client.NodeDiff
+			diffs, err = client.DiffTrees(up.nc, up.ncUp, n.ID, parent)
+			if err != nil {
+				break
+			}
+			resp.Nodes = append(resp.Nodes, diffs...)
+		}
+	}
+
+	if err != nil {
+		log.Printf("Upstream %v: error comparing trees: %v\n",
+			up.nodeUp.Description, err)
+		resp.Error = err.Error()
+	}
+
+	out, err := json.Marshal(resp)
+	if err != nil {
+		log.Println("Error encoding tree diff: ", err)
+		return
+	}
+
+	err = msg.Respond(out)
+	if err != nil {
+		log.Println("Error responding to tree diff request: ", err)
+	}
+}
@@ -2,13 +2,15 @@ package node
 
 import (
 	"log"
+	"reflect"
 
 	"github.com/nats-io/nats.go"
 	"github.com/simpleiot/simpleiot/client"
 	"github.com/simpleiot/simpleiot/data"
 )
 
-// UpstreamManager looks for upstream nodes and creates new upstream connections
+// UpstreamManager looks for upstream and peer nodes and creates new
+// connections
 type UpstreamManager struct {
 	nc         *nats.Conn
 	upstreams  map[string]*Upstream
@@ -32,6 +34,13 @@ func (upm *UpstreamManager) Update() error {
 		return err
 	}
 
+	peers, err := client.GetNodeChildren(upm.nc, upm.rootNodeID, data.NodeTypePeer, false, false)
+	if err != nil {
+		return err
+	}
+
+	nodes = append(nodes, peers...)
+
 	found := make(map[string]bool)
 
 	for _, node := range nodes {
@@ -52,7 +61,7 @@ func (upm *UpstreamManager) Update() error {
 				log.Println("Error with upstream node config: ", err)
 
 			} else {
-				if *upNode != *up.nodeUp {
+				if !reflect.DeepEqual(upNode, up.nodeUp) {
 					// restart upstream as something changed
 					log.Println("Restarting upstream: ", upNode.Description)
 					up.Stop()
@@ -13,6 +13,27 @@ type UpstreamNode struct {
 	URI         string
 	AuthToken   string
 	Disabled    bool
+	// ProvisionURL is the HTTP URL of the upstream. If set, NATS
+	// credentials are issued by the upstream after device attestation.
+	ProvisionURL string
+	// Proxy is the URL of a SOCKS5 or HTTP proxy the upstream connection
+	// (and attestation) goes through (see client.NewProxyDialer)
+	Proxy string
+	// WebSocket is set to connect with NATS over WebSocket (see
+	// client.EdgeOptions), WSPath is the optional WebSocket path
+	WebSocket bool
+	WSPath    string
+	// TLSCert and TLSKey are the client certificate files used when the
+	// upstream requires client certificates, and TLSCA is the CA bundle
+	// used to verify the upstream
+	TLSCert string
+	TLSKey  string
+	TLSCA   string
+	// Creds is the NATS credentials file issued by the upstream
+	Creds string
+	// SyncNodes is set for peer connections and contains the IDs of the
+	// subtrees that are mirrored. If empty, the entire tree is synchronized.
+	SyncNodes []string
 }
 
 // NewUpstreamNode converts a node to UpstreamNode
@@ -26,11 +47,30 @@ func NewUpstreamNode(node data.NodeEdge) (*UpstreamNode, error) {
 	ret.Description, _ = node.Points.Text(data.PointTypeDescription, "")
 	ret.AuthToken, _ = node.Points.Text(data.PointTypeAuthToken, "")
 	ret.Disabled, _ = node.Points.ValueBool(data.PointTypeDisable, "")
+	ret.ProvisionURL, _ = node.Points.Text(data.PointTypeProvisionURL, "")
+	ret.Proxy, _ = node.Points.Text(data.PointTypeProxy, "")
+	transport, _ := node.Points.Text(data.PointTypeTransport, "")
+	ret.WebSocket = transport == data.PointValueWebSocket
+	ret.WSPath, _ = node.Points.Text(data.PointTypeWSPath, "")
+	ret.TLSCert, _ = node.Points.Text(data.PointTypeTLSCert, "")
+	ret.TLSKey, _ = node.Points.Text(data.PointTypeTLSKey, "")
+	ret.TLSCA, _ = node.Points.Text(data.PointTypeTLSCA, "")
+	ret.Creds, _ = node.Points.Text(data.PointTypeCreds, "")
 
 	ret.URI, ok = node.Points.Text(data.PointTypeURI, "")
 	if !ok {
 		return nil, errors.New("URI must be specified for upstream connection")
 	}
 
+	for _, p := range node.Points {
+		if p.Type == data.PointTypeSyncNode && p.Text != "" && p.Tombstone == 0 {
+			ret.SyncNodes = append(ret.SyncNodes, p.Text)
+		}
+	}
+
+	if node.Type == data.NodeTypePeer && len(ret.SyncNodes) == 0 {
+		return nil, errors.New("at least one sync node must be specified for peer connection")
+	}
+
 	return ret, nil
 }
@@ -0,0 +1,86 @@
+package node_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+	"github.com/simpleiot/simpleiot/node"
+	"github.com/simpleiot/simpleiot/server"
+)
+
+func TestUpstreamSyncArchived(t *testing.T) {
+	nc, root, stop, err := server.TestServer()
+	if err != nil {
+		t.Fatal("Error starting test server: ", err)
+	}
+	defer stop()
+
+	ncUp, _, stopUp, err := server.TestServerMemory()
+	if err != nil {
+		t.Fatal("Error starting upstream test server: ", err)
+	}
+	defer stopUp()
+
+	children := []data.NodeEdge{
+		{ID: "ID-active", Type: data.NodeTypeVariable, Parent: root.ID},
+		{ID: "ID-archived", Type: data.NodeTypeVariable, Parent: root.ID},
+	}
+
+	for _, n := range children {
+		n.Points = data.Points{{Time: time.Now(), Type: data.PointTypeDescription,
+			Text: n.ID}}
+		err = client.SendNode(nc, n, "test")
+		if err != nil {
+			t.Fatal("Error sending node: ", err)
+		}
+	}
+
+	err = client.ArchiveNode(nc, "ID-archived", true, "test")
+	if err != nil {
+		t.Fatal("Error archiving node: ", err)
+	}
+
+	up, err := node.NewUpstream(nc, data.NodeEdge{
+		ID:   "ID-upstream",
+		Type: data.NodeTypeUpstream,
+		Points: data.Points{
+			{Type: data.PointTypeDescription, Text: "upstream"},
+			{Type: data.PointTypeURI, Text: "nats://localhost:4980"},
+		},
+	})
+	if err != nil {
+		t.Fatal("Error starting upstream: ", err)
+	}
+	defer up.Stop()
+
+	// the archived node is sent with the rest of the tree
+	var archived []data.NodeEdge
+	for start := time.Now(); time.Since(start) < 10*time.Second; {
+		archived, err = client.GetNode(ncUp, "ID-archived", root.ID)
+		if err == nil && len(archived) > 0 {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	if len(archived) != 1 || !archived[0].Archived() {
+		t.Fatalf("Archived node not synced upstream: %v, %v", archived, err)
+	}
+
+	local, err := client.GetNode(nc, root.ID, "none")
+	if err != nil || len(local) < 1 {
+		t.Fatal("Error getting local root: ", err)
+	}
+
+	upRoot, err := client.GetNode(ncUp, root.ID, "none")
+	if err != nil || len(upRoot) < 1 {
+		t.Fatal("Error getting upstream root: ", err)
+	}
+
+	if !bytes.Equal(local[0].Hash, upRoot[0].Hash) {
+		t.Error("Hash of upstream tree does not match")
+	}
+}
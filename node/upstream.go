@@ -14,7 +14,9 @@ import (
 	"github.com/simpleiot/simpleiot/data"
 )
 
-// Upstream is used to manage an upstream connection (cloud, etc)
+// Upstream is used to manage an upstream connection (cloud, etc). It is also
+// used for peer connections, where only selected subtrees are mirrored
+// between sibling instances.
 type Upstream struct {
 	nc                 *nats.Conn
 	node               data.NodeEdge
@@ -25,8 +27,20 @@ type Upstream struct {
 	subUpEdgePoints    map[string]*nats.Subscription
 	subLocalNodePoints *nats.Subscription
 	subLocalEdgePoints *nats.Subscription
+	subUpBackup        *nats.Subscription
+	backup             *upstreamBackup
+	subDiff            *nats.Subscription
+	subUpDiff          *nats.Subscription
+	syncRoots          []data.NodeEdge
 	lock               sync.Mutex
 	closeSync          chan bool
+	// sent is used in peer mode to track points that have been sent
+	// to the peer, so we don't bounce them back and forth
+	sent map[string]time.Time
+	// deviceID is set if the device is authenticated with attestation,
+	// credentials, or a client certificate, and can only use the subjects
+	// of its subtree on the upstream
+	deviceID string
 }
 
 // NewUpstream is used to create a new upstream connection
@@ -39,6 +53,7 @@ func NewUpstream(nc *nats.Conn, node data.NodeEdge) (*Upstream, error) {
 		subUpNodePoints: make(map[string]*nats.Subscription),
 		subUpEdgePoints: make(map[string]*nats.Subscription),
 		closeSync:       make(chan bool),
+		sent:            make(map[string]time.Time),
 	}
 
 	up.nodeUp, err = NewUpstreamNode(node)
@@ -51,9 +66,46 @@ func NewUpstream(nc *nats.Conn, node data.NodeEdge) (*Upstream, error) {
 		return up, nil
 	}
 
+	authToken := up.nodeUp.AuthToken
+
+	// devices authenticated with attestation, credentials, or client
+	// certificates are identified by the root node ID
+	deviceID := ""
+	if up.nodeUp.ProvisionURL != "" || up.nodeUp.Creds != "" ||
+		up.nodeUp.TLSCert != "" {
+		root, err := client.GetNode(nc, "root", "")
+		if err != nil {
+			return nil, fmt.Errorf("Error getting root node for device ID: %v", err)
+		}
+
+		if len(root) < 1 {
+			return nil, errors.New("Error getting root node for device ID, no data")
+		}
+
+		deviceID = root[0].ID
+	}
+
+	up.deviceID = deviceID
+
+	credsData := ""
+	if up.nodeUp.ProvisionURL != "" {
+		credsData, err = attest(up.nodeUp.ProvisionURL, up.nodeUp.Proxy, deviceID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	opts := client.EdgeOptions{
 		URI:       up.nodeUp.URI,
-		AuthToken: up.nodeUp.AuthToken,
+		AuthToken: authToken,
+		Proxy:     up.nodeUp.Proxy,
+		WebSocket: up.nodeUp.WebSocket,
+		WSPath:    up.nodeUp.WSPath,
+		TLSCert:   up.nodeUp.TLSCert,
+		TLSKey:    up.nodeUp.TLSKey,
+		TLSCA:     up.nodeUp.TLSCA,
+		Creds:     up.nodeUp.Creds,
+		CredsData: credsData,
 		NoEcho:    true,
 		Disconnected: func() {
 			log.Println("NATS Upstream Disconnected")
@@ -66,6 +118,11 @@ func NewUpstream(nc *nats.Conn, node data.NodeEdge) (*Upstream, error) {
 		},
 	}
 
+	if up.nodeUp.ProvisionURL != "" || up.nodeUp.Creds != "" ||
+		up.nodeUp.TLSCert != "" {
+		opts.InboxPrefix = client.DeviceInbox(deviceID)
+	}
+
 	up.ncUp, err = client.EdgeConnect(opts)
 
 	if err != nil {
@@ -80,6 +137,17 @@ func NewUpstream(nc *nats.Conn, node data.NodeEdge) (*Upstream, error) {
 			return
 		}
 
+		if up.peer() {
+			if !up.watched(nodeID) {
+				return
+			}
+
+			points = up.filterSent(nodeID, "", points)
+			if len(points) == 0 {
+				return
+			}
+		}
+
 		err = client.SendNodePoints(up.ncUp, nodeID, points, false)
 
 		if err != nil {
@@ -95,7 +163,18 @@ func NewUpstream(nc *nats.Conn, node data.NodeEdge) (*Upstream, error) {
 			return
 		}
 
-		err = client.SendEdgePoints(up.ncUp, nodeID, parentID, points, false)
+		if up.peer() {
+			if !up.watchedEdge(nodeID, parentID) {
+				return
+			}
+
+			points = up.filterSent(nodeID, parentID, points)
+			if len(points) == 0 {
+				return
+			}
+		}
+
+		err = up.sendEdgePointsUp(nodeID, parentID, points, false)
 
 		if err != nil {
 			log.Println("Error sending edge points to remote system: ", err)
@@ -130,6 +209,33 @@ func NewUpstream(nc *nats.Conn, node data.NodeEdge) (*Upstream, error) {
 
 	var rootNode = rootNodes[0]
 
+	if !up.peer() {
+		up.backup = newUpstreamBackup(nc, up.ncUp)
+		up.subUpBackup, err = up.ncUp.Subscribe(
+			client.SubjectDeviceBackup(rootNode.ID), up.backup.handle)
+		if err != nil {
+			return nil, fmt.Errorf("Error subscribing to backup requests: %v", err)
+		}
+	}
+
+	// syncRoots are the nodes we synchronize. For upstream connections,
+	// this is the root node, for peers, it is the configured subtrees.
+	var syncRoots []data.NodeEdge
+
+	if up.peer() {
+		for _, id := range up.nodeUp.SyncNodes {
+			nodes, err := client.GetNode(nc, id, "all")
+			if err != nil || len(nodes) < 1 {
+				log.Printf("Peer %v: sync node %v not found: %v\n",
+					up.nodeUp.Description, id, err)
+				continue
+			}
+			syncRoots = append(syncRoots, nodes[0])
+		}
+	} else {
+		syncRoots = []data.NodeEdge{rootNode}
+	}
+
 	var watchNode func(node data.NodeEdge) error
 
 	watchNode = func(node data.NodeEdge) error {
@@ -153,11 +259,28 @@ func NewUpstream(nc *nats.Conn, node data.NodeEdge) (*Upstream, error) {
 		return nil
 	}
 
-	err = watchNode(rootNode)
+	up.syncRoots = syncRoots
 
+	up.subDiff, err = nc.Subscribe(client.SubjectTreeDiff(up.node.ID), up.handleDiff)
 	if err != nil {
-		up.Stop()
-		return nil, fmt.Errorf("failed to watch nodes: %v", err)
+		return nil, fmt.Errorf("Error subscribing to tree diff: %v", err)
+	}
+
+	if !up.peer() {
+		up.subUpDiff, err = up.ncUp.Subscribe(client.SubjectTreeDiff(rootNode.ID),
+			up.handleDiff)
+		if err != nil {
+			return nil, fmt.Errorf("Error subscribing to upstream tree diff: %v", err)
+		}
+	}
+
+	for _, n := range syncRoots {
+		err = watchNode(n)
+
+		if err != nil {
+			up.Stop()
+			return nil, fmt.Errorf("failed to watch nodes: %v", err)
+		}
 	}
 
 	// occasionally sync nodes
@@ -167,9 +290,22 @@ func NewUpstream(nc *nats.Conn, node data.NodeEdge) (*Upstream, error) {
 		for {
 			select {
 			case <-timer.C:
-				err := up.syncNode(rootNode.ID, "none")
-				if err != nil {
-					fmt.Printf("Error syncing: %v\n", err)
+				for _, n := range syncRoots {
+					parent := n.Parent
+					if !up.peer() {
+						parent = "none"
+					}
+					err := up.syncNode(n.ID, parent)
+					if err != nil {
+						fmt.Printf("Error syncing: %v\n", err)
+					}
+				}
+				up.expireSent()
+				if !up.peer() {
+					err := up.updateRuleEvaluators(rootNode.ID)
+					if err != nil {
+						log.Println("Error updating rule evaluators: ", err)
+					}
 				}
 				timer.Reset(time.Second * 10)
 			case <-ch:
@@ -182,6 +318,135 @@ func NewUpstream(nc *nats.Conn, node data.NodeEdge) (*Upstream, error) {
 	return up, nil
 }
 
+// updateRuleEvaluators writes the evaluator to every rule that has a runOn
+// designation when it changes, so that exactly one of the edge and upstream
+// instances evaluates the rule. A heartbeat is sent to the upstream instance
+// every sync cycle, which lets it detect when the edge is not reachable. The
+// heartbeat is not stored, so the rules are not written every cycle.
+func (up *Upstream) updateRuleEvaluators(rootID string) error {
+	connected := up.ncUp.IsConnected()
+
+	if connected {
+		err := up.ncUp.Publish(client.SubjectInstanceHeartbeat(rootID), nil)
+		if err != nil {
+			log.Println("Error sending heartbeat to upstream: ", err)
+		}
+	}
+
+	nodes, err := client.GetNodeChildren(up.nc, rootID, "", false, true)
+	if err != nil {
+		return err
+	}
+
+	for _, n := range nodes {
+		if n.Type != data.NodeTypeRule {
+			continue
+		}
+
+		runOn, _ := n.Points.Text(data.PointTypeRunOn, "")
+
+		var evaluator string
+
+		switch runOn {
+		case data.PointValueEdge, data.PointValueEdgePreferred:
+			evaluator = data.PointValueEdge
+		case data.PointValueUpstream:
+			evaluator = data.PointValueUpstream
+		case data.PointValueUpstreamPreferred:
+			if connected {
+				evaluator = data.PointValueUpstream
+			} else {
+				evaluator = data.PointValueEdge
+			}
+		default:
+			continue
+		}
+
+		curEvaluator, _ := n.Points.Text(data.PointTypeEvaluator, "")
+		curEdge, _ := n.Points.Text(data.PointTypeEvaluatorEdge, "")
+
+		if curEvaluator == evaluator && curEdge == rootID {
+			continue
+		}
+
+		now := time.Now()
+
+		pts := data.Points{
+			{Time: now, Type: data.PointTypeEvaluator, Text: evaluator},
+			{Time: now, Type: data.PointTypeEvaluatorEdge, Text: rootID},
+		}
+
+		err := client.SendNodePoints(up.nc, n.ID, pts, false)
+		if err != nil {
+			log.Println("Error sending rule evaluator: ", err)
+		}
+	}
+
+	return nil
+}
+
+// peer returns true if this is a peer connection where only selected
+// subtrees are synchronized
+func (up *Upstream) peer() bool {
+	return len(up.nodeUp.SyncNodes) > 0
+}
+
+// watched returns true if node points for nodeID are synchronized
+func (up *Upstream) watched(nodeID string) bool {
+	up.lock.Lock()
+	defer up.lock.Unlock()
+	_, ok := up.subUpNodePoints[nodeID]
+	return ok
+}
+
+// watchedEdge returns true if the edge is synchronized, or if the parent
+// is synchronized, in which case this is a new node in a synchronized subtree
+func (up *Upstream) watchedEdge(nodeID, parentID string) bool {
+	up.lock.Lock()
+	defer up.lock.Unlock()
+	if _, ok := up.subUpEdgePoints[nodeID+":"+parentID]; ok {
+		return true
+	}
+	_, ok := up.subUpNodePoints[parentID]
+	return ok
+}
+
+// filterSent returns the points that have not already been sent to the peer
+// and records them as sent. If peer connections are configured on both
+// instances, a point received from the peer is forwarded back to it once
+// more, and is then dropped here.
+func (up *Upstream) filterSent(nodeID, parentID string, points data.Points) data.Points {
+	up.lock.Lock()
+	defer up.lock.Unlock()
+
+	var ret data.Points
+
+	now := time.Now()
+
+	for _, p := range points {
+		key := fmt.Sprintf("%v:%v:%v:%v:%v", nodeID, parentID, p.Type, p.Key,
+			p.Time.UnixNano())
+		if _, ok := up.sent[key]; ok {
+			continue
+		}
+		up.sent[key] = now
+		ret = append(ret, p)
+	}
+
+	return ret
+}
+
+func (up *Upstream) expireSent() {
+	up.lock.Lock()
+	defer up.lock.Unlock()
+
+	for k, t := range up.sent {
+		if time.Since(t) > time.Minute {
+			delete(up.sent, k)
+		}
+	}
+}
+
 func (up *Upstream) addUpstreamSub(node data.NodeEdge) error {
 	err := up.addUpstreamNodeSub(node.ID)
 	if err != nil {
@@ -279,10 +544,38 @@ func (up *Upstream) addUpstreamEdgeSub(nodeID, parentID string) error {
 	return nil
 }
 
+// sendEdgePointsUp sends edge points to the upstream. Devices that can only
+// use the subjects of their subtree send the edge points of nodes below the
+// device node with client.SendChildEdgePoints, so new nodes can be created.
+func (up *Upstream) sendEdgePointsUp(nodeID, parentID string, points data.Points, ack bool) error {
+	if up.deviceID != "" && nodeID != up.deviceID {
+		return client.SendChildEdgePoints(up.ncUp, nodeID, parentID, points, ack)
+	}
+
+	return client.SendEdgePoints(up.ncUp, nodeID, parentID, points, ack)
+}
+
 // sendNodesUp is used to send node and children over nats
 // from one NATS server to another. Typically from the current instance
 // to an upstream.
 func (up *Upstream) sendNodesUp(node data.NodeEdge) error {
+	if up.deviceID != "" && node.ID != up.deviceID && node.Parent != "" &&
+		node.Parent != "none" {
+		edgePoints := node.EdgePoints
+		if _, ok := edgePoints.Find(data.PointTypeTombstone, ""); !ok {
+			edgePoints = append(edgePoints, data.Point{Time: time.Now(),
+				Type: data.PointTypeTombstone, Origin: up.node.ID})
+		}
+
+		err := up.sendEdgePointsUp(node.ID, node.Parent, edgePoints, true)
+		if err != nil {
+			return fmt.Errorf("Error sending edge points: %w", err)
+		}
+
+		// the edge was created above
+		node.Parent = "none"
+	}
+
 	err := client.SendNode(up.ncUp, node, up.node.ID)
 
 	if err != nil {
@@ -512,6 +805,24 @@ func (up *Upstream) Stop() {
 		}
 	}
 
+	if up.subUpBackup != nil {
+		err := up.subUpBackup.Unsubscribe()
+		if err != nil {
+			log.Println("Error unsubscribing backup from upstream bus: ", err)
+		}
+		up.backup.stop()
+	}
+
+	for _, sub := range []*nats.Subscription{up.subDiff, up.subUpDiff} {
+		if sub == nil {
+			continue
+		}
+		err := sub.Unsubscribe()
+		if err != nil {
+			log.Println("Error unsubscribing tree diff: ", err)
+		}
+	}
+
 	up.lock.Lock()
 	for _, sub := range up.subUpNodePoints {
 		err := sub.Unsubscribe()
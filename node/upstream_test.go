@@ -0,0 +1,58 @@
+package node
+
+import (
+	"testing"
+	"time"
+
+	"github.com/simpleiot/simpleiot/data"
+)
+
+func TestPeerFilterSent(t *testing.T) {
+	node := data.NodeEdge{
+		ID:   "peer1",
+		Type: data.NodeTypePeer,
+		Points: data.Points{
+			{Type: data.PointTypeURI, Text: "nats://localhost:4222"},
+			{Type: data.PointTypeSyncNode, Key: "0", Text: "abc"},
+		},
+	}
+
+	nodeUp, err := NewUpstreamNode(node)
+	if err != nil {
+		t.Fatal("Error creating peer node: ", err)
+	}
+
+	up := &Upstream{nodeUp: nodeUp, sent: make(map[string]time.Time)}
+
+	if !up.peer() {
+		t.Fatal("expected peer mode")
+	}
+
+	now := time.Now()
+	pts := data.Points{
+		{Time: now, Type: data.PointTypeValue, Value: 1},
+		{Time: now, Type: data.PointTypeDescription, Text: "hi"},
+	}
+
+	if len(up.filterSent("abc", "", pts)) != 2 {
+		t.Fatal("first send should not filter points")
+	}
+
+	// the same points coming back from the peer must be dropped
+	if len(up.filterSent("abc", "", pts)) != 0 {
+		t.Fatal("points already sent should be filtered")
+	}
+
+	// newer point must go through
+	pts[0].Time = now.Add(time.Second)
+	if len(up.filterSent("abc", "", pts)) != 1 {
+		t.Fatal("new point should not be filtered")
+	}
+
+	// a peer without sync nodes is not valid
+	node.Points = node.Points[:1]
+	_, err = NewUpstreamNode(node)
+	if err == nil {
+		t.Fatal("expected error for peer without sync nodes")
+	}
+}
@@ -0,0 +1,50 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/client"
+)
+
+const coldChainUsage = "usage: siot coldchain <node ID> <file> (use - for stdout)"
+
+// runColdChainCommand writes the events of a cold chain node as a CSV audit
+// record:
+//
+//	siot coldchain <node ID> <file>
+func runColdChainCommand(nc *nats.Conn, args []string) error {
+	if len(args) != 2 {
+		return errors.New(coldChainUsage)
+	}
+
+	events, err := client.GetColdChainEvents(nc, args[0])
+	if err != nil {
+		return fmt.Errorf("Error getting cold chain events: %w", err)
+	}
+
+	var w io.Writer = os.Stdout
+	if args[1] != "-" {
+		f, err := os.Create(args[1])
+		if err != nil {
+			return fmt.Errorf("Error creating audit file: %w", err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	err = client.WriteColdChainCSV(w, events)
+	if err != nil {
+		return fmt.Errorf("Error writing audit file: %w", err)
+	}
+
+	if args[1] != "-" {
+		log.Printf("Wrote %v cold chain events to: %v\n", len(events), args[1])
+	}
+
+	return nil
+}
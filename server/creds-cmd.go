@@ -0,0 +1,54 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/client"
+)
+
+const credsUsage = "usage: siot creds <device ID> <file> (use - for stdout)\n" +
+	"       siot creds -revoke <device ID>"
+
+// runCredsCommand issues NATS credentials for a device and writes the creds
+// file, or revokes the credentials issued to a device:
+//
+//	siot creds <device ID> <file>
+//	siot creds -revoke <device ID>
+func runCredsCommand(nc *nats.Conn, args []string) error {
+	if len(args) == 2 && args[0] == "-revoke" {
+		err := client.RevokeDeviceCreds(nc, args[1])
+		if err != nil {
+			return fmt.Errorf("Error revoking device creds: %w", err)
+		}
+
+		log.Println("Revoked NATS credentials for device: ", args[1])
+		return nil
+	}
+
+	if len(args) != 2 {
+		return errors.New(credsUsage)
+	}
+
+	creds, err := client.IssueDeviceCreds(nc, args[0])
+	if err != nil {
+		return fmt.Errorf("Error issuing device creds: %w", err)
+	}
+
+	if args[1] == "-" {
+		fmt.Print(creds)
+		return nil
+	}
+
+	err = os.WriteFile(args[1], []byte(creds), 0600)
+	if err != nil {
+		return fmt.Errorf("Error writing creds file: %w", err)
+	}
+
+	log.Printf("Wrote NATS credentials for device %v to: %v\n", args[0], args[1])
+
+	return nil
+}
@@ -0,0 +1,87 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/api"
+	"github.com/simpleiot/simpleiot/client"
+)
+
+// handleDiag runs a read-only diagnostic command (see client.Diag). The
+// request must carry a valid user token, unless auth is disabled.
+func (s *Server) handleDiag(msg *nats.Msg, auth api.Authorizer) {
+	var resp client.DiagResponse
+
+	result, err := s.diag(msg.Data, auth)
+	if err != nil {
+		resp.Error = err.Error()
+	} else {
+		resp.Result, err = json.Marshal(result)
+		if err != nil {
+			resp.Error = fmt.Sprintf("Error encoding result: %v", err)
+		}
+	}
+
+	out, err := json.Marshal(resp)
+	if err != nil {
+		log.Println("Error encoding diagnostic response: ", err)
+		return
+	}
+
+	err = msg.Respond(out)
+	if err != nil {
+		log.Println("Error responding to diagnostic request: ", err)
+	}
+}
+
+func (s *Server) diag(reqData []byte, auth api.Authorizer) (any, error) {
+	var req client.DiagRequest
+	err := json.Unmarshal(reqData, &req)
+	if err != nil {
+		return nil, fmt.Errorf("Error decoding request: %v", err)
+	}
+
+	if auth == nil {
+		return nil, errors.New("auth is not set up")
+	}
+
+	if valid, _ := auth.ValidToken(req.Token); !valid {
+		return nil, errors.New("invalid token")
+	}
+
+	switch req.Command {
+	case client.DiagNode:
+		if req.ID == "" {
+			return nil, errors.New("node ID must be set")
+		}
+		nodes, err := client.GetNode(s.nc, req.ID, "all")
+		if err != nil {
+			return nil, err
+		}
+
+		// diagnostics are read by support, so credentials are masked
+		// like in the HTTP API
+		for i := range nodes {
+			nodes[i].Points = nodes[i].Points.Mask()
+			nodes[i].EdgePoints = nodes[i].EdgePoints.Mask()
+		}
+
+		return nodes, nil
+
+	case client.DiagSubscriptions:
+		if s.natsServer == nil {
+			return nil, errors.New("NATS server is not embedded")
+		}
+		return s.natsServer.Subsz(&server.SubszOptions{Subscriptions: true})
+
+	case client.DiagManagers:
+		return s.clients.ManagerStates()
+	}
+
+	return nil, fmt.Errorf("unknown command: %v", req.Command)
+}
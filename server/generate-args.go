@@ -0,0 +1,43 @@
+package server
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/simpleiot/simpleiot/generate"
+)
+
+// generateArgs runs the generate command:
+//
+//	siot generate client -type myDevice [-dir .] [-import path]
+func generateArgs(args []string) error {
+	if len(args) < 3 || args[2] != "client" {
+		return errors.New("usage: siot generate client -type <nodeType> [-dir <dir>] [-import <path>]")
+	}
+
+	flags := flag.NewFlagSet("generate client", flag.ExitOnError)
+	flagType := flags.String("type", "", "node type of the client, ex: myDevice")
+	flagDir := flags.String("dir", ".", "directory the client package is created in")
+	flagImport := flags.String("import", "", "import path of the client package, found from go.mod if not set")
+	if err := flags.Parse(args[3:]); err != nil {
+		return err
+	}
+
+	if *flagType == "" {
+		return errors.New("-type must be set")
+	}
+
+	ca := generate.ClientArgs{NodeType: *flagType, Dir: *flagDir, Import: *flagImport}
+	dir, importPath, err := generate.Client(ca)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Generated %v client in %v\n\n", *flagType, dir)
+	fmt.Println("Register the client with the server:")
+	fmt.Println()
+	fmt.Print(generate.ClientRegistration(*flagType, importPath))
+
+	return nil
+}
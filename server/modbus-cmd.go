@@ -0,0 +1,49 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/node"
+)
+
+const modbusUsage = "usage: siot modbus import <modbus node ID> <register map .csv or .json>"
+
+// runModbusCommand runs Modbus commands:
+//
+//	siot modbus import <modbus node ID> <register map file>
+func runModbusCommand(nc *nats.Conn, args []string) error {
+	if len(args) != 3 || args[0] != "import" {
+		return errors.New(modbusUsage)
+	}
+
+	modbusID, file := args[1], args[2]
+
+	f, err := os.Open(file)
+	if err != nil {
+		return fmt.Errorf("Error opening register map: %w", err)
+	}
+	defer f.Close()
+
+	format := strings.TrimPrefix(filepath.Ext(file), ".")
+
+	regs, err := node.ParseModbusRegisters(f, format)
+	if err != nil {
+		return err
+	}
+
+	created, updated, err := node.ImportModbusRegisters(nc, modbusID, regs)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Imported %v registers into Modbus node %v, created: %v, updated: %v\n",
+		len(regs), modbusID, created, updated)
+
+	return nil
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// mqttPoint decodes the payload of an MQTT message into a point. The payload
+// can be a number, true/false, a JSON encoded point, or text. The point
+// type and key come from the MQTT topic, and the time is now if not set.
+func mqttPoint(typ, key string, payload []byte) (data.Point, error) {
+	p := data.Point{Type: typ, Key: key}
+
+	payload = bytes.TrimSpace(payload)
+	s := string(payload)
+
+	switch {
+	case len(payload) <= 0:
+		return p, errors.New("empty payload")
+	case payload[0] == '{':
+		err := json.Unmarshal(payload, &p)
+		if err != nil {
+			return p, fmt.Errorf("Error decoding JSON point: %w", err)
+		}
+		p.Type, p.Key = typ, key
+	case s == "true":
+		p.Value = 1
+	case s == "false":
+		p.Value = 0
+	default:
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			p.Text = s
+		} else {
+			p.Value = v
+		}
+	}
+
+	if p.Time.IsZero() {
+		p.Time = time.Now()
+	}
+
+	return p, nil
+}
+
+// handleMQTTPoints writes points published by MQTT clients to the node in
+// the topic (see client.SubjectMQTTPoints)
+func (s *Server) handleMQTTPoints(msg *nats.Msg) {
+	chunks := strings.Split(msg.Subject, ".")
+	if len(chunks) < 3 || len(chunks) > 4 {
+		log.Println("MQTT topic must be siot/<node ID>/<point type>[/<key>]: ",
+			strings.ReplaceAll(msg.Subject, ".", "/"))
+		return
+	}
+
+	key := ""
+	if len(chunks) == 4 {
+		key = chunks[3]
+	}
+
+	p, err := mqttPoint(chunks[2], key, msg.Data)
+	if err != nil {
+		log.Printf("Error decoding MQTT point for node %v: %v\n", chunks[1], err)
+		return
+	}
+
+	err = client.SendNodePoints(s.nc, chunks[1], data.Points{p}, false)
+	if err != nil {
+		log.Printf("Error sending MQTT point for node %v: %v\n", chunks[1], err)
+	}
+}
@@ -0,0 +1,148 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/client"
+)
+
+func TestMQTTPoint(t *testing.T) {
+	tests := []struct {
+		payload string
+		value   float64
+		text    string
+	}{
+		{"21.5", 21.5, ""},
+		{" 3\n", 3, ""},
+		{"true", 1, ""},
+		{"false", 0, ""},
+		{"open", 0, "open"},
+		{`{"value": 2, "text": "hi", "type": "ignored"}`, 2, "hi"},
+	}
+
+	for _, test := range tests {
+		p, err := mqttPoint("temp", "a", []byte(test.payload))
+		if err != nil {
+			t.Fatalf("Error decoding %q: %v", test.payload, err)
+		}
+
+		if p.Type != "temp" || p.Key != "a" || p.Value != test.value ||
+			p.Text != test.text || p.Time.IsZero() {
+			t.Errorf("Wrong point for %q: %v", test.payload, p)
+		}
+	}
+
+	_, err := mqttPoint("temp", "", []byte(" "))
+	if err == nil {
+		t.Error("Expected error for empty payload")
+	}
+}
+
+// mqttString encodes a length prefixed MQTT string
+func mqttString(s string) []byte {
+	return append([]byte{byte(len(s) >> 8), byte(len(s))}, s...)
+}
+
+// mqttPublish connects to an MQTT server and publishes a QoS 0 message
+func mqttPublish(addr, password, topic, payload string) error {
+	conn, err := net.DialTimeout("tcp", addr, 5*time.Second)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	// CONNECT, MQTT 3.1.1, clean session, user name and password
+	connect := append(mqttString("MQTT"), 4, 0xc2, 0, 60)
+	connect = append(connect, mqttString("test")...)
+	connect = append(connect, mqttString("device")...)
+	connect = append(connect, mqttString(password)...)
+	_, err = conn.Write(append([]byte{0x10, byte(len(connect))}, connect...))
+	if err != nil {
+		return err
+	}
+
+	connack := make([]byte, 4)
+	_, err = io.ReadFull(conn, connack)
+	if err != nil {
+		return err
+	}
+
+	if connack[0] != 0x20 || connack[3] != 0 {
+		return fmt.Errorf("connection refused: %v", connack)
+	}
+
+	publish := append(mqttString(topic), payload...)
+	_, err = conn.Write(append([]byte{0x30, byte(len(publish))}, publish...))
+	if err != nil {
+		return err
+	}
+
+	// PINGREQ, so the publish is processed once PINGRESP is received
+	_, err = conn.Write([]byte{0xc0, 0})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.ReadFull(conn, make([]byte, 2))
+	return err
+}
+
+func TestNatsMQTT(t *testing.T) {
+	mqttPort, err := freePort()
+	if err != nil {
+		t.Fatal("Error getting free port: ", err)
+	}
+
+	ns, err := newNatsServer(natsServerOptions{Host: "127.0.0.1", Port: -1,
+		HTTPPort: -1, MQTTPort: mqttPort, Auth: "secret", JetStream: true,
+		StoreDir: t.TempDir()})
+	if err != nil {
+		t.Fatal("Error creating server: ", err)
+	}
+	go ns.Start()
+	defer ns.Shutdown()
+
+	if !ns.ReadyForConnections(5 * time.Second) {
+		t.Fatal("Server not ready")
+	}
+
+	nc, err := nats.Connect(ns.ClientURL(), nats.Token("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+
+	sub, err := nc.SubscribeSync(client.SubjectMQTTPoints("*") + ".>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	nc.Flush()
+
+	addr := fmt.Sprintf("127.0.0.1:%v", mqttPort)
+
+	err = mqttPublish(addr, "wrong", "siot/dev1/temp", "21.5")
+	if err == nil {
+		t.Fatal("MQTT client connected with wrong password")
+	}
+
+	err = mqttPublish(addr, "secret", "siot/dev1/temp", "21.5")
+	if err != nil {
+		t.Fatal("Error publishing MQTT message: ", err)
+	}
+
+	msg, err := sub.NextMsg(5 * time.Second)
+	if err != nil {
+		t.Fatal("MQTT message not received: ", err)
+	}
+
+	if msg.Subject != "siot.dev1.temp" || !bytes.Equal(msg.Data, []byte("21.5")) {
+		t.Fatalf("Wrong message: %v %s", msg.Subject, msg.Data)
+	}
+}
@@ -0,0 +1,331 @@
+package server
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nkeys"
+	"github.com/simpleiot/simpleiot/client"
+)
+
+// how many connections of a device are tracked to update permissions when
+// nodes are added to the device subtree. A device usually has one
+// connection per upstream, older connections are closed after reconnects.
+const maxDeviceConns = 4
+
+// natsAuth authenticates NATS clients when client certificates are
+// required (see natsServerOptions.TLSCA) or device credentials are issued
+// (see issueDeviceCreds). Clients that send the auth token have full access.
+// Devices authenticate with a certificate verified against the CA bundle
+// during the TLS handshake, or with an nkey and a user JWT signed by the
+// issuer key. The
+// certificate common name or JWT name is the ID of the device node, and
+// the device can only publish and subscribe to the subjects of the nodes in
+// its subtree. The connection user is set to the device ID, so it shows up
+// in the NATS monitoring endpoints. If no auth token is set, all clients
+// have full access. Credentials issued at or before the time returned by
+// revoked are rejected (see revoke), and connections lose their permissions
+// when their credentials expire.
+type natsAuth struct {
+	token  string
+	issuer string
+	// subtree returns the IDs of the nodes in the device subtree
+	subtree func(deviceID string) []string
+	// revoked returns the time the credentials of a device were revoked,
+	// or zero
+	revoked func(deviceID string) time.Time
+
+	lock    sync.Mutex
+	devices map[string]*authDevice
+}
+
+type authDevice struct {
+	nodes map[string]bool
+	conns []authConn
+}
+
+// authConn is a device connection. issued is the unix time the credentials
+// of the connection were issued, 0 for client certificates.
+type authConn struct {
+	c      server.ClientAuthentication
+	issued int64
+}
+
+func newNatsAuth(token, issuer string, subtree func(deviceID string) []string,
+	revoked func(deviceID string) time.Time) *natsAuth {
+	return &natsAuth{
+		token:   token,
+		issuer:  issuer,
+		subtree: subtree,
+		revoked: revoked,
+		devices: make(map[string]*authDevice),
+	}
+}
+
+// Check implements server.Authentication
+func (a *natsAuth) Check(c server.ClientAuthentication) bool {
+	opts := c.GetOpts()
+	if a.token == "" || opts.Token == a.token {
+		return true
+	}
+
+	deviceID := certDeviceID(c.GetTLSConnectionState())
+
+	var claims *jwt.UserClaims
+
+	if deviceID == "" && opts.Nkey != "" {
+		var err error
+		claims, err = a.credsClaims(opts.Token, opts.Nkey, opts.Sig, c.GetNonce())
+		if err != nil {
+			log.Printf("NATS auth failed for %v: %v\n", c.RemoteAddress(), err)
+			return false
+		}
+
+		deviceID = claims.Name
+
+		if a.revoked != nil {
+			if t := a.revoked(deviceID); !t.IsZero() && claims.IssuedAt <= t.Unix() {
+				log.Printf("NATS auth failed for %v: credentials of %v were revoked\n",
+					c.RemoteAddress(), deviceID)
+				return false
+			}
+		}
+	}
+
+	if deviceID == "" {
+		return false
+	}
+
+	conn := authConn{c: c}
+	if claims != nil {
+		conn.issued = claims.IssuedAt
+
+		if claims.Expires > 0 {
+			// the NATS server does not disconnect clients when
+			// credentials expire, so permissions are removed
+			time.AfterFunc(time.Until(time.Unix(claims.Expires, 0)), func() {
+				log.Printf("NATS credentials of %v expired\n", deviceID)
+				a.removeConn(deviceID, c)
+			})
+		}
+	}
+
+	a.addDevice(deviceID, conn)
+
+	return true
+}
+
+// credsClaims checks the user JWT was issued by us for the nkey, is not
+// expired, and the nonce was signed with the nkey, and returns the JWT
+// claims. The name is the device ID. The NATS server discards JWTs when it
+// is not in operator mode, so devices send the JWT as the token (see
+// client.DeviceCreds).
+func (a *natsAuth) credsClaims(token, nkey, sig string, nonce []byte) (*jwt.UserClaims, error) {
+	if a.issuer == "" {
+		return nil, errors.New("device credentials are not enabled")
+	}
+
+	claims, err := jwt.DecodeUserClaims(token)
+	if err != nil {
+		return nil, fmt.Errorf("Error decoding JWT: %w", err)
+	}
+
+	if claims.Issuer != a.issuer {
+		return nil, errors.New("JWT has unknown issuer")
+	}
+
+	if claims.Subject != nkey {
+		return nil, errors.New("JWT was not issued for the nkey")
+	}
+
+	vr := jwt.CreateValidationResults()
+	claims.Validate(vr)
+	if vr.IsBlocking(true) {
+		return nil, errors.New("JWT is not valid or expired")
+	}
+
+	sigBytes, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil {
+		// allow fallback to normal base64
+		sigBytes, err = base64.StdEncoding.DecodeString(sig)
+		if err != nil {
+			return nil, errors.New("signature not valid base64")
+		}
+	}
+
+	pub, err := nkeys.FromPublicKey(nkey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid nkey: %w", err)
+	}
+
+	if err := pub.Verify(nonce, sigBytes); err != nil {
+		return nil, errors.New("signature does not match nkey")
+	}
+
+	if claims.Name == "" {
+		return nil, errors.New("JWT does not have a device ID")
+	}
+
+	return claims, nil
+}
+
+// noPermissions is set on connections whose credentials expired or were
+// revoked, as the NATS server has no way to close them from here
+var noPermissions = &server.Permissions{
+	Publish:   &server.SubjectPermission{Deny: []string{">"}},
+	Subscribe: &server.SubjectPermission{Deny: []string{">"}},
+}
+
+// addDevice sets the connection user and permissions for a device
+func (a *natsAuth) addDevice(deviceID string, conn authConn) {
+	nodes := []string{deviceID}
+	if a.subtree != nil {
+		nodes = a.subtree(deviceID)
+	}
+
+	conn.c.RegisterUser(&server.User{
+		Username:    deviceID,
+		Permissions: devicePermissions(deviceID, nodes),
+	})
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	d := &authDevice{nodes: make(map[string]bool)}
+	for _, id := range nodes {
+		d.nodes[id] = true
+	}
+
+	if prev, ok := a.devices[deviceID]; ok {
+		d.conns = prev.conns
+	}
+
+	d.conns = append(d.conns, conn)
+	if len(d.conns) > maxDeviceConns {
+		d.conns = d.conns[len(d.conns)-maxDeviceConns:]
+	}
+
+	a.devices[deviceID] = d
+}
+
+// removeConn removes the permissions of a device connection
+func (a *natsAuth) removeConn(deviceID string, c server.ClientAuthentication) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	c.RegisterUser(&server.User{Username: deviceID, Permissions: noPermissions})
+
+	d, ok := a.devices[deviceID]
+	if !ok {
+		return
+	}
+
+	conns := d.conns[:0]
+	for _, conn := range d.conns {
+		if conn.c != c {
+			conns = append(conns, conn)
+		}
+	}
+	d.conns = conns
+}
+
+// revoke removes the permissions of connections of a device with
+// credentials issued at or before t. New connections with these credentials
+// are rejected by Check once revoked returns t.
+func (a *natsAuth) revoke(deviceID string, t time.Time) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	d, ok := a.devices[deviceID]
+	if !ok {
+		return
+	}
+
+	conns := d.conns[:0]
+	for _, conn := range d.conns {
+		if conn.issued > 0 && conn.issued <= t.Unix() {
+			conn.c.RegisterUser(&server.User{Username: deviceID,
+				Permissions: noPermissions})
+			continue
+		}
+		conns = append(conns, conn)
+	}
+	d.conns = conns
+}
+
+// nodeAdded is called when the store has written an edge that adds a node
+// to a parent (see Server.handleDeviceEdge), and updates the permissions of
+// connected devices with the parent in their subtree.
+func (a *natsAuth) nodeAdded(nodeID, parentID string) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	for deviceID, d := range a.devices {
+		if !d.nodes[parentID] || d.nodes[nodeID] {
+			continue
+		}
+
+		d.nodes[nodeID] = true
+		nodes := make([]string, 0, len(d.nodes))
+		for id := range d.nodes {
+			nodes = append(nodes, id)
+		}
+
+		for _, conn := range d.conns {
+			conn.c.RegisterUser(&server.User{
+				Username:    deviceID,
+				Permissions: devicePermissions(deviceID, nodes),
+			})
+		}
+	}
+}
+
+// devicePermissions returns the NATS permissions of a device, which can
+// only use the subjects of nodes in its subtree, publish MQTT points to its
+// nodes, receive request replies on the device inbox (see
+// client.DeviceInbox), and reply to requests it receives. Devices can't
+// publish edge points for nodes outside their subtree, so they create child
+// nodes with client.SendChildEdgePoints, which the server checks (see
+// Server.handleChildEdgePoints).
+func devicePermissions(deviceID string, nodes []string) *server.Permissions {
+	inbox := client.DeviceInbox(deviceID) + ".>"
+	pub := []string{}
+	sub := []string{inbox}
+
+	for _, id := range nodes {
+		pub = append(pub,
+			"node."+id,
+			"node."+id+".>",
+			client.SubjectNodeHRPoints(id),
+			client.SubjectHistory(id),
+			client.SubjectMQTTPoints(id)+".>")
+		sub = append(sub,
+			"node."+id+".>")
+	}
+
+	return &server.Permissions{
+		Publish:   &server.SubjectPermission{Allow: pub},
+		Subscribe: &server.SubjectPermission{Allow: sub},
+		// reply to requests from upstream, see client.DeviceBackup
+		Response: &server.ResponsePermission{
+			MaxMsgs: server.DEFAULT_ALLOW_RESPONSE_MAX_MSGS,
+			Expires: server.DEFAULT_ALLOW_RESPONSE_EXPIRATION,
+		},
+	}
+}
+
+// certDeviceID returns the common name of a verified client certificate
+func certDeviceID(cs *tls.ConnectionState) string {
+	if cs == nil || len(cs.VerifiedChains) <= 0 || len(cs.VerifiedChains[0]) <= 0 {
+		return ""
+	}
+
+	return cs.VerifiedChains[0][0].Subject.CommonName
+}
@@ -0,0 +1,413 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nkeys"
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+	"github.com/simpleiot/simpleiot/store"
+)
+
+// writeCert creates a certificate signed by parent (self-signed if parent is
+// nil) and writes the cert and key PEM files to dir
+func writeCert(t *testing.T, dir, name, cn string, parent *x509.Certificate,
+	parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal("Error generating key: ", err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth,
+			x509.ExtKeyUsageClientAuth},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+	}
+
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+		parent = tmpl
+		parentKey = key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal("Error creating cert: ", err)
+	}
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal("Error marshalling key: ", err)
+	}
+
+	err = os.WriteFile(filepath.Join(dir, name+".crt"),
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.WriteFile(filepath.Join(dir, name+".key"),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return cert, key
+}
+
+func TestNatsClientCert(t *testing.T) {
+	dir := t.TempDir()
+	ca, caKey := writeCert(t, dir, "ca", "siot-ca", nil, nil)
+	writeCert(t, dir, "server", "siot-server", ca, caKey)
+	writeCert(t, dir, "device", "device-123", ca, caKey)
+	writeCert(t, dir, "rogue", "rogue", nil, nil)
+
+	port, err := freePort()
+	if err != nil {
+		t.Fatal("Error getting free port: ", err)
+	}
+
+	ns, err := newNatsServer(natsServerOptions{
+		Host:       "127.0.0.1",
+		Port:       port,
+		Auth:       "secret",
+		TLSCert:    filepath.Join(dir, "server.crt"),
+		TLSKey:     filepath.Join(dir, "server.key"),
+		TLSCA:      filepath.Join(dir, "ca.crt"),
+		TLSTimeout: 2,
+		DeviceAuth: newNatsAuth("secret", "", nil, nil),
+	})
+	if err != nil {
+		t.Fatal("Error creating NATS server: ", err)
+	}
+
+	go ns.Start()
+	defer ns.Shutdown()
+
+	if !ns.ReadyForConnections(5 * time.Second) {
+		t.Fatal("NATS server not ready")
+	}
+
+	url := ns.ClientURL()
+	caFile := filepath.Join(dir, "ca.crt")
+
+	nc, err := nats.Connect(url, nats.RootCAs(caFile),
+		nats.ClientCert(filepath.Join(dir, "device.crt"), filepath.Join(dir, "device.key")))
+	if err != nil {
+		t.Fatal("Device with cert failed to connect: ", err)
+	}
+	nc.Close()
+
+	nc, err = nats.Connect(url, nats.RootCAs(caFile),
+		nats.ClientCert(filepath.Join(dir, "rogue.crt"), filepath.Join(dir, "rogue.key")))
+	if err == nil {
+		nc.Close()
+		t.Fatal("Device with cert from unknown CA connected")
+	}
+
+	nc, err = nats.Connect(url, nats.RootCAs(caFile), nats.Token("secret"))
+	if err == nil {
+		nc.Close()
+		t.Fatal("Client without cert connected")
+	}
+}
+
+func TestNatsDeviceCreds(t *testing.T) {
+	dir := t.TempDir()
+
+	issuer, err := loadIssuerKey(filepath.Join(dir, "issuer.nk"))
+	if err != nil {
+		t.Fatal("Error loading issuer key: ", err)
+	}
+
+	// key is saved and loaded again
+	issuer2, err := loadIssuerKey(filepath.Join(dir, "issuer.nk"))
+	if err != nil {
+		t.Fatal("Error loading issuer key again: ", err)
+	}
+
+	issuerPub, _ := issuer.PublicKey()
+	issuerPub2, _ := issuer2.PublicKey()
+	if issuerPub != issuerPub2 {
+		t.Fatal("Issuer key changed after loading again")
+	}
+
+	var revokedLock sync.Mutex
+	revoked := make(map[string]time.Time)
+
+	auth := newNatsAuth("secret", issuerPub, func(deviceID string) []string {
+		return []string{deviceID, "child"}
+	}, func(deviceID string) time.Time {
+		revokedLock.Lock()
+		defer revokedLock.Unlock()
+		return revoked[deviceID]
+	})
+
+	port, err := freePort()
+	if err != nil {
+		t.Fatal("Error getting free port: ", err)
+	}
+
+	ns, err := newNatsServer(natsServerOptions{
+		Host:       "127.0.0.1",
+		Port:       port,
+		Auth:       "secret",
+		DeviceAuth: auth,
+	})
+	if err != nil {
+		t.Fatal("Error creating NATS server: ", err)
+	}
+
+	go ns.Start()
+	defer ns.Shutdown()
+
+	if !ns.ReadyForConnections(5 * time.Second) {
+		t.Fatal("NATS server not ready")
+	}
+
+	url := ns.ClientURL()
+
+	admin, err := nats.Connect(url, nats.Token("secret"))
+	if err != nil {
+		t.Fatal("Admin failed to connect: ", err)
+	}
+	defer admin.Close()
+
+	received := make(chan string, 10)
+	_, err = admin.Subscribe("node.>", func(msg *nats.Msg) {
+		received <- msg.Subject
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	admin.Flush()
+
+	writeCreds := func(name string, kp nkeys.KeyPair, deviceID string) string {
+		creds, err := issueDeviceCreds(kp, deviceID, time.Hour)
+		if err != nil {
+			t.Fatal("Error issuing creds: ", err)
+		}
+
+		file := filepath.Join(dir, name)
+		err = os.WriteFile(file, []byte(creds), 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return file
+	}
+
+	violations := make(chan error, 10)
+	device, err := nats.Connect(url,
+		client.DeviceCreds(writeCreds("device.creds", issuer, "dev1")),
+		nats.CustomInboxPrefix(client.DeviceInbox("dev1")),
+		nats.ErrorHandler(func(_ *nats.Conn, _ *nats.Subscription, err error) {
+			violations <- err
+		}))
+	if err != nil {
+		t.Fatal("Device with creds failed to connect: ", err)
+	}
+	defer device.Close()
+
+	expectConn := func(device *nats.Conn, subject string, allowed bool) {
+		t.Helper()
+		err := device.Publish(subject, []byte("hi"))
+		if err != nil {
+			t.Fatal("Error publishing: ", err)
+		}
+		device.Flush()
+
+		select {
+		case s := <-received:
+			if !allowed {
+				t.Fatal("Device published to: ", s)
+			}
+			if s != subject {
+				t.Fatalf("Expected %v, got %v", subject, s)
+			}
+		case <-violations:
+			if allowed {
+				t.Fatal("Device not allowed to publish to: ", subject)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Timeout publishing to: ", subject)
+		}
+	}
+
+	expect := func(subject string, allowed bool) {
+		t.Helper()
+		expectConn(device, subject, allowed)
+	}
+
+	expect("node.dev1.points", true)
+	expect("node.child.dev1.points", true)
+	expect("node.other.points", false)
+	expect("node.new.points", false)
+	// edges of nodes outside the subtree can't be written directly, so
+	// nodes can't be moved into the subtree
+	expect("node.new.child.points", false)
+	expect(client.SubjectChildEdgePoints("new", "child"), true)
+
+	auth.nodeAdded("new", "child")
+	expect("node.new.points", true)
+
+	other, err := nkeys.CreateAccount()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nc, err := nats.Connect(url,
+		client.DeviceCreds(writeCreds("rogue.creds", other, "dev1")))
+	if err == nil {
+		nc.Close()
+		t.Fatal("Device with creds from unknown issuer connected")
+	}
+
+	// connections lose their permissions when credentials expire
+	expiring, err := issueDeviceCreds(issuer, "dev1", 2*time.Second)
+	if err != nil {
+		t.Fatal("Error issuing creds: ", err)
+	}
+
+	expiringConn, err := nats.Connect(url, client.DeviceCredsData([]byte(expiring)),
+		nats.CustomInboxPrefix(client.DeviceInbox("dev1")),
+		nats.ErrorHandler(func(_ *nats.Conn, _ *nats.Subscription, err error) {
+			violations <- err
+		}))
+	if err != nil {
+		t.Fatal("Device with creds failed to connect: ", err)
+	}
+	defer expiringConn.Close()
+
+	expectConn(expiringConn, "node.dev1.points", true)
+
+	time.Sleep(3 * time.Second)
+
+	expectConn(expiringConn, "node.dev1.points", false)
+
+	nc, err = nats.Connect(url, client.DeviceCredsData([]byte(expiring)))
+	if err == nil {
+		nc.Close()
+		t.Fatal("Device with expired creds connected")
+	}
+
+	// revoked credentials lose their permissions and can't connect again
+	revokedLock.Lock()
+	revoked["dev1"] = time.Now()
+	revokedLock.Unlock()
+	auth.revoke("dev1", time.Now())
+
+	expect("node.dev1.points", false)
+
+	nc, err = nats.Connect(url,
+		client.DeviceCreds(filepath.Join(dir, "device.creds")))
+	if err == nil {
+		nc.Close()
+		t.Fatal("Device with revoked creds connected")
+	}
+}
+
+func TestNatsDeviceChildEdges(t *testing.T) {
+	nc, root, stop, err := testServer(Options{
+		StoreFile:         store.MemoryStoreFile,
+		NatsPort:          4970,
+		HTTPPort:          "8970",
+		NatsHTTPPort:      8971,
+		NatsWSPort:        8972,
+		NatsServer:        "nats://localhost:4970",
+		AuthToken:         "secret",
+		NatsIssuerKeyFile: filepath.Join(t.TempDir(), "issuer.nk"),
+	})
+	if err != nil {
+		t.Fatal("Error starting test server: ", err)
+	}
+	defer stop()
+
+	for _, id := range []string{"dev1", "other"} {
+		err = client.SendNodeType(nc, client.Variable{ID: id, Parent: root.ID}, "test")
+		if err != nil {
+			t.Fatal("Error creating node: ", err)
+		}
+	}
+
+	creds, err := client.IssueDeviceCreds(nc, "dev1")
+	if err != nil {
+		t.Fatal("Error issuing creds: ", err)
+	}
+
+	device, err := nats.Connect("nats://localhost:4970",
+		client.DeviceCredsData([]byte(creds)),
+		nats.CustomInboxPrefix(client.DeviceInbox("dev1")))
+	if err != nil {
+		t.Fatal("Device failed to connect: ", err)
+	}
+	defer device.Close()
+
+	edge := data.Points{{Type: data.PointTypeTombstone, Value: 0}}
+	desc := data.Points{
+		{Type: data.PointTypeNodeType, Text: data.NodeTypeVariable},
+		{Type: data.PointTypeDescription, Text: "new"},
+	}
+
+	err = client.SendChildEdgePoints(device, "new", "dev1", edge, true)
+	if err != nil {
+		t.Fatal("Error creating child node: ", err)
+	}
+
+	// the device can use the new node right away
+	err = client.SendNodePoints(device, "new", desc, true)
+	if err != nil {
+		t.Fatal("Error sending points to new node: ", err)
+	}
+
+	err = client.SendChildEdgePoints(device, "other", "dev1", edge, true)
+	if err == nil {
+		t.Fatal("Device moved a node into its subtree")
+	}
+
+	err = client.SendNodePoints(device, "other", desc, true)
+	if err == nil {
+		t.Fatal("Device sent points to a node outside its subtree")
+	}
+
+	err = client.RevokeDeviceCreds(nc, "dev1")
+	if err != nil {
+		t.Fatal("Error revoking creds: ", err)
+	}
+
+	err = client.SendNodePoints(device, "new", desc, true)
+	if err == nil {
+		t.Fatal("Device with revoked creds sent points")
+	}
+
+	nc2, err := nats.Connect("nats://localhost:4970",
+		client.DeviceCredsData([]byte(creds)))
+	if err == nil {
+		nc2.Close()
+		t.Fatal("Device with revoked creds connected")
+	}
+}
@@ -0,0 +1,319 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nkeys"
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// loadIssuerKey loads the nkey seed used to sign device credentials from a
+// file. A new account key is generated and saved if the file does not exist.
+func loadIssuerKey(file string) (nkeys.KeyPair, error) {
+	seed, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		kp, err := nkeys.CreateAccount()
+		if err != nil {
+			return nil, fmt.Errorf("Error generating issuer key: %w", err)
+		}
+
+		seed, err = kp.Seed()
+		if err != nil {
+			return nil, err
+		}
+
+		err = os.WriteFile(file, seed, 0600)
+		if err != nil {
+			return nil, fmt.Errorf("Error saving issuer key: %w", err)
+		}
+
+		return kp, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("Error reading issuer key: %w", err)
+	}
+
+	kp, err := nkeys.FromSeed([]byte(strings.TrimSpace(string(seed))))
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing issuer key: %w", err)
+	}
+
+	return kp, nil
+}
+
+// DefaultNatsCredsExpiry is how long NATS credentials issued to devices are
+// valid if Options.NatsCredsExpiry is not set
+const DefaultNatsCredsExpiry = 90 * 24 * time.Hour
+
+// issueDeviceCreds creates a user nkey for a device and returns a creds
+// file with the key and a JWT naming the device, signed by the issuer. The
+// JWT expires after expiry, if set.
+func issueDeviceCreds(issuer nkeys.KeyPair, deviceID string, expiry time.Duration) (string, error) {
+	if deviceID == "" {
+		return "", errors.New("device ID must be set")
+	}
+
+	user, err := nkeys.CreateUser()
+	if err != nil {
+		return "", fmt.Errorf("Error generating device key: %w", err)
+	}
+
+	pub, err := user.PublicKey()
+	if err != nil {
+		return "", err
+	}
+
+	claims := jwt.NewUserClaims(pub)
+	claims.Name = deviceID
+	if expiry > 0 {
+		claims.Expires = time.Now().Add(expiry).Unix()
+	}
+
+	token, err := claims.Encode(issuer)
+	if err != nil {
+		return "", fmt.Errorf("Error signing device JWT: %w", err)
+	}
+
+	seed, err := user.Seed()
+	if err != nil {
+		return "", err
+	}
+
+	creds, err := jwt.FormatUserConfig(token, seed)
+	if err != nil {
+		return "", err
+	}
+
+	return string(creds), nil
+}
+
+// handleDeviceCreds issues credentials to the device ID in the request (see
+// client.IssueDeviceCreds)
+func (s *Server) handleDeviceCreds(msg *nats.Msg) {
+	var resp client.DeviceCredsResponse
+
+	deviceID := string(msg.Data)
+
+	if s.issuer == nil {
+		resp.Error = "issuer key is not set"
+	} else {
+		var err error
+		expiry := s.options.NatsCredsExpiry
+		if expiry <= 0 {
+			expiry = DefaultNatsCredsExpiry
+		}
+
+		resp.Creds, err = issueDeviceCreds(s.issuer, deviceID, expiry)
+		if err != nil {
+			resp.Error = err.Error()
+		} else {
+			log.Println("Issued NATS credentials for device: ", deviceID)
+		}
+	}
+
+	out, err := json.Marshal(resp)
+	if err != nil {
+		log.Println("Error encoding creds response: ", err)
+		return
+	}
+
+	err = msg.Respond(out)
+	if err != nil {
+		log.Println("Error responding to creds request: ", err)
+	}
+}
+
+// deviceSubtree returns the IDs of the device node and its descendants. If
+// the device node does not exist yet (before the device syncs), only the
+// device ID is returned, so the device can create its node.
+func (s *Server) deviceSubtree(deviceID string) []string {
+	ret := []string{deviceID}
+
+	children, err := client.GetNodeChildren(s.nc, deviceID, "", false, true)
+	if err != nil {
+		log.Printf("Error getting subtree of device %v: %v\n", deviceID, err)
+		return ret
+	}
+
+	for _, c := range children {
+		ret = append(ret, c.ID)
+	}
+
+	return ret
+}
+
+// handleDeviceCredsRevoke revokes the credentials of the device ID in the
+// request (see client.RevokeDeviceCreds). The revocation is recorded on the
+// root node, so it is kept when the server restarts.
+func (s *Server) handleDeviceCredsRevoke(msg *nats.Msg) {
+	var resp client.DeviceCredsResponse
+
+	deviceID := string(msg.Data)
+	now := time.Now()
+
+	err := s.revokeDeviceCreds(deviceID, now)
+	if err != nil {
+		resp.Error = err.Error()
+	} else {
+		log.Println("Revoked NATS credentials for device: ", deviceID)
+	}
+
+	out, err := json.Marshal(resp)
+	if err != nil {
+		log.Println("Error encoding revoke response: ", err)
+		return
+	}
+
+	err = msg.Respond(out)
+	if err != nil {
+		log.Println("Error responding to revoke request: ", err)
+	}
+}
+
+func (s *Server) revokeDeviceCreds(deviceID string, t time.Time) error {
+	if deviceID == "" {
+		return errors.New("device ID must be set")
+	}
+
+	if s.natsAuth == nil {
+		return errors.New("device credentials are not enabled")
+	}
+
+	root, err := client.GetNode(s.nc, "root", "")
+	if err != nil || len(root) < 1 {
+		return fmt.Errorf("Error getting root node: %v", err)
+	}
+
+	err = client.SendNodePoint(s.nc, root[0].ID, data.Point{
+		Time:  t,
+		Type:  data.PointTypeCredsRevoked,
+		Key:   deviceID,
+		Value: 1,
+	}, true)
+	if err != nil {
+		return fmt.Errorf("Error recording revocation: %v", err)
+	}
+
+	s.natsAuth.revoke(deviceID, t)
+
+	return nil
+}
+
+// deviceRevoked returns the time the credentials of a device were revoked,
+// or zero if they were not. Devices are rejected if the root node can't be
+// read.
+func (s *Server) deviceRevoked(deviceID string) time.Time {
+	root, err := client.GetNode(s.nc, "root", "")
+	if err != nil || len(root) < 1 {
+		log.Printf("Error getting revoked credentials of %v: %v\n", deviceID, err)
+		return time.Now()
+	}
+
+	p, ok := root[0].Points.Find(data.PointTypeCredsRevoked, deviceID)
+	if !ok || p.Tombstone%2 == 1 {
+		return time.Time{}
+	}
+
+	return p.Time
+}
+
+// edgeAdded returns true if edge points add a node to a parent (the
+// tombstone point is cleared)
+func edgeAdded(points data.Points) bool {
+	p, ok := points.Find(data.PointTypeTombstone, "")
+	return ok && int(p.Value)%2 == 0
+}
+
+// handleDeviceEdge updates the permissions of connected devices when a node
+// is added to their subtree. It handles the edge points the store publishes
+// after they are written (up.<node>.<node>.<parent>.points), so edges that
+// are rejected or deleted don't change permissions.
+func (s *Server) handleDeviceEdge(msg *nats.Msg) {
+	chunks := strings.Split(msg.Subject, ".")
+	if len(chunks) != 5 || chunks[1] != chunks[2] {
+		// published for each upstream node, only handle the first
+		return
+	}
+
+	points, err := client.DecodePoints(msg)
+	if err != nil || !edgeAdded(points) {
+		return
+	}
+
+	s.natsAuth.nodeAdded(chunks[2], chunks[3])
+}
+
+// handleChildEdgePoints writes edge points devices send for a child of a
+// node in their subtree (see client.SendChildEdgePoints). NATS permissions
+// only allow devices to publish these for parents in their subtree. The
+// points are only written if the child is a new node or already has an edge
+// to the parent, so devices can't move nodes they don't own into their
+// subtree. Permissions of the device are updated before the reply, so it
+// can use the subjects of a new node right away.
+func (s *Server) handleChildEdgePoints(msg *nats.Msg) {
+	respond := func(err error) {
+		if msg.Reply == "" {
+			if err != nil {
+				log.Println("Device child edge: ", err)
+			}
+			return
+		}
+
+		reply := ""
+		if err != nil {
+			reply = err.Error()
+		}
+
+		msg.Respond([]byte(reply))
+	}
+
+	// node.<parent>.child.<node>.points
+	chunks := strings.Split(msg.Subject, ".")
+	if len(chunks) != 5 {
+		respond(fmt.Errorf("Error in message subject: %v", msg.Subject))
+		return
+	}
+
+	parentID, nodeID := chunks[1], chunks[3]
+
+	points, err := client.DecodePoints(msg)
+	if err != nil {
+		respond(fmt.Errorf("Error decoding points: %v", err))
+		return
+	}
+
+	_, err = client.GetNode(s.nc, nodeID, parentID)
+	if err == data.ErrDocumentNotFound {
+		// the edge does not exist, so the node must be new
+		_, err = client.GetNode(s.nc, nodeID, "none")
+		if err == nil {
+			respond(fmt.Errorf("node %v already exists outside of %v", nodeID, parentID))
+			return
+		}
+	}
+
+	if err != nil && err != data.ErrDocumentNotFound {
+		respond(fmt.Errorf("Error getting node %v: %v", nodeID, err))
+		return
+	}
+
+	err = client.SendEdgePoints(s.nc, nodeID, parentID, points, true)
+	if err != nil {
+		respond(err)
+		return
+	}
+
+	if edgeAdded(points) {
+		s.natsAuth.nodeAdded(nodeID, parentID)
+	}
+
+	respond(nil)
+}
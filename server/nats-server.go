@@ -3,28 +3,56 @@ package server
 import (
 	"fmt"
 	"log"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/nats-io/nats-server/v2/server"
 )
 
 type natsServerOptions struct {
+	Host       string
 	Port       int
 	HTTPPort   int
+	WSHost     string
 	WSPort     int
+	MQTTPort   int
 	Auth       string
 	TLSCert    string
 	TLSKey     string
 	TLSTimeout float64
+	TLSCA      string
+	// DeviceAuth is used when TLSCA is set or device credentials are
+	// issued, see natsAuth
+	DeviceAuth *natsAuth
+	JetStream  bool
+	StoreDir   string
+	// leafnode remote, see Options
+	LeafURL         string
+	LeafCredentials string
+	LeafTLSCert     string
+	LeafTLSKey      string
+	LeafTLSCA       string
+	// cluster, see Options
+	ClusterName string
+	ClusterPort int
+	Routes      string
 }
 
 // newNatsServer creates a new nats server instance
 func newNatsServer(o natsServerOptions) (*server.Server, error) {
 	opts := server.Options{
+		Host:          o.Host,
 		Port:          o.Port,
+		HTTPHost:      o.Host,
 		HTTPPort:      o.HTTPPort,
 		Authorization: o.Auth,
 		NoSigs:        true,
+		JetStream:     o.JetStream,
+		StoreDir:      o.StoreDir,
 	}
 
 	if o.TLSCert != "" && o.TLSKey != "" {
@@ -36,6 +64,15 @@ func newNatsServer(o natsServerOptions) (*server.Server, error) {
 		tc := server.TLSConfigOpts{}
 		tc.CertFile = opts.TLSCert
 		tc.KeyFile = opts.TLSKey
+
+		if o.TLSCA != "" {
+			// clients must have a certificate signed by a CA in the
+			// bundle, see natsAuth
+			log.Println("NATS client certificates required, CA: ", o.TLSCA)
+			opts.TLSCaCert = o.TLSCA
+			opts.TLSVerify = true
+		}
+
 		tc.CaFile = opts.TLSCaCert
 		tc.Verify = opts.TLSVerify
 
@@ -47,7 +84,15 @@ func newNatsServer(o natsServerOptions) (*server.Server, error) {
 		}
 	}
 
+	if o.DeviceAuth != nil {
+		opts.Authorization = ""
+		opts.CustomClientAuthentication = o.DeviceAuth
+		// the nonce is signed by clients with credentials
+		opts.AlwaysEnableNonce = true
+	}
+
 	if o.WSPort != 0 {
+		opts.Websocket.Host = o.WSHost
 		opts.Websocket.Port = o.WSPort
 		opts.Websocket.Token = o.Auth
 		opts.Websocket.AuthTimeout = o.TLSTimeout
@@ -55,6 +100,38 @@ func newNatsServer(o natsServerOptions) (*server.Server, error) {
 		opts.Websocket.HandshakeTimeout = time.Second * 20
 	}
 
+	if o.MQTTPort != 0 {
+		// MQTT requires a server name, which is used to name the
+		// JetStream streams MQTT sessions are stored in
+		hostname, err := os.Hostname()
+		if err != nil {
+			hostname = "localhost"
+		}
+		opts.ServerName = "siot-" + hostname
+		opts.MQTT.Host = o.Host
+		opts.MQTT.Port = o.MQTTPort
+		opts.MQTT.TLSConfig = opts.TLSConfig
+		opts.MQTT.TLSTimeout = o.TLSTimeout
+	}
+
+	if o.LeafURL != "" {
+		remote, err := leafRemote(o)
+		if err != nil {
+			return nil, err
+		}
+
+		opts.LeafNode.Remotes = []*server.RemoteLeafOpts{remote}
+	}
+
+	if o.ClusterName != "" {
+		opts.Cluster.Name = o.ClusterName
+		opts.Cluster.Host = o.Host
+		opts.Cluster.Port = o.ClusterPort
+		opts.Routes = server.RoutesFromStr(o.Routes)
+		log.Printf("NATS cluster %v, port: %v, routes: %v\n", o.ClusterName,
+			o.ClusterPort, o.Routes)
+	}
+
 	natsServer, err := server.NewServer(&opts)
 
 	if err != nil {
@@ -67,12 +144,59 @@ func newNatsServer(o natsServerOptions) (*server.Server, error) {
 		authEnabled = "yes"
 	}
 
-	log.Printf("NATS server, port: %v, http port: %v, auth enabled: %v\n",
-		o.Port, o.HTTPPort, authEnabled)
+	log.Printf("NATS server, address: %v, http port: %v, auth enabled: %v\n",
+		net.JoinHostPort(o.Host, strconv.Itoa(o.Port)), o.HTTPPort, authEnabled)
 
 	if o.WSPort != 0 {
-		log.Printf("NATS server WS enabled on port: %v\n", o.WSPort)
+		log.Printf("NATS server WS enabled on: %v\n",
+			net.JoinHostPort(o.WSHost, strconv.Itoa(o.WSPort)))
+	}
+
+	if o.MQTTPort != 0 {
+		log.Printf("NATS server MQTT enabled on: %v\n",
+			net.JoinHostPort(o.Host, strconv.Itoa(o.MQTTPort)))
 	}
 
 	return natsServer, nil
 }
+
+// leafRemote returns the leafnode remote config that connects the NATS
+// server to an upstream NATS server or cluster
+func leafRemote(o natsServerOptions) (*server.RemoteLeafOpts, error) {
+	remote := &server.RemoteLeafOpts{Credentials: o.LeafCredentials}
+
+	for _, u := range strings.Split(o.LeafURL, ",") {
+		u = strings.TrimSpace(u)
+		if u == "" {
+			continue
+		}
+
+		leafURL, err := url.Parse(u)
+		if err != nil {
+			return nil, fmt.Errorf("Error parsing leafnode URL %v: %v", u, err)
+		}
+
+		remote.URLs = append(remote.URLs, leafURL)
+	}
+
+	if o.LeafTLSCert != "" || o.LeafTLSCA != "" {
+		tc := server.TLSConfigOpts{
+			CertFile: o.LeafTLSCert,
+			KeyFile:  o.LeafTLSKey,
+			CaFile:   o.LeafTLSCA,
+		}
+
+		var err error
+		remote.TLSConfig, err = server.GenTLSConfig(&tc)
+		if err != nil {
+			return nil, fmt.Errorf("Error setting up leafnode TLS: %v", err)
+		}
+		remote.TLS = true
+	}
+
+	for _, u := range remote.URLs {
+		log.Println("NATS leafnode remote: ", u.Redacted())
+	}
+
+	return remote, nil
+}
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+)
+
+func TestNatsLeafNode(t *testing.T) {
+	leafPort, err := freePort()
+	if err != nil {
+		t.Fatal("Error getting free port: ", err)
+	}
+
+	hub, err := server.NewServer(&server.Options{Port: -1, NoSigs: true,
+		LeafNode: server.LeafNodeOpts{Host: "127.0.0.1", Port: leafPort}})
+	if err != nil {
+		t.Fatal("Error creating hub server: ", err)
+	}
+	go hub.Start()
+	defer hub.Shutdown()
+
+	if !hub.ReadyForConnections(5 * time.Second) {
+		t.Fatal("Hub server not ready")
+	}
+
+	leafURL := fmt.Sprintf("nats://127.0.0.1:%v", leafPort)
+
+	edge, err := newNatsServer(natsServerOptions{Host: "127.0.0.1", Port: -1,
+		HTTPPort: -1, LeafURL: leafURL})
+	if err != nil {
+		t.Fatal("Error creating edge server: ", err)
+	}
+	go edge.Start()
+	defer edge.Shutdown()
+
+	if !edge.ReadyForConnections(5 * time.Second) {
+		t.Fatal("Edge server not ready")
+	}
+
+	start := time.Now()
+	for hub.NumLeafNodes() < 1 {
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("Edge server did not connect to hub")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	hubNc, err := nats.Connect(hub.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer hubNc.Close()
+
+	edgeNc, err := nats.Connect(edge.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer edgeNc.Close()
+
+	sub, err := hubNc.SubscribeSync("up.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hubNc.Flush()
+
+	// the subscription is propagated to the leafnode asynchronously
+	for {
+		err = edgeNc.Publish("up.test", []byte("hello"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = sub.NextMsg(100 * time.Millisecond)
+		if err == nil {
+			break
+		}
+
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("Message from edge not received on hub")
+		}
+	}
+}
+
+func freePort() (int, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
+
+func TestClusterRequiresStoreURI(t *testing.T) {
+	s, nc, err := NewServer(Options{
+		NatsServer:      "nats://127.0.0.1:1",
+		NatsClusterName: "siot",
+	})
+	if err != nil {
+		t.Fatal("Error creating server: ", err)
+	}
+	defer nc.Close()
+
+	err = s.Start()
+	if err == nil {
+		t.Fatal("Server started in cluster mode without a store URI")
+	}
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strconv"
+)
+
+// errRestart is returned by the run group when SIGHUP is received
+var errRestart = errors.New("restart requested")
+
+// envHTTPFD is the environment variable with the file descriptor of the HTTP
+// listener inherited from the process that restarted in place (see restart)
+const envHTTPFD = "SIOT_HTTP_FD"
+
+// listenHTTP returns the HTTP listener inherited from the previous process if
+// there is one bound to address, otherwise it listens on address.
+func listenHTTP(address string) (net.Listener, error) {
+	if fd := os.Getenv(envHTTPFD); fd != "" {
+		os.Unsetenv(envHTTPFD)
+
+		ln, err := inheritedListener(fd)
+		if err != nil {
+			log.Println("Error using inherited HTTP listener: ", err)
+		} else if !listenerBoundTo(ln, address) {
+			log.Printf("Inherited HTTP listener is bound to %v, listening on %v",
+				ln.Addr(), address)
+			ln.Close()
+		} else {
+			log.Println("Using inherited HTTP listener: ", ln.Addr())
+			return ln, nil
+		}
+	}
+
+	ln, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("Error starting api server: %v", err)
+	}
+
+	return ln, nil
+}
+
+func inheritedListener(fd string) (net.Listener, error) {
+	n, err := strconv.Atoi(fd)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %v: %v", envHTTPFD, fd)
+	}
+
+	f := os.NewFile(uintptr(n), "http")
+	defer f.Close()
+
+	// FileListener dups the file descriptor
+	return net.FileListener(f)
+}
+
+// listenerBoundTo returns true if ln is bound to the port of address, and to
+// the IP of address unless it is blank
+func listenerBoundTo(ln net.Listener, address string) bool {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return false
+	}
+
+	addr, ok := ln.Addr().(*net.TCPAddr)
+	if !ok || strconv.Itoa(addr.Port) != port {
+		return false
+	}
+
+	if host == "" {
+		return addr.IP.IsUnspecified()
+	}
+
+	return addr.IP.Equal(net.ParseIP(host))
+}
+
+// listenerFile returns a duplicate of the file descriptor of ln, which keeps
+// the socket listening after ln is closed
+func listenerFile(ln net.Listener) (*os.File, error) {
+	tl, ok := ln.(*net.TCPListener)
+	if !ok {
+		return nil, fmt.Errorf("not a TCP listener: %T", ln)
+	}
+
+	return tl.File()
+}
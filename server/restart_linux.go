@@ -0,0 +1,44 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"runtime"
+	"strconv"
+	"syscall"
+)
+
+// restart replaces the process with the current executable, which is the new
+// binary if it was updated, using the same arguments and environment. The
+// process ID does not change, so service managers do not see a restart. The
+// HTTP listener file is inherited by the new process, so HTTP connections are
+// queued instead of refused while it starts.
+func restart(http *os.File) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("Error getting executable: %v", err)
+	}
+
+	env := os.Environ()
+
+	if http != nil {
+		fd := http.Fd()
+
+		// clear close on exec so the new process inherits the listener
+		_, _, errno := syscall.Syscall(syscall.SYS_FCNTL, fd,
+			syscall.F_SETFD, 0)
+		if errno != 0 {
+			log.Println("Error passing HTTP listener: ", errno)
+		} else {
+			env = append(env, envHTTPFD+"="+strconv.Itoa(int(fd)))
+		}
+	}
+
+	log.Println("Restarting ", exe)
+
+	err = syscall.Exec(exe, os.Args, env)
+	runtime.KeepAlive(http)
+
+	return fmt.Errorf("Error restarting: %v", err)
+}
@@ -0,0 +1,109 @@
+package server
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"syscall"
+	"testing"
+)
+
+func TestListenHTTPInherited(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("Error listening: ", err)
+	}
+
+	f, err := listenerFile(ln)
+	if err != nil {
+		t.Fatal("Error getting listener file: ", err)
+	}
+
+	// the socket keeps listening through the file
+	ln.Close()
+
+	// listenHTTP closes the inherited descriptor, like after a restart
+	fd, err := syscall.Dup(int(f.Fd()))
+	if err != nil {
+		t.Fatal("Error duplicating listener: ", err)
+	}
+	f.Close()
+
+	address := ln.Addr().String()
+
+	os.Setenv(envHTTPFD, strconv.Itoa(fd))
+
+	inherited, err := listenHTTP(address)
+	if err != nil {
+		t.Fatal("Error listening: ", err)
+	}
+	defer inherited.Close()
+
+	if os.Getenv(envHTTPFD) != "" {
+		t.Error("Environment variable not cleared")
+	}
+
+	if inherited.Addr().String() != address {
+		t.Fatalf("Expected listener on %v, got %v", address, inherited.Addr())
+	}
+
+	conn, err := net.Dial("tcp", address)
+	if err != nil {
+		t.Fatal("Error connecting to inherited listener: ", err)
+	}
+	conn.Close()
+}
+
+func TestListenHTTPOtherAddress(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("Error listening: ", err)
+	}
+	defer ln.Close()
+
+	f, err := listenerFile(ln)
+	if err != nil {
+		t.Fatal("Error getting listener file: ", err)
+	}
+
+	fd, err := syscall.Dup(int(f.Fd()))
+	if err != nil {
+		t.Fatal("Error duplicating listener: ", err)
+	}
+	f.Close()
+
+	os.Setenv(envHTTPFD, strconv.Itoa(fd))
+
+	// the configured port changed, so a new listener is used
+	ln2, err := listenHTTP("127.0.0.1:0")
+	if err != nil {
+		t.Fatal("Error listening: ", err)
+	}
+	defer ln2.Close()
+
+	if ln2.Addr().String() == ln.Addr().String() {
+		t.Error("Inherited listener used for a different address")
+	}
+}
+
+func TestListenerBoundTo(t *testing.T) {
+	ln, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal("Error listening: ", err)
+	}
+	defer ln.Close()
+
+	port := strconv.Itoa(ln.Addr().(*net.TCPAddr).Port)
+
+	if !listenerBoundTo(ln, ":"+port) {
+		t.Error("Listener should be bound to all addresses")
+	}
+
+	if listenerBoundTo(ln, "127.0.0.1:"+port) {
+		t.Error("Listener is not bound to 127.0.0.1")
+	}
+
+	if listenerBoundTo(ln, ":1") {
+		t.Error("Listener is not bound to port 1")
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package server
+
+import (
+	"errors"
+	"os"
+)
+
+// restart is only supported on Linux, the server stops
+func restart(_ *os.File) error {
+	return errors.New("in-place restart is only supported on Linux")
+}
@@ -0,0 +1,53 @@
+package server
+
+import (
+	"crypto/ed25519"
+	"fmt"
+	"log"
+
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// setupSigning loads the signing key, uses it to sign node points sent by
+// this instance, and adds the public key to the root node so that the store
+// accepts them.
+func (s *Server) setupSigning() error {
+	key, err := client.LoadSigningKey(s.options.SigningKeyFile)
+	if err != nil {
+		return err
+	}
+
+	nodes, err := client.GetNode(s.nc, "root", "")
+	if err != nil {
+		return fmt.Errorf("Error getting root node for signing: %v", err)
+	}
+
+	if len(nodes) == 0 {
+		return fmt.Errorf("Error getting root node for signing, no data")
+	}
+
+	root := nodes[0]
+	client.SetSigningKey(root.ID, key, s.options.SignPointTypes)
+
+	pub := data.EncodeSigningKey(key.Public().(ed25519.PublicKey))
+
+	p, ok := root.Points.Find(data.PointTypeSigningKey, root.ID)
+	if ok && p.Text == pub && p.Tombstone == 0 {
+		return nil
+	}
+
+	err = client.SendNodePoint(s.nc, root.ID, data.Point{
+		Type: data.PointTypeSigningKey,
+		Key:  root.ID,
+		Text: pub,
+	}, true)
+
+	if err != nil {
+		// if signing is already enforced, the key must be added by
+		// another instance with a trusted key
+		log.Println("Error adding signing key to root node: ", err)
+	}
+
+	return nil
+}
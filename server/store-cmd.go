@@ -0,0 +1,243 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/client"
+)
+
+const storeUsage = "usage: siot store backup|restore <file> (use - for stdout/stdin), siot store verify|repair, siot store device-backup <device ID> <file>"
+
+// runStoreCommand runs the store verbs:
+//
+//	siot store backup <file>
+//	siot store restore <file>
+//	siot store verify
+//	siot store repair
+//	siot store device-backup <device ID> <file>
+//
+// against the server at -natsServer
+func runStoreCommand(nc *nats.Conn, args []string) error {
+	if len(args) == 1 && (args[0] == "verify" || args[0] == "repair") {
+		return runStoreVerify(nc, args[0] == "repair")
+	}
+
+	if len(args) == 3 && args[0] == "device-backup" {
+		return runDeviceBackup(nc, args[1], args[2])
+	}
+
+	if len(args) != 2 {
+		return errors.New(storeUsage)
+	}
+
+	file := args[1]
+
+	switch args[0] {
+	case "backup":
+		if file == "-" {
+			err := client.StoreBackup(nc, os.Stdout)
+			if err != nil {
+				return fmt.Errorf("Error backing up store: %w", err)
+			}
+			return nil
+		}
+
+		// write to a temp file so a failed backup does not overwrite a
+		// previous one
+		tmp := file + ".tmp"
+		f, err := os.Create(tmp)
+		if err != nil {
+			return fmt.Errorf("Error creating backup file: %w", err)
+		}
+
+		err = client.StoreBackup(nc, f)
+		closeErr := f.Close()
+		if err == nil {
+			err = closeErr
+		}
+
+		if err != nil {
+			os.Remove(tmp)
+			return fmt.Errorf("Error backing up store: %w", err)
+		}
+
+		err = os.Rename(tmp, file)
+		if err != nil {
+			return fmt.Errorf("Error renaming backup file: %w", err)
+		}
+
+		log.Println("Store backed up to: ", file)
+	case "restore":
+		var r io.Reader = os.Stdin
+		if file != "-" {
+			f, err := os.Open(file)
+			if err != nil {
+				return fmt.Errorf("Error opening backup file: %w", err)
+			}
+			defer f.Close()
+			r = f
+		}
+
+		err := client.StoreRestore(nc, r)
+		if err != nil {
+			return fmt.Errorf("Error restoring store: %w", err)
+		}
+
+		log.Println("Store restored, restart SIOT to use the restored data")
+	default:
+		return errors.New(storeUsage)
+	}
+
+	return nil
+}
+
+// runStoreVerify prints the problems found by a store verify
+func runStoreVerify(nc *nats.Conn, repair bool) error {
+	report, err := client.StoreVerify(nc, repair)
+	if err != nil {
+		return fmt.Errorf("Error verifying store: %w", err)
+	}
+
+	for _, p := range report.Problems {
+		fmt.Println(p)
+	}
+
+	fmt.Printf("Checked %v nodes and %v edges, found %v problems\n",
+		report.Nodes, report.Edges, len(report.Problems))
+
+	return nil
+}
+
+// runDeviceBackup downloads a snapshot of the store of a downstream device.
+// The snapshot is written to a temp file, and the snapshot ID to another
+// file, so an interrupted download is resumed when the command is run again.
+// The snapshot is verified against its hash before it is renamed to file.
+func runDeviceBackup(nc *nats.Conn, deviceID, file string) error {
+	tmp := file + ".tmp"
+	idFile := tmp + ".id"
+
+	var state client.DeviceBackupRequest
+
+	id, err := os.ReadFile(idFile)
+	if err == nil {
+		info, err := os.Stat(tmp)
+		if err == nil {
+			state.ID = strings.TrimSpace(string(id))
+			state.Offset = info.Size()
+			log.Printf("Resuming device backup at %v bytes\n", state.Offset)
+		}
+	}
+
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if state.ID != "" {
+		flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+
+	f, err := os.OpenFile(tmp, flags, 0644)
+	if err != nil {
+		return fmt.Errorf("Error creating backup file: %w", err)
+	}
+
+	w := &deviceBackupWriter{f: f, idFile: idFile, state: &state,
+		saved: state.ID != ""}
+	err = client.DeviceBackup(nc, deviceID, &state, w)
+	closeErr := f.Close()
+	if err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		saveErr := w.saveID()
+		if saveErr != nil {
+			log.Println(saveErr)
+		}
+
+		if errors.Is(err, client.ErrSnapshotExpired) {
+			// the device no longer has the snapshot, so start over
+			os.Remove(tmp)
+			os.Remove(idFile)
+		}
+		return fmt.Errorf("Error backing up device: %w", err)
+	}
+
+	err = verifySnapshot(tmp, state.ID)
+	if err != nil {
+		os.Remove(tmp)
+		os.Remove(idFile)
+		return err
+	}
+
+	err = os.Rename(tmp, file)
+	if err != nil {
+		return fmt.Errorf("Error renaming backup file: %w", err)
+	}
+	os.Remove(idFile)
+
+	log.Println("Device store backed up to: ", file)
+
+	return nil
+}
+
+// deviceBackupWriter writes chunks of a device backup to a file. The
+// snapshot ID is set once the first chunk is written, and is saved when the
+// next chunk is written, so a download that is killed can be resumed.
+type deviceBackupWriter struct {
+	f      *os.File
+	idFile string
+	state  *client.DeviceBackupRequest
+	saved  bool
+}
+
+func (w *deviceBackupWriter) Write(p []byte) (int, error) {
+	err := w.saveID()
+	if err != nil {
+		return 0, err
+	}
+
+	return w.f.Write(p)
+}
+
+func (w *deviceBackupWriter) saveID() error {
+	if w.saved || w.state.ID == "" {
+		return nil
+	}
+
+	err := os.WriteFile(w.idFile, []byte(w.state.ID), 0644)
+	if err != nil {
+		return fmt.Errorf("Error saving snapshot ID: %w", err)
+	}
+
+	w.saved = true
+
+	return nil
+}
+
+// verifySnapshot checks the SHA-256 hash of a snapshot file matches the
+// snapshot ID
+func verifySnapshot(file, id string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	_, err = io.Copy(h, f)
+	if err != nil {
+		return fmt.Errorf("Error reading backup file: %w", err)
+	}
+
+	if hex.EncodeToString(h.Sum(nil)) != id {
+		return errors.New("device backup does not match the snapshot hash")
+	}
+
+	return nil
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/nats-io/nats.go"
 	"github.com/simpleiot/simpleiot/client"
 	"github.com/simpleiot/simpleiot/data"
+	"github.com/simpleiot/simpleiot/store"
 )
 
 var testServerOptions = Options{
@@ -21,10 +22,40 @@ var testServerOptions = Options{
 	NatsServer:   "nats://localhost:4990",
 }
 
+// the memory test server uses different ports, so it can run at the same
+// time as the default test server
+var testServerMemoryOptions = Options{
+	StoreFile:    store.MemoryStoreFile,
+	NatsPort:     4980,
+	HTTPPort:     "8980",
+	NatsHTTPPort: 8981,
+	NatsWSPort:   8982,
+	NatsServer:   "nats://localhost:4980",
+}
+
 // TestServer starts a test server and returns a function to stop it
 func TestServer() (*nats.Conn, data.NodeEdge, func(), error) {
 	exec.Command("sh", "-c", "rm test.sqlite*").Run()
-	s, nc, err := NewServer(testServerOptions)
+	nc, root, stop, err := testServer(testServerOptions)
+	if stop != nil {
+		stopServer := stop
+		stop = func() {
+			stopServer()
+			exec.Command("sh", "-c", "rm test.sqlite*").Run()
+		}
+	}
+	return nc, root, stop, err
+}
+
+// TestServerMemory starts a test server that uses the in-memory store
+// backend. It can run alongside TestServer, for example to test things
+// that involve two instances.
+func TestServerMemory() (*nats.Conn, data.NodeEdge, func(), error) {
+	return testServer(testServerMemoryOptions)
+}
+
+func testServer(o Options) (*nats.Conn, data.NodeEdge, func(), error) {
+	s, nc, err := NewServer(o)
 
 	if err != nil {
 		return nil, data.NodeEdge{}, nil, fmt.Errorf("Error starting siot server: %v", err)
@@ -43,7 +74,6 @@ func TestServer() (*nats.Conn, data.NodeEdge, func(), error) {
 	stop := func() {
 		s.Stop(nil)
 		<-stopped
-		exec.Command("sh", "-c", "rm test.sqlite*").Run()
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
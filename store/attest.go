@@ -0,0 +1,159 @@
+package store
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// how long a device has to sign an attestation challenge
+var attestChallengeTimeout = time.Minute
+
+// attestMaxChallenges limits the pending challenges, as challenge requests
+// are not authenticated
+const attestMaxChallenges = 1000
+
+// errAttest is returned to devices for all attestation errors, so requests
+// don't show which devices are enrolled. The reason is logged.
+var errAttest = errors.New("attestation failed")
+
+type attestChallenge struct {
+	deviceID string
+	expires  time.Time
+}
+
+// enrolledKey returns the attestation key enrolled for a device on the root
+// node
+func (st *Store) enrolledKey(deviceID string) (string, error) {
+	root, err := st.db.node(st.db.rootNodeID())
+	if err != nil {
+		return "", err
+	}
+
+	p, ok := root.Points.Find(data.PointTypeAttestationKey, deviceID)
+	if !ok || p.Text == "" || p.Tombstone%2 == 1 {
+		return "", fmt.Errorf("device %v is not enrolled", deviceID)
+	}
+
+	return p.Text, nil
+}
+
+// attestChallenge returns a new challenge for a device. Challenges are
+// returned whether the device is enrolled or not, and are keyed by the
+// challenge, so a device can have several pending challenges and requests
+// for a device ID can't replace the challenge of the device.
+func (st *Store) attestChallenge(deviceID string) ([]byte, error) {
+	challenge := make([]byte, 32)
+	_, err := io.ReadFull(rand.Reader, challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	st.lock.Lock()
+	defer st.lock.Unlock()
+
+	now := time.Now()
+	for k, c := range st.challenges {
+		if now.After(c.expires) {
+			delete(st.challenges, k)
+		}
+	}
+
+	if len(st.challenges) >= attestMaxChallenges {
+		return nil, errors.New("too many pending attestation challenges")
+	}
+
+	st.challenges[string(challenge)] = attestChallenge{
+		deviceID: deviceID,
+		expires:  now.Add(attestChallengeTimeout),
+	}
+
+	return challenge, nil
+}
+
+// attestVerify checks the signed challenge of a device and returns NATS
+// credentials for the device (see client.IssueDeviceCreds), which only
+// allow access to the device subtree. Each challenge can only be used once.
+func (st *Store) attestVerify(req data.AttestRequest) (string, error) {
+	st.lock.Lock()
+	c, ok := st.challenges[string(req.Challenge)]
+	delete(st.challenges, string(req.Challenge))
+	st.lock.Unlock()
+
+	if !ok || time.Now().After(c.expires) || c.deviceID != req.DeviceID {
+		return "", fmt.Errorf("invalid or expired challenge for %v", req.DeviceID)
+	}
+
+	enc, err := st.enrolledKey(req.DeviceID)
+	if err != nil {
+		return "", err
+	}
+
+	pub, err := data.ParsePublicKey(enc)
+	if err != nil {
+		return "", fmt.Errorf("Error parsing key enrolled for %v: %w", req.DeviceID, err)
+	}
+
+	err = data.VerifyAttestation(pub, req.DeviceID, req.Challenge, req.Signature)
+	if err != nil {
+		return "", fmt.Errorf("attestation failed for %v: %w", req.DeviceID, err)
+	}
+
+	creds, err := client.IssueDeviceCreds(st.nc, req.DeviceID)
+	if err != nil {
+		return "", fmt.Errorf("Error issuing credentials for %v: %w", req.DeviceID, err)
+	}
+
+	err = client.SendNodePoint(st.nc, st.db.rootNodeID(), data.Point{
+		Type:  data.PointTypeAttested,
+		Key:   req.DeviceID,
+		Value: 1,
+	}, false)
+	if err != nil {
+		log.Println("Error recording attestation: ", err)
+	}
+
+	return creds, nil
+}
+
+// handleAttest handles attestation challenge and verify requests (see
+// client.AttestChallenge and client.AttestVerify)
+func (st *Store) handleAttest(msg *nats.Msg) {
+	var resp data.AttestResponse
+
+	var req data.AttestRequest
+	err := json.Unmarshal(msg.Data, &req)
+	if err != nil {
+		resp.Error = "Error decoding attestation request"
+	} else if req.DeviceID == "" {
+		resp.Error = "device ID must be set"
+	} else if msg.Subject == client.SubjectAttestVerify() {
+		resp.Creds, err = st.attestVerify(req)
+	} else {
+		resp.Challenge, err = st.attestChallenge(req.DeviceID)
+	}
+
+	if err != nil {
+		log.Println("Store attestation: ", err)
+		resp.Error = errAttest.Error()
+	}
+
+	d, err := json.Marshal(resp)
+	if err != nil {
+		log.Println("Error encoding attestation response: ", err)
+		return
+	}
+
+	err = st.nc.Publish(msg.Reply, d)
+	if err != nil {
+		log.Println("Error sending attestation response: ", err)
+	}
+}
@@ -0,0 +1,128 @@
+package store
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"testing"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+func TestStoreAttest(t *testing.T) {
+	nc, st, _ := startTestStoreParams(t, Params{BatchPeriod: -1})
+
+	root := st.db.rootNodeID()
+
+	// credentials are issued by the server
+	credsSub, err := nc.Subscribe(client.SubjectDeviceCreds(), func(msg *nats.Msg) {
+		d, _ := json.Marshal(client.DeviceCredsResponse{Creds: "creds-" + string(msg.Data)})
+		msg.Respond(d)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer credsSub.Unsubscribe()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// challenges don't show if a device is enrolled
+	challenge, err := client.AttestChallenge(nc, "dev1")
+	if err != nil {
+		t.Fatal("Error getting challenge for device that is not enrolled: ", err)
+	}
+
+	sig, err := data.SignAttestation(key, "dev1", challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = client.AttestVerify(nc, data.AttestRequest{DeviceID: "dev1",
+		Challenge: challenge, Signature: sig})
+	if err == nil || err.Error() != errAttest.Error() {
+		t.Fatal("Expected generic error for device that is not enrolled: ", err)
+	}
+
+	pub, err := data.EncodePublicKey(key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = client.SendNodePoint(nc, root, data.Point{Type: data.PointTypeAttestationKey,
+		Key: "dev1", Text: pub}, true)
+	if err != nil {
+		t.Fatal("Error enrolling device: ", err)
+	}
+
+	challenge, err = client.AttestChallenge(nc, "dev1")
+	if err != nil {
+		t.Fatal("Error getting challenge: ", err)
+	}
+
+	// a challenge for another device does not replace the challenge
+	other, err := client.AttestChallenge(nc, "dev2")
+	if err != nil {
+		t.Fatal("Error getting challenge: ", err)
+	}
+
+	sig, err = data.SignAttestation(key, "dev1", other)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = client.AttestVerify(nc, data.AttestRequest{DeviceID: "dev1",
+		Challenge: other, Signature: sig})
+	if err == nil {
+		t.Fatal("Challenge for another device was accepted")
+	}
+
+	// signature of another challenge
+	sig, err = data.SignAttestation(key, "dev1", []byte("other"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = client.AttestVerify(nc, data.AttestRequest{DeviceID: "dev1",
+		Challenge: challenge, Signature: sig})
+	if err == nil {
+		t.Fatal("Invalid signature was accepted")
+	}
+
+	// a challenge can only be used once
+	sig, err = data.SignAttestation(key, "dev1", challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = client.AttestVerify(nc, data.AttestRequest{DeviceID: "dev1",
+		Challenge: challenge, Signature: sig})
+	if err == nil {
+		t.Fatal("Challenge was used twice")
+	}
+
+	challenge, err = client.AttestChallenge(nc, "dev1")
+	if err != nil {
+		t.Fatal("Error getting challenge: ", err)
+	}
+
+	sig, err = data.SignAttestation(key, "dev1", challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	creds, err := client.AttestVerify(nc, data.AttestRequest{DeviceID: "dev1",
+		Challenge: challenge, Signature: sig})
+	if err != nil {
+		t.Fatal("Error verifying attestation: ", err)
+	}
+
+	if creds != "creds-dev1" {
+		t.Fatal("Got wrong credentials: ", creds)
+	}
+}
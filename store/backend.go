@@ -0,0 +1,106 @@
+package store
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// MemoryStoreFile can be used as the store file to keep all data in RAM
+const MemoryStoreFile = ":memory:"
+
+// backend is the node/edge/point storage used by the store. DbSqlite,
+// DbPostgres, and MemoryBackend implement this interface.
+type backend interface {
+	nodePoints(id string, points data.Points) error
+	edgePoints(nodeID, parentID string, points data.Points) error
+	batch(writes []pointWrite) error
+	node(id string) (*data.Node, error)
+	children(id, typ string, includeDel bool) ([]data.NodeEdge, error)
+	nodeEdge(id, parent string) ([]data.NodeEdge, error)
+	userCheck(email, password string) (data.Nodes, error)
+	up(id string, includeDeleted bool) ([]string, error)
+	historyInsert(retentionID string, points []historyPoint) error
+	historyRaw(retentionID string, before time.Time) ([]historyPoint, error)
+	historyDelete(retentionID string, raw bool, before time.Time) error
+	historyQuery(nodeID, typ, key string, start, end time.Time) ([]historyPoint, error)
+	historyBytes(retentionID string) (int64, error)
+	snapshot(history bool) (*snapshot, error)
+	restore(s *snapshot) error
+	repairEdges(deleteIDs []string, hashes map[string][]byte) error
+	purge(edgeIDs, nodeIDs []string) error
+	purgePoints(points []pointRef) error
+	rootNodeID() string
+	Close() error
+}
+
+// newBackend opens the backend for a store. If uri is set, it is used to pick
+// the backend (only postgres:// is currently supported). Otherwise a sqlite
+// db is opened, or a memory backend if file is MemoryStoreFile.
+func newBackend(file, uri string) (backend, error) {
+	if uri != "" {
+		if isPostgresURI(uri) {
+			return NewPostgresDb(uri)
+		}
+
+		return nil, fmt.Errorf("unsupported store URI: %v", uri)
+	}
+
+	if file == MemoryStoreFile {
+		return NewMemoryBackend()
+	}
+
+	return NewSqliteDb(file)
+}
+
+// initRoot creates the root node and default admin user and returns the
+// root node ID
+func initRoot(db backend) (string, error) {
+	log.Println("STORE: Initialize root node and admin user")
+	var rootNode data.NodeEdge
+	rootNode.Points = data.Points{
+		{
+			Time: time.Now(),
+			Type: data.PointTypeNodeType,
+			Text: data.NodeTypeDevice,
+		},
+	}
+
+	rootNode.ID = uuid.New().String()
+
+	err := db.nodePoints(rootNode.ID, rootNode.Points)
+	if err != nil {
+		return "", fmt.Errorf("Error setting root node points: %v", err)
+	}
+
+	err = db.edgePoints(rootNode.ID, "", data.Points{{Type: data.PointTypeTombstone, Value: 0}})
+	if err != nil {
+		return "", fmt.Errorf("Error sending root node edges: %w", err)
+	}
+
+	// create admin user off root node
+	admin := data.User{
+		ID:        uuid.New().String(),
+		FirstName: "admin",
+		LastName:  "user",
+		Email:     "admin@admin.com",
+		Pass:      "admin",
+	}
+
+	points := admin.ToPoints()
+
+	err = db.nodePoints(admin.ID, points)
+	if err != nil {
+		return "", fmt.Errorf("Error setting default user: %v", err)
+	}
+
+	err = db.edgePoints(admin.ID, rootNode.ID, data.Points{{Type: data.PointTypeTombstone, Value: 0}})
+	if err != nil {
+		return "", err
+	}
+
+	return rootNode.ID, nil
+}
@@ -0,0 +1,89 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// handleBackfill handles node.<id>.backfill messages (see
+// client.SendBackfill)
+func (st *Store) handleBackfill(msg *nats.Msg) {
+	chunks := strings.Split(msg.Subject, ".")
+	if len(chunks) < 3 {
+		st.reply(msg.Reply, errors.New("malformed backfill subject"))
+		return
+	}
+
+	points, err := client.DecodePoints(msg)
+	if err != nil {
+		st.reply(msg.Reply, fmt.Errorf("Error decoding backfill points: %w", err))
+		return
+	}
+
+	err = st.backfill(chunks[1], points)
+	if err != nil {
+		log.Println("Store backfill: ", err)
+	}
+
+	st.reply(msg.Reply, err)
+}
+
+// backfill publishes historical points of a node on
+// phrup.<upNodeID>.<nodeID> for each node above it, so they are recorded by
+// history clients the same way as high rate points. The points are not
+// written to the node, so current values are not changed, and they are not
+// published on up.* subjects where rules would process them.
+func (st *Store) backfill(nodeID string, points data.Points) error {
+	node, err := st.db.node(nodeID)
+	if err != nil {
+		return fmt.Errorf("Error getting node %v: %w", nodeID, err)
+	}
+
+	points = points.Calibrate(node.Points.Calibrations())
+
+	d, err := points.ToPb()
+	if err != nil {
+		return err
+	}
+
+	visited := make(map[string]bool)
+
+	var publish func(id string) error
+	publish = func(id string) error {
+		ups, err := st.db.up(id, false)
+		if err != nil {
+			return err
+		}
+
+		for _, up := range ups {
+			if up == "none" || visited[up] {
+				continue
+			}
+			visited[up] = true
+
+			msg := nats.NewMsg(client.SubjectNodeHRUpPoints(up, nodeID))
+			msg.Header.Set(client.HeaderBackfill, "true")
+			msg.Data = d
+
+			err := st.nc.PublishMsg(msg)
+			if err != nil {
+				return err
+			}
+
+			err = publish(up)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	return publish(nodeID)
+}
@@ -0,0 +1,91 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+func TestStoreBackfill(t *testing.T) {
+	nc, st, _ := startBatchTestStore(t, -1)
+
+	root := st.db.rootNodeID()
+
+	err := client.SendNodeType(nc, client.Variable{ID: "group", Parent: root}, "test")
+	if err != nil {
+		t.Fatal("Error sending node: ", err)
+	}
+
+	err = client.SendNodeType(nc, client.Variable{ID: "v", Parent: "group", Value: 5}, "test")
+	if err != nil {
+		t.Fatal("Error sending node: ", err)
+	}
+
+	msgs := make(chan *nats.Msg, 10)
+	sub, err := nc.ChanSubscribe("phrup.*.v", msgs)
+	if err != nil {
+		t.Fatal("Error subscribing: ", err)
+	}
+	defer sub.Unsubscribe()
+
+	past := time.Now().Add(-24 * time.Hour)
+	points := data.Points{
+		{Time: past, Type: data.PointTypeValue, Value: 1},
+		{Time: past.Add(time.Minute), Type: data.PointTypeValue, Value: 2},
+	}
+
+	err = client.SendBackfill(nc, "v", points)
+	if err != nil {
+		t.Fatal("Error sending backfill: ", err)
+	}
+
+	// backfill points are sent to each node above v
+	subjects := make(map[string]bool)
+	for i := 0; i < 2; i++ {
+		select {
+		case msg := <-msgs:
+			subjects[msg.Subject] = true
+			if msg.Header.Get(client.HeaderBackfill) == "" {
+				t.Error("Backfill header not set")
+			}
+
+			pts, err := client.DecodePoints(msg)
+			if err != nil {
+				t.Fatal("Error decoding points: ", err)
+			}
+
+			if len(pts) != 2 || !pts[0].Time.Equal(past) || pts[1].Value != 2 {
+				t.Error("Backfill points not correct: ", pts)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Timeout waiting for backfill points")
+		}
+	}
+
+	if !subjects["phrup.group.v"] || !subjects["phrup."+root+".v"] {
+		t.Error("Backfill subjects not correct: ", subjects)
+	}
+
+	// the current value is not changed
+	node, err := st.db.node("v")
+	if err != nil {
+		t.Fatal("Error getting node: ", err)
+	}
+
+	if v, _ := node.Points.Value(data.PointTypeValue, ""); v != 5 {
+		t.Error("Backfill changed current value: ", v)
+	}
+
+	err = client.SendBackfill(nc, "v", data.Points{{Type: data.PointTypeValue}})
+	if err == nil {
+		t.Error("Expected error for point without time")
+	}
+
+	err = client.SendBackfill(nc, "unknown", points)
+	if err == nil {
+		t.Error("Expected error for unknown node")
+	}
+}
@@ -0,0 +1,185 @@
+package store
+
+import (
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// DefaultBatchPeriod is how long point writes are collected before they are
+// committed in one transaction
+const DefaultBatchPeriod = 50 * time.Millisecond
+
+// batchMaxSize is the max number of writes in a batch. A batch is written
+// early when it is full.
+var batchMaxSize = 1000
+
+// pointWrite is a node or edge point write waiting to be batched
+type pointWrite struct {
+	nodeID string
+	// parentID is set for edge points
+	parentID string
+	edge     bool
+	points   data.Points
+	// tx is set for transactions. The writes in a transaction are written
+	// or fail together.
+	tx []pointWrite
+	// done is called with the result after the write is committed
+	done func(err error)
+}
+
+// flattenWrites replaces transactions with the writes they contain
+func flattenWrites(writes []pointWrite) []pointWrite {
+	var ret []pointWrite
+	for _, w := range writes {
+		if w.tx != nil {
+			ret = append(ret, w.tx...)
+		} else {
+			ret = append(ret, w)
+		}
+	}
+	return ret
+}
+
+// sqlTransaction runs f in a transaction, which is committed if f succeeds
+func sqlTransaction(db *sql.DB, f func(tx *sql.Tx) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	err = f(tx)
+	if err != nil {
+		rbErr := tx.Rollback()
+		if rbErr != nil {
+			log.Println("Rollback error: ", rbErr)
+		}
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// sqlBatch writes a batch of node and edge points in one transaction using
+// the backend's transaction write functions
+func sqlBatch(db *sql.DB, writes []pointWrite,
+	nodePoints func(tx *sql.Tx, id string, points data.Points) error,
+	edgePoints func(tx *sql.Tx, nodeID, parentID string, points data.Points) error) error {
+	return sqlTransaction(db, func(tx *sql.Tx) error {
+		for _, w := range writes {
+			var err error
+			if w.edge {
+				err = edgePoints(tx, w.nodeID, w.parentID, w.points)
+			} else {
+				err = nodePoints(tx, w.nodeID, w.points)
+			}
+
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// write queues a point write. If batching is disabled, the write is done
+// right away.
+func (st *Store) write(w pointWrite) {
+	if st.batchPeriod < 0 {
+		st.writeBatch([]pointWrite{w})
+		return
+	}
+
+	select {
+	case st.chBatch <- w:
+	case <-st.chBatchDone:
+		w.done(errStoreStopped)
+	}
+}
+
+// runBatcher collects point writes for batchPeriod and then writes them. It
+// exits after writing any pending writes when chBatchStop is closed.
+func (st *Store) runBatcher() {
+	defer close(st.chBatchDone)
+
+	var pending []pointWrite
+
+	timer := time.NewTimer(time.Hour)
+	timer.Stop()
+
+	flush := func() {
+		timer.Stop()
+		if len(pending) > 0 {
+			st.writeBatch(pending)
+			pending = nil
+		}
+	}
+
+	for {
+		select {
+		case w := <-st.chBatch:
+			pending = append(pending, w)
+			if len(pending) == 1 {
+				timer.Reset(st.batchPeriod)
+			}
+
+			if len(pending) >= batchMaxSize {
+				flush()
+			}
+		case <-timer.C:
+			flush()
+		case <-st.chBatchStop:
+			// write anything already queued
+			for {
+				select {
+				case w := <-st.chBatch:
+					pending = append(pending, w)
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// writeBatch writes points to the db and then calls the done function of each
+// write in order. If the batch fails, the writes are retried one at a time so
+// that one bad write does not fail the others. A transaction is retried as
+// one write.
+func (st *Store) writeBatch(writes []pointWrite) {
+	errs := make([]error, len(writes))
+
+	if !st.writeAllowed() {
+		for i := range errs {
+			errs[i] = ErrReadOnly
+		}
+	} else {
+		err := st.db.batch(flattenWrites(writes))
+		if err != nil && len(writes) > 1 {
+			log.Printf("Error writing batch of %v writes, retrying one at a time: %v\n",
+				len(writes), err)
+
+			err = nil
+			for i, w := range writes {
+				errs[i] = st.db.batch(flattenWrites([]pointWrite{w}))
+				if errs[i] != nil {
+					err = errs[i]
+				}
+			}
+		} else {
+			for i := range errs {
+				errs[i] = err
+			}
+		}
+
+		st.writeResult(err)
+	}
+
+	for i, w := range writes {
+		w.done(errs[i])
+	}
+}
@@ -0,0 +1,242 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	natsserver "github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// batchTestBackend counts batches and fails batches that write to the "bad"
+// node, or all batches if fail is set
+type batchTestBackend struct {
+	backend
+	lock    sync.Mutex
+	batches int
+	fail    error
+}
+
+func (b *batchTestBackend) batch(writes []pointWrite) error {
+	b.lock.Lock()
+	b.batches++
+	fail := b.fail
+	b.lock.Unlock()
+
+	if fail != nil {
+		return fail
+	}
+
+	for _, w := range writes {
+		if w.nodeID == "bad" {
+			return errors.New("bad node")
+		}
+	}
+
+	return b.backend.batch(writes)
+}
+
+func (b *batchTestBackend) setFail(err error) {
+	b.lock.Lock()
+	b.fail = err
+	b.lock.Unlock()
+}
+
+func (b *batchTestBackend) count() int {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.batches
+}
+
+func startBatchTestStore(t *testing.T, batchPeriod time.Duration) (*nats.Conn, *Store, *batchTestBackend) {
+	return startTestStoreParams(t, Params{BatchPeriod: batchPeriod})
+}
+
+// startTestStoreParams starts a memory store with p, File and Nc are set by
+// the function. JetStream is enabled in the NATS server if p.Stream is set.
+func startTestStoreParams(t *testing.T, p Params) (*nats.Conn, *Store, *batchTestBackend) {
+	nsOpts := &natsserver.Options{Port: -1, NoSigs: true}
+	if p.Stream != "" {
+		nsOpts.JetStream = true
+		nsOpts.StoreDir = t.TempDir()
+	}
+
+	ns, err := natsserver.NewServer(nsOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go ns.Start()
+	t.Cleanup(ns.Shutdown)
+
+	if !ns.ReadyForConnections(5 * time.Second) {
+		t.Fatal("NATS server not ready")
+	}
+
+	nc, err := nats.Connect(ns.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(nc.Close)
+
+	p.File = MemoryStoreFile
+	p.Nc = nc
+
+	st, err := NewStore(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := &batchTestBackend{backend: st.db}
+	st.db = db
+
+	stopped := make(chan struct{})
+	go func() {
+		st.Start()
+		close(stopped)
+	}()
+	t.Cleanup(func() {
+		st.Stop(nil)
+		<-stopped
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	err = st.WaitStart(ctx)
+	cancel()
+	if err != nil {
+		t.Fatal("Error waiting for store: ", err)
+	}
+
+	return nc, st, db
+}
+
+func TestStoreBatch(t *testing.T) {
+	nc, st, db := startBatchTestStore(t, 50*time.Millisecond)
+	rootID := st.db.rootNodeID()
+
+	err := client.SendNode(nc, data.NodeEdge{
+		ID:     "var",
+		Type:   data.NodeTypeVariable,
+		Parent: rootID,
+	}, "")
+	if err != nil {
+		t.Fatal("Error sending variable node: ", err)
+	}
+
+	start := db.count()
+
+	for i := 0; i < 200; i++ {
+		err := client.SendNodePoint(nc, "var", data.Point{
+			Type:  data.PointTypeValue,
+			Key:   fmt.Sprint(i),
+			Value: float64(i),
+		}, false)
+		if err != nil {
+			t.Fatal("Error sending point: ", err)
+		}
+	}
+
+	// the ack is sent after the point is committed
+	err = client.SendNodePoint(nc, "var", data.Point{Type: data.PointTypeDescription,
+		Text: "last"}, true)
+	if err != nil {
+		t.Fatal("Error sending point: ", err)
+	}
+
+	nodes, err := client.GetNode(nc, "var", "")
+	if err != nil || len(nodes) < 1 {
+		t.Fatal("Error getting node: ", err)
+	}
+
+	// 200 values and the description
+	if len(nodes[0].Points) != 201 {
+		t.Fatal("Not all points were written: ", len(nodes[0].Points))
+	}
+
+	batches := db.count() - start
+	if batches > 20 {
+		t.Error("Points were not batched, batches: ", batches)
+	}
+}
+
+func TestStoreBatchRetry(t *testing.T) {
+	nc, st, _ := startBatchTestStore(t, 200*time.Millisecond)
+
+	err := client.SendNode(nc, data.NodeEdge{
+		ID:     "good",
+		Type:   data.NodeTypeVariable,
+		Parent: st.db.rootNodeID(),
+	}, "")
+	if err != nil {
+		t.Fatal("Error sending variable node: ", err)
+	}
+
+	// both writes are in one batch, which fails because of the bad write
+	errs := make(chan error, 2)
+	for _, id := range []string{"bad", "good"} {
+		id := id
+		go func() {
+			errs <- client.SendNodePoint(nc, id, data.Point{Type: data.PointTypeValue,
+				Value: 1}, true)
+		}()
+	}
+
+	var failed, succeeded int
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != nil {
+			failed++
+		} else {
+			succeeded++
+		}
+	}
+
+	if failed != 1 || succeeded != 1 {
+		t.Fatalf("Expected one write to fail, failed: %v, succeeded: %v", failed, succeeded)
+	}
+}
+
+func TestDbSqliteBatch(t *testing.T) {
+	db := newTestDb(t)
+	defer db.Close()
+
+	testBackendBatch(t, db)
+}
+
+func TestMemoryBackendBatch(t *testing.T) {
+	testBackendBatch(t, newTestMemoryBackend(t))
+}
+
+// testBackendBatch checks that node and edge points in a batch are written
+func testBackendBatch(t *testing.T, db backend) {
+	rootID := db.rootNodeID()
+
+	err := db.batch([]pointWrite{
+		{nodeID: "var", points: data.Points{
+			{Type: data.PointTypeNodeType, Text: data.NodeTypeVariable}}},
+		{nodeID: "var", parentID: rootID, edge: true, points: data.Points{
+			{Type: data.PointTypeTombstone}}},
+		{nodeID: "var", points: data.Points{{Type: data.PointTypeValue, Value: 3}}},
+	})
+	if err != nil {
+		t.Fatal("Error writing batch: ", err)
+	}
+
+	children, err := db.children(rootID, data.NodeTypeVariable, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(children) != 1 {
+		t.Fatal("Batch not written: ", children)
+	}
+
+	v, _ := children[0].Points.Value(data.PointTypeValue, "")
+	if v != 3 {
+		t.Error("Wrong value: ", v)
+	}
+}
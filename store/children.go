@@ -0,0 +1,32 @@
+package store
+
+import "github.com/simpleiot/simpleiot/data"
+
+// removeArchived removes nodes with an archived point set from query
+// results
+func removeArchived(nodes []data.NodeEdge) []data.NodeEdge {
+	var ret []data.NodeEdge
+
+	for _, n := range nodes {
+		if n.Archived() {
+			continue
+		}
+
+		ret = append(ret, n)
+	}
+
+	return ret
+}
+
+// nodesWithRole returns the nodes whose edge has a role point set to role
+func nodesWithRole(nodes []data.NodeEdge, role string) []data.NodeEdge {
+	var ret []data.NodeEdge
+
+	for _, n := range nodes {
+		if n.Role() == role {
+			ret = append(ret, n)
+		}
+	}
+
+	return ret
+}
@@ -0,0 +1,189 @@
+package store
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// how often the command policy is read from the root node
+var commandPolicyCheckPeriod = time.Minute
+
+// used if the root node does not have a commandTimeout point
+var defaultCommandTimeout = 10 * time.Second
+
+// commandPolicy is read from the root device node. Node points with a type
+// in commandPointTypes (comma separated) are commands, and commands that are
+// not confirmed within commandTimeout seconds time out.
+type commandPolicy struct {
+	pointTypes map[string]bool
+	timeout    time.Duration
+}
+
+func (st *Store) commandPolicy() commandPolicy {
+	st.lock.Lock()
+	if time.Since(st.commandCheck) < commandPolicyCheckPeriod {
+		defer st.lock.Unlock()
+		return st.command
+	}
+	st.lock.Unlock()
+
+	policy := commandPolicy{
+		pointTypes: make(map[string]bool),
+		timeout:    defaultCommandTimeout,
+	}
+
+	root, err := st.db.node(st.db.rootNodeID())
+	if err != nil {
+		log.Println("Error getting command policy: ", err)
+	} else {
+		for _, p := range root.Points {
+			if p.Tombstone%2 == 1 {
+				continue
+			}
+
+			switch p.Type {
+			case data.PointTypeCommandPointTypes:
+				for _, t := range strings.Split(p.Text, ",") {
+					if t = strings.TrimSpace(t); t != "" {
+						policy.pointTypes[t] = true
+					}
+				}
+			case data.PointTypeCommandTimeout:
+				if p.Value > 0 {
+					policy.timeout = time.Duration(p.Value * float64(time.Second))
+				}
+			}
+		}
+	}
+
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	st.command = policy
+	st.commandCheck = time.Now()
+
+	return policy
+}
+
+// clearCommandPolicy is called when points are written to the root node so
+// that policy changes are used right away
+func (st *Store) clearCommandPolicy(points data.Points) {
+	for _, p := range points {
+		if p.Type == data.PointTypeCommandPointTypes ||
+			p.Type == data.PointTypeCommandTimeout {
+			st.lock.Lock()
+			st.commandCheck = time.Time{}
+			st.lock.Unlock()
+			return
+		}
+	}
+}
+
+// commands tracks the state of commands written to a node. A command is a
+// point with a command point type written by another node (a user, rule,
+// etc). Pending commandState points are added for each command, and a
+// timeout state is written if the client of the node does not confirm the
+// command in time. Confirmations (final commandState points and their
+// commandError) are dropped if the command is not pending so that clients
+// can confirm every write without tracking commands themselves.
+func (st *Store) commands(nodeID string, points data.Points) data.Points {
+	policy := st.commandPolicy()
+	if len(policy.pointTypes) <= 0 {
+		return points
+	}
+
+	var pending data.Points
+	dropKeys := make(map[string]bool)
+
+	for _, p := range points {
+		switch {
+		case policy.pointTypes[p.Type] && p.Origin != "" &&
+			p.Origin != nodeID && p.Tombstone == 0:
+			key := data.CommandKey(p)
+			ps := data.CommandStatePoints(key, data.PointValuePending, "")
+			// the client may confirm the command before the store sees it,
+			// so the pending state gets the time of the command
+			start := ps[0].Time
+			if !p.Time.IsZero() {
+				start = p.Time
+			}
+			for i := range ps {
+				ps[i].Origin = p.Origin
+				ps[i].Time = start
+			}
+			pending = append(pending, ps...)
+
+			st.lock.Lock()
+			st.pendingCommands[nodeID+"/"+key] = start
+			st.lock.Unlock()
+
+			time.AfterFunc(policy.timeout, func() {
+				st.commandTimeout(nodeID, key, start)
+			})
+
+		case p.Type == data.PointTypeCommandState && data.CommandDone(p.Text):
+			if !st.confirmCommand(nodeID, p.Key) {
+				dropKeys[p.Key] = true
+			}
+		}
+	}
+
+	if len(dropKeys) > 0 {
+		var ret data.Points
+		for _, p := range points {
+			if (p.Type == data.PointTypeCommandState ||
+				p.Type == data.PointTypeCommandError) && dropKeys[p.Key] {
+				continue
+			}
+			ret = append(ret, p)
+		}
+		points = ret
+	}
+
+	return append(points, pending...)
+}
+
+// confirmCommand returns true and stops tracking the command if it is
+// pending. Commands that were pending when the store was restarted are
+// found in the db.
+func (st *Store) confirmCommand(nodeID, key string) bool {
+	st.lock.Lock()
+	_, ok := st.pendingCommands[nodeID+"/"+key]
+	delete(st.pendingCommands, nodeID+"/"+key)
+	st.lock.Unlock()
+
+	if ok {
+		return true
+	}
+
+	node, err := st.db.node(nodeID)
+	if err != nil {
+		return false
+	}
+
+	state, _ := node.Points.Text(data.PointTypeCommandState, key)
+	return state == data.PointValuePending
+}
+
+// commandTimeout writes a timeout state if the command started at start is
+// still pending
+func (st *Store) commandTimeout(nodeID, key string, start time.Time) {
+	st.lock.Lock()
+	pendingStart, ok := st.pendingCommands[nodeID+"/"+key]
+	st.lock.Unlock()
+
+	if !ok || !pendingStart.Equal(start) {
+		// confirmed, or replaced by a newer command
+		return
+	}
+
+	err := client.SendNodePoints(st.nc, nodeID,
+		data.CommandStatePoints(key, data.PointValueTimeout,
+			"client did not confirm the command"), false)
+	if err != nil {
+		log.Println("Error sending command timeout: ", err)
+	}
+}
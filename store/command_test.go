@@ -0,0 +1,117 @@
+package store
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+func TestStoreCommands(t *testing.T) {
+	nc, st, _ := startBatchTestStore(t, -1)
+
+	root := st.db.rootNodeID()
+
+	err := client.SendNodePoints(nc, root, data.Points{
+		{Type: data.PointTypeCommandPointTypes, Text: data.PointTypeValueSet},
+		{Type: data.PointTypeCommandTimeout, Value: 0.2},
+	}, true)
+	if err != nil {
+		t.Fatal("Error sending command policy: ", err)
+	}
+
+	err = client.SendNodeType(nc, client.Variable{ID: "io", Parent: root}, "test")
+	if err != nil {
+		t.Fatal("Error sending node: ", err)
+	}
+
+	// fake client for the node that rejects negative setpoints
+	stopClient, err := client.SubscribePoints(nc, "io", func(points []data.Point) {
+		for _, p := range points {
+			if p.Type != data.PointTypeValueSet {
+				continue
+			}
+
+			var cmdErr error
+			if p.Value < 0 {
+				cmdErr = errors.New("out of range")
+			}
+
+			err := client.ConfirmCommand(nc, "io", p, cmdErr)
+			if err != nil {
+				t.Error("Error confirming command: ", err)
+			}
+		}
+	})
+	if err != nil {
+		t.Fatal("Error subscribing: ", err)
+	}
+
+	state := func() string {
+		t.Helper()
+		node, err := st.db.node("io")
+		if err != nil {
+			t.Fatal("Error getting node: ", err)
+		}
+		s, _ := node.Points.Text(data.PointTypeCommandState, data.PointTypeValueSet)
+		return s
+	}
+
+	command := func(v float64) error {
+		return client.SendCommand(nc, "io", data.Point{Time: time.Now(),
+			Type: data.PointTypeValueSet, Value: v, Origin: "user1"}, 2*time.Second)
+	}
+
+	err = command(5)
+	if err != nil {
+		t.Fatal("Command failed: ", err)
+	}
+
+	if s := state(); s != data.PointValueSuccess {
+		t.Fatal("Expected success state, got: ", s)
+	}
+
+	err = command(-1)
+	if err == nil || !strings.Contains(err.Error(), "out of range") {
+		t.Fatal("Expected command to fail, got: ", err)
+	}
+
+	if s := state(); s != data.PointValueFail {
+		t.Fatal("Expected fail state, got: ", s)
+	}
+
+	stopClient()
+
+	err = command(3)
+	if err != client.ErrCommandTimeout {
+		t.Fatal("Expected command timeout, got: ", err)
+	}
+
+	if s := state(); s != data.PointValueTimeout {
+		t.Fatal("Expected timeout state, got: ", s)
+	}
+
+	// confirmations of commands that are not pending are dropped
+	err = client.ConfirmCommand(nc, "io", data.Point{Type: data.PointTypeValueSet}, nil)
+	if err != nil {
+		t.Fatal("Error confirming command: ", err)
+	}
+
+	if s := state(); s != data.PointValueTimeout {
+		t.Fatal("Expected confirmation to be dropped, got: ", s)
+	}
+
+	// writes by the node itself are not commands
+	err = client.SendNodePoint(nc, "io", data.Point{Time: time.Now(),
+		Type: data.PointTypeValueSet, Value: 4}, true)
+	if err != nil {
+		t.Fatal("Error sending point: ", err)
+	}
+
+	if s := state(); s != data.PointValueTimeout {
+		t.Fatal("Expected no pending command, got: ", s)
+	}
+}
@@ -0,0 +1,209 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/data"
+	"github.com/simpleiot/simpleiot/internal/pb"
+	"google.golang.org/protobuf/proto"
+)
+
+// createWrites assigns new IDs to a tree of nodes to create under parent and
+// returns the created nodes (in the same order, without points) and the
+// transaction writes that create them. The IDs in nodes are only used to
+// reference parents: a node with a blank Parent (or parent) is created under
+// parent, otherwise its Parent must be the ID of another node in nodes.
+func createWrites(parent string, nodes []data.NodeEdge, now time.Time) (data.Nodes, []data.TxWrite, error) {
+	ids := make(map[string]string)
+	for _, n := range nodes {
+		if n.Type == "" {
+			return nil, nil, fmt.Errorf("Node %v does not have a type", n.ID)
+		}
+
+		if n.ID == "" {
+			continue
+		}
+
+		if _, ok := ids[n.ID]; ok {
+			return nil, nil, fmt.Errorf("Node %v is in the request more than once", n.ID)
+		}
+
+		ids[n.ID] = uuid.New().String()
+	}
+
+	// parent of each node in the request, blank for top level nodes
+	parents := make(map[string]string)
+	for _, n := range nodes {
+		if n.Parent == "" || n.Parent == parent {
+			continue
+		}
+
+		if _, ok := ids[n.Parent]; !ok {
+			return nil, nil, fmt.Errorf("Parent %v of node %v is not in the request",
+				n.Parent, n.ID)
+		}
+
+		parents[n.ID] = n.Parent
+	}
+
+	// make sure every node leads to a top level node
+	for id := range parents {
+		cur := id
+		for i := 0; parents[cur] != ""; i++ {
+			if i >= len(nodes) {
+				return nil, nil, fmt.Errorf("Node %v is its own ancestor", id)
+			}
+			cur = parents[cur]
+		}
+	}
+
+	stamp := func(points data.Points) data.Points {
+		ret := make(data.Points, len(points))
+		copy(ret, points)
+		for i := range ret {
+			if ret[i].Time.IsZero() {
+				ret[i].Time = now
+			}
+		}
+		return ret
+	}
+
+	created := make(data.Nodes, len(nodes))
+	var writes []data.TxWrite
+
+	for i, n := range nodes {
+		id := ids[n.ID]
+		if id == "" {
+			id = uuid.New().String()
+		}
+
+		up := parent
+		if p, ok := parents[n.ID]; ok {
+			up = ids[p]
+		}
+
+		created[i] = data.NodeEdge{ID: id, Type: n.Type, Parent: up}
+
+		edgePoints := stamp(n.EdgePoints)
+		if _, ok := edgePoints.Find(data.PointTypeTombstone, ""); !ok {
+			edgePoints = append(edgePoints, data.Point{Time: now,
+				Type: data.PointTypeTombstone, Value: 0})
+		}
+
+		points := stamp(n.Points)
+		points = append(points, data.Point{Time: now, Type: data.PointTypeNodeType,
+			Text: n.Type})
+
+		writes = append(writes,
+			data.TxWrite{NodeID: id, ParentID: up, Edge: true, Points: edgePoints},
+			data.TxWrite{NodeID: id, Points: points})
+	}
+
+	return created, writes, nil
+}
+
+// handleCreate creates a tree of nodes in one transaction and replies with
+// the created nodes and their new IDs (see client.SendNodes)
+func (st *Store) handleCreate(msg *nats.Msg) {
+	chunks := strings.Split(msg.Subject, ".")
+	if len(chunks) < 3 {
+		st.replyNodes(msg.Reply, nil, fmt.Errorf("Error in message subject: %v", msg.Subject))
+		return
+	}
+
+	parent := chunks[1]
+	if parent == "root" {
+		parent = st.db.rootNodeID()
+	}
+
+	_, err := st.db.node(parent)
+	if err != nil {
+		st.replyNodes(msg.Reply, nil, fmt.Errorf("Error getting parent %v: %w", parent, err))
+		return
+	}
+
+	nodes, err := data.PbDecodeNodes(msg.Data)
+	if err != nil {
+		st.replyNodes(msg.Reply, nil, errors.New("error decoding nodes"))
+		return
+	}
+
+	created, writes, err := createWrites(parent, nodes, time.Now())
+	if err != nil {
+		st.replyNodes(msg.Reply, nil, err)
+		return
+	}
+
+	writes, err = st.prepareWrites(writes, false)
+	if err != nil {
+		st.replyNodes(msg.Reply, nil, err)
+		return
+	}
+
+	if len(writes) <= 0 {
+		st.replyNodes(msg.Reply, created, nil)
+		return
+	}
+
+	tx := make([]pointWrite, len(writes))
+	for i, w := range writes {
+		tx[i] = pointWrite{
+			nodeID:   w.NodeID,
+			parentID: w.ParentID,
+			edge:     w.Edge,
+			points:   w.Points,
+		}
+	}
+
+	st.write(pointWrite{
+		tx: tx,
+		done: func(writeErr error) {
+			if writeErr != nil {
+				if writeErr != ErrReadOnly {
+					log.Printf("Error creating %v nodes: %v\n", len(created), writeErr)
+				}
+				st.replyNodes(msg.Reply, nil, writeErr)
+				return
+			}
+
+			st.publishTx(writes)
+			st.replyNodes(msg.Reply, created, nil)
+		},
+	})
+}
+
+// replyNodes sends nodes or an error in a pb.NodesRequest
+func (st *Store) replyNodes(subject string, nodes data.Nodes, err error) {
+	if subject == "" {
+		return
+	}
+
+	resp := &pb.NodesRequest{}
+	if err != nil {
+		resp.Error = err.Error()
+	} else {
+		resp.Nodes, err = nodes.ToPbNodes()
+		if err != nil {
+			resp.Error = fmt.Sprintf("Error pb encoding nodes: %v", err)
+		}
+	}
+
+	st.service.replied(subject, err)
+
+	d, err := proto.Marshal(resp)
+	if err != nil {
+		log.Println("Error encoding create response: ", err)
+		return
+	}
+
+	err = st.nc.Publish(subject, d)
+	if err != nil {
+		log.Println("Error sending create response: ", err)
+	}
+}
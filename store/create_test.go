@@ -0,0 +1,109 @@
+package store
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+func TestStoreCreate(t *testing.T) {
+	nc, st, db := startBatchTestStore(t, -1)
+	rootID := st.db.rootNodeID()
+
+	nodes := []data.NodeEdge{
+		{ID: "bus", Type: data.NodeTypeModbus, Points: data.Points{
+			{Type: data.PointTypeDescription, Text: "bus"}}},
+	}
+
+	for i := 0; i < 200; i++ {
+		nodes = append(nodes, data.NodeEdge{Type: data.NodeTypeModbusIO, Parent: "bus",
+			Points: data.Points{{Type: data.PointTypeAddress, Value: float64(i)}}})
+	}
+
+	start := db.count()
+
+	ids, err := client.SendNodes(nc, "root", nodes)
+	if err != nil {
+		t.Fatal("Error creating nodes: ", err)
+	}
+
+	if len(ids) != len(nodes) {
+		t.Fatal("Wrong number of IDs: ", len(ids))
+	}
+
+	if ids[0] == "bus" {
+		t.Error("ID was not assigned")
+	}
+
+	children, err := st.db.children(rootID, data.NodeTypeModbus, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(children) != 1 || children[0].ID != ids[0] {
+		t.Fatal("Top node not created: ", children)
+	}
+
+	children, err = st.db.children(ids[0], data.NodeTypeModbusIO, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(children) != 200 {
+		t.Fatal("Expected 200 children, got: ", len(children))
+	}
+
+	node, err := st.db.node(ids[100])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v, _ := node.Points.Value(data.PointTypeAddress, ""); v != 99 {
+		t.Error("Wrong address: ", v)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if db.count()-start != 1 {
+		t.Error("Expected 1 batch, got: ", db.count()-start)
+	}
+}
+
+func TestStoreCreateErrors(t *testing.T) {
+	nc, st, _ := startBatchTestStore(t, -1)
+	rootID := st.db.rootNodeID()
+
+	for _, tc := range []struct {
+		name   string
+		parent string
+		nodes  []data.NodeEdge
+	}{
+		{"no type", rootID, []data.NodeEdge{{ID: "a"}}},
+		{"parent not in request", rootID, []data.NodeEdge{
+			{ID: "a", Type: data.NodeTypeGroup, Parent: "x"}}},
+		{"loop", rootID, []data.NodeEdge{
+			{ID: "a", Type: data.NodeTypeGroup, Parent: "b"},
+			{ID: "b", Type: data.NodeTypeGroup, Parent: "a"}}},
+		{"duplicate ID", rootID, []data.NodeEdge{
+			{ID: "a", Type: data.NodeTypeGroup},
+			{ID: "a", Type: data.NodeTypeGroup}}},
+		{"parent does not exist", "missing", []data.NodeEdge{
+			{ID: "a", Type: data.NodeTypeGroup}}},
+	} {
+		_, err := client.SendNodes(nc, tc.parent, tc.nodes)
+		if err == nil {
+			t.Errorf("%v: expected error", tc.name)
+		}
+	}
+
+	children, err := st.db.children(rootID, data.NodeTypeGroup, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(children) != 0 {
+		t.Error("Nodes created by failed requests: ", fmt.Sprint(children))
+	}
+}
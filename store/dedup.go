@@ -0,0 +1,127 @@
+package store
+
+import (
+	"log"
+	"time"
+
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// how long the dedup policy read from the root node is cached. The cache is
+// also cleared when dedup points on the root node are written.
+var dedupPolicyCheckPeriod = time.Minute
+
+// dedupPolicy returns the dedup window for each node type. The policy is
+// set by dedupWindow points on the root device node, where the point key is
+// the node type and the value is the window in seconds. A point without a key
+// sets the default window (stored under "") for node types without their own
+// point.
+func (st *Store) dedupPolicy() map[string]time.Duration {
+	st.lock.Lock()
+	if time.Since(st.dedupCheck) < dedupPolicyCheckPeriod {
+		defer st.lock.Unlock()
+		return st.dedupWindows
+	}
+	st.lock.Unlock()
+
+	windows := make(map[string]time.Duration)
+
+	root, err := st.db.node(st.db.rootNodeID())
+	if err != nil {
+		log.Println("Error getting dedup policy: ", err)
+	} else {
+		for _, p := range root.Points {
+			if p.Type != data.PointTypeDedupWindow || p.Tombstone != 0 {
+				continue
+			}
+
+			key := p.Key
+			if key == "0" {
+				key = ""
+			}
+
+			// a window of 0 for a node type disables the default window
+			windows[key] = time.Duration(p.Value * float64(time.Second))
+		}
+	}
+
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	st.dedupWindows = windows
+	st.dedupCheck = time.Now()
+
+	return windows
+}
+
+// clearDedupPolicy is called when points are written to the root node so
+// that policy changes are used right away
+func (st *Store) clearDedupPolicy(points data.Points) {
+	for _, p := range points {
+		if p.Type == data.PointTypeDedupWindow {
+			st.lock.Lock()
+			st.dedupCheck = time.Time{}
+			st.lock.Unlock()
+			return
+		}
+	}
+}
+
+// dedup removes points that match the stored point with the same type and
+// key (value, text, and tombstone) and are less than the dedup window for
+// the node type newer than the stored point. Once the window has passed, the
+// next point is stored, so unchanged values are still recorded once per
+// window.
+func (st *Store) dedup(nodeID string, points data.Points) data.Points {
+	windows := st.dedupPolicy()
+	if len(windows) <= 0 {
+		return points
+	}
+
+	node, err := st.db.node(nodeID)
+	if err != nil {
+		// the node may not exist yet
+		return points
+	}
+
+	window, ok := windows[node.Type]
+	if !ok {
+		window = windows[""]
+	}
+
+	if window <= 0 {
+		return points
+	}
+
+	var ret data.Points
+
+	for _, p := range points {
+		if !isDuplicate(node.Points, p, window) {
+			ret = append(ret, p)
+		}
+	}
+
+	return ret
+}
+
+// isDuplicate returns true if p matches a point in stored within window
+func isDuplicate(stored data.Points, p data.Point, window time.Duration) bool {
+	for _, s := range stored {
+		if s.Type != p.Type || s.Key != p.Key {
+			continue
+		}
+
+		if s.Value != p.Value || s.Text != p.Text || s.Tombstone != p.Tombstone {
+			return false
+		}
+
+		t := p.Time
+		if t.IsZero() {
+			t = time.Now()
+		}
+
+		d := t.Sub(s.Time)
+		return d >= 0 && d < window
+	}
+
+	return false
+}
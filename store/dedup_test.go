@@ -0,0 +1,148 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+func TestIsDuplicate(t *testing.T) {
+	now := time.Now()
+	stored := data.Points{
+		{Time: now, Type: data.PointTypeValue, Value: 1},
+		{Time: now, Type: data.PointTypeDescription, Text: "sensor"},
+	}
+
+	window := 10 * time.Second
+
+	tests := []struct {
+		name string
+		p    data.Point
+		exp  bool
+	}{
+		{"same value", data.Point{Time: now.Add(time.Second), Type: data.PointTypeValue, Value: 1}, true},
+		{"changed value", data.Point{Time: now.Add(time.Second), Type: data.PointTypeValue, Value: 2}, false},
+		{"after window", data.Point{Time: now.Add(window), Type: data.PointTypeValue, Value: 1}, false},
+		{"older", data.Point{Time: now.Add(-time.Second), Type: data.PointTypeValue, Value: 1}, false},
+		{"same text", data.Point{Time: now.Add(time.Second), Type: data.PointTypeDescription, Text: "sensor"}, true},
+		{"changed text", data.Point{Time: now.Add(time.Second), Type: data.PointTypeDescription, Text: "tank"}, false},
+		{"other key", data.Point{Time: now.Add(time.Second), Type: data.PointTypeValue, Key: "1", Value: 1}, false},
+		{"deleted", data.Point{Time: now.Add(time.Second), Type: data.PointTypeValue, Value: 1, Tombstone: 1}, false},
+	}
+
+	for _, test := range tests {
+		if got := isDuplicate(stored, test.p, window); got != test.exp {
+			t.Errorf("%v: expected %v, got %v", test.name, test.exp, got)
+		}
+	}
+}
+
+func TestStoreDedup(t *testing.T) {
+	nc, st, db := startBatchTestStore(t, -1)
+
+	root := st.db.rootNodeID()
+
+	err := client.SendNodeType(nc, client.Variable{ID: "v", Parent: root}, "test")
+	if err != nil {
+		t.Fatal("Error sending node: ", err)
+	}
+
+	send := func(v float64) {
+		t.Helper()
+		err := client.SendNodePoint(nc, "v", data.Point{Time: time.Now(),
+			Type: data.PointTypeValue, Value: v}, true)
+		if err != nil {
+			t.Fatal("Error sending point: ", err)
+		}
+	}
+
+	// without a policy, all points are written
+	start := db.count()
+	send(1)
+	send(1)
+	if db.count()-start != 2 {
+		t.Fatal("Expected 2 writes, got: ", db.count()-start)
+	}
+
+	err = client.SendNodePoint(nc, root, data.Point{Type: data.PointTypeDedupWindow,
+		Key: data.NodeTypeVariable, Value: 60}, true)
+	if err != nil {
+		t.Fatal("Error sending dedup policy: ", err)
+	}
+
+	start = db.count()
+	send(1)
+	send(1)
+	send(2)
+	if db.count()-start != 1 {
+		t.Fatal("Expected only changed point to be written, got: ", db.count()-start)
+	}
+
+	node, err := st.db.node("v")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v, _ := node.Points.Value(data.PointTypeValue, ""); v != 2 {
+		t.Error("Changed value not stored: ", v)
+	}
+
+	// points in transactions are dropped the same way
+	start = db.count()
+	err = client.SendNodePointsTx(nc, []data.TxWrite{{NodeID: "v", Points: data.Points{
+		{Time: time.Now(), Type: data.PointTypeValue, Value: 2}}}})
+	if err != nil {
+		t.Fatal("Error sending transaction: ", err)
+	}
+
+	if db.count()-start != 0 {
+		t.Fatal("Unchanged transaction point was written")
+	}
+
+	err = client.SendNodePoint(nc, root, data.Point{Type: data.PointTypeDedupWindow,
+		Key: data.NodeTypeVariable, Value: 0}, true)
+	if err != nil {
+		t.Fatal("Error clearing dedup policy: ", err)
+	}
+
+	start = db.count()
+	send(2)
+	if db.count()-start != 1 {
+		t.Fatal("Point not written after policy cleared")
+	}
+
+	// the default window applies to node types without their own window
+	err = client.SendNodePoint(nc, root, data.Point{Type: data.PointTypeDedupWindow,
+		Key: data.NodeTypeVariable, Tombstone: 1}, true)
+	if err != nil {
+		t.Fatal("Error deleting dedup policy: ", err)
+	}
+
+	err = client.SendNodePoint(nc, root, data.Point{Type: data.PointTypeDedupWindow,
+		Value: 60}, true)
+	if err != nil {
+		t.Fatal("Error sending default dedup policy: ", err)
+	}
+
+	start = db.count()
+	send(2)
+	send(2)
+	if db.count()-start != 0 {
+		t.Fatal("Expected default window to drop unchanged points, got: ", db.count()-start)
+	}
+
+	// a window of 0 for a node type overrides the default
+	err = client.SendNodePoint(nc, root, data.Point{Type: data.PointTypeDedupWindow,
+		Key: data.NodeTypeVariable, Value: 0}, true)
+	if err != nil {
+		t.Fatal("Error sending dedup policy: ", err)
+	}
+
+	start = db.count()
+	send(2)
+	if db.count()-start != 1 {
+		t.Fatal("Point not written with dedup disabled for node type")
+	}
+}
@@ -1,5 +1,8 @@
 // Package store implements the SIOT data store and processes messages.
-// Currently data is stored in Genji and Influxdb.
+// Data is stored in SQLite, PostgreSQL (if a postgres:// URI is given), or in
+// memory if the store file is ":memory:".
 // Direct DB access is not provided and all write data goes through NATS,
 // thus making it easy to observe any data changes.
+// The store also runs the clients for retention nodes, which record point
+// history in the store db.
 package store
@@ -0,0 +1,88 @@
+package store
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// publishEncoded publishes points that were published on an up.* subject
+// JSON and/or CBOR encoded for clients that do not speak protobuf
+func (st *Store) publishEncoded(subject string, points data.Points) error {
+	if st.jsonPoints {
+		d, err := points.ToJSON()
+		if err != nil {
+			return err
+		}
+
+		msg := nats.NewMsg(client.SubjectPrefixJSON + subject)
+		msg.Header.Set(client.HeaderEncoding, client.EncodingJSON)
+		msg.Data = d
+
+		err = st.nc.PublishMsg(msg)
+		if err != nil {
+			return err
+		}
+	}
+
+	if st.cborPoints {
+		d, err := points.ToCBOR()
+		if err != nil {
+			return err
+		}
+
+		err = st.nc.Publish(client.SubjectPrefixCBOR+subject, d)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// handleEncodedPoints handles JSON or CBOR encoded points published on
+// json.node.* or cbor.node.* subjects. The points are republished protobuf
+// encoded on the node subject with the same reply subject, so they are
+// written like any other points and all node subscribers see them.
+func (st *Store) handleEncodedPoints(msg *nats.Msg) {
+	prefix, subject, _ := strings.Cut(msg.Subject, ".")
+
+	var points data.Points
+	var err error
+
+	switch prefix + "." {
+	case client.SubjectPrefixJSON:
+		err = points.FromJSON(msg.Data)
+	case client.SubjectPrefixCBOR:
+		err = points.FromCBOR(msg.Data)
+	default:
+		err = fmt.Errorf("unknown encoding %v", prefix)
+	}
+
+	if err != nil {
+		st.reply(msg.Reply, fmt.Errorf("error decoding %v points: %w", prefix, err))
+		return
+	}
+
+	now := time.Now()
+	for i := range points {
+		if points[i].Time.IsZero() {
+			points[i].Time = now
+		}
+	}
+
+	d, err := points.ToPb()
+	if err != nil {
+		st.reply(msg.Reply, fmt.Errorf("error encoding points: %w", err))
+		return
+	}
+
+	err = st.nc.PublishMsg(&nats.Msg{Subject: subject, Reply: msg.Reply, Data: d})
+	if err != nil {
+		st.reply(msg.Reply, err)
+	}
+}
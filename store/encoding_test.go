@@ -0,0 +1,124 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+func TestStoreJSONPoints(t *testing.T) {
+	nc, st, _ := startTestStoreParams(t, Params{BatchPeriod: -1, JSONPoints: true})
+
+	root := st.db.rootNodeID()
+
+	sub, err := nc.SubscribeSync("json.up.none.>")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := nats.NewMsg(client.SubjectNodePoints(root))
+	msg.Header.Set(client.HeaderEncoding, client.EncodingJSON)
+	msg.Data = []byte(`[{"type":"description","text":"from json"}]`)
+
+	resp, err := nc.RequestMsg(msg, time.Second)
+	if err != nil {
+		t.Fatal("Error sending JSON points: ", err)
+	}
+
+	if len(resp.Data) > 0 {
+		t.Fatal("Store returned error: ", string(resp.Data))
+	}
+
+	node, err := st.db.node(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if node.Desc() != "from json" {
+		t.Errorf("description not written, got %v", node.Desc())
+	}
+
+	up, err := sub.NextMsg(time.Second)
+	if err != nil {
+		t.Fatal("Did not get JSON points upstream: ", err)
+	}
+
+	if up.Subject != "json.up.none."+root+".points" {
+		t.Errorf("wrong subject: %v", up.Subject)
+	}
+
+	points, err := client.DecodePoints(up)
+	if err != nil {
+		t.Fatal("Error decoding JSON points: ", err)
+	}
+
+	p, ok := points.Find(data.PointTypeDescription, "")
+	if !ok || p.Text != "from json" || p.Time.IsZero() {
+		t.Errorf("JSON points not correct: %v", points)
+	}
+}
+
+func TestStoreCBORPoints(t *testing.T) {
+	nc, st, _ := startTestStoreParams(t, Params{BatchPeriod: -1, CBORPoints: true})
+
+	root := st.db.rootNodeID()
+
+	sub, err := nc.SubscribeSync(client.SubjectPrefixCBOR + "up.none.>")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := data.Points{{Type: data.PointTypeDescription, Text: "from cbor"}}.ToCBOR()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := nc.Request(client.SubjectPrefixCBOR+client.SubjectNodePoints(root),
+		d, time.Second)
+	if err != nil {
+		t.Fatal("Error sending CBOR points: ", err)
+	}
+
+	if len(resp.Data) > 0 {
+		t.Fatal("Store returned error: ", string(resp.Data))
+	}
+
+	node, err := st.db.node(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if node.Desc() != "from cbor" {
+		t.Errorf("description not written, got %v", node.Desc())
+	}
+
+	up, err := sub.NextMsg(time.Second)
+	if err != nil {
+		t.Fatal("Did not get CBOR points upstream: ", err)
+	}
+
+	var points data.Points
+	err = points.FromCBOR(up.Data)
+	if err != nil {
+		t.Fatal("Error decoding CBOR points: ", err)
+	}
+
+	p, ok := points.Find(data.PointTypeDescription, "")
+	if !ok || p.Text != "from cbor" || p.Time.IsZero() {
+		t.Errorf("CBOR points not correct: %v", points)
+	}
+
+	// invalid data is rejected
+	resp, err = nc.Request(client.SubjectPrefixCBOR+client.SubjectNodePoints(root),
+		[]byte{0xff}, time.Second)
+	if err != nil {
+		t.Fatal("Error sending CBOR points: ", err)
+	}
+
+	if len(resp.Data) == 0 {
+		t.Error("expected error for invalid CBOR")
+	}
+}
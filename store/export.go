@@ -0,0 +1,309 @@
+package store
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+	"gopkg.in/yaml.v2"
+)
+
+// Export writes a node and its descendants that are not deleted to w as
+// YAML. If id is "root" or empty, the root node is exported.
+func (st *Store) Export(id string, w io.Writer) error {
+	if id == "" || id == "root" {
+		id = st.db.rootNodeID()
+	}
+
+	nodes, err := st.db.nodeEdge(id, "")
+	if err != nil {
+		return fmt.Errorf("Error getting node %v: %w", id, err)
+	}
+
+	if len(nodes) < 1 {
+		return fmt.Errorf("Node %v not found", id)
+	}
+
+	n, err := st.exportNode(nodes[0], map[string]bool{})
+	if err != nil {
+		return err
+	}
+
+	// edge points of the top node describe its current parent, so are not
+	// exported
+	n.EdgePoints = nil
+
+	out, err := yaml.Marshal(data.Export{Nodes: []data.ExportNode{n}})
+	if err != nil {
+		return fmt.Errorf("Error encoding YAML: %w", err)
+	}
+
+	_, err = w.Write(out)
+	return err
+}
+
+// exportNode converts a node and its children to an export node. path
+// contains the IDs of the nodes above this one so that loops are not
+// followed.
+func (st *Store) exportNode(ne data.NodeEdge, path map[string]bool) (data.ExportNode, error) {
+	ret := data.ExportNode{
+		ID:         ne.ID,
+		Type:       ne.Type,
+		Points:     ne.Points.ToExport(),
+		EdgePoints: ne.EdgePoints.ToExport(),
+	}
+
+	path[ne.ID] = true
+	defer delete(path, ne.ID)
+
+	children, err := st.db.children(ne.ID, "", false)
+	if err != nil {
+		return ret, fmt.Errorf("Error getting children of %v: %w", ne.ID, err)
+	}
+
+	for _, c := range children {
+		if path[c.ID] {
+			continue
+		}
+
+		child, err := st.exportNode(c, path)
+		if err != nil {
+			return ret, err
+		}
+
+		ret.Children = append(ret.Children, child)
+	}
+
+	return ret, nil
+}
+
+// Import reads nodes from YAML (see Export) and creates them under parent.
+// If preserveIDs is set, the IDs in the YAML are used, and nodes that already
+// exist are updated. Otherwise new IDs are assigned, and point text that
+// matches the ID of an imported node is changed to the new ID so that
+// references between imported nodes still work. Nodes are sent over NATS so
+// clients are started for the new nodes. The IDs of the top level nodes are
+// returned.
+func (st *Store) Import(parent string, r io.Reader, preserveIDs bool, origin string) ([]string, error) {
+	if parent == "" || parent == "root" {
+		parent = st.db.rootNodeID()
+	}
+
+	if origin == "" {
+		// clients ignore points without an origin for their own node
+		origin = "import"
+	}
+
+	in, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var exp data.Export
+	err = yaml.UnmarshalStrict(in, &exp)
+	if err != nil {
+		return nil, fmt.Errorf("Error decoding YAML: %w", err)
+	}
+
+	ids := make(map[string]string)
+
+	// IDs of the parent and nodes above it, which can't be imported under
+	// it if IDs are preserved
+	above := make(map[string]bool)
+	if preserveIDs {
+		seen := make(map[string]bool)
+		check := []string{parent}
+		for len(check) > 0 {
+			id := check[0]
+			check = check[1:]
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+			above[id] = true
+
+			ups, err := st.db.up(id, true)
+			if err != nil {
+				return nil, fmt.Errorf("Error getting parents of %v: %w", id, err)
+			}
+			check = append(check, ups...)
+		}
+
+		above[st.db.rootNodeID()] = true
+	}
+
+	var assign func(nodes []data.ExportNode) error
+	assign = func(nodes []data.ExportNode) error {
+		for _, n := range nodes {
+			if n.Type == "" {
+				return fmt.Errorf("Node %v does not have a type", n.ID)
+			}
+
+			if preserveIDs && n.ID == "" {
+				return errors.New("Node IDs must be set to preserve IDs")
+			}
+
+			if above[n.ID] {
+				return fmt.Errorf("Node %v can't be imported under itself", n.ID)
+			}
+
+			newID := n.ID
+			if !preserveIDs {
+				newID = uuid.New().String()
+			}
+
+			if n.ID != "" {
+				if _, ok := ids[n.ID]; !ok {
+					ids[n.ID] = newID
+				}
+			}
+
+			err := assign(n.Children)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	err = assign(exp.Nodes)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+
+	// nodes that are in the YAML more than once (for example users in
+	// several groups) are only given one new ID
+	nodeID := func(n data.ExportNode) string {
+		if n.ID == "" {
+			return uuid.New().String()
+		}
+		return ids[n.ID]
+	}
+
+	toPoints := func(eps []data.ExportPoint) data.Points {
+		points := data.ExportToPoints(eps, now, origin)
+		if !preserveIDs {
+			for i, p := range points {
+				if id, ok := ids[p.Text]; ok {
+					points[i].Text = id
+				}
+			}
+		}
+		return points
+	}
+
+	var send func(n data.ExportNode, parent string) (string, error)
+	send = func(n data.ExportNode, parent string) (string, error) {
+		ne := data.NodeEdge{
+			ID:         nodeID(n),
+			Type:       n.Type,
+			Parent:     parent,
+			Points:     toPoints(n.Points),
+			EdgePoints: toPoints(n.EdgePoints),
+		}
+
+		if _, ok := ne.EdgePoints.Find(data.PointTypeTombstone, ""); !ok {
+			ne.EdgePoints = append(ne.EdgePoints, data.Point{Time: now,
+				Type: data.PointTypeTombstone, Value: 0, Origin: origin})
+		}
+
+		err := client.SendNode(st.nc, ne, origin)
+		if err != nil {
+			return "", fmt.Errorf("Error sending node %v: %w", ne.ID, err)
+		}
+
+		for _, c := range n.Children {
+			_, err := send(c, ne.ID)
+			if err != nil {
+				return "", err
+			}
+		}
+
+		return ne.ID, nil
+	}
+
+	var ret []string
+
+	for _, n := range exp.Nodes {
+		id, err := send(n, parent)
+		if err != nil {
+			return ret, err
+		}
+		ret = append(ret, id)
+	}
+
+	return ret, nil
+}
+
+// handleExport sends a YAML export of a node in chunks to the reply subject
+// (see client.ExportNodes)
+func (st *Store) handleExport(msg *nats.Msg) {
+	if msg.Reply == "" {
+		return
+	}
+
+	var req client.ExportRequest
+	err := json.Unmarshal(msg.Data, &req)
+	if err != nil {
+		st.reply(msg.Reply, fmt.Errorf("Error decoding export request: %w", err))
+		return
+	}
+
+	var buf bytes.Buffer
+	err = st.Export(req.ID, &buf)
+	if err != nil {
+		log.Println("Error exporting nodes: ", err)
+		st.reply(msg.Reply, err)
+		return
+	}
+
+	err = st.sendChunks(msg.Reply, &buf)
+	if err != nil {
+		log.Println("Error sending export: ", err)
+	}
+}
+
+// handleImport imports nodes from YAML and replies with a JSON encoded
+// client.ImportResponse (see client.ImportNodes)
+func (st *Store) handleImport(msg *nats.Msg) {
+	var resp client.ImportResponse
+
+	var req client.ImportRequest
+	err := json.Unmarshal(msg.Data, &req)
+	if err != nil {
+		resp.Error = fmt.Sprintf("Error decoding import request: %v", err)
+	} else {
+		resp.IDs, err = st.Import(req.Parent, bytes.NewReader(req.YAML),
+			req.PreserveIDs, req.Origin)
+		if err != nil {
+			log.Println("Error importing nodes: ", err)
+			resp.Error = err.Error()
+		}
+	}
+
+	if msg.Reply == "" {
+		return
+	}
+
+	d, err := json.Marshal(resp)
+	if err != nil {
+		log.Println("Error encoding import response: ", err)
+		return
+	}
+
+	err = st.nc.Publish(msg.Reply, d)
+	if err != nil {
+		log.Println("Error sending import response: ", err)
+	}
+}
@@ -0,0 +1,139 @@
+package store
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+	"gopkg.in/yaml.v2"
+)
+
+func TestStoreExportImport(t *testing.T) {
+	nc, st, _ := startBatchTestStore(t, 0)
+
+	root := st.db.rootNodeID()
+
+	nodes := []data.NodeEdge{
+		{ID: "g", Type: data.NodeTypeGroup, Parent: root, Points: data.Points{
+			{Type: data.PointTypeDescription, Text: "site"},
+		}},
+		{ID: "v", Type: data.NodeTypeVariable, Parent: "g", Points: data.Points{
+			{Type: data.PointTypeDescription, Text: "pump"},
+			{Type: data.PointTypeValue, Value: 2},
+		}},
+		// refers to v by ID
+		{ID: "l", Type: data.NodeTypeLighting, Parent: "g", Points: data.Points{
+			{Type: data.PointTypeOutputNodeID, Text: "v"},
+		}},
+		{ID: "del", Type: data.NodeTypeVariable, Parent: "g", EdgePoints: data.Points{
+			{Type: data.PointTypeTombstone, Value: 1},
+		}},
+	}
+
+	for _, n := range nodes {
+		err := client.SendNode(nc, n, "test")
+		if err != nil {
+			t.Fatal("Error sending node: ", err)
+		}
+	}
+
+	out, err := client.ExportNodes(nc, "g")
+	if err != nil {
+		t.Fatal("Error exporting: ", err)
+	}
+
+	var exp data.Export
+	err = yaml.Unmarshal(out, &exp)
+	if err != nil {
+		t.Fatal("Error decoding export: ", err)
+	}
+
+	if len(exp.Nodes) != 1 || exp.Nodes[0].ID != "g" || len(exp.Nodes[0].Children) != 2 {
+		t.Fatalf("Wrong export:\n%s", out)
+	}
+
+	// import a copy under the root node
+	ids, err := client.ImportNodes(nc, "", out, false, "test")
+	if err != nil {
+		t.Fatal("Error importing: ", err)
+	}
+
+	if len(ids) != 1 || ids[0] == "g" {
+		t.Fatal("Wrong imported IDs: ", ids)
+	}
+
+	children, err := st.db.children(ids[0], "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(children) != 2 {
+		t.Fatal("Expected 2 children: ", children)
+	}
+
+	var newV, outputNodeID string
+	for _, c := range children {
+		switch c.Type {
+		case data.NodeTypeVariable:
+			newV = c.ID
+			if v, _ := c.Points.Value(data.PointTypeValue, ""); v != 2 {
+				t.Error("Value not imported: ", c.Points)
+			}
+		case data.NodeTypeLighting:
+			outputNodeID, _ = c.Points.Text(data.PointTypeOutputNodeID, "")
+		}
+	}
+
+	if newV == "" || newV == "v" || outputNodeID != newV {
+		t.Errorf("Reference not updated, variable: %v, output node ID: %v", newV, outputNodeID)
+	}
+
+	// importing with IDs preserved updates the existing nodes
+	exp.Nodes[0].Points = []data.ExportPoint{{Type: data.PointTypeDescription, Text: "new site"}}
+	out, err = yaml.Marshal(exp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// make sure the timestamps are newer than the original points
+	time.Sleep(10 * time.Millisecond)
+
+	_, err = client.ImportNodes(nc, root, out, true, "test")
+	if err != nil {
+		t.Fatal("Error importing with IDs: ", err)
+	}
+
+	g, err := st.db.node("g")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if desc, _ := g.Points.Text(data.PointTypeDescription, ""); desc != "new site" {
+		t.Error("Node not updated: ", desc)
+	}
+
+	// a node can't be imported under itself
+	_, err = client.ImportNodes(nc, "v", out, true, "test")
+	if err == nil {
+		t.Error("Expected error importing g under its child")
+	}
+
+	// the decoder is strict so that typos in config files are caught
+	_, err = client.ImportNodes(nc, root, []byte("nodes:\n  - type: group\n    pionts: []\n"),
+		false, "test")
+	if err == nil {
+		t.Error("Expected error for unknown field")
+	}
+
+	var buf bytes.Buffer
+	err = st.Export("root", &buf)
+	if err != nil {
+		t.Fatal("Error exporting root: ", err)
+	}
+
+	if !bytes.Contains(buf.Bytes(), []byte("new site")) {
+		t.Errorf("Root export does not contain imported nodes:\n%s", buf.Bytes())
+	}
+}
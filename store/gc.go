@@ -0,0 +1,447 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// StoreSettings configures store maintenance. Deleted (tombstoned) nodes are
+// kept so that deletes can be synchronized and undone. If GcAge is set, edges
+// that have been deleted for more than GcAge days are purged every GcPeriod
+// hours (defaults to 24), along with the nodes in the deleted subtree that
+// have no other parents. If GcDryRun is set, the purge is only logged.
+// GcEdges and GcNodes are the number of edges and nodes purged (or that would
+// be purged) by the last run.
+//
+// KeyTypes is a comma separated list of point types used as keyed
+// collections, like the network
+// interfaces or USB devices a client enumerates. Points of these types that
+// have not been updated for KeyAge days are deleted, and if a node has more
+// than KeyLimit points of one of these types, the oldest are deleted. Deleted
+// points of these types are purged after GcAge days. GcKeys and GcPoints are
+// the number of points deleted and purged by the last run.
+type StoreSettings struct {
+	ID          string  `node:"id"`
+	Parent      string  `node:"parent"`
+	Description string  `point:"description"`
+	GcAge       float64 `point:"gcAge"`
+	GcPeriod    float64 `point:"gcPeriod"`
+	GcDryRun    bool    `point:"gcDryRun"`
+	KeyTypes    string  `point:"keyTypes"`
+	KeyAge      float64 `point:"keyAge"`
+	KeyLimit    int     `point:"keyLimit"`
+	Disable     bool    `point:"disable"`
+	GcEdges     int     `point:"gcEdges"`
+	GcNodes     int     `point:"gcNodes"`
+	GcKeys      int     `point:"gcKeys"`
+	GcPoints    int     `point:"gcPoints"`
+}
+
+// how often GC runs if no period is configured
+var gcDefaultPeriod = 24 * time.Hour
+
+// gcPlan returns the edges and nodes to purge from a snapshot. Edges
+// deleted before the cutoff are purged, and a node is purged when all of its
+// edges are purged, which also purges the edges to its children. Nodes that
+// are still reachable through another parent are kept, as is the root node.
+func gcPlan(s *snapshot, before time.Time) (edgeIDs, nodeIDs []string) {
+	edgesUp := make(map[string][]*data.Edge)
+	edgesDown := make(map[string][]*data.Edge)
+
+	for i := range s.Edges {
+		e := &s.Edges[i]
+		edgesUp[e.Up] = append(edgesUp[e.Up], e)
+		edgesDown[e.Down] = append(edgesDown[e.Down], e)
+	}
+
+	purgeEdges := make(map[string]bool)
+	purgeNodes := make(map[string]bool)
+
+	var check []string
+
+	for i := range s.Edges {
+		e := &s.Edges[i]
+		p, ok := e.Points.Find(data.PointTypeTombstone, "")
+		if !ok || p.Value == 0 || !p.Time.Before(before) {
+			continue
+		}
+
+		purgeEdges[e.ID] = true
+		edgeIDs = append(edgeIDs, e.ID)
+		check = append(check, e.Down)
+	}
+
+	for len(check) > 0 {
+		id := check[0]
+		check = check[1:]
+
+		if purgeNodes[id] || id == s.RootID {
+			continue
+		}
+
+		orphan := true
+		for _, e := range edgesDown[id] {
+			if !purgeEdges[e.ID] {
+				orphan = false
+				break
+			}
+		}
+
+		if !orphan {
+			continue
+		}
+
+		purgeNodes[id] = true
+		nodeIDs = append(nodeIDs, id)
+
+		for _, e := range edgesUp[id] {
+			if !purgeEdges[e.ID] {
+				purgeEdges[e.ID] = true
+				edgeIDs = append(edgeIDs, e.ID)
+			}
+			check = append(check, e.Down)
+		}
+	}
+
+	return edgeIDs, nodeIDs
+}
+
+// pointRef identifies a point of a node
+type pointRef struct {
+	nodeID string
+	typ    string
+	key    string
+}
+
+// keyPlan returns the points of types to delete and purge from a
+// snapshot. Points older than expire are deleted, as are the oldest points
+// of a node and type beyond limit. Points that were deleted before purge are
+// purged. Zero times and limits disable the matching rule.
+func keyPlan(s *snapshot, types map[string]bool, expire time.Time, limit int,
+	purge time.Time) (del map[string]data.Points, purged []pointRef) {
+	del = make(map[string]data.Points)
+
+	for _, n := range s.Nodes {
+		live := make(map[string]data.Points)
+
+		for _, p := range n.Points {
+			if !types[p.Type] {
+				continue
+			}
+
+			if p.Tombstone%2 == 1 {
+				if !purge.IsZero() && p.Time.Before(purge) {
+					purged = append(purged, pointRef{n.ID, p.Type, p.Key})
+				}
+				continue
+			}
+
+			if !expire.IsZero() && p.Time.Before(expire) {
+				del[n.ID] = append(del[n.ID], p)
+				continue
+			}
+
+			live[p.Type] = append(live[p.Type], p)
+		}
+
+		if limit <= 0 {
+			continue
+		}
+
+		for _, pts := range live {
+			if len(pts) <= limit {
+				continue
+			}
+
+			sort.SliceStable(pts, func(i, j int) bool {
+				return pts[i].Time.After(pts[j].Time)
+			})
+
+			del[n.ID] = append(del[n.ID], pts[limit:]...)
+		}
+	}
+
+	return del, purged
+}
+
+// gcClient purges deleted nodes for a StoreSettings node
+type gcClient struct {
+	nc            *nats.Conn
+	db            backend
+	config        StoreSettings
+	stop          chan struct{}
+	newPoints     chan client.NewPoints
+	newEdgePoints chan client.NewPoints
+}
+
+func newGcClient(nc *nats.Conn, db backend, config StoreSettings) client.Client {
+	return &gcClient{
+		nc:            nc,
+		db:            db,
+		config:        config,
+		stop:          make(chan struct{}),
+		newPoints:     make(chan client.NewPoints),
+		newEdgePoints: make(chan client.NewPoints),
+	}
+}
+
+// Start runs the main logic for this client and blocks until stopped
+func (g *gcClient) Start() error {
+	log.Println("Starting store settings client: ", g.config.Description)
+
+	ticker := time.NewTicker(g.period())
+	defer ticker.Stop()
+
+	g.run(time.Now())
+
+done:
+	for {
+		select {
+		case <-g.stop:
+			log.Println("Stopping store settings client: ", g.config.Description)
+			break done
+		case now := <-ticker.C:
+			g.run(now)
+		case pts := <-g.newPoints:
+			err := data.MergePoints(pts.ID, pts.Points, &g.config)
+			if err != nil {
+				log.Println("error merging new points: ", err)
+			}
+
+			for _, p := range pts.Points {
+				switch p.Type {
+				case data.PointTypeGcPeriod:
+					ticker.Reset(g.period())
+				case data.PointTypeGcAge, data.PointTypeGcDryRun, data.PointTypeDisable,
+					data.PointTypeKeyTypes, data.PointTypeKeyAge, data.PointTypeKeyLimit:
+					g.run(time.Now())
+				}
+			}
+		case pts := <-g.newEdgePoints:
+			err := data.MergeEdgePoints(pts.ID, pts.Parent, pts.Points, &g.config)
+			if err != nil {
+				log.Println("error merging new points: ", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (g *gcClient) period() time.Duration {
+	if g.config.GcPeriod <= 0 {
+		return gcDefaultPeriod
+	}
+	return time.Duration(g.config.GcPeriod * float64(time.Hour))
+}
+
+// run purges edges and nodes that have been deleted for more than the GC age,
+// and cleans up keyed points
+func (g *gcClient) run(now time.Time) {
+	keyTypes := g.keyTypes()
+
+	if g.config.Disable || (g.config.GcAge <= 0 && len(keyTypes) <= 0) {
+		return
+	}
+
+	s, err := g.db.snapshot(false)
+	if err != nil {
+		log.Println("Store GC: error reading store: ", err)
+		return
+	}
+
+	var results data.Points
+
+	if g.config.GcAge > 0 {
+		results = append(results, g.gcNodes(s, now)...)
+	}
+
+	if len(keyTypes) > 0 {
+		results = append(results, g.gcKeys(s, keyTypes, now)...)
+	}
+
+	if len(results) <= 0 {
+		return
+	}
+
+	err = client.SendNodePoints(g.nc, g.config.ID, results, false)
+	if err != nil {
+		log.Println("Store GC: error sending results: ", err)
+	}
+}
+
+// keyTypes returns the point types in KeyTypes
+func (g *gcClient) keyTypes() map[string]bool {
+	ret := make(map[string]bool)
+	for _, t := range strings.Split(g.config.KeyTypes, ",") {
+		t = strings.TrimSpace(t)
+		if t != "" {
+			ret[t] = true
+		}
+	}
+	return ret
+}
+
+// gcBefore returns the time before which deleted nodes and points are purged
+func (g *gcClient) gcBefore(now time.Time) time.Time {
+	return now.Add(-time.Duration(g.config.GcAge * float64(24*time.Hour)))
+}
+
+// gcNodes purges deleted edges and nodes and returns the result points
+func (g *gcClient) gcNodes(s *snapshot, now time.Time) data.Points {
+	edgeIDs, nodeIDs := gcPlan(s, g.gcBefore(now))
+
+	if g.config.GcDryRun {
+		if len(edgeIDs) > 0 {
+			log.Printf("Store GC dry run: would purge %v edges and %v nodes: %v\n",
+				len(edgeIDs), len(nodeIDs), nodeIDs)
+		}
+	} else if len(edgeIDs) > 0 {
+		err := g.db.purge(edgeIDs, nodeIDs)
+		if err != nil {
+			log.Println("Store GC: error purging deleted nodes: ", err)
+			return nil
+		}
+
+		log.Printf("Store GC: purged %v edges and %v nodes\n", len(edgeIDs), len(nodeIDs))
+	}
+
+	g.config.GcEdges = len(edgeIDs)
+	g.config.GcNodes = len(nodeIDs)
+
+	return data.Points{
+		{Time: now, Type: data.PointTypeGcEdges, Value: float64(len(edgeIDs))},
+		{Time: now, Type: data.PointTypeGcNodes, Value: float64(len(nodeIDs))},
+	}
+}
+
+// gcKeys deletes expired keyed points and the oldest keyed points beyond the
+// limit, purges old deleted keyed points, and returns the result points.
+// Points are deleted by sending tombstones, so the deletes are synchronized
+// and clients see them.
+func (g *gcClient) gcKeys(s *snapshot, types map[string]bool, now time.Time) data.Points {
+	var expire, purge time.Time
+	if g.config.KeyAge > 0 {
+		expire = now.Add(-time.Duration(g.config.KeyAge * float64(24*time.Hour)))
+	}
+	if g.config.GcAge > 0 {
+		purge = g.gcBefore(now)
+	}
+
+	del, purged := keyPlan(s, types, expire, g.config.KeyLimit, purge)
+
+	count := 0
+	for _, pts := range del {
+		count += len(pts)
+	}
+
+	if g.config.GcDryRun {
+		if count > 0 || len(purged) > 0 {
+			log.Printf("Store GC dry run: would delete %v and purge %v keyed points\n",
+				count, len(purged))
+		}
+	} else {
+		for nodeID, pts := range del {
+			tombstones := make(data.Points, len(pts))
+			for i, p := range pts {
+				tombstones[i] = data.Point{Time: now, Type: p.Type, Key: p.Key,
+					Tombstone: 1}
+			}
+
+			err := client.SendNodePoints(g.nc, nodeID, tombstones, true)
+			if err != nil {
+				log.Println("Store GC: error deleting keyed points: ", err)
+				return nil
+			}
+		}
+
+		if len(purged) > 0 {
+			err := g.db.purgePoints(purged)
+			if err != nil {
+				log.Println("Store GC: error purging keyed points: ", err)
+				return nil
+			}
+		}
+
+		if count > 0 || len(purged) > 0 {
+			log.Printf("Store GC: deleted %v and purged %v keyed points\n",
+				count, len(purged))
+		}
+	}
+
+	g.config.GcKeys = count
+	g.config.GcPoints = len(purged)
+
+	return data.Points{
+		{Time: now, Type: data.PointTypeGcKeys, Value: float64(count)},
+		{Time: now, Type: data.PointTypeGcPoints, Value: float64(len(purged))},
+	}
+}
+
+// Stop sends a signal to the Start function to exit
+func (g *gcClient) Stop(err error) {
+	close(g.stop)
+}
+
+// Points is called by the Manager when new points for this
+// node are received.
+func (g *gcClient) Points(nodeID string, points []data.Point) {
+	g.newPoints <- client.NewPoints{ID: nodeID, Points: points}
+}
+
+// EdgePoints is called by the Manager when new edge points for this
+// node are received.
+func (g *gcClient) EdgePoints(nodeID, parentID string, points []data.Point) {
+	g.newEdgePoints <- client.NewPoints{ID: nodeID, Parent: parentID, Points: points}
+}
+
+// sqlPurge deletes edges, their points, and node points in one transaction.
+// It is shared by the sqlite and postgres backends.
+func sqlPurge(db *sql.DB, rebind func(string) string, edgeIDs, nodeIDs []string) error {
+	return sqlTransaction(db, func(tx *sql.Tx) error {
+		for _, id := range edgeIDs {
+			_, err := tx.Exec(rebind("DELETE FROM edge_points WHERE edge_id=?"), id)
+			if err != nil {
+				return fmt.Errorf("Error deleting edge points: %w", err)
+			}
+
+			_, err = tx.Exec(rebind("DELETE FROM edges WHERE id=?"), id)
+			if err != nil {
+				return fmt.Errorf("Error deleting edge: %w", err)
+			}
+		}
+
+		for _, id := range nodeIDs {
+			_, err := tx.Exec(rebind("DELETE FROM node_points WHERE node_id=?"), id)
+			if err != nil {
+				return fmt.Errorf("Error deleting node points: %w", err)
+			}
+		}
+
+		return nil
+	})
+}
+
+// sqlPurgePoints deletes node points in one transaction. It is shared by the
+// sqlite and postgres backends.
+func sqlPurgePoints(db *sql.DB, rebind func(string) string, points []pointRef) error {
+	return sqlTransaction(db, func(tx *sql.Tx) error {
+		for _, p := range points {
+			_, err := tx.Exec(rebind("DELETE FROM node_points WHERE node_id=? AND type=? AND key=?"),
+				p.nodeID, p.typ, p.key)
+			if err != nil {
+				return fmt.Errorf("Error deleting node point: %w", err)
+			}
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,374 @@
+package store
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+func TestGcPlan(t *testing.T) {
+	now := time.Now()
+	old := now.Add(-48 * time.Hour)
+
+	edge := func(id, up, down string, deleted bool, ts time.Time) data.Edge {
+		return data.Edge{ID: id, Up: up, Down: down, Points: data.Points{
+			{Type: data.PointTypeTombstone, Value: data.BoolToFloat(deleted), Time: ts}}}
+	}
+
+	s := &snapshot{
+		RootID: "root",
+		Edges: []data.Edge{
+			edge("e-root", "none", "root", false, old),
+			// a deleted subtree
+			edge("e-a", "root", "a", true, old),
+			edge("e-b", "a", "b", false, old),
+			edge("e-c", "b", "c", false, old),
+			// d is also a child of the root, so it is kept
+			edge("e-ad", "a", "d", false, old),
+			edge("e-d", "root", "d", false, old),
+			// deleted recently
+			edge("e-x", "root", "x", true, now),
+			// deleted from one parent, but still has another
+			edge("e-y1", "root", "y", true, old),
+			edge("e-y2", "x", "y", false, old),
+		},
+	}
+
+	edgeIDs, nodeIDs := gcPlan(s, now.Add(-24*time.Hour))
+
+	sort.Strings(edgeIDs)
+	sort.Strings(nodeIDs)
+
+	if fmt.Sprint(edgeIDs) != "[e-a e-ad e-b e-c e-y1]" {
+		t.Error("Wrong edges purged: ", edgeIDs)
+	}
+
+	if fmt.Sprint(nodeIDs) != "[a b c]" {
+		t.Error("Wrong nodes purged: ", nodeIDs)
+	}
+}
+
+func TestStoreGc(t *testing.T) {
+	nc, st, _ := startBatchTestStore(t, -1)
+	rootID := st.db.rootNodeID()
+
+	for _, n := range []data.NodeEdge{
+		{ID: "group", Type: data.NodeTypeGroup, Parent: rootID},
+		{ID: "var", Type: data.NodeTypeVariable, Parent: "group"},
+	} {
+		err := client.SendNode(nc, n, "")
+		if err != nil {
+			t.Fatal("Error sending node: ", err)
+		}
+	}
+
+	err := client.SendEdgePoint(nc, "group", rootID, data.Point{
+		Time: time.Now().Add(-48 * time.Hour), Type: data.PointTypeTombstone,
+		Value: 1}, true)
+	if err != nil {
+		t.Fatal("Error deleting node: ", err)
+	}
+
+	err = client.SendNodeType(nc, StoreSettings{
+		ID:       "settings",
+		Parent:   rootID,
+		GcAge:    1,
+		GcDryRun: true,
+	}, "test")
+	if err != nil {
+		t.Fatal("Error sending store settings: ", err)
+	}
+
+	waitGc := func(nodes float64) {
+		t.Helper()
+		timeout := time.After(5 * time.Second)
+		for {
+			n, err := st.db.node("settings")
+			if err == nil {
+				if v, ok := n.Points.Value(data.PointTypeGcNodes, ""); ok && v == nodes {
+					return
+				}
+			}
+
+			select {
+			case <-timeout:
+				t.Fatal("Timeout waiting for GC")
+			case <-time.After(50 * time.Millisecond):
+			}
+		}
+	}
+
+	waitGc(2)
+
+	// a dry run does not purge anything
+	if _, err := st.db.node("var"); err != nil {
+		t.Fatal("Dry run purged node: ", err)
+	}
+
+	err = client.SendNodePoint(nc, "settings", data.Point{Type: data.PointTypeGcDryRun,
+		Value: 0, Origin: "test"}, true)
+	if err != nil {
+		t.Fatal("Error sending point: ", err)
+	}
+
+	timeout := time.After(5 * time.Second)
+	for {
+		_, errGroup := st.db.node("group")
+		_, errVar := st.db.node("var")
+		if errGroup != nil && errVar != nil {
+			break
+		}
+
+		select {
+		case <-timeout:
+			t.Fatal("Timeout waiting for nodes to be purged")
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+
+	children, err := st.db.children(rootID, "", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range children {
+		if c.ID == "group" {
+			t.Fatal("Edge to purged node still exists")
+		}
+	}
+
+	// the next run finds nothing to purge
+	err = client.SendNodePoint(nc, "settings", data.Point{Type: data.PointTypeGcAge,
+		Value: 2, Origin: "test"}, true)
+	if err != nil {
+		t.Fatal("Error sending point: ", err)
+	}
+
+	waitGc(0)
+}
+
+func TestDbSqlitePurge(t *testing.T) {
+	db := newTestDb(t)
+	defer db.Close()
+
+	testBackendPurge(t, db)
+}
+
+func TestMemoryBackendPurge(t *testing.T) {
+	testBackendPurge(t, newTestMemoryBackend(t))
+}
+
+func testBackendPurge(t *testing.T, db backend) {
+	rootID := db.rootNodeID()
+
+	err := db.nodePoints("var", data.Points{{Type: data.PointTypeNodeType,
+		Text: data.NodeTypeVariable}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.edgePoints("var", rootID, data.Points{{Type: data.PointTypeTombstone, Value: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := db.snapshot(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	edgeIDs, nodeIDs := gcPlan(s, time.Now().Add(time.Second))
+	if len(edgeIDs) != 1 || len(nodeIDs) != 1 || nodeIDs[0] != "var" {
+		t.Fatal("Wrong purge plan: ", edgeIDs, nodeIDs)
+	}
+
+	err = db.purge(edgeIDs, nodeIDs)
+	if err != nil {
+		t.Fatal("Error purging: ", err)
+	}
+
+	if _, err := db.node("var"); err == nil {
+		t.Fatal("Node not purged")
+	}
+
+	children, err := db.children(rootID, "", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range children {
+		if c.ID == "var" {
+			t.Fatal("Edge not purged")
+		}
+	}
+}
+
+func TestKeyPlan(t *testing.T) {
+	now := time.Now()
+	day := 24 * time.Hour
+
+	iface := func(key string, age time.Duration, tombstone int) data.Point {
+		return data.Point{Type: "iface", Key: key, Time: now.Add(-age),
+			Tombstone: tombstone}
+	}
+
+	s := &snapshot{
+		Nodes: []snapshotNode{
+			{ID: "a", Points: data.Points{
+				{Type: data.PointTypeDescription, Text: "a", Time: now.Add(-10 * day)},
+				iface("eth0", time.Hour, 0),
+				iface("eth1", 3*time.Hour, 0),
+				iface("eth2", 2*time.Hour, 0),
+				iface("usb0", 10*day, 0),
+				iface("usb1", 10*day, 1),
+				iface("usb2", time.Hour, 1),
+			}},
+			{ID: "b", Points: data.Points{
+				iface("eth0", 10*day, 0),
+			}},
+		},
+	}
+
+	del, purged := keyPlan(s, map[string]bool{"iface": true}, now.Add(-7*day), 2,
+		now.Add(-7*day))
+
+	keys := func(pts data.Points) string {
+		var ret []string
+		for _, p := range pts {
+			ret = append(ret, p.Key)
+		}
+		sort.Strings(ret)
+		return fmt.Sprint(ret)
+	}
+
+	if len(del) != 2 || keys(del["a"]) != "[eth1 usb0]" || keys(del["b"]) != "[eth0]" {
+		t.Error("Wrong points deleted: ", del)
+	}
+
+	if len(purged) != 1 || purged[0] != (pointRef{"a", "iface", "usb1"}) {
+		t.Error("Wrong points purged: ", purged)
+	}
+
+	// no rules
+	del, purged = keyPlan(s, map[string]bool{"iface": true}, time.Time{}, 0, time.Time{})
+	if len(del) != 0 || len(purged) != 0 {
+		t.Error("Expected no changes: ", del, purged)
+	}
+}
+
+func TestStoreGcKeys(t *testing.T) {
+	nc, st, _ := startBatchTestStore(t, -1)
+	rootID := st.db.rootNodeID()
+
+	err := client.SendNode(nc, data.NodeEdge{ID: "dev", Type: data.NodeTypeVariable,
+		Parent: rootID}, "")
+	if err != nil {
+		t.Fatal("Error sending node: ", err)
+	}
+
+	now := time.Now()
+
+	err = client.SendNodePoints(nc, "dev", data.Points{
+		{Type: "iface", Key: "eth0", Time: now, Value: 1},
+		{Type: "iface", Key: "eth1", Time: now.Add(-time.Hour), Value: 1},
+		{Type: "iface", Key: "eth2", Time: now.Add(-2 * time.Hour), Value: 1},
+		{Type: "iface", Key: "usb0", Time: now.Add(-48 * time.Hour), Value: 1},
+		{Type: "iface", Key: "usb1", Time: now.Add(-48 * time.Hour), Tombstone: 1},
+	}, true)
+	if err != nil {
+		t.Fatal("Error sending points: ", err)
+	}
+
+	err = client.SendNodeType(nc, StoreSettings{
+		ID:       "settings",
+		Parent:   rootID,
+		GcAge:    1,
+		KeyTypes: "iface",
+		KeyAge:   1,
+		KeyLimit: 2,
+	}, "test")
+	if err != nil {
+		t.Fatal("Error sending store settings: ", err)
+	}
+
+	timeout := time.After(5 * time.Second)
+	for {
+		n, err := st.db.node("settings")
+		if err == nil {
+			keys, _ := n.Points.Value(data.PointTypeGcKeys, "")
+			points, _ := n.Points.Value(data.PointTypeGcPoints, "")
+			if keys == 2 && points == 1 {
+				break
+			}
+		}
+
+		select {
+		case <-timeout:
+			t.Fatal("Timeout waiting for GC")
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+
+	n, err := st.db.node("dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, exp := range []struct {
+		key     string
+		deleted bool
+	}{{"eth0", false}, {"eth1", false}, {"eth2", true}, {"usb0", true}} {
+		p, ok := n.Points.Find("iface", exp.key)
+		if !ok || (p.Tombstone%2 == 1) != exp.deleted {
+			t.Errorf("Point %v: expected deleted %v, got %v", exp.key, exp.deleted, p)
+		}
+	}
+
+	if _, ok := n.Points.Find("iface", "usb1"); ok {
+		t.Error("Deleted point not purged")
+	}
+}
+
+func TestDbSqlitePurgePoints(t *testing.T) {
+	db := newTestDb(t)
+	defer db.Close()
+
+	testBackendPurgePoints(t, db)
+}
+
+func TestMemoryBackendPurgePoints(t *testing.T) {
+	testBackendPurgePoints(t, newTestMemoryBackend(t))
+}
+
+func testBackendPurgePoints(t *testing.T, db backend) {
+	err := db.nodePoints("var", data.Points{
+		{Type: data.PointTypeNodeType, Text: data.NodeTypeVariable},
+		{Type: "iface", Key: "eth0", Value: 1},
+		{Type: "iface", Key: "eth1", Tombstone: 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.purgePoints([]pointRef{{"var", "iface", "eth1"}})
+	if err != nil {
+		t.Fatal("Error purging points: ", err)
+	}
+
+	n, err := db.node("var")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := n.Points.Find("iface", "eth0"); !ok {
+		t.Error("Point purged that should be kept")
+	}
+
+	if _, ok := n.Points.Find("iface", "eth1"); ok {
+		t.Error("Point not purged")
+	}
+}
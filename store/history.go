@@ -0,0 +1,143 @@
+package store
+
+import (
+	"log"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// how long the result of the external history db check is cached
+var externalHistoryCheckPeriod = time.Minute
+
+// handleHistory answers history.<nodeId> requests from the point history
+// recorded by retention nodes. There is one history backend: if an external
+// history db (Influx db client) is configured, all requests are left for
+// that client to answer, otherwise the store answers.
+func (st *Store) handleHistory(msg *nats.Msg) {
+	if st.hasExternalHistory() {
+		return
+	}
+
+	nodeID, q, err := client.DecodeHistoryMsg(msg)
+	if err != nil {
+		st.respondHistory(msg, nodeID, nil, err)
+		return
+	}
+
+	hps, err := st.db.historyQuery(nodeID, q.Type, q.Key, q.Start, q.End)
+	if err != nil {
+		st.respondHistory(msg, nodeID, nil, err)
+		return
+	}
+
+	points, err := q.Apply(historyToPoints(hps, q.Aggregate))
+	st.respondHistory(msg, nodeID, points, err)
+}
+
+func (st *Store) respondHistory(msg *nats.Msg, nodeID string, points data.Points, err error) {
+	err = client.RespondHistory(msg, nodeID, points, err)
+	if err != nil {
+		log.Println("Error responding to history request: ", err)
+	}
+}
+
+// historyToPoints converts history points to data points. Downsampled points
+// are returned at the start of their interval with the min or max value if
+// that is the requested aggregate, otherwise with the average. The same point
+// recorded by more than one retention node is only returned once.
+func historyToPoints(hps []historyPoint, aggregate string) data.Points {
+	type pointKey struct {
+		typ, key string
+		time     time.Time
+		interval time.Duration
+	}
+
+	seen := make(map[pointKey]bool)
+	ret := make(data.Points, 0, len(hps))
+
+	for _, hp := range hps {
+		k := pointKey{hp.Type, hp.Key, hp.Time, hp.Interval}
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+
+		p := data.Point{
+			Type:  hp.Type,
+			Key:   hp.Key,
+			Time:  hp.Time,
+			Value: hp.Value,
+			Text:  hp.Text,
+		}
+
+		if hp.Interval > 0 {
+			switch aggregate {
+			case data.AggregateMin:
+				p.Value = hp.Min
+			case data.AggregateMax:
+				p.Value = hp.Max
+			}
+		}
+
+		ret = append(ret, p)
+	}
+
+	return ret
+}
+
+// clearExternalHistory causes the external history db check to run on the
+// next history request. It is called when edges change, so the history
+// backend changes as soon as a db node is added or deleted.
+func (st *Store) clearExternalHistory() {
+	st.lock.Lock()
+	st.externalHistoryCheck = time.Time{}
+	st.lock.Unlock()
+}
+
+// hasExternalHistory returns true if there is a db node anywhere in the
+// tree. The result is cached for externalHistoryCheckPeriod.
+func (st *Store) hasExternalHistory() bool {
+	st.lock.Lock()
+	if time.Since(st.externalHistoryCheck) < externalHistoryCheckPeriod {
+		defer st.lock.Unlock()
+		return st.externalHistory
+	}
+	st.lock.Unlock()
+
+	found := false
+	visited := make(map[string]bool)
+
+	var walk func(id string)
+	walk = func(id string) {
+		if found || visited[id] {
+			return
+		}
+		visited[id] = true
+
+		children, err := st.db.children(id, "", false)
+		if err != nil {
+			log.Println("Error checking for history db: ", err)
+			return
+		}
+
+		for _, c := range children {
+			if c.Type == data.NodeTypeDb {
+				found = true
+				return
+			}
+			walk(c.ID)
+		}
+	}
+
+	walk(st.db.rootNodeID())
+
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	st.externalHistory = found
+	st.externalHistoryCheck = time.Now()
+
+	return found
+}
@@ -0,0 +1,180 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	natsserver "github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+func TestHistoryToPoints(t *testing.T) {
+	now := time.Now()
+
+	hps := []historyPoint{
+		{NodeID: "n", Type: data.PointTypeValue, Time: now.Add(-2 * time.Hour),
+			Interval: time.Hour, Value: 3, Min: 1, Max: 5, Count: 10},
+		{NodeID: "n", Type: data.PointTypeValue, Time: now, Value: 2, Min: 2,
+			Max: 2, Count: 1, Text: "raw"},
+		// recorded by a second retention node
+		{NodeID: "n", Type: data.PointTypeValue, Time: now, Value: 2, Min: 2,
+			Max: 2, Count: 1, Text: "raw"},
+	}
+
+	points := historyToPoints(hps, "")
+	if len(points) != 2 {
+		t.Fatal("Expected duplicates to be removed: ", points)
+	}
+
+	if points[0].Value != 3 || points[1].Value != 2 || points[1].Text != "raw" {
+		t.Error("Wrong points: ", points)
+	}
+
+	points = historyToPoints(hps, data.AggregateMax)
+	if points[0].Value != 5 || points[1].Value != 2 {
+		t.Error("Expected max of downsampled points: ", points)
+	}
+
+	points = historyToPoints(hps, data.AggregateMin)
+	if points[0].Value != 1 {
+		t.Error("Expected min of downsampled points: ", points)
+	}
+}
+
+func TestStoreHistory(t *testing.T) {
+	ns, err := natsserver.NewServer(&natsserver.Options{Port: -1, NoSigs: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go ns.Start()
+	defer ns.Shutdown()
+
+	if !ns.ReadyForConnections(5 * time.Second) {
+		t.Fatal("NATS server not ready")
+	}
+
+	nc, err := nats.Connect(ns.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+
+	st, err := NewStore(Params{File: MemoryStoreFile, Nc: nc})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		st.Start()
+		close(stopped)
+	}()
+	defer func() {
+		st.Stop(nil)
+		<-stopped
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	err = st.WaitStart(ctx)
+	cancel()
+	if err != nil {
+		t.Fatal("Error waiting for store: ", err)
+	}
+
+	rootID := st.db.rootNodeID()
+
+	err = client.SendNode(nc, data.NodeEdge{
+		ID:     "var",
+		Type:   data.NodeTypeVariable,
+		Parent: rootID,
+	}, "")
+	if err != nil {
+		t.Fatal("Error sending variable node: ", err)
+	}
+
+	start := time.Now().Add(-time.Hour).Truncate(time.Minute)
+	var hps []historyPoint
+	for i := 0; i < 6; i++ {
+		hps = append(hps, historyPoint{NodeID: "var", Type: data.PointTypeValue,
+			Time: start.Add(time.Duration(i) * 10 * time.Minute), Value: float64(i),
+			Min: float64(i), Max: float64(i), Count: 1})
+	}
+
+	err = st.db.historyInsert("ret", hps)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	points, err := client.GetHistory(nc, "var", data.HistoryQuery{
+		Start: start,
+		End:   time.Now(),
+	})
+	if err != nil {
+		t.Fatal("Error getting history: ", err)
+	}
+
+	if len(points) != 6 || points[5].Value != 5 {
+		t.Fatal("Wrong history: ", points)
+	}
+
+	points, err = client.GetHistory(nc, "var", data.HistoryQuery{
+		Start:     start,
+		End:       time.Now(),
+		Window:    30 * time.Minute,
+		Aggregate: data.AggregateMean,
+	})
+	if err != nil {
+		t.Fatal("Error getting aggregated history: ", err)
+	}
+
+	if len(points) != 2 || points[0].Value != 1 || points[1].Value != 4 {
+		t.Fatal("Wrong aggregated history: ", points)
+	}
+
+	// nodes without history return no points
+	points, err = client.GetHistory(nc, rootID, data.HistoryQuery{
+		Start: start,
+		End:   time.Now(),
+	})
+	if err != nil {
+		t.Fatal("Error getting history: ", err)
+	}
+
+	if len(points) != 0 {
+		t.Fatal("Expected no history: ", points)
+	}
+
+	_, err = client.GetHistory(nc, "var", data.HistoryQuery{
+		Start:     start,
+		End:       time.Now(),
+		Aggregate: "bogus",
+	})
+	if err == nil {
+		t.Fatal("Expected error for invalid aggregate")
+	}
+
+	// once there is a db node, the db client answers history requests and
+	// the store does not
+	err = client.SendNode(nc, data.NodeEdge{
+		ID:     "influx",
+		Type:   data.NodeTypeDb,
+		Parent: rootID,
+	}, "")
+	if err != nil {
+		t.Fatal("Error sending db node: ", err)
+	}
+
+	reqPoints := data.HistoryQuery{Start: start, End: time.Now()}.ToPoints()
+	req, err := reqPoints.ToPb()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = nc.Request(client.SubjectHistory("var"), req, 500*time.Millisecond)
+	if err != nats.ErrTimeout {
+		t.Fatal("Expected store not to answer with a db node, got: ", err)
+	}
+}
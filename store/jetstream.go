@@ -0,0 +1,157 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// how often the time of the last point published to the stream is saved
+var streamTimeSavePeriod = time.Minute
+
+// replayed points are read from the stream until none are received for
+// this long
+var streamReplayTimeout = 2 * time.Second
+
+// setupStream creates or updates the JetStream stream that accepted points
+// are published to and replays points published since the store last ran
+func (st *Store) setupStream() error {
+	js, err := st.nc.JetStream()
+	if err != nil {
+		return fmt.Errorf("Error getting JetStream context: %w", err)
+	}
+
+	cfg := &nats.StreamConfig{
+		Name:     st.stream,
+		Subjects: []string{client.SubjectPrefixStream + "node.>"},
+		Storage:  nats.FileStorage,
+		MaxAge:   st.streamMaxAge,
+	}
+
+	info, err := js.StreamInfo(st.stream)
+	if errors.Is(err, nats.ErrStreamNotFound) {
+		info, err = js.AddStream(cfg)
+	} else if err == nil {
+		info, err = js.UpdateStream(cfg)
+	}
+	if err != nil {
+		return fmt.Errorf("Error setting up stream %v: %w", st.stream, err)
+	}
+
+	root, err := st.db.node(st.db.rootNodeID())
+	if err != nil {
+		return err
+	}
+
+	p, ok := root.Points.Find(data.PointTypeStreamTime, "")
+	if !ok || info.State.Msgs == 0 || !info.State.LastTime.After(p.Time) {
+		return nil
+	}
+
+	count, err := st.replayStream(js, p.Time)
+	log.Printf("Replayed %v point messages from stream %v\n", count, st.stream)
+	return err
+}
+
+// replayStream writes the points published to the stream at or after start
+// to the db. Points that are not newer than the points in the db are
+// ignored, so points the store already has are not changed.
+func (st *Store) replayStream(js nats.JetStreamContext, start time.Time) (int, error) {
+	sub, err := js.SubscribeSync(client.SubjectPrefixStream+"node.>",
+		nats.OrderedConsumer(), nats.StartTime(start))
+	if err != nil {
+		return 0, fmt.Errorf("Error subscribing to stream: %w", err)
+	}
+	defer sub.Unsubscribe()
+
+	count := 0
+
+	for {
+		msg, err := sub.NextMsg(streamReplayTimeout)
+		if errors.Is(err, nats.ErrTimeout) {
+			return count, nil
+		}
+		if err != nil {
+			return count, err
+		}
+
+		err = st.replayMsg(msg)
+		if err != nil {
+			log.Println("Error replaying stream message: ", err)
+		} else {
+			count++
+		}
+
+		meta, err := msg.Metadata()
+		if err == nil && meta.NumPending == 0 {
+			return count, nil
+		}
+	}
+}
+
+// replayMsg writes the points in a stream.node.<id>.points or
+// stream.node.<id>.<parent>.points message to the db
+func (st *Store) replayMsg(msg *nats.Msg) error {
+	chunks := strings.Split(strings.TrimPrefix(msg.Subject, client.SubjectPrefixStream), ".")
+
+	points, err := data.PbDecodePoints(msg.Data)
+	if err != nil {
+		return err
+	}
+
+	switch len(chunks) {
+	case 3:
+		return st.db.nodePoints(chunks[1], points)
+	case 4:
+		return st.db.edgePoints(chunks[1], chunks[2], points)
+	}
+
+	return fmt.Errorf("invalid stream subject: %v", msg.Subject)
+}
+
+// publishStream publishes points that were written to the stream subject
+// for the node or edge. The stream captures the message, so it is not
+// acknowledged.
+func (st *Store) publishStream(subject string, points data.Points) error {
+	if st.stream == "" {
+		return nil
+	}
+
+	err := client.SendPoints(st.nc, client.SubjectPrefixStream+subject, points, false)
+	if err != nil {
+		return err
+	}
+
+	st.lock.Lock()
+	st.streamTime = time.Now()
+	st.lock.Unlock()
+
+	return nil
+}
+
+// saveStreamTime saves the time of the last point published to the stream
+// on the root node. It is written directly to the db as it is only used by
+// the store.
+func (st *Store) saveStreamTime() {
+	st.lock.Lock()
+	t := st.streamTime
+	saved := st.streamTimeSaved
+	st.streamTimeSaved = t
+	st.lock.Unlock()
+
+	if t.IsZero() || !t.After(saved) {
+		return
+	}
+
+	err := st.db.nodePoints(st.db.rootNodeID(), data.Points{
+		{Type: data.PointTypeStreamTime, Time: t}})
+	if err != nil {
+		log.Println("Error saving stream time: ", err)
+	}
+}
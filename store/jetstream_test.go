@@ -0,0 +1,93 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+func TestStream(t *testing.T) {
+	nc, st, _ := startTestStoreParams(t, Params{BatchPeriod: -1, Stream: "test"})
+
+	root := st.db.rootNodeID()
+
+	err := client.SendNodeType(nc, client.Variable{ID: "v1", Parent: root}, "test")
+	if err != nil {
+		t.Fatal("Error sending node: ", err)
+	}
+
+	err = client.SendNodePoint(nc, "v1", data.Point{Time: time.Now(),
+		Type: data.PointTypeValue, Value: 5}, true)
+	if err != nil {
+		t.Fatal("Error sending point: ", err)
+	}
+
+	js, err := nc.JetStream()
+	if err != nil {
+		t.Fatal("Error getting JetStream: ", err)
+	}
+
+	sub, err := js.SubscribeSync(client.SubjectPrefixStream+"node.v1.points",
+		nats.OrderedConsumer(), nats.DeliverAll())
+	if err != nil {
+		t.Fatal("Error subscribing to stream: ", err)
+	}
+	defer sub.Unsubscribe()
+
+	found := false
+	for !found {
+		msg, err := sub.NextMsg(time.Second)
+		if err != nil {
+			t.Fatal("Point not found in stream: ", err)
+		}
+
+		points, err := data.PbDecodePoints(msg.Data)
+		if err != nil {
+			t.Fatal("Error decoding points: ", err)
+		}
+
+		v, ok := points.Value(data.PointTypeValue, "")
+		found = ok && v == 5
+	}
+
+	// points published to the stream by another instance are written on
+	// replay
+	start := time.Now()
+	err = client.SendPoints(nc, client.SubjectPrefixStream+"node.v1.points",
+		data.Points{{Time: time.Now(), Type: data.PointTypeValue, Value: 7}}, false)
+	if err != nil {
+		t.Fatal("Error publishing to stream: ", err)
+	}
+
+	count, err := st.replayStream(js, start)
+	if err != nil {
+		t.Fatal("Error replaying stream: ", err)
+	}
+
+	if count != 1 {
+		t.Fatal("Expected 1 replayed message, got: ", count)
+	}
+
+	node, err := st.db.node("v1")
+	if err != nil {
+		t.Fatal("Error getting node: ", err)
+	}
+
+	if v, _ := node.Points.Value(data.PointTypeValue, ""); v != 7 {
+		t.Fatal("Replayed point not written, value: ", v)
+	}
+
+	st.saveStreamTime()
+
+	rootNode, err := st.db.node(root)
+	if err != nil {
+		t.Fatal("Error getting root node: ", err)
+	}
+
+	if _, ok := rootNode.Points.Find(data.PointTypeStreamTime, ""); !ok {
+		t.Fatal("Stream time not saved")
+	}
+}
@@ -0,0 +1,144 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/client"
+)
+
+// how often the leader sends heartbeats, and how long a store waits without
+// heartbeats before it claims leadership
+var leaderHeartbeatPeriod = time.Second
+var leaderTimeout = 3 * time.Second
+
+// errLeaderLost is returned by Start if another store took over
+var errLeaderLost = errors.New("store lost leadership")
+
+// leaderMsg is sent on the leader subject by the leader, and by stores that
+// claim leadership. Since is when the store became leader (or made the
+// claim).
+type leaderMsg struct {
+	ID     string    `json:"id"`
+	Since  time.Time `json:"since"`
+	Leader bool      `json:"leader"`
+}
+
+// before returns true if m has priority over o. The store that has been
+// leader the longest wins, and then the store with the lowest ID, so all
+// stores make the same choice.
+func (m leaderMsg) before(o leaderMsg) bool {
+	if m.Leader != o.Leader {
+		return m.Leader
+	}
+
+	if !m.Since.Equal(o.Since) {
+		return m.Since.Before(o.Since)
+	}
+
+	return m.ID < o.ID
+}
+
+// elect waits until this store is the leader. Stores that are not the
+// leader are standbys, and claim leadership if they do not receive
+// heartbeats from a leader for leaderTimeout. The returned channel is closed
+// if another store takes over later, for example after a network partition
+// heals. ok is false if the store was stopped while waiting.
+func (st *Store) elect() (lost chan struct{}, ok bool, err error) {
+	chMsg := make(chan leaderMsg, 10)
+
+	sub, err := st.nc.Subscribe(client.SubjectStoreLeader(), func(msg *nats.Msg) {
+		var m leaderMsg
+		err := json.Unmarshal(msg.Data, &m)
+		if err != nil {
+			log.Println("Error decoding store leader message: ", err)
+			return
+		}
+
+		if m.ID == st.leaderID {
+			return
+		}
+
+		select {
+		case chMsg <- m:
+		default:
+			// nobody is listening once leadership is lost
+		}
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	st.subscriptions["leader"] = sub
+
+	log.Printf("Store %v is standby, waiting for leader election\n", st.leaderID)
+
+	var claim *leaderMsg
+	timer := time.NewTimer(leaderTimeout)
+
+	for claim == nil || time.Since(claim.Since) < leaderTimeout {
+		select {
+		case <-st.chStop:
+			return nil, false, nil
+		case m := <-chMsg:
+			if claim == nil || m.before(*claim) {
+				// another store is leader, or has a better claim
+				claim = nil
+				timer.Reset(leaderTimeout)
+			}
+		case <-timer.C:
+			if claim == nil {
+				claim = &leaderMsg{ID: st.leaderID, Since: time.Now()}
+			}
+			st.sendLeaderMsg(*claim)
+			timer.Reset(leaderHeartbeatPeriod)
+		}
+	}
+
+	timer.Stop()
+
+	log.Printf("Store %v is leader\n", st.leaderID)
+
+	me := leaderMsg{ID: st.leaderID, Since: time.Now(), Leader: true}
+	st.sendLeaderMsg(me)
+
+	lost = make(chan struct{})
+
+	go func() {
+		ticker := time.NewTicker(leaderHeartbeatPeriod)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-st.chStop:
+				return
+			case m := <-chMsg:
+				if m.before(me) {
+					log.Printf("Store %v took over from store %v\n", m.ID, me.ID)
+					close(lost)
+					return
+				}
+			case <-ticker.C:
+				st.sendLeaderMsg(me)
+			}
+		}
+	}()
+
+	return lost, true, nil
+}
+
+func (st *Store) sendLeaderMsg(m leaderMsg) {
+	d, err := json.Marshal(m)
+	if err != nil {
+		log.Println("Error encoding store leader message: ", err)
+		return
+	}
+
+	err = st.nc.Publish(client.SubjectStoreLeader(), d)
+	if err != nil {
+		log.Println("Error sending store leader message: ", err)
+	}
+}
@@ -0,0 +1,87 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLeaderMsgBefore(t *testing.T) {
+	now := time.Now()
+
+	leader := leaderMsg{ID: "b", Since: now.Add(time.Second), Leader: true}
+	older := leaderMsg{ID: "c", Since: now, Leader: true}
+	claim := leaderMsg{ID: "a", Since: now}
+
+	if !leader.before(claim) || claim.before(leader) {
+		t.Error("Leader should have priority over a claim")
+	}
+
+	if !older.before(leader) {
+		t.Error("Older leader should have priority")
+	}
+
+	same := leaderMsg{ID: "d", Since: now}
+	if !claim.before(same) || same.before(claim) {
+		t.Error("Lowest ID should have priority if times are equal")
+	}
+}
+
+func TestStoreLeaderElection(t *testing.T) {
+	heartbeat, timeout := leaderHeartbeatPeriod, leaderTimeout
+	leaderHeartbeatPeriod = 20 * time.Millisecond
+	leaderTimeout = 100 * time.Millisecond
+	t.Cleanup(func() {
+		leaderHeartbeatPeriod, leaderTimeout = heartbeat, timeout
+	})
+
+	// only used for the NATS connection the stores share
+	nc, _, _ := startTestStoreParams(t, Params{})
+
+	startStore := func(id string) (*Store, chan error) {
+		t.Helper()
+		st, err := NewStore(Params{File: MemoryStoreFile, Nc: nc, LeaderID: id})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		stopped := make(chan error, 1)
+		go func() {
+			stopped <- st.Start()
+		}()
+
+		return st, stopped
+	}
+
+	leader, leaderStopped := startStore("a")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	err := leader.WaitStart(ctx)
+	cancel()
+	if err != nil {
+		t.Fatal("Store was not elected: ", err)
+	}
+
+	standby, stopped := startStore("b")
+	t.Cleanup(func() {
+		standby.Stop(nil)
+		<-stopped
+	})
+
+	ctx, cancel = context.WithTimeout(context.Background(), 5*leaderTimeout)
+	err = standby.WaitStart(ctx)
+	cancel()
+	if err == nil {
+		t.Fatal("Standby store started while there is a leader")
+	}
+
+	leader.Stop(nil)
+	<-leaderStopped
+
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	err = standby.WaitStart(ctx)
+	cancel()
+	if err != nil {
+		t.Fatal("Standby store did not take over: ", err)
+	}
+}
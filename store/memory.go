@@ -0,0 +1,538 @@
+package store
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// MemoryBackend stores nodes, edges, and points in RAM. Nothing is written
+// to disk, so it is useful for tests and gateways with read-only root file
+// systems. All data is lost when the process exits.
+type MemoryBackend struct {
+	lock sync.RWMutex
+	// node points (including the node type) by node ID
+	nodes map[string]data.Points
+	// edges are kept in insertion order to match the sqlite backend
+	edges  []*data.Edge
+	rootID string
+	// history points by retention node ID
+	history map[string][]historyPoint
+}
+
+// NewMemoryBackend creates a memory backend with a root node and default
+// admin user
+func NewMemoryBackend() (*MemoryBackend, error) {
+	ret := &MemoryBackend{
+		nodes:   make(map[string]data.Points),
+		history: make(map[string][]historyPoint),
+	}
+
+	var err error
+	ret.rootID, err = initRoot(ret)
+	if err != nil {
+		return nil, fmt.Errorf("Error initializing root node: %v", err)
+	}
+
+	return ret, nil
+}
+
+// mergePoints merges points into existing points. If after is set, an
+// existing point is only replaced by a newer point, otherwise points with
+// equal timestamps are also written.
+func mergePoints(existing, points data.Points, after bool, id string) data.Points {
+NextPin:
+	for _, pIn := range points {
+		if pIn.Time.IsZero() {
+			pIn.Time = time.Now()
+		}
+
+		for j, pDb := range existing {
+			if pIn.Type == pDb.Type && pIn.Key == pDb.Key {
+				if pIn.Time.After(pDb.Time) || (!after && pIn.Time.Equal(pDb.Time)) {
+					existing[j] = pIn
+				} else if !after {
+					log.Println("Ignoring point due to timestamps: ", id, pIn)
+				}
+				continue NextPin
+			}
+		}
+
+		existing = append(existing, pIn)
+	}
+
+	return existing
+}
+
+func (mb *MemoryBackend) nodePoints(id string, points data.Points) error {
+	mb.lock.Lock()
+	defer mb.lock.Unlock()
+
+	mb.nodes[id] = mergePoints(mb.nodes[id], points, false, id)
+
+	return nil
+}
+
+// findEdge must be called with lock held
+func (mb *MemoryBackend) findEdge(up, down string) *data.Edge {
+	for _, e := range mb.edges {
+		if e.Up == up && e.Down == down {
+			return e
+		}
+	}
+
+	return nil
+}
+
+func (mb *MemoryBackend) edgePoints(nodeID, parentID string, points data.Points) error {
+	if parentID == "" {
+		parentID = "none"
+	}
+
+	mb.lock.Lock()
+	defer mb.lock.Unlock()
+
+	edge := mb.findEdge(parentID, nodeID)
+	if edge == nil {
+		edge = &data.Edge{
+			ID:   uuid.New().String(),
+			Up:   parentID,
+			Down: nodeID,
+		}
+		mb.edges = append(mb.edges, edge)
+	}
+
+	edge.Points = mergePoints(edge.Points, points, true, nodeID)
+
+	return nil
+}
+
+// batch writes node and edge points
+func (mb *MemoryBackend) batch(writes []pointWrite) error {
+	for _, w := range writes {
+		var err error
+		if w.edge {
+			err = mb.edgePoints(w.nodeID, w.parentID, w.points)
+		} else {
+			err = mb.nodePoints(w.nodeID, w.points)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Close does nothing for the memory backend
+func (mb *MemoryBackend) Close() error {
+	return nil
+}
+
+func (mb *MemoryBackend) rootNodeID() string {
+	mb.lock.RLock()
+	defer mb.lock.RUnlock()
+	return mb.rootID
+}
+
+// splitPoints returns a copy of points without the node type point, and the
+// node type
+func splitPoints(points data.Points) (data.Points, string) {
+	var ret data.Points
+	var typ string
+
+	for _, p := range points {
+		if p.Type == data.PointTypeNodeType {
+			typ = p.Text
+		} else {
+			ret = append(ret, p)
+		}
+	}
+
+	return ret, typ
+}
+
+// edgeToNodeEdge must be called with lock held
+func (mb *MemoryBackend) edgeToNodeEdge(e *data.Edge) data.NodeEdge {
+	var ne data.NodeEdge
+	ne.ID = e.Down
+	ne.Parent = e.Up
+	ne.Hash = e.Hash
+	ne.EdgePoints, _ = splitPoints(e.Points)
+	ne.Points, ne.Type = splitPoints(mb.nodes[e.Down])
+	return ne
+}
+
+func (mb *MemoryBackend) node(id string) (*data.Node, error) {
+	mb.lock.RLock()
+	defer mb.lock.RUnlock()
+
+	var ret data.Node
+	ret.ID = id
+	ret.Points, ret.Type = splitPoints(mb.nodes[id])
+
+	if ret.Type == "" {
+		return nil, data.ErrDocumentNotFound
+	}
+
+	return &ret, nil
+}
+
+func (mb *MemoryBackend) children(id, typ string, includeDel bool) ([]data.NodeEdge, error) {
+	mb.lock.RLock()
+	defer mb.lock.RUnlock()
+
+	var ret []data.NodeEdge
+
+	for _, e := range mb.edges {
+		if e.Up != id {
+			continue
+		}
+
+		ne := mb.edgeToNodeEdge(e)
+
+		if !includeDel {
+			tombstone, _ := ne.IsTombstone()
+			if tombstone {
+				// skip deleted nodes
+				continue
+			}
+		}
+
+		if typ != "" && ne.Type != typ {
+			// skip node of incorrect type
+			continue
+		}
+
+		ret = append(ret, ne)
+	}
+
+	return ret, nil
+}
+
+// id must be a valid ID or "root"
+// parent can be:
+//   - id of node
+//   - none: parent details are skipped
+//   - all: instances of node are fetched
+func (mb *MemoryBackend) nodeEdge(id, parent string) ([]data.NodeEdge, error) {
+	if id == "root" {
+		id = mb.rootID
+	}
+
+	if parent == "" {
+		parent = "none"
+	}
+
+	if parent == "none" {
+		node, err := mb.node(id)
+		if err != nil {
+			return nil, err
+		}
+		return []data.NodeEdge{node.ToNodeEdge(data.Edge{})}, nil
+	}
+
+	mb.lock.RLock()
+	defer mb.lock.RUnlock()
+
+	var ret []data.NodeEdge
+
+	for _, e := range mb.edges {
+		if e.Down != id || (parent != "all" && e.Up != parent) {
+			continue
+		}
+
+		ret = append(ret, mb.edgeToNodeEdge(e))
+	}
+
+	if len(ret) < 1 {
+		return ret, data.ErrDocumentNotFound
+	}
+
+	return ret, nil
+}
+
+// userCheck checks user authentication
+// returns nil, nil if user is not found
+func (mb *MemoryBackend) userCheck(email, password string) (data.Nodes, error) {
+	mb.lock.RLock()
+	var ids []string
+	for id, points := range mb.nodes {
+		if _, typ := splitPoints(points); typ == data.NodeTypeUser {
+			ids = append(ids, id)
+		}
+	}
+	mb.lock.RUnlock()
+
+	var ret []data.NodeEdge
+
+	for _, id := range ids {
+		ne, err := mb.nodeEdge(id, "all")
+		if err != nil {
+			log.Println("Error getting user node for id: ", id)
+			continue
+		}
+
+		n := ne[0].ToNode()
+		u := n.ToUser()
+		if u.Email == email && u.Pass == password {
+			ret = append(ret, ne...)
+		}
+	}
+
+	return ret, nil
+}
+
+// up returns upstream ids for a node
+func (mb *MemoryBackend) up(id string, includeDeleted bool) ([]string, error) {
+	mb.lock.RLock()
+	defer mb.lock.RUnlock()
+
+	var ups []string
+
+	for _, e := range mb.edges {
+		if e.Down != id {
+			continue
+		}
+
+		if !includeDeleted {
+			p, _ := e.Points.Find(data.PointTypeTombstone, "")
+			if p.Value != 0 {
+				continue
+			}
+		}
+
+		ups = append(ups, e.Up)
+	}
+
+	return ups, nil
+}
+
+func (mb *MemoryBackend) historyInsert(retentionID string, points []historyPoint) error {
+	mb.lock.Lock()
+	defer mb.lock.Unlock()
+
+	mb.history[retentionID] = append(mb.history[retentionID], points...)
+
+	return nil
+}
+
+// historyRaw returns raw history points older than before
+func (mb *MemoryBackend) historyRaw(retentionID string, before time.Time) ([]historyPoint, error) {
+	mb.lock.RLock()
+	defer mb.lock.RUnlock()
+
+	var ret []historyPoint
+	for _, p := range mb.history[retentionID] {
+		if p.Interval == 0 && p.Time.Before(before) {
+			ret = append(ret, p)
+		}
+	}
+
+	sort.SliceStable(ret, func(i, j int) bool {
+		return ret[i].Time.Before(ret[j].Time)
+	})
+
+	return ret, nil
+}
+
+// historyQuery returns raw and downsampled history points for a node between
+// start and end (inclusive). typ and key are ignored if blank, and a zero end
+// time means there is no end.
+func (mb *MemoryBackend) historyQuery(nodeID, typ, key string, start, end time.Time) ([]historyPoint, error) {
+	mb.lock.RLock()
+	defer mb.lock.RUnlock()
+
+	var ret []historyPoint
+	for _, points := range mb.history {
+		for _, p := range points {
+			if p.NodeID != nodeID || p.Time.Before(start) ||
+				(!end.IsZero() && p.Time.After(end)) ||
+				(typ != "" && p.Type != typ) || (key != "" && p.Key != key) {
+				continue
+			}
+			ret = append(ret, p)
+		}
+	}
+
+	sort.SliceStable(ret, func(i, j int) bool {
+		return ret[i].Time.Before(ret[j].Time)
+	})
+
+	return ret, nil
+}
+
+// historyDelete deletes raw or downsampled history points older than before
+func (mb *MemoryBackend) historyDelete(retentionID string, raw bool, before time.Time) error {
+	mb.lock.Lock()
+	defer mb.lock.Unlock()
+
+	var keep []historyPoint
+	for _, p := range mb.history[retentionID] {
+		if (p.Interval == 0) == raw && p.Time.Before(before) {
+			continue
+		}
+		keep = append(keep, p)
+	}
+
+	mb.history[retentionID] = keep
+
+	return nil
+}
+
+// historyBytes returns the approximate size of the history of a retention
+// node
+func (mb *MemoryBackend) historyBytes(retentionID string) (int64, error) {
+	mb.lock.RLock()
+	defer mb.lock.RUnlock()
+
+	var ret int64
+	for _, p := range mb.history[retentionID] {
+		ret += p.size()
+	}
+
+	return ret, nil
+}
+
+// snapshot returns a copy of all nodes, edges, and optionally history
+func (mb *MemoryBackend) snapshot(history bool) (*snapshot, error) {
+	mb.lock.RLock()
+	defer mb.lock.RUnlock()
+
+	ret := &snapshot{RootID: mb.rootID}
+
+	ids := make([]string, 0, len(mb.nodes))
+	for id := range mb.nodes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		ret.Nodes = append(ret.Nodes, snapshotNode{
+			ID:     id,
+			Points: append(data.Points{}, mb.nodes[id]...),
+		})
+	}
+
+	for _, e := range mb.edges {
+		ret.Edges = append(ret.Edges, data.Edge{
+			ID:     e.ID,
+			Up:     e.Up,
+			Down:   e.Down,
+			Points: append(data.Points{}, e.Points...),
+			Hash:   append([]byte{}, e.Hash...),
+		})
+	}
+
+	if !history {
+		return ret, nil
+	}
+
+	retentionIDs := make([]string, 0, len(mb.history))
+	for id := range mb.history {
+		retentionIDs = append(retentionIDs, id)
+	}
+	sort.Strings(retentionIDs)
+
+	for _, id := range retentionIDs {
+		ret.History = append(ret.History, snapshotHistory{
+			RetentionID: id,
+			Points:      append([]historyPoint{}, mb.history[id]...),
+		})
+	}
+
+	return ret, nil
+}
+
+// restore replaces all data with a snapshot
+func (mb *MemoryBackend) restore(s *snapshot) error {
+	nodes := make(map[string]data.Points)
+	for _, n := range s.Nodes {
+		nodes[n.ID] = append(nodes[n.ID], n.Points...)
+	}
+
+	var edges []*data.Edge
+	for _, e := range s.Edges {
+		e := e
+		e.Hash = nil
+		edges = append(edges, &e)
+	}
+
+	history := make(map[string][]historyPoint)
+	for _, h := range s.History {
+		history[h.RetentionID] = append(history[h.RetentionID], h.Points...)
+	}
+
+	mb.lock.Lock()
+	defer mb.lock.Unlock()
+
+	mb.nodes = nodes
+	mb.edges = edges
+	mb.history = history
+	mb.rootID = s.RootID
+
+	return nil
+}
+
+// repairEdges deletes edges and writes edge hashes
+func (mb *MemoryBackend) repairEdges(deleteIDs []string, hashes map[string][]byte) error {
+	del := make(map[string]bool)
+	for _, id := range deleteIDs {
+		del[id] = true
+	}
+
+	mb.lock.Lock()
+	defer mb.lock.Unlock()
+
+	edges := mb.edges[:0]
+	for _, e := range mb.edges {
+		if del[e.ID] {
+			continue
+		}
+
+		if h, ok := hashes[e.ID]; ok {
+			e.Hash = h
+		}
+
+		edges = append(edges, e)
+	}
+
+	mb.edges = edges
+
+	return nil
+}
+
+// purge deletes edges and nodes
+func (mb *MemoryBackend) purge(edgeIDs, nodeIDs []string) error {
+	mb.lock.Lock()
+	for _, id := range nodeIDs {
+		delete(mb.nodes, id)
+	}
+	mb.lock.Unlock()
+
+	return mb.repairEdges(edgeIDs, nil)
+}
+
+// purgePoints deletes node points
+func (mb *MemoryBackend) purgePoints(points []pointRef) error {
+	mb.lock.Lock()
+	defer mb.lock.Unlock()
+
+	for _, ref := range points {
+		pts := mb.nodes[ref.nodeID]
+		for i, p := range pts {
+			if p.Type == ref.typ && p.Key == ref.key {
+				mb.nodes[ref.nodeID] = append(pts[:i], pts[i+1:]...)
+				break
+			}
+		}
+	}
+
+	return nil
+}
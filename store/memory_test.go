@@ -0,0 +1,85 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/simpleiot/simpleiot/data"
+)
+
+func newTestMemoryBackend(t *testing.T) *MemoryBackend {
+	db, err := NewMemoryBackend()
+	if err != nil {
+		t.Fatal("Error creating memory backend: ", err)
+	}
+
+	return db
+}
+
+func TestMemoryBackend(t *testing.T) {
+	testBackend(t, newTestMemoryBackend(t))
+}
+
+func TestMemoryBackendUserCheck(t *testing.T) {
+	testBackendUserCheck(t, newTestMemoryBackend(t))
+}
+
+func TestMemoryBackendUp(t *testing.T) {
+	testBackendUp(t, newTestMemoryBackend(t))
+}
+
+func TestMemoryBackendTombstone(t *testing.T) {
+	db := newTestMemoryBackend(t)
+	rootID := db.rootNodeID()
+
+	children, err := db.children(rootID, "", false)
+	if err != nil || len(children) != 1 {
+		t.Fatal("Expected admin user child: ", err, children)
+	}
+
+	adminID := children[0].ID
+
+	err = db.edgePoints(adminID, rootID, data.Points{{Type: data.PointTypeTombstone, Value: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	children, _ = db.children(rootID, "", false)
+	if len(children) != 0 {
+		t.Fatal("Deleted node should not be returned: ", children)
+	}
+
+	children, _ = db.children(rootID, "", true)
+	if len(children) != 1 {
+		t.Fatal("Deleted node should be returned with includeDel")
+	}
+
+	ups, _ := db.up(adminID, false)
+	if len(ups) != 0 {
+		t.Fatal("Deleted edge should not be returned by up: ", ups)
+	}
+
+	ups, _ = db.up(adminID, true)
+	if len(ups) != 1 || ups[0] != rootID {
+		t.Fatal("Deleted edge should be returned by up with includeDeleted: ", ups)
+	}
+}
+
+func TestMemoryBackendTypeFilter(t *testing.T) {
+	db := newTestMemoryBackend(t)
+	rootID := db.rootNodeID()
+
+	users, err := db.children(rootID, data.NodeTypeUser, false)
+	if err != nil || len(users) != 1 {
+		t.Fatal("Expected 1 user: ", err, users)
+	}
+
+	groups, err := db.children(rootID, data.NodeTypeGroup, false)
+	if err != nil || len(groups) != 0 {
+		t.Fatal("Expected no groups: ", err, groups)
+	}
+
+	_, err = db.node("does-not-exist")
+	if err == nil {
+		t.Fatal("Expected error for missing node")
+	}
+}
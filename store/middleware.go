@@ -0,0 +1,54 @@
+package store
+
+import (
+	"fmt"
+
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// PointMiddleware inspects, transforms, or rejects node points before the
+// store writes them, for example to enforce a site policy, convert units, or
+// add points. node is the node as stored, or nil if it is being created. The
+// points returned are passed to the next middleware, and if none are
+// returned nothing is written. An error rejects all the points and is
+// returned to the sender.
+type PointMiddleware func(nodeID string, node *data.Node, points data.Points) (data.Points, error)
+
+// Use adds point middleware. Middleware runs in the order it is added, after
+// point signatures are verified and before schema validation, for node
+// points written on node.<id>.points, in transactions, and when nodes are
+// created (see prepareWrites). Edge points are not passed to middleware. Use can be called while the store is running.
+func (st *Store) Use(mw PointMiddleware) {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	st.middleware = append(st.middleware, mw)
+}
+
+// runMiddleware passes points through the registered middleware
+func (st *Store) runMiddleware(nodeID string, points data.Points) (data.Points, error) {
+	st.lock.Lock()
+	middleware := st.middleware
+	st.lock.Unlock()
+
+	if len(middleware) <= 0 {
+		return points, nil
+	}
+
+	node, err := st.db.node(nodeID)
+	if err != nil {
+		node = nil
+	}
+
+	for _, mw := range middleware {
+		points, err = mw(nodeID, node, points)
+		if err != nil {
+			return nil, fmt.Errorf("rejected points for node %v: %w", nodeID, err)
+		}
+
+		if len(points) <= 0 {
+			return nil, nil
+		}
+	}
+
+	return points, nil
+}
@@ -0,0 +1,109 @@
+package store
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+func TestMiddleware(t *testing.T) {
+	// converts values to tenths and rejects negative values
+	tenths := func(_ string, _ *data.Node, points data.Points) (data.Points, error) {
+		for i, p := range points {
+			if p.Type != data.PointTypeValue {
+				continue
+			}
+			if p.Value < 0 {
+				return nil, errors.New("negative value")
+			}
+			points[i].Value = p.Value * 10
+		}
+		return points, nil
+	}
+
+	nc, st, _ := startTestStoreParams(t, Params{BatchPeriod: -1,
+		Middleware: []PointMiddleware{tenths}})
+
+	// drops description changes of existing nodes, runs after tenths
+	st.Use(func(_ string, node *data.Node, points data.Points) (data.Points, error) {
+		if node == nil {
+			return points, nil
+		}
+
+		var ret data.Points
+		for _, p := range points {
+			if p.Type != data.PointTypeDescription {
+				ret = append(ret, p)
+			}
+		}
+		return ret, nil
+	})
+
+	root := st.db.rootNodeID()
+
+	err := client.SendNodeType(nc, client.Variable{ID: "v1", Parent: root,
+		Description: "first"}, "test")
+	if err != nil {
+		t.Fatal("Error sending node: ", err)
+	}
+
+	node := func() *data.Node {
+		t.Helper()
+		n, err := st.db.node("v1")
+		if err != nil {
+			t.Fatal("Error getting node: ", err)
+		}
+		return n
+	}
+
+	err = client.SendNodePoint(nc, "v1", data.Point{Time: time.Now(),
+		Type: data.PointTypeValue, Value: 2}, true)
+	if err != nil {
+		t.Fatal("Error sending point: ", err)
+	}
+
+	if v, _ := node().Points.Value(data.PointTypeValue, ""); v != 20 {
+		t.Fatal("Point was not transformed, value: ", v)
+	}
+
+	err = client.SendNodePoint(nc, "v1", data.Point{Time: time.Now(),
+		Type: data.PointTypeValue, Value: -1}, true)
+	if err == nil {
+		t.Fatal("Expected point to be rejected")
+	}
+
+	err = client.SendNodePointsTx(nc, []data.TxWrite{{NodeID: "v1", Points: data.Points{
+		{Time: time.Now(), Type: data.PointTypeValue, Value: 3},
+		{Time: time.Now(), Type: data.PointTypeDescription, Text: "second"},
+	}}})
+	if err != nil {
+		t.Fatal("Error sending transaction: ", err)
+	}
+
+	n := node()
+	if v, _ := n.Points.Value(data.PointTypeValue, ""); v != 30 {
+		t.Fatal("Transaction point was not transformed, value: ", v)
+	}
+
+	if d := n.Desc(); d != "first" {
+		t.Fatal("Description change was not dropped: ", d)
+	}
+
+	ids, err := client.SendNodes(nc, root, []data.NodeEdge{{Type: data.NodeTypeVariable,
+		Points: data.Points{{Type: data.PointTypeValue, Value: 4}}}})
+	if err != nil {
+		t.Fatal("Error creating node: ", err)
+	}
+
+	created, err := st.db.node(ids[0])
+	if err != nil {
+		t.Fatal("Error getting created node: ", err)
+	}
+
+	if v, _ := created.Points.Value(data.PointTypeValue, ""); v != 40 {
+		t.Fatal("Created node point was not transformed, value: ", v)
+	}
+}
@@ -0,0 +1,86 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// pointOrigin returns who last changed point typ/key of a node
+func (st *Store) pointOrigin(nodeID, typ, key string) (data.PointOrigin, error) {
+	node, err := st.db.node(nodeID)
+	if err != nil {
+		return data.PointOrigin{}, fmt.Errorf("Error getting node %v: %w", nodeID, err)
+	}
+
+	p, ok := node.Points.Find(typ, key)
+	if !ok {
+		return data.PointOrigin{}, fmt.Errorf("Node %v does not have point %v:%v",
+			nodeID, typ, key)
+	}
+
+	var origin *data.Node
+	originID := p.OriginID(nodeID)
+	if originID == nodeID {
+		origin = node
+	} else {
+		// the origin may not be in this store (a user of an upstream
+		// instance, etc)
+		origin, _ = st.db.node(originID)
+	}
+
+	return data.NewPointOrigin(nodeID, p, origin), nil
+}
+
+// handleOrigin answers node.<id>.origin requests with a JSON encoded
+// data.PointOrigin (see client.GetPointOrigin)
+func (st *Store) handleOrigin(msg *nats.Msg) {
+	ret, err := st.originRequest(msg)
+	if err != nil {
+		ret.Error = err.Error()
+	}
+
+	if msg.Reply == "" {
+		return
+	}
+
+	d, err := json.Marshal(ret)
+	if err != nil {
+		log.Println("Error encoding point origin: ", err)
+		return
+	}
+
+	err = st.nc.Publish(msg.Reply, d)
+	if err != nil {
+		log.Println("Error sending point origin: ", err)
+	}
+}
+
+// originRequest decodes the node ID and point type and key of an origin
+// request and looks up the point origin
+func (st *Store) originRequest(msg *nats.Msg) (data.PointOrigin, error) {
+	chunks := strings.Split(msg.Subject, ".")
+	if len(chunks) < 3 {
+		return data.PointOrigin{}, fmt.Errorf("Error in message subject: %v", msg.Subject)
+	}
+
+	nodeID := chunks[1]
+	if nodeID == "root" {
+		nodeID = st.db.rootNodeID()
+	}
+
+	points, err := client.DecodePoints(msg)
+	if err != nil {
+		return data.PointOrigin{}, fmt.Errorf("Error decoding points: %w", err)
+	}
+
+	typ, _ := points.Text(data.PointTypePointType, "")
+	key, _ := points.Text(data.PointTypePointKey, "")
+
+	return st.pointOrigin(nodeID, typ, key)
+}
@@ -0,0 +1,73 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+func TestStorePointOrigin(t *testing.T) {
+	nc, st, _ := startBatchTestStore(t, -1)
+
+	root := st.db.rootNodeID()
+
+	send := func(n data.NodeEdge) {
+		t.Helper()
+		n.Parent = root
+		err := client.SendNode(nc, n, "test")
+		if err != nil {
+			t.Fatal("Error sending node: ", err)
+		}
+	}
+
+	send(data.NodeEdge{ID: "user1", Type: data.NodeTypeUser, Points: data.Points{
+		{Type: data.PointTypeFirstName, Text: "Jane"},
+		{Type: data.PointTypeLastName, Text: "Smith"},
+	}})
+
+	send(data.NodeEdge{ID: "rule1", Type: data.NodeTypeRule, Points: data.Points{
+		{Type: data.PointTypeDescription, Text: "heat rule"},
+	}})
+
+	send(data.NodeEdge{ID: "hvac", Type: "hvac"})
+
+	setpoint := func(v float64, origin string) {
+		t.Helper()
+		err := client.SendNodePoint(nc, "hvac", data.Point{Time: time.Now(),
+			Type: data.PointTypeValueSet, Value: v, Origin: origin}, true)
+		if err != nil {
+			t.Fatal("Error sending setpoint: ", err)
+		}
+	}
+
+	tests := []struct {
+		origin, originID, kind, desc string
+	}{
+		{"user1", "user1", data.PointOriginUser, "Jane Smith"},
+		{"rule1", "rule1", data.PointOriginClient, "heat rule"},
+		{"", "hvac", data.PointOriginClient, "hvac"},
+		{"remote", "remote", data.PointOriginUnknown, ""},
+		{root, root, data.PointOriginInstance, root},
+	}
+
+	for i, test := range tests {
+		setpoint(float64(20+i), test.origin)
+
+		o, err := client.GetPointOrigin(nc, "hvac", data.PointTypeValueSet, "")
+		if err != nil {
+			t.Fatal("Error getting point origin: ", err)
+		}
+
+		if o.NodeID != "hvac" || o.OriginID != test.originID || o.Kind != test.kind ||
+			o.OriginDescription != test.desc || o.Point.Value != float64(20+i) {
+			t.Errorf("origin %v not correct: %+v", test.origin, o)
+		}
+	}
+
+	_, err := client.GetPointOrigin(nc, "hvac", data.PointTypeLevel, "")
+	if err == nil {
+		t.Error("expected error for missing point")
+	}
+}
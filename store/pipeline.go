@@ -0,0 +1,86 @@
+package store
+
+import (
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// prepareWrites runs node and edge point writes through the steps the store
+// applies before points are written. It is used for node points, edge
+// points, transactions, and node creation, so all writes get the same
+// checks. signed is set for node points messages, which may include signed
+// point types (see verify); other writes must not include them. Node points
+// are passed through middleware, shadow, schema validation, TTL, dedup, and
+// command tracking, and secrets are encrypted in all writes. Node writes
+// that do not have any points left are removed (edge writes create the edge
+// even without points). An error rejects all the writes.
+func (st *Store) prepareWrites(writes []data.TxWrite, signed bool) ([]data.TxWrite, error) {
+	var err error
+
+	if signed {
+		for _, w := range writes {
+			if w.Edge {
+				continue
+			}
+
+			err = st.verify(w.NodeID, w.Points)
+			if err != nil {
+				return nil, err
+			}
+		}
+	} else {
+		err = st.verifyUnsigned(writes)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = st.quotaWrites(writes)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]data.TxWrite, 0, len(writes))
+
+	for _, w := range writes {
+		if !w.Edge {
+			w.Points, err = st.runMiddleware(w.NodeID, w.Points)
+			if err != nil {
+				return nil, err
+			}
+
+			// desired points are applied to config points if this
+			// instance owns the node
+			w.Points = st.shadow(w.NodeID, w.Points)
+
+			w.Points, err = st.validate(w.NodeID, w.Points)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		w.Points, err = st.encryptSecrets(w.Points)
+		if err != nil {
+			return nil, err
+		}
+
+		if !w.Edge {
+			// points with a TTL are tracked before dedup, as unchanged
+			// points still refresh the TTL
+			w.Points = st.ttl(w.NodeID, w.Points)
+
+			// unchanged points are dropped if a dedup window is
+			// configured for the node type
+			w.Points = st.dedup(w.NodeID, w.Points)
+
+			// command points get a pending state and confirmations of
+			// commands that are not pending are dropped
+			w.Points = st.commands(w.NodeID, w.Points)
+		}
+
+		if w.Edge || len(w.Points) > 0 {
+			ret = append(ret, w)
+		}
+	}
+
+	return ret, nil
+}
@@ -0,0 +1,677 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/simpleiot/simpleiot/data"
+
+	// tell sql to use postgres
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+// advisory lock ID used while initializing the database so that only one
+// instance creates the root node
+const pgInitLockID = 0x5349_4f54
+
+// DbPostgres represents a PostgreSQL data store. Multiple SIOT instances can
+// share one database. Points are written with upserts that check timestamps
+// in the database, so concurrent writes from several instances resolve the
+// same way as they do in a single instance.
+type DbPostgres struct {
+	db   *sql.DB
+	meta Meta
+}
+
+// isPostgresURI returns true if uri should be opened with the postgres
+// backend
+func isPostgresURI(uri string) bool {
+	return strings.HasPrefix(uri, "postgres://") || strings.HasPrefix(uri, "postgresql://")
+}
+
+// NewPostgresDb creates a new PostgreSQL data store. uri is a postgres://
+// URL with libpq parameters (see github.com/jackc/pgx/v5/pgconn.ParseConfig).
+func NewPostgresDb(uri string) (*DbPostgres, error) {
+	ret := &DbPostgres{}
+
+	db, err := sql.Open("pgx", uri)
+	if err != nil {
+		return nil, err
+	}
+
+	ret.db = db
+
+	tables := []string{
+		`CREATE TABLE IF NOT EXISTS meta (id INT NOT NULL PRIMARY KEY,
+				version INT,
+				root_id TEXT)`,
+		`CREATE TABLE IF NOT EXISTS edges (id TEXT NOT NULL PRIMARY KEY,
+				seq BIGSERIAL,
+				up TEXT NOT NULL,
+				down TEXT NOT NULL,
+				hash BYTEA,
+				UNIQUE (up, down))`,
+		`CREATE INDEX IF NOT EXISTS edges_down ON edges (down)`,
+		`CREATE TABLE IF NOT EXISTS node_points (id TEXT NOT NULL PRIMARY KEY,
+				seq BIGSERIAL,
+				node_id TEXT NOT NULL,
+				type TEXT NOT NULL,
+				key TEXT NOT NULL,
+				time_s BIGINT,
+				time_ns BIGINT,
+				idx DOUBLE PRECISION,
+				value DOUBLE PRECISION,
+				text TEXT,
+				data BYTEA,
+				tombstone INT,
+				origin TEXT,
+				UNIQUE (node_id, type, key))`,
+		`CREATE TABLE IF NOT EXISTS edge_points (id TEXT NOT NULL PRIMARY KEY,
+				seq BIGSERIAL,
+				edge_id TEXT NOT NULL,
+				type TEXT NOT NULL,
+				key TEXT NOT NULL,
+				time_s BIGINT,
+				time_ns BIGINT,
+				idx DOUBLE PRECISION,
+				value DOUBLE PRECISION,
+				text TEXT,
+				data BYTEA,
+				tombstone INT,
+				origin TEXT,
+				UNIQUE (edge_id, type, key))`,
+		`CREATE TABLE IF NOT EXISTS history (retention_id TEXT NOT NULL,
+				node_id TEXT NOT NULL,
+				type TEXT NOT NULL,
+				key TEXT NOT NULL,
+				time BIGINT NOT NULL,
+				interval_ns BIGINT NOT NULL,
+				value DOUBLE PRECISION,
+				min DOUBLE PRECISION,
+				max DOUBLE PRECISION,
+				count BIGINT,
+				text TEXT)`,
+		`CREATE INDEX IF NOT EXISTS history_retention
+				ON history (retention_id, interval_ns, time)`,
+		`CREATE INDEX IF NOT EXISTS history_node
+				ON history (node_id, type, time)`,
+	}
+
+	for _, t := range tables {
+		_, err = db.Exec(t)
+		if err != nil {
+			db.Close()
+			return nil, fmt.Errorf("Error creating tables: %v", err)
+		}
+	}
+
+	err = ret.initMeta()
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	// make sure we find root ID
+	_, err = ret.node(ret.meta.RootID)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("db constructor can't fetch root node: %v", err)
+	}
+
+	return ret, nil
+}
+
+// initMeta reads the meta data and initializes the root node if this is a
+// new database. An advisory lock is held so that instances starting at the
+// same time don't each create a root node.
+func (pdb *DbPostgres) initMeta() error {
+	ctx := context.Background()
+
+	conn, err := pdb.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", int64(pgInitLockID))
+	if err != nil {
+		return fmt.Errorf("Error locking db: %v", err)
+	}
+
+	defer func() {
+		_, err := conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", int64(pgInitLockID))
+		if err != nil {
+			log.Println("Error unlocking db: ", err)
+		}
+	}()
+
+	err = conn.QueryRowContext(ctx, "SELECT id, version, root_id FROM meta").Scan(
+		&pdb.meta.ID, &pdb.meta.Version, &pdb.meta.RootID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("Error quering meta: %v", err)
+	}
+
+	if pdb.meta.RootID != "" {
+		return nil
+	}
+
+	// we need to initialize root node and user
+	pdb.meta.RootID, err = initRoot(pdb)
+	if err != nil {
+		return fmt.Errorf("Error initializing root node: %v", err)
+	}
+
+	_, err = conn.ExecContext(ctx, "INSERT INTO meta(id, version, root_id) VALUES($1, $2, $3)",
+		0, 0, pdb.meta.RootID)
+	if err != nil {
+		return fmt.Errorf("Error setting meta data: %v", err)
+	}
+
+	return nil
+}
+
+// writePoints upserts points as part of the tx transaction. Existing points
+// are only updated if the new point is newer, or the same age if equal is
+// set. Returns the points that were not written.
+func (pdb *DbPostgres) writePoints(tx *sql.Tx, table, idColumn, id string, points data.Points, equal bool) (data.Points, error) {
+	cmp := "<"
+	if equal {
+		cmp = "<="
+	}
+
+	q := fmt.Sprintf(`INSERT INTO %[1]v(id, %[2]v, type, key, time_s,
+		time_ns, idx, value, text, data, tombstone, origin)
+		VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		ON CONFLICT (%[2]v, type, key) DO UPDATE SET
+		time_s = EXCLUDED.time_s,
+		time_ns = EXCLUDED.time_ns,
+		idx = EXCLUDED.idx,
+		value = EXCLUDED.value,
+		text = EXCLUDED.text,
+		data = EXCLUDED.data,
+		tombstone = EXCLUDED.tombstone,
+		origin = EXCLUDED.origin
+		WHERE (%[1]v.time_s, %[1]v.time_ns) %[3]v (EXCLUDED.time_s, EXCLUDED.time_ns)`,
+		table, idColumn, cmp)
+
+	var ignored data.Points
+
+	for _, p := range points {
+		if p.Time.IsZero() {
+			p.Time = time.Now()
+		}
+
+		tS := p.Time.Unix()
+		tNs := p.Time.UnixNano() - 1e9*tS
+
+		res, err := tx.Exec(q, uuid.New().String(), id, p.Type, p.Key, tS, tNs,
+			p.Index, p.Value, p.Text, p.Data, p.Tombstone, p.Origin)
+		if err != nil {
+			return nil, err
+		}
+
+		if n, _ := res.RowsAffected(); n == 0 {
+			ignored = append(ignored, p)
+		}
+	}
+
+	return ignored, nil
+}
+
+func (pdb *DbPostgres) nodePoints(id string, points data.Points) error {
+	return sqlTransaction(pdb.db, func(tx *sql.Tx) error {
+		return pdb.nodePointsTx(tx, id, points)
+	})
+}
+
+// nodePointsTx writes node points as part of the tx transaction
+func (pdb *DbPostgres) nodePointsTx(tx *sql.Tx, id string, points data.Points) error {
+	ignored, err := pdb.writePoints(tx, "node_points", "node_id", id, points, true)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range ignored {
+		log.Println("Ignoring point due to timestamps: ", id, p)
+	}
+
+	return nil
+}
+
+func (pdb *DbPostgres) edgePoints(nodeID, parentID string, points data.Points) error {
+	return sqlTransaction(pdb.db, func(tx *sql.Tx) error {
+		return pdb.edgePointsTx(tx, nodeID, parentID, points)
+	})
+}
+
+// edgePointsTx writes edge points as part of the tx transaction
+func (pdb *DbPostgres) edgePointsTx(tx *sql.Tx, nodeID, parentID string, points data.Points) error {
+	if parentID == "" {
+		parentID = "none"
+	}
+
+	_, err := tx.Exec(`INSERT INTO edges(id, up, down) VALUES ($1, $2, $3)
+		ON CONFLICT (up, down) DO NOTHING`, uuid.New().String(), parentID, nodeID)
+	if err != nil {
+		return err
+	}
+
+	var edgeID string
+	err = tx.QueryRow("SELECT id FROM edges WHERE up=$1 AND down=$2",
+		parentID, nodeID).Scan(&edgeID)
+	if err != nil {
+		return err
+	}
+
+	_, err = pdb.writePoints(tx, "edge_points", "edge_id", edgeID, points, false)
+	return err
+}
+
+// batch writes node and edge points in one transaction
+func (pdb *DbPostgres) batch(writes []pointWrite) error {
+	return sqlBatch(pdb.db, writes, pdb.nodePointsTx, pdb.edgePointsTx)
+}
+
+// Close the db
+func (pdb *DbPostgres) Close() error {
+	return pdb.db.Close()
+}
+
+func (pdb *DbPostgres) rootNodeID() string {
+	return pdb.meta.RootID
+}
+
+const pgPointColumns = "type, key, time_s, time_ns, idx, value, text, data, tombstone, origin"
+
+// returns points, type (if node), and error
+func (pdb *DbPostgres) queryPoints(query string, args ...interface{}) (data.Points, string, error) {
+	var retPoints data.Points
+	var retType string
+
+	rowsPoints, err := pdb.db.Query(query, args...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rowsPoints.Close()
+
+	for rowsPoints.Next() {
+		var p data.Point
+		var timeS, timeNS int64
+		err := rowsPoints.Scan(&p.Type, &p.Key, &timeS, &timeNS, &p.Index, &p.Value, &p.Text,
+			&p.Data, &p.Tombstone, &p.Origin)
+		if err != nil {
+			return nil, "", err
+		}
+		p.Time = time.Unix(timeS, timeNS)
+		if p.Type == data.PointTypeNodeType {
+			retType = p.Text
+		} else {
+			retPoints = append(retPoints, p)
+		}
+	}
+
+	return retPoints, retType, rowsPoints.Err()
+}
+
+func (pdb *DbPostgres) queryNodePoints(id string) (data.Points, string, error) {
+	return pdb.queryPoints("SELECT "+pgPointColumns+
+		" FROM node_points WHERE node_id=$1 ORDER BY seq", id)
+}
+
+func (pdb *DbPostgres) queryEdgePoints(edgeID string) (data.Points, error) {
+	points, _, err := pdb.queryPoints("SELECT "+pgPointColumns+
+		" FROM edge_points WHERE edge_id=$1 ORDER BY seq", edgeID)
+	return points, err
+}
+
+// gets a node
+func (pdb *DbPostgres) node(id string) (*data.Node, error) {
+	var err error
+	var ret data.Node
+	ret.ID = id
+
+	ret.Points, ret.Type, err = pdb.queryNodePoints(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if ret.Type == "" {
+		return nil, data.ErrDocumentNotFound
+	}
+
+	return &ret, nil
+}
+
+// queryEdges returns edges with node and edge points
+func (pdb *DbPostgres) queryEdges(query string, args ...interface{}) ([]data.NodeEdge, error) {
+	rowsEdges, err := pdb.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("Error getting edges: %v", err)
+	}
+
+	var edges []data.Edge
+
+	for rowsEdges.Next() {
+		var edge data.Edge
+		err = rowsEdges.Scan(&edge.ID, &edge.Up, &edge.Down, &edge.Hash)
+		if err != nil {
+			rowsEdges.Close()
+			return nil, fmt.Errorf("Error scanning edges: %v", err)
+		}
+		edges = append(edges, edge)
+	}
+
+	rowsEdges.Close()
+
+	ret := make([]data.NodeEdge, len(edges))
+
+	for i, edge := range edges {
+		ne := &ret[i]
+		ne.ID = edge.Down
+		ne.Parent = edge.Up
+		ne.Hash = edge.Hash
+
+		ne.EdgePoints, err = pdb.queryEdgePoints(edge.ID)
+		if err != nil {
+			return nil, fmt.Errorf("Error getting edge points: %v", err)
+		}
+
+		ne.Points, ne.Type, err = pdb.queryNodePoints(edge.Down)
+		if err != nil {
+			return nil, fmt.Errorf("Error getting node points: %v", err)
+		}
+	}
+
+	return ret, nil
+}
+
+func (pdb *DbPostgres) children(id, typ string, includeDel bool) ([]data.NodeEdge, error) {
+	edges, err := pdb.queryEdges(
+		"SELECT id, up, down, hash FROM edges WHERE up=$1 ORDER BY seq", id)
+	if err != nil {
+		return nil, err
+	}
+
+	var ret []data.NodeEdge
+
+	for _, ne := range edges {
+		if !includeDel {
+			tombstone, _ := ne.IsTombstone()
+			if tombstone {
+				// skip deleted nodes
+				continue
+			}
+		}
+
+		if typ != "" && ne.Type != typ {
+			// skip node of incorrect type
+			continue
+		}
+
+		ret = append(ret, ne)
+	}
+
+	return ret, nil
+}
+
+// id must be a valid ID or "root"
+// parent can be:
+//   - id of node
+//   - none: parent details are skipped
+//   - all: instances of node are fetched
+func (pdb *DbPostgres) nodeEdge(id, parent string) ([]data.NodeEdge, error) {
+	if id == "root" {
+		id = pdb.meta.RootID
+	}
+
+	if parent == "" {
+		parent = "none"
+	}
+
+	var ret []data.NodeEdge
+	var err error
+
+	switch parent {
+	case "none":
+		node, err := pdb.node(id)
+		if err != nil {
+			return nil, err
+		}
+		return []data.NodeEdge{node.ToNodeEdge(data.Edge{})}, nil
+	case "all":
+		ret, err = pdb.queryEdges(
+			"SELECT id, up, down, hash FROM edges WHERE down=$1 ORDER BY seq", id)
+	default:
+		ret, err = pdb.queryEdges(
+			"SELECT id, up, down, hash FROM edges WHERE up=$1 AND down=$2", parent, id)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ret) < 1 {
+		return ret, data.ErrDocumentNotFound
+	}
+
+	return ret, nil
+}
+
+// userCheck checks user authentication
+// returns nil, nil if user is not found
+func (pdb *DbPostgres) userCheck(email, password string) (data.Nodes, error) {
+	rows, err := pdb.db.Query("SELECT node_id FROM node_points WHERE type=$1 AND text=$2",
+		data.PointTypeNodeType, data.NodeTypeUser)
+	if err != nil {
+		return nil, fmt.Errorf("userCheck, error query error: %v", err)
+	}
+
+	var ids []string
+
+	for rows.Next() {
+		var id string
+		err = rows.Scan(&id)
+		if err != nil {
+			log.Println("Error scanning user id: ", id)
+			continue
+		}
+		ids = append(ids, id)
+	}
+
+	rows.Close()
+
+	var ret []data.NodeEdge
+
+	for _, id := range ids {
+		ne, err := pdb.nodeEdge(id, "all")
+		if err != nil {
+			log.Println("Error getting user node for id: ", id)
+			continue
+		}
+
+		n := ne[0].ToNode()
+		u := n.ToUser()
+		if u.Email == email && u.Pass == password {
+			ret = append(ret, ne...)
+		}
+	}
+
+	return ret, nil
+}
+
+// up returns upstream ids for a node
+func (pdb *DbPostgres) up(id string, includeDeleted bool) ([]string, error) {
+	rows, err := pdb.db.Query(`SELECT e.up FROM edges e
+		LEFT JOIN edge_points p ON p.edge_id = e.id AND p.type = $2 AND p.key = ''
+		WHERE e.down = $1 AND ($3 OR COALESCE(p.value, 0) = 0)
+		ORDER BY e.seq`, id, data.PointTypeTombstone, includeDeleted)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ups []string
+
+	for rows.Next() {
+		var up string
+		err := rows.Scan(&up)
+		if err != nil {
+			return nil, err
+		}
+		ups = append(ups, up)
+	}
+
+	return ups, rows.Err()
+}
+
+func (pdb *DbPostgres) historyInsert(retentionID string, points []historyPoint) error {
+	tx, err := pdb.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	for _, p := range points {
+		_, err = tx.Exec(`INSERT INTO history(retention_id, node_id, type, key,
+			time, interval_ns, value, min, max, count, text)
+			VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`,
+			retentionID, p.NodeID, p.Type, p.Key, p.Time.UnixNano(),
+			int64(p.Interval), p.Value, p.Min, p.Max, p.Count, p.Text)
+		if err != nil {
+			rbErr := tx.Rollback()
+			if rbErr != nil {
+				log.Println("Rollback error: ", rbErr)
+			}
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// historyRaw returns raw history points older than before
+func (pdb *DbPostgres) historyRaw(retentionID string, before time.Time) ([]historyPoint, error) {
+	rows, err := pdb.db.Query(`SELECT node_id, type, key, time, value, min, max,
+		count, text FROM history WHERE retention_id=$1 AND interval_ns=0 AND time<$2
+		ORDER BY time`, retentionID, before.UnixNano())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ret []historyPoint
+
+	for rows.Next() {
+		var p historyPoint
+		var t int64
+		err := rows.Scan(&p.NodeID, &p.Type, &p.Key, &t, &p.Value, &p.Min, &p.Max,
+			&p.Count, &p.Text)
+		if err != nil {
+			return nil, err
+		}
+		p.Time = time.Unix(0, t)
+		ret = append(ret, p)
+	}
+
+	return ret, rows.Err()
+}
+
+// historyQuery returns raw and downsampled history points for a node between
+// start and end (inclusive). typ and key are ignored if blank, and a zero end
+// time means there is no end.
+func (pdb *DbPostgres) historyQuery(nodeID, typ, key string, start, end time.Time) ([]historyPoint, error) {
+	q := `SELECT node_id, type, key, time, interval_ns, value, min, max, count, text
+		FROM history WHERE node_id=$1 AND time>=$2`
+	args := []interface{}{nodeID, start.UnixNano()}
+
+	if !end.IsZero() {
+		args = append(args, end.UnixNano())
+		q += fmt.Sprintf(" AND time<=$%v", len(args))
+	}
+
+	if typ != "" {
+		args = append(args, typ)
+		q += fmt.Sprintf(" AND type=$%v", len(args))
+	}
+
+	if key != "" {
+		args = append(args, key)
+		q += fmt.Sprintf(" AND key=$%v", len(args))
+	}
+
+	rows, err := pdb.db.Query(q+" ORDER BY time", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ret []historyPoint
+
+	for rows.Next() {
+		var p historyPoint
+		var t, interval int64
+		err := rows.Scan(&p.NodeID, &p.Type, &p.Key, &t, &interval, &p.Value, &p.Min,
+			&p.Max, &p.Count, &p.Text)
+		if err != nil {
+			return nil, err
+		}
+		p.Time = time.Unix(0, t)
+		p.Interval = time.Duration(interval)
+		ret = append(ret, p)
+	}
+
+	return ret, rows.Err()
+}
+
+// historyDelete deletes raw or downsampled history points older than before
+func (pdb *DbPostgres) historyDelete(retentionID string, raw bool, before time.Time) error {
+	q := "DELETE FROM history WHERE retention_id=$1 AND interval_ns>0 AND time<$2"
+	if raw {
+		q = "DELETE FROM history WHERE retention_id=$1 AND interval_ns=0 AND time<$2"
+	}
+
+	_, err := pdb.db.Exec(q, retentionID, before.UnixNano())
+	return err
+}
+
+// historyBytes returns the approximate size of the history of a retention
+// node
+func (pdb *DbPostgres) historyBytes(retentionID string) (int64, error) {
+	return sqlHistoryBytes(pdb.db, rebindDollar, retentionID)
+}
+
+// snapshot reads all nodes, edges, and optionally history in one transaction
+func (pdb *DbPostgres) snapshot(history bool) (*snapshot, error) {
+	return sqlSnapshot(pdb.db, "seq", history)
+}
+
+// restore replaces all data with a snapshot
+func (pdb *DbPostgres) restore(s *snapshot) error {
+	err := sqlRestore(pdb.db, rebindDollar, s)
+	if err != nil {
+		return err
+	}
+
+	pdb.meta.RootID = s.RootID
+	return nil
+}
+
+// repairEdges deletes edges and writes edge hashes
+func (pdb *DbPostgres) repairEdges(deleteIDs []string, hashes map[string][]byte) error {
+	return sqlRepairEdges(pdb.db, rebindDollar, deleteIDs, hashes)
+}
+
+// purge deletes edges, their points, and node points
+func (pdb *DbPostgres) purge(edgeIDs, nodeIDs []string) error {
+	return sqlPurge(pdb.db, rebindDollar, edgeIDs, nodeIDs)
+}
+
+// purgePoints deletes node points
+func (pdb *DbPostgres) purgePoints(points []pointRef) error {
+	return sqlPurgePoints(pdb.db, rebindDollar, points)
+}
@@ -0,0 +1,92 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+	"github.com/simpleiot/simpleiot/internal/pb"
+	"google.golang.org/protobuf/proto"
+)
+
+// queryNodes returns the nodes below the query parent that match q. The
+// tree is walked breadth first so a node with more than one parent is
+// returned with the parent closest to the query parent.
+func (st *Store) queryNodes(q client.Query) (data.Nodes, error) {
+	filter, err := data.ParseNodeFilter(q.Where)
+	if err != nil {
+		return nil, err
+	}
+
+	parent := q.Parent
+	if parent == "" || parent == "root" {
+		parent = st.db.rootNodeID()
+	}
+
+	var ret data.Nodes
+	seen := map[string]bool{parent: true}
+	level := []string{parent}
+
+	for depth := 1; len(level) > 0 && (q.Depth <= 0 || depth <= q.Depth); depth++ {
+		var next []string
+
+		for _, id := range level {
+			children, err := st.db.children(id, "", false)
+			if err != nil {
+				return nil, fmt.Errorf("Error getting children of %v: %w", id, err)
+			}
+
+			for _, c := range removeArchived(children) {
+				if seen[c.ID] {
+					continue
+				}
+				seen[c.ID] = true
+				next = append(next, c.ID)
+
+				if (q.Type == "" || c.Type == q.Type) && filter.Match(c.Points) {
+					ret = append(ret, c)
+				}
+			}
+		}
+
+		level = next
+	}
+
+	return ret, nil
+}
+
+// handleQuery answers query.nodes requests (see client.QueryNodes)
+func (st *Store) handleQuery(msg *nats.Msg) {
+	resp := &pb.NodesRequest{}
+
+	var q client.Query
+	var nodes data.Nodes
+	err := json.Unmarshal(msg.Data, &q)
+	if err != nil {
+		resp.Error = fmt.Sprintf("Error decoding query: %v", err)
+	} else {
+		nodes, err = st.queryNodes(q)
+		if err != nil {
+			resp.Error = fmt.Sprintf("Error querying nodes: %v", err)
+		}
+	}
+
+	resp.Nodes, err = nodes.ToPbNodes()
+	if err != nil {
+		resp.Error = fmt.Sprintf("Error pb encoding nodes: %v", err)
+	}
+
+	out, err := proto.Marshal(resp)
+	if err != nil {
+		log.Println("Error encoding query response: ", err)
+		return
+	}
+
+	err = st.nc.Publish(msg.Reply, out)
+	if err != nil {
+		log.Println("NATS: Error publishing response to query: ", err)
+	}
+}
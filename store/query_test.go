@@ -0,0 +1,66 @@
+package store
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/simpleiot/simpleiot/client"
+)
+
+func TestQueryNodes(t *testing.T) {
+	nc, st, _ := startBatchTestStore(t, -1)
+
+	root := st.db.rootNodeID()
+
+	nodes := []client.Variable{
+		{ID: "v1", Parent: root, Description: "supply", Value: 30},
+		{ID: "v2", Parent: root, Description: "return", Value: 10},
+		{ID: "v3", Parent: "v1", Description: "room", Value: 25},
+		{ID: "v4", Parent: "v3", Description: "outside", Value: 5},
+	}
+
+	for _, n := range nodes {
+		err := client.SendNodeType(nc, n, "test")
+		if err != nil {
+			t.Fatal("Error sending node: ", err)
+		}
+	}
+
+	ids := func(q client.Query) string {
+		t.Helper()
+		nodes, err := client.QueryNodes(nc, q)
+		if err != nil {
+			t.Fatal("Error querying nodes: ", err)
+		}
+
+		var ret []string
+		for _, n := range nodes {
+			ret = append(ret, n.ID)
+		}
+		sort.Strings(ret)
+		return fmt.Sprint(ret)
+	}
+
+	tests := []struct {
+		q   client.Query
+		exp string
+	}{
+		{client.Query{Type: "variable", Where: "value > 20"}, "[v1 v3]"},
+		{client.Query{Type: "variable", Depth: 1}, "[v1 v2]"},
+		{client.Query{Parent: "v1", Where: "value < 10"}, "[v4]"},
+		{client.Query{Where: `description = "room"`}, "[v3]"},
+		{client.Query{Type: "device"}, "[]"},
+	}
+
+	for _, test := range tests {
+		if got := ids(test.q); got != test.exp {
+			t.Errorf("Query %+v: expected %v, got %v", test.q, test.exp, got)
+		}
+	}
+
+	_, err := client.QueryNodes(nc, client.Query{Where: "value >"})
+	if err == nil {
+		t.Fatal("Expected error for invalid filter")
+	}
+}
@@ -0,0 +1,428 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// ErrOverQuota is returned when writes are rejected because a quota is
+// exceeded
+var ErrOverQuota = errors.New("over quota")
+
+// Quota limits the resources used by the nodes in the subtree of NodeID, for
+// example a tenant or site on a shared upstream server. Quota nodes are
+// created under the root node, and if NodeID is blank, the quota applies to
+// the entire tree. If MaxNodes is set, nodes can't be added to the subtree
+// once it has MaxNodes nodes. If MaxPointRate is set, point writes to nodes
+// in the subtree are limited to MaxPointRate points per second (with bursts
+// of up to one second of points). If MaxHistoryBytes is set, retention nodes
+// in the subtree stop recording history while their history uses more than
+// MaxHistoryBytes. NodeCount, PointRate, and HistoryBytes are the usage,
+// and Rejected is keyed by the usage point type and counts rejected writes.
+// OverQuota points are keyed by the usage point type and set while it is
+// over its limit, so rules can notify when a subtree goes over quota.
+type Quota struct {
+	ID              string  `node:"id"`
+	Parent          string  `node:"parent"`
+	Description     string  `point:"description"`
+	NodeID          string  `point:"nodeID"`
+	MaxNodes        int     `point:"maxNodes"`
+	MaxPointRate    float64 `point:"maxPointRate"`
+	MaxHistoryBytes float64 `point:"maxHistoryBytes"`
+	Disable         bool    `point:"disable"`
+	NodeCount       int     `point:"nodeCount"`
+	PointRate       float64 `point:"pointRate"`
+	HistoryBytes    float64 `point:"historyBytes"`
+}
+
+// how often quota usage is updated
+var quotaCheckPeriod = 10 * time.Second
+
+// quotaState is the usage of a quota tracked by the store, protected by the
+// store lock
+type quotaState struct {
+	config Quota
+	// nodes in the subtree, including the subtree root
+	nodes     map[string]bool
+	nodeCount int
+	// point rate token bucket
+	tokens     float64
+	lastRefill time.Time
+	// points written since the last check
+	points int
+	// rejected writes by usage point type since the last check
+	rejected map[string]int
+	// set when history is over the limit
+	historyOver bool
+}
+
+func (q *quotaState) refill(now time.Time) {
+	max := q.config.MaxPointRate
+	if q.lastRefill.IsZero() {
+		q.tokens = max
+	} else {
+		q.tokens += now.Sub(q.lastRefill).Seconds() * max
+	}
+
+	if q.tokens > max {
+		q.tokens = max
+	}
+
+	q.lastRefill = now
+}
+
+// quotaWrites checks writes against the quotas of the subtrees they are in.
+// Edge writes that add a node to a subtree count as a new node, and node
+// writes count their points. The writes are rejected with ErrOverQuota if
+// any quota is exceeded, otherwise the usage is recorded.
+func (st *Store) quotaWrites(writes []data.TxWrite) error {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+
+	if len(st.quotas) <= 0 {
+		return nil
+	}
+
+	type usage struct {
+		nodes  map[string]bool
+		points int
+	}
+
+	used := make(map[*quotaState]*usage)
+
+	for _, q := range st.quotas {
+		if q.config.Disable {
+			continue
+		}
+
+		u := &usage{nodes: make(map[string]bool)}
+
+		for _, w := range writes {
+			if w.Edge && q.nodes[w.ParentID] && !q.nodes[w.NodeID] &&
+				w.NodeID != q.config.ID && !edgeDeleted(w.Points) {
+				u.nodes[w.NodeID] = true
+			}
+		}
+
+		for _, w := range writes {
+			if !w.Edge && w.NodeID != q.config.ID &&
+				(q.nodes[w.NodeID] || u.nodes[w.NodeID]) {
+				u.points += len(w.Points)
+			}
+		}
+
+		if len(u.nodes) > 0 || u.points > 0 {
+			used[q] = u
+		}
+	}
+
+	now := time.Now()
+
+	for q, u := range used {
+		if q.config.MaxNodes > 0 && len(u.nodes) > 0 &&
+			q.nodeCount+len(u.nodes) > q.config.MaxNodes {
+			q.rejected[data.PointTypeNodeCount]++
+			return fmt.Errorf("%w: %v has %v nodes, max is %v", ErrOverQuota,
+				q.config.Description, q.nodeCount, q.config.MaxNodes)
+		}
+
+		if q.config.MaxPointRate > 0 && u.points > 0 {
+			q.refill(now)
+			if q.tokens < float64(u.points) {
+				q.rejected[data.PointTypePointRate]++
+				return fmt.Errorf("%w: %v is limited to %v points/s", ErrOverQuota,
+					q.config.Description, q.config.MaxPointRate)
+			}
+		}
+	}
+
+	for q, u := range used {
+		if q.config.MaxPointRate > 0 {
+			q.tokens -= float64(u.points)
+		}
+		q.points += u.points
+		q.nodeCount += len(u.nodes)
+		for id := range u.nodes {
+			q.nodes[id] = true
+		}
+	}
+
+	return nil
+}
+
+// quotaPoints checks node points against quotas (see quotaWrites)
+func (st *Store) quotaPoints(nodeID string, points data.Points) error {
+	return st.quotaWrites([]data.TxWrite{{NodeID: nodeID, Points: points}})
+}
+
+// quotaEdgePoints checks edge points against quotas (see quotaWrites)
+func (st *Store) quotaEdgePoints(nodeID, parentID string, points data.Points) error {
+	return st.quotaWrites([]data.TxWrite{{NodeID: nodeID, ParentID: parentID,
+		Edge: true, Points: points}})
+}
+
+// historyOverQuota returns true if a retention node is in a subtree that
+// is over its history quota
+func (st *Store) historyOverQuota(retentionID string) bool {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+
+	for _, q := range st.quotas {
+		if q.historyOver && !q.config.Disable && q.nodes[retentionID] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// edgeDeleted returns true if edge points delete the edge
+func edgeDeleted(points data.Points) bool {
+	for _, p := range points {
+		if p.Type == data.PointTypeTombstone && p.Value != 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// quotaClient updates the usage of a quota node and reports when it goes
+// over quota. The limits are enforced by the store (see quotaWrites).
+type quotaClient struct {
+	nc            *nats.Conn
+	st            *Store
+	config        Quota
+	stop          chan struct{}
+	newPoints     chan client.NewPoints
+	newEdgePoints chan client.NewPoints
+	rejected      map[string]int
+	over          map[string]bool
+	lastCheck     time.Time
+}
+
+func newQuotaClient(nc *nats.Conn, st *Store, config Quota) client.Client {
+	return &quotaClient{
+		nc:            nc,
+		st:            st,
+		config:        config,
+		stop:          make(chan struct{}),
+		newPoints:     make(chan client.NewPoints),
+		newEdgePoints: make(chan client.NewPoints),
+		rejected:      make(map[string]int),
+		over:          make(map[string]bool),
+	}
+}
+
+// Start runs the main logic for this client and blocks until stopped
+func (q *quotaClient) Start() error {
+	log.Println("Starting quota client: ", q.config.Description)
+
+	q.st.lock.Lock()
+	q.st.quotas[q.config.ID] = &quotaState{
+		config:   q.config,
+		nodes:    map[string]bool{q.subtreeID(): true},
+		rejected: make(map[string]int),
+	}
+	q.st.lock.Unlock()
+
+	q.lastCheck = time.Now()
+	q.check()
+
+	checkTicker := time.NewTicker(quotaCheckPeriod)
+	defer checkTicker.Stop()
+
+done:
+	for {
+		select {
+		case <-q.stop:
+			log.Println("Stopping quota client: ", q.config.Description)
+			break done
+		case <-checkTicker.C:
+			q.check()
+		case pts := <-q.newPoints:
+			err := data.MergePoints(pts.ID, pts.Points, &q.config)
+			if err != nil {
+				log.Println("error merging new points: ", err)
+			}
+			q.setConfig()
+
+			for _, p := range pts.Points {
+				if p.Type == data.PointTypeNodeID {
+					q.check()
+				}
+			}
+		case pts := <-q.newEdgePoints:
+			err := data.MergeEdgePoints(pts.ID, pts.Parent, pts.Points, &q.config)
+			if err != nil {
+				log.Println("error merging new points: ", err)
+			}
+			q.setConfig()
+		}
+	}
+
+	q.st.lock.Lock()
+	delete(q.st.quotas, q.config.ID)
+	q.st.lock.Unlock()
+
+	return nil
+}
+
+func (q *quotaClient) setConfig() {
+	q.st.lock.Lock()
+	defer q.st.lock.Unlock()
+
+	if s, ok := q.st.quotas[q.config.ID]; ok {
+		s.config = q.config
+	}
+}
+
+// subtreeID returns the ID of the root of the subtree the quota applies to
+func (q *quotaClient) subtreeID() string {
+	if q.config.NodeID != "" {
+		return q.config.NodeID
+	}
+	return q.config.Parent
+}
+
+// subtree returns the IDs of the nodes in the subtree, including the
+// subtree root, and the IDs of the retention nodes
+func (q *quotaClient) subtree() (map[string]bool, []string, error) {
+	nodes := map[string]bool{q.subtreeID(): true}
+	var retention []string
+
+	level := []string{q.subtreeID()}
+	for len(level) > 0 {
+		var next []string
+		for _, id := range level {
+			children, err := q.st.db.children(id, "", false)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			for _, c := range children {
+				if nodes[c.ID] || c.ID == q.config.ID {
+					continue
+				}
+				nodes[c.ID] = true
+				next = append(next, c.ID)
+				if c.Type == data.NodeTypeRetention {
+					retention = append(retention, c.ID)
+				}
+			}
+		}
+		level = next
+	}
+
+	return nodes, retention, nil
+}
+
+// check updates the usage and sends the usage and over quota points
+func (q *quotaClient) check() {
+	nodes, retention, err := q.subtree()
+	if err != nil {
+		log.Printf("Quota %v: error getting subtree: %v\n", q.config.Description, err)
+		return
+	}
+
+	var historyBytes int64
+	for _, id := range retention {
+		b, err := q.st.db.historyBytes(id)
+		if err != nil {
+			log.Printf("Quota %v: error getting history size: %v\n",
+				q.config.Description, err)
+			continue
+		}
+		historyBytes += b
+	}
+
+	now := time.Now()
+	elapsed := now.Sub(q.lastCheck).Seconds()
+	q.lastCheck = now
+
+	historyOver := q.config.MaxHistoryBytes > 0 &&
+		float64(historyBytes) > q.config.MaxHistoryBytes
+
+	q.st.lock.Lock()
+	s, ok := q.st.quotas[q.config.ID]
+	if !ok {
+		q.st.lock.Unlock()
+		return
+	}
+	s.nodes = nodes
+	s.nodeCount = len(nodes) - 1
+	s.historyOver = historyOver
+	points := s.points
+	s.points = 0
+	rejected := s.rejected
+	s.rejected = make(map[string]int)
+	q.st.lock.Unlock()
+
+	var pointRate float64
+	if elapsed > 0 {
+		pointRate = float64(points) / elapsed
+	}
+
+	over := map[string]bool{
+		data.PointTypeNodeCount: rejected[data.PointTypeNodeCount] > 0 ||
+			(q.config.MaxNodes > 0 && len(nodes)-1 > q.config.MaxNodes),
+		data.PointTypePointRate:    rejected[data.PointTypePointRate] > 0,
+		data.PointTypeHistoryBytes: historyOver,
+	}
+
+	pts := data.Points{
+		{Time: now, Type: data.PointTypeNodeCount, Value: float64(len(nodes) - 1)},
+		{Time: now, Type: data.PointTypePointRate, Value: pointRate},
+		{Time: now, Type: data.PointTypeHistoryBytes, Value: float64(historyBytes)},
+	}
+
+	for key, o := range over {
+		if rejected[key] > 0 {
+			q.rejected[key] += rejected[key]
+			pts = append(pts, data.Point{Time: now, Type: data.PointTypeRejected,
+				Key: key, Value: float64(q.rejected[key])})
+		}
+
+		if o == q.over[key] {
+			continue
+		}
+
+		q.over[key] = o
+		if o {
+			log.Printf("Quota %v: over %v limit\n", q.config.Description, key)
+		} else {
+			log.Printf("Quota %v: %v back under limit\n", q.config.Description, key)
+		}
+
+		pts = append(pts, data.Point{Time: now, Type: data.PointTypeOverQuota,
+			Key: key, Value: data.BoolToFloat(o)})
+	}
+
+	err = client.SendNodePoints(q.nc, q.config.ID, pts, false)
+	if err != nil {
+		log.Println("Quota: error sending usage: ", err)
+	}
+}
+
+// Stop sends a signal to the Start function to exit
+func (q *quotaClient) Stop(err error) {
+	close(q.stop)
+}
+
+// Points is called by the Manager when new points for this
+// node are received.
+func (q *quotaClient) Points(nodeID string, points []data.Point) {
+	q.newPoints <- client.NewPoints{ID: nodeID, Points: points}
+}
+
+// EdgePoints is called by the Manager when new edge points for this
+// node are received.
+func (q *quotaClient) EdgePoints(nodeID, parentID string, points []data.Point) {
+	q.newEdgePoints <- client.NewPoints{ID: nodeID, Parent: parentID, Points: points}
+}
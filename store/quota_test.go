@@ -0,0 +1,170 @@
+package store
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+func TestStoreQuota(t *testing.T) {
+	quotaCheckPeriodSave := quotaCheckPeriod
+	quotaCheckPeriod = 100 * time.Millisecond
+	t.Cleanup(func() { quotaCheckPeriod = quotaCheckPeriodSave })
+
+	nc, st, _ := startBatchTestStore(t, -1)
+	rootID := st.db.rootNodeID()
+
+	err := client.SendNode(nc, data.NodeEdge{ID: "site", Type: data.NodeTypeGroup,
+		Parent: rootID}, "")
+	if err != nil {
+		t.Fatal("Error sending node: ", err)
+	}
+
+	err = client.SendNodeType(nc, Quota{ID: "quota", Parent: rootID, NodeID: "site",
+		MaxNodes: 2}, "")
+	if err != nil {
+		t.Fatal("Error sending quota: ", err)
+	}
+
+	waitQuota := func(check func(q *quotaState) bool) {
+		t.Helper()
+		start := time.Now()
+		for {
+			st.lock.Lock()
+			q, ok := st.quotas["quota"]
+			done := ok && check(q)
+			st.lock.Unlock()
+			if done {
+				return
+			}
+			if time.Since(start) > 5*time.Second {
+				t.Fatal("Timeout waiting for quota")
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+	}
+
+	waitQuota(func(q *quotaState) bool { return q.nodes["site"] })
+
+	for _, id := range []string{"a", "b"} {
+		err := client.SendNode(nc, data.NodeEdge{ID: id, Type: data.NodeTypeVariable,
+			Parent: "site"}, "")
+		if err != nil {
+			t.Fatal("Error sending node under quota: ", err)
+		}
+	}
+
+	err = client.SendNode(nc, data.NodeEdge{ID: "c", Type: data.NodeTypeVariable,
+		Parent: "site"}, "")
+	if err == nil || !strings.Contains(err.Error(), ErrOverQuota.Error()) {
+		t.Fatal("Expected over quota error, got: ", err)
+	}
+
+	// nodes outside the subtree are not limited
+	err = client.SendNode(nc, data.NodeEdge{ID: "d", Type: data.NodeTypeVariable,
+		Parent: rootID}, "")
+	if err != nil {
+		t.Fatal("Error sending node outside quota: ", err)
+	}
+
+	// the over quota event is recorded on the quota node
+	start := time.Now()
+	for {
+		nodes, err := client.GetNode(nc, "quota", rootID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		p, ok := nodes[0].Points.Find(data.PointTypeOverQuota, data.PointTypeNodeCount)
+		if ok && p.Value == 1 {
+			break
+		}
+
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("Timeout waiting for over quota point")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	err = client.SendNodePoint(nc, "quota", data.Point{Type: data.PointTypeMaxPointRate,
+		Value: 5, Origin: "test"}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	waitQuota(func(q *quotaState) bool { return q.config.MaxPointRate == 5 })
+
+	var rejected error
+	for i := 0; i < 10; i++ {
+		err := client.SendNodePoint(nc, "a", data.Point{Type: data.PointTypeValue,
+			Value: float64(i)}, true)
+		if err != nil {
+			rejected = err
+			break
+		}
+	}
+
+	if rejected == nil {
+		t.Fatal("Point rate was not limited")
+	}
+
+	if !strings.Contains(rejected.Error(), ErrOverQuota.Error()) {
+		t.Fatal("Expected over quota error, got: ", rejected)
+	}
+}
+
+func TestQuotaWrites(t *testing.T) {
+	st := &Store{quotas: map[string]*quotaState{
+		"q": {
+			config:   Quota{ID: "q", NodeID: "p", MaxNodes: 1, MaxPointRate: 2},
+			nodes:    map[string]bool{"p": true},
+			rejected: make(map[string]int),
+		},
+	}}
+
+	// deleting an edge is not a new node
+	err := st.quotaEdgePoints("x", "p", data.Points{{Type: data.PointTypeTombstone, Value: 1}})
+	if err != nil {
+		t.Fatal("Delete rejected: ", err)
+	}
+
+	// a node and its points created in one transaction
+	err = st.quotaWrites([]data.TxWrite{
+		{NodeID: "x", ParentID: "p", Edge: true},
+		{NodeID: "x", Points: data.Points{{Type: data.PointTypeValue}}},
+	})
+	if err != nil {
+		t.Fatal("Create rejected: ", err)
+	}
+
+	err = st.quotaEdgePoints("y", "x", nil)
+	if !errors.Is(err, ErrOverQuota) {
+		t.Fatal("Expected nodes over quota, got: ", err)
+	}
+
+	// one of the 2 tokens was used creating x
+	err = st.quotaPoints("x", data.Points{{}, {}})
+	if !errors.Is(err, ErrOverQuota) {
+		t.Fatal("Expected points over quota, got: ", err)
+	}
+
+	// quota node and other nodes are not limited
+	err = st.quotaPoints("q", data.Points{{}, {}, {}})
+	if err != nil {
+		t.Fatal("Quota node points rejected: ", err)
+	}
+
+	err = st.quotaPoints("other", data.Points{{}, {}, {}})
+	if err != nil {
+		t.Fatal("Points outside subtree rejected: ", err)
+	}
+
+	if st.quotas["q"].rejected[data.PointTypeNodeCount] != 1 ||
+		st.quotas["q"].rejected[data.PointTypePointRate] != 1 {
+		t.Fatal("Wrong rejected counts: ", st.quotas["q"].rejected)
+	}
+}
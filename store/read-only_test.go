@@ -0,0 +1,157 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// subscribeUpPoints sends the points of type typ published upstream of
+// nodeID to the returned channel
+func subscribeUpPoints(t *testing.T, nc *nats.Conn, nodeID, typ string) chan data.Point {
+	ret := make(chan data.Point, 100)
+
+	_, err := nc.Subscribe(fmt.Sprintf("up.%v.%v.points", nodeID, nodeID), func(msg *nats.Msg) {
+		pts, err := client.DecodePoints(msg)
+		if err != nil {
+			t.Error("Error decoding points: ", err)
+			return
+		}
+
+		for _, p := range pts {
+			if p.Type == typ {
+				ret <- p
+			}
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return ret
+}
+
+func waitUpPoint(t *testing.T, ch chan data.Point, desc string) data.Point {
+	t.Helper()
+
+	select {
+	case p := <-ch:
+		return p
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timeout waiting for ", desc)
+	}
+
+	return data.Point{}
+}
+
+func TestStoreReadOnly(t *testing.T) {
+	retryPeriod := readOnlyRetryPeriod
+	readOnlyRetryPeriod = 300 * time.Millisecond
+	t.Cleanup(func() { readOnlyRetryPeriod = retryPeriod })
+
+	nc, st, db := startTestStoreParams(t, Params{BatchPeriod: -1})
+	rootID := st.db.rootNodeID()
+
+	err := client.SendNode(nc, data.NodeEdge{
+		ID:     "var",
+		Type:   data.NodeTypeVariable,
+		Parent: rootID,
+	}, "")
+	if err != nil {
+		t.Fatal("Error sending variable node: ", err)
+	}
+
+	states := subscribeUpPoints(t, nc, rootID, data.PointTypeStoreReadOnly)
+	values := subscribeUpPoints(t, nc, "var", data.PointTypeValue)
+
+	sendValue := func(v float64) error {
+		return client.SendNodePoint(nc, "var", data.Point{Type: data.PointTypeValue,
+			Value: v}, true)
+	}
+
+	db.setFail(errors.New("disk full"))
+
+	for i := 0; i < readOnlyErrorThreshold; i++ {
+		if st.isReadOnly() {
+			t.Fatal("Read-only before the error threshold, errors: ", i)
+		}
+
+		if sendValue(float64(i)) == nil {
+			t.Fatal("Write should fail")
+		}
+	}
+
+	if !st.isReadOnly() {
+		t.Fatal("Not read-only after the error threshold")
+	}
+
+	if p := waitUpPoint(t, states, "read-only state"); p.Value != 1 {
+		t.Fatal("Read-only state not set: ", p)
+	}
+
+	// the write that switched to read-only mode is forwarded
+	waitUpPoint(t, values, "value")
+
+	// writes are not attempted until the retry period, but points are
+	// still forwarded upstream
+	count := db.count()
+
+	err = sendValue(42)
+	if err == nil || err.Error() != ErrReadOnly.Error() {
+		t.Fatal("Expected read-only error, got: ", err)
+	}
+
+	if db.count() != count {
+		t.Error("Write attempted in read-only mode")
+	}
+
+	if p := waitUpPoint(t, values, "value"); p.Value != 42 {
+		t.Error("Point not forwarded in read-only mode: ", p)
+	}
+
+	// a write is retried after the retry period
+	time.Sleep(readOnlyRetryPeriod + 100*time.Millisecond)
+
+	if sendValue(43) == nil {
+		t.Fatal("Write should still fail")
+	}
+
+	if db.count() != count+1 {
+		t.Error("Write not retried, batches: ", db.count()-count)
+	}
+
+	if !st.isReadOnly() {
+		t.Fatal("Failed retry should stay read-only")
+	}
+
+	// a successful retry leaves read-only mode
+	db.setFail(nil)
+	time.Sleep(readOnlyRetryPeriod + 100*time.Millisecond)
+
+	err = sendValue(44)
+	if err != nil {
+		t.Fatal("Write should succeed: ", err)
+	}
+
+	if st.isReadOnly() {
+		t.Fatal("Still read-only after a successful write")
+	}
+
+	if p := waitUpPoint(t, states, "read-only state"); p.Value != 0 {
+		t.Fatal("Read-only state not cleared: ", p)
+	}
+
+	nodes, err := client.GetNode(nc, rootID, "")
+	if err != nil || len(nodes) < 1 {
+		t.Fatal("Error getting root node: ", err)
+	}
+
+	if v, ok := nodes[0].Points.Value(data.PointTypeStoreReadOnly, ""); !ok || v != 0 {
+		t.Error("Read-only state not written to the root node: ", v, ok)
+	}
+}
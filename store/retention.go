@@ -0,0 +1,425 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// Retention configures how point history is kept for the nodes under the
+// retention node's parent. Raw points are kept for RawPeriod hours. After
+// that, points are downsampled to min/max/avg per DownsampleInterval minutes,
+// and the downsampled data is kept for DownsamplePeriod days. If
+// DownsampleInterval is 0, raw points are deleted without downsampling. If
+// DownsamplePeriod is 0, downsampled data is kept forever. PointTypes is a
+// comma separated list of point types to record, all points are recorded if
+// it is blank.
+type Retention struct {
+	ID                 string  `node:"id"`
+	Parent             string  `node:"parent"`
+	Description        string  `point:"description"`
+	RawPeriod          float64 `point:"rawPeriod"`
+	DownsampleInterval float64 `point:"downsampleInterval"`
+	DownsamplePeriod   float64 `point:"downsamplePeriod"`
+	PointTypes         string  `point:"pointTypes"`
+	Disable            bool    `point:"disable"`
+	ErrorCount         int     `point:"errorCount"`
+}
+
+// raw period used if none is configured
+var retentionDefaultRawPeriod = 24 * time.Hour
+
+// recorded points are written every retentionFlushPeriod
+var retentionFlushPeriod = time.Second
+
+// how often downsampling runs if no downsample interval is configured
+var retentionMaintainPeriod = 15 * time.Minute
+
+// historyPoint is a point stored in the history table. Raw points have a zero
+// Interval and a Count of 1. Downsampled points cover Interval starting at
+// Time, and Value is the average of the raw points.
+type historyPoint struct {
+	NodeID   string        `json:"nodeId"`
+	Type     string        `json:"type"`
+	Key      string        `json:"key,omitempty"`
+	Time     time.Time     `json:"time"`
+	Interval time.Duration `json:"interval,omitempty"`
+	Value    float64       `json:"value"`
+	Min      float64       `json:"min,omitempty"`
+	Max      float64       `json:"max,omitempty"`
+	Count    int           `json:"count,omitempty"`
+	Text     string        `json:"text,omitempty"`
+}
+
+// size of the numeric fields of a history point, used to estimate how many
+// bytes of history are stored
+const historyPointBytes = 48
+
+// size returns the approximate number of bytes used to store the point
+func (p historyPoint) size() int64 {
+	return int64(historyPointBytes + len(p.NodeID) + len(p.Type) + len(p.Key) +
+		len(p.Text))
+}
+
+// sqlHistoryBytes returns the approximate number of bytes of history stored
+// for a retention node (see historyPoint.size)
+func sqlHistoryBytes(db *sql.DB, rebind func(string) string, retentionID string) (int64, error) {
+	var count, text int64
+	err := db.QueryRow(rebind(`SELECT COUNT(*), COALESCE(SUM(COALESCE(LENGTH(node_id), 0) +
+		COALESCE(LENGTH(type), 0) + COALESCE(LENGTH(key), 0) +
+		COALESCE(LENGTH(text), 0)), 0) FROM history WHERE retention_id=?`),
+		retentionID).Scan(&count, &text)
+	if err != nil {
+		return 0, err
+	}
+
+	return count*historyPointBytes + text, nil
+}
+
+// downsample groups points by node, type, key, and interval and returns the
+// min/max/avg for each group. Text is not kept.
+func downsample(points []historyPoint, interval time.Duration) []historyPoint {
+	type bucket struct {
+		nodeID, typ, key string
+		time             time.Time
+	}
+
+	var order []bucket
+	sums := make(map[bucket]float64)
+	groups := make(map[bucket]*historyPoint)
+
+	for _, p := range points {
+		b := bucket{p.NodeID, p.Type, p.Key, p.Time.Truncate(interval)}
+
+		d, ok := groups[b]
+		if !ok {
+			d = &historyPoint{
+				NodeID:   p.NodeID,
+				Type:     p.Type,
+				Key:      p.Key,
+				Time:     b.time,
+				Interval: interval,
+				Min:      p.Min,
+				Max:      p.Max,
+			}
+			groups[b] = d
+			order = append(order, b)
+		}
+
+		if p.Min < d.Min {
+			d.Min = p.Min
+		}
+
+		if p.Max > d.Max {
+			d.Max = p.Max
+		}
+
+		sums[b] += p.Value * float64(p.Count)
+		d.Count += p.Count
+	}
+
+	sort.Slice(order, func(i, j int) bool {
+		a, b := order[i], order[j]
+		if a.nodeID != b.nodeID {
+			return a.nodeID < b.nodeID
+		}
+		if a.typ != b.typ {
+			return a.typ < b.typ
+		}
+		if a.key != b.key {
+			return a.key < b.key
+		}
+		return a.time.Before(b.time)
+	})
+
+	ret := make([]historyPoint, len(order))
+	for i, b := range order {
+		d := groups[b]
+		d.Value = sums[b] / float64(d.Count)
+		ret[i] = *d
+	}
+
+	return ret
+}
+
+// retentionClient records points for the nodes under a retention node's
+// parent and downsamples and deletes old history.
+type retentionClient struct {
+	nc            *nats.Conn
+	db            backend
+	config        Retention
+	stop          chan struct{}
+	newPoints     chan client.NewPoints
+	newEdgePoints chan client.NewPoints
+	newUpPoints   chan client.NewPoints
+	pointTypes    map[string]bool
+	points        []historyPoint
+	// overQuota returns true if history is over quota (see Quota)
+	overQuota func(retentionID string) bool
+}
+
+func newRetentionClient(nc *nats.Conn, db backend, config Retention,
+	overQuota func(retentionID string) bool) client.Client {
+	return &retentionClient{
+		nc:            nc,
+		db:            db,
+		config:        config,
+		overQuota:     overQuota,
+		stop:          make(chan struct{}),
+		newPoints:     make(chan client.NewPoints),
+		newEdgePoints: make(chan client.NewPoints),
+		newUpPoints:   make(chan client.NewPoints),
+	}
+}
+
+// Start runs the main logic for this client and blocks until stopped
+func (r *retentionClient) Start() error {
+	log.Println("Starting retention client: ", r.config.Description)
+
+	bufOpts := client.BufferOptions{
+		Size:          10000,
+		Policy:        client.BufferDropOldest,
+		MetricsNodeID: r.config.ID,
+	}
+
+	handler := func(subject string, points data.Points) {
+		chunks := strings.Split(subject, ".")
+		if len(chunks) < 3 {
+			log.Println("Retention up sub, malformed subject: ", subject)
+			return
+		}
+
+		// don't record our own stats
+		if chunks[2] == r.config.ID {
+			return
+		}
+
+		select {
+		case r.newUpPoints <- client.NewPoints{ID: chunks[2], Points: points}:
+		case <-r.stop:
+		}
+	}
+
+	upSub, err := client.NewBufferedSub(r.nc, fmt.Sprintf("up.%v.*.points", r.config.Parent),
+		bufOpts, handler)
+	if err != nil {
+		return fmt.Errorf("Retention error subscribing to upsub: %v", err)
+	}
+
+	upSubHr, err := client.NewBufferedSub(r.nc, fmt.Sprintf("phrup.%v.*", r.config.Parent),
+		bufOpts, handler)
+	if err != nil {
+		upSub.Stop()
+		return fmt.Errorf("Retention error subscribing to upSubHr: %v", err)
+	}
+
+	r.configure()
+
+	flushTicker := time.NewTicker(retentionFlushPeriod)
+	defer flushTicker.Stop()
+
+	maintainTicker := time.NewTicker(r.maintainPeriod())
+	defer maintainTicker.Stop()
+
+	maintain := func() {
+		if r.config.Disable {
+			return
+		}
+
+		err := r.maintain(time.Now())
+		if err != nil {
+			log.Printf("Retention %v: error downsampling history: %v\n",
+				r.config.Description, err)
+			r.sendErrorCount()
+		}
+	}
+
+	maintain()
+
+done:
+	for {
+		select {
+		case <-r.stop:
+			log.Println("Stopping retention client: ", r.config.Description)
+			break done
+		case <-flushTicker.C:
+			r.flush()
+		case <-maintainTicker.C:
+			maintain()
+		case pts := <-r.newPoints:
+			err := data.MergePoints(pts.ID, pts.Points, &r.config)
+			if err != nil {
+				log.Println("error merging new points: ", err)
+			}
+
+			for _, p := range pts.Points {
+				switch p.Type {
+				case data.PointTypePointTypes:
+					r.configure()
+				case data.PointTypeDownsampleInterval:
+					maintainTicker.Reset(r.maintainPeriod())
+				}
+			}
+		case pts := <-r.newEdgePoints:
+			err := data.MergeEdgePoints(pts.ID, pts.Parent, pts.Points, &r.config)
+			if err != nil {
+				log.Println("error merging new points: ", err)
+			}
+		case pts := <-r.newUpPoints:
+			if r.config.Disable {
+				continue
+			}
+
+			for _, p := range pts.Points {
+				if len(r.pointTypes) > 0 && !r.pointTypes[p.Type] {
+					continue
+				}
+				r.points = append(r.points, historyPoint{
+					NodeID: pts.ID,
+					Type:   p.Type,
+					Key:    p.Key,
+					Time:   p.Time,
+					Value:  p.Value,
+					Min:    p.Value,
+					Max:    p.Value,
+					Count:  1,
+					Text:   p.Text,
+				})
+			}
+		}
+	}
+
+	upSub.Stop()
+	upSubHr.Stop()
+	r.flush()
+
+	return nil
+}
+
+func (r *retentionClient) configure() {
+	r.pointTypes = make(map[string]bool)
+	for _, t := range strings.Split(r.config.PointTypes, ",") {
+		t = strings.TrimSpace(t)
+		if t != "" {
+			r.pointTypes[t] = true
+		}
+	}
+}
+
+func (r *retentionClient) rawPeriod() time.Duration {
+	if r.config.RawPeriod <= 0 {
+		return retentionDefaultRawPeriod
+	}
+	return time.Duration(r.config.RawPeriod * float64(time.Hour))
+}
+
+func (r *retentionClient) downsampleInterval() time.Duration {
+	return time.Duration(r.config.DownsampleInterval * float64(time.Minute))
+}
+
+// maintainPeriod returns how often history is downsampled. This matches the
+// downsample interval so that each run typically handles one interval.
+func (r *retentionClient) maintainPeriod() time.Duration {
+	if i := r.downsampleInterval(); i >= time.Minute {
+		return i
+	}
+	return retentionMaintainPeriod
+}
+
+// flush writes recorded points to the db. Points are dropped on error so
+// that a failing db does not use up all memory, and while the history of
+// the subtree is over quota.
+func (r *retentionClient) flush() {
+	if len(r.points) <= 0 {
+		return
+	}
+
+	if r.overQuota != nil && r.overQuota(r.config.ID) {
+		r.points = nil
+		return
+	}
+
+	err := r.db.historyInsert(r.config.ID, r.points)
+	r.points = nil
+	if err != nil {
+		log.Printf("Retention %v: error writing history: %v\n",
+			r.config.Description, err)
+		r.sendErrorCount()
+	}
+}
+
+// maintain downsamples raw points older than the raw period and deletes
+// downsampled points older than the downsample period. Downsampled points
+// are written before raw points are deleted, so an interruption leaves
+// duplicate data rather than losing it.
+func (r *retentionClient) maintain(now time.Time) error {
+	cutoff := now.Add(-r.rawPeriod())
+
+	if interval := r.downsampleInterval(); interval > 0 {
+		// only downsample complete intervals
+		cutoff = cutoff.Truncate(interval)
+
+		raw, err := r.db.historyRaw(r.config.ID, cutoff)
+		if err != nil {
+			return err
+		}
+
+		if len(raw) > 0 {
+			err = r.db.historyInsert(r.config.ID, downsample(raw, interval))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	err := r.db.historyDelete(r.config.ID, true, cutoff)
+	if err != nil {
+		return err
+	}
+
+	if r.config.DownsamplePeriod > 0 {
+		period := time.Duration(r.config.DownsamplePeriod * float64(24*time.Hour))
+		err = r.db.historyDelete(r.config.ID, false, now.Add(-period))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *retentionClient) sendErrorCount() {
+	r.config.ErrorCount++
+	err := client.SendNodePoint(r.nc, r.config.ID, data.Point{
+		Time:  time.Now(),
+		Type:  data.PointTypeErrorCount,
+		Value: float64(r.config.ErrorCount),
+	}, false)
+	if err != nil {
+		log.Println("Retention: error sending stat: ", err)
+	}
+}
+
+// Stop sends a signal to the Start function to exit
+func (r *retentionClient) Stop(err error) {
+	close(r.stop)
+}
+
+// Points is called by the Manager when new points for this
+// node are received.
+func (r *retentionClient) Points(nodeID string, points []data.Point) {
+	r.newPoints <- client.NewPoints{ID: nodeID, Points: points}
+}
+
+// EdgePoints is called by the Manager when new edge points for this
+// node are received.
+func (r *retentionClient) EdgePoints(nodeID, parentID string, points []data.Point) {
+	r.newEdgePoints <- client.NewPoints{ID: nodeID, Parent: parentID, Points: points}
+}
@@ -0,0 +1,301 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	natsserver "github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+func TestDownsample(t *testing.T) {
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	raw := func(id string, offset time.Duration, v float64) historyPoint {
+		return historyPoint{NodeID: id, Type: data.PointTypeValue,
+			Time: start.Add(offset), Value: v, Min: v, Max: v, Count: 1}
+	}
+
+	points := []historyPoint{
+		raw("b", 0, 5),
+		raw("a", time.Minute, 1),
+		raw("a", 2*time.Minute, 3),
+		raw("a", 16*time.Minute, 10),
+		raw("a", 3*time.Minute, 8),
+	}
+
+	ds := downsample(points, 15*time.Minute)
+
+	if len(ds) != 3 {
+		t.Fatal("Expected 3 downsampled points, got: ", ds)
+	}
+
+	exp := []historyPoint{
+		{NodeID: "a", Type: data.PointTypeValue, Time: start,
+			Interval: 15 * time.Minute, Value: 4, Min: 1, Max: 8, Count: 3},
+		{NodeID: "a", Type: data.PointTypeValue, Time: start.Add(15 * time.Minute),
+			Interval: 15 * time.Minute, Value: 10, Min: 10, Max: 10, Count: 1},
+		{NodeID: "b", Type: data.PointTypeValue, Time: start,
+			Interval: 15 * time.Minute, Value: 5, Min: 5, Max: 5, Count: 1},
+	}
+
+	for i := range exp {
+		if ds[i] != exp[i] {
+			t.Errorf("Point %v: expected %+v, got %+v", i, exp[i], ds[i])
+		}
+	}
+
+	// downsampled points can be downsampled again, the average is weighted
+	// by count
+	ds = downsample(ds[:2], time.Hour)
+	if len(ds) != 1 || ds[0].Value != 5.5 || ds[0].Count != 4 ||
+		ds[0].Min != 1 || ds[0].Max != 10 {
+		t.Error("Downsampling downsampled points failed: ", ds)
+	}
+}
+
+// testBackendHistory runs history tests that are common to all backends
+func testBackendHistory(t *testing.T, db backend) {
+	now := time.Now()
+
+	points := []historyPoint{
+		{NodeID: "n", Type: data.PointTypeValue, Time: now.Add(-2 * time.Hour),
+			Value: 1, Min: 1, Max: 1, Count: 1, Text: "old"},
+		{NodeID: "n", Type: data.PointTypeValue, Time: now.Add(-time.Minute),
+			Value: 2, Min: 2, Max: 2, Count: 1},
+		{NodeID: "n", Type: data.PointTypeValue, Time: now.Add(-3 * time.Hour),
+			Interval: time.Hour, Value: 3, Min: 2, Max: 4, Count: 10},
+	}
+
+	err := db.historyInsert("r1", points)
+	if err != nil {
+		t.Fatal("Error inserting history: ", err)
+	}
+
+	err = db.historyInsert("r2", points[:1])
+	if err != nil {
+		t.Fatal("Error inserting history: ", err)
+	}
+
+	hps, err := db.historyQuery("n", data.PointTypeValue, "", now.Add(-150*time.Minute), time.Time{})
+	if err != nil {
+		t.Fatal("Error querying history: ", err)
+	}
+
+	// the point for r2 is a duplicate and is returned for both retention nodes
+	if len(hps) != 3 || hps[0].Text != "old" || hps[2].Value != 2 {
+		t.Fatal("Wrong history query result: ", hps)
+	}
+
+	hps, _ = db.historyQuery("n", "", "", now.Add(-4*time.Hour), now.Add(-90*time.Minute))
+	if len(hps) != 3 || hps[0].Interval != time.Hour {
+		t.Fatal("Wrong history query result with end time: ", hps)
+	}
+
+	hps, _ = db.historyQuery("n", data.PointTypeDescription, "", time.Time{}, time.Time{})
+	if len(hps) != 0 {
+		t.Fatal("History query did not filter by type: ", hps)
+	}
+
+	raw, err := db.historyRaw("r1", now.Add(-time.Hour))
+	if err != nil {
+		t.Fatal("Error reading history: ", err)
+	}
+
+	if len(raw) != 1 || raw[0].Text != "old" || !raw[0].Time.Equal(points[0].Time) {
+		t.Fatal("Wrong raw history: ", raw)
+	}
+
+	// deleting raw points leaves downsampled points and other retention
+	// nodes alone
+	err = db.historyDelete("r1", true, now)
+	if err != nil {
+		t.Fatal("Error deleting history: ", err)
+	}
+
+	raw, _ = db.historyRaw("r1", now)
+	if len(raw) != 0 {
+		t.Error("Raw points not deleted: ", raw)
+	}
+
+	raw, _ = db.historyRaw("r2", now)
+	if len(raw) != 1 {
+		t.Error("Points for other retention node deleted: ", raw)
+	}
+
+	err = db.historyDelete("r1", false, now)
+	if err != nil {
+		t.Fatal("Error deleting history: ", err)
+	}
+}
+
+func TestDbSqliteHistory(t *testing.T) {
+	db := newTestDb(t)
+	defer db.Close()
+
+	testBackendHistory(t, db)
+}
+
+func TestMemoryBackendHistory(t *testing.T) {
+	testBackendHistory(t, newTestMemoryBackend(t))
+}
+
+func TestRetentionMaintain(t *testing.T) {
+	db := newTestMemoryBackend(t)
+
+	r := &retentionClient{db: db, config: Retention{
+		ID:                 "r",
+		RawPeriod:          1,
+		DownsampleInterval: 60,
+		DownsamplePeriod:   1,
+	}}
+
+	now := time.Date(2023, 1, 2, 10, 30, 0, 0, time.UTC)
+
+	var points []historyPoint
+	// one point per 10m for the last 2 days
+	for d := time.Duration(0); d < 48*time.Hour; d += 10 * time.Minute {
+		points = append(points, historyPoint{NodeID: "n", Type: data.PointTypeValue,
+			Time: now.Add(-d), Value: 1, Min: 1, Max: 1, Count: 1})
+	}
+
+	err := db.historyInsert("r", points)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = r.maintain(now)
+	if err != nil {
+		t.Fatal("maintain error: ", err)
+	}
+
+	var raw, ds []historyPoint
+	for _, p := range db.history["r"] {
+		if p.Interval == 0 {
+			raw = append(raw, p)
+		} else {
+			ds = append(ds, p)
+		}
+	}
+
+	// raw points from 9:00 on are kept as that interval is not complete
+	if len(raw) != 10 {
+		t.Error("Expected 10 raw points, got: ", len(raw))
+	}
+
+	for _, p := range raw {
+		if p.Time.Before(time.Date(2023, 1, 2, 9, 0, 0, 0, time.UTC)) {
+			t.Error("Old raw point not deleted: ", p.Time)
+		}
+	}
+
+	// intervals starting after 10:30 the previous day up to 9:00 are kept
+	if len(ds) != 22 {
+		t.Error("Expected 22 downsampled points, got: ", len(ds))
+	}
+
+	for _, p := range ds {
+		if p.Count != 6 || p.Value != 1 {
+			t.Error("Wrong downsampled point: ", p)
+		}
+	}
+}
+
+func TestRetentionRecord(t *testing.T) {
+	ns, err := natsserver.NewServer(&natsserver.Options{Port: -1, NoSigs: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go ns.Start()
+	defer ns.Shutdown()
+
+	if !ns.ReadyForConnections(5 * time.Second) {
+		t.Fatal("NATS server not ready")
+	}
+
+	nc, err := nats.Connect(ns.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+
+	st, err := NewStore(Params{File: MemoryStoreFile, Nc: nc})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		st.Start()
+		close(stopped)
+	}()
+	defer func() {
+		st.Stop(nil)
+		<-stopped
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	err = st.WaitStart(ctx)
+	cancel()
+	if err != nil {
+		t.Fatal("Error waiting for store: ", err)
+	}
+
+	db := st.db.(*MemoryBackend)
+	rootID := db.rootNodeID()
+
+	err = client.SendNode(nc, data.NodeEdge{
+		ID:     "ret",
+		Type:   data.NodeTypeRetention,
+		Parent: rootID,
+		Points: data.Points{
+			{Type: data.PointTypePointTypes, Text: data.PointTypeValue},
+		},
+	}, "")
+	if err != nil {
+		t.Fatal("Error sending retention node: ", err)
+	}
+
+	err = client.SendNode(nc, data.NodeEdge{
+		ID:     "var",
+		Type:   data.NodeTypeVariable,
+		Parent: rootID,
+	}, "")
+	if err != nil {
+		t.Fatal("Error sending variable node: ", err)
+	}
+
+	// wait for the retention client to start
+	var raw []historyPoint
+	timeout := time.After(5 * time.Second)
+
+	for i := 0; len(raw) <= 0; i++ {
+		select {
+		case <-timeout:
+			t.Fatal("Timeout waiting for history")
+		case <-time.After(100 * time.Millisecond):
+		}
+
+		err = client.SendNodePoints(nc, "var", data.Points{
+			{Type: data.PointTypeValue, Value: float64(i)},
+			{Type: data.PointTypeDescription, Text: "not recorded"},
+		}, true)
+		if err != nil {
+			t.Fatal("Error sending points: ", err)
+		}
+
+		raw, err = db.historyRaw("ret", time.Now().Add(time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, p := range raw {
+		if p.NodeID != "var" || p.Type != data.PointTypeValue {
+			t.Error("Wrong point recorded: ", p)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// how long the schema mode read from the root node is cached. The cache is
+// also cleared when a schemaMode point on the root node is written.
+var schemaModeCheckPeriod = time.Minute
+
+// schemaValidation returns the schema validation mode set by the schemaMode
+// point on the root device node. Validation is off if it is not set.
+func (st *Store) schemaValidation() string {
+	st.lock.Lock()
+	if time.Since(st.schemaCheck) < schemaModeCheckPeriod {
+		defer st.lock.Unlock()
+		return st.schemaMode
+	}
+	st.lock.Unlock()
+
+	mode := data.SchemaModeOff
+
+	root, err := st.db.node(st.db.rootNodeID())
+	if err != nil {
+		log.Println("Error getting schema mode: ", err)
+	} else if m, ok := root.Points.Text(data.PointTypeSchemaMode, ""); ok && m != "" {
+		mode = m
+	}
+
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	st.schemaMode = mode
+	st.schemaCheck = time.Now()
+
+	return mode
+}
+
+// clearSchemaMode is called when points are written to the root node so
+// that mode changes are used right away
+func (st *Store) clearSchemaMode(points data.Points) {
+	for _, p := range points {
+		if p.Type == data.PointTypeSchemaMode {
+			st.lock.Lock()
+			st.schemaCheck = time.Time{}
+			st.lock.Unlock()
+			return
+		}
+	}
+}
+
+// validate checks points written to a node against the schema registered
+// for the node type (see data.RegisterSchema). In reject mode an error is
+// returned for the first invalid point. In flag mode invalid points are
+// still written along with a schemaError point for each, where the key is
+// the invalid point type, and the schemaError point is cleared when a valid
+// point of that type is written.
+func (st *Store) validate(nodeID string, points data.Points) (data.Points, error) {
+	mode := st.schemaValidation()
+	if mode != data.SchemaModeFlag && mode != data.SchemaModeReject {
+		return points, nil
+	}
+
+	nodeType := ""
+	for _, p := range points {
+		if p.Type == data.PointTypeNodeType {
+			nodeType = p.Text
+		}
+	}
+
+	var stored data.Points
+	node, err := st.db.node(nodeID)
+	if err == nil {
+		// the node does not exist yet if it is being created
+		stored = node.Points
+		if nodeType == "" {
+			nodeType = node.Type
+		}
+	}
+
+	schema, ok := data.LookupSchema(nodeType)
+	if !ok {
+		return points, nil
+	}
+
+	var flags data.Points
+
+	for _, p := range points {
+		ps, ok := schema.Point(p.Type)
+		if !ok {
+			continue
+		}
+
+		t := p.Time
+		if t.IsZero() {
+			t = time.Now()
+		}
+
+		err := ps.Validate(p)
+		if err != nil {
+			if mode == data.SchemaModeReject {
+				return nil, fmt.Errorf("rejected point for %v node %v: %w",
+					nodeType, nodeID, err)
+			}
+
+			flags = append(flags, data.Point{Time: t, Type: data.PointTypeSchemaError,
+				Key: p.Type, Text: err.Error()})
+			continue
+		}
+
+		if flagged(stored, p.Type) {
+			flags = append(flags, data.Point{Time: t, Type: data.PointTypeSchemaError,
+				Key: p.Type, Tombstone: 1})
+		}
+	}
+
+	if len(flags) <= 0 {
+		return points, nil
+	}
+
+	ret := make(data.Points, 0, len(points)+len(flags))
+	ret = append(ret, points...)
+	return append(ret, flags...), nil
+}
+
+// flagged returns true if stored has a schema error for a point type
+func flagged(stored data.Points, typ string) bool {
+	for _, p := range stored {
+		if p.Type == data.PointTypeSchemaError && p.Key == typ {
+			return p.Tombstone%2 == 0
+		}
+	}
+
+	return false
+}
+
+// handleSchemas replies with the registered point schemas
+func (st *Store) handleSchemas(msg *nats.Msg) {
+	resp := client.SchemasResponse{Schemas: data.Schemas()}
+
+	d, err := json.Marshal(resp)
+	if err != nil {
+		log.Println("Error encoding schemas response: ", err)
+		return
+	}
+
+	err = st.nc.Publish(msg.Reply, d)
+	if err != nil {
+		log.Println("Error sending schemas response: ", err)
+	}
+}
@@ -0,0 +1,135 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+type schemaTest struct {
+	ID     string  `node:"id"`
+	Parent string  `node:"parent"`
+	Level  float64 `point:"level"`
+}
+
+func TestStoreSchemaValidation(t *testing.T) {
+	nc, st, _ := startBatchTestStore(t, -1)
+
+	data.RegisterSchema(data.NodeSchema{NodeType: "schemaTest", Points: []data.PointSchema{
+		data.PointSchema{Type: data.PointTypeLevel, Kind: data.PointKindValue}.WithRange(0, 100),
+	}})
+
+	root := st.db.rootNodeID()
+
+	err := client.SendNodeType(nc, schemaTest{ID: "s", Parent: root, Level: 10}, "test")
+	if err != nil {
+		t.Fatal("Error sending node: ", err)
+	}
+
+	send := func(v float64) error {
+		t.Helper()
+		return client.SendNodePoint(nc, "s", data.Point{Time: time.Now(),
+			Type: data.PointTypeLevel, Value: v}, true)
+	}
+
+	setMode := func(mode string) {
+		t.Helper()
+		err := client.SendNodePoint(nc, root, data.Point{Type: data.PointTypeSchemaMode,
+			Text: mode}, true)
+		if err != nil {
+			t.Fatal("Error setting schema mode: ", err)
+		}
+	}
+
+	level := func() float64 {
+		t.Helper()
+		node, err := st.db.node("s")
+		if err != nil {
+			t.Fatal(err)
+		}
+		v, _ := node.Points.Value(data.PointTypeLevel, "")
+		return v
+	}
+
+	schemaError := func() string {
+		t.Helper()
+		node, err := st.db.node("s")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, p := range node.Points {
+			if p.Type == data.PointTypeSchemaError && p.Key == data.PointTypeLevel &&
+				p.Tombstone == 0 {
+				return p.Text
+			}
+		}
+		return ""
+	}
+
+	// validation is off by default
+	if err := send(150); err != nil {
+		t.Fatal("Point rejected with validation off: ", err)
+	}
+
+	setMode(data.SchemaModeReject)
+
+	if err := send(200); err == nil {
+		t.Error("Out of range point was not rejected")
+	}
+
+	if level() != 150 {
+		t.Error("Rejected point was written: ", level())
+	}
+
+	if err := send(50); err != nil {
+		t.Fatal("Valid point rejected: ", err)
+	}
+
+	setMode(data.SchemaModeFlag)
+
+	if err := send(-1); err != nil {
+		t.Fatal("Point rejected in flag mode: ", err)
+	}
+
+	if level() != -1 {
+		t.Error("Flagged point was not written: ", level())
+	}
+
+	if schemaError() == "" {
+		t.Error("Invalid point was not flagged")
+	}
+
+	if err := send(20); err != nil {
+		t.Fatal("Error sending valid point: ", err)
+	}
+
+	if e := schemaError(); e != "" {
+		t.Error("Schema error was not cleared: ", e)
+	}
+}
+
+func TestStoreSchemas(t *testing.T) {
+	nc, _, _ := startBatchTestStore(t, -1)
+
+	data.RegisterSchema(data.NodeSchema{NodeType: "schemaTest", Points: []data.PointSchema{
+		{Type: data.PointTypeLevel, Kind: data.PointKindValue},
+	}})
+
+	schemas, err := client.GetSchemas(nc)
+	if err != nil {
+		t.Fatal("Error getting schemas: ", err)
+	}
+
+	found := false
+	for _, s := range schemas {
+		if s.NodeType == "schemaTest" {
+			found = len(s.Points) == 1 && s.Points[0].Type == data.PointTypeLevel
+		}
+	}
+
+	if !found {
+		t.Error("Registered schema not returned: ", schemas)
+	}
+}
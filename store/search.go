@@ -0,0 +1,304 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+	"github.com/simpleiot/simpleiot/internal/pb"
+	"google.golang.org/protobuf/proto"
+)
+
+// searchIndex is an in-memory index of the type, description, and text
+// points of the nodes in the tree. It is built on the first search after
+// nodes are added, moved, or deleted, and entries are updated as text
+// points are written.
+type searchIndex struct {
+	lock    sync.Mutex
+	built   bool
+	entries map[string]*searchEntry
+}
+
+// searchEntry is the lower case searchable text of a node
+type searchEntry struct {
+	id     string
+	parent string
+	desc   string
+	text   string
+}
+
+func newSearchEntry(id, parent, typ string, points data.Points) *searchEntry {
+	ret := &searchEntry{id: id, parent: parent}
+	ret.update(typ, points)
+	return ret
+}
+
+// update indexes the text points of a node. Sensitive points are not
+// indexed.
+func (e *searchEntry) update(typ string, points data.Points) {
+	var text []string
+	if typ != "" {
+		text = append(text, typ)
+	}
+
+	e.desc = ""
+
+	for _, p := range points {
+		if p.Text == "" || p.Tombstone%2 == 1 || data.IsSensitive(p.Type) {
+			continue
+		}
+
+		t := strings.ToLower(p.Text)
+		if p.Type == data.PointTypeDescription && e.desc == "" {
+			e.desc = t
+			continue
+		}
+
+		text = append(text, t)
+	}
+
+	e.text = strings.Join(text, " ")
+}
+
+// score returns how well the entry matches the terms, or 0 if a term is
+// not found. Matches in the description score higher.
+func (e *searchEntry) score(terms []string) int {
+	ret := 0
+
+	for _, t := range terms {
+		switch {
+		case strings.Contains(e.desc, t):
+			ret += 2
+		case strings.Contains(e.text, t):
+			ret++
+		default:
+			return 0
+		}
+	}
+
+	if e.desc == strings.Join(terms, " ") {
+		ret += len(terms)
+	}
+
+	return ret
+}
+
+// clearSearch causes the search index to be rebuilt on the next search. It
+// is called when edges change.
+func (st *Store) clearSearch() {
+	st.search.lock.Lock()
+	st.search.built = false
+	st.search.entries = nil
+	st.search.lock.Unlock()
+}
+
+// updateSearch updates the search entry of a node after text points are
+// written to it
+func (st *Store) updateSearch(node *data.Node, points data.Points) {
+	text := false
+	for _, p := range points {
+		if p.Text != "" || p.Type == data.PointTypeDescription {
+			text = true
+			break
+		}
+	}
+
+	if !text {
+		return
+	}
+
+	st.search.lock.Lock()
+	defer st.search.lock.Unlock()
+
+	if e, ok := st.search.entries[node.ID]; ok {
+		e.update(node.Type, node.Points)
+	}
+}
+
+// buildSearch walks the tree and indexes every node that is not deleted.
+// It must be called with the search lock held.
+func (st *Store) buildSearch() error {
+	root := st.db.rootNodeID()
+
+	rootNode, err := st.db.node(root)
+	if err != nil {
+		return fmt.Errorf("Error getting root node: %w", err)
+	}
+
+	entries := map[string]*searchEntry{
+		root: newSearchEntry(root, "", rootNode.Type, rootNode.Points),
+	}
+	level := []string{root}
+
+	for len(level) > 0 {
+		var next []string
+
+		for _, id := range level {
+			children, err := st.db.children(id, "", false)
+			if err != nil {
+				return fmt.Errorf("Error getting children of %v: %w", id, err)
+			}
+
+			for _, c := range children {
+				if _, ok := entries[c.ID]; ok {
+					continue
+				}
+
+				entries[c.ID] = newSearchEntry(c.ID, c.Parent, c.Type, c.Points)
+				next = append(next, c.ID)
+			}
+		}
+
+		level = next
+	}
+
+	st.search.entries = entries
+	st.search.built = true
+
+	return nil
+}
+
+// isBelow returns true if parent is id or one of its ancestors
+func (st *Store) isBelow(id, parent string) bool {
+	seen := make(map[string]bool)
+	level := []string{id}
+
+	for len(level) > 0 {
+		var next []string
+
+		for _, n := range level {
+			if n == parent {
+				return true
+			}
+
+			if seen[n] {
+				continue
+			}
+			seen[n] = true
+
+			ups, err := st.db.up(n, false)
+			if err != nil {
+				return false
+			}
+
+			next = append(next, ups...)
+		}
+
+		level = next
+	}
+
+	return false
+}
+
+// searchNodes returns the nodes whose type, description, or text points
+// contain all words of the query, best matches first (see client.Search)
+func (st *Store) searchNodes(req client.SearchRequest) (data.Nodes, error) {
+	terms := strings.Fields(strings.ToLower(req.Query))
+	if len(terms) == 0 {
+		return nil, nil
+	}
+
+	limit := req.Limit
+	if limit <= 0 {
+		limit = client.DefaultSearchLimit
+	}
+
+	parent := req.Parent
+	if parent == "root" {
+		parent = st.db.rootNodeID()
+	}
+
+	type match struct {
+		entry searchEntry
+		score int
+	}
+
+	var matches []match
+
+	st.search.lock.Lock()
+	if !st.search.built {
+		err := st.buildSearch()
+		if err != nil {
+			st.search.lock.Unlock()
+			return nil, err
+		}
+	}
+
+	for _, e := range st.search.entries {
+		if s := e.score(terms); s > 0 {
+			matches = append(matches, match{*e, s})
+		}
+	}
+	st.search.lock.Unlock()
+
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].score != matches[j].score {
+			return matches[i].score > matches[j].score
+		}
+		if matches[i].entry.desc != matches[j].entry.desc {
+			return matches[i].entry.desc < matches[j].entry.desc
+		}
+		return matches[i].entry.id < matches[j].entry.id
+	})
+
+	var ret data.Nodes
+
+	for _, m := range matches {
+		if len(ret) >= limit {
+			break
+		}
+
+		if parent != "" && !st.isBelow(m.entry.id, parent) {
+			continue
+		}
+
+		nodes, err := st.db.nodeEdge(m.entry.id, m.entry.parent)
+		if err != nil || len(nodes) < 1 {
+			// the node was removed since the index was built
+			continue
+		}
+
+		ret = append(ret, nodes[0])
+	}
+
+	return ret, nil
+}
+
+// handleSearch answers query.search requests (see client.Search)
+func (st *Store) handleSearch(msg *nats.Msg) {
+	resp := &pb.NodesRequest{}
+
+	var req client.SearchRequest
+	var nodes data.Nodes
+	err := json.Unmarshal(msg.Data, &req)
+	if err != nil {
+		resp.Error = fmt.Sprintf("Error decoding search request: %v", err)
+	} else {
+		nodes, err = st.searchNodes(req)
+		if err != nil {
+			resp.Error = fmt.Sprintf("Error searching nodes: %v", err)
+		}
+	}
+
+	resp.Nodes, err = nodes.ToPbNodes()
+	if err != nil {
+		resp.Error = fmt.Sprintf("Error pb encoding nodes: %v", err)
+	}
+
+	out, err := proto.Marshal(resp)
+	if err != nil {
+		log.Println("Error encoding search response: ", err)
+		return
+	}
+
+	err = st.nc.Publish(msg.Reply, out)
+	if err != nil {
+		log.Println("NATS: Error publishing response to search: ", err)
+	}
+}
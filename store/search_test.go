@@ -0,0 +1,83 @@
+package store
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+func TestSearch(t *testing.T) {
+	nc, st, _ := startBatchTestStore(t, -1)
+
+	root := st.db.rootNodeID()
+
+	nodes := []client.Variable{
+		{ID: "v1", Parent: root, Description: "Boiler supply temp", VariableType: "number"},
+		{ID: "v2", Parent: root, Description: "Pump room", VariableType: "onOff"},
+		{ID: "v3", Parent: "v2", Description: "Boiler pump", VariableType: "onOff"},
+	}
+
+	for _, n := range nodes {
+		err := client.SendNodeType(nc, n, "test")
+		if err != nil {
+			t.Fatal("Error sending node: ", err)
+		}
+	}
+
+	search := func(q, parent string) string {
+		t.Helper()
+		nodes, err := client.Search(nc, client.SearchRequest{Query: q, Parent: parent})
+		if err != nil {
+			t.Fatal("Error searching: ", err)
+		}
+
+		var ret []string
+		for _, n := range nodes {
+			ret = append(ret, n.ID)
+		}
+		return fmt.Sprint(ret)
+	}
+
+	tests := []struct {
+		q, parent, exp string
+	}{
+		// description matches are first
+		{"pump", "", "[v3 v2]"},
+		{"BOILER pump", "", "[v3]"},
+		{"onoff", "", "[v3 v2]"},
+		{"pump", "v2", "[v3 v2]"},
+		{"supply", "v2", "[]"},
+		{"", "", "[]"},
+	}
+
+	for _, test := range tests {
+		if got := search(test.q, test.parent); got != test.exp {
+			t.Errorf("Search %q under %q: expected %v, got %v", test.q,
+				test.parent, test.exp, got)
+		}
+	}
+
+	// text points update the index
+	err := client.SendNodePoint(nc, "v1", data.Point{Time: time.Now(),
+		Type: data.PointTypeDescription, Text: "Chiller supply temp"}, true)
+	if err != nil {
+		t.Fatal("Error sending point: ", err)
+	}
+
+	if got := search("chiller", ""); got != "[v1]" {
+		t.Fatal("Expected updated description to be found, got: ", got)
+	}
+
+	// deleted nodes are removed
+	err = client.DeleteNode(nc, "v3", "v2", "test")
+	if err != nil {
+		t.Fatal("Error deleting node: ", err)
+	}
+
+	if got := search("pump", ""); got != "[v2]" {
+		t.Fatal("Expected deleted node to be removed, got: ", got)
+	}
+}
@@ -0,0 +1,198 @@
+package store
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// SecretKeeper encrypts and decrypts the values of secret nodes. The
+// ciphertext is stored as text, so it must not contain binary data. An
+// external KMS can be used by implementing this interface (see
+// NewVaultKeeper).
+type SecretKeeper interface {
+	Encrypt(plain []byte) (string, error)
+	Decrypt(ciphertext string) ([]byte, error)
+}
+
+type aesKeeper struct {
+	aead cipher.AEAD
+}
+
+// NewAESKeeper returns a SecretKeeper that uses AES-GCM with a 32 byte key
+func NewAESKeeper(key []byte) (SecretKeeper, error) {
+	if len(key) != 32 {
+		return nil, errors.New("secret key must be 32 bytes")
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &aesKeeper{aead: aead}, nil
+}
+
+// LoadAESKeeper returns an AES SecretKeeper with the base64 encoded key in
+// file. If the file does not exist, a new key is generated and saved to it.
+func LoadAESKeeper(file string) (SecretKeeper, error) {
+	contents, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		key := make([]byte, 32)
+		_, err := io.ReadFull(rand.Reader, key)
+		if err != nil {
+			return nil, fmt.Errorf("Error generating secret key: %w", err)
+		}
+
+		err = os.WriteFile(file, []byte(base64.StdEncoding.EncodeToString(key)+"\n"), 0600)
+		if err != nil {
+			return nil, fmt.Errorf("Error saving secret key: %w", err)
+		}
+
+		return NewAESKeeper(key)
+	} else if err != nil {
+		return nil, fmt.Errorf("Error reading secret key: %w", err)
+	}
+
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(contents)))
+	if err != nil {
+		return nil, fmt.Errorf("Error decoding secret key: %w", err)
+	}
+
+	return NewAESKeeper(key)
+}
+
+func (k *aesKeeper) Encrypt(plain []byte) (string, error) {
+	nonce := make([]byte, k.aead.NonceSize())
+	_, err := io.ReadFull(rand.Reader, nonce)
+	if err != nil {
+		return "", err
+	}
+
+	sealed := k.aead.Seal(nonce, nonce, plain, nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (k *aesKeeper) Decrypt(ciphertext string) ([]byte, error) {
+	sealed, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return nil, err
+	}
+
+	n := k.aead.NonceSize()
+	if len(sealed) < n {
+		return nil, errors.New("ciphertext is too short")
+	}
+
+	return k.aead.Open(nil, sealed[:n], sealed[n:], nil)
+}
+
+// encryptSecrets returns points with the text of secret value points
+// encrypted. points is returned as is if there is nothing to encrypt or no
+// SecretKeeper is configured.
+func (st *Store) encryptSecrets(points data.Points) (data.Points, error) {
+	if st.secrets == nil {
+		return points, nil
+	}
+
+	var ret data.Points
+
+	for i, p := range points {
+		if p.Type != data.PointTypeSecretValue || p.Text == "" ||
+			strings.HasPrefix(p.Text, data.EncryptedPrefix) {
+			continue
+		}
+
+		enc, err := st.secrets.Encrypt([]byte(p.Text))
+		if err != nil {
+			return nil, fmt.Errorf("Error encrypting secret: %w", err)
+		}
+
+		if ret == nil {
+			ret = make(data.Points, len(points))
+			copy(ret, points)
+		}
+
+		ret[i].Text = data.EncryptedPrefix + enc
+	}
+
+	if ret == nil {
+		return points, nil
+	}
+
+	return ret, nil
+}
+
+// secret returns the decrypted value of a secret node
+func (st *Store) secret(id string) (string, error) {
+	node, err := st.db.node(id)
+	if err != nil {
+		return "", fmt.Errorf("Error getting secret %v: %w", id, err)
+	}
+
+	if node.Type != data.NodeTypeSecret {
+		return "", fmt.Errorf("Node %v is not a secret", id)
+	}
+
+	value, _ := node.Points.Text(data.PointTypeSecretValue, "")
+	if !strings.HasPrefix(value, data.EncryptedPrefix) {
+		return value, nil
+	}
+
+	if st.secrets == nil {
+		return "", fmt.Errorf("Secret %v is encrypted, but no secret key is configured", id)
+	}
+
+	plain, err := st.secrets.Decrypt(strings.TrimPrefix(value, data.EncryptedPrefix))
+	if err != nil {
+		return "", fmt.Errorf("Error decrypting secret %v: %w", id, err)
+	}
+
+	return string(plain), nil
+}
+
+// handleSecret replies with the value of a secret node (see client.GetSecret)
+func (st *Store) handleSecret(msg *nats.Msg) {
+	chunks := strings.Split(msg.Subject, ".")
+	if len(chunks) != 2 {
+		log.Println("Error in secret subject: ", msg.Subject)
+		return
+	}
+
+	var resp client.SecretResponse
+
+	value, err := st.secret(chunks[1])
+	if err != nil {
+		resp.Error = err.Error()
+	} else {
+		resp.Value = value
+	}
+
+	d, err := json.Marshal(resp)
+	if err != nil {
+		log.Println("Error encoding secret response: ", err)
+		return
+	}
+
+	err = st.nc.Publish(msg.Reply, d)
+	if err != nil {
+		log.Println("Error sending secret response: ", err)
+	}
+}
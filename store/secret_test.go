@@ -0,0 +1,110 @@
+package store
+
+import (
+	"bytes"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+func TestLoadAESKeeper(t *testing.T) {
+	file := path.Join(t.TempDir(), "secret.key")
+
+	k1, err := LoadAESKeeper(file)
+	if err != nil {
+		t.Fatal("Error creating key: ", err)
+	}
+
+	enc, err := k1.Encrypt([]byte("hello"))
+	if err != nil {
+		t.Fatal("Error encrypting: ", err)
+	}
+
+	// the key is loaded from the file the second time
+	k2, err := LoadAESKeeper(file)
+	if err != nil {
+		t.Fatal("Error loading key: ", err)
+	}
+
+	plain, err := k2.Decrypt(enc)
+	if err != nil {
+		t.Fatal("Error decrypting: ", err)
+	}
+
+	if string(plain) != "hello" {
+		t.Fatal("Decrypted wrong value: ", string(plain))
+	}
+}
+
+func TestStoreSecrets(t *testing.T) {
+	keeper, err := NewAESKeeper(bytes.Repeat([]byte{1}, 32))
+	if err != nil {
+		t.Fatal("Error creating keeper: ", err)
+	}
+
+	nc, st, _ := startTestStoreParams(t, Params{BatchPeriod: -1, Secrets: keeper})
+
+	root := st.db.rootNodeID()
+
+	err = client.SendNode(nc, data.NodeEdge{
+		ID:     "s1",
+		Type:   data.NodeTypeSecret,
+		Parent: root,
+		Points: data.Points{
+			{Type: data.PointTypeSecretValue, Text: "hunter2"},
+		},
+	}, "test")
+	if err != nil {
+		t.Fatal("Error sending secret: ", err)
+	}
+
+	node, err := st.db.node("s1")
+	if err != nil {
+		t.Fatal("Error getting secret node: ", err)
+	}
+
+	stored, _ := node.Points.Text(data.PointTypeSecretValue, "")
+	if !strings.HasPrefix(stored, data.EncryptedPrefix) || strings.Contains(stored, "hunter2") {
+		t.Fatal("Secret was not encrypted: ", stored)
+	}
+
+	value, err := client.GetSecret(nc, "s1")
+	if err != nil {
+		t.Fatal("Error getting secret: ", err)
+	}
+
+	if value != "hunter2" {
+		t.Fatal("Got wrong secret value: ", value)
+	}
+
+	points, err := client.ResolveSecrets(nc, data.Points{
+		{Type: data.PointTypeAuthToken, Text: data.SecretRef("s1")},
+	})
+	if err != nil {
+		t.Fatal("Error resolving secrets: ", err)
+	}
+
+	if points[0].Text != "hunter2" {
+		t.Fatal("Secret reference not resolved: ", points[0].Text)
+	}
+
+	// exports keep the encrypted value so secrets can be restored with the
+	// same key
+	var buf bytes.Buffer
+	err = st.Export("s1", &buf)
+	if err != nil {
+		t.Fatal("Error exporting: ", err)
+	}
+
+	if !strings.Contains(buf.String(), stored) {
+		t.Fatal("Export does not contain encrypted secret: ", buf.String())
+	}
+
+	_, err = client.GetSecret(nc, root)
+	if err == nil {
+		t.Fatal("Getting a node that is not a secret should fail")
+	}
+}
@@ -0,0 +1,315 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/client"
+)
+
+// serviceAPIURL is where the endpoints are documented
+const serviceAPIURL = "https://docs.simpleiot.org/docs/ref/api.html"
+
+// requests that are not answered within serviceReplyTimeout are counted as
+// errors
+var serviceReplyTimeout = time.Minute
+
+// errNoReply is the error of requests that were never answered
+var errNoReply = errors.New("no reply")
+
+// serviceEndpointDoc describes an endpoint in service INFO and SCHEMA
+// responses. Endpoints are async if the reply is sent after the handler
+// returns, once the points are written.
+type serviceEndpointDoc struct {
+	description string
+	request     string
+	response    string
+	async       bool
+}
+
+// serviceEndpointDocs describes the endpoints by subscription name
+var serviceEndpointDocs = map[string]serviceEndpointDoc{
+	"nodePoints":      {"write node points", "pb.Points", "error string", true},
+	"edgePoints":      {"write edge points", "pb.Points", "error string", true},
+	"jsonNodePoints":  {"write JSON node points", "JSON points", "error string", false},
+	"jsonEdgePoints":  {"write JSON edge points", "JSON points", "error string", false},
+	"cborNodePoints":  {"write CBOR node points", "CBOR points", "error string", false},
+	"cborEdgePoints":  {"write CBOR edge points", "CBOR points", "error string", false},
+	"tx":              {"write points of several nodes in one transaction", "pb.Tx", "error string", true},
+	"node":            {"get a node", "parent ID or all", "pb.NodesRequest", false},
+	"children":        {"get the children of a node", "pb.Points", "pb.NodesRequest", false},
+	"origin":          {"get who last changed a point", "pb.Points", "JSON data.PointOrigin", false},
+	"backfill":        {"write historical points to history", "pb.Points", "error string", false},
+	"create":          {"create a tree of nodes", "pb.Nodes", "pb.NodesRequest", false},
+	"notifications":   {"send a notification", "pb.Notification", "", false},
+	"messages":        {"send a message", "pb.Message", "", false},
+	"auth":            {"authenticate a user", "pb.Points", "pb.NodesRequest", false},
+	"history":         {"get point history", "pb.Points", "pb.NodesRequest", false},
+	"backup":          {"back up the store", "", "error string and snapshot chunks", false},
+	"export":          {"export nodes to YAML", "JSON client.ExportRequest", "error string and YAML chunks", false},
+	"import":          {"import nodes from YAML", "JSON client.ImportRequest", "JSON client.ImportResponse", false},
+	"verify":          {"check and repair the store", "pb.Points", "JSON data.StoreVerifyReport", false},
+	"restore":         {"restore a snapshot", "snapshot chunk", "error string", false},
+	"secret":          {"get the value of a secret node", "", "JSON client.SecretResponse", false},
+	"schemas":         {"get the point schemas", "", "JSON client.SchemasResponse", false},
+	"query":           {"find nodes", "JSON client.Query", "pb.NodesRequest", false},
+	"search":          {"search nodes", "JSON client.SearchRequest", "pb.NodesRequest", false},
+	"watch":           {"watch point changes", "JSON client.WatchRequest", "error string", false},
+	"attestChallenge": {"get a device attestation challenge", "JSON data.AttestRequest", "JSON data.AttestResponse", false},
+	"attestVerify":    {"verify a device attestation", "JSON data.AttestRequest", "JSON data.AttestResponse", false},
+}
+
+// serviceEndpoint is an endpoint of the store and its request stats
+type serviceEndpoint struct {
+	name    string
+	subject string
+	doc     serviceEndpointDoc
+
+	// stats, protected by the service lock
+	requests  int
+	errors    int
+	lastError string
+	time      time.Duration
+}
+
+// serviceRequest is a request that has not been answered yet
+type serviceRequest struct {
+	endpoint *serviceEndpoint
+	start    time.Time
+}
+
+// service tracks the endpoints of the store for the NATS services API (see
+// handleService). Requests are timed from when they are received until the
+// store replies with reply, or replyNodes. Requests answered another way are
+// timed until the handler returns.
+type service struct {
+	lock      sync.Mutex
+	id        string
+	started   time.Time
+	endpoints []*serviceEndpoint
+	// unanswered requests by reply subject
+	pending   map[string]serviceRequest
+	lastSweep time.Time
+}
+
+func (s *service) add(name, subject string) *serviceEndpoint {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	e := &serviceEndpoint{name: name, subject: subject, doc: serviceEndpointDocs[name]}
+	s.endpoints = append(s.endpoints, e)
+	return e
+}
+
+// record must be called with the lock held
+func (s *service) record(e *serviceEndpoint, d time.Duration, err error) {
+	e.requests++
+	e.time += d
+	if err != nil {
+		e.errors++
+		e.lastError = err.Error()
+	}
+}
+
+// begin starts timing a request
+func (s *service) begin(e *serviceEndpoint, reply string, start time.Time) {
+	if reply == "" {
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.pending == nil {
+		s.pending = make(map[string]serviceRequest)
+	}
+
+	if start.Sub(s.lastSweep) > serviceReplyTimeout {
+		for k, r := range s.pending {
+			if start.Sub(r.start) > serviceReplyTimeout {
+				s.record(r.endpoint, start.Sub(r.start), errNoReply)
+				delete(s.pending, k)
+			}
+		}
+		s.lastSweep = start
+	}
+
+	if r, ok := s.pending[reply]; ok {
+		// the request was forwarded to another endpoint with the same reply
+		// subject, for example JSON points
+		s.record(r.endpoint, start.Sub(r.start), nil)
+	}
+
+	s.pending[reply] = serviceRequest{e, start}
+}
+
+// handled is called when the handler of a request returns
+func (s *service) handled(e *serviceEndpoint, reply string, start time.Time) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if reply == "" {
+		s.record(e, time.Since(start), nil)
+		return
+	}
+
+	if e.doc.async {
+		return
+	}
+
+	if r, ok := s.pending[reply]; ok && r.endpoint == e {
+		s.record(e, time.Since(r.start), nil)
+		delete(s.pending, reply)
+	}
+}
+
+// replied is called when the store replies to a request
+func (s *service) replied(reply string, err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	r, ok := s.pending[reply]
+	if !ok {
+		return
+	}
+
+	s.record(r.endpoint, time.Since(r.start), err)
+	delete(s.pending, reply)
+}
+
+// subscribe subscribes handler to subject and adds it to the service
+// endpoints
+func (st *Store) subscribe(name, subject string, handler nats.MsgHandler) error {
+	e := st.service.add(name, subject)
+
+	var err error
+	st.subscriptions[name], err = st.nc.Subscribe(subject, func(msg *nats.Msg) {
+		start := time.Now()
+		st.service.begin(e, msg.Reply, start)
+		handler(msg)
+		st.service.handled(e, msg.Reply, start)
+	})
+
+	return err
+}
+
+// startService subscribes to the NATS services API subjects, so tools like
+// `nats micro` can discover the store and list its endpoints and stats
+func (st *Store) startService() error {
+	st.service.id = strings.ReplaceAll(uuid.New().String(), "-", "")
+	st.service.started = time.Now()
+
+	for _, verb := range []string{"PING", "INFO", "STATS", "SCHEMA"} {
+		subjects := []string{
+			"$SRV." + verb,
+			client.SubjectService(verb, ""),
+			client.SubjectService(verb, st.service.id),
+		}
+
+		verb := verb
+		for _, subject := range subjects {
+			var err error
+			st.subscriptions[subject], err = st.nc.Subscribe(subject, func(msg *nats.Msg) {
+				st.handleService(verb, msg)
+			})
+			if err != nil {
+				return fmt.Errorf("Subscribe %v error: %w", subject, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (st *Store) serviceIdentity(typ string) client.ServiceIdentity {
+	version := strings.TrimPrefix(st.version, "v")
+	if version == "" {
+		version = "0.0.0"
+	}
+
+	return client.ServiceIdentity{
+		Type:     typ,
+		Name:     client.ServiceName,
+		ID:       st.service.id,
+		Version:  version,
+		Metadata: map[string]string{"nodeID": st.db.rootNodeID()},
+	}
+}
+
+// handleService answers NATS services API requests
+func (st *Store) handleService(verb string, msg *nats.Msg) {
+	var resp any
+
+	st.service.lock.Lock()
+	switch verb {
+	case "PING":
+		resp = st.serviceIdentity(client.ServicePingType)
+	case "INFO":
+		info := client.ServiceInfo{
+			ServiceIdentity: st.serviceIdentity(client.ServiceInfoType),
+			Description:     "Simple IoT store",
+			Endpoints:       []client.ServiceEndpointInfo{},
+		}
+		for _, e := range st.service.endpoints {
+			info.Endpoints = append(info.Endpoints, client.ServiceEndpointInfo{
+				Name:     e.name,
+				Subject:  e.subject,
+				Metadata: map[string]string{"description": e.doc.description},
+			})
+		}
+		resp = info
+	case "STATS":
+		stats := client.ServiceStats{
+			ServiceIdentity: st.serviceIdentity(client.ServiceStatsType),
+			Started:         st.service.started.UTC(),
+			Endpoints:       []client.ServiceEndpointStats{},
+		}
+		for _, e := range st.service.endpoints {
+			es := client.ServiceEndpointStats{
+				Name:           e.name,
+				Subject:        e.subject,
+				NumRequests:    e.requests,
+				NumErrors:      e.errors,
+				LastError:      e.lastError,
+				ProcessingTime: e.time,
+			}
+			if e.requests > 0 {
+				es.AverageProcessingTime = e.time / time.Duration(e.requests)
+			}
+			stats.Endpoints = append(stats.Endpoints, es)
+		}
+		resp = stats
+	case "SCHEMA":
+		schema := client.ServiceSchema{
+			ServiceIdentity: st.serviceIdentity(client.ServiceSchemaType),
+			APIURL:          serviceAPIURL,
+			Endpoints:       []client.ServiceEndpointSchema{},
+		}
+		for _, e := range st.service.endpoints {
+			es := client.ServiceEndpointSchema{Name: e.name, Subject: e.subject}
+			es.Schema.Request = e.doc.request
+			es.Schema.Response = e.doc.response
+			schema.Endpoints = append(schema.Endpoints, es)
+		}
+		resp = schema
+	}
+	st.service.lock.Unlock()
+
+	d, err := json.Marshal(resp)
+	if err != nil {
+		log.Println("Error encoding service response: ", err)
+		return
+	}
+
+	err = msg.Respond(d)
+	if err != nil {
+		log.Println("Error sending service response: ", err)
+	}
+}
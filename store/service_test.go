@@ -0,0 +1,98 @@
+package store
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+func TestServiceStats(t *testing.T) {
+	var s service
+	points := s.add("nodePoints", "node.*.points")
+	points.doc.async = true
+	json := s.add("jsonNodePoints", "json.node.*.points")
+	start := time.Now()
+
+	// never answered, swept by the next request
+	s.begin(points, "r1", start.Add(-2*serviceReplyTimeout))
+
+	// JSON points are forwarded to nodePoints with the same reply subject
+	s.begin(json, "r2", start)
+	s.begin(points, "r2", start)
+	s.handled(json, "r2", start)
+	s.handled(points, "r2", start)
+	s.replied("r2", errors.New("bad point"))
+
+	s.begin(points, "r3", start)
+	s.replied("r3", nil)
+
+	if json.requests != 1 || json.errors != 0 {
+		t.Errorf("json stats: %+v", json)
+	}
+
+	if points.requests != 3 || points.errors != 2 || points.lastError != "bad point" {
+		t.Errorf("points stats: %+v", points)
+	}
+
+	if len(s.pending) != 0 {
+		t.Error("pending requests: ", s.pending)
+	}
+}
+
+func TestStoreService(t *testing.T) {
+	nc, st, _ := startTestStoreParams(t, Params{BatchPeriod: -1, Version: "v1.2.3"})
+
+	info, err := client.GetServiceInfo(nc, "")
+	if err != nil {
+		t.Fatal("Error getting service info: ", err)
+	}
+
+	if info.Name != client.ServiceName || info.Version != "1.2.3" ||
+		info.Type != client.ServiceInfoType ||
+		info.Metadata["nodeID"] != st.db.rootNodeID() {
+		t.Fatalf("Wrong info: %+v", info)
+	}
+
+	found := false
+	for _, e := range info.Endpoints {
+		if e.Name == "nodePoints" && e.Subject == "node.*.points" {
+			found = true
+		}
+	}
+
+	if !found {
+		t.Error("nodePoints endpoint not found: ", info.Endpoints)
+	}
+
+	err = client.SendNodePoint(nc, st.db.rootNodeID(), data.Point{Type: data.PointTypeDescription,
+		Text: "root"}, true)
+	if err != nil {
+		t.Fatal("Error sending point: ", err)
+	}
+
+	_, err = client.GetNode(nc, st.db.rootNodeID(), "none")
+	if err != nil {
+		t.Fatal("Error getting nodes: ", err)
+	}
+
+	stats, err := client.GetServiceStats(nc, info.ID)
+	if err != nil {
+		t.Fatal("Error getting service stats: ", err)
+	}
+
+	if stats.ID != info.ID || stats.Started.IsZero() {
+		t.Fatalf("Wrong stats: %+v", stats)
+	}
+
+	requests := make(map[string]int)
+	for _, e := range stats.Endpoints {
+		requests[e.Name] = e.NumRequests
+	}
+
+	if requests["nodePoints"] != 1 || requests["node"] != 1 || requests["tx"] != 0 {
+		t.Error("Wrong requests: ", requests)
+	}
+}
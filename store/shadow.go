@@ -0,0 +1,100 @@
+package store
+
+import (
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// shadow applies desired points written to nodes this instance owns. The
+// config point gets the value and time of the desired point unless it has
+// the same value or was changed at or after the desired time (see
+// data.Shadow). Desired points are written as is so other instances can
+// see if they were applied.
+func (st *Store) shadow(nodeID string, points data.Points) data.Points {
+	var desired data.Points
+	for _, p := range points {
+		if p.Type == data.PointTypeDesired && p.Tombstone%2 == 0 {
+			desired = append(desired, p)
+		}
+	}
+
+	if len(desired) <= 0 || !st.ownsNode(nodeID) {
+		return points
+	}
+
+	// the reported point may be in the db or in this write
+	var reported data.Points
+	node, err := st.db.node(nodeID)
+	if err == nil {
+		reported = append(reported, node.Points...)
+	}
+	reported = append(reported, points...)
+
+	for _, d := range desired {
+		typ, key := data.DesiredTypeKey(d.Key)
+		s := data.Shadow{Type: typ, Key: key, Desired: d}
+
+		for _, p := range reported {
+			if p.Type == typ && p.TypeKey() == d.Key &&
+				(s.Reported.Type == "" || p.Time.After(s.Reported.Time)) {
+				s.Reported = p
+			}
+		}
+
+		if !s.Pending() {
+			continue
+		}
+
+		points = append(points, data.Point{
+			Type:   typ,
+			Key:    key,
+			Time:   d.Time,
+			Index:  d.Index,
+			Value:  d.Value,
+			Text:   d.Text,
+			Data:   d.Data,
+			Origin: d.Origin,
+		})
+	}
+
+	return points
+}
+
+// ownsNode returns true if the first device node at or above the node is
+// the root node of this instance. Nodes below other device nodes are owned
+// by the downstream instance of the device.
+func (st *Store) ownsNode(id string) bool {
+	rootID := st.db.rootNodeID()
+	seen := make(map[string]bool)
+	level := []string{id}
+
+	for len(level) > 0 {
+		var next []string
+
+		for _, n := range level {
+			if n == rootID {
+				return true
+			}
+
+			if seen[n] {
+				continue
+			}
+			seen[n] = true
+
+			node, err := st.db.node(n)
+			if err == nil && node.Type == data.NodeTypeDevice {
+				continue
+			}
+
+			ups, err := st.db.up(n, false)
+			if err != nil {
+				return false
+			}
+
+			next = append(next, ups...)
+		}
+
+		level = next
+	}
+
+	return false
+}
@@ -0,0 +1,89 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+func TestStoreShadow(t *testing.T) {
+	nc, st, _ := startBatchTestStore(t, -1)
+
+	root := st.db.rootNodeID()
+
+	err := client.SendNodeType(nc, client.Variable{ID: "local", Parent: root,
+		Description: "a"}, "test")
+	if err != nil {
+		t.Fatal("Error sending node: ", err)
+	}
+
+	// device of a downstream instance
+	err = client.SendNode(nc, data.NodeEdge{ID: "dev", Type: data.NodeTypeDevice,
+		Parent: root}, "test")
+	if err != nil {
+		t.Fatal("Error sending device node: ", err)
+	}
+
+	err = client.SendNodeType(nc, client.Variable{ID: "remote", Parent: "dev",
+		Description: "a"}, "test")
+	if err != nil {
+		t.Fatal("Error sending node: ", err)
+	}
+
+	getNode := func(id string) *data.Node {
+		t.Helper()
+		node, err := st.db.node(id)
+		if err != nil {
+			t.Fatal("Error getting node: ", err)
+		}
+		return node
+	}
+
+	sendDesired := func(id, desc string, tm time.Time) {
+		t.Helper()
+		err := client.SendDesiredPoints(nc, id, data.Points{{
+			Type: data.PointTypeDescription, Text: desc, Time: tm,
+			Origin: "user1"}}, true)
+		if err != nil {
+			t.Fatal("Error sending desired points: ", err)
+		}
+	}
+
+	sendDesired("local", "b", time.Now())
+
+	local := getNode("local")
+	if d := local.Desc(); d != "b" {
+		t.Fatal("Desired point was not applied to local node, got: ", d)
+	}
+	if p := local.Points.Pending(); len(p) != 0 {
+		t.Fatal("Expected no pending points, got: ", p)
+	}
+
+	sendDesired("remote", "b", time.Now())
+
+	remote := getNode("remote")
+	if d := remote.Desc(); d != "a" {
+		t.Fatal("Desired point should not be applied to remote node, got: ", d)
+	}
+	pending := remote.Points.Pending()
+	if len(pending) != 1 || pending[0].Desired.Text != "b" ||
+		pending[0].Type != data.PointTypeDescription {
+		t.Fatal("Expected pending description, got: ", pending)
+	}
+
+	// a desired value older than a local change is not applied
+	old := time.Now()
+	err = client.SendNodePoint(nc, "local", data.Point{
+		Type: data.PointTypeDescription, Text: "c", Time: time.Now()}, true)
+	if err != nil {
+		t.Fatal("Error sending point: ", err)
+	}
+
+	sendDesired("local", "d", old)
+
+	if d := getNode("local").Desc(); d != "c" {
+		t.Fatal("Older desired point should not be applied, got: ", d)
+	}
+}
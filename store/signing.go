@@ -0,0 +1,111 @@
+package store
+
+import (
+	"crypto/ed25519"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// how often the signing policy is read from the root node
+var signingPolicyCheckPeriod = time.Minute
+
+// signatures older than this are rejected. Newer signatures are only
+// accepted once (see data.NonceCache), so captured messages can't be
+// replayed.
+var signatureMaxAge = 5 * time.Minute
+
+// signingPolicy is read from the root device node (see data.SigningPolicy)
+type signingPolicy struct {
+	pointTypes map[string]bool
+	keys       map[string]ed25519.PublicKey
+}
+
+func (st *Store) signingPolicy() signingPolicy {
+	st.lock.Lock()
+	if time.Since(st.signingCheck) < signingPolicyCheckPeriod {
+		defer st.lock.Unlock()
+		return st.signing
+	}
+	st.lock.Unlock()
+
+	policy := signingPolicy{
+		pointTypes: make(map[string]bool),
+		keys:       make(map[string]ed25519.PublicKey),
+	}
+
+	root, err := st.db.node(st.db.rootNodeID())
+	if err != nil {
+		log.Println("Error getting signing policy: ", err)
+	} else {
+		policy.pointTypes, policy.keys = data.SigningPolicy(root.Points)
+	}
+
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	st.signing = policy
+	st.signingCheck = time.Now()
+
+	return policy
+}
+
+// clearSigningPolicy is called when points are written to the root node so
+// that policy changes are used right away
+func (st *Store) clearSigningPolicy(points data.Points) {
+	for _, p := range points {
+		if p.Type == data.PointTypeSignedPointTypes || p.Type == data.PointTypeSigningKey {
+			st.lock.Lock()
+			st.signingCheck = time.Time{}
+			st.lock.Unlock()
+			return
+		}
+	}
+}
+
+// signedPoint returns the first point that must be signed, if any
+func (policy signingPolicy) signedPoint(points data.Points) (data.Point, bool) {
+	for _, p := range points {
+		if policy.pointTypes[p.Type] {
+			return p, true
+		}
+	}
+
+	return data.Point{}, false
+}
+
+// verify checks the signature of node points that include a point type that
+// must be signed
+func (st *Store) verify(nodeID string, points data.Points) error {
+	policy := st.signingPolicy()
+
+	p, ok := policy.signedPoint(points)
+	if !ok {
+		return nil
+	}
+
+	err := data.VerifyPoints(nodeID, points, policy.pointTypes, policy.keys,
+		signatureMaxAge, time.Now(), st.signatureNonces)
+	if err != nil {
+		return fmt.Errorf("rejected %v point for node %v: %w", p.Type, nodeID, err)
+	}
+
+	return nil
+}
+
+// verifyUnsigned returns an error if any of the writes include a point type
+// that must be signed. Signed points can only be written with node points
+// messages.
+func (st *Store) verifyUnsigned(writes []data.TxWrite) error {
+	policy := st.signingPolicy()
+
+	for _, w := range writes {
+		if p, ok := policy.signedPoint(w.Points); ok {
+			return fmt.Errorf("rejected %v point for node %v: must be sent signed in a node points message",
+				p.Type, w.NodeID)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,114 @@
+package store
+
+import (
+	"crypto/ed25519"
+	"testing"
+	"time"
+
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+func TestStoreSigning(t *testing.T) {
+	nc, st, _ := startBatchTestStore(t, -1)
+
+	root := st.db.rootNodeID()
+
+	pub, key, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal("Error generating key: ", err)
+	}
+
+	_, otherKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal("Error generating key: ", err)
+	}
+
+	err = client.SendNodeType(nc, client.Variable{ID: "v", Parent: root}, "test")
+	if err != nil {
+		t.Fatal("Error sending node: ", err)
+	}
+
+	send := func(id string, points data.Points) error {
+		return client.SendPoints(nc, client.SubjectNodePoints(id), points, true)
+	}
+
+	valueSet := data.Points{{Time: time.Now(), Type: data.PointTypeValueSet, Value: 1}}
+
+	// without a policy, unsigned points are accepted
+	err = send("v", valueSet)
+	if err != nil {
+		t.Fatal("Error sending unsigned point without policy: ", err)
+	}
+
+	err = send(root, data.Points{
+		{Time: time.Now(), Type: data.PointTypeSigningKey, Key: "k1",
+			Text: data.EncodeSigningKey(pub)},
+		{Time: time.Now(), Type: data.PointTypeSignedPointTypes,
+			Text: data.PointTypeValueSet},
+	})
+	if err != nil {
+		t.Fatal("Error sending signing policy: ", err)
+	}
+
+	err = send("v", valueSet)
+	if err == nil {
+		t.Fatal("Unsigned point was accepted")
+	}
+
+	err = send("v", data.SignPoints("v", valueSet, nil, "k1", key))
+	if err != nil {
+		t.Fatal("Signed point was rejected: ", err)
+	}
+
+	// replayed message
+	signed := data.SignPoints("v", valueSet, nil, "k1", key)
+	err = send("v", signed)
+	if err != nil {
+		t.Fatal("Signed point was rejected: ", err)
+	}
+
+	err = send("v", signed)
+	if err == nil {
+		t.Fatal("Replayed signed point was accepted")
+	}
+
+	// signature for another node
+	err = send("v", data.SignPoints("w", valueSet, nil, "k1", key))
+	if err == nil {
+		t.Fatal("Point signed for another node was accepted")
+	}
+
+	err = send("v", data.SignPoints("v", valueSet, nil, "k1", otherKey))
+	if err == nil {
+		t.Fatal("Point signed with unknown key was accepted")
+	}
+
+	// other point types are not affected
+	err = send("v", data.Points{{Time: time.Now(), Type: data.PointTypeValue, Value: 2}})
+	if err != nil {
+		t.Fatal("Unsigned value point was rejected: ", err)
+	}
+
+	err = client.SendNodePointsTx(nc, []data.TxWrite{{NodeID: "v", Points: valueSet}})
+	if err == nil {
+		t.Fatal("Unsigned point in transaction was accepted")
+	}
+
+	// the policy can't be turned off without a signature
+	disable := data.Points{{Time: time.Now(), Type: data.PointTypeSignedPointTypes}}
+	err = send(root, disable)
+	if err == nil {
+		t.Fatal("Unsigned policy change was accepted")
+	}
+
+	err = send(root, data.SignPoints(root, disable, nil, "k1", key))
+	if err != nil {
+		t.Fatal("Signed policy change was rejected: ", err)
+	}
+
+	err = send("v", valueSet)
+	if err != nil {
+		t.Fatal("Unsigned point rejected after policy was disabled: ", err)
+	}
+}
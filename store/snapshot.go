@@ -0,0 +1,395 @@
+package store
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// snapshotVersion is incremented when the snapshot format changes
+const snapshotVersion = 1
+
+// snapshot is a copy of everything in a store backend. It is encoded as JSON
+// so that it can be restored into any backend.
+type snapshot struct {
+	Version int               `json:"version"`
+	Time    time.Time         `json:"time"`
+	RootID  string            `json:"rootId"`
+	Nodes   []snapshotNode    `json:"nodes"`
+	Edges   []data.Edge       `json:"edges"`
+	History []snapshotHistory `json:"history"`
+}
+
+// snapshotNode contains all points for a node, including the node type
+type snapshotNode struct {
+	ID     string      `json:"id"`
+	Points data.Points `json:"points"`
+}
+
+// snapshotHistory contains the history points recorded by a retention node
+type snapshotHistory struct {
+	RetentionID string         `json:"retentionId"`
+	Points      []historyPoint `json:"points"`
+}
+
+// Snapshot writes a consistent copy of the store to w. The store keeps
+// running while the snapshot is taken.
+func (st *Store) Snapshot(w io.Writer) error {
+	s, err := st.db.snapshot(true)
+	if err != nil {
+		return fmt.Errorf("Error reading snapshot: %w", err)
+	}
+
+	s.Version = snapshotVersion
+	s.Time = time.Now()
+
+	err = json.NewEncoder(w).Encode(s)
+	if err != nil {
+		return fmt.Errorf("Error encoding snapshot: %w", err)
+	}
+
+	return nil
+}
+
+// Restore replaces everything in the store with a snapshot read from r. The
+// data is replaced in one transaction, so the store is left unchanged if the
+// restore fails. Clients are not restarted, so SIOT should be restarted after
+// a restore.
+func (st *Store) Restore(r io.Reader) error {
+	var s snapshot
+	err := json.NewDecoder(r).Decode(&s)
+	if err != nil {
+		return fmt.Errorf("Error decoding snapshot: %w", err)
+	}
+
+	if s.Version != snapshotVersion {
+		return fmt.Errorf("Unsupported snapshot version: %v", s.Version)
+	}
+
+	if s.RootID == "" {
+		return errors.New("Snapshot does not have a root node")
+	}
+
+	err = st.db.restore(&s)
+	if err != nil {
+		return fmt.Errorf("Error restoring snapshot: %w", err)
+	}
+
+	st.clearSearch()
+	st.clearExternalHistory()
+
+	return nil
+}
+
+// sqlSnapshot reads a snapshot in one transaction. It is shared by the
+// sqlite and postgres backends, which use the same tables. Rows are read in
+// the order of the order column so that the restored db returns nodes in the
+// same order. History is only read if history is set.
+func sqlSnapshot(db *sql.DB, order string, history bool) (*snapshot, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	// we only read, so the transaction is always rolled back
+	defer tx.Rollback()
+
+	var ret snapshot
+
+	err = tx.QueryRow("SELECT root_id FROM meta").Scan(&ret.RootID)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading meta: %w", err)
+	}
+
+	nodePoints, nodeIDs, err := sqlSnapshotPoints(tx, "node_points", "node_id", order)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, id := range nodeIDs {
+		ret.Nodes = append(ret.Nodes, snapshotNode{ID: id, Points: nodePoints[id]})
+	}
+
+	edgePoints, _, err := sqlSnapshotPoints(tx, "edge_points", "edge_id", order)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.Query("SELECT id, up, down, hash FROM edges ORDER BY " + order)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading edges: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e data.Edge
+		err = rows.Scan(&e.ID, &e.Up, &e.Down, &e.Hash)
+		if err != nil {
+			return nil, err
+		}
+		e.Points = edgePoints[e.ID]
+		ret.Edges = append(ret.Edges, e)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if !history {
+		return &ret, nil
+	}
+
+	hRows, err := tx.Query(`SELECT retention_id, node_id, type, key, time,
+		interval_ns, value, min, max, count, text FROM history ORDER BY time`)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading history: %w", err)
+	}
+	defer hRows.Close()
+
+	retentionIndex := make(map[string]int)
+
+	for hRows.Next() {
+		var retentionID string
+		var p historyPoint
+		var t, interval int64
+		err = hRows.Scan(&retentionID, &p.NodeID, &p.Type, &p.Key, &t, &interval,
+			&p.Value, &p.Min, &p.Max, &p.Count, &p.Text)
+		if err != nil {
+			return nil, err
+		}
+		p.Time = time.Unix(0, t)
+		p.Interval = time.Duration(interval)
+
+		i, ok := retentionIndex[retentionID]
+		if !ok {
+			i = len(ret.History)
+			retentionIndex[retentionID] = i
+			ret.History = append(ret.History, snapshotHistory{RetentionID: retentionID})
+		}
+		ret.History[i].Points = append(ret.History[i].Points, p)
+	}
+
+	return &ret, hRows.Err()
+}
+
+// sqlSnapshotPoints reads all points in a point table and returns them by
+// ID, and the IDs in the order they were first found
+func sqlSnapshotPoints(tx *sql.Tx, table, idColumn, order string) (map[string]data.Points, []string, error) {
+	rows, err := tx.Query(fmt.Sprintf(`SELECT %v, type, key, time_s, time_ns, idx,
+		value, text, data, tombstone, origin FROM %v ORDER BY %v`, idColumn, table, order))
+	if err != nil {
+		return nil, nil, fmt.Errorf("Error reading %v: %w", table, err)
+	}
+	defer rows.Close()
+
+	ret := make(map[string]data.Points)
+	var ids []string
+
+	for rows.Next() {
+		var p data.Point
+		var id string
+		var timeS, timeNS int64
+		err := rows.Scan(&id, &p.Type, &p.Key, &timeS, &timeNS, &p.Index, &p.Value,
+			&p.Text, &p.Data, &p.Tombstone, &p.Origin)
+		if err != nil {
+			return nil, nil, err
+		}
+		p.Time = time.Unix(timeS, timeNS)
+
+		if _, ok := ret[id]; !ok {
+			ids = append(ids, id)
+		}
+		ret[id] = append(ret[id], p)
+	}
+
+	return ret, ids, rows.Err()
+}
+
+// sqlRestore replaces all data with a snapshot in one transaction. Queries
+// are written with ? placeholders and passed through rebind so they can be
+// converted for databases that use another style.
+func sqlRestore(db *sql.DB, rebind func(string) string, s *snapshot) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	exec := func(q string, args ...interface{}) error {
+		_, err := tx.Exec(rebind(q), args...)
+		return err
+	}
+
+	err = func() error {
+		for _, t := range []string{"node_points", "edge_points", "edges", "history"} {
+			if err := exec("DELETE FROM " + t); err != nil {
+				return fmt.Errorf("Error clearing %v: %w", t, err)
+			}
+		}
+
+		if err := exec("UPDATE meta SET root_id=?", s.RootID); err != nil {
+			return fmt.Errorf("Error setting root ID: %w", err)
+		}
+
+		insertPoint := func(table, idColumn, id string, p data.Point) error {
+			tS := p.Time.Unix()
+			tNs := p.Time.UnixNano() - 1e9*tS
+			return exec(fmt.Sprintf(`INSERT INTO %v(id, %v, type, key, time_s,
+				time_ns, idx, value, text, data, tombstone, origin)
+				VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, table, idColumn),
+				uuid.New().String(), id, p.Type, p.Key, tS, tNs, p.Index, p.Value,
+				p.Text, p.Data, p.Tombstone, p.Origin)
+		}
+
+		for _, n := range s.Nodes {
+			for _, p := range n.Points {
+				if err := insertPoint("node_points", "node_id", n.ID, p); err != nil {
+					return fmt.Errorf("Error writing node point: %w", err)
+				}
+			}
+		}
+
+		for _, e := range s.Edges {
+			if err := exec("INSERT INTO edges(id, up, down, hash) VALUES(?, ?, ?, ?)",
+				e.ID, e.Up, e.Down, []byte{}); err != nil {
+				return fmt.Errorf("Error writing edge: %w", err)
+			}
+
+			for _, p := range e.Points {
+				if err := insertPoint("edge_points", "edge_id", e.ID, p); err != nil {
+					return fmt.Errorf("Error writing edge point: %w", err)
+				}
+			}
+		}
+
+		for _, h := range s.History {
+			for _, p := range h.Points {
+				if err := exec(`INSERT INTO history(retention_id, node_id, type, key,
+					time, interval_ns, value, min, max, count, text)
+					VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+					h.RetentionID, p.NodeID, p.Type, p.Key, p.Time.UnixNano(),
+					int64(p.Interval), p.Value, p.Min, p.Max, p.Count, p.Text); err != nil {
+					return fmt.Errorf("Error writing history: %w", err)
+				}
+			}
+		}
+
+		return nil
+	}()
+
+	if err != nil {
+		rbErr := tx.Rollback()
+		if rbErr != nil {
+			log.Println("Rollback error: ", rbErr)
+		}
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// rebindNone is used for databases that support ? placeholders
+func rebindNone(q string) string {
+	return q
+}
+
+// rebindDollar converts ? placeholders to $1, $2, ...
+func rebindDollar(q string) string {
+	var b strings.Builder
+	n := 0
+	for _, c := range q {
+		if c == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// restores that have not received a chunk in this long are discarded
+var restoreTimeout = time.Minute
+
+// handleBackup sends a snapshot of the store in chunks to the reply subject
+// (see client.StoreBackup)
+func (st *Store) handleBackup(msg *nats.Msg) {
+	if msg.Reply == "" {
+		return
+	}
+
+	var buf bytes.Buffer
+	err := st.Snapshot(&buf)
+	if err != nil {
+		log.Println("Error taking store snapshot: ", err)
+		st.reply(msg.Reply, err)
+		return
+	}
+
+	err = st.sendChunks(msg.Reply, &buf)
+	if err != nil {
+		log.Println("Error sending store snapshot: ", err)
+	}
+}
+
+// sendChunks replies with an empty status, then buf in chunks that fit in a
+// NATS message, and then an empty message (see client.requestChunks)
+func (st *Store) sendChunks(reply string, buf *bytes.Buffer) error {
+	st.reply(reply, nil)
+
+	chunkSize := int(st.nc.MaxPayload()) - 1024
+	for buf.Len() > 0 {
+		err := st.nc.Publish(reply, buf.Next(chunkSize))
+		if err != nil {
+			return err
+		}
+	}
+
+	return st.nc.Publish(reply, nil)
+}
+
+// handleRestore collects snapshot chunks and restores them when an empty
+// chunk is received (see client.StoreRestore). NATS calls this handler
+// sequentially, so the restore buffer does not need a lock.
+func (st *Store) handleRestore(msg *nats.Msg) {
+	if st.restoreBuf != nil && time.Since(st.restoreLast) > restoreTimeout {
+		log.Println("Discarding incomplete store restore")
+		st.restoreBuf = nil
+	}
+
+	if len(msg.Data) > 0 {
+		if st.restoreBuf == nil {
+			st.restoreBuf = &bytes.Buffer{}
+		}
+		st.restoreBuf.Write(msg.Data)
+		st.restoreLast = time.Now()
+		st.reply(msg.Reply, nil)
+		return
+	}
+
+	if st.restoreBuf == nil {
+		st.reply(msg.Reply, errors.New("no snapshot received"))
+		return
+	}
+
+	buf := st.restoreBuf
+	st.restoreBuf = nil
+
+	err := st.Restore(buf)
+	if err != nil {
+		log.Println("Error restoring store: ", err)
+	} else {
+		log.Println("Store restored, SIOT should be restarted")
+	}
+
+	st.reply(msg.Reply, err)
+}
@@ -0,0 +1,192 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	natsserver "github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// testBackendSnapshot snapshots src, restores it into dst, and checks that
+// dst has the same data
+func testBackendSnapshot(t *testing.T, src, dst backend) {
+	rootID := src.rootNodeID()
+
+	err := src.nodePoints("var", data.Points{
+		{Type: data.PointTypeNodeType, Text: data.NodeTypeVariable},
+		{Type: data.PointTypeDescription, Text: "var"},
+		{Type: data.PointTypeValue, Value: 12, Origin: "test"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = src.edgePoints("var", rootID, data.Points{{Type: data.PointTypeTombstone}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().Truncate(time.Second)
+	err = src.historyInsert("ret", []historyPoint{
+		{NodeID: "var", Type: data.PointTypeValue, Time: now, Value: 12, Min: 12,
+			Max: 12, Count: 1},
+		{NodeID: "var", Type: data.PointTypeValue, Time: now.Add(-time.Hour),
+			Interval: time.Hour, Value: 10, Min: 8, Max: 12, Count: 60},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := src.snapshot(true)
+	if err != nil {
+		t.Fatal("Error taking snapshot: ", err)
+	}
+
+	err = dst.restore(s)
+	if err != nil {
+		t.Fatal("Error restoring snapshot: ", err)
+	}
+
+	if dst.rootNodeID() != rootID {
+		t.Fatal("Root ID not restored: ", dst.rootNodeID())
+	}
+
+	children, err := dst.children(rootID, data.NodeTypeVariable, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(children) != 1 || children[0].ID != "var" {
+		t.Fatal("Wrong children after restore: ", children)
+	}
+
+	v, _ := children[0].Points.Value(data.PointTypeValue, "")
+	p, _ := children[0].Points.Find(data.PointTypeValue, "")
+	if v != 12 || p.Origin != "test" {
+		t.Error("Wrong points after restore: ", children[0].Points)
+	}
+
+	// users are part of the snapshot
+	nodes, err := dst.userCheck("admin@admin.com", "admin")
+	if err != nil || len(nodes) < 1 {
+		t.Error("Admin user not restored: ", err)
+	}
+
+	hps, err := dst.historyQuery("var", "", "", now.Add(-2*time.Hour), time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(hps) != 2 || hps[0].Interval != time.Hour || hps[0].Min != 8 ||
+		!hps[1].Time.Equal(now) {
+		t.Error("Wrong history after restore: ", hps)
+	}
+}
+
+func TestDbSqliteSnapshot(t *testing.T) {
+	db := newTestDb(t)
+	defer db.Close()
+
+	testBackendSnapshot(t, db, newTestMemoryBackend(t))
+}
+
+func TestDbSqliteRestore(t *testing.T) {
+	db := newTestDb(t)
+	defer db.Close()
+
+	testBackendSnapshot(t, newTestMemoryBackend(t), db)
+}
+
+func TestStoreBackupRestore(t *testing.T) {
+	ns, err := natsserver.NewServer(&natsserver.Options{Port: -1, NoSigs: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go ns.Start()
+	defer ns.Shutdown()
+
+	if !ns.ReadyForConnections(5 * time.Second) {
+		t.Fatal("NATS server not ready")
+	}
+
+	nc, err := nats.Connect(ns.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+
+	st, err := NewStore(Params{File: MemoryStoreFile, Nc: nc})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		st.Start()
+		close(stopped)
+	}()
+	defer func() {
+		st.Stop(nil)
+		<-stopped
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	err = st.WaitStart(ctx)
+	cancel()
+	if err != nil {
+		t.Fatal("Error waiting for store: ", err)
+	}
+
+	rootID := st.db.rootNodeID()
+
+	// the snapshot is large enough to be sent in several chunks
+	desc := string(bytes.Repeat([]byte("a"), int(nc.MaxPayload()/4)))
+
+	for i := 0; i < 8; i++ {
+		err = client.SendNode(nc, data.NodeEdge{
+			ID:     fmt.Sprintf("var%v", i),
+			Type:   data.NodeTypeVariable,
+			Parent: rootID,
+			Points: data.Points{{Type: data.PointTypeDescription, Text: desc}},
+		}, "")
+		if err != nil {
+			t.Fatal("Error sending variable node: ", err)
+		}
+	}
+
+	var backup bytes.Buffer
+	err = client.StoreBackup(nc, &backup)
+	if err != nil {
+		t.Fatal("Error backing up store: ", err)
+	}
+
+	err = client.DeleteNode(nc, "var0", rootID, "")
+	if err != nil {
+		t.Fatal("Error deleting node: ", err)
+	}
+
+	err = client.StoreRestore(nc, &backup)
+	if err != nil {
+		t.Fatal("Error restoring store: ", err)
+	}
+
+	nodes, err := client.GetNodeType[client.Variable](nc, "var0", rootID)
+	if err != nil {
+		t.Fatal("Error getting node: ", err)
+	}
+
+	if len(nodes) != 1 || nodes[0].Description != desc {
+		t.Fatal("Node not restored")
+	}
+
+	err = client.StoreRestore(nc, bytes.NewBufferString("{}"))
+	if err == nil {
+		t.Error("Expected error restoring invalid snapshot")
+	}
+}
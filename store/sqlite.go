@@ -2,7 +2,6 @@ package store
 
 import (
 	"database/sql"
-	"errors"
 	"fmt"
 	"log"
 	"time"
@@ -58,6 +57,32 @@ func NewSqliteDb(dbFile string) (*DbSqlite, error) {
 		return nil, fmt.Errorf("Error creating edges table: %v", err)
 	}
 
+	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS edges_up ON edges (up)`)
+	if err != nil {
+		return nil, fmt.Errorf("Error creating edges index: %v", err)
+	}
+
+	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS edges_down ON edges (down)`)
+	if err != nil {
+		return nil, fmt.Errorf("Error creating edges index: %v", err)
+	}
+
+	// the edge index is keyed by parent, node type, and tombstone so that
+	// child queries only read the points of the children that are returned
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS edge_index (edge_id TEXT NOT NULL PRIMARY KEY,
+				up TEXT,
+				node_type TEXT,
+				tombstone INT)`)
+	if err != nil {
+		return nil, fmt.Errorf("Error creating edge_index table: %v", err)
+	}
+
+	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS edge_index_up
+				ON edge_index (up, node_type, tombstone)`)
+	if err != nil {
+		return nil, fmt.Errorf("Error creating edge index: %v", err)
+	}
+
 	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS node_points (id TEXT NOT NULL PRIMARY KEY,
 				node_id TEXT,
 				type TEXT,
@@ -75,6 +100,11 @@ func NewSqliteDb(dbFile string) (*DbSqlite, error) {
 		return nil, fmt.Errorf("Error creating node_points table: %v", err)
 	}
 
+	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS node_points_node ON node_points (node_id)`)
+	if err != nil {
+		return nil, fmt.Errorf("Error creating node_points index: %v", err)
+	}
+
 	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS edge_points (id TEXT NOT NULL PRIMARY KEY,
 				edge_id TEXT,
 				type TEXT,
@@ -92,6 +122,43 @@ func NewSqliteDb(dbFile string) (*DbSqlite, error) {
 		return nil, fmt.Errorf("Error creating edge_points table: %v", err)
 	}
 
+	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS edge_points_edge ON edge_points (edge_id)`)
+	if err != nil {
+		return nil, fmt.Errorf("Error creating edge_points index: %v", err)
+	}
+
+	// history is written by retention nodes. time is in ns since the epoch
+	// and interval_ns is 0 for raw points.
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS history (retention_id TEXT,
+				node_id TEXT,
+				type TEXT,
+				key TEXT,
+				time INT,
+				interval_ns INT,
+				value REAL,
+				min REAL,
+				max REAL,
+				count INT,
+				text TEXT)`)
+
+	if err != nil {
+		return nil, fmt.Errorf("Error creating history table: %v", err)
+	}
+
+	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS history_retention
+				ON history (retention_id, interval_ns, time)`)
+
+	if err != nil {
+		return nil, fmt.Errorf("Error creating history index: %v", err)
+	}
+
+	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS history_node
+				ON history (node_id, type, time)`)
+
+	if err != nil {
+		return nil, fmt.Errorf("Error creating history index: %v", err)
+	}
+
 	metaRows, err := db.Query("SELECT * from meta")
 	if err != nil {
 		return nil, fmt.Errorf("Error quering meta: %v", err)
@@ -113,6 +180,21 @@ func NewSqliteDb(dbFile string) (*DbSqlite, error) {
 		}
 	}
 
+	if ret.meta.Version < sqliteVersionEdgeIndex {
+		// dbs created before the edge index need it built
+		err = ret.reindexEdges()
+		if err != nil {
+			return nil, fmt.Errorf("Error building edge index: %v", err)
+		}
+
+		_, err = db.Exec("UPDATE meta SET version=?", sqliteVersionEdgeIndex)
+		if err != nil {
+			return nil, fmt.Errorf("Error setting db version: %v", err)
+		}
+
+		ret.meta.Version = sqliteVersionEdgeIndex
+	}
+
 	// make sure we find root ID
 	_, err = ret.node(ret.meta.RootID)
 	if err != nil {
@@ -122,60 +204,56 @@ func NewSqliteDb(dbFile string) (*DbSqlite, error) {
 	return ret, nil
 }
 
-func (sdb *DbSqlite) initRoot() (string, error) {
-	log.Println("STORE: Initialize root node and admin user")
-	var rootNode data.NodeEdge
-	rootNode.Points = data.Points{
-		{
-			Time: time.Now(),
-			Type: data.PointTypeNodeType,
-			Text: data.NodeTypeDevice,
-		},
-	}
-
-	rootNode.ID = uuid.New().String()
-
-	err := sdb.nodePoints(rootNode.ID, rootNode.Points)
-	if err != nil {
-		return "", fmt.Errorf("Error setting root node points: %v", err)
-	}
-
-	err = sdb.edgePoints(rootNode.ID, "", data.Points{{Type: data.PointTypeTombstone, Value: 0}})
-	if err != nil {
-		return "", fmt.Errorf("Error sending root node edges: %w", err)
-	}
-
-	// create admin user off root node
-	admin := data.User{
-		ID:        uuid.New().String(),
-		FirstName: "admin",
-		LastName:  "user",
-		Email:     "admin@admin.com",
-		Pass:      "admin",
-	}
-
-	points := admin.ToPoints()
+// sqliteVersionEdgeIndex is the meta version where the edge index was added
+const sqliteVersionEdgeIndex = 1
+
+// sqliteIndexEdges updates the edge index for the edges selected by a WHERE
+// clause on edges e. The node type and tombstone are read the same way as
+// in queryPoints and NodeEdge.IsTombstone.
+const sqliteIndexEdges = `INSERT OR REPLACE INTO edge_index(edge_id, up, node_type, tombstone)
+	SELECT e.id, e.up,
+	COALESCE((SELECT text FROM node_points WHERE node_id=e.down AND type='` +
+	data.PointTypeNodeType + `' ORDER BY rowid DESC LIMIT 1), ''),
+	COALESCE((SELECT value != 0 FROM edge_points WHERE edge_id=e.id AND type='` +
+	data.PointTypeTombstone + `' AND key='' LIMIT 1), 0)
+	FROM edges e `
+
+// reindexEdges rebuilds the edge index from the edges and points
+func (sdb *DbSqlite) reindexEdges() error {
+	return sqlTransaction(sdb.db, func(tx *sql.Tx) error {
+		_, err := tx.Exec("DELETE FROM edge_index")
+		if err != nil {
+			return err
+		}
 
-	err = sdb.nodePoints(admin.ID, points)
-	if err != nil {
-		return "", fmt.Errorf("Error setting default user: %v", err)
-	}
+		_, err = tx.Exec(sqliteIndexEdges)
+		return err
+	})
+}
 
-	err = sdb.edgePoints(admin.ID, rootNode.ID, data.Points{{Type: data.PointTypeTombstone, Value: 0}})
+func (sdb *DbSqlite) initRoot() (string, error) {
+	rootID, err := initRoot(sdb)
 	if err != nil {
 		return "", err
 	}
 
-	_, err = sdb.db.Exec("INSERT INTO meta(id, version, root_id) VALUES(?, ?, ?)", 0, 0, rootNode.ID)
+	_, err = sdb.db.Exec("INSERT INTO meta(id, version, root_id) VALUES(?, ?, ?)", 0, 0, rootID)
 	if err != nil {
 		return "", fmt.Errorf("Error setting meta data: %v", err)
 	}
 
-	return rootNode.ID, nil
+	return rootID, nil
 }
 
 func (sdb *DbSqlite) nodePoints(id string, points data.Points) error {
-	rowsPoints, err := sdb.db.Query("SELECT * FROM node_points WHERE node_id=?", id)
+	return sqlTransaction(sdb.db, func(tx *sql.Tx) error {
+		return sdb.nodePointsTx(tx, id, points)
+	})
+}
+
+// nodePointsTx writes node points as part of the tx transaction
+func (sdb *DbSqlite) nodePointsTx(tx *sql.Tx, id string, points data.Points) error {
+	rowsPoints, err := tx.Query("SELECT * FROM node_points WHERE node_id=?", id)
 	if err != nil {
 		return err
 	}
@@ -199,6 +277,11 @@ func (sdb *DbSqlite) nodePoints(id string, points data.Points) error {
 		dbPointIDs = append(dbPointIDs, pID)
 	}
 
+	err = rowsPoints.Close()
+	if err != nil {
+		return err
+	}
+
 	var writePoints data.Points
 	var writePointIDs []string
 
@@ -227,10 +310,6 @@ NextPin:
 	}
 
 	// loop through write points and write them
-	tx, err := sdb.db.Begin()
-	if err != nil {
-		return err
-	}
 	stmt, err := tx.Prepare(`INSERT INTO node_points(id, node_id, type, key, time_s,
                  time_ns, idx, value, text, data, tombstone, origin)
 		 VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
@@ -246,8 +325,13 @@ NextPin:
 		 tombstone = ?11,
 		 origin = ?12
 		 `)
+	if err != nil {
+		return err
+	}
 	defer stmt.Close()
 
+	nodeType := false
+
 	for i, p := range writePoints {
 		tS := p.Time.Unix()
 		tNs := p.Time.UnixNano() - 1e9*tS
@@ -255,28 +339,37 @@ NextPin:
 		_, err = stmt.Exec(pID, id, p.Type, p.Key, tS, tNs, p.Index, p.Value, p.Text, p.Data, p.Tombstone,
 			p.Origin)
 		if err != nil {
-			rbErr := tx.Rollback()
-			if rbErr != nil {
-				log.Println("Rollback error: ", rbErr)
-			}
 			return err
 		}
+
+		if p.Type == data.PointTypeNodeType {
+			nodeType = true
+		}
 	}
 
-	err = tx.Commit()
-	if err != nil {
-		return err
+	if nodeType {
+		_, err = tx.Exec(sqliteIndexEdges+"WHERE e.down=?", id)
+		if err != nil {
+			return fmt.Errorf("Error updating edge index: %w", err)
+		}
 	}
 
 	return nil
 }
 
 func (sdb *DbSqlite) edgePoints(nodeID, parentID string, points data.Points) error {
+	return sqlTransaction(sdb.db, func(tx *sql.Tx) error {
+		return sdb.edgePointsTx(tx, nodeID, parentID, points)
+	})
+}
+
+// edgePointsTx writes edge points as part of the tx transaction
+func (sdb *DbSqlite) edgePointsTx(tx *sql.Tx, nodeID, parentID string, points data.Points) error {
 	if parentID == "" {
 		parentID = "none"
 	}
 
-	rowsEdge, err := sdb.db.Query("SELECT * FROM edges WHERE up=? AND down=?", parentID, nodeID)
+	rowsEdge, err := tx.Query("SELECT * FROM edges WHERE up=? AND down=?", parentID, nodeID)
 	if err != nil {
 		return err
 	}
@@ -291,13 +384,20 @@ func (sdb *DbSqlite) edgePoints(nodeID, parentID string, points data.Points) err
 		}
 	}
 
-	if edge.ID == "" {
+	err = rowsEdge.Close()
+	if err != nil {
+		return err
+	}
+
+	newEdge := edge.ID == ""
+
+	if newEdge {
 		edge.ID = uuid.New().String()
 		edge.Up = parentID
 		edge.Down = nodeID
 
 		// did not find edge, need to add it
-		_, err := sdb.db.Exec(`INSERT INTO edges(id, up, down, hash) VALUES (?, ?, ?, ?)`,
+		_, err := tx.Exec(`INSERT INTO edges(id, up, down, hash) VALUES (?, ?, ?, ?)`,
 			edge.ID, edge.Up, edge.Down, "")
 
 		if err != nil {
@@ -305,7 +405,7 @@ func (sdb *DbSqlite) edgePoints(nodeID, parentID string, points data.Points) err
 		}
 	}
 
-	rowsPoints, err := sdb.db.Query("SELECT * FROM edge_points WHERE edge_id=?", edge.ID)
+	rowsPoints, err := tx.Query("SELECT * FROM edge_points WHERE edge_id=?", edge.ID)
 	if err != nil {
 		return err
 	}
@@ -329,6 +429,11 @@ func (sdb *DbSqlite) edgePoints(nodeID, parentID string, points data.Points) err
 		dbPointIDs = append(dbPointIDs, pID)
 	}
 
+	err = rowsPoints.Close()
+	if err != nil {
+		return err
+	}
+
 	var writePoints data.Points
 	var writePointIDs []string
 
@@ -355,10 +460,6 @@ NextPin:
 	}
 
 	// loop through write points and write them
-	tx, err := sdb.db.Begin()
-	if err != nil {
-		return err
-	}
 	stmt, err := tx.Prepare(`INSERT INTO edge_points(id, edge_id, type, key, time_s,
                  time_ns, idx, value, text, data, tombstone, origin)
 		 VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
@@ -374,8 +475,13 @@ NextPin:
 		 tombstone = ?11,
 		 origin = ?12
 		 `)
+	if err != nil {
+		return err
+	}
 	defer stmt.Close()
 
+	tombstone := false
+
 	for i, p := range writePoints {
 		tS := p.Time.Unix()
 		tNs := p.Time.UnixNano() - 1e9*tS
@@ -383,23 +489,29 @@ NextPin:
 		_, err = stmt.Exec(pID, edge.ID, p.Type, p.Key, tS, tNs, p.Index, p.Value, p.Text, p.Data, p.Tombstone,
 			p.Origin)
 		if err != nil {
-			rbErr := tx.Rollback()
-			if rbErr != nil {
-				log.Println("Rollback error: ", rbErr)
-			}
-
 			return err
 		}
+
+		if p.Type == data.PointTypeTombstone {
+			tombstone = true
+		}
 	}
 
-	err = tx.Commit()
-	if err != nil {
-		return err
+	if newEdge || tombstone {
+		_, err = tx.Exec(sqliteIndexEdges+"WHERE e.id=?", edge.ID)
+		if err != nil {
+			return fmt.Errorf("Error updating edge index: %w", err)
+		}
 	}
 
 	return nil
 }
 
+// batch writes node and edge points in one transaction
+func (sdb *DbSqlite) batch(writes []pointWrite) error {
+	return sqlBatch(sdb.db, writes, sdb.nodePointsTx, sdb.edgePointsTx)
+}
+
 // Close the db
 func (sdb *DbSqlite) Close() error {
 	return sdb.db.Close()
@@ -423,28 +535,56 @@ func (sdb *DbSqlite) node(id string) (*data.Node, error) {
 	}
 
 	if ret.Type == "" {
-		return nil, errors.New("node not found")
+		return nil, data.ErrDocumentNotFound
 	}
 
 	return &ret, err
 }
 
+// children uses the edge index to find the children of a node, so only the
+// points of the children that are returned are read
 func (sdb *DbSqlite) children(id, typ string, includeDel bool) ([]data.NodeEdge, error) {
 	var ret []data.NodeEdge
 
-	rowsEdges, err := sdb.db.Query("SELECT * FROM edges WHERE up=?", id)
+	q := `SELECT e.id, e.up, e.down, e.hash FROM edge_index i
+		JOIN edges e ON e.id = i.edge_id WHERE i.up=?`
+	args := []interface{}{id}
+
+	if typ != "" {
+		q += " AND i.node_type=?"
+		args = append(args, typ)
+	}
+
+	if !includeDel {
+		q += " AND i.tombstone=0"
+	}
+
+	// return children in the order they were added
+	q += " ORDER BY e.rowid"
+
+	rowsEdges, err := sdb.db.Query(q, args...)
 	if err != nil {
 		return ret, fmt.Errorf("Error getting edges: %v", err)
 	}
 	defer rowsEdges.Close()
 
+	var edges []data.Edge
+
 	for rowsEdges.Next() {
 		var edge data.Edge
 		err = rowsEdges.Scan(&edge.ID, &edge.Up, &edge.Down, &edge.Hash)
 		if err != nil {
 			return nil, fmt.Errorf("Error scanning edges: %v", err)
 		}
+		edges = append(edges, edge)
+	}
+
+	err = rowsEdges.Close()
+	if err != nil {
+		return nil, err
+	}
 
+	for _, edge := range edges {
 		var ne data.NodeEdge
 		ne.ID = edge.Down
 		ne.Parent = id
@@ -456,27 +596,12 @@ func (sdb *DbSqlite) children(id, typ string, includeDel bool) ([]data.NodeEdge,
 			return nil, fmt.Errorf("children error getting edge points: %v", err)
 		}
 
-		if !includeDel {
-			tombstone, _ := ne.IsTombstone()
-			if tombstone {
-				// skip deleted nodes
-				continue
-			}
-		}
-
 		q = fmt.Sprintf("SELECT * FROM node_points WHERE node_id='%v'", edge.Down)
 		ne.Points, ne.Type, err = sdb.queryPoints(q)
 		if err != nil {
 			return nil, fmt.Errorf("children error getting edge points: %v", err)
 		}
 
-		if typ != "" {
-			if ne.Type != typ {
-				// skip node of incorrect type
-				continue
-			}
-		}
-
 		ret = append(ret, ne)
 	}
 
@@ -549,7 +674,7 @@ func (sdb *DbSqlite) nodeEdge(id, parent string) ([]data.NodeEdge, error) {
 	}
 
 	if len(ret) < 1 {
-		return ret, fmt.Errorf("Node not found")
+		return ret, data.ErrDocumentNotFound
 	}
 
 	return ret, nil
@@ -659,3 +784,167 @@ func (sdb *DbSqlite) up(id string, includeDeleted bool) ([]string, error) {
 
 	return ups, nil
 }
+
+func (sdb *DbSqlite) historyInsert(retentionID string, points []historyPoint) error {
+	tx, err := sdb.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	stmt, err := tx.Prepare(`INSERT INTO history(retention_id, node_id, type, key,
+		time, interval_ns, value, min, max, count, text)
+		VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+
+	for _, p := range points {
+		_, err = stmt.Exec(retentionID, p.NodeID, p.Type, p.Key, p.Time.UnixNano(),
+			int64(p.Interval), p.Value, p.Min, p.Max, p.Count, p.Text)
+		if err != nil {
+			rbErr := tx.Rollback()
+			if rbErr != nil {
+				log.Println("Rollback error: ", rbErr)
+			}
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// historyRaw returns raw history points older than before
+func (sdb *DbSqlite) historyRaw(retentionID string, before time.Time) ([]historyPoint, error) {
+	rows, err := sdb.db.Query(`SELECT node_id, type, key, time, value, min, max,
+		count, text FROM history WHERE retention_id=? AND interval_ns=0 AND time<?
+		ORDER BY time`, retentionID, before.UnixNano())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ret []historyPoint
+
+	for rows.Next() {
+		var p historyPoint
+		var t int64
+		err := rows.Scan(&p.NodeID, &p.Type, &p.Key, &t, &p.Value, &p.Min, &p.Max,
+			&p.Count, &p.Text)
+		if err != nil {
+			return nil, err
+		}
+		p.Time = time.Unix(0, t)
+		ret = append(ret, p)
+	}
+
+	return ret, rows.Err()
+}
+
+// historyQuery returns raw and downsampled history points for a node between
+// start and end (inclusive). typ and key are ignored if blank, and a zero end
+// time means there is no end.
+func (sdb *DbSqlite) historyQuery(nodeID, typ, key string, start, end time.Time) ([]historyPoint, error) {
+	q := `SELECT node_id, type, key, time, interval_ns, value, min, max, count, text
+		FROM history WHERE node_id=? AND time>=?`
+	args := []interface{}{nodeID, start.UnixNano()}
+
+	if !end.IsZero() {
+		q += " AND time<=?"
+		args = append(args, end.UnixNano())
+	}
+
+	if typ != "" {
+		q += " AND type=?"
+		args = append(args, typ)
+	}
+
+	if key != "" {
+		q += " AND key=?"
+		args = append(args, key)
+	}
+
+	rows, err := sdb.db.Query(q+" ORDER BY time", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ret []historyPoint
+
+	for rows.Next() {
+		var p historyPoint
+		var t, interval int64
+		err := rows.Scan(&p.NodeID, &p.Type, &p.Key, &t, &interval, &p.Value, &p.Min,
+			&p.Max, &p.Count, &p.Text)
+		if err != nil {
+			return nil, err
+		}
+		p.Time = time.Unix(0, t)
+		p.Interval = time.Duration(interval)
+		ret = append(ret, p)
+	}
+
+	return ret, rows.Err()
+}
+
+// historyDelete deletes raw or downsampled history points older than before
+func (sdb *DbSqlite) historyDelete(retentionID string, raw bool, before time.Time) error {
+	q := "DELETE FROM history WHERE retention_id=? AND interval_ns>0 AND time<?"
+	if raw {
+		q = "DELETE FROM history WHERE retention_id=? AND interval_ns=0 AND time<?"
+	}
+
+	_, err := sdb.db.Exec(q, retentionID, before.UnixNano())
+	return err
+}
+
+// historyBytes returns the approximate size of the history of a retention
+// node
+func (sdb *DbSqlite) historyBytes(retentionID string) (int64, error) {
+	return sqlHistoryBytes(sdb.db, rebindNone, retentionID)
+}
+
+// snapshot reads all nodes, edges, and optionally history in one transaction
+func (sdb *DbSqlite) snapshot(history bool) (*snapshot, error) {
+	return sqlSnapshot(sdb.db, "rowid", history)
+}
+
+// restore replaces all data with a snapshot
+func (sdb *DbSqlite) restore(s *snapshot) error {
+	err := sqlRestore(sdb.db, rebindNone, s)
+	if err != nil {
+		return err
+	}
+
+	sdb.meta.RootID = s.RootID
+	return sdb.reindexEdges()
+}
+
+// repairEdges deletes edges and writes edge hashes
+func (sdb *DbSqlite) repairEdges(deleteIDs []string, hashes map[string][]byte) error {
+	err := sqlRepairEdges(sdb.db, rebindNone, deleteIDs, hashes)
+	if err != nil {
+		return err
+	}
+
+	_, err = sdb.db.Exec("DELETE FROM edge_index WHERE edge_id NOT IN (SELECT id FROM edges)")
+	return err
+}
+
+// purge deletes edges, their points, and node points
+func (sdb *DbSqlite) purge(edgeIDs, nodeIDs []string) error {
+	err := sqlPurge(sdb.db, rebindNone, edgeIDs, nodeIDs)
+	if err != nil {
+		return err
+	}
+
+	_, err = sdb.db.Exec("DELETE FROM edge_index WHERE edge_id NOT IN (SELECT id FROM edges)")
+	return err
+}
+
+// purgePoints deletes node points
+func (sdb *DbSqlite) purgePoints(points []pointRef) error {
+	return sqlPurgePoints(sdb.db, rebindNone, points)
+}
@@ -27,6 +27,11 @@ func TestDbSqlite(t *testing.T) {
 	db := newTestDb(t)
 	defer db.Close()
 
+	testBackend(t, db)
+}
+
+// testBackend runs tests that are common to all backends
+func testBackend(t *testing.T, db backend) {
 	rootID := db.rootNodeID()
 
 	if rootID == "" {
@@ -202,6 +207,10 @@ func TestDbSqliteUserCheck(t *testing.T) {
 	db := newTestDb(t)
 	defer db.Close()
 
+	testBackendUserCheck(t, db)
+}
+
+func testBackendUserCheck(t *testing.T, db backend) {
 	nodes, err := db.userCheck("admin@admin.com", "admin")
 	if err != nil {
 		t.Fatal("userCheck returned error: ", err)
@@ -216,6 +225,10 @@ func TestDbSqliteUp(t *testing.T) {
 	db := newTestDb(t)
 	defer db.Close()
 
+	testBackendUp(t, db)
+}
+
+func testBackendUp(t *testing.T, db backend) {
 	rootID := db.rootNodeID()
 
 	children, err := db.children(rootID, "", false)
@@ -259,3 +272,159 @@ func TestDbSqliteUp(t *testing.T) {
 		t.Fatal("ups, wrong ID for root: ", ups[0])
 	}
 }
+
+func TestDbSqliteChildren(t *testing.T) {
+	db := newTestDb(t)
+	defer db.Close()
+
+	testBackendChildren(t, db)
+
+	// dbs created before the edge index get it built when opened
+	_, err := db.db.Exec("DELETE FROM edge_index")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = db.db.Exec("UPDATE meta SET version=0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db.Close()
+
+	db, err = NewSqliteDb(testFile)
+	if err != nil {
+		t.Fatal("Error opening db: ", err)
+	}
+	defer db.Close()
+
+	children, err := db.children(db.rootNodeID(), data.NodeTypeVariable, false)
+	if err != nil || len(children) != 1 || children[0].ID != "var2" {
+		t.Fatal("Edge index not rebuilt: ", err, children)
+	}
+}
+
+func TestMemoryBackendChildren(t *testing.T) {
+	testBackendChildren(t, newTestMemoryBackend(t))
+}
+
+func testBackendChildren(t *testing.T, db backend) {
+	rootID := db.rootNodeID()
+
+	for _, id := range []string{"var1", "var2", "var3"} {
+		err := db.nodePoints(id, data.Points{{Type: data.PointTypeNodeType,
+			Text: data.NodeTypeVariable}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = db.edgePoints(id, rootID, data.Points{{Type: data.PointTypeTombstone}})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	checkChildren := func(typ string, includeDel bool, exp ...string) {
+		t.Helper()
+		children, err := db.children(rootID, typ, includeDel)
+		if err != nil {
+			t.Fatal("Error getting children: ", err)
+		}
+
+		var ids []string
+		for _, c := range children {
+			if c.Type == data.NodeTypeVariable {
+				ids = append(ids, c.ID)
+			}
+		}
+
+		if fmt.Sprint(ids) != fmt.Sprint(exp) {
+			t.Fatalf("Expected children %v, got %v", exp, ids)
+		}
+	}
+
+	checkChildren(data.NodeTypeVariable, false, "var1", "var2", "var3")
+
+	// delete a node
+	err := db.edgePoints("var1", rootID, data.Points{{Type: data.PointTypeTombstone,
+		Value: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkChildren(data.NodeTypeVariable, false, "var2", "var3")
+	checkChildren(data.NodeTypeVariable, true, "var1", "var2", "var3")
+	checkChildren("", false, "var2", "var3")
+
+	// change the node type
+	err = db.nodePoints("var3", data.Points{{Type: data.PointTypeNodeType,
+		Text: data.NodeTypeGroup}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkChildren(data.NodeTypeVariable, false, "var2")
+
+	groups, err := db.children(rootID, data.NodeTypeGroup, false)
+	if err != nil || len(groups) != 1 || groups[0].ID != "var3" {
+		t.Fatal("Expected var3 group: ", err, groups)
+	}
+}
+
+// BenchmarkDbSqliteChildren gets the children of a node with 10 children in
+// trees of different sizes. With the edge index, the time does not depend on
+// the size of the tree.
+func BenchmarkDbSqliteChildren(b *testing.B) {
+	for _, size := range []int{1000, 10000} {
+		b.Run(fmt.Sprint(size), func(b *testing.B) {
+			exec.Command("sh", "-c", "rm "+testFile+"*").Run()
+
+			db, err := NewSqliteDb(testFile)
+			if err != nil {
+				b.Fatal("Error opening db: ", err)
+			}
+			defer db.Close()
+
+			rootID := db.rootNodeID()
+			parentID := uuid.New().String()
+
+			var writes []pointWrite
+
+			addNode := func(id, parent, typ string) {
+				writes = append(writes,
+					pointWrite{nodeID: id, points: data.Points{{Type: data.PointTypeNodeType,
+						Text: typ}, {Type: data.PointTypeDescription, Text: id}}},
+					pointWrite{nodeID: id, parentID: parent, edge: true,
+						points: data.Points{{Type: data.PointTypeTombstone}}})
+			}
+
+			addNode(parentID, rootID, data.NodeTypeGroup)
+
+			for i := 0; i < 10; i++ {
+				typ := data.NodeTypeVariable
+				if i%2 == 0 {
+					typ = data.NodeTypeGroup
+				}
+				addNode(uuid.New().String(), parentID, typ)
+			}
+
+			for i := 0; i < size; i++ {
+				addNode(uuid.New().String(), rootID, data.NodeTypeVariable)
+			}
+
+			err = db.batch(writes)
+			if err != nil {
+				b.Fatal("Error writing nodes: ", err)
+			}
+
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				children, err := db.children(parentID, data.NodeTypeVariable, false)
+				if err != nil || len(children) != 5 {
+					b.Fatal("Error getting children: ", err, len(children))
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package store
+
+import (
+	"log"
+	"time"
+
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// ttlEntry tracks the latest point of a type/key of a node that has a TTL
+type ttlEntry struct {
+	// time of the latest point, or of the cleared point written when the
+	// TTL expired
+	time  time.Time
+	stale bool
+	timer *time.Timer
+}
+
+// ttl tracks points with a TTL. When the TTL of the latest point expires,
+// the store writes a point with a cleared value and a stale point (see
+// expire). Points written after that set stale back to 0. TTLs are only
+// tracked in memory, so they are not restored when the store restarts.
+func (st *Store) ttl(nodeID string, points data.Points) data.Points {
+	var ret data.Points
+
+	for _, p := range points {
+		if p.Type == data.PointTypeStale {
+			continue
+		}
+
+		typeKey := p.TypeKey()
+		key := nodeID + "/" + typeKey
+
+		st.lock.Lock()
+		e, ok := st.ttls[key]
+		if (!ok && p.TTL <= 0) || (ok && !p.Time.After(e.time)) {
+			// not tracked, or an older point or our own cleared point
+			st.lock.Unlock()
+			continue
+		}
+
+		if ok {
+			e.timer.Stop()
+			delete(st.ttls, key)
+		}
+
+		if p.TTL > 0 {
+			entry := &ttlEntry{time: p.Time}
+			typ, pKey := p.Type, p.Key
+			entry.timer = time.AfterFunc(time.Until(p.Time.Add(p.TTL)), func() {
+				st.expire(nodeID, typ, pKey, entry)
+			})
+			st.ttls[key] = entry
+		}
+		st.lock.Unlock()
+
+		if ok && e.stale {
+			// the stale point was written with the store time
+			ret = append(ret, data.Point{Type: data.PointTypeStale, Key: typeKey,
+				Time: time.Now(), Value: 0})
+		}
+	}
+
+	return append(points, ret...)
+}
+
+// expire clears the value of a point whose TTL has passed and marks it
+// stale, unless entry was replaced by a newer point
+func (st *Store) expire(nodeID, typ, key string, entry *ttlEntry) {
+	now := time.Now()
+	p := data.Point{Type: typ, Key: key, Time: now}
+	typeKey := p.TypeKey()
+
+	st.lock.Lock()
+	if st.ttls[nodeID+"/"+typeKey] != entry {
+		st.lock.Unlock()
+		return
+	}
+	entry.time = now
+	entry.stale = true
+	st.lock.Unlock()
+
+	if _, err := st.db.node(nodeID); err != nil {
+		// the node was deleted
+		st.lock.Lock()
+		delete(st.ttls, nodeID+"/"+typeKey)
+		st.lock.Unlock()
+		return
+	}
+
+	err := client.SendNodePoints(st.nc, nodeID, data.Points{
+		p,
+		{Type: data.PointTypeStale, Key: typeKey, Time: now, Value: 1},
+	}, false)
+	if err != nil {
+		log.Println("Error sending expired point: ", err)
+	}
+}
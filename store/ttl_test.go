@@ -0,0 +1,65 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+func TestStoreTTL(t *testing.T) {
+	nc, st, _ := startBatchTestStore(t, -1)
+
+	root := st.db.rootNodeID()
+
+	err := client.SendNodeType(nc, client.Variable{ID: "presence", Parent: root}, "test")
+	if err != nil {
+		t.Fatal("Error sending node: ", err)
+	}
+
+	send := func(v float64, ttl time.Duration) {
+		t.Helper()
+		err := client.SendNodePoint(nc, "presence", data.Point{Time: time.Now(),
+			Type: data.PointTypeValue, Value: v, TTL: ttl}, true)
+		if err != nil {
+			t.Fatal("Error sending point: ", err)
+		}
+	}
+
+	check := func(expValue, expStale float64) {
+		t.Helper()
+		node, err := st.db.node("presence")
+		if err != nil {
+			t.Fatal("Error getting node: ", err)
+		}
+
+		v, _ := node.Points.Value(data.PointTypeValue, "")
+		stale, _ := node.Points.Value(data.PointTypeStale, data.PointTypeValue)
+		if v != expValue || stale != expStale {
+			t.Fatalf("expected value %v, stale %v, got %v, %v", expValue, expStale,
+				v, stale)
+		}
+	}
+
+	ttl := 100 * time.Millisecond
+
+	// refreshing the point before the TTL keeps it
+	send(1, ttl)
+	time.Sleep(ttl / 2)
+	send(1, ttl)
+	time.Sleep(ttl / 2)
+	check(1, 0)
+
+	// the value is cleared and marked stale once the TTL expires
+	time.Sleep(ttl * 2)
+	check(0, 1)
+
+	send(1, ttl)
+	check(1, 0)
+
+	// points without a TTL stop tracking
+	send(2, 0)
+	time.Sleep(ttl * 2)
+	check(2, 0)
+}
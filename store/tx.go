@@ -0,0 +1,125 @@
+package store
+
+import (
+	"errors"
+	"log"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// handleTx writes node and edge points for multiple nodes in one transaction.
+// After the transaction is committed, the points are published to the node
+// and edge point subjects for clients, and sent upstream.
+func (st *Store) handleTx(msg *nats.Msg) {
+	writes, err := data.PbDecodeTx(msg.Data)
+	if err != nil {
+		log.Println("Error decoding transaction: ", err)
+		st.reply(msg.Reply, errors.New("error decoding transaction"))
+		return
+	}
+
+	if len(writes) <= 0 {
+		st.reply(msg.Reply, nil)
+		return
+	}
+
+	for _, w := range writes {
+		if w.NodeID == "" {
+			st.reply(msg.Reply, errors.New("transaction write node ID must be set"))
+			return
+		}
+	}
+
+	writes, err = st.prepareWrites(writes, false)
+	if err != nil {
+		log.Println("Store: ", err)
+		st.reply(msg.Reply, err)
+		return
+	}
+
+	if len(writes) <= 0 {
+		st.reply(msg.Reply, nil)
+		return
+	}
+
+	tx := make([]pointWrite, len(writes))
+	for i, w := range writes {
+		tx[i] = pointWrite{
+			nodeID:   w.NodeID,
+			parentID: w.ParentID,
+			edge:     w.Edge,
+			points:   w.Points,
+		}
+	}
+
+	st.write(pointWrite{
+		tx: tx,
+		done: func(writeErr error) {
+			st.txWritten(msg, writes, writeErr)
+		},
+	})
+}
+
+// txWritten publishes the points of a transaction and sends them upstream
+// after they are written. Nothing is sent if the transaction fails.
+func (st *Store) txWritten(msg *nats.Msg, writes []data.TxWrite, writeErr error) {
+	if writeErr != nil {
+		if writeErr != ErrReadOnly {
+			log.Printf("Error writing transaction of %v writes: %v\n",
+				len(writes), writeErr)
+		}
+		st.reply(msg.Reply, writeErr)
+		return
+	}
+
+	st.publishTx(writes)
+	st.reply(msg.Reply, nil)
+}
+
+// publishTx publishes the points of a committed transaction to the node and
+// edge point subjects and sends them upstream
+func (st *Store) publishTx(writes []data.TxWrite) {
+	for _, w := range writes {
+		subject := client.SubjectNodePoints(w.NodeID)
+		if w.Edge {
+			subject = client.SubjectEdgePoints(w.NodeID, w.ParentID)
+		}
+
+		err := st.publishTxPoints(subject, w.Points)
+		if err != nil {
+			log.Println("Error publishing transaction points: ", err)
+		}
+
+		if w.Edge {
+			st.clearSearch()
+			st.clearExternalHistory()
+			err = st.processEdgePointsUpstream(w.NodeID, w.NodeID, w.ParentID, w.Points)
+			if err != nil {
+				log.Println("Error processing point in upstream nodes: ", err)
+			}
+		} else {
+			err = st.nodePointsUpstream(w.NodeID, w.Points, nil)
+			if err != nil {
+				log.Println("Error getting transaction node: ", w.NodeID, err)
+			}
+		}
+	}
+}
+
+// publishTxPoints publishes points that were written in a transaction. The
+// tx header is set to the txID of the store to tell it the points have
+// already been written.
+func (st *Store) publishTxPoints(subject string, points data.Points) error {
+	d, err := points.ToPb()
+	if err != nil {
+		return err
+	}
+
+	m := nats.NewMsg(subject)
+	m.Header.Set(client.HeaderTx, st.txID)
+	m.Data = d
+
+	return st.nc.PublishMsg(m)
+}
@@ -0,0 +1,175 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+func TestStoreTx(t *testing.T) {
+	nc, st, db := startBatchTestStore(t, -1)
+	rootID := st.db.rootNodeID()
+
+	published := make(chan data.Points, 10)
+	sub, err := nc.Subscribe(client.SubjectNodePoints("a"), func(msg *nats.Msg) {
+		points, err := data.PbDecodePoints(msg.Data)
+		if err != nil {
+			t.Error("Error decoding points: ", err)
+			return
+		}
+		published <- points
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Unsubscribe()
+
+	start := db.count()
+
+	err = client.SendNodePointsTx(nc, []data.TxWrite{
+		{NodeID: "a", Points: data.Points{
+			{Type: data.PointTypeNodeType, Text: data.NodeTypeVariable},
+			{Type: data.PointTypeValue, Value: 1}}},
+		{NodeID: "a", ParentID: rootID, Edge: true, Points: data.Points{
+			{Type: data.PointTypeTombstone}}},
+		{NodeID: "b", Points: data.Points{
+			{Type: data.PointTypeNodeType, Text: data.NodeTypeVariable},
+			{Type: data.PointTypeValue, Value: 2}}},
+	})
+	if err != nil {
+		t.Fatal("Error sending transaction: ", err)
+	}
+
+	select {
+	case points := <-published:
+		if v, _ := points.Value(data.PointTypeValue, ""); v != 1 {
+			t.Error("Wrong published value: ", v)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Transaction points not published")
+	}
+
+	children, err := st.db.children(rootID, data.NodeTypeVariable, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(children) != 1 || children[0].ID != "a" {
+		t.Fatal("Edge not written: ", children)
+	}
+
+	node, err := st.db.node("b")
+	if err != nil {
+		t.Fatal("Node b not written: ", err)
+	}
+
+	if v, _ := node.Points.Value(data.PointTypeValue, ""); v != 2 {
+		t.Error("Wrong value for b: ", v)
+	}
+
+	// the published points are not written again
+	time.Sleep(100 * time.Millisecond)
+	if db.count()-start != 1 {
+		t.Error("Expected 1 batch, got: ", db.count()-start)
+	}
+
+	// a tx header that was not set by the store is ignored, so the
+	// request is written and answered
+	m := nats.NewMsg(client.SubjectNodePoints("b"))
+	m.Header.Set(client.HeaderTx, "1")
+	points := data.Points{{Type: data.PointTypeValue, Value: 3}}
+	m.Data, err = points.ToPb()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reply, err := nc.RequestMsg(m, time.Second)
+	if err != nil {
+		t.Fatal("No reply to points with a tx header: ", err)
+	}
+
+	if len(reply.Data) > 0 {
+		t.Fatal("Error writing points with a tx header: ", string(reply.Data))
+	}
+
+	node, err = st.db.node("b")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v, _ := node.Points.Value(data.PointTypeValue, ""); v != 3 {
+		t.Error("Points with a tx header not written, value: ", v)
+	}
+
+	// a failed write fails the whole transaction
+	err = client.SendNodePointsTx(nc, []data.TxWrite{
+		{NodeID: "a", Points: data.Points{{Type: data.PointTypeValue, Value: 10}}},
+		{NodeID: "bad", Points: data.Points{{Type: data.PointTypeValue, Value: 10}}},
+	})
+	if err == nil {
+		t.Fatal("Expected transaction to fail")
+	}
+
+	node, err = st.db.node("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v, _ := node.Points.Value(data.PointTypeValue, ""); v != 1 {
+		t.Error("Failed transaction was partly written, value: ", v)
+	}
+}
+
+func TestStoreTxBatchRetry(t *testing.T) {
+	nc, st, _ := startBatchTestStore(t, 200*time.Millisecond)
+
+	err := client.SendNode(nc, data.NodeEdge{
+		ID:     "good",
+		Type:   data.NodeTypeVariable,
+		Parent: st.db.rootNodeID(),
+	}, "")
+	if err != nil {
+		t.Fatal("Error sending variable node: ", err)
+	}
+
+	// the failed transaction is batched with a good write, which is still
+	// written when the batch is retried
+	errs := make(chan error, 2)
+	go func() {
+		errs <- client.SendNodePointsTx(nc, []data.TxWrite{
+			{NodeID: "good", Points: data.Points{{Type: data.PointTypeValue, Value: 5}}},
+			{NodeID: "bad", Points: data.Points{{Type: data.PointTypeValue, Value: 5}}},
+		})
+	}()
+	go func() {
+		errs <- client.SendNodePoint(nc, "good", data.Point{Type: data.PointTypeDescription,
+			Text: "good"}, true)
+	}()
+
+	var failed int
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != nil {
+			failed++
+		}
+	}
+
+	if failed != 1 {
+		t.Fatal("Expected only the transaction to fail, failed: ", failed)
+	}
+
+	node, err := st.db.node("good")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v, _ := node.Points.Value(data.PointTypeValue, ""); v != 0 {
+		t.Error("Failed transaction was partly written, value: ", v)
+	}
+
+	if d, _ := node.Points.Text(data.PointTypeDescription, ""); d != "good" {
+		t.Error("Good write not written: ", d)
+	}
+}
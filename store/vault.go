@@ -0,0 +1,96 @@
+package store
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type vaultKeeper struct {
+	addr   string
+	token  string
+	key    string
+	client *http.Client
+}
+
+// NewVaultKeeper returns a SecretKeeper that uses the transit secrets engine
+// of a HashiCorp Vault server at addr to encrypt secrets with the named key.
+// The data key never leaves Vault.
+func NewVaultKeeper(addr, token, key string) SecretKeeper {
+	return &vaultKeeper{
+		addr:   strings.TrimSuffix(addr, "/"),
+		token:  token,
+		key:    key,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+type vaultResponse struct {
+	Data struct {
+		Ciphertext string `json:"ciphertext"`
+		Plaintext  string `json:"plaintext"`
+	} `json:"data"`
+	Errors []string `json:"errors"`
+}
+
+func (k *vaultKeeper) post(op string, body map[string]string) (vaultResponse, error) {
+	var ret vaultResponse
+
+	d, err := json.Marshal(body)
+	if err != nil {
+		return ret, err
+	}
+
+	url := fmt.Sprintf("%v/v1/transit/%v/%v", k.addr, op, k.key)
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(d))
+	if err != nil {
+		return ret, err
+	}
+
+	req.Header.Set("X-Vault-Token", k.token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return ret, fmt.Errorf("Vault %v error: %w", op, err)
+	}
+	defer resp.Body.Close()
+
+	err = json.NewDecoder(resp.Body).Decode(&ret)
+	if err != nil {
+		return ret, fmt.Errorf("Error decoding Vault %v response: %w", op, err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return ret, fmt.Errorf("Vault %v returned %v: %v", op, resp.Status,
+			strings.Join(ret.Errors, ", "))
+	}
+
+	return ret, nil
+}
+
+func (k *vaultKeeper) Encrypt(plain []byte) (string, error) {
+	resp, err := k.post("encrypt", map[string]string{
+		"plaintext": base64.StdEncoding.EncodeToString(plain),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return resp.Data.Ciphertext, nil
+}
+
+func (k *vaultKeeper) Decrypt(ciphertext string) ([]byte, error) {
+	resp, err := k.post("decrypt", map[string]string{
+		"ciphertext": ciphertext,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return base64.StdEncoding.DecodeString(resp.Data.Plaintext)
+}
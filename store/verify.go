@@ -0,0 +1,378 @@
+package store
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// verifyResult is the problems found in a snapshot and the changes needed to
+// repair them. problem is the index of the problem in the report that the
+// change repairs.
+type verifyResult struct {
+	problems []data.StoreProblem
+	// edges to delete
+	deleteEdges []verifyFix
+	// edge points to write
+	edgePoints []verifyEdgePoint
+	// recomputed hashes for edges that do not match the stored hash
+	hashes map[string][]byte
+}
+
+type verifyFix struct {
+	problem int
+	id      string
+}
+
+type verifyEdgePoint struct {
+	problem  int
+	nodeID   string
+	parentID string
+	point    data.Point
+}
+
+// Verify checks edge hashes, orphaned nodes and edges, and tombstones in the
+// store. If repair is set, the problems that can be fixed are repaired:
+//   - edges to nodes or parents that don't exist are deleted
+//   - nodes that can't be reached from the root are added to the root node as
+//     deleted nodes so they can be restored or removed
+//   - the root node is undeleted
+//   - the recomputed edge hashes are stored
+//
+// Deleted node type points are only reported.
+func (st *Store) Verify(repair bool) (data.StoreVerifyReport, error) {
+	report := data.StoreVerifyReport{Time: time.Now(), Repair: repair}
+
+	s, err := st.db.snapshot(false)
+	if err != nil {
+		return report, fmt.Errorf("Error reading store: %w", err)
+	}
+
+	report.Nodes = len(s.Nodes)
+	report.Edges = len(s.Edges)
+
+	res := verifySnapshot(s)
+	report.Problems = res.problems
+
+	if !repair || len(res.problems) <= 0 {
+		return report, nil
+	}
+
+	var deleteIDs []string
+	for _, f := range res.deleteEdges {
+		deleteIDs = append(deleteIDs, f.id)
+	}
+
+	if len(deleteIDs) > 0 {
+		err = st.db.repairEdges(deleteIDs, nil)
+		if err != nil {
+			return report, fmt.Errorf("Error deleting orphaned edges: %w", err)
+		}
+
+		for _, f := range res.deleteEdges {
+			report.Problems[f.problem].Repaired = true
+		}
+	}
+
+	// edge points are sent through NATS so that clients see them
+	for _, p := range res.edgePoints {
+		err = client.SendEdgePoint(st.nc, p.nodeID, p.parentID, p.point, true)
+		if err != nil {
+			log.Println("Store verify: error repairing edge: ", err)
+			continue
+		}
+
+		report.Problems[p.problem].Repaired = true
+	}
+
+	// hashes depend on the repaired edges, so compute them again
+	s, err = st.db.snapshot(false)
+	if err != nil {
+		return report, fmt.Errorf("Error reading repaired store: %w", err)
+	}
+
+	res = verifySnapshot(s)
+
+	if len(res.hashes) > 0 {
+		err = st.db.repairEdges(nil, res.hashes)
+		if err != nil {
+			return report, fmt.Errorf("Error writing edge hashes: %w", err)
+		}
+	}
+
+	for i, p := range report.Problems {
+		if p.Type == data.StoreProblemHash {
+			report.Problems[i].Repaired = true
+		}
+	}
+
+	return report, nil
+}
+
+// verifySnapshot finds problems in a snapshot
+func verifySnapshot(s *snapshot) verifyResult {
+	var ret verifyResult
+
+	addProblem := func(p data.StoreProblem) int {
+		ret.problems = append(ret.problems, p)
+		return len(ret.problems) - 1
+	}
+
+	nodes := make(map[string]data.Points, len(s.Nodes))
+	for _, n := range s.Nodes {
+		nodes[n.ID] = n.Points
+	}
+
+	nodeType := func(id string) string {
+		points := nodes[id]
+		t, _ := points.Text(data.PointTypeNodeType, "")
+		return t
+	}
+
+	// edges that point to nodes that exist, by parent ID
+	valid := make(map[string][]*data.Edge)
+	validIDs := make(map[string]bool)
+	// number of valid edges that point to each node
+	ups := make(map[string]int)
+
+	for i := range s.Edges {
+		e := &s.Edges[i]
+
+		_, downOk := nodes[e.Down]
+		_, upOk := nodes[e.Up]
+		if e.Up == "none" {
+			upOk = e.Down == s.RootID
+		}
+
+		if !downOk || !upOk {
+			desc := fmt.Sprintf("edge from %v to %v", e.Up, e.Down)
+			switch {
+			case !downOk:
+				desc += ", node does not exist"
+			case e.Up == "none":
+				desc += ", only the root node can be at the top of the tree"
+			default:
+				desc += ", parent does not exist"
+			}
+
+			i := addProblem(data.StoreProblem{
+				Type:        data.StoreProblemOrphanEdge,
+				NodeID:      e.Down,
+				EdgeID:      e.ID,
+				Description: desc,
+			})
+			ret.deleteEdges = append(ret.deleteEdges, verifyFix{problem: i, id: e.ID})
+			continue
+		}
+
+		if e.Up == "none" && e.IsTombstone() {
+			i := addProblem(data.StoreProblem{
+				Type:        data.StoreProblemTombstone,
+				NodeID:      e.Down,
+				EdgeID:      e.ID,
+				Description: "root node is deleted",
+			})
+			ret.edgePoints = append(ret.edgePoints, verifyEdgePoint{
+				problem: i, nodeID: e.Down, parentID: "none",
+				point: data.Point{Time: time.Now(), Type: data.PointTypeTombstone, Value: 0},
+			})
+		}
+
+		valid[e.Up] = append(valid[e.Up], e)
+		validIDs[e.ID] = true
+		ups[e.Down]++
+	}
+
+	for _, n := range s.Nodes {
+		p, ok := n.Points.Find(data.PointTypeNodeType, "")
+		if ok && p.Tombstone%2 != 0 {
+			addProblem(data.StoreProblem{
+				Type:        data.StoreProblemTombstone,
+				NodeID:      n.ID,
+				Description: fmt.Sprintf("node type point (%v) is deleted", p.Text),
+			})
+		}
+	}
+
+	// walk the tree from the root to find nodes that can't be reached.
+	// Deleted nodes are still part of the tree.
+	reached := make(map[string]bool)
+	var walk func(id string) int
+	walk = func(id string) int {
+		if reached[id] {
+			return 0
+		}
+		reached[id] = true
+		count := 1
+		for _, e := range valid[id] {
+			count += walk(e.Down)
+		}
+		return count
+	}
+
+	walk(s.RootID)
+
+	orphan := func(id string) {
+		count := walk(id) - 1
+		i := addProblem(data.StoreProblem{
+			Type:   data.StoreProblemOrphanNode,
+			NodeID: id,
+			Description: fmt.Sprintf("%v node and %v descendants can't be reached from the root node",
+				nodeType(id), count),
+		})
+		ret.edgePoints = append(ret.edgePoints, verifyEdgePoint{
+			problem: i, nodeID: id, parentID: s.RootID,
+			point: data.Point{Time: time.Now(), Type: data.PointTypeTombstone, Value: 1},
+		})
+	}
+
+	// report the top of each unreachable subtree, and then any nodes left in
+	// cycles
+	for _, n := range s.Nodes {
+		if !reached[n.ID] && ups[n.ID] == 0 {
+			orphan(n.ID)
+		}
+	}
+
+	for _, n := range s.Nodes {
+		if !reached[n.ID] {
+			orphan(n.ID)
+		}
+	}
+
+	// hashes are computed from the bottom of the tree up
+	hashes := make(map[string][]byte)
+	inProgress := make(map[string]bool)
+	var hash func(e *data.Edge) []byte
+	hash = func(e *data.Edge) []byte {
+		if h, ok := hashes[e.ID]; ok {
+			return h
+		}
+
+		inProgress[e.ID] = true
+
+		var downEdges []*data.Edge
+		for _, d := range valid[e.Down] {
+			// skip edges in cycles
+			if inProgress[d.ID] {
+				continue
+			}
+			downEdges = append(downEdges, &data.Edge{ID: d.ID, Hash: hash(d)})
+		}
+
+		up := &data.Edge{ID: e.ID, Points: e.Points}
+		updateHash(&data.Node{ID: e.Down, Points: nodes[e.Down]}, []*data.Edge{up}, downEdges)
+
+		delete(inProgress, e.ID)
+		hashes[e.ID] = up.Hash
+		return up.Hash
+	}
+
+	ret.hashes = make(map[string][]byte)
+
+	for i := range s.Edges {
+		e := &s.Edges[i]
+		if !validIDs[e.ID] {
+			continue
+		}
+
+		h := hash(e)
+		if bytes.Equal(h, e.Hash) {
+			continue
+		}
+
+		ret.hashes[e.ID] = h
+
+		// the store does not keep hashes up to date yet, so an edge that
+		// has never been hashed is not a problem
+		if len(e.Hash) > 0 {
+			addProblem(data.StoreProblem{
+				Type:        data.StoreProblemHash,
+				NodeID:      e.Down,
+				EdgeID:      e.ID,
+				Description: fmt.Sprintf("hash of edge from %v to %v does not match", e.Up, e.Down),
+			})
+		}
+	}
+
+	return ret
+}
+
+// sqlRepairEdges deletes edges and their points, and writes edge hashes in
+// one transaction. It is shared by the sqlite and postgres backends.
+func sqlRepairEdges(db *sql.DB, rebind func(string) string, deleteIDs []string,
+	hashes map[string][]byte) error {
+	return sqlTransaction(db, func(tx *sql.Tx) error {
+		for _, id := range deleteIDs {
+			_, err := tx.Exec(rebind("DELETE FROM edge_points WHERE edge_id=?"), id)
+			if err != nil {
+				return fmt.Errorf("Error deleting edge points: %w", err)
+			}
+
+			_, err = tx.Exec(rebind("DELETE FROM edges WHERE id=?"), id)
+			if err != nil {
+				return fmt.Errorf("Error deleting edge: %w", err)
+			}
+		}
+
+		for id, h := range hashes {
+			_, err := tx.Exec(rebind("UPDATE edges SET hash=? WHERE id=?"), h, id)
+			if err != nil {
+				return fmt.Errorf("Error writing edge hash: %w", err)
+			}
+		}
+
+		return nil
+	})
+}
+
+// handleVerify verifies the store and replies with a JSON encoded report (see
+// client.StoreVerify)
+func (st *Store) handleVerify(msg *nats.Msg) {
+	repair := false
+
+	if len(msg.Data) > 0 {
+		pts, err := client.DecodePoints(msg)
+		if err != nil {
+			log.Println("Error decoding store verify request: ", err)
+		}
+
+		for _, p := range pts {
+			if p.Type == data.PointTypeRepair {
+				repair = data.FloatToBool(p.Value)
+			}
+		}
+	}
+
+	report, err := st.Verify(repair)
+	if err != nil {
+		log.Println("Error verifying store: ", err)
+		report.Error = err.Error()
+	}
+
+	for _, p := range report.Problems {
+		log.Println("Store verify: ", p)
+	}
+
+	if msg.Reply == "" {
+		return
+	}
+
+	d, err := json.Marshal(report)
+	if err != nil {
+		log.Println("Error encoding store verify report: ", err)
+		return
+	}
+
+	err = st.nc.Publish(msg.Reply, d)
+	if err != nil {
+		log.Println("Error sending store verify report: ", err)
+	}
+}
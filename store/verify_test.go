@@ -0,0 +1,230 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+func problemTypes(problems []data.StoreProblem) map[string]int {
+	ret := make(map[string]int)
+	for _, p := range problems {
+		ret[p.Type]++
+	}
+	return ret
+}
+
+func TestVerifySnapshot(t *testing.T) {
+	now := time.Now()
+	typ := func(t string) data.Points {
+		return data.Points{{Time: now, Type: data.PointTypeNodeType, Text: t}}
+	}
+
+	s := &snapshot{
+		RootID: "root",
+		Nodes: []snapshotNode{
+			{ID: "root", Points: typ(data.NodeTypeDevice)},
+			{ID: "v1", Points: typ(data.NodeTypeVariable)},
+			// lost is not connected to the tree, and has a child
+			{ID: "lost", Points: typ(data.NodeTypeGroup)},
+			{ID: "lostChild", Points: typ(data.NodeTypeVariable)},
+			{ID: "noType", Points: data.Points{{Time: now, Type: data.PointTypeNodeType,
+				Text: data.NodeTypeVariable, Tombstone: 1}}},
+		},
+		Edges: []data.Edge{
+			{ID: "e1", Up: "none", Down: "root", Points: data.Points{
+				{Time: now, Type: data.PointTypeTombstone, Value: 1}}},
+			{ID: "e2", Up: "root", Down: "v1"},
+			{ID: "e3", Up: "root", Down: "missing"},
+			{ID: "e4", Up: "lost", Down: "lostChild"},
+			{ID: "e5", Up: "root", Down: "noType"},
+		},
+	}
+
+	res := verifySnapshot(s)
+
+	exp := map[string]int{
+		data.StoreProblemTombstone:  2,
+		data.StoreProblemOrphanEdge: 1,
+		data.StoreProblemOrphanNode: 1,
+	}
+
+	got := problemTypes(res.problems)
+	for k, v := range exp {
+		if got[k] != v {
+			t.Errorf("Expected %v %v problems, got %v: %v", v, k, got[k], res.problems)
+		}
+	}
+
+	if len(res.deleteEdges) != 1 || res.deleteEdges[0].id != "e3" {
+		t.Error("Expected e3 to be deleted: ", res.deleteEdges)
+	}
+
+	// the root is undeleted and lost is added to the root. lostChild is
+	// reached through lost.
+	if len(res.edgePoints) != 2 {
+		t.Fatal("Expected 2 edge repairs: ", res.edgePoints)
+	}
+
+	if res.edgePoints[1].nodeID != "lost" || res.edgePoints[1].parentID != "root" {
+		t.Error("Wrong orphan repair: ", res.edgePoints[1])
+	}
+
+	// all valid edges are hashed
+	if len(res.hashes) != 4 {
+		t.Fatal("Expected 4 hashes: ", len(res.hashes))
+	}
+
+	// stored hashes that match are not problems, and changed hashes are
+	for i := range s.Edges {
+		s.Edges[i].Hash = res.hashes[s.Edges[i].ID]
+	}
+
+	s.Nodes[1].Points = append(s.Nodes[1].Points, data.Point{Time: now.Add(time.Second),
+		Type: data.PointTypeValue, Value: 1})
+
+	res = verifySnapshot(s)
+
+	var hashEdges []string
+	for _, p := range res.problems {
+		if p.Type == data.StoreProblemHash {
+			hashEdges = append(hashEdges, p.EdgeID)
+		}
+	}
+
+	// v1 changed, which changes the hash of its edge and the root edge
+	if len(hashEdges) != 2 || hashEdges[0] != "e1" || hashEdges[1] != "e2" {
+		t.Error("Expected e1 and e2 hash problems, got: ", hashEdges)
+	}
+}
+
+func TestStoreVerify(t *testing.T) {
+	nc, st, _ := startBatchTestStore(t, 0)
+
+	root := st.db.rootNodeID()
+
+	report, err := client.StoreVerify(nc, false)
+	if err != nil {
+		t.Fatal("Error verifying store: ", err)
+	}
+
+	if len(report.Problems) != 0 {
+		t.Fatal("New store has problems: ", report.Problems)
+	}
+
+	// an edge to a node that does not exist and a node without an edge
+	err = st.db.edgePoints("missing", root, data.Points{{Time: time.Now(),
+		Type: data.PointTypeTombstone, Value: 0}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = st.db.nodePoints("lost", data.Points{{Time: time.Now(),
+		Type: data.PointTypeNodeType, Text: data.NodeTypeVariable}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err = client.StoreVerify(nc, false)
+	if err != nil {
+		t.Fatal("Error verifying store: ", err)
+	}
+
+	got := problemTypes(report.Problems)
+	if len(report.Problems) != 2 || got[data.StoreProblemOrphanEdge] != 1 ||
+		got[data.StoreProblemOrphanNode] != 1 {
+		t.Fatal("Wrong problems: ", report.Problems)
+	}
+
+	report, err = client.StoreVerify(nc, true)
+	if err != nil {
+		t.Fatal("Error repairing store: ", err)
+	}
+
+	for _, p := range report.Problems {
+		if !p.Repaired {
+			t.Error("Problem not repaired: ", p)
+		}
+	}
+
+	report, err = client.StoreVerify(nc, false)
+	if err != nil {
+		t.Fatal("Error verifying store: ", err)
+	}
+
+	if len(report.Problems) != 0 {
+		t.Fatal("Problems after repair: ", report.Problems)
+	}
+
+	// the lost node is now a deleted child of the root node
+	children, err := st.db.children(root, data.NodeTypeVariable, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(children) != 1 || children[0].ID != "lost" {
+		t.Fatal("Lost node not added to root: ", children)
+	}
+
+	if ts, _ := children[0].IsTombstone(); !ts {
+		t.Error("Lost node should be deleted")
+	}
+}
+
+func TestDbSqliteRepairEdges(t *testing.T) {
+	db := newTestDb(t)
+	defer db.Close()
+
+	testBackendRepairEdges(t, db)
+}
+
+func TestMemoryRepairEdges(t *testing.T) {
+	testBackendRepairEdges(t, newTestMemoryBackend(t))
+}
+
+func testBackendRepairEdges(t *testing.T, db backend) {
+	root := db.rootNodeID()
+
+	err := db.edgePoints("missing", root, data.Points{{Time: time.Now(),
+		Type: data.PointTypeTombstone, Value: 0}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := db.snapshot(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var deleteID string
+	hashes := make(map[string][]byte)
+	for _, e := range s.Edges {
+		if e.Down == "missing" {
+			deleteID = e.ID
+		} else {
+			hashes[e.ID] = []byte{1, 2, 3}
+		}
+	}
+
+	err = db.repairEdges([]string{deleteID}, hashes)
+	if err != nil {
+		t.Fatal("Error repairing edges: ", err)
+	}
+
+	s, err = db.snapshot(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(s.Edges) != len(hashes) {
+		t.Fatal("Edge not deleted: ", s.Edges)
+	}
+
+	for _, e := range s.Edges {
+		if string(e.Hash) != string(hashes[e.ID]) {
+			t.Error("Hash not written: ", e)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+// watch sends point changes that match a filter to a subject (see
+// client.Watch)
+type watch struct {
+	deliver    string
+	parent     string
+	nodeTypes  map[string]bool
+	pointTypes map[string]bool
+	deadband   float64
+	expires    time.Time
+	// last point sent by node ID and point type and key, used for the
+	// deadband
+	last map[string]data.Point
+}
+
+// watchList holds the active watches by ID
+type watchList struct {
+	lock    sync.Mutex
+	watches map[string]*watch
+}
+
+func newWatch(req client.WatchRequest) *watch {
+	w := &watch{
+		deliver:  req.Deliver,
+		parent:   req.Filter.Parent,
+		deadband: req.Filter.Deadband,
+		last:     make(map[string]data.Point),
+	}
+
+	if len(req.Filter.NodeTypes) > 0 {
+		w.nodeTypes = make(map[string]bool)
+		for _, t := range req.Filter.NodeTypes {
+			w.nodeTypes[t] = true
+		}
+	}
+
+	if len(req.Filter.PointTypes) > 0 {
+		w.pointTypes = make(map[string]bool)
+		for _, t := range req.Filter.PointTypes {
+			w.pointTypes[t] = true
+		}
+	}
+
+	return w
+}
+
+// filter returns the points of a node that pass the point type filter and
+// the deadband, and records them as sent. Must be called with the watch
+// list lock held.
+func (w *watch) filter(nodeID string, points data.Points) data.Points {
+	var ret data.Points
+
+	for _, p := range points {
+		if w.pointTypes != nil && !w.pointTypes[p.Type] {
+			continue
+		}
+
+		if w.deadband > 0 {
+			key := nodeID + "." + p.Type + "." + p.Key
+			last, ok := w.last[key]
+			if ok && last.Text == p.Text &&
+				math.Abs(last.Value-p.Value) < w.deadband {
+				continue
+			}
+			w.last[key] = p
+		}
+
+		ret = append(ret, p)
+	}
+
+	return ret
+}
+
+// handleWatch creates, renews, and cancels watches
+func (st *Store) handleWatch(msg *nats.Msg) {
+	var req client.WatchRequest
+	err := json.Unmarshal(msg.Data, &req)
+	if err != nil {
+		st.reply(msg.Reply, fmt.Errorf("Error decoding watch request: %w", err))
+		return
+	}
+
+	if req.ID == "" || req.Deliver == "" {
+		st.reply(msg.Reply, errors.New("watch ID and deliver subject are required"))
+		return
+	}
+
+	if req.Filter.Deadband < 0 {
+		st.reply(msg.Reply, errors.New("watch deadband must not be negative"))
+		return
+	}
+
+	st.watches.lock.Lock()
+	defer st.watches.lock.Unlock()
+
+	if req.Cancel {
+		delete(st.watches.watches, req.ID)
+		st.reply(msg.Reply, nil)
+		return
+	}
+
+	if st.watches.watches == nil {
+		st.watches.watches = make(map[string]*watch)
+	}
+
+	w := newWatch(req)
+	if existing, ok := st.watches.watches[req.ID]; ok {
+		// keep the deadband state when renewing
+		w.last = existing.last
+	}
+	w.expires = time.Now().Add(client.WatchTTL)
+	st.watches.watches[req.ID] = w
+
+	st.reply(msg.Reply, nil)
+}
+
+// watchPoints sends points that have been written to the watches that
+// match them
+func (st *Store) watchPoints(node *data.Node, points data.Points) {
+	now := time.Now()
+
+	st.watches.lock.Lock()
+	var watches []*watch
+	for id, w := range st.watches.watches {
+		if now.After(w.expires) {
+			delete(st.watches.watches, id)
+			continue
+		}
+
+		if w.nodeTypes != nil && !w.nodeTypes[node.Type] {
+			continue
+		}
+
+		watches = append(watches, w)
+	}
+	st.watches.lock.Unlock()
+
+	for _, w := range watches {
+		// walking up the tree needs the db, so is done without the lock
+		if w.parent != "" && w.parent != "root" && !st.isBelow(node.ID, w.parent) {
+			continue
+		}
+
+		st.watches.lock.Lock()
+		send := w.filter(node.ID, points)
+		st.watches.lock.Unlock()
+
+		if len(send) <= 0 {
+			continue
+		}
+
+		err := client.SendPoints(st.nc, w.deliver+"."+node.ID, send, false)
+		if err != nil {
+			log.Println("Error sending watch points: ", err)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/simpleiot/simpleiot/client"
+	"github.com/simpleiot/simpleiot/data"
+)
+
+func TestWatch(t *testing.T) {
+	nc, st, _ := startBatchTestStore(t, -1)
+
+	root := st.db.rootNodeID()
+
+	err := client.SendNodeType(nc, client.Variable{ID: "v1", Parent: root,
+		Description: "outside"}, "test")
+	if err != nil {
+		t.Fatal("Error sending node: ", err)
+	}
+
+	err = client.SendNodeType(nc, client.Variable{ID: "d1", Parent: root,
+		Description: "site"}, "test")
+	if err != nil {
+		t.Fatal("Error sending node: ", err)
+	}
+
+	err = client.SendNodeType(nc, client.Variable{ID: "v2", Parent: "d1",
+		Description: "inside"}, "test")
+	if err != nil {
+		t.Fatal("Error sending node: ", err)
+	}
+
+	err = client.SendNodeType(nc, client.Kafka{ID: "k1", Parent: "d1",
+		Description: "not a variable"}, "test")
+	if err != nil {
+		t.Fatal("Error sending node: ", err)
+	}
+
+	type update struct {
+		nodeID string
+		points data.Points
+	}
+
+	updates := make(chan update, 10)
+
+	w, err := client.Watch(nc, client.WatchFilter{
+		Parent:     "d1",
+		NodeTypes:  []string{data.NodeTypeVariable},
+		PointTypes: []string{data.PointTypeValue},
+		Deadband:   1,
+	}, func(nodeID string, points data.Points) {
+		updates <- update{nodeID, points}
+	})
+	if err != nil {
+		t.Fatal("Error creating watch: ", err)
+	}
+
+	send := func(id, typ string, v float64) {
+		t.Helper()
+		err := client.SendNodePoint(nc, id, data.Point{Time: time.Now(),
+			Type: typ, Value: v}, true)
+		if err != nil {
+			t.Fatal("Error sending point: ", err)
+		}
+	}
+
+	// filtered by parent, node type, point type, and deadband
+	send("v1", data.PointTypeValue, 10)
+	send("k1", data.PointTypeValue, 10)
+	send("v2", data.PointTypeDescription, 0)
+	send("v2", data.PointTypeValue, 10)
+	send("v2", data.PointTypeValue, 10.5)
+	send("v2", data.PointTypeValue, 11.5)
+
+	for _, exp := range []float64{10, 11.5} {
+		select {
+		case u := <-updates:
+			if u.nodeID != "v2" || len(u.points) != 1 ||
+				u.points[0].Type != data.PointTypeValue ||
+				u.points[0].Value != exp {
+				t.Fatalf("Expected v2 value %v, got %v: %v", exp, u.nodeID, u.points)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Timeout waiting for watch update")
+		}
+	}
+
+	select {
+	case u := <-updates:
+		t.Fatal("Unexpected update: ", u)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	err = w.Stop()
+	if err != nil {
+		t.Fatal("Error stopping watch: ", err)
+	}
+
+	st.watches.lock.Lock()
+	n := len(st.watches.watches)
+	st.watches.lock.Unlock()
+
+	if n != 0 {
+		t.Fatal("Expected watch to be removed, got: ", n)
+	}
+
+	// expired watches are dropped
+	st.watches.lock.Lock()
+	st.watches.watches["expired"] = &watch{deliver: "expired",
+		expires: time.Now().Add(-time.Second)}
+	st.watches.lock.Unlock()
+
+	send("v2", data.PointTypeValue, 20)
+
+	st.watches.lock.Lock()
+	n = len(st.watches.watches)
+	st.watches.lock.Unlock()
+
+	if n != 0 {
+		t.Fatal("Expected expired watch to be removed, got: ", n)
+	}
+}